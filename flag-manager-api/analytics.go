@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+const (
+	defaultActivityWindow = 30 * 24 * time.Hour
+	maxActivityPeriods    = 1000
+)
+
+// ActivitySeries is the flag activity time series of one group. Group is empty
+// when activity is not split by project or actor.
+type ActivitySeries struct {
+	Group  string             `json:"group"`
+	Points []db.ActivityCount `json:"points"`
+}
+
+// truncatePeriod returns the start of the UTC period containing t, matching
+// PostgreSQL's date_trunc (weeks start on Monday).
+func truncatePeriod(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	if interval == "hour" {
+		return t.Truncate(time.Hour)
+	}
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// nextPeriod returns the start of the period following start.
+func nextPeriod(start time.Time, interval string) time.Time {
+	switch interval {
+	case "hour":
+		return start.Add(time.Hour)
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// activityPeriods returns the start of every period overlapping [since, until).
+func activityPeriods(since, until time.Time, interval string) []time.Time {
+	var periods []time.Time
+	for p := truncatePeriod(since, interval); p.Before(until); p = nextPeriod(p, interval) {
+		periods = append(periods, p)
+	}
+	return periods
+}
+
+// buildActivitySeries groups activity counts into one series per group, with
+// zero points for periods without activity so the series chart continuously.
+func buildActivitySeries(counts []db.ActivityCount, periods []time.Time) []ActivitySeries {
+	byGroup := make(map[string]map[time.Time]db.ActivityCount)
+	for _, c := range counts {
+		if byGroup[c.Group] == nil {
+			byGroup[c.Group] = make(map[time.Time]db.ActivityCount)
+		}
+		byGroup[c.Group][c.Period] = c
+	}
+	if len(byGroup) == 0 {
+		byGroup[""] = nil
+	}
+
+	groups := make([]string, 0, len(byGroup))
+	for group := range byGroup {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	series := make([]ActivitySeries, 0, len(groups))
+	for _, group := range groups {
+		points := make([]db.ActivityCount, 0, len(periods))
+		for _, p := range periods {
+			c, ok := byGroup[group][p]
+			if !ok {
+				c = db.ActivityCount{Period: p}
+			}
+			c.Group = ""
+			points = append(points, c)
+		}
+		series = append(series, ActivitySeries{Group: group, Points: points})
+	}
+	return series
+}
+
+// ActivityAnalyticsResponse is the flag activity over a time window.
+type ActivityAnalyticsResponse struct {
+	GroupBy   string           `json:"groupBy"`
+	Dimension string           `json:"dimension"`
+	Since     time.Time        `json:"since"`
+	Until     time.Time        `json:"until"`
+	Series    []ActivitySeries `json:"series"`
+}
+
+// getActivityAnalyticsHandler returns flag create/update/delete counts over
+// time derived from audit events, optionally split by project or actor.
+func (fm *FlagManager) getActivityAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	if fm.store == nil {
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for analytics")
+		return
+	}
+
+	q := r.URL.Query()
+
+	interval := q.Get("groupBy")
+	if interval == "" {
+		interval = "day"
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		writeValidationError(w, "INVALID_GROUP_BY", "groupBy must be day, week or month")
+		return
+	}
+
+	dimension := q.Get("dimension")
+	if dimension != "" && dimension != "project" && dimension != "actor" {
+		writeValidationError(w, "INVALID_DIMENSION", "dimension must be project or actor")
+		return
+	}
+
+	until := time.Now().UTC()
+	if s := q.Get("until"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			writeValidationError(w, "INVALID_TIME_RANGE", "until must be an RFC 3339 timestamp")
+			return
+		}
+		until = t.UTC()
+	}
+	since := until.Add(-defaultActivityWindow)
+	if s := q.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			writeValidationError(w, "INVALID_TIME_RANGE", "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = t.UTC()
+	}
+	if !since.Before(until) {
+		writeValidationError(w, "INVALID_TIME_RANGE", "since must be before until")
+		return
+	}
+
+	periods := activityPeriods(since, until, interval)
+	if len(periods) > maxActivityPeriods {
+		writeValidationError(w, "INVALID_TIME_RANGE", "time range spans too many periods; use a larger groupBy or a shorter range")
+		return
+	}
+
+	counts, err := fm.store.FlagActivity(r.Context(), db.ActivityParams{
+		Interval:  interval,
+		Dimension: dimension,
+		Since:     since,
+		Until:     until,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ActivityAnalyticsResponse{
+		GroupBy:   interval,
+		Dimension: dimension,
+		Since:     since,
+		Until:     until,
+		Series:    buildActivitySeries(counts, periods),
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestActivitySeries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	// 2024-03-06 is a Wednesday; weeks start on Monday like date_trunc
+	if got := truncatePeriod(time.Date(2024, 3, 6, 15, 0, 0, 0, time.UTC), "week"); !got.Equal(day(4)) {
+		t.Errorf("Expected week to start on 2024-03-04, got %s", got)
+	}
+	if got := truncatePeriod(day(6), "month"); !got.Equal(day(1)) {
+		t.Errorf("Expected month to start on 2024-03-01, got %s", got)
+	}
+
+	periods := activityPeriods(day(1).Add(12*time.Hour), day(4), "day")
+	if len(periods) != 3 || !periods[0].Equal(day(1)) {
+		t.Fatalf("Expected 3 daily periods from 2024-03-01, got %v", periods)
+	}
+
+	series := buildActivitySeries([]db.ActivityCount{
+		{Period: day(1), Group: "web", Created: 2},
+		{Period: day(3), Group: "api", Updated: 1, Deleted: 1},
+	}, periods)
+	if len(series) != 2 || series[0].Group != "api" || series[1].Group != "web" {
+		t.Fatalf("Expected api and web series, got %+v", series)
+	}
+	for _, s := range series {
+		if len(s.Points) != 3 {
+			t.Fatalf("Expected gap-filled series, got %+v", s)
+		}
+	}
+	if web := series[1].Points; web[0].Created != 2 || web[1] != (db.ActivityCount{Period: day(2)}) {
+		t.Errorf("Unexpected web series: %+v", web)
+	}
+
+	if empty := buildActivitySeries(nil, periods); len(empty) != 1 || len(empty[0].Points) != 3 {
+		t.Errorf("Expected a single zero series without activity, got %+v", empty)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -30,13 +31,28 @@ func setupTestFlagManager(t *testing.T) (*FlagManager, string, func()) {
 	}
 
 	fm := &FlagManager{
-		config:       config,
-		integrations: NewIntegrationsStore(tempDir),
-		flagSets:     NewFlagSetsStore(tempDir),
-		notifiers:    NewNotifiersStore(tempDir),
-		exporters:    NewExportersStore(tempDir),
-		retrievers:   NewRetrieversStore(tempDir),
+		config:            config,
+		integrations:      NewIntegrationsStore(tempDir, nil),
+		flagSets:          NewFlagSetsStore(tempDir),
+		notifiers:         NewNotifiersStore(tempDir, nil),
+		exporters:         NewExportersStore(tempDir, nil),
+		retrievers:        NewRetrieversStore(tempDir, nil),
+		settings:          NewSettingsStore(tempDir),
+		projectMeta:       NewProjectMetaStore(tempDir, nil),
+		proposals:         NewProposalsStore(tempDir),
+		templates:         NewFlagTemplatesStore(tempDir),
+		auditSinks:        NewAuditSinksStore(tempDir, nil),
+		publishTargets:    NewPublishTargetsStore(tempDir, nil),
+		notificationRules: NewNotificationRulesStore(tempDir),
+		policies:          NewPoliciesStore(tempDir),
+		codeReferences:    NewCodeReferencesStore(tempDir),
+		changeRequests:    NewChangeRequestsStore(tempDir),
+		gitSync:           NewGitSyncStore(tempDir),
+		auditLog:          NewAuditLogStore(tempDir, defaultAuditLogMaxSize, defaultAuditLogMaxFiles),
+		changes:           NewChangeFeed(),
 	}
+	fm.storage = newPolicyStorage(fm, &fileStorage{fm: fm})
+	fm.audit = NewFileAuditLogger(fm.auditLog, fm.changes)
 
 	cleanup := func() {
 		os.RemoveAll(tempDir)
@@ -47,29 +63,122 @@ func setupTestFlagManager(t *testing.T) (*FlagManager, string, func()) {
 
 func setupTestRouter(fm *FlagManager) *mux.Router {
 	r := mux.NewRouter()
+	r.Use(fm.authorize)
 
 	// Health check
 	r.HandleFunc("/health", fm.healthHandler).Methods("GET")
+	r.HandleFunc("/healthz", fm.livenessHandler).Methods("GET")
+	r.HandleFunc("/readyz", fm.readinessHandler).Methods("GET")
+	r.HandleFunc("/metrics", fm.metricsHandler).Methods("GET")
 
 	// Configuration
 	r.HandleFunc("/api/config", fm.getConfigHandler).Methods("GET")
 
+	// Settings
+	r.HandleFunc("/api/settings", fm.getSettingsHandler).Methods("GET")
+	r.HandleFunc("/api/settings", fm.updateSettingsHandler).Methods("PUT")
+
 	// Raw flags
 	r.HandleFunc("/api/flags/raw", fm.getRawFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/relay-proxy/status", fm.relayProxyStatusHandler).Methods("GET")
 	r.HandleFunc("/api/flags/raw/{project}", fm.getRawProjectFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/flags/signing-key", fm.signingKeyHandler).Methods("GET")
+	r.HandleFunc("/api/flags/openfeature", fm.getOpenFeatureFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/flags/stale", fm.staleFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/flags/owned", fm.ownedFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/tags", fm.listTagsHandler).Methods("GET")
+	r.HandleFunc("/api/search", fm.searchHandler).Methods("GET")
+	r.HandleFunc("/api/diff", fm.diffHandler).Methods("GET")
+	r.HandleFunc("/api/evaluate/{project}/{flagKey}", fm.evaluateFlagHandler).Methods("POST")
+	r.HandleFunc("/api/ws", fm.changeFeedHandler).Methods("GET")
+	r.HandleFunc("/api/audit", fm.listAuditEventsHandler).Methods("GET")
+	r.HandleFunc("/api/audit/export", fm.exportAuditEventsHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/audit", fm.getFlagAuditHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/code-references", fm.getCodeReferencesHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/reconciliation", fm.reconciliationHandler).Methods("GET")
+	r.HandleFunc("/api/change-requests", fm.listChangeRequestsHandler).Methods("GET")
+	r.HandleFunc("/api/change-requests", fm.createChangeRequestHandler).Methods("POST")
+	r.HandleFunc("/api/change-requests/count", fm.countChangeRequestsHandler).Methods("GET")
+	r.HandleFunc("/api/change-requests/bulk-cancel", fm.bulkCancelChangeRequestsHandler).Methods("POST")
+	r.HandleFunc("/api/change-requests/{id}", fm.getChangeRequestHandler).Methods("GET")
+	r.HandleFunc("/api/change-requests/{id}/preview", fm.previewChangeRequestHandler).Methods("GET")
+	r.HandleFunc("/api/change-requests/{id}/review", fm.reviewChangeRequestHandler).Methods("POST")
+	r.HandleFunc("/api/change-requests/{id}/apply", fm.applyChangeRequestHandler).Methods("POST")
+	r.HandleFunc("/api/change-requests/{id}/cancel", fm.cancelChangeRequestHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/simulate", fm.simulateFlagHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/publish", fm.publishFlagHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/archive", fm.archiveFlagHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/restore", fm.restoreFlagHandler).Methods("POST")
+	r.HandleFunc("/api/ramps", fm.listRampsHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/ramp", fm.getFlagRampHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/ramp", fm.putFlagRampHandler).Methods("PUT")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/ramp", fm.deleteFlagRampHandler).Methods("DELETE")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/ramp/pause", fm.pauseFlagRampHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/ramp/resume", fm.resumeFlagRampHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/versions", fm.getFlagVersionsHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/rollback/{versionId}", fm.rollbackFlagHandler).Methods("POST")
+	r.HandleFunc("/api/evaluations", fm.ingestEvaluationsHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/stats", fm.flagStatsHandler).Methods("GET")
 
 	// Projects
 	r.HandleFunc("/api/projects", fm.listProjectsHandler).Methods("GET")
 	r.HandleFunc("/api/projects/{project}", fm.getProjectHandler).Methods("GET")
 	r.HandleFunc("/api/projects/{project}", fm.createProjectHandler).Methods("POST")
 	r.HandleFunc("/api/projects/{project}", fm.deleteProjectHandler).Methods("DELETE")
+	r.HandleFunc("/api/trash", fm.listTrashHandler).Methods("GET")
+	r.HandleFunc("/api/trash/{id}/restore", fm.restoreTrashHandler).Methods("POST")
+	r.HandleFunc("/api/trash/{id}", fm.purgeTrashHandler).Methods("DELETE")
+	r.HandleFunc("/api/projects/{project}/attributes", fm.listProjectAttributesHandler).Methods("GET")
+
+	// Bulk operations
+	r.HandleFunc("/api/projects/{project}/flags/bulk-toggle", fm.bulkToggleHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/bulk-delete", fm.bulkDeleteHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/bulk-metadata", fm.bulkMetadataHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/bulk-tags", fm.bulkTagsHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/bulk-update-targeting", fm.bulkUpdateTargetingHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/health", fm.projectHealthHandler).Methods("GET", "POST")
 
 	// Flags
 	r.HandleFunc("/api/projects/{project}/flags", fm.listFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/segments/validate", fm.validateSegmentHandler).Methods("POST")
+	r.HandleFunc("/api/segments", fm.createSegmentHandler).Methods("POST")
+	r.HandleFunc("/api/segments/{id}", fm.updateSegmentHandler).Methods("PUT")
+	r.HandleFunc("/api/segments/{id}/rename-preview", fm.segmentRenamePreviewHandler).Methods("GET")
+	r.HandleFunc("/api/segments/{id}/versions", fm.listSegmentVersionsHandler).Methods("GET")
+	r.HandleFunc("/api/segments/{id}/rollback/{version}", fm.rollbackSegmentHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/git-diff", fm.getProjectGitDiffHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/webhook", fm.getProjectWebhookHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/webhook", fm.updateProjectWebhookHandler).Methods("PUT")
+	r.HandleFunc("/api/projects/{project}/webhook", fm.deleteProjectWebhookHandler).Methods("DELETE")
+	r.HandleFunc("/api/projects/{project}/webhooks", fm.listProjectWebhookSubscriptionsHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/webhooks", fm.createProjectWebhookSubscriptionHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/webhooks/{id}", fm.getProjectWebhookSubscriptionHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/webhooks/{id}", fm.updateProjectWebhookSubscriptionHandler).Methods("PUT")
+	r.HandleFunc("/api/projects/{project}/webhooks/{id}", fm.deleteProjectWebhookSubscriptionHandler).Methods("DELETE")
+	r.HandleFunc("/api/projects/{project}/webhooks/{id}/deliveries", fm.listProjectWebhookDeliveriesHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/webhooks/{id}/deliveries/{deliveryId}/redeliver", fm.redeliverProjectWebhookHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/naming-rules", fm.getNamingRulesHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/naming-rules", fm.updateNamingRulesHandler).Methods("PUT")
+	r.HandleFunc("/api/projects/{project}/naming-rules", fm.deleteNamingRulesHandler).Methods("DELETE")
+	r.HandleFunc("/api/lint/flags", fm.lintFlagsHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/export", fm.exportProjectHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/import", fm.importProjectHandler).Methods("POST")
+	r.HandleFunc("/api/flags/import", fm.importFlagsHandler).Methods("POST")
 	r.HandleFunc("/api/projects/{project}/flags/{flagKey}", fm.getFlagHandler).Methods("GET")
 	r.HandleFunc("/api/projects/{project}/flags/{flagKey}", fm.createFlagHandler).Methods("POST")
 	r.HandleFunc("/api/projects/{project}/flags/{flagKey}", fm.updateFlagHandler).Methods("PUT")
 	r.HandleFunc("/api/projects/{project}/flags/{flagKey}", fm.deleteFlagHandler).Methods("DELETE")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/clone", fm.cloneFlagHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/propose", fm.proposeFlagChangeHandler).Methods("POST")
+	r.HandleFunc("/api/proposals", fm.listProposalsHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/ack-stale", fm.ackStaleFlagHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/environments", fm.listProjectEnvironmentsHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/environments/{environment}", fm.createProjectEnvironmentHandler).Methods("POST")
+	r.HandleFunc("/api/projects/{project}/environments/{environment}", fm.deleteProjectEnvironmentHandler).Methods("DELETE")
+	r.HandleFunc("/api/projects/{project}/environments/{environment}/flags", fm.listEnvironmentFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/projects/{project}/environments/{environment}/flags/{flagKey}", fm.updateEnvironmentFlagHandler).Methods("PUT")
+	r.HandleFunc("/api/projects/{project}/environments/{environment}/flags/{flagKey}", fm.deleteEnvironmentFlagHandler).Methods("DELETE")
+	r.HandleFunc("/api/projects/{project}/flags/{flagKey}/promote", fm.promoteFlagHandler).Methods("POST")
 
 	// Integrations
 	r.HandleFunc("/api/integrations", fm.listIntegrationsHandler).Methods("GET")
@@ -77,13 +186,60 @@ func setupTestRouter(fm *FlagManager) *mux.Router {
 	r.HandleFunc("/api/integrations/{id}", fm.getIntegrationHandler).Methods("GET")
 	r.HandleFunc("/api/integrations/{id}", fm.updateIntegrationHandler).Methods("PUT")
 	r.HandleFunc("/api/integrations/{id}", fm.deleteIntegrationHandler).Methods("DELETE")
+	r.HandleFunc("/api/integrations/{id}/test", fm.testIntegrationHandler).Methods("POST")
+	r.HandleFunc("/api/integrations/{id}/sync", fm.syncIntegrationHandler).Methods("POST")
+	r.HandleFunc("/api/webhooks/git/{integrationId}", fm.gitWebhookHandler).Methods("POST")
 
 	// Flag sets
+	r.HandleFunc("/api/admin/backup", fm.backupHandler).Methods("GET")
+	r.HandleFunc("/api/admin/rate-limits", fm.listRateLimitsHandler).Methods("GET")
+	r.HandleFunc("/api/admin/rate-limits", fm.resetRateLimitsHandler).Methods("DELETE")
+	r.HandleFunc("/api/admin/rate-limits/{client}", fm.resetRateLimitHandler).Methods("DELETE")
+	r.HandleFunc("/api/admin/secrets/rotate", fm.rotateSecretsHandler).Methods("POST")
+	r.HandleFunc("/api/roles", fm.listRolesHandler).Methods("GET")
+	r.HandleFunc("/api/users", fm.listUsersHandler).Methods("GET")
+	r.HandleFunc("/api/users/{userId}/roles", fm.setUserRolesHandler).Methods("PUT")
+	r.HandleFunc("/api/users/{userId}/permissions", fm.userPermissionsHandler).Methods("GET")
+	r.HandleFunc("/api/audit/sinks", fm.listAuditSinksHandler).Methods("GET")
+	r.HandleFunc("/api/audit/sinks", fm.createAuditSinkHandler).Methods("POST")
+	r.HandleFunc("/api/audit/sinks/{id}", fm.getAuditSinkHandler).Methods("GET")
+	r.HandleFunc("/api/audit/sinks/{id}", fm.updateAuditSinkHandler).Methods("PUT")
+	r.HandleFunc("/api/audit/sinks/{id}", fm.deleteAuditSinkHandler).Methods("DELETE")
+	r.HandleFunc("/api/audit/sinks/{id}/test", fm.testAuditSinkHandler).Methods("POST")
+	r.HandleFunc("/api/audit/sinks/{id}/dead-letters", fm.listAuditDeadLettersHandler).Methods("GET")
+	r.HandleFunc("/api/audit/sinks/{id}/dead-letters", fm.clearAuditDeadLettersHandler).Methods("DELETE")
+	r.HandleFunc("/api/audit/sinks/{id}/dead-letters/retry", fm.retryAuditDeadLettersHandler).Methods("POST")
+	r.HandleFunc("/api/publish-targets", fm.listPublishTargetsHandler).Methods("GET")
+	r.HandleFunc("/api/publish-targets", fm.createPublishTargetHandler).Methods("POST")
+	r.HandleFunc("/api/publish-targets/{id}", fm.getPublishTargetHandler).Methods("GET")
+	r.HandleFunc("/api/publish-targets/{id}", fm.updatePublishTargetHandler).Methods("PUT")
+	r.HandleFunc("/api/publish-targets/{id}", fm.deletePublishTargetHandler).Methods("DELETE")
+	r.HandleFunc("/api/publish-targets/{id}/publish", fm.publishTargetHandler).Methods("POST")
+	r.HandleFunc("/api/auth/role-mappings", fm.listRoleMappingsHandler).Methods("GET")
+	r.HandleFunc("/api/auth/role-mappings/debug", fm.debugRoleMappingsHandler).Methods("POST")
+	r.HandleFunc("/api/api-keys", fm.listAPIKeysHandler).Methods("GET")
+	r.HandleFunc("/api/api-keys", fm.createAPIKeyHandler).Methods("POST")
+	r.HandleFunc("/api/api-keys/{id}/rotate", fm.rotateAPIKeyHandler).Methods("POST")
+	r.HandleFunc("/api/templates", fm.listFlagTemplatesHandler).Methods("GET")
+	r.HandleFunc("/api/templates", fm.createFlagTemplateHandler).Methods("POST")
+	r.HandleFunc("/api/templates/{id}", fm.getFlagTemplateHandler).Methods("GET")
+	r.HandleFunc("/api/templates/{id}", fm.updateFlagTemplateHandler).Methods("PUT")
+	r.HandleFunc("/api/templates/{id}", fm.deleteFlagTemplateHandler).Methods("DELETE")
+	r.HandleFunc("/api/admin/restore", fm.restoreHandler).Methods("POST")
+	r.HandleFunc("/api/apply", fm.applyHandler).Methods("POST")
 	r.HandleFunc("/api/flagsets", fm.listFlagSetsHandler).Methods("GET")
 	r.HandleFunc("/api/flagsets", fm.createFlagSetHandler).Methods("POST")
+	r.HandleFunc("/api/flagsets/config/relay-proxy", fm.generateRelayProxyConfigHandler).Methods("GET")
 	r.HandleFunc("/api/flagsets/{id}", fm.getFlagSetHandler).Methods("GET")
 	r.HandleFunc("/api/flagsets/{id}", fm.updateFlagSetHandler).Methods("PUT")
 	r.HandleFunc("/api/flagsets/{id}", fm.deleteFlagSetHandler).Methods("DELETE")
+	r.HandleFunc("/api/flagsets/{id}/flags", fm.listFlagSetFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/flagsets/{id}/flags/raw", fm.getFlagSetRawFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/flagsets/{id}/effective-flags", fm.getFlagSetEffectiveFlagsHandler).Methods("GET")
+	r.HandleFunc("/api/flagsets/{id}/flags/{flagKey}", fm.getFlagSetFlagHandler).Methods("GET")
+	r.HandleFunc("/api/flagsets/{id}/flags/{flagKey}", fm.createFlagSetFlagHandler).Methods("POST")
+	r.HandleFunc("/api/flagsets/{id}/flags/{flagKey}", fm.updateFlagSetFlagHandler).Methods("PUT")
+	r.HandleFunc("/api/flagsets/{id}/flags/{flagKey}", fm.deleteFlagSetFlagHandler).Methods("DELETE")
 
 	// Notifiers
 	r.HandleFunc("/api/notifiers", fm.listNotifiersHandler).Methods("GET")
@@ -91,6 +247,20 @@ func setupTestRouter(fm *FlagManager) *mux.Router {
 	r.HandleFunc("/api/notifiers/{id}", fm.getNotifierHandler).Methods("GET")
 	r.HandleFunc("/api/notifiers/{id}", fm.updateNotifierHandler).Methods("PUT")
 	r.HandleFunc("/api/notifiers/{id}", fm.deleteNotifierHandler).Methods("DELETE")
+	r.HandleFunc("/api/notifiers/{id}/test", fm.testNotifierHandler).Methods("POST")
+	r.HandleFunc("/api/notifiers/{id}/status", fm.notifierStatusHandler).Methods("GET")
+	r.HandleFunc("/api/notification-rules", fm.listNotificationRulesHandler).Methods("GET")
+	r.HandleFunc("/api/notification-rules", fm.createNotificationRuleHandler).Methods("POST")
+	r.HandleFunc("/api/notification-rules/evaluate", fm.evaluateNotificationRulesHandler).Methods("POST")
+	r.HandleFunc("/api/notification-rules/{id}", fm.getNotificationRuleHandler).Methods("GET")
+	r.HandleFunc("/api/notification-rules/{id}", fm.updateNotificationRuleHandler).Methods("PUT")
+	r.HandleFunc("/api/notification-rules/{id}", fm.deleteNotificationRuleHandler).Methods("DELETE")
+	r.HandleFunc("/api/policies", fm.listPoliciesHandler).Methods("GET")
+	r.HandleFunc("/api/policies", fm.createPolicyHandler).Methods("POST")
+	r.HandleFunc("/api/policies/validate", fm.validatePoliciesHandler).Methods("POST")
+	r.HandleFunc("/api/policies/{id}", fm.getPolicyHandler).Methods("GET")
+	r.HandleFunc("/api/policies/{id}", fm.updatePolicyHandler).Methods("PUT")
+	r.HandleFunc("/api/policies/{id}", fm.deletePolicyHandler).Methods("DELETE")
 
 	// Exporters
 	r.HandleFunc("/api/exporters", fm.listExportersHandler).Methods("GET")
@@ -105,10 +275,35 @@ func setupTestRouter(fm *FlagManager) *mux.Router {
 	r.HandleFunc("/api/retrievers/{id}", fm.getRetrieverHandler).Methods("GET")
 	r.HandleFunc("/api/retrievers/{id}", fm.updateRetrieverHandler).Methods("PUT")
 	r.HandleFunc("/api/retrievers/{id}", fm.deleteRetrieverHandler).Methods("DELETE")
+	r.HandleFunc("/api/retrievers/{id}/usage", fm.getRetrieverUsageHandler).Methods("GET")
 
 	return r
 }
 
+// doRequest sends a request to handler and fails the test unless the response
+// has the expected status. The JSON response is decoded into v unless v is nil.
+func doRequest(t *testing.T, handler http.Handler, method, path, body string, status int, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveRequest(t, handler, httptest.NewRequest(method, path, strings.NewReader(body)), status, v)
+}
+
+// serveRequest is doRequest for a request built by the caller, for instance to
+// set headers.
+func serveRequest(t *testing.T, handler http.Handler, req *http.Request, status int, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != status {
+		t.Fatalf("%s %s: expected status %d, got %d: %s", req.Method, req.URL.RequestURI(), status, rr.Code, rr.Body.String())
+	}
+	if v != nil {
+		if err := json.Unmarshal(rr.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: invalid response: %v", req.Method, req.URL.RequestURI(), err)
+		}
+	}
+	return rr
+}
+
 // =============================================================================
 // HEALTH CHECK TESTS
 // =============================================================================
@@ -286,7 +481,8 @@ func TestFlagCRUD(t *testing.T) {
 
 	t.Run("create duplicate flag", func(t *testing.T) {
 		flagConfig := FlagConfig{
-			Variations: map[string]interface{}{"enabled": true},
+			Variations:  map[string]interface{}{"enabled": true},
+			DefaultRule: &DefaultRule{Variation: "enabled"},
 		}
 
 		body, _ := json.Marshal(flagConfig)
@@ -817,725 +1013,58 @@ func TestRawFlagsEndpoint(t *testing.T) {
 		}
 	})
 
-	t.Run("get raw flags for nonexistent project", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/flags/raw/nonexistent", nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusNotFound {
-			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
-		}
-	})
-}
-
-// =============================================================================
-// NOTIFIERS API TESTS
-// =============================================================================
-
-func TestNotifiersCRUD(t *testing.T) {
-	fm, _, cleanup := setupTestFlagManager(t)
-	defer cleanup()
-
-	router := setupTestRouter(fm)
-
-	t.Run("list empty notifiers", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/notifiers", nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	var createdID string
-
-	t.Run("create slack notifier", func(t *testing.T) {
-		notifier := map[string]interface{}{
-			"id":         "test-slack-notifier",
-			"name":       "slack-alerts",
-			"kind":       "slack",
-			"enabled":    true,
-			"webhookUrl": "https://hooks.slack.com/services/xxx",
-		}
-
-		body, _ := json.Marshal(notifier)
-		req := httptest.NewRequest("POST", "/api/notifiers", bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusCreated {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
-		}
-
-		var response map[string]interface{}
-		json.Unmarshal(rr.Body.Bytes(), &response)
-		createdID = response["id"].(string)
-	})
-
-	t.Run("get notifier", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/notifiers/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("update notifier", func(t *testing.T) {
-		notifier := map[string]interface{}{
-			"id":         createdID,
-			"name":       "slack-alerts-updated",
-			"kind":       "slack",
-			"enabled":    false,
-			"webhookUrl": "https://hooks.slack.com/services/yyy",
-		}
-
-		body, _ := json.Marshal(notifier)
-		req := httptest.NewRequest("PUT", "/api/notifiers/"+createdID, bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
-		}
-	})
-
-	t.Run("delete notifier", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/api/notifiers/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
-			t.Errorf("Expected status 200 or 204, got %d", rr.Code)
-		}
-	})
-}
-
-func TestAllNotifierTypes(t *testing.T) {
-	fm, _, cleanup := setupTestFlagManager(t)
-	defer cleanup()
-
-	router := setupTestRouter(fm)
-
-	testCases := []struct {
-		name     string
-		notifier map[string]interface{}
-	}{
-		{
-			name: "slack notifier",
-			notifier: map[string]interface{}{
-				"id":         "test-slack",
-				"name":       "slack",
-				"kind":       "slack",
-				"enabled":    true,
-				"webhookUrl": "https://hooks.slack.com/xxx",
-			},
-		},
-		{
-			name: "discord notifier",
-			notifier: map[string]interface{}{
-				"id":         "test-discord",
-				"name":       "discord",
-				"kind":       "discord",
-				"enabled":    true,
-				"webhookUrl": "https://discord.com/api/webhooks/xxx",
-			},
-		},
-		{
-			name: "microsoft teams notifier",
-			notifier: map[string]interface{}{
-				"id":         "test-teams",
-				"name":       "teams",
-				"kind":       "microsoftteams",
-				"enabled":    true,
-				"webhookUrl": "https://outlook.office.com/webhook/xxx",
-			},
-		},
-		{
-			name: "webhook notifier",
-			notifier: map[string]interface{}{
-				"id":          "test-webhook",
-				"name":        "webhook",
-				"kind":        "webhook",
-				"enabled":     true,
-				"endpointUrl": "https://example.com/webhook",
-				"secret":      "my-secret",
-				"headers":     map[string]string{"Authorization": "Bearer token"},
-			},
-		},
-		{
-			name: "log notifier",
-			notifier: map[string]interface{}{
-				"id":        "test-log",
-				"name":      "log",
-				"kind":      "log",
-				"enabled":   true,
-				"logFormat": "json",
-			},
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			body, _ := json.Marshal(tc.notifier)
-			req := httptest.NewRequest("POST", "/api/notifiers", bytes.NewReader(body))
-			req.Header.Set("Content-Type", "application/json")
-			rr := httptest.NewRecorder()
-			router.ServeHTTP(rr, req)
-
-			if rr.Code != http.StatusCreated {
-				t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	t.Run("negotiate raw flags format", func(t *testing.T) {
+		cases := []struct {
+			path, accept, contentType string
+		}{
+			{"/api/flags/raw/project-a?format=json", "", "application/json"},
+			{"/api/flags/raw/project-a?format=toml", "application/json", "application/toml"},
+			{"/api/flags/raw/project-a", "application/json", "application/json"},
+			{"/api/flags/raw/project-a", "text/html, application/toml;q=0.9", "application/toml"},
+			{"/api/flags/raw/project-a", "application/json;q=0, */*", "application/x-yaml"},
+			{"/api/flags/raw?format=json", "", "application/json"},
+		}
+		for _, c := range cases {
+			req := httptest.NewRequest("GET", c.path, nil)
+			if c.accept != "" {
+				req.Header.Set("Accept", c.accept)
 			}
-		})
-	}
-}
-
-// =============================================================================
-// EXPORTERS API TESTS
-// =============================================================================
-
-func TestExportersCRUD(t *testing.T) {
-	fm, _, cleanup := setupTestFlagManager(t)
-	defer cleanup()
-
-	router := setupTestRouter(fm)
-
-	var createdID string
-
-	t.Run("create file exporter", func(t *testing.T) {
-		exporter := map[string]interface{}{
-			"id":         "test-file-exporter",
-			"name":       "file-exporter",
-			"kind":       "file",
-			"enabled":    true,
-			"outputDir":  "/var/log/goff",
-			"fileFormat": "json",
-		}
-
-		body, _ := json.Marshal(exporter)
-		req := httptest.NewRequest("POST", "/api/exporters", bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusCreated {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
-		}
-
-		var response map[string]interface{}
-		json.Unmarshal(rr.Body.Bytes(), &response)
-		createdID = response["id"].(string)
-	})
-
-	t.Run("list exporters", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/exporters", nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("get exporter", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/exporters/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("update exporter", func(t *testing.T) {
-		exporter := map[string]interface{}{
-			"id":         createdID,
-			"name":       "file-exporter-updated",
-			"kind":       "file",
-			"enabled":    false,
-			"outputDir":  "/var/log/goff-new",
-			"fileFormat": "csv",
-		}
-
-		body, _ := json.Marshal(exporter)
-		req := httptest.NewRequest("PUT", "/api/exporters/"+createdID, bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
-		}
-	})
-
-	t.Run("delete exporter", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/api/exporters/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
-			t.Errorf("Expected status 200 or 204, got %d", rr.Code)
-		}
-	})
-}
-
-func TestAllExporterTypes(t *testing.T) {
-	fm, _, cleanup := setupTestFlagManager(t)
-	defer cleanup()
-
-	router := setupTestRouter(fm)
-
-	testCases := []struct {
-		name     string
-		exporter map[string]interface{}
-	}{
-		{
-			name: "file exporter",
-			exporter: map[string]interface{}{
-				"id":        "test-file",
-				"name":      "file",
-				"kind":      "file",
-				"enabled":   true,
-				"outputDir": "/var/log/goff",
-			},
-		},
-		{
-			name: "webhook exporter",
-			exporter: map[string]interface{}{
-				"id":          "test-webhook",
-				"name":        "webhook",
-				"kind":        "webhook",
-				"enabled":     true,
-				"endpointUrl": "https://example.com/export",
-			},
-		},
-		{
-			name: "log exporter",
-			exporter: map[string]interface{}{
-				"id":      "test-log",
-				"name":    "log",
-				"kind":    "log",
-				"enabled": true,
-			},
-		},
-		{
-			name: "s3 exporter",
-			exporter: map[string]interface{}{
-				"id":       "test-s3",
-				"name":     "s3",
-				"kind":     "s3",
-				"enabled":  true,
-				"s3Bucket": "my-bucket",
-			},
-		},
-		{
-			name: "google storage exporter",
-			exporter: map[string]interface{}{
-				"id":        "test-gcs",
-				"name":      "gcs",
-				"kind":      "googleStorage",
-				"enabled":   true,
-				"gcsBucket": "my-bucket",
-			},
-		},
-		{
-			name: "kafka exporter",
-			exporter: map[string]interface{}{
-				"id":          "test-kafka",
-				"name":        "kafka",
-				"kind":        "kafka",
-				"enabled":     true,
-				"kafkaTopic":  "feature-flags",
-				"kafkaBroker": "localhost:9092",
-			},
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			body, _ := json.Marshal(tc.exporter)
-			req := httptest.NewRequest("POST", "/api/exporters", bytes.NewReader(body))
-			req.Header.Set("Content-Type", "application/json")
 			rr := httptest.NewRecorder()
 			router.ServeHTTP(rr, req)
-
-			if rr.Code != http.StatusCreated {
-				t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+			if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != c.contentType {
+				t.Errorf("%s (Accept %q): expected %s, got %d %s", c.path, c.accept, c.contentType, rr.Code, rr.Header().Get("Content-Type"))
+				continue
 			}
-		})
-	}
-}
-
-// =============================================================================
-// RETRIEVERS API TESTS
-// =============================================================================
-
-func TestRetrieversCRUD(t *testing.T) {
-	fm, _, cleanup := setupTestFlagManager(t)
-	defer cleanup()
-
-	router := setupTestRouter(fm)
-
-	var createdID string
-
-	t.Run("create file retriever", func(t *testing.T) {
-		retriever := map[string]interface{}{
-			"id":      "test-file-retriever",
-			"name":    "file-retriever",
-			"kind":    "file",
-			"enabled": true,
-			"path":    "/etc/goff/flags.yaml",
-		}
-
-		body, _ := json.Marshal(retriever)
-		req := httptest.NewRequest("POST", "/api/retrievers", bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusCreated {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
-		}
-
-		var response map[string]interface{}
-		json.Unmarshal(rr.Body.Bytes(), &response)
-		createdID = response["id"].(string)
-	})
-
-	t.Run("list retrievers", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/retrievers", nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("get retriever", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/retrievers/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("update retriever", func(t *testing.T) {
-		retriever := map[string]interface{}{
-			"id":      createdID,
-			"name":    "file-retriever-updated",
-			"kind":    "file",
-			"enabled": false,
-			"path":    "/etc/goff/flags-new.yaml",
-		}
-
-		body, _ := json.Marshal(retriever)
-		req := httptest.NewRequest("PUT", "/api/retrievers/"+createdID, bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
-		}
-	})
-
-	t.Run("delete retriever", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/api/retrievers/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
-			t.Errorf("Expected status 200 or 204, got %d", rr.Code)
-		}
-	})
-}
-
-func TestAllRetrieverTypes(t *testing.T) {
-	fm, _, cleanup := setupTestFlagManager(t)
-	defer cleanup()
-
-	router := setupTestRouter(fm)
-
-	testCases := []struct {
-		name      string
-		retriever map[string]interface{}
-	}{
-		{
-			name: "file retriever",
-			retriever: map[string]interface{}{
-				"id":      "test-file",
-				"name":    "file",
-				"kind":    "file",
-				"enabled": true,
-				"path":    "/flags.yaml",
-			},
-		},
-		{
-			name: "http retriever",
-			retriever: map[string]interface{}{
-				"id":      "test-http",
-				"name":    "http",
-				"kind":    "http",
-				"enabled": true,
-				"url":     "https://example.com/flags.yaml",
-			},
-		},
-		{
-			name: "s3 retriever",
-			retriever: map[string]interface{}{
-				"id":       "test-s3",
-				"name":     "s3",
-				"kind":     "s3",
-				"enabled":  true,
-				"s3Bucket": "my-bucket",
-				"s3Item":   "flags.yaml",
-			},
-		},
-		{
-			name: "github retriever",
-			retriever: map[string]interface{}{
-				"id":                   "test-github",
-				"name":                 "github",
-				"kind":                 "github",
-				"enabled":              true,
-				"githubRepositorySlug": "org/repo",
-				"githubPath":           "flags.yaml",
-				"githubBranch":         "main",
-			},
-		},
-		{
-			name: "gitlab retriever",
-			retriever: map[string]interface{}{
-				"id":                   "test-gitlab",
-				"name":                 "gitlab",
-				"kind":                 "gitlab",
-				"enabled":              true,
-				"gitlabRepositorySlug": "org/repo",
-				"gitlabPath":           "flags.yaml",
-				"gitlabBranch":         "main",
-			},
-		},
-		{
-			name: "mongodb retriever",
-			retriever: map[string]interface{}{
-				"id":                "test-mongodb",
-				"name":              "mongodb",
-				"kind":              "mongodb",
-				"enabled":           true,
-				"mongodbUri":        "mongodb://localhost:27017",
-				"mongodbDatabase":   "goff",
-				"mongodbCollection": "flags",
-			},
-		},
-		{
-			name: "redis retriever",
-			retriever: map[string]interface{}{
-				"id":          "test-redis",
-				"name":        "redis",
-				"kind":        "redis",
-				"enabled":     true,
-				"redisAddr":   "localhost:6379",
-				"redisPrefix": "goff:",
-			},
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			body, _ := json.Marshal(tc.retriever)
-			req := httptest.NewRequest("POST", "/api/retrievers", bytes.NewReader(body))
-			req.Header.Set("Content-Type", "application/json")
-			rr := httptest.NewRecorder()
-			router.ServeHTTP(rr, req)
 
-			if rr.Code != http.StatusCreated {
-				t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+			flags, err := decodeFlagFormat(map[string]string{
+				"application/json":   "json",
+				"application/toml":   "toml",
+				"application/x-yaml": "yaml",
+			}[c.contentType], rr.Body.Bytes())
+			key := "flag-1"
+			if !strings.Contains(c.path, "project-a") {
+				key = "project-a/flag-1"
+			}
+			if err != nil || flags[key].DefaultRule == nil || flags[key].DefaultRule.Variation != "enabled" {
+				t.Errorf("%s (Accept %q): expected %s in the response, got %+v, %v", c.path, c.accept, key, flags, err)
 			}
-		})
-	}
-}
-
-// =============================================================================
-// FLAG SETS API TESTS
-// =============================================================================
-
-func TestFlagSetsCRUD(t *testing.T) {
-	fm, _, cleanup := setupTestFlagManager(t)
-	defer cleanup()
-
-	router := setupTestRouter(fm)
-
-	var createdID string
-
-	t.Run("create flag set", func(t *testing.T) {
-		flagSet := map[string]interface{}{
-			"id":          "test-production",
-			"name":        "production",
-			"description": "Production flag set",
-			"projects":    []string{"project-a", "project-b"},
-		}
-
-		body, _ := json.Marshal(flagSet)
-		req := httptest.NewRequest("POST", "/api/flagsets", bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusCreated {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
-		}
-
-		var response map[string]interface{}
-		json.Unmarshal(rr.Body.Bytes(), &response)
-		createdID = response["id"].(string)
-	})
-
-	t.Run("list flag sets", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/flagsets", nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("get flag set", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/flagsets/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("update flag set", func(t *testing.T) {
-		flagSet := map[string]interface{}{
-			"id":          createdID,
-			"name":        "production-updated",
-			"description": "Updated production flag set",
-			"projects":    []string{"project-a", "project-b", "project-c"},
-		}
-
-		body, _ := json.Marshal(flagSet)
-		req := httptest.NewRequest("PUT", "/api/flagsets/"+createdID, bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
-		}
-	})
-
-	t.Run("delete flag set", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/api/flagsets/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-}
-
-// =============================================================================
-// INTEGRATIONS API TESTS
-// =============================================================================
-
-func TestIntegrationsCRUD(t *testing.T) {
-	fm, _, cleanup := setupTestFlagManager(t)
-	defer cleanup()
-
-	router := setupTestRouter(fm)
-
-	var createdID string
-
-	t.Run("create integration", func(t *testing.T) {
-		integration := map[string]interface{}{
-			"id":         "test-gitlab-main",
-			"name":       "gitlab-main",
-			"provider":   "gitlab",
-			"enabled":    true,
-			"repository": "org/repo",
-			"baseBranch": "main",
-			"flagsPath":  "/flags",
-			"token":      "glpat-xxxx",
-		}
-
-		body, _ := json.Marshal(integration)
-		req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusCreated {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
-		}
-
-		var response map[string]interface{}
-		json.Unmarshal(rr.Body.Bytes(), &response)
-		createdID = response["id"].(string)
-	})
-
-	t.Run("list integrations", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/integrations", nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("get integration", func(t *testing.T) {
-		req := httptest.NewRequest("GET", "/api/integrations/"+createdID, nil)
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
-		}
-	})
-
-	t.Run("update integration", func(t *testing.T) {
-		integration := map[string]interface{}{
-			"id":         createdID,
-			"name":       "gitlab-main-updated",
-			"provider":   "gitlab",
-			"enabled":    false,
-			"repository": "org/repo-new",
-			"baseBranch": "develop",
-			"flagsPath":  "/flags-new",
-			"token":      "glpat-yyyy",
 		}
 
-		body, _ := json.Marshal(integration)
-		req := httptest.NewRequest("PUT", "/api/integrations/"+createdID, bytes.NewReader(body))
-		req.Header.Set("Content-Type", "application/json")
+		req := httptest.NewRequest("GET", "/api/flags/raw/project-a?format=xml", nil)
 		rr := httptest.NewRecorder()
 		router.ServeHTTP(rr, req)
-
-		if rr.Code != http.StatusOK {
-			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for an unknown format, got %d", http.StatusBadRequest, rr.Code)
 		}
 	})
 
-	t.Run("delete integration", func(t *testing.T) {
-		req := httptest.NewRequest("DELETE", "/api/integrations/"+createdID, nil)
+	t.Run("get raw flags for nonexistent project", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/flags/raw/nonexistent", nil)
 		rr := httptest.NewRecorder()
 		router.ServeHTTP(rr, req)
 
-		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
-			t.Errorf("Expected status 200 or 204, got %d", rr.Code)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
 		}
 	})
 }
@@ -1587,3 +1116,53 @@ func TestFlagFilePersistence(t *testing.T) {
 		t.Error("Expected file to contain version")
 	}
 }
+
+// =============================================================================
+// FLAG FORMAT TESTS
+// =============================================================================
+
+func TestGetFlagFormats(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	flagConfig := FlagConfig{
+		Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+		DefaultRule: &DefaultRule{Variation: "disabled"},
+	}
+	body, _ := json.Marshal(flagConfig)
+	req := httptest.NewRequest("POST", "/api/projects/test-project/flags/format-flag", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	tests := []struct {
+		format      string
+		wantStatus  int
+		contentType string
+		contains    string
+	}{
+		{"yaml", http.StatusOK, "application/x-yaml", "format-flag:"},
+		{"toml", http.StatusOK, "application/toml", "[format-flag"},
+		{"json", http.StatusOK, "application/json", `"key":"format-flag"`},
+		{"xml", http.StatusBadRequest, "application/json", "INVALID_FORMAT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/projects/test-project/flags/format-flag?format="+tt.format, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.contentType, ct)
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte(tt.contains)) {
+				t.Errorf("Expected body to contain %q, got %s", tt.contains, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	"flag-manager-api/db"
+)
+
+// DesiredState is the complete state POST /api/apply reconciles the instance
+// to. A section left out is not touched; a present one, even empty, is
+// matched exactly, so whatever it does not list is deleted.
+type DesiredState struct {
+	Projects map[string]ProjectFlags `json:"projects"`
+	Segments []DesiredSegment        `json:"segments"`
+	FlagSets []DesiredFlagSet        `json:"flagSets"`
+}
+
+// DesiredSegment is a segment of a desired state, matched by name.
+type DesiredSegment struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Rules       []string `json:"rules"`
+}
+
+// DesiredFlagSet is a flag set of a desired state, matched by name. New flag
+// sets get the same defaults as those created through the API.
+type DesiredFlagSet struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Environment string                 `json:"environment,omitempty"`
+	Flags       map[string]interface{} `json:"flags"`
+}
+
+// ApplyChange is one create, update or delete an apply makes, or would make.
+type ApplyChange struct {
+	Action  string         `json:"action"` // create, update or delete
+	Kind    string         `json:"kind"`   // project, flag, segment, flagSet or flagSetFlag
+	Name    string         `json:"name"`
+	Project string         `json:"project,omitempty"`
+	FlagSet string         `json:"flagSet,omitempty"`
+	Changes []ConfigChange `json:"changes,omitempty"`
+
+	before, after interface{}
+}
+
+// ApplyResult is the plan of an apply and whether it was carried out.
+type ApplyResult struct {
+	DryRun  bool           `json:"dryRun"`
+	Applied bool           `json:"applied"`
+	Summary map[string]int `json:"summary"`
+	Plan    []ApplyChange  `json:"plan"`
+}
+
+// applyStep makes some changes of an apply plan.
+type applyStep struct {
+	changes []ApplyChange
+	run     func(ctx context.Context) error
+}
+
+// applyAuditEvents are the audit action and resource type logged per kind of
+// applied change.
+var applyAuditEvents = map[string][2]string{
+	"project":     {"project.applied", "project"},
+	"flag":        {"flag.applied", "flag"},
+	"segment":     {"segment.applied", "segment"},
+	"flagSet":     {"flagset.applied", "flagset"},
+	"flagSetFlag": {"flag.applied", "flagset_flag"},
+}
+
+// applyWebhookEvents maps apply actions on flags to project webhook events.
+var applyWebhookEvents = map[string]string{
+	"create": "flag.created",
+	"update": "flag.updated",
+	"delete": "flag.deleted",
+}
+
+// validateDesiredState checks the names and flag configs of a desired state.
+func (fm *FlagManager) validateDesiredState(desired *DesiredState) []string {
+	var invalid []string
+	for project, flags := range desired.Projects {
+		if err := ValidateProjectName(project); err != nil {
+			invalid = append(invalid, "projects/"+project+": "+err.Error())
+			continue
+		}
+		for key, config := range flags {
+			if err := ValidateFlagKey(key); err != nil {
+				invalid = append(invalid, "projects/"+project+"/"+key+": "+err.Error())
+				continue
+			}
+			for _, e := range ValidateFlagConfig(config) {
+				invalid = append(invalid, "projects/"+project+"/"+key+": "+e)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, seg := range desired.Segments {
+		if err := ValidateSegmentName(seg.Name); err != nil {
+			invalid = append(invalid, "segments/"+seg.Name+": "+err.Error())
+		} else if seen[seg.Name] {
+			invalid = append(invalid, "segments/"+seg.Name+": duplicate segment")
+		} else if len(seg.Rules) == 0 {
+			invalid = append(invalid, "segments/"+seg.Name+": at least one rule is required")
+		}
+		seen[seg.Name] = true
+	}
+
+	seen = make(map[string]bool)
+	for _, fs := range desired.FlagSets {
+		if fs.Name == "" {
+			invalid = append(invalid, "flagSets: name is required")
+			continue
+		}
+		if seen[fs.Name] {
+			invalid = append(invalid, "flagSets/"+fs.Name+": duplicate flag set")
+		}
+		seen[fs.Name] = true
+		for key, config := range fs.Flags {
+			if err := ValidateFlagKey(key); err != nil {
+				invalid = append(invalid, "flagSets/"+fs.Name+"/"+key+": "+err.Error())
+				continue
+			}
+			for _, e := range validateFlagSetFlagConfig(config) {
+				invalid = append(invalid, "flagSets/"+fs.Name+"/"+key+": "+e)
+			}
+		}
+	}
+	sort.Strings(invalid)
+	return invalid
+}
+
+// applyHandler reconciles the instance to a desired state document and
+// returns the plan of changes. With ?dryRun=true nothing is written.
+// Segments are created and updated first and deleted last, so that flags
+// never reference a missing segment. A failed apply stops at the first error;
+// applying the same document again completes it.
+func (fm *FlagManager) applyHandler(w http.ResponseWriter, r *http.Request) {
+	var desired DesiredState
+	if err := json.NewDecoder(r.Body).Decode(&desired); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if invalid := fm.validateDesiredState(&desired); len(invalid) > 0 {
+		writeValidationError(w, "INVALID_DESIRED_STATE", "The desired state is invalid", invalid...)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	steps, err := fm.planApply(r.Context(), &desired, actorLabel(GetActor(r)))
+	if errors.Is(err, errDatabaseRequired) {
+		writeValidationError(w, "INVALID_DESIRED_STATE", "The desired state is invalid", "segments: segments require a database")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	result := &ApplyResult{
+		DryRun:  dryRun,
+		Summary: map[string]int{"create": 0, "update": 0, "delete": 0},
+		Plan:    []ApplyChange{},
+	}
+	for _, step := range steps {
+		for _, c := range step.changes {
+			result.Plan = append(result.Plan, c)
+			result.Summary[c.Action]++
+		}
+	}
+
+	if !dryRun {
+		for _, step := range steps {
+			if err := step.run(r.Context()); err != nil {
+				fm.auditApply(r, result)
+				if writePolicyViolationError(w, err) {
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to apply the desired state: "+err.Error())
+				return
+			}
+			fm.auditApplyChanges(r, step.changes)
+		}
+		result.Applied = true
+		fm.auditApply(r, result)
+		if len(result.Plan) > 0 {
+			fm.scheduleRelayRefresh(r.Context())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// auditApplyChanges logs the changes of a completed apply step, and notifies
+// project webhooks of changed flags.
+func (fm *FlagManager) auditApplyChanges(r *http.Request, changes []ApplyChange) {
+	actor := GetActor(r)
+	for _, c := range changes {
+		event := applyAuditEvents[c.Kind]
+		diff := map[string]interface{}{}
+		if c.before != nil {
+			diff["before"] = c.before
+		}
+		if c.after != nil {
+			diff["after"] = c.after
+		}
+		metadata := map[string]interface{}{"action": c.Action}
+		if c.FlagSet != "" {
+			metadata["flagSet"] = c.FlagSet
+		}
+		fm.audit.Log(r.Context(), actor, event[0], event[1], "", c.Name, c.Project, diff, metadata)
+		if c.Kind == "flag" {
+			fm.notifyProjectWebhook(r, applyWebhookEvents[c.Action], c.Project, c.Name, "")
+		}
+	}
+}
+
+// auditApply logs the outcome of an apply.
+func (fm *FlagManager) auditApply(r *http.Request, result *ApplyResult) {
+	fm.audit.Log(r.Context(), GetActor(r), "instance.applied", "instance", "", "", "", nil,
+		map[string]interface{}{"summary": result.Summary, "applied": result.Applied})
+}
+
+// planApply plans the steps reconciling the instance to a desired state, in
+// the order they must run. author is recorded on segment versions.
+func (fm *FlagManager) planApply(ctx context.Context, desired *DesiredState, author string) ([]applyStep, error) {
+	var steps, deletes []applyStep
+	add := func(s, d []applyStep, err error) error {
+		steps = append(steps, s...)
+		deletes = append(deletes, d...)
+		return err
+	}
+
+	if desired.Segments != nil {
+		if err := add(fm.planApplySegments(ctx, desired.Segments, author)); err != nil {
+			return nil, fmt.Errorf("segments: %w", err)
+		}
+	}
+	if desired.Projects != nil {
+		if err := add(fm.planApplyProjects(ctx, desired.Projects)); err != nil {
+			return nil, fmt.Errorf("projects: %w", err)
+		}
+	}
+	if desired.FlagSets != nil {
+		if err := add(fm.planApplyFlagSets(ctx, desired.FlagSets)); err != nil {
+			return nil, fmt.Errorf("flag sets: %w", err)
+		}
+	}
+	// Flag sets, then projects, then the segments they may reference
+	slices.Reverse(deletes)
+	return append(steps, deletes...), nil
+}
+
+func (fm *FlagManager) planApplySegments(ctx context.Context, desired []DesiredSegment, author string) (steps, deletes []applyStep, err error) {
+	existing := make(map[string]db.Segment)
+	for page := 1; ; page++ {
+		segments, err := fm.storage.ListSegments(ctx, db.PaginationParams{Page: page, PageSize: 200, Order: "asc"})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, seg := range segments.Data {
+			existing[seg.Name] = seg
+		}
+		if page >= segments.TotalPages {
+			break
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, want := range desired {
+		wanted[want.Name] = true
+		seg := db.Segment{Name: want.Name, Description: want.Description, Rules: want.Rules}
+		current, ok := existing[want.Name]
+		if !ok {
+			c := ApplyChange{Action: "create", Kind: "segment", Name: want.Name, after: want}
+			steps = append(steps, applyStep{changes: []ApplyChange{c}, run: func(ctx context.Context) error {
+				_, err := fm.storage.CreateSegment(ctx, seg, author)
+				return err
+			}})
+			continue
+		}
+
+		have := DesiredSegment{Name: current.Name, Description: current.Description, Rules: current.Rules}
+		if have.Description == want.Description && slices.Equal(have.Rules, want.Rules) {
+			continue
+		}
+		changes, err := diffConfigs(have, want)
+		if err != nil {
+			return nil, nil, err
+		}
+		c := ApplyChange{Action: "update", Kind: "segment", Name: want.Name, Changes: changes, before: have, after: want}
+		id := current.ID
+		steps = append(steps, applyStep{changes: []ApplyChange{c}, run: func(ctx context.Context) error {
+			if _, err := fm.storage.UpdateSegment(ctx, id, seg, author); err != nil {
+				return err
+			}
+			fm.refreshSegmentDependents(ctx, seg.Name)
+			return nil
+		}})
+	}
+
+	for _, name := range sortedKeys(existing) {
+		if wanted[name] {
+			continue
+		}
+		current := existing[name]
+		have := DesiredSegment{Name: current.Name, Description: current.Description, Rules: current.Rules}
+		c := ApplyChange{Action: "delete", Kind: "segment", Name: name, before: have}
+		deletes = append(deletes, applyStep{changes: []ApplyChange{c}, run: func(ctx context.Context) error {
+			return fm.storage.DeleteSegment(ctx, current.ID)
+		}})
+	}
+	return steps, deletes, nil
+}
+
+func (fm *FlagManager) planApplyProjects(ctx context.Context, desired map[string]ProjectFlags) (steps, deletes []applyStep, err error) {
+	for _, project := range sortedKeys(desired) {
+		flags := desired[project]
+		if flags == nil {
+			flags = make(ProjectFlags)
+		}
+		local, err := fm.loadStoredProjectFlags(ctx, project)
+		if err != nil {
+			return nil, nil, err
+		}
+		exists := local != nil
+		if !exists {
+			local = make(ProjectFlags)
+		}
+
+		// Using the current flags as the sync base takes every difference
+		// from the desired state.
+		plan, err := planGitSync(local, flags, local, syncStrategyRepo)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", project, err)
+		}
+		var changes []ApplyChange
+		if !exists {
+			changes = append(changes, ApplyChange{Action: "create", Kind: "project", Name: project})
+		}
+		for _, f := range plan {
+			c := ApplyChange{Kind: "flag", Name: f.Key, Project: project, Changes: f.Changes}
+			switch f.Action {
+			case "added":
+				c.Action = "create"
+			case "updated":
+				c.Action = "update"
+			case "removed":
+				c.Action = "delete"
+			}
+			if config, ok := local[f.Key]; ok {
+				c.before = config
+			}
+			if config, ok := flags[f.Key]; ok {
+				c.after = config
+			}
+			changes = append(changes, c)
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		steps = append(steps, applyStep{changes: changes, run: func(ctx context.Context) error {
+			if !exists {
+				if err := fm.storage.CreateProject(ctx, project); err != nil && !errors.Is(err, errProjectExists) {
+					return fmt.Errorf("%s: %w", project, err)
+				}
+			}
+			if err := fm.applyGitSync(ctx, project, flags, plan); err != nil {
+				return fmt.Errorf("%s: %w", project, err)
+			}
+			return nil
+		}})
+	}
+
+	projects, err := fm.storage.ListProjects(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(projects)
+	for _, project := range projects {
+		if _, ok := desired[project]; ok {
+			continue
+		}
+		c := ApplyChange{Action: "delete", Kind: "project", Name: project}
+		deletes = append(deletes, applyStep{changes: []ApplyChange{c}, run: func(ctx context.Context) error {
+			if _, err := fm.storage.DeleteProject(ctx, project); err != nil && !errors.Is(err, errProjectNotFound) {
+				return fmt.Errorf("%s: %w", project, err)
+			}
+			return nil
+		}})
+	}
+	return steps, deletes, nil
+}
+
+func (fm *FlagManager) planApplyFlagSets(ctx context.Context, desired []DesiredFlagSet) (steps, deletes []applyStep, err error) {
+	flagSets, err := fm.storage.ListFlagSets(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := make(map[string]FlagSet, len(flagSets))
+	for _, fs := range flagSets {
+		existing[fs.Name] = fs
+	}
+
+	wanted := make(map[string]bool)
+	for _, want := range desired {
+		wanted[want.Name] = true
+		flags := want.Flags
+		if flags == nil {
+			flags = make(map[string]interface{})
+		}
+
+		current, ok := existing[want.Name]
+		var changes []ApplyChange
+		var have map[string]interface{}
+		if ok {
+			if have, err = fm.storage.ListFlagSetFlags(ctx, current.ID); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", want.Name, err)
+			}
+			before := map[string]string{"description": current.Description, "environment": current.Environment}
+			after := map[string]string{"description": want.Description, "environment": want.Environment}
+			if before["description"] != after["description"] || before["environment"] != after["environment"] {
+				diff, err := diffConfigs(before, after)
+				if err != nil {
+					return nil, nil, err
+				}
+				changes = append(changes, ApplyChange{Action: "update", Kind: "flagSet", Name: want.Name, Changes: diff, before: before, after: after})
+			}
+		} else {
+			changes = append(changes, ApplyChange{Action: "create", Kind: "flagSet", Name: want.Name,
+				after: map[string]string{"description": want.Description, "environment": want.Environment}})
+		}
+
+		flagChanges, err := planFlagSetFlags(want.Name, have, flags)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", want.Name, err)
+		}
+		changes = append(changes, flagChanges...)
+		if len(changes) == 0 {
+			continue
+		}
+
+		steps = append(steps, applyStep{changes: changes, run: func(ctx context.Context) error {
+			saved, err := fm.applyFlagSet(ctx, current, ok, want)
+			if err != nil {
+				return fmt.Errorf("%s: %w", want.Name, err)
+			}
+			if err := fm.applyFlagSetFlags(ctx, saved.ID, flags, flagChanges); err != nil {
+				return fmt.Errorf("%s: %w", want.Name, err)
+			}
+			return nil
+		}})
+	}
+
+	for _, fs := range flagSets {
+		if wanted[fs.Name] {
+			continue
+		}
+		c := ApplyChange{Action: "delete", Kind: "flagSet", Name: fs.Name,
+			before: map[string]string{"description": fs.Description, "environment": fs.Environment}}
+		id := fs.ID
+		deletes = append(deletes, applyStep{changes: []ApplyChange{c}, run: func(ctx context.Context) error {
+			return fm.storage.DeleteFlagSet(ctx, id)
+		}})
+	}
+	return steps, deletes, nil
+}
+
+// planFlagSetFlags plans the changes turning a flag set's flags into the
+// desired ones.
+func planFlagSetFlags(flagSet string, have, want map[string]interface{}) ([]ApplyChange, error) {
+	keys := make(map[string]bool)
+	for key := range have {
+		keys[key] = true
+	}
+	for key := range want {
+		keys[key] = true
+	}
+
+	var changes []ApplyChange
+	for _, key := range sortedKeys(keys) {
+		before, inHave := have[key]
+		after, inWant := want[key]
+		diff, err := diffConfigs(before, after)
+		if err != nil {
+			return nil, fmt.Errorf("flag %s: %w", key, err)
+		}
+		if inHave && inWant && len(diff) == 0 {
+			continue
+		}
+		c := ApplyChange{Action: "update", Kind: "flagSetFlag", Name: key, FlagSet: flagSet, Changes: diff, before: before, after: after}
+		switch {
+		case !inHave:
+			c.Action = "create"
+		case !inWant:
+			c.Action = "delete"
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// applyFlagSet creates a desired flag set, or updates the description and
+// environment of an existing one.
+func (fm *FlagManager) applyFlagSet(ctx context.Context, fs FlagSet, exists bool, want DesiredFlagSet) (*FlagSet, error) {
+	if !exists {
+		fs = FlagSet{Name: want.Name, Description: want.Description, Environment: want.Environment}
+		if err := fm.prepareFlagSet(ctx, &fs); err != nil {
+			return nil, err
+		}
+		return fm.storage.CreateFlagSet(ctx, fs)
+	}
+	if fs.Description == want.Description && fs.Environment == want.Environment {
+		return &fs, nil
+	}
+	fs.Description, fs.Environment = want.Description, want.Environment
+	return fm.storage.UpdateFlagSet(ctx, fs.ID, fs)
+}
+
+// applyFlagSetFlags writes the planned flag changes of a flag set.
+func (fm *FlagManager) applyFlagSetFlags(ctx context.Context, id string, flags map[string]interface{}, changes []ApplyChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	changed := make([]string, len(changes))
+	for i, c := range changes {
+		changed[i] = c.Name
+	}
+	return fm.storage.SaveFlagSetFlags(ctx, id, flags, changed)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestApply(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+	apply := func(router http.Handler, path, body string) ApplyResult {
+		t.Helper()
+		var result ApplyResult
+		doRequest(t, router, "POST", path, body, http.StatusOK, &result)
+		return result
+	}
+
+	if _, err := fm.storage.CreateFlag(context.Background(), "legacy", "old", FlagConfig{Variations: map[string]interface{}{"on": true}, DefaultRule: &DefaultRule{Variation: "on"}}); err != nil {
+		t.Fatal(err)
+	}
+	state := `{
+		"projects": {"web": {"checkout": {"variations": {"on": true, "off": false}, "defaultRule": {"variation": "on"}}}},
+		"flagSets": [{"name": "mobile", "environment": "production", "flags": {"dark-mode": {"variations": {"on": true}, "defaultRule": {"variation": "on"}}}}]
+	}`
+
+	// A dry run plans without writing
+	result := apply(router, "/api/apply?dryRun=true", state)
+	if result.Applied || result.Summary["create"] != 4 || result.Summary["delete"] != 1 {
+		t.Errorf("Expected 4 creates and 1 delete planned, got %+v", result)
+	}
+	if _, err := fm.storage.ListFlags(context.Background(), "web"); !errors.Is(err, errProjectNotFound) {
+		t.Errorf("Expected a dry run to create nothing, got %v", err)
+	}
+
+	result = apply(router, "/api/apply", state)
+	if !result.Applied || len(result.Plan) != 5 {
+		t.Fatalf("Expected 5 changes applied, got %+v", result)
+	}
+	if flags, err := fm.storage.ListFlags(context.Background(), "web"); err != nil || flags["checkout"].DefaultRule.Variation != "on" {
+		t.Errorf("Expected the web project with its flag, got %+v, %v", flags, err)
+	}
+	if _, err := fm.storage.ListFlags(context.Background(), "legacy"); !errors.Is(err, errProjectNotFound) {
+		t.Errorf("Expected the unlisted project to be deleted, got %v", err)
+	}
+	mobile := fm.flagSets.GetByName("mobile")
+	if mobile == nil || mobile.Environment != "production" || len(mobile.APIKeys) != 1 {
+		t.Fatalf("Expected the flag set with an API key, got %+v", mobile)
+	}
+	if flags, _ := fm.readFlagSetFlags(mobile.ID); flags["dark-mode"] == nil {
+		t.Errorf("Expected the flag set flags, got %+v", flags)
+	}
+
+	// Applying the same state again changes nothing; the flag set file is not
+	// mistaken for a project
+	if result = apply(router, "/api/apply", state); len(result.Plan) != 0 {
+		t.Errorf("Expected an empty plan, got %+v", result.Plan)
+	}
+
+	// Sections left out are not touched, empty ones are emptied
+	result = apply(router, "/api/apply", `{"flagSets": []}`)
+	if len(result.Plan) != 1 || result.Plan[0].Kind != "flagSet" || result.Plan[0].Action != "delete" {
+		t.Errorf("Expected only the flag set deleted, got %+v", result.Plan)
+	}
+	if len(fm.flagSets.List()) != 0 {
+		t.Errorf("Expected no flag sets, got %+v", fm.flagSets.List())
+	}
+	if flags, err := fm.storage.ListFlags(context.Background(), "web"); err != nil || len(flags) != 1 {
+		t.Errorf("Expected the web project to be kept, got %+v, %v", flags, err)
+	}
+
+	doRequest(t, router, "POST", "/api/apply", `{"projects": {"web": {"Bad Key": {}}}}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/apply", `{"segments": [{"name": "beta", "rules": ["plan eq \"pro\""]}]}`, http.StatusBadRequest, nil)
+
+	// Segments need a database
+	store, err := db.NewStore("sqlite://" + filepath.Join(t.TempDir(), "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: t.TempDir()}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+	dbRouter := setupTestRouter(dbFM)
+
+	segments := `{"segments": [{"name": "beta", "rules": ["plan eq \"pro\""]}, {"name": "staff", "rules": ["email ew \"@example.com\""]}]}`
+	if result = apply(dbRouter, "/api/apply", segments); result.Summary["create"] != 2 {
+		t.Errorf("Expected 2 segments created, got %+v", result)
+	}
+	result = apply(dbRouter, "/api/apply", `{"segments": [{"name": "beta", "rules": ["plan eq \"enterprise\""]}]}`)
+	if result.Summary["update"] != 1 || result.Summary["delete"] != 1 || len(result.Plan[0].Changes) == 0 {
+		t.Errorf("Expected beta updated and staff deleted, got %+v", result)
+	}
+	if seg, err := store.GetSegmentByName(context.Background(), "beta"); err != nil || seg.Rules[0] != `plan eq "enterprise"` {
+		t.Errorf("Expected the updated segment, got %+v, %v", seg, err)
+	}
+	if _, err := store.GetSegmentByName(context.Background(), "staff"); err == nil {
+		t.Error("Expected the unlisted segment to be deleted")
+	}
+}
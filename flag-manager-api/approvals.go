@@ -2,27 +2,261 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"flag-manager-api/db"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-func (fm *FlagManager) listChangeRequestsHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for change requests", http.StatusBadRequest)
-		return
+// ChangeRequestsStore manages change request persistence in file mode
+type ChangeRequestsStore struct {
+	filePath string
+	data     changeRequestsData
+	mu       sync.RWMutex
+}
+
+type changeRequestsData struct {
+	ChangeRequests []db.ChangeRequest       `json:"changeRequests"`
+	Reviews        []db.ChangeRequestReview `json:"reviews"`
+}
+
+// NewChangeRequestsStore creates a new change requests store
+func NewChangeRequestsStore(configDir string) *ChangeRequestsStore {
+	store := &ChangeRequestsStore{
+		filePath: filepath.Join(configDir, "change_requests.json"),
+	}
+	store.load()
+	return store
+}
+
+func (s *ChangeRequestsStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.data)
+}
+
+func (s *ChangeRequestsStore) save() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filePath, data, 0644)
+}
+
+// find returns the change request with the given ID, or nil.
+func (s *ChangeRequestsStore) find(id string) *db.ChangeRequest {
+	for i := range s.data.ChangeRequests {
+		if s.data.ChangeRequests[i].ID == id {
+			return &s.data.ChangeRequests[i]
+		}
+	}
+	return nil
+}
+
+// Create records a pending change request and returns it with its ID and
+// timestamps
+func (s *ChangeRequestsStore) Create(cr db.ChangeRequest) (*db.ChangeRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	cr.ID = uuid.New().String()
+	cr.Status = "pending"
+	cr.CreatedAt = now
+	cr.UpdatedAt = now
+	cr.AppliedAt = nil
+	cr.AppliedBy = ""
+	s.data.ChangeRequests = append(s.data.ChangeRequests, cr)
+	if err := s.save(); err != nil {
+		s.data.ChangeRequests = s.data.ChangeRequests[:len(s.data.ChangeRequests)-1]
+		return nil, err
+	}
+	return &cr, nil
+}
+
+// Get returns a change request by ID
+func (s *ChangeRequestsStore) Get(id string) (*db.ChangeRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cr := s.find(id)
+	if cr == nil {
+		return nil, fmt.Errorf("change request not found")
+	}
+	found := *cr
+	return &found, nil
+}
+
+// List returns a page of the change requests matching params, ordered by
+// creation time like the database query
+func (s *ChangeRequestsStore) List(params db.ChangeRequestFilterParams) *db.PaginatedResult[db.ChangeRequest] {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search := strings.ToLower(params.Search)
+	crs := []db.ChangeRequest{}
+	for _, cr := range s.data.ChangeRequests {
+		if (params.Status != "" && cr.Status != params.Status) ||
+			(params.From != nil && cr.CreatedAt.Before(*params.From)) ||
+			(params.To != nil && cr.CreatedAt.After(*params.To)) {
+			continue
+		}
+		if search != "" &&
+			!strings.Contains(strings.ToLower(cr.Title), search) &&
+			!strings.Contains(strings.ToLower(cr.FlagKey), search) &&
+			!strings.Contains(strings.ToLower(cr.Project), search) {
+			continue
+		}
+		crs = append(crs, cr)
+	}
+
+	desc := params.OrderDirection() == "DESC"
+	if desc {
+		// Keep requests created in the same instant newest first
+		slices.Reverse(crs)
 	}
+	sort.SliceStable(crs, func(i, j int) bool {
+		if desc {
+			return crs[i].CreatedAt.After(crs[j].CreatedAt)
+		}
+		return crs[i].CreatedAt.Before(crs[j].CreatedAt)
+	})
+
+	total := len(crs)
+	start := min(params.Offset(), total)
+	end := min(start+params.Limit(), total)
+	return db.NewPaginatedResult(crs[start:end], total, params.PaginationParams)
+}
+
+// UpdateStatus sets the status of a change request, recording who applied it
+// when the status is "applied"
+func (s *ChangeRequestsStore) UpdateStatus(id, status, appliedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	cr := s.find(id)
+	if cr == nil {
+		return fmt.Errorf("change request not found")
+	}
+	now := time.Now().UTC()
+	cr.Status = status
+	cr.UpdatedAt = now
+	if status == "applied" {
+		cr.AppliedAt = &now
+		cr.AppliedBy = appliedBy
+	}
+	return s.save()
+}
+
+// CancelBefore cancels all open (pending or approved) change requests created
+// before the given time and returns the cancelled requests
+func (s *ChangeRequestsStore) CancelBefore(before time.Time) ([]db.ChangeRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	cancelled := []db.ChangeRequest{}
+	for i := range s.data.ChangeRequests {
+		cr := &s.data.ChangeRequests[i]
+		if (cr.Status != "pending" && cr.Status != "approved") || !cr.CreatedAt.Before(before) {
+			continue
+		}
+		cr.Status = "cancelled"
+		cr.UpdatedAt = now
+		cancelled = append(cancelled, *cr)
+	}
+	if len(cancelled) == 0 {
+		return cancelled, nil
+	}
+	return cancelled, s.save()
+}
+
+// CountPending returns the number of pending change requests
+func (s *ChangeRequestsStore) CountPending() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, cr := range s.data.ChangeRequests {
+		if cr.Status == "pending" {
+			count++
+		}
+	}
+	return count
+}
+
+// AddReview records a review of a change request
+func (s *ChangeRequestsStore) AddReview(review db.ChangeRequestReview) (*db.ChangeRequestReview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.find(review.ChangeRequestID) == nil {
+		return nil, fmt.Errorf("change request not found")
+	}
+	review.ID = uuid.New().String()
+	review.CreatedAt = time.Now().UTC()
+	s.data.Reviews = append(s.data.Reviews, review)
+	if err := s.save(); err != nil {
+		s.data.Reviews = s.data.Reviews[:len(s.data.Reviews)-1]
+		return nil, err
+	}
+	return &review, nil
+}
+
+// Reviews returns the reviews of a change request, oldest first
+func (s *ChangeRequestsStore) Reviews(crID string) []db.ChangeRequestReview {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reviews := []db.ChangeRequestReview{}
+	for _, r := range s.data.Reviews {
+		if r.ChangeRequestID == crID {
+			reviews = append(reviews, r)
+		}
+	}
+	return reviews
+}
+
+func (fm *FlagManager) listChangeRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	params := db.ChangeRequestFilterParams{
 		PaginationParams: parsePaginationParams(r),
 		Status:           r.URL.Query().Get("status"),
 	}
 
-	result, err := fm.store.ListChangeRequests(r.Context(), params)
+	if from := r.URL.Query().Get("from"); from != "" {
+		if t, err := time.Parse(time.RFC3339, from); err == nil {
+			params.From = &t
+		}
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		if t, err := time.Parse(time.RFC3339, to); err == nil {
+			params.To = &t
+		}
+	}
+
+	result, err := fm.storage.ListChangeRequests(r.Context(), params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -30,45 +264,44 @@ func (fm *FlagManager) listChangeRequestsHandler(w http.ResponseWriter, r *http.
 	json.NewEncoder(w).Encode(result)
 }
 
-func (fm *FlagManager) getChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for change requests", http.StatusBadRequest)
-		return
-	}
+// ChangeRequestResponse is a change request with its reviews.
+type ChangeRequestResponse struct {
+	ChangeRequest *db.ChangeRequest        `json:"changeRequest"`
+	Reviews       []db.ChangeRequestReview `json:"reviews"`
+}
 
+func (fm *FlagManager) getChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	cr, err := fm.store.GetChangeRequest(r.Context(), id)
+	cr, err := fm.storage.GetChangeRequest(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Change request not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "CHANGE_REQUEST_NOT_FOUND", "Change request not found")
 		return
 	}
 
 	// Include reviews
-	reviews, _ := fm.store.GetChangeRequestReviews(r.Context(), id)
+	reviews, _ := fm.storage.ListChangeRequestReviews(r.Context(), id)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"changeRequest": cr,
-		"reviews":       reviews,
+	json.NewEncoder(w).Encode(ChangeRequestResponse{
+		ChangeRequest: cr,
+		Reviews:       reviews,
 	})
 }
 
 func (fm *FlagManager) createChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for change requests", http.StatusBadRequest)
-		return
-	}
-
 	var cr db.ChangeRequest
 	if err := json.NewDecoder(r.Body).Decode(&cr); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if cr.Title == "" {
-		http.Error(w, "Title is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Title is required")
+		return
+	}
+	if !fm.authorizeProject(w, r, "change_request", "write", cr.Project) {
 		return
 	}
 
@@ -80,9 +313,9 @@ func (fm *FlagManager) createChangeRequestHandler(w http.ResponseWriter, r *http
 		cr.ResourceType = "flag"
 	}
 
-	created, err := fm.store.CreateChangeRequest(r.Context(), cr)
+	created, err := fm.storage.CreateChangeRequest(r.Context(), cr)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -94,22 +327,20 @@ func (fm *FlagManager) createChangeRequestHandler(w http.ResponseWriter, r *http
 }
 
 func (fm *FlagManager) reviewChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for change requests", http.StatusBadRequest)
-		return
-	}
-
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	// Verify CR exists and is pending
-	cr, err := fm.store.GetChangeRequest(r.Context(), id)
+	cr, err := fm.storage.GetChangeRequest(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Change request not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "CHANGE_REQUEST_NOT_FOUND", "Change request not found")
+		return
+	}
+	if !fm.authorizeProject(w, r, "change_request", "write", cr.Project) {
 		return
 	}
 	if cr.Status != "pending" {
-		http.Error(w, "Change request is not pending", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Change request is not pending")
 		return
 	}
 
@@ -118,17 +349,17 @@ func (fm *FlagManager) reviewChangeRequestHandler(w http.ResponseWriter, r *http
 		Comment  string `json:"comment,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if body.Decision != "approved" && body.Decision != "rejected" && body.Decision != "commented" {
-		http.Error(w, "Decision must be approved, rejected, or commented", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Decision must be approved, rejected, or commented")
 		return
 	}
 
 	actor := GetActor(r)
-	review, err := fm.store.AddChangeRequestReview(r.Context(), db.ChangeRequestReview{
+	review, err := fm.storage.AddChangeRequestReview(r.Context(), db.ChangeRequestReview{
 		ChangeRequestID: id,
 		ReviewerID:      actor.ID,
 		ReviewerEmail:   actor.Email,
@@ -137,15 +368,15 @@ func (fm *FlagManager) reviewChangeRequestHandler(w http.ResponseWriter, r *http
 		Comment:         body.Comment,
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	// Update status based on decision
 	if body.Decision == "approved" {
-		fm.store.UpdateChangeRequestStatus(r.Context(), id, "approved", "")
+		fm.storage.SetChangeRequestStatus(r.Context(), id, "approved", "")
 	} else if body.Decision == "rejected" {
-		fm.store.UpdateChangeRequestStatus(r.Context(), id, "rejected", "")
+		fm.storage.SetChangeRequestStatus(r.Context(), id, "rejected", "")
 	}
 
 	fm.audit.Log(r.Context(), actor, "change_request.reviewed", "change_request", id, cr.Title, cr.Project,
@@ -155,23 +386,87 @@ func (fm *FlagManager) reviewChangeRequestHandler(w http.ResponseWriter, r *http
 	json.NewEncoder(w).Encode(review)
 }
 
-func (fm *FlagManager) applyChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for change requests", http.StatusBadRequest)
+// ChangeRequestPreview is what applying a change request would do to the live
+// flag. Drift lists the changes made to the flag since the request was created.
+type ChangeRequestPreview struct {
+	ChangeRequest  *db.ChangeRequest `json:"changeRequest"`
+	ProposedConfig interface{}       `json:"proposedConfig"`
+	LiveConfig     interface{}       `json:"liveConfig"`
+	Diff           []ConfigChange    `json:"diff"`
+	Stale          bool              `json:"stale"`
+	Drift          []ConfigChange    `json:"drift"`
+}
+
+// previewChangeRequestHandler shows what applying a change request would do to the
+// live flag. The change request is stale when the live config no longer matches the
+// config captured when it was created.
+func (fm *FlagManager) previewChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	cr, err := fm.storage.GetChangeRequest(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "CHANGE_REQUEST_NOT_FOUND", "Change request not found")
 		return
 	}
 
+	var liveConfig interface{}
+	if cr.FlagKey != "" && cr.Project != "" {
+		flag, err := fm.storage.GetFlag(r.Context(), cr.Project, cr.FlagKey)
+		if err == nil {
+			configJSON, _ := json.Marshal(flag.Config)
+			liveConfig = rawConfigValue(configJSON)
+		} else if !errors.Is(err, errFlagNotFound) && !errors.Is(err, errProjectNotFound) {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to load live flag config")
+			return
+		}
+	}
+
+	proposedConfig := rawConfigValue(cr.ProposedConfig)
+	capturedConfig := rawConfigValue(cr.CurrentConfig)
+
+	changes, err := diffConfigs(liveConfig, proposedConfig)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	// Only flag change requests can be compared against live state.
+	drift := []ConfigChange{}
+	if cr.FlagKey != "" && cr.Project != "" {
+		drift, err = diffConfigs(capturedConfig, liveConfig)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ChangeRequestPreview{
+		ChangeRequest:  cr,
+		ProposedConfig: proposedConfig,
+		LiveConfig:     liveConfig,
+		Diff:           changes,
+		Stale:          len(drift) > 0,
+		Drift:          drift,
+	})
+}
+
+func (fm *FlagManager) applyChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	cr, err := fm.store.GetChangeRequest(r.Context(), id)
+	cr, err := fm.storage.GetChangeRequest(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Change request not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "CHANGE_REQUEST_NOT_FOUND", "Change request not found")
+		return
+	}
+	if !fm.authorizeProject(w, r, "change_request", "write", cr.Project) {
 		return
 	}
 
 	if cr.Status != "approved" && cr.Status != "pending" {
-		http.Error(w, "Change request must be approved or pending to apply", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Change request must be approved or pending to apply")
 		return
 	}
 
@@ -182,87 +477,161 @@ func (fm *FlagManager) applyChangeRequestHandler(w http.ResponseWriter, r *http.
 		// Parse proposed config
 		var flagConfig FlagConfig
 		if err := json.Unmarshal(cr.ProposedConfig, &flagConfig); err != nil {
-			http.Error(w, "Failed to parse proposed config", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to parse proposed config")
 			return
 		}
 
-		configJSON, _ := json.Marshal(flagConfig)
-		disabled := false
-		if flagConfig.Disable != nil {
-			disabled = *flagConfig.Disable
+		_, _, err := fm.storage.UpdateFlag(r.Context(), cr.Project, cr.FlagKey, "", flagConfig)
+		if writePolicyViolationError(w, err) {
+			return
 		}
-
-		_, err := fm.store.UpdateFlag(r.Context(), cr.Project, cr.FlagKey, configJSON, disabled, flagConfig.Version, "")
 		if err != nil {
-			http.Error(w, "Failed to apply flag change: "+err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to apply flag change: "+err.Error())
 			return
 		}
 
-		go fm.refreshRelayProxy()
+		fm.scheduleRelayRefresh(r.Context())
 	}
 
 	// Mark as applied
-	if err := fm.store.UpdateChangeRequestStatus(r.Context(), id, "applied", actor.ID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := fm.storage.SetChangeRequestStatus(r.Context(), id, "applied", actor.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	fm.audit.Log(r.Context(), actor, "change_request.applied", "change_request", id, cr.Title, cr.Project, nil, nil)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "applied",
-		"message": "Change request applied successfully",
+	json.NewEncoder(w).Encode(StatusResponse{
+		Status:  "applied",
+		Message: "Change request applied successfully",
 	})
 }
 
 func (fm *FlagManager) cancelChangeRequestHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for change requests", http.StatusBadRequest)
-		return
-	}
-
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	cr, err := fm.store.GetChangeRequest(r.Context(), id)
+	cr, err := fm.storage.GetChangeRequest(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Change request not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "CHANGE_REQUEST_NOT_FOUND", "Change request not found")
+		return
+	}
+	if !fm.authorizeProject(w, r, "change_request", "write", cr.Project) {
 		return
 	}
 
 	if cr.Status == "applied" || cr.Status == "cancelled" {
-		http.Error(w, "Cannot cancel a change request that is already "+cr.Status, http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Cannot cancel a change request that is already "+cr.Status)
 		return
 	}
 
-	if err := fm.store.UpdateChangeRequestStatus(r.Context(), id, "cancelled", ""); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := fm.storage.SetChangeRequestStatus(r.Context(), id, "cancelled", ""); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	fm.audit.Log(r.Context(), GetActor(r), "change_request.cancelled", "change_request", id, cr.Title, cr.Project, nil, nil)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "cancelled",
-		"message": "Change request cancelled",
+	json.NewEncoder(w).Encode(StatusResponse{
+		Status:  "cancelled",
+		Message: "Change request cancelled",
 	})
 }
 
-func (fm *FlagManager) countChangeRequestsHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]int{"count": 0})
+// BulkCancelResponse lists the change requests cancelled in bulk.
+type BulkCancelResponse struct {
+	Cancelled []db.ChangeRequest `json:"cancelled"`
+	Total     int                `json:"total"`
+}
+
+// bulkCancelChangeRequestsHandler cancels every open change request created
+// before a given date, auditing each cancellation with the supplied reason.
+func (fm *FlagManager) bulkCancelChangeRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Before string `json:"before"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+
+	before, err := time.Parse(time.RFC3339, body.Before)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "before must be an RFC 3339 timestamp")
+		return
+	}
+	if body.Reason == "" {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "A reason is required")
 		return
 	}
 
-	count, err := fm.store.CountPendingChangeRequests(r.Context())
+	cancelled, err := fm.storage.CancelChangeRequestsBefore(r.Context(), before)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
+	actor := GetActor(r)
+	for _, cr := range cancelled {
+		fm.audit.Log(r.Context(), actor, "change_request.cancelled", "change_request", cr.ID, cr.Title, cr.Project,
+			nil, map[string]interface{}{"reason": body.Reason, "bulk": true})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"count": count})
+	json.NewEncoder(w).Encode(BulkCancelResponse{
+		Cancelled: cancelled,
+		Total:     len(cancelled),
+	})
+}
+
+// CountResponse is a count of pending change requests.
+type CountResponse struct {
+	Count int `json:"count"`
+}
+
+func (fm *FlagManager) countChangeRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := fm.storage.CountPendingChangeRequests(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CountResponse{Count: count})
+}
+
+// flagRequiresApproval reports whether updates to a flag must go through a
+// change request. A per-flag requiresApproval override takes precedence over
+// the global REQUIRE_APPROVALS setting. The stored config is used so that an
+// update cannot opt itself out of approval.
+func (fm *FlagManager) flagRequiresApproval(existing FlagConfig) bool {
+	if existing.RequiresApproval != nil {
+		return *existing.RequiresApproval
+	}
+	return fm.requireApprovals
+}
+
+// bypassesApproval reports whether the actor of a request changes flags that
+// require approval without a change request: admins and API keys do.
+func (fm *FlagManager) bypassesApproval(r *http.Request) bool {
+	actor := GetActor(r)
+	if actor.Type == "apikey" {
+		return true
+	}
+	isAdmin := false
+	if fm.store != nil && actor.ID != "" {
+		isAdmin, _ = fm.store.HasPermission(r.Context(), actor.ID, "*", "admin")
+	}
+	return isAdmin
+}
+
+// boolPtrEqual compares two optional booleans, treating nil as distinct from false.
+func boolPtrEqual(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagRequiresApproval(t *testing.T) {
+	tests := []struct {
+		name     string
+		global   bool
+		override *bool
+		want     bool
+	}{
+		{"global off, no override", false, nil, false},
+		{"global on, no override", true, nil, true},
+		{"global off, override on", false, boolPtr(true), true},
+		{"global on, override off", true, boolPtr(false), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm := &FlagManager{requireApprovals: tt.global}
+			got := fm.flagRequiresApproval(FlagConfig{RequiresApproval: tt.override})
+			if got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFileModeChangeRequests(t *testing.T) {
+	fm, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	count := func() int {
+		t.Helper()
+		var resp map[string]int
+		doRequest(t, router, "GET", "/api/change-requests/count", "", http.StatusOK, &resp)
+		return resp["count"]
+	}
+
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"requiresApproval":true}`, http.StatusCreated, nil)
+
+	// Updating a flag that requires approval creates a change request
+	var pending struct {
+		RequiresApproval bool   `json:"requiresApproval"`
+		ChangeRequestID  string `json:"changeRequestId"`
+	}
+	doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"},"requiresApproval":true},"changeNote":"launch"}`, http.StatusOK, &pending)
+	if !pending.RequiresApproval || pending.ChangeRequestID == "" {
+		t.Fatalf("Expected a change request, got %+v", pending)
+	}
+	var flag struct {
+		Config FlagConfig `json:"config"`
+	}
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout", "", http.StatusOK, &flag)
+	if flag.Config.DefaultRule.Variation != "off" {
+		t.Errorf("Expected the flag to be unchanged before approval, got %q", flag.Config.DefaultRule.Variation)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("Expected 1 pending change request, got %d", n)
+	}
+
+	var preview struct {
+		Stale bool           `json:"stale"`
+		Diff  []ConfigChange `json:"diff"`
+	}
+	doRequest(t, router, "GET", "/api/change-requests/"+pending.ChangeRequestID+"/preview", "", http.StatusOK, &preview)
+	if preview.Stale || len(preview.Diff) == 0 {
+		t.Errorf("Expected a fresh change request with a diff, got %+v", preview)
+	}
+
+	doRequest(t, router, "POST", "/api/change-requests/"+pending.ChangeRequestID+"/review", `{"decision":"approved","comment":"ship it"}`, http.StatusOK, nil)
+	var detail struct {
+		ChangeRequest db.ChangeRequest         `json:"changeRequest"`
+		Reviews       []db.ChangeRequestReview `json:"reviews"`
+	}
+	doRequest(t, router, "GET", "/api/change-requests/"+pending.ChangeRequestID, "", http.StatusOK, &detail)
+	if detail.ChangeRequest.Status != "approved" || len(detail.Reviews) != 1 || detail.Reviews[0].Comment != "ship it" {
+		t.Errorf("Expected an approved change request with its review, got %+v", detail)
+	}
+
+	doRequest(t, router, "POST", "/api/change-requests/"+pending.ChangeRequestID+"/apply", "", http.StatusOK, nil)
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout", "", http.StatusOK, &flag)
+	if flag.Config.DefaultRule.Variation != "on" {
+		t.Errorf("Expected the proposed config to be applied, got %q", flag.Config.DefaultRule.Variation)
+	}
+	doRequest(t, router, "POST", "/api/change-requests/"+pending.ChangeRequestID+"/cancel", "", http.StatusBadRequest, nil)
+
+	// Change requests survive a restart
+	fm.changeRequests = NewChangeRequestsStore(tempDir)
+	doRequest(t, router, "GET", "/api/change-requests/"+pending.ChangeRequestID, "", http.StatusOK, &detail)
+	if detail.ChangeRequest.Status != "applied" || detail.ChangeRequest.AppliedAt == nil || len(detail.Reviews) != 1 {
+		t.Errorf("Expected the applied change request to be reloaded, got %+v", detail)
+	}
+
+	var created db.ChangeRequest
+	doRequest(t, router, "POST", "/api/change-requests", `{"title":"Retire checkout","project":"web","flagKey":"checkout"}`, http.StatusCreated, &created)
+	doRequest(t, router, "POST", "/api/change-requests/"+created.ID+"/cancel", "", http.StatusOK, nil)
+	doRequest(t, router, "POST", "/api/change-requests/"+created.ID+"/review", `{"decision":"approved"}`, http.StatusBadRequest, nil)
+
+	doRequest(t, router, "POST", "/api/change-requests", `{"title":"Old request"}`, http.StatusCreated, nil)
+	var bulk struct {
+		Total int `json:"total"`
+	}
+	doRequest(t, router, "POST", "/api/change-requests/bulk-cancel", `{"before":"`+time.Now().Add(time.Minute).Format(time.RFC3339)+`","reason":"cleanup"}`, http.StatusOK, &bulk)
+	if bulk.Total != 1 || count() != 0 {
+		t.Errorf("Expected 1 request bulk cancelled and none pending, got %d and %d", bulk.Total, count())
+	}
+
+	var list db.PaginatedResult[db.ChangeRequest]
+	doRequest(t, router, "GET", "/api/change-requests?status=cancelled", "", http.StatusOK, &list)
+	if list.Total != 2 || list.Data[0].Title != "Old request" {
+		t.Errorf("Expected 2 cancelled requests, newest first, got %+v", list)
+	}
+	doRequest(t, router, "GET", "/api/change-requests?search=retire", "", http.StatusOK, &list)
+	if list.Total != 1 || list.Data[0].ID != created.ID {
+		t.Errorf("Expected the search to match the title, got %+v", list)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultFlagArchiveRetention is how long archived flags are kept when
+	// FLAG_ARCHIVE_RETENTION is not set.
+	defaultFlagArchiveRetention = 30 * 24 * time.Hour
+	// archivePurgeInterval is how often archived flags past the retention are
+	// purged.
+	archivePurgeInterval = time.Hour
+)
+
+// archivePurgeActor is the audit actor of archived flags purged after the
+// retention.
+var archivePurgeActor = Actor{ID: "archive-purge", Name: "archive-purge", Type: "system"}
+
+// errNotFlagOwner is returned when archiving or restoring a flag the actor
+// may not change.
+var errNotFlagOwner = errors.New("not an owner of the flag")
+
+// parseFlagArchiveRetention reads the FLAG_ARCHIVE_RETENTION setting ("30d",
+// "720h"). Empty values use the default; zero keeps archived flags until they
+// are deleted again.
+func parseFlagArchiveRetention(value string) time.Duration {
+	if value == "" {
+		return defaultFlagArchiveRetention
+	}
+	if value == "0" {
+		return 0
+	}
+	d, err := parseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid FLAG_ARCHIVE_RETENTION, using default", "value", value, "default", defaultFlagArchiveRetention)
+		return defaultFlagArchiveRetention
+	}
+	return d
+}
+
+// isArchived reports whether a flag is archived. Archived flags keep their
+// history and can be restored, but are neither served nor listed by default.
+func isArchived(config FlagConfig) bool {
+	return config.ArchivedAt != ""
+}
+
+// withoutArchived returns flags without the archived flags.
+func withoutArchived(flags ProjectFlags) ProjectFlags {
+	active := make(ProjectFlags, len(flags))
+	for key, config := range flags {
+		if !isArchived(config) {
+			active[key] = config
+		}
+	}
+	return active
+}
+
+// setFlagArchived archives a project flag, or restores an archived one, and
+// reports the change. It returns the flag's config after, or errFlagArchived
+// or errFlagNotArchived if the flag already is in the requested state.
+func (fm *FlagManager) setFlagArchived(r *http.Request, project, flagKey string, archive bool) (FlagConfig, error) {
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil {
+		return FlagConfig{}, err
+	}
+	before, ok := flags[flagKey]
+	if !ok {
+		return FlagConfig{}, errFlagNotFound
+	}
+	if !fm.mayChangeFlag(r, before) {
+		return FlagConfig{}, errNotFlagOwner
+	}
+	if archive && isArchived(before) {
+		return FlagConfig{}, errFlagArchived
+	}
+	if !archive && !isArchived(before) {
+		return FlagConfig{}, errFlagNotArchived
+	}
+
+	after := before
+	action := "flag.restored"
+	after.ArchivedAt = ""
+	if archive {
+		action = "flag.archived"
+		after.ArchivedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	flags[flagKey] = after
+	ids, err := fm.storage.SaveFlags(r.Context(), project, flags, []string{flagKey})
+	if err != nil {
+		return FlagConfig{}, err
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), action, "flag", ids[flagKey], flagKey, project,
+		map[string]interface{}{"before": before, "after": after}, nil)
+	fm.notifyProjectWebhook(r, action, project, flagKey, "")
+	fm.syncJiraIssue(r, project, flagKey, &before, &after)
+
+	fm.scheduleRelayRefresh(r.Context())
+	return after, nil
+}
+
+// writeArchiveError writes the error of archiving or restoring a flag.
+func writeArchiveError(w http.ResponseWriter, flagKey string, err error) {
+	if errors.Is(err, errNotFlagOwner) {
+		writeNotFlagOwner(w, flagKey)
+		return
+	}
+	writeStorageError(w, err)
+}
+
+// archiveFlagHandler archives a flag: it is no longer served, but stays
+// readable with its history until it is restored or purged.
+func (fm *FlagManager) archiveFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	after, err := fm.setFlagArchived(r, vars["project"], vars["flagKey"], true)
+	if err != nil {
+		writeArchiveError(w, vars["flagKey"], err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newFlagResponse(vars["flagKey"], after))
+}
+
+// restoreFlagHandler restores an archived flag, which is served again.
+func (fm *FlagManager) restoreFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	after, err := fm.setFlagArchived(r, vars["project"], vars["flagKey"], false)
+	if err != nil {
+		writeArchiveError(w, vars["flagKey"], err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newFlagResponse(vars["flagKey"], after))
+}
+
+// purgeArchivedFlags deletes the flags archived longer than the retention
+// across all projects. A failing project does not stop the others; the first
+// error is returned.
+func (fm *FlagManager) purgeArchivedFlags(ctx context.Context, now time.Time) (int, error) {
+	projects, err := fm.listAllProjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := now.Add(-fm.config.FlagArchiveRetention)
+
+	purged := 0
+	var firstErr error
+	for _, project := range projects {
+		flags, err := fm.storage.ListFlags(ctx, project)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to list archived flags", "project", project, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for key, config := range flags {
+			archivedAt, err := time.Parse(time.RFC3339, config.ArchivedAt)
+			if err != nil || archivedAt.After(cutoff) {
+				continue
+			}
+			// The flag may have been restored since it was listed
+			if current, err := fm.storage.GetFlag(ctx, project, key); err != nil || current.Config.ArchivedAt != config.ArchivedAt {
+				continue
+			}
+			existing, err := fm.storage.DeleteFlag(context.WithValue(ctx, ctxActor, archivePurgeActor), project, key)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to purge archived flag", "project", project, "flag", key, "error", err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			fm.audit.Log(ctx, archivePurgeActor, "flag.deleted", "flag", existing.ID, key, project,
+				map[string]interface{}{"before": existing.Config},
+				map[string]interface{}{"archivedAt": config.ArchivedAt})
+			purged++
+		}
+	}
+
+	if purged > 0 {
+		slog.InfoContext(ctx, "Purged archived flags", "count", purged, "retention", fm.config.FlagArchiveRetention)
+	}
+	return purged, firstErr
+}
+
+// runArchivePurge purges archived flags past the retention every interval
+// until ctx is done.
+func (fm *FlagManager) runArchivePurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			fm.purgeArchivedFlags(ctx, now)
+		}
+	}
+}
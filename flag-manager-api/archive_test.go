@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagArchive(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			fm.config.FlagArchiveRetention = 24 * time.Hour
+			router := setupTestRouter(fm)
+			listed := func(query string) ([]string, []string) {
+				t.Helper()
+				var list struct {
+					Flags map[string]interface{} `json:"flags"`
+				}
+				doRequest(t, router, "GET", "/api/projects/web/flags"+query, "", http.StatusOK, &list)
+				var page struct {
+					Data []struct {
+						Key string `json:"key"`
+					} `json:"data"`
+				}
+				sep := "?"
+				if query != "" {
+					sep = "&"
+				}
+				doRequest(t, router, "GET", "/api/projects/web/flags"+query+sep+"page=1&sort=key&order=asc", "", http.StatusOK, &page)
+				var keys, paged []string
+				for key := range list.Flags {
+					keys = append(keys, key)
+				}
+				for _, item := range page.Data {
+					paged = append(paged, item.Key)
+				}
+				sort.Strings(keys)
+				return keys, paged
+			}
+			served := func() map[string]interface{} {
+				t.Helper()
+				var flags map[string]interface{}
+				doRequest(t, router, "GET", "/api/flags/raw/web?format=json", "", http.StatusOK, &flags)
+				return flags
+			}
+
+			flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout", flag, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/banner", flag, http.StatusCreated, nil)
+
+			var archived FlagResponse
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout/archive", "", http.StatusOK, &archived)
+			if archived.Config.ArchivedAt == "" {
+				t.Fatalf("Expected the flag to be archived, got %+v", archived.Config)
+			}
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout/archive", "", http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/missing/archive", "", http.StatusNotFound, nil)
+
+			// Archived flags are not served nor listed, but stay readable
+			if flags := served(); len(flags) != 1 || flags["banner"] == nil {
+				t.Errorf("Expected the archived flag not to be served, got %v", flags)
+			}
+			if keys, paged := listed(""); !reflect.DeepEqual(keys, []string{"banner"}) || !reflect.DeepEqual(paged, []string{"banner"}) {
+				t.Errorf("Expected only the active flag to be listed, got %v and %v", keys, paged)
+			}
+			if keys, paged := listed("?archived=true"); !reflect.DeepEqual(keys, []string{"checkout"}) || !reflect.DeepEqual(paged, []string{"checkout"}) {
+				t.Errorf("Expected only the archived flag to be listed, got %v and %v", keys, paged)
+			}
+			doRequest(t, router, "GET", "/api/projects/web/flags?archived=maybe", "", http.StatusBadRequest, nil)
+			var got FlagResponse
+			doRequest(t, router, "GET", "/api/projects/web/flags/checkout", "", http.StatusOK, &got)
+			if got.Config.ArchivedAt != archived.Config.ArchivedAt {
+				t.Errorf("Expected the archived flag to be readable, got %+v", got.Config)
+			}
+			var versions FlagVersionsResponse
+			doRequest(t, router, "GET", "/api/projects/web/flags/checkout/versions", "", http.StatusOK, &versions)
+			if len(versions.Versions) != 2 || versions.Versions[0].Config.ArchivedAt == "" {
+				t.Errorf("Expected the archival in the flag history, got %+v", versions.Versions)
+			}
+
+			// Archived flags must be restored to be changed, and cannot be
+			// archived by an update
+			var updated FlagResponse
+			doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":`+flag+`}`, http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout", flag, http.StatusConflict, nil)
+			doRequest(t, router, "PUT", "/api/projects/web/flags/banner", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"},"archivedAt":"2020-01-01T00:00:00Z"}}`, http.StatusOK, &updated)
+			if updated.Config.ArchivedAt != "" {
+				t.Errorf("Expected an update not to archive the flag, got %+v", updated.Config)
+			}
+
+			var restored FlagResponse
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout/restore", "", http.StatusOK, &restored)
+			if restored.Config.ArchivedAt != "" {
+				t.Errorf("Expected the flag to be restored, got %+v", restored.Config)
+			}
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout/restore", "", http.StatusConflict, nil)
+			if flags := served(); len(flags) != 2 {
+				t.Errorf("Expected the restored flag to be served, got %v", flags)
+			}
+
+			// Deleting archives the flag, and deleting it again purges it
+			doRequest(t, router, "DELETE", "/api/projects/web/flags/banner", "", http.StatusNoContent, nil)
+			var deleted FlagResponse
+			doRequest(t, router, "GET", "/api/projects/web/flags/banner", "", http.StatusOK, &deleted)
+			if deleted.Config.ArchivedAt == "" {
+				t.Errorf("Expected a deleted flag to be archived, got %+v", deleted.Config)
+			}
+			doRequest(t, router, "DELETE", "/api/projects/web/flags/banner", "", http.StatusNoContent, nil)
+			doRequest(t, router, "GET", "/api/projects/web/flags/banner", "", http.StatusNotFound, nil)
+
+			// Archived flags are purged once the retention has passed
+			ctx := context.Background()
+			doRequest(t, router, "DELETE", "/api/projects/web/flags/checkout", "", http.StatusNoContent, nil)
+			if n, err := fm.purgeArchivedFlags(ctx, time.Now().Add(time.Hour)); err != nil || n != 0 {
+				t.Errorf("Expected no flag purged within the retention, got %d, %v", n, err)
+			}
+			if n, err := fm.purgeArchivedFlags(ctx, time.Now().Add(25*time.Hour)); err != nil || n != 1 {
+				t.Errorf("Expected the archived flag purged after the retention, got %d, %v", n, err)
+			}
+			doRequest(t, router, "GET", "/api/projects/web/flags/checkout", "", http.StatusNotFound, nil)
+		})
+	}
+
+	for _, action := range []string{"flag.archived", "flag.restored"} {
+		events, err := store.ListAuditEvents(context.Background(), db.AuditFilterParams{PaginationParams: db.DefaultPagination(), Action: action})
+		if err != nil || events.Total == 0 {
+			t.Errorf("Expected %s audit events, got %v, %v", action, events, err)
+		}
+	}
+	if got := parseFlagArchiveRetention("7d"); got != 7*24*time.Hour {
+		t.Errorf("Expected 7d retention, got %v", got)
+	}
+	if got := parseFlagArchiveRetention("0"); got != 0 {
+		t.Errorf("Expected 0 to keep archived flags, got %v", got)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// TargetingAttribute is an evaluation context attribute referenced by targeting queries.
+type TargetingAttribute struct {
+	Name  string   `json:"name"`
+	Flags []string `json:"flags"`
+}
+
+// collectFlagQueries returns every targeting query in a flag config, including
+// the targeting rules of scheduled rollout steps.
+func collectFlagQueries(config FlagConfig) []string {
+	var queries []string
+	for _, rule := range config.Targeting {
+		if rule.Query != "" {
+			queries = append(queries, rule.Query)
+		}
+	}
+	for _, step := range config.ScheduledRollout {
+		for _, rule := range step.Targeting {
+			if rule.Query != "" {
+				queries = append(queries, rule.Query)
+			}
+		}
+	}
+	return queries
+}
+
+// ProjectAttributesResponse lists the targeting attributes of a project.
+type ProjectAttributesResponse struct {
+	Project    string               `json:"project"`
+	Attributes []TargetingAttribute `json:"attributes"`
+	Count      int                  `json:"count"`
+}
+
+// listProjectAttributesHandler returns the distinct attributes referenced by the
+// targeting queries of a project's flags, with the flags that use each one.
+func (fm *FlagManager) listProjectAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+
+	flags, err := fm.loadProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if flags == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	usage := make(map[string]map[string]bool)
+	for flagKey, config := range flags {
+		for _, query := range collectFlagQueries(config) {
+			for _, attr := range extractQueryAttributes(query) {
+				if usage[attr] == nil {
+					usage[attr] = make(map[string]bool)
+				}
+				usage[attr][flagKey] = true
+			}
+		}
+	}
+
+	attributes := make([]TargetingAttribute, 0, len(usage))
+	for name, flagSet := range usage {
+		attr := TargetingAttribute{Name: name, Flags: make([]string, 0, len(flagSet))}
+		for flagKey := range flagSet {
+			attr.Flags = append(attr.Flags, flagKey)
+		}
+		sort.Strings(attr.Flags)
+		attributes = append(attributes, attr)
+	}
+	sort.Slice(attributes, func(i, j int) bool { return attributes[i].Name < attributes[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProjectAttributesResponse{
+		Project:    project,
+		Attributes: attributes,
+		Count:      len(attributes),
+	})
+}
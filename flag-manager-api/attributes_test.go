@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListProjectAttributes(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	flags := map[string]FlagConfig{
+		"beta-banner": {
+			Variations:  map[string]interface{}{"on": true, "off": false},
+			Targeting:   []TargetingRule{{Query: `email ew "@company.com"`, Variation: "on"}},
+			DefaultRule: &DefaultRule{Variation: "off"},
+		},
+		"new-checkout": {
+			Variations: map[string]interface{}{"on": true, "off": false},
+			Targeting:  []TargetingRule{{Query: `country eq "US" and email pr`, Variation: "on"}},
+			ScheduledRollout: []ScheduledStep{
+				{Date: "2030-01-01T00:00:00Z", Targeting: []TargetingRule{{Query: `plan eq "pro"`, Variation: "on"}}},
+			},
+			DefaultRule: &DefaultRule{Variation: "off"},
+		},
+	}
+	for key, config := range flags {
+		body, _ := json.Marshal(config)
+		req := httptest.NewRequest("POST", "/api/projects/web/flags/"+key, bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to create flag %s: %d %s", key, rr.Code, rr.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/projects/web/attributes", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Attributes []TargetingAttribute `json:"attributes"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+
+	want := []TargetingAttribute{
+		{Name: "country", Flags: []string{"new-checkout"}},
+		{Name: "email", Flags: []string{"beta-banner", "new-checkout"}},
+		{Name: "plan", Flags: []string{"new-checkout"}},
+	}
+	if len(resp.Attributes) != len(want) {
+		t.Fatalf("Expected %d attributes, got %+v", len(want), resp.Attributes)
+	}
+	for i := range want {
+		if resp.Attributes[i].Name != want[i].Name || strings.Join(resp.Attributes[i].Flags, ",") != strings.Join(want[i].Flags, ",") {
+			t.Errorf("Attribute %d = %+v, want %+v", i, resp.Attributes[i], want[i])
+		}
+	}
+
+	req = httptest.NewRequest("GET", "/api/projects/missing/attributes", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing project, got %d", rr.Code)
+	}
+}
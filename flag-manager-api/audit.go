@@ -1,33 +1,54 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"flag-manager-api/db"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
 )
 
 // AuditLogger provides methods to log audit events.
 type AuditLogger struct {
-	store *db.Store
+	store  *db.Store
+	file   *AuditLogStore
+	feed   *ChangeFeed
+	sinks  *auditSinkDispatcher
+	notify *notifierDispatcher
 }
 
-// NewAuditLogger creates a new audit logger.
-func NewAuditLogger(store *db.Store) *AuditLogger {
-	return &AuditLogger{store: store}
+// NewAuditLogger creates a new audit logger. Events are stored when a database
+// is configured and published to the change feed, if any, and streamed to the
+// audit sinks and notifiers in both modes.
+func NewAuditLogger(store *db.Store, feed *ChangeFeed) *AuditLogger {
+	return &AuditLogger{store: store, feed: feed, sinks: &auditSinkDispatcher{}, notify: &notifierDispatcher{}}
+}
+
+// NewFileAuditLogger creates an audit logger for file mode, which appends
+// events to an audit log file.
+func NewFileAuditLogger(file *AuditLogStore, feed *ChangeFeed) *AuditLogger {
+	return &AuditLogger{file: file, feed: feed, sinks: &auditSinkDispatcher{}, notify: &notifierDispatcher{}}
 }
 
 // Log records an audit event. It does not fail the request if logging fails.
 func (al *AuditLogger) Log(ctx context.Context, actor Actor, action, resourceType, resourceID, resourceName, project string, changes, metadata interface{}) {
-	if al == nil || al.store == nil {
+	if al == nil {
 		return
 	}
 
@@ -37,13 +58,26 @@ func (al *AuditLogger) Log(ctx context.Context, actor Actor, action, resourceTyp
 			changesJSON = data
 		}
 	}
+
 	if metadata != nil {
 		if data, err := json.Marshal(metadata); err == nil {
 			metadataJSON = data
 		}
 	}
 
+	change := newChangeEvent(actor, action, resourceType, resourceID, resourceName, project, changes, changesJSON)
+	al.feed.Publish(change)
+	if n, ok := newNotification(change, metadataJSON); ok {
+		al.notify.publish(n)
+	}
+
+	if al.store == nil && al.file == nil {
+		return
+	}
+
 	event := db.AuditEvent{
+		ID:           uuid.New().String(),
+		Timestamp:    time.Now().UTC(),
 		ActorID:      actor.ID,
 		ActorEmail:   actor.Email,
 		ActorName:    actor.Name,
@@ -55,11 +89,218 @@ func (al *AuditLogger) Log(ctx context.Context, actor Actor, action, resourceTyp
 		Project:      project,
 		Changes:      changesJSON,
 		Metadata:     metadataJSON,
+		RequestID:    requestIDFrom(ctx),
+	}
+
+	var err error
+	if al.store != nil {
+		err = al.store.LogAudit(ctx, event)
+	} else {
+		err = al.file.Append(event)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to log audit event", "action", action, "error", err)
+	}
+	al.sinks.publish(event)
+}
+
+// Audit log defaults for file mode, overridden by AUDIT_LOG_MAX_SIZE (in MB)
+// and AUDIT_LOG_MAX_FILES.
+const (
+	defaultAuditLogMaxSize  = 10 << 20
+	defaultAuditLogMaxFiles = 5
+)
+
+// AuditLogStore is the append-only audit log of file mode: one JSON event per
+// line in audit.jsonl. When the file grows past maxSize it is rotated to
+// audit.1.jsonl, shifting older files up to audit.<maxFiles>.jsonl; older
+// events are dropped.
+type AuditLogStore struct {
+	dir      string
+	maxSize  int64
+	maxFiles int
+	mu       sync.Mutex
+}
+
+// NewAuditLogStore creates an audit log in configDir.
+func NewAuditLogStore(configDir string, maxSize int64, maxFiles int) *AuditLogStore {
+	return &AuditLogStore{dir: configDir, maxSize: maxSize, maxFiles: maxFiles}
+}
+
+// path returns the path of the current log (n = 0) or of the nth rotated log.
+func (s *AuditLogStore) path(n int) string {
+	if n == 0 {
+		return filepath.Join(s.dir, "audit.jsonl")
+	}
+	return filepath.Join(s.dir, fmt.Sprintf("audit.%d.jsonl", n))
+}
+
+// Append assigns the event an ID and timestamp and writes it to the log.
+func (s *AuditLogStore) Append(event db.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+		event.Timestamp = time.Now().UTC()
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path(0), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(s.path(0)); err == nil && s.maxSize > 0 && info.Size() >= s.maxSize {
+		return s.rotate()
+	}
+	return nil
+}
+
+func (s *AuditLogStore) rotate() error {
+	if s.maxFiles < 1 {
+		return os.Remove(s.path(0))
+	}
+	if err := os.Remove(s.path(s.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := s.maxFiles - 1; n >= 0; n-- {
+		if err := os.Rename(s.path(n), s.path(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// events returns every logged event, oldest first.
+func (s *AuditLogStore) events() ([]db.AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []db.AuditEvent
+	for n := s.maxFiles; n >= 0; n-- {
+		data, err := os.ReadFile(s.path(n))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var e db.AuditEvent
+			if err := json.Unmarshal(line, &e); err != nil {
+				// Skip a line torn by a crash mid-write
+				continue
+			}
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// List returns logged events matching params, with the filters, sorting and
+// pagination of db.Store.ListAuditEvents.
+func (s *AuditLogStore) List(params db.AuditFilterParams) (*db.PaginatedResult[db.AuditEvent], error) {
+	all, err := s.events()
+	if err != nil {
+		return nil, err
+	}
+
+	search := strings.ToLower(params.Search)
+	events := []db.AuditEvent{}
+	for _, e := range all {
+		if (params.Action != "" && e.Action != params.Action) ||
+			(params.ResourceType != "" && e.ResourceType != params.ResourceType) ||
+			(params.ActorID != "" && e.ActorID != params.ActorID && !strings.EqualFold(e.ActorEmail, params.ActorID)) ||
+			(params.From != nil && e.Timestamp.Before(*params.From)) ||
+			(params.To != nil && e.Timestamp.After(*params.To)) {
+			continue
+		}
+		if search != "" &&
+			!strings.Contains(strings.ToLower(e.ResourceName), search) &&
+			!strings.Contains(strings.ToLower(e.Action), search) &&
+			!strings.Contains(strings.ToLower(e.Project), search) {
+			continue
+		}
+		events = append(events, e)
+	}
+
+	less := func(a, b db.AuditEvent) bool {
+		switch params.Sort {
+		case "action":
+			return a.Action < b.Action
+		case "resource_type":
+			return a.ResourceType < b.ResourceType
+		}
+		return a.Timestamp.Before(b.Timestamp)
+	}
+	desc := params.OrderDirection() == "DESC"
+	if desc {
+		// Keep events logged in the same instant newest first
+		slices.Reverse(events)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if desc {
+			return less(events[j], events[i])
+		}
+		return less(events[i], events[j])
+	})
+
+	total := len(events)
+	start := min(params.Offset(), total)
+	end := min(start+params.Limit(), total)
+	return db.NewPaginatedResult(events[start:end], total, params.PaginationParams), nil
+}
+
+// parseAuditLogMaxSize reads the AUDIT_LOG_MAX_SIZE setting in megabytes.
+func parseAuditLogMaxSize(value string) int64 {
+	if value == "" {
+		return defaultAuditLogMaxSize
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		slog.Warn("Invalid AUDIT_LOG_MAX_SIZE, using default", "value", value, "default_mb", defaultAuditLogMaxSize>>20)
+		return defaultAuditLogMaxSize
 	}
+	return int64(n) << 20
+}
 
-	if err := al.store.LogAudit(ctx, event); err != nil {
-		log.Printf("Warning: failed to log audit event: %v", err)
+// parseAuditLogMaxFiles reads the AUDIT_LOG_MAX_FILES setting. Zero keeps no
+// rotated files.
+func parseAuditLogMaxFiles(value string) int {
+	if value == "" {
+		return defaultAuditLogMaxFiles
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		slog.Warn("Invalid AUDIT_LOG_MAX_FILES, using default", "value", value, "default", defaultAuditLogMaxFiles)
+		return defaultAuditLogMaxFiles
 	}
+	return n
+}
+
+// listAuditEvents lists audit events from the database or the audit log file.
+func (fm *FlagManager) listAuditEvents(ctx context.Context, params db.AuditFilterParams) (*db.PaginatedResult[db.AuditEvent], error) {
+	if fm.store != nil {
+		return fm.store.ListAuditEvents(ctx, params)
+	}
+	if fm.auditLog == nil {
+		return db.NewPaginatedResult([]db.AuditEvent{}, 0, params.PaginationParams), nil
+	}
+	return fm.auditLog.List(params)
 }
 
 // Audit endpoint handlers
@@ -67,9 +308,9 @@ func (al *AuditLogger) Log(ctx context.Context, actor Actor, action, resourceTyp
 func (fm *FlagManager) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
 	params := parseAuditParams(r)
 
-	result, err := fm.store.ListAuditEvents(r.Context(), params)
+	result, err := fm.listAuditEvents(r.Context(), params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -88,9 +329,9 @@ func (fm *FlagManager) exportAuditEventsHandler(w http.ResponseWriter, r *http.R
 	params.PageSize = 10000
 	params.Page = 1
 
-	result, err := fm.store.ListAuditEvents(r.Context(), params)
+	result, err := fm.listAuditEvents(r.Context(), params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -101,7 +342,7 @@ func (fm *FlagManager) exportAuditEventsHandler(w http.ResponseWriter, r *http.R
 
 		writer := csv.NewWriter(w)
 		// Header
-		writer.Write([]string{"Timestamp", "Actor", "Actor Type", "Action", "Resource Type", "Resource ID", "Resource Name", "Project"})
+		writer.Write([]string{"Timestamp", "Actor", "Actor Type", "Action", "Resource Type", "Resource ID", "Resource Name", "Project", "Request ID"})
 
 		for _, e := range result.Data {
 			actorDisplay := e.ActorEmail
@@ -117,6 +358,7 @@ func (fm *FlagManager) exportAuditEventsHandler(w http.ResponseWriter, r *http.R
 				e.ResourceID,
 				e.ResourceName,
 				e.Project,
+				e.RequestID,
 			})
 		}
 		writer.Flush()
@@ -127,10 +369,16 @@ func (fm *FlagManager) exportAuditEventsHandler(w http.ResponseWriter, r *http.R
 		json.NewEncoder(w).Encode(result.Data)
 
 	default:
-		http.Error(w, "Unsupported format. Use csv or json.", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Unsupported format. Use csv or json.")
 	}
 }
 
+// FlagAuditResponse lists the audit events of a flag.
+type FlagAuditResponse struct {
+	Data  []db.AuditEvent `json:"data"`
+	Total int             `json:"total"`
+}
+
 func (fm *FlagManager) getFlagAuditHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	project := vars["project"]
@@ -138,13 +386,13 @@ func (fm *FlagManager) getFlagAuditHandler(w http.ResponseWriter, r *http.Reques
 
 	params := parsePaginationParams(r)
 
-	result, err := fm.store.ListAuditEvents(r.Context(), db.AuditFilterParams{
+	result, err := fm.listAuditEvents(r.Context(), db.AuditFilterParams{
 		PaginationParams: params,
 		ResourceType:     "flag",
 		Action:           "", // All actions
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -160,9 +408,9 @@ func (fm *FlagManager) getFlagAuditHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"data":  filtered,
-		"total": len(filtered),
+	json.NewEncoder(w).Encode(FlagAuditResponse{
+		Data:  filtered,
+		Total: len(filtered),
 	})
 }
 
@@ -198,7 +446,11 @@ func parsePaginationParams(r *http.Request) db.PaginationParams {
 			params.Page = p
 		}
 	}
-	if pageSize := r.URL.Query().Get("pageSize"); pageSize != "" {
+	pageSize := r.URL.Query().Get("pageSize")
+	if pageSize == "" {
+		pageSize = r.URL.Query().Get("perPage")
+	}
+	if pageSize != "" {
 		if ps, err := strconv.Atoi(pageSize); err == nil && ps > 0 {
 			params.PageSize = ps
 		}
@@ -218,72 +470,169 @@ func parsePaginationParams(r *http.Request) db.PaginationParams {
 
 // API Key management endpoints
 
+// APIKeysResponse lists the API keys.
+type APIKeysResponse struct {
+	APIKeys []db.APIKey `json:"apiKeys"`
+}
+
+// CreateAPIKeyResponse is a new API key with its secret, which is only ever
+// returned here.
+type CreateAPIKeyResponse struct {
+	APIKey *db.APIKey `json:"apiKey"`
+	Key    string     `json:"key"`
+}
+
 func (fm *FlagManager) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
 	keys, err := fm.store.ListAPIKeys(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"apiKeys": keys})
+	json.NewEncoder(w).Encode(APIKeysResponse{APIKeys: keys})
 }
 
+// createAPIKeyHandler creates an API key. A key bound to a role with roleId
+// acts as a service account with that role's permissions, within projects and
+// flagSets when given; readOnly keys may only read.
 func (fm *FlagManager) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		Name        string   `json:"name"`
-		Permissions []string `json:"permissions"`
-		ExpiresIn   string   `json:"expiresIn,omitempty"` // e.g., "30d", "90d", "never"
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		ExpiresIn   string     `json:"expiresIn,omitempty"` // e.g., "30d", "90d", "never"
+		ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+		RoleID      string     `json:"roleId,omitempty"`
+		Projects    []string   `json:"projects,omitempty"`
+		FlagSets    []string   `json:"flagSets,omitempty"`
+		ReadOnly    bool       `json:"readOnly,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if body.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Name is required")
 		return
 	}
 
-	if len(body.Permissions) == 0 {
+	if body.RoleID != "" && len(body.Permissions) > 0 {
+		writeValidationError(w, "INVALID_API_KEY_SCOPE", "API key scope is invalid", "permissions cannot be combined with roleId")
+		return
+	}
+	if body.RoleID == "" && len(body.Permissions) == 0 {
 		body.Permissions = []string{"read"}
 	}
+	for _, permission := range body.Permissions {
+		if _, ok := apiKeyPermissions[permission]; !ok {
+			writeValidationError(w, "INVALID_API_KEY_SCOPE", "API key scope is invalid", "unknown permission: "+permission+" (use read, write or admin)")
+			return
+		}
+	}
 
-	var expiresAt *time.Time
+	expiresAt := body.ExpiresAt
 	if body.ExpiresIn != "" && body.ExpiresIn != "never" {
+		if expiresAt != nil {
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", "expiresIn and expiresAt cannot both be set")
+			return
+		}
 		duration, err := parseDuration(body.ExpiresIn)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid expiresIn: %v", err), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", fmt.Sprintf("Invalid expiresIn: %v", err))
 			return
 		}
 		t := time.Now().Add(duration)
 		expiresAt = &t
+	} else if expiresAt != nil && !expiresAt.After(time.Now()) {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "expiresAt must be in the future")
+		return
 	}
 
-	key, rawKey, err := fm.store.CreateAPIKey(r.Context(), body.Name, body.Permissions, expiresAt)
+	if errs := fm.validateAPIKeyScope(r.Context(), body.RoleID, body.Projects, body.FlagSets); len(errs) > 0 {
+		writeValidationError(w, "INVALID_API_KEY_SCOPE", "API key scope is invalid", errs...)
+		return
+	}
+
+	key, rawKey, err := fm.store.CreateAPIKey(r.Context(), db.APIKey{
+		Name:        body.Name,
+		Permissions: body.Permissions,
+		RoleID:      body.RoleID,
+		Projects:    body.Projects,
+		FlagSets:    body.FlagSets,
+		ReadOnly:    body.ReadOnly,
+		ExpiresAt:   expiresAt,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	// Log audit event
-	fm.audit.Log(r.Context(), GetActor(r), "apikey.created", "apikey", key.ID, key.Name, "", nil, nil)
+	fm.audit.Log(r.Context(), GetActor(r), "apikey.created", "apikey", key.ID, key.Name, "", nil,
+		map[string]interface{}{"permissions": key.Permissions, "roleId": key.RoleID, "projects": key.Projects, "flagSets": key.FlagSets, "readOnly": key.ReadOnly})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"apiKey": key,
-		"key":    rawKey, // Only returned once at creation
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{
+		APIKey: key,
+		Key:    rawKey, // Only returned once at creation
 	})
 }
 
+// validateAPIKeyScope checks that the role and flag sets of an API key exist
+// and its projects are valid project names.
+func (fm *FlagManager) validateAPIKeyScope(ctx context.Context, roleID string, projects, flagSets []string) []string {
+	var errs []string
+	if roleID != "" {
+		if _, err := fm.store.GetRole(ctx, roleID); err != nil {
+			errs = append(errs, "role not found: "+roleID)
+		}
+	}
+	for i, project := range projects {
+		if err := ValidateProjectName(project); err != nil {
+			errs = append(errs, err.Error())
+		} else if slices.Contains(projects[:i], project) {
+			errs = append(errs, "duplicate project: "+project)
+		}
+	}
+	for i, flagSetID := range flagSets {
+		if _, err := fm.store.GetFlagSet(ctx, flagSetID); err != nil {
+			errs = append(errs, "flag set not found: "+flagSetID)
+		} else if slices.Contains(flagSets[:i], flagSetID) {
+			errs = append(errs, "duplicate flag set: "+flagSetID)
+		}
+	}
+	return errs
+}
+
+// rotateAPIKeyHandler replaces the secret of an API key, keeping its role,
+// scope and expiry. The new key is only returned here.
+func (fm *FlagManager) rotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	key, rawKey, err := fm.store.RotateAPIKey(r.Context(), id)
+	if err == pgx.ErrNoRows {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "API key not found")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "apikey.rotated", "apikey", key.ID, key.Name, "", nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{APIKey: key, Key: rawKey})
+}
+
 func (fm *FlagManager) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	if err := fm.store.DeleteAPIKey(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		return
 	}
 
@@ -0,0 +1,864 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+	"flag-manager-api/httpclient"
+	"flag-manager-api/secrets"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errAuditSinkNotFound = errors.New("audit sink not found")
+	errAuditSinkExists   = errors.New("audit sink already exists")
+)
+
+const (
+	auditSinkQueueSize       = 1000 // events waiting for delivery, per sink
+	auditSinkMaxAttempts     = 5
+	auditSinkDeadLetterLimit = 1000 // undelivered events kept per sink; the oldest are dropped
+	auditSinkTimeout         = 10 * time.Second
+	defaultSyslogFacility    = 16 // local0
+	defaultSyslogAppName     = "goff"
+)
+
+// auditSinkRetryDelay is the delay before the first retry of a delivery; it
+// doubles on each further attempt.
+var auditSinkRetryDelay = time.Second
+
+// auditSinkKinds are the kinds of audit sinks.
+var auditSinkKinds = []string{"webhook", "kafka", "syslog"}
+
+// AuditSinksStore manages audit sink persistence in file mode
+type AuditSinksStore struct {
+	filePath string
+	cipher   *secrets.Cipher
+	sinks    []db.AuditSink
+	mu       sync.RWMutex
+}
+
+// NewAuditSinksStore creates a new audit sinks store
+func NewAuditSinksStore(configDir string, cipher *secrets.Cipher) *AuditSinksStore {
+	store := &AuditSinksStore{
+		filePath: filepath.Join(configDir, "audit_sinks.json"),
+		cipher:   cipher,
+	}
+	store.load()
+	return store
+}
+
+func (s *AuditSinksStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := readSealedFile(s.filePath, s.cipher, db.AuditSinkSecretFields)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.sinks)
+}
+
+func (s *AuditSinksStore) save() error {
+	data, err := json.MarshalIndent(s.sinks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSealedFile(s.filePath, data, 0600, s.cipher, db.AuditSinkSecretFields)
+}
+
+// nameTaken reports whether a sink other than id is named name.
+func (s *AuditSinksStore) nameTaken(name, id string) bool {
+	for _, sink := range s.sinks {
+		if sink.Name == name && sink.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the sinks ordered by name
+func (s *AuditSinksStore) List() []db.AuditSink {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sinks := append([]db.AuditSink{}, s.sinks...)
+	sort.Slice(sinks, func(i, j int) bool {
+		return sinks[i].Name < sinks[j].Name
+	})
+	return sinks
+}
+
+// Get returns a sink, or errAuditSinkNotFound
+func (s *AuditSinksStore) Get(id string) (*db.AuditSink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, sink := range s.sinks {
+		if sink.ID == id {
+			return &sink, nil
+		}
+	}
+	return nil, errAuditSinkNotFound
+}
+
+// Create stores a sink and returns it with its ID and timestamps
+func (s *AuditSinksStore) Create(sink db.AuditSink) (*db.AuditSink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(sink.Name, "") {
+		return nil, errAuditSinkExists
+	}
+	now := time.Now().UTC()
+	sink.ID = uuid.New().String()
+	sink.CreatedAt = now
+	sink.UpdatedAt = now
+	s.sinks = append(s.sinks, sink)
+	if err := s.save(); err != nil {
+		s.sinks = s.sinks[:len(s.sinks)-1]
+		return nil, err
+	}
+	return &sink, nil
+}
+
+// Update replaces a sink, keeping its ID and creation time
+func (s *AuditSinksStore) Update(id string, sink db.AuditSink) (*db.AuditSink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.sinks {
+		if existing.ID != id {
+			continue
+		}
+		if s.nameTaken(sink.Name, id) {
+			return nil, errAuditSinkExists
+		}
+		sink.ID = id
+		sink.CreatedAt = existing.CreatedAt
+		sink.UpdatedAt = time.Now().UTC()
+		s.sinks[i] = sink
+		if err := s.save(); err != nil {
+			s.sinks[i] = existing
+			return nil, err
+		}
+		return &sink, nil
+	}
+	return nil, errAuditSinkNotFound
+}
+
+// Delete removes a sink
+func (s *AuditSinksStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, sink := range s.sinks {
+		if sink.ID != id {
+			continue
+		}
+		previous := s.sinks
+		s.sinks = append(s.sinks[:i:i], s.sinks[i+1:]...)
+		if err := s.save(); err != nil {
+			s.sinks = previous
+			return err
+		}
+		return nil
+	}
+	return errAuditSinkNotFound
+}
+
+// auditSinkStoreError maps database errors to errAuditSinkNotFound and
+// errAuditSinkExists.
+func auditSinkStoreError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return errAuditSinkNotFound
+	case strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "UNIQUE"):
+		return errAuditSinkExists
+	}
+	return err
+}
+
+func (fm *FlagManager) listAuditSinks(ctx context.Context) ([]db.AuditSink, error) {
+	if fm.store != nil {
+		return fm.store.ListAuditSinks(ctx)
+	}
+	return fm.auditSinks.List(), nil
+}
+
+func (fm *FlagManager) getAuditSink(ctx context.Context, id string) (*db.AuditSink, error) {
+	if fm.store != nil {
+		sink, err := fm.store.GetAuditSink(ctx, id)
+		return sink, auditSinkStoreError(err)
+	}
+	return fm.auditSinks.Get(id)
+}
+
+func (fm *FlagManager) createAuditSink(ctx context.Context, sink db.AuditSink) (*db.AuditSink, error) {
+	if fm.store != nil {
+		created, err := fm.store.CreateAuditSink(ctx, sink)
+		return created, auditSinkStoreError(err)
+	}
+	return fm.auditSinks.Create(sink)
+}
+
+func (fm *FlagManager) updateAuditSink(ctx context.Context, id string, sink db.AuditSink) (*db.AuditSink, error) {
+	if fm.store != nil {
+		updated, err := fm.store.UpdateAuditSink(ctx, id, sink)
+		return updated, auditSinkStoreError(err)
+	}
+	return fm.auditSinks.Update(id, sink)
+}
+
+func (fm *FlagManager) deleteAuditSink(ctx context.Context, id string) error {
+	if fm.store != nil {
+		return auditSinkStoreError(fm.store.DeleteAuditSink(ctx, id))
+	}
+	return fm.auditSinks.Delete(id)
+}
+
+// reloadAuditSinks hands the configured sinks to the audit logger, which
+// streams events to the enabled ones.
+func (fm *FlagManager) reloadAuditSinks(ctx context.Context) error {
+	sinks, err := fm.listAuditSinks(ctx)
+	if err != nil {
+		return err
+	}
+	fm.audit.sinks.configure(sinks)
+	return nil
+}
+
+// writeAuditSinkError responds with the status of an audit sink store error.
+func writeAuditSinkError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errAuditSinkNotFound):
+		writeError(w, http.StatusNotFound, "AUDIT_SINK_NOT_FOUND", "Audit sink not found")
+	case errors.Is(err, errAuditSinkExists):
+		writeError(w, http.StatusConflict, "AUDIT_SINK_EXISTS", "Audit sink with this name already exists")
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+}
+
+// validateAuditSink checks the name, kind and the settings its kind needs.
+func validateAuditSink(sink db.AuditSink) []string {
+	var errs []string
+	if sink.Name == "" {
+		errs = append(errs, "name is required")
+	}
+	c := sink.Config
+	checkURL := func(field string) {
+		u, err := url.Parse(c.URL)
+		if c.URL == "" {
+			errs = append(errs, field+" is required")
+		} else if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, field+" must be an http or https URL")
+		}
+	}
+	switch sink.Kind {
+	case "webhook":
+		checkURL("url")
+	case "kafka":
+		checkURL("url of the Kafka REST proxy")
+		if c.Topic == "" {
+			errs = append(errs, "topic is required")
+		} else if strings.ContainsAny(c.Topic, "/?#") {
+			errs = append(errs, "topic must not contain '/', '?' or '#'")
+		}
+	case "syslog":
+		if c.Network != "" && c.Network != "udp" && c.Network != "tcp" {
+			errs = append(errs, "network must be udp or tcp")
+		}
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			errs = append(errs, "address must be host:port")
+		}
+		if c.Facility < 0 || c.Facility > 23 {
+			errs = append(errs, "facility must be between 0 and 23")
+		}
+	default:
+		errs = append(errs, "kind must be one of "+strings.Join(auditSinkKinds, ", "))
+	}
+	return errs
+}
+
+// maskAuditSink hides the webhook secret and the header values of a sink,
+// which often carry credentials such as an Authorization header.
+func maskAuditSink(sink db.AuditSink) db.AuditSink {
+	if sink.Config.Secret != "" {
+		sink.Config.Secret = "********"
+	}
+	if len(sink.Config.Headers) > 0 {
+		headers := make(map[string]string, len(sink.Config.Headers))
+		for name := range sink.Config.Headers {
+			headers[name] = "********"
+		}
+		sink.Config.Headers = headers
+	}
+	return sink
+}
+
+// auditSender delivers an audit event to a sink.
+type auditSender func(ctx context.Context, event db.AuditEvent) error
+
+// newAuditSender returns the sender of a sink's kind.
+func newAuditSender(sink db.AuditSink) auditSender {
+	c := sink.Config
+	switch sink.Kind {
+	case "webhook":
+		return func(ctx context.Context, event db.AuditEvent) error {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			headers := map[string]string{projectWebhookEventHeader: "audit." + event.Action}
+			if c.Secret != "" {
+				headers[projectWebhookSignatureHeader] = "sha256=" + signProjectWebhookPayload(c.Secret, data)
+			}
+			return postAuditEvent(ctx, c.URL, "application/json", data, c.Headers, headers)
+		}
+	case "kafka":
+		// Kafka is reached through a Kafka REST proxy (Confluent REST API v2).
+		// Events of the same resource share a key, so they keep their order.
+		return func(ctx context.Context, event db.AuditEvent) error {
+			data, err := json.Marshal(map[string]interface{}{
+				"records": []map[string]interface{}{{"key": event.ResourceType + ":" + event.ResourceID, "value": event}},
+			})
+			if err != nil {
+				return err
+			}
+			endpoint := strings.TrimSuffix(c.URL, "/") + "/topics/" + url.PathEscape(c.Topic)
+			return postAuditEvent(ctx, endpoint, "application/vnd.kafka.json.v2+json", data, c.Headers, nil)
+		}
+	case "syslog":
+		return func(ctx context.Context, event db.AuditEvent) error {
+			return sendSyslog(ctx, c, event)
+		}
+	}
+	return func(context.Context, db.AuditEvent) error {
+		return fmt.Errorf("unknown audit sink kind %q", sink.Kind)
+	}
+}
+
+// postAuditEvent posts an event body and fails on non-2xx responses.
+func postAuditEvent(ctx context.Context, endpoint, contentType string, body []byte, headers ...map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, auditSinkTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for _, h := range headers {
+		for k, v := range h {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := httpclient.Default().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("audit sink returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// syslogMessage formats an event as an RFC 5424 message with severity
+// informational, the action as message ID and the event as JSON.
+func syslogMessage(c db.AuditSinkConfig, event db.AuditEvent, hostname string) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	facility := c.Facility
+	if facility == 0 {
+		facility = defaultSyslogFacility
+	}
+	appName := c.AppName
+	if appName == "" {
+		appName = defaultSyslogAppName
+	}
+	msgID := event.Action
+	if len(msgID) > 32 {
+		msgID = msgID[:32]
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ", facility*8+6,
+		event.Timestamp.UTC().Format(time.RFC3339Nano), hostname, appName, os.Getpid(), msgID)
+	return append([]byte(header), data...), nil
+}
+
+// sendSyslog sends an event to a syslog endpoint, framing it with its length
+// over TCP (RFC 6587).
+func sendSyslog(ctx context.Context, c db.AuditSinkConfig, event db.AuditEvent) error {
+	hostname, _ := os.Hostname()
+	msg, err := syslogMessage(c, event, hostname)
+	if err != nil {
+		return err
+	}
+	network := c.Network
+	if network == "" {
+		network = "udp"
+	}
+
+	dialer := net.Dialer{Timeout: auditSinkTimeout}
+	conn, err := dialer.DialContext(ctx, network, c.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(auditSinkTimeout))
+	if network == "tcp" {
+		msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	_, err = conn.Write(msg)
+	return err
+}
+
+// AuditDeadLetter is an audit event a sink failed to receive after every
+// retry.
+type AuditDeadLetter struct {
+	Event    db.AuditEvent `json:"event"`
+	Error    string        `json:"error"`
+	Attempts int           `json:"attempts"`
+	FailedAt time.Time     `json:"failedAt"`
+}
+
+// AuditSinkStatus is the delivery state of a sink.
+type AuditSinkStatus struct {
+	Queued          int        `json:"queued"`
+	Delivered       int        `json:"delivered"`
+	Failed          int        `json:"failed"` // events moved to the dead-letter buffer
+	DeadLetters     int        `json:"deadLetters"`
+	LastError       string     `json:"lastError,omitempty"`
+	LastDeliveredAt *time.Time `json:"lastDeliveredAt,omitempty"`
+}
+
+// auditSinkState is the queue, delivery worker and dead-letter buffer of a
+// sink. The worker runs until the sink is deleted; a changed sink keeps its
+// queue and dead letters.
+type auditSinkState struct {
+	queue chan db.AuditEvent
+	stop  chan struct{}
+
+	mu          sync.Mutex
+	sink        db.AuditSink
+	send        auditSender
+	status      AuditSinkStatus
+	deadLetters []AuditDeadLetter
+}
+
+func (s *auditSinkState) run() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case event := <-s.queue:
+			s.deliver(event)
+		}
+	}
+}
+
+// deliver sends an event, retrying failed attempts with exponential backoff,
+// and moves it to the dead-letter buffer when every attempt failed.
+func (s *auditSinkState) deliver(event db.AuditEvent) {
+	delay := auditSinkRetryDelay
+	for attempt := 1; ; attempt++ {
+		s.mu.Lock()
+		send := s.send
+		s.mu.Unlock()
+
+		err := send(context.Background(), event)
+		if err == nil {
+			now := time.Now().UTC()
+			s.mu.Lock()
+			s.status.Delivered++
+			s.status.LastDeliveredAt = &now
+			s.mu.Unlock()
+			return
+		}
+		if attempt == auditSinkMaxAttempts {
+			s.deadLetter(event, err, attempt)
+			return
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-s.stop:
+			s.deadLetter(event, err, attempt)
+			return
+		}
+	}
+}
+
+func (s *auditSinkState) deadLetter(event db.AuditEvent, err error, attempts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Failed++
+	s.status.LastError = err.Error()
+	s.deadLetters = append(s.deadLetters, AuditDeadLetter{Event: event, Error: err.Error(), Attempts: attempts, FailedAt: time.Now().UTC()})
+	if n := len(s.deadLetters) - auditSinkDeadLetterLimit; n > 0 {
+		s.deadLetters = append([]AuditDeadLetter(nil), s.deadLetters[n:]...)
+	}
+	slog.Warn("Audit event not delivered to sink", "sink", s.sink.Name, "action", event.Action, "attempts", attempts, "error", err)
+}
+
+// enqueue queues an event for delivery. Events that do not fit in the queue
+// go to the dead-letter buffer at once.
+func (s *auditSinkState) enqueue(event db.AuditEvent) {
+	select {
+	case s.queue <- event:
+	default:
+		s.deadLetter(event, errors.New("delivery queue full"), 0)
+	}
+}
+
+// auditSinkDispatcher streams audit events to the configured sinks. The zero
+// value has no sinks and is ready to use.
+type auditSinkDispatcher struct {
+	mu     sync.RWMutex
+	states map[string]*auditSinkState
+}
+
+// configure replaces the sinks events are streamed to.
+func (d *auditSinkDispatcher) configure(sinks []db.AuditSink) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	states := make(map[string]*auditSinkState, len(sinks))
+	for _, sink := range sinks {
+		s, ok := d.states[sink.ID]
+		if !ok {
+			s = &auditSinkState{queue: make(chan db.AuditEvent, auditSinkQueueSize), stop: make(chan struct{})}
+			go s.run()
+		}
+		s.mu.Lock()
+		s.sink = sink
+		s.send = newAuditSender(sink)
+		s.mu.Unlock()
+		states[sink.ID] = s
+	}
+	for id, s := range d.states {
+		if _, ok := states[id]; !ok {
+			close(s.stop)
+		}
+	}
+	d.states = states
+}
+
+// publish queues an event for every enabled sink.
+func (d *auditSinkDispatcher) publish(event db.AuditEvent) {
+	if d == nil {
+		return
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, s := range d.states {
+		s.mu.Lock()
+		enabled := s.sink.Enabled
+		s.mu.Unlock()
+		if enabled {
+			s.enqueue(event)
+		}
+	}
+}
+
+func (d *auditSinkDispatcher) state(id string) *auditSinkState {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.states[id]
+}
+
+// status returns the delivery state of a sink.
+func (d *auditSinkDispatcher) status(id string) AuditSinkStatus {
+	s := d.state(id)
+	if s == nil {
+		return AuditSinkStatus{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Queued = len(s.queue)
+	status.DeadLetters = len(s.deadLetters)
+	return status
+}
+
+// deadLetters returns the undelivered events of a sink, oldest first.
+func (d *auditSinkDispatcher) deadLetters(id string) []AuditDeadLetter {
+	s := d.state(id)
+	if s == nil {
+		return []AuditDeadLetter{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]AuditDeadLetter{}, s.deadLetters...)
+}
+
+// takeDeadLetters empties the dead-letter buffer of a sink and returns its
+// state and undelivered events.
+func (d *auditSinkDispatcher) takeDeadLetters(id string) (*auditSinkState, []AuditDeadLetter) {
+	s := d.state(id)
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	letters := s.deadLetters
+	s.deadLetters = nil
+	return s, letters
+}
+
+// retryDeadLetters queues the undelivered events of a sink again and returns
+// how many there were.
+func (d *auditSinkDispatcher) retryDeadLetters(id string) int {
+	s, letters := d.takeDeadLetters(id)
+	for _, letter := range letters {
+		s.enqueue(letter.Event)
+	}
+	return len(letters)
+}
+
+// clearDeadLetters drops the undelivered events of a sink.
+func (d *auditSinkDispatcher) clearDeadLetters(id string) {
+	d.takeDeadLetters(id)
+}
+
+// AuditSinkResponse is a sink, with its secret masked, and its delivery state.
+type AuditSinkResponse struct {
+	db.AuditSink
+	Status AuditSinkStatus `json:"status"`
+}
+
+// AuditSinksResponse lists the audit sinks.
+type AuditSinksResponse struct {
+	Sinks []AuditSinkResponse `json:"sinks"`
+	Total int                 `json:"total"`
+}
+
+func (fm *FlagManager) auditSinkResponse(sink db.AuditSink) AuditSinkResponse {
+	return AuditSinkResponse{AuditSink: maskAuditSink(sink), Status: fm.audit.sinks.status(sink.ID)}
+}
+
+func (fm *FlagManager) listAuditSinksHandler(w http.ResponseWriter, r *http.Request) {
+	sinks, err := fm.listAuditSinks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	resp := AuditSinksResponse{Sinks: make([]AuditSinkResponse, 0, len(sinks)), Total: len(sinks)}
+	for _, sink := range sinks {
+		resp.Sinks = append(resp.Sinks, fm.auditSinkResponse(sink))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (fm *FlagManager) getAuditSinkHandler(w http.ResponseWriter, r *http.Request) {
+	sink, err := fm.getAuditSink(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fm.auditSinkResponse(*sink))
+}
+
+// decodeAuditSink reads and validates the sink of a request body. An empty or
+// masked secret keeps the secret of previous, if any, and a masked header
+// value the value of its header. It writes the error response and returns
+// false when the sink is invalid.
+func decodeAuditSink(w http.ResponseWriter, r *http.Request, previous *db.AuditSink) (db.AuditSink, bool) {
+	sink := db.AuditSink{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&sink); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return sink, false
+	}
+	sink.Name = strings.TrimSpace(sink.Name)
+	if previous != nil && (sink.Config.Secret == "" || sink.Config.Secret == "********") {
+		sink.Config.Secret = previous.Config.Secret
+	}
+	for name, value := range sink.Config.Headers {
+		if previous != nil && value == "********" {
+			sink.Config.Headers[name] = previous.Config.Headers[name]
+		}
+	}
+	if errs := validateAuditSink(sink); len(errs) > 0 {
+		writeValidationError(w, "INVALID_AUDIT_SINK", "Audit sink is invalid", errs...)
+		return sink, false
+	}
+	return sink, true
+}
+
+// afterAuditSinkChange applies a sink change to the audit logger.
+func (fm *FlagManager) afterAuditSinkChange(r *http.Request) {
+	if err := fm.reloadAuditSinks(r.Context()); err != nil {
+		slog.WarnContext(r.Context(), "Failed to reload audit sinks", "error", err)
+	}
+}
+
+func (fm *FlagManager) createAuditSinkHandler(w http.ResponseWriter, r *http.Request) {
+	sink, ok := decodeAuditSink(w, r, nil)
+	if !ok {
+		return
+	}
+
+	created, err := fm.createAuditSink(r.Context(), sink)
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+	fm.afterAuditSinkChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "audit_sink.created", "audit_sink", created.ID, created.Name, "",
+		map[string]interface{}{"after": maskAuditSink(*created)}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fm.auditSinkResponse(*created))
+}
+
+func (fm *FlagManager) updateAuditSinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	before, err := fm.getAuditSink(r.Context(), id)
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+	sink, ok := decodeAuditSink(w, r, before)
+	if !ok {
+		return
+	}
+	updated, err := fm.updateAuditSink(r.Context(), id, sink)
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+	fm.afterAuditSinkChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "audit_sink.updated", "audit_sink", updated.ID, updated.Name, "",
+		map[string]interface{}{"before": maskAuditSink(*before), "after": maskAuditSink(*updated)}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fm.auditSinkResponse(*updated))
+}
+
+func (fm *FlagManager) deleteAuditSinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	existing, err := fm.getAuditSink(r.Context(), id)
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+	if err := fm.deleteAuditSink(r.Context(), id); err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+	fm.afterAuditSinkChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "audit_sink.deleted", "audit_sink", id, existing.Name, "",
+		map[string]interface{}{"before": maskAuditSink(*existing)}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testAuditSinkHandler sends a test event to a sink once, without retries.
+func (fm *FlagManager) testAuditSinkHandler(w http.ResponseWriter, r *http.Request) {
+	sink, err := fm.getAuditSink(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+
+	actor := GetActor(r)
+	event := db.AuditEvent{
+		ID:           uuid.New().String(),
+		Timestamp:    time.Now().UTC(),
+		ActorID:      actor.ID,
+		ActorEmail:   actor.Email,
+		ActorName:    actor.Name,
+		ActorType:    actor.Type,
+		Action:       "audit_sink.test",
+		ResourceType: "audit_sink",
+		ResourceID:   sink.ID,
+		ResourceName: sink.Name,
+		RequestID:    requestIDFrom(r.Context()),
+	}
+	resp := map[string]interface{}{"success": true}
+	if err := newAuditSender(*sink)(r.Context(), event); err != nil {
+		resp = map[string]interface{}{"success": false, "error": err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AuditDeadLettersResponse lists the undelivered events of a sink.
+type AuditDeadLettersResponse struct {
+	DeadLetters []AuditDeadLetter `json:"deadLetters"`
+	Total       int               `json:"total"`
+}
+
+func (fm *FlagManager) listAuditDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	sink, err := fm.getAuditSink(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+
+	letters := fm.audit.sinks.deadLetters(sink.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditDeadLettersResponse{DeadLetters: letters, Total: len(letters)})
+}
+
+// retryAuditDeadLettersHandler queues the undelivered events of a sink for
+// delivery again.
+func (fm *FlagManager) retryAuditDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	sink, err := fm.getAuditSink(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+
+	n := fm.audit.sinks.retryDeadLetters(sink.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"requeued": n})
+}
+
+func (fm *FlagManager) clearAuditDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	sink, err := fm.getAuditSink(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeAuditSinkError(w, err)
+		return
+	}
+
+	fm.audit.sinks.clearDeadLetters(sink.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestAuditSinks(t *testing.T) {
+	previousDelay := auditSinkRetryDelay
+	auditSinkRetryDelay = time.Millisecond
+	defer func() { auditSinkRetryDelay = previousDelay }()
+
+	type received struct {
+		path, signature string
+		body            []byte
+	}
+	var failing atomic.Bool
+	requests := make(chan received, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{path: r.URL.Path, signature: r.Header.Get("X-Goff-Signature"), body: body}
+	}))
+	defer server.Close()
+
+	syslog, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for syslog: %v", err)
+	}
+	defer syslog.Close()
+
+	// next returns the first request for path carrying action, keeping the
+	// others for later calls
+	var backlog []received
+	next := func(t *testing.T, path, action string) received {
+		t.Helper()
+		matches := func(req received) bool {
+			return req.path == path && bytes.Contains(req.body, []byte(`"action":"`+action+`"`))
+		}
+		if i := slices.IndexFunc(backlog, matches); i >= 0 {
+			req := backlog[i]
+			backlog = slices.Delete(backlog, i, i+1)
+			return req
+		}
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case req := <-requests:
+				if matches(req) {
+					return req
+				}
+				backlog = append(backlog, req)
+			case <-timeout:
+				t.Fatalf("Timed out waiting for %s on %s", action, path)
+			}
+		}
+	}
+
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			defer fm.audit.sinks.configure(nil)
+
+			doRequest(t, router, "POST", "/api/audit/sinks", `{"name":"bad","kind":"ftp"}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/audit/sinks", `{"name":"bad","kind":"webhook","config":{"url":"ftp://example.com"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/audit/sinks", `{"name":"bad","kind":"kafka","config":{"url":"http://proxy"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/audit/sinks", `{"name":"bad","kind":"syslog","config":{"address":"nohost"}}`, http.StatusBadRequest, nil)
+
+			var webhook, kafka, syslogSink AuditSinkResponse
+			doRequest(t, router, "POST", "/api/audit/sinks", `{"name":"siem","kind":"webhook","config":{"url":"`+server.URL+`/hook","secret":"s3cret","headers":{"Authorization":"Bearer t0ken"}}}`, http.StatusCreated, &webhook)
+			doRequest(t, router, "POST", "/api/audit/sinks", `{"name":"siem","kind":"webhook","config":{"url":"`+server.URL+`/hook"}}`, http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/audit/sinks", `{"name":"kafka","kind":"kafka","config":{"url":"`+server.URL+`/","topic":"audit"}}`, http.StatusCreated, &kafka)
+			doRequest(t, router, "POST", "/api/audit/sinks", `{"name":"syslog","kind":"syslog","config":{"address":"`+syslog.LocalAddr().String()+`"}}`, http.StatusCreated, &syslogSink)
+			if !webhook.Enabled || webhook.Config.Secret != "********" || webhook.Config.Headers["Authorization"] != "********" {
+				t.Errorf("Expected an enabled sink with a masked secret and headers, got %+v", webhook.AuditSink)
+			}
+
+			doRequest(t, router, "POST", "/api/projects/web/flags/"+mode, `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+			req := next(t, "/hook", "flag.created")
+			if req.signature != "sha256="+signProjectWebhookPayload("s3cret", req.body) {
+				t.Errorf("Expected the event to be signed, got %q", req.signature)
+			}
+			var event db.AuditEvent
+			json.Unmarshal(req.body, &event)
+			if event.ID == "" || event.ResourceName != mode || event.Project != "web" {
+				t.Errorf("Expected the flag.created event, got %+v", event)
+			}
+
+			req = next(t, "/topics/audit", "flag.created")
+			var records struct {
+				Records []struct {
+					Key   string        `json:"key"`
+					Value db.AuditEvent `json:"value"`
+				} `json:"records"`
+			}
+			json.Unmarshal(req.body, &records)
+			if len(records.Records) != 1 || records.Records[0].Value.ID != event.ID || records.Records[0].Key != "flag:"+event.ResourceID {
+				t.Errorf("Expected the same event as a Kafka record, got %s", req.body)
+			}
+
+			buf := make([]byte, 64*1024)
+			syslog.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for {
+				n, _, err := syslog.ReadFrom(buf)
+				if err != nil {
+					t.Fatalf("No syslog message received: %v", err)
+				}
+				if msg := string(buf[:n]); strings.Contains(msg, " flag.created ") {
+					if !strings.HasPrefix(msg, "<134>1 ") || !strings.Contains(msg, event.ID) {
+						t.Errorf("Expected an RFC 5424 message for the event, got %q", msg)
+					}
+					break
+				}
+			}
+
+			// Keeping a masked secret or header keeps its value
+			doRequest(t, router, "PUT", "/api/audit/sinks/"+webhook.ID, `{"name":"siem","kind":"webhook","enabled":true,"config":{"url":"`+server.URL+`/hook","secret":"********","headers":{"Authorization":"********"}}}`, http.StatusOK, nil)
+			if sink, err := fm.getAuditSink(context.Background(), webhook.ID); err != nil || sink.Config.Secret != "s3cret" || sink.Config.Headers["Authorization"] != "Bearer t0ken" {
+				t.Errorf("Expected the sink to keep its secret and header, got %+v (%v)", sink, err)
+			}
+			doRequest(t, router, "DELETE", "/api/audit/sinks/"+kafka.ID, "", http.StatusNoContent, nil)
+			doRequest(t, router, "PUT", "/api/audit/sinks/"+syslogSink.ID, `{"name":"syslog","kind":"syslog","enabled":false,"config":{"address":"`+syslog.LocalAddr().String()+`"}}`, http.StatusOK, nil)
+
+			t.Run("dead letters", func(t *testing.T) {
+				failing.Store(true)
+				doRequest(t, router, "PUT", "/api/projects/web/flags/"+mode, `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusOK, nil)
+
+				var letters AuditDeadLettersResponse
+				for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+					doRequest(t, router, "GET", "/api/audit/sinks/"+webhook.ID+"/dead-letters", "", http.StatusOK, &letters)
+					if slices.ContainsFunc(letters.DeadLetters, func(l AuditDeadLetter) bool { return l.Event.Action == "flag.updated" }) {
+						break
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("Expected the undelivered event in the dead letters, got %+v", letters)
+					}
+				}
+				for _, l := range letters.DeadLetters {
+					if l.Attempts != auditSinkMaxAttempts || l.Error == "" {
+						t.Errorf("Expected a dead letter after %d attempts, got %+v", auditSinkMaxAttempts, l)
+					}
+				}
+				var sink AuditSinkResponse
+				doRequest(t, router, "GET", "/api/audit/sinks/"+webhook.ID, "", http.StatusOK, &sink)
+				if sink.Status.DeadLetters != letters.Total || sink.Status.LastError == "" {
+					t.Errorf("Expected the failure in the sink status, got %+v", sink.Status)
+				}
+
+				failing.Store(false)
+				var retried map[string]int
+				doRequest(t, router, "POST", "/api/audit/sinks/"+webhook.ID+"/dead-letters/retry", "", http.StatusOK, &retried)
+				if retried["requeued"] != letters.Total {
+					t.Errorf("Expected %d requeued events, got %v", letters.Total, retried)
+				}
+				req := next(t, "/hook", "flag.updated")
+				if req.signature != "sha256="+signProjectWebhookPayload("s3cret", req.body) {
+					t.Errorf("Expected the kept secret to sign the event, got %q", req.signature)
+				}
+			})
+
+			var result map[string]interface{}
+			doRequest(t, router, "POST", "/api/audit/sinks/"+webhook.ID+"/test", "", http.StatusOK, &result)
+			if result["success"] != true {
+				t.Errorf("Expected the test event to be delivered, got %v", result)
+			}
+			next(t, "/hook", "audit_sink.test")
+
+			var list AuditSinksResponse
+			doRequest(t, router, "GET", "/api/audit/sinks", "", http.StatusOK, &list)
+			if list.Total != 2 || list.Sinks[0].Name != "siem" || list.Sinks[1].Enabled {
+				t.Errorf("Expected the webhook and the disabled syslog sink, got %+v", list.Sinks)
+			}
+			doRequest(t, router, "GET", "/api/audit/sinks/"+kafka.ID, "", http.StatusNotFound, nil)
+		})
+	}
+}
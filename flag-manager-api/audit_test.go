@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestFileAuditLog(t *testing.T) {
+	fm, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	doRequest(t, router, "POST", "/api/projects/web", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/beta", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/flags/beta", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}},"changeNote":"launch"}`, http.StatusOK, nil)
+
+	var audit db.PaginatedResult[db.AuditEvent]
+	doRequest(t, router, "GET", "/api/audit", "", http.StatusOK, &audit)
+	if audit.Total != 3 || len(audit.Data) != 3 {
+		t.Fatalf("Expected 3 audit events, got %+v", audit)
+	}
+	if audit.Data[0].Action != "flag.updated" || audit.Data[0].ID == "" || audit.Data[0].Timestamp.IsZero() {
+		t.Errorf("Expected the newest event first with an ID and timestamp, got %+v", audit.Data[0])
+	}
+	if !strings.Contains(string(audit.Data[0].Metadata), "launch") {
+		t.Errorf("Expected the change note in the event metadata, got %s", audit.Data[0].Metadata)
+	}
+
+	doRequest(t, router, "GET", "/api/audit?action=flag.created", "", http.StatusOK, &audit)
+	if audit.Total != 1 || audit.Data[0].ResourceName != "beta" {
+		t.Errorf("Expected the flag.created event, got %+v", audit)
+	}
+	doRequest(t, router, "GET", "/api/audit?sort=action&order=asc&pageSize=1&page=2", "", http.StatusOK, &audit)
+	if audit.Total != 3 || audit.TotalPages != 3 || len(audit.Data) != 1 || audit.Data[0].Action != "flag.updated" {
+		t.Errorf("Expected the second event by action, got %+v", audit)
+	}
+
+	var history struct {
+		Data  []db.AuditEvent `json:"data"`
+		Total int             `json:"total"`
+	}
+	doRequest(t, router, "GET", "/api/projects/web/flags/beta/audit", "", http.StatusOK, &history)
+	if history.Total != 2 {
+		t.Errorf("Expected 2 events for web/beta, got %+v", history)
+	}
+
+	csv := doRequest(t, router, "GET", "/api/audit/export", "", http.StatusOK, nil).Body.String()
+	if lines := strings.Split(strings.TrimSpace(csv), "\n"); len(lines) != 4 || !strings.Contains(csv, "project.created") {
+		t.Errorf("Expected a header and 3 events in the export, got %q", csv)
+	}
+
+	// With a tiny size limit every event rotates the log; only 2 files are kept
+	logStore := NewAuditLogStore(t.TempDir(), 1, 2)
+	for _, action := range []string{"a", "b", "c", "d"} {
+		if err := logStore.Append(db.AuditEvent{Action: action, ResourceType: "flag"}); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	rotated, err := logStore.List(db.AuditFilterParams{PaginationParams: db.DefaultPagination()})
+	if err != nil || rotated.Total != 2 || rotated.Data[0].Action != "d" || rotated.Data[1].Action != "c" {
+		t.Errorf("Expected the 2 newest events to survive rotation, got %+v, %v", rotated, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "audit.jsonl")); err != nil {
+		t.Errorf("Expected audit.jsonl in the flags directory: %v", err)
+	}
+}
+
+func TestServiceAccountKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	fm := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	fm.audit = NewAuditLogger(store, fm.changes)
+	handler := fm.AuthMiddleware(setupTestRouter(fm))
+
+	withKey := func(key, method, path, body string, status int, v interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != status {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, status, rr.Code, rr.Body.String())
+		}
+		if v != nil {
+			json.Unmarshal(rr.Body.Bytes(), v)
+		}
+	}
+	flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+
+	var roles RolesResponse
+	withKey("", "GET", "/api/roles", "", http.StatusOK, &roles)
+	roleIDs := make(map[string]string)
+	for _, role := range roles.Roles {
+		roleIDs[role.Name] = role.ID
+	}
+	var mobile FlagSet
+	withKey("", "POST", "/api/flagsets", `{"name":"mobile"}`, http.StatusCreated, &mobile)
+	withKey("", "POST", "/api/projects/shop/flags/checkout", flag, http.StatusCreated, nil)
+	withKey("", "POST", "/api/projects/blog/flags/comments", flag, http.StatusCreated, nil)
+
+	create := func(body string) CreateAPIKeyResponse {
+		t.Helper()
+		var created CreateAPIKeyResponse
+		withKey("", "POST", "/api/api-keys", body, http.StatusCreated, &created)
+		if created.Key == "" || created.APIKey == nil {
+			t.Fatalf("Expected a new key, got %+v", created)
+		}
+		return created
+	}
+	admin := create(`{"name":"deploy","permissions":["admin"]}`)
+	writer := create(`{"name":"sync","permissions":["write"]}`)
+	basic := create(`{"name":"status"}`)
+	editor := create(`{"name":"shop-ci","roleId":"` + roleIDs["editor"] + `","projects":["shop"],"flagSets":["` + mobile.ID + `"]}`)
+	reader := create(`{"name":"dashboards","readOnly":true,"expiresIn":"30d"}`)
+	if !reflect.DeepEqual(editor.APIKey.Projects, []string{"shop"}) || editor.APIKey.RoleID != roleIDs["editor"] {
+		t.Errorf("Expected the key's role and projects to be stored, got %+v", editor.APIKey)
+	}
+	if !reader.APIKey.ReadOnly || reader.APIKey.ExpiresAt == nil {
+		t.Errorf("Expected a read-only key with an expiry, got %+v", reader.APIKey)
+	}
+
+	withKey("", "POST", "/api/api-keys", `{"name":"bad","roleId":"missing"}`, http.StatusBadRequest, nil)
+	withKey("", "POST", "/api/api-keys", `{"name":"bad","flagSets":["missing"]}`, http.StatusBadRequest, nil)
+	withKey("", "POST", "/api/api-keys", `{"name":"bad","expiresAt":"2001-01-01T00:00:00Z"}`, http.StatusBadRequest, nil)
+	withKey("", "POST", "/api/api-keys", `{"name":"bad","permissions":["owner"]}`, http.StatusBadRequest, nil)
+	withKey("", "POST", "/api/api-keys", `{"name":"bad","permissions":["admin"],"roleId":"`+roleIDs["editor"]+`"}`, http.StatusBadRequest, nil)
+
+	fm.authEnabled = true
+	defer func() { fm.authEnabled = false }()
+
+	t.Run("permissions", func(t *testing.T) {
+		withKey(admin.Key, "PUT", "/api/projects/blog/flags/comments", `{"config":`+flag+`}`, http.StatusOK, nil)
+		withKey(admin.Key, "GET", "/api/api-keys", "", http.StatusOK, nil)
+		withKey(writer.Key, "PUT", "/api/projects/blog/flags/comments", `{"config":`+flag+`}`, http.StatusOK, nil)
+		withKey(writer.Key, "POST", "/api/api-keys", `{"name":"escalate","permissions":["admin"]}`, http.StatusForbidden, nil)
+		withKey(basic.Key, "GET", "/api/projects/blog/flags", "", http.StatusOK, nil)
+		withKey(basic.Key, "PUT", "/api/projects/blog/flags/comments", `{"config":`+flag+`}`, http.StatusForbidden, nil)
+		withKey("goff_wrong", "GET", "/api/projects", "", http.StatusUnauthorized, nil)
+	})
+
+	t.Run("role and scope", func(t *testing.T) {
+		withKey(editor.Key, "PUT", "/api/projects/shop/flags/checkout", `{"config":`+flag+`}`, http.StatusOK, nil)
+		withKey(editor.Key, "POST", "/api/flagsets/"+mobile.ID+"/flags/banner", flag, http.StatusCreated, nil)
+		withKey(editor.Key, "GET", "/api/projects/blog/flags", "", http.StatusForbidden, nil)
+		withKey(editor.Key, "GET", "/api/api-keys", "", http.StatusForbidden, nil)
+
+		var projects ProjectsResponse
+		withKey(editor.Key, "GET", "/api/projects", "", http.StatusOK, &projects)
+		if !reflect.DeepEqual(projects.Projects, []string{"shop"}) {
+			t.Errorf("Expected only the key's project, got %v", projects.Projects)
+		}
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		withKey(reader.Key, "GET", "/api/projects/blog/flags", "", http.StatusOK, nil)
+		withKey(reader.Key, "PUT", "/api/projects/blog/flags/comments", `{"config":`+flag+`}`, http.StatusForbidden, nil)
+		withKey(reader.Key, "DELETE", "/api/projects/blog/flags/comments", "", http.StatusForbidden, nil)
+	})
+
+	t.Run("last use and rotation", func(t *testing.T) {
+		var keys APIKeysResponse
+		withKey(admin.Key, "GET", "/api/api-keys", "", http.StatusOK, &keys)
+		for _, k := range keys.APIKeys {
+			if k.ID == reader.APIKey.ID && k.LastUsedAt == nil {
+				t.Errorf("Expected the last use of %s to be recorded", k.Name)
+			}
+		}
+
+		var rotated CreateAPIKeyResponse
+		withKey(admin.Key, "POST", "/api/api-keys/"+editor.APIKey.ID+"/rotate", "", http.StatusOK, &rotated)
+		if rotated.Key == "" || rotated.Key == editor.Key || rotated.APIKey.RotatedAt == nil {
+			t.Fatalf("Expected a new secret, got %+v", rotated)
+		}
+		if rotated.APIKey.RoleID != roleIDs["editor"] || !reflect.DeepEqual(rotated.APIKey.Projects, []string{"shop"}) {
+			t.Errorf("Expected rotation to keep the key's scope, got %+v", rotated.APIKey)
+		}
+		withKey(editor.Key, "GET", "/api/projects/shop/flags", "", http.StatusUnauthorized, nil)
+		withKey(rotated.Key, "GET", "/api/projects/shop/flags", "", http.StatusOK, nil)
+		withKey(admin.Key, "POST", "/api/api-keys/00000000-0000-0000-0000-000000000000/rotate", "", http.StatusNotFound, nil)
+	})
+}
@@ -4,12 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
+	"log/slog"
 	"strings"
 	"sync"
 	"time"
 
+	"flag-manager-api/httpclient"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -91,6 +92,14 @@ func (fm *FlagManager) validateJWT(tokenString string) (Actor, error) {
 	if preferredUsername, ok := claims["preferred_username"].(string); ok && actor.Name == "" {
 		actor.Name = preferredUsername
 	}
+	if groups, ok := claims["groups"].([]interface{}); ok {
+		for _, g := range groups {
+			if group, ok := g.(string); ok {
+				actor.Groups = append(actor.Groups, group)
+			}
+		}
+	}
+	actor.RoleClaims = claimValues(claims, fm.rolesClaim())
 
 	return actor, nil
 }
@@ -113,7 +122,7 @@ func fetchOIDCConfig(issuerURL string) (*oidcConfig, error) {
 	}
 
 	wellKnownURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
-	resp, err := http.Get(wellKnownURL)
+	resp, err := httpclient.Default().Get(wellKnownURL)
 	if err != nil {
 		return nil, fmt.Errorf("fetch OIDC config: %w", err)
 	}
@@ -130,6 +139,6 @@ func fetchOIDCConfig(issuerURL string) (*oidcConfig, error) {
 	}
 
 	oidcCache = &config
-	log.Printf("OIDC config loaded from %s", wellKnownURL)
+	slog.Info("OIDC config loaded", "url", wellKnownURL)
 	return &config, nil
 }
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+// backupVersion is the version of the backup document. Restores reject
+// documents of other versions.
+const backupVersion = 1
+
+// Backup is a snapshot of an instance: project flags, flag sets with their
+// flags, segments and the integration, notifier, exporter and retriever
+// configs, secrets included. API keys are listed without their hashes, so
+// they cannot be restored and must be issued again.
+type Backup struct {
+	Version      int                     `json:"version"`
+	CreatedAt    time.Time               `json:"createdAt"`
+	Storage      string                  `json:"storage"` // file, postgres or sqlite
+	Projects     map[string]ProjectFlags `json:"projects"`
+	FlagSets     []BackupFlagSet         `json:"flagSets"`
+	Segments     []db.Segment            `json:"segments"`
+	Templates    []db.FlagTemplate       `json:"templates"`
+	Integrations []GitIntegration        `json:"integrations"`
+	Notifiers    []Notifier              `json:"notifiers"`
+	Exporters    []Exporter              `json:"exporters"`
+	Retrievers   []Retriever             `json:"retrievers"`
+	APIKeys      []db.APIKey             `json:"apiKeys"`
+}
+
+// BackupFlagSet is a flag set with its flags.
+type BackupFlagSet struct {
+	FlagSet
+	Flags map[string]json.RawMessage `json:"flags"`
+}
+
+// RestoreCount counts the resources of one kind a restore created or updated.
+type RestoreCount struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+// RestoreResult is the outcome of restoring a backup.
+type RestoreResult struct {
+	Summary map[string]*RestoreCount `json:"summary"`
+	Skipped []string                 `json:"skipped"`
+	Errors  []string                 `json:"errors"`
+}
+
+// record counts a restored resource, or its error.
+func (res *RestoreResult) record(kind, name string, created bool, err error) {
+	if err != nil {
+		res.Errors = append(res.Errors, fmt.Sprintf("%s %s: %v", kind, name, err))
+		return
+	}
+	count, ok := res.Summary[kind]
+	if !ok {
+		count = &RestoreCount{}
+		res.Summary[kind] = count
+	}
+	if created {
+		count.Created++
+	} else {
+		count.Updated++
+	}
+}
+
+// storageName names the active storage backend.
+func (fm *FlagManager) storageName() string {
+	switch {
+	case fm.store == nil:
+		return "file"
+	case fm.store.SQLite():
+		return "sqlite"
+	default:
+		return "postgres"
+	}
+}
+
+// createBackup snapshots the instance.
+func (fm *FlagManager) createBackup(ctx context.Context) (*Backup, error) {
+	b := &Backup{
+		Version:      backupVersion,
+		CreatedAt:    time.Now().UTC(),
+		Storage:      fm.storageName(),
+		Projects:     map[string]ProjectFlags{},
+		FlagSets:     []BackupFlagSet{},
+		Segments:     []db.Segment{},
+		Templates:    []db.FlagTemplate{},
+		Integrations: []GitIntegration{},
+		Notifiers:    []Notifier{},
+		Exporters:    []Exporter{},
+		Retrievers:   []Retriever{},
+		APIKeys:      []db.APIKey{},
+	}
+
+	projects, err := fm.storage.ListProjects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list projects: %w", err)
+	}
+	for _, project := range projects {
+		flags, err := fm.storage.ListFlags(ctx, project)
+		if err != nil {
+			return nil, fmt.Errorf("project %s: %w", project, err)
+		}
+		b.Projects[project] = flags
+	}
+
+	if fm.store != nil {
+		if err := fm.backupDB(ctx, b); err != nil {
+			return nil, err
+		}
+	} else if err := fm.backupFiles(b); err != nil {
+		return nil, err
+	}
+
+	for page := 1; ; page++ {
+		segments, err := fm.storage.ListSegments(ctx, db.PaginationParams{Page: page, PageSize: 200, Order: "asc"})
+		if errors.Is(err, errDatabaseRequired) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list segments: %w", err)
+		}
+		b.Segments = append(b.Segments, segments.Data...)
+		if page >= segments.TotalPages {
+			break
+		}
+	}
+
+	if b.Templates, err = fm.storage.ListFlagTemplates(ctx); err != nil {
+		return nil, fmt.Errorf("list templates: %w", err)
+	}
+
+	sort.Slice(b.FlagSets, func(i, j int) bool { return b.FlagSets[i].Name < b.FlagSets[j].Name })
+	sort.Slice(b.Integrations, func(i, j int) bool { return b.Integrations[i].ID < b.Integrations[j].ID })
+	sort.Slice(b.Notifiers, func(i, j int) bool { return b.Notifiers[i].ID < b.Notifiers[j].ID })
+	sort.Slice(b.Exporters, func(i, j int) bool { return b.Exporters[i].ID < b.Exporters[j].ID })
+	sort.Slice(b.Retrievers, func(i, j int) bool { return b.Retrievers[i].ID < b.Retrievers[j].ID })
+	return b, nil
+}
+
+func (fm *FlagManager) backupDB(ctx context.Context, b *Backup) error {
+	flagSets, err := fm.store.ListFlagSets(ctx)
+	if err != nil {
+		return fmt.Errorf("list flag sets: %w", err)
+	}
+	for _, dbfs := range flagSets {
+		flags, err := fm.store.ListFlagSetFlags(ctx, dbfs.ID)
+		if err != nil {
+			return fmt.Errorf("flag set %s: %w", dbfs.Name, err)
+		}
+		b.FlagSets = append(b.FlagSets, BackupFlagSet{FlagSet: dbFlagSetToFlagSet(dbfs), Flags: flags})
+	}
+
+	integrations, err := fm.store.ListIntegrations(ctx)
+	if err != nil {
+		return fmt.Errorf("list integrations: %w", err)
+	}
+	for _, dbi := range integrations {
+		b.Integrations = append(b.Integrations, dbIntegrationToGitIntegration(dbi))
+	}
+	notifiers, err := fm.store.ListNotifiers(ctx)
+	if err != nil {
+		return fmt.Errorf("list notifiers: %w", err)
+	}
+	for _, dbn := range notifiers {
+		b.Notifiers = append(b.Notifiers, dbNotifierToNotifier(dbn))
+	}
+	exporters, err := fm.store.ListExporters(ctx)
+	if err != nil {
+		return fmt.Errorf("list exporters: %w", err)
+	}
+	for _, dbe := range exporters {
+		b.Exporters = append(b.Exporters, dbExporterToExporter(dbe))
+	}
+	retrievers, err := fm.store.ListRetrievers(ctx)
+	if err != nil {
+		return fmt.Errorf("list retrievers: %w", err)
+	}
+	for _, dbr := range retrievers {
+		b.Retrievers = append(b.Retrievers, dbRetrieverToRetriever(dbr))
+	}
+
+	keys, err := fm.store.ListAPIKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("list API keys: %w", err)
+	}
+	b.APIKeys = append(b.APIKeys, keys...)
+	return nil
+}
+
+func (fm *FlagManager) backupFiles(b *Backup) error {
+	for _, fs := range fm.flagSets.List() {
+		flags, err := fm.readFlagSetFlags(fs.ID)
+		if err != nil {
+			return fmt.Errorf("flag set %s: %w", fs.Name, err)
+		}
+		raw := make(map[string]json.RawMessage, len(flags))
+		for key, config := range flags {
+			data, err := json.Marshal(config)
+			if err != nil {
+				return fmt.Errorf("flag set %s: flag %s: %w", fs.Name, key, err)
+			}
+			raw[key] = data
+		}
+		b.FlagSets = append(b.FlagSets, BackupFlagSet{FlagSet: fs, Flags: raw})
+		// Flag set files sit next to project files and are listed as projects
+		delete(b.Projects, strings.TrimSuffix(filepath.Base(fm.getFlagSetFilePath(fs.ID)), ".yaml"))
+	}
+
+	for _, gi := range fm.integrations.List() {
+		b.Integrations = append(b.Integrations, *fm.integrations.GetRaw(gi.ID))
+	}
+	for _, n := range fm.notifiers.List() {
+		b.Notifiers = append(b.Notifiers, *fm.notifiers.GetRaw(n.ID))
+	}
+	for _, e := range fm.exporters.List() {
+		b.Exporters = append(b.Exporters, *fm.exporters.GetRaw(e.ID))
+	}
+	for _, r := range fm.retrievers.List() {
+		b.Retrievers = append(b.Retrievers, *fm.retrievers.GetRaw(r.ID))
+	}
+	return nil
+}
+
+// backupHandler downloads a backup of the whole instance as a JSON document.
+// It contains secrets and should be stored accordingly.
+func (fm *FlagManager) backupHandler(w http.ResponseWriter, r *http.Request) {
+	b, err := fm.createBackup(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create backup: "+err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "instance.backed_up", "instance", "", "", "", nil,
+		map[string]interface{}{"projects": len(b.Projects), "flagSets": len(b.FlagSets)})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=goff-backup-%s.json", b.CreatedAt.Format("20060102-150405")))
+	json.NewEncoder(w).Encode(b)
+}
+
+// restoreHandler loads a backup made by backupHandler, possibly on an
+// instance with another storage backend. Resources in the backup are created
+// or overwritten, matched by ID (by name for flag sets, segments and
+// templates); the
+// flags of restored projects and flag sets are replaced. Resources missing
+// from the backup are left untouched. A failing resource does not stop the
+// others and is reported in errors.
+func (fm *FlagManager) restoreHandler(w http.ResponseWriter, r *http.Request) {
+	var b Backup
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		writeValidationError(w, "INVALID_BACKUP", "Invalid backup: "+err.Error())
+		return
+	}
+	if b.Version != backupVersion {
+		writeValidationError(w, "INVALID_BACKUP", fmt.Sprintf("Unsupported backup version %d, expected %d", b.Version, backupVersion))
+		return
+	}
+	var invalid []string
+	for project, flags := range b.Projects {
+		if err := ValidateProjectName(project); err != nil {
+			invalid = append(invalid, project+": "+err.Error())
+			continue
+		}
+		for key, config := range flags {
+			if err := ValidateFlagKey(key); err != nil {
+				invalid = append(invalid, project+"/"+key+": "+err.Error())
+				continue
+			}
+			for _, e := range ValidateFlagConfig(config) {
+				invalid = append(invalid, project+"/"+key+": "+e)
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		writeValidationError(w, "INVALID_BACKUP", "The backup contains invalid flags", invalid...)
+		return
+	}
+
+	ctx := r.Context()
+	res := &RestoreResult{Summary: map[string]*RestoreCount{}, Skipped: []string{}, Errors: []string{}}
+
+	for i := range b.Integrations {
+		gi := b.Integrations[i]
+		created, err := fm.restoreIntegration(ctx, &gi)
+		res.record("integration", gi.ID, created, err)
+	}
+	for i := range b.Retrievers {
+		ret := b.Retrievers[i]
+		created, err := fm.restoreRetriever(ctx, &ret)
+		res.record("retriever", ret.ID, created, err)
+	}
+	for i := range b.Exporters {
+		e := b.Exporters[i]
+		created, err := fm.restoreExporter(ctx, &e)
+		res.record("exporter", e.ID, created, err)
+	}
+	for i := range b.Notifiers {
+		n := b.Notifiers[i]
+		created, err := fm.restoreNotifier(ctx, &n)
+		res.record("notifier", n.ID, created, err)
+	}
+	if len(b.Notifiers) > 0 {
+		fm.afterNotifierChange(r)
+	}
+
+	for _, seg := range b.Segments {
+		created, err := fm.restoreSegment(ctx, seg, actorLabel(GetActor(r)))
+		if errors.Is(err, errDatabaseRequired) {
+			res.Skipped = append(res.Skipped, fmt.Sprintf("%d segments: segments require a database", len(b.Segments)))
+			break
+		}
+		res.record("segment", seg.Name, created, err)
+	}
+
+	for _, t := range b.Templates {
+		created, err := fm.restoreFlagTemplate(ctx, t)
+		res.record("template", t.Name, created, err)
+	}
+
+	projects := make([]string, 0, len(b.Projects))
+	for project := range b.Projects {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	for _, project := range projects {
+		created, err := fm.restoreProject(ctx, project, b.Projects[project])
+		res.record("project", project, created, err)
+	}
+
+	for _, fs := range b.FlagSets {
+		created, err := fm.restoreFlagSet(ctx, fs)
+		res.record("flagSet", fs.Name, created, err)
+	}
+
+	if len(b.APIKeys) > 0 {
+		res.Skipped = append(res.Skipped, fmt.Sprintf("%d API keys: keys are not included in backups and must be issued again", len(b.APIKeys)))
+	}
+
+	fm.audit.Log(ctx, GetActor(r), "instance.restored", "instance", "", "", "", nil,
+		map[string]interface{}{"backupCreatedAt": b.CreatedAt, "backupStorage": b.Storage, "errors": len(res.Errors)})
+	fm.scheduleRelayRefresh(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (fm *FlagManager) restoreIntegration(ctx context.Context, gi *GitIntegration) (bool, error) {
+	if fm.store != nil {
+		dbi := gitIntegrationToDBIntegration(*gi)
+		if _, err := fm.store.GetIntegration(ctx, gi.ID); err == nil {
+			_, err = fm.store.UpdateIntegration(ctx, gi.ID, dbi)
+			return false, err
+		}
+		_, err := fm.store.CreateIntegration(ctx, dbi)
+		return true, err
+	}
+	if fm.integrations.GetRaw(gi.ID) != nil {
+		return false, fm.integrations.Update(gi.ID, gi)
+	}
+	return true, fm.integrations.Create(gi)
+}
+
+func (fm *FlagManager) restoreRetriever(ctx context.Context, ret *Retriever) (bool, error) {
+	if fm.store != nil {
+		dbr := retrieverToDBRetriever(*ret)
+		if _, err := fm.store.GetRetriever(ctx, ret.ID); err == nil {
+			_, err = fm.store.UpdateRetriever(ctx, ret.ID, dbr)
+			return false, err
+		}
+		_, err := fm.store.CreateRetriever(ctx, dbr)
+		return true, err
+	}
+	if fm.retrievers.GetRaw(ret.ID) != nil {
+		return false, fm.retrievers.Update(ret.ID, ret)
+	}
+	return true, fm.retrievers.Create(ret)
+}
+
+func (fm *FlagManager) restoreExporter(ctx context.Context, e *Exporter) (bool, error) {
+	if fm.store != nil {
+		dbe := exporterToDBExporter(*e)
+		if _, err := fm.store.GetExporter(ctx, e.ID); err == nil {
+			_, err = fm.store.UpdateExporter(ctx, e.ID, dbe)
+			return false, err
+		}
+		_, err := fm.store.CreateExporter(ctx, dbe)
+		return true, err
+	}
+	if fm.exporters.GetRaw(e.ID) != nil {
+		return false, fm.exporters.Update(e.ID, e)
+	}
+	return true, fm.exporters.Create(e)
+}
+
+func (fm *FlagManager) restoreNotifier(ctx context.Context, n *Notifier) (bool, error) {
+	if fm.store != nil {
+		dbn := notifierToDBNotifier(*n)
+		if _, err := fm.store.GetNotifier(ctx, n.ID); err == nil {
+			_, err = fm.store.UpdateNotifier(ctx, n.ID, dbn)
+			return false, err
+		}
+		_, err := fm.store.CreateNotifier(ctx, dbn)
+		return true, err
+	}
+	if fm.notifiers.GetRaw(n.ID) != nil {
+		return false, fm.notifiers.Update(n.ID, n)
+	}
+	return true, fm.notifiers.Create(n)
+}
+
+func (fm *FlagManager) restoreSegment(ctx context.Context, seg db.Segment, author string) (bool, error) {
+	if existing, err := fm.storage.GetSegmentByName(ctx, seg.Name); err == nil {
+		_, err = fm.storage.UpdateSegment(ctx, existing.ID, seg, author)
+		return false, err
+	}
+	_, err := fm.storage.CreateSegment(ctx, seg, author)
+	return true, err
+}
+
+func (fm *FlagManager) restoreFlagTemplate(ctx context.Context, t db.FlagTemplate) (bool, error) {
+	templates, err := fm.storage.ListFlagTemplates(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, existing := range templates {
+		if existing.Name == t.Name {
+			_, err := fm.storage.UpdateFlagTemplate(ctx, existing.ID, t)
+			return false, err
+		}
+	}
+	_, err = fm.storage.CreateFlagTemplate(ctx, t)
+	return true, err
+}
+
+// restoreProject creates a project if needed and replaces its flags.
+func (fm *FlagManager) restoreProject(ctx context.Context, project string, flags ProjectFlags) (bool, error) {
+	err := fm.storage.CreateProject(ctx, project)
+	created := err == nil
+	if err != nil && !errors.Is(err, errProjectExists) {
+		return false, err
+	}
+
+	local, err := fm.loadStoredProjectFlags(ctx, project)
+	if err != nil {
+		return false, err
+	}
+	if flags == nil {
+		flags = make(ProjectFlags)
+	}
+	// Using the current flags as the sync base removes those missing from
+	// the backup.
+	plan, err := planGitSync(local, flags, local, syncStrategyRepo)
+	if err != nil {
+		return false, err
+	}
+	return created, fm.applyGitSync(ctx, project, flags, plan)
+}
+
+// restoreFlagSet creates or updates a flag set by name and replaces its flags.
+func (fm *FlagManager) restoreFlagSet(ctx context.Context, b BackupFlagSet) (bool, error) {
+	fs := b.FlagSet
+	backupID := fs.ID
+
+	if fm.store != nil {
+		existing, err := fm.store.ListFlagSets(ctx)
+		if err != nil {
+			return false, err
+		}
+		id := ""
+		for _, dbfs := range existing {
+			if dbfs.Name == fs.Name {
+				id = dbfs.ID
+			}
+		}
+		created := id == ""
+		if created {
+			dbfs, err := fm.store.CreateFlagSet(ctx, flagSetToDBFlagSet(fs))
+			if err != nil {
+				return false, err
+			}
+			id = dbfs.ID
+		} else if _, err := fm.store.UpdateFlagSet(ctx, id, flagSetToDBFlagSet(fs)); err != nil {
+			return false, err
+		}
+
+		current, err := fm.store.ListFlagSetFlags(ctx, id)
+		if err != nil {
+			return created, err
+		}
+		for key := range current {
+			if _, ok := b.Flags[key]; !ok {
+				if err := fm.store.DeleteFlagSetFlag(ctx, id, key); err != nil {
+					return created, err
+				}
+			}
+		}
+		for key, config := range b.Flags {
+			if _, ok := current[key]; ok {
+				err = fm.store.UpdateFlagSetFlag(ctx, id, key, config, "")
+			} else {
+				err = fm.store.CreateFlagSetFlag(ctx, id, key, config)
+			}
+			if err != nil {
+				return created, fmt.Errorf("flag %s: %w", key, err)
+			}
+		}
+		return created, nil
+	}
+
+	flags := make(map[string]interface{}, len(b.Flags))
+	for key, raw := range b.Flags {
+		var config interface{}
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return false, fmt.Errorf("flag %s: %w", key, err)
+		}
+		flags[key] = config
+	}
+
+	existing := fm.flagSets.GetByName(fs.Name)
+	created := existing == nil
+	var saved *FlagSet
+	var err error
+	if created {
+		saved, err = fm.flagSets.Create(fs)
+	} else {
+		saved, err = fm.flagSets.Update(existing.ID, fs)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Point file retrievers at the flags file of the flag set's new ID
+	if saved.Retriever.Kind == "file" && (saved.Retriever.Path == "" || filepath.Base(saved.Retriever.Path) == fmt.Sprintf("flagset-%s.yaml", backupID)) {
+		saved.Retriever.Path = fm.getFlagSetFilePath(saved.ID)
+		if _, err := fm.flagSets.Update(saved.ID, *saved); err != nil {
+			return created, err
+		}
+	}
+	return created, fm.writeFlagSetFlags(saved.ID, flags)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestBackupRestore(t *testing.T) {
+	source, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(source)
+
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}`, http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/empty", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/integrations", `{"id":"gh","name":"GitHub","provider":"github","githubOwner":"acme","githubRepo":"flags","githubToken":"ghp_secret"}`, http.StatusCreated, nil)
+	if err := source.notifiers.Create(&Notifier{ID: "hook", Name: "Hook", Kind: "webhook", EndpointURL: "https://example.com", Secret: "s3cret", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	var flagSet FlagSet
+	doRequest(t, router, "POST", "/api/flagsets", `{"name":"mobile"}`, http.StatusCreated, &flagSet)
+	if err := source.writeFlagSetFlags(flagSet.ID, map[string]interface{}{"dark-mode": map[string]interface{}{"variations": map[string]interface{}{"on": true}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	backup := doRequest(t, router, "GET", "/api/admin/backup", "", http.StatusOK, nil).Body.Bytes()
+	if !strings.Contains(string(backup), "ghp_secret") || !strings.Contains(string(backup), "s3cret") {
+		t.Errorf("Expected the backup to include secrets, got %s", backup)
+	}
+
+	target, _, cleanupTarget := setupTestFlagManager(t)
+	defer cleanupTarget()
+	targetRouter := setupTestRouter(target)
+	doRequest(t, targetRouter, "POST", "/api/projects/web/flags/legacy", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+	var result RestoreResult
+	doRequest(t, targetRouter, "POST", "/api/admin/restore", string(backup), http.StatusOK, &result)
+	if len(result.Errors) != 0 {
+		t.Fatalf("Expected no restore errors, got %v", result.Errors)
+	}
+	if p := result.Summary["project"]; p == nil || p.Created != 1 || p.Updated != 1 {
+		t.Errorf("Expected 1 project created and 1 updated, got %+v", p)
+	}
+
+	flags, err := target.storage.ListFlags(context.Background(), "web")
+	if err != nil || len(flags) != 1 || flags["checkout"].DefaultRule.Variation != "on" {
+		t.Errorf("Expected the project flags to be replaced, got %+v, %v", flags, err)
+	}
+	if _, err := target.storage.ListFlags(context.Background(), "empty"); err != nil {
+		t.Errorf("Expected the empty project to be restored, got %v", err)
+	}
+	if gi := target.integrations.GetRaw("gh"); gi == nil || gi.GitHubToken != "ghp_secret" {
+		t.Errorf("Expected the integration with its token, got %+v", gi)
+	}
+	if n := target.notifiers.GetRaw("hook"); n == nil || n.Secret != "s3cret" {
+		t.Errorf("Expected the notifier with its secret, got %+v", n)
+	}
+	restored := target.flagSets.GetByName("mobile")
+	if restored == nil {
+		t.Fatal("Expected the flag set to be restored")
+	}
+	if restored.Retriever.Path != target.getFlagSetFilePath(restored.ID) {
+		t.Errorf("Expected the file retriever to point at %s, got %s", target.getFlagSetFilePath(restored.ID), restored.Retriever.Path)
+	}
+	if setFlags, _ := target.readFlagSetFlags(restored.ID); setFlags["dark-mode"] == nil {
+		t.Errorf("Expected the flag set flags to be restored, got %+v", setFlags)
+	}
+
+	// Restoring again updates in place
+	doRequest(t, targetRouter, "POST", "/api/admin/restore", string(backup), http.StatusOK, &result)
+	if fs := result.Summary["flagSet"]; fs == nil || fs.Updated != 1 || len(target.flagSets.List()) != 1 {
+		t.Errorf("Expected the flag set to be updated, got %+v", fs)
+	}
+
+	doRequest(t, targetRouter, "POST", "/api/admin/restore", `{"version":99}`, http.StatusBadRequest, nil)
+
+	// Backups move between storage backends
+	store, err := db.NewStore("sqlite://" + filepath.Join(t.TempDir(), "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: t.TempDir()}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+	dbRouter := setupTestRouter(dbFM)
+
+	doRequest(t, dbRouter, "POST", "/api/admin/restore", string(backup), http.StatusOK, &result)
+	if len(result.Errors) != 0 {
+		t.Fatalf("Expected no errors restoring into SQLite, got %v", result.Errors)
+	}
+	var dbBackup Backup
+	doRequest(t, dbRouter, "GET", "/api/admin/backup", "", http.StatusOK, &dbBackup)
+	if dbBackup.Storage != "sqlite" || len(dbBackup.Projects["web"]) != 1 || len(dbBackup.Integrations) != 1 || len(dbBackup.Notifiers) != 1 {
+		t.Errorf("Expected the restored resources in the SQLite backup, got %+v", dbBackup)
+	}
+	if len(dbBackup.FlagSets) != 1 || dbBackup.FlagSets[0].Flags["dark-mode"] == nil {
+		t.Errorf("Expected the flag set with its flags in the SQLite backup, got %+v", dbBackup.FlagSets)
+	}
+}
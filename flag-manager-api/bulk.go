@@ -2,53 +2,76 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
 
-func (fm *FlagManager) bulkToggleHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for bulk operations", http.StatusBadRequest)
-		return
-	}
+// reservedMetadataPrefix marks metadata keys managed by the flag manager itself,
+// which bulk edits may not set or remove.
+const reservedMetadataPrefix = "goff."
+
+// BulkResult is the outcome for one flag of a bulk operation.
+type BulkResult struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+}
+
+// BulkResponse reports a bulk operation: the flags changed and an error for
+// each flag that could not be.
+type BulkResponse struct {
+	Results []BulkResult `json:"results"`
+	Errors  []string     `json:"errors"`
+	Total   int          `json:"total"`
+}
 
+func (fm *FlagManager) bulkToggleHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	project := vars["project"]
 
 	var body struct {
 		Keys     []string `json:"keys"`
+		Tag      string   `json:"tag,omitempty"`
 		Disabled bool     `json:"disabled"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
-	if len(body.Keys) == 0 {
-		http.Error(w, "At least one key is required", http.StatusBadRequest)
+	if len(body.Keys) == 0 && body.Tag == "" {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "At least one key or a tag is required")
+		return
+	}
+	keys, err := fm.bulkFlagKeys(r.Context(), project, body.Keys, body.Tag)
+	if err != nil {
+		writeStorageError(w, err)
 		return
 	}
 
 	actor := GetActor(r)
-	var results []map[string]interface{}
+	var results []BulkResult
 	var errors []string
 
-	for _, key := range body.Keys {
-		// Get existing flag
-		existing, err := fm.store.GetFlag(r.Context(), project, key)
+	for _, key := range keys {
+		existing, err := fm.storage.GetFlag(r.Context(), project, key)
 		if err != nil {
 			errors = append(errors, "Flag not found: "+key)
 			continue
 		}
+		if !fm.mayChangeFlag(r, existing.Config) {
+			errors = append(errors, "Not an owner of "+key)
+			continue
+		}
 
-		// Parse existing config and update disable field
-		var flagConfig FlagConfig
-		json.Unmarshal(existing.Config, &flagConfig)
+		flagConfig := existing.Config
 		flagConfig.Disable = &body.Disabled
-
-		configJSON, _ := json.Marshal(flagConfig)
-		flag, err := fm.store.UpdateFlag(r.Context(), project, key, configJSON, body.Disabled, flagConfig.Version, "")
+		_, flag, err := fm.storage.UpdateFlag(r.Context(), project, key, "", flagConfig)
 		if err != nil {
 			errors = append(errors, "Failed to update "+key+": "+err.Error())
 			continue
@@ -60,86 +83,98 @@ func (fm *FlagManager) bulkToggleHandler(w http.ResponseWriter, r *http.Request)
 		}
 		fm.audit.Log(r.Context(), actor, action, "flag", flag.ID, key, project,
 			map[string]interface{}{"disabled": body.Disabled}, nil)
+		fm.notifyProjectWebhook(r, "flag.updated", project, key, "")
 
-		results = append(results, map[string]interface{}{
-			"key":    key,
-			"status": "updated",
-		})
+		results = append(results, BulkResult{Key: key, Status: "updated"})
 	}
 
-	go fm.refreshRelayProxy()
+	fm.scheduleRelayRefresh(r.Context())
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"results": results,
-		"errors":  errors,
-		"total":   len(results),
+	json.NewEncoder(w).Encode(BulkResponse{
+		Results: results,
+		Errors:  errors,
+		Total:   len(results),
 	})
 }
 
 func (fm *FlagManager) bulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for bulk operations", http.StatusBadRequest)
-		return
-	}
-
 	vars := mux.Vars(r)
 	project := vars["project"]
 
 	var body struct {
 		Keys []string `json:"keys"`
+		Tag  string   `json:"tag,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
-	if len(body.Keys) == 0 {
-		http.Error(w, "At least one key is required", http.StatusBadRequest)
+	if len(body.Keys) == 0 && body.Tag == "" {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "At least one key or a tag is required")
+		return
+	}
+	keys, err := fm.bulkFlagKeys(r.Context(), project, body.Keys, body.Tag)
+	if err != nil {
+		writeStorageError(w, err)
 		return
 	}
 
 	actor := GetActor(r)
-	var results []map[string]interface{}
+	var results []BulkResult
 	var errors []string
 
-	for _, key := range body.Keys {
-		existing, _ := fm.store.GetFlag(r.Context(), project, key)
-
-		if err := fm.store.DeleteFlag(r.Context(), project, key); err != nil {
+	for _, key := range keys {
+		flag, err := fm.storage.GetFlag(r.Context(), project, key)
+		if err != nil {
 			errors = append(errors, "Failed to delete "+key+": "+err.Error())
 			continue
 		}
-
-		if existing != nil {
-			var config interface{}
-			json.Unmarshal(existing.Config, &config)
-			fm.audit.Log(r.Context(), actor, "flag.deleted", "flag", existing.ID, key, project,
-				map[string]interface{}{"before": config}, nil)
+		if !fm.mayChangeFlag(r, flag.Config) {
+			errors = append(errors, "Not an owner of "+key)
+			continue
+		}
+		// As with DELETE, flags are archived first and purged when deleted again
+		if !isArchived(flag.Config) {
+			if _, err := fm.setFlagArchived(r, project, key, true); err != nil {
+				errors = append(errors, "Failed to archive "+key+": "+err.Error())
+				continue
+			}
+			results = append(results, BulkResult{Key: key, Status: "archived"})
+			continue
+		}
+		existing, err := fm.storage.DeleteFlag(r.Context(), project, key)
+		if err != nil {
+			errors = append(errors, "Failed to delete "+key+": "+err.Error())
+			continue
 		}
 
-		results = append(results, map[string]interface{}{
-			"key":    key,
-			"status": "deleted",
-		})
+		fm.audit.Log(r.Context(), actor, "flag.deleted", "flag", existing.ID, key, project,
+			map[string]interface{}{"before": existing.Config}, nil)
+		fm.notifyProjectWebhook(r, "flag.deleted", project, key, "")
+
+		results = append(results, BulkResult{Key: key, Status: "deleted"})
 	}
 
-	go fm.refreshRelayProxy()
+	fm.scheduleRelayRefresh(r.Context())
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"results": results,
-		"errors":  errors,
-		"total":   len(results),
+	json.NewEncoder(w).Encode(BulkResponse{
+		Results: results,
+		Errors:  errors,
+		Total:   len(results),
 	})
 }
 
-func (fm *FlagManager) cloneFlagHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for cloning", http.StatusBadRequest)
-		return
-	}
+// ClonedFlagResponse is a flag created by cloning another.
+type ClonedFlagResponse struct {
+	Key     string     `json:"key"`
+	Project string     `json:"project"`
+	Config  FlagConfig `json:"config"`
+}
 
+func (fm *FlagManager) cloneFlagHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	project := vars["project"]
 	flagKey := vars["flagKey"]
@@ -149,12 +184,12 @@ func (fm *FlagManager) cloneFlagHandler(w http.ResponseWriter, r *http.Request)
 		TargetProject string `json:"targetProject,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if body.NewKey == "" {
-		http.Error(w, "newKey is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "newKey is required")
 		return
 	}
 
@@ -168,31 +203,39 @@ func (fm *FlagManager) cloneFlagHandler(w http.ResponseWriter, r *http.Request)
 		targetProject = body.TargetProject
 	}
 
-	// Read source flag
-	source, err := fm.store.GetFlag(r.Context(), project, flagKey)
+	source, err := fm.storage.GetFlag(r.Context(), project, flagKey)
 	if err != nil {
-		http.Error(w, "Source flag not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Source flag not found")
 		return
 	}
 
-	// Check if target already exists
-	exists, _ := fm.store.FlagExists(r.Context(), targetProject, body.NewKey)
-	if exists {
-		http.Error(w, "Flag with new key already exists in target project", http.StatusConflict)
-		return
+	if targetProject != project {
+		exists, err := fm.storage.ProjectExists(r.Context(), targetProject)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if !exists {
+			writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Target project not found")
+			return
+		}
 	}
 
-	// Create the clone
-	var flagConfig FlagConfig
-	json.Unmarshal(source.Config, &flagConfig)
-	disabled := false
-	if flagConfig.Disable != nil {
-		disabled = *flagConfig.Disable
+	if errs, err := fm.validateFlagKeyConvention(r.Context(), targetProject, body.NewKey, source.Config.Owners); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	} else if len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_KEY", "Flag key does not follow the project's naming rules", errs...)
+		return
 	}
 
-	cloned, err := fm.store.CreateFlag(r.Context(), targetProject, body.NewKey, source.Config, disabled, flagConfig.Version)
+	cloned, err := fm.storage.CreateFlag(r.Context(), targetProject, body.NewKey, source.Config)
+	if errors.Is(err, errFlagExists) {
+		writeError(w, http.StatusConflict, "FLAG_EXISTS", "Flag with new key already exists in target project")
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeStorageError(w, err)
 		return
 	}
 
@@ -204,15 +247,191 @@ func (fm *FlagManager) cloneFlagHandler(w http.ResponseWriter, r *http.Request)
 			"targetKey":     body.NewKey,
 		}, nil)
 
-	go fm.refreshRelayProxy()
+	fm.scheduleRelayRefresh(r.Context())
 
-	var config interface{}
-	json.Unmarshal(cloned.Config, &config)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"key":     body.NewKey,
-		"project": targetProject,
-		"config":  config,
+	json.NewEncoder(w).Encode(ClonedFlagResponse{
+		Key:     body.NewKey,
+		Project: targetProject,
+		Config:  cloned.Config,
+	})
+}
+
+// MetadataPatch describes a bulk metadata change. Flags are selected by Keys (all
+// flags when empty) and further narrowed to those carrying Tag, if set, and whose
+// metadata contains every Match entry.
+type MetadataPatch struct {
+	Keys   []string               `json:"keys,omitempty"`
+	Tag    string                 `json:"tag,omitempty"`
+	Match  map[string]interface{} `json:"match,omitempty"`
+	Set    map[string]interface{} `json:"set,omitempty"`
+	Remove []string               `json:"remove,omitempty"`
+}
+
+// validate checks that the patch changes something and leaves reserved keys alone.
+func (p MetadataPatch) validate() []string {
+	var errs []string
+	if len(p.Set) == 0 && len(p.Remove) == 0 {
+		errs = append(errs, "set or remove is required")
+	}
+
+	check := func(key string) {
+		if strings.TrimSpace(key) == "" {
+			errs = append(errs, "metadata keys cannot be empty")
+		} else if strings.HasPrefix(key, reservedMetadataPrefix) {
+			errs = append(errs, fmt.Sprintf("metadata key '%s' is reserved", key))
+		}
+	}
+	for key := range p.Set {
+		check(key)
+	}
+	for _, key := range p.Remove {
+		check(key)
+		if _, ok := p.Set[key]; ok {
+			errs = append(errs, fmt.Sprintf("metadata key '%s' cannot be both set and removed", key))
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// selects reports whether a flag's metadata satisfies the patch's match filter.
+func (p MetadataPatch) selects(metadata map[string]interface{}) bool {
+	for key, want := range p.Match {
+		got, ok := metadata[key]
+		if !ok || !reflect.DeepEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the patched copy of metadata and whether anything changed.
+func (p MetadataPatch) apply(metadata map[string]interface{}) (map[string]interface{}, bool) {
+	patched := make(map[string]interface{}, len(metadata)+len(p.Set))
+	for k, v := range metadata {
+		patched[k] = v
+	}
+	for k, v := range p.Set {
+		patched[k] = v
+	}
+	for _, k := range p.Remove {
+		delete(patched, k)
+	}
+	if len(patched) == 0 {
+		return nil, len(metadata) > 0
+	}
+	return patched, !reflect.DeepEqual(patched, metadata)
+}
+
+// BulkMetadataResponse lists the flags whose metadata a bulk edit changed.
+type BulkMetadataResponse struct {
+	Updated []string `json:"updated"`
+	Total   int      `json:"total"`
+}
+
+// bulkMetadataHandler applies a metadata patch to many flags of a project at
+// once. All selected flags are written together or not at all.
+func (fm *FlagManager) bulkMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+
+	var patch MetadataPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	// Normalize values to their JSON form so Match compares like with like.
+	if generic, err := toGenericValue(patch.Match); err == nil {
+		patch.Match, _ = generic.(map[string]interface{})
+	}
+
+	if errs := patch.validate(); len(errs) > 0 {
+		writeValidationError(w, "INVALID_METADATA_PATCH", "Metadata patch is invalid", errs...)
+		return
+	}
+
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.loadStoredProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if flags == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	candidates := patch.Keys
+	if len(candidates) == 0 {
+		for key := range flags {
+			candidates = append(candidates, key)
+		}
+	}
+	sort.Strings(candidates)
+
+	type metadataChange struct {
+		key           string
+		before, after map[string]interface{}
+	}
+	var changes []metadataChange
+	var denied []string
+	for _, key := range candidates {
+		config, ok := flags[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found: "+key)
+			return
+		}
+		if (patch.Tag != "" && !hasTag(config, patch.Tag)) || !patch.selects(config.Metadata) {
+			continue
+		}
+		patched, changed := patch.apply(config.Metadata)
+		if !changed {
+			continue
+		}
+		if !fm.mayChangeFlag(r, config) {
+			denied = append(denied, key)
+		}
+		changes = append(changes, metadataChange{key: key, before: config.Metadata, after: patched})
+		config.Metadata = patched
+		flags[key] = config
+	}
+	if len(denied) > 0 {
+		writeNotFlagOwner(w, denied...)
+		return
+	}
+
+	if len(changes) > 0 {
+		changedKeys := make([]string, 0, len(changes))
+		for _, c := range changes {
+			changedKeys = append(changedKeys, c.key)
+		}
+		flagIDs, err := fm.saveStoredProjectFlags(r.Context(), project, flags, changedKeys)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+
+		actor := GetActor(r)
+		for _, c := range changes {
+			fm.audit.Log(r.Context(), actor, "flag.metadata_updated", "flag", flagIDs[c.key], c.key, project,
+				map[string]interface{}{"before": c.before, "after": c.after},
+				map[string]interface{}{"bulk": true})
+		}
+
+		fm.scheduleRelayRefresh(r.Context())
+	}
+
+	updatedKeys := make([]string, 0, len(changes))
+	for _, c := range changes {
+		updatedKeys = append(updatedKeys, c.key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BulkMetadataResponse{
+		Updated: updatedKeys,
+		Total:   len(updatedKeys),
 	})
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Targeting transform operations.
+const (
+	targetingAddRule         = "addRule"
+	targetingRemoveRule      = "removeRule"
+	targetingRenameSegment   = "renameSegment"
+	targetingSetBucketingKey = "setBucketingKey"
+)
+
+// TargetingTransform is one change of a bulk targeting edit.
+type TargetingTransform struct {
+	Op           string         `json:"op"`                     // addRule, removeRule, renameSegment or setBucketingKey
+	Rule         *TargetingRule `json:"rule,omitempty"`         // addRule: the rule, which must be named
+	Position     string         `json:"position,omitempty"`     // addRule: "first", or "last" (default)
+	Name         string         `json:"name,omitempty"`         // removeRule: the name of the rule
+	From         string         `json:"from,omitempty"`         // renameSegment: the segment referenced
+	To           string         `json:"to,omitempty"`           // renameSegment: the segment to reference instead
+	BucketingKey string         `json:"bucketingKey,omitempty"` // setBucketingKey: the key; empty clears it
+}
+
+// TargetingPatch describes a bulk targeting change: its transforms are applied
+// in order to the flags selected by Keys and Tag, as for the other bulk
+// operations.
+type TargetingPatch struct {
+	Keys       []string             `json:"keys,omitempty"`
+	Tag        string               `json:"tag,omitempty"`
+	Transforms []TargetingTransform `json:"transforms"`
+}
+
+// validate checks that the patch selects flags and that its transforms are
+// complete.
+func (p TargetingPatch) validate() []string {
+	var errs []string
+	if len(p.Keys) == 0 && p.Tag == "" {
+		errs = append(errs, "at least one key or a tag is required")
+	}
+	if len(p.Transforms) == 0 {
+		errs = append(errs, "at least one transform is required")
+	}
+	for i, t := range p.Transforms {
+		prefix := fmt.Sprintf("transform #%d: ", i+1)
+		switch t.Op {
+		case targetingAddRule:
+			if t.Rule == nil || t.Rule.Name == "" {
+				errs = append(errs, prefix+"rule with a name is required")
+			} else if err := validateQuery(t.Rule.Query); err != nil {
+				errs = append(errs, prefix+err.Error())
+			}
+			if t.Position != "" && t.Position != "first" && t.Position != "last" {
+				errs = append(errs, prefix+"position must be first or last")
+			}
+		case targetingRemoveRule:
+			if t.Name == "" {
+				errs = append(errs, prefix+"name is required")
+			}
+		case targetingRenameSegment:
+			for _, name := range []string{t.From, t.To} {
+				if err := ValidateSegmentName(name); err != nil {
+					errs = append(errs, prefix+err.Error())
+				}
+			}
+			if t.From == t.To {
+				errs = append(errs, prefix+"from and to must differ")
+			}
+		case targetingSetBucketingKey:
+		default:
+			errs = append(errs, prefix+"op must be addRule, removeRule, renameSegment or setBucketingKey")
+		}
+	}
+	return errs
+}
+
+// apply returns a flag config with the transforms applied and whether
+// anything changed. The config passed in is left untouched.
+func (p TargetingPatch) apply(config FlagConfig) (FlagConfig, bool) {
+	after := config
+	after.Targeting = append([]TargetingRule(nil), config.Targeting...)
+	scheduleCopied := false
+	for _, t := range p.Transforms {
+		switch t.Op {
+		case targetingAddRule:
+			// Adding a rule again leaves the flag as it is
+			if slices.ContainsFunc(after.Targeting, func(rule TargetingRule) bool { return rule.Name == t.Rule.Name }) {
+				continue
+			}
+			if t.Position == "first" {
+				after.Targeting = append([]TargetingRule{*t.Rule}, after.Targeting...)
+			} else {
+				after.Targeting = append(after.Targeting, *t.Rule)
+			}
+		case targetingRemoveRule:
+			after.Targeting = slices.DeleteFunc(after.Targeting, func(rule TargetingRule) bool { return rule.Name == t.Name })
+		case targetingRenameSegment:
+			if !scheduleCopied && len(after.ScheduledRollout) > 0 {
+				after.ScheduledRollout = append([]ScheduledStep(nil), after.ScheduledRollout...)
+				for i := range after.ScheduledRollout {
+					after.ScheduledRollout[i].Targeting = append([]TargetingRule(nil), after.ScheduledRollout[i].Targeting...)
+				}
+				scheduleCopied = true
+			}
+			renameRuleSegments(after.Targeting, t.From, t.To)
+			for i := range after.ScheduledRollout {
+				renameRuleSegments(after.ScheduledRollout[i].Targeting, t.From, t.To)
+			}
+		case targetingSetBucketingKey:
+			after.BucketingKey = t.BucketingKey
+		}
+	}
+	if len(after.Targeting) == 0 && len(config.Targeting) == 0 {
+		after.Targeting = config.Targeting
+	}
+	return after, !reflect.DeepEqual(after, config)
+}
+
+// renameRuleSegments makes the rules referencing segment from reference
+// segment to instead.
+func renameRuleSegments(rules []TargetingRule, from, to string) {
+	for i := range rules {
+		if query, ok := renameSegmentReference(rules[i].Query, from, to); ok {
+			rules[i].Query = query
+		}
+	}
+}
+
+// BulkTargetingChange is a flag a bulk targeting edit changes, with the
+// changes to its config.
+type BulkTargetingChange struct {
+	Key     string         `json:"key"`
+	Changes []ConfigChange `json:"changes"`
+}
+
+// BulkTargetingResponse lists the flags a bulk targeting edit changed, or
+// would change with ?dryRun=true.
+type BulkTargetingResponse struct {
+	DryRun  bool                  `json:"dryRun"`
+	Applied bool                  `json:"applied"`
+	Updated []BulkTargetingChange `json:"updated"`
+	Total   int                   `json:"total"`
+}
+
+// bulkUpdateTargetingHandler applies targeting transforms to many flags of a
+// project at once. All changed flags are written together or not at all:
+// when one of them may not be changed, is invalid after the transforms or
+// requires approval, nothing is. ?dryRun=true returns the changes without
+// writing them. Archived flags selected by tag are left out.
+func (fm *FlagManager) bulkUpdateTargetingHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+
+	var patch TargetingPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if errs := patch.validate(); len(errs) > 0 {
+		writeValidationError(w, "INVALID_TARGETING_PATCH", "Targeting patch is invalid", errs...)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.loadStoredProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if flags == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	candidates := patch.Keys
+	if len(candidates) == 0 {
+		for key, config := range flags {
+			if !isArchived(config) {
+				candidates = append(candidates, key)
+			}
+		}
+	}
+	sort.Strings(candidates)
+
+	type targetingChange struct {
+		key           string
+		before, after FlagConfig
+		diff          []ConfigChange
+	}
+	var changes []targetingChange
+	var denied, invalid, approval []string
+	for _, key := range candidates {
+		config, ok := flags[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found: "+key)
+			return
+		}
+		if patch.Tag != "" && !hasTag(config, patch.Tag) {
+			continue
+		}
+		if isArchived(config) {
+			writeError(w, http.StatusConflict, "FLAG_ARCHIVED", "Flag is archived; restore it to change it: "+key)
+			return
+		}
+		after, changed := patch.apply(config)
+		if !changed {
+			continue
+		}
+		if !fm.mayChangeFlag(r, config) {
+			denied = append(denied, key)
+		}
+		for _, e := range ValidateFlagConfig(after) {
+			invalid = append(invalid, key+": "+e)
+		}
+		if fm.flagRequiresApproval(config) && !fm.bypassesApproval(r) {
+			approval = append(approval, key)
+		}
+		diff, err := diffConfigs(config, after)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		changes = append(changes, targetingChange{key: key, before: config, after: after, diff: diff})
+	}
+	if len(denied) > 0 {
+		writeNotFlagOwner(w, denied...)
+		return
+	}
+	if len(invalid) > 0 {
+		writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid after the transforms", invalid...)
+		return
+	}
+	if len(approval) > 0 {
+		writeError(w, http.StatusConflict, "APPROVAL_REQUIRED", "Flags that require approval must be updated one at a time: "+strings.Join(approval, ", "))
+		return
+	}
+	if dryRun {
+		checked := make([]flagChange, 0, len(changes))
+		for _, c := range changes {
+			checked = append(checked, flagChange{key: c.key, before: &c.before, after: &c.after})
+		}
+		if !fm.checkFlagPolicies(w, r, project, checked...) {
+			return
+		}
+	}
+
+	resp := BulkTargetingResponse{DryRun: dryRun, Updated: []BulkTargetingChange{}}
+	for _, c := range changes {
+		resp.Updated = append(resp.Updated, BulkTargetingChange{Key: c.key, Changes: c.diff})
+	}
+	resp.Total = len(resp.Updated)
+
+	if !dryRun {
+		if len(changes) > 0 {
+			changedKeys := make([]string, 0, len(changes))
+			for _, c := range changes {
+				flags[c.key] = c.after
+				changedKeys = append(changedKeys, c.key)
+			}
+			flagIDs, err := fm.saveStoredProjectFlags(r.Context(), project, flags, changedKeys)
+			if err != nil {
+				writeStorageError(w, err)
+				return
+			}
+
+			actor := GetActor(r)
+			for _, c := range changes {
+				fm.audit.Log(r.Context(), actor, "flag.updated", "flag", flagIDs[c.key], c.key, project,
+					map[string]interface{}{"before": c.before, "after": c.after},
+					map[string]interface{}{"bulk": true, "transforms": patch.Transforms})
+				fm.notifyProjectWebhook(r, "flag.updated", project, c.key, "")
+				fm.syncJiraIssue(r, project, c.key, &c.before, &c.after)
+			}
+
+			fm.scheduleRelayRefresh(r.Context())
+		}
+		resp.Applied = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
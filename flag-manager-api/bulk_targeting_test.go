@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestBulkUpdateTargeting(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			get := func(key string) FlagConfig {
+				t.Helper()
+				var flag FlagResponse
+				doRequest(t, router, "GET", "/api/projects/shop/flags/"+key, "", http.StatusOK, &flag)
+				return flag.Config
+			}
+
+			doRequest(t, router, "POST", "/api/projects/shop/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"tags":["payments"],
+				"targeting":[{"name":"beta","query":"segment:beta-users","variation":"on"}]}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/refunds", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"tags":["payments"]}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/banner", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+			patch := `{"tag":"payments","transforms":[
+				{"op":"addRule","position":"first","rule":{"name":"staff","query":"country eq \"FR\"","variation":"on"}},
+				{"op":"renameSegment","from":"beta-users","to":"beta-testers"},
+				{"op":"setBucketingKey","bucketingKey":"teamId"}]}`
+			var preview BulkTargetingResponse
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-update-targeting?dryRun=true", patch, http.StatusOK, &preview)
+			if !preview.DryRun || preview.Applied || preview.Total != 2 || preview.Updated[0].Key != "checkout" || preview.Updated[1].Key != "refunds" {
+				t.Fatalf("Expected a preview of checkout and refunds, got %+v", preview)
+			}
+			paths := map[string]bool{}
+			for _, c := range preview.Updated[0].Changes {
+				paths[c.Path] = true
+			}
+			if !paths["bucketingKey"] || !paths["targeting[0].name"] || !paths["targeting[1]"] {
+				t.Errorf("Expected the diff of checkout, got %+v", preview.Updated[0].Changes)
+			}
+			if config := get("checkout"); len(config.Targeting) != 1 || config.BucketingKey != "" {
+				t.Errorf("Expected the preview not to change the flag, got %+v", config)
+			}
+
+			var applied BulkTargetingResponse
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-update-targeting", patch, http.StatusOK, &applied)
+			if applied.DryRun || !applied.Applied || applied.Total != 2 {
+				t.Errorf("Expected checkout and refunds updated, got %+v", applied)
+			}
+			checkout := get("checkout")
+			if len(checkout.Targeting) != 2 || checkout.Targeting[0].Name != "staff" || checkout.Targeting[1].Query != "segment:beta-testers" || checkout.BucketingKey != "teamId" {
+				t.Errorf("Expected the transforms applied to checkout, got %+v", checkout)
+			}
+			if refunds := get("refunds"); len(refunds.Targeting) != 1 || refunds.BucketingKey != "teamId" {
+				t.Errorf("Expected the transforms applied to refunds, got %+v", refunds)
+			}
+			if banner := get("banner"); len(banner.Targeting) != 0 || banner.BucketingKey != "" {
+				t.Errorf("Expected banner to be left alone, got %+v", banner)
+			}
+
+			// Applying the same patch again changes nothing
+			applied = BulkTargetingResponse{}
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-update-targeting", patch, http.StatusOK, &applied)
+			if applied.Total != 0 {
+				t.Errorf("Expected nothing left to change, got %+v", applied)
+			}
+
+			// A flag left invalid fails the whole edit
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-update-targeting", `{"keys":["checkout","refunds"],"transforms":[
+				{"op":"removeRule","name":"staff"},
+				{"op":"addRule","rule":{"name":"vip","query":"plan eq \"vip\"","variation":"missing"}}]}`, http.StatusBadRequest, nil)
+			if config := get("checkout"); len(config.Targeting) != 2 {
+				t.Errorf("Expected no flag changed by a failed edit, got %+v", config)
+			}
+
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-update-targeting", `{"keys":["checkout"],"transforms":[{"op":"removeRule","name":"staff"}]}`, http.StatusOK, &applied)
+			if config := get("checkout"); len(config.Targeting) != 1 || config.Targeting[0].Name != "beta" {
+				t.Errorf("Expected the staff rule removed, got %+v", config.Targeting)
+			}
+
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-update-targeting", `{"keys":["missing"],"transforms":[{"op":"removeRule","name":"staff"}]}`, http.StatusNotFound, nil)
+			doRequest(t, router, "POST", "/api/projects/nope/flags/bulk-update-targeting", `{"tag":"payments","transforms":[{"op":"removeRule","name":"staff"}]}`, http.StatusNotFound, nil)
+			for _, invalid := range []string{
+				`{"transforms":[{"op":"removeRule","name":"staff"}]}`,
+				`{"tag":"payments","transforms":[]}`,
+				`{"tag":"payments","transforms":[{"op":"rewrite"}]}`,
+				`{"tag":"payments","transforms":[{"op":"addRule","rule":{"query":"country eq \"FR\"","variation":"on"}}]}`,
+				`{"tag":"payments","transforms":[{"op":"addRule","rule":{"name":"bad","query":"country eq","variation":"on"}}]}`,
+				`{"tag":"payments","transforms":[{"op":"renameSegment","from":"beta","to":"beta"}]}`,
+			} {
+				doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-update-targeting", invalid, http.StatusBadRequest, nil)
+			}
+		})
+	}
+
+	events, err := store.ListAuditEvents(context.Background(), db.AuditFilterParams{PaginationParams: db.DefaultPagination(), Action: "flag.updated"})
+	if err != nil || events.Total != 3 {
+		t.Errorf("Expected 3 bulk flag.updated audit events, got %v, %v", events, err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBulkMetadata(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	for key, team := range map[string]string{"checkout": "payments", "refunds": "payments", "search": "discovery"} {
+		body, _ := json.Marshal(FlagConfig{
+			Variations:  map[string]interface{}{"on": true, "off": false},
+			DefaultRule: &DefaultRule{Variation: "off"},
+			Metadata:    map[string]interface{}{"team": team, "legacy": true},
+		})
+		req := httptest.NewRequest("POST", "/api/projects/shop/flags/"+key, bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to create flag %s: %d %s", key, rr.Code, rr.Body.String())
+		}
+	}
+
+	patch := func(p MetadataPatch) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(p)
+		req := httptest.NewRequest("POST", "/api/projects/shop/flags/bulk-metadata", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("reserved and empty patches rejected", func(t *testing.T) {
+		for _, p := range []MetadataPatch{
+			{},
+			{Set: map[string]interface{}{"goff.owner": "x"}},
+			{Remove: []string{"goff.archived"}},
+			{Set: map[string]interface{}{"team": "x"}, Remove: []string{"team"}},
+		} {
+			rr := patch(p)
+			if rr.Code != http.StatusBadRequest || !bytes.Contains(rr.Body.Bytes(), []byte("INVALID_METADATA_PATCH")) {
+				t.Errorf("Expected INVALID_METADATA_PATCH for %+v, got %d: %s", p, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("unknown key fails without partial writes", func(t *testing.T) {
+		rr := patch(MetadataPatch{Keys: []string{"checkout", "missing"}, Set: map[string]interface{}{"owner": "x"}})
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("Expected status 404, got %d: %s", rr.Code, rr.Body.String())
+		}
+		flags, _ := fm.readProjectFlags("shop")
+		if _, ok := flags["checkout"].Metadata["owner"]; ok {
+			t.Error("Expected checkout to be left unchanged")
+		}
+	})
+
+	t.Run("patch applied to matching flags", func(t *testing.T) {
+		rr := patch(MetadataPatch{
+			Match:  map[string]interface{}{"team": "payments"},
+			Set:    map[string]interface{}{"owner": "payments-oncall"},
+			Remove: []string{"legacy"},
+		})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var resp struct {
+			Updated []string `json:"updated"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if strings.Join(resp.Updated, ",") != "checkout,refunds" {
+			t.Errorf("Expected checkout and refunds to be updated, got %v", resp.Updated)
+		}
+
+		flags, _ := fm.readProjectFlags("shop")
+		for key, config := range flags {
+			_, hasLegacy := config.Metadata["legacy"]
+			owner := config.Metadata["owner"]
+			if key == "search" {
+				if !hasLegacy || owner != nil {
+					t.Errorf("Expected search to be unchanged, got %v", config.Metadata)
+				}
+				continue
+			}
+			if hasLegacy || owner != "payments-oncall" {
+				t.Errorf("Unexpected metadata for %s: %v", key, config.Metadata)
+			}
+			if config.Variations == nil || config.DefaultRule == nil {
+				t.Errorf("Expected rule config of %s to be preserved", key)
+			}
+		}
+	})
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// changeFeedBufferSize is how many messages a subscriber may fall behind by
+	// before it is disconnected as too slow.
+	changeFeedBufferSize = 64
+
+	changeFeedWriteTimeout = 10 * time.Second
+	changeFeedPingInterval = 30 * time.Second
+	// changeFeedReadTimeout closes connections that stop answering pings.
+	changeFeedReadTimeout = 2 * changeFeedPingInterval
+)
+
+// ChangeEvent is a change feed message, built from an audit event.
+type ChangeEvent struct {
+	Type         string          `json:"type"` // always "change"
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resourceType"`
+	ResourceID   string          `json:"resourceId,omitempty"`
+	ResourceName string          `json:"resourceName,omitempty"`
+	Project      string          `json:"project,omitempty"`
+	FlagSet      string          `json:"flagSet,omitempty"`
+	Actor        Actor           `json:"actor"`
+	Changes      json.RawMessage `json:"changes,omitempty"` // before/after as audited
+	Diff         []ConfigChange  `json:"diff,omitempty"`    // field changes between before and after
+	Timestamp    time.Time       `json:"timestamp"`
+}
+
+// changeFeedRequest is a client message changing its subscriptions.
+type changeFeedRequest struct {
+	Type     string   `json:"type"` // subscribe, unsubscribe
+	Projects []string `json:"projects"`
+	FlagSets []string `json:"flagSets"`
+}
+
+// ChangeFeed fans audit events out to change feed subscribers.
+type ChangeFeed struct {
+	mu          sync.RWMutex
+	subscribers map[*changeSubscriber]struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewChangeFeed creates a change feed without subscribers.
+func NewChangeFeed() *ChangeFeed {
+	return &ChangeFeed{subscribers: make(map[*changeSubscriber]struct{}), closed: make(chan struct{})}
+}
+
+// Close disconnects every subscriber with status 1001, as the server shuts
+// down, so that clients reconnect to another replica.
+func (f *ChangeFeed) Close() {
+	f.closeOnce.Do(func() { close(f.closed) })
+}
+
+// changeSubscriber receives the encoded events of the projects and flag sets
+// it subscribed to. "*" subscribes to all of them.
+type changeSubscriber struct {
+	mu       sync.RWMutex
+	projects map[string]bool
+	flagSets map[string]bool
+
+	messages chan []byte
+	// slow is closed when the subscriber's buffer overflows
+	slow     chan struct{}
+	slowOnce sync.Once
+}
+
+// Subscribe registers a subscriber with no subscriptions.
+func (f *ChangeFeed) Subscribe() *changeSubscriber {
+	s := &changeSubscriber{
+		projects: make(map[string]bool),
+		flagSets: make(map[string]bool),
+		messages: make(chan []byte, changeFeedBufferSize),
+		slow:     make(chan struct{}),
+	}
+	f.mu.Lock()
+	f.subscribers[s] = struct{}{}
+	f.mu.Unlock()
+	changeFeedConnections.Add(1)
+	return s
+}
+
+// Unsubscribe removes a subscriber; it receives no further events.
+func (f *ChangeFeed) Unsubscribe(s *changeSubscriber) {
+	f.mu.Lock()
+	_, ok := f.subscribers[s]
+	delete(f.subscribers, s)
+	f.mu.Unlock()
+	if ok {
+		changeFeedConnections.Add(-1)
+	}
+}
+
+// Publish delivers an event to every matching subscriber without blocking.
+// Subscribers whose buffer is full are flagged as slow and dropped by their
+// connection handler.
+func (f *ChangeFeed) Publish(event ChangeEvent) {
+	if f == nil {
+		return
+	}
+
+	var data []byte
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for s := range f.subscribers {
+		if !s.matches(event) {
+			continue
+		}
+		if data == nil {
+			var err error
+			if data, err = json.Marshal(event); err != nil {
+				slog.Warn("Failed to encode change event", "error", err)
+				return
+			}
+		}
+		select {
+		case s.messages <- data:
+		default:
+			s.slowOnce.Do(func() {
+				close(s.slow)
+				changeFeedSlowDisconnects.Add(1)
+			})
+		}
+	}
+}
+
+func (s *changeSubscriber) matches(event ChangeEvent) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if event.Project != "" && (s.projects["*"] || s.projects[event.Project]) {
+		return true
+	}
+	return event.FlagSet != "" && (s.flagSets["*"] || s.flagSets[event.FlagSet])
+}
+
+// update adds or removes subscriptions.
+func (s *changeSubscriber) update(projects, flagSets []string, subscribe bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range projects {
+		if subscribe {
+			s.projects[p] = true
+		} else {
+			delete(s.projects, p)
+		}
+	}
+	for _, id := range flagSets {
+		if subscribe {
+			s.flagSets[id] = true
+		} else {
+			delete(s.flagSets, id)
+		}
+	}
+}
+
+// subscriptions returns the current subscriptions as a message to the client.
+func (s *changeSubscriber) subscriptions() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	projects := make([]string, 0, len(s.projects))
+	for p := range s.projects {
+		projects = append(projects, p)
+	}
+	flagSets := make([]string, 0, len(s.flagSets))
+	for id := range s.flagSets {
+		flagSets = append(flagSets, id)
+	}
+	sort.Strings(projects)
+	sort.Strings(flagSets)
+	return map[string]interface{}{"type": "subscribed", "projects": projects, "flagSets": flagSets}
+}
+
+// newChangeEvent builds a change feed event from an audit event. Flag set flag
+// events carry their flag set ID as the resource ID.
+func newChangeEvent(actor Actor, action, resourceType, resourceID, resourceName, project string, changes interface{}, changesJSON json.RawMessage) ChangeEvent {
+	event := ChangeEvent{
+		Type:         "change",
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		ResourceName: resourceName,
+		Project:      project,
+		Actor:        actor,
+		Changes:      changesJSON,
+		Timestamp:    time.Now().UTC(),
+	}
+	if resourceType == "flagset_flag" {
+		event.FlagSet = resourceID
+	}
+
+	if m, ok := changes.(map[string]interface{}); ok {
+		before, hasBefore := m["before"]
+		after, hasAfter := m["after"]
+		if hasBefore && hasAfter {
+			if diff, err := diffConfigs(before, after); err == nil && len(diff) > 0 {
+				event.Diff = diff
+			}
+		}
+	}
+	return event
+}
+
+// changeFeedHandler serves the change feed over a WebSocket. Clients choose
+// projects and flag sets with the project and flagSet query parameters and
+// with {"type": "subscribe"|"unsubscribe", "projects": [...], "flagSets": [...]}
+// messages; each change is sent as a ChangeEvent. Clients that fall
+// changeFeedBufferSize messages behind are disconnected with status 1013 and
+// should reconnect and reload.
+func (fm *FlagManager) changeFeedHandler(w http.ResponseWriter, r *http.Request) {
+	if fm.changes == nil {
+		writeError(w, http.StatusServiceUnavailable, "UNAVAILABLE", "Change feed not available")
+		return
+	}
+
+	conn, err := fm.upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Writes come from both the reader and the feed loop
+	var writeMu sync.Mutex
+	write := func(messageType int, data []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(changeFeedWriteTimeout))
+		return conn.WriteMessage(messageType, data)
+	}
+	closeWith := func(code int, reason string) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	}
+
+	sub := fm.changes.Subscribe()
+	defer fm.changes.Unsubscribe(sub)
+
+	q := r.URL.Query()
+	sub.update(q["project"], q["flagSet"], true)
+
+	send := func(v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return write(websocket.TextMessage, data)
+	}
+	if err := send(sub.subscriptions()); err != nil {
+		return
+	}
+
+	// The reader handles subscription changes until the client goes away
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(changeFeedReadTimeout))
+		})
+		for {
+			conn.SetReadDeadline(time.Now().Add(changeFeedReadTimeout))
+			op, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if op != websocket.TextMessage {
+				continue
+			}
+
+			var req changeFeedRequest
+			if err := json.Unmarshal(message, &req); err != nil || (req.Type != "subscribe" && req.Type != "unsubscribe") {
+				send(map[string]string{"type": "error", "error": `expected {"type": "subscribe"|"unsubscribe", "projects": [...], "flagSets": [...]}`})
+				continue
+			}
+			sub.update(req.Projects, req.FlagSets, req.Type == "subscribe")
+			if send(sub.subscriptions()) != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(changeFeedPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case data := <-sub.messages:
+			if write(websocket.TextMessage, data) != nil {
+				return
+			}
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(changeFeedWriteTimeout)) != nil {
+				return
+			}
+		case <-sub.slow:
+			closeWith(websocket.CloseTryAgainLater, "subscriber too slow")
+			return
+		case <-fm.changes.closed:
+			closeWith(websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-readerDone:
+			return
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testWSClient is a change feed client.
+type testWSClient struct {
+	conn *websocket.Conn
+}
+
+func dialTestWebSocket(t *testing.T, serverURL, path string) *testWSClient {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(serverURL, "http")+path, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %d", resp.StatusCode)
+	}
+	return &testWSClient{conn: conn}
+}
+
+func (c *testWSClient) send(t *testing.T, v interface{}) {
+	t.Helper()
+	if err := c.conn.WriteJSON(v); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+}
+
+func (c *testWSClient) readJSON(t *testing.T) map[string]interface{} {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	op, payload, err := c.conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if op != websocket.TextMessage {
+		t.Fatalf("Expected text message, got type %d", op)
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Fatalf("Invalid message %s: %v", payload, err)
+	}
+	return msg
+}
+
+func TestChangeFeed(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	doRequest(t, router, "POST", "/api/projects/feed-a", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/feed-b", "", http.StatusCreated, nil)
+	flagSet, err := fm.flagSets.Create(FlagSet{Name: "mobile"})
+	if err != nil {
+		t.Fatalf("Failed to create flag set: %v", err)
+	}
+
+	client := dialTestWebSocket(t, server.URL, "/api/ws?project=feed-a")
+	defer client.conn.Close()
+
+	msg := client.readJSON(t)
+	if msg["type"] != "subscribed" || fmt.Sprint(msg["projects"]) != "[feed-a]" {
+		t.Fatalf("Expected subscription ack for feed-a, got %v", msg)
+	}
+
+	flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+	doRequest(t, router, "POST", "/api/projects/feed-b/flags/ignored", flag, http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/feed-a/flags/checkout", flag, http.StatusCreated, nil)
+
+	msg = client.readJSON(t)
+	if msg["type"] != "change" || msg["action"] != "flag.created" || msg["project"] != "feed-a" || msg["resourceName"] != "checkout" {
+		t.Fatalf("Expected feed-a flag.created event only, got %v", msg)
+	}
+	if actor, _ := msg["actor"].(map[string]interface{}); actor["name"] == nil {
+		t.Errorf("Expected actor in event, got %v", msg["actor"])
+	}
+
+	updated := `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`
+	doRequest(t, router, "PUT", "/api/projects/feed-a/flags/checkout", updated, http.StatusOK, nil)
+
+	msg = client.readJSON(t)
+	diff, _ := json.Marshal(msg["diff"])
+	if msg["action"] != "flag.updated" || string(diff) != `[{"after":"on","before":"off","op":"changed","path":"defaultRule.variation"}]` {
+		t.Fatalf("Expected flag.updated with diff, got %v (diff %s)", msg, diff)
+	}
+
+	// Subscriptions change at runtime
+	client.send(t, map[string]interface{}{"type": "subscribe", "flagSets": []string{flagSet.ID}})
+	client.send(t, map[string]interface{}{"type": "unsubscribe", "projects": []string{"feed-a"}})
+	if msg = client.readJSON(t); msg["type"] != "subscribed" {
+		t.Fatalf("Expected subscription ack, got %v", msg)
+	}
+	msg = client.readJSON(t)
+	if fmt.Sprint(msg["projects"]) != "[]" || fmt.Sprint(msg["flagSets"]) != "["+flagSet.ID+"]" {
+		t.Fatalf("Expected only the flag set subscription, got %v", msg)
+	}
+
+	doRequest(t, router, "DELETE", "/api/projects/feed-a/flags/checkout", "", http.StatusNoContent, nil)
+	doRequest(t, router, "POST", "/api/flagsets/"+flagSet.ID+"/flags/dark-mode", flag, http.StatusCreated, nil)
+
+	msg = client.readJSON(t)
+	if msg["action"] != "flag.created" || msg["flagSet"] != flagSet.ID || msg["resourceName"] != "dark-mode" {
+		t.Fatalf("Expected flag set flag.created event only, got %v", msg)
+	}
+
+	client.send(t, map[string]interface{}{"type": "bogus"})
+	if msg = client.readJSON(t); msg["type"] != "error" {
+		t.Errorf("Expected error for unknown message type, got %v", msg)
+	}
+
+	t.Run("slow subscribers are flagged", func(t *testing.T) {
+		sub := fm.changes.Subscribe()
+		defer fm.changes.Unsubscribe(sub)
+		sub.update([]string{"*"}, nil, true)
+
+		for i := 0; i < changeFeedBufferSize; i++ {
+			fm.changes.Publish(ChangeEvent{Type: "change", Action: "flag.updated", Project: "feed-b"})
+		}
+		select {
+		case <-sub.slow:
+			t.Fatal("Expected subscriber within its buffer not to be flagged")
+		default:
+		}
+
+		fm.changes.Publish(ChangeEvent{Type: "change", Action: "flag.updated", Project: "feed-b"})
+		select {
+		case <-sub.slow:
+		default:
+			t.Error("Expected subscriber with a full buffer to be flagged as slow")
+		}
+	})
+
+	t.Run("plain HTTP requests are rejected", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/api/ws")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUpgradeRequired {
+			t.Errorf("Expected 426, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("origins", func(t *testing.T) {
+		fm.config.CORS.API = CORSPolicy{AllowedOrigins: []string{"https://flags.example.com"}}
+		defer func() { fm.config.CORS.API = CORSPolicy{} }()
+
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws"
+		for origin, status := range map[string]int{
+			"https://flags.example.com": http.StatusSwitchingProtocols,
+			server.URL:                  http.StatusSwitchingProtocols,
+			"https://evil.example":      http.StatusForbidden,
+		} {
+			conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {origin}})
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil || resp.StatusCode != status {
+				t.Errorf("Origin %s: expected %d, got %v (%v)", origin, status, resp, err)
+			}
+		}
+	})
+}
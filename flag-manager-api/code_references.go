@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+
+	"github.com/gorilla/mux"
+)
+
+// CodeReferencesStore manages code reference persistence in file mode
+type CodeReferencesStore struct {
+	filePath string
+	refs     map[string][]db.CodeReference // by project
+	mu       sync.RWMutex
+}
+
+// NewCodeReferencesStore creates a new code references store
+func NewCodeReferencesStore(configDir string) *CodeReferencesStore {
+	store := &CodeReferencesStore{
+		filePath: filepath.Join(configDir, "code-references.json"),
+		refs:     make(map[string][]db.CodeReference),
+	}
+	store.load()
+	return store
+}
+
+func (s *CodeReferencesStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.refs)
+}
+
+func (s *CodeReferencesStore) save() error {
+	data, err := json.MarshalIndent(s.refs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filePath, data, 0644)
+}
+
+// List returns the code references of a flag
+func (s *CodeReferencesStore) List(project, flagKey string) []db.CodeReference {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refs := []db.CodeReference{}
+	for _, ref := range s.refs[project] {
+		if ref.FlagKey == flagKey {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// ListProject returns the code references of a project
+func (s *CodeReferencesStore) ListProject(project string) []db.CodeReference {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]db.CodeReference{}, s.refs[project]...)
+}
+
+// Replace replaces the code references an app has in a project
+func (s *CodeReferencesStore) Replace(project, app string, refs []db.CodeReference) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := []db.CodeReference{}
+	for _, ref := range s.refs[project] {
+		if ref.App != app {
+			kept = append(kept, ref)
+		}
+	}
+	previous := s.refs[project]
+	s.refs[project] = append(kept, refs...)
+	if err := s.save(); err != nil {
+		s.refs[project] = previous
+		return err
+	}
+	return nil
+}
+
+// listCodeReferences returns the code references of a flag by app, file and
+// line.
+func (fm *FlagManager) listCodeReferences(ctx context.Context, project, flagKey string) ([]db.CodeReference, error) {
+	if fm.store != nil {
+		return fm.store.ListCodeReferences(ctx, project, flagKey)
+	}
+	if fm.codeReferences == nil {
+		return []db.CodeReference{}, nil
+	}
+	refs := fm.codeReferences.List(project, flagKey)
+	sort.SliceStable(refs, func(i, j int) bool { return codeReferenceLess(refs[i], refs[j]) })
+	return refs, nil
+}
+
+// codeReferenceLess orders code references by app, file and line.
+func codeReferenceLess(a, b db.CodeReference) bool {
+	if a.App != b.App {
+		return a.App < b.App
+	}
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// replaceCodeReferences stores the code references of an app's latest scan
+// in a project.
+func (fm *FlagManager) replaceCodeReferences(ctx context.Context, project, app string, refs []db.CodeReference) error {
+	if fm.store != nil {
+		return fm.store.ReplaceCodeReferences(ctx, project, app, refs)
+	}
+	if fm.codeReferences == nil {
+		return nil
+	}
+	return fm.codeReferences.Replace(project, app, refs)
+}
+
+// app returns the app a manifest was scanned from, which may be empty.
+func (m *ImportMetadata) app() string {
+	if m == nil {
+		return ""
+	}
+	return m.App
+}
+
+// manifestCodeReferences returns the code references in the call sites of a
+// manifest's flags, and whether the manifest has call sites at all: those of
+// older scanners do not, and leave the stored references alone.
+func manifestCodeReferences(req ImportRequest) (refs []db.CodeReference, ok bool) {
+	scannedAt := time.Now().UTC()
+	version := ""
+	if req.Metadata != nil {
+		if t, err := time.Parse(time.RFC3339, req.Metadata.GeneratedAt); err == nil {
+			scannedAt = t.UTC()
+		}
+		version = req.Metadata.Version
+	}
+
+	for _, f := range req.Flags {
+		if f.CallSites == nil {
+			continue
+		}
+		ok = true
+		if ValidateFlagKey(f.Key) != nil {
+			continue
+		}
+		for _, site := range f.CallSites {
+			typ := site.Type
+			if typ == "" {
+				typ = f.Type
+			}
+			refs = append(refs, db.CodeReference{
+				FlagKey:   f.Key,
+				App:       req.Metadata.app(),
+				File:      site.File,
+				Line:      site.Line,
+				Column:    site.Column,
+				Language:  site.Language,
+				Symbol:    site.Call,
+				Type:      typ,
+				Version:   version,
+				ScannedAt: scannedAt,
+			})
+		}
+	}
+	return refs, ok
+}
+
+// CodeReferencesResponse lists the places in code where a flag is evaluated.
+type CodeReferencesResponse struct {
+	References []db.CodeReference `json:"references"`
+}
+
+// getCodeReferencesHandler returns where a flag is evaluated in code, as of
+// the latest scans. A deleted flag may still be referenced.
+func (fm *FlagManager) getCodeReferencesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	refs, err := fm.listCodeReferences(r.Context(), vars["project"], vars["flagKey"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CodeReferencesResponse{References: refs})
+}
+
+// FlagReferencedResponse refuses to delete a flag still evaluated in code.
+type FlagReferencedResponse struct {
+	APIError
+	References []db.CodeReference `json:"references"`
+}
+
+// checkFlagUnreferenced writes a 409 listing the code references of a flag
+// that has any, and reports whether it has none.
+func (fm *FlagManager) checkFlagUnreferenced(w http.ResponseWriter, r *http.Request, project, flagKey string) bool {
+	refs, err := fm.listCodeReferences(r.Context(), project, flagKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return false
+	}
+	if len(refs) == 0 {
+		return true
+	}
+
+	message := "Flag is still referenced in code"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(FlagReferencedResponse{
+		APIError:   APIError{Code: "FLAG_REFERENCED", Message: message, Error: message},
+		References: refs,
+	})
+	return false
+}
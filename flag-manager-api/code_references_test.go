@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestCodeReferences(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			references := func(flagKey string) []db.CodeReference {
+				t.Helper()
+				var resp CodeReferencesResponse
+				doRequest(t, router, "GET", "/api/projects/shop/flags/"+flagKey+"/code-references", "", http.StatusOK, &resp)
+				return resp.References
+			}
+
+			var imported ManifestImportResponse
+			doRequest(t, router, "POST", "/api/flags/import", `{"project":"shop","metadata":{"app":"web","version":"1.0.0","generatedAt":"2026-03-01T10:00:00Z"},"flags":[
+				{"key":"checkout","type":"boolean","callSites":[
+					{"file":"src/pay.ts","line":12,"column":5,"language":"typescript","call":"getBooleanValue"},
+					{"file":"src/cart.ts","line":3,"column":9,"language":"typescript","call":"useFlag"}]},
+				{"key":"banner","type":"string","callSites":[{"file":"src/home.ts","line":1,"language":"typescript","call":"getStringValue"}]}]}`, http.StatusCreated, &imported)
+			if imported.CodeReferences != 3 {
+				t.Errorf("Expected 3 code references to be stored, got %+v", imported)
+			}
+			doRequest(t, router, "POST", "/api/flags/import", `{"project":"shop","metadata":{"app":"worker"},"flags":[
+				{"key":"checkout","type":"boolean","callSites":[{"file":"jobs/pay.py","line":7,"language":"python","call":"get_boolean_value"}]}]}`, http.StatusOK, nil)
+
+			refs := references("checkout")
+			if len(refs) != 3 || refs[0].File != "src/cart.ts" || refs[1].File != "src/pay.ts" || refs[2].App != "worker" {
+				t.Fatalf("Expected the references of both apps by app and file, got %+v", refs)
+			}
+			if refs[1].Line != 12 || refs[1].Column != 5 || refs[1].Language != "typescript" || refs[1].Symbol != "getBooleanValue" ||
+				refs[1].Version != "1.0.0" || !refs[1].ScannedAt.Equal(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)) {
+				t.Errorf("Expected the call site details, got %+v", refs[1])
+			}
+
+			// A new scan of an app replaces its references, a manifest
+			// without call sites leaves them alone
+			doRequest(t, router, "POST", "/api/flags/import", `{"project":"shop","metadata":{"app":"web"},"flags":[
+				{"key":"banner","type":"string","callSites":[{"file":"src/home.ts","line":2,"language":"typescript","call":"getStringValue"}]},
+				{"key":"checkout","type":"boolean","callSites":[]}]}`, http.StatusOK, nil)
+			doRequest(t, router, "POST", "/api/flags/import", `{"project":"shop","metadata":{"app":"web"},"flags":[{"key":"banner","type":"string"}]}`, http.StatusOK, nil)
+			if refs := references("checkout"); len(refs) != 1 || refs[0].App != "worker" {
+				t.Errorf("Expected only the worker reference to checkout, got %+v", refs)
+			}
+			if refs := references("banner"); len(refs) != 1 || refs[0].Line != 2 {
+				t.Errorf("Expected the rescanned banner reference, got %+v", refs)
+			}
+			if refs := references("unknown"); len(refs) != 0 {
+				t.Errorf("Expected no references, got %+v", refs)
+			}
+
+			var referenced FlagReferencedResponse
+			doRequest(t, router, "DELETE", "/api/projects/shop/flags/checkout?ifUnreferenced=true", "", http.StatusConflict, &referenced)
+			if referenced.Code != "FLAG_REFERENCED" || len(referenced.References) != 1 {
+				t.Errorf("Expected the delete to be refused with the references, got %+v", referenced)
+			}
+			doRequest(t, router, "DELETE", "/api/projects/shop/flags/checkout", "", http.StatusNoContent, nil)
+			if refs := references("checkout"); len(refs) != 1 {
+				t.Errorf("Expected a deleted flag to keep its references, got %+v", refs)
+			}
+		})
+	}
+}
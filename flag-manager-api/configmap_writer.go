@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	defaultConfigMapKey          = "flags.goff.yaml"
+	defaultConfigMapSyncInterval = 30 * time.Second
+
+	// configMapMaxSize is the most data Kubernetes stores in a ConfigMap.
+	configMapMaxSize = 1 << 20
+
+	// Leader election timings, as client-go's defaults: a leader that fails
+	// to renew for configMapRenewDeadline steps down before its lease of
+	// configMapLeaseDuration can be taken over.
+	configMapLeaseDuration = 15 * time.Second
+	configMapRenewDeadline = 10 * time.Second
+	configMapRetryPeriod   = 2 * time.Second
+)
+
+// ConfigMapTarget is the ConfigMap key the merged flags are written to, for
+// relay proxies using the configmap retriever.
+type ConfigMapTarget struct {
+	Namespace string
+	Name      string
+	Key       string
+	// Lease names the coordination.k8s.io Lease electing the replica that
+	// writes the ConfigMap.
+	Lease        string
+	SyncInterval time.Duration // how often the leader rewrites changed flags
+}
+
+// parseConfigMapTarget reads the CONFIGMAP_* settings. An empty name
+// disables the ConfigMap writer; the namespace defaults to the pod's.
+func parseConfigMapTarget(getenv func(string) string) (*ConfigMapTarget, error) {
+	name := strings.TrimSpace(getenv("CONFIGMAP_NAME"))
+	if name == "" {
+		return nil, nil
+	}
+
+	target := &ConfigMapTarget{
+		Namespace:    getenv("CONFIGMAP_NAMESPACE"),
+		Name:         name,
+		Key:          getenv("CONFIGMAP_KEY"),
+		Lease:        getenv("CONFIGMAP_LEASE_NAME"),
+		SyncInterval: defaultConfigMapSyncInterval,
+	}
+	if target.Namespace == "" {
+		target.Namespace = inClusterNamespace()
+	}
+	if target.Namespace == "" {
+		return nil, errors.New("CONFIGMAP_NAMESPACE is required outside a pod")
+	}
+	if target.Key == "" {
+		target.Key = defaultConfigMapKey
+	}
+	if target.Lease == "" {
+		target.Lease = name + "-writer"
+	}
+	if value := getenv("CONFIGMAP_SYNC_INTERVAL"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid CONFIGMAP_SYNC_INTERVAL %q: must be a duration of at least 1s", value)
+		}
+		target.SyncInterval = d
+	}
+	return target, nil
+}
+
+// podIdentity names this replica in the leader election lease.
+func podIdentity() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return fmt.Sprintf("goff-manager-%d", os.Getpid())
+}
+
+// ConfigMapWriter writes the merged flags YAML into a ConfigMap. Replicas
+// elect a leader with a Lease and only the leader writes: it writes after
+// its own changes, and every sync interval after those of other replicas.
+type ConfigMapWriter struct {
+	client   kubernetes.Interface
+	target   ConfigMapTarget
+	identity string
+	render   func(ctx context.Context) ([]byte, error)
+
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+
+	mu      sync.Mutex
+	leader  bool
+	written string // data last written while leader
+	queue   relayRefreshQueue
+}
+
+// NewConfigMapWriter creates a writer of the flags render returns.
+func NewConfigMapWriter(client kubernetes.Interface, target ConfigMapTarget, identity string, render func(ctx context.Context) ([]byte, error)) *ConfigMapWriter {
+	return &ConfigMapWriter{
+		client:        client,
+		target:        target,
+		identity:      identity,
+		render:        render,
+		leaseDuration: configMapLeaseDuration,
+		renewDeadline: configMapRenewDeadline,
+		retryPeriod:   configMapRetryPeriod,
+	}
+}
+
+// IsLeader reports whether this replica writes the ConfigMap.
+func (w *ConfigMapWriter) IsLeader() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.leader
+}
+
+// schedule writes the flags after a change, coalescing the changes made
+// within window. Followers leave it to the leader's next sync.
+func (w *ConfigMapWriter) schedule(ctx context.Context, window time.Duration) {
+	if w == nil || !w.IsLeader() {
+		return
+	}
+	w.queue.schedule(ctx, window, w.sync)
+}
+
+// sync writes the flags if they changed since the last write.
+func (w *ConfigMapWriter) sync(ctx context.Context) error {
+	if !w.IsLeader() {
+		return nil
+	}
+	if err := w.write(ctx); err != nil {
+		configMapWritesTotal.Add(1, "result", "failure")
+		slog.WarnContext(ctx, "Writing flags ConfigMap failed", "namespace", w.target.Namespace, "name", w.target.Name, "error", err)
+		return err
+	}
+	return nil
+}
+
+func (w *ConfigMapWriter) write(ctx context.Context) error {
+	data, err := w.render(ctx)
+	if err != nil {
+		return err
+	}
+	if len(data) > configMapMaxSize {
+		return fmt.Errorf("flags are %d bytes, more than a ConfigMap holds", len(data))
+	}
+
+	w.mu.Lock()
+	unchanged := w.written == string(data)
+	w.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	t := w.target
+	if err := applyConfigMapKey(ctx, w.client, t.Namespace, t.Name, t.Key, string(data)); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.written = string(data)
+	w.mu.Unlock()
+	configMapWritesTotal.Add(1, "result", "success")
+	return nil
+}
+
+// setLeader records whether this replica leads.
+func (w *ConfigMapWriter) setLeader(ctx context.Context, leader bool) {
+	w.mu.Lock()
+	changed := w.leader != leader
+	w.leader = leader
+	if leader {
+		// The ConfigMap may have been written by the previous leader
+		w.written = ""
+	}
+	w.mu.Unlock()
+
+	if changed {
+		configMapLeadershipChanges.Add(1)
+		slog.InfoContext(ctx, "ConfigMap writer leadership changed", "lease", w.target.Lease, "identity", w.identity, "leader", leader)
+	}
+}
+
+// lead syncs the flags every sync interval while this replica leads, until
+// ctx is done.
+func (w *ConfigMapWriter) lead(ctx context.Context) {
+	w.setLeader(ctx, true)
+	ticker := time.NewTicker(w.target.SyncInterval)
+	defer ticker.Stop()
+	for {
+		w.sync(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run takes part in the leader election until ctx is done, standing again
+// after losing the lease. The lease is released on the way out, so another
+// replica takes over without waiting for it to expire.
+func (w *ConfigMapWriter) run(ctx context.Context) {
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Namespace: w.target.Namespace, Name: w.target.Lease},
+			Client:     w.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: w.identity},
+		},
+		LeaseDuration:   w.leaseDuration,
+		RenewDeadline:   w.renewDeadline,
+		RetryPeriod:     w.retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            w.target.Lease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: w.lead,
+			OnStoppedLeading: func() { w.setLeader(ctx, false) },
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "ConfigMap writer leader election failed", "lease", w.target.Lease, "error", err)
+		return
+	}
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+}
+
+// renderFlagsConfigMap returns the merged flags YAML, as served by
+// /api/flags/raw.
+func (fm *FlagManager) renderFlagsConfigMap(ctx context.Context) ([]byte, error) {
+	return fm.encodeRelayFlags("yaml", fm.eachServedFlag(ctx), "")
+}
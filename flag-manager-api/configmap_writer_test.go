@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapWriter(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	client := kubefake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "flags", Name: "goff-flags"},
+		Data:       map[string]string{"other.yaml": "kept"},
+	})
+
+	target, err := parseConfigMapTarget(func(key string) string {
+		return map[string]string{"CONFIGMAP_NAME": "goff-flags", "CONFIGMAP_NAMESPACE": "flags"}[key]
+	})
+	if err != nil || target.Key != defaultConfigMapKey || target.Lease != "goff-flags-writer" || target.SyncInterval != defaultConfigMapSyncInterval {
+		t.Fatalf("Expected the default key, lease and interval, got %+v, %v", target, err)
+	}
+	if _, err := parseConfigMapTarget(func(key string) string {
+		return map[string]string{"CONFIGMAP_NAME": "goff-flags", "CONFIGMAP_NAMESPACE": "flags", "CONFIGMAP_SYNC_INTERVAL": "soon"}[key]
+	}); err == nil {
+		t.Error("Expected an invalid sync interval to be rejected")
+	}
+
+	newWriter := func(identity string, render func(context.Context) ([]byte, error)) *ConfigMapWriter {
+		w := NewConfigMapWriter(client, *target, identity, render)
+		w.leaseDuration, w.renewDeadline, w.retryPeriod = time.Second, 500*time.Millisecond, 20*time.Millisecond
+		return w
+	}
+	writerA := newWriter("manager-a", fm.renderFlagsConfigMap)
+	writerB := newWriter("manager-b", func(context.Context) ([]byte, error) { return []byte("b: {}\n"), nil })
+	fm.configMap = writerA
+
+	doRequest(t, router, "POST", "/api/projects/shop", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/shop/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+	configMapData := func() (map[string]string, int) {
+		cm, err := client.CoreV1().ConfigMaps("flags").Get(context.Background(), "goff-flags", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Failed to get the ConfigMap: %v", err)
+		}
+		applies := 0
+		for _, action := range client.Actions() {
+			if action.Matches("patch", "configmaps") {
+				applies++
+			}
+		}
+		return cm.Data, applies
+	}
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// The first replica becomes the leader and writes the flags
+	ctxA, stopA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() { defer close(doneA); writerA.run(ctxA) }()
+	defer func() { stopA(); <-doneA }()
+	waitFor("manager-a to lead", writerA.IsLeader)
+	ctxB, stopB := context.WithCancel(context.Background())
+	doneB := make(chan struct{})
+	go func() { defer close(doneB); writerB.run(ctxB) }()
+	defer func() { stopB(); <-doneB }()
+
+	waitFor("the first write", func() bool { data, _ := configMapData(); return data[defaultConfigMapKey] != "" })
+	data, applies := configMapData()
+	if applies != 1 || !strings.Contains(data[defaultConfigMapKey], "checkout:") || data["other.yaml"] != "kept" {
+		t.Fatalf("Expected the leader to write the flags next to the other keys, got %d applies: %v", applies, data)
+	}
+	time.Sleep(5 * writerB.retryPeriod)
+	if writerB.IsLeader() {
+		t.Fatal("Expected manager-b to follow")
+	}
+
+	// Changes are written by the leader
+	doRequest(t, router, "POST", "/api/projects/shop/flags/banner", `{"variations":{"a":"x","b":"y"},"defaultRule":{"variation":"a"}}`, http.StatusCreated, nil)
+	waitFor("the ConfigMap write", func() bool { data, _ := configMapData(); return strings.Contains(data[defaultConfigMapKey], "banner:") })
+	if err := writerA.sync(context.Background()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if _, applies := configMapData(); applies != 2 {
+		t.Errorf("Expected unchanged flags not to be rewritten, got %d applies", applies)
+	}
+
+	// Followers never write
+	if err := writerB.sync(context.Background()); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if data, _ := configMapData(); strings.HasPrefix(data[defaultConfigMapKey], "b:") {
+		t.Error("Expected a follower not to write the ConfigMap")
+	}
+
+	// When the leader stops, it releases the lease and another replica takes
+	// over
+	stopA()
+	<-doneA
+	waitFor("manager-b to take over", writerB.IsLeader)
+	if writerA.IsLeader() {
+		t.Error("Expected manager-a to step down")
+	}
+	waitFor("the new leader's write", func() bool { data, _ := configMapData(); return data[defaultConfigMapKey] == "b: {}\n" })
+	lease, err := client.CoordinationV1().Leases("flags").Get(context.Background(), "goff-flags-writer", metav1.GetOptions{})
+	if err != nil || *lease.Spec.HolderIdentity != "manager-b" || *lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("Expected the lease to change holder, got %+v, %v", lease, err)
+	}
+}
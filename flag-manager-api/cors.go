@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCORSAllowedMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	defaultCORSAllowedHeaders = "Content-Type, Authorization, X-API-Key, X-Request-ID"
+	defaultCORSExposedHeaders = "X-Request-ID, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After"
+	defaultCORSMaxAge         = 24 * time.Hour
+
+	// The public flags endpoints are fetched by browser SDKs, conditionally
+	// and with the signature of the file
+	publicCORSAllowedHeaders = "Accept, If-None-Match, If-Modified-Since, X-API-Key, X-Request-ID"
+	publicCORSExposedHeaders = "ETag, Last-Modified, X-Request-ID, X-Flags-SHA256, X-Flags-Signature, X-Flags-Signature-Algorithm, X-Flags-Signature-Key-Id"
+)
+
+// CORSPolicy is the cross-origin access allowed to a group of routes.
+// AllowedOrigins are exact origins, "*" for any, or patterns with a
+// wildcard subdomain, as in https://*.example.com.
+type CORSPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   string
+	AllowedHeaders   string
+	ExposedHeaders   string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORSConfig holds the CORS policy of the management API and the one of the
+// public flags endpoints, which relay proxies and browser SDKs fetch from
+// anywhere by default.
+type CORSConfig struct {
+	API    CORSPolicy
+	Public CORSPolicy
+}
+
+// parseCORSConfig reads the CORS_* settings. CORS_ALLOWED_ORIGINS (or
+// ALLOWED_ORIGINS, its former name), CORS_ALLOWED_METHODS,
+// CORS_ALLOWED_HEADERS, CORS_EXPOSED_HEADERS, CORS_ALLOW_CREDENTIALS and
+// CORS_MAX_AGE set the API policy; CORS_PUBLIC_ALLOWED_ORIGINS the origins
+// allowed to read the public flags endpoints, without credentials.
+func parseCORSConfig(getenv func(string) string) (CORSConfig, error) {
+	orEnv := func(name, def string) string {
+		if value := getenv(name); value != "" {
+			return value
+		}
+		return def
+	}
+
+	maxAge := defaultCORSMaxAge
+	if value := getenv("CORS_MAX_AGE"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return CORSConfig{}, fmt.Errorf("invalid CORS_MAX_AGE %q", value)
+		}
+		maxAge = d
+	}
+
+	api := CORSPolicy{
+		AllowedOrigins:   splitList(orEnv("CORS_ALLOWED_ORIGINS", orEnv("ALLOWED_ORIGINS", "*"))),
+		AllowedMethods:   orEnv("CORS_ALLOWED_METHODS", defaultCORSAllowedMethods),
+		AllowedHeaders:   orEnv("CORS_ALLOWED_HEADERS", defaultCORSAllowedHeaders),
+		ExposedHeaders:   orEnv("CORS_EXPOSED_HEADERS", defaultCORSExposedHeaders),
+		AllowCredentials: getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		MaxAge:           maxAge,
+	}
+	public := CORSPolicy{
+		AllowedOrigins: splitList(orEnv("CORS_PUBLIC_ALLOWED_ORIGINS", "*")),
+		AllowedMethods: "GET, HEAD, OPTIONS",
+		AllowedHeaders: publicCORSAllowedHeaders,
+		ExposedHeaders: publicCORSExposedHeaders,
+		MaxAge:         maxAge,
+	}
+
+	for name, origins := range map[string][]string{"CORS_ALLOWED_ORIGINS": api.AllowedOrigins, "CORS_PUBLIC_ALLOWED_ORIGINS": public.AllowedOrigins} {
+		for _, origin := range origins {
+			if origin != "*" && !strings.Contains(origin, "://") {
+				return CORSConfig{}, fmt.Errorf("%s: origin %q must include the scheme, as in https://app.example.com", name, origin)
+			}
+		}
+	}
+	if api.AllowCredentials && allowsAnyOrigin(api.AllowedOrigins) {
+		return CORSConfig{}, errors.New("CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS to list origins rather than *")
+	}
+	return CORSConfig{API: api, Public: public}, nil
+}
+
+// splitList splits a comma-separated setting, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func allowsAnyOrigin(origins []string) bool {
+	for _, o := range origins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" if the policy does not allow it.
+func (p CORSPolicy) allowedOrigin(origin string) string {
+	if allowsAnyOrigin(p.AllowedOrigins) && !p.AllowCredentials {
+		return "*"
+	}
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) || matchOriginPattern(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// matchOriginPattern matches origin against a pattern such as
+// https://*.example.com, which allows any subdomain but not the domain itself.
+func matchOriginPattern(pattern, origin string) bool {
+	scheme, host, ok := strings.Cut(pattern, "://*.")
+	if !ok {
+		return false
+	}
+	prefix := scheme + "://"
+	if len(origin) <= len(prefix) || !strings.EqualFold(origin[:len(prefix)], prefix) {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(origin[len(prefix):]), "."+strings.ToLower(host))
+}
+
+// isPublicFlagsPath reports whether path is served under the public CORS
+// policy: the raw flags endpoints and the signing key verifying them.
+func isPublicFlagsPath(path string) bool {
+	switch {
+	case path == "/api/flags/raw" || path == "/api/flags/signing-key":
+		return true
+	case strings.HasPrefix(path, "/api/flags/raw/"):
+		return !strings.Contains(strings.TrimPrefix(path, "/api/flags/raw/"), "/")
+	case strings.HasPrefix(path, "/api/flagsets/") && strings.HasSuffix(path, "/flags/raw"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/api/flagsets/"), "/flags/raw")
+		return id != "" && !strings.Contains(id, "/")
+	}
+	return false
+}
+
+// CORSMiddleware applies the public policy to the public flags endpoints and
+// the API policy to the others, and answers preflight requests.
+func CORSMiddleware(config CORSConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := config.API
+			if isPublicFlagsPath(r.URL.Path) {
+				policy = config.Public
+			}
+
+			h := w.Header()
+			allowed := policy.allowedOrigin(r.Header.Get("Origin"))
+			if allowed != "*" {
+				h.Add("Vary", "Origin")
+			}
+			if allowed != "" {
+				h.Set("Access-Control-Allow-Origin", allowed)
+				if policy.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+				if policy.ExposedHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", policy.ExposedHeaders)
+				}
+			}
+
+			if r.Method == "OPTIONS" {
+				if allowed != "" {
+					h.Set("Access-Control-Allow-Methods", policy.AllowedMethods)
+					h.Set("Access-Control-Allow-Headers", policy.AllowedHeaders)
+					h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+				}
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORSPolicies(t *testing.T) {
+	parse := func(env map[string]string) (CORSConfig, error) {
+		return parseCORSConfig(func(name string) string { return env[name] })
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	request := func(config CORSConfig, method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		rr := httptest.NewRecorder()
+		CORSMiddleware(config)(next).ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Any origin by default, as before
+	config, err := parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := request(config, "GET", "/api/projects", "https://evil.example")
+	if rr.Header().Get("Access-Control-Allow-Origin") != "*" || rr.Header().Get("Access-Control-Allow-Credentials") != "" || rr.Code != http.StatusTeapot {
+		t.Errorf("Expected any origin without credentials, got %v", rr.Header())
+	}
+
+	config, err = parse(map[string]string{
+		"CORS_ALLOWED_ORIGINS":        "https://flags.example.com, https://*.corp.example",
+		"CORS_ALLOW_CREDENTIALS":      "true",
+		"CORS_ALLOWED_HEADERS":        "Content-Type, Authorization",
+		"CORS_MAX_AGE":                "10m",
+		"CORS_PUBLIC_ALLOWED_ORIGINS": "*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		method, path, origin string
+		allowed              string
+		credentials          bool
+	}{
+		{"GET", "/api/projects", "https://flags.example.com", "https://flags.example.com", true},
+		{"GET", "/api/projects", "https://ui.corp.example", "https://ui.corp.example", true},
+		{"GET", "/api/projects", "https://corp.example", "", false},
+		{"GET", "/api/projects", "https://evil.example", "", false},
+		{"GET", "/api/flags/raw", "https://evil.example", "*", false},
+		{"GET", "/api/flags/raw/shop", "https://evil.example", "*", false},
+		{"GET", "/api/flagsets/fs-1/flags/raw", "https://evil.example", "*", false},
+		{"GET", "/api/flagsets/fs-1/flags", "https://evil.example", "", false},
+		{"GET", "/api/flags/signing-key", "", "*", false},
+	} {
+		rr := request(config, tc.method, tc.path, tc.origin)
+		h := rr.Header()
+		if h.Get("Access-Control-Allow-Origin") != tc.allowed || (h.Get("Access-Control-Allow-Credentials") == "true") != tc.credentials {
+			t.Errorf("%s %s from %s: expected origin %q (credentials %v), got %v", tc.method, tc.path, tc.origin, tc.allowed, tc.credentials, h)
+		}
+		if tc.allowed != "*" && h.Get("Vary") != "Origin" {
+			t.Errorf("%s from %s: expected Vary: Origin, got %v", tc.path, tc.origin, h)
+		}
+	}
+
+	rr = request(config, "OPTIONS", "/api/projects/shop/flags/checkout", "https://flags.example.com")
+	if h := rr.Header(); rr.Code != http.StatusOK || h.Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" ||
+		h.Get("Access-Control-Max-Age") != "600" || h.Get("Access-Control-Allow-Methods") != defaultCORSAllowedMethods {
+		t.Errorf("Expected the API preflight, got %d %v", rr.Code, h)
+	}
+	rr = request(config, "OPTIONS", "/api/flags/raw", "https://evil.example")
+	if h := rr.Header(); h.Get("Access-Control-Allow-Methods") != "GET, HEAD, OPTIONS" || !strings.Contains(h.Get("Access-Control-Allow-Headers"), "If-None-Match") {
+		t.Errorf("Expected the public preflight, got %v", h)
+	}
+	if h := request(config, "OPTIONS", "/api/projects", "https://evil.example").Header(); h.Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("Expected no preflight grant for a disallowed origin, got %v", h)
+	}
+	if h := request(config, "GET", "/api/flags/raw", "").Header(); !strings.Contains(h.Get("Access-Control-Expose-Headers"), "ETag") {
+		t.Errorf("Expected the raw flags headers to be exposed, got %v", h)
+	}
+
+	// The former setting still applies
+	config, _ = parse(map[string]string{"ALLOWED_ORIGINS": "http://localhost:4000"})
+	if h := request(config, "GET", "/api/projects", "http://localhost:4000").Header(); h.Get("Access-Control-Allow-Origin") != "http://localhost:4000" {
+		t.Errorf("Expected ALLOWED_ORIGINS to be honored, got %v", h)
+	}
+
+	for _, env := range []map[string]string{
+		{"CORS_ALLOW_CREDENTIALS": "true"},
+		{"CORS_ALLOWED_ORIGINS": "flags.example.com"},
+		{"CORS_MAX_AGE": "soon"},
+	} {
+		if _, err := parse(env); err == nil {
+			t.Errorf("Expected %v to be rejected", env)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ActivityCount is the number of flag changes in one period, optionally for a
+// single project or actor.
+type ActivityCount struct {
+	Period  time.Time `json:"period"`
+	Group   string    `json:"group,omitempty"`
+	Created int       `json:"created"`
+	Updated int       `json:"updated"`
+	Deleted int       `json:"deleted"`
+}
+
+// ActivityParams selects the flag activity to aggregate.
+type ActivityParams struct {
+	Interval  string // day, week or month
+	Dimension string // "", project or actor
+	Since     time.Time
+	Until     time.Time
+}
+
+// flagCreateActions are the audit actions counted as flag creations; flag.deleted
+// counts as a deletion and every other flag action as an update.
+const flagCreateActions = "'flag.created', 'flag.cloned', 'flag.imported'"
+
+// FlagActivity returns counts of flag creates, updates and deletes from the
+// audit log, truncated to the given interval in UTC. Only periods with activity
+// are returned, ordered by period and group.
+func (s *Store) FlagActivity(ctx context.Context, params ActivityParams) ([]ActivityCount, error) {
+	switch params.Interval {
+	case "day", "week", "month":
+	default:
+		return nil, fmt.Errorf("invalid interval: %s", params.Interval)
+	}
+
+	group := "''"
+	switch params.Dimension {
+	case "":
+	case "project":
+		group = "COALESCE(project, '')"
+	case "actor":
+		group = "COALESCE(NULLIF(actor_email, ''), NULLIF(actor_name, ''), '')"
+	default:
+		return nil, fmt.Errorf("invalid dimension: %s", params.Dimension)
+	}
+
+	query := fmt.Sprintf(`SELECT date_trunc($1, timestamp AT TIME ZONE 'UTC') AS period, %s AS grp,
+	                 COUNT(*) FILTER (WHERE action IN (%s)),
+	                 COUNT(*) FILTER (WHERE action NOT IN (%s) AND action <> 'flag.deleted'),
+	                 COUNT(*) FILTER (WHERE action = 'flag.deleted')
+	          FROM audit_events
+	          WHERE resource_type = 'flag' AND timestamp >= $2 AND timestamp < $3
+	          GROUP BY 1, 2
+	          ORDER BY 1, 2`, group, flagCreateActions, flagCreateActions)
+
+	rows, err := s.pool.Query(ctx, query, params.Interval, params.Since, params.Until)
+	if err != nil {
+		return nil, fmt.Errorf("flag activity: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []ActivityCount
+	for rows.Next() {
+		var c ActivityCount
+		if err := rows.Scan(&c.Period, &c.Group, &c.Created, &c.Updated, &c.Deleted); err != nil {
+			return nil, err
+		}
+		c.Period = c.Period.UTC()
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
@@ -11,19 +11,41 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// APIKey represents an API key in the database.
+// APIKey represents an API key in the database. A key bound to a role acts as
+// a service account with that role's permissions, within Projects and FlagSets
+// when either is set; a key without a role has full access. ReadOnly keys may
+// only read.
 type APIKey struct {
 	ID          string     `json:"id"`
 	Name        string     `json:"name"`
 	KeyPrefix   string     `json:"keyPrefix"`
 	Permissions []string   `json:"permissions"`
+	RoleID      string     `json:"roleId,omitempty"`
+	Projects    []string   `json:"projects"`
+	FlagSets    []string   `json:"flagSets"` // flag set IDs
+	ReadOnly    bool       `json:"readOnly"`
 	CreatedAt   time.Time  `json:"createdAt"`
 	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
 	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
+	RotatedAt   *time.Time `json:"rotatedAt,omitempty"`
 }
 
-// CreateAPIKey creates a new API key and returns it with the unhashed key.
-func (s *Store) CreateAPIKey(ctx context.Context, name string, permissions []string, expiresAt *time.Time) (*APIKey, string, error) {
+// Restricted reports whether the key is limited to some projects or flag sets.
+func (k APIKey) Restricted() bool {
+	return len(k.Projects) > 0 || len(k.FlagSets) > 0
+}
+
+const apiKeyColumns = `id, name, key_prefix, permissions, role_id, projects, flag_sets, read_only,
+	created_at, expires_at, last_used_at, rotated_at`
+
+func (k *APIKey) scanDest(extra ...any) []any {
+	return append(extra, &k.ID, &k.Name, &k.KeyPrefix, &k.Permissions, &k.RoleID, &k.Projects, &k.FlagSets,
+		&k.ReadOnly, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RotatedAt)
+}
+
+// CreateAPIKey creates a new API key from the settings of key and returns it
+// with the unhashed key.
+func (s *Store) CreateAPIKey(ctx context.Context, key APIKey) (*APIKey, string, error) {
 	// Generate a random key
 	rawKey := generateAPIKey()
 	prefix := rawKey[:8]
@@ -32,25 +54,60 @@ func (s *Store) CreateAPIKey(ctx context.Context, name string, permissions []str
 	if err != nil {
 		return nil, "", fmt.Errorf("hash API key: %w", err)
 	}
+	if key.Permissions == nil {
+		key.Permissions = []string{}
+	}
+	if key.Projects == nil {
+		key.Projects = []string{}
+	}
+	if key.FlagSets == nil {
+		key.FlagSets = []string{}
+	}
 
-	var key APIKey
+	var created APIKey
 	err = s.pool.QueryRow(ctx,
-		`INSERT INTO api_keys (name, key_hash, key_prefix, permissions, expires_at)
-		 VALUES ($1, $2, $3, $4, $5)
-		 RETURNING id, name, key_prefix, permissions, created_at, expires_at, last_used_at`,
-		name, string(hash), prefix, permissions, expiresAt,
-	).Scan(&key.ID, &key.Name, &key.KeyPrefix, &key.Permissions, &key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt)
+		`INSERT INTO api_keys (name, key_hash, key_prefix, permissions, role_id, projects, flag_sets, read_only, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING `+apiKeyColumns,
+		key.Name, string(hash), prefix, key.Permissions, key.RoleID, key.Projects, key.FlagSets, key.ReadOnly, key.ExpiresAt,
+	).Scan(created.scanDest()...)
 	if err != nil {
 		return nil, "", fmt.Errorf("create API key: %w", err)
 	}
 
+	return &created, rawKey, nil
+}
+
+// RotateAPIKey replaces the secret of an API key, keeping its settings, and
+// returns the key with the new unhashed key. The previous secret stops working
+// at once.
+func (s *Store) RotateAPIKey(ctx context.Context, id string) (*APIKey, string, error) {
+	rawKey := generateAPIKey()
+	prefix := rawKey[:8]
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(rawKey), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", fmt.Errorf("hash API key: %w", err)
+	}
+
+	var key APIKey
+	err = s.pool.QueryRow(ctx,
+		`UPDATE api_keys SET key_hash = $2, key_prefix = $3, rotated_at = now()
+		 WHERE id = $1
+		 RETURNING `+apiKeyColumns,
+		id, string(hash), prefix,
+	).Scan(key.scanDest()...)
+	if err != nil {
+		return nil, "", err
+	}
+
 	return &key, rawKey, nil
 }
 
 // ListAPIKeys returns all API keys (without hashes).
 func (s *Store) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, name, key_prefix, permissions, created_at, expires_at, last_used_at
+		`SELECT `+apiKeyColumns+`
 		 FROM api_keys ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
@@ -60,7 +117,7 @@ func (s *Store) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
 	var keys []APIKey
 	for rows.Next() {
 		var k APIKey
-		if err := rows.Scan(&k.ID, &k.Name, &k.KeyPrefix, &k.Permissions, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt); err != nil {
+		if err := rows.Scan(k.scanDest()...); err != nil {
 			return nil, err
 		}
 		keys = append(keys, k)
@@ -81,7 +138,7 @@ func (s *Store) ValidateAPIKey(ctx context.Context, rawKey string) (*APIKey, err
 
 	// Find keys matching this prefix
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, name, key_hash, key_prefix, permissions, created_at, expires_at, last_used_at
+		`SELECT key_hash, `+apiKeyColumns+`
 		 FROM api_keys WHERE key_prefix = $1`,
 		prefix)
 	if err != nil {
@@ -92,7 +149,7 @@ func (s *Store) ValidateAPIKey(ctx context.Context, rawKey string) (*APIKey, err
 	for rows.Next() {
 		var k APIKey
 		var keyHash string
-		if err := rows.Scan(&k.ID, &k.Name, &keyHash, &k.KeyPrefix, &k.Permissions, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt); err != nil {
+		if err := rows.Scan(k.scanDest(&keyHash)...); err != nil {
 			return nil, err
 		}
 
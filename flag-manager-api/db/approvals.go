@@ -43,6 +43,8 @@ type ChangeRequestReview struct {
 type ChangeRequestFilterParams struct {
 	PaginationParams
 	Status string
+	From   *time.Time
+	To     *time.Time
 }
 
 // ListChangeRequests returns paginated change requests.
@@ -61,6 +63,16 @@ func (s *Store) ListChangeRequests(ctx context.Context, params ChangeRequestFilt
 		args = append(args, "%"+params.Search+"%")
 		argIdx++
 	}
+	if params.From != nil {
+		where += fmt.Sprintf(" AND created_at >= $%d", argIdx)
+		args = append(args, *params.From)
+		argIdx++
+	}
+	if params.To != nil {
+		where += fmt.Sprintf(" AND created_at <= $%d", argIdx)
+		args = append(args, *params.To)
+		argIdx++
+	}
 
 	// Count
 	var total int
@@ -104,13 +116,7 @@ func (s *Store) ListChangeRequests(ctx context.Context, params ChangeRequestFilt
 		crs = []ChangeRequest{}
 	}
 
-	return &PaginatedResult[ChangeRequest]{
-		Data:       crs,
-		Total:      total,
-		Page:       params.Page,
-		PageSize:   params.Limit(),
-		TotalPages: TotalPages(total, params.Limit()),
-	}, nil
+	return NewPaginatedResult(crs, total, params.PaginationParams), nil
 }
 
 // GetChangeRequest returns a change request by ID.
@@ -189,6 +195,32 @@ func (s *Store) UpdateChangeRequestStatus(ctx context.Context, id, status, appli
 	return nil
 }
 
+// CancelChangeRequestsBefore cancels all open (pending or approved) change
+// requests created before the given time and returns the cancelled requests.
+func (s *Store) CancelChangeRequestsBefore(ctx context.Context, before time.Time) ([]ChangeRequest, error) {
+	rows, err := s.pool.Query(ctx,
+		`UPDATE change_requests SET status = 'cancelled', updated_at = now()
+		 WHERE status IN ('pending', 'approved') AND created_at < $1
+		 RETURNING id, title, COALESCE(project, ''), COALESCE(flag_key, ''), created_at`, before)
+	if err != nil {
+		return nil, fmt.Errorf("cancel change requests: %w", err)
+	}
+	defer rows.Close()
+
+	var crs []ChangeRequest
+	for rows.Next() {
+		cr := ChangeRequest{Status: "cancelled"}
+		if err := rows.Scan(&cr.ID, &cr.Title, &cr.Project, &cr.FlagKey, &cr.CreatedAt); err != nil {
+			return nil, err
+		}
+		crs = append(crs, cr)
+	}
+	if crs == nil {
+		crs = []ChangeRequest{}
+	}
+	return crs, rows.Err()
+}
+
 // AddChangeRequestReview adds a review to a change request.
 func (s *Store) AddChangeRequestReview(ctx context.Context, review ChangeRequestReview) (*ChangeRequestReview, error) {
 	var created ChangeRequestReview
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // AuditEvent represents an audit log entry.
@@ -22,6 +24,7 @@ type AuditEvent struct {
 	Project      string          `json:"project,omitempty"`
 	Changes      json.RawMessage `json:"changes,omitempty"`
 	Metadata     json.RawMessage `json:"metadata,omitempty"`
+	RequestID    string          `json:"requestId,omitempty"`
 }
 
 // AuditFilterParams extends pagination with audit-specific filters.
@@ -36,12 +39,17 @@ type AuditFilterParams struct {
 
 // LogAudit writes an audit event to the database.
 func (s *Store) LogAudit(ctx context.Context, event AuditEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+		event.Timestamp = time.Now().UTC()
+	}
 	_, err := s.pool.Exec(ctx,
-		`INSERT INTO audit_events (actor_id, actor_email, actor_name, actor_type, action, resource_type, resource_id, resource_name, project, changes, metadata)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		`INSERT INTO audit_events (id, timestamp, actor_id, actor_email, actor_name, actor_type, action, resource_type, resource_id, resource_name, project, changes, metadata, request_id)
+		 VALUES ($13, $14, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
 		nullStr(event.ActorID), nullStr(event.ActorEmail), nullStr(event.ActorName), nullStr(event.ActorType),
 		event.Action, event.ResourceType, nullStr(event.ResourceID), nullStr(event.ResourceName),
-		nullStr(event.Project), nullableJSON(event.Changes), nullableJSON(event.Metadata),
+		nullStr(event.Project), nullableJSON(event.Changes), nullableJSON(event.Metadata), nullStr(event.RequestID),
+		event.ID, event.Timestamp,
 	)
 	return err
 }
@@ -93,7 +101,8 @@ func (s *Store) ListAuditEvents(ctx context.Context, params AuditFilterParams) (
 	// Query
 	query := `SELECT id, timestamp, COALESCE(actor_id, ''), COALESCE(actor_email, ''), COALESCE(actor_name, ''),
 	                 COALESCE(actor_type, ''), action, resource_type, COALESCE(resource_id, ''),
-	                 COALESCE(resource_name, ''), COALESCE(project, ''), changes, metadata
+	                 COALESCE(resource_name, ''), COALESCE(project, ''), changes, metadata,
+	                 COALESCE(request_id, '')
 	          FROM audit_events ` + where
 
 	sortCol := "timestamp"
@@ -119,7 +128,7 @@ func (s *Store) ListAuditEvents(ctx context.Context, params AuditFilterParams) (
 		var changes, metadata []byte
 		if err := rows.Scan(&e.ID, &e.Timestamp, &e.ActorID, &e.ActorEmail, &e.ActorName,
 			&e.ActorType, &e.Action, &e.ResourceType, &e.ResourceID,
-			&e.ResourceName, &e.Project, &changes, &metadata); err != nil {
+			&e.ResourceName, &e.Project, &changes, &metadata, &e.RequestID); err != nil {
 			return nil, err
 		}
 		e.Changes = changes
@@ -131,13 +140,7 @@ func (s *Store) ListAuditEvents(ctx context.Context, params AuditFilterParams) (
 		events = []AuditEvent{}
 	}
 
-	return &PaginatedResult[AuditEvent]{
-		Data:       events,
-		Total:      total,
-		Page:       params.Page,
-		PageSize:   params.Limit(),
-		TotalPages: TotalPages(total, params.Limit()),
-	}, nil
+	return NewPaginatedResult(events, total, params.PaginationParams), nil
 }
 
 // GetAuditEventsForResource returns audit events for a specific resource.
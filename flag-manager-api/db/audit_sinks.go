@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AuditSink is an external system audit events are streamed to: a webhook, a
+// Kafka topic through a Kafka REST proxy, or a syslog endpoint.
+type AuditSink struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Kind      string          `json:"kind"` // webhook, kafka or syslog
+	Enabled   bool            `json:"enabled"`
+	Config    AuditSinkConfig `json:"config"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// AuditSinkConfig holds the settings of an audit sink; which apply depends on
+// its kind.
+type AuditSinkConfig struct {
+	URL      string            `json:"url,omitempty"`      // webhook, or the Kafka REST proxy
+	Headers  map[string]string `json:"headers,omitempty"`  // webhook and Kafka REST proxy
+	Secret   string            `json:"secret,omitempty"`   // webhook: HMAC-SHA256 signing key
+	Topic    string            `json:"topic,omitempty"`    // kafka
+	Network  string            `json:"network,omitempty"`  // syslog: udp or tcp
+	Address  string            `json:"address,omitempty"`  // syslog: host:port
+	Facility int               `json:"facility,omitempty"` // syslog: 0-23, defaults to local0
+	AppName  string            `json:"appName,omitempty"`  // syslog
+}
+
+const auditSinkColumns = `id, name, kind, enabled, config, created_at, updated_at`
+
+func (s *Store) scanAuditSink(row pgx.Row) (*AuditSink, error) {
+	var sink AuditSink
+	var config json.RawMessage
+	if err := row.Scan(&sink.ID, &sink.Name, &sink.Kind, &sink.Enabled, &config, &sink.CreatedAt, &sink.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := s.openConfig(&config, AuditSinkSecretFields); err != nil {
+		return nil, fmt.Errorf("audit sink %s: %w", sink.Name, err)
+	}
+	if err := json.Unmarshal(config, &sink.Config); err != nil {
+		return nil, fmt.Errorf("parse config of audit sink %s: %w", sink.Name, err)
+	}
+	return &sink, nil
+}
+
+// ListAuditSinks returns all audit sinks ordered by name.
+func (s *Store) ListAuditSinks(ctx context.Context) ([]AuditSink, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+auditSinkColumns+" FROM audit_sinks ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list audit sinks: %w", err)
+	}
+	defer rows.Close()
+
+	sinks := []AuditSink{}
+	for rows.Next() {
+		sink, err := s.scanAuditSink(rows)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, *sink)
+	}
+	return sinks, rows.Err()
+}
+
+// GetAuditSink returns an audit sink, or pgx.ErrNoRows.
+func (s *Store) GetAuditSink(ctx context.Context, id string) (*AuditSink, error) {
+	return s.scanAuditSink(s.pool.QueryRow(ctx, "SELECT "+auditSinkColumns+" FROM audit_sinks WHERE id = $1", id))
+}
+
+// CreateAuditSink stores an audit sink and returns it with its ID and
+// timestamps.
+func (s *Store) CreateAuditSink(ctx context.Context, sink AuditSink) (*AuditSink, error) {
+	config, err := json.Marshal(sink.Config)
+	if err != nil {
+		return nil, err
+	}
+	if config, err = s.sealConfig(config, AuditSinkSecretFields); err != nil {
+		return nil, err
+	}
+	created, err := s.scanAuditSink(s.pool.QueryRow(ctx,
+		`INSERT INTO audit_sinks (name, kind, enabled, config)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+auditSinkColumns,
+		sink.Name, sink.Kind, sink.Enabled, config,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create audit sink: %w", err)
+	}
+	return created, nil
+}
+
+// UpdateAuditSink replaces an audit sink, or returns pgx.ErrNoRows.
+func (s *Store) UpdateAuditSink(ctx context.Context, id string, sink AuditSink) (*AuditSink, error) {
+	config, err := json.Marshal(sink.Config)
+	if err != nil {
+		return nil, err
+	}
+	if config, err = s.sealConfig(config, AuditSinkSecretFields); err != nil {
+		return nil, err
+	}
+	updated, err := s.scanAuditSink(s.pool.QueryRow(ctx,
+		`UPDATE audit_sinks SET name = $1, kind = $2, enabled = $3, config = $4, updated_at = now()
+		 WHERE id = $5
+		 RETURNING `+auditSinkColumns,
+		sink.Name, sink.Kind, sink.Enabled, config, id,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update audit sink: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteAuditSink deletes an audit sink, or returns pgx.ErrNoRows.
+func (s *Store) DeleteAuditSink(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM audit_sinks WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete audit sink: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CodeReference is a place in an application's code where a flag is
+// evaluated, as found by goff-scan.
+type CodeReference struct {
+	FlagKey   string    `json:"flagKey"`
+	App       string    `json:"app,omitempty"`
+	File      string    `json:"file"`
+	Line      int       `json:"line"`
+	Column    int       `json:"column,omitempty"`
+	Language  string    `json:"language,omitempty"`
+	Symbol    string    `json:"symbol,omitempty"` // the SDK call, e.g. getBooleanValue
+	Type      string    `json:"type,omitempty"`   // the type the call evaluates the flag as
+	Version   string    `json:"version,omitempty"`
+	ScannedAt time.Time `json:"scannedAt"`
+}
+
+const codeReferenceColumns = `flag_key, app, file, line, col, language, symbol, flag_type, version, scanned_at`
+
+func (s *Store) queryCodeReferences(ctx context.Context, query string, args ...interface{}) ([]CodeReference, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list code references: %w", err)
+	}
+	defer rows.Close()
+
+	refs := []CodeReference{}
+	for rows.Next() {
+		var ref CodeReference
+		if err := rows.Scan(&ref.FlagKey, &ref.App, &ref.File, &ref.Line, &ref.Column, &ref.Language, &ref.Symbol,
+			&ref.Type, &ref.Version, &ref.ScannedAt); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
+
+// ListCodeReferences returns the code references of a flag by app, file and
+// line.
+func (s *Store) ListCodeReferences(ctx context.Context, project, flagKey string) ([]CodeReference, error) {
+	return s.queryCodeReferences(ctx,
+		"SELECT "+codeReferenceColumns+" FROM code_references WHERE project = $1 AND flag_key = $2 ORDER BY app, file, line, col",
+		project, flagKey)
+}
+
+// ListProjectCodeReferences returns the code references of a project by
+// flag, app, file and line.
+func (s *Store) ListProjectCodeReferences(ctx context.Context, project string) ([]CodeReference, error) {
+	return s.queryCodeReferences(ctx,
+		"SELECT "+codeReferenceColumns+" FROM code_references WHERE project = $1 ORDER BY flag_key, app, file, line, col",
+		project)
+}
+
+// ReplaceCodeReferences replaces the code references an app has in a project
+// with those of its latest scan.
+func (s *Store) ReplaceCodeReferences(ctx context.Context, project, app string, refs []CodeReference) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM code_references WHERE project = $1 AND app = $2", project, app); err != nil {
+		return fmt.Errorf("replace code references: %w", err)
+	}
+	for _, ref := range refs {
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO code_references (project, flag_key, app, file, line, col, language, symbol, flag_type, version, scanned_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			project, ref.FlagKey, app, ref.File, ref.Line, ref.Column, ref.Language, ref.Symbol, ref.Type, ref.Version, ref.ScannedAt,
+		); err != nil {
+			return fmt.Errorf("replace code references: %w", err)
+		}
+	}
+	return tx.Commit(ctx)
+}
@@ -74,6 +74,9 @@ func (s *Store) ListIntegrations(ctx context.Context) ([]DBIntegration, error) {
 		if err := rows.Scan(&item.ID, &item.Name, &item.Provider, &item.Description, &item.IsDefault, &item.Config, &item.CreatedAt, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if err := s.openConfig(&item.Config, IntegrationSecretFields); err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
 	if items == nil {
@@ -91,10 +94,18 @@ func (s *Store) GetIntegration(ctx context.Context, id string) (*DBIntegration,
 	if err != nil {
 		return nil, err
 	}
+	if err := s.openConfig(&item.Config, IntegrationSecretFields); err != nil {
+		return nil, err
+	}
 	return &item, nil
 }
 
 func (s *Store) CreateIntegration(ctx context.Context, item DBIntegration) (*DBIntegration, error) {
+	config, err := s.sealConfig(item.Config, IntegrationSecretFields)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return nil, err
@@ -112,16 +123,24 @@ func (s *Store) CreateIntegration(ctx context.Context, item DBIntegration) (*DBI
 		`INSERT INTO integrations (id, name, provider, description, is_default, config)
 		 VALUES ($1, $2, $3, $4, $5, $6)
 		 RETURNING id, name, provider, COALESCE(description, ''), is_default, config, created_at, updated_at`,
-		item.ID, item.Name, item.Provider, item.Description, item.IsDefault, item.Config,
+		item.ID, item.Name, item.Provider, item.Description, item.IsDefault, config,
 	).Scan(&created.ID, &created.Name, &created.Provider, &created.Description, &created.IsDefault, &created.Config, &created.CreatedAt, &created.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("create integration: %w", err)
 	}
 
+	if err := s.openConfig(&created.Config, IntegrationSecretFields); err != nil {
+		return nil, err
+	}
 	return &created, tx.Commit(ctx)
 }
 
 func (s *Store) UpdateIntegration(ctx context.Context, id string, item DBIntegration) (*DBIntegration, error) {
+	config, err := s.sealConfig(item.Config, IntegrationSecretFields)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return nil, err
@@ -139,12 +158,15 @@ func (s *Store) UpdateIntegration(ctx context.Context, id string, item DBIntegra
 		`UPDATE integrations SET name = $1, provider = $2, description = $3, is_default = $4, config = $5, updated_at = now()
 		 WHERE id = $6
 		 RETURNING id, name, provider, COALESCE(description, ''), is_default, config, created_at, updated_at`,
-		item.Name, item.Provider, item.Description, item.IsDefault, item.Config, id,
+		item.Name, item.Provider, item.Description, item.IsDefault, config, id,
 	).Scan(&updated.ID, &updated.Name, &updated.Provider, &updated.Description, &updated.IsDefault, &updated.Config, &updated.CreatedAt, &updated.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("update integration: %w", err)
 	}
 
+	if err := s.openConfig(&updated.Config, IntegrationSecretFields); err != nil {
+		return nil, err
+	}
 	return &updated, tx.Commit(ctx)
 }
 
@@ -169,6 +191,9 @@ func (s *Store) GetDefaultIntegration(ctx context.Context) (*DBIntegration, erro
 	if err != nil {
 		return nil, err
 	}
+	if err := s.openConfig(&item.Config, IntegrationSecretFields); err != nil {
+		return nil, err
+	}
 	return &item, nil
 }
 
@@ -189,6 +214,9 @@ func (s *Store) ListNotifiers(ctx context.Context) ([]DBNotifier, error) {
 		if err := rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Description, &item.Enabled, &item.Config, &item.CreatedAt, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if err := s.openConfig(&item.Config, NotifierSecretFields); err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
 	if items == nil {
@@ -206,34 +234,53 @@ func (s *Store) GetNotifier(ctx context.Context, id string) (*DBNotifier, error)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.openConfig(&item.Config, NotifierSecretFields); err != nil {
+		return nil, err
+	}
 	return &item, nil
 }
 
 func (s *Store) CreateNotifier(ctx context.Context, item DBNotifier) (*DBNotifier, error) {
+	config, err := s.sealConfig(item.Config, NotifierSecretFields)
+	if err != nil {
+		return nil, err
+	}
+
 	var created DBNotifier
-	err := s.pool.QueryRow(ctx,
+	err = s.pool.QueryRow(ctx,
 		`INSERT INTO notifiers (id, name, kind, description, enabled, config)
 		 VALUES ($1, $2, $3, $4, $5, $6)
 		 RETURNING id, name, kind, COALESCE(description, ''), enabled, config, created_at, updated_at`,
-		item.ID, item.Name, item.Kind, item.Description, item.Enabled, item.Config,
+		item.ID, item.Name, item.Kind, item.Description, item.Enabled, config,
 	).Scan(&created.ID, &created.Name, &created.Kind, &created.Description, &created.Enabled, &created.Config, &created.CreatedAt, &created.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("create notifier: %w", err)
 	}
+	if err := s.openConfig(&created.Config, NotifierSecretFields); err != nil {
+		return nil, err
+	}
 	return &created, nil
 }
 
 func (s *Store) UpdateNotifier(ctx context.Context, id string, item DBNotifier) (*DBNotifier, error) {
+	config, err := s.sealConfig(item.Config, NotifierSecretFields)
+	if err != nil {
+		return nil, err
+	}
+
 	var updated DBNotifier
-	err := s.pool.QueryRow(ctx,
+	err = s.pool.QueryRow(ctx,
 		`UPDATE notifiers SET name = $1, kind = $2, description = $3, enabled = $4, config = $5, updated_at = now()
 		 WHERE id = $6
 		 RETURNING id, name, kind, COALESCE(description, ''), enabled, config, created_at, updated_at`,
-		item.Name, item.Kind, item.Description, item.Enabled, item.Config, id,
+		item.Name, item.Kind, item.Description, item.Enabled, config, id,
 	).Scan(&updated.ID, &updated.Name, &updated.Kind, &updated.Description, &updated.Enabled, &updated.Config, &updated.CreatedAt, &updated.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("update notifier: %w", err)
 	}
+	if err := s.openConfig(&updated.Config, NotifierSecretFields); err != nil {
+		return nil, err
+	}
 	return &updated, nil
 }
 
@@ -257,6 +304,9 @@ func (s *Store) GetEnabledNotifiers(ctx context.Context) ([]DBNotifier, error) {
 		if err := rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Description, &item.Enabled, &item.Config, &item.CreatedAt, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if err := s.openConfig(&item.Config, NotifierSecretFields); err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
 	return items, nil
@@ -279,6 +329,9 @@ func (s *Store) ListExporters(ctx context.Context) ([]DBExporter, error) {
 		if err := rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Description, &item.Enabled, &item.Config, &item.CreatedAt, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if err := s.openConfig(&item.Config, ExporterSecretFields); err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
 	if items == nil {
@@ -296,34 +349,53 @@ func (s *Store) GetExporter(ctx context.Context, id string) (*DBExporter, error)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.openConfig(&item.Config, ExporterSecretFields); err != nil {
+		return nil, err
+	}
 	return &item, nil
 }
 
 func (s *Store) CreateExporter(ctx context.Context, item DBExporter) (*DBExporter, error) {
+	config, err := s.sealConfig(item.Config, ExporterSecretFields)
+	if err != nil {
+		return nil, err
+	}
+
 	var created DBExporter
-	err := s.pool.QueryRow(ctx,
+	err = s.pool.QueryRow(ctx,
 		`INSERT INTO exporters (id, name, kind, description, enabled, config)
 		 VALUES ($1, $2, $3, $4, $5, $6)
 		 RETURNING id, name, kind, COALESCE(description, ''), enabled, config, created_at, updated_at`,
-		item.ID, item.Name, item.Kind, item.Description, item.Enabled, item.Config,
+		item.ID, item.Name, item.Kind, item.Description, item.Enabled, config,
 	).Scan(&created.ID, &created.Name, &created.Kind, &created.Description, &created.Enabled, &created.Config, &created.CreatedAt, &created.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("create exporter: %w", err)
 	}
+	if err := s.openConfig(&created.Config, ExporterSecretFields); err != nil {
+		return nil, err
+	}
 	return &created, nil
 }
 
 func (s *Store) UpdateExporter(ctx context.Context, id string, item DBExporter) (*DBExporter, error) {
+	config, err := s.sealConfig(item.Config, ExporterSecretFields)
+	if err != nil {
+		return nil, err
+	}
+
 	var updated DBExporter
-	err := s.pool.QueryRow(ctx,
+	err = s.pool.QueryRow(ctx,
 		`UPDATE exporters SET name = $1, kind = $2, description = $3, enabled = $4, config = $5, updated_at = now()
 		 WHERE id = $6
 		 RETURNING id, name, kind, COALESCE(description, ''), enabled, config, created_at, updated_at`,
-		item.Name, item.Kind, item.Description, item.Enabled, item.Config, id,
+		item.Name, item.Kind, item.Description, item.Enabled, config, id,
 	).Scan(&updated.ID, &updated.Name, &updated.Kind, &updated.Description, &updated.Enabled, &updated.Config, &updated.CreatedAt, &updated.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("update exporter: %w", err)
 	}
+	if err := s.openConfig(&updated.Config, ExporterSecretFields); err != nil {
+		return nil, err
+	}
 	return &updated, nil
 }
 
@@ -347,6 +419,9 @@ func (s *Store) GetEnabledExporters(ctx context.Context) ([]DBExporter, error) {
 		if err := rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Description, &item.Enabled, &item.Config, &item.CreatedAt, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if err := s.openConfig(&item.Config, ExporterSecretFields); err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
 	return items, nil
@@ -369,6 +444,9 @@ func (s *Store) ListRetrievers(ctx context.Context) ([]DBRetriever, error) {
 		if err := rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Description, &item.Enabled, &item.Config, &item.CreatedAt, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if err := s.openConfig(&item.Config, RetrieverSecretFields); err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
 	if items == nil {
@@ -386,34 +464,53 @@ func (s *Store) GetRetriever(ctx context.Context, id string) (*DBRetriever, erro
 	if err != nil {
 		return nil, err
 	}
+	if err := s.openConfig(&item.Config, RetrieverSecretFields); err != nil {
+		return nil, err
+	}
 	return &item, nil
 }
 
 func (s *Store) CreateRetriever(ctx context.Context, item DBRetriever) (*DBRetriever, error) {
+	config, err := s.sealConfig(item.Config, RetrieverSecretFields)
+	if err != nil {
+		return nil, err
+	}
+
 	var created DBRetriever
-	err := s.pool.QueryRow(ctx,
+	err = s.pool.QueryRow(ctx,
 		`INSERT INTO retrievers (id, name, kind, description, enabled, config)
 		 VALUES ($1, $2, $3, $4, $5, $6)
 		 RETURNING id, name, kind, COALESCE(description, ''), enabled, config, created_at, updated_at`,
-		item.ID, item.Name, item.Kind, item.Description, item.Enabled, item.Config,
+		item.ID, item.Name, item.Kind, item.Description, item.Enabled, config,
 	).Scan(&created.ID, &created.Name, &created.Kind, &created.Description, &created.Enabled, &created.Config, &created.CreatedAt, &created.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("create retriever: %w", err)
 	}
+	if err := s.openConfig(&created.Config, RetrieverSecretFields); err != nil {
+		return nil, err
+	}
 	return &created, nil
 }
 
 func (s *Store) UpdateRetriever(ctx context.Context, id string, item DBRetriever) (*DBRetriever, error) {
+	config, err := s.sealConfig(item.Config, RetrieverSecretFields)
+	if err != nil {
+		return nil, err
+	}
+
 	var updated DBRetriever
-	err := s.pool.QueryRow(ctx,
+	err = s.pool.QueryRow(ctx,
 		`UPDATE retrievers SET name = $1, kind = $2, description = $3, enabled = $4, config = $5, updated_at = now()
 		 WHERE id = $6
 		 RETURNING id, name, kind, COALESCE(description, ''), enabled, config, created_at, updated_at`,
-		item.Name, item.Kind, item.Description, item.Enabled, item.Config, id,
+		item.Name, item.Kind, item.Description, item.Enabled, config, id,
 	).Scan(&updated.ID, &updated.Name, &updated.Kind, &updated.Description, &updated.Enabled, &updated.Config, &updated.CreatedAt, &updated.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("update retriever: %w", err)
 	}
+	if err := s.openConfig(&updated.Config, RetrieverSecretFields); err != nil {
+		return nil, err
+	}
 	return &updated, nil
 }
 
@@ -437,6 +534,9 @@ func (s *Store) GetEnabledRetrievers(ctx context.Context) ([]DBRetriever, error)
 		if err := rows.Scan(&item.ID, &item.Name, &item.Kind, &item.Description, &item.Enabled, &item.Config, &item.CreatedAt, &item.UpdatedAt); err != nil {
 			return nil, err
 		}
+		if err := s.openConfig(&item.Config, RetrieverSecretFields); err != nil {
+			return nil, err
+		}
 		items = append(items, item)
 	}
 	return items, nil
@@ -4,21 +4,37 @@ import (
 	"context"
 	"embed"
 	"fmt"
-	"log"
+	"log/slog"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"flag-manager-api/secrets"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+// conn is the part of *pgxpool.Pool the store uses, also implemented for
+// SQLite by sqliteConn.
+type conn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Close()
+}
+
 // Store provides access to all database operations.
 type Store struct {
-	pool *pgxpool.Pool
+	pool   conn
+	sqlite bool
+	cipher *secrets.Cipher // encrypts the secrets of configs; nil keeps them in plaintext
 }
 
 // PaginationParams holds common pagination parameters.
@@ -32,18 +48,42 @@ type PaginationParams struct {
 
 // PaginatedResult wraps a paginated response.
 type PaginatedResult[T any] struct {
-	Data       []T `json:"data"`
-	Total      int `json:"total"`
-	Page       int `json:"page"`
-	PageSize   int `json:"pageSize"`
-	TotalPages int `json:"totalPages"`
+	Data       []T  `json:"data"`
+	Total      int  `json:"total"`
+	Page       int  `json:"page"`
+	PageSize   int  `json:"pageSize"`
+	TotalPages int  `json:"totalPages"`
+	HasNext    bool `json:"hasNext"`
+}
+
+// NewPaginatedResult wraps a page of data out of total items.
+func NewPaginatedResult[T any](data []T, total int, params PaginationParams) *PaginatedResult[T] {
+	return &PaginatedResult[T]{
+		Data:       data,
+		Total:      total,
+		Page:       params.Page,
+		PageSize:   params.Limit(),
+		TotalPages: TotalPages(total, params.Limit()),
+		HasNext:    params.Offset()+len(data) < total,
+	}
 }
 
-// NewStore creates a new database store with connection pool.
+// NewStore creates a new database store with connection pool. URLs starting
+// with sqlite:// open a SQLite database file instead of PostgreSQL.
 func NewStore(databaseURL string) (*Store, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return NewStoreContext(context.Background(), databaseURL)
+}
+
+// NewStoreContext is NewStore giving up, in connecting or migrating, when ctx
+// is done.
+func NewStoreContext(ctx context.Context, databaseURL string) (*Store, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
+	if strings.HasPrefix(databaseURL, "sqlite://") {
+		return newSQLiteStore(ctx, databaseURL)
+	}
+
 	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("parse database URL: %w", err)
@@ -64,7 +104,7 @@ func NewStore(databaseURL string) (*Store, error) {
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
 
-	log.Println("Connected to PostgreSQL")
+	slog.Info("Connected to PostgreSQL")
 
 	store := &Store{pool: pool}
 	if err := store.runMigrations(ctx); err != nil {
@@ -80,9 +120,22 @@ func (s *Store) Close() {
 	s.pool.Close()
 }
 
-// Pool returns the underlying connection pool for advanced usage.
+// Ping checks that the database answers queries.
+func (s *Store) Ping(ctx context.Context) error {
+	var one int
+	return s.pool.QueryRow(ctx, "SELECT 1").Scan(&one)
+}
+
+// Pool returns the underlying connection pool for advanced usage, or nil when
+// using SQLite.
 func (s *Store) Pool() *pgxpool.Pool {
-	return s.pool
+	pool, _ := s.pool.(*pgxpool.Pool)
+	return pool
+}
+
+// SQLite reports whether the store uses SQLite rather than PostgreSQL.
+func (s *Store) SQLite() bool {
+	return s.sqlite
 }
 
 // runMigrations executes all pending SQL migration files in order.
@@ -91,7 +144,7 @@ func (s *Store) runMigrations(ctx context.Context) error {
 	_, err := s.pool.Exec(ctx, `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version INT PRIMARY KEY,
-			applied_at TIMESTAMPTZ DEFAULT now()
+			applied_at TIMESTAMPTZ DEFAULT (now())
 		)
 	`)
 	if err != nil {
@@ -115,7 +168,11 @@ func (s *Store) runMigrations(ctx context.Context) error {
 	}
 
 	// Read migration files
-	entries, err := migrationsFS.ReadDir("migrations")
+	migrationsDir, migrationFiles := "migrations", migrationsFS
+	if s.sqlite {
+		migrationsDir, migrationFiles = "migrations_sqlite", sqliteMigrationsFS
+	}
+	entries, err := migrationFiles.ReadDir(migrationsDir)
 	if err != nil {
 		return fmt.Errorf("read migrations dir: %w", err)
 	}
@@ -151,12 +208,12 @@ func (s *Store) runMigrations(ctx context.Context) error {
 			continue
 		}
 
-		data, err := migrationsFS.ReadFile("migrations/" + m.name)
+		data, err := migrationFiles.ReadFile(migrationsDir + "/" + m.name)
 		if err != nil {
 			return fmt.Errorf("read migration %s: %w", m.name, err)
 		}
 
-		log.Printf("Applying migration %03d: %s", m.version, m.name)
+		slog.Info("Applying migration", "version", m.version, "name", m.name)
 		if _, err := s.pool.Exec(ctx, string(data)); err != nil {
 			return fmt.Errorf("apply migration %s: %w", m.name, err)
 		}
@@ -166,7 +223,7 @@ func (s *Store) runMigrations(ctx context.Context) error {
 		}
 	}
 
-	log.Println("Database migrations complete")
+	slog.Info("Database migrations complete")
 	return nil
 }
 
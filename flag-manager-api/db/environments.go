@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ListEnvironmentFlags returns the per-environment configs of a project's
+// flags in one environment, keyed by flag key.
+func (s *Store) ListEnvironmentFlags(ctx context.Context, projectName, environment string) (map[string]json.RawMessage, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT f.key, ef.config FROM environment_flags ef
+		 JOIN flags f ON f.id = ef.flag_id
+		 JOIN projects p ON p.id = f.project_id
+		 WHERE p.name = $1 AND ef.environment = $2
+		 ORDER BY f.key`,
+		projectName, environment,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list environment flags: %w", err)
+	}
+	defer rows.Close()
+
+	flags := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var key string
+		var config json.RawMessage
+		if err := rows.Scan(&key, &config); err != nil {
+			return nil, err
+		}
+		flags[key] = config
+	}
+	return flags, rows.Err()
+}
+
+// SetEnvironmentFlag creates or replaces a flag's config in one environment.
+// It returns the ID of the project flag, or pgx.ErrNoRows if the flag does
+// not exist.
+func (s *Store) SetEnvironmentFlag(ctx context.Context, projectName, environment, flagKey string, config json.RawMessage) (string, error) {
+	var flagID string
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO environment_flags (flag_id, environment, config)
+		 SELECT f.id, $3, $4 FROM flags f
+		 JOIN projects p ON p.id = f.project_id
+		 WHERE p.name = $1 AND f.key = $2
+		 ON CONFLICT (flag_id, environment) DO UPDATE SET config = EXCLUDED.config, updated_at = now()
+		 RETURNING flag_id`,
+		projectName, flagKey, environment, config,
+	).Scan(&flagID)
+	if err != nil {
+		return "", err
+	}
+	return flagID, nil
+}
+
+// DeleteEnvironmentFlag removes a flag's config in one environment, so the
+// environment falls back to the project config. It returns pgx.ErrNoRows if
+// the flag has no config there.
+func (s *Store) DeleteEnvironmentFlag(ctx context.Context, projectName, environment, flagKey string) error {
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM environment_flags
+		 WHERE environment = $2 AND flag_id IN (
+		   SELECT f.id FROM flags f JOIN projects p ON p.id = f.project_id
+		   WHERE p.name = $1 AND f.key = $3)`,
+		projectName, environment, flagKey,
+	)
+	if err != nil {
+		return fmt.Errorf("delete environment flag: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteEnvironmentFlags removes every flag config of a project in one
+// environment.
+func (s *Store) DeleteEnvironmentFlags(ctx context.Context, projectName, environment string) error {
+	_, err := s.pool.Exec(ctx,
+		`DELETE FROM environment_flags
+		 WHERE environment = $2 AND flag_id IN (
+		   SELECT f.id FROM flags f JOIN projects p ON p.id = f.project_id
+		   WHERE p.name = $1)`,
+		projectName, environment,
+	)
+	if err != nil {
+		return fmt.Errorf("delete environment flags: %w", err)
+	}
+	return nil
+}
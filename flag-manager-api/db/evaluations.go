@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// evaluationInsertBatch bounds the rows of one INSERT, keeping the number of
+// parameters below the limits of PostgreSQL and SQLite.
+const evaluationInsertBatch = 500
+
+// EvaluationEvent is one flag evaluation reported by a relay proxy.
+type EvaluationEvent struct {
+	Project     string
+	FlagKey     string
+	Variation   string
+	ContextKey  string
+	ContextKind string
+	RuleName    string
+	Default     bool
+	Source      string
+	EvaluatedAt time.Time
+}
+
+// EvaluationCount is the number of evaluations of one variation in a period.
+type EvaluationCount struct {
+	Period    time.Time `json:"period"`
+	Variation string    `json:"variation"`
+	Count     int       `json:"count"`
+}
+
+// RuleHitCount is the number of evaluations served by one targeting rule. An
+// empty rule is the default rule, or evaluations reported without a rule.
+type RuleHitCount struct {
+	Rule  string `json:"rule"`
+	Count int    `json:"count"`
+}
+
+// EvaluationStatsParams selects the evaluations of a flag to aggregate.
+type EvaluationStatsParams struct {
+	Project  string
+	FlagKey  string
+	Interval string // hour or day
+	Since    time.Time
+	Until    time.Time
+}
+
+// EvaluationStats are the aggregated evaluations of a flag.
+type EvaluationStats struct {
+	Total             int
+	UniqueContextKeys int
+	Counts            []EvaluationCount // by period and variation, only non-zero
+	RuleHits          []RuleHitCount    // most hit first
+}
+
+// InsertEvaluationEvents stores evaluation events in batches.
+func (s *Store) InsertEvaluationEvents(ctx context.Context, events []EvaluationEvent) error {
+	for start := 0; start < len(events); start += evaluationInsertBatch {
+		batch := events[start:min(start+evaluationInsertBatch, len(events))]
+
+		values := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, len(batch)*9)
+		for i, e := range batch {
+			n := i * 9
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9))
+			args = append(args, e.Project, e.FlagKey, e.Variation, e.ContextKey, e.ContextKind,
+				e.RuleName, e.Default, e.Source, e.EvaluatedAt.UTC())
+		}
+
+		_, err := s.pool.Exec(ctx,
+			`INSERT INTO evaluation_events (project, flag_key, variation, context_key, context_kind, rule_name, is_default, source, evaluated_at)
+			 VALUES `+strings.Join(values, ", "), args...)
+		if err != nil {
+			return fmt.Errorf("insert evaluation events: %w", err)
+		}
+	}
+	return nil
+}
+
+// FlagEvaluationStats aggregates the evaluations of a flag in [Since, Until),
+// counting them per variation in UTC periods of the given interval.
+func (s *Store) FlagEvaluationStats(ctx context.Context, params EvaluationStatsParams) (*EvaluationStats, error) {
+	if params.Interval != "hour" && params.Interval != "day" {
+		return nil, fmt.Errorf("invalid interval: %s", params.Interval)
+	}
+
+	const where = `WHERE project = $1 AND flag_key = $2 AND evaluated_at >= $3 AND evaluated_at < $4`
+	args := []interface{}{params.Project, params.FlagKey, params.Since, params.Until}
+	stats := &EvaluationStats{}
+
+	err := s.pool.QueryRow(ctx,
+		`SELECT COUNT(*), COUNT(DISTINCT context_key) FROM evaluation_events `+where, args...,
+	).Scan(&stats.Total, &stats.UniqueContextKeys)
+	if err != nil {
+		return nil, fmt.Errorf("evaluation totals: %w", err)
+	}
+	if stats.Total == 0 {
+		return stats, nil
+	}
+
+	rows, err := s.pool.Query(ctx,
+		`SELECT date_trunc($5, evaluated_at AT TIME ZONE 'UTC') AS period, variation, COUNT(*)
+		 FROM evaluation_events `+where+`
+		 GROUP BY 1, 2
+		 ORDER BY 1, 2`, append(args, params.Interval)...)
+	if err != nil {
+		return nil, fmt.Errorf("evaluation counts: %w", err)
+	}
+	for rows.Next() {
+		var c EvaluationCount
+		if err := rows.Scan(&c.Period, &c.Variation, &c.Count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Period = c.Period.UTC()
+		stats.Counts = append(stats.Counts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.pool.Query(ctx,
+		`SELECT rule_name, COUNT(*) FROM evaluation_events `+where+`
+		 GROUP BY 1
+		 ORDER BY 2 DESC, 1`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("rule hit counts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c RuleHitCount
+		if err := rows.Scan(&c.Rule, &c.Count); err != nil {
+			return nil, err
+		}
+		stats.RuleHits = append(stats.RuleHits, c)
+	}
+	return stats, rows.Err()
+}
+
+// DeleteEvaluationEventsBefore purges evaluations older than cutoff and
+// returns how many were deleted.
+func (s *Store) DeleteEvaluationEventsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM evaluation_events WHERE evaluated_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("delete evaluation events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
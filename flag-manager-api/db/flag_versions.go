@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FlagVersion is a stored revision of a project flag. Config is empty for the
+// revision recording a deletion.
+type FlagVersion struct {
+	Project     string
+	FlagKey     string
+	Version     int
+	Action      string
+	Config      json.RawMessage
+	PreviousKey string
+	Author      string
+	CreatedAt   time.Time
+}
+
+// InsertFlagVersion stores v as the next revision of its flag and returns the
+// revision number.
+func (s *Store) InsertFlagVersion(ctx context.Context, v FlagVersion) (int, error) {
+	var version int
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO flag_versions (project, flag_key, version, action, config, previous_key, author)
+		 SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, $6
+		 FROM flag_versions WHERE project = $1 AND flag_key = $2
+		 RETURNING version`,
+		v.Project, v.FlagKey, v.Action, nullableJSON(v.Config), nullStr(v.PreviousKey), nullStr(v.Author),
+	).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("insert flag version: %w", err)
+	}
+	return version, nil
+}
+
+// ListFlagVersions returns the revisions of a flag, newest first.
+func (s *Store) ListFlagVersions(ctx context.Context, project, key string) ([]FlagVersion, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT project, flag_key, version, action, config, COALESCE(previous_key, ''), COALESCE(author, ''), created_at
+		 FROM flag_versions WHERE project = $1 AND flag_key = $2
+		 ORDER BY version DESC`, project, key)
+	if err != nil {
+		return nil, fmt.Errorf("list flag versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []FlagVersion
+	for rows.Next() {
+		var v FlagVersion
+		if err := rows.Scan(&v.Project, &v.FlagKey, &v.Version, &v.Action, &v.Config, &v.PreviousKey, &v.Author, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// RenameFlagVersions moves the history of a flag to its new key.
+func (s *Store) RenameFlagVersions(ctx context.Context, project, key, newKey string) error {
+	_, err := s.pool.Exec(ctx,
+		`UPDATE flag_versions SET flag_key = $3 WHERE project = $1 AND flag_key = $2`, project, key, newKey)
+	if err != nil {
+		return fmt.Errorf("rename flag versions: %w", err)
+	}
+	return nil
+}
+
+// DeleteProjectFlagVersions deletes the flag history of a project.
+func (s *Store) DeleteProjectFlagVersions(ctx context.Context, project string) error {
+	if _, err := s.pool.Exec(ctx, `DELETE FROM flag_versions WHERE project = $1`, project); err != nil {
+		return fmt.Errorf("delete flag versions: %w", err)
+	}
+	return nil
+}
@@ -19,12 +19,25 @@ type Flag struct {
 	UpdatedAt time.Time       `json:"updatedAt"`
 }
 
+// publishedFlagFilter excludes draft flags, which are not served to the relay
+// proxy until published, and archived flags, which are kept until purged.
+const publishedFlagFilter = `COALESCE(f.config->>'status', '') <> 'draft' AND COALESCE(f.config->>'archivedAt', '') = ''`
+
 // ListFlags returns all flags for a project as a map (backward-compatible format).
 func (s *Store) ListFlags(ctx context.Context, projectName string) (map[string]json.RawMessage, error) {
+	return s.listFlags(ctx, projectName, "")
+}
+
+// ListPublishedFlags is like ListFlags but leaves out draft and archived flags.
+func (s *Store) ListPublishedFlags(ctx context.Context, projectName string) (map[string]json.RawMessage, error) {
+	return s.listFlags(ctx, projectName, " AND "+publishedFlagFilter)
+}
+
+func (s *Store) listFlags(ctx context.Context, projectName, filter string) (map[string]json.RawMessage, error) {
 	rows, err := s.pool.Query(ctx,
 		`SELECT f.key, f.config FROM flags f
 		 JOIN projects p ON p.id = f.project_id
-		 WHERE p.name = $1 ORDER BY f.key`,
+		 WHERE p.name = $1`+filter+` ORDER BY f.key`,
 		projectName,
 	)
 	if err != nil {
@@ -44,41 +57,78 @@ func (s *Store) ListFlags(ctx context.Context, projectName string) (map[string]j
 	return flags, nil
 }
 
+// FlagFilterParams extends pagination with flag filters.
+type FlagFilterParams struct {
+	PaginationParams
+	Tag      string // flags carrying this tag
+	Disabled *bool
+	Type     string // variation type: boolean, string, number or object
+	Archived bool   // list the archived flags instead of the others
+}
+
+// flagVariationTypes maps flag types to the JSON types of their variation
+// values, as named by jsonb_typeof and SQLite's json_each.
+var flagVariationTypes = map[string]struct{ postgres, sqlite string }{
+	"boolean": {`'boolean'`, `'true', 'false'`},
+	"string":  {`'string'`, `'text'`},
+	"number":  {`'number'`, `'integer', 'real'`},
+	"object":  {`'object', 'array'`, `'object', 'array'`},
+}
+
 // ListFlagsPaginated returns paginated flags for a project.
-func (s *Store) ListFlagsPaginated(ctx context.Context, projectName string, params PaginationParams) (*PaginatedResult[Flag], error) {
+func (s *Store) ListFlagsPaginated(ctx context.Context, projectName string, params FlagFilterParams) (*PaginatedResult[Flag], error) {
 	// Get project ID
 	projectID, err := s.GetProjectID(ctx, projectName)
 	if err != nil {
 		return nil, fmt.Errorf("project not found: %w", err)
 	}
 
-	// Count
-	var total int
-	countQuery := "SELECT COUNT(*) FROM flags WHERE project_id = $1"
-	countArgs := []interface{}{projectID}
+	where := "WHERE project_id = $1"
+	args := []interface{}{projectID}
 	argIdx := 2
 
 	if params.Search != "" {
-		countQuery += fmt.Sprintf(" AND key ILIKE $%d", argIdx)
-		countArgs = append(countArgs, "%"+params.Search+"%")
+		where += fmt.Sprintf(" AND key ILIKE $%d", argIdx)
+		args = append(args, "%"+params.Search+"%")
 		argIdx++
 	}
+	if params.Tag != "" {
+		where += " AND " + s.flagTagClause(argIdx)
+		args = append(args, params.Tag)
+		argIdx++
+	}
+	if params.Disabled != nil {
+		where += fmt.Sprintf(" AND disabled = $%d", argIdx)
+		args = append(args, *params.Disabled)
+		argIdx++
+	}
+	if params.Archived {
+		where += " AND COALESCE(config->>'archivedAt', '') <> ''"
+	} else {
+		where += " AND COALESCE(config->>'archivedAt', '') = ''"
+	}
+	if params.Type != "" {
+		types, ok := flagVariationTypes[params.Type]
+		if !ok {
+			return nil, fmt.Errorf("unknown flag type %q", params.Type)
+		}
+		// Every variation must have the type
+		if s.sqlite {
+			where += " AND EXISTS (SELECT 1 FROM json_each(config, '$.variations'))" +
+				" AND NOT EXISTS (SELECT 1 FROM json_each(config, '$.variations') WHERE type NOT IN (" + types.sqlite + "))"
+		} else {
+			where += " AND EXISTS (SELECT 1 FROM jsonb_each(config->'variations'))" +
+				" AND NOT EXISTS (SELECT 1 FROM jsonb_each(config->'variations') v WHERE jsonb_typeof(v.value) NOT IN (" + types.postgres + "))"
+		}
+	}
 
-	if err := s.pool.QueryRow(ctx, countQuery, countArgs...).Scan(&total); err != nil {
+	// Count
+	var total int
+	if err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM flags "+where, args...).Scan(&total); err != nil {
 		return nil, err
 	}
 
 	// Query
-	query := "SELECT id, project_id, key, config, disabled, COALESCE(version, ''), created_at, updated_at FROM flags WHERE project_id = $1"
-	queryArgs := []interface{}{projectID}
-	queryArgIdx := 2
-
-	if params.Search != "" {
-		query += fmt.Sprintf(" AND key ILIKE $%d", queryArgIdx)
-		queryArgs = append(queryArgs, "%"+params.Search+"%")
-		queryArgIdx++
-	}
-
 	sortCol := "key"
 	switch params.Sort {
 	case "created_at":
@@ -86,11 +136,12 @@ func (s *Store) ListFlagsPaginated(ctx context.Context, projectName string, para
 	case "updated_at":
 		sortCol = "updated_at"
 	}
+	query := "SELECT id, project_id, key, config, disabled, COALESCE(version, ''), created_at, updated_at FROM flags " + where
 	query += fmt.Sprintf(" ORDER BY %s %s", sortCol, params.OrderDirection())
-	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", queryArgIdx, queryArgIdx+1)
-	queryArgs = append(queryArgs, params.Limit(), params.Offset())
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
+	args = append(args, params.Limit(), params.Offset())
 
-	rows, err := s.pool.Query(ctx, query, queryArgs...)
+	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -109,13 +160,16 @@ func (s *Store) ListFlagsPaginated(ctx context.Context, projectName string, para
 		flags = []Flag{}
 	}
 
-	return &PaginatedResult[Flag]{
-		Data:       flags,
-		Total:      total,
-		Page:       params.Page,
-		PageSize:   params.Limit(),
-		TotalPages: TotalPages(total, params.Limit()),
-	}, nil
+	return NewPaginatedResult(flags, total, params.PaginationParams), nil
+}
+
+// flagTagClause returns a condition matching flags whose config tags contain
+// the argument at position arg.
+func (s *Store) flagTagClause(arg int) string {
+	if s.sqlite {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(config, '$.tags') WHERE value = $%d)", arg)
+	}
+	return fmt.Sprintf("config->'tags' @> jsonb_build_array($%d::text)", arg)
 }
 
 // GetFlag returns a single flag by project name and key.
@@ -207,31 +261,113 @@ func (s *Store) FlagExists(ctx context.Context, projectName, flagKey string) (bo
 	return exists, err
 }
 
-// GetAllFlags returns all flags across all projects (for /api/flags/raw).
+// ListFlagUpdateTimes returns when each flag of a project was last updated.
+func (s *Store) ListFlagUpdateTimes(ctx context.Context, projectName string) (map[string]time.Time, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT f.key, f.updated_at FROM flags f
+		 JOIN projects p ON p.id = f.project_id
+		 WHERE p.name = $1`,
+		projectName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list flag update times: %w", err)
+	}
+	defer rows.Close()
+
+	times := make(map[string]time.Time)
+	for rows.Next() {
+		var key string
+		var updatedAt time.Time
+		if err := rows.Scan(&key, &updatedAt); err != nil {
+			return nil, err
+		}
+		times[key] = updatedAt
+	}
+	return times, rows.Err()
+}
+
+// GetAllFlags returns all flags across all projects keyed "project/flag".
 func (s *Store) GetAllFlags(ctx context.Context) (map[string]json.RawMessage, error) {
+	return s.getAllFlags(ctx, "")
+}
+
+// GetAllPublishedFlags returns the flags served on /api/flags/raw: all flags
+// across all projects except drafts and archived flags.
+func (s *Store) GetAllPublishedFlags(ctx context.Context) (map[string]json.RawMessage, error) {
+	return s.getAllFlags(ctx, " WHERE "+publishedFlagFilter)
+}
+
+// EachPublishedFlag calls fn with the flags GetAllPublishedFlags returns one
+// at a time, as they are read, ordered by project and key. It stops at the
+// first error fn returns.
+func (s *Store) EachPublishedFlag(ctx context.Context, fn func(key string, config json.RawMessage) error) error {
+	return s.eachFlag(ctx, " WHERE "+publishedFlagFilter, fn)
+}
+
+func (s *Store) getAllFlags(ctx context.Context, filter string) (map[string]json.RawMessage, error) {
+	allFlags := make(map[string]json.RawMessage)
+	err := s.eachFlag(ctx, filter, func(key string, config json.RawMessage) error {
+		allFlags[key] = config
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allFlags, nil
+}
+
+func (s *Store) eachFlag(ctx context.Context, filter string, fn func(key string, config json.RawMessage) error) error {
 	rows, err := s.pool.Query(ctx,
 		`SELECT p.name, f.key, f.config FROM flags f
-		 JOIN projects p ON p.id = f.project_id
+		 JOIN projects p ON p.id = f.project_id AND p.deleted_at IS NULL`+filter+`
 		 ORDER BY p.name, f.key`,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("get all flags: %w", err)
+		return fmt.Errorf("get all flags: %w", err)
 	}
 	defer rows.Close()
 
-	allFlags := make(map[string]json.RawMessage)
 	for rows.Next() {
 		var project, key string
 		var config json.RawMessage
 		if err := rows.Scan(&project, &key, &config); err != nil {
-			return nil, err
+			return err
+		}
+		if err := fn(project+"/"+key, config); err != nil {
+			return err
 		}
-		allFlags[project+"/"+key] = config
 	}
-	return allFlags, nil
+	return rows.Err()
 }
 
 // GetProjectFlags returns all flags for a project (for /api/flags/raw/{project}).
 func (s *Store) GetProjectFlags(ctx context.Context, projectName string) (map[string]json.RawMessage, error) {
 	return s.ListFlags(ctx, projectName)
 }
+
+// UpdateFlagConfigs replaces the config of several flags in one project in a
+// single transaction. Either every flag is updated or none are.
+func (s *Store) UpdateFlagConfigs(ctx context.Context, projectName string, configs map[string]json.RawMessage) ([]Flag, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	updated := make([]Flag, 0, len(configs))
+	for flagKey, config := range configs {
+		var f Flag
+		err := tx.QueryRow(ctx,
+			`UPDATE flags SET config = $1, updated_at = now()
+			 WHERE project_id = (SELECT id FROM projects WHERE name = $2) AND key = $3
+			 RETURNING id, project_id, key, config, disabled, COALESCE(version, ''), created_at, updated_at`,
+			config, projectName, flagKey,
+		).Scan(&f.ID, &f.ProjectID, &f.Key, &f.Config, &f.Disabled, &f.Version, &f.CreatedAt, &f.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("update flag %s: %w", flagKey, err)
+		}
+		updated = append(updated, f)
+	}
+
+	return updated, tx.Commit(ctx)
+}
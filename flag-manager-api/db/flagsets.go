@@ -15,6 +15,7 @@ type DBFlagSet struct {
 	Name        string          `json:"name"`
 	Description string          `json:"description,omitempty"`
 	IsDefault   bool            `json:"isDefault"`
+	Environment string          `json:"environment,omitempty"`
 	Retriever   json.RawMessage `json:"retriever,omitempty"`
 	Exporter    json.RawMessage `json:"exporter,omitempty"`
 	Notifier    json.RawMessage `json:"notifier,omitempty"`
@@ -36,7 +37,7 @@ type DBFlagSetFlag struct {
 // ListFlagSets returns all flag sets with their API keys.
 func (s *Store) ListFlagSets(ctx context.Context) ([]DBFlagSet, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, name, COALESCE(description, ''), is_default,
+		`SELECT id, name, COALESCE(description, ''), is_default, COALESCE(environment, ''),
 		        retriever, exporter, notifier,
 		        created_at, updated_at
 		 FROM flag_sets ORDER BY name`)
@@ -49,7 +50,7 @@ func (s *Store) ListFlagSets(ctx context.Context) ([]DBFlagSet, error) {
 	for rows.Next() {
 		var fs DBFlagSet
 		var retriever, exporter, notifier []byte
-		if err := rows.Scan(&fs.ID, &fs.Name, &fs.Description, &fs.IsDefault,
+		if err := rows.Scan(&fs.ID, &fs.Name, &fs.Description, &fs.IsDefault, &fs.Environment,
 			&retriever, &exporter, &notifier,
 			&fs.CreatedAt, &fs.UpdatedAt); err != nil {
 			return nil, err
@@ -80,11 +81,11 @@ func (s *Store) GetFlagSet(ctx context.Context, id string) (*DBFlagSet, error) {
 	var fs DBFlagSet
 	var retriever, exporter, notifier []byte
 	err := s.pool.QueryRow(ctx,
-		`SELECT id, name, COALESCE(description, ''), is_default,
+		`SELECT id, name, COALESCE(description, ''), is_default, COALESCE(environment, ''),
 		        retriever, exporter, notifier,
 		        created_at, updated_at
 		 FROM flag_sets WHERE id = $1`, id,
-	).Scan(&fs.ID, &fs.Name, &fs.Description, &fs.IsDefault,
+	).Scan(&fs.ID, &fs.Name, &fs.Description, &fs.IsDefault, &fs.Environment,
 		&retriever, &exporter, &notifier,
 		&fs.CreatedAt, &fs.UpdatedAt)
 	if err != nil {
@@ -120,11 +121,11 @@ func (s *Store) CreateFlagSet(ctx context.Context, fs DBFlagSet) (*DBFlagSet, er
 	var created DBFlagSet
 	var retriever, exporter, notifier []byte
 	err = tx.QueryRow(ctx,
-		`INSERT INTO flag_sets (name, description, is_default, retriever, exporter, notifier)
-		 VALUES ($1, $2, $3, $4, $5, $6)
-		 RETURNING id, name, COALESCE(description, ''), is_default, retriever, exporter, notifier, created_at, updated_at`,
-		fs.Name, fs.Description, fs.IsDefault, nullableJSON(fs.Retriever), nullableJSON(fs.Exporter), nullableJSON(fs.Notifier),
-	).Scan(&created.ID, &created.Name, &created.Description, &created.IsDefault,
+		`INSERT INTO flag_sets (name, description, is_default, environment, retriever, exporter, notifier)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, name, COALESCE(description, ''), is_default, COALESCE(environment, ''), retriever, exporter, notifier, created_at, updated_at`,
+		fs.Name, fs.Description, fs.IsDefault, nullStr(fs.Environment), nullableJSON(fs.Retriever), nullableJSON(fs.Exporter), nullableJSON(fs.Notifier),
+	).Scan(&created.ID, &created.Name, &created.Description, &created.IsDefault, &created.Environment,
 		&retriever, &exporter, &notifier,
 		&created.CreatedAt, &created.UpdatedAt)
 	if err != nil {
@@ -162,12 +163,12 @@ func (s *Store) UpdateFlagSet(ctx context.Context, id string, fs DBFlagSet) (*DB
 	var updated DBFlagSet
 	var retriever, exporter, notifier []byte
 	err = tx.QueryRow(ctx,
-		`UPDATE flag_sets SET name = $1, description = $2, is_default = $3,
-		        retriever = $4, exporter = $5, notifier = $6, updated_at = now()
-		 WHERE id = $7
-		 RETURNING id, name, COALESCE(description, ''), is_default, retriever, exporter, notifier, created_at, updated_at`,
-		fs.Name, fs.Description, fs.IsDefault, nullableJSON(fs.Retriever), nullableJSON(fs.Exporter), nullableJSON(fs.Notifier), id,
-	).Scan(&updated.ID, &updated.Name, &updated.Description, &updated.IsDefault,
+		`UPDATE flag_sets SET name = $1, description = $2, is_default = $3, environment = $4,
+		        retriever = $5, exporter = $6, notifier = $7, updated_at = now()
+		 WHERE id = $8
+		 RETURNING id, name, COALESCE(description, ''), is_default, COALESCE(environment, ''), retriever, exporter, notifier, created_at, updated_at`,
+		fs.Name, fs.Description, fs.IsDefault, nullStr(fs.Environment), nullableJSON(fs.Retriever), nullableJSON(fs.Exporter), nullableJSON(fs.Notifier), id,
+	).Scan(&updated.ID, &updated.Name, &updated.Description, &updated.IsDefault, &updated.Environment,
 		&retriever, &exporter, &notifier,
 		&updated.CreatedAt, &updated.UpdatedAt)
 	if err != nil {
@@ -195,6 +196,13 @@ func (s *Store) GenerateFlagSetAPIKey(ctx context.Context, flagSetID, key string
 	return err
 }
 
+// GetFlagSetIDByAPIKey returns the ID of the flag set owning an API key.
+func (s *Store) GetFlagSetIDByAPIKey(ctx context.Context, key string) (string, error) {
+	var id string
+	err := s.pool.QueryRow(ctx, "SELECT flag_set_id FROM flag_set_api_keys WHERE key = $1", key).Scan(&id)
+	return id, err
+}
+
 // RemoveFlagSetAPIKey removes an API key from a flag set.
 func (s *Store) RemoveFlagSetAPIKey(ctx context.Context, flagSetID, key string) error {
 	// Check if this is the last key
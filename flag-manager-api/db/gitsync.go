@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetGitSyncBase returns a project's flags as last synced from a git
+// integration, or nil if the project was never synced from it.
+func (s *Store) GetGitSyncBase(ctx context.Context, integrationID, projectName string) (json.RawMessage, error) {
+	var flags json.RawMessage
+	err := s.pool.QueryRow(ctx,
+		`SELECT flags FROM git_sync_state WHERE integration_id = $1 AND project = $2`,
+		integrationID, projectName,
+	).Scan(&flags)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get git sync state: %w", err)
+	}
+	return flags, nil
+}
+
+// SetGitSyncBase records a project's flags as synced from a git integration.
+func (s *Store) SetGitSyncBase(ctx context.Context, integrationID, projectName string, flags json.RawMessage) error {
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO git_sync_state (integration_id, project, flags)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (integration_id, project) DO UPDATE SET flags = EXCLUDED.flags, synced_at = now()`,
+		integrationID, projectName, flags,
+	)
+	if err != nil {
+		return fmt.Errorf("set git sync state: %w", err)
+	}
+	return nil
+}
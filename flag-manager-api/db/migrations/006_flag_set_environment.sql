@@ -0,0 +1 @@
+ALTER TABLE flag_sets ADD COLUMN environment TEXT;
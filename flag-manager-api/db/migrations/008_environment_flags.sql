@@ -0,0 +1,12 @@
+-- Per-environment flag configs, overriding a project flag's config in one environment
+CREATE TABLE IF NOT EXISTS environment_flags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    flag_id UUID NOT NULL REFERENCES flags(id) ON DELETE CASCADE,
+    environment TEXT NOT NULL,
+    config JSONB NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    UNIQUE(flag_id, environment)
+);
+
+CREATE INDEX IF NOT EXISTS idx_environment_flags_environment ON environment_flags(environment);
@@ -0,0 +1,19 @@
+-- Pull requests opened for proposed flag changes, tracked until merged or closed
+CREATE TABLE IF NOT EXISTS proposals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project TEXT NOT NULL,
+    flag_key TEXT NOT NULL,
+    action TEXT NOT NULL,
+    integration_id TEXT NOT NULL DEFAULT '',
+    branch TEXT NOT NULL,
+    base_branch TEXT NOT NULL,
+    pr_url TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT 'open',
+    created_by TEXT,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_proposals_state ON proposals(state);
+CREATE INDEX IF NOT EXISTS idx_proposals_flag ON proposals(project, flag_key);
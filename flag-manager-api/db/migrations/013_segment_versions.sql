@@ -0,0 +1,15 @@
+-- Snapshot of a segment after each create, update and rollback. Existing
+-- segments start at version 1.
+CREATE TABLE IF NOT EXISTS segment_versions (
+    segment_id UUID NOT NULL REFERENCES segments(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT,
+    rules JSONB NOT NULL,
+    created_by TEXT,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (segment_id, version)
+);
+
+INSERT INTO segment_versions (segment_id, version, name, description, rules, created_at)
+SELECT id, 1, name, description, rules, updated_at FROM segments;
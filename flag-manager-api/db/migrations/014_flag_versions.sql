@@ -0,0 +1,13 @@
+-- Revisions of project flags, numbered per flag. Deleted flags keep their
+-- history with a final revision without config.
+CREATE TABLE IF NOT EXISTS flag_versions (
+    project TEXT NOT NULL,
+    flag_key TEXT NOT NULL,
+    version INT NOT NULL,
+    action TEXT NOT NULL,
+    config JSONB,
+    previous_key TEXT,
+    author TEXT,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (project, flag_key, version)
+);
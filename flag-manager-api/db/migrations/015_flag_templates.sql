@@ -0,0 +1,12 @@
+-- Reusable flag skeletons from which flags are created
+CREATE TABLE IF NOT EXISTS flag_templates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    config JSONB NOT NULL,
+    placeholders JSONB NOT NULL DEFAULT '[]',
+    required_metadata JSONB NOT NULL DEFAULT '[]',
+    created_by TEXT,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now()
+);
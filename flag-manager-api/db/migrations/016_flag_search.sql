@@ -0,0 +1,22 @@
+-- Full-text search over flag keys, descriptions, variation names and targeting
+-- queries, weighted in that order.
+CREATE OR REPLACE FUNCTION flag_search_vector(flag_key TEXT, config JSONB) RETURNS tsvector AS $$
+    SELECT setweight(to_tsvector('simple', flag_key || ' ' || translate(flag_key, '-_.', '   ')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(config->'metadata'->>'description', '')), 'B') ||
+        setweight(to_tsvector('simple', COALESCE((
+            SELECT string_agg(name, ' ') FROM jsonb_object_keys(
+                CASE WHEN jsonb_typeof(config->'variations') = 'object' THEN config->'variations' ELSE '{}'::jsonb END) AS name
+        ), '')), 'C') ||
+        setweight(to_tsvector('simple', COALESCE((
+            SELECT string_agg(rule->>'query', ' ') FROM jsonb_array_elements(
+                CASE WHEN jsonb_typeof(config->'targeting') = 'array' THEN config->'targeting' ELSE '[]'::jsonb END) AS rule
+        ), '')), 'D')
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE flags ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (flag_search_vector(key, config)) STORED;
+ALTER TABLE flag_set_flags ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (flag_search_vector(key, config)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_flags_search ON flags USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_flag_set_flags_search ON flag_set_flags USING GIN (search_vector);
@@ -0,0 +1,11 @@
+-- Roles can be assigned within a project or flag set rather than globally.
+-- Empty scope columns mean a global assignment.
+ALTER TABLE user_roles ADD COLUMN project TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_roles ADD COLUMN flag_set_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_roles DROP CONSTRAINT user_roles_user_id_role_id_key;
+ALTER TABLE user_roles ADD CONSTRAINT user_roles_user_id_role_id_scope_key UNIQUE (user_id, role_id, project, flag_set_id);
+
+-- Every route now checks permissions: editors keep using change requests,
+-- templates and flag history
+UPDATE roles SET permissions = '[{"resource":"flag","actions":["read","write","delete"]},{"resource":"project","actions":["read","write","delete"]},{"resource":"flagset","actions":["read","write"]},{"resource":"segment","actions":["read","write"]},{"resource":"settings","actions":["read"]},{"resource":"change_request","actions":["read","write"]},{"resource":"template","actions":["read"]},{"resource":"audit","actions":["read"]}]', updated_at = now()
+WHERE name = 'editor' AND is_builtin;
@@ -0,0 +1,17 @@
+-- Places in application code where flags are evaluated, from goff-scan
+-- manifests. Each scan replaces the references of its app in the project.
+CREATE TABLE IF NOT EXISTS code_references (
+    id BIGSERIAL PRIMARY KEY,
+    project TEXT NOT NULL,
+    flag_key TEXT NOT NULL,
+    app TEXT NOT NULL DEFAULT '',
+    file TEXT NOT NULL,
+    line INTEGER NOT NULL,
+    col INTEGER NOT NULL DEFAULT 0,
+    language TEXT NOT NULL DEFAULT '',
+    symbol TEXT NOT NULL DEFAULT '',
+    version TEXT NOT NULL DEFAULT '',
+    scanned_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_references_flag ON code_references (project, flag_key);
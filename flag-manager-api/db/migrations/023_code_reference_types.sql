@@ -0,0 +1,3 @@
+-- The type a code reference evaluates its flag as (boolean, string, number or
+-- object), to report flags whose variations have another type
+ALTER TABLE code_references ADD COLUMN flag_type TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+-- Object storage the rendered flags file is published to on every change
+CREATE TABLE IF NOT EXISTS publish_targets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL UNIQUE,
+    kind TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    config JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now()
+);
@@ -0,0 +1,5 @@
+-- Deleted projects stay in the trash until restored or purged: the row is
+-- renamed out of the way of live projects and keeps its flags
+ALTER TABLE projects ADD COLUMN deleted_name TEXT;
+ALTER TABLE projects ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE projects ADD COLUMN deleted_by TEXT;
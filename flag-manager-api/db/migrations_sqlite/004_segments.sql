@@ -0,0 +1,10 @@
+CREATE TABLE segments (
+  id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+  name TEXT UNIQUE NOT NULL,
+  description TEXT,
+  rules TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT (now()),
+  updated_at TIMESTAMP DEFAULT (now())
+);
+
+CREATE INDEX idx_segments_name ON segments(name);
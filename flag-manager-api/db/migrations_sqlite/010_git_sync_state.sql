@@ -0,0 +1,9 @@
+-- Flags of a project as last synced from a git integration, the common base
+-- used to tell repo changes from manager changes on the next sync
+CREATE TABLE IF NOT EXISTS git_sync_state (
+    integration_id TEXT NOT NULL,
+    project TEXT NOT NULL,
+    flags TEXT NOT NULL,
+    synced_at TIMESTAMP DEFAULT (now()),
+    PRIMARY KEY (integration_id, project)
+);
@@ -0,0 +1,2 @@
+-- ID of the API request that caused an audit event, to correlate it with logs
+ALTER TABLE audit_events ADD COLUMN request_id TEXT;
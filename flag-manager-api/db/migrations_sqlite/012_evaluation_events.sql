@@ -0,0 +1,18 @@
+-- Flag evaluations reported by the relay proxy's webhook exporter, aggregated
+-- by the flag statistics API and purged after EVALUATION_RETENTION
+CREATE TABLE IF NOT EXISTS evaluation_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project TEXT NOT NULL,
+    flag_key TEXT NOT NULL,
+    variation TEXT NOT NULL,
+    context_key TEXT NOT NULL,
+    context_kind TEXT NOT NULL DEFAULT '',
+    rule_name TEXT NOT NULL DEFAULT '',
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    source TEXT NOT NULL DEFAULT '',
+    evaluated_at TIMESTAMP NOT NULL,
+    received_at TIMESTAMP DEFAULT (now())
+);
+
+CREATE INDEX IF NOT EXISTS idx_evaluation_events_flag ON evaluation_events(project, flag_key, evaluated_at);
+CREATE INDEX IF NOT EXISTS idx_evaluation_events_time ON evaluation_events(evaluated_at);
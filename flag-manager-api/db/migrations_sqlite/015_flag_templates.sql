@@ -0,0 +1,12 @@
+-- Reusable flag skeletons from which flags are created
+CREATE TABLE IF NOT EXISTS flag_templates (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    config TEXT NOT NULL,
+    placeholders TEXT NOT NULL DEFAULT '[]',
+    required_metadata TEXT NOT NULL DEFAULT '[]',
+    created_by TEXT,
+    created_at TIMESTAMP DEFAULT (now()),
+    updated_at TIMESTAMP DEFAULT (now())
+);
@@ -0,0 +1,3 @@
+-- Full-text flag search uses PostgreSQL text search; SQLite deployments rank
+-- the stored flags in memory instead, so there is nothing to migrate.
+SELECT 1;
@@ -0,0 +1,23 @@
+-- Roles can be assigned within a project or flag set rather than globally.
+-- Empty scope columns mean a global assignment. SQLite cannot change a
+-- table's unique constraint, so the table is rebuilt.
+CREATE TABLE user_roles_scoped (
+  user_id TEXT NOT NULL,
+  role_id TEXT REFERENCES roles(id) ON DELETE CASCADE,
+  project TEXT NOT NULL DEFAULT '',
+  flag_set_id TEXT NOT NULL DEFAULT '',
+  assigned_at TIMESTAMP DEFAULT (now()),
+  UNIQUE(user_id, role_id, project, flag_set_id)
+);
+
+INSERT INTO user_roles_scoped (user_id, role_id, assigned_at)
+SELECT user_id, role_id, assigned_at FROM user_roles;
+
+DROP TABLE user_roles;
+ALTER TABLE user_roles_scoped RENAME TO user_roles;
+CREATE INDEX idx_user_roles_user ON user_roles(user_id);
+
+-- Every route now checks permissions: editors keep using change requests,
+-- templates and flag history
+UPDATE roles SET permissions = '[{"resource":"flag","actions":["read","write","delete"]},{"resource":"project","actions":["read","write","delete"]},{"resource":"flagset","actions":["read","write"]},{"resource":"segment","actions":["read","write"]},{"resource":"settings","actions":["read"]},{"resource":"change_request","actions":["read","write"]},{"resource":"template","actions":["read"]},{"resource":"audit","actions":["read"]}]', updated_at = now()
+WHERE name = 'editor' AND is_builtin;
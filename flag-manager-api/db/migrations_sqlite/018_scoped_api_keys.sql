@@ -0,0 +1,8 @@
+-- API keys act as service accounts: a key may be bound to a role, restricted
+-- to projects and flag sets, and made read-only. Keys without a role keep full
+-- access. rotated_at records the last time the key's secret was replaced.
+ALTER TABLE api_keys ADD COLUMN role_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE api_keys ADD COLUMN projects TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE api_keys ADD COLUMN flag_sets TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE api_keys ADD COLUMN read_only BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE api_keys ADD COLUMN rotated_at TIMESTAMP;
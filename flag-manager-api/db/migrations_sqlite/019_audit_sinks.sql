@@ -0,0 +1,10 @@
+-- External systems audit events are streamed to, in addition to audit_events
+CREATE TABLE IF NOT EXISTS audit_sinks (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    name TEXT NOT NULL UNIQUE,
+    kind TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    config TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT (now()),
+    updated_at TIMESTAMP DEFAULT (now())
+);
@@ -0,0 +1,14 @@
+-- Rules routing manager events to notifiers by event, project, tag,
+-- environment and severity
+CREATE TABLE IF NOT EXISTS notification_rules (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    priority INTEGER NOT NULL DEFAULT 0,
+    conditions TEXT NOT NULL DEFAULT '{}',
+    notifiers TEXT NOT NULL DEFAULT '[]',
+    continue_matching BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP DEFAULT (now()),
+    updated_at TIMESTAMP DEFAULT (now())
+);
@@ -0,0 +1,14 @@
+-- Policies checked on every flag create and update: a rule, in the targeting
+-- query language, that changes matching the condition must satisfy
+CREATE TABLE IF NOT EXISTS policies (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    severity TEXT NOT NULL DEFAULT 'error',
+    condition TEXT NOT NULL DEFAULT '',
+    rule TEXT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT (now()),
+    updated_at TIMESTAMP DEFAULT (now())
+);
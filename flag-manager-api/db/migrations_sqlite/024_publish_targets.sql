@@ -0,0 +1,10 @@
+-- Object storage the rendered flags file is published to on every change
+CREATE TABLE IF NOT EXISTS publish_targets (
+    id TEXT PRIMARY KEY DEFAULT (gen_random_uuid()),
+    name TEXT NOT NULL UNIQUE,
+    kind TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    config TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT (now()),
+    updated_at TIMESTAMP DEFAULT (now())
+);
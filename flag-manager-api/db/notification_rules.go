@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// NotificationRule routes the manager events matching its conditions to
+// notifiers. Rules are evaluated by ascending priority and the first match
+// decides, unless it continues to the next rules.
+type NotificationRule struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name"`
+	Description string                `json:"description,omitempty"`
+	Enabled     bool                  `json:"enabled"`
+	Priority    int                   `json:"priority"`
+	Match       NotificationRuleMatch `json:"match"`
+	Notifiers   []string              `json:"notifiers"` // notifier IDs
+	Continue    bool                  `json:"continue"`  // evaluate later rules after a match
+	CreatedAt   time.Time             `json:"createdAt"`
+	UpdatedAt   time.Time             `json:"updatedAt"`
+}
+
+// NotificationRuleMatch holds the conditions of a rule. An event matches when
+// every set condition has one of its values; empty conditions match anything.
+type NotificationRuleMatch struct {
+	Events       []string `json:"events,omitempty"`
+	Projects     []string `json:"projects,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+	Severities   []string `json:"severities,omitempty"` // info, warning or critical
+}
+
+const notificationRuleColumns = `id, name, description, enabled, priority, conditions, notifiers, continue_matching, created_at, updated_at`
+
+func scanNotificationRule(row pgx.Row) (*NotificationRule, error) {
+	var rule NotificationRule
+	var conditions []byte
+	if err := row.Scan(&rule.ID, &rule.Name, &rule.Description, &rule.Enabled, &rule.Priority, &conditions,
+		&rule.Notifiers, &rule.Continue, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(conditions, &rule.Match); err != nil {
+		return nil, fmt.Errorf("parse conditions of notification rule %s: %w", rule.Name, err)
+	}
+	if rule.Notifiers == nil {
+		rule.Notifiers = []string{}
+	}
+	return &rule, nil
+}
+
+// ListNotificationRules returns all notification rules in evaluation order.
+func (s *Store) ListNotificationRules(ctx context.Context) ([]NotificationRule, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+notificationRuleColumns+" FROM notification_rules ORDER BY priority, name")
+	if err != nil {
+		return nil, fmt.Errorf("list notification rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []NotificationRule{}
+	for rows.Next() {
+		rule, err := scanNotificationRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+// GetNotificationRule returns a notification rule, or pgx.ErrNoRows.
+func (s *Store) GetNotificationRule(ctx context.Context, id string) (*NotificationRule, error) {
+	return scanNotificationRule(s.pool.QueryRow(ctx, "SELECT "+notificationRuleColumns+" FROM notification_rules WHERE id = $1", id))
+}
+
+// CreateNotificationRule stores a notification rule and returns it with its ID
+// and timestamps.
+func (s *Store) CreateNotificationRule(ctx context.Context, rule NotificationRule) (*NotificationRule, error) {
+	conditions, err := json.Marshal(rule.Match)
+	if err != nil {
+		return nil, err
+	}
+	created, err := scanNotificationRule(s.pool.QueryRow(ctx,
+		`INSERT INTO notification_rules (name, description, enabled, priority, conditions, notifiers, continue_matching)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+notificationRuleColumns,
+		rule.Name, rule.Description, rule.Enabled, rule.Priority, conditions, rule.Notifiers, rule.Continue,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create notification rule: %w", err)
+	}
+	return created, nil
+}
+
+// UpdateNotificationRule replaces a notification rule, or returns
+// pgx.ErrNoRows.
+func (s *Store) UpdateNotificationRule(ctx context.Context, id string, rule NotificationRule) (*NotificationRule, error) {
+	conditions, err := json.Marshal(rule.Match)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := scanNotificationRule(s.pool.QueryRow(ctx,
+		`UPDATE notification_rules SET name = $1, description = $2, enabled = $3, priority = $4, conditions = $5,
+		 notifiers = $6, continue_matching = $7, updated_at = now()
+		 WHERE id = $8
+		 RETURNING `+notificationRuleColumns,
+		rule.Name, rule.Description, rule.Enabled, rule.Priority, conditions, rule.Notifiers, rule.Continue, id,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update notification rule: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteNotificationRule deletes a notification rule, or returns
+// pgx.ErrNoRows.
+func (s *Store) DeleteNotificationRule(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM notification_rules WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete notification rule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Policy is a rule flag changes must satisfy, such as "production flags have
+// an owner". Condition and Rule are queries in the targeting query language
+// over a description of the change; a change the condition matches violates
+// the policy unless it also matches the rule.
+type Policy struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	Severity    string    `json:"severity"`            // error blocks the change, warning only reports it
+	Condition   string    `json:"condition,omitempty"` // empty applies the policy to every change
+	Rule        string    `json:"rule"`
+	Message     string    `json:"message,omitempty"` // shown for violations, defaults to the name
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+const policyColumns = `id, name, description, enabled, severity, condition, rule, message, created_at, updated_at`
+
+func scanPolicy(row pgx.Row) (*Policy, error) {
+	var p Policy
+	if err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Enabled, &p.Severity, &p.Condition, &p.Rule, &p.Message,
+		&p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPolicies returns all policies by name.
+func (s *Store) ListPolicies(ctx context.Context) ([]Policy, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+policyColumns+" FROM policies ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []Policy{}
+	for rows.Next() {
+		p, err := scanPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *p)
+	}
+	return policies, rows.Err()
+}
+
+// GetPolicy returns a policy, or pgx.ErrNoRows.
+func (s *Store) GetPolicy(ctx context.Context, id string) (*Policy, error) {
+	return scanPolicy(s.pool.QueryRow(ctx, "SELECT "+policyColumns+" FROM policies WHERE id = $1", id))
+}
+
+// CreatePolicy stores a policy and returns it with its ID and timestamps.
+func (s *Store) CreatePolicy(ctx context.Context, p Policy) (*Policy, error) {
+	created, err := scanPolicy(s.pool.QueryRow(ctx,
+		`INSERT INTO policies (name, description, enabled, severity, condition, rule, message)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING `+policyColumns,
+		p.Name, p.Description, p.Enabled, p.Severity, p.Condition, p.Rule, p.Message,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create policy: %w", err)
+	}
+	return created, nil
+}
+
+// UpdatePolicy replaces a policy, or returns pgx.ErrNoRows.
+func (s *Store) UpdatePolicy(ctx context.Context, id string, p Policy) (*Policy, error) {
+	updated, err := scanPolicy(s.pool.QueryRow(ctx,
+		`UPDATE policies SET name = $1, description = $2, enabled = $3, severity = $4, condition = $5,
+		 rule = $6, message = $7, updated_at = now()
+		 WHERE id = $8
+		 RETURNING `+policyColumns,
+		p.Name, p.Description, p.Enabled, p.Severity, p.Condition, p.Rule, p.Message, id,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update policy: %w", err)
+	}
+	return updated, nil
+}
+
+// DeletePolicy deletes a policy, or returns pgx.ErrNoRows.
+func (s *Store) DeletePolicy(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM policies WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete policy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -17,7 +18,7 @@ type Project struct {
 
 // ListProjects returns all project names (for backward compatibility).
 func (s *Store) ListProjects(ctx context.Context) ([]string, error) {
-	rows, err := s.pool.Query(ctx, "SELECT name FROM projects ORDER BY name")
+	rows, err := s.pool.Query(ctx, "SELECT name FROM projects WHERE deleted_at IS NULL ORDER BY name")
 	if err != nil {
 		return nil, fmt.Errorf("list projects: %w", err)
 	}
@@ -38,12 +39,12 @@ func (s *Store) ListProjects(ctx context.Context) ([]string, error) {
 func (s *Store) ListProjectsFull(ctx context.Context, params PaginationParams) (*PaginatedResult[Project], error) {
 	// Count total
 	var total int
-	countQuery := "SELECT COUNT(*) FROM projects"
+	countQuery := "SELECT COUNT(*) FROM projects WHERE deleted_at IS NULL"
 	args := []interface{}{}
 	argIdx := 1
 
 	if params.Search != "" {
-		countQuery += fmt.Sprintf(" WHERE name ILIKE $%d", argIdx)
+		countQuery += fmt.Sprintf(" AND name ILIKE $%d", argIdx)
 		args = append(args, "%"+params.Search+"%")
 		argIdx++
 	}
@@ -53,12 +54,12 @@ func (s *Store) ListProjectsFull(ctx context.Context, params PaginationParams) (
 	}
 
 	// Query with pagination
-	query := "SELECT id, name, COALESCE(description, ''), created_at, updated_at FROM projects"
+	query := "SELECT id, name, COALESCE(description, ''), created_at, updated_at FROM projects WHERE deleted_at IS NULL"
 	queryArgs := []interface{}{}
 	queryArgIdx := 1
 
 	if params.Search != "" {
-		query += fmt.Sprintf(" WHERE name ILIKE $%d", queryArgIdx)
+		query += fmt.Sprintf(" AND name ILIKE $%d", queryArgIdx)
 		queryArgs = append(queryArgs, "%"+params.Search+"%")
 		queryArgIdx++
 	}
@@ -94,13 +95,7 @@ func (s *Store) ListProjectsFull(ctx context.Context, params PaginationParams) (
 		projects = []Project{}
 	}
 
-	return &PaginatedResult[Project]{
-		Data:       projects,
-		Total:      total,
-		Page:       params.Page,
-		PageSize:   params.Limit(),
-		TotalPages: TotalPages(total, params.Limit()),
-	}, nil
+	return NewPaginatedResult(projects, total, params), nil
 }
 
 // GetProject returns a project by name.
@@ -155,3 +150,33 @@ func (s *Store) ProjectExists(ctx context.Context, name string) (bool, error) {
 	err := s.pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM projects WHERE name = $1)", name).Scan(&exists)
 	return exists, err
 }
+
+// GetProjectMeta returns a project's raw meta JSON, or nil if unset. It returns
+// pgx.ErrNoRows if the project does not exist.
+func (s *Store) GetProjectMeta(ctx context.Context, name string) (json.RawMessage, error) {
+	var meta json.RawMessage
+	err := s.pool.QueryRow(ctx, "SELECT meta FROM projects WHERE name = $1", name).Scan(&meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.openConfig(&meta, ProjectMetaSecretFields); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// SetProjectMeta replaces a project's meta JSON.
+func (s *Store) SetProjectMeta(ctx context.Context, name string, meta json.RawMessage) error {
+	meta, err := s.sealConfig(meta, ProjectMetaSecretFields)
+	if err != nil {
+		return err
+	}
+	tag, err := s.pool.Exec(ctx, "UPDATE projects SET meta = $2, updated_at = now() WHERE name = $1", name, meta)
+	if err != nil {
+		return fmt.Errorf("set project meta: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("project not found")
+	}
+	return nil
+}
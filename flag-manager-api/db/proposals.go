@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Proposal is a pull request opened for a proposed flag change, tracked until
+// it is merged or closed.
+type Proposal struct {
+	ID            string     `json:"id"`
+	Project       string     `json:"project"`
+	FlagKey       string     `json:"flagKey"`
+	Action        string     `json:"action"`
+	IntegrationID string     `json:"integrationId,omitempty"` // empty for the provider configured through the environment
+	Branch        string     `json:"branch"`
+	BaseBranch    string     `json:"baseBranch"`
+	PRURL         string     `json:"prUrl"`
+	State         string     `json:"state"` // open, merged or closed
+	CreatedBy     string     `json:"createdBy,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	ResolvedAt    *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// ProposalFilter selects proposals; empty fields match everything.
+type ProposalFilter struct {
+	Project string
+	FlagKey string
+	State   string
+}
+
+const proposalColumns = `id, project, flag_key, action, integration_id, branch, base_branch, pr_url, state,
+	COALESCE(created_by, ''), created_at, updated_at, resolved_at`
+
+// CreateProposal records a proposal and returns it with its ID and timestamps.
+func (s *Store) CreateProposal(ctx context.Context, p Proposal) (*Proposal, error) {
+	if p.State == "" {
+		p.State = "open"
+	}
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO proposals (project, flag_key, action, integration_id, branch, base_branch, pr_url, state, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING id, created_at, updated_at`,
+		p.Project, p.FlagKey, p.Action, p.IntegrationID, p.Branch, p.BaseBranch, p.PRURL, p.State, p.CreatedBy,
+	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("create proposal: %w", err)
+	}
+	return &p, nil
+}
+
+// ListProposals returns the proposals matching filter, newest first.
+func (s *Store) ListProposals(ctx context.Context, filter ProposalFilter) ([]Proposal, error) {
+	where := "WHERE 1=1"
+	args := []interface{}{}
+	if filter.Project != "" {
+		args = append(args, filter.Project)
+		where += fmt.Sprintf(" AND project = $%d", len(args))
+	}
+	if filter.FlagKey != "" {
+		args = append(args, filter.FlagKey)
+		where += fmt.Sprintf(" AND flag_key = $%d", len(args))
+	}
+	if filter.State != "" {
+		args = append(args, filter.State)
+		where += fmt.Sprintf(" AND state = $%d", len(args))
+	}
+
+	rows, err := s.pool.Query(ctx, "SELECT "+proposalColumns+" FROM proposals "+where+" ORDER BY created_at DESC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("list proposals: %w", err)
+	}
+	defer rows.Close()
+
+	proposals := []Proposal{}
+	for rows.Next() {
+		var p Proposal
+		if err := rows.Scan(&p.ID, &p.Project, &p.FlagKey, &p.Action, &p.IntegrationID, &p.Branch, &p.BaseBranch,
+			&p.PRURL, &p.State, &p.CreatedBy, &p.CreatedAt, &p.UpdatedAt, &p.ResolvedAt); err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, p)
+	}
+	return proposals, rows.Err()
+}
+
+// UpdateProposalState sets the state of a proposal. Leaving the open state
+// records when the proposal was resolved.
+func (s *Store) UpdateProposalState(ctx context.Context, id, state string) error {
+	_, err := s.pool.Exec(ctx,
+		`UPDATE proposals SET state = $2, updated_at = now(),
+		 resolved_at = CASE WHEN $2 = 'open' THEN NULL ELSE COALESCE(resolved_at, now()) END
+		 WHERE id = $1`,
+		id, state,
+	)
+	if err != nil {
+		return fmt.Errorf("update proposal: %w", err)
+	}
+	return nil
+}
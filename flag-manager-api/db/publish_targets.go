@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PublishTarget is an object storage location the rendered flags file is
+// written to on every change: an S3 bucket, a GCS bucket, or an Azure Blob
+// Storage container.
+type PublishTarget struct {
+	ID        string              `json:"id"`
+	Name      string              `json:"name"`
+	Kind      string              `json:"kind"` // s3, gcs or azblob
+	Enabled   bool                `json:"enabled"`
+	Config    PublishTargetConfig `json:"config"`
+	CreatedAt time.Time           `json:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt"`
+}
+
+// PublishTargetConfig holds the settings of a publish target; which apply
+// depends on its kind.
+type PublishTargetConfig struct {
+	Object   string `json:"object"`             // path of the flags file in the bucket or container
+	Format   string `json:"format,omitempty"`   // yaml (default), json or toml
+	Project  string `json:"project,omitempty"`  // publishes one project; all projects when empty
+	Endpoint string `json:"endpoint,omitempty"` // overrides the service URL, e.g. for MinIO or Azurite
+
+	Bucket          string `json:"bucket,omitempty"`          // s3 and gcs
+	Region          string `json:"region,omitempty"`          // s3
+	AccessKeyID     string `json:"accessKeyId,omitempty"`     // s3
+	SecretAccessKey string `json:"secretAccessKey,omitempty"` // s3
+	SessionToken    string `json:"sessionToken,omitempty"`    // s3
+
+	ServiceAccountKey string `json:"serviceAccountKey,omitempty"` // gcs: JSON key; the metadata server is used without one
+
+	AccountName string `json:"accountName,omitempty"` // azblob
+	AccountKey  string `json:"accountKey,omitempty"`  // azblob: shared key
+	SASToken    string `json:"sasToken,omitempty"`    // azblob: instead of the shared key
+	Container   string `json:"container,omitempty"`   // azblob
+}
+
+const publishTargetColumns = `id, name, kind, enabled, config, created_at, updated_at`
+
+func (s *Store) scanPublishTarget(row pgx.Row) (*PublishTarget, error) {
+	var t PublishTarget
+	var config json.RawMessage
+	if err := row.Scan(&t.ID, &t.Name, &t.Kind, &t.Enabled, &config, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := s.openConfig(&config, PublishTargetSecretFields); err != nil {
+		return nil, fmt.Errorf("publish target %s: %w", t.Name, err)
+	}
+	if err := json.Unmarshal(config, &t.Config); err != nil {
+		return nil, fmt.Errorf("parse config of publish target %s: %w", t.Name, err)
+	}
+	return &t, nil
+}
+
+// ListPublishTargets returns all publish targets ordered by name.
+func (s *Store) ListPublishTargets(ctx context.Context) ([]PublishTarget, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+publishTargetColumns+" FROM publish_targets ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list publish targets: %w", err)
+	}
+	defer rows.Close()
+
+	targets := []PublishTarget{}
+	for rows.Next() {
+		target, err := s.scanPublishTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, *target)
+	}
+	return targets, rows.Err()
+}
+
+// GetPublishTarget returns a publish target, or pgx.ErrNoRows.
+func (s *Store) GetPublishTarget(ctx context.Context, id string) (*PublishTarget, error) {
+	return s.scanPublishTarget(s.pool.QueryRow(ctx, "SELECT "+publishTargetColumns+" FROM publish_targets WHERE id = $1", id))
+}
+
+// CreatePublishTarget stores a publish target and returns it with its ID and
+// timestamps.
+func (s *Store) CreatePublishTarget(ctx context.Context, target PublishTarget) (*PublishTarget, error) {
+	config, err := json.Marshal(target.Config)
+	if err != nil {
+		return nil, err
+	}
+	if config, err = s.sealConfig(config, PublishTargetSecretFields); err != nil {
+		return nil, err
+	}
+	created, err := s.scanPublishTarget(s.pool.QueryRow(ctx,
+		`INSERT INTO publish_targets (name, kind, enabled, config)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+publishTargetColumns,
+		target.Name, target.Kind, target.Enabled, config,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create publish target: %w", err)
+	}
+	return created, nil
+}
+
+// UpdatePublishTarget replaces a publish target, or returns pgx.ErrNoRows.
+func (s *Store) UpdatePublishTarget(ctx context.Context, id string, target PublishTarget) (*PublishTarget, error) {
+	config, err := json.Marshal(target.Config)
+	if err != nil {
+		return nil, err
+	}
+	if config, err = s.sealConfig(config, PublishTargetSecretFields); err != nil {
+		return nil, err
+	}
+	updated, err := s.scanPublishTarget(s.pool.QueryRow(ctx,
+		`UPDATE publish_targets SET name = $1, kind = $2, enabled = $3, config = $4, updated_at = now()
+		 WHERE id = $5
+		 RETURNING `+publishTargetColumns,
+		target.Name, target.Kind, target.Enabled, config, id,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update publish target: %w", err)
+	}
+	return updated, nil
+}
+
+// DeletePublishTarget deletes a publish target, or returns pgx.ErrNoRows.
+func (s *Store) DeletePublishTarget(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM publish_targets WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete publish target: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
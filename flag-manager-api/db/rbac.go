@@ -26,13 +26,58 @@ type Role struct {
 	UpdatedAt   time.Time    `json:"updatedAt"`
 }
 
+// Grants reports whether the role allows action on resource.
+func (r Role) Grants(resource, action string) bool {
+	for _, perm := range r.Permissions {
+		if perm.Resource == "*" || perm.Resource == resource {
+			for _, a := range perm.Actions {
+				if a == action || a == "*" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// RoleAssignment gives a role to a user on every resource or, when Project or
+// FlagSet is set, only within that project or flag set.
+type RoleAssignment struct {
+	RoleID  string `json:"roleId"`
+	Project string `json:"project,omitempty"`
+	FlagSet string `json:"flagSet,omitempty"` // flag set ID
+}
+
+// ScopedRole is a role assigned to a user with the scope of the assignment.
+type ScopedRole struct {
+	Role
+	Project string `json:"project,omitempty"`
+	FlagSet string `json:"flagSet,omitempty"`
+}
+
+// Global reports whether the role applies to every resource.
+func (r ScopedRole) Global() bool {
+	return r.Project == "" && r.FlagSet == ""
+}
+
+// GrantsIn reports whether the role allows action on resource within a
+// project or flag set. Global roles apply everywhere, scoped roles only in
+// their own project or flag set; a request outside any project or flag set
+// is only granted by global roles.
+func (r ScopedRole) GrantsIn(resource, action, project, flagSetID string) bool {
+	inScope := r.Global() ||
+		(r.Project != "" && r.Project == project) ||
+		(r.FlagSet != "" && r.FlagSet == flagSetID)
+	return inScope && r.Grants(resource, action)
+}
+
 // UserWithRoles represents a user with their assigned roles.
 type UserWithRoles struct {
-	UserID     string    `json:"userId"`
-	Email      string    `json:"email,omitempty"`
-	Name       string    `json:"name,omitempty"`
-	Roles      []Role    `json:"roles"`
-	LastActive time.Time `json:"lastActive,omitempty"`
+	UserID     string       `json:"userId"`
+	Email      string       `json:"email,omitempty"`
+	Name       string       `json:"name,omitempty"`
+	Roles      []ScopedRole `json:"roles"`
+	LastActive time.Time    `json:"lastActive,omitempty"`
 }
 
 // ListRoles returns all roles.
@@ -186,37 +231,47 @@ func (s *Store) ListUsers(ctx context.Context) ([]UserWithRoles, error) {
 	return users, nil
 }
 
-// GetUserRoles returns roles assigned to a user.
-func (s *Store) GetUserRoles(ctx context.Context, userID string) ([]Role, error) {
+// GetUserRoles returns roles assigned to a user, global roles first.
+func (s *Store) GetUserRoles(ctx context.Context, userID string) ([]ScopedRole, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT r.id, r.name, COALESCE(r.description, ''), r.permissions, r.is_builtin, r.created_at, r.updated_at
+		`SELECT r.id, r.name, COALESCE(r.description, ''), r.permissions, r.is_builtin, r.created_at, r.updated_at,
+		        ur.project, ur.flag_set_id
 		 FROM roles r
 		 INNER JOIN user_roles ur ON r.id = ur.role_id
 		 WHERE ur.user_id = $1
-		 ORDER BY r.name`, userID)
+		 ORDER BY ur.project, ur.flag_set_id, r.name`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("get user roles: %w", err)
 	}
 	defer rows.Close()
 
-	var roles []Role
+	var roles []ScopedRole
 	for rows.Next() {
-		var r Role
+		var r ScopedRole
 		var permsJSON []byte
-		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &permsJSON, &r.IsBuiltin, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.Name, &r.Description, &permsJSON, &r.IsBuiltin, &r.CreatedAt, &r.UpdatedAt, &r.Project, &r.FlagSet); err != nil {
 			return nil, err
 		}
 		json.Unmarshal(permsJSON, &r.Permissions)
 		roles = append(roles, r)
 	}
 	if roles == nil {
-		roles = []Role{}
+		roles = []ScopedRole{}
 	}
 	return roles, nil
 }
 
-// SetUserRoles replaces all roles for a user.
+// SetUserRoles replaces all roles for a user with the given global roles.
 func (s *Store) SetUserRoles(ctx context.Context, userID string, roleIDs []string) error {
+	assignments := make([]RoleAssignment, len(roleIDs))
+	for i, roleID := range roleIDs {
+		assignments[i] = RoleAssignment{RoleID: roleID}
+	}
+	return s.SetUserRoleAssignments(ctx, userID, assignments)
+}
+
+// SetUserRoleAssignments replaces all roles for a user, global and scoped.
+func (s *Store) SetUserRoleAssignments(ctx context.Context, userID string, assignments []RoleAssignment) error {
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
@@ -230,32 +285,42 @@ func (s *Store) SetUserRoles(ctx context.Context, userID string, roleIDs []strin
 	}
 
 	// Insert new roles
-	for _, roleID := range roleIDs {
-		_, err = tx.Exec(ctx, "INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2)", userID, roleID)
+	for _, a := range assignments {
+		_, err = tx.Exec(ctx,
+			"INSERT INTO user_roles (user_id, role_id, project, flag_set_id) VALUES ($1, $2, $3, $4)",
+			userID, a.RoleID, a.Project, a.FlagSet)
 		if err != nil {
-			return fmt.Errorf("assign role %s: %w", roleID, err)
+			return fmt.Errorf("assign role %s: %w", a.RoleID, err)
 		}
 	}
 
 	return tx.Commit(ctx)
 }
 
-// HasPermission checks if a user has a specific permission.
+// CountRoleAssignments returns the number of roles assigned to users.
+func (s *Store) CountRoleAssignments(ctx context.Context) (int, error) {
+	var n int
+	err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM user_roles").Scan(&n)
+	return n, err
+}
+
+// HasPermission checks if a user has a specific permission through a global
+// role.
 func (s *Store) HasPermission(ctx context.Context, userID, resource, action string) (bool, error) {
+	return s.HasScopedPermission(ctx, userID, resource, action, "", "")
+}
+
+// HasScopedPermission checks if a user has a specific permission within a
+// project or flag set, through a global role or one assigned there.
+func (s *Store) HasScopedPermission(ctx context.Context, userID, resource, action, project, flagSetID string) (bool, error) {
 	roles, err := s.GetUserRoles(ctx, userID)
 	if err != nil {
 		return false, err
 	}
 
 	for _, role := range roles {
-		for _, perm := range role.Permissions {
-			if perm.Resource == "*" || perm.Resource == resource {
-				for _, a := range perm.Actions {
-					if a == action || a == "*" {
-						return true, nil
-					}
-				}
-			}
+		if role.GrantsIn(resource, action, project, flagSetID) {
+			return true, nil
 		}
 	}
 
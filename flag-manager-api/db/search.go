@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// FlagSearchHit is a project or flag set flag matching a search.
+type FlagSearchHit struct {
+	Project     string // empty for flag set flags
+	FlagSetID   string
+	FlagSetName string
+	Key         string
+	Config      json.RawMessage
+	Rank        float64
+}
+
+// SearchFlags runs a full-text search for flags of every project and flag set
+// matching all terms, as word prefixes, and returns the best ranked first. It
+// relies on PostgreSQL text search and is not available with SQLite.
+func (s *Store) SearchFlags(ctx context.Context, terms []string, limit int) ([]FlagSearchHit, error) {
+	if s.sqlite {
+		return nil, fmt.Errorf("full-text search requires PostgreSQL")
+	}
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = "'" + strings.ReplaceAll(term, "'", "''") + "':*"
+	}
+
+	rows, err := s.pool.Query(ctx,
+		`WITH q AS (SELECT to_tsquery('simple', $1) AS query)
+		 SELECT p.name, '', '', f.key, f.config, ts_rank(f.search_vector, q.query) AS rank
+		 FROM flags f JOIN projects p ON p.id = f.project_id AND p.deleted_at IS NULL, q
+		 WHERE f.search_vector @@ q.query
+		 UNION ALL
+		 SELECT '', fs.id::text, fs.name, fsf.key, fsf.config, ts_rank(fsf.search_vector, q.query) AS rank
+		 FROM flag_set_flags fsf JOIN flag_sets fs ON fs.id = fsf.flag_set_id, q
+		 WHERE fsf.search_vector @@ q.query
+		 ORDER BY rank DESC, 1, 3, 4
+		 LIMIT $2`,
+		strings.Join(prefixes, " & "), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search flags: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []FlagSearchHit
+	for rows.Next() {
+		var h FlagSearchHit
+		var config []byte
+		var rank float32
+		if err := rows.Scan(&h.Project, &h.FlagSetID, &h.FlagSetName, &h.Key, &config, &rank); err != nil {
+			return nil, err
+		}
+		h.Config = json.RawMessage(config)
+		h.Rank = float64(rank)
+		hits = append(hits, h)
+	}
+	return hits, rows.Err()
+}
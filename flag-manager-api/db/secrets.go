@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"flag-manager-api/secrets"
+)
+
+// The JSON fields holding secrets in the config of each kind of resource,
+// encrypted at rest once a cipher is set. The file stores encrypt the same
+// fields in their files.
+var (
+	IntegrationSecretFields   = []string{"adoPat", "gitlabToken", "githubToken", "bitbucketAppPassword", "giteaToken", "jiraApiToken", "webhookSecret"}
+	NotifierSecretFields      = []string{"secret", "routingKey", "apiKey", "smtpPassword"}
+	ExporterSecretFields      = []string{"secret", "azureAccountKey"}
+	RetrieverSecretFields     = []string{"azureAccountKey", "githubToken", "gitlabToken", "bitbucketToken", "redisPassword", "mongodbUri"}
+	AuditSinkSecretFields     = []string{"secret"}
+	PublishTargetSecretFields = []string{"secretAccessKey", "sessionToken", "serviceAccountKey", "accountKey", "sasToken"}
+	ProjectMetaSecretFields   = []string{"secret"} // the signing secrets of the project webhooks
+)
+
+// secretColumns are the JSON columns holding secrets, by table.
+var secretColumns = []struct {
+	table, key, column string
+	fields             []string
+}{
+	{"integrations", "id", "config", IntegrationSecretFields},
+	{"notifiers", "id", "config", NotifierSecretFields},
+	{"exporters", "id", "config", ExporterSecretFields},
+	{"retrievers", "id", "config", RetrieverSecretFields},
+	{"audit_sinks", "id", "config", AuditSinkSecretFields},
+	{"publish_targets", "id", "config", PublishTargetSecretFields},
+	{"projects", "name", "meta", ProjectMetaSecretFields},
+}
+
+// SetCipher makes the store encrypt the secrets of the configs it writes with
+// c, and decrypt those it reads. Secrets written before are read as they are
+// until RotateSecrets encrypts them.
+func (s *Store) SetCipher(c *secrets.Cipher) {
+	s.cipher = c
+}
+
+// sealConfig encrypts the secret fields of a config before it is written.
+func (s *Store) sealConfig(config []byte, fields []string) ([]byte, error) {
+	sealed, _, err := s.cipher.SealJSON(config, fields)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt secrets: %w", err)
+	}
+	return sealed, nil
+}
+
+// openConfig decrypts the secret fields of a config read from the database.
+func (s *Store) openConfig(config *json.RawMessage, fields []string) error {
+	opened, err := s.cipher.OpenJSON(*config, fields)
+	if err != nil {
+		return fmt.Errorf("decrypt secrets: %w", err)
+	}
+	*config = opened
+	return nil
+}
+
+// RotateSecrets encrypts with the primary key of the cipher the secrets still
+// in plaintext or encrypted with an older key, in one transaction. It returns
+// how many it encrypted, by table.
+func (s *Store) RotateSecrets(ctx context.Context) (map[string]int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rotated := make(map[string]int, len(secretColumns))
+	for _, c := range secretColumns {
+		rows, err := tx.Query(ctx, fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IS NOT NULL", c.key, c.column, c.table, c.column))
+		if err != nil {
+			return nil, fmt.Errorf("rotate secrets of %s: %w", c.table, err)
+		}
+		type row struct {
+			key    string
+			config []byte
+		}
+		var all []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.key, &r.config); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("rotate secrets of %s: %w", c.table, err)
+			}
+			all = append(all, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("rotate secrets of %s: %w", c.table, err)
+		}
+
+		for _, r := range all {
+			sealed, n, err := s.cipher.SealJSON(r.config, c.fields)
+			if err != nil {
+				return nil, fmt.Errorf("rotate secrets of %s %s: %w", c.table, r.key, err)
+			}
+			if n == 0 {
+				continue
+			}
+			if _, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET %s = $1 WHERE %s = $2", c.table, c.column, c.key), sealed, r.key); err != nil {
+				return nil, fmt.Errorf("rotate secrets of %s %s: %w", c.table, r.key, err)
+			}
+			rotated[c.table] += n
+		}
+	}
+	return rotated, tx.Commit(ctx)
+}
@@ -15,6 +15,7 @@ type Segment struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description,omitempty"`
 	Rules       []string `json:"rules"`
+	Version     int      `json:"version"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
 }
@@ -36,7 +37,7 @@ func (s *Store) ListSegments(ctx context.Context, params PaginationParams) (*Pag
 		return nil, fmt.Errorf("count segments: %w", err)
 	}
 
-	query := `SELECT id, name, COALESCE(description, ''), rules, created_at, updated_at
+	query := `SELECT id, name, COALESCE(description, ''), rules, created_at, updated_at, ` + segmentVersionColumn + `
 	          FROM segments ` + where
 	query += fmt.Sprintf(" ORDER BY name ASC")
 	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
@@ -52,7 +53,7 @@ func (s *Store) ListSegments(ctx context.Context, params PaginationParams) (*Pag
 	for rows.Next() {
 		var seg Segment
 		var rulesJSON []byte
-		if err := rows.Scan(&seg.ID, &seg.Name, &seg.Description, &rulesJSON, &seg.CreatedAt, &seg.UpdatedAt); err != nil {
+		if err := rows.Scan(&seg.ID, &seg.Name, &seg.Description, &rulesJSON, &seg.CreatedAt, &seg.UpdatedAt, &seg.Version); err != nil {
 			return nil, err
 		}
 		json.Unmarshal(rulesJSON, &seg.Rules)
@@ -62,13 +63,7 @@ func (s *Store) ListSegments(ctx context.Context, params PaginationParams) (*Pag
 		segments = []Segment{}
 	}
 
-	return &PaginatedResult[Segment]{
-		Data:       segments,
-		Total:      total,
-		Page:       params.Page,
-		PageSize:   params.Limit(),
-		TotalPages: TotalPages(total, params.Limit()),
-	}, nil
+	return NewPaginatedResult(segments, total, params), nil
 }
 
 // GetSegment returns a segment by ID.
@@ -76,9 +71,9 @@ func (s *Store) GetSegment(ctx context.Context, id string) (*Segment, error) {
 	var seg Segment
 	var rulesJSON []byte
 	err := s.pool.QueryRow(ctx,
-		`SELECT id, name, COALESCE(description, ''), rules, created_at, updated_at
+		`SELECT id, name, COALESCE(description, ''), rules, created_at, updated_at, ` + segmentVersionColumn + `
 		 FROM segments WHERE id = $1`, id,
-	).Scan(&seg.ID, &seg.Name, &seg.Description, &rulesJSON, &seg.CreatedAt, &seg.UpdatedAt)
+	).Scan(&seg.ID, &seg.Name, &seg.Description, &rulesJSON, &seg.CreatedAt, &seg.UpdatedAt, &seg.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -91,9 +86,9 @@ func (s *Store) GetSegmentByName(ctx context.Context, name string) (*Segment, er
 	var seg Segment
 	var rulesJSON []byte
 	err := s.pool.QueryRow(ctx,
-		`SELECT id, name, COALESCE(description, ''), rules, created_at, updated_at
+		`SELECT id, name, COALESCE(description, ''), rules, created_at, updated_at, ` + segmentVersionColumn + `
 		 FROM segments WHERE name = $1`, name,
-	).Scan(&seg.ID, &seg.Name, &seg.Description, &rulesJSON, &seg.CreatedAt, &seg.UpdatedAt)
+	).Scan(&seg.ID, &seg.Name, &seg.Description, &rulesJSON, &seg.CreatedAt, &seg.UpdatedAt, &seg.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -101,16 +96,23 @@ func (s *Store) GetSegmentByName(ctx context.Context, name string) (*Segment, er
 	return &seg, nil
 }
 
-// CreateSegment creates a new segment.
-func (s *Store) CreateSegment(ctx context.Context, seg Segment) (*Segment, error) {
+// CreateSegment creates a new segment with its first version, authored by
+// author.
+func (s *Store) CreateSegment(ctx context.Context, seg Segment, author string) (*Segment, error) {
 	rulesJSON, err := json.Marshal(seg.Rules)
 	if err != nil {
 		return nil, fmt.Errorf("marshal rules: %w", err)
 	}
 
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
 	var created Segment
 	var createdRulesJSON []byte
-	err = s.pool.QueryRow(ctx,
+	err = tx.QueryRow(ctx,
 		`INSERT INTO segments (name, description, rules)
 		 VALUES ($1, $2, $3)
 		 RETURNING id, name, COALESCE(description, ''), rules, created_at, updated_at`,
@@ -120,19 +122,33 @@ func (s *Store) CreateSegment(ctx context.Context, seg Segment) (*Segment, error
 		return nil, fmt.Errorf("create segment: %w", err)
 	}
 	json.Unmarshal(createdRulesJSON, &created.Rules)
+
+	if created.Version, err = insertSegmentVersion(ctx, tx, &created, author); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
 	return &created, nil
 }
 
-// UpdateSegment updates an existing segment.
-func (s *Store) UpdateSegment(ctx context.Context, id string, seg Segment) (*Segment, error) {
+// UpdateSegment updates an existing segment and stores the result as a new
+// version, authored by author.
+func (s *Store) UpdateSegment(ctx context.Context, id string, seg Segment, author string) (*Segment, error) {
 	rulesJSON, err := json.Marshal(seg.Rules)
 	if err != nil {
 		return nil, fmt.Errorf("marshal rules: %w", err)
 	}
 
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
 	var updated Segment
 	var updatedRulesJSON []byte
-	err = s.pool.QueryRow(ctx,
+	err = tx.QueryRow(ctx,
 		`UPDATE segments SET name = $1, description = $2, rules = $3, updated_at = now()
 		 WHERE id = $4
 		 RETURNING id, name, COALESCE(description, ''), rules, created_at, updated_at`,
@@ -145,6 +161,13 @@ func (s *Store) UpdateSegment(ctx context.Context, id string, seg Segment) (*Seg
 		return nil, fmt.Errorf("update segment: %w", err)
 	}
 	json.Unmarshal(updatedRulesJSON, &updated.Rules)
+
+	if updated.Version, err = insertSegmentVersion(ctx, tx, &updated, author); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
 	return &updated, nil
 }
 
@@ -159,3 +182,81 @@ func (s *Store) DeleteSegment(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+// segmentVersionColumn selects the current version of a segment.
+const segmentVersionColumn = `(SELECT COALESCE(MAX(version), 0) FROM segment_versions WHERE segment_id = segments.id)`
+
+// SegmentVersion is a snapshot of a segment.
+type SegmentVersion struct {
+	SegmentID   string    `json:"segmentId"`
+	Version     int       `json:"version"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Rules       []string  `json:"rules"`
+	CreatedBy   string    `json:"createdBy,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// insertSegmentVersion stores a snapshot of seg as its next version and
+// returns the version number.
+func insertSegmentVersion(ctx context.Context, tx pgx.Tx, seg *Segment, author string) (int, error) {
+	rulesJSON, err := json.Marshal(seg.Rules)
+	if err != nil {
+		return 0, fmt.Errorf("marshal rules: %w", err)
+	}
+
+	var version int
+	err = tx.QueryRow(ctx,
+		`INSERT INTO segment_versions (segment_id, version, name, description, rules, created_by)
+		 SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5 FROM segment_versions WHERE segment_id = $1
+		 RETURNING version`,
+		seg.ID, seg.Name, nullStr(seg.Description), rulesJSON, nullStr(author),
+	).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("store segment version: %w", err)
+	}
+	return version, nil
+}
+
+// ListSegmentVersions returns the versions of a segment, newest first.
+func (s *Store) ListSegmentVersions(ctx context.Context, id string) ([]SegmentVersion, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT segment_id, version, name, COALESCE(description, ''), rules, COALESCE(created_by, ''), created_at
+		 FROM segment_versions WHERE segment_id = $1
+		 ORDER BY version DESC`, id)
+	if err != nil {
+		return nil, fmt.Errorf("list segment versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []SegmentVersion{}
+	for rows.Next() {
+		v, err := scanSegmentVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+	}
+	return versions, rows.Err()
+}
+
+// GetSegmentVersion returns one version of a segment.
+func (s *Store) GetSegmentVersion(ctx context.Context, id string, version int) (*SegmentVersion, error) {
+	v, err := scanSegmentVersion(s.pool.QueryRow(ctx,
+		`SELECT segment_id, version, name, COALESCE(description, ''), rules, COALESCE(created_by, ''), created_at
+		 FROM segment_versions WHERE segment_id = $1 AND version = $2`, id, version))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("segment version not found")
+	}
+	return v, err
+}
+
+func scanSegmentVersion(row pgx.Row) (*SegmentVersion, error) {
+	var v SegmentVersion
+	var rulesJSON []byte
+	if err := row.Scan(&v.SegmentID, &v.Version, &v.Name, &v.Description, &rulesJSON, &v.CreatedBy, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal(rulesJSON, &v.Rules)
+	return &v, nil
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetSetting returns the raw JSON value stored under key, or nil if unset.
+func (s *Store) GetSetting(ctx context.Context, key string) (json.RawMessage, error) {
+	var value []byte
+	err := s.pool.QueryRow(ctx, "SELECT value FROM settings WHERE key = $1", key).Scan(&value)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get setting: %w", err)
+	}
+	return value, nil
+}
+
+// SetSetting stores a JSON value under key, replacing any existing value.
+func (s *Store) SetSetting(ctx context.Context, key string, value json.RawMessage) error {
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO settings (key, value, updated_at) VALUES ($1, $2, now())
+		 ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`,
+		key, value)
+	if err != nil {
+		return fmt.Errorf("set setting: %w", err)
+	}
+	return nil
+}
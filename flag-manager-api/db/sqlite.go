@@ -0,0 +1,377 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations_sqlite/*.sql
+var sqliteMigrationsFS embed.FS
+
+// sqliteDriverName is the go-sqlite3 driver with the PostgreSQL functions the
+// store's queries use registered on every connection.
+const sqliteDriverName = "sqlite3_goff"
+
+// sqliteTimeFormat is how timestamps are stored: fixed width in UTC, so that
+// they compare and sort as text.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000-07:00"
+
+// sqliteTimeLayouts are the layouts timestamps are read back with.
+var sqliteTimeLayouts = []string{
+	sqliteTimeFormat,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var (
+	sqlitePlaceholder = regexp.MustCompile(`\$(\d+)`)
+	sqliteILike       = regexp.MustCompile(`\bILIKE\b`)
+	sqliteAtUTC       = regexp.MustCompile(`\s+AT TIME ZONE 'UTC'`)
+)
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(c *sqlite3.SQLiteConn) error {
+			if err := c.RegisterFunc("gen_random_uuid", uuid.NewString, false); err != nil {
+				return err
+			}
+			if err := c.RegisterFunc("now", sqliteNow, false); err != nil {
+				return err
+			}
+			return c.RegisterFunc("date_trunc", sqliteDateTrunc, true)
+		},
+	})
+}
+
+func sqliteNow() string {
+	return time.Now().UTC().Format(sqliteTimeFormat)
+}
+
+// sqliteDateTrunc truncates a stored timestamp to the start of its hour, day,
+// ISO week or month, like PostgreSQL's date_trunc.
+func sqliteDateTrunc(unit, value string) (string, error) {
+	t, err := parseSQLiteTime(value)
+	if err != nil {
+		return "", err
+	}
+	if unit == "hour" {
+		return t.Truncate(time.Hour).Format(sqliteTimeFormat), nil
+	}
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch unit {
+	case "day":
+	case "week":
+		t = t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	case "month":
+		t = t.AddDate(0, 0, 1-t.Day())
+	default:
+		return "", fmt.Errorf("unsupported date_trunc unit: %s", unit)
+	}
+	return t.Format(sqliteTimeFormat), nil
+}
+
+func parseSQLiteTime(value string) (time.Time, error) {
+	for _, layout := range sqliteTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %q", value)
+}
+
+// newSQLiteStore opens the SQLite database of a sqlite://<path> URL, creating
+// it if needed.
+func newSQLiteStore(ctx context.Context, databaseURL string) (*Store, error) {
+	path := strings.TrimPrefix(databaseURL, "sqlite://")
+	if path == "" {
+		return nil, fmt.Errorf("parse database URL: sqlite:// requires a file path")
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	// WAL lets reads run alongside the single writer; writers wait for each
+	// other instead of failing, and transactions take the write lock upfront
+	dsn := "file:" + path + sep + "_foreign_keys=1&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+
+	sqlDB, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+
+	slog.Info("Opened SQLite database", "path", path)
+
+	store := &Store{pool: &sqliteConn{db: sqlDB}, sqlite: true}
+	if err := store.runMigrations(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("run migrations: %w", err)
+	}
+
+	return store, nil
+}
+
+// sqliteQuery rewrites the PostgreSQL syntax used by the store's queries:
+// $n placeholders become ?n, ILIKE becomes LIKE (case-insensitive for ASCII
+// in SQLite) and timestamps are already stored in UTC.
+func sqliteQuery(query string) string {
+	query = sqlitePlaceholder.ReplaceAllString(query, "?$1")
+	query = sqliteILike.ReplaceAllString(query, "LIKE")
+	return sqliteAtUTC.ReplaceAllString(query, "")
+}
+
+// sqliteArgs converts query arguments to the types they are stored as.
+func sqliteArgs(args []any) []any {
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			converted[i] = v.UTC().Format(sqliteTimeFormat)
+		case *time.Time:
+			if v != nil {
+				converted[i] = v.UTC().Format(sqliteTimeFormat)
+			}
+		case json.RawMessage:
+			if v != nil {
+				converted[i] = string(v)
+			}
+		case []byte:
+			if v != nil {
+				converted[i] = string(v)
+			}
+		case []string:
+			if v == nil {
+				v = []string{}
+			}
+			data, _ := json.Marshal(v)
+			converted[i] = string(data)
+		default:
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// sqliteError reports constraint violations like PostgreSQL does, so callers
+// can detect duplicates the same way.
+func sqliteError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return fmt.Errorf("duplicate key value violates unique constraint: %w", err)
+	}
+	return err
+}
+
+// sqliteValue scans columns into the types pgx supports but database/sql does
+// not: timestamps stored as text, JSON and string arrays stored as JSON.
+type sqliteValue struct {
+	dest any
+}
+
+func (v sqliteValue) Scan(src any) error {
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+
+	switch d := v.dest.(type) {
+	case *time.Time:
+		*d = time.Time{}
+		switch s := src.(type) {
+		case time.Time:
+			*d = s.UTC()
+		case string:
+			t, err := parseSQLiteTime(s)
+			if err != nil {
+				return err
+			}
+			*d = t
+		}
+	case **time.Time:
+		*d = nil
+		if src != nil {
+			var t time.Time
+			if err := (sqliteValue{&t}).Scan(src); err != nil {
+				return err
+			}
+			*d = &t
+		}
+	case *json.RawMessage:
+		*d = nil
+		if s, ok := src.(string); ok {
+			*d = json.RawMessage(s)
+		}
+	case *[]string:
+		*d = []string{}
+		if s, ok := src.(string); ok {
+			return json.Unmarshal([]byte(s), d)
+		}
+	}
+	return nil
+}
+
+func sqliteScanDest(dest []any) []any {
+	wrapped := make([]any, len(dest))
+	for i, d := range dest {
+		switch d.(type) {
+		case *time.Time, **time.Time, *json.RawMessage, *[]string:
+			wrapped[i] = sqliteValue{d}
+		default:
+			wrapped[i] = d
+		}
+	}
+	return wrapped
+}
+
+// sqliteExecutor is implemented by *sql.DB and *sql.Tx.
+type sqliteExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func sqliteExec(ctx context.Context, e sqliteExecutor, query string, args []any) (pgconn.CommandTag, error) {
+	result, err := e.ExecContext(ctx, sqliteQuery(query), sqliteArgs(args)...)
+	if err != nil {
+		return pgconn.CommandTag{}, sqliteError(err)
+	}
+	n, _ := result.RowsAffected()
+	verb := "EXEC"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		verb = strings.ToUpper(fields[0])
+	}
+	return pgconn.NewCommandTag(fmt.Sprintf("%s %d", verb, n)), nil
+}
+
+func sqliteQueryRows(ctx context.Context, e sqliteExecutor, query string, args []any) (pgx.Rows, error) {
+	rows, err := e.QueryContext(ctx, sqliteQuery(query), sqliteArgs(args)...)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return &sqliteRows{rows: rows}, nil
+}
+
+func sqliteQueryRow(ctx context.Context, e sqliteExecutor, query string, args []any) pgx.Row {
+	return sqliteRow{row: e.QueryRowContext(ctx, sqliteQuery(query), sqliteArgs(args)...)}
+}
+
+// sqliteConn runs the store's queries against a SQLite database.
+type sqliteConn struct {
+	db *sql.DB
+}
+
+func (c *sqliteConn) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	return sqliteExec(ctx, c.db, query, args)
+}
+
+func (c *sqliteConn) Query(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	return sqliteQueryRows(ctx, c.db, query, args)
+}
+
+func (c *sqliteConn) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return sqliteQueryRow(ctx, c.db, query, args)
+}
+
+func (c *sqliteConn) Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteTx{tx: tx}, nil
+}
+
+func (c *sqliteConn) Close() {
+	c.db.Close()
+}
+
+// sqliteTx is a SQLite transaction. Only the pgx.Tx methods the store uses
+// are implemented; the others panic.
+type sqliteTx struct {
+	pgx.Tx
+	tx *sql.Tx
+}
+
+func (t *sqliteTx) Exec(ctx context.Context, query string, args ...any) (pgconn.CommandTag, error) {
+	return sqliteExec(ctx, t.tx, query, args)
+}
+
+func (t *sqliteTx) Query(ctx context.Context, query string, args ...any) (pgx.Rows, error) {
+	return sqliteQueryRows(ctx, t.tx, query, args)
+}
+
+func (t *sqliteTx) QueryRow(ctx context.Context, query string, args ...any) pgx.Row {
+	return sqliteQueryRow(ctx, t.tx, query, args)
+}
+
+func (t *sqliteTx) Commit(ctx context.Context) error {
+	return sqliteError(t.tx.Commit())
+}
+
+func (t *sqliteTx) Rollback(ctx context.Context) error {
+	if err := t.tx.Rollback(); err != nil {
+		if errors.Is(err, sql.ErrTxDone) {
+			return pgx.ErrTxClosed
+		}
+		return err
+	}
+	return nil
+}
+
+type sqliteRow struct {
+	row *sql.Row
+}
+
+func (r sqliteRow) Scan(dest ...any) error {
+	err := r.row.Scan(sqliteScanDest(dest)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+	return sqliteError(err)
+}
+
+type sqliteRows struct {
+	rows *sql.Rows
+}
+
+func (r *sqliteRows) Close()                                       { r.rows.Close() }
+func (r *sqliteRows) Err() error                                   { return sqliteError(r.rows.Err()) }
+func (r *sqliteRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *sqliteRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *sqliteRows) Next() bool                                   { return r.rows.Next() }
+func (r *sqliteRows) RawValues() [][]byte                          { return nil }
+func (r *sqliteRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *sqliteRows) Scan(dest ...any) error {
+	return r.rows.Scan(sqliteScanDest(dest)...)
+}
+
+func (r *sqliteRows) Values() ([]any, error) {
+	columns, err := r.rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	return values, r.rows.Scan(dest...)
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// FlagTemplate is a reusable flag skeleton. Strings of its config may contain
+// {{name}} placeholders that are substituted when a flag is created from it.
+type FlagTemplate struct {
+	ID               string                `json:"id"`
+	Name             string                `json:"name"`
+	Description      string                `json:"description,omitempty"`
+	Config           json.RawMessage       `json:"config"`
+	Placeholders     []TemplatePlaceholder `json:"placeholders"`
+	RequiredMetadata []string              `json:"requiredMetadata"` // metadata keys flags created from the template must set
+	CreatedBy        string                `json:"createdBy,omitempty"`
+	CreatedAt        time.Time             `json:"createdAt"`
+	UpdatedAt        time.Time             `json:"updatedAt"`
+}
+
+// TemplatePlaceholder is a value supplied when a flag is created from a
+// template.
+type TemplatePlaceholder struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+const flagTemplateColumns = `id, name, COALESCE(description, ''), config, placeholders, required_metadata,
+	COALESCE(created_by, ''), created_at, updated_at`
+
+func scanFlagTemplate(row pgx.Row) (*FlagTemplate, error) {
+	var t FlagTemplate
+	var config, placeholders, requiredMetadata []byte
+	if err := row.Scan(&t.ID, &t.Name, &t.Description, &config, &placeholders, &requiredMetadata,
+		&t.CreatedBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	t.Config = json.RawMessage(config)
+	if err := json.Unmarshal(placeholders, &t.Placeholders); err != nil {
+		return nil, fmt.Errorf("parse placeholders of template %s: %w", t.Name, err)
+	}
+	if err := json.Unmarshal(requiredMetadata, &t.RequiredMetadata); err != nil {
+		return nil, fmt.Errorf("parse required metadata of template %s: %w", t.Name, err)
+	}
+	return &t, nil
+}
+
+// templateLists encodes the placeholders and required metadata of a template,
+// as empty arrays rather than null.
+func templateLists(t FlagTemplate) (placeholders, requiredMetadata []byte, err error) {
+	if t.Placeholders == nil {
+		t.Placeholders = []TemplatePlaceholder{}
+	}
+	if t.RequiredMetadata == nil {
+		t.RequiredMetadata = []string{}
+	}
+	if placeholders, err = json.Marshal(t.Placeholders); err != nil {
+		return nil, nil, err
+	}
+	requiredMetadata, err = json.Marshal(t.RequiredMetadata)
+	return placeholders, requiredMetadata, err
+}
+
+// ListFlagTemplates returns all flag templates ordered by name.
+func (s *Store) ListFlagTemplates(ctx context.Context) ([]FlagTemplate, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+flagTemplateColumns+" FROM flag_templates ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list flag templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []FlagTemplate{}
+	for rows.Next() {
+		t, err := scanFlagTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *t)
+	}
+	return templates, rows.Err()
+}
+
+// GetFlagTemplate returns a flag template, or pgx.ErrNoRows.
+func (s *Store) GetFlagTemplate(ctx context.Context, id string) (*FlagTemplate, error) {
+	return scanFlagTemplate(s.pool.QueryRow(ctx, "SELECT "+flagTemplateColumns+" FROM flag_templates WHERE id = $1", id))
+}
+
+// CreateFlagTemplate stores a flag template and returns it with its ID and
+// timestamps.
+func (s *Store) CreateFlagTemplate(ctx context.Context, t FlagTemplate) (*FlagTemplate, error) {
+	placeholders, requiredMetadata, err := templateLists(t)
+	if err != nil {
+		return nil, err
+	}
+	created, err := scanFlagTemplate(s.pool.QueryRow(ctx,
+		`INSERT INTO flag_templates (name, description, config, placeholders, required_metadata, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 RETURNING `+flagTemplateColumns,
+		t.Name, nullStr(t.Description), []byte(t.Config), placeholders, requiredMetadata, nullStr(t.CreatedBy),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create flag template: %w", err)
+	}
+	return created, nil
+}
+
+// UpdateFlagTemplate replaces a flag template, or returns pgx.ErrNoRows.
+func (s *Store) UpdateFlagTemplate(ctx context.Context, id string, t FlagTemplate) (*FlagTemplate, error) {
+	placeholders, requiredMetadata, err := templateLists(t)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := scanFlagTemplate(s.pool.QueryRow(ctx,
+		`UPDATE flag_templates SET name = $1, description = $2, config = $3, placeholders = $4,
+		 required_metadata = $5, updated_at = now()
+		 WHERE id = $6
+		 RETURNING `+flagTemplateColumns,
+		t.Name, nullStr(t.Description), []byte(t.Config), placeholders, requiredMetadata, id,
+	))
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update flag template: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteFlagTemplate deletes a flag template, or returns pgx.ErrNoRows.
+func (s *Store) DeleteFlagTemplate(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM flag_templates WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete flag template: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// TrashedProject is a deleted project in the trash. Its row keeps its ID and
+// flags, renamed so that it is out of the way of live projects.
+type TrashedProject struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Flags     int       `json:"flags"`
+	DeletedAt time.Time `json:"deletedAt"`
+	DeletedBy string    `json:"deletedBy,omitempty"`
+}
+
+const trashedProjectColumns = `p.id, p.deleted_name, (SELECT COUNT(*) FROM flags f WHERE f.project_id = p.id), p.deleted_at, COALESCE(p.deleted_by, '')`
+
+func scanTrashedProject(row pgx.Row) (*TrashedProject, error) {
+	var p TrashedProject
+	if err := row.Scan(&p.ID, &p.Name, &p.Flags, &p.DeletedAt, &p.DeletedBy); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// TrashProject moves a project to the trash, or returns pgx.ErrNoRows.
+func (s *Store) TrashProject(ctx context.Context, name, deletedBy string) (*TrashedProject, error) {
+	// Project names start with an alphanumeric, so the trashed name is
+	// never taken
+	var id string
+	err := s.pool.QueryRow(ctx,
+		`UPDATE projects SET deleted_name = name, name = $2, deleted_at = now(), deleted_by = $3, updated_at = now()
+		 WHERE name = $1 AND deleted_at IS NULL
+		 RETURNING id`,
+		name, "."+uuid.NewString(), deletedBy,
+	).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("trash project: %w", err)
+	}
+	return s.GetTrashedProject(ctx, id)
+}
+
+// ListTrashedProjects returns the projects in the trash, most recently
+// deleted first.
+func (s *Store) ListTrashedProjects(ctx context.Context) ([]TrashedProject, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT `+trashedProjectColumns+` FROM projects p
+		 WHERE p.deleted_at IS NOT NULL
+		 ORDER BY p.deleted_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list trashed projects: %w", err)
+	}
+	defer rows.Close()
+
+	projects := []TrashedProject{}
+	for rows.Next() {
+		p, err := scanTrashedProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, *p)
+	}
+	return projects, rows.Err()
+}
+
+// GetTrashedProject returns a project in the trash, or pgx.ErrNoRows.
+func (s *Store) GetTrashedProject(ctx context.Context, id string) (*TrashedProject, error) {
+	return scanTrashedProject(s.pool.QueryRow(ctx,
+		`SELECT `+trashedProjectColumns+` FROM projects p
+		 WHERE p.id = $1 AND p.deleted_at IS NOT NULL`,
+		id,
+	))
+}
+
+// ProjectInTrash reports whether a project with this name is in the trash.
+func (s *Store) ProjectInTrash(ctx context.Context, name string) (bool, error) {
+	var exists bool
+	err := s.pool.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM projects WHERE deleted_name = $1 AND deleted_at IS NOT NULL)", name).Scan(&exists)
+	return exists, err
+}
+
+// RestoreProject takes a project out of the trash under its name, or returns
+// pgx.ErrNoRows. The name must not have been taken since.
+func (s *Store) RestoreProject(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE projects SET name = deleted_name, deleted_name = NULL, deleted_at = NULL, deleted_by = NULL, updated_at = now()
+		 WHERE id = $1 AND deleted_at IS NOT NULL`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("restore project: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// PurgeProject deletes a project in the trash for good, with its flags, or
+// returns pgx.ErrNoRows.
+func (s *Store) PurgeProject(ctx context.Context, id string) error {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM projects WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("purge project: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
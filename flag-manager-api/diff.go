@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigChange describes a single difference between two configs.
+type ConfigChange struct {
+	Path   string      `json:"path"`
+	Op     string      `json:"op"` // added, removed, changed
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// diffConfigs returns the differences between two JSON-compatible values, walking
+// nested objects and arrays. Paths use dot notation with array indexes in brackets,
+// e.g. "targeting[0].percentage.enabled". Changes are sorted by path.
+func diffConfigs(before, after interface{}) ([]ConfigChange, error) {
+	b, err := toGenericValue(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := toGenericValue(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []ConfigChange{}
+	diffValues("", b, a, &changes)
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// rawConfigValue decodes a stored JSON config, treating empty input as nil.
+func rawConfigValue(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func diffValues(path string, before, after interface{}, changes *[]ConfigChange) {
+	switch b := before.(type) {
+	case map[string]interface{}:
+		if a, ok := after.(map[string]interface{}); ok {
+			for k, bv := range b {
+				if av, exists := a[k]; exists {
+					diffValues(joinDiffPath(path, k), bv, av, changes)
+				} else {
+					*changes = append(*changes, ConfigChange{Path: joinDiffPath(path, k), Op: "removed", Before: bv})
+				}
+			}
+			for k, av := range a {
+				if _, exists := b[k]; !exists {
+					*changes = append(*changes, ConfigChange{Path: joinDiffPath(path, k), Op: "added", After: av})
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if a, ok := after.([]interface{}); ok {
+			for i := 0; i < len(b) || i < len(a); i++ {
+				p := path + "[" + strconv.Itoa(i) + "]"
+				switch {
+				case i >= len(a):
+					*changes = append(*changes, ConfigChange{Path: p, Op: "removed", Before: b[i]})
+				case i >= len(b):
+					*changes = append(*changes, ConfigChange{Path: p, Op: "added", After: a[i]})
+				default:
+					diffValues(p, b[i], a[i], changes)
+				}
+			}
+			return
+		}
+	}
+
+	switch {
+	case reflect.DeepEqual(before, after):
+	case before == nil:
+		*changes = append(*changes, ConfigChange{Path: path, Op: "added", After: after})
+	case after == nil:
+		*changes = append(*changes, ConfigChange{Path: path, Op: "removed", Before: before})
+	default:
+		*changes = append(*changes, ConfigChange{Path: path, Op: "changed", Before: before, After: after})
+	}
+}
+
+func joinDiffPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// FlagDrift describes how a flag differs between two sets of flags.
+type FlagDrift struct {
+	Key     string         `json:"key"`
+	Status  string         `json:"status"` // added (right only), removed (left only), changed
+	Changes []ConfigChange `json:"changes,omitempty"`
+}
+
+// diffProjectFlags compares two sets of flags, e.g. a project's flags on the
+// git base branch (base) with the local ones. Changes go from base to local.
+// Results are sorted by flag key.
+func diffProjectFlags(base, local ProjectFlags) ([]FlagDrift, error) {
+	drift := []FlagDrift{}
+
+	for key, localConfig := range local {
+		baseConfig, ok := base[key]
+		if !ok {
+			drift = append(drift, FlagDrift{Key: key, Status: "added"})
+			continue
+		}
+		changes, err := diffConfigs(baseConfig, localConfig)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			drift = append(drift, FlagDrift{Key: key, Status: "changed", Changes: changes})
+		}
+	}
+	for key := range base {
+		if _, ok := local[key]; !ok {
+			drift = append(drift, FlagDrift{Key: key, Status: "removed"})
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Key < drift[j].Key })
+	return drift, nil
+}
+
+// loadDiffSide loads the flags named by a diff side: "project" for a project's
+// own flags, or "project/environment" for the flags it serves in an
+// environment. status is the HTTP status to report when err is set.
+func (fm *FlagManager) loadDiffSide(ctx context.Context, side string) (flags ProjectFlags, status int, err error) {
+	project, env, hasEnv := strings.Cut(side, "/")
+	if project == "" || (hasEnv && env == "") {
+		return nil, http.StatusBadRequest, fmt.Errorf("%q must be project or project/environment", side)
+	}
+
+	if !hasEnv {
+		flags, err = fm.loadStoredProjectFlags(ctx, project)
+	} else {
+		envs, ok, envErr := fm.projectEnvironments(ctx, project)
+		if envErr != nil {
+			return nil, http.StatusInternalServerError, envErr
+		}
+		if ok && !hasEnvironment(envs, env) {
+			return nil, http.StatusNotFound, fmt.Errorf("environment not found: %s", side)
+		}
+		flags, _, err = fm.loadEnvironmentFlags(ctx, project, env, false)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if flags == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("project not found: %s", project)
+	}
+	return flags, http.StatusOK, nil
+}
+
+// DiffResponse compares the flags of two projects or project environments.
+type DiffResponse struct {
+	Left      string         `json:"left"`
+	Right     string         `json:"right"`
+	Identical bool           `json:"identical"`
+	Summary   map[string]int `json:"summary"`
+	Flags     []FlagDrift    `json:"flags"`
+}
+
+// diffHandler compares the flags of two projects or project environments,
+// e.g. ?left=shop/prod&right=shop/staging, listing the flags only on either
+// side and the field changes from left to right of the flags on both.
+func (fm *FlagManager) diffHandler(w http.ResponseWriter, r *http.Request) {
+	left := r.URL.Query().Get("left")
+	right := r.URL.Query().Get("right")
+	if left == "" || right == "" {
+		writeValidationError(w, "INVALID_DIFF", "left and right are required, as project or project/environment")
+		return
+	}
+
+	sides := make([]ProjectFlags, 2)
+	for i, side := range []string{left, right} {
+		flags, status, err := fm.loadDiffSide(r.Context(), side)
+		if err != nil {
+			if status == http.StatusBadRequest {
+				writeValidationError(w, "INVALID_DIFF", err.Error())
+			} else {
+				writeError(w, status, errorCode(status), err.Error())
+			}
+			return
+		}
+		sides[i] = flags
+	}
+
+	drift, err := diffProjectFlags(sides[0], sides[1])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	summary := map[string]int{"added": 0, "removed": 0, "changed": 0}
+	for _, d := range drift {
+		summary[d.Status]++
+	}
+	summary["unchanged"] = len(sides[1]) - summary["added"] - summary["changed"]
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DiffResponse{
+		Left:      left,
+		Right:     right,
+		Identical: len(drift) == 0,
+		Summary:   summary,
+		Flags:     drift,
+	})
+}
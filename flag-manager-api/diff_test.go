@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDiffEndpoint(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+	flag := func(variation string) string {
+		return `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"` + variation + `"}}`
+	}
+
+	doRequest(t, router, "POST", "/api/projects/shop", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/shop/flags/checkout", flag("off"), http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/shop/flags/banner", flag("on"), http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/shop/environments/staging", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/shop/environments/prod", "", http.StatusCreated, nil)
+	doRequest(t, router, "PUT", "/api/projects/shop/environments/staging/flags/checkout", `{"config":`+flag("on")+`}`, http.StatusOK, nil)
+	doRequest(t, router, "POST", "/api/projects/blog", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/blog/flags/banner", flag("on"), http.StatusCreated, nil)
+
+	type diffResponse struct {
+		Identical bool           `json:"identical"`
+		Summary   map[string]int `json:"summary"`
+		Flags     []FlagDrift    `json:"flags"`
+	}
+	diff := func(query string) diffResponse {
+		t.Helper()
+		var response diffResponse
+		doRequest(t, router, "GET", "/api/diff?"+query, "", http.StatusOK, &response)
+		return response
+	}
+
+	envDiff := diff("left=shop/prod&right=shop/staging")
+	if envDiff.Identical || len(envDiff.Flags) != 1 || envDiff.Flags[0].Key != "checkout" || envDiff.Flags[0].Status != "changed" {
+		t.Fatalf("Expected checkout to differ between prod and staging, got %+v", envDiff.Flags)
+	}
+	if c := envDiff.Flags[0].Changes; len(c) != 1 || c[0].Path != "defaultRule.variation" || c[0].Before != "off" || c[0].After != "on" {
+		t.Errorf("Unexpected changes %+v", c)
+	}
+	if envDiff.Summary["changed"] != 1 || envDiff.Summary["unchanged"] != 1 {
+		t.Errorf("Unexpected summary %v", envDiff.Summary)
+	}
+
+	if same := diff("left=shop&right=shop/prod"); !same.Identical {
+		t.Errorf("Expected prod to match the project config, got %+v", same.Flags)
+	}
+
+	projectDiff := diff("left=shop&right=blog")
+	if len(projectDiff.Flags) != 1 || projectDiff.Flags[0].Key != "checkout" || projectDiff.Flags[0].Status != "removed" {
+		t.Errorf("Expected checkout only on the left, got %+v", projectDiff.Flags)
+	}
+
+	for query, code := range map[string]int{
+		"left=shop":                 http.StatusBadRequest,
+		"left=shop/&right=blog":     http.StatusBadRequest,
+		"left=shop/qa&right=blog":   http.StatusNotFound,
+		"left=shop&right=missing/x": http.StatusNotFound,
+	} {
+		doRequest(t, router, "GET", "/api/diff?"+query, "", code, nil)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Flag statuses. Flags without a status are published.
+const (
+	flagStatusDraft     = "draft"
+	flagStatusPublished = "published"
+)
+
+// isDraft reports whether a flag is a draft, which is kept out of the flags
+// served to the relay proxy until it is published.
+func isDraft(config FlagConfig) bool {
+	return config.Status == flagStatusDraft
+}
+
+// servedFlags returns the flags served to the relay proxy: flags that are
+// neither drafts nor archived.
+func servedFlags[M ~map[string]FlagConfig](flags M) M {
+	served := make(M, len(flags))
+	for key, config := range flags {
+		if !isDraft(config) && !isArchived(config) {
+			served[key] = config
+		}
+	}
+	return served
+}
+
+// publishFlagHandler publishes a draft flag, which the relay proxy then serves.
+func (fm *FlagManager) publishFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	before, ok := flags[flagKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
+		return
+	}
+	if !fm.mayChangeFlag(r, before) {
+		writeNotFlagOwner(w, flagKey)
+		return
+	}
+	if !isDraft(before) {
+		writeError(w, http.StatusConflict, "FLAG_NOT_DRAFT", "Flag is already published")
+		return
+	}
+
+	after := before
+	after.Status = flagStatusPublished
+	flags[flagKey] = after
+	ids, err := fm.storage.SaveFlags(r.Context(), project, flags, []string{flagKey})
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "flag.published", "flag", ids[flagKey], flagKey, project,
+		map[string]interface{}{"before": before, "after": after}, nil)
+	fm.notifyProjectWebhook(r, "flag.published", project, flagKey, "")
+
+	fm.scheduleRelayRefresh(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newFlagResponse(flagKey, after))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestDraftFlags(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			served := func() []string {
+				t.Helper()
+				var all, project map[string]interface{}
+				doRequest(t, router, "GET", "/api/flags/raw?format=json", "", http.StatusOK, &all)
+				doRequest(t, router, "GET", "/api/flags/raw/web?format=json", "", http.StatusOK, &project)
+				var keys []string
+				for key := range all {
+					keys = append(keys, key)
+				}
+				for key := range project {
+					keys = append(keys, "web:"+key)
+				}
+				sort.Strings(keys)
+				return keys
+			}
+
+			doRequest(t, router, "POST", "/api/projects/web/flags/live", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/beta", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"status":"draft"}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/bad", `{"variations":{"on":true},"defaultRule":{"variation":"on"},"status":"hidden"}`, http.StatusBadRequest, nil)
+
+			if keys := served(); !reflect.DeepEqual(keys, []string{"web/live", "web:live"}) {
+				t.Errorf("Expected the draft not to be served, got %v", keys)
+			}
+			if body := doRequest(t, router, "GET", "/api/projects/web", "", http.StatusOK, nil).Body.String(); !strings.Contains(body, `"beta"`) {
+				t.Errorf("Expected the draft to be listed in its project, got %s", body)
+			}
+
+			// An update without a status keeps the flag a draft
+			doRequest(t, router, "PUT", "/api/projects/web/flags/beta", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusOK, nil)
+			if keys := served(); len(keys) != 2 {
+				t.Errorf("Expected the updated draft not to be served, got %v", keys)
+			}
+
+			var published FlagResponse
+			doRequest(t, router, "POST", "/api/projects/web/flags/beta/publish", "", http.StatusOK, &published)
+			if published.Config.Status != flagStatusPublished || published.Config.DefaultRule.Variation != "on" {
+				t.Errorf("Expected the updated draft to be published, got %+v", published.Config)
+			}
+			if keys := served(); !reflect.DeepEqual(keys, []string{"web/beta", "web/live", "web:beta", "web:live"}) {
+				t.Errorf("Expected the published flag to be served, got %v", keys)
+			}
+
+			doRequest(t, router, "POST", "/api/projects/web/flags/beta/publish", "", http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/live/publish", "", http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/missing/publish", "", http.StatusNotFound, nil)
+		})
+	}
+
+	events, err := store.ListAuditEvents(context.Background(), db.AuditFilterParams{PaginationParams: db.DefaultPagination(), Action: "flag.published"})
+	if err != nil || events.Total != 1 || events.Data[0].ResourceName != "beta" {
+		t.Errorf("Expected a publish audit event, got %v, %v", events, err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// validateEnvironmentOverrides checks that every environment override targets a
+// variation defined on the flag.
+func validateEnvironmentOverrides(config FlagConfig) []string {
+	var errors []string
+
+	names := make([]string, 0, len(config.EnvironmentOverrides))
+	for name := range config.EnvironmentOverrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, exists := config.Variations[name]; !exists {
+			errors = append(errors, fmt.Sprintf("environmentOverrides references unknown variation '%s'", name))
+			continue
+		}
+		for env := range config.EnvironmentOverrides[name] {
+			if env == "" {
+				errors = append(errors, fmt.Sprintf("environmentOverrides.%s has an empty environment name", name))
+			}
+		}
+	}
+
+	return errors
+}
+
+// validateFlagSetFlagConfig validates the environment overrides of a flag set
+// flag, whose config is otherwise stored as submitted.
+func validateFlagSetFlagConfig(raw interface{}) []string {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var config FlagConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return []string{fmt.Sprintf("invalid flag config: %v", err)}
+	}
+	return validateEnvironmentOverrides(config)
+}
+
+// loadFlagSetFlags returns the stored flags of a flag set and its
+// environment. found is false if the flag set does not exist.
+func (fm *FlagManager) loadFlagSetFlags(ctx context.Context, id string) (env string, flags map[string]interface{}, found bool, err error) {
+	flagSet, err := fm.storage.GetFlagSet(ctx, id)
+	if errors.Is(err, errFlagSetNotFound) {
+		return "", nil, false, nil
+	}
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	flags, err = fm.storage.ListFlagSetFlags(ctx, id)
+	return flagSet.Environment, flags, true, err
+}
+
+// getFlagSetRawFlagsHandler returns a flag set's flags as a flags file for the
+// relay proxy, with variation values resolved for the flag set's environment.
+func (fm *FlagManager) getFlagSetRawFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	r, cached := fm.serveCachedRawFlags(w, r)
+	if cached {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	env, flags, found, err := fm.loadFlagSetFlags(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
+		return
+	}
+
+	fm.writeRawFlags(w, r, flags, env)
+}
+
+// FlagSetEffectiveFlags are the flags the relay proxy is served for a flag set.
+type FlagSetEffectiveFlags struct {
+	FlagSetID   string               `json:"flagSetId"`
+	Environment string               `json:"environment"`
+	Keys        []string             `json:"keys"`
+	Flags       map[string]RelayFlag `json:"flags"`
+	Count       int                  `json:"count"`
+}
+
+// getFlagSetEffectiveFlagsHandler previews, as JSON, exactly the flags the
+// relay proxy is served for a flag set.
+func (fm *FlagManager) getFlagSetEffectiveFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	env, stored, found, err := fm.loadFlagSetFlags(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
+		return
+	}
+	flags, err := relayFlags(stored, env)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	keys := make([]string, 0, len(flags))
+	for k := range flags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FlagSetEffectiveFlags{
+		FlagSetID:   id,
+		Environment: env,
+		Keys:        keys,
+		Flags:       flags,
+		Count:       len(flags),
+	})
+}
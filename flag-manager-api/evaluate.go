@@ -0,0 +1,589 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Evaluation reasons and error codes, as reported by GO Feature Flag and OFREP.
+const (
+	reasonTargetingMatch      = "TARGETING_MATCH"
+	reasonTargetingMatchSplit = "TARGETING_MATCH_SPLIT"
+	reasonSplit               = "SPLIT"
+	reasonDefault             = "DEFAULT"
+	reasonStatic              = "STATIC"
+	reasonDisabled            = "DISABLED"
+	reasonError               = "ERROR"
+
+	errorCodeFlagNotFound        = "FLAG_NOT_FOUND"
+	errorCodeTargetingKeyMissing = "TARGETING_KEY_MISSING"
+	errorCodeInvalidContext      = "INVALID_CONTEXT"
+	errorCodeFlagConfig          = "FLAG_CONFIG"
+
+	// maxSimulationContexts bounds the contexts of one simulation request
+	maxSimulationContexts = 1000
+
+	// percentageMultiplier turns percentages into bucket sizes, giving
+	// GO Feature Flag's 0.001% bucketing granularity.
+	percentageMultiplier = 1000
+)
+
+// EvaluationRequest is an OFREP evaluation request body. The context holds the
+// targetingKey and any custom attributes; "gofeatureflag.currentDateTime" (RFC
+// 3339) evaluates the flag as of that time.
+type EvaluationRequest struct {
+	Context map[string]interface{} `json:"context"`
+}
+
+// EvaluationResult is the resolved value of a flag for one evaluation context.
+type EvaluationResult struct {
+	Key          string      `json:"key"`
+	Value        interface{} `json:"value"`
+	Variant      string      `json:"variant,omitempty"`
+	Reason       string      `json:"reason"`
+	RuleIndex    *int        `json:"ruleIndex,omitempty"`
+	RuleName     string      `json:"ruleName,omitempty"`
+	ErrorCode    string      `json:"errorCode,omitempty"`
+	ErrorDetails string      `json:"errorDetails,omitempty"`
+}
+
+// SimulationRequest lists sample evaluation contexts to resolve a flag for.
+// Flag, if set, is a draft configuration evaluated instead of the saved one.
+type SimulationRequest struct {
+	Contexts []map[string]interface{} `json:"contexts"`
+	Flag     *FlagConfig              `json:"flag,omitempty"`
+}
+
+// SimulationResponse is the resolution of a flag for each sample context, with
+// the number of contexts served each variant.
+type SimulationResponse struct {
+	FlagKey  string             `json:"flagKey"`
+	Draft    bool               `json:"draft"`
+	Results  []EvaluationResult `json:"results"`
+	Variants map[string]int     `json:"variants"`
+}
+
+// evaluationContext is a parsed evaluation context.
+type evaluationContext struct {
+	key    string
+	custom map[string]interface{}
+	date   time.Time
+}
+
+// queryAttributes returns the attributes targeting queries are evaluated
+// against: the custom attributes plus the targeting key and anonymous flag.
+func (c evaluationContext) queryAttributes() map[string]interface{} {
+	attrs := make(map[string]interface{}, len(c.custom)+2)
+	for k, v := range c.custom {
+		attrs[k] = v
+	}
+	attrs["key"] = c.key
+	if _, ok := attrs["anonymous"].(bool); !ok {
+		attrs["anonymous"] = false
+	}
+	return attrs
+}
+
+// parseEvaluationContext reads an OFREP context. The evaluation date defaults
+// to now.
+func parseEvaluationContext(raw map[string]interface{}, now time.Time) (evaluationContext, error) {
+	ctx := evaluationContext{custom: make(map[string]interface{}, len(raw)), date: now}
+	for k, v := range raw {
+		if k == "targetingKey" {
+			key, ok := v.(string)
+			if !ok {
+				return ctx, fmt.Errorf("targetingKey must be a string")
+			}
+			ctx.key = key
+			continue
+		}
+		ctx.custom[k] = v
+	}
+
+	if goff, ok := ctx.custom["gofeatureflag"].(map[string]interface{}); ok {
+		if s, ok := goff["currentDateTime"].(string); ok {
+			date, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return ctx, fmt.Errorf("gofeatureflag.currentDateTime must be an RFC 3339 timestamp")
+			}
+			ctx.date = date
+		}
+	}
+	return ctx, nil
+}
+
+// bucketHash returns the bucket of a bucketing key for a flag, in [0, max).
+func bucketHash(flagName, key string, max uint32) uint32 {
+	if max == 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(flagName + key))
+	return h.Sum32() % max
+}
+
+// evaluationRule is the part of a targeting or default rule that selects a variation.
+type evaluationRule struct {
+	Variation          string
+	Percentage         map[string]float64
+	ProgressiveRollout *ProgressiveRollout
+}
+
+func (r evaluationRule) requiresBucketing() bool {
+	return len(r.Percentage) > 0 || r.ProgressiveRollout != nil
+}
+
+// isDynamic reports whether the rule splits contexts between variations.
+func (r evaluationRule) isDynamic() bool {
+	if r.ProgressiveRollout != nil {
+		return true
+	}
+	for _, pct := range r.Percentage {
+		if pct == 100 {
+			return false
+		}
+	}
+	return len(r.Percentage) > 0
+}
+
+// variation selects the rule's variation for a bucketing key. A progressive
+// rollout takes precedence over a percentage split, which takes precedence
+// over a fixed variation.
+func (r evaluationRule) variation(flagName, key string, date time.Time) (string, error) {
+	if r.requiresBucketing() && key == "" {
+		return "", fmt.Errorf("rule requires a bucketing key")
+	}
+
+	if rollout := r.ProgressiveRollout; rollout != nil {
+		return rollout.variation(bucketHash(flagName, key, 100*percentageMultiplier), date)
+	}
+
+	if len(r.Percentage) > 0 {
+		// Buckets are assigned in reverse name order, as GO Feature Flag does
+		names := make([]string, 0, len(r.Percentage))
+		total := 0.0
+		for name, pct := range r.Percentage {
+			names = append(names, name)
+			total += pct
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+		hash := bucketHash(flagName, key, uint32(total*percentageMultiplier))
+		start := 0.0
+		for _, name := range names {
+			end := start + r.Percentage[name]*percentageMultiplier
+			if uint32(start) <= hash && uint32(end) > hash {
+				return name, nil
+			}
+			start = end
+		}
+		return "", fmt.Errorf("impossible to find the variation")
+	}
+
+	if r.Variation != "" {
+		return r.Variation, nil
+	}
+	return "", fmt.Errorf("no variation available for this rule")
+}
+
+// variation returns the initial variation before the rollout starts, then moves
+// buckets to the end variation linearly until the end date.
+func (p *ProgressiveRollout) variation(hash uint32, date time.Time) (string, error) {
+	if p.Initial == nil || p.End == nil || p.Initial.Variation == "" || p.End.Variation == "" {
+		return "", fmt.Errorf("progressive rollout is missing params")
+	}
+	initialDate, err1 := time.Parse(time.RFC3339, p.Initial.Date)
+	endDate, err2 := time.Parse(time.RFC3339, p.End.Date)
+	if err1 != nil || err2 != nil || !endDate.After(initialDate) {
+		return "", fmt.Errorf("progressive rollout has invalid dates")
+	}
+
+	if date.Before(initialDate) {
+		return p.Initial.Variation, nil
+	}
+
+	endPct := p.End.Percentage
+	if endPct == 0 || endPct > 100 {
+		endPct = 100
+	}
+	initial := p.Initial.Percentage * percentageMultiplier
+	perSecond := (endPct*percentageMultiplier - initial) / float64(endDate.Unix()-initialDate.Unix())
+	current := float64(date.Unix()-initialDate.Unix())*perSecond + initial
+
+	if hash < uint32(current) {
+		return p.End.Variation, nil
+	}
+	return p.Initial.Variation, nil
+}
+
+// mergeProgressiveRolloutStep overrides the set fields of a rollout step.
+func mergeProgressiveRolloutStep(step *ProgressiveRolloutStep, update *ProgressiveRolloutStep) *ProgressiveRolloutStep {
+	merged := ProgressiveRolloutStep{}
+	if step != nil {
+		merged = *step
+	}
+	if update.Variation != "" {
+		merged.Variation = update.Variation
+	}
+	if update.Percentage != 0 {
+		merged.Percentage = update.Percentage
+	}
+	if update.Date != "" {
+		merged.Date = update.Date
+	}
+	return &merged
+}
+
+// mergeEvaluationRule applies a scheduled update to a rule. A negative
+// percentage removes that variation from the split.
+func mergeEvaluationRule(rule *evaluationRule, query *string, update evaluationRule, updateQuery string) {
+	if query != nil && updateQuery != "" {
+		*query = updateQuery
+	}
+	if update.Variation != "" {
+		rule.Variation = update.Variation
+	}
+	if p := update.ProgressiveRollout; p != nil {
+		merged := ProgressiveRollout{}
+		if rule.ProgressiveRollout != nil {
+			merged = *rule.ProgressiveRollout
+		}
+		if p.Initial != nil {
+			merged.Initial = mergeProgressiveRolloutStep(merged.Initial, p.Initial)
+		}
+		if p.End != nil {
+			merged.End = mergeProgressiveRolloutStep(merged.End, p.End)
+		}
+		rule.ProgressiveRollout = &merged
+	}
+	if update.Percentage != nil {
+		merged := make(map[string]float64, len(rule.Percentage))
+		for name, pct := range rule.Percentage {
+			merged[name] = pct
+		}
+		for name, pct := range update.Percentage {
+			if pct < 0 {
+				delete(merged, name)
+				continue
+			}
+			merged[name] = pct
+		}
+		rule.Percentage = merged
+	}
+}
+
+func targetingEvaluationRule(rule TargetingRule) evaluationRule {
+	return evaluationRule{Variation: rule.Variation, Percentage: rule.Percentage, ProgressiveRollout: rule.ProgressiveRollout}
+}
+
+func defaultEvaluationRule(rule DefaultRule) evaluationRule {
+	return evaluationRule{Variation: rule.Variation, Percentage: rule.Percentage, ProgressiveRollout: rule.ProgressiveRollout}
+}
+
+// applyScheduledRollout returns the flag as of date, with every scheduled step
+// due by then merged in and removed from its scheduledRollout, and the steps
+// that were applied. Targeting rules are matched by name; unmatched ones are
+// appended.
+func applyScheduledRollout(config FlagConfig, date time.Time) (FlagConfig, []ScheduledStep) {
+	if len(config.ScheduledRollout) == 0 {
+		return config, nil
+	}
+
+	targeting := make([]TargetingRule, len(config.Targeting))
+	copy(targeting, config.Targeting)
+	var defaultRule *DefaultRule
+	if config.DefaultRule != nil {
+		rule := *config.DefaultRule
+		defaultRule = &rule
+	}
+
+	var applied, pending []ScheduledStep
+	for _, step := range config.ScheduledRollout {
+		stepDate, err := time.Parse(time.RFC3339, step.Date)
+		if err != nil || stepDate.After(date) {
+			pending = append(pending, step)
+			continue
+		}
+		applied = append(applied, step)
+
+		for _, update := range step.Targeting {
+			merged := false
+			for i := range targeting {
+				if update.Name == "" || targeting[i].Name != update.Name {
+					continue
+				}
+				rule := targetingEvaluationRule(targeting[i])
+				mergeEvaluationRule(&rule, &targeting[i].Query, targetingEvaluationRule(update), update.Query)
+				targeting[i].Variation = rule.Variation
+				targeting[i].Percentage = rule.Percentage
+				targeting[i].ProgressiveRollout = rule.ProgressiveRollout
+				merged = true
+			}
+			if !merged {
+				targeting = append(targeting, update)
+			}
+		}
+
+		if step.DefaultRule != nil {
+			if defaultRule == nil {
+				defaultRule = &DefaultRule{}
+			}
+			rule := defaultEvaluationRule(*defaultRule)
+			mergeEvaluationRule(&rule, nil, defaultEvaluationRule(*step.DefaultRule), "")
+			defaultRule.Variation = rule.Variation
+			defaultRule.Percentage = rule.Percentage
+			defaultRule.ProgressiveRollout = rule.ProgressiveRollout
+		}
+	}
+
+	if len(applied) == 0 {
+		return config, nil
+	}
+	config.Targeting = targeting
+	config.DefaultRule = defaultRule
+	config.ScheduledRollout = pending
+	return config, applied
+}
+
+// flagRequiresBucketing reports whether any rule of the flag splits contexts.
+func flagRequiresBucketing(config FlagConfig) bool {
+	if config.DefaultRule != nil && defaultEvaluationRule(*config.DefaultRule).requiresBucketing() {
+		return true
+	}
+	for _, rule := range config.Targeting {
+		if targetingEvaluationRule(rule).requiresBucketing() {
+			return true
+		}
+	}
+	return false
+}
+
+// bucketingKeyValue returns the key contexts are bucketed by: the flag's
+// bucketingKey attribute if set, the targeting key otherwise. A key is only
+// required when the flag splits contexts.
+func bucketingKeyValue(config FlagConfig, ctx evaluationContext) (string, error) {
+	key := ctx.key
+	if config.BucketingKey != "" {
+		value, ok := lookupQueryAttribute(ctx.custom, config.BucketingKey)
+		if !ok {
+			return "", fmt.Errorf("bucketing key %q not found in context", config.BucketingKey)
+		}
+		s, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("bucketing key %q must be a string", config.BucketingKey)
+		}
+		key = s
+	}
+	if key == "" && flagRequiresBucketing(config) {
+		return "", fmt.Errorf("a bucketing key is required to evaluate this flag")
+	}
+	return key, nil
+}
+
+// experimentationOver reports whether date is outside the flag's experimentation window.
+func experimentationOver(exp *Experimentation, date time.Time) bool {
+	if exp == nil {
+		return false
+	}
+	if start, err := time.Parse(time.RFC3339, exp.Start); err == nil && date.Before(start) {
+		return true
+	}
+	if end, err := time.Parse(time.RFC3339, exp.End); err == nil && date.After(end) {
+		return true
+	}
+	return false
+}
+
+// evaluateFlag resolves a flag for an evaluation context the way GO Feature
+// Flag does: scheduled steps due are applied, then the first enabled targeting
+// rule whose query matches selects the variation, falling back to the default
+// rule. flagName seeds the bucketing hash. Disabled flags and flags outside
+// their experimentation window resolve to no value, leaving the SDK default.
+func evaluateFlag(flagName string, config FlagConfig, ctx evaluationContext) EvaluationResult {
+	result := EvaluationResult{Key: flagName}
+	fail := func(code string, err error) EvaluationResult {
+		result.Reason = reasonError
+		result.ErrorCode = code
+		result.ErrorDetails = err.Error()
+		return result
+	}
+
+	config, _ = applyScheduledRollout(config, ctx.date)
+
+	key, err := bucketingKeyValue(config, ctx)
+	if err != nil {
+		return fail(errorCodeTargetingKeyMissing, err)
+	}
+
+	if (config.Disable != nil && *config.Disable) || experimentationOver(config.Experimentation, ctx.date) {
+		result.Reason = reasonDisabled
+		return result
+	}
+
+	hasRules := len(config.Targeting) > 0
+	attrs := ctx.queryAttributes()
+
+	variation := ""
+	for i, rule := range config.Targeting {
+		if rule.Disable != nil && *rule.Disable {
+			continue
+		}
+		if query := strings.TrimSpace(rule.Query); query != "" {
+			if strings.HasPrefix(query, "{") {
+				return fail(errorCodeFlagConfig, fmt.Errorf("targeting[%d]: JSONLogic queries are not supported", i))
+			}
+			node, err := parseQuery(query)
+			if err != nil || !node.eval(attrs) {
+				continue
+			}
+		}
+
+		er := targetingEvaluationRule(rule)
+		if variation, err = er.variation(flagName, key, ctx.date); err != nil {
+			return fail(errorCodeFlagConfig, fmt.Errorf("targeting[%d]: %w", i, err))
+		}
+		index := i
+		result.RuleIndex = &index
+		result.RuleName = rule.Name
+		result.Reason = reasonTargetingMatch
+		if er.isDynamic() {
+			result.Reason = reasonTargetingMatchSplit
+		}
+		break
+	}
+
+	if result.RuleIndex == nil {
+		if config.DefaultRule == nil {
+			return fail(errorCodeFlagConfig, fmt.Errorf("no default rule for the flag"))
+		}
+		er := defaultEvaluationRule(*config.DefaultRule)
+		if variation, err = er.variation(flagName, key, ctx.date); err != nil {
+			return fail(errorCodeFlagConfig, fmt.Errorf("defaultRule: %w", err))
+		}
+		switch {
+		case er.isDynamic():
+			result.Reason = reasonSplit
+		case hasRules:
+			result.Reason = reasonDefault
+		default:
+			result.Reason = reasonStatic
+		}
+	}
+
+	result.Variant = variation
+	result.Value = config.Variations[variation]
+	return result
+}
+
+// evaluateFlagHandler evaluates a flag against an evaluation context without
+// going through the relay proxy. Flags are bucketed under "project/flagKey",
+// their name on /api/flags/raw, so results match what the relay proxy serves.
+func (fm *FlagManager) evaluateFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+	flagName := project + "/" + flagKey
+
+	var req EvaluationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, err := parseEvaluationContext(req.Context, time.Now())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(EvaluationResult{Key: flagName, Reason: reasonError, ErrorCode: errorCodeInvalidContext, ErrorDetails: err.Error()})
+		return
+	}
+
+	flags, err := fm.loadProjectFlagsExpanded(r.Context(), project, true)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	config, ok := flags[flagKey]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(EvaluationResult{Key: flagName, Reason: reasonError, ErrorCode: errorCodeFlagNotFound, ErrorDetails: "flag " + flagName + " not found"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(evaluateFlag(flagName, config, ctx))
+}
+
+// simulateFlagHandler resolves a flag for a batch of sample contexts, reporting
+// the variation and matched rule of each and how many contexts got each
+// variation. A draft flag in the request is simulated instead of the saved
+// flag, so targeting can be checked before it is saved.
+func (fm *FlagManager) simulateFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+	flagName := project + "/" + flagKey
+
+	var req SimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if len(req.Contexts) == 0 {
+		writeValidationError(w, "INVALID_CONTEXTS", "at least one evaluation context is required")
+		return
+	}
+	if len(req.Contexts) > maxSimulationContexts {
+		writeValidationError(w, "INVALID_CONTEXTS", fmt.Sprintf("at most %d evaluation contexts can be simulated at once", maxSimulationContexts))
+		return
+	}
+
+	flags, err := fm.loadProjectFlagsExpanded(r.Context(), project, true)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if flags == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	config, ok := flags[flagKey]
+	if req.Flag != nil {
+		config = fm.expandFlagSegments(r.Context(), *req.Flag)
+	} else if !ok {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
+		return
+	}
+
+	now := time.Now()
+	results := make([]EvaluationResult, 0, len(req.Contexts))
+	variants := make(map[string]int)
+	for _, raw := range req.Contexts {
+		ctx, err := parseEvaluationContext(raw, now)
+		if err != nil {
+			results = append(results, EvaluationResult{Key: flagName, Reason: reasonError, ErrorCode: errorCodeInvalidContext, ErrorDetails: err.Error()})
+			continue
+		}
+		result := evaluateFlag(flagName, config, ctx)
+		if result.Variant != "" {
+			variants[result.Variant]++
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SimulationResponse{
+		FlagKey:  flagKey,
+		Draft:    req.Flag != nil,
+		Results:  results,
+		Variants: variants,
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEvaluateFlag(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	req := httptest.NewRequest("POST", "/api/projects/eval-tests", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	createFlag := func(key string, config map[string]interface{}) {
+		body, _ := json.Marshal(config)
+		req := httptest.NewRequest("POST", "/api/projects/eval-tests/flags/"+key, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to create flag %s: %d %s", key, rr.Code, rr.Body.String())
+		}
+	}
+	evaluate := func(key string, context map[string]interface{}) (int, EvaluationResult) {
+		body, _ := json.Marshal(map[string]interface{}{"context": context})
+		req := httptest.NewRequest("POST", "/api/evaluate/eval-tests/"+key, bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var result EvaluationResult
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		return rr.Code, result
+	}
+
+	createFlag("checkout", map[string]interface{}{
+		"variations": map[string]interface{}{"on": true, "off": false},
+		"targeting": []map[string]interface{}{
+			{"name": "staff", "query": `email ew "@example.com" and user.plan in ["pro", "team"]`, "variation": "on"},
+			{"name": "legacy", "query": `key eq "user-1"`, "variation": "off", "disable": true},
+		},
+		"defaultRule": map[string]interface{}{"percentage": map[string]float64{"on": 50, "off": 50}},
+		"scheduledRollout": []map[string]interface{}{
+			{"date": "2030-01-01T00:00:00Z", "defaultRule": map[string]interface{}{"percentage": map[string]float64{"on": 100, "off": 0}}},
+		},
+	})
+	createFlag("banner", map[string]interface{}{
+		"variations":  map[string]interface{}{"a": "A", "b": "B"},
+		"defaultRule": map[string]interface{}{"variation": "b"},
+	})
+	createFlag("retired", map[string]interface{}{
+		"variations":  map[string]interface{}{"a": "A", "b": "B"},
+		"defaultRule": map[string]interface{}{"variation": "a"},
+		"disable":     true,
+	})
+
+	code, result := evaluate("checkout", map[string]interface{}{
+		"targetingKey": "user-1",
+		"email":        "jane@example.com",
+		"user":         map[string]interface{}{"plan": "team"},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if result.Key != "eval-tests/checkout" || result.Variant != "on" || result.Value != true || result.Reason != reasonTargetingMatch {
+		t.Errorf("Expected staff rule to match, got %+v", result)
+	}
+	if result.RuleIndex == nil || *result.RuleIndex != 0 || result.RuleName != "staff" {
+		t.Errorf("Expected rule 0 (staff), got %+v", result)
+	}
+
+	// The disabled legacy rule is skipped; the default rule splits by bucket
+	_, first := evaluate("checkout", map[string]interface{}{"targetingKey": "user-1"})
+	if first.Reason != reasonSplit || (first.Variant != "on" && first.Variant != "off") || first.RuleIndex != nil {
+		t.Errorf("Expected a split default rule result, got %+v", first)
+	}
+	_, again := evaluate("checkout", map[string]interface{}{"targetingKey": "user-1"})
+	if again.Variant != first.Variant {
+		t.Errorf("Expected bucketing to be stable, got %s then %s", first.Variant, again.Variant)
+	}
+
+	// Scheduled rollout steps apply once the evaluation date passes them
+	_, result = evaluate("checkout", map[string]interface{}{
+		"targetingKey":  "user-1",
+		"gofeatureflag": map[string]interface{}{"currentDateTime": "2030-06-01T00:00:00Z"},
+	})
+	if result.Variant != "on" || result.Reason != reasonDefault {
+		t.Errorf("Expected scheduled 100%% rollout to serve on, got %+v", result)
+	}
+
+	code, result = evaluate("checkout", map[string]interface{}{"email": "anon@other.com"})
+	if code != http.StatusOK || result.Reason != reasonError || result.ErrorCode != errorCodeTargetingKeyMissing {
+		t.Errorf("Expected TARGETING_KEY_MISSING, got %d %+v", code, result)
+	}
+
+	// Static flags need no targeting key
+	_, result = evaluate("banner", map[string]interface{}{})
+	if result.Variant != "b" || result.Value != "B" || result.Reason != reasonStatic {
+		t.Errorf("Expected static variation b, got %+v", result)
+	}
+
+	_, result = evaluate("retired", map[string]interface{}{"targetingKey": "user-1"})
+	if result.Reason != reasonDisabled || result.Value != nil || result.Variant != "" {
+		t.Errorf("Expected disabled flag to resolve to no value, got %+v", result)
+	}
+
+	code, result = evaluate("missing", map[string]interface{}{"targetingKey": "user-1"})
+	if code != http.StatusNotFound || result.ErrorCode != errorCodeFlagNotFound {
+		t.Errorf("Expected FLAG_NOT_FOUND, got %d %+v", code, result)
+	}
+
+	code, result = evaluate("banner", map[string]interface{}{"targetingKey": 42})
+	if code != http.StatusBadRequest || result.ErrorCode != errorCodeInvalidContext {
+		t.Errorf("Expected INVALID_CONTEXT, got %d %+v", code, result)
+	}
+}
+
+func TestSimulateFlag(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	req := httptest.NewRequest("POST", "/api/projects/sim-tests", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"variations":  map[string]interface{}{"on": true, "off": false},
+		"targeting":   []map[string]interface{}{{"name": "beta", "query": `beta eq true`, "variation": "on"}},
+		"defaultRule": map[string]interface{}{"variation": "off"},
+	})
+	req = httptest.NewRequest("POST", "/api/projects/sim-tests/flags/checkout", bytes.NewReader(body))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create flag: %d %s", rr.Code, rr.Body.String())
+	}
+
+	simulate := func(key string, payload map[string]interface{}) (int, map[string]interface{}) {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/projects/sim-tests/flags/"+key+"/simulate", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	contexts := []map[string]interface{}{
+		{"targetingKey": "u1", "beta": true},
+		{"targetingKey": "u2", "beta": false},
+		{"targetingKey": "u3", "country": "FR"},
+		{"targetingKey": 3},
+	}
+
+	code, resp := simulate("checkout", map[string]interface{}{"contexts": contexts})
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if resp["draft"] != false {
+		t.Errorf("Expected saved flag to be simulated, got %v", resp["draft"])
+	}
+	results, _ := resp["results"].([]interface{})
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 results, got %v", resp["results"])
+	}
+	first := results[0].(map[string]interface{})
+	if first["variant"] != "on" || first["ruleName"] != "beta" || first["ruleIndex"] != float64(0) {
+		t.Errorf("Expected beta rule to match first context, got %v", first)
+	}
+	if results[1].(map[string]interface{})["variant"] != "off" {
+		t.Errorf("Expected default variation for second context, got %v", results[1])
+	}
+	if results[3].(map[string]interface{})["errorCode"] != errorCodeInvalidContext {
+		t.Errorf("Expected INVALID_CONTEXT for last context, got %v", results[3])
+	}
+	variants, _ := json.Marshal(resp["variants"])
+	if string(variants) != `{"off":2,"on":1}` {
+		t.Errorf("Unexpected variant counts: %s", variants)
+	}
+
+	// A draft changes the outcome without saving it, even for a new flag
+	draft := map[string]interface{}{
+		"variations":  map[string]interface{}{"on": true, "off": false},
+		"targeting":   []map[string]interface{}{{"name": "fr", "query": `country eq "FR"`, "variation": "on"}},
+		"defaultRule": map[string]interface{}{"variation": "off"},
+	}
+	for _, key := range []string{"checkout", "new-flag"} {
+		code, resp = simulate(key, map[string]interface{}{"contexts": contexts[:3], "flag": draft})
+		if code != http.StatusOK || resp["draft"] != true {
+			t.Fatalf("Expected draft simulation of %s, got %d %v", key, code, resp)
+		}
+		variants, _ = json.Marshal(resp["variants"])
+		if string(variants) != `{"off":2,"on":1}` {
+			t.Errorf("Unexpected draft variant counts for %s: %s", key, variants)
+		}
+		results, _ = resp["results"].([]interface{})
+		if results[2].(map[string]interface{})["ruleName"] != "fr" {
+			t.Errorf("Expected fr rule to match third context, got %v", results[2])
+		}
+	}
+
+	if code, _ := simulate("checkout", map[string]interface{}{"contexts": []interface{}{}}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without contexts, got %d", code)
+	}
+	if code, _ := simulate("new-flag", map[string]interface{}{"contexts": contexts}); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown flag without draft, got %d", code)
+	}
+}
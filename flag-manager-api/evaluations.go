@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"flag-manager-api/db"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultEvaluationRetention is how long evaluation events are kept when
+	// EVALUATION_RETENTION is not set.
+	defaultEvaluationRetention = 30 * 24 * time.Hour
+	// evaluationRetentionInterval is how often expired evaluations are purged.
+	evaluationRetentionInterval = time.Hour
+	// defaultStatsWindow is the window of flag statistics without ?window=.
+	defaultStatsWindow = 7 * 24 * time.Hour
+	// hourlyStatsWindow is the largest window bucketed by hour by default.
+	hourlyStatsWindow = 48 * time.Hour
+	// maxEvaluationBatch bounds the events of one ingestion request.
+	maxEvaluationBatch = 10000
+)
+
+// parseEvaluationRetention reads the EVALUATION_RETENTION setting ("30d",
+// "720h"). Empty values use the default; zero keeps evaluations forever.
+func parseEvaluationRetention(value string) time.Duration {
+	if value == "" {
+		return defaultEvaluationRetention
+	}
+	if value == "0" {
+		return 0
+	}
+	d, err := parseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid EVALUATION_RETENTION, using default", "value", value, "default", defaultEvaluationRetention)
+		return defaultEvaluationRetention
+	}
+	return d
+}
+
+// EvaluationEventBatch is the body the GO Feature Flag webhook exporter posts.
+type EvaluationEventBatch struct {
+	Meta   map[string]string `json:"meta,omitempty"`
+	Events []EvaluationEvent `json:"events"`
+}
+
+// EvaluationEvent is a GO Feature Flag feature event. RuleName is not part of
+// GO Feature Flag's events; clients that know the targeting rule served (e.g.
+// from an OFREP response) may set it to count rule hits.
+type EvaluationEvent struct {
+	Kind         string      `json:"kind"`
+	ContextKind  string      `json:"contextKind"`
+	UserKey      string      `json:"userKey"`
+	CreationDate int64       `json:"creationDate"` // Unix seconds
+	Key          string      `json:"key"`
+	Variation    string      `json:"variation"`
+	Value        interface{} `json:"value,omitempty"`
+	Default      bool        `json:"default"`
+	Version      string      `json:"version,omitempty"`
+	Source       string      `json:"source,omitempty"`
+	RuleName     string      `json:"ruleName,omitempty"`
+}
+
+// EvaluationIngestResponse is the outcome of an evaluation ingestion request.
+type EvaluationIngestResponse struct {
+	Accepted int `json:"accepted"`
+	Skipped  int `json:"skipped"`
+}
+
+// toEvaluationEvents converts feature events to stored evaluations. Flag keys
+// are "project/flag" as served by /api/flags/raw, or plain flag keys of
+// project when the relay proxy reads /api/flags/raw/{project}. Events of other
+// kinds, without a flag or context key, or older than cutoff are skipped.
+func toEvaluationEvents(events []EvaluationEvent, project string, cutoff time.Time) ([]db.EvaluationEvent, int) {
+	var stored []db.EvaluationEvent
+	skipped := 0
+	for _, e := range events {
+		eventProject, flagKey := project, e.Key
+		if eventProject == "" {
+			eventProject, flagKey, _ = strings.Cut(e.Key, "/")
+		}
+		at := time.Unix(e.CreationDate, 0).UTC()
+		if (e.Kind != "" && e.Kind != "feature") || eventProject == "" || flagKey == "" || e.UserKey == "" || at.Before(cutoff) {
+			skipped++
+			continue
+		}
+		stored = append(stored, db.EvaluationEvent{
+			Project:     eventProject,
+			FlagKey:     flagKey,
+			Variation:   e.Variation,
+			ContextKey:  e.UserKey,
+			ContextKind: e.ContextKind,
+			RuleName:    e.RuleName,
+			Default:     e.Default,
+			Source:      e.Source,
+			EvaluatedAt: at,
+		})
+	}
+	return stored, skipped
+}
+
+// ingestEvaluationsHandler stores the feature events of a relay proxy webhook
+// exporter. ?project= names the project of plain flag keys.
+func (fm *FlagManager) ingestEvaluationsHandler(w http.ResponseWriter, r *http.Request) {
+	if fm.store == nil {
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for evaluation statistics")
+		return
+	}
+
+	var batch EvaluationEventBatch
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		writeValidationError(w, "INVALID_JSON", "Invalid JSON: "+err.Error())
+		return
+	}
+	if len(batch.Events) > maxEvaluationBatch {
+		writeValidationError(w, "TOO_MANY_EVENTS", "a request may contain at most 10000 events")
+		return
+	}
+
+	var cutoff time.Time
+	if fm.config.EvaluationRetention > 0 {
+		cutoff = time.Now().Add(-fm.config.EvaluationRetention)
+	}
+	events, skipped := toEvaluationEvents(batch.Events, r.URL.Query().Get("project"), cutoff)
+	if err := fm.store.InsertEvaluationEvents(r.Context(), events); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EvaluationIngestResponse{Accepted: len(events), Skipped: skipped})
+}
+
+// EvaluationBucket holds the evaluations per variation in one period.
+type EvaluationBucket struct {
+	Start  time.Time      `json:"start"`
+	Counts map[string]int `json:"counts"`
+}
+
+// FlagStatsResponse is the evaluation statistics of a flag over a window.
+type FlagStatsResponse struct {
+	Project           string             `json:"project"`
+	FlagKey           string             `json:"flagKey"`
+	Window            string             `json:"window"`
+	Bucket            string             `json:"bucket"`
+	Since             time.Time          `json:"since"`
+	Until             time.Time          `json:"until"`
+	Total             int                `json:"total"`
+	UniqueContextKeys int                `json:"uniqueContextKeys"`
+	Variations        map[string]int     `json:"variations"`
+	Buckets           []EvaluationBucket `json:"buckets"`
+	RuleHits          []db.RuleHitCount  `json:"ruleHits"`
+}
+
+// buildEvaluationBuckets spreads evaluation counts over every period, with a
+// zero count for each variation without evaluations so the series chart
+// continuously.
+func buildEvaluationBuckets(counts []db.EvaluationCount, periods []time.Time, variations map[string]int) []EvaluationBucket {
+	byPeriod := make(map[time.Time]map[string]int)
+	for _, c := range counts {
+		if byPeriod[c.Period] == nil {
+			byPeriod[c.Period] = make(map[string]int)
+		}
+		byPeriod[c.Period][c.Variation] += c.Count
+	}
+
+	buckets := make([]EvaluationBucket, 0, len(periods))
+	for _, p := range periods {
+		bucket := EvaluationBucket{Start: p, Counts: make(map[string]int, len(variations))}
+		for variation := range variations {
+			bucket.Counts[variation] = byPeriod[p][variation]
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// flagStatsHandler returns a flag's evaluations per variation over time,
+// its unique context keys and targeting rule hits. ?window= (default 7d)
+// selects the last hours or days; ?bucket= is hour or day, by default hour
+// for windows up to 48h.
+func (fm *FlagManager) flagStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if fm.store == nil {
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for evaluation statistics")
+		return
+	}
+
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+	q := r.URL.Query()
+
+	windowParam := q.Get("window")
+	window := defaultStatsWindow
+	if windowParam == "" {
+		windowParam = "7d"
+	} else {
+		d, err := parseDuration(windowParam)
+		if err != nil || d <= 0 {
+			writeValidationError(w, "INVALID_WINDOW", "window must be a positive duration such as 7d or 24h")
+			return
+		}
+		window = d
+	}
+
+	interval := q.Get("bucket")
+	if interval == "" {
+		interval = "day"
+		if window <= hourlyStatsWindow {
+			interval = "hour"
+		}
+	}
+	if interval != "hour" && interval != "day" {
+		writeValidationError(w, "INVALID_BUCKET", "bucket must be hour or day")
+		return
+	}
+
+	until := time.Now().UTC()
+	since := until.Add(-window)
+	periods := activityPeriods(since, until, interval)
+	if len(periods) > maxActivityPeriods {
+		writeValidationError(w, "INVALID_WINDOW", "window spans too many buckets; use bucket=day or a shorter window")
+		return
+	}
+
+	stats, err := fm.store.FlagEvaluationStats(r.Context(), db.EvaluationStatsParams{
+		Project:  project,
+		FlagKey:  flagKey,
+		Interval: interval,
+		Since:    since,
+		Until:    until,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	// Configured variations are listed even when they were never served
+	variations := make(map[string]int)
+	flag, err := fm.storage.GetFlag(r.Context(), project, flagKey)
+	switch {
+	case err == nil:
+		for variation := range flag.Config.Variations {
+			variations[variation] = 0
+		}
+	case !errors.Is(err, errProjectNotFound) && !errors.Is(err, errFlagNotFound):
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	for _, c := range stats.Counts {
+		variations[c.Variation] += c.Count
+	}
+
+	ruleHits := stats.RuleHits
+	if ruleHits == nil {
+		ruleHits = []db.RuleHitCount{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FlagStatsResponse{
+		Project:           project,
+		FlagKey:           flagKey,
+		Window:            windowParam,
+		Bucket:            interval,
+		Since:             since,
+		Until:             until,
+		Total:             stats.Total,
+		UniqueContextKeys: stats.UniqueContextKeys,
+		Variations:        variations,
+		Buckets:           buildEvaluationBuckets(stats.Counts, periods, variations),
+		RuleHits:          ruleHits,
+	})
+}
+
+// purgeExpiredEvaluations deletes evaluations older than the retention.
+func (fm *FlagManager) purgeExpiredEvaluations(ctx context.Context, now time.Time) (int64, error) {
+	deleted, err := fm.store.DeleteEvaluationEventsBefore(ctx, now.Add(-fm.config.EvaluationRetention))
+	if err != nil {
+		slog.Error("Failed to purge expired evaluations", "error", err)
+		return 0, err
+	}
+	if deleted > 0 {
+		slog.Info("Purged expired evaluations", "count", deleted, "retention", fm.config.EvaluationRetention)
+	}
+	return deleted, nil
+}
+
+// runEvaluationRetention purges expired evaluations every interval until ctx
+// is done.
+func (fm *FlagManager) runEvaluationRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			fm.purgeExpiredEvaluations(ctx, now)
+		}
+	}
+}
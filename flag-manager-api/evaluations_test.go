@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagEvaluationStats(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+
+	fm := &FlagManager{config: Config{FlagsDir: tempDir, EvaluationRetention: 30 * 24 * time.Hour}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	fm.audit = NewAuditLogger(store, fm.changes)
+	router := setupTestRouter(fm)
+
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false,"beta":true},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+	now := time.Now().UTC()
+	event := func(key, user, variation, rule string, age time.Duration) map[string]interface{} {
+		return map[string]interface{}{
+			"kind": "feature", "contextKind": "user", "userKey": user, "key": key,
+			"variation": variation, "ruleName": rule, "creationDate": now.Add(-age).Unix(),
+		}
+	}
+	batch, _ := json.Marshal(map[string]interface{}{
+		"meta": map[string]string{"hostname": "relay"},
+		"events": []map[string]interface{}{
+			event("web/checkout", "u1", "on", "beta-users", time.Hour),
+			event("web/checkout", "u2", "on", "beta-users", time.Hour),
+			event("web/checkout", "u1", "off", "", 3*time.Hour),
+			event("web/checkout", "u3", "off", "", 30*time.Hour),
+			event("web/checkout", "u4", "off", "", 40*24*time.Hour), // past retention
+			event("api/checkout", "u1", "on", "", time.Hour),
+			event("checkout", "u1", "on", "", time.Hour), // no project
+			{"kind": "custom", "userKey": "u1", "key": "web/checkout", "creationDate": now.Unix()},
+		},
+	})
+	var ingest EvaluationIngestResponse
+	doRequest(t, router, "POST", "/api/evaluations", string(batch), http.StatusOK, &ingest)
+	if ingest.Accepted != 5 || ingest.Skipped != 3 {
+		t.Errorf("Expected 5 accepted and 3 skipped events, got %+v", ingest)
+	}
+
+	// A relay proxy reading /api/flags/raw/web reports plain flag keys
+	batch, _ = json.Marshal(map[string]interface{}{"events": []map[string]interface{}{event("checkout", "u5", "on", "beta-users", 2*time.Hour)}})
+	doRequest(t, router, "POST", "/api/evaluations?project=web", string(batch), http.StatusOK, &ingest)
+	if ingest.Accepted != 1 {
+		t.Errorf("Expected the project event to be accepted, got %+v", ingest)
+	}
+
+	var stats FlagStatsResponse
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout/stats?window=2d", "", http.StatusOK, &stats)
+	if stats.Bucket != "hour" || len(stats.Buckets) < 48 {
+		t.Errorf("Expected hourly buckets over 2 days, got %s with %d buckets", stats.Bucket, len(stats.Buckets))
+	}
+	if stats.Total != 5 || stats.UniqueContextKeys != 4 {
+		t.Errorf("Expected 5 evaluations by 4 contexts, got %d by %d", stats.Total, stats.UniqueContextKeys)
+	}
+	if want := map[string]int{"on": 3, "off": 2, "beta": 0}; !reflect.DeepEqual(stats.Variations, want) {
+		t.Errorf("Expected variations %v, got %v", want, stats.Variations)
+	}
+	var bucketed int
+	for _, b := range stats.Buckets {
+		if len(b.Counts) != 3 {
+			t.Fatalf("Expected every variation in every bucket, got %v", b.Counts)
+		}
+		bucketed += b.Counts["on"] + b.Counts["off"]
+	}
+	if bucketed != 5 {
+		t.Errorf("Expected the buckets to add up to 5 evaluations, got %d", bucketed)
+	}
+	if want := []db.RuleHitCount{{Rule: "beta-users", Count: 3}, {Rule: "", Count: 2}}; !reflect.DeepEqual(stats.RuleHits, want) {
+		t.Errorf("Expected rule hits %v, got %v", want, stats.RuleHits)
+	}
+
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout/stats?window=2h", "", http.StatusOK, &stats)
+	if stats.Total != 2 || stats.Variations["off"] != 0 {
+		t.Errorf("Expected the 2 evaluations of the last 2 hours, got %+v", stats)
+	}
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout/stats", "", http.StatusOK, &stats)
+	if stats.Window != "7d" || stats.Bucket != "day" || stats.Total != 5 {
+		t.Errorf("Expected the default 7d window in daily buckets, got %s/%s with %d", stats.Window, stats.Bucket, stats.Total)
+	}
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout/stats?window=7x", "", http.StatusBadRequest, nil)
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout/stats?window=7d&bucket=week", "", http.StatusBadRequest, nil)
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout/stats?window=90d&bucket=hour", "", http.StatusBadRequest, nil)
+
+	fm.config.EvaluationRetention = 2 * time.Hour
+	if deleted, err := fm.purgeExpiredEvaluations(context.Background(), now); err != nil || deleted != 3 {
+		t.Errorf("Expected 3 expired evaluations to be purged, got %d, %v", deleted, err)
+	}
+	doRequest(t, router, "GET", "/api/projects/web/flags/checkout/stats", "", http.StatusOK, &stats)
+	if stats.Total != 2 {
+		t.Errorf("Expected 2 evaluations after the purge, got %d", stats.Total)
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"flag-manager-api/db"
+	"flag-manager-api/secrets"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
@@ -78,14 +80,16 @@ type Exporter struct {
 // ExportersStore manages exporter configurations
 type ExportersStore struct {
 	configPath string
+	cipher     *secrets.Cipher
 	exporters  map[string]*Exporter
 	mu         sync.RWMutex
 }
 
 // NewExportersStore creates a new exporters store
-func NewExportersStore(configDir string) *ExportersStore {
+func NewExportersStore(configDir string, cipher *secrets.Cipher) *ExportersStore {
 	store := &ExportersStore{
 		configPath: filepath.Join(configDir, "exporters.json"),
+		cipher:     cipher,
 		exporters:  make(map[string]*Exporter),
 	}
 	store.load()
@@ -97,7 +101,7 @@ func (s *ExportersStore) load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := os.ReadFile(s.configPath)
+	data, err := readSealedFile(s.configPath, s.cipher, db.ExporterSecretFields)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -129,17 +133,16 @@ func (s *ExportersStore) save() error {
 		return err
 	}
 
-	return os.WriteFile(s.configPath, data, 0644)
+	return writeSealedFile(s.configPath, data, 0644, s.cipher, db.ExporterSecretFields)
 }
 
 // maskSecrets returns a copy with secrets masked
 func (s *ExportersStore) maskSecrets(exporter *Exporter) *Exporter {
 	masked := *exporter
-	if masked.Secret != "" {
-		masked.Secret = "********"
-	}
-	if masked.AzureAccountKey != "" {
-		masked.AzureAccountKey = "********"
+	for _, secret := range exporterSecrets(&masked) {
+		if *secret != "" && !isSecretRef(*secret) {
+			*secret = "********"
+		}
 	}
 	return &masked
 }
@@ -396,44 +399,63 @@ func exporterToDBExporter(e Exporter) db.DBExporter {
 	return dbe
 }
 
+// exporterSecrets returns the credentials of an exporter.
+func exporterSecrets(e *Exporter) []*string {
+	return []*string{&e.Secret, &e.AzureAccountKey}
+}
+
 func maskExporterSecrets(e *Exporter) *Exporter {
 	masked := *e
-	if masked.Secret != "" {
-		masked.Secret = "********"
-	}
-	if masked.AzureAccountKey != "" {
-		masked.AzureAccountKey = "********"
+	for _, secret := range exporterSecrets(&masked) {
+		if *secret != "" && !isSecretRef(*secret) {
+			*secret = "********"
+		}
 	}
 	return &masked
 }
 
 // HTTP Handlers
 
+// ExportersResponse lists the exporters.
+type ExportersResponse struct {
+	Exporters []*Exporter `json:"exporters"`
+}
+
 func (fm *FlagManager) listExportersHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseListFilter(r)
+	if err != nil {
+		writeValidationError(w, "INVALID_FILTER", err.Error())
+		return
+	}
+
+	var exporters []*Exporter
 	if fm.store != nil {
 		dbItems, err := fm.store.ListExporters(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
-		exporters := make([]*Exporter, 0, len(dbItems))
+		exporters = make([]*Exporter, 0, len(dbItems))
 		for _, dbe := range dbItems {
 			e := dbExporterToExporter(dbe)
 			exporters = append(exporters, maskExporterSecrets(&e))
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"exporters": exporters,
-		})
-		return
+	} else {
+		exporters = fm.exporters.List()
 	}
+	exporters = slices.DeleteFunc(exporters, func(e *Exporter) bool { return !filter.keeps(!e.Enabled, e.Kind) })
 
-	exporters := fm.exporters.List()
+	if wantsPage(r) {
+		writePage(w, r, pageList(r, exporters,
+			func(e *Exporter) string { return e.Name + " " + e.Description },
+			namedSorts(func(e *Exporter) string { return e.Name }, func(e *Exporter) string { return e.Kind },
+				func(e *Exporter) time.Time { return e.CreatedAt }, func(e *Exporter) time.Time { return e.UpdatedAt }),
+			"name"))
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"exporters": exporters,
-	})
+	json.NewEncoder(w).Encode(ExportersResponse{Exporters: exporters})
 }
 
 func (fm *FlagManager) getExporterHandler(w http.ResponseWriter, r *http.Request) {
@@ -444,9 +466,9 @@ func (fm *FlagManager) getExporterHandler(w http.ResponseWriter, r *http.Request
 		dbe, err := fm.store.GetExporter(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Exporter not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "EXPORTER_NOT_FOUND", "Exporter not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -458,7 +480,7 @@ func (fm *FlagManager) getExporterHandler(w http.ResponseWriter, r *http.Request
 
 	exporter := fm.exporters.Get(id)
 	if exporter == nil {
-		http.Error(w, "Exporter not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "EXPORTER_NOT_FOUND", "Exporter not found")
 		return
 	}
 
@@ -469,22 +491,22 @@ func (fm *FlagManager) getExporterHandler(w http.ResponseWriter, r *http.Request
 func (fm *FlagManager) createExporterHandler(w http.ResponseWriter, r *http.Request) {
 	var exporter Exporter
 	if err := json.NewDecoder(r.Body).Decode(&exporter); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if exporter.ID == "" {
-		http.Error(w, "ID is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "ID is required")
 		return
 	}
 
 	if exporter.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Name is required")
 		return
 	}
 
 	if exporter.Kind == "" {
-		http.Error(w, "Kind is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Kind is required")
 		return
 	}
 
@@ -502,7 +524,7 @@ func (fm *FlagManager) createExporterHandler(w http.ResponseWriter, r *http.Requ
 		"pubsub":           true,
 	}
 	if !validKinds[exporter.Kind] {
-		http.Error(w, "Invalid kind. Must be one of: file, webhook, log, s3, googleStorage, azureBlobStorage, kafka, sqs, kinesis, pubsub", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Invalid kind. Must be one of: file, webhook, log, s3, googleStorage, azureBlobStorage, kafka, sqs, kinesis, pubsub")
 		return
 	}
 
@@ -510,7 +532,7 @@ func (fm *FlagManager) createExporterHandler(w http.ResponseWriter, r *http.Requ
 		dbe := exporterToDBExporter(exporter)
 		created, err := fm.store.CreateExporter(r.Context(), dbe)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusConflict)
+			writeError(w, http.StatusConflict, "CONFLICT", err.Error())
 			return
 		}
 		e := dbExporterToExporter(*created)
@@ -521,7 +543,7 @@ func (fm *FlagManager) createExporterHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := fm.exporters.Create(&exporter); err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		writeError(w, http.StatusConflict, "CONFLICT", err.Error())
 		return
 	}
 
@@ -536,7 +558,7 @@ func (fm *FlagManager) updateExporterHandler(w http.ResponseWriter, r *http.Requ
 
 	var updates Exporter
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
@@ -545,9 +567,9 @@ func (fm *FlagManager) updateExporterHandler(w http.ResponseWriter, r *http.Requ
 		existing, err := fm.store.GetExporter(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Exporter not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "EXPORTER_NOT_FOUND", "Exporter not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -562,7 +584,7 @@ func (fm *FlagManager) updateExporterHandler(w http.ResponseWriter, r *http.Requ
 		dbe := exporterToDBExporter(updates)
 		updated, err := fm.store.UpdateExporter(r.Context(), id, dbe)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 			return
 		}
 		e := dbExporterToExporter(*updated)
@@ -572,7 +594,7 @@ func (fm *FlagManager) updateExporterHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := fm.exporters.Update(id, &updates); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		return
 	}
 
@@ -586,7 +608,7 @@ func (fm *FlagManager) deleteExporterHandler(w http.ResponseWriter, r *http.Requ
 
 	if fm.store != nil {
 		if err := fm.store.DeleteExporter(r.Context(), id); err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -594,7 +616,7 @@ func (fm *FlagManager) deleteExporterHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := fm.exporters.Delete(id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		return
 	}
 
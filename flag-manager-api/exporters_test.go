@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExportersCRUD(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	var createdID string
+
+	t.Run("create file exporter", func(t *testing.T) {
+		exporter := map[string]interface{}{
+			"id":         "test-file-exporter",
+			"name":       "file-exporter",
+			"kind":       "file",
+			"enabled":    true,
+			"outputDir":  "/var/log/goff",
+			"fileFormat": "json",
+		}
+
+		body, _ := json.Marshal(exporter)
+		req := httptest.NewRequest("POST", "/api/exporters", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		createdID = response["id"].(string)
+	})
+
+	t.Run("list exporters", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/exporters", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("get exporter", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/exporters/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("update exporter", func(t *testing.T) {
+		exporter := map[string]interface{}{
+			"id":         createdID,
+			"name":       "file-exporter-updated",
+			"kind":       "file",
+			"enabled":    false,
+			"outputDir":  "/var/log/goff-new",
+			"fileFormat": "csv",
+		}
+
+		body, _ := json.Marshal(exporter)
+		req := httptest.NewRequest("PUT", "/api/exporters/"+createdID, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("delete exporter", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/exporters/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status 200 or 204, got %d", rr.Code)
+		}
+	})
+}
+
+func TestAllExporterTypes(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	testCases := []struct {
+		name     string
+		exporter map[string]interface{}
+	}{
+		{
+			name: "file exporter",
+			exporter: map[string]interface{}{
+				"id":        "test-file",
+				"name":      "file",
+				"kind":      "file",
+				"enabled":   true,
+				"outputDir": "/var/log/goff",
+			},
+		},
+		{
+			name: "webhook exporter",
+			exporter: map[string]interface{}{
+				"id":          "test-webhook",
+				"name":        "webhook",
+				"kind":        "webhook",
+				"enabled":     true,
+				"endpointUrl": "https://example.com/export",
+			},
+		},
+		{
+			name: "log exporter",
+			exporter: map[string]interface{}{
+				"id":      "test-log",
+				"name":    "log",
+				"kind":    "log",
+				"enabled": true,
+			},
+		},
+		{
+			name: "s3 exporter",
+			exporter: map[string]interface{}{
+				"id":       "test-s3",
+				"name":     "s3",
+				"kind":     "s3",
+				"enabled":  true,
+				"s3Bucket": "my-bucket",
+			},
+		},
+		{
+			name: "google storage exporter",
+			exporter: map[string]interface{}{
+				"id":        "test-gcs",
+				"name":      "gcs",
+				"kind":      "googleStorage",
+				"enabled":   true,
+				"gcsBucket": "my-bucket",
+			},
+		},
+		{
+			name: "kafka exporter",
+			exporter: map[string]interface{}{
+				"id":          "test-kafka",
+				"name":        "kafka",
+				"kind":        "kafka",
+				"enabled":     true,
+				"kafkaTopic":  "feature-flags",
+				"kafkaBroker": "localhost:9092",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.exporter)
+			req := httptest.NewRequest("POST", "/api/exporters", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusCreated {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
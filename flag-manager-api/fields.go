@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// flagResponseFields are the top-level fields a flag response can be projected on,
+// with the type used to validate nested paths (nil means no nested paths).
+var flagResponseFields = map[string]reflect.Type{
+	"key":         nil,
+	"config":      reflect.TypeOf(FlagConfig{}),
+	"contentHash": nil,
+	"id":          nil,
+	"projectId":   nil,
+	"disabled":    nil,
+	"version":     nil,
+	"createdAt":   nil,
+	"updatedAt":   nil,
+}
+
+// parseFieldSelection reads the ?fields= query parameter, a comma-separated list
+// of dotted paths such as "key,config.defaultRule,config.disable". It returns nil
+// when no selection was requested.
+func parseFieldSelection(r *http.Request) ([]string, error) {
+	raw := r.URL.Query().Get("fields")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if err := validateFieldPath(field); err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// validateFieldPath checks a dotted path against the flag response schema. Map
+// values (variations, metadata, percentages) accept any key, and paths through
+// lists such as targeting apply to every element.
+func validateFieldPath(path string) error {
+	segments := strings.Split(path, ".")
+	t, ok := flagResponseFields[segments[0]]
+	if !ok {
+		return fmt.Errorf("unknown field: %s", path)
+	}
+
+	for _, seg := range segments[1:] {
+		if seg == "" || t == nil {
+			return fmt.Errorf("unknown field: %s", path)
+		}
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+
+		switch t.Kind() {
+		case reflect.Interface:
+			return nil
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Struct:
+			field, found := jsonFieldByName(t, seg)
+			if !found {
+				return fmt.Errorf("unknown field: %s", path)
+			}
+			t = field.Type
+		default:
+			return fmt.Errorf("unknown field: %s", path)
+		}
+	}
+	return nil
+}
+
+// jsonFieldByName finds the struct field serialized under the given JSON name.
+func jsonFieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if strings.Split(f.Tag.Get("json"), ",")[0] == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// projectFields returns a copy of v (any JSON-compatible value) containing only
+// the given dotted paths. Paths that are absent from v are skipped.
+func projectFields(v interface{}, fields []string) (map[string]interface{}, error) {
+	generic, err := toGenericValue(v)
+	if err != nil {
+		return nil, err
+	}
+	src, _ := generic.(map[string]interface{})
+
+	dst := make(map[string]interface{})
+	for _, field := range fields {
+		projectPath(dst, src, strings.Split(field, "."))
+	}
+	return dst, nil
+}
+
+func projectPath(dst, src map[string]interface{}, segments []string) {
+	val, ok := src[segments[0]]
+	if !ok {
+		return
+	}
+	if len(segments) == 1 {
+		dst[segments[0]] = val
+		return
+	}
+
+	switch typed := val.(type) {
+	case map[string]interface{}:
+		sub, _ := dst[segments[0]].(map[string]interface{})
+		if sub == nil {
+			sub = make(map[string]interface{})
+			dst[segments[0]] = sub
+		}
+		projectPath(sub, typed, segments[1:])
+	case []interface{}:
+		items, _ := dst[segments[0]].([]interface{})
+		if len(items) != len(typed) {
+			items = make([]interface{}, len(typed))
+			dst[segments[0]] = items
+		}
+		for i, elem := range typed {
+			elemMap, ok := elem.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			sub, _ := items[i].(map[string]interface{})
+			if sub == nil {
+				sub = make(map[string]interface{})
+				items[i] = sub
+			}
+			projectPath(sub, elemMap, segments[1:])
+		}
+	}
+}
+
+// writeFlagResponse writes a single flag as {key, config}, projected on the
+// requested fields when ?fields= is set.
+func writeFlagResponse(w http.ResponseWriter, r *http.Request, flagKey string, config FlagConfig) {
+	fields, err := parseFieldSelection(r)
+	if err != nil {
+		writeValidationError(w, "INVALID_FIELDS", err.Error())
+		return
+	}
+
+	var resp interface{} = newFlagResponse(flagKey, config)
+	if fields != nil {
+		if resp, err = projectFields(resp, fields); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// FlagListResponse lists flags keyed by flag key.
+type FlagListResponse struct {
+	Flags map[string]interface{} `json:"flags"`
+}
+
+// writeFlagListResponse writes flags as {"flags": {key: config}}. With ?fields=,
+// each config is projected on the requested "config." paths; "key" is implied
+// by the map key.
+func writeFlagListResponse(w http.ResponseWriter, r *http.Request, flags map[string]interface{}) {
+	fields, err := parseFieldSelection(r)
+	if err != nil {
+		writeValidationError(w, "INVALID_FIELDS", err.Error())
+		return
+	}
+
+	if fields != nil {
+		projected := make(map[string]interface{}, len(flags))
+		for key, config := range flags {
+			entry, err := projectFields(map[string]interface{}{"key": key, "config": config}, fields)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+			projected[key] = entry["config"]
+		}
+		flags = projected
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FlagListResponse{Flags: flags})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFlagFieldSelection(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	body, _ := json.Marshal(FlagConfig{
+		Variations:  map[string]interface{}{"on": true, "off": false},
+		Targeting:   []TargetingRule{{Name: "beta", Query: `beta eq true`, Variation: "on"}},
+		DefaultRule: &DefaultRule{Variation: "off"},
+		Disable:     boolPtr(false),
+		Metadata:    map[string]interface{}{"owner": "web"},
+	})
+	req := httptest.NewRequest("POST", "/api/projects/web/flags/banner", bytes.NewReader(body))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	get := func(url string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", url, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	t.Run("single flag", func(t *testing.T) {
+		code, resp := get("/api/projects/web/flags/banner?fields=key,config.defaultRule,config.disable,config.targeting.query")
+		if code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+		want := map[string]interface{}{
+			"key": "banner",
+			"config": map[string]interface{}{
+				"defaultRule": map[string]interface{}{"variation": "off"},
+				"disable":     false,
+				"targeting":   []interface{}{map[string]interface{}{"query": "beta eq true"}},
+			},
+		}
+		if !reflect.DeepEqual(resp, want) {
+			t.Errorf("Unexpected projection: %v", resp)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		code, resp := get("/api/projects/web/flags?fields=config.metadata.owner")
+		if code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+		want := map[string]interface{}{
+			"flags": map[string]interface{}{
+				"banner": map[string]interface{}{"metadata": map[string]interface{}{"owner": "web"}},
+			},
+		}
+		if !reflect.DeepEqual(resp, want) {
+			t.Errorf("Unexpected projection: %v", resp)
+		}
+	})
+
+	t.Run("unknown paths rejected", func(t *testing.T) {
+		for _, fields := range []string{"nope", "config.defaultRule.nope", "key.length", "config..disable"} {
+			code, resp := get("/api/projects/web/flags/banner?fields=" + fields)
+			if code != http.StatusBadRequest || resp["code"] != "INVALID_FIELDS" {
+				t.Errorf("Expected INVALID_FIELDS for %q, got %d %v", fields, code, resp)
+			}
+		}
+	})
+}
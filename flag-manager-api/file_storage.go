@@ -1,23 +1,90 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"log"
-	"net/http"
+	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/gorilla/mux"
+	"flag-manager-api/db"
+
+	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 )
 
 // File-based storage methods - used when DATABASE_URL is not set.
 // These preserve the original file-based behavior for simple deployments.
 
+// Lock ordering (file mode)
+//
+// Operations that touch more than one resource must acquire locks in this
+// order to avoid deadlocks:
+//
+//  1. Flag file locks, acquired together through lockFlagFiles, which sorts
+//     them by path. These serialize read-modify-write cycles on a file.
+//  2. fileMu, held only for the duration of a single file read or write.
+//  3. Per-store mutexes (FlagSetsStore.mu, NotifiersStore.mu, ...), which are
+//     internal to each store and never held while calling into another store.
+//  4. The write lock of a single file, taken by writeFileAtomic for the
+//     duration of the write only.
+//
+// Never acquire a flag file lock while holding fileMu or a store mutex, and
+// never call lockFlagFiles twice without releasing the first set of locks.
+
 var fileMu sync.RWMutex
 
+var (
+	flagFileLocksMu sync.Mutex
+	flagFileLocks   = make(map[string]*sync.Mutex)
+)
+
+// flagFileLock returns the lock guarding a single flags file.
+func flagFileLock(path string) *sync.Mutex {
+	flagFileLocksMu.Lock()
+	defer flagFileLocksMu.Unlock()
+
+	l, ok := flagFileLocks[path]
+	if !ok {
+		l = &sync.Mutex{}
+		flagFileLocks[path] = l
+	}
+	return l
+}
+
+// lockFlagFiles acquires the locks for the given flag files in ascending path
+// order and returns a function that releases them. Duplicate paths are locked once.
+func lockFlagFiles(paths ...string) func() {
+	sorted := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		if !seen[p] {
+			seen[p] = true
+			sorted = append(sorted, p)
+		}
+	}
+	sort.Strings(sorted)
+
+	locks := make([]*sync.Mutex, 0, len(sorted))
+	for _, p := range sorted {
+		l := flagFileLock(p)
+		l.Lock()
+		locks = append(locks, l)
+	}
+
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
 // getProjectFilePath returns the file path for a project
 func (fm *FlagManager) getProjectFilePath(project string) string {
 	return filepath.Join(fm.config.FlagsDir, project+".yaml")
@@ -60,7 +127,8 @@ func (fm *FlagManager) writeProjectFlags(project string, flags ProjectFlags) err
 		return err
 	}
 
-	return os.WriteFile(filePath, data, 0644)
+	defer fm.searchIndex.invalidate()
+	return writeFileAtomic(filePath, data, 0644)
 }
 
 // listProjectsFile returns all project names from file system
@@ -83,280 +151,645 @@ func (fm *FlagManager) listProjectsFile() ([]string, error) {
 	return projects, nil
 }
 
-// File-based handler fallbacks
+// Files of a project in the trash, in FLAGS_DIR/.trash/<id>/
+const (
+	trashEntryFile       = "trash.json"
+	trashFlagsFile       = "flags.yaml"
+	trashEnvironmentsDir = "environments"
+)
 
-func (fm *FlagManager) getRawFlagsFileBased(w http.ResponseWriter, r *http.Request) {
-	projects, err := fm.listProjectsFile()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// trashEntry records a project deletion in its trash directory.
+type trashEntry struct {
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deletedAt"`
+	DeletedBy string    `json:"deletedBy,omitempty"`
+}
 
-	allFlags := make(map[string]FlagConfig)
-	for _, project := range projects {
-		flags, err := fm.readProjectFlags(project)
-		if err != nil {
-			log.Printf("Warning: Failed to read %s: %v", project, err)
-			continue
-		}
-		for flagKey, flagConfig := range flags {
-			fullKey := project + "/" + flagKey
-			allFlags[fullKey] = flagConfig
-		}
-	}
+func (e trashEntry) project(id string, flags int) *TrashedProject {
+	return &TrashedProject{ID: id, Type: "project", Name: e.Name, Flags: flags, DeletedAt: e.DeletedAt, DeletedBy: e.DeletedBy}
+}
 
-	w.Header().Set("Content-Type", "application/x-yaml")
-	yaml.NewEncoder(w).Encode(allFlags)
+// trashDir returns the directory of the projects in the trash. Project names
+// start with an alphanumeric, so it is never listed as a project.
+func (fm *FlagManager) trashDir() string {
+	return filepath.Join(fm.config.FlagsDir, ".trash")
 }
 
-func (fm *FlagManager) getRawProjectFlagsFileBased(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	project := vars["project"]
+// trashEntryDir returns the trash directory of a deleted project.
+func (fm *FlagManager) trashEntryDir(id string) string {
+	return filepath.Join(fm.trashDir(), id)
+}
 
-	flags, err := fm.readProjectFlags(project)
+// readTrashEntry returns a project in the trash, or errTrashNotFound.
+func (fm *FlagManager) readTrashEntry(id string) (*TrashedProject, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errTrashNotFound
+	}
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+
+	dir := fm.trashEntryDir(id)
+	data, err := os.ReadFile(filepath.Join(dir, trashEntryFile))
+	if os.IsNotExist(err) {
+		return nil, errTrashNotFound
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	var entry trashEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
 	}
 
-	if flags == nil {
-		http.Error(w, "Project not found", http.StatusNotFound)
-		return
+	data, err = os.ReadFile(filepath.Join(dir, trashFlagsFile))
+	if os.IsNotExist(err) {
+		return nil, errTrashNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var flags ProjectFlags
+	if err := yaml.Unmarshal(data, &flags); err != nil {
+		return nil, err
 	}
+	return entry.project(id, len(flags)), nil
+}
 
-	w.Header().Set("Content-Type", "application/x-yaml")
-	yaml.NewEncoder(w).Encode(flags)
+// fileStorage stores each project's flags in a YAML file in FLAGS_DIR.
+type fileStorage struct {
+	fm *FlagManager
 }
 
-func (fm *FlagManager) listProjectsFileBased(w http.ResponseWriter, r *http.Request) {
-	projects, err := fm.listProjectsFile()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// ListProjects leaves out the flags files of flag sets, which sit next to
+// the project files.
+func (s *fileStorage) ListProjects(ctx context.Context) ([]string, error) {
+	projects, err := s.fm.listProjectsFile()
+	if err != nil || s.fm.flagSets == nil {
+		return projects, err
 	}
-
-	if projects == nil {
-		projects = []string{}
+	flagSetFiles := make(map[string]bool)
+	for _, fs := range s.fm.flagSets.List() {
+		flagSetFiles[strings.TrimSuffix(filepath.Base(s.fm.getFlagSetFilePath(fs.ID)), ".yaml")] = true
 	}
+	return slices.DeleteFunc(projects, func(project string) bool {
+		return flagSetFiles[project]
+	}), nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string][]string{"projects": projects})
+func (s *fileStorage) ProjectExists(ctx context.Context, project string) (bool, error) {
+	flags, err := s.fm.readProjectFlags(project)
+	return flags != nil, err
 }
 
-func (fm *FlagManager) getProjectFileBased(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	project := vars["project"]
+func (s *fileStorage) CreateProject(ctx context.Context, project string) error {
+	defer s.LockProject(project)()
 
-	flags, err := fm.readProjectFlags(project)
+	flags, err := s.fm.readProjectFlags(project)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
+	}
+	if flags != nil {
+		return errProjectExists
+	}
+	if err := s.checkNotInTrash(project); err != nil {
+		return err
 	}
+	return s.fm.writeProjectFlags(project, make(ProjectFlags))
+}
 
+// DeleteProject moves the project file and environments to a directory of
+// the trash. Its meta and history stay in place, with the name reserved,
+// until it is purged.
+func (s *fileStorage) DeleteProject(ctx context.Context, project string) (*TrashedProject, error) {
+	defer s.LockProject(project)()
+
+	flags, err := s.fm.readProjectFlags(project)
+	if err != nil {
+		return nil, err
+	}
 	if flags == nil {
-		http.Error(w, "Project not found", http.StatusNotFound)
-		return
+		return nil, errProjectNotFound
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"project": project,
-		"flags":   flags,
-	})
-}
+	entry := trashEntry{Name: project, DeletedAt: time.Now().UTC(), DeletedBy: trashDeletedBy(ctx)}
+	id := uuid.NewString()
+	dir := s.fm.trashEntryDir(id)
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	fileMu.Lock()
+	err = writeFileAtomic(filepath.Join(dir, trashEntryFile), data, 0644)
+	if err == nil {
+		err = os.Rename(s.fm.getProjectFilePath(project), filepath.Join(dir, trashFlagsFile))
+	}
+	fileMu.Unlock()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	s.fm.searchIndex.invalidate()
 
-func (fm *FlagManager) createProjectFileBased(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	project := vars["project"]
+	envDir := filepath.Dir(s.fm.getEnvironmentFilePath(project, ""))
+	if err := os.Rename(envDir, filepath.Join(dir, trashEnvironmentsDir)); err != nil && !os.IsNotExist(err) {
+		slog.WarnContext(ctx, "Failed to move project environments to the trash", "project", project, "error", err)
+	}
+	return entry.project(id, len(flags)), nil
+}
 
-	flags, err := fm.readProjectFlags(project)
+func (s *fileStorage) ListTrash(ctx context.Context) ([]TrashedProject, error) {
+	entries, err := os.ReadDir(s.fm.trashDir())
+	if os.IsNotExist(err) {
+		return []TrashedProject{}, nil
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	if flags != nil {
-		http.Error(w, "Project already exists", http.StatusConflict)
-		return
+	trash := []TrashedProject{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p, err := s.fm.readTrashEntry(e.Name())
+		if err != nil {
+			if !errors.Is(err, errTrashNotFound) {
+				slog.WarnContext(ctx, "Failed to read trashed project", "id", e.Name(), "error", err)
+			}
+			continue
+		}
+		trash = append(trash, *p)
 	}
+	sort.Slice(trash, func(i, j int) bool { return trash[i].DeletedAt.After(trash[j].DeletedAt) })
+	return trash, nil
+}
 
-	if err := fm.writeProjectFlags(project, make(ProjectFlags)); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+func (s *fileStorage) RestoreProject(ctx context.Context, id string) (*TrashedProject, error) {
+	p, err := s.fm.readTrashEntry(id)
+	if err != nil {
+		return nil, err
 	}
+	defer s.LockProject(p.Name)()
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"project": project, "status": "created"})
-}
+	// The project may have been restored or purged while waiting for the lock
+	if p, err = s.fm.readTrashEntry(id); err != nil {
+		return nil, err
+	}
+	dir := s.fm.trashEntryDir(id)
+	fileMu.Lock()
+	_, err = os.Stat(s.fm.getProjectFilePath(p.Name))
+	if err == nil {
+		err = errProjectExists
+	} else if os.IsNotExist(err) {
+		err = os.Rename(filepath.Join(dir, trashFlagsFile), s.fm.getProjectFilePath(p.Name))
+	}
+	fileMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	s.fm.searchIndex.invalidate()
 
-func (fm *FlagManager) deleteProjectFileBased(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	project := vars["project"]
+	envDir := filepath.Dir(s.fm.getEnvironmentFilePath(p.Name, ""))
+	if err := os.Rename(filepath.Join(dir, trashEnvironmentsDir), envDir); err != nil && !os.IsNotExist(err) {
+		slog.WarnContext(ctx, "Failed to restore project environments", "project", p.Name, "error", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		slog.WarnContext(ctx, "Failed to remove trash entry", "project", p.Name, "id", id, "error", err)
+	}
+	return p, nil
+}
 
-	filePath := fm.getProjectFilePath(project)
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		http.Error(w, "Project not found", http.StatusNotFound)
-		return
+// PurgeProject removes the trash directory of a project with its meta and
+// history.
+func (s *fileStorage) PurgeProject(ctx context.Context, id string) (*TrashedProject, error) {
+	p, err := s.fm.readTrashEntry(id)
+	if err != nil {
+		return nil, err
 	}
+	defer s.LockProject(p.Name)()
 
-	if err := os.Remove(filePath); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if p, err = s.fm.readTrashEntry(id); err != nil {
+		return nil, err
+	}
+	if err := os.RemoveAll(s.fm.trashEntryDir(id)); err != nil {
+		return nil, err
+	}
+	s.fm.history().deleteProject(ctx, p.Name)
+	if s.fm.projectMeta != nil {
+		if err := s.fm.projectMeta.Delete(p.Name); err != nil {
+			slog.WarnContext(ctx, "Failed to remove project meta", "project", p.Name, "error", err)
+		}
 	}
+	return p, nil
+}
 
-	go fm.refreshRelayProxy()
-	w.WriteHeader(http.StatusNoContent)
+// checkNotInTrash returns errProjectInTrash if a deleted project keeps the
+// name.
+func (s *fileStorage) checkNotInTrash(project string) error {
+	trash, err := s.ListTrash(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, p := range trash {
+		if p.Name == project {
+			return errProjectInTrash
+		}
+	}
+	return nil
 }
 
-func (fm *FlagManager) listFlagsFileBased(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	project := vars["project"]
+func (s *fileStorage) ListFlags(ctx context.Context, project string) (ProjectFlags, error) {
+	flags, err := s.fm.readProjectFlags(project)
+	if err == nil && flags == nil {
+		err = errProjectNotFound
+	}
+	return flags, err
+}
 
-	flags, err := fm.readProjectFlags(project)
+func (s *fileStorage) AllFlags(ctx context.Context) (map[string]FlagConfig, error) {
+	projects, err := s.fm.listProjectsFile()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	if flags == nil {
-		http.Error(w, "Project not found", http.StatusNotFound)
-		return
+	allFlags := make(map[string]FlagConfig)
+	for _, project := range projects {
+		flags, err := s.fm.readProjectFlags(project)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read project flags", "project", project, "error", err)
+			continue
+		}
+		for flagKey, flagConfig := range flags {
+			allFlags[project+"/"+flagKey] = flagConfig
+		}
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"flags": flags})
+	return allFlags, nil
 }
 
-func (fm *FlagManager) getFlagFileBased(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	project := vars["project"]
-	flagKey := vars["flagKey"]
+func (s *fileStorage) ListPublishedFlags(ctx context.Context, project string) (ProjectFlags, error) {
+	flags, err := s.ListFlags(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	return servedFlags(flags), nil
+}
 
-	flags, err := fm.readProjectFlags(project)
+func (s *fileStorage) AllPublishedFlags(ctx context.Context) (map[string]FlagConfig, error) {
+	allFlags, err := s.AllFlags(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
+	return servedFlags(allFlags), nil
+}
 
-	if flags == nil {
-		http.Error(w, "Project not found", http.StatusNotFound)
-		return
+// EachPublishedFlag reads one project file at a time.
+func (s *fileStorage) EachPublishedFlag(ctx context.Context, fn func(key string, config FlagConfig) error) error {
+	projects, err := s.fm.listProjectsFile()
+	if err != nil {
+		return err
+	}
+	sort.Strings(projects)
+	for _, project := range projects {
+		flags, err := s.fm.readProjectFlags(project)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read project flags", "project", project, "error", err)
+			continue
+		}
+		flags = servedFlags(flags)
+		for _, key := range sortedKeys(flags) {
+			if err := fn(project+"/"+key, flags[key]); err != nil {
+				return err
+			}
+		}
 	}
+	return nil
+}
 
-	flag, exists := flags[flagKey]
+func (s *fileStorage) GetFlag(ctx context.Context, project, key string) (*StoredFlag, error) {
+	flags, err := s.ListFlags(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	config, exists := flags[key]
 	if !exists {
-		http.Error(w, "Flag not found", http.StatusNotFound)
-		return
+		return nil, errFlagNotFound
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"key":    flagKey,
-		"config": flag,
-	})
+	return &StoredFlag{Key: key, Config: config}, nil
 }
 
-func (fm *FlagManager) createFlagFileBased(w http.ResponseWriter, r *http.Request, project, flagKey string, flagConfig FlagConfig) {
-	flags, err := fm.readProjectFlags(project)
+func (s *fileStorage) CreateFlag(ctx context.Context, project, key string, config FlagConfig) (*StoredFlag, error) {
+	defer s.LockProject(project)()
+
+	flags, err := s.fm.readProjectFlags(project)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-
 	if flags == nil {
+		if err := s.checkNotInTrash(project); err != nil {
+			return nil, err
+		}
 		flags = make(ProjectFlags)
 	}
+	if _, exists := flags[key]; exists {
+		return nil, errFlagExists
+	}
 
-	if _, exists := flags[flagKey]; exists {
-		http.Error(w, "Flag already exists", http.StatusConflict)
-		return
+	flags[key] = config
+	if err := s.fm.writeProjectFlags(project, flags); err != nil {
+		return nil, err
 	}
+	countFlagOperation("create", 1)
+	s.fm.history().record(ctx, project, flagRevision{Key: key, Action: flagVersionCreated, Config: &config})
+	return &StoredFlag{Key: key, Config: config}, nil
+}
 
-	flags[flagKey] = flagConfig
+func (s *fileStorage) UpdateFlag(ctx context.Context, project, key, newKey string, config FlagConfig) (*StoredFlag, *StoredFlag, error) {
+	defer lockFlagFiles(s.fm.projectFlagFilePaths(project)...)()
 
-	if err := fm.writeProjectFlags(project, flags); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	flags, err := s.ListFlags(ctx, project)
+	if err != nil {
+		return nil, nil, err
+	}
+	before, exists := flags[key]
+	if !exists {
+		return nil, nil, errFlagNotFound
 	}
 
-	go fm.refreshRelayProxy()
+	effectiveKey := key
+	if newKey != "" && newKey != key {
+		if _, exists := flags[newKey]; exists {
+			return nil, nil, errFlagExists
+		}
+		delete(flags, key)
+		effectiveKey = newKey
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"key":    flagKey,
-		"config": flagConfig,
-	})
+	flags[effectiveKey] = config
+	if err := s.fm.writeProjectFlags(project, flags); err != nil {
+		return nil, nil, err
+	}
+	countFlagOperation("update", 1)
+	s.fm.history().record(ctx, project, updateRevision(key, effectiveKey, config))
+	if effectiveKey != key {
+		if err := s.fm.moveEnvironmentFlagConfigs(project, key, effectiveKey); err != nil {
+			slog.WarnContext(ctx, "Failed to rename environment configs", "project", project, "flag", key, "new_flag", effectiveKey, "error", err)
+		}
+	}
+	return &StoredFlag{Key: key, Config: before}, &StoredFlag{Key: effectiveKey, Config: config}, nil
 }
 
-func (fm *FlagManager) updateFlagFileBased(w http.ResponseWriter, r *http.Request, project, flagKey string, flagConfig FlagConfig, newKey string) {
-	flags, err := fm.readProjectFlags(project)
+func (s *fileStorage) DeleteFlag(ctx context.Context, project, key string) (*StoredFlag, error) {
+	defer lockFlagFiles(s.fm.projectFlagFilePaths(project)...)()
+
+	flags, err := s.ListFlags(ctx, project)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	before, exists := flags[key]
+	if !exists {
+		return nil, errFlagNotFound
 	}
 
-	if flags == nil {
-		http.Error(w, "Project not found", http.StatusNotFound)
-		return
+	delete(flags, key)
+	if err := s.fm.writeProjectFlags(project, flags); err != nil {
+		return nil, err
 	}
+	countFlagOperation("delete", 1)
+	s.fm.history().record(ctx, project, flagRevision{Key: key, Action: flagVersionDeleted})
+	if err := s.fm.moveEnvironmentFlagConfigs(project, key, ""); err != nil {
+		slog.WarnContext(ctx, "Failed to remove environment configs", "project", project, "flag", key, "error", err)
+	}
+	return &StoredFlag{Key: key, Config: before}, nil
+}
 
-	if _, exists := flags[flagKey]; !exists {
-		http.Error(w, "Flag not found", http.StatusNotFound)
-		return
+// SaveFlags rewrites the whole project file; the caller must hold the
+// project's lock.
+func (s *fileStorage) SaveFlags(ctx context.Context, project string, flags ProjectFlags, changed []string) (map[string]string, error) {
+	if err := s.fm.writeProjectFlags(project, flags); err != nil {
+		return nil, err
 	}
+	countFlagOperation("update", len(changed))
+	s.fm.history().record(ctx, project, savedRevisions(flags, changed)...)
+	return make(map[string]string), nil
+}
 
-	effectiveKey := flagKey
-	if newKey != "" && newKey != flagKey {
-		if _, exists := flags[newKey]; exists {
-			http.Error(w, "Flag with new key already exists", http.StatusConflict)
-			return
-		}
-		delete(flags, flagKey)
-		effectiveKey = newKey
+func (s *fileStorage) LockProject(project string) func() {
+	return lockFlagFiles(s.fm.getProjectFilePath(project))
+}
+
+func (s *fileStorage) ListEnvironmentFlags(ctx context.Context, project, env string) (ProjectFlags, error) {
+	return s.fm.readEnvironmentFlags(project, env)
+}
+
+func (s *fileStorage) SetEnvironmentFlag(ctx context.Context, project, env, key string, config FlagConfig) (string, *FlagConfig, error) {
+	defer lockFlagFiles(s.fm.getProjectFilePath(project), s.fm.getEnvironmentFilePath(project, env))()
+
+	flags, err := s.fm.readProjectFlags(project)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, ok := flags[key]; !ok {
+		return "", nil, errFlagNotFound
+	}
+	configs, err := s.fm.readEnvironmentFlags(project, env)
+	if err != nil {
+		return "", nil, err
 	}
+	var before *FlagConfig
+	if prev, ok := configs[key]; ok {
+		before = &prev
+	}
+	configs[key] = config
+	return "", before, s.fm.writeEnvironmentFlags(project, env, configs)
+}
 
-	flags[effectiveKey] = flagConfig
+func (s *fileStorage) DeleteEnvironmentFlag(ctx context.Context, project, env, key string) (*FlagConfig, error) {
+	defer lockFlagFiles(s.fm.getEnvironmentFilePath(project, env))()
 
-	if err := fm.writeProjectFlags(project, flags); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	configs, err := s.fm.readEnvironmentFlags(project, env)
+	if err != nil {
+		return nil, err
 	}
+	before, ok := configs[key]
+	if !ok {
+		return nil, errFlagNotConfigured
+	}
+	delete(configs, key)
+	if err := s.fm.writeEnvironmentFlags(project, env, configs); err != nil {
+		return nil, err
+	}
+	return &before, nil
+}
 
-	go fm.refreshRelayProxy()
+func (s *fileStorage) DeleteEnvironmentFlags(ctx context.Context, project, env string) error {
+	defer lockFlagFiles(s.fm.getEnvironmentFilePath(project, env))()
+	return s.fm.writeEnvironmentFlags(project, env, nil)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"key":    effectiveKey,
-		"config": flagConfig,
-	})
+func (s *fileStorage) ListFlagSets(ctx context.Context) ([]FlagSet, error) {
+	return s.fm.flagSets.List(), nil
 }
 
-func (fm *FlagManager) deleteFlagFileBased(w http.ResponseWriter, r *http.Request, project, flagKey string) {
-	flags, err := fm.readProjectFlags(project)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+func (s *fileStorage) GetFlagSet(ctx context.Context, id string) (*FlagSet, error) {
+	fs := s.fm.flagSets.Get(id)
+	if fs == nil {
+		return nil, errFlagSetNotFound
 	}
+	return fs, nil
+}
 
-	if flags == nil {
-		http.Error(w, "Project not found", http.StatusNotFound)
-		return
+// CreateFlagSet gives a flag set with a file retriever an empty flags file of
+// its own.
+func (s *fileStorage) CreateFlagSet(ctx context.Context, flagSet FlagSet) (*FlagSet, error) {
+	created, err := s.fm.flagSets.Create(flagSet)
+	if err != nil {
+		return nil, err
+	}
+	if flagSet.Retriever.Kind != "file" {
+		return created, nil
 	}
 
-	if _, exists := flags[flagKey]; !exists {
-		http.Error(w, "Flag not found", http.StatusNotFound)
-		return
+	path := s.fm.getFlagSetFilePath(created.ID)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		writeFileAtomic(path, []byte("# Flags for "+created.Name+"\n"), 0644)
 	}
+	created.Retriever.Path = path
+	return s.fm.flagSets.Update(created.ID, *created)
+}
 
-	delete(flags, flagKey)
+func (s *fileStorage) UpdateFlagSet(ctx context.Context, id string, flagSet FlagSet) (*FlagSet, error) {
+	if s.fm.flagSets.Get(id) == nil {
+		return nil, errFlagSetNotFound
+	}
+	return s.fm.flagSets.Update(id, flagSet)
+}
 
-	if err := fm.writeProjectFlags(project, flags); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// DeleteFlagSet also removes the flag set's flags file, which would otherwise
+// be listed as a project.
+func (s *fileStorage) DeleteFlagSet(ctx context.Context, id string) error {
+	if err := s.fm.flagSets.Delete(id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.fm.getFlagSetFilePath(id)); err != nil && !os.IsNotExist(err) {
+		return err
 	}
+	return nil
+}
+
+func (s *fileStorage) ListFlagSetFlags(ctx context.Context, id string) (map[string]interface{}, error) {
+	return s.fm.readFlagSetFlags(id)
+}
+
+// SaveFlagSetFlags rewrites the whole flag set file.
+func (s *fileStorage) SaveFlagSetFlags(ctx context.Context, id string, flags map[string]interface{}, changed []string) error {
+	return s.fm.writeFlagSetFlags(id, flags)
+}
+
+func (s *fileStorage) ListSegments(ctx context.Context, params db.PaginationParams) (*db.PaginatedResult[db.Segment], error) {
+	return nil, errDatabaseRequired
+}
+
+func (s *fileStorage) GetSegment(ctx context.Context, id string) (*db.Segment, error) {
+	return nil, errDatabaseRequired
+}
+
+// GetSegmentByName finds no segment, so that segment references in flags are
+// left as they are.
+func (s *fileStorage) GetSegmentByName(ctx context.Context, name string) (*db.Segment, error) {
+	return nil, errSegmentNotFound
+}
+
+func (s *fileStorage) CreateSegment(ctx context.Context, seg db.Segment, author string) (*db.Segment, error) {
+	return nil, errDatabaseRequired
+}
+
+func (s *fileStorage) UpdateSegment(ctx context.Context, id string, seg db.Segment, author string) (*db.Segment, error) {
+	return nil, errDatabaseRequired
+}
+
+func (s *fileStorage) DeleteSegment(ctx context.Context, id string) error {
+	return errDatabaseRequired
+}
+
+func (s *fileStorage) ListSegmentVersions(ctx context.Context, id string) ([]db.SegmentVersion, error) {
+	return nil, errDatabaseRequired
+}
+
+func (s *fileStorage) GetSegmentVersion(ctx context.Context, id string, version int) (*db.SegmentVersion, error) {
+	return nil, errDatabaseRequired
+}
+
+func (s *fileStorage) ListChangeRequests(ctx context.Context, params db.ChangeRequestFilterParams) (*db.PaginatedResult[db.ChangeRequest], error) {
+	return s.fm.changeRequests.List(params), nil
+}
+
+func (s *fileStorage) GetChangeRequest(ctx context.Context, id string) (*db.ChangeRequest, error) {
+	return s.fm.changeRequests.Get(id)
+}
+
+func (s *fileStorage) CreateChangeRequest(ctx context.Context, cr db.ChangeRequest) (*db.ChangeRequest, error) {
+	return s.fm.changeRequests.Create(cr)
+}
+
+func (s *fileStorage) SetChangeRequestStatus(ctx context.Context, id, status, appliedBy string) error {
+	return s.fm.changeRequests.UpdateStatus(id, status, appliedBy)
+}
+
+func (s *fileStorage) CancelChangeRequestsBefore(ctx context.Context, before time.Time) ([]db.ChangeRequest, error) {
+	return s.fm.changeRequests.CancelBefore(before)
+}
+
+func (s *fileStorage) CountPendingChangeRequests(ctx context.Context) (int, error) {
+	return s.fm.changeRequests.CountPending(), nil
+}
+
+func (s *fileStorage) AddChangeRequestReview(ctx context.Context, review db.ChangeRequestReview) (*db.ChangeRequestReview, error) {
+	return s.fm.changeRequests.AddReview(review)
+}
+
+func (s *fileStorage) ListChangeRequestReviews(ctx context.Context, id string) ([]db.ChangeRequestReview, error) {
+	return s.fm.changeRequests.Reviews(id), nil
+}
+
+func (s *fileStorage) ListFlagTemplates(ctx context.Context) ([]db.FlagTemplate, error) {
+	return s.fm.templates.List(), nil
+}
+
+func (s *fileStorage) GetFlagTemplate(ctx context.Context, id string) (*db.FlagTemplate, error) {
+	return s.fm.templates.Get(id)
+}
+
+func (s *fileStorage) CreateFlagTemplate(ctx context.Context, t db.FlagTemplate) (*db.FlagTemplate, error) {
+	return s.fm.templates.Create(t)
+}
+
+func (s *fileStorage) UpdateFlagTemplate(ctx context.Context, id string, t db.FlagTemplate) (*db.FlagTemplate, error) {
+	return s.fm.templates.Update(id, t)
+}
+
+func (s *fileStorage) DeleteFlagTemplate(ctx context.Context, id string) error {
+	return s.fm.templates.Delete(id)
+}
+
+func (s *fileStorage) ListPolicies(ctx context.Context) ([]db.Policy, error) {
+	return s.fm.policies.List(), nil
+}
+
+func (s *fileStorage) GetPolicy(ctx context.Context, id string) (*db.Policy, error) {
+	return s.fm.policies.Get(id)
+}
+
+func (s *fileStorage) CreatePolicy(ctx context.Context, p db.Policy) (*db.Policy, error) {
+	return s.fm.policies.Create(p)
+}
+
+func (s *fileStorage) UpdatePolicy(ctx context.Context, id string, p db.Policy) (*db.Policy, error) {
+	return s.fm.policies.Update(id, p)
+}
 
-	go fm.refreshRelayProxy()
-	w.WriteHeader(http.StatusNoContent)
+func (s *fileStorage) DeletePolicy(ctx context.Context, id string) error {
+	return s.fm.policies.Delete(id)
 }
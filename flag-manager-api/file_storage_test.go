@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockFlagFilesOrdering(t *testing.T) {
+	// Acquiring the same files in opposite orders must not deadlock.
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				defer lockFlagFiles("/locks/a.yaml", "/locks/b.yaml")()
+			}()
+			go func() {
+				defer wg.Done()
+				defer lockFlagFiles("/locks/b.yaml", "/locks/a.yaml", "/locks/b.yaml")()
+			}()
+		}
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("lockFlagFiles deadlocked")
+	}
+}
+
+func TestConcurrentCrossProjectClone(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	flagConfig := FlagConfig{
+		Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+		DefaultRule: &DefaultRule{Variation: "disabled"},
+	}
+	body, _ := json.Marshal(flagConfig)
+	for _, project := range []string{"project-a", "project-b"} {
+		req := httptest.NewRequest("POST", "/api/projects/"+project+"/flags/source", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to create source flag in %s: %d %s", project, rr.Code, rr.Body.String())
+		}
+	}
+
+	const perDirection = 20
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for i := 0; i < perDirection; i++ {
+			for _, dir := range [][2]string{{"project-a", "project-b"}, {"project-b", "project-a"}} {
+				wg.Add(2)
+				source, target := dir[0], dir[1]
+				newKey := "clone-from-" + source + "-" + string(rune('a'+i))
+
+				go func() {
+					defer wg.Done()
+					reqBody, _ := json.Marshal(map[string]string{"newKey": newKey, "targetProject": target})
+					req := httptest.NewRequest("POST", "/api/projects/"+source+"/flags/source/clone", bytes.NewReader(reqBody))
+					rr := httptest.NewRecorder()
+					router.ServeHTTP(rr, req)
+					if rr.Code != http.StatusCreated {
+						t.Errorf("Clone %s -> %s failed: %d %s", source, target, rr.Code, rr.Body.String())
+					}
+				}()
+
+				// Interleave same-project writes with the clones.
+				go func() {
+					defer wg.Done()
+					localKey := "local-" + newKey
+					req := httptest.NewRequest("POST", "/api/projects/"+source+"/flags/"+localKey, bytes.NewReader(body))
+					rr := httptest.NewRecorder()
+					router.ServeHTTP(rr, req)
+					if rr.Code != http.StatusCreated {
+						t.Errorf("Create %s/%s failed: %d %s", source, localKey, rr.Code, rr.Body.String())
+					}
+				}()
+			}
+		}
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("Concurrent cross-project operations deadlocked")
+	}
+
+	// No write may be lost: each project holds its source, its local flags and
+	// the clones received from the other project.
+	for _, project := range []string{"project-a", "project-b"} {
+		flags, err := fm.readProjectFlags(project)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", project, err)
+		}
+		if want := 1 + 2*perDirection; len(flags) != want {
+			t.Errorf("Expected %d flags in %s, got %d", want, project, len(flags))
+		}
+	}
+}
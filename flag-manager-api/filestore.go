@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Shared file-store layer. Every file written in FLAGS_DIR (project YAML
+// files and the JSON files of the file-mode stores) goes through
+// writeFileAtomic, so that a crash or a concurrent writer can never leave a
+// file half written.
+
+var (
+	writeFileLocksMu sync.Mutex
+	writeFileLocks   = make(map[string]*sync.Mutex)
+)
+
+// writeFileLock returns the in-process lock serializing writes to a file.
+func writeFileLock(path string) *sync.Mutex {
+	writeFileLocksMu.Lock()
+	defer writeFileLocksMu.Unlock()
+
+	l, ok := writeFileLocks[path]
+	if !ok {
+		l = &sync.Mutex{}
+		writeFileLocks[path] = l
+	}
+	return l
+}
+
+// lockFile takes an exclusive lock on path and returns the function that
+// releases it. Goroutines are serialized with an in-process mutex and other
+// processes sharing the directory, such as a second API replica, with an
+// advisory lock on a hidden ".<name>.lock" file next to path.
+func lockFile(path string) (func(), error) {
+	l := writeFileLock(path)
+	l.Lock()
+
+	lockPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock")
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		l.Unlock()
+		return nil, err
+	}
+	if err := flockFile(f); err != nil {
+		f.Close()
+		l.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		funlockFile(f)
+		f.Close()
+		l.Unlock()
+	}, nil
+}
+
+// writeFileAtomic replaces the contents of path with data. The data is
+// written to a temporary file in the same directory, synced to disk and
+// renamed over path, so readers and a restart after a crash see either the
+// old or the new contents. Concurrent writers of path are serialized with
+// lockFile.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	renamed = true
+
+	return syncDir(dir)
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Advisory locks are not available; writes are only serialized within the
+// process.
+
+func flockFile(f *os.File) error { return nil }
+
+func funlockFile(f *os.File) error { return nil }
+
+// syncDir does nothing: directories cannot be synced on this platform.
+func syncDir(dir string) error { return nil }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "web.yaml")
+
+	var wg sync.WaitGroup
+	contents := make([]string, 20)
+	for i := range contents {
+		contents[i] = strings.Repeat(fmt.Sprintf("flag-%d: {}\n", i), 1000)
+		wg.Add(1)
+		go func(data string) {
+			defer wg.Done()
+			if err := writeFileAtomic(path, []byte(data), 0644); err != nil {
+				t.Errorf("writeFileAtomic: %v", err)
+			}
+		}(contents[i])
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(contents, string(data)) {
+		t.Errorf("Expected the contents of one writer, got %d interleaved bytes", len(data))
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v, %v", info.Mode().Perm(), err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("Expected no temporary files left, found %s", e.Name())
+		}
+	}
+}
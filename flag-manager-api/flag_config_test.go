@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -1115,6 +1116,202 @@ func TestFlagConfig_YAMLSerialization(t *testing.T) {
 	}
 }
 
+func TestFlagConfig_YAMLNumberNormalization(t *testing.T) {
+	input := []byte(`my-flag:
+  variations:
+    low: 50
+    high: 100.5
+  defaultRule:
+    percentage:
+      low: 33.34
+      high: 66.66
+  version: 1
+dotted-flag:
+  variations:
+    on: true
+  version: "1.10"
+major-flag:
+  variations:
+    on: true
+  version: "2.0"
+`)
+
+	var flags ProjectFlags
+	if err := yaml.Unmarshal(input, &flags); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	// Values coming back from the database have been through encoding/json.
+	generic, err := toGenericValue(flags)
+	if err != nil {
+		t.Fatalf("Failed to convert: %v", err)
+	}
+
+	fm := &FlagManager{config: Config{NormalizeYAMLNumbers: true}}
+	for name, v := range map[string]interface{}{"typed": flags, "generic": generic} {
+		t.Run(name, func(t *testing.T) {
+			data, err := fm.marshalFlagsYAML(v)
+			if err != nil {
+				t.Fatalf("Failed to marshal: %v", err)
+			}
+			out := string(data)
+
+			for _, want := range []string{"version: 1\n", "low: 50\n", "high: 100.5\n", "low: 33.34\n", "high: 66.66\n"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+				}
+			}
+			// Only integer versions lose their quotes
+			for _, want := range []string{`version: "1.10"` + "\n", `version: "2.0"` + "\n"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+				}
+			}
+			if strings.Contains(out, `"1"`) || strings.Contains(out, "50.0") {
+				t.Errorf("Unexpected number formatting in output:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestValidateAllVariationReferences(t *testing.T) {
+	base := func() FlagConfig {
+		return FlagConfig{
+			Variations:  map[string]interface{}{"on": true, "off": false},
+			DefaultRule: &DefaultRule{Variation: "off"},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*FlagConfig)
+		want   []string
+	}{
+		{
+			name: "valid references",
+			modify: func(c *FlagConfig) {
+				c.Targeting = []TargetingRule{{Query: "a eq 1", Percentage: map[string]float64{"on": 50, "off": 50}}}
+			},
+		},
+		{
+			name: "bad reference in scheduled step targeting",
+			modify: func(c *FlagConfig) {
+				c.ScheduledRollout = []ScheduledStep{
+					{Date: "2030-01-01T00:00:00Z", DefaultRule: &DefaultRule{Variation: "on"}},
+					{Date: "2030-02-01T00:00:00Z", Targeting: []TargetingRule{
+						{Query: "a eq 1", Variation: "on"},
+						{Query: "b eq 1", Variation: "missing"},
+					}},
+				}
+			},
+			want: []string{"scheduledRollout[1].targeting[1].variation references unknown variation 'missing'"},
+		},
+		{
+			name: "bad references in percentages and progressive rollouts",
+			modify: func(c *FlagConfig) {
+				c.DefaultRule = &DefaultRule{ProgressiveRollout: &ProgressiveRollout{
+					Initial: &ProgressiveRolloutStep{Variation: "off"},
+					End:     &ProgressiveRolloutStep{Variation: "gone"},
+				}}
+				c.Targeting = []TargetingRule{{Query: "a eq 1", Percentage: map[string]float64{"on": 50, "nope": 50}}}
+			},
+			want: []string{
+				"defaultRule.progressiveRollout.end.variation references unknown variation 'gone'",
+				"targeting[0].percentage.nope references unknown variation 'nope'",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base()
+			tt.modify(&config)
+
+			got := validateAllVariationReferences(config)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateAllVariationReferences() = %v, want %v", got, tt.want)
+			}
+
+			errs := ValidateFlagConfig(config)
+			for _, want := range tt.want {
+				found := false
+				for _, e := range errs {
+					found = found || e == want
+				}
+				if !found {
+					t.Errorf("ValidateFlagConfig() = %v, missing %q", errs, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffConfigs(t *testing.T) {
+	before := FlagConfig{
+		Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+		Targeting:   []TargetingRule{{Query: `beta eq true`, Variation: "enabled"}},
+		DefaultRule: &DefaultRule{Variation: "disabled"},
+	}
+	after := FlagConfig{
+		Variations:  map[string]interface{}{"enabled": true, "disabled": false, "partial": "maybe"},
+		DefaultRule: &DefaultRule{Variation: "enabled"},
+		Disable:     boolPtr(true),
+	}
+
+	changes, err := diffConfigs(before, after)
+	if err != nil {
+		t.Fatalf("diffConfigs returned error: %v", err)
+	}
+
+	want := []ConfigChange{
+		{Path: "defaultRule.variation", Op: "changed", Before: "disabled", After: "enabled"},
+		{Path: "disable", Op: "added", After: true},
+		{Path: "targeting", Op: "removed", Before: []interface{}{map[string]interface{}{"query": "beta eq true", "variation": "enabled"}}},
+		{Path: "variations.partial", Op: "added", After: "maybe"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("diffConfigs() = %+v, want %+v", changes, want)
+	}
+
+	same, _ := diffConfigs(before, before)
+	if len(same) != 0 {
+		t.Errorf("Expected no changes for identical configs, got %+v", same)
+	}
+}
+
+func TestDiffProjectFlags(t *testing.T) {
+	left := ProjectFlags{
+		"checkout": {Variations: map[string]interface{}{"on": true, "off": false}, DefaultRule: &DefaultRule{Variation: "off"}},
+		"legacy":   {Variations: map[string]interface{}{"on": true}, DefaultRule: &DefaultRule{Variation: "on"}},
+		"same":     {Variations: map[string]interface{}{"on": true}, DefaultRule: &DefaultRule{Variation: "on"}},
+	}
+	right := ProjectFlags{
+		"checkout": {Variations: map[string]interface{}{"on": true, "off": false}, DefaultRule: &DefaultRule{Variation: "on"}},
+		"banner":   {Variations: map[string]interface{}{"on": true}, DefaultRule: &DefaultRule{Variation: "on"}},
+		"same":     {Variations: map[string]interface{}{"on": true}, DefaultRule: &DefaultRule{Variation: "on"}},
+	}
+
+	drift, err := diffProjectFlags(left, right)
+	if err != nil {
+		t.Fatalf("diffProjectFlags returned error: %v", err)
+	}
+
+	want := []FlagDrift{
+		{Key: "banner", Status: "added"},
+		{Key: "checkout", Status: "changed", Changes: []ConfigChange{
+			{Path: "defaultRule.variation", Op: "changed", Before: "off", After: "on"},
+		}},
+		{Key: "legacy", Status: "removed"},
+	}
+	if !reflect.DeepEqual(drift, want) {
+		t.Errorf("diffProjectFlags() = %+v, want %+v", drift, want)
+	}
+
+	if same, _ := diffProjectFlags(left, left); len(same) != 0 {
+		t.Errorf("Expected no drift for identical flags, got %+v", same)
+	}
+}
+
 func TestFlagConfig_JSONSerialization(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1376,3 +1573,26 @@ func validateTargetingRules(flag FlagConfig) bool {
 
 	return true
 }
+
+func TestExtractQueryAttributes(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`email ew "@company.com"`, []string{"email"}},
+		{`key eq "user-1" and (beta eq true or age ge 21)`, []string{"age", "beta", "key"}},
+		{`user.company in ["acme", "globex"] and not (plan == "free")`, []string{"plan", "user.company"}},
+		{`country pr and country ne "eq"`, []string{"country"}},
+		{`name co "and or" or email sw 'admin'`, []string{"email", "name"}},
+		{``, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := extractQueryAttributes(tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractQueryAttributes(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"runtime"
+	"sort"
+	"unicode"
+)
+
+// flagSeq calls yield with flags one at a time, stopping at the first error
+// yield returns. Flags read from storage are yielded as they are read, so
+// encoders writing them as they come never hold every flag at once.
+type flagSeq[V any] func(yield func(key string, value V) error) error
+
+// sortedFlags yields a map of flags in the key order of less.
+func sortedFlags[M ~map[string]V, V any](flags M, less func(a, b string) bool) flagSeq[V] {
+	return func(yield func(key string, value V) error) error {
+		keys := make([]string, 0, len(flags))
+		for key := range flags {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+		for _, key := range keys {
+			if err := yield(key, flags[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// flagsYAMLChunk is how many flags an encodeFlagsYAML worker encodes at once.
+const flagsYAMLChunk = 256
+
+// encodeFlagsYAML writes flags as a YAML mapping in the order they are
+// yielded, encoding a chunk of flags at a time in parallel. yaml.v3 keeps
+// every event of a document until it is written, so encoding a whole map at
+// once holds the file many times over; here only the chunks in flight are
+// held. Each flag is normalized as marshalFlagsYAML does.
+func encodeFlagsYAML[V any](w io.Writer, flags flagSeq[V], normalize bool) error {
+	type entry struct {
+		key   string
+		value V
+	}
+	type encoded struct {
+		data []byte
+		err  error
+	}
+
+	// Chunks are written in order as they complete; at most GOMAXPROCS are
+	// encoded or waiting to be written before reading more flags blocks
+	pending := make(chan chan encoded, runtime.GOMAXPROCS(0))
+	written := make(chan error, 1)
+	go func() {
+		var err error
+		for result := range pending {
+			chunk := <-result
+			if err == nil {
+				err = chunk.err
+			}
+			if err == nil {
+				_, err = w.Write(chunk.data)
+			}
+		}
+		written <- err
+	}()
+
+	var chunk []entry
+	count := 0
+	encode := func() {
+		entries := chunk
+		chunk = make([]entry, 0, flagsYAMLChunk)
+		result := make(chan encoded, 1)
+		pending <- result
+		go func() {
+			var buf bytes.Buffer
+			for _, e := range entries {
+				data, err := marshalYAMLMapping(map[string]V{e.key: e.value}, normalize)
+				if err != nil {
+					result <- encoded{err: err}
+					return
+				}
+				buf.Write(data)
+			}
+			result <- encoded{data: buf.Bytes()}
+		}()
+	}
+	err := flags(func(key string, value V) error {
+		chunk = append(chunk, entry{key, value})
+		count++
+		if len(chunk) == flagsYAMLChunk {
+			encode()
+		}
+		return nil
+	})
+	if err == nil && len(chunk) > 0 {
+		encode()
+	}
+	close(pending)
+	if writeErr := <-written; err == nil {
+		err = writeErr
+	}
+	if err == nil && count == 0 {
+		_, err = io.WriteString(w, "{}\n")
+	}
+	return err
+}
+
+// encodeFlagsJSON writes flags as an indented JSON object in the order they
+// are yielded, one flag at a time.
+func encodeFlagsJSON[V any](w io.Writer, flags flagSeq[V]) error {
+	bw := bufio.NewWriter(w)
+	count := 0
+	err := flags(func(key string, value V) error {
+		name, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(value, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			bw.WriteString("{\n  ")
+		} else {
+			bw.WriteString(",\n  ")
+		}
+		count++
+		bw.Write(name)
+		bw.WriteString(": ")
+		bw.Write(data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		bw.WriteString("{}")
+	} else {
+		bw.WriteString("\n}")
+	}
+	return bw.Flush()
+}
+
+// encodeRelayFlags serializes flags served in env for the relay proxy in a
+// flags file format, without the fields only the manager uses. YAML and JSON
+// are written one flag at a time as flags are yielded.
+func (fm *FlagManager) encodeRelayFlags(format string, flags interface{}, env string) ([]byte, error) {
+	relay, err := relayFlagSeq(flags, env)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "yaml":
+		err = encodeFlagsYAML(&buf, relay, fm.config.NormalizeYAMLNumbers)
+	case "json":
+		err = encodeFlagsJSON(&buf, relay)
+	default:
+		// The TOML encoder writes a whole document at once
+		all := make(map[string]RelayFlag)
+		if err := relay(func(key string, flag RelayFlag) error {
+			all[key] = flag
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return encodeFlagFormat(format, all)
+	}
+	return buf.Bytes(), err
+}
+
+// yamlKeyLess orders string map keys as yaml.v3 does when marshalling a map:
+// letters before other characters and runs of digits by their value, so
+// that flag2 comes before flag10. It is ported from yaml.v3's keyList.
+func yamlKeyLess(a, b string) bool {
+	ar, br := []rune(a), []rune(b)
+	digits := false
+	for i := 0; i < len(ar) && i < len(br); i++ {
+		if ar[i] == br[i] {
+			digits = unicode.IsDigit(ar[i])
+			continue
+		}
+		al := unicode.IsLetter(ar[i])
+		bl := unicode.IsLetter(br[i])
+		if al && bl {
+			return ar[i] < br[i]
+		}
+		if al || bl {
+			if digits {
+				return al
+			}
+			return bl
+		}
+		var ai, bi int
+		var an, bn int64
+		if ar[i] == '0' || br[i] == '0' {
+			for j := i - 1; j >= 0 && unicode.IsDigit(ar[j]); j-- {
+				if ar[j] != '0' {
+					an = 1
+					bn = 1
+					break
+				}
+			}
+		}
+		for ai = i; ai < len(ar) && unicode.IsDigit(ar[ai]); ai++ {
+			an = an*10 + int64(ar[ai]-'0')
+		}
+		for bi = i; bi < len(br) && unicode.IsDigit(br[bi]); bi++ {
+			bn = bn*10 + int64(br[bi]-'0')
+		}
+		if an != bn {
+			return an < bn
+		}
+		if ai != bi {
+			return ai < bi
+		}
+		return ar[i] < br[i]
+	}
+	return len(ar) < len(br)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestStreamingFlagsEncoders(t *testing.T) {
+	flags := map[string]FlagConfig{}
+	keys := []string{"flag10", "flag2", "flag02", "Flag", "flag", "a-b", "a_b", "a.b", "007", "7", "x0y", "x00y", "é", "true", "web/checkout", "<html>&"}
+	for i, key := range keys {
+		flags[key] = FlagConfig{
+			Variations:  map[string]interface{}{"on": true, "off": false, "ratio": float64(i) + 0.5, "count": 50.0, "list": []interface{}{1.0, "two"}},
+			Targeting:   []TargetingRule{{Query: `country eq "fr"`, Percentage: map[string]float64{"on": 33.34, "off": 66.66}}},
+			DefaultRule: &DefaultRule{Variation: "off"},
+			Version:     fmt.Sprintf("%d", i),
+			Metadata:    map[string]interface{}{"description": "multi\nline", "owner": nil},
+		}
+	}
+	generic := map[string]interface{}{"b": map[string]interface{}{"variations": map[string]interface{}{"x": 1.0}}, "a10": "v", "a9": []interface{}{}}
+
+	for _, normalize := range []bool{true, false} {
+		fm := &FlagManager{config: Config{NormalizeYAMLNumbers: normalize}}
+		for name, v := range map[string]interface{}{"flags": flags, "project": ProjectFlags(flags), "generic": generic, "empty": map[string]FlagConfig{}, "nil": ProjectFlags(nil)} {
+			want, err := marshalYAMLMapping(v, normalize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fm.marshalFlagsYAML(v)
+			if err != nil || string(got) != string(want) {
+				t.Errorf("%s (normalize %v): YAML differs from marshalling the whole map (%v):\n%s\nwant:\n%s", name, normalize, err, got, want)
+			}
+
+			if name == "generic" {
+				continue // not flags
+			}
+			relay, err := relayFlags(v, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err = encodeFlagFormat("json", relay)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = fm.encodeRelayFlags("json", v, "")
+			if err != nil || !jsonEqual(got, want) {
+				t.Errorf("%s: JSON differs from encodeFlagFormat (%v):\n%s\nwant:\n%s", name, err, got, want)
+			}
+		}
+
+		// Flags yielded by storage are encoded as they are read
+		yielded := sortedFlags(flags, func(a, b string) bool { return a < b })
+		for _, format := range []string{"yaml", "json"} {
+			data, err := fm.encodeRelayFlags(format, yielded, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := decodeFlagFormat(format, data)
+			if err != nil || len(decoded) != len(flags) || decoded["flag10"].Version != "0" {
+				t.Errorf("%s: expected the yielded flags back (%v), got:\n%s", format, err, data)
+			}
+		}
+		failing := flagSeq[FlagConfig](func(yield func(string, FlagConfig) error) error {
+			if err := yield("first", flags["flag"]); err != nil {
+				return err
+			}
+			return errors.New("read failed")
+		})
+		if _, err := fm.encodeRelayFlags("yaml", failing, ""); err == nil || err.Error() != "read failed" {
+			t.Errorf("Expected the read error, got %v", err)
+		}
+	}
+}
+
+// jsonEqual reports whether two JSON documents hold the same values.
+func jsonEqual(a, b []byte) bool {
+	var av, bv interface{}
+	if json.Unmarshal(a, &av) != nil || json.Unmarshal(b, &bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
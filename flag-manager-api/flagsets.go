@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
@@ -19,21 +21,24 @@ import (
 
 // FlagSet represents a collection of related feature flags
 type FlagSet struct {
-	ID          string              `json:"id"`
-	Name        string              `json:"name"`
-	Description string              `json:"description,omitempty"`
-	APIKeys     []string            `json:"apiKeys"`
-	Retriever   FlagSetRetriever    `json:"retriever"`
-	Exporter    *FlagSetExporter    `json:"exporter,omitempty"`
-	Notifier    *FlagSetNotifier    `json:"notifier,omitempty"`
-	IsDefault   bool                `json:"isDefault"`
-	CreatedAt   time.Time           `json:"createdAt"`
-	UpdatedAt   time.Time           `json:"updatedAt"`
+	ID          string           `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	APIKeys     []string         `json:"apiKeys"`
+	Retriever   FlagSetRetriever `json:"retriever"`
+	Exporter    *FlagSetExporter `json:"exporter,omitempty"`
+	Notifier    *FlagSetNotifier `json:"notifier,omitempty"`
+	IsDefault   bool             `json:"isDefault"`
+	Environment string           `json:"environment,omitempty"` // resolves flag environmentOverrides
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
 }
 
 // FlagSetRetriever defines how flags are loaded for this set
 type FlagSetRetriever struct {
 	Kind string `json:"kind"` // file, http, git, s3, etc.
+	// Managed retriever this flag set was configured from, if any
+	RetrieverID string `json:"retrieverId,omitempty"`
 	// File retriever
 	Path string `json:"path,omitempty"`
 	// HTTP retriever
@@ -116,7 +121,7 @@ func (s *FlagSetsStore) save() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(s.filePath, data, 0644)
+	return writeFileAtomic(s.filePath, data, 0644)
 }
 
 // List returns all flag sets
@@ -154,6 +159,21 @@ func (s *FlagSetsStore) GetByName(name string) *FlagSet {
 	return nil
 }
 
+// GetByAPIKey returns the flag set owning an API key
+func (s *FlagSetsStore) GetByAPIKey(key string) *FlagSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, fs := range s.flagSets {
+		for _, k := range fs.APIKeys {
+			if k == key {
+				fsCopy := fs
+				return &fsCopy
+			}
+		}
+	}
+	return nil
+}
+
 // GetDefault returns the default flag set
 func (s *FlagSetsStore) GetDefault() *FlagSet {
 	s.mu.RLock()
@@ -327,6 +347,7 @@ func dbFlagSetToFlagSet(dbfs db.DBFlagSet) FlagSet {
 		Name:        dbfs.Name,
 		Description: dbfs.Description,
 		IsDefault:   dbfs.IsDefault,
+		Environment: dbfs.Environment,
 		APIKeys:     dbfs.APIKeys,
 		CreatedAt:   dbfs.CreatedAt,
 		UpdatedAt:   dbfs.UpdatedAt,
@@ -358,6 +379,7 @@ func flagSetToDBFlagSet(fs FlagSet) db.DBFlagSet {
 		Name:        fs.Name,
 		Description: fs.Description,
 		IsDefault:   fs.IsDefault,
+		Environment: fs.Environment,
 		APIKeys:     fs.APIKeys,
 		CreatedAt:   fs.CreatedAt,
 		UpdatedAt:   fs.UpdatedAt,
@@ -377,29 +399,41 @@ func flagSetToDBFlagSet(fs FlagSet) db.DBFlagSet {
 
 // HTTP Handlers
 
+// FlagSetsResponse lists the flag sets.
+type FlagSetsResponse struct {
+	FlagSets []FlagSet `json:"flagSets"`
+}
+
 func (fm *FlagManager) listFlagSetsHandler(w http.ResponseWriter, r *http.Request) {
+	var flagSets []FlagSet
 	if fm.store != nil {
 		dbFlagSets, err := fm.store.ListFlagSets(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
-		flagSets := make([]FlagSet, 0, len(dbFlagSets))
+		flagSets = make([]FlagSet, 0, len(dbFlagSets))
 		for _, dbfs := range dbFlagSets {
 			flagSets = append(flagSets, dbFlagSetToFlagSet(dbfs))
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"flagSets": flagSets,
-		})
+	} else {
+		flagSets = fm.flagSets.List()
+	}
+	if readable := fm.readableIn(r, "flagset"); readable != nil {
+		flagSets = slices.DeleteFunc(flagSets, func(fs FlagSet) bool { return !readable("", fs.ID) })
+	}
+
+	if wantsPage(r) {
+		writePage(w, r, pageList(r, flagSets,
+			func(fs FlagSet) string { return fs.Name + " " + fs.Description },
+			namedSorts(func(fs FlagSet) string { return fs.Name }, func(fs FlagSet) string { return fs.Retriever.Kind },
+				func(fs FlagSet) time.Time { return fs.CreatedAt }, func(fs FlagSet) time.Time { return fs.UpdatedAt }),
+			"name"))
 		return
 	}
 
-	flagSets := fm.flagSets.List()
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"flagSets": flagSets,
-	})
+	json.NewEncoder(w).Encode(FlagSetsResponse{FlagSets: flagSets})
 }
 
 func (fm *FlagManager) getFlagSetHandler(w http.ResponseWriter, r *http.Request) {
@@ -410,9 +444,9 @@ func (fm *FlagManager) getFlagSetHandler(w http.ResponseWriter, r *http.Request)
 		dbfs, err := fm.store.GetFlagSet(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag set not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -424,7 +458,7 @@ func (fm *FlagManager) getFlagSetHandler(w http.ResponseWriter, r *http.Request)
 
 	flagSet := fm.flagSets.Get(id)
 	if flagSet == nil {
-		http.Error(w, "Flag set not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 		return
 	}
 
@@ -435,70 +469,56 @@ func (fm *FlagManager) getFlagSetHandler(w http.ResponseWriter, r *http.Request)
 func (fm *FlagManager) createFlagSetHandler(w http.ResponseWriter, r *http.Request) {
 	var flagSet FlagSet
 	if err := json.NewDecoder(r.Body).Decode(&flagSet); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	// Validate required fields
 	if flagSet.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Name is required")
 		return
 	}
 
-	// Generate initial API key if none provided
-	if len(flagSet.APIKeys) == 0 {
-		flagSet.APIKeys = []string{uuid.New().String()}
-	}
-
-	// Default retriever to file if not specified
-	if flagSet.Retriever.Kind == "" {
-		flagSet.Retriever.Kind = "file"
-	}
-
-	if fm.store != nil {
-		dbfs := flagSetToDBFlagSet(flagSet)
-		created, err := fm.store.CreateFlagSet(r.Context(), dbfs)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusConflict)
-			return
-		}
-		fs := dbFlagSetToFlagSet(*created)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(fs)
+	if err := fm.prepareFlagSet(r.Context(), &flagSet); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
-	created, err := fm.flagSets.Create(flagSet)
+	created, err := fm.storage.CreateFlagSet(r.Context(), flagSet)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		writeError(w, http.StatusConflict, "CONFLICT", err.Error())
 		return
 	}
 
-	// Create flags file for the flag set if using file retriever
-	if flagSet.Retriever.Kind == "file" {
-		flagSetFlagsPath := filepath.Join(fm.config.FlagsDir, fmt.Sprintf("flagset-%s.yaml", created.ID))
-		if _, err := os.Stat(flagSetFlagsPath); os.IsNotExist(err) {
-			// Create empty flags file
-			os.WriteFile(flagSetFlagsPath, []byte("# Flags for "+created.Name+"\n"), 0644)
-		}
-		// Update retriever path
-		created.Retriever.Path = flagSetFlagsPath
-		fm.flagSets.Update(created.ID, *created)
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(created)
 }
 
+// prepareFlagSet fills in the defaults of a new flag set: an initial API key,
+// a file retriever and the server's default exporter and notifier.
+func (fm *FlagManager) prepareFlagSet(ctx context.Context, flagSet *FlagSet) error {
+	// Generate initial API key if none provided
+	if len(flagSet.APIKeys) == 0 {
+		flagSet.APIKeys = []string{uuid.New().String()}
+	}
+
+	// Default retriever to file if not specified
+	if flagSet.Retriever.Kind == "" {
+		flagSet.Retriever.Kind = "file"
+	}
+
+	// Attach the server's default exporter/notifier when none is provided
+	return fm.applyFlagSetDefaults(ctx, flagSet)
+}
+
 func (fm *FlagManager) updateFlagSetHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	var updates FlagSet
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
@@ -507,9 +527,9 @@ func (fm *FlagManager) updateFlagSetHandler(w http.ResponseWriter, r *http.Reque
 		updated, err := fm.store.UpdateFlagSet(r.Context(), id, dbfs)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag set not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusConflict)
+				writeError(w, http.StatusConflict, "CONFLICT", err.Error())
 			}
 			return
 		}
@@ -522,9 +542,9 @@ func (fm *FlagManager) updateFlagSetHandler(w http.ResponseWriter, r *http.Reque
 	updated, err := fm.flagSets.Update(id, updates)
 	if err != nil {
 		if err.Error() == "flag set not found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		} else {
-			http.Error(w, err.Error(), http.StatusConflict)
+			writeError(w, http.StatusConflict, "CONFLICT", err.Error())
 		}
 		return
 	}
@@ -539,21 +559,26 @@ func (fm *FlagManager) deleteFlagSetHandler(w http.ResponseWriter, r *http.Reque
 
 	if fm.store != nil {
 		if err := fm.store.DeleteFlagSet(r.Context(), id); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+		json.NewEncoder(w).Encode(SuccessResponse{Success: true})
 		return
 	}
 
 	if err := fm.flagSets.Delete(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	json.NewEncoder(w).Encode(SuccessResponse{Success: true})
+}
+
+// FlagSetAPIKeyResponse is a newly generated flag set API key.
+type FlagSetAPIKeyResponse struct {
+	APIKey string `json:"apiKey"`
 }
 
 func (fm *FlagManager) generateFlagSetAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
@@ -563,22 +588,22 @@ func (fm *FlagManager) generateFlagSetAPIKeyHandler(w http.ResponseWriter, r *ht
 	if fm.store != nil {
 		newKey := uuid.New().String()
 		if err := fm.store.GenerateFlagSetAPIKey(r.Context(), id, newKey); err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"apiKey": newKey})
+		json.NewEncoder(w).Encode(FlagSetAPIKeyResponse{APIKey: newKey})
 		return
 	}
 
 	newKey, err := fm.flagSets.GenerateAPIKey(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"apiKey": newKey})
+	json.NewEncoder(w).Encode(FlagSetAPIKeyResponse{APIKey: newKey})
 }
 
 func (fm *FlagManager) removeFlagSetAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
@@ -589,35 +614,35 @@ func (fm *FlagManager) removeFlagSetAPIKeyHandler(w http.ResponseWriter, r *http
 		APIKey string `json:"apiKey"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if fm.store != nil {
 		if err := fm.store.RemoveFlagSetAPIKey(r.Context(), id, body.APIKey); err != nil {
 			if err.Error() == "cannot remove last API key" {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
 			} else {
-				http.Error(w, err.Error(), http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 			}
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]bool{"success": true})
+		json.NewEncoder(w).Encode(SuccessResponse{Success: true})
 		return
 	}
 
 	if err := fm.flagSets.RemoveAPIKey(id, body.APIKey); err != nil {
 		if err.Error() == "flag set not found" {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		} else {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "BAD_REQUEST", err.Error())
 		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	json.NewEncoder(w).Encode(SuccessResponse{Success: true})
 }
 
 // GenerateRelayProxyConfig generates the relay proxy configuration for all flag sets
@@ -627,7 +652,7 @@ func (fm *FlagManager) generateRelayProxyConfigHandler(w http.ResponseWriter, r
 	if fm.store != nil {
 		dbFlagSets, err := fm.store.ListFlagSets(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 		flagSets = make([]FlagSet, 0, len(dbFlagSets))
@@ -639,7 +664,7 @@ func (fm *FlagManager) generateRelayProxyConfigHandler(w http.ResponseWriter, r
 	}
 
 	if len(flagSets) == 0 {
-		http.Error(w, "No flag sets configured", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "No flag sets configured")
 		return
 	}
 
@@ -734,8 +759,16 @@ func (fm *FlagManager) generateRelayProxyConfigHandler(w http.ResponseWriter, r
 		config["flagSets"] = append(config["flagSets"].([]map[string]interface{}), fsConfig)
 	}
 
+	// Secret references are resolved only here, so the relay proxy gets the
+	// credentials while the manager never stores them
+	resolved, err := fm.secretRefs.resolveConfig(r.Context(), config)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "SECRET_RESOLUTION_FAILED", err.Error())
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(config)
+	json.NewEncoder(w).Encode(resolved)
 }
 
 // getFlagSetFilePath returns the path to a flagset's flags file
@@ -780,7 +813,20 @@ func (fm *FlagManager) writeFlagSetFlags(flagSetID string, flags map[string]inte
 		return err
 	}
 
-	return os.WriteFile(filePath, data, 0644)
+	defer fm.searchIndex.invalidate()
+	return writeFileAtomic(filePath, data, 0644)
+}
+
+// FlagSetFlagsResponse is a flag set with its flags.
+type FlagSetFlagsResponse struct {
+	Flags   map[string]interface{} `json:"flags"`
+	FlagSet FlagSet                `json:"flagSet"`
+}
+
+// FlagSetFlagResponse is the body returned for a single flag set flag.
+type FlagSetFlagResponse struct {
+	Key    string      `json:"key"`
+	Config interface{} `json:"config"`
 }
 
 // listFlagSetFlagsHandler returns all flags in a flagset
@@ -793,16 +839,16 @@ func (fm *FlagManager) listFlagSetFlagsHandler(w http.ResponseWriter, r *http.Re
 		dbfs, err := fm.store.GetFlagSet(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag set not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
 
 		flags, err := fm.store.ListFlagSetFlags(r.Context(), id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 
@@ -819,9 +865,9 @@ func (fm *FlagManager) listFlagSetFlagsHandler(w http.ResponseWriter, r *http.Re
 
 		fs := dbFlagSetToFlagSet(*dbfs)
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"flags":   flagsOut,
-			"flagSet": fs,
+		json.NewEncoder(w).Encode(FlagSetFlagsResponse{
+			Flags:   flagsOut,
+			FlagSet: fs,
 		})
 		return
 	}
@@ -829,20 +875,20 @@ func (fm *FlagManager) listFlagSetFlagsHandler(w http.ResponseWriter, r *http.Re
 	// Verify flagset exists
 	flagSet := fm.flagSets.Get(id)
 	if flagSet == nil {
-		http.Error(w, "Flag set not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 		return
 	}
 
 	flags, err := fm.readFlagSetFlags(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"flags":   flags,
-		"flagSet": flagSet,
+	json.NewEncoder(w).Encode(FlagSetFlagsResponse{
+		Flags:   flags,
+		FlagSet: *flagSet,
 	})
 }
 
@@ -857,9 +903,9 @@ func (fm *FlagManager) getFlagSetFlagHandler(w http.ResponseWriter, r *http.Requ
 		_, err := fm.store.GetFlagSet(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag set not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -867,9 +913,9 @@ func (fm *FlagManager) getFlagSetFlagHandler(w http.ResponseWriter, r *http.Requ
 		config, err := fm.store.GetFlagSetFlag(r.Context(), id, flagKey)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -878,9 +924,9 @@ func (fm *FlagManager) getFlagSetFlagHandler(w http.ResponseWriter, r *http.Requ
 		json.Unmarshal(config, &parsed)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"key":    flagKey,
-			"config": parsed,
+		json.NewEncoder(w).Encode(FlagSetFlagResponse{
+			Key:    flagKey,
+			Config: parsed,
 		})
 		return
 	}
@@ -888,26 +934,26 @@ func (fm *FlagManager) getFlagSetFlagHandler(w http.ResponseWriter, r *http.Requ
 	// Verify flagset exists
 	flagSet := fm.flagSets.Get(id)
 	if flagSet == nil {
-		http.Error(w, "Flag set not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 		return
 	}
 
 	flags, err := fm.readFlagSetFlags(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	flag, exists := flags[flagKey]
 	if !exists {
-		http.Error(w, "Flag not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"key":    flagKey,
-		"config": flag,
+	json.NewEncoder(w).Encode(FlagSetFlagResponse{
+		Key:    flagKey,
+		Config: flag,
 	})
 }
 
@@ -922,91 +968,107 @@ func (fm *FlagManager) createFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 		_, err := fm.store.GetFlagSet(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag set not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
 
 		var flagConfig interface{}
 		if err := json.NewDecoder(r.Body).Decode(&flagConfig); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+			return
+		}
+		if errs := validateFlagSetFlagConfig(flagConfig); len(errs) > 0 {
+			writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid", errs...)
 			return
 		}
 
 		// Check if flag already exists
 		exists, err := fm.store.FlagSetFlagExists(r.Context(), id, flagKey)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 		if exists {
-			http.Error(w, "Flag already exists", http.StatusConflict)
+			writeError(w, http.StatusConflict, "FLAG_EXISTS", "Flag already exists")
 			return
 		}
 
 		configJSON, err := json.Marshal(flagConfig)
 		if err != nil {
-			http.Error(w, "Failed to marshal flag config", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to marshal flag config")
 			return
 		}
 
 		if err := fm.store.CreateFlagSetFlag(r.Context(), id, flagKey, configJSON); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 
-		go fm.refreshRelayProxy()
+		fm.audit.Log(r.Context(), GetActor(r), "flag.created", "flagset_flag", id, flagKey, "",
+			map[string]interface{}{"after": flagConfig}, nil)
+
+		fm.scheduleFlagSetRelayRefresh(r.Context(), id)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"key":    flagKey,
-			"config": flagConfig,
+		json.NewEncoder(w).Encode(FlagSetFlagResponse{
+			Key:    flagKey,
+			Config: flagConfig,
 		})
 		return
 	}
 
+	defer lockFlagFiles(fm.getFlagSetFilePath(id))()
+
 	// Verify flagset exists
 	flagSet := fm.flagSets.Get(id)
 	if flagSet == nil {
-		http.Error(w, "Flag set not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 		return
 	}
 
 	var flagConfig interface{}
 	if err := json.NewDecoder(r.Body).Decode(&flagConfig); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if errs := validateFlagSetFlagConfig(flagConfig); len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid", errs...)
 		return
 	}
 
 	flags, err := fm.readFlagSetFlags(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	if _, exists := flags[flagKey]; exists {
-		http.Error(w, "Flag already exists", http.StatusConflict)
+		writeError(w, http.StatusConflict, "FLAG_EXISTS", "Flag already exists")
 		return
 	}
 
 	flags[flagKey] = flagConfig
 
 	if err := fm.writeFlagSetFlags(id, flags); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
+	fm.audit.Log(r.Context(), GetActor(r), "flag.created", "flagset_flag", id, flagKey, "",
+		map[string]interface{}{"after": flagConfig}, nil)
+
 	// Refresh relay proxy
-	go fm.refreshRelayProxy()
+	fm.scheduleFlagSetRelayRefresh(r.Context(), id)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"key":    flagKey,
-		"config": flagConfig,
+	json.NewEncoder(w).Encode(FlagSetFlagResponse{
+		Key:    flagKey,
+		Config: flagConfig,
 	})
 }
 
@@ -1021,9 +1083,9 @@ func (fm *FlagManager) updateFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 		_, err := fm.store.GetFlagSet(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag set not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -1033,13 +1095,17 @@ func (fm *FlagManager) updateFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 			NewKey string      `json:"newKey,omitempty"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+			return
+		}
+		if errs := validateFlagSetFlagConfig(requestBody.Config); len(errs) > 0 {
+			writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid", errs...)
 			return
 		}
 
 		configJSON, err := json.Marshal(requestBody.Config)
 		if err != nil {
-			http.Error(w, "Failed to marshal flag config", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to marshal flag config")
 			return
 		}
 
@@ -1047,20 +1113,26 @@ func (fm *FlagManager) updateFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 		if requestBody.NewKey != "" && requestBody.NewKey != flagKey {
 			exists, err := fm.store.FlagSetFlagExists(r.Context(), id, requestBody.NewKey)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 				return
 			}
 			if exists {
-				http.Error(w, "Flag with new key already exists", http.StatusConflict)
+				writeError(w, http.StatusConflict, "FLAG_EXISTS", "Flag with new key already exists")
 				return
 			}
 		}
 
+		// Get flag for audit
+		var before interface{}
+		if existing, err := fm.store.GetFlagSetFlag(r.Context(), id, flagKey); err == nil {
+			json.Unmarshal(existing, &before)
+		}
+
 		if err := fm.store.UpdateFlagSetFlag(r.Context(), id, flagKey, configJSON, requestBody.NewKey); err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -1070,20 +1142,25 @@ func (fm *FlagManager) updateFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 			effectiveKey = requestBody.NewKey
 		}
 
-		go fm.refreshRelayProxy()
+		fm.audit.Log(r.Context(), GetActor(r), "flag.updated", "flagset_flag", id, effectiveKey, "",
+			map[string]interface{}{"before": before, "after": requestBody.Config}, nil)
+
+		fm.scheduleFlagSetRelayRefresh(r.Context(), id)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"key":    effectiveKey,
-			"config": requestBody.Config,
+		json.NewEncoder(w).Encode(FlagSetFlagResponse{
+			Key:    effectiveKey,
+			Config: requestBody.Config,
 		})
 		return
 	}
 
+	defer lockFlagFiles(fm.getFlagSetFilePath(id))()
+
 	// Verify flagset exists
 	flagSet := fm.flagSets.Get(id)
 	if flagSet == nil {
-		http.Error(w, "Flag set not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 		return
 	}
 
@@ -1092,18 +1169,23 @@ func (fm *FlagManager) updateFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 		NewKey string      `json:"newKey,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if errs := validateFlagSetFlagConfig(requestBody.Config); len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid", errs...)
 		return
 	}
 
 	flags, err := fm.readFlagSetFlags(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
-	if _, exists := flags[flagKey]; !exists {
-		http.Error(w, "Flag not found", http.StatusNotFound)
+	before, exists := flags[flagKey]
+	if !exists {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
 		return
 	}
 
@@ -1111,7 +1193,7 @@ func (fm *FlagManager) updateFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 	effectiveKey := flagKey
 	if requestBody.NewKey != "" && requestBody.NewKey != flagKey {
 		if _, exists := flags[requestBody.NewKey]; exists {
-			http.Error(w, "Flag with new key already exists", http.StatusConflict)
+			writeError(w, http.StatusConflict, "FLAG_EXISTS", "Flag with new key already exists")
 			return
 		}
 		delete(flags, flagKey)
@@ -1121,17 +1203,20 @@ func (fm *FlagManager) updateFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 	flags[effectiveKey] = requestBody.Config
 
 	if err := fm.writeFlagSetFlags(id, flags); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
+	fm.audit.Log(r.Context(), GetActor(r), "flag.updated", "flagset_flag", id, effectiveKey, "",
+		map[string]interface{}{"before": before, "after": requestBody.Config}, nil)
+
 	// Refresh relay proxy
-	go fm.refreshRelayProxy()
+	fm.scheduleFlagSetRelayRefresh(r.Context(), id)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"key":    effectiveKey,
-		"config": requestBody.Config,
+	json.NewEncoder(w).Encode(FlagSetFlagResponse{
+		Key:    effectiveKey,
+		Config: requestBody.Config,
 	})
 }
 
@@ -1146,55 +1231,70 @@ func (fm *FlagManager) deleteFlagSetFlagHandler(w http.ResponseWriter, r *http.R
 		_, err := fm.store.GetFlagSet(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag set not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
 
+		// Get flag for audit
+		var before interface{}
+		if existing, err := fm.store.GetFlagSetFlag(r.Context(), id, flagKey); err == nil {
+			json.Unmarshal(existing, &before)
+		}
+
 		if err := fm.store.DeleteFlagSetFlag(r.Context(), id, flagKey); err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Flag not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
 
-		go fm.refreshRelayProxy()
+		fm.audit.Log(r.Context(), GetActor(r), "flag.deleted", "flagset_flag", id, flagKey, "",
+			map[string]interface{}{"before": before}, nil)
+
+		fm.scheduleFlagSetRelayRefresh(r.Context(), id)
 
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	defer lockFlagFiles(fm.getFlagSetFilePath(id))()
+
 	// Verify flagset exists
 	flagSet := fm.flagSets.Get(id)
 	if flagSet == nil {
-		http.Error(w, "Flag set not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
 		return
 	}
 
 	flags, err := fm.readFlagSetFlags(id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
-	if _, exists := flags[flagKey]; !exists {
-		http.Error(w, "Flag not found", http.StatusNotFound)
+	before, exists := flags[flagKey]
+	if !exists {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
 		return
 	}
 
 	delete(flags, flagKey)
 
 	if err := fm.writeFlagSetFlags(id, flags); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
+	fm.audit.Log(r.Context(), GetActor(r), "flag.deleted", "flagset_flag", id, flagKey, "",
+		map[string]interface{}{"before": before}, nil)
+
 	// Refresh relay proxy
-	go fm.refreshRelayProxy()
+	fm.scheduleFlagSetRelayRefresh(r.Context(), id)
 
 	w.WriteHeader(http.StatusNoContent)
 }
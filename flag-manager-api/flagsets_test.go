@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFlagSetsCRUD(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	var createdID string
+
+	t.Run("create flag set", func(t *testing.T) {
+		flagSet := map[string]interface{}{
+			"id":          "test-production",
+			"name":        "production",
+			"description": "Production flag set",
+			"projects":    []string{"project-a", "project-b"},
+		}
+
+		body, _ := json.Marshal(flagSet)
+		req := httptest.NewRequest("POST", "/api/flagsets", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		createdID = response["id"].(string)
+	})
+
+	t.Run("list flag sets", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/flagsets", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("get flag set", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/flagsets/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("update flag set", func(t *testing.T) {
+		flagSet := map[string]interface{}{
+			"id":          createdID,
+			"name":        "production-updated",
+			"description": "Updated production flag set",
+			"projects":    []string{"project-a", "project-b", "project-c"},
+		}
+
+		body, _ := json.Marshal(flagSet)
+		req := httptest.NewRequest("PUT", "/api/flagsets/"+createdID, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("delete flag set", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/flagsets/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+}
+
+func TestFlagSetAPIKeyScopedWrites(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	fm.authEnabled = true
+	handler := fm.AuthMiddleware(setupTestRouter(fm))
+
+	own, err := fm.flagSets.Create(FlagSet{Name: "service-a"})
+	if err != nil {
+		t.Fatalf("Failed to create flag set: %v", err)
+	}
+	other, err := fm.flagSets.Create(FlagSet{Name: "service-b"})
+	if err != nil {
+		t.Fatalf("Failed to create flag set: %v", err)
+	}
+	apiKey, err := fm.flagSets.GenerateAPIKey(own.ID)
+	if err != nil {
+		t.Fatalf("Failed to generate API key: %v", err)
+	}
+
+	flagBody := func() *bytes.Reader {
+		body, _ := json.Marshal(map[string]interface{}{
+			"variations":  map[string]interface{}{"on": true, "off": false},
+			"defaultRule": map[string]interface{}{"variation": "off"},
+		})
+		return bytes.NewReader(body)
+	}
+
+	t.Run("writes own flag set flags", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/flagsets/"+own.ID+"/flags/self-managed", flagBody())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		update, _ := json.Marshal(map[string]interface{}{
+			"config": map[string]interface{}{
+				"variations":  map[string]interface{}{"on": true, "off": false},
+				"defaultRule": map[string]interface{}{"variation": "on"},
+			},
+		})
+		req = httptest.NewRequest("PUT", "/api/flagsets/"+own.ID+"/flags/self-managed", bytes.NewReader(update))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("denied on another flag set", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/flagsets/"+other.ID+"/flags/intruder", flagBody())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+		}
+
+		flags, err := fm.readFlagSetFlags(other.ID)
+		if err != nil {
+			t.Fatalf("Failed to read flag set flags: %v", err)
+		}
+		if _, exists := flags["intruder"]; exists {
+			t.Error("Expected flag not to be written to another flag set")
+		}
+	})
+
+	t.Run("denied outside flag set flags", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/flagsets/"+own.ID, nil)
+		req.Header.Set("X-API-Key", apiKey)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusForbidden, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("unknown key is unauthorized", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/flagsets/"+own.ID+"/flags", nil)
+		req.Header.Set("X-API-Key", "not-a-key")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+}
+
+func TestFlagSetDefaultsFromSettings(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	settings := map[string]interface{}{
+		"defaultFlagSetExporter": map[string]interface{}{"kind": "log"},
+		"defaultFlagSetNotifier": map[string]interface{}{
+			"kind":            "slack",
+			"slackWebhookUrl": "https://hooks.slack.com/services/default",
+		},
+	}
+	body, _ := json.Marshal(settings)
+	req := httptest.NewRequest("PUT", "/api/settings", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	createFlagSet := func(t *testing.T, flagSet map[string]interface{}) FlagSet {
+		body, _ := json.Marshal(flagSet)
+		req := httptest.NewRequest("POST", "/api/flagsets", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+		var created FlagSet
+		json.Unmarshal(rr.Body.Bytes(), &created)
+		return created
+	}
+
+	t.Run("defaults applied when none provided", func(t *testing.T) {
+		created := createFlagSet(t, map[string]interface{}{"name": "defaulted"})
+
+		if created.Exporter == nil || created.Exporter.Kind != "log" {
+			t.Errorf("Expected default log exporter, got %+v", created.Exporter)
+		}
+		if created.Notifier == nil || created.Notifier.SlackWebhookURL != "https://hooks.slack.com/services/default" {
+			t.Errorf("Expected default slack notifier, got %+v", created.Notifier)
+		}
+	})
+
+	t.Run("explicit configs take precedence", func(t *testing.T) {
+		created := createFlagSet(t, map[string]interface{}{
+			"name":     "explicit",
+			"exporter": map[string]interface{}{"kind": "webhook", "endpointUrl": "https://example.com/events"},
+			"notifier": map[string]interface{}{"kind": "webhook", "endpointUrl": "https://example.com/notify"},
+		})
+
+		if created.Exporter == nil || created.Exporter.Kind != "webhook" {
+			t.Errorf("Expected explicit webhook exporter, got %+v", created.Exporter)
+		}
+		if created.Notifier == nil || created.Notifier.Kind != "webhook" {
+			t.Errorf("Expected explicit webhook notifier, got %+v", created.Notifier)
+		}
+	})
+
+	t.Run("settings persisted", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/settings", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var got ServerSettings
+		json.Unmarshal(rr.Body.Bytes(), &got)
+		if got.DefaultFlagSetNotifier == nil || got.DefaultFlagSetNotifier.Kind != "slack" {
+			t.Errorf("Expected stored slack notifier default, got %+v", got.DefaultFlagSetNotifier)
+		}
+	})
+}
+
+func TestFlagSetEnvironmentOverrides(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	staging, err := fm.flagSets.Create(FlagSet{Name: "staging", Environment: "staging"})
+	if err != nil {
+		t.Fatalf("Failed to create flag set: %v", err)
+	}
+
+	flag := map[string]interface{}{
+		"variations": map[string]interface{}{
+			"configA": map[string]interface{}{"endpoint": "https://api.example.com"},
+			"configB": map[string]interface{}{"endpoint": "https://api-b.example.com"},
+		},
+		"environmentOverrides": map[string]interface{}{
+			"configA": map[string]interface{}{
+				"staging": map[string]interface{}{"endpoint": "https://api.staging.example.com"},
+			},
+		},
+		"defaultRule": map[string]interface{}{"variation": "configA"},
+	}
+
+	t.Run("raw output resolves flag set environment", func(t *testing.T) {
+		body, _ := json.Marshal(flag)
+		req := httptest.NewRequest("POST", "/api/flagsets/"+staging.ID+"/flags/api-endpoint", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		req = httptest.NewRequest("GET", "/api/flagsets/"+staging.ID+"/flags/raw", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		raw := rr.Body.String()
+		if !strings.Contains(raw, "https://api.staging.example.com") {
+			t.Errorf("Expected staging endpoint in raw output, got:\n%s", raw)
+		}
+		if !strings.Contains(raw, "https://api-b.example.com") {
+			t.Errorf("Expected non-overridden variation unchanged, got:\n%s", raw)
+		}
+		if strings.Contains(raw, "environmentOverrides") {
+			t.Errorf("Expected overrides to be dropped from raw output, got:\n%s", raw)
+		}
+	})
+
+	t.Run("effective flags preview matches raw output", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/flagsets/"+staging.ID+"/effective-flags", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var resp struct {
+			Environment string                            `json:"environment"`
+			Keys        []string                          `json:"keys"`
+			Flags       map[string]map[string]interface{} `json:"flags"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.Environment != "staging" || strings.Join(resp.Keys, ",") != "api-endpoint" {
+			t.Fatalf("Unexpected preview: %s", rr.Body.String())
+		}
+		served := resp.Flags["api-endpoint"]
+		if _, ok := served["environmentOverrides"]; ok {
+			t.Error("Expected overrides to be resolved in preview")
+		}
+		variations, _ := served["variations"].(map[string]interface{})
+		configA, _ := variations["configA"].(map[string]interface{})
+		if configA["endpoint"] != "https://api.staging.example.com" {
+			t.Errorf("Expected staging endpoint in preview, got %v", variations)
+		}
+
+		req = httptest.NewRequest("GET", "/api/flagsets/missing/effective-flags", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("override of unknown variation rejected", func(t *testing.T) {
+		invalid := map[string]interface{}{
+			"variations":  map[string]interface{}{"on": true, "off": false},
+			"defaultRule": map[string]interface{}{"variation": "off"},
+			"environmentOverrides": map[string]interface{}{
+				"missing": map[string]interface{}{"staging": true},
+			},
+		}
+		body, _ := json.Marshal(invalid)
+		req := httptest.NewRequest("POST", "/api/flagsets/"+staging.ID+"/flags/bad-override", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+		}
+
+		errs := ValidateFlagConfig(FlagConfig{
+			Variations:           map[string]interface{}{"on": true},
+			DefaultRule:          &DefaultRule{Variation: "on"},
+			EnvironmentOverrides: map[string]map[string]interface{}{"missing": {"staging": true}},
+		})
+		if len(errs) != 1 || !strings.Contains(errs[0], "unknown variation 'missing'") {
+			t.Errorf("Expected unknown variation error for project flags, got %v", errs)
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// flagFormatContentTypes maps the supported flag file formats to their content types.
+var flagFormatContentTypes = map[string]string{
+	"json": "application/json",
+	"yaml": "application/x-yaml",
+	"toml": "application/toml",
+}
+
+// encodeFlagFormat serializes flags in one of the formats understood by the relay proxy
+// file retrievers (json, yaml, toml).
+func encodeFlagFormat(format string, v interface{}) ([]byte, error) {
+	// Round-trip through JSON so struct values use their json/yaml field names
+	// and the TOML encoder only ever sees plain maps and slices.
+	generic, err := toGenericValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "json":
+		return json.MarshalIndent(generic, "", "  ")
+	case "yaml":
+		return yaml.Marshal(generic)
+	case "toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(generic); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %s (use json, yaml, or toml)", format)
+	}
+}
+
+// decodeFlagFormat parses a flags file in one of the formats understood by the
+// relay proxy file retrievers (json, yaml, toml).
+func decodeFlagFormat(format string, data []byte) (ProjectFlags, error) {
+	flags := make(ProjectFlags)
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &flags); err != nil {
+			return nil, err
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(data, &flags); err != nil {
+			return nil, err
+		}
+	case "toml":
+		var generic map[string]interface{}
+		if err := toml.Unmarshal(data, &generic); err != nil {
+			return nil, err
+		}
+		// Round-trip through JSON to map the TOML tables onto FlagConfig
+		converted, err := json.Marshal(generic)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(converted, &flags); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format: %s (use json, yaml, or toml)", format)
+	}
+	if flags == nil {
+		flags = make(ProjectFlags)
+	}
+	return flags, nil
+}
+
+// toGenericValue converts v into the map/slice/scalar representation produced by encoding/json.
+func toGenericValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFlagFormat writes a single flag keyed by its flag key, so the output can be
+// pasted directly into a flags file.
+func writeFlagFormat(w http.ResponseWriter, format, flagKey string, config interface{}) {
+	contentType, ok := flagFormatContentTypes[format]
+	if !ok {
+		writeValidationError(w, "INVALID_FORMAT", "format must be one of: json, yaml, toml")
+		return
+	}
+
+	data, err := encodeFlagFormat(format, map[string]interface{}{flagKey: config})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+// flagFormatMediaTypes maps the media types accepted in an Accept header to a
+// flag file format.
+var flagFormatMediaTypes = map[string]string{
+	"application/json":   "json",
+	"application/x-yaml": "yaml",
+	"application/yaml":   "yaml",
+	"text/yaml":          "yaml",
+	"application/toml":   "toml",
+	"application/x-toml": "toml",
+}
+
+// negotiateFlagFormat picks the format of a flags file response: ?format= if
+// set, else the first flag file media type in the Accept header, else yaml.
+// It reports false for an unsupported ?format=.
+func negotiateFlagFormat(r *http.Request) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		_, ok := flagFormatContentTypes[format]
+		return format, ok
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		if format, ok := flagFormatMediaTypes[mediaType]; ok {
+			return format, true
+		}
+	}
+	return "yaml", true
+}
+
+// writeRawFlags serves flags as a flags file in the format negotiated for the
+// request, with only the fields the relay proxy understands and variations
+// resolved for env. It is signed in X-Flags-* headers if a signing key is
+// set, and cached for requests that went through serveCachedRawFlags. flags
+// may be a flagSeq, whose flags are encoded as they are read.
+func (fm *FlagManager) writeRawFlags(w http.ResponseWriter, r *http.Request, flags interface{}, env string) {
+	format, ok := negotiateFlagFormat(r)
+	if !ok {
+		writeValidationError(w, "INVALID_FORMAT", "format must be one of: json, yaml, toml")
+		return
+	}
+
+	data, err := fm.encodeRelayFlags(format, flags, env)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	sig, err := fm.signer.sign(data)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	entry := &rawFlagsEntry{
+		renderedAt:  now,
+		data:        data,
+		contentType: flagFormatContentTypes[format],
+		etag:        `"` + sha256Hex(data) + `"`,
+		modified:    now,
+		signature:   sig,
+	}
+	if revision, ok := r.Context().Value(rawFlagsRevisionKey{}).(uint64); ok {
+		entry.revision = revision
+		fm.rawFlags.store(rawFlagsCacheKey(r, format), entry)
+	}
+	fm.serveRawFlagsEntry(w, r, entry)
+}
+
+// marshalFlagsYAML serializes a map of flag key to flag config as YAML. Unless
+// disabled with NORMALIZE_YAML_NUMBERS=false, numbers are normalized first so
+// that repeated load/save cycles produce stable output for git diffs. Flag
+// maps are encoded one flag at a time by encodeFlagsYAML, in yaml.v3's key
+// order.
+func (fm *FlagManager) marshalFlagsYAML(flags interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	normalize := fm.config.NormalizeYAMLNumbers
+	switch flags := flags.(type) {
+	case map[string]FlagConfig:
+		err = encodeFlagsYAML(&buf, sortedFlags(flags, yamlKeyLess), normalize)
+	case ProjectFlags:
+		err = encodeFlagsYAML(&buf, sortedFlags(flags, yamlKeyLess), normalize)
+	case map[string]interface{}:
+		err = encodeFlagsYAML(&buf, sortedFlags(flags, yamlKeyLess), normalize)
+	case map[string]RelayFlag:
+		err = encodeFlagsYAML(&buf, sortedFlags(flags, yamlKeyLess), normalize)
+	default:
+		return marshalYAMLMapping(flags, fm.config.NormalizeYAMLNumbers)
+	}
+	return buf.Bytes(), err
+}
+
+// marshalYAMLMapping serializes a map of flag key to flag config as YAML,
+// normalizing numbers if normalize is set.
+func marshalYAMLMapping(flags interface{}, normalize bool) ([]byte, error) {
+	if !normalize {
+		return yaml.Marshal(flags)
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(flags); err != nil {
+		return nil, err
+	}
+	if doc.Kind == yaml.MappingNode {
+		for i := 1; i < len(doc.Content); i += 2 {
+			normalizeFlagVersion(doc.Content[i])
+		}
+	}
+	normalizeYAMLNumbers(&doc)
+
+	return yaml.Marshal(&doc)
+}
+
+// normalizeFlagVersion emits an integer flag version such as "1" unquoted,
+// matching how versions are usually written by hand in flag files. Other
+// versions stay strings, so "1.10" is not read back as the number 1.1.
+func normalizeFlagVersion(flag *yaml.Node) {
+	if flag.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(flag.Content); i += 2 {
+		key, value := flag.Content[i], flag.Content[i+1]
+		if key.Value != "version" || value.Kind != yaml.ScalarNode || value.Tag != "!!str" {
+			continue
+		}
+		if value.Value == "" || strings.Trim(value.Value, "0123456789") != "" || (len(value.Value) > 1 && value.Value[0] == '0') {
+			continue
+		}
+		value.Tag = "!!int"
+		value.Style = 0
+	}
+}
+
+// normalizeYAMLNumbers rewrites float scalars so integer values serialize without
+// a fractional part or exponent (50.0 -> 50) and other values use the shortest
+// decimal representation that round-trips (33.34 stays 33.34).
+func normalizeYAMLNumbers(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!float" {
+		f, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return
+		}
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			n.Value = strconv.FormatInt(int64(f), 10)
+			n.Tag = "!!int"
+		} else {
+			n.Value = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return
+	}
+	for _, child := range n.Content {
+		normalizeYAMLNumbers(child)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"flag-manager-api/httpclient"
 )
 
 // ADOClient handles Azure DevOps Git operations
@@ -32,14 +34,14 @@ func NewADOClient(orgURL, project, repository, pat, branch string) *ADOClient {
 		Repository: repository,
 		PAT:        pat,
 		Branch:     branch,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		httpClient: httpclient.WithTimeout(30 * time.Second),
 	}
 }
 
 // GetFile retrieves a file from the repository
 func (c *ADOClient) GetFile(path string) ([]byte, error) {
-	url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/items?path=%s&api-version=7.0",
-		c.OrgURL, c.Project, c.Repository, url.QueryEscape(path))
+	url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/items?path=%s&versionDescriptor.version=%s&versionDescriptor.versionType=branch&api-version=7.0",
+		c.OrgURL, c.Project, c.Repository, url.QueryEscape(path), url.QueryEscape(c.Branch))
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -260,6 +262,49 @@ func (c *ADOClient) createPR(title, description, sourceBranch, targetBranch stri
 	return webURL, nil
 }
 
+// GetPRState returns the state of a pull request created by CreatePR
+func (c *ADOClient) GetPRState(prURL string) (PRState, error) {
+	id, err := prNumber(prURL)
+	if err != nil {
+		return "", err
+	}
+	url := fmt.Sprintf("%s/%s/_apis/git/repositories/%s/pullrequests/%d?api-version=7.0",
+		c.OrgURL, c.Project, c.Repository, id)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get PR: %d - %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	switch result.Status {
+	case "completed":
+		return PRStateMerged, nil
+	case "abandoned":
+		return PRStateClosed, nil
+	default:
+		return PRStateOpen, nil
+	}
+}
+
 func (c *ADOClient) setAuth(req *http.Request) {
 	auth := base64.StdEncoding.EncodeToString([]byte(":" + c.PAT))
 	req.Header.Set("Authorization", "Basic "+auth)
@@ -0,0 +1,359 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"flag-manager-api/httpclient"
+)
+
+// DefaultBitbucketURL is the REST API of Bitbucket Cloud. Any other base URL
+// is treated as a self-hosted Bitbucket Server / Data Center instance.
+const DefaultBitbucketURL = "https://api.bitbucket.org"
+
+// BitbucketClient handles Bitbucket Cloud and Bitbucket Server Git operations
+type BitbucketClient struct {
+	BaseURL    string
+	Workspace  string // Cloud workspace, or Server project key
+	Repository string // Repository slug
+	Username   string // Basic auth user for app passwords; empty for access tokens
+	Password   string // App password, or access token when Username is empty
+	Branch     string
+	Server     bool
+	httpClient *http.Client
+}
+
+// NewBitbucketClient creates a new Bitbucket client. An empty baseURL targets
+// Bitbucket Cloud.
+func NewBitbucketClient(baseURL, workspace, repository, username, password, branch string) *BitbucketClient {
+	if baseURL == "" {
+		baseURL = DefaultBitbucketURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if branch == "" {
+		branch = "main"
+	}
+	return &BitbucketClient{
+		BaseURL:    baseURL,
+		Workspace:  workspace,
+		Repository: repository,
+		Username:   username,
+		Password:   password,
+		Branch:     branch,
+		Server:     baseURL != DefaultBitbucketURL,
+		httpClient: httpclient.WithTimeout(30 * time.Second),
+	}
+}
+
+func (c *BitbucketClient) repoURL(format string, args ...interface{}) string {
+	var base string
+	if c.Server {
+		base = fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s", c.BaseURL, url.PathEscape(c.Workspace), url.PathEscape(c.Repository))
+	} else {
+		base = fmt.Sprintf("%s/2.0/repositories/%s/%s", c.BaseURL, url.PathEscape(c.Workspace), url.PathEscape(c.Repository))
+	}
+	return base + fmt.Sprintf(format, args...)
+}
+
+// send performs a request and decodes a successful JSON response into result.
+// It returns the response status code; statuses other than the expected ones
+// are returned as errors.
+func (c *BitbucketClient) send(req *http.Request, result interface{}, expected ...int) (int, error) {
+	c.setAuth(req)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			if result != nil && status < 300 {
+				if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+					return resp.StatusCode, err
+				}
+			}
+			return resp.StatusCode, nil
+		}
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, fmt.Errorf("Bitbucket API error %d: %s", resp.StatusCode, string(body))
+}
+
+func (c *BitbucketClient) sendJSON(method, apiURL string, payload, result interface{}, expected ...int) (int, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(method, apiURL, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.send(req, result, expected...)
+}
+
+func (c *BitbucketClient) sendForm(method, apiURL string, fields map[string]string, result interface{}, expected ...int) (int, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return 0, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(method, apiURL, &body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return c.send(req, result, expected...)
+}
+
+// GetFile retrieves a file from the repository
+func (c *BitbucketClient) GetFile(path string) ([]byte, error) {
+	return c.getFile(c.Branch, path)
+}
+
+func (c *BitbucketClient) getFile(branch, path string) ([]byte, error) {
+	var apiURL string
+	if c.Server {
+		apiURL = c.repoURL("/raw/%s?at=%s", contentsPath(path), url.QueryEscape("refs/heads/"+branch))
+	} else {
+		apiURL = c.repoURL("/src/%s/%s", url.PathEscape(branch), contentsPath(path))
+	}
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Bitbucket API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// CreatePullRequest creates a PR with the given changes
+func (c *BitbucketClient) CreatePullRequest(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
+	// 1. Create the source branch from the target branch unless it exists
+	head, exists, err := c.getBranchHead(sourceBranch)
+	if err != nil {
+		return "", fmt.Errorf("failed to get branch: %w", err)
+	}
+	if !exists {
+		base, found, err := c.getBranchHead(targetBranch)
+		if err != nil {
+			return "", fmt.Errorf("failed to get branch: %w", err)
+		}
+		if !found {
+			return "", fmt.Errorf("target branch %s not found", targetBranch)
+		}
+		head = base
+	}
+
+	// 2. Commit changes to the source branch
+	if err := c.commitChanges(sourceBranch, head, exists, "Update feature flags via GOFF UI", changes); err != nil {
+		return "", fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	// 3. Create the pull request
+	prURL, err := c.createPR(title, description, sourceBranch, targetBranch)
+	if err != nil {
+		return "", fmt.Errorf("failed to create PR: %w", err)
+	}
+
+	return prURL, nil
+}
+
+// getBranchHead returns the commit a branch points at.
+func (c *BitbucketClient) getBranchHead(branch string) (string, bool, error) {
+	if c.Server {
+		req, err := http.NewRequest("GET", c.repoURL("/branches?filterText=%s&limit=100", url.QueryEscape(branch)), nil)
+		if err != nil {
+			return "", false, err
+		}
+		var result struct {
+			Values []struct {
+				DisplayID    string `json:"displayId"`
+				LatestCommit string `json:"latestCommit"`
+			} `json:"values"`
+		}
+		if _, err := c.send(req, &result, http.StatusOK); err != nil {
+			return "", false, err
+		}
+		for _, b := range result.Values {
+			if b.DisplayID == branch {
+				return b.LatestCommit, true, nil
+			}
+		}
+		return "", false, nil
+	}
+
+	req, err := http.NewRequest("GET", c.repoURL("/refs/branches/%s", contentsPath(branch)), nil)
+	if err != nil {
+		return "", false, err
+	}
+	var result struct {
+		Target struct {
+			Hash string `json:"hash"`
+		} `json:"target"`
+	}
+	status, err := c.send(req, &result, http.StatusOK, http.StatusNotFound)
+	if err != nil || status == http.StatusNotFound {
+		return "", false, err
+	}
+	return result.Target.Hash, true, nil
+}
+
+// commitChanges commits changes to branch, which is created from head when it
+// does not exist yet.
+func (c *BitbucketClient) commitChanges(branch, head string, exists bool, message string, changes map[string][]byte) error {
+	if !c.Server {
+		// Cloud commits all files at once and creates the branch on demand
+		fields := map[string]string{"message": message, "branch": branch}
+		if !exists {
+			fields["parents"] = head
+		}
+		for path, content := range changes {
+			fields["/"+strings.TrimPrefix(path, "/")] = string(content)
+		}
+		_, err := c.sendForm("POST", c.repoURL("/src"), fields, nil, http.StatusCreated)
+		return err
+	}
+
+	if !exists {
+		payload := map[string]string{"name": branch, "startPoint": head}
+		if _, err := c.sendJSON("POST", c.repoURL("/branches"), payload, nil, http.StatusOK); err != nil {
+			return err
+		}
+	}
+
+	// Server commits one file at a time; existing files must name the commit
+	// they are edited from
+	for path, content := range changes {
+		current, err := c.getFile(branch, path)
+		if err != nil {
+			return err
+		}
+		fields := map[string]string{"content": string(content), "message": message, "branch": branch}
+		if current != nil {
+			fields["sourceCommitId"] = head
+		}
+		var commit struct {
+			ID string `json:"id"`
+		}
+		if _, err := c.sendForm("PUT", c.repoURL("/browse/%s", contentsPath(path)), fields, &commit, http.StatusOK); err != nil {
+			return err
+		}
+		head = commit.ID
+	}
+	return nil
+}
+
+func (c *BitbucketClient) createPR(title, description, sourceBranch, targetBranch string) (string, error) {
+	if c.Server {
+		payload := map[string]interface{}{
+			"title":       title,
+			"description": description,
+			"fromRef":     map[string]string{"id": "refs/heads/" + sourceBranch},
+			"toRef":       map[string]string{"id": "refs/heads/" + targetBranch},
+		}
+		var result struct {
+			Links struct {
+				Self []struct {
+					Href string `json:"href"`
+				} `json:"self"`
+			} `json:"links"`
+		}
+		if _, err := c.sendJSON("POST", c.repoURL("/pull-requests"), payload, &result, http.StatusCreated); err != nil {
+			return "", err
+		}
+		if len(result.Links.Self) == 0 {
+			return "", nil
+		}
+		return result.Links.Self[0].Href, nil
+	}
+
+	payload := map[string]interface{}{
+		"title":       title,
+		"description": description,
+		"source":      map[string]interface{}{"branch": map[string]string{"name": sourceBranch}},
+		"destination": map[string]interface{}{"branch": map[string]string{"name": targetBranch}},
+	}
+	var result struct {
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	}
+	if _, err := c.sendJSON("POST", c.repoURL("/pullrequests"), payload, &result, http.StatusCreated); err != nil {
+		return "", err
+	}
+	return result.Links.HTML.Href, nil
+}
+
+// GetPRState returns the state of a pull request created by CreatePR
+func (c *BitbucketClient) GetPRState(prURL string) (PRState, error) {
+	id, err := prNumber(prURL)
+	if err != nil {
+		return "", err
+	}
+	apiURL := c.repoURL("/pullrequests/%d", id)
+	if c.Server {
+		apiURL = c.repoURL("/pull-requests/%d", id)
+	}
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		State string `json:"state"`
+	}
+	if _, err := c.send(req, &result, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	// Cloud also reports SUPERSEDED for PRs replaced by another one
+	switch result.State {
+	case "MERGED":
+		return PRStateMerged, nil
+	case "DECLINED", "SUPERSEDED":
+		return PRStateClosed, nil
+	default:
+		return PRStateOpen, nil
+	}
+}
+
+func (c *BitbucketClient) setAuth(req *http.Request) {
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.Password)
+	}
+}
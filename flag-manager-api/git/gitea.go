@@ -0,0 +1,228 @@
+package git
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"flag-manager-api/httpclient"
+)
+
+// GiteaClient handles Gitea and Forgejo Git operations
+type GiteaClient struct {
+	BaseURL    string
+	Owner      string
+	Repository string
+	Token      string
+	Branch     string
+	httpClient *http.Client
+}
+
+// NewGiteaClient creates a new Gitea client
+func NewGiteaClient(baseURL, owner, repository, token, branch string) *GiteaClient {
+	if branch == "" {
+		branch = "main"
+	}
+	return &GiteaClient{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Owner:      owner,
+		Repository: repository,
+		Token:      token,
+		Branch:     branch,
+		httpClient: httpclient.WithTimeout(30 * time.Second),
+	}
+}
+
+func (c *GiteaClient) repoURL(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s", c.BaseURL, url.PathEscape(c.Owner), url.PathEscape(c.Repository)) +
+		fmt.Sprintf(format, args...)
+}
+
+// do sends a request with an optional JSON payload and decodes a successful
+// JSON response into result. It returns the response status code; statuses
+// other than the expected ones are returned as errors.
+func (c *GiteaClient) do(method, apiURL string, payload, result interface{}, expected ...int) (int, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, apiURL, body)
+	if err != nil {
+		return 0, err
+	}
+	c.setAuth(req)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			if result != nil && status < 300 {
+				if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+					return resp.StatusCode, err
+				}
+			}
+			return resp.StatusCode, nil
+		}
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, fmt.Errorf("Gitea API error %d: %s", resp.StatusCode, string(respBody))
+}
+
+// GetFile retrieves a file from the repository
+func (c *GiteaClient) GetFile(path string) ([]byte, error) {
+	apiURL := c.repoURL("/raw/%s?ref=%s", contentsPath(path), url.QueryEscape(c.Branch))
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Gitea API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// CreatePullRequest creates a PR with the given changes
+func (c *GiteaClient) CreatePullRequest(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
+	// 1. Create the source branch
+	if err := c.createBranch(sourceBranch, targetBranch); err != nil {
+		return "", fmt.Errorf("failed to create branch: %w", err)
+	}
+
+	// 2. Commit changes to the source branch
+	if err := c.commitChanges(sourceBranch, "Update feature flags via GOFF UI", changes); err != nil {
+		return "", fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	// 3. Create the pull request
+	prURL, err := c.createPR(title, description, sourceBranch, targetBranch)
+	if err != nil {
+		return "", fmt.Errorf("failed to create PR: %w", err)
+	}
+
+	return prURL, nil
+}
+
+func (c *GiteaClient) createBranch(branchName, ref string) error {
+	payload := map[string]string{
+		"new_branch_name": branchName,
+		"old_branch_name": ref,
+	}
+	// A conflict means the branch already exists, which is fine
+	_, err := c.do("POST", c.repoURL("/branches"), payload, nil, http.StatusCreated, http.StatusConflict)
+	return err
+}
+
+// commitChanges commits all changes in a single commit. Files that already
+// exist on the branch are updated, which requires their current blob SHA.
+func (c *GiteaClient) commitChanges(branch, message string, changes map[string][]byte) error {
+	files := make([]map[string]string, 0, len(changes))
+	for path, content := range changes {
+		path = strings.TrimPrefix(path, "/")
+		file := map[string]string{
+			"operation": "create",
+			"path":      path,
+			"content":   base64.StdEncoding.EncodeToString(content),
+		}
+
+		var existing struct {
+			SHA string `json:"sha"`
+		}
+		status, err := c.do("GET", c.repoURL("/contents/%s?ref=%s", contentsPath(path), url.QueryEscape(branch)),
+			nil, &existing, http.StatusOK, http.StatusNotFound)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusOK {
+			file["operation"] = "update"
+			file["sha"] = existing.SHA
+		}
+		files = append(files, file)
+	}
+
+	payload := map[string]interface{}{
+		"branch":  branch,
+		"message": message,
+		"files":   files,
+	}
+	_, err := c.do("POST", c.repoURL("/contents"), payload, nil, http.StatusCreated)
+	return err
+}
+
+func (c *GiteaClient) createPR(title, description, sourceBranch, targetBranch string) (string, error) {
+	payload := map[string]string{
+		"title": title,
+		"body":  description,
+		"head":  sourceBranch,
+		"base":  targetBranch,
+	}
+
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if _, err := c.do("POST", c.repoURL("/pulls"), payload, &result, http.StatusCreated); err != nil {
+		return "", err
+	}
+	return result.HTMLURL, nil
+}
+
+// GetPRState returns the state of a pull request created by CreatePR
+func (c *GiteaClient) GetPRState(prURL string) (PRState, error) {
+	number, err := prNumber(prURL)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		State  string `json:"state"`
+		Merged bool   `json:"merged"`
+	}
+	if _, err := c.do("GET", c.repoURL("/pulls/%d", number), nil, &result, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	switch {
+	case result.Merged:
+		return PRStateMerged, nil
+	case result.State == "closed":
+		return PRStateClosed, nil
+	default:
+		return PRStateOpen, nil
+	}
+}
+
+func (c *GiteaClient) setAuth(req *http.Request) {
+	req.Header.Set("Authorization", "token "+c.Token)
+}
@@ -0,0 +1,283 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"flag-manager-api/httpclient"
+)
+
+// DefaultGitHubAPIURL is the REST API of github.com; GitHub Enterprise Server
+// uses https://<host>/api/v3.
+const DefaultGitHubAPIURL = "https://api.github.com"
+
+// GitHubClient handles GitHub Git operations
+type GitHubClient struct {
+	APIURL     string
+	Owner      string
+	Repository string
+	Token      string
+	Branch     string
+	httpClient *http.Client
+}
+
+// NewGitHubClient creates a new GitHub client
+func NewGitHubClient(apiURL, owner, repository, token, branch string) *GitHubClient {
+	if apiURL == "" {
+		apiURL = DefaultGitHubAPIURL
+	}
+	if branch == "" {
+		branch = "main"
+	}
+	return &GitHubClient{
+		APIURL:     strings.TrimSuffix(apiURL, "/"),
+		Owner:      owner,
+		Repository: repository,
+		Token:      token,
+		Branch:     branch,
+		httpClient: httpclient.WithTimeout(30 * time.Second),
+	}
+}
+
+func (c *GitHubClient) repoURL(format string, args ...interface{}) string {
+	return fmt.Sprintf("%s/repos/%s/%s", c.APIURL, url.PathEscape(c.Owner), url.PathEscape(c.Repository)) +
+		fmt.Sprintf(format, args...)
+}
+
+// contentsPath escapes a repository file path for the contents API, keeping
+// its slashes.
+func contentsPath(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// do sends a request with an optional JSON payload and decodes a successful
+// JSON response into result. It returns the response status code; statuses
+// other than the expected ones are returned as errors.
+func (c *GitHubClient) do(method, apiURL string, payload, result interface{}, expected ...int) (int, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, apiURL, body)
+	if err != nil {
+		return 0, err
+	}
+	c.setAuth(req)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			if result != nil && status < 300 {
+				if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+					return resp.StatusCode, err
+				}
+			}
+			return resp.StatusCode, nil
+		}
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, fmt.Errorf("GitHub API error %d: %s", resp.StatusCode, string(respBody))
+}
+
+// GetFile retrieves a file from the repository
+func (c *GitHubClient) GetFile(path string) ([]byte, error) {
+	apiURL := c.repoURL("/contents/%s?ref=%s", contentsPath(path), url.QueryEscape(c.Branch))
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setAuth(req)
+	req.Header.Set("Accept", "application/vnd.github.raw+json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GitHub API error %d: %s", resp.StatusCode, string(body))
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// CreatePullRequest creates a PR with the given changes, committed in a single
+// commit on the source branch
+func (c *GitHubClient) CreatePullRequest(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
+	// 1. Find the commit to build on: the source branch if it already exists
+	parentSHA, sourceExists, err := c.getBranchHead(sourceBranch)
+	if err != nil {
+		return "", fmt.Errorf("failed to get branch: %w", err)
+	}
+	if !sourceExists {
+		var targetExists bool
+		if parentSHA, targetExists, err = c.getBranchHead(targetBranch); err != nil {
+			return "", fmt.Errorf("failed to get branch: %w", err)
+		}
+		if !targetExists {
+			return "", fmt.Errorf("target branch %s not found", targetBranch)
+		}
+	}
+
+	// 2. Commit changes on top of it
+	commitSHA, err := c.commitChanges(parentSHA, "Update feature flags via GOFF UI", changes)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	// 3. Point the source branch at the commit
+	if err := c.updateBranch(sourceBranch, commitSHA, sourceExists); err != nil {
+		return "", fmt.Errorf("failed to update branch: %w", err)
+	}
+
+	// 4. Create the pull request
+	prURL, err := c.createPR(title, description, sourceBranch, targetBranch)
+	if err != nil {
+		return "", fmt.Errorf("failed to create PR: %w", err)
+	}
+
+	return prURL, nil
+}
+
+// getBranchHead returns the commit SHA a branch points at.
+func (c *GitHubClient) getBranchHead(branch string) (string, bool, error) {
+	var ref struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	status, err := c.do("GET", c.repoURL("/git/ref/heads/%s", contentsPath(branch)), nil, &ref, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return "", false, err
+	}
+	if status == http.StatusNotFound {
+		return "", false, nil
+	}
+	return ref.Object.SHA, true, nil
+}
+
+func (c *GitHubClient) commitChanges(parentSHA, message string, changes map[string][]byte) (string, error) {
+	var parent struct {
+		Tree struct {
+			SHA string `json:"sha"`
+		} `json:"tree"`
+	}
+	if _, err := c.do("GET", c.repoURL("/git/commits/%s", parentSHA), nil, &parent, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	entries := make([]map[string]string, 0, len(changes))
+	for path, content := range changes {
+		entries = append(entries, map[string]string{
+			"path":    strings.TrimPrefix(path, "/"),
+			"mode":    "100644",
+			"type":    "blob",
+			"content": string(content),
+		})
+	}
+
+	var tree struct {
+		SHA string `json:"sha"`
+	}
+	payload := map[string]interface{}{"base_tree": parent.Tree.SHA, "tree": entries}
+	if _, err := c.do("POST", c.repoURL("/git/trees"), payload, &tree, http.StatusCreated); err != nil {
+		return "", err
+	}
+
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	payload = map[string]interface{}{"message": message, "tree": tree.SHA, "parents": []string{parentSHA}}
+	if _, err := c.do("POST", c.repoURL("/git/commits"), payload, &commit, http.StatusCreated); err != nil {
+		return "", err
+	}
+	return commit.SHA, nil
+}
+
+func (c *GitHubClient) updateBranch(branch, sha string, exists bool) error {
+	if exists {
+		_, err := c.do("PATCH", c.repoURL("/git/refs/heads/%s", contentsPath(branch)),
+			map[string]interface{}{"sha": sha, "force": false}, nil, http.StatusOK)
+		return err
+	}
+	_, err := c.do("POST", c.repoURL("/git/refs"),
+		map[string]string{"ref": "refs/heads/" + branch, "sha": sha}, nil, http.StatusCreated)
+	return err
+}
+
+func (c *GitHubClient) createPR(title, description, sourceBranch, targetBranch string) (string, error) {
+	payload := map[string]string{
+		"title": title,
+		"body":  description,
+		"head":  sourceBranch,
+		"base":  targetBranch,
+	}
+
+	var result struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if _, err := c.do("POST", c.repoURL("/pulls"), payload, &result, http.StatusCreated); err != nil {
+		return "", err
+	}
+	return result.HTMLURL, nil
+}
+
+// GetPRState returns the state of a pull request created by CreatePR
+func (c *GitHubClient) GetPRState(prURL string) (PRState, error) {
+	number, err := prNumber(prURL)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		State  string `json:"state"`
+		Merged bool   `json:"merged"`
+	}
+	if _, err := c.do("GET", c.repoURL("/pulls/%d", number), nil, &result, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	switch {
+	case result.Merged:
+		return PRStateMerged, nil
+	case result.State == "closed":
+		return PRStateClosed, nil
+	default:
+		return PRStateOpen, nil
+	}
+}
+
+func (c *GitHubClient) setAuth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+}
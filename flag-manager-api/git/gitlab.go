@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"flag-manager-api/httpclient"
 )
 
 // GitLabClient handles GitLab Git operations
@@ -34,7 +36,7 @@ func NewGitLabClient(baseURL, projectID, token, branch string) *GitLabClient {
 		ProjectID:  url.PathEscape(projectID),
 		Token:      token,
 		Branch:     branch,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		httpClient: httpclient.WithTimeout(30 * time.Second),
 	}
 }
 
@@ -205,6 +207,49 @@ func (c *GitLabClient) createMR(title, description, sourceBranch, targetBranch s
 	return result.WebURL, nil
 }
 
+// GetPRState returns the state of a merge request created by CreatePR
+func (c *GitLabClient) GetPRState(prURL string) (PRState, error) {
+	iid, err := prNumber(prURL)
+	if err != nil {
+		return "", err
+	}
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d",
+		c.BaseURL, c.ProjectID, iid)
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return "", err
+	}
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to get MR: %d - %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	switch result.State {
+	case "merged":
+		return PRStateMerged, nil
+	case "closed":
+		return PRStateClosed, nil
+	default:
+		return PRStateOpen, nil
+	}
+}
+
 func (c *GitLabClient) setAuth(req *http.Request) {
 	req.Header.Set("PRIVATE-TOKEN", c.Token)
 }
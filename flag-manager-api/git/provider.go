@@ -3,31 +3,65 @@ package git
 import (
 	"fmt"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 )
 
 // Provider defines the interface for git operations
 type Provider interface {
-	// GetFile retrieves a file from the repository
+	// GetFile retrieves a file from the repository's base branch.
+	// It returns nil without an error if the file does not exist.
 	GetFile(path string) ([]byte, error)
 	// CreatePR creates a pull/merge request with the given changes
 	// Returns the URL of the created PR/MR
 	CreatePR(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error)
 }
 
+// PRState is the state of a pull/merge request
+type PRState string
+
+const (
+	PRStateOpen   PRState = "open"
+	PRStateMerged PRState = "merged"
+	PRStateClosed PRState = "closed" // closed, declined or abandoned without merging
+)
+
+// StatusProvider is implemented by providers that can report the state of a
+// pull/merge request they created
+type StatusProvider interface {
+	// GetPRState returns the state of the PR/MR at prURL, as returned by CreatePR
+	GetPRState(prURL string) (PRState, error)
+}
+
+// prNumber extracts the PR/MR number from the web URL returned by CreatePR,
+// whose last path segment is the number on every supported provider.
+func prNumber(prURL string) (int, error) {
+	n, err := strconv.Atoi(path.Base(strings.TrimSuffix(prURL, "/")))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("no pull request number in URL %q", prURL)
+	}
+	return n, nil
+}
+
 // ProviderType represents the git provider type
 type ProviderType string
 
 const (
-	ProviderNone   ProviderType = ""
-	ProviderADO    ProviderType = "ado"
-	ProviderGitLab ProviderType = "gitlab"
+	ProviderNone      ProviderType = ""
+	ProviderADO       ProviderType = "ado"
+	ProviderGitLab    ProviderType = "gitlab"
+	ProviderGitHub    ProviderType = "github"
+	ProviderBitbucket ProviderType = "bitbucket"
+	ProviderGitea     ProviderType = "gitea"
 )
 
 // Config holds the git provider configuration
 type Config struct {
-	Provider     ProviderType
-	BaseBranch   string
-	FlagsPath    string
+	Provider       ProviderType
+	BaseBranch     string
+	FlagsPath      string
+	BranchTemplate string // Go text/template for proposal branch names
 
 	// ADO-specific
 	ADOOrgURL     string
@@ -39,6 +73,25 @@ type Config struct {
 	GitLabURL       string
 	GitLabProjectID string
 	GitLabToken     string
+
+	// GitHub-specific
+	GitHubURL        string // REST API URL, defaults to https://api.github.com
+	GitHubOwner      string
+	GitHubRepository string
+	GitHubToken      string
+
+	// Bitbucket-specific
+	BitbucketURL         string // empty for Bitbucket Cloud, base URL of a self-hosted server otherwise
+	BitbucketWorkspace   string // Cloud workspace or Server project key
+	BitbucketRepository  string
+	BitbucketUsername    string // empty to use BitbucketAppPassword as an access token
+	BitbucketAppPassword string
+
+	// Gitea-specific (also Forgejo)
+	GiteaURL        string
+	GiteaOwner      string
+	GiteaRepository string
+	GiteaToken      string
 }
 
 // LoadConfigFromEnv loads git configuration from environment variables
@@ -50,6 +103,8 @@ func LoadConfigFromEnv() *Config {
 		BaseBranch: getEnvDefault("GIT_BASE_BRANCH", "main"),
 		FlagsPath:  getEnvDefault("GIT_FLAGS_PATH", "/flags.yaml"),
 
+		BranchTemplate: os.Getenv("GIT_BRANCH_TEMPLATE"),
+
 		// ADO
 		ADOOrgURL:     os.Getenv("ADO_ORG_URL"),
 		ADOProject:    os.Getenv("ADO_PROJECT"),
@@ -60,6 +115,25 @@ func LoadConfigFromEnv() *Config {
 		GitLabURL:       os.Getenv("GITLAB_URL"),
 		GitLabProjectID: os.Getenv("GITLAB_PROJECT_ID"),
 		GitLabToken:     os.Getenv("GITLAB_TOKEN"),
+
+		// GitHub
+		GitHubURL:        os.Getenv("GITHUB_API_URL"),
+		GitHubOwner:      os.Getenv("GITHUB_OWNER"),
+		GitHubRepository: os.Getenv("GITHUB_REPOSITORY"),
+		GitHubToken:      os.Getenv("GITHUB_TOKEN"),
+
+		// Bitbucket
+		BitbucketURL:         os.Getenv("BITBUCKET_URL"),
+		BitbucketWorkspace:   os.Getenv("BITBUCKET_WORKSPACE"),
+		BitbucketRepository:  os.Getenv("BITBUCKET_REPOSITORY"),
+		BitbucketUsername:    os.Getenv("BITBUCKET_USERNAME"),
+		BitbucketAppPassword: os.Getenv("BITBUCKET_APP_PASSWORD"),
+
+		// Gitea
+		GiteaURL:        os.Getenv("GITEA_URL"),
+		GiteaOwner:      os.Getenv("GITEA_OWNER"),
+		GiteaRepository: os.Getenv("GITEA_REPOSITORY"),
+		GiteaToken:      os.Getenv("GITEA_TOKEN"),
 	}
 
 	return config
@@ -91,6 +165,43 @@ func NewProvider(config *Config) (Provider, error) {
 			config.BaseBranch,
 		), nil
 
+	case ProviderGitHub:
+		if config.GitHubOwner == "" || config.GitHubRepository == "" || config.GitHubToken == "" {
+			return nil, fmt.Errorf("GitHub configuration incomplete: need GITHUB_OWNER, GITHUB_REPOSITORY, GITHUB_TOKEN")
+		}
+		return NewGitHubClient(
+			config.GitHubURL,
+			config.GitHubOwner,
+			config.GitHubRepository,
+			config.GitHubToken,
+			config.BaseBranch,
+		), nil
+
+	case ProviderBitbucket:
+		if config.BitbucketWorkspace == "" || config.BitbucketRepository == "" || config.BitbucketAppPassword == "" {
+			return nil, fmt.Errorf("Bitbucket configuration incomplete: need BITBUCKET_WORKSPACE, BITBUCKET_REPOSITORY, BITBUCKET_APP_PASSWORD")
+		}
+		return NewBitbucketClient(
+			config.BitbucketURL,
+			config.BitbucketWorkspace,
+			config.BitbucketRepository,
+			config.BitbucketUsername,
+			config.BitbucketAppPassword,
+			config.BaseBranch,
+		), nil
+
+	case ProviderGitea:
+		if config.GiteaURL == "" || config.GiteaOwner == "" || config.GiteaRepository == "" || config.GiteaToken == "" {
+			return nil, fmt.Errorf("Gitea configuration incomplete: need GITEA_URL, GITEA_OWNER, GITEA_REPOSITORY, GITEA_TOKEN")
+		}
+		return NewGiteaClient(
+			config.GiteaURL,
+			config.GiteaOwner,
+			config.GiteaRepository,
+			config.GiteaToken,
+			config.BaseBranch,
+		), nil
+
 	case ProviderNone:
 		return nil, nil
 
@@ -111,18 +222,47 @@ func getEnvDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
-// Ensure ADOClient implements Provider
+// Ensure ADOClient implements Provider and StatusProvider
 var _ Provider = (*ADOClient)(nil)
+var _ StatusProvider = (*ADOClient)(nil)
 
 // CreatePR implements Provider for ADOClient
 func (c *ADOClient) CreatePR(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
 	return c.CreatePullRequest(title, description, sourceBranch, targetBranch, changes)
 }
 
-// Ensure GitLabClient implements Provider
+// Ensure GitLabClient implements Provider and StatusProvider
 var _ Provider = (*GitLabClient)(nil)
+var _ StatusProvider = (*GitLabClient)(nil)
 
 // CreatePR implements Provider for GitLabClient
 func (c *GitLabClient) CreatePR(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
 	return c.CreateMergeRequest(title, description, sourceBranch, targetBranch, changes)
 }
+
+// Ensure GitHubClient implements Provider and StatusProvider
+var _ Provider = (*GitHubClient)(nil)
+var _ StatusProvider = (*GitHubClient)(nil)
+
+// CreatePR implements Provider for GitHubClient
+func (c *GitHubClient) CreatePR(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
+	return c.CreatePullRequest(title, description, sourceBranch, targetBranch, changes)
+}
+
+// Ensure BitbucketClient implements Provider and StatusProvider
+var _ Provider = (*BitbucketClient)(nil)
+var _ StatusProvider = (*BitbucketClient)(nil)
+
+// CreatePR implements Provider for BitbucketClient
+func (c *BitbucketClient) CreatePR(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
+	return c.CreatePullRequest(title, description, sourceBranch, targetBranch, changes)
+}
+
+// Ensure GiteaClient implements Provider and StatusProvider
+var _ Provider = (*GiteaClient)(nil)
+var _ StatusProvider = (*GiteaClient)(nil)
+
+// CreatePR implements Provider for GiteaClient
+func (c *GiteaClient) CreatePR(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
+	return c.CreatePullRequest(title, description, sourceBranch, targetBranch, changes)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// GitDiffResponse reports how a project's flags have drifted from its flags
+// file on the git base branch.
+type GitDiffResponse struct {
+	Project    string      `json:"project"`
+	Path       string      `json:"path"`
+	Branch     string      `json:"branch"`
+	FileExists bool        `json:"fileExists"`
+	InSync     bool        `json:"inSync"`
+	Flags      []FlagDrift `json:"flags"`
+}
+
+// getProjectGitDiffHandler fetches a project's flags file from the integration's
+// base branch and reports how the locally stored flags have drifted from it.
+func (fm *FlagManager) getProjectGitDiffHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	provider, integration := fm.resolveGitProvider(r)
+	if provider == nil {
+		writeError(w, http.StatusBadRequest, "GIT_NOT_CONFIGURED", "Git provider not configured. Add an integration in Settings.")
+		return
+	}
+
+	local, err := fm.loadStoredProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if local == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	flagsPath, baseBranch := fm.gitFlagsLocation(integration, project)
+
+	var data []byte
+	err = fm.outbound.Do(func() error {
+		data, err = provider.GetFile(flagsPath)
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "BAD_GATEWAY", fmt.Sprintf("Failed to fetch %s from git: %v", flagsPath, err))
+		return
+	}
+
+	base := make(ProjectFlags)
+	if data != nil {
+		if err := yaml.Unmarshal(data, &base); err != nil {
+			writeValidationError(w, "INVALID_GIT_FLAGS_FILE", fmt.Sprintf("%s on %s is not a valid flags file: %v", flagsPath, baseBranch, err))
+			return
+		}
+	}
+
+	drift, err := diffProjectFlags(base, local)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GitDiffResponse{
+		Project:    project,
+		Path:       flagsPath,
+		Branch:     baseBranch,
+		FileExists: data != nil,
+		InSync:     len(drift) == 0,
+		Flags:      drift,
+	})
+}
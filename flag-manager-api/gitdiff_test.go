@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProjectGitDiff(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	gitDiff := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/projects/shop/git-diff", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := gitDiff(); rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 without a git provider, got %d", rr.Code)
+	}
+
+	provider := &recordingProvider{files: map[string][]byte{}}
+	fm.gitProvider = provider
+
+	if rr := gitDiff(); rr.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for unknown project, got %d", rr.Code)
+	}
+
+	disabled := false
+	fm.writeProjectFlags("shop", ProjectFlags{
+		"checkout": {Variations: map[string]interface{}{"on": true, "off": false}, DefaultRule: &DefaultRule{Variation: "on"}},
+		"search":   {Variations: map[string]interface{}{"on": true, "off": false}, DefaultRule: &DefaultRule{Variation: "off"}, Disable: &disabled},
+		"banner":   {Variations: map[string]interface{}{"on": true, "off": false}, DefaultRule: &DefaultRule{Variation: "off"}},
+	})
+
+	var resp struct {
+		FileExists bool        `json:"fileExists"`
+		InSync     bool        `json:"inSync"`
+		Flags      []FlagDrift `json:"flags"`
+	}
+
+	rr := gitDiff()
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp.FileExists || len(resp.Flags) != 3 || resp.Flags[0].Status != "added" {
+		t.Fatalf("Expected every flag to be added when git has no file, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	provider.files["/shop.yaml"] = []byte(`checkout:
+  variations: {on: true, off: false}
+  defaultRule: {variation: "off"}
+search:
+  variations: {on: true, off: false}
+  defaultRule: {variation: "off"}
+  disable: false
+legacy:
+  variations: {on: true, off: false}
+  defaultRule: {variation: "off"}
+`)
+
+	resp.Flags = nil
+	rr = gitDiff()
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || !resp.FileExists || resp.InSync {
+		t.Fatalf("Expected drift, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var got []string
+	for _, d := range resp.Flags {
+		got = append(got, d.Key+":"+d.Status)
+	}
+	if strings.Join(got, ",") != "banner:added,checkout:changed,legacy:removed" {
+		t.Errorf("Unexpected drift: %v", got)
+	}
+	if changes := resp.Flags[1].Changes; len(changes) != 1 || changes[0].Path != "defaultRule.variation" || changes[0].After != "on" {
+		t.Errorf("Expected checkout's default variation change, got %+v", changes)
+	}
+
+	provider.files["/shop.yaml"] = []byte("checkout: [not, a, flag")
+	if rr := gitDiff(); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid git file, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"flag-manager-api/git"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// Git sync strategies for flags changed both in the manager and in the repo.
+const (
+	syncStrategyRepo  = "repo"  // take the repo copy
+	syncStrategyLocal = "local" // keep the manager copy
+)
+
+// syncWebhookEvents maps the sync actions that change a flag to the project
+// webhook event sent for them.
+var syncWebhookEvents = map[string]string{
+	"added":   "flag.created",
+	"updated": "flag.updated",
+	"removed": "flag.deleted",
+}
+
+// SyncedFlag describes what a git sync did, or would do, to one flag.
+type SyncedFlag struct {
+	Key      string         `json:"key"`
+	Action   string         `json:"action"` // added, updated, removed, kept_local, conflict
+	Conflict bool           `json:"conflict,omitempty"`
+	Changes  []ConfigChange `json:"changes,omitempty"`
+}
+
+// GitSyncStore keeps the flags of each project as last synced from each
+// integration in file mode. They are the common base used to tell which side
+// changed a flag.
+type GitSyncStore struct {
+	filePath string
+	bases    map[string]ProjectFlags // keyed by integration ID and project
+	mu       sync.RWMutex
+}
+
+// NewGitSyncStore creates a new git sync store
+func NewGitSyncStore(configDir string) *GitSyncStore {
+	store := &GitSyncStore{
+		filePath: filepath.Join(configDir, "git_sync.json"),
+		bases:    make(map[string]ProjectFlags),
+	}
+	store.load()
+	return store
+}
+
+func (s *GitSyncStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.bases)
+}
+
+func gitSyncKey(integrationID, project string) string {
+	return integrationID + "/" + project
+}
+
+// Get returns a project's flags as last synced from an integration, or nil
+func (s *GitSyncStore) Get(integrationID, project string) ProjectFlags {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bases[gitSyncKey(integrationID, project)]
+}
+
+// Set records a project's flags as synced from an integration
+func (s *GitSyncStore) Set(integrationID, project string, flags ProjectFlags) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := gitSyncKey(integrationID, project)
+	previous, existed := s.bases[key]
+	s.bases[key] = flags
+
+	data, err := json.MarshalIndent(s.bases, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.filePath, data, 0644)
+	}
+	if err != nil {
+		if existed {
+			s.bases[key] = previous
+		} else {
+			delete(s.bases, key)
+		}
+	}
+	return err
+}
+
+func (fm *FlagManager) loadGitSyncBase(ctx context.Context, integrationID, project string) (ProjectFlags, error) {
+	if fm.store == nil {
+		return fm.gitSync.Get(integrationID, project), nil
+	}
+	data, err := fm.store.GetGitSyncBase(ctx, integrationID, project)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var flags ProjectFlags
+	if err := json.Unmarshal(data, &flags); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+func (fm *FlagManager) saveGitSyncBase(ctx context.Context, integrationID, project string, flags ProjectFlags) error {
+	if fm.store == nil {
+		return fm.gitSync.Set(integrationID, project, flags)
+	}
+	data, err := json.Marshal(flags)
+	if err != nil {
+		return err
+	}
+	return fm.store.SetGitSyncBase(ctx, integrationID, project, data)
+}
+
+// sameFlagConfig reports whether a flag is present with the same config in
+// both copies, or absent from both.
+func sameFlagConfig(a, b ProjectFlags, key string) (bool, error) {
+	ac, aok := a[key]
+	bc, bok := b[key]
+	if aok != bok {
+		return false, nil
+	}
+	if !aok {
+		return true, nil
+	}
+	changes, err := diffConfigs(ac, bc)
+	return len(changes) == 0, err
+}
+
+// planGitSync decides per flag whether the repo or the manager copy wins.
+// base is nil if the project was never synced, in which case every flag that
+// differs counts as changed on both sides when present in both, or on the side
+// holding it otherwise. Conflicts are resolved by strategy, or reported when it
+// is empty.
+func planGitSync(local, repo, base ProjectFlags, strategy string) ([]SyncedFlag, error) {
+	keys := make(map[string]bool)
+	for _, flags := range []ProjectFlags{local, repo, base} {
+		for key := range flags {
+			keys[key] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	plan := []SyncedFlag{}
+	for _, key := range sorted {
+		same, err := sameFlagConfig(local, repo, key)
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			continue
+		}
+
+		_, inLocal := local[key]
+		_, inRepo := repo[key]
+		localChanged, repoChanged := inLocal, inRepo
+		if base != nil {
+			if localChanged, err = sameFlagConfig(local, base, key); err != nil {
+				return nil, err
+			}
+			if repoChanged, err = sameFlagConfig(repo, base, key); err != nil {
+				return nil, err
+			}
+			localChanged, repoChanged = !localChanged, !repoChanged
+		}
+
+		entry := SyncedFlag{Key: key, Conflict: localChanged && repoChanged}
+		takeRepo := repoChanged && (!localChanged || strategy == syncStrategyRepo)
+		switch {
+		case takeRepo && !inRepo:
+			entry.Action = "removed"
+		case takeRepo && !inLocal:
+			entry.Action = "added"
+		case takeRepo:
+			entry.Action = "updated"
+		case entry.Conflict && strategy == "":
+			entry.Action = "conflict"
+		default:
+			entry.Action = "kept_local"
+		}
+
+		var before, after interface{}
+		if inLocal {
+			before = local[key]
+		}
+		if inRepo {
+			after = repo[key]
+		}
+		if entry.Changes, err = diffConfigs(before, after); err != nil {
+			return nil, err
+		}
+		plan = append(plan, entry)
+	}
+	return plan, nil
+}
+
+// applyGitSync writes the flags the plan takes from the repo through the
+// storage. The plan is checked against the policies as a whole first, so that
+// a violation leaves the project unchanged.
+func (fm *FlagManager) applyGitSync(ctx context.Context, project string, repo ProjectFlags, plan []SyncedFlag) error {
+	policies, err := fm.enabledPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	if len(policies) > 0 {
+		local, err := fm.storage.ListFlags(ctx, project)
+		if err != nil && !errors.Is(err, errProjectNotFound) {
+			return err
+		}
+		var changes []flagChange
+		for _, f := range plan {
+			if f.Action != "added" && f.Action != "updated" {
+				continue
+			}
+			after := repo[f.Key]
+			change := flagChange{key: f.Key, after: &after}
+			if before, ok := local[f.Key]; ok {
+				change.before = &before
+			}
+			changes = append(changes, change)
+		}
+		if _, err := fm.checkFlagChanges(ctx, policies, project, "", changes); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range plan {
+		var err error
+		switch f.Action {
+		case "added":
+			_, err = fm.storage.CreateFlag(ctx, project, f.Key, repo[f.Key])
+		case "updated":
+			_, _, err = fm.storage.UpdateFlag(ctx, project, f.Key, "", repo[f.Key])
+		case "removed":
+			_, err = fm.storage.DeleteFlag(ctx, project, f.Key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Key, err)
+		}
+	}
+	return nil
+}
+
+// GitSyncResult is the outcome of syncing a project from a git integration.
+type GitSyncResult struct {
+	Project     string         `json:"project"`
+	Integration string         `json:"integration"`
+	Path        string         `json:"path"`
+	Branch      string         `json:"branch"`
+	DryRun      bool           `json:"dryRun"`
+	Applied     bool           `json:"applied"`
+	Summary     map[string]int `json:"summary"`
+	Flags       []SyncedFlag   `json:"flags"`
+}
+
+// gitSyncError is a sync failure with the HTTP status it is reported with.
+// Errors with a code are reported as validation errors.
+type gitSyncError struct {
+	status  int
+	code    string
+	message string
+	details []string
+}
+
+func (e *gitSyncError) Error() string { return e.message }
+
+func (e *gitSyncError) write(w http.ResponseWriter) {
+	if e.code != "" {
+		writeValidationError(w, e.code, e.message, e.details...)
+		return
+	}
+	writeError(w, e.status, errorCode(e.status), e.message)
+}
+
+// syncProjectFromGit imports a project's flags file from an integration's base
+// branch. Flags changed only in the repo since the last sync are taken from it,
+// flags changed only in the manager are kept, and flags changed on both sides
+// are conflicts: nothing is applied unless strategy picks a side. It does not
+// refresh the relay proxy.
+func (fm *FlagManager) syncProjectFromGit(r *http.Request, id string, provider git.Provider, integration *GitIntegration, project, strategy string, dryRun bool) (*GitSyncResult, error) {
+	ctx := r.Context()
+
+	local, err := fm.loadStoredProjectFlags(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if local == nil {
+		return nil, &gitSyncError{status: http.StatusNotFound, message: "Project not found"}
+	}
+
+	flagsPath, baseBranch := fm.gitFlagsLocation(integration, project)
+
+	var data []byte
+	err = fm.outbound.Do(func() error {
+		data, err = provider.GetFile(flagsPath)
+		return err
+	})
+	if err != nil {
+		return nil, &gitSyncError{status: http.StatusBadGateway, message: fmt.Sprintf("Failed to fetch %s from git: %v", flagsPath, err)}
+	}
+	if data == nil {
+		return nil, &gitSyncError{status: http.StatusNotFound, message: fmt.Sprintf("%s not found on %s", flagsPath, baseBranch)}
+	}
+
+	repo := make(ProjectFlags)
+	if err := yaml.Unmarshal(data, &repo); err != nil {
+		return nil, &gitSyncError{code: "INVALID_GIT_FLAGS_FILE", message: fmt.Sprintf("%s on %s is not a valid flags file: %v", flagsPath, baseBranch, err)}
+	}
+	var invalid []string
+	for key, config := range repo {
+		if err := ValidateFlagKey(key); err != nil {
+			invalid = append(invalid, key+": "+err.Error())
+			continue
+		}
+		for _, e := range ValidateFlagConfig(config) {
+			invalid = append(invalid, key+": "+e)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return nil, &gitSyncError{code: "INVALID_GIT_FLAGS_FILE", message: fmt.Sprintf("%s on %s contains invalid flags", flagsPath, baseBranch), details: invalid}
+	}
+
+	base, err := fm.loadGitSyncBase(ctx, id, project)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := planGitSync(local, repo, base, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GitSyncResult{
+		Project:     project,
+		Integration: id,
+		Path:        flagsPath,
+		Branch:      baseBranch,
+		DryRun:      dryRun,
+		Summary:     map[string]int{"added": 0, "updated": 0, "removed": 0, "keptLocal": 0, "conflicts": 0},
+		Flags:       plan,
+	}
+	for _, f := range plan {
+		switch f.Action {
+		case "added", "updated", "removed":
+			result.Summary[f.Action]++
+		case "kept_local":
+			result.Summary["keptLocal"]++
+		case "conflict":
+			result.Summary["conflicts"]++
+		}
+	}
+	if dryRun || result.Summary["conflicts"] > 0 {
+		return result, nil
+	}
+
+	if err := fm.applyGitSync(ctx, project, repo, plan); err != nil {
+		return nil, fmt.Errorf("failed to apply sync: %w", err)
+	}
+	if err := fm.saveGitSyncBase(ctx, id, project, repo); err != nil {
+		return nil, err
+	}
+	result.Applied = true
+
+	actor := GetActor(r)
+	for _, f := range plan {
+		if f.Action == "kept_local" {
+			continue
+		}
+		changes := map[string]interface{}{}
+		if config, ok := local[f.Key]; ok {
+			changes["before"] = config
+		}
+		if config, ok := repo[f.Key]; ok {
+			changes["after"] = config
+		}
+		fm.audit.Log(ctx, actor, "flag.git_synced", "flag", "", f.Key, project, changes,
+			map[string]interface{}{"integration": id, "path": flagsPath, "branch": baseBranch, "action": f.Action})
+		fm.notifyProjectWebhook(r, syncWebhookEvents[f.Action], project, f.Key, "")
+	}
+	return result, nil
+}
+
+// changedFlags reports whether a sync result changed any flag.
+func (res *GitSyncResult) changedFlags() bool {
+	return res.Applied && res.Summary["added"]+res.Summary["updated"]+res.Summary["removed"] > 0
+}
+
+// syncIntegrationHandler imports a project's flags file from an integration
+// (?project=). Conflicts fail the sync with 409 unless ?strategy=repo or
+// ?strategy=local picks a side; ?dryRun=true reports the outcome without
+// applying it.
+func (fm *FlagManager) syncIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+	project := query.Get("project")
+	strategy := query.Get("strategy")
+
+	if project == "" {
+		writeValidationError(w, "INVALID_SYNC", "project is required")
+		return
+	}
+	switch strategy {
+	case "", syncStrategyRepo, syncStrategyLocal:
+	default:
+		writeValidationError(w, "INVALID_SYNC_STRATEGY", "strategy must be repo or local")
+		return
+	}
+
+	provider, integration := fm.integrationGitProvider(r.Context(), id)
+	if integration == nil {
+		writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
+		return
+	}
+	if provider == nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Integration is not fully configured")
+		return
+	}
+
+	result, err := fm.syncProjectFromGit(r, id, provider, integration, project, strategy, query.Get("dryRun") == "true")
+	if err != nil {
+		if syncErr, ok := err.(*gitSyncError); ok {
+			syncErr.write(w)
+		} else if !writePolicyViolationError(w, err) {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		}
+		return
+	}
+	if result.changedFlags() {
+		fm.scheduleRelayRefresh(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Summary["conflicts"] > 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(result)
+}
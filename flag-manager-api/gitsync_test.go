@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitSync(t *testing.T) {
+	fm, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	body, _ := json.Marshal(map[string]interface{}{"id": "synced", "name": "synced", "provider": "gitlab"})
+	req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	provider := &recordingProvider{files: map[string][]byte{}}
+	fm.integrations.providers["synced"] = provider
+
+	flagYAML := func(defaultVariation string) string {
+		return "  variations:\n    enabled: true\n    disabled: false\n  defaultRule:\n    variation: " + defaultVariation + "\n"
+	}
+	os.WriteFile(filepath.Join(tempDir, "web.yaml"), []byte("local-only:\n"+flagYAML("enabled")+"shared:\n"+flagYAML("enabled")), 0644)
+	provider.files["/web.yaml"] = []byte("repo-only:\n" + flagYAML("enabled") + "shared:\n" + flagYAML("disabled"))
+
+	type syncResponse struct {
+		Applied bool           `json:"applied"`
+		Summary map[string]int `json:"summary"`
+		Flags   []SyncedFlag   `json:"flags"`
+	}
+	sync := func(query string, expected int) syncResponse {
+		t.Helper()
+		var resp syncResponse
+		doRequest(t, router, "POST", "/api/integrations/synced/sync?project=web"+query, "", expected, &resp)
+		return resp
+	}
+	actions := func(resp syncResponse) map[string]string {
+		result := map[string]string{}
+		for _, f := range resp.Flags {
+			result[f.Key] = f.Action
+		}
+		return result
+	}
+
+	// The first sync has no base, so a flag differing on both sides conflicts
+	resp := sync("", http.StatusConflict)
+	if resp.Applied || resp.Summary["conflicts"] != 1 {
+		t.Fatalf("Expected an unapplied sync with 1 conflict, got %+v", resp)
+	}
+	if got := actions(resp); got["shared"] != "conflict" || got["repo-only"] != "added" || got["local-only"] != "kept_local" {
+		t.Errorf("Unexpected actions: %v", got)
+	}
+
+	resp = sync("&strategy=repo&dryRun=true", http.StatusOK)
+	if resp.Applied || actions(resp)["shared"] != "updated" {
+		t.Errorf("Expected a dry run taking the repo copy, got %+v", resp)
+	}
+	if flags, _ := fm.readProjectFlags("web"); flags["shared"].DefaultRule.Variation != "enabled" {
+		t.Error("Dry run should not change flags")
+	}
+
+	resp = sync("&strategy=repo", http.StatusOK)
+	if !resp.Applied || resp.Summary["added"] != 1 || resp.Summary["updated"] != 1 || resp.Summary["keptLocal"] != 1 {
+		t.Fatalf("Unexpected sync result: %+v", resp)
+	}
+	flags, _ := fm.readProjectFlags("web")
+	if _, ok := flags["repo-only"]; !ok || flags["shared"].DefaultRule.Variation != "disabled" {
+		t.Fatalf("Expected repo flags to be imported, got %v", flags)
+	}
+	if _, ok := flags["local-only"]; !ok {
+		t.Error("Expected flag only in the manager to be kept")
+	}
+
+	// Against the recorded base, a repo-side removal and edit apply cleanly
+	// while a manager-side edit is kept
+	flags["local-only"] = FlagConfig{
+		Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+		DefaultRule: &DefaultRule{Variation: "disabled"},
+	}
+	fm.writeProjectFlags("web", flags)
+	provider.files["/web.yaml"] = []byte("shared:\n" + flagYAML("enabled"))
+
+	resp = sync("", http.StatusOK)
+	if got := actions(resp); got["repo-only"] != "removed" || got["shared"] != "updated" || got["local-only"] != "kept_local" {
+		t.Errorf("Unexpected actions: %v", got)
+	}
+	flags, _ = fm.readProjectFlags("web")
+	if _, ok := flags["repo-only"]; ok {
+		t.Error("Expected flag removed from the repo to be deleted")
+	}
+	if flags["local-only"].DefaultRule.Variation != "disabled" {
+		t.Error("Expected manager edit to be kept")
+	}
+
+	provider.files["/web.yaml"] = []byte("bad key!:\n" + flagYAML("enabled"))
+	sync("", http.StatusBadRequest)
+
+	req = httptest.NewRequest("POST", "/api/integrations/missing/sync?project=web", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown integration, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// gitWebhookActor is the audit actor of flags synced by push webhooks.
+var gitWebhookActor = Actor{ID: "git-webhook", Name: "git-webhook", Type: "system"}
+
+// maxPushCommits is the number of commits GitHub and GitLab include in a push
+// payload; the changed files of longer pushes are not all listed.
+const maxPushCommits = 20
+
+// gitPushEvent is a push reported by a git host.
+type gitPushEvent struct {
+	Refs     []string // updated refs, e.g. refs/heads/main
+	Paths    []string // files added, modified or removed
+	AllPaths bool     // the payload does not list every changed file
+}
+
+type pushCommit struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+func (e *gitPushEvent) addCommits(commits []pushCommit) {
+	for _, c := range commits {
+		e.Paths = append(e.Paths, c.Added...)
+		e.Paths = append(e.Paths, c.Modified...)
+		e.Paths = append(e.Paths, c.Removed...)
+	}
+}
+
+// updates reports whether the push updated branch.
+func (e *gitPushEvent) updates(branch string) bool {
+	for _, ref := range e.Refs {
+		if ref == "refs/heads/"+branch {
+			return true
+		}
+	}
+	return false
+}
+
+// touches reports whether the push may have changed the file at path.
+func (e *gitPushEvent) touches(path string) bool {
+	if e.AllPaths {
+		return true
+	}
+	path = strings.TrimPrefix(path, "/")
+	for _, p := range e.Paths {
+		if strings.TrimPrefix(p, "/") == path {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGitPushEvent verifies a GitHub, GitLab or Azure DevOps webhook against
+// secret and returns the push it reports, or nil for other events:
+//   - GitHub signs the body with HMAC-SHA256 in X-Hub-Signature-256
+//   - GitLab sends the secret as X-Gitlab-Token
+//   - Azure DevOps service hooks send it as the basic auth password
+func parseGitPushEvent(r *http.Request, body []byte, secret string) (*gitPushEvent, error) {
+	invalid := &gitSyncError{status: http.StatusUnauthorized, message: "Invalid webhook signature"}
+	malformed := func(err error) error {
+		return &gitSyncError{code: "INVALID_WEBHOOK_PAYLOAD", message: fmt.Sprintf("Invalid push payload: %v", err)}
+	}
+
+	switch {
+	case r.Header.Get("X-GitHub-Event") != "":
+		expected := "sha256=" + signProjectWebhookPayload(secret, body)
+		if !hmac.Equal([]byte(r.Header.Get("X-Hub-Signature-256")), []byte(expected)) {
+			return nil, invalid
+		}
+		if r.Header.Get("X-GitHub-Event") != "push" {
+			return nil, nil
+		}
+		var payload struct {
+			Ref     string       `json:"ref"`
+			Commits []pushCommit `json:"commits"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, malformed(err)
+		}
+		event := &gitPushEvent{Refs: []string{payload.Ref}, AllPaths: len(payload.Commits) >= maxPushCommits}
+		event.addCommits(payload.Commits)
+		return event, nil
+
+	case r.Header.Get("X-Gitlab-Event") != "":
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return nil, invalid
+		}
+		if r.Header.Get("X-Gitlab-Event") != "Push Hook" {
+			return nil, nil
+		}
+		var payload struct {
+			Ref               string       `json:"ref"`
+			TotalCommitsCount int          `json:"total_commits_count"`
+			Commits           []pushCommit `json:"commits"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, malformed(err)
+		}
+		event := &gitPushEvent{Refs: []string{payload.Ref}, AllPaths: payload.TotalCommitsCount > len(payload.Commits)}
+		event.addCommits(payload.Commits)
+		return event, nil
+
+	default:
+		_, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(secret)) != 1 {
+			return nil, invalid
+		}
+		var payload struct {
+			EventType string `json:"eventType"`
+			Resource  struct {
+				RefUpdates []struct {
+					Name string `json:"name"`
+				} `json:"refUpdates"`
+			} `json:"resource"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, malformed(err)
+		}
+		if payload.EventType != "git.push" {
+			return nil, nil
+		}
+		// Azure DevOps push payloads do not list the changed files
+		event := &gitPushEvent{AllPaths: true}
+		for _, ref := range payload.Resource.RefUpdates {
+			event.Refs = append(event.Refs, ref.Name)
+		}
+		return event, nil
+	}
+}
+
+// GitWebhookResponse reports what a git push webhook did: "ignored" with the
+// reason, or "synced" with the result of each project re-synced and the
+// projects that failed.
+type GitWebhookResponse struct {
+	Integration string            `json:"integration"`
+	Branch      string            `json:"branch"`
+	Status      string            `json:"status"`
+	Reason      string            `json:"reason,omitempty"`
+	Results     []*GitSyncResult  `json:"results,omitempty"`
+	Errors      map[string]string `json:"errors,omitempty"`
+}
+
+// gitWebhookHandler receives push webhooks for an integration and re-syncs
+// every project whose flags file changed on the integration's base branch,
+// then refreshes the relay proxy. Projects can be restricted with ?project=,
+// which is required when the integration has a fixed flags path. Conflicting
+// flags are reported and left for a manual sync.
+func (fm *FlagManager) gitWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["integrationId"]
+	r = r.WithContext(context.WithValue(r.Context(), ctxActor, gitWebhookActor))
+
+	provider, integration := fm.integrationGitProvider(r.Context(), id)
+	if integration == nil {
+		writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
+		return
+	}
+	secret := integration.WebhookSecret
+	if fm.store == nil {
+		secret = fm.integrations.GetWebhookSecret(id)
+	}
+	secret, err := fm.secretRefs.resolve(r.Context(), secret)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "SECRET_RESOLUTION_FAILED", "Failed to resolve the webhook secret: "+err.Error())
+		return
+	}
+	if secret == "" {
+		writeError(w, http.StatusForbidden, "FORBIDDEN", "Integration has no webhook secret")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	event, err := parseGitPushEvent(r, body, secret)
+	if err != nil {
+		err.(*gitSyncError).write(w)
+		return
+	}
+
+	_, baseBranch := fm.gitFlagsLocation(integration, "")
+	respond := func(resp GitWebhookResponse) {
+		resp.Integration = id
+		resp.Branch = baseBranch
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+	if event == nil {
+		respond(GitWebhookResponse{Status: "ignored", Reason: "not a push event"})
+		return
+	}
+	if !event.updates(baseBranch) {
+		respond(GitWebhookResponse{Status: "ignored", Reason: "push is not to " + baseBranch})
+		return
+	}
+	if provider == nil {
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Integration is not fully configured")
+		return
+	}
+
+	projects := r.URL.Query()["project"]
+	if len(projects) == 0 {
+		if integration.FlagsPath != "" {
+			writeValidationError(w, "INVALID_WEBHOOK", "project is required when the integration has a fixed flagsPath")
+			return
+		}
+		if projects, err = fm.listAllProjects(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	}
+
+	results := []*GitSyncResult{}
+	errs := map[string]string{}
+	for _, project := range projects {
+		flagsPath, _ := fm.gitFlagsLocation(integration, project)
+		if !event.touches(flagsPath) {
+			continue
+		}
+		result, err := fm.syncProjectFromGit(r, id, provider, integration, project, "", false)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Git webhook sync failed", "project", project, "integration", id, "error", err)
+			errs[project] = err.Error()
+			continue
+		}
+		if result.Summary["conflicts"] > 0 {
+			slog.WarnContext(r.Context(), "Git webhook sync has conflicts", "project", project, "integration", id, "conflicts", result.Summary["conflicts"])
+		}
+		results = append(results, result)
+	}
+
+	if len(results)+len(errs) > 0 {
+		fm.scheduleRelayRefresh(r.Context())
+	}
+	respond(GitWebhookResponse{Status: "synced", Results: results, Errors: errs})
+}
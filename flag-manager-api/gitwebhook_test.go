@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGitWebhook(t *testing.T) {
+	fm, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	var refreshes int32
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+	}))
+	defer relay.Close()
+	fm.config.RelayProxyURL = relay.URL
+	waitForRefreshes := func(n int32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for atomic.LoadInt32(&refreshes) < n && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := atomic.LoadInt32(&refreshes); got < n {
+			t.Errorf("Expected the relay proxy to be refreshed after each sync, got %d refreshes", got)
+		}
+	}
+
+	router := setupTestRouter(fm)
+
+	body, _ := json.Marshal(map[string]interface{}{"id": "pushed", "name": "pushed", "provider": "gitlab", "webhookSecret": "s3cret"})
+	req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "s3cret") {
+		t.Error("Webhook secret should be masked")
+	}
+	provider := &recordingProvider{files: map[string][]byte{
+		"/web.yaml": []byte("from-git:\n  variations:\n    enabled: true\n    disabled: false\n  defaultRule:\n    variation: enabled\n"),
+	}}
+	fm.integrations.providers["pushed"] = provider
+	os.WriteFile(filepath.Join(tempDir, "web.yaml"), []byte("{}\n"), 0644)
+
+	// Push webhooks bypass token auth and are verified by the secret instead
+	fm.authEnabled = true
+	handler := fm.AuthMiddleware(router)
+
+	send := func(headers map[string]string, payload string, expected int) map[string]interface{} {
+		req := httptest.NewRequest("POST", "/api/webhooks/git/pushed", strings.NewReader(payload))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Fatalf("Expected status %d, got %d: %s", expected, rr.Code, rr.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp
+	}
+	github := func(event, payload string) map[string]string {
+		return map[string]string{
+			"X-GitHub-Event":      event,
+			"X-Hub-Signature-256": "sha256=" + signProjectWebhookPayload("s3cret", []byte(payload)),
+		}
+	}
+
+	push := `{"ref":"refs/heads/main","commits":[{"modified":["web.yaml"]}]}`
+	send(map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=bad"}, push, http.StatusUnauthorized)
+	send(map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"}, push, http.StatusUnauthorized)
+
+	if resp := send(github("ping", `{}`), `{}`, http.StatusOK); resp["status"] != "ignored" {
+		t.Errorf("Expected ping to be ignored, got %v", resp)
+	}
+	other := `{"ref":"refs/heads/feature","commits":[{"modified":["web.yaml"]}]}`
+	if resp := send(github("push", other), other, http.StatusOK); resp["status"] != "ignored" {
+		t.Errorf("Expected push to another branch to be ignored, got %v", resp)
+	}
+
+	unrelated := `{"ref":"refs/heads/main","total_commits_count":1,"commits":[{"modified":["README.md"]}]}`
+	resp := send(map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "s3cret"}, unrelated, http.StatusOK)
+	if results, _ := resp["results"].([]interface{}); len(results) != 0 {
+		t.Errorf("Expected no sync for a push not touching the flags file, got %v", resp)
+	}
+	if flags, _ := fm.readProjectFlags("web"); len(flags) != 0 {
+		t.Fatalf("Expected no flags to be imported, got %v", flags)
+	}
+
+	resp = send(github("push", push), push, http.StatusOK)
+	if results, _ := resp["results"].([]interface{}); len(results) != 1 {
+		t.Fatalf("Expected web to be synced, got %v", resp)
+	}
+	if flags, _ := fm.readProjectFlags("web"); len(flags) != 1 {
+		t.Fatalf("Expected from-git to be imported, got %v", flags)
+	}
+	// Refreshes requested while one is pending are coalesced
+	waitForRefreshes(1)
+
+	// Azure DevOps does not list changed files, so every project is synced
+	provider.files["/web.yaml"] = []byte("{}\n")
+	ado := `{"eventType":"git.push","resource":{"refUpdates":[{"name":"refs/heads/main"}]}}`
+	req = httptest.NewRequest("POST", "/api/webhooks/git/pushed", strings.NewReader(ado))
+	req.SetBasicAuth("ado", "s3cret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if flags, _ := fm.readProjectFlags("web"); len(flags) != 0 {
+		t.Errorf("Expected from-git to be removed, got %v", flags)
+	}
+
+	waitForRefreshes(2)
+}
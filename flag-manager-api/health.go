@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// FlagHealthIssue is a problem found by the project health scan.
+type FlagHealthIssue struct {
+	Flag    string `json:"flag"`
+	Path    string `json:"path,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PercentageFix records a percentage map rescaled by ?fix=normalize.
+type PercentageFix struct {
+	Flag   string             `json:"flag"`
+	Path   string             `json:"path"`
+	Before map[string]float64 `json:"before"`
+	After  map[string]float64 `json:"after"`
+}
+
+// ProjectHealthResponse is the result of a project health scan.
+type ProjectHealthResponse struct {
+	Project      string            `json:"project"`
+	FlagsScanned int               `json:"flagsScanned"`
+	Healthy      bool              `json:"healthy"`
+	Issues       []FlagHealthIssue `json:"issues"`
+	Fixes        []PercentageFix   `json:"fixes"`
+}
+
+// percentageTolerance matches the tolerance used by ValidateFlagConfig.
+const percentageTolerance = 0.1
+
+// percentageMaps returns pointers to every percentage split in a flag config,
+// keyed by their path.
+func percentageMaps(config *FlagConfig) map[string]*map[string]float64 {
+	maps := make(map[string]*map[string]float64)
+	addDefault := func(path string, rule *DefaultRule) {
+		if rule != nil && len(rule.Percentage) > 0 {
+			maps[path+".percentage"] = &rule.Percentage
+		}
+	}
+	addTargeting := func(path string, rules []TargetingRule) {
+		for i := range rules {
+			if len(rules[i].Percentage) > 0 {
+				maps[fmt.Sprintf("%s[%d].percentage", path, i)] = &rules[i].Percentage
+			}
+		}
+	}
+
+	addDefault("defaultRule", config.DefaultRule)
+	addTargeting("targeting", config.Targeting)
+	for i := range config.ScheduledRollout {
+		step := &config.ScheduledRollout[i]
+		addDefault(fmt.Sprintf("scheduledRollout[%d].defaultRule", i), step.DefaultRule)
+		addTargeting(fmt.Sprintf("scheduledRollout[%d].targeting", i), step.Targeting)
+	}
+	return maps
+}
+
+func percentageSum(percentage map[string]float64) float64 {
+	var total float64
+	for _, pct := range percentage {
+		total += pct
+	}
+	return total
+}
+
+// normalizePercentages rescales a percentage split so it sums to exactly 100,
+// rounding to two decimals and giving any rounding remainder to the largest share.
+func normalizePercentages(percentage map[string]float64) map[string]float64 {
+	total := percentageSum(percentage)
+	if total <= 0 {
+		return percentage
+	}
+
+	keys := make([]string, 0, len(percentage))
+	for k := range percentage {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	normalized := make(map[string]float64, len(percentage))
+	var sum float64
+	largest := keys[0]
+	for _, k := range keys {
+		normalized[k] = math.Round(percentage[k]/total*10000) / 100
+		sum += normalized[k]
+		if normalized[k] > normalized[largest] {
+			largest = k
+		}
+	}
+	normalized[largest] = math.Round((normalized[largest]+100-sum)*100) / 100
+	return normalized
+}
+
+// checkFlagHealth lints a single flag.
+func checkFlagHealth(flagKey string, config FlagConfig, now time.Time) []FlagHealthIssue {
+	var issues []FlagHealthIssue
+
+	maps := percentageMaps(&config)
+	paths := make([]string, 0, len(maps))
+	for path := range maps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if total := percentageSum(*maps[path]); math.Abs(total-100) > percentageTolerance {
+			issues = append(issues, FlagHealthIssue{
+				Flag: flagKey, Path: path, Code: "PERCENTAGE_DRIFT",
+				Message: fmt.Sprintf("percentage splits sum to %.2f instead of 100", total),
+			})
+		}
+	}
+
+	if len(config.Variations) > 0 {
+		for _, msg := range validateAllVariationReferences(config) {
+			issues = append(issues, FlagHealthIssue{Flag: flagKey, Code: "UNKNOWN_VARIATION", Message: msg})
+		}
+	}
+
+	if len(config.ScheduledRollout) > 0 && allDatesPast(now, scheduledDates(config.ScheduledRollout)...) {
+		issues = append(issues, FlagHealthIssue{
+			Flag: flagKey, Path: "scheduledRollout", Code: "PAST_SCHEDULE",
+			Message: "every scheduled rollout step is in the past",
+		})
+	}
+	if pr := progressiveRolloutOf(config.DefaultRule); pr != nil && pr.End != nil && allDatesPast(now, pr.End.Date) {
+		issues = append(issues, FlagHealthIssue{
+			Flag: flagKey, Path: "defaultRule.progressiveRollout", Code: "PAST_SCHEDULE",
+			Message: "progressive rollout has already ended",
+		})
+	}
+
+	return issues
+}
+
+func scheduledDates(steps []ScheduledStep) []string {
+	dates := make([]string, 0, len(steps))
+	for _, step := range steps {
+		dates = append(dates, step.Date)
+	}
+	return dates
+}
+
+func progressiveRolloutOf(rule *DefaultRule) *ProgressiveRollout {
+	if rule == nil {
+		return nil
+	}
+	return rule.ProgressiveRollout
+}
+
+// allDatesPast reports whether every date is a valid RFC 3339 time before now.
+func allDatesPast(now time.Time, dates ...string) bool {
+	if len(dates) == 0 {
+		return false
+	}
+	for _, d := range dates {
+		t, err := time.Parse(time.RFC3339, d)
+		if err != nil || !t.Before(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// projectHealthHandler lints every flag in a project. GET reports issues; POST
+// with ?fix=normalize also rescales drifted percentage splits to sum to 100.
+func (fm *FlagManager) projectHealthHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+
+	fix := r.URL.Query().Get("fix")
+	if fix != "" && (fix != "normalize" || r.Method != http.MethodPost) {
+		writeValidationError(w, "INVALID_FIX", "fix must be 'normalize' and requires POST")
+		return
+	}
+
+	if fix != "" {
+		defer fm.storage.LockProject(project)()
+	}
+
+	flags, err := fm.loadStoredProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if flags == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	keys := make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fixes := []PercentageFix{}
+	if fix == "normalize" {
+		var changed []string
+		for _, key := range keys {
+			config := flags[key]
+			flagChanged := false
+			for path, pct := range percentageMaps(&config) {
+				if math.Abs(percentageSum(*pct)-100) <= percentageTolerance || percentageSum(*pct) <= 0 {
+					continue
+				}
+				before := *pct
+				*pct = normalizePercentages(before)
+				fixes = append(fixes, PercentageFix{Flag: key, Path: path, Before: before, After: *pct})
+				flagChanged = true
+			}
+			if flagChanged {
+				flags[key] = config
+				changed = append(changed, key)
+			}
+		}
+		sort.Slice(fixes, func(i, j int) bool {
+			if fixes[i].Flag != fixes[j].Flag {
+				return fixes[i].Flag < fixes[j].Flag
+			}
+			return fixes[i].Path < fixes[j].Path
+		})
+
+		if len(changed) > 0 {
+			ids, err := fm.saveStoredProjectFlags(r.Context(), project, flags, changed)
+			if err != nil {
+				writeStorageError(w, err)
+				return
+			}
+
+			actor := GetActor(r)
+			for _, f := range fixes {
+				fm.audit.Log(r.Context(), actor, "flag.percentages_normalized", "flag", ids[f.Flag], f.Flag, project,
+					map[string]interface{}{"path": f.Path, "before": f.Before, "after": f.After}, nil)
+			}
+
+			fm.scheduleRelayRefresh(r.Context())
+		}
+	}
+
+	now := time.Now()
+	issues := []FlagHealthIssue{}
+	for _, key := range keys {
+		issues = append(issues, checkFlagHealth(key, flags[key], now)...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProjectHealthResponse{
+		Project:      project,
+		FlagsScanned: len(flags),
+		Healthy:      len(issues) == 0,
+		Issues:       issues,
+		Fixes:        fixes,
+	})
+}
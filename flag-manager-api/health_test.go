@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProjectHealth(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	// Write the project file directly since the API rejects these configs.
+	past := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	flags := ProjectFlags{
+		"drifted": {
+			Variations:  map[string]interface{}{"a": "A", "b": "B", "c": "C"},
+			DefaultRule: &DefaultRule{Percentage: map[string]float64{"a": 30, "b": 30, "c": 30}},
+		},
+		"dangling": {
+			Variations:  map[string]interface{}{"on": true, "off": false},
+			DefaultRule: &DefaultRule{Variation: "off"},
+			ScheduledRollout: []ScheduledStep{
+				{Date: past, Targeting: []TargetingRule{{Query: "a eq 1", Variation: "gone"}}},
+			},
+		},
+		"healthy": {
+			Variations:  map[string]interface{}{"on": true, "off": false},
+			DefaultRule: &DefaultRule{Percentage: map[string]float64{"on": 33.34, "off": 66.66}},
+		},
+	}
+	if err := fm.writeProjectFlags("lint", flags); err != nil {
+		t.Fatalf("Failed to write flags: %v", err)
+	}
+
+	type healthResponse struct {
+		Healthy bool              `json:"healthy"`
+		Issues  []FlagHealthIssue `json:"issues"`
+		Fixes   []PercentageFix   `json:"fixes"`
+	}
+	call := func(method, url string) (int, healthResponse) {
+		req := httptest.NewRequest(method, url, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var resp healthResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	t.Run("report", func(t *testing.T) {
+		code, resp := call("GET", "/api/projects/lint/flags/health")
+		if code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+		var codes []string
+		for _, issue := range resp.Issues {
+			codes = append(codes, issue.Flag+":"+issue.Code)
+		}
+		want := "dangling:UNKNOWN_VARIATION,dangling:PAST_SCHEDULE,drifted:PERCENTAGE_DRIFT"
+		if strings.Join(codes, ",") != want || resp.Healthy {
+			t.Errorf("Expected issues %s, got %s", want, strings.Join(codes, ","))
+		}
+	})
+
+	t.Run("fix requires POST", func(t *testing.T) {
+		if code, _ := call("GET", "/api/projects/lint/flags/health?fix=normalize"); code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", code)
+		}
+	})
+
+	t.Run("normalize", func(t *testing.T) {
+		code, resp := call("POST", "/api/projects/lint/flags/health?fix=normalize")
+		if code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+		if len(resp.Fixes) != 1 || resp.Fixes[0].Flag != "drifted" || resp.Fixes[0].Path != "defaultRule.percentage" {
+			t.Fatalf("Unexpected fixes: %+v", resp.Fixes)
+		}
+		for _, issue := range resp.Issues {
+			if issue.Code == "PERCENTAGE_DRIFT" {
+				t.Errorf("Expected drift to be fixed, got %+v", issue)
+			}
+		}
+
+		stored, _ := fm.readProjectFlags("lint")
+		if total := percentageSum(stored["drifted"].DefaultRule.Percentage); total != 100 {
+			t.Errorf("Expected stored percentages to sum to 100, got %v", total)
+		}
+		if got := stored["healthy"].DefaultRule.Percentage["on"]; got != 33.34 {
+			t.Errorf("Expected healthy flag to be untouched, got %v", got)
+		}
+	})
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"flag-manager-api/db"
+
+	"github.com/gorilla/mux"
+)
+
+// Actions of flag revisions.
+const (
+	flagVersionCreated = "created"
+	flagVersionUpdated = "updated"
+	flagVersionDeleted = "deleted"
+)
+
+// FlagVersion is a revision of a project flag. Versions are numbered per flag
+// from 1; Config is nil for the revision recording a deletion.
+type FlagVersion struct {
+	Version     int         `json:"version"`
+	Action      string      `json:"action"`
+	Config      *FlagConfig `json:"config,omitempty"`
+	PreviousKey string      `json:"previousKey,omitempty"` // set when the revision renamed the flag
+	Author      string      `json:"author,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+}
+
+// flagRevision is a flag change to record in the history.
+type flagRevision struct {
+	Key         string
+	Action      string
+	Config      *FlagConfig
+	PreviousKey string
+}
+
+// updateRevision is the revision of an update of key, renamed to newKey when
+// they differ.
+func updateRevision(key, newKey string, config FlagConfig) flagRevision {
+	rev := flagRevision{Key: newKey, Action: flagVersionUpdated, Config: &config}
+	if newKey != key {
+		rev.PreviousKey = key
+	}
+	return rev
+}
+
+// savedRevisions are the revisions of the changed flags of a saved set.
+func savedRevisions(flags ProjectFlags, changed []string) []flagRevision {
+	revisions := make([]flagRevision, 0, len(changed))
+	for _, key := range changed {
+		if config, ok := flags[key]; ok {
+			revisions = append(revisions, flagRevision{Key: key, Action: flagVersionUpdated, Config: &config})
+		}
+	}
+	return revisions
+}
+
+// flagHistory stores flag revisions in the flag_versions table with a
+// database, and otherwise in history/<project>.jsonl in FLAGS_DIR, one
+// revision per line.
+type flagHistory struct {
+	store *db.Store
+	dir   string
+}
+
+// history returns the flag history of the active storage backend.
+func (fm *FlagManager) history() flagHistory {
+	return flagHistory{store: fm.store, dir: fm.config.FlagsDir}
+}
+
+// historyFileLine is a revision in a project history file.
+type historyFileLine struct {
+	Flag string `json:"flag"`
+	FlagVersion
+}
+
+func (h flagHistory) path(project string) string {
+	return filepath.Join(h.dir, "history", project+".jsonl")
+}
+
+// record stores revisions authored by the actor of ctx. Failures are logged
+// rather than returned: the flags are already saved, as with audit events.
+func (h flagHistory) record(ctx context.Context, project string, revisions ...flagRevision) {
+	if err := h.write(ctx, project, revisions); err != nil {
+		slog.ErrorContext(ctx, "Failed to record flag history", "project", project, "error", err)
+	}
+}
+
+func (h flagHistory) write(ctx context.Context, project string, revisions []flagRevision) error {
+	if len(revisions) == 0 {
+		return nil
+	}
+	author := ""
+	if actor, ok := ctx.Value(ctxActor).(Actor); ok {
+		author = actorLabel(actor)
+	}
+
+	if h.store != nil {
+		for _, rev := range revisions {
+			if rev.PreviousKey != "" {
+				if err := h.store.RenameFlagVersions(ctx, project, rev.PreviousKey, rev.Key); err != nil {
+					return err
+				}
+			}
+			var config json.RawMessage
+			if rev.Config != nil {
+				data, err := json.Marshal(rev.Config)
+				if err != nil {
+					return err
+				}
+				config = data
+			}
+			_, err := h.store.InsertFlagVersion(ctx, db.FlagVersion{
+				Project:     project,
+				FlagKey:     rev.Key,
+				Action:      rev.Action,
+				Config:      config,
+				PreviousKey: rev.PreviousKey,
+				Author:      author,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path := h.path(project)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	lines, err := readHistoryFile(path)
+	if err != nil {
+		return err
+	}
+	renamed := false
+	latest := make(map[string]int)
+	for i := range lines {
+		for _, rev := range revisions {
+			if rev.PreviousKey != "" && lines[i].Flag == rev.PreviousKey {
+				lines[i].Flag = rev.Key
+				renamed = true
+			}
+		}
+		latest[lines[i].Flag] = max(latest[lines[i].Flag], lines[i].Version)
+	}
+
+	now := time.Now().UTC()
+	var appended []historyFileLine
+	for _, rev := range revisions {
+		latest[rev.Key]++
+		appended = append(appended, historyFileLine{Flag: rev.Key, FlagVersion: FlagVersion{
+			Version:     latest[rev.Key],
+			Action:      rev.Action,
+			Config:      rev.Config,
+			PreviousKey: rev.PreviousKey,
+			Author:      author,
+			CreatedAt:   now,
+		}})
+	}
+
+	// A rename rewrites the file; otherwise revisions are appended
+	if renamed {
+		return writeHistoryFile(path, append(lines, appended...))
+	}
+	var buf bytes.Buffer
+	for _, line := range appended {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func readHistoryFile(path string) ([]historyFileLine, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []historyFileLine
+	for _, raw := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		var line historyFileLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			// Skip a line torn by a crash mid-write
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// writeHistoryFile replaces a history file; the caller holds its lock, which
+// writeFileAtomic would otherwise take.
+func writeHistoryFile(path string, lines []historyFileLine) error {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// versions returns the revisions of a flag, newest first.
+func (h flagHistory) versions(ctx context.Context, project, key string) ([]FlagVersion, error) {
+	versions := []FlagVersion{}
+	if h.store != nil {
+		stored, err := h.store.ListFlagVersions(ctx, project, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range stored {
+			v := FlagVersion{
+				Version:     s.Version,
+				Action:      s.Action,
+				PreviousKey: s.PreviousKey,
+				Author:      s.Author,
+				CreatedAt:   s.CreatedAt.UTC(),
+			}
+			if len(s.Config) > 0 {
+				var config FlagConfig
+				if err := json.Unmarshal(s.Config, &config); err != nil {
+					return nil, fmt.Errorf("failed to parse version %d of flag %s: %w", s.Version, key, err)
+				}
+				v.Config = &config
+			}
+			versions = append(versions, v)
+		}
+		return versions, nil
+	}
+
+	lines, err := readHistoryFile(h.path(project))
+	if err != nil {
+		return nil, err
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].Flag == key {
+			versions = append(versions, lines[i].FlagVersion)
+		}
+	}
+	return versions, nil
+}
+
+// deleteProject removes the flag history of a deleted project.
+func (h flagHistory) deleteProject(ctx context.Context, project string) {
+	var err error
+	if h.store != nil {
+		err = h.store.DeleteProjectFlagVersions(ctx, project)
+	} else if err = os.Remove(h.path(project)); os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to remove project flag history", "project", project, "error", err)
+	}
+}
+
+// FlagVersionEntry is a revision with its changes from the previous one.
+type FlagVersionEntry struct {
+	FlagVersion
+	Changes []ConfigChange `json:"changes"`
+}
+
+// FlagVersionsResponse is the history of a flag, newest first.
+type FlagVersionsResponse struct {
+	Project  string             `json:"project"`
+	FlagKey  string             `json:"flagKey"`
+	Versions []FlagVersionEntry `json:"versions"`
+}
+
+// getFlagVersionsHandler lists the revisions of a flag with the changes each
+// made to the config. The history of a deleted flag stays readable.
+func (fm *FlagManager) getFlagVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+
+	versions, err := fm.history().versions(r.Context(), project, flagKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if len(versions) == 0 && !fm.flagExists(r, project, flagKey) {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
+		return
+	}
+
+	entries := make([]FlagVersionEntry, 0, len(versions))
+	for i, v := range versions {
+		var previous *FlagConfig
+		if i+1 < len(versions) {
+			previous = versions[i+1].Config
+		}
+		changes, err := diffConfigs(previous, v.Config)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		entries = append(entries, FlagVersionEntry{FlagVersion: v, Changes: changes})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FlagVersionsResponse{
+		Project:  project,
+		FlagKey:  flagKey,
+		Versions: entries,
+	})
+}
+
+// rollbackFlagHandler restores the config of a flag revision. The restored
+// config goes through the same pipeline as an update, so it may be filed as a
+// change request when approvals are required. The optional body
+// {"changeNote": "..."} defaults to a note naming the version.
+func (fm *FlagManager) rollbackFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+
+	version, err := strconv.Atoi(vars["versionId"])
+	if err != nil || version < 1 {
+		writeValidationError(w, "INVALID_VERSION", "version must be a positive integer")
+		return
+	}
+
+	var requestBody struct {
+		ChangeNote string `json:"changeNote,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+			return
+		}
+	}
+	if requestBody.ChangeNote == "" {
+		requestBody.ChangeNote = fmt.Sprintf("Rollback to version %d", version)
+	}
+
+	versions, err := fm.history().versions(r.Context(), project, flagKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	var target *FlagVersion
+	for i := range versions {
+		if versions[i].Version == version {
+			target = &versions[i]
+		}
+	}
+	if target == nil {
+		writeError(w, http.StatusNotFound, "VERSION_NOT_FOUND", "Flag version not found")
+		return
+	}
+	if target.Config == nil {
+		writeValidationError(w, "VERSION_NOT_RESTORABLE", "the version records the deletion of the flag")
+		return
+	}
+
+	// The flag keeps its status: rolling back does not publish or unpublish it
+	config := *target.Config
+	config.Status = ""
+	fm.applyFlagUpdate(w, r, project, flagKey, flagUpdate{
+		Config:         config,
+		ChangeNote:     requestBody.ChangeNote,
+		RollbackTarget: version,
+	})
+}
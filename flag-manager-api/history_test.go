@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagVersions(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			doRequest(t, router, "POST", "/api/projects/web", "", http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/banner", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+			doRequest(t, router, "PUT", "/api/projects/web/flags/banner", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusOK, nil)
+			doRequest(t, router, "PUT", "/api/projects/web/flags/banner", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}},"newKey":"hero"}`, http.StatusOK, nil)
+
+			var versions FlagVersionsResponse
+			doRequest(t, router, "GET", "/api/projects/web/flags/hero/versions", "", http.StatusOK, &versions)
+			if len(versions.Versions) != 3 {
+				t.Fatalf("Expected 3 versions of the renamed flag, got %+v", versions.Versions)
+			}
+			if v := versions.Versions[0]; v.Version != 3 || v.PreviousKey != "banner" || len(v.Changes) != 0 {
+				t.Errorf("Expected version 3 to rename banner without config changes, got %+v", v)
+			}
+			if v := versions.Versions[1]; v.Action != flagVersionUpdated || len(v.Changes) != 1 || v.Changes[0].Path != "defaultRule.variation" {
+				t.Errorf("Expected version 2 to change the default variation, got %+v", v)
+			}
+			if v := versions.Versions[2]; v.Version != 1 || v.Action != flagVersionCreated || len(v.Changes) == 0 {
+				t.Errorf("Expected version 1 to create the flag, got %+v", v)
+			}
+
+			var flag map[string]interface{}
+			doRequest(t, router, "POST", "/api/projects/web/flags/hero/rollback/1", "", http.StatusOK, &flag)
+			versions = FlagVersionsResponse{}
+			doRequest(t, router, "GET", "/api/projects/web/flags/hero/versions", "", http.StatusOK, &versions)
+			if v := versions.Versions[0]; v.Version != 4 || v.Config.DefaultRule.Variation != "off" {
+				t.Errorf("Expected the rollback to be recorded as version 4, got %+v", v)
+			}
+
+			doRequest(t, router, "POST", "/api/projects/web/flags/hero/rollback/9", "", http.StatusNotFound, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/hero/rollback/latest", "", http.StatusBadRequest, nil)
+			doRequest(t, router, "GET", "/api/projects/web/flags/missing/versions", "", http.StatusNotFound, nil)
+
+			// The history of a deleted flag stays readable, but its deletion
+			// cannot be restored
+			doRequest(t, router, "DELETE", "/api/projects/web/flags/hero", "", http.StatusNoContent, nil)
+			doRequest(t, router, "DELETE", "/api/projects/web/flags/hero", "", http.StatusNoContent, nil)
+			versions = FlagVersionsResponse{}
+			doRequest(t, router, "GET", "/api/projects/web/flags/hero/versions", "", http.StatusOK, &versions)
+			if v := versions.Versions[1]; v.Version != 5 || v.Action != flagVersionUpdated || v.Config.ArchivedAt == "" {
+				t.Errorf("Expected version 5 to record the archival, got %+v", v)
+			}
+			if v := versions.Versions[0]; v.Version != 6 || v.Action != flagVersionDeleted || v.Config != nil {
+				t.Errorf("Expected version 6 to record the deletion, got %+v", v)
+			}
+			doRequest(t, router, "POST", "/api/projects/web/flags/hero/rollback/6", "", http.StatusBadRequest, nil)
+		})
+	}
+
+	// A rollback needing approval is filed as a change request
+	fileFM.requireApprovals = true
+	router := setupTestRouter(fileFM)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/projects/web/flags/checkout", strings.NewReader(`{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/projects/web/flags/checkout/rollback/1", nil))
+	var approval ApprovalRequiredResponse
+	json.Unmarshal(rr.Body.Bytes(), &approval)
+	if rr.Code != http.StatusOK || !approval.RequiresApproval || approval.ChangeRequestID == "" {
+		t.Errorf("Expected the rollback to require approval, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
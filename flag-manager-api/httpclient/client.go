@@ -0,0 +1,140 @@
+// Package httpclient provides the shared HTTP client used for outbound calls
+// (relay proxy refresh, git providers, notifier webhooks, OIDC discovery), so
+// connections are pooled and timeouts and proxy settings live in one place.
+package httpclient
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Config holds the outbound HTTP client configuration
+type Config struct {
+	Timeout             time.Duration
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// ProxyURL routes all requests through a proxy. When empty, the standard
+	// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables apply.
+	ProxyURL string
+}
+
+// DefaultConfig returns the defaults used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		Timeout:             10 * time.Second,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// LoadConfigFromEnv loads the client configuration from environment variables,
+// falling back to the defaults for missing or invalid values
+func LoadConfigFromEnv() Config {
+	config := DefaultConfig()
+	if d, ok := envDuration("HTTP_CLIENT_TIMEOUT"); ok {
+		config.Timeout = d
+	}
+	if n, ok := envInt("HTTP_CLIENT_MAX_IDLE_CONNS"); ok {
+		config.MaxIdleConns = n
+	}
+	if n, ok := envInt("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST"); ok {
+		config.MaxIdleConnsPerHost = n
+	}
+	config.ProxyURL = os.Getenv("HTTP_CLIENT_PROXY_URL")
+	return config
+}
+
+// New builds a client with its own transport from config
+func New(config Config) *http.Client {
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: newTransport(config),
+	}
+}
+
+func newTransport(config Config) *http.Transport {
+	proxy := http.ProxyFromEnvironment
+	if config.ProxyURL != "" {
+		if u, err := url.Parse(config.ProxyURL); err == nil {
+			proxy = http.ProxyURL(u)
+		} else {
+			slog.Warn("Invalid HTTP client proxy URL", "url", config.ProxyURL, "error", err)
+		}
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+var (
+	mu     sync.RWMutex
+	shared = New(DefaultConfig())
+)
+
+// Configure replaces the shared client; call it once at startup
+func Configure(config Config) {
+	client := New(config)
+	mu.Lock()
+	shared = client
+	mu.Unlock()
+}
+
+// Default returns the shared client
+func Default() *http.Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return shared
+}
+
+// WithTimeout returns a client sharing the shared client's connection pool but
+// with its own timeout, for callers that need a longer or shorter deadline
+func WithTimeout(timeout time.Duration) *http.Client {
+	client := *Default()
+	client.Timeout = timeout
+	return &client
+}
+
+func envDuration(key string) (time.Duration, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, false
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid "+key+", using default", "value", value)
+		return 0, false
+	}
+	return d, true
+}
+
+func envInt(key string) (int, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		slog.Warn("Invalid "+key+", using default", "value", value)
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,46 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSharedClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	defer Configure(DefaultConfig())
+	config := DefaultConfig()
+	config.Timeout = 50 * time.Millisecond
+	Configure(config)
+
+	if got := Default().Timeout; got != config.Timeout {
+		t.Fatalf("Expected shared client timeout %v, got %v", config.Timeout, got)
+	}
+
+	start := time.Now()
+	_, err := Default().Get(server.URL)
+	if err == nil {
+		t.Fatal("Expected request to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected timeout after ~%v, took %v", config.Timeout, elapsed)
+	}
+
+	longer := WithTimeout(time.Minute)
+	if longer.Timeout != time.Minute {
+		t.Errorf("Expected WithTimeout client timeout %v, got %v", time.Minute, longer.Timeout)
+	}
+	if longer.Transport != Default().Transport {
+		t.Error("Expected WithTimeout client to share the connection pool")
+	}
+}
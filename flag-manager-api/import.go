@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 )
@@ -15,9 +17,20 @@ type ImportRequest struct {
 
 // ImportFlag represents a single discovered flag to import.
 type ImportFlag struct {
-	Key    string `json:"key"`
-	Type   string `json:"type"`
-	Source string `json:"source,omitempty"`
+	Key       string           `json:"key"`
+	Type      string           `json:"type"`
+	Source    string           `json:"source,omitempty"`
+	CallSites []ImportCallSite `json:"callSites,omitempty"`
+}
+
+// ImportCallSite is a place in the scanned code where a flag is evaluated.
+type ImportCallSite struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Language string `json:"language,omitempty"`
+	Call     string `json:"call,omitempty"`
+	Type     string `json:"type,omitempty"` // defaults to the type of the flag
 }
 
 // ImportMetadata holds optional metadata about the scan that produced the manifest.
@@ -34,16 +47,43 @@ type ImportResponse struct {
 	Errors  []string `json:"errors"`
 }
 
+// ManifestImportResponse is the response of a discovery manifest import. New
+// lists the flags the import created and Known those that already existed;
+// ProjectCreated is set when the import created the project. The call sites
+// of the flags replace the code references of the manifest's app.
+type ManifestImportResponse struct {
+	ImportResponse
+	ProjectCreated bool     `json:"projectCreated"`
+	New            []string `json:"new"`
+	Known          []string `json:"known"`
+	CodeReferences int      `json:"codeReferences"` // call sites stored from the manifest
+}
+
 // importFlagsHandler handles POST /api/flags/import — idempotent bulk flag creation.
+// With ?source=launchdarkly the body is a LaunchDarkly export instead of a manifest,
+// and with ?source=codeowners a CODEOWNERS-style file setting flag owners.
 func (fm *FlagManager) importFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("source") {
+	case "":
+	case "launchdarkly":
+		fm.importLaunchDarklyFlags(w, r)
+		return
+	case "codeowners":
+		fm.importCodeowners(w, r)
+		return
+	default:
+		writeValidationError(w, "INVALID_IMPORT_SOURCE", "source must be launchdarkly or codeowners")
+		return
+	}
+
 	var req ImportRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if req.Project == "" {
-		http.Error(w, "project is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "project is required")
 		return
 	}
 
@@ -51,24 +91,35 @@ func (fm *FlagManager) importFlagsHandler(w http.ResponseWriter, r *http.Request
 		writeValidationError(w, "INVALID_PROJECT_NAME", err.Error())
 		return
 	}
+	if !fm.authorizeProject(w, r, "flag", "write", req.Project) {
+		return
+	}
 
 	if len(req.Flags) == 0 {
-		http.Error(w, "at least one flag is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "at least one flag is required")
 		return
 	}
 
-	resp := ImportResponse{Errors: []string{}}
+	resp := ManifestImportResponse{
+		ImportResponse: ImportResponse{Errors: []string{}},
+		New:            []string{},
+		Known:          []string{},
+	}
 	actor := GetActor(r)
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	if fm.store != nil {
-		fm.importFlagsDB(r, req, actor, now, &resp)
-	} else {
-		fm.importFlagsFileBased(req, actor, now, &resp)
+	fm.importManifestFlags(r.Context(), req, actor, now, &resp)
+
+	if refs, ok := manifestCodeReferences(req); ok {
+		if err := fm.replaceCodeReferences(r.Context(), req.Project, req.Metadata.app(), refs); err != nil {
+			resp.Errors = append(resp.Errors, "failed to store code references: "+err.Error())
+		} else {
+			resp.CodeReferences = len(refs)
+		}
 	}
 
 	if resp.Created > 0 {
-		go fm.refreshRelayProxy()
+		fm.scheduleRelayRefresh(r.Context())
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -80,69 +131,39 @@ func (fm *FlagManager) importFlagsHandler(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(resp)
 }
 
-// importFlagsDB handles import when using the database backend.
-func (fm *FlagManager) importFlagsDB(r *http.Request, req ImportRequest, actor Actor, now string, resp *ImportResponse) {
+// importManifestFlags creates the flags of a manifest that do not exist yet,
+// through the storage like any other new flag.
+func (fm *FlagManager) importManifestFlags(ctx context.Context, req ImportRequest, actor Actor, now string, resp *ManifestImportResponse) {
+	projectExists, err := fm.storage.ProjectExists(ctx, req.Project)
+	if err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+		return
+	}
+
 	for _, f := range req.Flags {
 		if err := ValidateFlagKey(f.Key); err != nil {
 			resp.Errors = append(resp.Errors, f.Key+": "+err.Error())
 			continue
 		}
 
-		exists, _ := fm.store.FlagExists(r.Context(), req.Project, f.Key)
-		if exists {
+		flagConfig := buildImportFlagConfig(f, req.Metadata, now)
+		flag, err := fm.storage.CreateFlag(ctx, req.Project, f.Key, flagConfig)
+		if errors.Is(err, errFlagExists) {
 			resp.Skipped++
+			resp.Known = append(resp.Known, f.Key)
 			continue
 		}
-
-		flagConfig := buildImportFlagConfig(f, req.Metadata, now)
-		configJSON, _ := json.Marshal(flagConfig)
-
-		flag, err := fm.store.CreateFlag(r.Context(), req.Project, f.Key, configJSON, false, "")
 		if err != nil {
 			resp.Errors = append(resp.Errors, f.Key+": "+err.Error())
 			continue
 		}
 
-		fm.audit.Log(r.Context(), actor, "flag.imported", "flag", flag.ID, f.Key, req.Project,
+		fm.audit.Log(ctx, actor, "flag.imported", "flag", flag.ID, f.Key, req.Project,
 			map[string]interface{}{"after": flagConfig}, nil)
 
 		resp.Created++
-	}
-}
-
-// importFlagsFileBased handles import when using file-based storage.
-func (fm *FlagManager) importFlagsFileBased(req ImportRequest, actor Actor, now string, resp *ImportResponse) {
-	flags, err := fm.readProjectFlags(req.Project)
-	if err != nil && flags == nil {
-		// Project doesn't exist yet — create empty
-		flags = make(ProjectFlags)
-	}
-	if flags == nil {
-		flags = make(ProjectFlags)
-	}
-
-	changed := false
-	for _, f := range req.Flags {
-		if err := ValidateFlagKey(f.Key); err != nil {
-			resp.Errors = append(resp.Errors, f.Key+": "+err.Error())
-			continue
-		}
-
-		if _, exists := flags[f.Key]; exists {
-			resp.Skipped++
-			continue
-		}
-
-		flagConfig := buildImportFlagConfig(f, req.Metadata, now)
-		flags[f.Key] = flagConfig
-		changed = true
-		resp.Created++
-	}
-
-	if changed {
-		if err := fm.writeProjectFlags(req.Project, flags); err != nil {
-			resp.Errors = append(resp.Errors, "failed to write project flags: "+err.Error())
-		}
+		resp.New = append(resp.New, f.Key)
+		resp.ProjectCreated = !projectExists
 	}
 }
 
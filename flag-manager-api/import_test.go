@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestImportDiscoveryManifest(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			importManifest := func(body string, status int) ManifestImportResponse {
+				t.Helper()
+				var resp ManifestImportResponse
+				doRequest(t, router, "POST", "/api/flags/import", body, status, &resp)
+				return resp
+			}
+
+			// goff-scan manifests carry call sites, which the import ignores
+			manifest := `{"project":"scanned","metadata":{"app":"web","version":"1.2.0"},"flags":[
+				{"key":"dark-mode","type":"boolean","source":"src/app.ts:4","languages":["typescript"],
+				 "callSites":[{"file":"src/app.ts","line":4,"column":20,"language":"typescript","call":"getBooleanValue"}]},
+				{"key":"banner","type":"string","source":"app/views.py:9"}]}`
+			resp := importManifest(manifest, http.StatusCreated)
+			if !resp.ProjectCreated || resp.Created != 2 || len(resp.New) != 2 || len(resp.Known) != 0 {
+				t.Fatalf("Expected two new flags in a new project, got %+v", resp)
+			}
+
+			resp = importManifest(`{"project":"scanned","flags":[{"key":"dark-mode","type":"boolean"},{"key":"limit","type":"number"}]}`, http.StatusCreated)
+			if resp.ProjectCreated || len(resp.New) != 1 || resp.New[0] != "limit" || len(resp.Known) != 1 || resp.Known[0] != "dark-mode" {
+				t.Fatalf("Expected limit to be new and dark-mode known, got %+v", resp)
+			}
+
+			resp = importManifest(manifest, http.StatusOK)
+			if resp.Created != 0 || resp.Skipped != 2 || len(resp.New) != 0 {
+				t.Errorf("Expected every flag to be known, got %+v", resp)
+			}
+		})
+	}
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"flag-manager-api/db"
 	"flag-manager-api/git"
+	"flag-manager-api/secrets"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
@@ -19,7 +25,7 @@ import (
 type GitIntegration struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
-	Provider    string    `json:"provider"` // "ado" or "gitlab"
+	Provider    string    `json:"provider"` // "ado", "gitlab", "github", "bitbucket", "gitea" or "jira"
 	Description string    `json:"description,omitempty"`
 	IsDefault   bool      `json:"isDefault"`
 	CreatedAt   time.Time `json:"createdAt"`
@@ -36,23 +42,170 @@ type GitIntegration struct {
 	GitLabProjectID string `json:"gitlabProjectId,omitempty"`
 	GitLabToken     string `json:"gitlabToken,omitempty"`
 
+	// GitHub-specific fields
+	GitHubURL        string `json:"githubUrl,omitempty"` // REST API URL, defaults to https://api.github.com
+	GitHubOwner      string `json:"githubOwner,omitempty"`
+	GitHubRepository string `json:"githubRepository,omitempty"`
+	GitHubToken      string `json:"githubToken,omitempty"`
+
+	// Bitbucket-specific fields
+	BitbucketURL         string `json:"bitbucketUrl,omitempty"`       // empty for Bitbucket Cloud
+	BitbucketWorkspace   string `json:"bitbucketWorkspace,omitempty"` // Cloud workspace or Server project key
+	BitbucketRepository  string `json:"bitbucketRepository,omitempty"`
+	BitbucketUsername    string `json:"bitbucketUsername,omitempty"` // empty to use the app password as an access token
+	BitbucketAppPassword string `json:"bitbucketAppPassword,omitempty"`
+
+	// Gitea-specific fields (also used for Forgejo)
+	GiteaURL        string `json:"giteaUrl,omitempty"`
+	GiteaOwner      string `json:"giteaOwner,omitempty"`
+	GiteaRepository string `json:"giteaRepository,omitempty"`
+	GiteaToken      string `json:"giteaToken,omitempty"`
+
+	// Jira-specific fields (an issue tracker, never the default integration)
+	JiraURL               string `json:"jiraUrl,omitempty"`
+	JiraEmail             string `json:"jiraEmail,omitempty"` // empty to use the API token as a personal access token
+	JiraAPIToken          string `json:"jiraApiToken,omitempty"`
+	JiraValidateIssues    bool   `json:"jiraValidateIssues,omitempty"`    // reject flags linking to a missing issue
+	JiraRolloutTransition string `json:"jiraRolloutTransition,omitempty"` // applied when a linked flag is fully rolled out
+	JiraArchiveTransition string `json:"jiraArchiveTransition,omitempty"` // applied when a linked flag is archived or deleted
+
 	// Common fields
 	BaseBranch string `json:"baseBranch"`
 	FlagsPath  string `json:"flagsPath"`
+
+	// PR templates (Go text/template, see PRTemplateData)
+	PRTitleTemplate       string `json:"prTitleTemplate,omitempty"`
+	PRDescriptionTemplate string `json:"prDescriptionTemplate,omitempty"`
+
+	// Proposal branch name template (Go text/template, see PRTemplateData)
+	BranchNameTemplate string `json:"branchNameTemplate,omitempty"`
+
+	// Secret verifying push webhooks sent to /api/webhooks/git/{id}
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+}
+
+// PRTemplateData is the data available to PR title and description templates,
+// e.g. "[FF][{{.Project}}] {{.Action}} {{.Flag}}".
+type PRTemplateData struct {
+	Project   string
+	Flag      string
+	Action    string
+	Actor     string
+	Timestamp int64
+}
+
+// defaultBranchNameTemplate is used when neither the integration nor
+// GIT_BRANCH_TEMPLATE sets a branch name template.
+const defaultBranchNameTemplate = "flag/{{.Project}}/{{.Flag}}-{{.Timestamp}}"
+
+// renderPRTemplate executes a PR title or description template.
+func renderPRTemplate(text string, data PRTemplateData) (string, error) {
+	tmpl, err := template.New("pr").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// invalidBranchChars matches characters git does not allow in ref names.
+var invalidBranchChars = regexp.MustCompile(`[\x00-\x20\x7f~^:?*\[\\]+`)
+
+// sanitizeBranchName rewrites a rendered branch name into a valid git ref name:
+// disallowed characters become "-", and empty, dot-prefixed and ".lock"
+// components, "..", "@{" and trailing dots or slashes are removed.
+func sanitizeBranchName(name string) string {
+	name = invalidBranchChars.ReplaceAllString(name, "-")
+	name = strings.ReplaceAll(name, "@{", "-")
+	for strings.Contains(name, "..") {
+		name = strings.ReplaceAll(name, "..", ".")
+	}
+
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		part = strings.TrimLeft(part, ".")
+		for strings.HasSuffix(part, ".lock") {
+			part = strings.TrimSuffix(part, ".lock")
+		}
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	name = strings.TrimRight(strings.Join(parts, "/"), ".")
+	if name == "@" {
+		return ""
+	}
+	return name
+}
+
+// renderBranchName renders a branch name template and sanitizes the result.
+func renderBranchName(text string, data PRTemplateData) (string, error) {
+	rendered, err := renderPRTemplate(text, data)
+	if err != nil {
+		return "", err
+	}
+	name := sanitizeBranchName(rendered)
+	if name == "" {
+		return "", fmt.Errorf("template renders an empty branch name")
+	}
+	return name, nil
+}
+
+// validateBranchNameTemplate checks that a branch name template parses, only
+// references known fields and renders a valid branch name without sanitizing.
+func validateBranchNameTemplate(text string) error {
+	sample := PRTemplateData{Project: "project", Flag: "flag", Action: "update", Actor: "actor", Timestamp: 1700000000}
+	rendered, err := renderPRTemplate(text, sample)
+	if err != nil {
+		return err
+	}
+	if name := sanitizeBranchName(rendered); name != rendered {
+		return fmt.Errorf("%q is not a valid branch name", rendered)
+	}
+	return nil
+}
+
+// validatePRTemplates checks that an integration's PR and branch name templates
+// parse and only reference known fields.
+func validatePRTemplates(gi *GitIntegration) []string {
+	sample := PRTemplateData{Project: "project", Flag: "flag", Action: "update", Actor: "actor"}
+
+	var errors []string
+	if gi.PRTitleTemplate != "" {
+		if _, err := renderPRTemplate(gi.PRTitleTemplate, sample); err != nil {
+			errors = append(errors, fmt.Sprintf("prTitleTemplate: %v", err))
+		}
+	}
+	if gi.PRDescriptionTemplate != "" {
+		if _, err := renderPRTemplate(gi.PRDescriptionTemplate, sample); err != nil {
+			errors = append(errors, fmt.Sprintf("prDescriptionTemplate: %v", err))
+		}
+	}
+	if gi.BranchNameTemplate != "" {
+		if err := validateBranchNameTemplate(gi.BranchNameTemplate); err != nil {
+			errors = append(errors, fmt.Sprintf("branchNameTemplate: %v", err))
+		}
+	}
+	return errors
 }
 
 // IntegrationsStore manages git integrations
 type IntegrationsStore struct {
 	configPath   string
+	cipher       *secrets.Cipher
 	integrations map[string]*GitIntegration
 	providers    map[string]git.Provider
 	mu           sync.RWMutex
 }
 
 // NewIntegrationsStore creates a new integrations store
-func NewIntegrationsStore(configDir string) *IntegrationsStore {
+func NewIntegrationsStore(configDir string, cipher *secrets.Cipher) *IntegrationsStore {
 	store := &IntegrationsStore{
 		configPath:   filepath.Join(configDir, "integrations.json"),
+		cipher:       cipher,
 		integrations: make(map[string]*GitIntegration),
 		providers:    make(map[string]git.Provider),
 	}
@@ -64,7 +217,7 @@ func (s *IntegrationsStore) load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := os.ReadFile(s.configPath)
+	data, err := readSealedFile(s.configPath, s.cipher, db.IntegrationSecretFields)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -96,7 +249,7 @@ func (s *IntegrationsStore) save() error {
 		return err
 	}
 
-	return os.WriteFile(s.configPath, data, 0644)
+	return writeSealedFile(s.configPath, data, 0644, s.cipher, db.IntegrationSecretFields)
 }
 
 func (s *IntegrationsStore) initProvider(integration *GitIntegration) {
@@ -123,6 +276,37 @@ func (s *IntegrationsStore) initProvider(integration *GitIntegration) {
 				integration.BaseBranch,
 			)
 		}
+	case "github":
+		if integration.GitHubOwner != "" && integration.GitHubRepository != "" && integration.GitHubToken != "" {
+			provider = git.NewGitHubClient(
+				integration.GitHubURL,
+				integration.GitHubOwner,
+				integration.GitHubRepository,
+				integration.GitHubToken,
+				integration.BaseBranch,
+			)
+		}
+	case "bitbucket":
+		if integration.BitbucketWorkspace != "" && integration.BitbucketRepository != "" && integration.BitbucketAppPassword != "" {
+			provider = git.NewBitbucketClient(
+				integration.BitbucketURL,
+				integration.BitbucketWorkspace,
+				integration.BitbucketRepository,
+				integration.BitbucketUsername,
+				integration.BitbucketAppPassword,
+				integration.BaseBranch,
+			)
+		}
+	case "gitea":
+		if integration.GiteaURL != "" && integration.GiteaOwner != "" && integration.GiteaRepository != "" && integration.GiteaToken != "" {
+			provider = git.NewGiteaClient(
+				integration.GiteaURL,
+				integration.GiteaOwner,
+				integration.GiteaRepository,
+				integration.GiteaToken,
+				integration.BaseBranch,
+			)
+		}
 	}
 
 	if err == nil && provider != nil {
@@ -155,6 +339,29 @@ func (s *IntegrationsStore) Get(id string) *GitIntegration {
 	return s.maskSecrets(integration)
 }
 
+// GetRaw returns an integration by ID without masking (for internal use)
+func (s *IntegrationsStore) GetRaw(id string) *GitIntegration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	integration, exists := s.integrations[id]
+	if !exists {
+		return nil
+	}
+	return integration
+}
+
+// GetWebhookSecret returns the unmasked push webhook secret of an integration
+func (s *IntegrationsStore) GetWebhookSecret(id string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if integration, exists := s.integrations[id]; exists {
+		return integration.WebhookSecret
+	}
+	return ""
+}
+
 // GetProvider returns the git provider for an integration
 func (s *IntegrationsStore) GetProvider(id string) git.Provider {
 	s.mu.RLock()
@@ -175,7 +382,9 @@ func (s *IntegrationsStore) GetDefaultProvider() (git.Provider, *GitIntegration)
 
 	// Return first one if no default set
 	for id, integration := range s.integrations {
-		return s.providers[id], s.maskSecrets(integration)
+		if integration.Provider != "jira" {
+			return s.providers[id], s.maskSecrets(integration)
+		}
 	}
 
 	return nil, nil
@@ -189,8 +398,11 @@ func (s *IntegrationsStore) Create(integration *GitIntegration) error {
 	integration.CreatedAt = time.Now()
 	integration.UpdatedAt = time.Now()
 
-	// If this is the first or marked as default, clear other defaults
-	if integration.IsDefault || len(s.integrations) == 0 {
+	// If this is the first git integration or marked as default, clear other
+	// defaults. Jira integrations are never the default.
+	if integration.Provider == "jira" {
+		integration.IsDefault = false
+	} else if integration.IsDefault || !s.hasGitIntegration() {
 		integration.IsDefault = true
 		for _, existing := range s.integrations {
 			existing.IsDefault = false
@@ -203,6 +415,16 @@ func (s *IntegrationsStore) Create(integration *GitIntegration) error {
 	return s.save()
 }
 
+// hasGitIntegration reports whether a git integration is configured
+func (s *IntegrationsStore) hasGitIntegration() bool {
+	for _, integration := range s.integrations {
+		if integration.Provider != "jira" {
+			return true
+		}
+	}
+	return false
+}
+
 // Update modifies an existing integration
 func (s *IntegrationsStore) Update(id string, updates *GitIntegration) error {
 	s.mu.Lock()
@@ -220,12 +442,30 @@ func (s *IntegrationsStore) Update(id string, updates *GitIntegration) error {
 	if updates.GitLabToken == "********" || updates.GitLabToken == "" {
 		updates.GitLabToken = existing.GitLabToken
 	}
+	if updates.GitHubToken == "********" || updates.GitHubToken == "" {
+		updates.GitHubToken = existing.GitHubToken
+	}
+	if updates.BitbucketAppPassword == "********" || updates.BitbucketAppPassword == "" {
+		updates.BitbucketAppPassword = existing.BitbucketAppPassword
+	}
+	if updates.GiteaToken == "********" || updates.GiteaToken == "" {
+		updates.GiteaToken = existing.GiteaToken
+	}
+	if updates.JiraAPIToken == "********" || updates.JiraAPIToken == "" {
+		updates.JiraAPIToken = existing.JiraAPIToken
+	}
+	if updates.WebhookSecret == "********" || updates.WebhookSecret == "" {
+		updates.WebhookSecret = existing.WebhookSecret
+	}
 
 	updates.ID = id
 	updates.CreatedAt = existing.CreatedAt
 	updates.UpdatedAt = time.Now()
 
 	// Handle default flag
+	if updates.Provider == "jira" {
+		updates.IsDefault = false
+	}
 	if updates.IsDefault {
 		for _, other := range s.integrations {
 			if other.ID != id {
@@ -254,10 +494,12 @@ func (s *IntegrationsStore) Delete(id string) error {
 	delete(s.providers, id)
 
 	// If deleted was default, make another one default
-	if wasDefault && len(s.integrations) > 0 {
+	if wasDefault {
 		for _, integration := range s.integrations {
-			integration.IsDefault = true
-			break
+			if integration.Provider != "jira" {
+				integration.IsDefault = true
+				break
+			}
 		}
 	}
 
@@ -266,11 +508,10 @@ func (s *IntegrationsStore) Delete(id string) error {
 
 func (s *IntegrationsStore) maskSecrets(integration *GitIntegration) *GitIntegration {
 	masked := *integration
-	if masked.ADOPAT != "" {
-		masked.ADOPAT = "********"
-	}
-	if masked.GitLabToken != "" {
-		masked.GitLabToken = "********"
+	for _, secret := range integrationSecrets(&masked) {
+		if *secret != "" && !isSecretRef(*secret) {
+			*secret = "********"
+		}
 	}
 	return &masked
 }
@@ -290,9 +531,43 @@ type integrationConfigJSON struct {
 	GitLabProjectID string `json:"gitlabProjectId,omitempty"`
 	GitLabToken     string `json:"gitlabToken,omitempty"`
 
+	// GitHub-specific
+	GitHubURL        string `json:"githubUrl,omitempty"`
+	GitHubOwner      string `json:"githubOwner,omitempty"`
+	GitHubRepository string `json:"githubRepository,omitempty"`
+	GitHubToken      string `json:"githubToken,omitempty"`
+
+	// Bitbucket-specific
+	BitbucketURL         string `json:"bitbucketUrl,omitempty"`
+	BitbucketWorkspace   string `json:"bitbucketWorkspace,omitempty"`
+	BitbucketRepository  string `json:"bitbucketRepository,omitempty"`
+	BitbucketUsername    string `json:"bitbucketUsername,omitempty"`
+	BitbucketAppPassword string `json:"bitbucketAppPassword,omitempty"`
+
+	// Gitea-specific
+	GiteaURL        string `json:"giteaUrl,omitempty"`
+	GiteaOwner      string `json:"giteaOwner,omitempty"`
+	GiteaRepository string `json:"giteaRepository,omitempty"`
+	GiteaToken      string `json:"giteaToken,omitempty"`
+
+	// Jira-specific
+	JiraURL               string `json:"jiraUrl,omitempty"`
+	JiraEmail             string `json:"jiraEmail,omitempty"`
+	JiraAPIToken          string `json:"jiraApiToken,omitempty"`
+	JiraValidateIssues    bool   `json:"jiraValidateIssues,omitempty"`
+	JiraRolloutTransition string `json:"jiraRolloutTransition,omitempty"`
+	JiraArchiveTransition string `json:"jiraArchiveTransition,omitempty"`
+
 	// Common
 	BaseBranch string `json:"baseBranch,omitempty"`
 	FlagsPath  string `json:"flagsPath,omitempty"`
+
+	// PR templates
+	PRTitleTemplate       string `json:"prTitleTemplate,omitempty"`
+	PRDescriptionTemplate string `json:"prDescriptionTemplate,omitempty"`
+	BranchNameTemplate    string `json:"branchNameTemplate,omitempty"`
+
+	WebhookSecret string `json:"webhookSecret,omitempty"`
 }
 
 func dbIntegrationToGitIntegration(dbi db.DBIntegration) GitIntegration {
@@ -316,8 +591,31 @@ func dbIntegrationToGitIntegration(dbi db.DBIntegration) GitIntegration {
 			gi.GitLabURL = cfg.GitLabURL
 			gi.GitLabProjectID = cfg.GitLabProjectID
 			gi.GitLabToken = cfg.GitLabToken
+			gi.GitHubURL = cfg.GitHubURL
+			gi.GitHubOwner = cfg.GitHubOwner
+			gi.GitHubRepository = cfg.GitHubRepository
+			gi.GitHubToken = cfg.GitHubToken
+			gi.BitbucketURL = cfg.BitbucketURL
+			gi.BitbucketWorkspace = cfg.BitbucketWorkspace
+			gi.BitbucketRepository = cfg.BitbucketRepository
+			gi.BitbucketUsername = cfg.BitbucketUsername
+			gi.BitbucketAppPassword = cfg.BitbucketAppPassword
+			gi.GiteaURL = cfg.GiteaURL
+			gi.GiteaOwner = cfg.GiteaOwner
+			gi.GiteaRepository = cfg.GiteaRepository
+			gi.GiteaToken = cfg.GiteaToken
+			gi.JiraURL = cfg.JiraURL
+			gi.JiraEmail = cfg.JiraEmail
+			gi.JiraAPIToken = cfg.JiraAPIToken
+			gi.JiraValidateIssues = cfg.JiraValidateIssues
+			gi.JiraRolloutTransition = cfg.JiraRolloutTransition
+			gi.JiraArchiveTransition = cfg.JiraArchiveTransition
 			gi.BaseBranch = cfg.BaseBranch
 			gi.FlagsPath = cfg.FlagsPath
+			gi.PRTitleTemplate = cfg.PRTitleTemplate
+			gi.PRDescriptionTemplate = cfg.PRDescriptionTemplate
+			gi.BranchNameTemplate = cfg.BranchNameTemplate
+			gi.WebhookSecret = cfg.WebhookSecret
 		}
 	}
 
@@ -343,8 +641,33 @@ func gitIntegrationToDBIntegration(gi GitIntegration) db.DBIntegration {
 		GitLabURL:     gi.GitLabURL,
 		GitLabProjectID: gi.GitLabProjectID,
 		GitLabToken:   gi.GitLabToken,
+		GitHubURL:     gi.GitHubURL,
+		GitHubOwner:   gi.GitHubOwner,
+		GitHubRepository: gi.GitHubRepository,
+		GitHubToken:   gi.GitHubToken,
+		BitbucketURL:  gi.BitbucketURL,
+		BitbucketWorkspace: gi.BitbucketWorkspace,
+		BitbucketRepository: gi.BitbucketRepository,
+		BitbucketUsername: gi.BitbucketUsername,
+		BitbucketAppPassword: gi.BitbucketAppPassword,
+		GiteaURL:      gi.GiteaURL,
+		GiteaOwner:    gi.GiteaOwner,
+		GiteaRepository: gi.GiteaRepository,
+		GiteaToken:    gi.GiteaToken,
+		JiraURL:       gi.JiraURL,
+		JiraEmail:     gi.JiraEmail,
+		JiraAPIToken:  gi.JiraAPIToken,
+		JiraValidateIssues: gi.JiraValidateIssues,
+		JiraRolloutTransition: gi.JiraRolloutTransition,
+		JiraArchiveTransition: gi.JiraArchiveTransition,
 		BaseBranch:    gi.BaseBranch,
 		FlagsPath:     gi.FlagsPath,
+
+		PRTitleTemplate:       gi.PRTitleTemplate,
+		PRDescriptionTemplate: gi.PRDescriptionTemplate,
+		BranchNameTemplate:    gi.BranchNameTemplate,
+
+		WebhookSecret: gi.WebhookSecret,
 	}
 	configJSON, _ := json.Marshal(cfg)
 	dbi.Config = configJSON
@@ -352,24 +675,33 @@ func gitIntegrationToDBIntegration(gi GitIntegration) db.DBIntegration {
 	return dbi
 }
 
+// integrationSecrets returns the credentials of an integration.
+func integrationSecrets(gi *GitIntegration) []*string {
+	return []*string{&gi.ADOPAT, &gi.GitLabToken, &gi.GitHubToken, &gi.BitbucketAppPassword, &gi.GiteaToken, &gi.JiraAPIToken, &gi.WebhookSecret}
+}
+
 func maskIntegrationSecrets(gi *GitIntegration) *GitIntegration {
 	masked := *gi
-	if masked.ADOPAT != "" {
-		masked.ADOPAT = "********"
-	}
-	if masked.GitLabToken != "" {
-		masked.GitLabToken = "********"
+	for _, secret := range integrationSecrets(&masked) {
+		if *secret != "" && !isSecretRef(*secret) {
+			*secret = "********"
+		}
 	}
 	return &masked
 }
 
 // HTTP Handlers
 
+// IntegrationsResponse lists the git integrations.
+type IntegrationsResponse struct {
+	Integrations []*GitIntegration `json:"integrations"`
+}
+
 func (fm *FlagManager) listIntegrationsHandler(w http.ResponseWriter, r *http.Request) {
 	if fm.store != nil {
 		dbItems, err := fm.store.ListIntegrations(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 		integrations := make([]*GitIntegration, 0, len(dbItems))
@@ -378,18 +710,14 @@ func (fm *FlagManager) listIntegrationsHandler(w http.ResponseWriter, r *http.Re
 			integrations = append(integrations, maskIntegrationSecrets(&gi))
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"integrations": integrations,
-		})
+		json.NewEncoder(w).Encode(IntegrationsResponse{Integrations: integrations})
 		return
 	}
 
 	integrations := fm.integrations.List()
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"integrations": integrations,
-	})
+	json.NewEncoder(w).Encode(IntegrationsResponse{Integrations: integrations})
 }
 
 func (fm *FlagManager) getIntegrationHandler(w http.ResponseWriter, r *http.Request) {
@@ -400,9 +728,9 @@ func (fm *FlagManager) getIntegrationHandler(w http.ResponseWriter, r *http.Requ
 		dbi, err := fm.store.GetIntegration(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Integration not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -414,7 +742,7 @@ func (fm *FlagManager) getIntegrationHandler(w http.ResponseWriter, r *http.Requ
 
 	integration := fm.integrations.Get(id)
 	if integration == nil {
-		http.Error(w, "Integration not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
 		return
 	}
 
@@ -425,29 +753,41 @@ func (fm *FlagManager) getIntegrationHandler(w http.ResponseWriter, r *http.Requ
 func (fm *FlagManager) createIntegrationHandler(w http.ResponseWriter, r *http.Request) {
 	var integration GitIntegration
 	if err := json.NewDecoder(r.Body).Decode(&integration); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if integration.ID == "" {
-		http.Error(w, "Integration ID is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Integration ID is required")
 		return
 	}
 
-	if integration.Provider != "ado" && integration.Provider != "gitlab" {
-		http.Error(w, "Provider must be 'ado' or 'gitlab'", http.StatusBadRequest)
+	switch integration.Provider {
+	case "ado", "gitlab", "github", "bitbucket", "gitea":
+		if integration.BaseBranch == "" {
+			integration.BaseBranch = "main"
+		}
+	case "jira":
+		integration.IsDefault = false
+	default:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Provider must be 'ado', 'gitlab', 'github', 'bitbucket', 'gitea' or 'jira'")
 		return
 	}
 
-	if integration.BaseBranch == "" {
-		integration.BaseBranch = "main"
+	if errs := validatePRTemplates(&integration); len(errs) > 0 {
+		writeValidationError(w, "INVALID_PR_TEMPLATE", "Invalid PR template", errs...)
+		return
+	}
+	if errs := validateJiraIntegration(&integration, true); len(errs) > 0 {
+		writeValidationError(w, "INVALID_JIRA_INTEGRATION", "Invalid Jira integration", errs...)
+		return
 	}
 
 	if fm.store != nil {
 		dbi := gitIntegrationToDBIntegration(integration)
 		created, err := fm.store.CreateIntegration(r.Context(), dbi)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 		gi := dbIntegrationToGitIntegration(*created)
@@ -458,7 +798,7 @@ func (fm *FlagManager) createIntegrationHandler(w http.ResponseWriter, r *http.R
 	}
 
 	if err := fm.integrations.Create(&integration); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -473,18 +813,30 @@ func (fm *FlagManager) updateIntegrationHandler(w http.ResponseWriter, r *http.R
 
 	var integration GitIntegration
 	if err := json.NewDecoder(r.Body).Decode(&integration); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
+	if errs := validatePRTemplates(&integration); len(errs) > 0 {
+		writeValidationError(w, "INVALID_PR_TEMPLATE", "Invalid PR template", errs...)
+		return
+	}
+	if errs := validateJiraIntegration(&integration, false); len(errs) > 0 {
+		writeValidationError(w, "INVALID_JIRA_INTEGRATION", "Invalid Jira integration", errs...)
+		return
+	}
+	if integration.Provider == "jira" {
+		integration.IsDefault = false
+	}
+
 	if fm.store != nil {
 		// Preserve secrets if masked
 		existing, err := fm.store.GetIntegration(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Integration not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -495,11 +847,26 @@ func (fm *FlagManager) updateIntegrationHandler(w http.ResponseWriter, r *http.R
 		if integration.GitLabToken == "********" || integration.GitLabToken == "" {
 			integration.GitLabToken = existingGI.GitLabToken
 		}
+		if integration.GitHubToken == "********" || integration.GitHubToken == "" {
+			integration.GitHubToken = existingGI.GitHubToken
+		}
+		if integration.BitbucketAppPassword == "********" || integration.BitbucketAppPassword == "" {
+			integration.BitbucketAppPassword = existingGI.BitbucketAppPassword
+		}
+		if integration.GiteaToken == "********" || integration.GiteaToken == "" {
+			integration.GiteaToken = existingGI.GiteaToken
+		}
+		if integration.JiraAPIToken == "********" || integration.JiraAPIToken == "" {
+			integration.JiraAPIToken = existingGI.JiraAPIToken
+		}
+		if integration.WebhookSecret == "********" || integration.WebhookSecret == "" {
+			integration.WebhookSecret = existingGI.WebhookSecret
+		}
 
 		dbi := gitIntegrationToDBIntegration(integration)
 		updated, err := fm.store.UpdateIntegration(r.Context(), id, dbi)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 		gi := dbIntegrationToGitIntegration(*updated)
@@ -509,13 +876,13 @@ func (fm *FlagManager) updateIntegrationHandler(w http.ResponseWriter, r *http.R
 	}
 
 	if err := fm.integrations.Update(id, &integration); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	updated := fm.integrations.Get(id)
 	if updated == nil {
-		http.Error(w, "Integration not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
 		return
 	}
 
@@ -529,7 +896,7 @@ func (fm *FlagManager) deleteIntegrationHandler(w http.ResponseWriter, r *http.R
 
 	if fm.store != nil {
 		if err := fm.store.DeleteIntegration(r.Context(), id); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
 		w.WriteHeader(http.StatusNoContent)
@@ -537,7 +904,7 @@ func (fm *FlagManager) deleteIntegrationHandler(w http.ResponseWriter, r *http.R
 	}
 
 	if err := fm.integrations.Delete(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -553,14 +920,24 @@ func (fm *FlagManager) testIntegrationHandler(w http.ResponseWriter, r *http.Req
 		dbi, err := fm.store.GetIntegration(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Integration not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
 
-		gi := dbIntegrationToGitIntegration(*dbi)
+		dbGI := dbIntegrationToGitIntegration(*dbi)
+		gi, err := fm.resolveIntegration(r.Context(), &dbGI)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ConnectionTestResult{Success: false, Error: err.Error()})
+			return
+		}
+		if gi.Provider == "jira" {
+			fm.testJiraIntegration(w, gi)
+			return
+		}
 		var provider git.Provider
 
 		switch gi.Provider {
@@ -572,57 +949,77 @@ func (fm *FlagManager) testIntegrationHandler(w http.ResponseWriter, r *http.Req
 			if gi.GitLabURL != "" && gi.GitLabProjectID != "" && gi.GitLabToken != "" {
 				provider = git.NewGitLabClient(gi.GitLabURL, gi.GitLabProjectID, gi.GitLabToken, gi.BaseBranch)
 			}
+		case "github":
+			if gi.GitHubOwner != "" && gi.GitHubRepository != "" && gi.GitHubToken != "" {
+				provider = git.NewGitHubClient(gi.GitHubURL, gi.GitHubOwner, gi.GitHubRepository, gi.GitHubToken, gi.BaseBranch)
+			}
+		case "bitbucket":
+			if gi.BitbucketWorkspace != "" && gi.BitbucketRepository != "" && gi.BitbucketAppPassword != "" {
+				provider = git.NewBitbucketClient(gi.BitbucketURL, gi.BitbucketWorkspace, gi.BitbucketRepository,
+					gi.BitbucketUsername, gi.BitbucketAppPassword, gi.BaseBranch)
+			}
+		case "gitea":
+			if gi.GiteaURL != "" && gi.GiteaOwner != "" && gi.GiteaRepository != "" && gi.GiteaToken != "" {
+				provider = git.NewGiteaClient(gi.GiteaURL, gi.GiteaOwner, gi.GiteaRepository, gi.GiteaToken, gi.BaseBranch)
+			}
 		}
 
 		if provider == nil {
-			http.Error(w, "Integration not configured properly", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "INTEGRATION_NOT_CONFIGURED", "Integration not configured properly")
 			return
 		}
 
-		_, err = provider.GetFile(gi.FlagsPath)
+		err = fm.outbound.Do(func() error {
+			_, err := provider.GetFile(gi.FlagsPath)
+			return err
+		})
 		if err != nil {
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"success": false,
-				"error":   err.Error(),
-			})
+			json.NewEncoder(w).Encode(ConnectionTestResult{Success: false, Error: err.Error()})
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"message": "Successfully connected to repository",
-		})
+		json.NewEncoder(w).Encode(ConnectionTestResult{Success: true, Message: "Successfully connected to repository"})
 		return
 	}
 
-	provider := fm.integrations.GetProvider(id)
+	if gi := fm.integrations.GetRaw(id); gi != nil {
+		resolved, err := fm.resolveIntegration(r.Context(), gi)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ConnectionTestResult{Success: false, Error: err.Error()})
+			return
+		}
+		if resolved.Provider == "jira" {
+			fm.testJiraIntegration(w, resolved)
+			return
+		}
+	}
+
+	provider := fm.fileGitProvider(r.Context(), id)
 	if provider == nil {
-		http.Error(w, "Integration not found or not configured", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found or not configured")
 		return
 	}
 
 	integration := fm.integrations.Get(id)
 	if integration == nil {
-		http.Error(w, "Integration not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
 		return
 	}
 
 	// Try to fetch the flags file
-	_, err := provider.GetFile(integration.FlagsPath)
+	err := fm.outbound.Do(func() error {
+		_, err := provider.GetFile(integration.FlagsPath)
+		return err
+	})
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   err.Error(),
-		})
+		json.NewEncoder(w).Encode(ConnectionTestResult{Success: false, Error: err.Error()})
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Successfully connected to repository",
-	})
+	json.NewEncoder(w).Encode(ConnectionTestResult{Success: true, Message: "Successfully connected to repository"})
 }
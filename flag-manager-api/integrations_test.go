@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIntegrationsCRUD(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	var createdID string
+
+	t.Run("create integration", func(t *testing.T) {
+		integration := map[string]interface{}{
+			"id":         "test-gitlab-main",
+			"name":       "gitlab-main",
+			"provider":   "gitlab",
+			"enabled":    true,
+			"repository": "org/repo",
+			"baseBranch": "main",
+			"flagsPath":  "/flags",
+			"token":      "glpat-xxxx",
+		}
+
+		body, _ := json.Marshal(integration)
+		req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		createdID = response["id"].(string)
+	})
+
+	t.Run("list integrations", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/integrations", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("get integration", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/integrations/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("update integration", func(t *testing.T) {
+		integration := map[string]interface{}{
+			"id":         createdID,
+			"name":       "gitlab-main-updated",
+			"provider":   "gitlab",
+			"enabled":    false,
+			"repository": "org/repo-new",
+			"baseBranch": "develop",
+			"flagsPath":  "/flags-new",
+			"token":      "glpat-yyyy",
+		}
+
+		body, _ := json.Marshal(integration)
+		req := httptest.NewRequest("PUT", "/api/integrations/"+createdID, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("delete integration", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/integrations/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status 200 or 204, got %d", rr.Code)
+		}
+	})
+}
+
+func TestGitHubIntegration(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	// Fake GitHub REST API holding a main branch with a single commit
+	var mu sync.Mutex
+	var calls []string
+	var tree, commit, ref, pull map[string]interface{}
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+
+		if r.Header.Get("Authorization") != "Bearer ghp-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&body)
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/acme/flags/contents/flags.yaml":
+			if r.URL.Query().Get("ref") != "main" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("my-flag:\n  variations: {}\n"))
+		case "GET /repos/acme/flags/git/ref/heads/main":
+			json.NewEncoder(w).Encode(map[string]interface{}{"object": map[string]string{"sha": "base-sha"}})
+		case "GET /repos/acme/flags/git/commits/base-sha":
+			json.NewEncoder(w).Encode(map[string]interface{}{"tree": map[string]string{"sha": "base-tree"}})
+		case "POST /repos/acme/flags/git/trees":
+			tree = body
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"sha": "new-tree"})
+		case "POST /repos/acme/flags/git/commits":
+			commit = body
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"sha": "new-commit"})
+		case "POST /repos/acme/flags/git/refs":
+			ref = body
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"ref": body["ref"].(string)})
+		case "POST /repos/acme/flags/pulls":
+			pull = body
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"number": 7, "html_url": "https://github.com/acme/flags/pull/7"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer github.Close()
+
+	integration := map[string]interface{}{
+		"id":               "github-main",
+		"name":             "github-main",
+		"provider":         "github",
+		"githubUrl":        github.URL,
+		"githubOwner":      "acme",
+		"githubRepository": "flags",
+		"githubToken":      "ghp-test",
+		"baseBranch":       "main",
+		"flagsPath":        "/flags.yaml",
+	}
+	body, _ := json.Marshal(integration)
+	req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	t.Run("token is masked", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/integrations/github-main", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		if response["githubToken"] != "********" {
+			t.Errorf("Expected masked token, got %v", response["githubToken"])
+		}
+		if response["githubOwner"] != "acme" || response["githubRepository"] != "flags" {
+			t.Errorf("Unexpected repository: %v", response)
+		}
+	})
+
+	provider := fm.integrations.GetProvider("github-main")
+	if provider == nil {
+		t.Fatal("Expected a GitHub provider for the integration")
+	}
+
+	t.Run("get file", func(t *testing.T) {
+		content, err := provider.GetFile("/flags.yaml")
+		if err != nil {
+			t.Fatalf("GetFile failed: %v", err)
+		}
+		if !strings.Contains(string(content), "my-flag") {
+			t.Errorf("Unexpected content: %q", content)
+		}
+
+		content, err = provider.GetFile("/missing.yaml")
+		if err != nil || content != nil {
+			t.Errorf("Expected nil content for a missing file, got %q, %v", content, err)
+		}
+	})
+
+	t.Run("create PR", func(t *testing.T) {
+		url, err := provider.CreatePR("Update my-flag", "Details", "flag/my-flag", "main",
+			map[string][]byte{"/flags.yaml": []byte("my-flag: {}\n")})
+		if err != nil {
+			t.Fatalf("CreatePR failed: %v", err)
+		}
+		if url != "https://github.com/acme/flags/pull/7" {
+			t.Errorf("Unexpected PR URL %q", url)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if tree["base_tree"] != "base-tree" {
+			t.Errorf("Expected tree based on base-tree, got %v", tree["base_tree"])
+		}
+		entries, _ := tree["tree"].([]interface{})
+		if len(entries) != 1 || entries[0].(map[string]interface{})["path"] != "flags.yaml" {
+			t.Errorf("Unexpected tree entries: %v", tree["tree"])
+		}
+		if parents, _ := commit["parents"].([]interface{}); len(parents) != 1 || parents[0] != "base-sha" {
+			t.Errorf("Expected commit on base-sha, got %v", commit["parents"])
+		}
+		if ref["ref"] != "refs/heads/flag/my-flag" || ref["sha"] != "new-commit" {
+			t.Errorf("Unexpected branch ref: %v", ref)
+		}
+		if pull["head"] != "flag/my-flag" || pull["base"] != "main" || pull["title"] != "Update my-flag" {
+			t.Errorf("Unexpected pull request: %v", pull)
+		}
+	})
+
+	t.Run("rejects unknown provider", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]interface{}{"id": "svn", "name": "svn", "provider": "svn"})
+		req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestBitbucketServerIntegration(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	// Fake Bitbucket Server holding flags.yaml on a main branch
+	var mu sync.Mutex
+	var branch, pull map[string]interface{}
+	var edit map[string]string
+	bitbucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if user, pass, ok := r.BasicAuth(); !ok || user != "svc" || pass != "app-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		repo := "/rest/api/1.0/projects/FF/repos/flags"
+		switch {
+		case r.Method == "GET" && r.URL.Path == repo+"/raw/flags.yaml":
+			if r.URL.Query().Get("at") != "refs/heads/main" && branch == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte("checkout:\n  variations:\n    enabled: true\n    disabled: false\n  defaultRule:\n    variation: enabled\n"))
+		case r.Method == "GET" && r.URL.Path == repo+"/branches":
+			values := []map[string]string{}
+			if r.URL.Query().Get("filterText") == "main" {
+				values = append(values, map[string]string{"displayId": "main", "latestCommit": "main-sha"})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"values": values})
+		case r.Method == "POST" && r.URL.Path == repo+"/branches":
+			json.NewDecoder(r.Body).Decode(&branch)
+			json.NewEncoder(w).Encode(map[string]string{"displayId": branch["name"].(string)})
+		case r.Method == "PUT" && r.URL.Path == repo+"/browse/flags.yaml":
+			r.ParseMultipartForm(1 << 20)
+			edit = map[string]string{}
+			for name, values := range r.MultipartForm.Value {
+				edit[name] = values[0]
+			}
+			json.NewEncoder(w).Encode(map[string]string{"id": "edit-sha"})
+		case r.Method == "POST" && r.URL.Path == repo+"/pull-requests":
+			json.NewDecoder(r.Body).Decode(&pull)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":    3,
+				"links": map[string]interface{}{"self": []map[string]string{{"href": "https://bitbucket.example.com/projects/FF/repos/flags/pull-requests/3"}}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer bitbucket.Close()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":                   "bitbucket-main",
+		"name":                 "bitbucket-main",
+		"provider":             "bitbucket",
+		"bitbucketUrl":         bitbucket.URL,
+		"bitbucketWorkspace":   "FF",
+		"bitbucketRepository":  "flags",
+		"bitbucketUsername":    "svc",
+		"bitbucketAppPassword": "app-secret",
+		"baseBranch":           "main",
+		"flagsPath":            "/flags.yaml",
+	})
+	req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var created map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if created["bitbucketAppPassword"] != "********" {
+		t.Errorf("Expected masked app password, got %v", created["bitbucketAppPassword"])
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{
+		"action": "update",
+		"config": FlagConfig{
+			Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+			DefaultRule: &DefaultRule{Variation: "disabled"},
+		},
+	})
+	req = httptest.NewRequest("POST", "/api/projects/web/flags/checkout/propose", bytes.NewReader(body))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "pull-requests/3") {
+		t.Errorf("Expected PR URL in response, got %s", rr.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if branch == nil || branch["startPoint"] != "main-sha" {
+		t.Fatalf("Expected branch created from main-sha, got %v", branch)
+	}
+	if edit["branch"] != branch["name"] || edit["sourceCommitId"] != "main-sha" {
+		t.Errorf("Unexpected file edit: %v", edit)
+	}
+	if !strings.Contains(edit["content"], "variation: disabled") {
+		t.Errorf("Expected updated flags file, got %q", edit["content"])
+	}
+	fromRef, _ := pull["fromRef"].(map[string]interface{})
+	toRef, _ := pull["toRef"].(map[string]interface{})
+	if fromRef["id"] != "refs/heads/"+branch["name"].(string) || toRef["id"] != "refs/heads/main" {
+		t.Errorf("Unexpected pull request refs: %v", pull)
+	}
+}
+
+func TestGiteaIntegration(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	// Fake Gitea API holding flags.yaml on a main branch
+	var mu sync.Mutex
+	var branch, commit, pull map[string]interface{}
+	gitea := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Header.Get("Authorization") != "token gitea-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		repo := "/api/v1/repos/platform/flags"
+		switch r.Method + " " + r.URL.Path {
+		case "GET " + repo + "/raw/flags.yaml":
+			w.Write([]byte("checkout:\n  variations:\n    enabled: true\n    disabled: false\n  defaultRule:\n    variation: enabled\n"))
+		case "POST " + repo + "/branches":
+			json.NewDecoder(r.Body).Decode(&branch)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": branch["new_branch_name"]})
+		case "GET " + repo + "/contents/flags.yaml":
+			json.NewEncoder(w).Encode(map[string]string{"path": "flags.yaml", "sha": "blob-sha"})
+		case "POST " + repo + "/contents":
+			json.NewDecoder(r.Body).Decode(&commit)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"commit": map[string]string{"sha": "commit-sha"}})
+		case "POST " + repo + "/pulls":
+			json.NewDecoder(r.Body).Decode(&pull)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"number": 5, "html_url": "https://gitea.example.com/platform/flags/pulls/5"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer gitea.Close()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":              "gitea-main",
+		"name":            "gitea-main",
+		"provider":        "gitea",
+		"giteaUrl":        gitea.URL,
+		"giteaOwner":      "platform",
+		"giteaRepository": "flags",
+		"giteaToken":      "gitea-secret",
+		"baseBranch":      "main",
+		"flagsPath":       "/flags.yaml",
+	})
+	req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var created map[string]interface{}
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if created["giteaToken"] != "********" {
+		t.Errorf("Expected masked token, got %v", created["giteaToken"])
+	}
+
+	body, _ = json.Marshal(map[string]interface{}{
+		"action": "update",
+		"config": FlagConfig{
+			Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+			DefaultRule: &DefaultRule{Variation: "disabled"},
+		},
+	})
+	req = httptest.NewRequest("POST", "/api/projects/web/flags/checkout/propose", bytes.NewReader(body))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "pulls/5") {
+		t.Errorf("Expected PR URL in response, got %s", rr.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if branch == nil || branch["old_branch_name"] != "main" {
+		t.Fatalf("Expected branch created from main, got %v", branch)
+	}
+	files, _ := commit["files"].([]interface{})
+	if commit["branch"] != branch["new_branch_name"] || len(files) != 1 {
+		t.Fatalf("Unexpected commit: %v", commit)
+	}
+	file := files[0].(map[string]interface{})
+	if file["operation"] != "update" || file["sha"] != "blob-sha" || file["path"] != "flags.yaml" {
+		t.Errorf("Expected update of flags.yaml from blob-sha, got %v", file)
+	}
+	content, _ := base64.StdEncoding.DecodeString(file["content"].(string))
+	if !strings.Contains(string(content), "variation: disabled") {
+		t.Errorf("Expected updated flags file, got %q", content)
+	}
+	if pull["head"] != branch["new_branch_name"] || pull["base"] != "main" {
+		t.Errorf("Unexpected pull request: %v", pull)
+	}
+}
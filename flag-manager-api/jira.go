@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"flag-manager-api/httpclient"
+)
+
+// jiraIssueMetadataKey is the flag metadata key linking a flag to a Jira
+// issue, e.g. "OPS-123".
+const jiraIssueMetadataKey = "jiraIssue"
+
+var jiraIssueKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-[0-9]+$`)
+
+var errJiraIssueNotFound = errors.New("Jira issue not found")
+
+// jiraIssueOf returns the Jira issue a flag's metadata links to, if any.
+func jiraIssueOf(config *FlagConfig) string {
+	if config == nil {
+		return ""
+	}
+	issue, _ := config.Metadata[jiraIssueMetadataKey].(string)
+	return strings.TrimSpace(issue)
+}
+
+// validateJiraIntegration checks the settings of a Jira integration. Updates
+// may leave the API token empty to keep the current one.
+func validateJiraIntegration(gi *GitIntegration, requireToken bool) []string {
+	if gi.Provider != "jira" {
+		return nil
+	}
+	var errs []string
+	if u, err := url.Parse(gi.JiraURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, "jiraUrl must be an http(s) URL")
+	}
+	if requireToken && gi.JiraAPIToken == "" {
+		errs = append(errs, "jiraApiToken is required")
+	}
+	return errs
+}
+
+// JiraClient calls the Jira REST API v2, which Jira Cloud, Server and Data
+// Center all serve.
+type JiraClient struct {
+	BaseURL    string
+	Email      string // empty to send the token as a bearer token (personal access token)
+	Token      string
+	httpClient *http.Client
+}
+
+// NewJiraClient creates a client for a Jira integration.
+func NewJiraClient(gi *GitIntegration) *JiraClient {
+	return &JiraClient{
+		BaseURL:    strings.TrimSuffix(gi.JiraURL, "/"),
+		Email:      gi.JiraEmail,
+		Token:      gi.JiraAPIToken,
+		httpClient: httpclient.WithTimeout(30 * time.Second),
+	}
+}
+
+// JiraIssue is the part of a Jira issue the manager reads.
+type JiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary string `json:"summary"`
+		Status  struct {
+			Name string `json:"name"`
+		} `json:"status"`
+	} `json:"fields"`
+}
+
+// do sends a request with an optional JSON payload and decodes a successful
+// JSON response into result. A missing issue is returned as
+// errJiraIssueNotFound.
+func (c *JiraClient) do(method, path string, payload, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+"/rest/api/2"+path, body)
+	if err != nil {
+		return err
+	}
+	if c.Email != "" {
+		req.SetBasicAuth(c.Email, c.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/issue/") {
+		return errJiraIssueNotFound
+	}
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Jira API error %d: %s", resp.StatusCode, string(respBody))
+	}
+	if result != nil && resp.StatusCode != http.StatusNoContent {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// CurrentUser checks the credentials and returns the display name they
+// belong to.
+func (c *JiraClient) CurrentUser() (string, error) {
+	var user struct {
+		DisplayName string `json:"displayName"`
+	}
+	if err := c.do("GET", "/myself", nil, &user); err != nil {
+		return "", err
+	}
+	return user.DisplayName, nil
+}
+
+// GetIssue returns an issue, or errJiraIssueNotFound.
+func (c *JiraClient) GetIssue(key string) (*JiraIssue, error) {
+	var issue JiraIssue
+	if err := c.do("GET", "/issue/"+url.PathEscape(key)+"?fields=summary,status", nil, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+// AddComment posts a plain text comment on an issue.
+func (c *JiraClient) AddComment(key, text string) error {
+	return c.do("POST", "/issue/"+url.PathEscape(key)+"/comment", map[string]string{"body": text}, nil)
+}
+
+// TransitionIssue moves an issue through the transition with the given name,
+// or the transition to the status with that name. Issues already in that
+// status are left alone.
+func (c *JiraClient) TransitionIssue(key, name string) error {
+	issue, err := c.GetIssue(key)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(issue.Fields.Status.Name, name) {
+		return nil
+	}
+
+	var available struct {
+		Transitions []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			To   struct {
+				Name string `json:"name"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := c.do("GET", "/issue/"+url.PathEscape(key)+"/transitions", nil, &available); err != nil {
+		return err
+	}
+	for _, t := range available.Transitions {
+		if strings.EqualFold(t.Name, name) || strings.EqualFold(t.To.Name, name) {
+			return c.do("POST", "/issue/"+url.PathEscape(key)+"/transitions",
+				map[string]interface{}{"transition": map[string]string{"id": t.ID}}, nil)
+		}
+	}
+	return fmt.Errorf("issue %s has no transition %q from status %s", key, name, issue.Fields.Status.Name)
+}
+
+// jiraIntegrations returns the configured Jira integrations, with the secret
+// references of their tokens resolved.
+func (fm *FlagManager) jiraIntegrations(ctx context.Context) ([]GitIntegration, error) {
+	var integrations []GitIntegration
+	if fm.store != nil {
+		dbItems, err := fm.store.ListIntegrations(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, dbi := range dbItems {
+			if dbi.Provider == "jira" {
+				integrations = append(integrations, dbIntegrationToGitIntegration(dbi))
+			}
+		}
+	} else if fm.integrations != nil {
+		for _, gi := range fm.integrations.List() {
+			if gi.Provider == "jira" {
+				integrations = append(integrations, *fm.integrations.GetRaw(gi.ID))
+			}
+		}
+	}
+	for i := range integrations {
+		if err := fm.secretRefs.resolveFields(ctx, integrationSecrets(&integrations[i])); err != nil {
+			slog.WarnContext(ctx, "Failed to resolve Jira integration secrets", "integration", integrations[i].Name, "error", err)
+		}
+	}
+	return integrations, nil
+}
+
+// validateJiraIssue checks that the Jira issue a flag links to exists, for
+// the Jira integrations that validate issues. Only a changed link is checked;
+// when Jira cannot be reached the flag is saved anyway.
+func (fm *FlagManager) validateJiraIssue(ctx context.Context, config, existing *FlagConfig) ([]string, error) {
+	issue := jiraIssueOf(config)
+	if issue == "" || issue == jiraIssueOf(existing) {
+		return nil, nil
+	}
+	integrations, err := fm.jiraIntegrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range integrations {
+		gi := &integrations[i]
+		if !gi.JiraValidateIssues {
+			continue
+		}
+		if !jiraIssueKeyPattern.MatchString(issue) {
+			return []string{fmt.Sprintf("%s must be a Jira issue key such as OPS-123", jiraIssueMetadataKey)}, nil
+		}
+		err := fm.outbound.Do(func() error {
+			_, err := NewJiraClient(gi).GetIssue(issue)
+			return err
+		})
+		if errors.Is(err, errJiraIssueNotFound) {
+			return []string{fmt.Sprintf("Jira issue %s does not exist in %s", issue, gi.Name)}, nil
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to validate Jira issue", "integration", gi.Name, "issue", issue, "error", err)
+		}
+	}
+	return nil, nil
+}
+
+// flagFullyRolledOut reports whether an enabled flag serves one variation to
+// everyone: no targeting rules and a default rule without a split or a
+// progressive rollout. A boolean flag must serve true.
+func flagFullyRolledOut(config FlagConfig) bool {
+	if flagDisabled(config) || config.DefaultRule == nil || config.DefaultRule.ProgressiveRollout != nil {
+		return false
+	}
+	for _, rule := range config.Targeting {
+		if rule.Disable == nil || !*rule.Disable {
+			return false
+		}
+	}
+
+	variation := config.DefaultRule.Variation
+	for name, percentage := range config.DefaultRule.Percentage {
+		switch {
+		case percentage >= 100:
+			variation = name
+		case percentage > 0:
+			return false
+		}
+	}
+	value, ok := config.Variations[variation]
+	if !ok {
+		return false
+	}
+	if b, isBool := value.(bool); isBool {
+		return b
+	}
+	return true
+}
+
+// jiraFlagState describes a flag's state in Jira comments.
+func jiraFlagState(config *FlagConfig) string {
+	switch {
+	case config == nil:
+		return "deleted"
+	case isArchived(*config):
+		return "archived"
+	case flagDisabled(*config):
+		return "disabled"
+	case flagFullyRolledOut(*config):
+		return "fully rolled out"
+	default:
+		return "enabled"
+	}
+}
+
+// syncJiraIssue comments on the Jira issue a flag links to when the flag is
+// created, deleted or changes state, and transitions the issue when the flag
+// is fully rolled out, archived or deleted. before is nil for a created
+// flag and after for a deleted one. Delivery is asynchronous and never fails
+// the request.
+func (fm *FlagManager) syncJiraIssue(r *http.Request, project, flagKey string, before, after *FlagConfig) {
+	issue := jiraIssueOf(after)
+	if after == nil {
+		issue = jiraIssueOf(before)
+	}
+	if issue == "" {
+		return
+	}
+
+	state := jiraFlagState(after)
+	event := state
+	switch {
+	case before == nil:
+		event = "created"
+	case after != nil && jiraIssueOf(before) != issue:
+		event = "linked to this issue"
+	case jiraFlagState(before) == state:
+		return
+	}
+
+	integrations, err := fm.jiraIntegrations(r.Context())
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to load Jira integrations", "error", err)
+		return
+	}
+	if len(integrations) == 0 {
+		return
+	}
+
+	actor := GetActor(r)
+	comment := fmt.Sprintf("Feature flag %s in project %s was %s by %s.", flagKey, project, event, actorDisplayName(actor))
+	if event != state {
+		comment = fmt.Sprintf("Feature flag %s in project %s was %s by %s and is %s.", flagKey, project, event, actorDisplayName(actor), state)
+	}
+
+	for _, gi := range integrations {
+		transition := ""
+		switch state {
+		case "fully rolled out":
+			transition = gi.JiraRolloutTransition
+		case "archived", "deleted":
+			transition = gi.JiraArchiveTransition
+		}
+		go func(gi GitIntegration) {
+			client := NewJiraClient(&gi)
+			if err := fm.outbound.Do(func() error { return client.AddComment(issue, comment) }); err != nil {
+				slog.Warn("Failed to comment on Jira issue", "integration", gi.Name, "issue", issue, "error", err)
+			}
+			if transition == "" {
+				return
+			}
+			if err := fm.outbound.Do(func() error { return client.TransitionIssue(issue, transition) }); err != nil {
+				slog.Warn("Failed to transition Jira issue", "integration", gi.Name, "issue", issue, "transition", transition, "error", err)
+			}
+		}(gi)
+	}
+}
+
+// testJiraIntegration checks that a Jira integration's credentials work.
+func (fm *FlagManager) testJiraIntegration(w http.ResponseWriter, gi *GitIntegration) {
+	var user string
+	err := fm.outbound.Do(func() error {
+		var err error
+		user, err = NewJiraClient(gi).CurrentUser()
+		return err
+	})
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		json.NewEncoder(w).Encode(ConnectionTestResult{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(ConnectionTestResult{Success: true, Message: "Successfully connected to Jira as " + user})
+}
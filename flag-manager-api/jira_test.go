@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJiraIntegration(t *testing.T) {
+	type received struct {
+		method, path, auth string
+		body               map[string]interface{}
+	}
+	requests := make(chan received, 20)
+	jira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, _ := r.BasicAuth()
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.URL.Path == "/rest/api/2/myself":
+			json.NewEncoder(w).Encode(map[string]string{"displayName": "GOFF Bot"})
+			return
+		case !strings.HasPrefix(r.URL.Path, "/rest/api/2/issue/OPS-1"):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case r.Method == "GET" && r.URL.Path == "/rest/api/2/issue/OPS-1":
+			json.NewEncoder(w).Encode(map[string]interface{}{"key": "OPS-1", "fields": map[string]interface{}{"status": map[string]string{"name": "In Progress"}}})
+			return
+		}
+		requests <- received{method: r.Method, path: r.URL.Path, auth: user + ":" + token, body: body}
+		switch r.URL.Path {
+		case "/rest/api/2/issue/OPS-1/transitions":
+			if r.Method == "GET" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"transitions": []map[string]interface{}{
+					{"id": "21", "name": "Ship it", "to": map[string]string{"name": "Released"}},
+					{"id": "31", "name": "Close", "to": map[string]string{"name": "Done"}},
+				}})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer jira.Close()
+
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+	next := func(t *testing.T, method, path string) received {
+		t.Helper()
+		select {
+		case req := <-requests:
+			if req.method != method || req.path != path {
+				t.Fatalf("Expected %s %s, got %s %s: %v", method, path, req.method, req.path, req.body)
+			}
+			return req
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s %s", method, path)
+		}
+		return received{}
+	}
+
+	doRequest(t, router, "POST", "/api/integrations", `{"id":"jira","name":"Jira","provider":"jira","jiraUrl":"jira.example.com","jiraApiToken":"t0ken"}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/integrations", `{"id":"jira","name":"Jira","provider":"jira","jiraUrl":"`+jira.URL+`"}`, http.StatusBadRequest, nil)
+
+	var created GitIntegration
+	doRequest(t, router, "POST", "/api/integrations", `{"id":"jira","name":"Jira","provider":"jira","isDefault":true,"jiraUrl":"`+jira.URL+`/","jiraEmail":"bot@example.com","jiraApiToken":"t0ken",`+
+		`"jiraValidateIssues":true,"jiraRolloutTransition":"Released","jiraArchiveTransition":"Close"}`, http.StatusCreated, &created)
+	if created.JiraAPIToken != "********" || created.IsDefault {
+		t.Fatalf("Expected a masked token and a non-default integration, got %+v", created)
+	}
+	if provider, gi := fm.integrations.GetDefaultProvider(); provider != nil || gi != nil {
+		t.Fatalf("Expected a Jira integration not to be the default git integration, got %+v", gi)
+	}
+	var result ConnectionTestResult
+	doRequest(t, router, "POST", "/api/integrations/jira/test", "", http.StatusOK, &result)
+	if !result.Success || result.Message != "Successfully connected to Jira as GOFF Bot" {
+		t.Fatalf("Unexpected connection test result: %+v", result)
+	}
+
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"metadata":{"jiraIssue":"OPS-404"}}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"metadata":{"jiraIssue":"not an issue"}}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"metadata":{"jiraIssue":"OPS-1"}}`, http.StatusCreated, nil)
+	req := next(t, "POST", "/rest/api/2/issue/OPS-1/comment")
+	if req.auth != "bot@example.com:t0ken" || !strings.Contains(req.body["body"].(string), "checkout in project web was created") {
+		t.Fatalf("Unexpected comment with %q: %v", req.auth, req.body)
+	}
+
+	// Changes that keep the flag's state are not commented on
+	doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"metadata":{"jiraIssue":"OPS-1","owner":"web"}}}`, http.StatusOK, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"disable":true,"metadata":{"jiraIssue":"OPS-1"}}}`, http.StatusOK, nil)
+	if req := next(t, "POST", "/rest/api/2/issue/OPS-1/comment"); !strings.Contains(req.body["body"].(string), "was disabled") {
+		t.Fatalf("Unexpected comment: %v", req.body)
+	}
+
+	doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"percentage":{"on":100,"off":0}},"metadata":{"jiraIssue":"OPS-1"}}}`, http.StatusOK, nil)
+	if req := next(t, "POST", "/rest/api/2/issue/OPS-1/comment"); !strings.Contains(req.body["body"].(string), "was fully rolled out") {
+		t.Fatalf("Unexpected comment: %v", req.body)
+	}
+	next(t, "GET", "/rest/api/2/issue/OPS-1/transitions")
+	if req := next(t, "POST", "/rest/api/2/issue/OPS-1/transitions"); !reflect.DeepEqual(req.body, map[string]interface{}{"transition": map[string]interface{}{"id": "21"}}) {
+		t.Fatalf("Expected the Released transition, got %v", req.body)
+	}
+
+	doRequest(t, router, "DELETE", "/api/projects/web/flags/checkout", "", http.StatusNoContent, nil)
+	if req := next(t, "POST", "/rest/api/2/issue/OPS-1/comment"); !strings.Contains(req.body["body"].(string), "was archived") {
+		t.Fatalf("Unexpected comment: %v", req.body)
+	}
+	next(t, "GET", "/rest/api/2/issue/OPS-1/transitions")
+	if req := next(t, "POST", "/rest/api/2/issue/OPS-1/transitions"); !reflect.DeepEqual(req.body, map[string]interface{}{"transition": map[string]interface{}{"id": "31"}}) {
+		t.Fatalf("Expected the Close transition, got %v", req.body)
+	}
+
+	for config, want := range map[string]bool{
+		`{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}`:                                                          true,
+		`{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`:                                                         false,
+		`{"variations":{"a":"x","b":"y"},"defaultRule":{"variation":"b"}}`:                                                                 true,
+		`{"variations":{"on":true,"off":false},"defaultRule":{"percentage":{"on":50,"off":50}}}`:                                           false,
+		`{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"},"targeting":[{"query":"beta eq true","variation":"off"}]}`: false,
+	} {
+		var c FlagConfig
+		json.Unmarshal([]byte(config), &c)
+		if got := flagFullyRolledOut(c); got != want {
+			t.Errorf("flagFullyRolledOut(%s) = %v, want %v", config, got, want)
+		}
+	}
+
+	gi := GitIntegration{ID: "jira", Provider: "jira", JiraURL: "https://example.atlassian.net", JiraEmail: "bot@example.com", JiraAPIToken: "t",
+		JiraValidateIssues: true, JiraRolloutTransition: "Released", JiraArchiveTransition: "Done"}
+	if got := dbIntegrationToGitIntegration(gitIntegrationToDBIntegration(gi)); !reflect.DeepEqual(got, gi) {
+		t.Fatalf("Expected Jira settings to survive the database config, got %+v", got)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeFieldManager owns the ConfigMap keys written with server-side apply.
+const kubeFieldManager = "goff-manager"
+
+// newInClusterKubeClient configures a client from the environment and the
+// service account Kubernetes gives pods. Its token is re-read as it is
+// rotated.
+func newInClusterKubeClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster: %w", err)
+	}
+	config.UserAgent = kubeFieldManager
+	return kubernetes.NewForConfig(config)
+}
+
+// inClusterNamespace returns the namespace the pod runs in, or "".
+func inClusterNamespace() string {
+	data, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// applyConfigMapKey sets a key of a ConfigMap with server-side apply,
+// creating the ConfigMap if needed. Its other keys are left alone.
+func applyConfigMapKey(ctx context.Context, client kubernetes.Interface, namespace, name, key, value string) error {
+	cm := corev1apply.ConfigMap(name, namespace).WithData(map[string]string{key: value})
+	_, err := client.CoreV1().ConfigMaps(namespace).Apply(ctx, cm, metav1.ApplyOptions{FieldManager: kubeFieldManager, Force: true})
+	return err
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLaunchDarklyEnvironment is the LaunchDarkly environment converted
+// when ?environment= is not given.
+const defaultLaunchDarklyEnvironment = "production"
+
+// LaunchDarklyExport is a LaunchDarkly flag export, as returned by its
+// "list feature flags" API with environment data. A bare array of flags is
+// accepted too.
+type LaunchDarklyExport struct {
+	Items []LaunchDarklyFlag `json:"items"`
+}
+
+// LaunchDarklyFlag is a single flag of a LaunchDarkly export.
+type LaunchDarklyFlag struct {
+	Key          string                             `json:"key"`
+	Name         string                             `json:"name,omitempty"`
+	Description  string                             `json:"description,omitempty"`
+	Kind         string                             `json:"kind,omitempty"`
+	Tags         []string                           `json:"tags,omitempty"`
+	Temporary    bool                               `json:"temporary,omitempty"`
+	Variations   []LaunchDarklyVariation            `json:"variations"`
+	Defaults     *LaunchDarklyDefaults              `json:"defaults,omitempty"`
+	Environments map[string]LaunchDarklyEnvironment `json:"environments,omitempty"`
+}
+
+// LaunchDarklyVariation is one of the values a LaunchDarkly flag can serve.
+type LaunchDarklyVariation struct {
+	Name  string      `json:"name,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// LaunchDarklyDefaults are the variations a LaunchDarkly flag serves in new
+// environments.
+type LaunchDarklyDefaults struct {
+	OnVariation  int `json:"onVariation"`
+	OffVariation int `json:"offVariation"`
+}
+
+// LaunchDarklyEnvironment is the configuration of a flag in one LaunchDarkly
+// environment.
+type LaunchDarklyEnvironment struct {
+	On             bool                       `json:"on"`
+	OffVariation   *int                       `json:"offVariation,omitempty"`
+	Fallthrough    LaunchDarklyServe          `json:"fallthrough"`
+	Targets        []LaunchDarklyTarget       `json:"targets,omitempty"`
+	ContextTargets []LaunchDarklyTarget       `json:"contextTargets,omitempty"`
+	Rules          []LaunchDarklyRule         `json:"rules,omitempty"`
+	Prerequisites  []LaunchDarklyPrerequisite `json:"prerequisites,omitempty"`
+	TrackEvents    bool                       `json:"trackEvents,omitempty"`
+}
+
+// LaunchDarklyServe is what a rule or the fallthrough serves: a single
+// variation or a percentage rollout.
+type LaunchDarklyServe struct {
+	Variation *int                 `json:"variation,omitempty"`
+	Rollout   *LaunchDarklyRollout `json:"rollout,omitempty"`
+}
+
+// LaunchDarklyRollout splits contexts between variations. Weights are in
+// thousandths of a percent.
+type LaunchDarklyRollout struct {
+	Variations []LaunchDarklyWeightedVariation `json:"variations"`
+	BucketBy   string                          `json:"bucketBy,omitempty"`
+}
+
+// LaunchDarklyWeightedVariation is one share of a LaunchDarkly rollout.
+type LaunchDarklyWeightedVariation struct {
+	Variation int `json:"variation"`
+	Weight    int `json:"weight"`
+}
+
+// LaunchDarklyTarget serves a variation to individually targeted context keys.
+type LaunchDarklyTarget struct {
+	Values      []string `json:"values"`
+	Variation   int      `json:"variation"`
+	ContextKind string   `json:"contextKind,omitempty"`
+}
+
+// LaunchDarklyRule is a custom targeting rule: all clauses must match.
+type LaunchDarklyRule struct {
+	LaunchDarklyServe
+	Description string               `json:"description,omitempty"`
+	Clauses     []LaunchDarklyClause `json:"clauses"`
+}
+
+// LaunchDarklyClause is a single condition of a LaunchDarkly rule.
+type LaunchDarklyClause struct {
+	Attribute   string        `json:"attribute"`
+	Op          string        `json:"op"`
+	Values      []interface{} `json:"values"`
+	Negate      bool          `json:"negate,omitempty"`
+	ContextKind string        `json:"contextKind,omitempty"`
+}
+
+// LaunchDarklyPrerequisite requires another flag to serve a variation.
+type LaunchDarklyPrerequisite struct {
+	Key       string `json:"key"`
+	Variation int    `json:"variation"`
+}
+
+// LaunchDarklyImportResponse is the response of a LaunchDarkly import. Unmapped
+// lists, per imported flag, the LaunchDarkly features that have no GO Feature
+// Flag equivalent and were dropped.
+type LaunchDarklyImportResponse struct {
+	ImportResponse
+	Environment string              `json:"environment"`
+	Unmapped    map[string][]string `json:"unmapped"`
+}
+
+// launchDarklyOperators maps LaunchDarkly clause operators to GO Feature Flag
+// query operators. "in" is handled separately.
+var launchDarklyOperators = map[string]string{
+	"startsWith":         "sw",
+	"endsWith":           "ew",
+	"contains":           "co",
+	"lessThan":           "lt",
+	"lessThanOrEqual":    "le",
+	"greaterThan":        "gt",
+	"greaterThanOrEqual": "ge",
+}
+
+// importLaunchDarklyFlags handles POST /api/flags/import?source=launchdarkly:
+// it converts the flags of a LaunchDarkly export, as configured in one
+// environment (?environment=, production by default), and creates them in
+// ?project=. Like the manifest import it is idempotent: existing flags are
+// skipped.
+func (fm *FlagManager) importLaunchDarklyFlags(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	project := query.Get("project")
+	if project == "" {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "project is required")
+		return
+	}
+	if err := ValidateProjectName(project); err != nil {
+		writeValidationError(w, "INVALID_PROJECT_NAME", err.Error())
+		return
+	}
+	if !fm.authorizeProject(w, r, "flag", "write", project) {
+		return
+	}
+	environment := query.Get("environment")
+	if environment == "" {
+		environment = defaultLaunchDarklyEnvironment
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	flags, err := decodeLaunchDarklyExport(body)
+	if err != nil {
+		writeValidationError(w, "INVALID_LAUNCHDARKLY_EXPORT", "Invalid LaunchDarkly export: "+err.Error())
+		return
+	}
+	if len(flags) == 0 {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "at least one flag is required")
+		return
+	}
+
+	resp := LaunchDarklyImportResponse{
+		ImportResponse: ImportResponse{Errors: []string{}},
+		Environment:    environment,
+		Unmapped:       map[string][]string{},
+	}
+	actor := GetActor(r)
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	for _, ld := range flags {
+		if err := ValidateFlagKey(ld.Key); err != nil {
+			resp.Errors = append(resp.Errors, ld.Key+": "+err.Error())
+			continue
+		}
+		config, unmapped, err := convertLaunchDarklyFlag(ld, environment)
+		if err != nil {
+			resp.Errors = append(resp.Errors, ld.Key+": "+err.Error())
+			continue
+		}
+		config.Metadata["importedAt"] = now
+		if errs := ValidateFlagConfig(config); len(errs) > 0 {
+			resp.Errors = append(resp.Errors, ld.Key+": "+strings.Join(errs, "; "))
+			continue
+		}
+
+		flag, err := fm.storage.CreateFlag(r.Context(), project, ld.Key, config)
+		if errors.Is(err, errFlagExists) {
+			resp.Skipped++
+			continue
+		}
+		if err != nil {
+			resp.Errors = append(resp.Errors, ld.Key+": "+err.Error())
+			continue
+		}
+
+		fm.audit.Log(r.Context(), actor, "flag.imported", "flag", flag.ID, ld.Key, project,
+			map[string]interface{}{"after": config},
+			map[string]interface{}{"source": "launchdarkly", "environment": environment})
+
+		if len(unmapped) > 0 {
+			resp.Unmapped[ld.Key] = unmapped
+		}
+		resp.Created++
+	}
+
+	if resp.Created > 0 {
+		fm.scheduleRelayRefresh(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Created > 0 {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// decodeLaunchDarklyExport reads the flags of a LaunchDarkly export, given
+// either as {"items": [...]} or as a bare array.
+func decodeLaunchDarklyExport(data []byte) ([]LaunchDarklyFlag, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var flags []LaunchDarklyFlag
+		if err := json.Unmarshal(data, &flags); err != nil {
+			return nil, err
+		}
+		return flags, nil
+	}
+	var export LaunchDarklyExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	return export.Items, nil
+}
+
+// convertLaunchDarklyFlag converts a LaunchDarkly flag, as configured in
+// environment, to a flag config on a best-effort basis.
+//
+// Variations keep their LaunchDarkly names (variation_<n> when unnamed or
+// ambiguous). Individual targets become "key in [...]" rules ahead of the
+// custom rules, whose clauses are translated to a targeting query when their
+// operators have an equivalent. The fallthrough becomes the default rule and
+// rollouts become percentage splits. A flag that is off is disabled. Anything
+// else (prerequisites, segment and regex clauses, non-user contexts, the off
+// variation) is dropped and returned as unmapped.
+func convertLaunchDarklyFlag(ld LaunchDarklyFlag, environment string) (FlagConfig, []string, error) {
+	if len(ld.Variations) == 0 {
+		return FlagConfig{}, nil, fmt.Errorf("flag has no variations")
+	}
+
+	names := launchDarklyVariationNames(ld.Variations)
+	config := FlagConfig{
+		Variations: make(map[string]interface{}, len(ld.Variations)),
+		Metadata:   map[string]interface{}{"importedFrom": "launchdarkly"},
+	}
+	for i, v := range ld.Variations {
+		config.Variations[names[i]] = v.Value
+	}
+	if ld.Name != "" && ld.Name != ld.Key {
+		config.Metadata["name"] = ld.Name
+	}
+	if ld.Description != "" {
+		config.Metadata["description"] = ld.Description
+	}
+	if len(ld.Tags) > 0 {
+		config.Metadata["tags"] = ld.Tags
+		promoteMetadataTag(&config)
+	}
+	if ld.Temporary {
+		config.Metadata["temporary"] = true
+	}
+
+	var unmapped []string
+	variation := func(i int) (string, bool) {
+		if i < 0 || i >= len(names) {
+			return "", false
+		}
+		return names[i], true
+	}
+
+	env, ok := ld.Environments[environment]
+	if !ok {
+		onVariation := 0
+		if ld.Defaults != nil {
+			onVariation = ld.Defaults.OnVariation
+		}
+		name, ok := variation(onVariation)
+		if !ok {
+			return FlagConfig{}, nil, fmt.Errorf("default on variation %d does not exist", onVariation)
+		}
+		config.DefaultRule = &DefaultRule{Variation: name}
+		unmapped = append(unmapped, fmt.Sprintf("no configuration for environment %q: serving the default on variation %q", environment, name))
+		return config, unmapped, nil
+	}
+
+	for _, p := range env.Prerequisites {
+		unmapped = append(unmapped, fmt.Sprintf("prerequisite on flag %q (variation %d)", p.Key, p.Variation))
+	}
+
+	targets := append([]LaunchDarklyTarget{}, env.Targets...)
+	for _, t := range env.ContextTargets {
+		// User targets are listed in "targets"; contextTargets only repeats
+		// them without values
+		if t.ContextKind == "" || t.ContextKind == "user" {
+			if len(t.Values) > 0 {
+				targets = append(targets, t)
+			}
+			continue
+		}
+		unmapped = append(unmapped, fmt.Sprintf("individual targets of context kind %q", t.ContextKind))
+	}
+	for _, t := range targets {
+		if len(t.Values) == 0 {
+			continue
+		}
+		name, ok := variation(t.Variation)
+		if !ok {
+			unmapped = append(unmapped, fmt.Sprintf("individual targets of unknown variation %d", t.Variation))
+			continue
+		}
+		values := make([]string, len(t.Values))
+		for i, v := range t.Values {
+			values[i] = strconv.Quote(v)
+		}
+		config.Targeting = append(config.Targeting, TargetingRule{
+			Name:      "targets_" + name,
+			Query:     "key in [" + strings.Join(values, ", ") + "]",
+			Variation: name,
+		})
+	}
+
+	for i, rule := range env.Rules {
+		label := fmt.Sprintf("rule #%d", i+1)
+		if rule.Description != "" {
+			label += fmt.Sprintf(" (%s)", rule.Description)
+		}
+		query, err := launchDarklyRuleQuery(rule.Clauses)
+		if err != nil {
+			unmapped = append(unmapped, label+": "+err.Error())
+			continue
+		}
+		converted := TargetingRule{Name: fmt.Sprintf("rule_%d", i+1), Query: query}
+		if rule.Description != "" {
+			converted.Name = rule.Description
+		}
+		if err := applyLaunchDarklyServe(rule.LaunchDarklyServe, names, &converted.Variation, &converted.Percentage, &config); err != nil {
+			unmapped = append(unmapped, label+": "+err.Error())
+			continue
+		}
+		config.Targeting = append(config.Targeting, converted)
+	}
+
+	defaultRule := &DefaultRule{}
+	if err := applyLaunchDarklyServe(env.Fallthrough, names, &defaultRule.Variation, &defaultRule.Percentage, &config); err != nil {
+		return FlagConfig{}, nil, fmt.Errorf("fallthrough: %w", err)
+	}
+	config.DefaultRule = defaultRule
+
+	if !env.On {
+		disable := true
+		config.Disable = &disable
+		if env.OffVariation != nil {
+			if name, ok := variation(*env.OffVariation); ok {
+				unmapped = append(unmapped, fmt.Sprintf("off variation %q: the flag is disabled and serves the SDK default value instead", name))
+			}
+		}
+	}
+	if env.TrackEvents {
+		trackEvents := true
+		config.TrackEvents = &trackEvents
+	}
+
+	return config, unmapped, nil
+}
+
+// launchDarklyVariationNames names the variations of a LaunchDarkly flag after
+// their LaunchDarkly names, falling back to variation_<n> for unnamed ones and
+// for names used more than once.
+func launchDarklyVariationNames(variations []LaunchDarklyVariation) []string {
+	counts := make(map[string]int, len(variations))
+	for _, v := range variations {
+		counts[v.Name]++
+	}
+	names := make([]string, len(variations))
+	for i, v := range variations {
+		names[i] = v.Name
+		if v.Name == "" || counts[v.Name] > 1 {
+			names[i] = fmt.Sprintf("variation_%d", i)
+		}
+	}
+	return names
+}
+
+// applyLaunchDarklyServe sets the variation or percentage split of a rule from
+// what a LaunchDarkly rule or fallthrough serves. A rollout bucketed by an
+// attribute other than the key sets the flag's bucketing key.
+func applyLaunchDarklyServe(serve LaunchDarklyServe, names []string, variation *string, percentage *map[string]float64, config *FlagConfig) error {
+	if serve.Variation != nil {
+		i := *serve.Variation
+		if i < 0 || i >= len(names) {
+			return fmt.Errorf("unknown variation %d", i)
+		}
+		*variation = names[i]
+		return nil
+	}
+	if serve.Rollout == nil || len(serve.Rollout.Variations) == 0 {
+		return fmt.Errorf("serves neither a variation nor a rollout")
+	}
+
+	split := make(map[string]float64)
+	for _, wv := range serve.Rollout.Variations {
+		if wv.Variation < 0 || wv.Variation >= len(names) {
+			return fmt.Errorf("rollout to unknown variation %d", wv.Variation)
+		}
+		if wv.Weight > 0 {
+			split[names[wv.Variation]] += float64(wv.Weight) / 1000
+		}
+	}
+	if len(split) == 0 {
+		return fmt.Errorf("rollout has no weights")
+	}
+	if bucketBy := serve.Rollout.BucketBy; bucketBy != "" && bucketBy != "key" {
+		if config.BucketingKey != "" && config.BucketingKey != bucketBy {
+			return fmt.Errorf("rollout bucketed by %q while another rollout is bucketed by %q", bucketBy, config.BucketingKey)
+		}
+		config.BucketingKey = bucketBy
+	}
+	*percentage = split
+	return nil
+}
+
+// launchDarklyRuleQuery translates the clauses of a LaunchDarkly rule, which
+// must all match, into a targeting query.
+func launchDarklyRuleQuery(clauses []LaunchDarklyClause) (string, error) {
+	if len(clauses) == 0 {
+		return "", fmt.Errorf("rule has no clauses")
+	}
+	parts := make([]string, 0, len(clauses))
+	for _, c := range clauses {
+		part, err := launchDarklyClauseQuery(c)
+		if err != nil {
+			return "", err
+		}
+		if len(clauses) > 1 && strings.Contains(part, " or ") {
+			part = "(" + part + ")"
+		}
+		parts = append(parts, part)
+	}
+	query := strings.Join(parts, " and ")
+	if err := validateQuery(query); err != nil {
+		return "", fmt.Errorf("could not translate clauses: %v", err)
+	}
+	return query, nil
+}
+
+// launchDarklyClauseQuery translates a single LaunchDarkly clause. Clauses
+// with several values match any of them.
+func launchDarklyClauseQuery(c LaunchDarklyClause) (string, error) {
+	if c.ContextKind != "" && c.ContextKind != "user" {
+		return "", fmt.Errorf("clause on context kind %q", c.ContextKind)
+	}
+	if c.Op == "segmentMatch" {
+		return "", fmt.Errorf("segment match clause")
+	}
+	if len(c.Values) == 0 {
+		return "", fmt.Errorf("clause on %q has no values", c.Attribute)
+	}
+
+	// Attribute references ("/address/city") become dotted paths
+	attr := c.Attribute
+	if strings.HasPrefix(attr, "/") {
+		attr = strings.ReplaceAll(strings.TrimPrefix(attr, "/"), "/", ".")
+	}
+	if !isQueryIdentifier(attr) {
+		return "", fmt.Errorf("unsupported attribute %q", c.Attribute)
+	}
+
+	values := make([]string, len(c.Values))
+	for i, v := range c.Values {
+		literal, ok := launchDarklyQueryLiteral(v)
+		if !ok {
+			return "", fmt.Errorf("unsupported value %v in clause on %q", v, c.Attribute)
+		}
+		values[i] = literal
+	}
+
+	var query string
+	switch op := c.Op; {
+	case op == "in" && len(values) == 1:
+		query = attr + " eq " + values[0]
+	case op == "in":
+		query = attr + " in [" + strings.Join(values, ", ") + "]"
+	case launchDarklyOperators[op] != "":
+		conditions := make([]string, len(values))
+		for i, v := range values {
+			conditions[i] = attr + " " + launchDarklyOperators[op] + " " + v
+		}
+		query = strings.Join(conditions, " or ")
+	default:
+		return "", fmt.Errorf("unsupported operator %q on %q", op, c.Attribute)
+	}
+
+	if c.Negate {
+		query = "not (" + query + ")"
+	}
+	return query, nil
+}
+
+// launchDarklyQueryLiteral formats a clause value as a query literal.
+func launchDarklyQueryLiteral(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
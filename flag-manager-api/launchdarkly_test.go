@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportLaunchDarklyFlags(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	export := `{"items": [
+		{
+			"key": "new-checkout",
+			"description": "New checkout flow",
+			"tags": ["payments"],
+			"temporary": true,
+			"variations": [{"name": "On", "value": true}, {"name": "Off", "value": false}],
+			"environments": {
+				"production": {
+					"on": true,
+					"offVariation": 1,
+					"targets": [{"values": ["alice", "bob"], "variation": 0}],
+					"rules": [
+						{"description": "staff", "variation": 0, "clauses": [
+							{"attribute": "email", "op": "endsWith", "values": ["@example.com"]},
+							{"attribute": "country", "op": "in", "values": ["FR", "DE"], "negate": true}
+						]},
+						{"variation": 0, "clauses": [{"attribute": "segments", "op": "segmentMatch", "values": ["beta"]}]},
+						{"rollout": {"variations": [{"variation": 0, "weight": 25000}, {"variation": 1, "weight": 75000}]},
+						 "clauses": [{"attribute": "/account/plan", "op": "in", "values": ["pro"]}]}
+					],
+					"prerequisites": [{"key": "payments-enabled", "variation": 0}],
+					"fallthrough": {"rollout": {"variations": [{"variation": 0, "weight": 10000}, {"variation": 1, "weight": 90000}], "bucketBy": "accountId"}}
+				},
+				"staging": {"on": false, "offVariation": 1, "fallthrough": {"variation": 0}}
+			}
+		},
+		{
+			"key": "banner-color",
+			"variations": [{"value": "blue"}, {"value": "red"}],
+			"defaults": {"onVariation": 1, "offVariation": 0}
+		},
+		{"key": "broken", "variations": []}
+	]}`
+
+	doRequest(t, router, "POST", "/api/flags/import?source=unleash", export, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/flags/import?source=launchdarkly", export, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/flags/import?source=launchdarkly&project=web", "{", http.StatusBadRequest, nil)
+
+	var resp LaunchDarklyImportResponse
+	doRequest(t, router, "POST", "/api/flags/import?source=launchdarkly&project=web", export, http.StatusCreated, &resp)
+	if resp.Created != 2 || resp.Environment != "production" || len(resp.Errors) != 1 || !strings.HasPrefix(resp.Errors[0], "broken:") {
+		t.Fatalf("Expected 2 flags created and broken rejected, got %+v", resp)
+	}
+
+	flags, err := fm.storage.ListFlags(context.Background(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkout := flags["new-checkout"]
+	if checkout.Variations["On"] != true || checkout.Metadata["description"] != "New checkout flow" || checkout.Metadata["temporary"] != true ||
+		!reflect.DeepEqual(checkout.Tags, []string{"payments"}) || checkout.Metadata["tags"] != nil {
+		t.Errorf("Expected the variations, metadata and tags to be kept, got %+v", checkout)
+	}
+	wantQueries := []string{
+		`key in ["alice", "bob"]`,
+		`email ew "@example.com" and not (country in ["FR", "DE"])`,
+		`account.plan eq "pro"`,
+	}
+	if len(checkout.Targeting) != len(wantQueries) {
+		t.Fatalf("Expected %d targeting rules, got %+v", len(wantQueries), checkout.Targeting)
+	}
+	for i, want := range wantQueries {
+		if checkout.Targeting[i].Query != want {
+			t.Errorf("Rule %d: expected query %q, got %q", i, want, checkout.Targeting[i].Query)
+		}
+	}
+	if checkout.Targeting[1].Name != "staff" || checkout.Targeting[1].Variation != "On" {
+		t.Errorf("Expected the staff rule to serve On, got %+v", checkout.Targeting[1])
+	}
+	if p := checkout.Targeting[2].Percentage; p["On"] != 25 || p["Off"] != 75 {
+		t.Errorf("Expected a 25/75 rule split, got %v", p)
+	}
+	if p := checkout.DefaultRule.Percentage; p["On"] != 10 || p["Off"] != 90 || checkout.BucketingKey != "accountId" {
+		t.Errorf("Expected a 10/90 fallthrough bucketed by accountId, got %v, %q", p, checkout.BucketingKey)
+	}
+	unmapped := strings.Join(resp.Unmapped["new-checkout"], "\n")
+	if !strings.Contains(unmapped, `prerequisite on flag "payments-enabled"`) || !strings.Contains(unmapped, "segment match") {
+		t.Errorf("Expected the prerequisite and segment rule to be reported, got %q", unmapped)
+	}
+
+	// Without configuration for the environment, the default on variation is served
+	if banner := flags["banner-color"]; banner.Variations["variation_1"] != "red" || banner.DefaultRule.Variation != "variation_1" {
+		t.Errorf("Expected banner-color to serve variation_1, got %+v", banner)
+	}
+
+	// Re-importing skips existing flags; an off flag is disabled
+	doRequest(t, router, "POST", "/api/flags/import?source=launchdarkly&project=web", export, http.StatusOK, &resp)
+	if resp.Created != 0 || resp.Skipped != 2 {
+		t.Errorf("Expected existing flags to be skipped, got %+v", resp)
+	}
+	doRequest(t, router, "POST", "/api/flags/import?source=launchdarkly&project=staging&environment=staging", export, http.StatusCreated, &resp)
+	staged, _ := fm.storage.GetFlag(context.Background(), "staging", "new-checkout")
+	if staged == nil || staged.Config.Disable == nil || !*staged.Config.Disable || staged.Config.DefaultRule.Variation != "On" {
+		t.Errorf("Expected a disabled flag serving On, got %+v", staged)
+	}
+	if !strings.Contains(strings.Join(resp.Unmapped["new-checkout"], "\n"), `off variation "Off"`) {
+		t.Errorf("Expected the off variation to be reported, got %v", resp.Unmapped)
+	}
+}
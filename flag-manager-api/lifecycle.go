@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultShutdownTimeout         = 30 * time.Second
+	defaultServerReadHeaderTimeout = 10 * time.Second
+	defaultServerReadTimeout       = 30 * time.Second
+	defaultServerWriteTimeout      = 2 * time.Minute
+	defaultServerIdleTimeout       = 2 * time.Minute
+
+	// readinessCheckTimeout bounds the checks of a readiness probe.
+	readinessCheckTimeout = 2 * time.Second
+)
+
+// parseServerDuration reads a server timeout or delay setting; 0 disables it.
+func parseServerDuration(name, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid "+name+", using default", "value", value, "default", def)
+		return def
+	}
+	return d
+}
+
+// newHTTPServer returns the API server. Requests are served with contexts
+// derived from base, so that cancelling it aborts the database queries of
+// requests still running once the shutdown timeout has passed. WebSocket
+// connections set their own deadlines.
+func newHTTPServer(base context.Context, config Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + config.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: config.ServerReadHeaderTimeout,
+		ReadTimeout:       config.ServerReadTimeout,
+		WriteTimeout:      config.ServerWriteTimeout,
+		IdleTimeout:       config.ServerIdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+}
+
+// backgroundJobs runs the manager's background loops with a context that is
+// cancelled when the server shuts down.
+type backgroundJobs struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newBackgroundJobs(parent context.Context) *backgroundJobs {
+	ctx, cancel := context.WithCancel(parent)
+	return &backgroundJobs{ctx: ctx, cancel: cancel}
+}
+
+// start runs job in a goroutine until the jobs are stopped.
+func (b *backgroundJobs) start(job func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		job(b.ctx)
+	}()
+}
+
+// stop cancels the jobs and waits for them to return, or for ctx to be done.
+func (b *backgroundJobs) stop(ctx context.Context) error {
+	b.cancel()
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background jobs still running: %w", ctx.Err())
+	}
+}
+
+// shutdown stops the server without dropping requests: /readyz fails first,
+// for ShutdownDelay, so that load balancers stop routing to this replica,
+// then the server stops accepting connections and waits for the requests in
+// flight. Change feed clients are told to reconnect elsewhere, background
+// jobs stop, and the relay proxy refreshes, ConfigMap writes and publishes
+// pending after the last flag changes are made, all before ctx is done.
+func (fm *FlagManager) shutdown(ctx context.Context, srv *http.Server, jobs *backgroundJobs) error {
+	fm.shuttingDown.Store(true)
+	if delay := fm.config.ShutdownDelay; delay > 0 {
+		slog.Info("Failing readiness before shutting down", "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	var errs []error
+	if fm.changes != nil {
+		fm.changes.Close()
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("requests still running: %w", err))
+	}
+	if jobs != nil {
+		if err := jobs.stop(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := fm.drainRefreshes(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// refreshQueues returns the queues of the relay proxy targets, the flags
+// ConfigMap and the publish targets.
+func (fm *FlagManager) refreshQueues() []*relayRefreshQueue {
+	var queues []*relayRefreshQueue
+	fm.relayStates.mu.Lock()
+	for _, state := range fm.relayStates.states {
+		queues = append(queues, &state.queue)
+	}
+	fm.relayStates.mu.Unlock()
+	if fm.configMap != nil {
+		queues = append(queues, &fm.configMap.queue)
+	}
+	fm.publishing.mu.RLock()
+	for _, state := range fm.publishing.states {
+		queues = append(queues, &state.queue)
+	}
+	fm.publishing.mu.RUnlock()
+	return queues
+}
+
+// drainRefreshes makes the pending refreshes now and waits for them.
+func (fm *FlagManager) drainRefreshes(ctx context.Context) error {
+	queues := fm.refreshQueues()
+	errs := make([]error, len(queues))
+	var wg sync.WaitGroup
+	for i, q := range queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = q.drain(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// livenessHandler reports that the process serves requests. It does not check
+// dependencies: restarting the manager does not fix a database outage.
+func (fm *FlagManager) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(HealthResponse{Healthy: true})
+}
+
+// ReadinessCheck is the outcome of one readiness check.
+type ReadinessCheck struct {
+	Name     string `json:"name"`
+	Healthy  bool   `json:"healthy"`
+	Required bool   `json:"required"` // failing it fails readiness
+	Error    string `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the body of GET /readyz.
+type ReadinessResponse struct {
+	Ready        bool             `json:"ready"`
+	ShuttingDown bool             `json:"shuttingDown,omitempty"`
+	Checks       []ReadinessCheck `json:"checks"`
+}
+
+// readinessHandler reports whether the manager can serve requests: its
+// storage answers and it is not shutting down. The relay proxy targets are
+// checked too, but do not fail readiness: they read their flags from the
+// manager, which must stay in rotation for them to recover.
+func (fm *FlagManager) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	targets := fm.relayTargets()
+	checks := make([]ReadinessCheck, 1+len(targets))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		checks[0] = ReadinessCheck{Name: "storage", Required: true}
+		if err := fm.checkStorage(ctx); err != nil {
+			checks[0].Error = err.Error()
+		} else {
+			checks[0].Healthy = true
+		}
+	}()
+	for i, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check := ReadinessCheck{Name: "relay:" + target.Name}
+			var health struct {
+				Initialized bool `json:"initialized"`
+			}
+			if _, err := fm.getRelayProxyJSON(ctx, target, "/health", &health); err != nil {
+				check.Error = err.Error()
+			} else if !health.Initialized {
+				check.Error = "relay proxy not initialized"
+			} else {
+				check.Healthy = true
+			}
+			checks[1+i] = check
+		}()
+	}
+	wg.Wait()
+
+	resp := ReadinessResponse{Ready: true, ShuttingDown: fm.shuttingDown.Load(), Checks: checks}
+	if resp.ShuttingDown {
+		resp.Ready = false
+	}
+	for _, check := range checks {
+		if check.Required && !check.Healthy {
+			resp.Ready = false
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkStorage checks that the database answers, or in file mode that the
+// flags directory is there.
+func (fm *FlagManager) checkStorage(ctx context.Context) error {
+	if fm.store != nil {
+		return fm.store.Ping(ctx)
+	}
+	info, err := os.Stat(fm.config.FlagsDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", fm.config.FlagsDir)
+	}
+	return nil
+}
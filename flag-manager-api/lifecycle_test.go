@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestReadinessProbes(t *testing.T) {
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"initialized":true}`))
+	}))
+	defer relay.Close()
+
+	fileFM, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			fm.config.RelayProxyURL = relay.URL
+			router := setupTestRouter(fm)
+			ready := func(status int) ReadinessResponse {
+				t.Helper()
+				var resp ReadinessResponse
+				doRequest(t, router, "GET", "/readyz", "", status, &resp)
+				return resp
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected the liveness probe to pass, got %d", rr.Code)
+			}
+
+			resp := ready(http.StatusOK)
+			if want := []ReadinessCheck{
+				{Name: "storage", Healthy: true, Required: true},
+				{Name: "relay:default", Healthy: true},
+			}; !resp.Ready || !reflect.DeepEqual(resp.Checks, want) {
+				t.Errorf("Expected every check to pass, got %+v", resp)
+			}
+
+			// The relay proxy does not take the manager out of rotation
+			fm.config.RelayProxyURL = "http://127.0.0.1:1"
+			if resp := ready(http.StatusOK); resp.Checks[1].Healthy || resp.Checks[1].Error == "" {
+				t.Errorf("Expected the relay check to fail, got %+v", resp.Checks)
+			}
+			fm.config.RelayProxyURL = ""
+
+			fm.shuttingDown.Store(true)
+			if resp := ready(http.StatusServiceUnavailable); !resp.ShuttingDown || !resp.Checks[0].Healthy {
+				t.Errorf("Expected readiness to fail while shutting down, got %+v", resp)
+			}
+			fm.shuttingDown.Store(false)
+
+			if fm.store != nil {
+				fm.store.Close()
+			} else {
+				fm.config.FlagsDir = filepath.Join(tempDir, "missing")
+			}
+			if resp := ready(http.StatusServiceUnavailable); resp.Checks[0].Healthy || resp.Checks[0].Error == "" {
+				t.Errorf("Expected the storage check to fail, got %+v", resp.Checks)
+			}
+		})
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	var refreshes int32
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin/v1/retriever/refresh" {
+			atomic.AddInt32(&refreshes, 1)
+		}
+	}))
+	defer relay.Close()
+
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	fm.config.RelayProxyURL = relay.URL
+	fm.config.RefreshDebounce = time.Hour
+	router := setupTestRouter(fm)
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("/", router)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+		w.Write([]byte("done"))
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newHTTPServer(context.Background(), Config{}, mux)
+	go srv.Serve(ln)
+	base := "http://" + ln.Addr().String()
+
+	resp, err := http.Post(base+"/api/projects/web/flags/checkout", "application/json", strings.NewReader(`{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`))
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Creating a flag failed: %v %v", err, resp)
+	}
+	resp.Body.Close()
+
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		slow <- string(body)
+	}()
+	<-entered
+
+	jobs := newBackgroundJobs(context.Background())
+	var jobStopped atomic.Bool
+	jobs.start(func(ctx context.Context) {
+		<-ctx.Done()
+		jobStopped.Store(true)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- fm.shutdown(ctx, srv, jobs) }()
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned with a request in flight: %v", err)
+	default:
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness to fail while shutting down, got %d", rr.Code)
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Error("Expected new connections to be refused")
+	}
+
+	close(release)
+	if body := <-slow; body != "done" {
+		t.Errorf("Expected the request in flight to complete, got %q", body)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if !jobStopped.Load() {
+		t.Error("Expected the background jobs to be stopped")
+	}
+	// The refresh debounced for an hour was made before returning
+	if n := atomic.LoadInt32(&refreshes); n != 1 {
+		t.Errorf("Expected the pending refresh to be made, got %d refreshes", n)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// requestIDHeader carries the request ID in requests and responses, and on
+// the calls made to the relay proxy on behalf of a request.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client supplied request IDs.
+const maxRequestIDLength = 128
+
+// newLogger returns the structured logger configured by LOG_FORMAT (text or
+// json, default text) and LOG_LEVEL (debug, info, warn or error, default
+// info). Records logged with a request context carry its request ID and actor.
+func newLogger(w io.Writer, format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLogLevel(level)}
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+func parseLogLevel(value string) slog.Level {
+	var level slog.Level
+	if value == "" || level.UnmarshalText([]byte(value)) != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// logFatal logs an error and exits, replacing log.Fatalf.
+func logFatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// contextHandler adds the request ID and actor of the context to records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if info := requestInfoFrom(ctx); info != nil {
+		record.AddAttrs(slog.String("request_id", info.ID))
+		if info.Actor != nil {
+			record.AddAttrs(actorAttr(*info.Actor))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// actorAttr groups the identity of an actor for log records.
+func actorAttr(actor Actor) slog.Attr {
+	attrs := []any{slog.String("type", actor.Type)}
+	if actor.ID != "" {
+		attrs = append(attrs, slog.String("id", actor.ID))
+	}
+	if actor.Email != "" {
+		attrs = append(attrs, slog.String("email", actor.Email))
+	}
+	if actor.Name != "" {
+		attrs = append(attrs, slog.String("name", actor.Name))
+	}
+	return slog.Group("actor", attrs...)
+}
+
+// requestInfo holds the logging fields of a request. RequestIDMiddleware
+// stores it in the request context and AuthMiddleware fills in the actor, so
+// that the access log written outside the auth middleware can name it.
+type requestInfo struct {
+	ID    string
+	Actor *Actor
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(ctxRequestInfo).(*requestInfo)
+	return info
+}
+
+// requestIDFrom returns the request ID of ctx, or "" outside a request.
+func requestIDFrom(ctx context.Context) string {
+	if info := requestInfoFrom(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+// withActor returns r with the authenticated actor in its context.
+func withActor(r *http.Request, actor Actor) *http.Request {
+	if info := requestInfoFrom(r.Context()); info != nil {
+		info.Actor = &actor
+	}
+	return r.WithContext(context.WithValue(r.Context(), ctxActor, actor))
+}
+
+// validRequestID reports whether a client supplied request ID can be reused:
+// short, and printable ASCII only so it cannot forge log lines or headers.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDMiddleware assigns each request an ID, reusing a valid
+// X-Request-ID header, and echoes it in the response.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), ctxRequestInfo, &requestInfo{ID: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// LoggingMiddleware logs HTTP requests.
+func LoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		slog.InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start))
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	relayIDs := make(chan string, 1)
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		relayIDs <- r.Header.Get("X-Request-ID")
+	}))
+	defer relay.Close()
+	fm.config.RelayProxyURL = relay.URL
+
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(newLogger(&logs, "json", "info"))
+
+	handler := RequestIDMiddleware(LoggingMiddleware(fm.AuthMiddleware(setupTestRouter(fm))))
+
+	flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+	req := httptest.NewRequest("POST", "/api/projects/web/flags/checkout", strings.NewReader(flag))
+	req.Header.Set("X-Request-ID", "req-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("X-Request-ID"); got != "req-123" {
+		t.Errorf("Expected the client request ID to be echoed, got %q", got)
+	}
+
+	select {
+	case id := <-relayIDs:
+		if id != "req-123" {
+			t.Errorf("Expected the relay refresh to carry the request ID, got %q", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Relay proxy was not refreshed")
+	}
+
+	events, err := fm.listAuditEvents(context.Background(), db.AuditFilterParams{})
+	if err != nil {
+		t.Fatalf("Failed to list audit events: %v", err)
+	}
+	if len(events.Data) != 1 || events.Data[0].RequestID != "req-123" {
+		t.Errorf("Expected the audit event to carry the request ID, got %+v", events.Data)
+	}
+
+	var access map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]interface{}
+		if json.Unmarshal([]byte(line), &record) == nil && record["msg"] == "request" {
+			access = record
+		}
+	}
+	if access == nil {
+		t.Fatalf("Expected an access log record, got %s", logs.String())
+	}
+	actor, _ := access["actor"].(map[string]interface{})
+	if access["request_id"] != "req-123" || access["status"] != float64(http.StatusCreated) || actor["name"] != "anonymous" {
+		t.Errorf("Expected request ID, status and actor in the access log, got %v", access)
+	}
+
+	req = httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("X-Request-ID", "bad id\nforged")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if got := rr.Header().Get("X-Request-ID"); got == "" || strings.ContainsAny(got, " \n") {
+		t.Errorf("Expected an invalid request ID to be replaced, got %q", got)
+	}
+}
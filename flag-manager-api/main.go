@@ -1,40 +1,84 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"flag-manager-api/db"
 	"flag-manager-api/git"
+	"flag-manager-api/httpclient"
+	"flag-manager-api/secrets"
 
 	"github.com/gorilla/mux"
-	"gopkg.in/yaml.v3"
 )
 
 // Config holds the application configuration
 type Config struct {
-	FlagsDir           string
-	RelayProxyURL      string
-	Port               string
-	AdminAPIKey        string
-	GitConfig          *git.Config
-	DatabaseURL        string
-	AuthEnabled        bool
-	JWTIssuerURL       string
-	RequireApprovals   bool
-	RequireChangeNotes bool
+	FlagsDir              string
+	RelayProxyURL         string
+	RelayTargets          []RelayTarget // replaces RelayProxyURL and AdminAPIKey when set
+	RelayRefreshPath      string        // defaults to /admin/v1/retriever/refresh
+	RelayAuthHeader       string        // defaults to Authorization
+	RelayAuthScheme       string        // defaults to Bearer; "none" sends the bare key
+	Port                  string
+	AdminAPIKey           string
+	GitConfig             *git.Config
+	DatabaseURL           string
+	AuthEnabled           bool
+	JWTIssuerURL          string
+	JWTRolesClaim         string        // claim path role mappings match, defaults to groups
+	RoleMappings          []RoleMapping // roles given by values of the roles claim
+	RequireApprovals      bool
+	RequireChangeNotes    bool
+	EnforceFlagOwners     bool // only owners and admins may change flags that have owners
+	NormalizeYAMLNumbers  bool
+	OutboundConcurrency   int
+	RefreshInterval       time.Duration // 0 disables scheduled relay refreshes
+	RefreshDebounce       time.Duration // window in which refreshes after flag changes are coalesced
+	SchedulerInterval     time.Duration // 0 disables applying scheduled rollout steps
+	RampInterval          time.Duration // 0 disables the rollout controller advancing ramps
+	PrometheusURL         string        // queried by the metrics checks of ramps
+	StaleFlagAge          time.Duration // flags unchanged for this long are stale; 0 disables
+	StaleReaperInterval   time.Duration // 0 disables the stale flag reaper
+	StaleReaperAction     string        // report, disable or delete expired flags
+	ProposalPollInterval  time.Duration // 0 disables polling the PR state of proposals
+	ProposalAutoRefresh   bool          // refresh the relay proxy when a proposal is merged
+	AuditLogMaxSize       int64         // file mode: rotate audit.jsonl past this many bytes
+	AuditLogMaxFiles      int           // file mode: rotated audit logs kept
+	EvaluationRetention   time.Duration // evaluations older than this are purged; 0 keeps them
+	FlagArchiveRetention  time.Duration // archived flags are purged this long after being archived; 0 keeps them
+	ProjectTrashRetention time.Duration // deleted projects are purged from the trash this long after; 0 keeps them
+	RawFlagsCacheTTL      time.Duration // longest a rendered raw flags file is reused; 0 renders every request
+	RateLimits            RateLimitConfig
+	CORS                  CORSConfig
+	ShutdownTimeout       time.Duration // longest a graceful shutdown waits for requests and refreshes
+	ShutdownDelay         time.Duration // how long /readyz fails before the server stops accepting requests
+
+	ServerReadHeaderTimeout time.Duration
+	ServerReadTimeout       time.Duration
+	ServerWriteTimeout      time.Duration
+	ServerIdleTimeout       time.Duration
 }
 
 // FlagManager handles flag CRUD operations
 type FlagManager struct {
 	config             Config
 	store              *db.Store
+	storage            Storage
 	audit              *AuditLogger
 	gitProvider        git.Provider
 	integrations       *IntegrationsStore
@@ -42,10 +86,37 @@ type FlagManager struct {
 	notifiers          *NotifiersStore
 	exporters          *ExportersStore
 	retrievers         *RetrieversStore
+	settings           *SettingsStore
+	projectMeta        *ProjectMetaStore
+	proposals          *ProposalsStore
+	templates          *FlagTemplatesStore
+	auditSinks         *AuditSinksStore
+	publishTargets     *PublishTargetsStore
+	notificationRules  *NotificationRulesStore
+	policies           *PoliciesStore
+	codeReferences     *CodeReferencesStore
+	configMap          *ConfigMapWriter // nil unless CONFIGMAP_NAME is set
+	signer             *flagsSigner     // nil unless a FLAGS_SIGNING_KEY is set
+	rateLimits         *rateLimiter
+	secrets            *secrets.Cipher // encrypts stored secrets; nil keeps them in plaintext
+	secretRefs         *secretRefResolver
+	changeRequests     *ChangeRequestsStore
+	gitSync            *GitSyncStore
+	auditLog           *AuditLogStore
+	changes            *ChangeFeed
 	authEnabled        bool
 	jwtIssuerURL       string
 	requireApprovals   bool
 	requireChangeNotes bool
+	enforceFlagOwners  bool
+	outbound           *outboundLimiter
+	relayStates        relayTargetStates
+	publishing         publishTargetDispatcher
+	rawFlagsFetches    rawFlagsFetchLog
+	rawFlags           rawFlagsCache
+	shuttingDown       atomic.Bool // /readyz fails once set
+	searchIndex        flagSearchIndex
+	webhookDeliveries  projectWebhookDeliveryLog
 }
 
 // ProgressiveRolloutStep represents a step in progressive rollout
@@ -61,13 +132,36 @@ type ProgressiveRollout struct {
 	End     *ProgressiveRolloutStep `yaml:"end,omitempty" json:"end,omitempty"`
 }
 
-// ScheduledStep represents a step in scheduled rollout
+// ScheduledStep represents a step in scheduled rollout. A step is scheduled
+// either at an absolute Date or After a delay (e.g. "12h", "7d") following the
+// previous step; relative steps are converted to dates when the flag is saved.
 type ScheduledStep struct {
 	Date        string          `yaml:"date,omitempty" json:"date,omitempty"`
+	After       string          `yaml:"after,omitempty" json:"after,omitempty"`
 	Targeting   []TargetingRule `yaml:"targeting,omitempty" json:"targeting,omitempty"`
 	DefaultRule *DefaultRule    `yaml:"defaultRule,omitempty" json:"defaultRule,omitempty"`
 }
 
+// resolveRelativeSchedule converts relative scheduled rollout steps into absolute
+// dates, counting the first step from now. It expects a config that passed
+// validateScheduledRolloutMode.
+func (c *FlagConfig) resolveRelativeSchedule(now time.Time) {
+	at := now.UTC()
+	for i := range c.ScheduledRollout {
+		step := &c.ScheduledRollout[i]
+		if step.After == "" {
+			continue
+		}
+		delay, err := parseDuration(step.After)
+		if err != nil {
+			continue
+		}
+		at = at.Add(delay)
+		step.Date = at.Format(time.RFC3339)
+		step.After = ""
+	}
+}
+
 // Experimentation represents an experimentation configuration
 type Experimentation struct {
 	Start string `yaml:"start,omitempty" json:"start,omitempty"`
@@ -76,16 +170,24 @@ type Experimentation struct {
 
 // FlagConfig represents a feature flag configuration
 type FlagConfig struct {
-	Variations       map[string]interface{} `yaml:"variations,omitempty" json:"variations,omitempty"`
-	Targeting        []TargetingRule        `yaml:"targeting,omitempty" json:"targeting,omitempty"`
-	DefaultRule      *DefaultRule           `yaml:"defaultRule,omitempty" json:"defaultRule,omitempty"`
-	TrackEvents      *bool                  `yaml:"trackEvents,omitempty" json:"trackEvents,omitempty"`
-	Disable          *bool                  `yaml:"disable,omitempty" json:"disable,omitempty"`
-	Version          string                 `yaml:"version,omitempty" json:"version,omitempty"`
-	Metadata         map[string]interface{} `yaml:"metadata,omitempty" json:"metadata,omitempty"`
-	ScheduledRollout []ScheduledStep        `yaml:"scheduledRollout,omitempty" json:"scheduledRollout,omitempty"`
-	Experimentation  *Experimentation       `yaml:"experimentation,omitempty" json:"experimentation,omitempty"`
-	BucketingKey     string                 `yaml:"bucketingKey,omitempty" json:"bucketingKey,omitempty"`
+	Variations           map[string]interface{}            `yaml:"variations,omitempty" json:"variations,omitempty"`
+	EnvironmentOverrides map[string]map[string]interface{} `yaml:"environmentOverrides,omitempty" json:"environmentOverrides,omitempty"` // variation -> environment -> value
+	Targeting            []TargetingRule                   `yaml:"targeting,omitempty" json:"targeting,omitempty"`
+	DefaultRule          *DefaultRule                      `yaml:"defaultRule,omitempty" json:"defaultRule,omitempty"`
+	TrackEvents          *bool                             `yaml:"trackEvents,omitempty" json:"trackEvents,omitempty"`
+	Disable              *bool                             `yaml:"disable,omitempty" json:"disable,omitempty"`
+	Version              string                            `yaml:"version,omitempty" json:"version,omitempty"`
+	Metadata             map[string]interface{}            `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	ScheduledRollout     []ScheduledStep                   `yaml:"scheduledRollout,omitempty" json:"scheduledRollout,omitempty"`
+	Experimentation      *Experimentation                  `yaml:"experimentation,omitempty" json:"experimentation,omitempty"`
+	BucketingKey         string                            `yaml:"bucketingKey,omitempty" json:"bucketingKey,omitempty"`
+	RequiresApproval     *bool                             `yaml:"requiresApproval,omitempty" json:"requiresApproval,omitempty"`
+	ExpiresAt            string                            `yaml:"expiresAt,omitempty" json:"expiresAt,omitempty"`   // RFC 3339; expired flags are reported as stale
+	Status               string                            `yaml:"status,omitempty" json:"status,omitempty"`         // draft or published (default); drafts are not served
+	ArchivedAt           string                            `yaml:"archivedAt,omitempty" json:"archivedAt,omitempty"` // RFC 3339; archived flags are not served until restored
+	Tags                 []string                          `yaml:"tags,omitempty" json:"tags,omitempty"`
+	Owners               []string                          `yaml:"owners,omitempty" json:"owners,omitempty"` // users and @org/teams allowed to change the flag
+	Ramp                 *RolloutRamp                      `yaml:"ramp,omitempty" json:"ramp,omitempty"`     // percentage rollout advanced by the rollout controller
 }
 
 // TargetingRule represents a targeting rule
@@ -110,85 +212,280 @@ type DefaultRule struct {
 type ProjectFlags map[string]FlagConfig
 
 func main() {
+	slog.SetDefault(newLogger(os.Stderr, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL")))
+	httpclient.Configure(httpclient.LoadConfigFromEnv())
 	gitConfig := git.LoadConfigFromEnv()
 
 	config := Config{
-		FlagsDir:      getEnv("FLAGS_DIR", "./flags"),
-		RelayProxyURL: getEnv("RELAY_PROXY_URL", "http://localhost:1031"),
-		Port:          getEnv("PORT", "8080"),
-		AdminAPIKey:   getEnv("ADMIN_API_KEY", ""),
-		GitConfig:     gitConfig,
-		DatabaseURL:   getEnv("DATABASE_URL", ""),
-		AuthEnabled:        getEnv("AUTH_ENABLED", "false") == "true",
-		JWTIssuerURL:       getEnv("JWT_ISSUER_URL", ""),
-		RequireApprovals:   getEnv("REQUIRE_APPROVALS", "false") == "true",
-		RequireChangeNotes: getEnv("REQUIRE_CHANGE_NOTES", "false") == "true",
+		FlagsDir:              getEnv("FLAGS_DIR", "./flags"),
+		RelayProxyURL:         getEnv("RELAY_PROXY_URL", "http://localhost:1031"),
+		RelayRefreshPath:      getEnv("RELAY_REFRESH_PATH", defaultRelayRefreshPath),
+		RelayAuthHeader:       getEnv("RELAY_AUTH_HEADER", defaultRelayAuthHeader),
+		RelayAuthScheme:       getEnv("RELAY_AUTH_SCHEME", defaultRelayAuthScheme),
+		Port:                  getEnv("PORT", "8080"),
+		AdminAPIKey:           getEnv("ADMIN_API_KEY", ""),
+		GitConfig:             gitConfig,
+		DatabaseURL:           getEnv("DATABASE_URL", ""),
+		AuthEnabled:           getEnv("AUTH_ENABLED", "false") == "true",
+		JWTIssuerURL:          getEnv("JWT_ISSUER_URL", ""),
+		JWTRolesClaim:         getEnv("JWT_ROLES_CLAIM", defaultRolesClaim),
+		RequireApprovals:      getEnv("REQUIRE_APPROVALS", "false") == "true",
+		RequireChangeNotes:    getEnv("REQUIRE_CHANGE_NOTES", "false") == "true",
+		EnforceFlagOwners:     getEnv("ENFORCE_FLAG_OWNERS", "false") == "true",
+		NormalizeYAMLNumbers:  getEnv("NORMALIZE_YAML_NUMBERS", "true") == "true",
+		OutboundConcurrency:   parseOutboundConcurrency(os.Getenv("OUTBOUND_CONCURRENCY")),
+		RefreshInterval:       parseRefreshInterval(os.Getenv("REFRESH_INTERVAL")),
+		RefreshDebounce:       parseRefreshDebounce(os.Getenv("REFRESH_DEBOUNCE")),
+		SchedulerInterval:     parseSchedulerInterval(os.Getenv("SCHEDULER_INTERVAL")),
+		RampInterval:          parseRampControllerInterval(os.Getenv("RAMP_CONTROLLER_INTERVAL")),
+		PrometheusURL:         getEnv("PROMETHEUS_URL", ""),
+		StaleFlagAge:          parseStaleFlagAge(os.Getenv("STALE_FLAG_AGE")),
+		StaleReaperInterval:   parseStaleReaperInterval(os.Getenv("STALE_REAPER_INTERVAL")),
+		StaleReaperAction:     parseStaleReaperAction(os.Getenv("STALE_REAPER_ACTION")),
+		ProposalPollInterval:  parseProposalPollInterval(os.Getenv("PROPOSAL_POLL_INTERVAL")),
+		ProposalAutoRefresh:   getEnv("PROPOSAL_AUTO_REFRESH", "false") == "true",
+		AuditLogMaxSize:       parseAuditLogMaxSize(os.Getenv("AUDIT_LOG_MAX_SIZE")),
+		AuditLogMaxFiles:      parseAuditLogMaxFiles(os.Getenv("AUDIT_LOG_MAX_FILES")),
+		EvaluationRetention:   parseEvaluationRetention(os.Getenv("EVALUATION_RETENTION")),
+		FlagArchiveRetention:  parseFlagArchiveRetention(os.Getenv("FLAG_ARCHIVE_RETENTION")),
+		ProjectTrashRetention: parseProjectTrashRetention(os.Getenv("PROJECT_TRASH_RETENTION")),
+		RawFlagsCacheTTL:      parseRawFlagsCacheTTL(os.Getenv("RAW_FLAGS_CACHE_TTL")),
+		ShutdownTimeout:       parseServerDuration("SHUTDOWN_TIMEOUT", os.Getenv("SHUTDOWN_TIMEOUT"), defaultShutdownTimeout),
+		ShutdownDelay:         parseServerDuration("SHUTDOWN_DELAY", os.Getenv("SHUTDOWN_DELAY"), 0),
+
+		ServerReadHeaderTimeout: parseServerDuration("SERVER_READ_HEADER_TIMEOUT", os.Getenv("SERVER_READ_HEADER_TIMEOUT"), defaultServerReadHeaderTimeout),
+		ServerReadTimeout:       parseServerDuration("SERVER_READ_TIMEOUT", os.Getenv("SERVER_READ_TIMEOUT"), defaultServerReadTimeout),
+		ServerWriteTimeout:      parseServerDuration("SERVER_WRITE_TIMEOUT", os.Getenv("SERVER_WRITE_TIMEOUT"), defaultServerWriteTimeout),
+		ServerIdleTimeout:       parseServerDuration("SERVER_IDLE_TIMEOUT", os.Getenv("SERVER_IDLE_TIMEOUT"), defaultServerIdleTimeout),
 	}
 
+	if config.RelayProxyURL != "" {
+		if _, err := relayRefreshURL(config.RelayProxyURL, config.RelayRefreshPath); err != nil {
+			logFatal("Invalid relay proxy configuration", "error", err)
+		}
+	}
+	relayTargets, err := parseRelayTargets(os.Getenv("RELAY_PROXY_TARGETS"), config.RelayRefreshPath)
+	if err != nil {
+		logFatal("Invalid relay proxy configuration", "error", err)
+	}
+	config.RelayTargets = relayTargets
+	roleMappings, err := parseRoleMappings(os.Getenv("JWT_ROLE_MAPPINGS"))
+	if err != nil {
+		logFatal("Invalid role mapping configuration", "error", err)
+	}
+	config.RoleMappings = roleMappings
+	configMapTarget, err := parseConfigMapTarget(os.Getenv)
+	if err != nil {
+		logFatal("Invalid ConfigMap configuration", "error", err)
+	}
+	signer, err := parseFlagsSigner(os.Getenv)
+	if err != nil {
+		logFatal("Invalid flags signing configuration", "error", err)
+	}
+	rateLimits, err := parseRateLimitConfig(os.Getenv)
+	if err != nil {
+		logFatal("Invalid rate limit configuration", "error", err)
+	}
+	config.RateLimits = rateLimits
+	cors, err := parseCORSConfig(os.Getenv)
+	if err != nil {
+		logFatal("Invalid CORS configuration", "error", err)
+	}
+	config.CORS = cors
+
 	fm := &FlagManager{
 		config:             config,
 		authEnabled:        config.AuthEnabled,
 		jwtIssuerURL:       config.JWTIssuerURL,
 		requireApprovals:   config.RequireApprovals,
 		requireChangeNotes: config.RequireChangeNotes,
+		enforceFlagOwners:  config.EnforceFlagOwners,
+		outbound:           newOutboundLimiter(config.OutboundConcurrency),
+		signer:             signer,
+		rateLimits:         newRateLimiter(config.RateLimits),
+		changes:            NewChangeFeed(),
+	}
+	fm.audit = NewAuditLogger(nil, fm.changes)
+
+	// SIGINT and SIGTERM start a graceful shutdown; a second signal exits
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	cipher, err := newSecretsCipher(ctx, os.Getenv)
+	if err != nil {
+		logFatal("Invalid secrets encryption configuration", "error", err)
+	}
+	if cipher != nil {
+		slog.Info("Encrypting stored secrets", "keyId", cipher.KeyID())
 	}
+	fm.secrets = cipher
+	fm.secretRefs = newSecretRefResolver(os.Getenv)
 
 	// Initialize database if DATABASE_URL is set
 	if config.DatabaseURL != "" {
-		store, err := db.NewStore(config.DatabaseURL)
+		store, err := db.NewStoreContext(ctx, config.DatabaseURL)
 		if err != nil {
-			log.Fatalf("Failed to connect to database: %v", err)
+			logFatal("Failed to connect to database", "error", err)
 		}
 		defer store.Close()
+		store.SetCipher(cipher)
 		fm.store = store
-		fm.audit = NewAuditLogger(store)
-		log.Println("Using PostgreSQL storage backend")
+		fm.storage = newPolicyStorage(fm, &dbStorage{store: store})
+		fm.audit = NewAuditLogger(store, fm.changes)
+		if store.SQLite() {
+			slog.Info("Using SQLite storage backend")
+		} else {
+			slog.Info("Using PostgreSQL storage backend")
+		}
 	} else {
 		// Fall back to file-based storage
-		log.Println("Using file-based storage backend (set DATABASE_URL for PostgreSQL)")
+		slog.Info("Using file-based storage backend (set DATABASE_URL for PostgreSQL or SQLite)")
 		if err := os.MkdirAll(config.FlagsDir, 0755); err != nil {
-			log.Fatalf("Failed to create flags directory: %v", err)
+			logFatal("Failed to create flags directory", "error", err)
+		}
+
+		if err := checkSealedFiles(config.FlagsDir, cipher); err != nil {
+			logFatal("Failed to decrypt stored secrets", "error", err)
 		}
 
-		fm.integrations = NewIntegrationsStore(config.FlagsDir)
+		fm.storage = newPolicyStorage(fm, &fileStorage{fm: fm})
+		fm.integrations = NewIntegrationsStore(config.FlagsDir, cipher)
 		fm.flagSets = NewFlagSetsStore(config.FlagsDir)
-		fm.notifiers = NewNotifiersStore(config.FlagsDir)
-		fm.exporters = NewExportersStore(config.FlagsDir)
-		fm.retrievers = NewRetrieversStore(config.FlagsDir)
+		fm.notifiers = NewNotifiersStore(config.FlagsDir, cipher)
+		fm.exporters = NewExportersStore(config.FlagsDir, cipher)
+		fm.retrievers = NewRetrieversStore(config.FlagsDir, cipher)
+		fm.settings = NewSettingsStore(config.FlagsDir)
+		fm.projectMeta = NewProjectMetaStore(config.FlagsDir, cipher)
+		fm.proposals = NewProposalsStore(config.FlagsDir)
+		fm.templates = NewFlagTemplatesStore(config.FlagsDir)
+		fm.auditSinks = NewAuditSinksStore(config.FlagsDir, cipher)
+		fm.publishTargets = NewPublishTargetsStore(config.FlagsDir, cipher)
+		fm.notificationRules = NewNotificationRulesStore(config.FlagsDir)
+		fm.policies = NewPoliciesStore(config.FlagsDir)
+		fm.codeReferences = NewCodeReferencesStore(config.FlagsDir)
+		fm.changeRequests = NewChangeRequestsStore(config.FlagsDir)
+		fm.gitSync = NewGitSyncStore(config.FlagsDir)
+		fm.auditLog = NewAuditLogStore(config.FlagsDir, config.AuditLogMaxSize, config.AuditLogMaxFiles)
+		fm.audit = NewFileAuditLogger(fm.auditLog, fm.changes)
+	}
+
+	if gitConfig.BranchTemplate != "" {
+		if err := validateBranchNameTemplate(gitConfig.BranchTemplate); err != nil {
+			slog.Warn("Ignoring invalid GIT_BRANCH_TEMPLATE", "error", err)
+			gitConfig.BranchTemplate = ""
+		}
 	}
 
 	// Initialize git provider if configured via environment
 	if gitConfig.IsConfigured() {
 		provider, err := git.NewProvider(gitConfig)
 		if err != nil {
-			log.Printf("Warning: Git provider initialization failed: %v", err)
+			slog.Warn("Git provider initialization failed", "error", err)
 		} else {
 			fm.gitProvider = provider
-			log.Printf("Git provider configured: %s", gitConfig.Provider)
+			slog.Info("Git provider configured", "provider", gitConfig.Provider)
 		}
 	}
 
+	if promoted, err := fm.promoteMetadataTags(context.Background()); err != nil {
+		slog.Warn("Promoting metadata tags failed", "error", err)
+	} else if promoted > 0 {
+		slog.Info("Promoted metadata tags to flag tags", "flags", promoted)
+	}
+	fm.checkRoleMappings(context.Background())
+	if err := fm.reloadAuditSinks(context.Background()); err != nil {
+		slog.Warn("Loading audit sinks failed", "error", err)
+	}
+	if err := fm.reloadNotifiers(context.Background()); err != nil {
+		slog.Warn("Loading notifiers failed", "error", err)
+	}
+	if err := fm.reloadPublishTargets(context.Background()); err != nil {
+		slog.Warn("Loading publish targets failed", "error", err)
+	}
+
 	// Setup routes
 	r := mux.NewRouter()
 
-	// Health check (no auth)
+	// Health check and probes (no auth)
 	r.HandleFunc("/health", fm.healthHandler).Methods("GET")
+	r.HandleFunc("/healthz", fm.livenessHandler).Methods("GET")
+	r.HandleFunc("/readyz", fm.readinessHandler).Methods("GET")
+
+	// Prometheus metrics (admin only)
+	r.Handle("/metrics", fm.requirePermission("*", "admin")(http.HandlerFunc(fm.metricsHandler))).Methods("GET")
 
-	// API subrouter with middleware chain
+	// API subrouter with middleware chain; every route is authorized by the
+	// permission it needs
 	api := r.PathPrefix("/api").Subrouter()
+	api.Use(fm.authorize)
 
 	// Configuration endpoint
 	api.HandleFunc("/config", fm.getConfigHandler).Methods("GET")
 
+	// Server settings
+	api.HandleFunc("/settings", fm.getSettingsHandler).Methods("GET")
+	api.HandleFunc("/settings", fm.updateSettingsHandler).Methods("PUT")
+
 	// Raw flags endpoint for relay proxy HTTP retriever (no auth required)
 	api.HandleFunc("/flags/raw", fm.getRawFlagsHandler).Methods("GET")
 	api.HandleFunc("/flags/raw/{project}", fm.getRawProjectFlagsHandler).Methods("GET")
+	api.HandleFunc("/flags/signing-key", fm.signingKeyHandler).Methods("GET")
+
+	// OpenFeature (flagd) flag definition export
+	api.HandleFunc("/flags/openfeature", fm.getOpenFeatureFlagsHandler).Methods("GET")
+
+	// Flag differences between two projects or project environments
+	api.HandleFunc("/diff", fm.diffHandler).Methods("GET")
+
+	// Stale and expired flags across all projects
+	api.HandleFunc("/flags/stale", fm.staleFlagsHandler).Methods("GET")
+	api.HandleFunc("/flags/owned", fm.ownedFlagsHandler).Methods("GET")
+	api.HandleFunc("/tags", fm.listTagsHandler).Methods("GET")
+	api.HandleFunc("/search", fm.searchHandler).Methods("GET")
+
+	// Flag evaluation against a sample evaluation context (OFREP request/response shape)
+	api.HandleFunc("/evaluate/{project}/{flagKey}", fm.evaluateFlagHandler).Methods("POST")
 
 	// Project management
 	api.HandleFunc("/projects", fm.listProjectsHandler).Methods("GET")
 	api.HandleFunc("/projects/{project}", fm.getProjectHandler).Methods("GET")
 	api.HandleFunc("/projects/{project}", fm.createProjectHandler).Methods("POST")
 	api.HandleFunc("/projects/{project}", fm.deleteProjectHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{project}/attributes", fm.listProjectAttributesHandler).Methods("GET")
+
+	// Deleted projects, until restored or purged
+	api.HandleFunc("/trash", fm.listTrashHandler).Methods("GET")
+	api.HandleFunc("/trash/{id}/restore", fm.restoreTrashHandler).Methods("POST")
+	api.HandleFunc("/trash/{id}", fm.purgeTrashHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{project}/git-diff", fm.getProjectGitDiffHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/webhook", fm.getProjectWebhookHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/webhook", fm.updateProjectWebhookHandler).Methods("PUT")
+	api.HandleFunc("/projects/{project}/webhook", fm.deleteProjectWebhookHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{project}/webhooks", fm.listProjectWebhookSubscriptionsHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/webhooks", fm.createProjectWebhookSubscriptionHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/webhooks/{id}", fm.getProjectWebhookSubscriptionHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/webhooks/{id}", fm.updateProjectWebhookSubscriptionHandler).Methods("PUT")
+	api.HandleFunc("/projects/{project}/webhooks/{id}", fm.deleteProjectWebhookSubscriptionHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{project}/webhooks/{id}/deliveries", fm.listProjectWebhookDeliveriesHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/webhooks/{id}/deliveries/{deliveryId}/redeliver", fm.redeliverProjectWebhookHandler).Methods("POST")
+
+	// Flag key naming rules per project, and linting flags files against them
+	api.HandleFunc("/projects/{project}/naming-rules", fm.getNamingRulesHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/naming-rules", fm.updateNamingRulesHandler).Methods("PUT")
+	api.HandleFunc("/projects/{project}/naming-rules", fm.deleteNamingRulesHandler).Methods("DELETE")
+	api.HandleFunc("/lint/flags", fm.lintFlagsHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/export", fm.exportProjectHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/import", fm.importProjectHandler).Methods("POST")
+
+	// Bulk operations (registered before /flags/{flagKey} so they are not taken as flag keys)
+	api.HandleFunc("/projects/{project}/flags/bulk-toggle", fm.bulkToggleHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/flags/bulk-delete", fm.bulkDeleteHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/flags/bulk-metadata", fm.bulkMetadataHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/flags/bulk-tags", fm.bulkTagsHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/flags/bulk-update-targeting", fm.bulkUpdateTargetingHandler).Methods("POST")
+
+	// Project-wide flag lint (also before /flags/{flagKey})
+	api.HandleFunc("/projects/{project}/flags/health", fm.projectHealthHandler).Methods("GET", "POST")
 
 	// Flag management
 	api.HandleFunc("/projects/{project}/flags", fm.listFlagsHandler).Methods("GET")
@@ -200,8 +497,51 @@ func main() {
 	// Flag audit history
 	api.HandleFunc("/projects/{project}/flags/{flagKey}/audit", fm.getFlagAuditHandler).Methods("GET")
 
+	// Where a flag is evaluated in code, from goff-scan manifests
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/code-references", fm.getCodeReferencesHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/reconciliation", fm.reconciliationHandler).Methods("GET")
+
+	// Project environments and per-environment flag configs
+	api.HandleFunc("/projects/{project}/environments", fm.listProjectEnvironmentsHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/environments/{environment}", fm.createProjectEnvironmentHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/environments/{environment}", fm.deleteProjectEnvironmentHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{project}/environments/{environment}/flags", fm.listEnvironmentFlagsHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/environments/{environment}/flags/{flagKey}", fm.updateEnvironmentFlagHandler).Methods("PUT")
+	api.HandleFunc("/projects/{project}/environments/{environment}/flags/{flagKey}", fm.deleteEnvironmentFlagHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/promote", fm.promoteFlagHandler).Methods("POST")
+
+	// Stale flag acknowledgement
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/ack-stale", fm.ackStaleFlagHandler).Methods("POST")
+
 	// PR/MR endpoints for git-backed changes
 	api.HandleFunc("/projects/{project}/flags/{flagKey}/propose", fm.proposeFlagChangeHandler).Methods("POST")
+	api.HandleFunc("/proposals", fm.listProposalsHandler).Methods("GET")
+
+	// What-if simulation of a saved or draft flag against sample contexts
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/simulate", fm.simulateFlagHandler).Methods("POST")
+
+	// Draft flags are not served until published
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/publish", fm.publishFlagHandler).Methods("POST")
+
+	// Archived flags are not served until restored, and are purged after the retention
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/archive", fm.archiveFlagHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/restore", fm.restoreFlagHandler).Methods("POST")
+
+	// Ramps advanced step by step by the rollout controller, halted by their metrics check
+	api.HandleFunc("/ramps", fm.listRampsHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/ramp", fm.getFlagRampHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/ramp", fm.putFlagRampHandler).Methods("PUT")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/ramp", fm.deleteFlagRampHandler).Methods("DELETE")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/ramp/pause", fm.pauseFlagRampHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/ramp/resume", fm.resumeFlagRampHandler).Methods("POST")
+
+	// Flag version history and rollback
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/versions", fm.getFlagVersionsHandler).Methods("GET")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/rollback/{versionId}", fm.rollbackFlagHandler).Methods("POST")
+
+	// Evaluation statistics from events ingested from the relay proxy (DB mode only)
+	api.HandleFunc("/evaluations", fm.ingestEvaluationsHandler).Methods("POST")
+	api.HandleFunc("/projects/{project}/flags/{flagKey}/stats", fm.flagStatsHandler).Methods("GET")
 
 	// Git integrations management
 	api.HandleFunc("/integrations", fm.listIntegrationsHandler).Methods("GET")
@@ -210,6 +550,10 @@ func main() {
 	api.HandleFunc("/integrations/{id}", fm.updateIntegrationHandler).Methods("PUT")
 	api.HandleFunc("/integrations/{id}", fm.deleteIntegrationHandler).Methods("DELETE")
 	api.HandleFunc("/integrations/{id}/test", fm.testIntegrationHandler).Methods("POST")
+	api.HandleFunc("/integrations/{id}/sync", fm.syncIntegrationHandler).Methods("POST")
+
+	// Git push webhooks (verified by the integration's webhook secret, no auth)
+	api.HandleFunc("/webhooks/git/{integrationId}", fm.gitWebhookHandler).Methods("POST")
 
 	// Flag sets management
 	api.HandleFunc("/flagsets", fm.listFlagSetsHandler).Methods("GET")
@@ -220,6 +564,8 @@ func main() {
 	api.HandleFunc("/flagsets/{id}/apikey", fm.generateFlagSetAPIKeyHandler).Methods("POST")
 	api.HandleFunc("/flagsets/{id}/apikey", fm.removeFlagSetAPIKeyHandler).Methods("DELETE")
 	api.HandleFunc("/flagsets/{id}/flags", fm.listFlagSetFlagsHandler).Methods("GET")
+	api.HandleFunc("/flagsets/{id}/flags/raw", fm.getFlagSetRawFlagsHandler).Methods("GET")
+	api.HandleFunc("/flagsets/{id}/effective-flags", fm.getFlagSetEffectiveFlagsHandler).Methods("GET")
 	api.HandleFunc("/flagsets/{id}/flags/{flagKey}", fm.getFlagSetFlagHandler).Methods("GET")
 	api.HandleFunc("/flagsets/{id}/flags/{flagKey}", fm.createFlagSetFlagHandler).Methods("POST")
 	api.HandleFunc("/flagsets/{id}/flags/{flagKey}", fm.updateFlagSetFlagHandler).Methods("PUT")
@@ -233,6 +579,21 @@ func main() {
 	api.HandleFunc("/notifiers/{id}", fm.updateNotifierHandler).Methods("PUT")
 	api.HandleFunc("/notifiers/{id}", fm.deleteNotifierHandler).Methods("DELETE")
 	api.HandleFunc("/notifiers/{id}/test", fm.testNotifierHandler).Methods("POST")
+	api.HandleFunc("/notifiers/{id}/status", fm.notifierStatusHandler).Methods("GET")
+	api.HandleFunc("/notification-rules", fm.listNotificationRulesHandler).Methods("GET")
+	api.HandleFunc("/notification-rules", fm.createNotificationRuleHandler).Methods("POST")
+	api.HandleFunc("/notification-rules/evaluate", fm.evaluateNotificationRulesHandler).Methods("POST")
+	api.HandleFunc("/notification-rules/{id}", fm.getNotificationRuleHandler).Methods("GET")
+	api.HandleFunc("/notification-rules/{id}", fm.updateNotificationRuleHandler).Methods("PUT")
+	api.HandleFunc("/notification-rules/{id}", fm.deleteNotificationRuleHandler).Methods("DELETE")
+
+	// Policies checked on flag creates and updates
+	api.HandleFunc("/policies", fm.listPoliciesHandler).Methods("GET")
+	api.HandleFunc("/policies", fm.createPolicyHandler).Methods("POST")
+	api.HandleFunc("/policies/validate", fm.validatePoliciesHandler).Methods("POST")
+	api.HandleFunc("/policies/{id}", fm.getPolicyHandler).Methods("GET")
+	api.HandleFunc("/policies/{id}", fm.updatePolicyHandler).Methods("PUT")
+	api.HandleFunc("/policies/{id}", fm.deletePolicyHandler).Methods("DELETE")
 
 	// Exporters management
 	api.HandleFunc("/exporters", fm.listExportersHandler).Methods("GET")
@@ -247,18 +608,53 @@ func main() {
 	api.HandleFunc("/retrievers/{id}", fm.getRetrieverHandler).Methods("GET")
 	api.HandleFunc("/retrievers/{id}", fm.updateRetrieverHandler).Methods("PUT")
 	api.HandleFunc("/retrievers/{id}", fm.deleteRetrieverHandler).Methods("DELETE")
+	api.HandleFunc("/retrievers/{id}/usage", fm.getRetrieverUsageHandler).Methods("GET")
 
 	// Admin endpoints
 	api.HandleFunc("/admin/refresh", fm.refreshRelayProxyHandler).Methods("POST")
-
-	// Audit endpoints (DB mode only)
+	api.HandleFunc("/relay-proxy/status", fm.relayProxyStatusHandler).Methods("GET")
+	api.Handle("/admin/backup", fm.requirePermission("*", "admin")(http.HandlerFunc(fm.backupHandler))).Methods("GET")
+	api.Handle("/admin/restore", fm.requirePermission("*", "admin")(http.HandlerFunc(fm.restoreHandler))).Methods("POST")
+	api.HandleFunc("/admin/rate-limits", fm.listRateLimitsHandler).Methods("GET")
+	api.HandleFunc("/admin/rate-limits", fm.resetRateLimitsHandler).Methods("DELETE")
+	api.HandleFunc("/admin/rate-limits/{client}", fm.resetRateLimitHandler).Methods("DELETE")
+	api.HandleFunc("/admin/secrets/rotate", fm.rotateSecretsHandler).Methods("POST")
+	api.Handle("/apply", fm.requirePermission("*", "admin")(http.HandlerFunc(fm.applyHandler))).Methods("POST")
+
+	// Audit endpoints (audit.jsonl in file mode)
 	api.HandleFunc("/audit", fm.listAuditEventsHandler).Methods("GET")
 	api.HandleFunc("/audit/export", fm.exportAuditEventsHandler).Methods("GET")
 
+	// Audit sinks (streaming audit events to webhooks, Kafka and syslog)
+	api.HandleFunc("/audit/sinks", fm.listAuditSinksHandler).Methods("GET")
+	api.HandleFunc("/audit/sinks", fm.createAuditSinkHandler).Methods("POST")
+	api.HandleFunc("/audit/sinks/{id}", fm.getAuditSinkHandler).Methods("GET")
+	api.HandleFunc("/audit/sinks/{id}", fm.updateAuditSinkHandler).Methods("PUT")
+	api.HandleFunc("/audit/sinks/{id}", fm.deleteAuditSinkHandler).Methods("DELETE")
+	api.HandleFunc("/audit/sinks/{id}/test", fm.testAuditSinkHandler).Methods("POST")
+	api.HandleFunc("/audit/sinks/{id}/dead-letters", fm.listAuditDeadLettersHandler).Methods("GET")
+	api.HandleFunc("/audit/sinks/{id}/dead-letters", fm.clearAuditDeadLettersHandler).Methods("DELETE")
+	api.HandleFunc("/audit/sinks/{id}/dead-letters/retry", fm.retryAuditDeadLettersHandler).Methods("POST")
+
+	// Publish targets
+	api.HandleFunc("/publish-targets", fm.listPublishTargetsHandler).Methods("GET")
+	api.HandleFunc("/publish-targets", fm.createPublishTargetHandler).Methods("POST")
+	api.HandleFunc("/publish-targets/{id}", fm.getPublishTargetHandler).Methods("GET")
+	api.HandleFunc("/publish-targets/{id}", fm.updatePublishTargetHandler).Methods("PUT")
+	api.HandleFunc("/publish-targets/{id}", fm.deletePublishTargetHandler).Methods("DELETE")
+	api.HandleFunc("/publish-targets/{id}/publish", fm.publishTargetHandler).Methods("POST")
+
+	// Change feed (audit events over WebSocket, per-project/flag set subscriptions)
+	api.HandleFunc("/ws", fm.changeFeedHandler).Methods("GET")
+
+	// Flag change analytics (derived from audit events)
+	api.HandleFunc("/analytics/activity", fm.getActivityAnalyticsHandler).Methods("GET")
+
 	// API Key management endpoints (DB mode only)
 	api.HandleFunc("/api-keys", fm.listAPIKeysHandler).Methods("GET")
 	api.HandleFunc("/api-keys", fm.createAPIKeyHandler).Methods("POST")
 	api.HandleFunc("/api-keys/{id}", fm.deleteAPIKeyHandler).Methods("DELETE")
+	api.HandleFunc("/api-keys/{id}/rotate", fm.rotateAPIKeyHandler).Methods("POST")
 
 	// RBAC: Role management
 	api.HandleFunc("/roles", fm.listRolesHandler).Methods("GET")
@@ -269,27 +665,43 @@ func main() {
 	// RBAC: User management
 	api.HandleFunc("/users", fm.listUsersHandler).Methods("GET")
 	api.HandleFunc("/users/{userId}/roles", fm.setUserRolesHandler).Methods("PUT")
+	api.HandleFunc("/users/{userId}/permissions", fm.userPermissionsHandler).Methods("GET")
+
+	// OIDC role mappings (JWT_ROLE_MAPPINGS)
+	api.HandleFunc("/auth/role-mappings", fm.listRoleMappingsHandler).Methods("GET")
+	api.HandleFunc("/auth/role-mappings/debug", fm.debugRoleMappingsHandler).Methods("POST")
 
 	// Segments management
+	// Flag templates, defined by admins
+	api.HandleFunc("/templates", fm.listFlagTemplatesHandler).Methods("GET")
+	api.Handle("/templates", fm.requirePermission("*", "admin")(http.HandlerFunc(fm.createFlagTemplateHandler))).Methods("POST")
+	api.HandleFunc("/templates/{id}", fm.getFlagTemplateHandler).Methods("GET")
+	api.Handle("/templates/{id}", fm.requirePermission("*", "admin")(http.HandlerFunc(fm.updateFlagTemplateHandler))).Methods("PUT")
+	api.Handle("/templates/{id}", fm.requirePermission("*", "admin")(http.HandlerFunc(fm.deleteFlagTemplateHandler))).Methods("DELETE")
+
 	api.HandleFunc("/segments", fm.listSegmentsHandler).Methods("GET")
 	api.HandleFunc("/segments", fm.createSegmentHandler).Methods("POST")
+	api.HandleFunc("/segments/validate", fm.validateSegmentHandler).Methods("POST")
 	api.HandleFunc("/segments/{id}", fm.getSegmentHandler).Methods("GET")
 	api.HandleFunc("/segments/{id}", fm.updateSegmentHandler).Methods("PUT")
 	api.HandleFunc("/segments/{id}", fm.deleteSegmentHandler).Methods("DELETE")
 	api.HandleFunc("/segments/{id}/usage", fm.getSegmentUsageHandler).Methods("GET")
+	api.HandleFunc("/segments/{id}/rename-preview", fm.segmentRenamePreviewHandler).Methods("GET")
+	api.HandleFunc("/segments/{id}/versions", fm.listSegmentVersionsHandler).Methods("GET")
+	api.HandleFunc("/segments/{id}/rollback/{version}", fm.rollbackSegmentHandler).Methods("POST")
 
 	// Change requests (approval workflow)
 	api.HandleFunc("/change-requests", fm.listChangeRequestsHandler).Methods("GET")
 	api.HandleFunc("/change-requests", fm.createChangeRequestHandler).Methods("POST")
 	api.HandleFunc("/change-requests/count", fm.countChangeRequestsHandler).Methods("GET")
+	api.HandleFunc("/change-requests/bulk-cancel", fm.bulkCancelChangeRequestsHandler).Methods("POST")
 	api.HandleFunc("/change-requests/{id}", fm.getChangeRequestHandler).Methods("GET")
+	api.HandleFunc("/change-requests/{id}/preview", fm.previewChangeRequestHandler).Methods("GET")
 	api.HandleFunc("/change-requests/{id}/review", fm.reviewChangeRequestHandler).Methods("POST")
 	api.HandleFunc("/change-requests/{id}/apply", fm.applyChangeRequestHandler).Methods("POST")
 	api.HandleFunc("/change-requests/{id}/cancel", fm.cancelChangeRequestHandler).Methods("POST")
 
-	// Bulk operations
-	api.HandleFunc("/projects/{project}/flags/bulk-toggle", fm.bulkToggleHandler).Methods("POST")
-	api.HandleFunc("/projects/{project}/flags/bulk-delete", fm.bulkDeleteHandler).Methods("POST")
+	// Clone
 	api.HandleFunc("/projects/{project}/flags/{flagKey}/clone", fm.cloneFlagHandler).Methods("POST")
 
 	// Flag discovery import
@@ -298,37 +710,100 @@ func main() {
 	// Build middleware chain
 	var handler http.Handler = r
 	handler = BodySizeLimitMiddleware(1 << 20)(handler) // 1MB
+	handler = fm.rateLimits.middleware(handler)         // per client, so after auth
 	handler = fm.AuthMiddleware(handler)
-	handler = RateLimitMiddleware(handler)
-	handler = CORSMiddleware(handler)
+	handler = fm.rateLimits.authMiddleware(handler) // failed authentications per address
+	handler = CORSMiddleware(config.CORS)(handler)
+	handler = MetricsMiddleware(r)(handler)
 	handler = LoggingMiddleware(handler)
-
-	log.Printf("Flag Manager API starting on port %s", config.Port)
-	if config.DatabaseURL != "" {
-		log.Printf("Database: PostgreSQL")
-	} else {
-		log.Printf("Flags directory: %s", config.FlagsDir)
+	handler = RequestIDMiddleware(handler)
+
+	slog.Info("Flag Manager API starting",
+		"port", config.Port,
+		"storage", fm.storageName(),
+		"relay_proxy_url", config.RelayProxyURL,
+		"relay_proxy_targets", len(config.RelayTargets),
+		"auth_enabled", config.AuthEnabled,
+		"jwt_issuer", config.JWTIssuerURL,
+		"require_approvals", config.RequireApprovals,
+		"require_change_notes", config.RequireChangeNotes,
+		"enforce_flag_owners", config.EnforceFlagOwners)
+	if fm.store == nil {
+		slog.Info("Flags directory", "path", config.FlagsDir)
 	}
-	log.Printf("Relay Proxy URL: %s", config.RelayProxyURL)
-	if config.AuthEnabled {
-		log.Printf("Auth: enabled (JWT issuer: %s)", config.JWTIssuerURL)
+	if gitConfig.IsConfigured() {
+		slog.Info("Git provider enabled", "provider", gitConfig.Provider)
 	} else {
-		log.Printf("Auth: disabled")
+		slog.Info("Git provider: none (file-based storage)")
 	}
-	if config.RequireApprovals {
-		log.Printf("Approval workflow: enabled")
+	jobs := newBackgroundJobs(context.Background())
+	if config.RefreshInterval > 0 && len(fm.relayTargets()) > 0 {
+		slog.Info("Scheduled relay refresh enabled", "interval", config.RefreshInterval)
+		jobs.start(func(ctx context.Context) { fm.runScheduledRefresh(ctx, config.RefreshInterval) })
 	}
-	if config.RequireChangeNotes {
-		log.Printf("Change notes: required")
+	if config.SchedulerInterval > 0 {
+		slog.Info("Rollout scheduler enabled", "interval", config.SchedulerInterval)
+		jobs.start(func(ctx context.Context) { fm.runRolloutScheduler(ctx, config.SchedulerInterval) })
 	}
-	if gitConfig.IsConfigured() {
-		log.Printf("Git Provider: %s", gitConfig.Provider)
-	} else {
-		log.Printf("Git Provider: none (file-based storage)")
+	if config.RampInterval > 0 {
+		slog.Info("Rollout controller enabled", "interval", config.RampInterval)
+		jobs.start(func(ctx context.Context) { fm.runRolloutController(ctx, config.RampInterval) })
 	}
+	if config.StaleReaperInterval > 0 {
+		slog.Info("Stale flag reaper enabled", "interval", config.StaleReaperInterval, "action", config.StaleReaperAction)
+		jobs.start(func(ctx context.Context) {
+			fm.runStaleReaper(ctx, config.StaleReaperInterval, config.StaleReaperAction)
+		})
+	}
+	if config.ProposalPollInterval > 0 {
+		slog.Info("Proposal poller enabled", "interval", config.ProposalPollInterval, "auto_refresh", config.ProposalAutoRefresh)
+		jobs.start(func(ctx context.Context) { fm.runProposalPoller(ctx, config.ProposalPollInterval) })
+	}
+	if configMapTarget != nil {
+		client, err := newInClusterKubeClient()
+		if err != nil {
+			logFatal("ConfigMap writer initialization failed", "error", err)
+		}
+		fm.configMap = NewConfigMapWriter(client, *configMapTarget, podIdentity(), fm.renderFlagsConfigMap)
+		slog.Info("ConfigMap writer enabled", "namespace", configMapTarget.Namespace, "name", configMapTarget.Name,
+			"key", configMapTarget.Key, "lease", configMapTarget.Lease)
+		jobs.start(fm.configMap.run)
+	}
+	if fm.store != nil && config.EvaluationRetention > 0 {
+		slog.Info("Evaluation retention enabled", "retention", config.EvaluationRetention)
+		jobs.start(func(ctx context.Context) { fm.runEvaluationRetention(ctx, evaluationRetentionInterval) })
+	}
+	if config.FlagArchiveRetention > 0 {
+		slog.Info("Archived flag purge enabled", "retention", config.FlagArchiveRetention)
+		jobs.start(func(ctx context.Context) { fm.runArchivePurge(ctx, archivePurgeInterval) })
+	}
+	if config.ProjectTrashRetention > 0 {
+		slog.Info("Project trash purge enabled", "retention", config.ProjectTrashRetention)
+		jobs.start(func(ctx context.Context) { fm.runTrashPurge(ctx, trashPurgeInterval) })
+	}
+
+	// Requests outlive the signal so that they can finish; cancelling their
+	// base context aborts those still running after the shutdown timeout
+	requests, cancelRequests := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRequests()
+	srv := newHTTPServer(requests, config, handler)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-serveErr:
+		logFatal("Server failed", "error", err)
+	case <-ctx.Done():
+	}
+	stopSignals()
+	slog.Info("Shutting down", "timeout", config.ShutdownTimeout)
 
-	if err := http.ListenAndServe(":"+config.Port, handler); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.ShutdownTimeout)
+	defer cancel()
+	if err := fm.shutdown(shutdownCtx, srv, jobs); err != nil {
+		slog.Warn("Shutdown incomplete", "error", err)
+	} else {
+		slog.Info("Shutdown complete")
 	}
 }
 
@@ -339,44 +814,134 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// refreshRelayProxy triggers the relay proxy to refresh its flags
-func (fm *FlagManager) refreshRelayProxy() error {
-	if fm.config.RelayProxyURL == "" {
-		return nil
+// loadProjectFlags returns a project's flags from whichever backend is active,
+// with segment references expanded in database mode. It returns nil flags
+// without an error when the project does not exist.
+func (fm *FlagManager) loadProjectFlags(ctx context.Context, project string) (ProjectFlags, error) {
+	return fm.loadProjectFlagsExpanded(ctx, project, true)
+}
+
+// loadServedProjectFlags returns a project's flags as served to the relay
+// proxy: like loadProjectFlags, without draft flags.
+func (fm *FlagManager) loadServedProjectFlags(ctx context.Context, project string) (ProjectFlags, error) {
+	flags, err := fm.storage.ListPublishedFlags(ctx, project)
+	if errors.Is(err, errProjectNotFound) {
+		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	return fm.expandProjectSegments(ctx, flags)
+}
 
-	url := fm.config.RelayProxyURL + "/admin/v1/retriever/refresh"
+// loadStoredProjectFlags is like loadProjectFlags but returns flags exactly as
+// stored, for read-modify-write cycles. The caller must hold the project's
+// storage lock.
+func (fm *FlagManager) loadStoredProjectFlags(ctx context.Context, project string) (ProjectFlags, error) {
+	return fm.loadProjectFlagsExpanded(ctx, project, false)
+}
 
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		return err
+// saveStoredProjectFlags persists the changed flags of a set loaded with
+// loadStoredProjectFlags, all at once. It returns the database IDs of the saved
+// flags (empty in file mode).
+func (fm *FlagManager) saveStoredProjectFlags(ctx context.Context, project string, flags ProjectFlags, changed []string) (map[string]string, error) {
+	return fm.storage.SaveFlags(ctx, project, flags, changed)
+}
+
+func (fm *FlagManager) loadProjectFlagsExpanded(ctx context.Context, project string, expandSegments bool) (ProjectFlags, error) {
+	flags, err := fm.storage.ListFlags(ctx, project)
+	if errors.Is(err, errProjectNotFound) {
+		return nil, nil
+	}
+	if err != nil || !expandSegments {
+		return flags, err
+	}
+	return fm.expandProjectSegments(ctx, flags)
+}
+
+// refreshRelayProxy triggers every relay proxy target to refresh its flags
+// and returns the failures joined.
+func (fm *FlagManager) refreshRelayProxy(ctx context.Context) error {
+	var errs []error
+	for _, target := range fm.relayTargets() {
+		if err := fm.refreshRelayTarget(ctx, target); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	if fm.config.AdminAPIKey != "" {
-		req.Header.Set("Authorization", "Bearer "+fm.config.AdminAPIKey)
+// refreshRelayTarget triggers a relay proxy to refresh its flags. The request
+// ID of ctx is forwarded to the relay proxy; cancelling ctx does not abort the
+// refresh, so handlers can start it in the background with their own context.
+func (fm *FlagManager) refreshRelayTarget(ctx context.Context, target RelayTarget) error {
+	url, err := relayRefreshURL(target.URL, fm.config.RelayRefreshPath)
+	if err != nil {
+		return err
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), "POST", url, nil)
 	if err != nil {
-		log.Printf("Warning: Failed to refresh relay proxy: %v", err)
 		return err
 	}
-	defer resp.Body.Close()
+	setRelayAuth(req, fm.config, target)
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
 
-	if resp.StatusCode >= 400 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Warning: Relay proxy refresh returned status %d: %s", resp.StatusCode, string(body))
+	client := httpclient.Default()
+	start := time.Now()
+	var resp *http.Response
+	err = fm.outbound.Do(func() error {
+		resp, err = client.Do(req)
+		return err
+	})
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			body, _ := io.ReadAll(resp.Body)
+			err = fmt.Errorf("relay proxy returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
 	}
 
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	fm.relayStates.get(target.Name).refreshes.record(ctx, start, statusCode, err)
+	if err != nil {
+		relayRefreshTotal.Add(1, "target", target.Name, "result", "failure")
+		slog.WarnContext(ctx, "Relay proxy refresh failed", "target", target.Name, "error", err)
+		return err
+	}
+	relayRefreshTotal.Add(1, "target", target.Name, "result", "success")
 	return nil
 }
 
 // Handler implementations
 
+// HealthResponse is the body of the health check.
+type HealthResponse struct {
+	Healthy bool `json:"healthy"`
+}
+
 func (fm *FlagManager) healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"healthy": true})
+	json.NewEncoder(w).Encode(HealthResponse{Healthy: true})
+}
+
+// ConfigResponse describes how the flag manager is configured.
+type ConfigResponse struct {
+	GitProvider        string `json:"gitProvider"`
+	GitConfigured      bool   `json:"gitConfigured"`
+	FlagsDir           string `json:"flagsDir"`
+	RelayProxyURL      string `json:"relayProxyURL"`
+	AuthEnabled        bool   `json:"authEnabled"`
+	DBEnabled          bool   `json:"dbEnabled"`
+	AuditEnabled       bool   `json:"auditEnabled"`
+	RequireApprovals   bool   `json:"requireApprovals"`
+	RequireChangeNotes bool   `json:"requireChangeNotes"`
+	EnforceFlagOwners  bool   `json:"enforceFlagOwners"`
 }
 
 func (fm *FlagManager) getConfigHandler(w http.ResponseWriter, r *http.Request) {
@@ -386,126 +951,122 @@ func (fm *FlagManager) getConfigHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"gitProvider":        gitProvider,
-		"gitConfigured":      fm.gitProvider != nil,
-		"flagsDir":           fm.config.FlagsDir,
-		"relayProxyURL":      fm.config.RelayProxyURL,
-		"authEnabled":        fm.authEnabled,
-		"dbEnabled":          fm.store != nil,
-		"requireApprovals":   fm.requireApprovals,
-		"requireChangeNotes": fm.requireChangeNotes,
+	json.NewEncoder(w).Encode(ConfigResponse{
+		GitProvider:        gitProvider,
+		GitConfigured:      fm.gitProvider != nil,
+		FlagsDir:           fm.config.FlagsDir,
+		RelayProxyURL:      fm.config.RelayProxyURL,
+		AuthEnabled:        fm.authEnabled,
+		DBEnabled:          fm.store != nil,
+		AuditEnabled:       fm.store != nil || fm.auditLog != nil,
+		RequireApprovals:   fm.requireApprovals,
+		RequireChangeNotes: fm.requireChangeNotes,
+		EnforceFlagOwners:  fm.enforceFlagOwners,
 	})
 }
 
 func (fm *FlagManager) getRawFlagsHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store != nil {
-		allFlags, err := fm.store.GetAllFlags(r.Context())
+	r, cached := fm.serveCachedRawFlags(w, r)
+	if cached {
+		return
+	}
+
+	// ?environment= serves each project's flags as configured in that environment
+	if env := r.URL.Query().Get("environment"); env != "" {
+		projects, err := fm.listAllProjects(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
-		// Expand segment references in targeting rules
-		allFlags = fm.expandSegmentRules(r.Context(), allFlags)
-		// Convert json.RawMessage values to interface{} for yaml serialization
-		yamlFlags := make(map[string]interface{})
-		for k, v := range allFlags {
-			var parsed interface{}
-			json.Unmarshal(v, &parsed)
-			yamlFlags[k] = parsed
-		}
-		w.Header().Set("Content-Type", "application/x-yaml")
-		yaml.NewEncoder(w).Encode(yamlFlags)
+		fm.writeRawEnvironmentFlags(w, r, projects, env, true)
 		return
 	}
 
-	// File-based fallback
-	fm.getRawFlagsFileBased(w, r)
+	fm.writeRawFlags(w, r, fm.eachServedFlag(r.Context()), "")
 }
 
 func (fm *FlagManager) getRawProjectFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	r, cached := fm.serveCachedRawFlags(w, r)
+	if cached {
+		return
+	}
 	vars := mux.Vars(r)
 	project := vars["project"]
 
-	if fm.store != nil {
-		flags, err := fm.store.GetProjectFlags(r.Context(), project)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	if env := r.URL.Query().Get("environment"); env != "" {
+		if fm.requireProjectEnvironment(w, r, project, env) {
+			fm.writeRawEnvironmentFlags(w, r, []string{project}, env, false)
 		}
-		if len(flags) == 0 {
-			// Check if project exists
-			exists, _ := fm.store.ProjectExists(r.Context(), project)
-			if !exists {
-				http.Error(w, "Project not found", http.StatusNotFound)
-				return
-			}
-		}
-		// Expand segment references
-		flags = fm.expandSegmentRules(r.Context(), flags)
-		yamlFlags := make(map[string]interface{})
-		for k, v := range flags {
-			var parsed interface{}
-			json.Unmarshal(v, &parsed)
-			yamlFlags[k] = parsed
-		}
-		w.Header().Set("Content-Type", "application/x-yaml")
-		yaml.NewEncoder(w).Encode(yamlFlags)
 		return
 	}
 
-	fm.getRawProjectFlagsFileBased(w, r)
+	flags, err := fm.loadServedProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if flags == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	fm.writeRawFlags(w, r, flags, "")
+}
+
+// ProjectsResponse lists the projects.
+type ProjectsResponse struct {
+	Projects []string `json:"projects"`
 }
 
 func (fm *FlagManager) listProjectsHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store != nil {
-		projects, err := fm.store.ListProjects(r.Context())
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if projects == nil {
-			projects = []string{}
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string][]string{"projects": projects})
+	projects, err := fm.listAllProjects(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
+	if projects == nil {
+		projects = []string{}
+	}
+	if readable := fm.readableIn(r, "project"); readable != nil {
+		projects = slices.DeleteFunc(projects, func(p string) bool { return !readable(p, "") })
+	}
 
-	fm.listProjectsFileBased(w, r)
+	if wantsPage(r) {
+		writePage(w, r, pageList(r, projects, func(p string) string { return p },
+			listSorts[string]{"name": cmp.Compare[string]}, "name"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProjectsResponse{Projects: projects})
+}
+
+// ProjectResponse is a project with its flags.
+type ProjectResponse struct {
+	Project string       `json:"project"`
+	Flags   ProjectFlags `json:"flags"`
 }
 
 func (fm *FlagManager) getProjectHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	project := vars["project"]
 
-	if fm.store != nil {
-		flags, err := fm.store.ListFlags(r.Context(), project)
-		if err != nil {
-			exists, _ := fm.store.ProjectExists(r.Context(), project)
-			if !exists {
-				http.Error(w, "Project not found", http.StatusNotFound)
-				return
-			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		// Convert to FlagConfig map for backward compat
-		flagMap := make(map[string]interface{})
-		for k, v := range flags {
-			var parsed interface{}
-			json.Unmarshal(v, &parsed)
-			flagMap[k] = parsed
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"project": project,
-			"flags":   flagMap,
-		})
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil {
+		writeStorageError(w, err)
 		return
 	}
 
-	fm.getProjectFileBased(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProjectResponse{
+		Project: project,
+		Flags:   flags,
+	})
+}
+
+// CreateProjectResponse acknowledges a new project.
+type CreateProjectResponse struct {
+	Project string `json:"project"`
+	Status  string `json:"status"`
 }
 
 func (fm *FlagManager) createProjectHandler(w http.ResponseWriter, r *http.Request) {
@@ -517,94 +1078,137 @@ func (fm *FlagManager) createProjectHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if fm.store != nil {
-		exists, _ := fm.store.ProjectExists(r.Context(), project)
-		if exists {
-			http.Error(w, "Project already exists", http.StatusConflict)
-			return
-		}
-		if _, err := fm.store.CreateProject(r.Context(), project, ""); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		fm.audit.Log(r.Context(), GetActor(r), "project.created", "project", "", project, project, nil, nil)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]string{"project": project, "status": "created"})
+	if err := fm.storage.CreateProject(r.Context(), project); err != nil {
+		writeStorageError(w, err)
 		return
 	}
+	fm.audit.Log(r.Context(), GetActor(r), "project.created", "project", "", project, project, nil, nil)
 
-	fm.createProjectFileBased(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateProjectResponse{Project: project, Status: "created"})
 }
 
 func (fm *FlagManager) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	project := vars["project"]
 
-	if fm.store != nil {
-		if err := fm.store.DeleteProject(r.Context(), project); err != nil {
-			if strings.Contains(err.Error(), "not found") {
-				http.Error(w, "Project not found", http.StatusNotFound)
-			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
-			return
-		}
-		fm.audit.Log(r.Context(), GetActor(r), "project.deleted", "project", "", project, project, nil, nil)
-		go fm.refreshRelayProxy()
-		w.WriteHeader(http.StatusNoContent)
+	trashed, err := fm.storage.DeleteProject(r.Context(), project)
+	if err != nil {
+		writeStorageError(w, err)
 		return
 	}
+	fm.audit.Log(r.Context(), GetActor(r), "project.deleted", "project", "", project, project, nil,
+		map[string]interface{}{"trashId": trashed.ID})
 
-	fm.deleteProjectFileBased(w, r)
+	fm.scheduleRelayRefresh(r.Context())
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (fm *FlagManager) listFlagsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	project := vars["project"]
 
-	if fm.store != nil {
-		// Check for pagination params
-		if r.URL.Query().Get("page") != "" {
-			params := parsePaginationParams(r)
-			result, err := fm.store.ListFlagsPaginated(r.Context(), project, params)
-			if err != nil {
-				if strings.Contains(err.Error(), "not found") {
-					http.Error(w, "Project not found", http.StatusNotFound)
-				} else {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-				}
-				return
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(result)
+	tag := r.URL.Query().Get("tag")
+	if tag != "" {
+		if err := ValidateTag(tag); err != nil {
+			writeValidationError(w, "INVALID_TAG", err.Error())
 			return
 		}
+	}
 
-		// Non-paginated (backward compat)
-		flags, err := fm.store.ListFlags(r.Context(), project)
+	filter, err := parseListFilter(r)
+	if err != nil {
+		writeValidationError(w, "INVALID_FILTER", err.Error())
+		return
+	}
+	// ?archived=true lists the archived flags, which are otherwise left out
+	archived := false
+	if v := r.URL.Query().Get("archived"); v != "" {
+		if archived, err = strconv.ParseBool(v); err != nil {
+			writeValidationError(w, "INVALID_FILTER", "archived must be true or false")
+			return
+		}
+	}
+	if filter.Type != "" && !slices.Contains(flagTypes, filter.Type) {
+		writeValidationError(w, "INVALID_FILTER", "type must be one of "+strings.Join(flagTypes, ", "))
+		return
+	}
+
+	// The database pages flags itself
+	if fm.store != nil && wantsPage(r) {
+		result, err := fm.store.ListFlagsPaginated(r.Context(), project, db.FlagFilterParams{
+			PaginationParams: parsePaginationParams(r),
+			Tag:              tag,
+			Disabled:         filter.Disabled,
+			Type:             filter.Type,
+			Archived:         archived,
+		})
 		if err != nil {
-			exists, _ := fm.store.ProjectExists(r.Context(), project)
-			if !exists {
-				http.Error(w, "Project not found", http.StatusNotFound)
-				return
+			if strings.Contains(err.Error(), "not found") {
+				writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+			} else {
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
-			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		// Convert to interface map
-		flagMap := make(map[string]interface{})
+		writePage(w, r, result)
+		return
+	}
+
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	for k, v := range flags {
+		if isArchived(v) != archived || (tag != "" && !hasTag(v, tag)) || !filter.keeps(flagDisabled(v), flagType(v)) {
+			delete(flags, k)
+		}
+	}
+
+	if wantsPage(r) {
+		entries := make([]FlagResponse, 0, len(flags))
 		for k, v := range flags {
-			var parsed interface{}
-			json.Unmarshal(v, &parsed)
-			flagMap[k] = parsed
+			entries = append(entries, newFlagResponse(k, v))
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"flags": flagMap})
+		writePage(w, r, pageList(r, entries, func(f FlagResponse) string { return f.Key },
+			listSorts[FlagResponse]{"key": func(a, b FlagResponse) int { return cmp.Compare(a.Key, b.Key) }}, "key"))
 		return
 	}
 
-	fm.listFlagsFileBased(w, r)
+	flagMap := make(map[string]interface{}, len(flags))
+	for k, v := range flags {
+		flagMap[k] = v
+	}
+	writeFlagListResponse(w, r, flagMap)
+}
+
+// flagTypes are the flag types list filters accept.
+var flagTypes = []string{"boolean", "string", "number", "object"}
+
+// flagType returns the type of a flag's variation values: boolean, string,
+// number or object (also for arrays), or "" if they differ or there are none.
+func flagType(config FlagConfig) string {
+	typ := ""
+	for _, value := range config.Variations {
+		var t string
+		switch value.(type) {
+		case bool:
+			t = "boolean"
+		case string:
+			t = "string"
+		case int, int64, float64:
+			t = "number"
+		case map[string]interface{}, []interface{}:
+			t = "object"
+		}
+		if t == "" || (typ != "" && t != typ) {
+			return ""
+		}
+		typ = t
+	}
+	return typ
 }
 
 func (fm *FlagManager) getFlagHandler(w http.ResponseWriter, r *http.Request) {
@@ -612,23 +1216,17 @@ func (fm *FlagManager) getFlagHandler(w http.ResponseWriter, r *http.Request) {
 	project := vars["project"]
 	flagKey := vars["flagKey"]
 
-	if fm.store != nil {
-		flag, err := fm.store.GetFlag(r.Context(), project, flagKey)
-		if err != nil {
-			http.Error(w, "Flag not found", http.StatusNotFound)
-			return
-		}
-		var config interface{}
-		json.Unmarshal(flag.Config, &config)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"key":    flag.Key,
-			"config": config,
-		})
+	flag, err := fm.storage.GetFlag(r.Context(), project, flagKey)
+	if err != nil {
+		writeStorageError(w, err)
 		return
 	}
 
-	fm.getFlagFileBased(w, r)
+	if format := r.URL.Query().Get("format"); format != "" && format != "json" {
+		writeFlagFormat(w, format, flag.Key, flag.Config)
+		return
+	}
+	writeFlagResponse(w, r, flag.Key, flag.Config)
 }
 
 func (fm *FlagManager) createFlagHandler(w http.ResponseWriter, r *http.Request) {
@@ -641,54 +1239,87 @@ func (fm *FlagManager) createFlagHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// ?template= creates the flag from a template rather than the config of
+	// the body
 	var flagConfig FlagConfig
-	if err := json.NewDecoder(r.Body).Decode(&flagConfig); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var auditMetadata interface{}
+	if templateID := r.URL.Query().Get("template"); templateID != "" {
+		config, t := fm.flagFromTemplate(w, r, templateID, project, flagKey)
+		if config == nil {
+			return
+		}
+		flagConfig = *config
+		auditMetadata = map[string]interface{}{"templateId": t.ID, "template": t.Name}
+	} else if err := json.NewDecoder(r.Body).Decode(&flagConfig); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
+	fm.createFlag(w, r, project, flagKey, flagConfig, auditMetadata)
+}
+
+// createFlag validates and saves a new flag, and writes the response.
+func (fm *FlagManager) createFlag(w http.ResponseWriter, r *http.Request, project, flagKey string, flagConfig FlagConfig, auditMetadata interface{}) {
+	// Flags are only archived by deleting them
+	flagConfig.ArchivedAt = ""
+
 	// Validate flag config
 	if errs := ValidateFlagConfig(flagConfig); len(errs) > 0 {
 		writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid", errs...)
 		return
 	}
+	if errs, err := fm.validateFlagKeyConvention(r.Context(), project, flagKey, flagConfig.Owners); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	} else if len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_KEY", "Flag key does not follow the project's naming rules", errs...)
+		return
+	}
+	if errs, err := fm.validateOwners(r.Context(), flagConfig.Owners, nil); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	} else if len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_OWNERS", "Flag owners are invalid", errs...)
+		return
+	}
+	if errs, err := fm.validateJiraIssue(r.Context(), &flagConfig, nil); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	} else if len(errs) > 0 {
+		writeValidationError(w, "INVALID_JIRA_ISSUE", "Jira issue is invalid", errs...)
+		return
+	}
+	flagConfig.resolveRelativeSchedule(time.Now())
 
-	if fm.store != nil {
-		configJSON, _ := json.Marshal(flagConfig)
-		disabled := false
-		if flagConfig.Disable != nil {
-			disabled = *flagConfig.Disable
-		}
-
-		exists, _ := fm.store.FlagExists(r.Context(), project, flagKey)
-		if exists {
-			http.Error(w, "Flag already exists", http.StatusConflict)
-			return
-		}
+	flag, err := fm.storage.CreateFlag(r.Context(), project, flagKey, flagConfig)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
 
-		flag, err := fm.store.CreateFlag(r.Context(), project, flagKey, configJSON, disabled, flagConfig.Version)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	fm.audit.Log(r.Context(), GetActor(r), "flag.created", "flag", flag.ID, flagKey, project,
+		map[string]interface{}{"after": flagConfig}, auditMetadata)
+	fm.notifyProjectWebhook(r, "flag.created", project, flagKey, "")
+	fm.syncJiraIssue(r, project, flagKey, nil, &flag.Config)
 
-		fm.audit.Log(r.Context(), GetActor(r), "flag.created", "flag", flag.ID, flagKey, project,
-			map[string]interface{}{"after": flagConfig}, nil)
+	fm.scheduleRelayRefresh(r.Context())
 
-		go fm.refreshRelayProxy()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newFlagResponse(flag.Key, flag.Config))
+}
 
-		var config interface{}
-		json.Unmarshal(flag.Config, &config)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"key":    flag.Key,
-			"config": config,
-		})
-		return
-	}
+// flagExists reports whether a flag is already stored.
+func (fm *FlagManager) flagExists(r *http.Request, project, flagKey string) bool {
+	_, err := fm.storage.GetFlag(r.Context(), project, flagKey)
+	return err == nil
+}
 
-	fm.createFlagFileBased(w, r, project, flagKey, flagConfig)
+// ApprovalRequiredResponse is returned instead of the flag when an update
+// needs approval: the change was filed as a change request.
+type ApprovalRequiredResponse struct {
+	RequiresApproval bool   `json:"requiresApproval"`
+	ChangeRequestID  string `json:"changeRequestId"`
 }
 
 func (fm *FlagManager) updateFlagHandler(w http.ResponseWriter, r *http.Request) {
@@ -702,16 +1333,42 @@ func (fm *FlagManager) updateFlagHandler(w http.ResponseWriter, r *http.Request)
 		ChangeNote string     `json:"changeNote,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
+	// ?upsert=true creates a missing flag and leaves an unchanged one alone,
+	// so that declarative tools need not tell creates from updates
+	if r.URL.Query().Get("upsert") == "true" {
+		if fm.upsertFlag(w, r, project, flagKey, requestBody.Config, requestBody.NewKey) {
+			return
+		}
+	}
+
 	// Validate change note if required
 	if fm.requireChangeNotes && requestBody.ChangeNote == "" {
 		writeValidationError(w, "CHANGE_NOTE_REQUIRED", "Change note is required")
 		return
 	}
 
+	fm.applyFlagUpdate(w, r, project, flagKey, flagUpdate{
+		Config:     requestBody.Config,
+		NewKey:     requestBody.NewKey,
+		ChangeNote: requestBody.ChangeNote,
+	})
+}
+
+// flagUpdate is a change to a flag's config, from an update or a rollback.
+type flagUpdate struct {
+	Config         FlagConfig
+	NewKey         string
+	ChangeNote     string
+	RollbackTarget int // version restored by a rollback
+}
+
+// applyFlagUpdate validates and saves a flag update, or files it as a change
+// request when it needs approval, and writes the response.
+func (fm *FlagManager) applyFlagUpdate(w http.ResponseWriter, r *http.Request, project, flagKey string, requestBody flagUpdate) {
 	if requestBody.NewKey != "" {
 		if err := ValidateFlagKey(requestBody.NewKey); err != nil {
 			writeValidationError(w, "INVALID_FLAG_KEY", err.Error())
@@ -719,186 +1376,218 @@ func (fm *FlagManager) updateFlagHandler(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	if fm.store != nil {
-		// Get existing flag for audit before/after
-		existing, err := fm.store.GetFlag(r.Context(), project, flagKey)
-		if err != nil {
-			http.Error(w, "Flag not found", http.StatusNotFound)
+	if errs := validateScheduledRolloutMode(requestBody.Config.ScheduledRollout); len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid", errs...)
+		return
+	}
+	requestBody.Config.resolveRelativeSchedule(time.Now())
+
+	// If approvals are required and the actor is not an admin, create a
+	// change request instead of saving. Without a database there are no
+	// roles, so every update needs approval.
+	existing, err := fm.storage.GetFlag(r.Context(), project, flagKey)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	// Without a status the flag keeps its own, so that a draft is only
+	// published on purpose
+	if requestBody.Config.Status == "" {
+		requestBody.Config.Status = existing.Config.Status
+	}
+	// Archived flags must be restored to be changed, and flags are only
+	// archived by deleting them
+	if isArchived(existing.Config) {
+		writeError(w, http.StatusConflict, "FLAG_ARCHIVED", "Flag is archived; restore it to change it")
+		return
+	}
+	requestBody.Config.ArchivedAt = ""
+	if !fm.mayChangeFlag(r, existing.Config) {
+		writeNotFlagOwner(w, flagKey)
+		return
+	}
+	if errs, err := fm.validateOwners(r.Context(), requestBody.Config.Owners, existing.Config.Owners); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	} else if len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_OWNERS", "Flag owners are invalid", errs...)
+		return
+	}
+	// Naming rules apply to renamed flags; existing keys are left alone
+	if requestBody.NewKey != "" && requestBody.NewKey != flagKey {
+		if errs, err := fm.validateFlagKeyConvention(r.Context(), project, requestBody.NewKey, requestBody.Config.Owners); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		} else if len(errs) > 0 {
+			writeValidationError(w, "INVALID_FLAG_KEY", "Flag key does not follow the project's naming rules", errs...)
 			return
 		}
-
-		// If approvals required and actor is not admin, create a change request
-		if fm.requireApprovals {
-			actor := GetActor(r)
-			isAdmin := false
-			if actor.ID != "" {
-				isAdmin, _ = fm.store.HasPermission(r.Context(), actor.ID, "*", "admin")
-			}
-			if !isAdmin && actor.Type != "apikey" {
-				// Create a change request instead of direct save
-				var currentConfig interface{}
-				json.Unmarshal(existing.Config, &currentConfig)
-				proposedJSON, _ := json.Marshal(requestBody.Config)
-
-				cr, err := fm.store.CreateChangeRequest(r.Context(), db.ChangeRequest{
-					Title:          "Update flag: " + flagKey,
-					Description:    requestBody.ChangeNote,
-					AuthorID:       actor.ID,
-					AuthorEmail:    actor.Email,
-					AuthorName:     actor.Name,
-					Project:        project,
-					FlagKey:        flagKey,
-					ResourceType:   "flag",
-					CurrentConfig:  existing.Config,
-					ProposedConfig: proposedJSON,
-				})
-				if err != nil {
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"requiresApproval": true,
-					"changeRequestId":  cr.ID,
-				})
+	}
+	if errs, err := fm.validateJiraIssue(r.Context(), &requestBody.Config, &existing.Config); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	} else if len(errs) > 0 {
+		writeValidationError(w, "INVALID_JIRA_ISSUE", "Jira issue is invalid", errs...)
+		return
+	}
+	if fm.flagRequiresApproval(existing.Config) {
+		if !fm.bypassesApproval(r) {
+			// Report violations now rather than when the change is applied
+			if !fm.checkFlagPolicies(w, r, project, flagChange{key: flagKey, before: &existing.Config, after: &requestBody.Config}) {
 				return
 			}
-		}
-
-		configJSON, _ := json.Marshal(requestBody.Config)
-		disabled := false
-		if requestBody.Config.Disable != nil {
-			disabled = *requestBody.Config.Disable
-		}
-
-		if requestBody.NewKey != "" && requestBody.NewKey != flagKey {
-			exists, _ := fm.store.FlagExists(r.Context(), project, requestBody.NewKey)
-			if exists {
-				http.Error(w, "Flag with new key already exists", http.StatusConflict)
+			actor := GetActor(r)
+			currentJSON, _ := json.Marshal(existing.Config)
+			proposedJSON, _ := json.Marshal(requestBody.Config)
+
+			cr, err := fm.storage.CreateChangeRequest(r.Context(), db.ChangeRequest{
+				Title:          "Update flag: " + flagKey,
+				Description:    requestBody.ChangeNote,
+				AuthorID:       actor.ID,
+				AuthorEmail:    actor.Email,
+				AuthorName:     actor.Name,
+				Project:        project,
+				FlagKey:        flagKey,
+				ResourceType:   "flag",
+				CurrentConfig:  currentJSON,
+				ProposedConfig: proposedJSON,
+			})
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 				return
 			}
-		}
 
-		flag, err := fm.store.UpdateFlag(r.Context(), project, flagKey, configJSON, disabled, requestBody.Config.Version, requestBody.NewKey)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			fm.audit.Log(r.Context(), actor, "change_request.created", "change_request", cr.ID, cr.Title, project, nil,
+				map[string]interface{}{"flagOverride": existing.Config.RequiresApproval != nil})
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(ApprovalRequiredResponse{
+				RequiresApproval: true,
+				ChangeRequestID:  cr.ID,
+			})
 			return
 		}
+	}
 
-		var beforeConfig interface{}
-		json.Unmarshal(existing.Config, &beforeConfig)
+	before, flag, err := fm.storage.UpdateFlag(r.Context(), project, flagKey, requestBody.NewKey, requestBody.Config)
+	if errors.Is(err, errFlagExists) {
+		writeError(w, http.StatusConflict, "FLAG_EXISTS", "Flag with new key already exists")
+		return
+	}
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
 
-		auditMetadata := map[string]interface{}{}
+	var auditMetadata interface{}
+	if requestBody.ChangeNote != "" || requestBody.RollbackTarget > 0 {
+		metadata := map[string]interface{}{}
 		if requestBody.ChangeNote != "" {
-			auditMetadata["changeNote"] = requestBody.ChangeNote
+			metadata["changeNote"] = requestBody.ChangeNote
 		}
-		var metadataArg interface{}
-		if len(auditMetadata) > 0 {
-			metadataArg = auditMetadata
+		if requestBody.RollbackTarget > 0 {
+			metadata["rolledBackTo"] = requestBody.RollbackTarget
 		}
+		auditMetadata = metadata
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "flag.updated", "flag", flag.ID, flag.Key, project,
+		map[string]interface{}{"before": before.Config, "after": requestBody.Config}, auditMetadata)
+
+	if !boolPtrEqual(before.Config.RequiresApproval, requestBody.Config.RequiresApproval) {
+		fm.audit.Log(r.Context(), GetActor(r), "flag.approval_override_changed", "flag", flag.ID, flag.Key, project,
+			map[string]interface{}{
+				"before": before.Config.RequiresApproval,
+				"after":  requestBody.Config.RequiresApproval,
+			}, nil)
+	}
 
-		fm.audit.Log(r.Context(), GetActor(r), "flag.updated", "flag", flag.ID, flag.Key, project,
-			map[string]interface{}{"before": beforeConfig, "after": requestBody.Config}, metadataArg)
-
-		go fm.refreshRelayProxy()
-
-		var config interface{}
-		json.Unmarshal(flag.Config, &config)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"key":    flag.Key,
-			"config": config,
-		})
-		return
+	previousKey := ""
+	if flag.Key != flagKey {
+		previousKey = flagKey
 	}
+	fm.notifyProjectWebhook(r, "flag.updated", project, flag.Key, previousKey)
+	fm.syncJiraIssue(r, project, flag.Key, &before.Config, &flag.Config)
+
+	fm.scheduleRelayRefresh(r.Context())
 
-	fm.updateFlagFileBased(w, r, project, flagKey, requestBody.Config, requestBody.NewKey)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newFlagResponse(flag.Key, flag.Config))
 }
 
+// deleteFlagHandler deletes a flag in two steps: a flag is archived first, and
+// deleting an archived flag purges it for good, as FLAG_ARCHIVE_RETENTION
+// does once it expires.
 func (fm *FlagManager) deleteFlagHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	project := vars["project"]
 	flagKey := vars["flagKey"]
 
-	if fm.store != nil {
-		// Get flag for audit
-		existing, _ := fm.store.GetFlag(r.Context(), project, flagKey)
-
-		if err := fm.store.DeleteFlag(r.Context(), project, flagKey); err != nil {
-			if strings.Contains(err.Error(), "not found") {
-				http.Error(w, "Flag not found", http.StatusNotFound)
-			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
+	flag, err := fm.storage.GetFlag(r.Context(), project, flagKey)
+	if err != nil {
+		// ?idempotent=true treats deleting a missing flag as done
+		if r.URL.Query().Get("idempotent") == "true" && (errors.Is(err, errFlagNotFound) || errors.Is(err, errProjectNotFound)) {
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
+		writeStorageError(w, err)
+		return
+	}
+	if !fm.mayChangeFlag(r, flag.Config) {
+		writeNotFlagOwner(w, flagKey)
+		return
+	}
+	// ?ifUnreferenced=true refuses to delete a flag still evaluated in code
+	if r.URL.Query().Get("ifUnreferenced") == "true" && !fm.checkFlagUnreferenced(w, r, project, flagKey) {
+		return
+	}
 
-		if existing != nil {
-			var config interface{}
-			json.Unmarshal(existing.Config, &config)
-			fm.audit.Log(r.Context(), GetActor(r), "flag.deleted", "flag", existing.ID, flagKey, project,
-				map[string]interface{}{"before": config}, nil)
+	if !isArchived(flag.Config) {
+		if _, err := fm.setFlagArchived(r, project, flagKey, true); err != nil && !errors.Is(err, errFlagArchived) {
+			writeArchiveError(w, flagKey, err)
+			return
 		}
-
-		go fm.refreshRelayProxy()
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	fm.deleteFlagFileBased(w, r, project, flagKey)
+	existing, err := fm.storage.DeleteFlag(r.Context(), project, flagKey)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	// Archived flags are not served, and the Jira issue was synced when the
+	// flag was archived
+	fm.audit.Log(r.Context(), GetActor(r), "flag.deleted", "flag", existing.ID, flagKey, project,
+		map[string]interface{}{"before": existing.Config}, nil)
+	fm.notifyProjectWebhook(r, "flag.deleted", project, flagKey, "")
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (fm *FlagManager) refreshRelayProxyHandler(w http.ResponseWriter, r *http.Request) {
-	if err := fm.refreshRelayProxy(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := fm.refreshRelayProxy(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "refreshed"})
+	json.NewEncoder(w).Encode(StatusResponse{Status: "refreshed"})
+}
+
+// ProposeResponse is a pull request opened for a flag change.
+type ProposeResponse struct {
+	Success    bool   `json:"success"`
+	PRURL      string `json:"prURL"`
+	Branch     string `json:"branch"`
+	Message    string `json:"message"`
+	ProposalID string `json:"proposalId,omitempty"`
 }
 
 // proposeFlagChangeHandler creates a PR/MR for a flag change
 func (fm *FlagManager) proposeFlagChangeHandler(w http.ResponseWriter, r *http.Request) {
-	// Get integration ID from query param or use default
-	integrationID := r.URL.Query().Get("integration")
-
-	var provider git.Provider
-	var integration *GitIntegration
-
-	if fm.store != nil {
-		// DB mode - load integration from DB
-		if integrationID != "" {
-			dbInt, err := fm.store.GetIntegration(r.Context(), integrationID)
-			if err == nil {
-				gi := dbIntegrationToGitIntegration(*dbInt)
-				integration = &gi
-				provider = initGitProviderFromIntegration(integration)
-			}
-		} else {
-			dbInt, err := fm.store.GetDefaultIntegration(r.Context())
-			if err == nil {
-				gi := dbIntegrationToGitIntegration(*dbInt)
-				integration = &gi
-				provider = initGitProviderFromIntegration(integration)
-			}
-		}
-	} else {
-		// File mode
-		if integrationID != "" {
-			provider = fm.integrations.GetProvider(integrationID)
-			integration = fm.integrations.Get(integrationID)
-		} else {
-			provider, integration = fm.integrations.GetDefaultProvider()
-		}
-	}
-
+	provider, integration := fm.resolveGitProvider(r)
 	if provider == nil {
-		provider = fm.gitProvider
-	}
-	if provider == nil {
-		http.Error(w, "Git provider not configured. Add an integration in Settings.", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "GIT_NOT_CONFIGURED", "Git provider not configured. Add an integration in Settings.")
 		return
 	}
 
@@ -913,31 +1602,14 @@ func (fm *FlagManager) proposeFlagChangeHandler(w http.ResponseWriter, r *http.R
 		Action      string     `json:"action"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	// Build flags map
-	var flags ProjectFlags
-
-	if fm.store != nil {
-		rawFlags, err := fm.store.ListFlags(r.Context(), project)
-		if err != nil {
-			flags = make(ProjectFlags)
-		} else {
-			flags = make(ProjectFlags)
-			for k, v := range rawFlags {
-				var fc FlagConfig
-				json.Unmarshal(v, &fc)
-				flags[k] = fc
-			}
-		}
-	} else {
-		var err error
-		flags, err = fm.readProjectFlags(project)
-		if err != nil || flags == nil {
-			flags = make(ProjectFlags)
-		}
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil || flags == nil {
+		flags = make(ProjectFlags)
 	}
 
 	switch requestBody.Action {
@@ -946,32 +1618,173 @@ func (fm *FlagManager) proposeFlagChangeHandler(w http.ResponseWriter, r *http.R
 	case "delete":
 		delete(flags, flagKey)
 	default:
-		http.Error(w, "Invalid action: must be create, update, or delete", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Invalid action: must be create, update, or delete")
 		return
 	}
 
-	flagsYAML, err := yaml.Marshal(flags)
+	flagsYAML, err := fm.marshalFlagsYAML(flags)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
-	branchName := fmt.Sprintf("flag/%s/%s-%d", project, flagKey, time.Now().Unix())
+	var titleTemplate, descriptionTemplate, branchTemplate string
+	if integration != nil {
+		titleTemplate = integration.PRTitleTemplate
+		descriptionTemplate = integration.PRDescriptionTemplate
+		branchTemplate = integration.BranchNameTemplate
+	}
+	if branchTemplate == "" && fm.config.GitConfig != nil {
+		branchTemplate = fm.config.GitConfig.BranchTemplate
+	}
+	if branchTemplate == "" {
+		branchTemplate = defaultBranchNameTemplate
+	}
+	actor := GetActor(r)
+	actorName := actor.Name
+	if actor.Email != "" {
+		actorName = actor.Email
+	}
+	templateData := PRTemplateData{Project: project, Flag: flagKey, Action: requestBody.Action, Actor: actorName, Timestamp: time.Now().Unix()}
+
+	branchName, err := renderBranchName(branchTemplate, templateData)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to render branch name template", "error", err)
+		branchName, _ = renderBranchName(defaultBranchNameTemplate, templateData)
+	}
 
 	title := requestBody.Title
+	if title == "" && titleTemplate != "" {
+		if rendered, err := renderPRTemplate(titleTemplate, templateData); err == nil {
+			title = rendered
+		} else {
+			slog.WarnContext(r.Context(), "Failed to render PR title template", "error", err)
+		}
+	}
 	if title == "" {
 		title = fmt.Sprintf("[Feature Flag] %s flag: %s", requestBody.Action, flagKey)
 	}
 
 	description := requestBody.Description
+	if description == "" && descriptionTemplate != "" {
+		if rendered, err := renderPRTemplate(descriptionTemplate, templateData); err == nil {
+			description = rendered
+		} else {
+			slog.WarnContext(r.Context(), "Failed to render PR description template", "error", err)
+		}
+	}
 	if description == "" {
 		description = fmt.Sprintf("Automated flag change via GOFF UI\n\n- Project: %s\n- Flag: %s\n- Action: %s",
 			project, flagKey, requestBody.Action)
 	}
 
-	var flagsPath string
-	var baseBranch string
+	flagsPath, baseBranch := fm.gitFlagsLocation(integration, project)
+
+	changes := map[string][]byte{
+		flagsPath: flagsYAML,
+	}
+
+	var prURL string
+	err = fm.outbound.Do(func() error {
+		prURL, err = provider.CreatePR(title, description, branchName, baseBranch, changes)
+		return err
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", fmt.Sprintf("Failed to create PR: %v", err))
+		return
+	}
+
+	// Track the PR so its merge can be detected; the PR exists either way
+	proposal := db.Proposal{
+		Project:    project,
+		FlagKey:    flagKey,
+		Action:     requestBody.Action,
+		Branch:     branchName,
+		BaseBranch: baseBranch,
+		PRURL:      prURL,
+		CreatedBy:  actorName,
+	}
+	if integration != nil {
+		proposal.IntegrationID = integration.ID
+	}
+	response := ProposeResponse{
+		Success: true,
+		PRURL:   prURL,
+		Branch:  branchName,
+		Message: "Pull request created successfully",
+	}
+	if recorded, err := fm.recordProposal(r.Context(), proposal); err != nil {
+		slog.WarnContext(r.Context(), "Failed to record proposal", "pr_url", prURL, "error", err)
+	} else {
+		response.ProposalID = recorded.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// resolveGitProvider returns the git provider for the request's ?integration=
+// parameter, or the default integration when it is absent. It falls back to the
+// provider configured through environment variables, in which case the returned
+// integration is nil. The provider is nil if none is configured.
+func (fm *FlagManager) resolveGitProvider(r *http.Request) (git.Provider, *GitIntegration) {
+	integrationID := r.URL.Query().Get("integration")
+
+	var provider git.Provider
+	var integration *GitIntegration
 
+	if fm.store != nil {
+		// DB mode - load integration from DB
+		if integrationID != "" {
+			dbInt, err := fm.store.GetIntegration(r.Context(), integrationID)
+			if err == nil {
+				gi := dbIntegrationToGitIntegration(*dbInt)
+				integration = &gi
+				provider = fm.initGitProvider(r.Context(), integration)
+			}
+		} else {
+			dbInt, err := fm.store.GetDefaultIntegration(r.Context())
+			if err == nil {
+				gi := dbIntegrationToGitIntegration(*dbInt)
+				integration = &gi
+				provider = fm.initGitProvider(r.Context(), integration)
+			}
+		}
+	} else {
+		// File mode
+		if integrationID != "" {
+			provider = fm.fileGitProvider(r.Context(), integrationID)
+			integration = fm.integrations.Get(integrationID)
+		} else if _, integration = fm.integrations.GetDefaultProvider(); integration != nil {
+			provider = fm.fileGitProvider(r.Context(), integration.ID)
+		}
+	}
+
+	if provider == nil {
+		provider = fm.gitProvider
+	}
+	return provider, integration
+}
+
+// integrationGitProvider returns an integration and its git provider by ID.
+// The integration is nil if it does not exist; the provider is nil if it is
+// not configured.
+func (fm *FlagManager) integrationGitProvider(ctx context.Context, id string) (git.Provider, *GitIntegration) {
+	if fm.store != nil {
+		dbi, err := fm.store.GetIntegration(ctx, id)
+		if err != nil {
+			return nil, nil
+		}
+		gi := dbIntegrationToGitIntegration(*dbi)
+		return fm.initGitProvider(ctx, &gi), &gi
+	}
+	return fm.fileGitProvider(ctx, id), fm.integrations.Get(id)
+}
+
+// gitFlagsLocation returns the repository path of a project's flags file and
+// the base branch it lives on.
+func (fm *FlagManager) gitFlagsLocation(integration *GitIntegration, project string) (flagsPath, baseBranch string) {
 	if integration != nil {
 		flagsPath = integration.FlagsPath
 		baseBranch = integration.BaseBranch
@@ -986,28 +1799,9 @@ func (fm *FlagManager) proposeFlagChangeHandler(w http.ResponseWriter, r *http.R
 	if baseBranch == "" {
 		baseBranch = "main"
 	}
-
-	changes := map[string][]byte{
-		flagsPath: flagsYAML,
-	}
-
-	prURL, err := provider.CreatePR(title, description, branchName, baseBranch, changes)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create PR: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"prURL":   prURL,
-		"branch":  branchName,
-		"message": "Pull request created successfully",
-	})
+	return flagsPath, baseBranch
 }
 
-
 // initGitProviderFromIntegration initializes a git provider from an integration.
 func initGitProviderFromIntegration(gi *GitIntegration) git.Provider {
 	if gi == nil {
@@ -1022,6 +1816,19 @@ func initGitProviderFromIntegration(gi *GitIntegration) git.Provider {
 		if gi.GitLabURL != "" && gi.GitLabProjectID != "" && gi.GitLabToken != "" {
 			return git.NewGitLabClient(gi.GitLabURL, gi.GitLabProjectID, gi.GitLabToken, gi.BaseBranch)
 		}
+	case "github":
+		if gi.GitHubOwner != "" && gi.GitHubRepository != "" && gi.GitHubToken != "" {
+			return git.NewGitHubClient(gi.GitHubURL, gi.GitHubOwner, gi.GitHubRepository, gi.GitHubToken, gi.BaseBranch)
+		}
+	case "bitbucket":
+		if gi.BitbucketWorkspace != "" && gi.BitbucketRepository != "" && gi.BitbucketAppPassword != "" {
+			return git.NewBitbucketClient(gi.BitbucketURL, gi.BitbucketWorkspace, gi.BitbucketRepository,
+				gi.BitbucketUsername, gi.BitbucketAppPassword, gi.BaseBranch)
+		}
+	case "gitea":
+		if gi.GiteaURL != "" && gi.GiteaOwner != "" && gi.GiteaRepository != "" && gi.GiteaToken != "" {
+			return git.NewGiteaClient(gi.GiteaURL, gi.GiteaOwner, gi.GiteaRepository, gi.GiteaToken, gi.BaseBranch)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Metrics served on /metrics in the Prometheus text exposition format. The
+// counters live for the lifetime of the process; gauges that describe stored
+// data are computed at scrape time.
+var (
+	httpRequestsTotal   = newCounterVec()
+	httpRequestDuration = newHistogramVec(defaultLatencyBuckets)
+	flagOperationsTotal = newCounterVec()
+	relayRefreshTotal   = newCounterVec()
+
+	// Background jobs
+	scheduledRefreshTotal      = newCounterVec()
+	backgroundJobFailuresTotal = newCounterVec()
+	scheduledStepsAppliedTotal = newCounterVec()
+	rampChangesTotal           = newCounterVec()
+	rampCheckFailuresTotal     = newCounterVec()
+	staleFlagsFound            = newGaugeVec()
+	reapedFlagsTotal           = newCounterVec()
+	proposalsResolvedTotal     = newCounterVec()
+	changeFeedConnections      = newGaugeVec()
+	changeFeedSlowDisconnects  = newCounterVec()
+	configMapWritesTotal       = newCounterVec()
+	configMapLeadershipChanges = newCounterVec()
+)
+
+// defaultLatencyBuckets are the upper bounds in seconds of the request
+// latency histogram, matching the Prometheus client defaults.
+var defaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unmatchedRoute labels requests that did not match any route, so that
+// arbitrary paths cannot blow up the number of series.
+const unmatchedRoute = "unmatched"
+
+// counterVec is a set of counters keyed by their rendered label pairs.
+type counterVec struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec() *counterVec {
+	return &counterVec{values: make(map[string]float64)}
+}
+
+// Add increases the counter with the given label pairs by v.
+func (c *counterVec) Add(v float64, labels ...string) {
+	key := metricLabels(labels...)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the counter with the given label pairs.
+func (c *counterVec) Value(labels ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[metricLabels(labels...)]
+}
+
+func (c *counterVec) write(w io.Writer, name, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", name, braced(key), formatMetricValue(c.values[key]))
+	}
+}
+
+// gaugeVec is a set of gauges keyed by their rendered label pairs, for values
+// tracked by the process rather than computed at scrape time.
+type gaugeVec struct {
+	counterVec
+}
+
+func newGaugeVec() *gaugeVec {
+	return &gaugeVec{counterVec{values: make(map[string]float64)}}
+}
+
+// Set sets the gauge with the given label pairs to v.
+func (g *gaugeVec) Set(v float64, labels ...string) {
+	key := metricLabels(labels...)
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+func (g *gaugeVec) write(w io.Writer, name, help string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeGauge(w, name, help, g.values)
+}
+
+// histogramVec is a set of histograms with shared buckets, keyed by their
+// rendered label pairs.
+type histogramVec struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(buckets []float64) *histogramVec {
+	return &histogramVec{buckets: buckets, series: make(map[string]*histogram)}
+}
+
+// Observe records v in the histogram with the given label pairs.
+func (h *histogramVec) Observe(v float64, labels ...string) {
+	key := metricLabels(labels...)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		prefix := key
+		if prefix != "" {
+			prefix += ","
+		}
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, prefix, formatMetricValue(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, braced(key), formatMetricValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, braced(key), s.count)
+	}
+}
+
+// writeGauge writes a gauge with one sample per label set in values.
+func writeGauge(w io.Writer, name, help string, values map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %s\n", name, braced(key), formatMetricValue(values[key]))
+	}
+}
+
+// metricLabels renders name/value pairs as `a="1",b="2"`.
+func metricLabels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countFlagOperation counts n successful flag mutations of the given kind
+// (create, update or delete). The storage backends call it.
+func countFlagOperation(operation string, n int) {
+	if n > 0 {
+		flagOperationsTotal.Add(float64(n), "operation", operation)
+	}
+}
+
+// statusRecorder captures the status code written by a handler. It passes
+// Hijack and Flush through so that the change feed WebSocket keeps working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	if s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// MetricsMiddleware counts requests and their latency per route template of
+// router. It runs outside the auth and rate limiting middleware so rejected
+// requests are counted too.
+func MetricsMiddleware(router *mux.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := unmatchedRoute
+			var match mux.RouteMatch
+			if router.Match(r, &match) && match.Route != nil {
+				if tmpl, err := match.Route.GetPathTemplate(); err == nil {
+					route = tmpl
+				}
+			}
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			httpRequestsTotal.Add(1, "method", r.Method, "route", route, "status", strconv.Itoa(rec.status))
+			httpRequestDuration.Observe(time.Since(start).Seconds(), "method", r.Method, "route", route)
+		})
+	}
+}
+
+// metricsHandler serves the metrics in the Prometheus text format.
+func (fm *FlagManager) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	httpRequestsTotal.write(w, "flag_manager_http_requests_total", "HTTP requests by method, route and status.")
+	httpRequestDuration.write(w, "flag_manager_http_request_duration_seconds", "HTTP request latency by method and route.")
+	flagOperationsTotal.write(w, "flag_manager_flag_operations_total", "Flag create, update and delete operations.")
+	relayRefreshTotal.write(w, "flag_manager_relay_refresh_total", "Relay proxy refreshes by result.")
+	scheduledRefreshTotal.write(w, "flag_manager_scheduled_relay_refresh_total", "REFRESH_INTERVAL relay proxy refreshes by result.")
+	backgroundJobFailuresTotal.write(w, "flag_manager_background_job_failures_total", "Failed runs of the background jobs by job.")
+	scheduledStepsAppliedTotal.write(w, "flag_manager_scheduled_steps_applied_total", "Scheduled rollout steps applied by the rollout scheduler.")
+	rampChangesTotal.write(w, "flag_manager_ramp_changes_total", "Rollout ramps advanced or halted by the rollout controller.")
+	rampCheckFailuresTotal.write(w, "flag_manager_ramp_check_failures_total", "Ramp metrics checks that failed to run.")
+	staleFlagsFound.write(w, "flag_manager_stale_flags", "Stale flags found by the last stale reaper run.")
+	reapedFlagsTotal.write(w, "flag_manager_reaped_flags_total", "Expired flags disabled or deleted by the stale reaper.")
+	proposalsResolvedTotal.write(w, "flag_manager_proposals_resolved_total", "Proposals found merged or closed by the proposal poller.")
+	changeFeedConnections.write(w, "flag_manager_change_feed_connections", "Open change feed connections.")
+	changeFeedSlowDisconnects.write(w, "flag_manager_change_feed_slow_disconnects_total", "Change feed connections dropped for falling behind.")
+	configMapWritesTotal.write(w, "flag_manager_configmap_writes_total", "Flags ConfigMap writes by result.")
+	configMapLeadershipChanges.write(w, "flag_manager_configmap_leadership_changes_total", "ConfigMap writer leadership changes.")
+
+	pending := map[string]float64{}
+	if count, err := fm.storage.CountPendingChangeRequests(r.Context()); err == nil {
+		pending[""] = float64(count)
+	} else {
+		slog.WarnContext(r.Context(), "Failed to count pending change requests for metrics", "error", err)
+	}
+	writeGauge(w, "flag_manager_change_requests_pending", "Change requests awaiting review.", pending)
+
+	flagCounts, err := fm.projectFlagCounts(r.Context())
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to count flags for metrics", "error", err)
+	}
+	writeGauge(w, "flag_manager_flags", "Stored flags per project.", flagCounts)
+}
+
+// projectFlagCounts returns the number of flags of every project keyed by
+// its rendered project label.
+func (fm *FlagManager) projectFlagCounts(ctx context.Context) (map[string]float64, error) {
+	counts := make(map[string]float64)
+	projects, err := fm.storage.ListProjects(ctx)
+	if err != nil {
+		return counts, err
+	}
+	for _, project := range projects {
+		counts[metricLabels("project", project)] = 0
+	}
+
+	flags, err := fm.storage.AllFlags(ctx)
+	if err != nil {
+		return counts, err
+	}
+	for key := range flags {
+		project, _, _ := strings.Cut(key, "/")
+		counts[metricLabels("project", project)]++
+	}
+	return counts, nil
+}
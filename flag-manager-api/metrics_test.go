@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+	handler := MetricsMiddleware(router)(router)
+
+	createsBefore := flagOperationsTotal.Value("operation", "create")
+	flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+	for _, key := range []string{"checkout", "banner"} {
+		doRequest(t, handler, "POST", "/api/projects/metrics-web/flags/"+key, flag, http.StatusCreated, nil)
+	}
+	doRequest(t, handler, "GET", "/api/projects/metrics-web/flags/missing", "", http.StatusNotFound, nil)
+
+	if got := flagOperationsTotal.Value("operation", "create") - createsBefore; got != 2 {
+		t.Errorf("Expected 2 counted flag creations, got %v", got)
+	}
+
+	rr := doRequest(t, handler, "GET", "/metrics", "", http.StatusOK, nil)
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected the Prometheus text format, got Content-Type %q", ct)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`flag_manager_http_requests_total{method="POST",route="/api/projects/{project}/flags/{flagKey}",status="201"}`,
+		`flag_manager_http_requests_total{method="GET",route="/api/projects/{project}/flags/{flagKey}",status="404"}`,
+		`flag_manager_http_request_duration_seconds_bucket{method="POST",route="/api/projects/{project}/flags/{flagKey}",le="+Inf"}`,
+		"# TYPE flag_manager_flag_operations_total counter",
+		"# TYPE flag_manager_change_requests_pending gauge",
+		"flag_manager_change_requests_pending 0",
+		`flag_manager_flags{project="metrics-web"} 2`,
+		"# TYPE flag_manager_background_job_failures_total counter",
+		"# TYPE flag_manager_change_feed_connections gauge",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", want, body)
+		}
+	}
+
+	if strings.Contains(body, "/api/projects/metrics-web/") {
+		t.Error("Expected requests to be labelled by route template, not path")
+	}
+}
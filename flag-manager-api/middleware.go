@@ -2,20 +2,17 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
-	"sync"
-	"time"
-
-	"golang.org/x/time/rate"
 )
 
 type contextKey string
 
 const (
-	ctxActor contextKey = "actor"
+	ctxActor       contextKey = "actor"
+	ctxRequestInfo contextKey = "requestInfo"
+	ctxAPIKey      contextKey = "apiKey"
 )
 
 // Actor represents the authenticated user or API key making a request.
@@ -24,127 +21,80 @@ type Actor struct {
 	Email string `json:"email"`
 	Name  string `json:"name"`
 	Type  string `json:"type"` // "user", "apikey", "system"
+
+	Groups     []string `json:"groups,omitempty"`     // teams of the user, from the groups claim
+	RoleClaims []string `json:"roleClaims,omitempty"` // values of the roles claim, for role mappings
 }
 
 // GetActor extracts the actor from the request context.
 func GetActor(r *http.Request) Actor {
-	if actor, ok := r.Context().Value(ctxActor).(Actor); ok {
+	return actorFrom(r.Context())
+}
+
+// actorFrom returns the actor of a request or background job context.
+func actorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(ctxActor).(Actor); ok {
 		return actor
 	}
 	return Actor{Type: "system", Name: "anonymous"}
 }
 
-// CORSMiddleware handles CORS with configurable allowed origins.
-func CORSMiddleware(next http.Handler) http.Handler {
-	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
-	if allowedOrigins == "" {
-		allowedOrigins = "*"
+// actorLabel names an actor by email, or by name when it has none.
+func actorLabel(actor Actor) string {
+	if actor.Email != "" {
+		return actor.Email
 	}
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-
-		if allowedOrigins == "*" {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-		} else {
-			origins := strings.Split(allowedOrigins, ",")
-			for _, o := range origins {
-				if strings.TrimSpace(o) == origin {
-					w.Header().Set("Access-Control-Allow-Origin", origin)
-					break
-				}
-			}
-		}
-
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
-		w.Header().Set("Access-Control-Max-Age", "86400")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
+	return actor.Name
 }
 
-// RateLimitMiddleware applies per-IP rate limiting.
-func RateLimitMiddleware(next http.Handler) http.Handler {
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
-
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
-
-	// Cleanup stale entries every minute
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock()
-			for ip, c := range clients {
-				if time.Since(c.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
-			}
-			mu.Unlock()
-		}
-	}()
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr
-		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-			ip = strings.Split(forwarded, ",")[0]
-		}
-
-		mu.Lock()
-		c, exists := clients[ip]
-		if !exists {
-			c = &client{
-				limiter: rate.NewLimiter(rate.Every(time.Second), 100), // 100 req/s burst
-			}
-			clients[ip] = c
-		}
-		c.lastSeen = time.Now()
-		mu.Unlock()
-
-		if !c.limiter.Allow() {
-			http.Error(w, `{"error":"rate limit exceeded","code":"RATE_LIMITED"}`, http.StatusTooManyRequests)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
+// healthRoutes are served without authentication.
+var healthRoutes = map[string]bool{"/health": true, "/healthz": true, "/readyz": true}
 
 // AuthMiddleware validates JWT tokens or API keys when AUTH_ENABLED=true.
 func (fm *FlagManager) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !fm.authEnabled {
 			// Auth disabled - set anonymous actor
-			ctx := context.WithValue(r.Context(), ctxActor, Actor{
+			next.ServeHTTP(w, withActor(r, Actor{
+				Type: "system",
+				Name: "anonymous",
+			}))
+			return
+		}
+
+		// Load balancers and orchestrators probe health without credentials
+		if healthRoutes[r.URL.Path] {
+			next.ServeHTTP(w, withActor(r, Actor{
 				Type: "system",
 				Name: "anonymous",
-			})
-			next.ServeHTTP(w, r.WithContext(ctx))
+			}))
+			return
+		}
+
+		// Git hosts cannot obtain tokens; push webhooks are verified against
+		// the integration's webhook secret by the handler instead
+		if strings.HasPrefix(r.URL.Path, "/api/webhooks/git/") {
+			next.ServeHTTP(w, withActor(r, gitWebhookActor))
 			return
 		}
 
 		// Try JWT Bearer token first
 		authHeader := r.Header.Get("Authorization")
+		// Browsers cannot set headers on WebSocket connections, so the change
+		// feed also accepts the token as a query parameter
+		if authHeader == "" && r.URL.Path == "/api/ws" {
+			if token := r.URL.Query().Get("access_token"); token != "" {
+				authHeader = "Bearer " + token
+			}
+		}
 		if strings.HasPrefix(authHeader, "Bearer ") {
 			token := strings.TrimPrefix(authHeader, "Bearer ")
 			actor, err := fm.validateJWT(token)
 			if err == nil {
-				ctx := context.WithValue(r.Context(), ctxActor, actor)
-				next.ServeHTTP(w, r.WithContext(ctx))
+				next.ServeHTTP(w, withActor(r, actor))
 				return
 			}
-			log.Printf("JWT validation failed: %v", err)
+			slog.InfoContext(r.Context(), "JWT validation failed", "error", err)
 		}
 
 		// Try API key
@@ -153,21 +103,60 @@ func (fm *FlagManager) AuthMiddleware(next http.Handler) http.Handler {
 			if fm.store != nil {
 				key, err := fm.store.ValidateAPIKey(r.Context(), apiKey)
 				if err == nil {
-					ctx := context.WithValue(r.Context(), ctxActor, Actor{
+					r = r.WithContext(context.WithValue(r.Context(), ctxAPIKey, key))
+					next.ServeHTTP(w, withActor(r, Actor{
 						ID:   key.ID,
 						Name: key.Name,
 						Type: "apikey",
-					})
-					next.ServeHTTP(w, r.WithContext(ctx))
+					}))
 					return
 				}
 			}
+
+			// A flag set's own API key may only manage that flag set's flags
+			if flagSetID := fm.flagSetIDForAPIKey(r.Context(), apiKey); flagSetID != "" {
+				if !isFlagSetFlagsPath(r.URL.Path, flagSetID) {
+					writeError(w, http.StatusForbidden, "FORBIDDEN", "Flag set API keys can only access their own flag set's flags")
+					return
+				}
+				next.ServeHTTP(w, withActor(r, Actor{
+					ID:   flagSetID,
+					Name: "flagset:" + flagSetID,
+					Type: "flagset",
+				}))
+				return
+			}
 		}
 
-		http.Error(w, `{"error":"unauthorized","code":"UNAUTHORIZED"}`, http.StatusUnauthorized)
+		writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "unauthorized")
 	})
 }
 
+// flagSetIDForAPIKey returns the ID of the flag set owning apiKey, or "" if the
+// key does not belong to a flag set.
+func (fm *FlagManager) flagSetIDForAPIKey(ctx context.Context, apiKey string) string {
+	if fm.store != nil {
+		id, err := fm.store.GetFlagSetIDByAPIKey(ctx, apiKey)
+		if err != nil {
+			return ""
+		}
+		return id
+	}
+	if fm.flagSets == nil {
+		return ""
+	}
+	if fs := fm.flagSets.GetByAPIKey(apiKey); fs != nil {
+		return fs.ID
+	}
+	return ""
+}
+
+// isFlagSetFlagsPath reports whether path targets the flags of the given flag set.
+func isFlagSetFlagsPath(path, flagSetID string) bool {
+	prefix := "/api/flagsets/" + flagSetID + "/flags"
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
 // BodySizeLimitMiddleware limits request body size.
 func BodySizeLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
 	if maxBytes <= 0 {
@@ -182,12 +171,3 @@ func BodySizeLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
 		})
 	}
 }
-
-// LoggingMiddleware logs HTTP requests.
-func LoggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.URL.Path, time.Since(start))
-	})
-}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// FlagNamingRules is a project's naming policy for flag keys, checked by
+// ValidateFlagKeyConvention when flags are created or renamed.
+type FlagNamingRules struct {
+	Pattern       string              `json:"pattern,omitempty"`      // regular expression keys must match
+	Prefixes      []string            `json:"prefixes,omitempty"`     // keys must start with one of these
+	TeamPrefixes  map[string][]string `json:"teamPrefixes,omitempty"` // team owner (@org/team) -> prefixes its flags must use
+	MaxLength     int                 `json:"maxLength,omitempty"`
+	ReservedWords []string            `json:"reservedWords,omitempty"` // words keys must not contain, between . _ and -
+}
+
+// teamPrefixes returns the prefixes required of flags owned by a team owner.
+func (rules *FlagNamingRules) teamPrefixes(owner string) []string {
+	if !isTeamOwner(owner) {
+		return nil
+	}
+	for team, prefixes := range rules.TeamPrefixes {
+		if normalizeOwner(team) == normalizeOwner(owner) {
+			return prefixes
+		}
+	}
+	return nil
+}
+
+// validateFlagNamingRules checks a naming policy.
+func validateFlagNamingRules(rules FlagNamingRules) []string {
+	var errs []string
+	if rules.Pattern != "" {
+		if _, err := regexp.Compile(rules.Pattern); err != nil {
+			errs = append(errs, fmt.Sprintf("pattern is not a valid regular expression: %v", err))
+		}
+	}
+	if rules.MaxLength < 0 || rules.MaxLength > maxFlagKeyLength {
+		errs = append(errs, fmt.Sprintf("maxLength must be between 0 and %d", maxFlagKeyLength))
+	}
+	for _, prefix := range rules.Prefixes {
+		if prefix == "" {
+			errs = append(errs, "prefixes must not be empty")
+			break
+		}
+	}
+	for team, prefixes := range rules.TeamPrefixes {
+		if !isTeamOwner(team) {
+			errs = append(errs, fmt.Sprintf("teamPrefixes key %q must be a team such as @org/team", team))
+		}
+		if len(prefixes) == 0 {
+			errs = append(errs, fmt.Sprintf("teamPrefixes of %s must list at least one prefix", team))
+		}
+		for _, prefix := range prefixes {
+			if prefix == "" {
+				errs = append(errs, fmt.Sprintf("teamPrefixes of %s must not be empty", team))
+				break
+			}
+		}
+	}
+	for _, word := range rules.ReservedWords {
+		if word == "" {
+			errs = append(errs, "reservedWords must not be empty")
+			break
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// validateFlagKeyConvention checks a new or renamed flag key against its
+// project's naming rules, if any.
+func (fm *FlagManager) validateFlagKeyConvention(ctx context.Context, project, key string, owners []string) ([]string, error) {
+	meta, ok, err := fm.getProjectMeta(ctx, project)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return ValidateFlagKeyConvention(key, owners, meta.NamingRules), nil
+}
+
+func (fm *FlagManager) getNamingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	if meta.NamingRules == nil {
+		writeError(w, http.StatusNotFound, "NAMING_RULES_NOT_CONFIGURED", "Naming rules not configured")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta.NamingRules)
+}
+
+// updateNamingRulesHandler replaces a project's naming rules. They apply to
+// flags created or renamed afterwards; existing keys are left alone.
+func (fm *FlagManager) updateNamingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	var rules FlagNamingRules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if errs := validateFlagNamingRules(rules); len(errs) > 0 {
+		writeValidationError(w, "INVALID_NAMING_RULES", "Naming rules are invalid", errs...)
+		return
+	}
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	before := meta.NamingRules
+	meta.NamingRules = &rules
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "project.naming_rules_updated", "project", "", project, project,
+		map[string]interface{}{"before": before, "after": rules}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func (fm *FlagManager) deleteNamingRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	if meta.NamingRules == nil {
+		writeError(w, http.StatusNotFound, "NAMING_RULES_NOT_CONFIGURED", "Naming rules not configured")
+		return
+	}
+
+	meta.NamingRules = nil
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "project.naming_rules_deleted", "project", "", project, project, nil, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FlagLintProblem is a problem lintFlagsHandler found in a flags file
+type FlagLintProblem struct {
+	Flag    string `json:"flag"`
+	Kind    string `json:"kind"` // key, naming or config
+	Message string `json:"message"`
+}
+
+// FlagLintResult is the response of lintFlagsHandler
+type FlagLintResult struct {
+	Project  string            `json:"project,omitempty"`
+	Valid    bool              `json:"valid"`
+	Flags    int               `json:"flags"`
+	Problems []FlagLintProblem `json:"problems"`
+}
+
+// lintFlagsHandler checks a flags file, typically from a pull request, without
+// saving anything: every key and config is validated, and with ?project= the
+// keys are checked against that project's naming rules. The format is taken
+// from ?format= or the Content-Type, defaulting to yaml. Problems are reported
+// in a 200 response so CI can print them all.
+func (fm *FlagManager) lintFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	project := query.Get("project")
+
+	format := query.Get("format")
+	if format == "" {
+		format = importFormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if _, ok := flagFormatContentTypes[format]; !ok {
+		writeValidationError(w, "INVALID_FORMAT", "format must be one of: json, yaml, toml")
+		return
+	}
+
+	var rules *FlagNamingRules
+	if project != "" {
+		meta, ok, err := fm.getProjectMeta(r.Context(), project)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+			return
+		}
+		rules = meta.NamingRules
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	flags, err := decodeFlagFormat(format, body)
+	if err != nil {
+		writeValidationError(w, "INVALID_FLAGS_FILE", fmt.Sprintf("Invalid %s flags file: %v", format, err))
+		return
+	}
+
+	keys := make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := FlagLintResult{Project: project, Flags: len(flags), Problems: []FlagLintProblem{}}
+	for _, key := range keys {
+		config := flags[key]
+		if err := ValidateFlagKey(key); err != nil {
+			result.Problems = append(result.Problems, FlagLintProblem{Flag: key, Kind: "key", Message: err.Error()})
+		} else {
+			for _, e := range ValidateFlagKeyConvention(key, config.Owners, rules) {
+				result.Problems = append(result.Problems, FlagLintProblem{Flag: key, Kind: "naming", Message: e})
+			}
+		}
+		for _, e := range ValidateFlagConfig(config) {
+			result.Problems = append(result.Problems, FlagLintProblem{Flag: key, Kind: "config", Message: e})
+		}
+	}
+	result.Valid = len(result.Problems) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
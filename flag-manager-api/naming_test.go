@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFlagNamingRules(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+	rules := `{"pattern":"^[a-z][a-z0-9.-]*$","prefixes":["web.","shared."],"teamPrefixes":{"@acme/payments":["web.pay-"]},"maxLength":24,"reservedWords":["Test"]}`
+	doRequest(t, router, "PUT", "/api/projects/web/naming-rules", rules, http.StatusNotFound, nil)
+	doRequest(t, router, "POST", "/api/projects/web", "", http.StatusCreated, nil)
+	doRequest(t, router, "GET", "/api/projects/web/naming-rules", "", http.StatusNotFound, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/naming-rules", `{"pattern":"[a-"}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/naming-rules", `{"maxLength":500}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/naming-rules", `{"teamPrefixes":{"alice":["web."]}}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/naming-rules", rules, http.StatusOK, nil)
+
+	var got FlagNamingRules
+	doRequest(t, router, "GET", "/api/projects/web/naming-rules", "", http.StatusOK, &got)
+	if got.MaxLength != 24 || len(got.Prefixes) != 2 || len(got.TeamPrefixes["@acme/payments"]) != 1 {
+		t.Fatalf("Expected the stored rules, got %+v", got)
+	}
+
+	config := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}%s}`
+	var apiErr APIError
+	for _, key := range []string{"checkout", "web.Checkout", "web.checkout-flow-for-everyone", "web.test-checkout"} {
+		doRequest(t, router, "POST", "/api/projects/web/flags/"+key, fmt.Sprintf(config, ""), http.StatusBadRequest, &apiErr)
+		if apiErr.Code != "INVALID_FLAG_KEY" || len(apiErr.Details) != 1 {
+			t.Errorf("Expected one naming problem for %s, got %+v", key, apiErr)
+		}
+	}
+	doRequest(t, router, "POST", "/api/projects/web/flags/web.checkout", fmt.Sprintf(config, ""), http.StatusCreated, nil)
+
+	// Team prefixes apply to the flags a team owns
+	payments := `,"owners":["@Acme/Payments"]`
+	doRequest(t, router, "POST", "/api/projects/web/flags/web.refunds", fmt.Sprintf(config, payments), http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/web.pay-refunds", fmt.Sprintf(config, payments), http.StatusCreated, nil)
+
+	// Renames are checked, unchanged keys are not
+	update := fmt.Sprintf(`{"config":%s,"newKey":"%%s"}`, fmt.Sprintf(config, ""))
+	doRequest(t, router, "PUT", "/api/projects/web/flags/web.checkout", fmt.Sprintf(update, "checkout"), http.StatusBadRequest, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/flags/web.checkout", fmt.Sprintf(update, "shared.checkout"), http.StatusOK, nil)
+
+	// Clones are checked against the rules of their target project
+	doRequest(t, router, "POST", "/api/projects/web/flags/shared.checkout/clone", `{"newKey":"checkout-copy"}`, http.StatusBadRequest, &apiErr)
+	if apiErr.Code != "INVALID_FLAG_KEY" {
+		t.Errorf("Expected INVALID_FLAG_KEY for a clone, got %+v", apiErr)
+	}
+	doRequest(t, router, "POST", "/api/projects/web/flags/shared.checkout/clone", `{"newKey":"web.checkout-copy"}`, http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/other", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/other/flags/checkout", fmt.Sprintf(config, ""), http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/other/flags/checkout/clone", `{"newKey":"checkout-copy","targetProject":"web"}`, http.StatusBadRequest, nil)
+
+	flagsFile := `
+shared.banner:
+  variations: {on: true, off: false}
+  defaultRule: {variation: on}
+test-banner:
+  variations: {on: true, off: false}
+  defaultRule: {variation: missing}
+`
+	var lint FlagLintResult
+	req := httptest.NewRequest("POST", "/api/lint/flags?project=web", strings.NewReader(flagsFile))
+	req.Header.Set("Content-Type", "application/yaml")
+	serveRequest(t, router, req, http.StatusOK, &lint)
+	if lint.Valid || lint.Flags != 2 {
+		t.Fatalf("Expected an invalid file of 2 flags, got %+v", lint)
+	}
+	kinds := map[string]int{}
+	for _, p := range lint.Problems {
+		if p.Flag != "test-banner" {
+			t.Errorf("Expected only test-banner to have problems, got %+v", p)
+		}
+		kinds[p.Kind]++
+	}
+	if kinds["naming"] != 2 || kinds["config"] == 0 {
+		t.Errorf("Expected naming and config problems, got %+v", lint.Problems)
+	}
+
+	// Without a project only keys and configs are checked
+	doRequest(t, router, "POST", "/api/lint/flags?format=yaml", "test.banner:\n  variations: {on: true}\n  defaultRule: {variation: on}\n", http.StatusOK, &lint)
+	if !lint.Valid || len(lint.Problems) != 0 {
+		t.Errorf("Expected a valid file, got %+v", lint)
+	}
+	doRequest(t, router, "POST", "/api/lint/flags?project=missing", flagsFile, http.StatusNotFound, nil)
+	doRequest(t, router, "POST", "/api/lint/flags", "not: [valid", http.StatusBadRequest, nil)
+
+	doRequest(t, router, "DELETE", "/api/projects/web/naming-rules", "", http.StatusNoContent, nil)
+	doRequest(t, router, "DELETE", "/api/projects/web/naming-rules", "", http.StatusNotFound, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", fmt.Sprintf(config, ""), http.StatusCreated, nil)
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errNotificationRuleNotFound = errors.New("notification rule not found")
+	errNotificationRuleExists   = errors.New("notification rule already exists")
+)
+
+// NotificationRulesStore manages notification rule persistence in file mode
+type NotificationRulesStore struct {
+	filePath string
+	rules    []db.NotificationRule
+	mu       sync.RWMutex
+}
+
+// NewNotificationRulesStore creates a new notification rules store
+func NewNotificationRulesStore(configDir string) *NotificationRulesStore {
+	store := &NotificationRulesStore{
+		filePath: filepath.Join(configDir, "notification_rules.json"),
+	}
+	store.load()
+	return store
+}
+
+func (s *NotificationRulesStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.rules)
+}
+
+func (s *NotificationRulesStore) save() error {
+	data, err := json.MarshalIndent(s.rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filePath, data, 0644)
+}
+
+// nameTaken reports whether a rule other than id is named name.
+func (s *NotificationRulesStore) nameTaken(name, id string) bool {
+	for _, rule := range s.rules {
+		if rule.Name == name && rule.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the rules in evaluation order
+func (s *NotificationRulesStore) List() []db.NotificationRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := append([]db.NotificationRule{}, s.rules...)
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].Name < rules[j].Name
+	})
+	return rules
+}
+
+// Get returns a rule, or errNotificationRuleNotFound
+func (s *NotificationRulesStore) Get(id string) (*db.NotificationRule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rule := range s.rules {
+		if rule.ID == id {
+			return &rule, nil
+		}
+	}
+	return nil, errNotificationRuleNotFound
+}
+
+// Create stores a rule and returns it with its ID and timestamps
+func (s *NotificationRulesStore) Create(rule db.NotificationRule) (*db.NotificationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(rule.Name, "") {
+		return nil, errNotificationRuleExists
+	}
+	now := time.Now().UTC()
+	rule.ID = uuid.New().String()
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	s.rules = append(s.rules, rule)
+	if err := s.save(); err != nil {
+		s.rules = s.rules[:len(s.rules)-1]
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// Update replaces a rule, keeping its ID and creation time
+func (s *NotificationRulesStore) Update(id string, rule db.NotificationRule) (*db.NotificationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.rules {
+		if existing.ID != id {
+			continue
+		}
+		if s.nameTaken(rule.Name, id) {
+			return nil, errNotificationRuleExists
+		}
+		rule.ID = id
+		rule.CreatedAt = existing.CreatedAt
+		rule.UpdatedAt = time.Now().UTC()
+		s.rules[i] = rule
+		if err := s.save(); err != nil {
+			s.rules[i] = existing
+			return nil, err
+		}
+		return &rule, nil
+	}
+	return nil, errNotificationRuleNotFound
+}
+
+// Delete removes a rule
+func (s *NotificationRulesStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, rule := range s.rules {
+		if rule.ID != id {
+			continue
+		}
+		previous := s.rules
+		s.rules = append(s.rules[:i:i], s.rules[i+1:]...)
+		if err := s.save(); err != nil {
+			s.rules = previous
+			return err
+		}
+		return nil
+	}
+	return errNotificationRuleNotFound
+}
+
+// notificationRuleStoreError maps database errors to
+// errNotificationRuleNotFound and errNotificationRuleExists.
+func notificationRuleStoreError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return errNotificationRuleNotFound
+	case strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "UNIQUE"):
+		return errNotificationRuleExists
+	}
+	return err
+}
+
+func (fm *FlagManager) listNotificationRules(ctx context.Context) ([]db.NotificationRule, error) {
+	if fm.store != nil {
+		return fm.store.ListNotificationRules(ctx)
+	}
+	return fm.notificationRules.List(), nil
+}
+
+func (fm *FlagManager) getNotificationRule(ctx context.Context, id string) (*db.NotificationRule, error) {
+	if fm.store != nil {
+		rule, err := fm.store.GetNotificationRule(ctx, id)
+		return rule, notificationRuleStoreError(err)
+	}
+	return fm.notificationRules.Get(id)
+}
+
+func (fm *FlagManager) createNotificationRule(ctx context.Context, rule db.NotificationRule) (*db.NotificationRule, error) {
+	if fm.store != nil {
+		created, err := fm.store.CreateNotificationRule(ctx, rule)
+		return created, notificationRuleStoreError(err)
+	}
+	return fm.notificationRules.Create(rule)
+}
+
+func (fm *FlagManager) updateNotificationRule(ctx context.Context, id string, rule db.NotificationRule) (*db.NotificationRule, error) {
+	if fm.store != nil {
+		updated, err := fm.store.UpdateNotificationRule(ctx, id, rule)
+		return updated, notificationRuleStoreError(err)
+	}
+	return fm.notificationRules.Update(id, rule)
+}
+
+func (fm *FlagManager) deleteNotificationRule(ctx context.Context, id string) error {
+	if fm.store != nil {
+		return notificationRuleStoreError(fm.store.DeleteNotificationRule(ctx, id))
+	}
+	return fm.notificationRules.Delete(id)
+}
+
+// notifierIDs returns the IDs of the configured notifiers.
+func (fm *FlagManager) notifierIDs(ctx context.Context) ([]string, error) {
+	var ids []string
+	if fm.store != nil {
+		items, err := fm.store.ListNotifiers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, dbn := range items {
+			ids = append(ids, dbn.ID)
+		}
+		return ids, nil
+	}
+	for _, n := range fm.notifiers.ListRaw() {
+		ids = append(ids, n.ID)
+	}
+	return ids, nil
+}
+
+// writeNotificationRuleError responds with the status of a notification rule
+// store error.
+func writeNotificationRuleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errNotificationRuleNotFound):
+		writeError(w, http.StatusNotFound, "NOTIFICATION_RULE_NOT_FOUND", "Notification rule not found")
+	case errors.Is(err, errNotificationRuleExists):
+		writeError(w, http.StatusConflict, "NOTIFICATION_RULE_EXISTS", "Notification rule with this name already exists")
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+}
+
+// validateNotificationRule checks the name, the conditions and that the rule
+// routes to known notifiers.
+func validateNotificationRule(rule db.NotificationRule, notifiers []string) []string {
+	var errs []string
+	if rule.Name == "" {
+		errs = append(errs, "name is required")
+	}
+	for _, event := range validateNotifierEvents(rule.Match.Events) {
+		errs = append(errs, "unknown event "+event)
+	}
+	for _, severity := range rule.Match.Severities {
+		if !slices.Contains(notificationSeverities, severity) {
+			errs = append(errs, "severity must be one of "+strings.Join(notificationSeverities, ", "))
+			break
+		}
+	}
+	for _, project := range rule.Match.Projects {
+		if err := ValidateProjectName(project); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(rule.Notifiers) == 0 {
+		errs = append(errs, "at least one notifier is required")
+	}
+	for _, id := range rule.Notifiers {
+		if !slices.Contains(notifiers, id) {
+			errs = append(errs, "unknown notifier "+id)
+		}
+	}
+	return errs
+}
+
+// matchesNotificationRule reports whether a notification meets every
+// condition of a rule. A change to a flag's base configuration applies to
+// all environments, so notifications without an environment meet any
+// environment condition.
+func matchesNotificationRule(m db.NotificationRuleMatch, n Notification) bool {
+	anyOf := func(values []string, candidates ...string) bool {
+		if len(values) == 0 {
+			return true
+		}
+		for _, c := range candidates {
+			if slices.Contains(values, c) {
+				return true
+			}
+		}
+		return false
+	}
+	return anyOf(m.Events, n.Event) &&
+		anyOf(m.Projects, n.Change.Project) &&
+		anyOf(m.Tags, n.Tags...) &&
+		(n.Environment == "" || anyOf(m.Environments, n.Environment)) &&
+		anyOf(m.Severities, n.Severity)
+}
+
+// routeNotification returns which of the notifiers a notification goes to,
+// and the rules that matched. The enabled rules are evaluated in order and
+// the first match decides, unless it continues to the next rules. When no
+// rule matches, the notification goes to the notifiers no rule routes to, so
+// a catch-all notifier needs no rule.
+func routeNotification(rules []db.NotificationRule, notifiers []string, n Notification) (recipients []string, matched []db.NotificationRule) {
+	routed := make(map[string]bool)
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		for _, id := range rule.Notifiers {
+			routed[id] = true
+		}
+	}
+	for _, rule := range rules {
+		if !rule.Enabled || !matchesNotificationRule(rule.Match, n) {
+			continue
+		}
+		matched = append(matched, rule)
+		for _, id := range rule.Notifiers {
+			if slices.Contains(notifiers, id) && !slices.Contains(recipients, id) {
+				recipients = append(recipients, id)
+			}
+		}
+		if !rule.Continue {
+			break
+		}
+	}
+	if len(matched) == 0 {
+		for _, id := range notifiers {
+			if !routed[id] {
+				recipients = append(recipients, id)
+			}
+		}
+	}
+	return recipients, matched
+}
+
+// NotificationRulesResponse lists the notification rules.
+type NotificationRulesResponse struct {
+	Rules []db.NotificationRule `json:"rules"`
+	Total int                   `json:"total"`
+}
+
+func (fm *FlagManager) listNotificationRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := fm.listNotificationRules(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NotificationRulesResponse{Rules: rules, Total: len(rules)})
+}
+
+func (fm *FlagManager) getNotificationRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule, err := fm.getNotificationRule(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeNotificationRuleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+// decodeNotificationRule reads and validates the rule of a request body. It
+// writes the error response and returns false when the rule is invalid.
+func (fm *FlagManager) decodeNotificationRule(w http.ResponseWriter, r *http.Request) (db.NotificationRule, bool) {
+	rule := db.NotificationRule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return rule, false
+	}
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Notifiers == nil {
+		rule.Notifiers = []string{}
+	}
+
+	notifiers, err := fm.notifierIDs(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return rule, false
+	}
+	if errs := validateNotificationRule(rule, notifiers); len(errs) > 0 {
+		writeValidationError(w, "INVALID_NOTIFICATION_RULE", "Notification rule is invalid", errs...)
+		return rule, false
+	}
+	return rule, true
+}
+
+func (fm *FlagManager) createNotificationRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule, ok := fm.decodeNotificationRule(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := fm.createNotificationRule(r.Context(), rule)
+	if err != nil {
+		writeNotificationRuleError(w, err)
+		return
+	}
+	fm.afterNotifierChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "notification_rule.created", "notification_rule", created.ID, created.Name, "",
+		map[string]interface{}{"after": created}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (fm *FlagManager) updateNotificationRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	before, err := fm.getNotificationRule(r.Context(), id)
+	if err != nil {
+		writeNotificationRuleError(w, err)
+		return
+	}
+	rule, ok := fm.decodeNotificationRule(w, r)
+	if !ok {
+		return
+	}
+	updated, err := fm.updateNotificationRule(r.Context(), id, rule)
+	if err != nil {
+		writeNotificationRuleError(w, err)
+		return
+	}
+	fm.afterNotifierChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "notification_rule.updated", "notification_rule", updated.ID, updated.Name, "",
+		map[string]interface{}{"before": before, "after": updated}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (fm *FlagManager) deleteNotificationRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	existing, err := fm.getNotificationRule(r.Context(), id)
+	if err != nil {
+		writeNotificationRuleError(w, err)
+		return
+	}
+	if err := fm.deleteNotificationRule(r.Context(), id); err != nil {
+		writeNotificationRuleError(w, err)
+		return
+	}
+	fm.afterNotifierChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "notification_rule.deleted", "notification_rule", id, existing.Name, "",
+		map[string]interface{}{"before": existing}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// NotificationRouteResponse shows where a notification would be sent.
+type NotificationRouteResponse struct {
+	Matched   []db.NotificationRule `json:"matched"`
+	Notifiers []string              `json:"notifiers"` // IDs of the notifiers routed to
+}
+
+// evaluateNotificationRulesHandler routes a sample notification, given by its
+// event, project, tags, environment and severity, without sending it.
+// Notifiers that are disabled or filter out the event are still listed.
+func (fm *FlagManager) evaluateNotificationRulesHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Event       string   `json:"event"`
+		Project     string   `json:"project,omitempty"`
+		Tags        []string `json:"tags,omitempty"`
+		Environment string   `json:"environment,omitempty"`
+		Severity    string   `json:"severity,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if !slices.Contains(notifierEvents, body.Event) {
+		writeValidationError(w, "INVALID_NOTIFICATION", "event must be one of "+strings.Join(notifierEvents, ", "))
+		return
+	}
+	if body.Severity == "" {
+		body.Severity = "info"
+	} else if !slices.Contains(notificationSeverities, body.Severity) {
+		writeValidationError(w, "INVALID_NOTIFICATION", "severity must be one of "+strings.Join(notificationSeverities, ", "))
+		return
+	}
+
+	rules, err := fm.listNotificationRules(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	notifiers, err := fm.notifierIDs(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	n := Notification{
+		Event:       body.Event,
+		Severity:    body.Severity,
+		Environment: body.Environment,
+		Tags:        body.Tags,
+		Change:      ChangeEvent{Project: body.Project},
+	}
+	recipients, matched := routeNotification(rules, notifiers, n)
+
+	resp := NotificationRouteResponse{Matched: matched, Notifiers: recipients}
+	if resp.Matched == nil {
+		resp.Matched = []db.NotificationRule{}
+	}
+	if resp.Notifiers == nil {
+		resp.Notifiers = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
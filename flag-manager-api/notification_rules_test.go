@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestNotificationRules(t *testing.T) {
+	requests := make(chan string, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Notification
+		json.NewDecoder(r.Body).Decode(&payload)
+		requests <- r.URL.Path + " " + payload.Severity + " " + payload.Environment
+	}))
+	defer server.Close()
+
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			defer fm.audit.notify.configure(nil)
+			route := func(body string) []string {
+				t.Helper()
+				var resp NotificationRouteResponse
+				doRequest(t, router, "POST", "/api/notification-rules/evaluate", body, http.StatusOK, &resp)
+				sort.Strings(resp.Notifiers)
+				return resp.Notifiers
+			}
+
+			for _, id := range []string{"pager", "ops", "chat"} {
+				doRequest(t, router, "POST", "/api/notifiers", `{"id":"`+id+`","name":"`+id+`","kind":"webhook","enabled":true,"endpointUrl":"`+server.URL+`/`+id+`"}`, http.StatusCreated, nil)
+			}
+
+			doRequest(t, router, "POST", "/api/notification-rules", `{"name":"bad","notifiers":["nobody"]}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/notification-rules", `{"name":"bad","match":{"severities":["urgent"]},"notifiers":["pager"]}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/notification-rules", `{"name":"bad","notifiers":[]}`, http.StatusBadRequest, nil)
+
+			var prod, payments db.NotificationRule
+			doRequest(t, router, "POST", "/api/notification-rules", `{"name":"prod-disables","match":{"environments":["production"],"severities":["critical"]},"notifiers":["pager"]}`, http.StatusCreated, &prod)
+			doRequest(t, router, "POST", "/api/notification-rules", `{"name":"prod-disables","notifiers":["pager"]}`, http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/notification-rules", `{"name":"payments","priority":10,"match":{"tags":["payments"]},"notifiers":["ops"]}`, http.StatusCreated, &payments)
+			if !prod.Enabled || prod.ID == "" {
+				t.Fatalf("Expected an enabled rule with an ID, got %+v", prod)
+			}
+
+			var list NotificationRulesResponse
+			doRequest(t, router, "GET", "/api/notification-rules", "", http.StatusOK, &list)
+			if list.Total != 2 || list.Rules[0].Name != "prod-disables" || list.Rules[1].Name != "payments" {
+				t.Fatalf("Expected the rules in priority order, got %+v", list.Rules)
+			}
+
+			if got := route(`{"event":"flag.updated","severity":"critical","environment":"production","tags":["payments"]}`); !reflect.DeepEqual(got, []string{"pager"}) {
+				t.Fatalf("Expected the first matching rule to decide, got %v", got)
+			}
+			if got := route(`{"event":"flag.deleted","severity":"critical"}`); !reflect.DeepEqual(got, []string{"pager"}) {
+				t.Fatalf("Expected base changes to match environment rules, got %v", got)
+			}
+			if got := route(`{"event":"flag.updated","severity":"critical","environment":"staging","tags":["payments"]}`); !reflect.DeepEqual(got, []string{"ops"}) {
+				t.Fatalf("Expected the payments rule, got %v", got)
+			}
+			if got := route(`{"event":"flag.created","environment":"staging"}`); !reflect.DeepEqual(got, []string{"chat"}) {
+				t.Fatalf("Expected unmatched events on the notifiers no rule names, got %v", got)
+			}
+			doRequest(t, router, "POST", "/api/notification-rules/evaluate", `{"event":"flag.renamed"}`, http.StatusBadRequest, nil)
+
+			doRequest(t, router, "PUT", "/api/notification-rules/"+prod.ID, `{"name":"prod-disables","continue":true,"match":{"environments":["production"],"severities":["critical"]},"notifiers":["pager"]}`, http.StatusOK, nil)
+			if got := route(`{"event":"flag.updated","severity":"critical","environment":"production","tags":["payments"]}`); !reflect.DeepEqual(got, []string{"ops", "pager"}) {
+				t.Fatalf("Expected a continuing rule to reach the next rules, got %v", got)
+			}
+
+			t.Run("dispatch", func(t *testing.T) {
+				disabled := true
+				fm.audit.Log(context.Background(), Actor{ID: "u1", Type: "user"}, "flag.environment_updated", "flag", "f1", "checkout", "web",
+					map[string]interface{}{"before": FlagConfig{Tags: []string{"payments"}}, "after": FlagConfig{Disable: &disabled, Tags: []string{"payments"}}},
+					map[string]interface{}{"environment": "production"})
+				var got []string
+				for len(got) < 2 {
+					select {
+					case req := <-requests:
+						got = append(got, req)
+					case <-time.After(5 * time.Second):
+						t.Fatalf("Timed out waiting for notifications, got %v", got)
+					}
+				}
+				sort.Strings(got)
+				if want := []string{"/ops critical production", "/pager critical production"}; !reflect.DeepEqual(got, want) {
+					t.Fatalf("Expected %v, got %v", want, got)
+				}
+				select {
+				case req := <-requests:
+					t.Fatalf("Unexpected notification %s", req)
+				case <-time.After(50 * time.Millisecond):
+				}
+			})
+
+			doRequest(t, router, "DELETE", "/api/notification-rules/"+payments.ID, "", http.StatusNoContent, nil)
+			doRequest(t, router, "GET", "/api/notification-rules/"+payments.ID, "", http.StatusNotFound, nil)
+			if got := route(`{"event":"flag.updated","severity":"warning","tags":["payments"]}`); !reflect.DeepEqual(got, []string{"chat", "ops"}) {
+				t.Fatalf("Expected the deleted rule's notifier to get unmatched events again, got %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Notifiers deliver the manager's own events, besides being passed to the
+// relay proxy, which notifies about the flag changes it detects.
+const (
+	notifierQueueSize   = 100 // notifications waiting for delivery, per notifier
+	notifierMaxAttempts = 5
+)
+
+// notifierRetryDelay is the delay before the first retry of a notification; it
+// doubles on each further attempt.
+var notifierRetryDelay = time.Second
+
+// notifierDigestUnit is the unit of the digestMinutes of email notifiers.
+var notifierDigestUnit = time.Minute
+
+// notifierEvents are the manager events notifiers are sent. A notifier with no
+// events configured is sent all of them.
+var notifierEvents = []string{
+	"flag.created",
+	"flag.updated",
+	"flag.deleted",
+	"change_request.opened",
+	"change_request.approved",
+	"change_request.rejected",
+}
+
+// validateNotifierEvents returns the events not in notifierEvents.
+func validateNotifierEvents(events []string) []string {
+	var unknown []string
+	for _, event := range events {
+		if !slices.Contains(notifierEvents, event) {
+			unknown = append(unknown, event)
+		}
+	}
+	return unknown
+}
+
+// notificationSeverities are the severities of notifications, for routing:
+// flag deletions, disables and halted ramps are critical, other flag updates
+// and rejected change requests warnings, and everything else info.
+var notificationSeverities = []string{"info", "warning", "critical"}
+
+// newNotification builds the notification of a change, or returns false for
+// changes notifiers are not sent. Updates of a flag in one environment, bulk
+// enables and disables, and ramps the rollout controller advances or halts,
+// are flag updates.
+func newNotification(change ChangeEvent, metadata json.RawMessage) (Notification, bool) {
+	var changes struct {
+		Before   *FlagConfig `json:"before"`
+		After    *FlagConfig `json:"after"`
+		Decision string      `json:"decision"` // change request reviews
+	}
+	json.Unmarshal(change.Changes, &changes)
+	var meta struct {
+		Environment string `json:"environment"`
+	}
+	json.Unmarshal(metadata, &meta)
+
+	n := Notification{Severity: "info", Environment: meta.Environment, Change: change}
+	switch change.Action {
+	case "flag.created":
+		n.Event = change.Action
+	case "flag.updated", "flag.enabled", "flag.disabled", "flag.environment_updated", "flag.environment_reset", "flag.ramp_advanced":
+		n.Event = "flag.updated"
+		n.Severity = "warning"
+		disabled := changes.After != nil && flagDisabled(*changes.After) && (changes.Before == nil || !flagDisabled(*changes.Before))
+		if disabled || change.Action == "flag.disabled" {
+			n.Severity = "critical"
+		}
+	case "flag.deleted":
+		n.Event = change.Action
+		n.Severity = "critical"
+	case "flag.ramp_halted":
+		n.Event = "flag.updated"
+		n.Severity = "critical"
+	case "change_request.created":
+		n.Event = "change_request.opened"
+	case "change_request.reviewed":
+		switch changes.Decision {
+		case "approved":
+			n.Event = "change_request.approved"
+		case "rejected":
+			n.Event = "change_request.rejected"
+			n.Severity = "warning"
+		default:
+			return n, false
+		}
+	default:
+		return n, false
+	}
+	for _, config := range []*FlagConfig{changes.After, changes.Before} {
+		if config != nil && len(config.Tags) > 0 {
+			n.Tags = config.Tags
+			break
+		}
+	}
+	return n, true
+}
+
+// wants reports whether the notifier is sent an event.
+func (n *Notifier) wants(event string) bool {
+	return len(n.Events) == 0 || slices.Contains(n.Events, event)
+}
+
+// Notification is a manager event as delivered to a notifier.
+type Notification struct {
+	Event       string      `json:"event"`
+	Severity    string      `json:"severity"`
+	Environment string      `json:"environment,omitempty"` // set for changes made in one environment
+	Tags        []string    `json:"tags,omitempty"`        // the flag's tags
+	Change      ChangeEvent `json:"change"`
+}
+
+// summary describes the notification in one line of markdown.
+func (n Notification) summary() string {
+	c := n.Change
+	var s string
+	switch n.Event {
+	case "flag.created", "flag.updated", "flag.deleted":
+		s = fmt.Sprintf("Flag `%s` %s", c.ResourceName, strings.TrimPrefix(n.Event, "flag."))
+	case "change_request.opened", "change_request.approved", "change_request.rejected":
+		s = fmt.Sprintf("Change request \"%s\" %s", c.ResourceName, strings.TrimPrefix(n.Event, "change_request."))
+	default:
+		s = n.Event
+	}
+	switch {
+	case c.Project != "":
+		s += fmt.Sprintf(" in project `%s`", c.Project)
+	case c.FlagSet != "":
+		s += fmt.Sprintf(" in flag set `%s`", c.FlagSet)
+	}
+	if n.Environment != "" {
+		s += fmt.Sprintf(", environment `%s`", n.Environment)
+	}
+	if actor := actorDisplayName(c.Actor); actor != "" {
+		s += " by " + actor
+	}
+	return s
+}
+
+// details lists the changed fields of an update, if any.
+func (n Notification) details() string {
+	var lines []string
+	for _, d := range n.Change.Diff {
+		lines = append(lines, fmt.Sprintf("• `%s` %s", d.Path, d.Op))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func actorDisplayName(actor Actor) string {
+	switch {
+	case actor.Email != "":
+		return actor.Email
+	case actor.Name != "":
+		return actor.Name
+	}
+	return actor.ID
+}
+
+// notifierSender delivers a notification to a notifier.
+type notifierSender func(n Notification) error
+
+// newNotifierSender returns the delivery function of a notifier's kind.
+func newNotifierSender(notifier Notifier) notifierSender {
+	switch notifier.Kind {
+	case "slack":
+		return func(n Notification) error { return sendSlackNotification(notifier, n) }
+	case "discord":
+		return func(n Notification) error { return sendDiscordNotification(notifier, n) }
+	case "microsoftteams":
+		return func(n Notification) error { return sendTeamsNotification(notifier, n) }
+	case "webhook":
+		return func(n Notification) error { return sendWebhookNotification(notifier, n) }
+	case "pagerduty":
+		return func(n Notification) error { return sendPagerDutyNotification(notifier, n) }
+	case "opsgenie":
+		return func(n Notification) error { return sendOpsgenieNotification(notifier, n) }
+	case "email":
+		return func(n Notification) error { return sendEmailNotifications(notifier, []Notification{n}, false) }
+	case "log":
+		return func(n Notification) error {
+			slog.Info("Notification", "notifier", notifier.Name, "event", n.Event, "summary", n.summary())
+			return nil
+		}
+	}
+	return func(Notification) error { return fmt.Errorf("unknown notifier kind %q", notifier.Kind) }
+}
+
+func sendSlackNotification(notifier Notifier, n Notification) error {
+	if notifier.WebhookURL == "" {
+		return fmt.Errorf("webhook URL is required")
+	}
+	text := n.summary()
+	if details := n.details(); details != "" {
+		text += "\n" + details
+	}
+	payload := map[string]interface{}{
+		"text": n.summary(),
+		"blocks": []map[string]interface{}{
+			{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": "*GO Feature Flag*\n" + text},
+			},
+		},
+	}
+	return sendWebhook(notifier.WebhookURL, payload, nil)
+}
+
+func sendDiscordNotification(notifier Notifier, n Notification) error {
+	if notifier.WebhookURL == "" {
+		return fmt.Errorf("webhook URL is required")
+	}
+	payload := map[string]interface{}{
+		"content": n.summary(),
+	}
+	if details := n.details(); details != "" {
+		payload["embeds"] = []map[string]interface{}{
+			{"title": "Changes", "description": details, "color": 3447003}, // Blue
+		}
+	}
+	return sendWebhook(notifier.WebhookURL, payload, nil)
+}
+
+func sendTeamsNotification(notifier Notifier, n Notification) error {
+	if notifier.WebhookURL == "" {
+		return fmt.Errorf("webhook URL is required")
+	}
+	facts := []map[string]string{
+		{"name": "Event", "value": n.Event},
+		{"name": "Severity", "value": n.Severity},
+		{"name": "Actor", "value": actorDisplayName(n.Change.Actor)},
+	}
+	if n.Change.Project != "" {
+		facts = append(facts, map[string]string{"name": "Project", "value": n.Change.Project})
+	}
+	if n.Change.FlagSet != "" {
+		facts = append(facts, map[string]string{"name": "Flag set", "value": n.Change.FlagSet})
+	}
+	if n.Environment != "" {
+		facts = append(facts, map[string]string{"name": "Environment", "value": n.Environment})
+	}
+	payload := map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "http://schema.org/extensions",
+		"themeColor": "0076D7",
+		"summary":    n.summary(),
+		"sections": []map[string]interface{}{
+			{
+				"activityTitle": n.summary(),
+				"text":          n.details(),
+				"facts":         facts,
+				"markdown":      true,
+			},
+		},
+	}
+	return sendWebhook(notifier.WebhookURL, payload, nil)
+}
+
+// sendWebhookNotification posts the notification as JSON, signed as GO
+// Feature Flag signs its webhook notifications when the notifier has a secret.
+func sendWebhookNotification(notifier Notifier, n Notification) error {
+	if notifier.EndpointURL == "" {
+		return fmt.Errorf("endpoint URL is required")
+	}
+	payload, err := json.Marshal(struct {
+		Type string `json:"type"` // always "event"
+		Notification
+		Meta map[string]string `json:"meta,omitempty"`
+	}{"event", n, notifier.Meta})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	headers := make(map[string]string, len(notifier.Headers)+1)
+	for k, v := range notifier.Headers {
+		headers[k] = v
+	}
+	if notifier.Secret != "" {
+		headers["X-Hub-Signature-256"] = "sha256=" + signProjectWebhookPayload(notifier.Secret, payload)
+	}
+	return sendWebhook(notifier.EndpointURL, json.RawMessage(payload), headers)
+}
+
+// NotifierStatus is the delivery state of a notifier.
+type NotifierStatus struct {
+	Queued          int        `json:"queued"`
+	Delivered       int        `json:"delivered"`
+	Failed          int        `json:"failed"`            // notifications dropped after every attempt failed
+	Pending         int        `json:"pending,omitempty"` // notifications waiting for the next digest
+	LastError       string     `json:"lastError,omitempty"`
+	LastDeliveredAt *time.Time `json:"lastDeliveredAt,omitempty"`
+}
+
+// notifierState is the queue and delivery worker of a notifier. The worker
+// runs until the notifier is deleted; a changed notifier keeps its queue.
+type notifierState struct {
+	queue chan Notification
+	stop  chan struct{}
+
+	mu       sync.Mutex
+	notifier Notifier
+	send     notifierSender
+	status   NotifierStatus
+	digest   []Notification // waiting for the next digest email
+}
+
+// digestInterval returns how often notifications are batched into a digest,
+// or 0 when they are sent one by one. Only email notifiers send digests.
+func (s *notifierState) digestInterval() time.Duration {
+	if s.notifier.Kind != "email" {
+		return 0
+	}
+	return time.Duration(s.notifier.DigestMinutes) * notifierDigestUnit
+}
+
+func (s *notifierState) run() {
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-s.stop:
+			return
+		case n := <-s.queue:
+			s.mu.Lock()
+			interval := s.digestInterval()
+			if interval > 0 {
+				s.digest = append(s.digest, n)
+			}
+			s.mu.Unlock()
+			if interval == 0 {
+				s.deliver([]Notification{n}, false)
+			} else if flush == nil {
+				flush = time.After(interval)
+			}
+		case <-flush:
+			flush = nil
+			s.mu.Lock()
+			batch := s.digest
+			s.digest = nil
+			s.mu.Unlock()
+			if len(batch) > 0 {
+				s.deliver(batch, true)
+			}
+		}
+	}
+}
+
+// deliver sends a notification, or a digest of several, retrying failed
+// attempts with exponential backoff, and drops it when every attempt failed.
+func (s *notifierState) deliver(batch []Notification, digest bool) {
+	delay := notifierRetryDelay
+	for attempt := 1; ; attempt++ {
+		s.mu.Lock()
+		send, notifier := s.send, s.notifier
+		s.mu.Unlock()
+
+		var err error
+		if digest {
+			err = sendEmailNotifications(notifier, batch, true)
+		} else {
+			err = send(batch[0])
+		}
+		if err == nil {
+			now := time.Now().UTC()
+			s.mu.Lock()
+			s.status.Delivered += len(batch)
+			s.status.LastDeliveredAt = &now
+			s.mu.Unlock()
+			return
+		}
+		if attempt == notifierMaxAttempts {
+			s.fail(batch, err, attempt)
+			return
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-s.stop:
+			s.fail(batch, err, attempt)
+			return
+		}
+	}
+}
+
+func (s *notifierState) fail(batch []Notification, err error, attempts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Failed += len(batch)
+	s.status.LastError = err.Error()
+	slog.Warn("Notification not delivered", "notifier", s.notifier.Name, "event", batch[0].Event, "notifications", len(batch), "attempts", attempts, "error", err)
+}
+
+// notifierDispatcher sends manager events to the configured notifiers, as
+// routed by the notification rules. The zero value has no notifiers and is
+// ready to use.
+type notifierDispatcher struct {
+	mu     sync.RWMutex
+	states map[string]*notifierState
+	rules  []db.NotificationRule // in evaluation order
+}
+
+// configure replaces the notifiers events are sent to.
+func (d *notifierDispatcher) configure(notifiers []Notifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	states := make(map[string]*notifierState, len(notifiers))
+	for _, notifier := range notifiers {
+		s, ok := d.states[notifier.ID]
+		if !ok {
+			s = &notifierState{queue: make(chan Notification, notifierQueueSize), stop: make(chan struct{})}
+			go s.run()
+		}
+		s.mu.Lock()
+		s.notifier = notifier
+		s.send = newNotifierSender(notifier)
+		s.mu.Unlock()
+		states[notifier.ID] = s
+	}
+	for id, s := range d.states {
+		if _, ok := states[id]; !ok {
+			close(s.stop)
+		}
+	}
+	d.states = states
+}
+
+// setRules replaces the notification rules.
+func (d *notifierDispatcher) setRules(rules []db.NotificationRule) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rules = rules
+}
+
+// publish queues a notification for every enabled notifier it is routed to
+// whose events include it.
+func (d *notifierDispatcher) publish(n Notification) {
+	if d == nil {
+		return
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ids := make([]string, 0, len(d.states))
+	for id := range d.states {
+		ids = append(ids, id)
+	}
+	recipients, _ := routeNotification(d.rules, ids, n)
+	for _, id := range recipients {
+		s := d.states[id]
+		s.mu.Lock()
+		wanted := s.notifier.Enabled && s.notifier.wants(n.Event)
+		s.mu.Unlock()
+		if !wanted {
+			continue
+		}
+		select {
+		case s.queue <- n:
+		default:
+			s.fail([]Notification{n}, errors.New("delivery queue full"), 0)
+		}
+	}
+}
+
+// status returns the delivery state of a notifier.
+func (d *notifierDispatcher) status(id string) NotifierStatus {
+	d.mu.RLock()
+	s := d.states[id]
+	d.mu.RUnlock()
+	if s == nil {
+		return NotifierStatus{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.status
+	status.Queued = len(s.queue)
+	status.Pending = len(s.digest)
+	return status
+}
+
+// reloadNotifiers hands the configured notifiers and notification rules to
+// the audit logger, which sends manager events to the enabled notifiers.
+func (fm *FlagManager) reloadNotifiers(ctx context.Context) error {
+	rules, err := fm.listNotificationRules(ctx)
+	if err != nil {
+		return err
+	}
+	var notifiers []Notifier
+	if fm.store != nil {
+		items, err := fm.store.ListNotifiers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, dbn := range items {
+			notifiers = append(notifiers, dbNotifierToNotifier(dbn))
+		}
+	} else {
+		notifiers = fm.notifiers.ListRaw()
+	}
+	fm.resolveNotifierSecrets(ctx, notifiers)
+	fm.audit.notify.configure(notifiers)
+	fm.audit.notify.setRules(rules)
+	return nil
+}
+
+// afterNotifierChange applies a notifier change to the audit logger.
+func (fm *FlagManager) afterNotifierChange(r *http.Request) {
+	if err := fm.reloadNotifiers(r.Context()); err != nil {
+		slog.WarnContext(r.Context(), "Failed to reload notifiers", "error", err)
+	}
+}
+
+func (fm *FlagManager) notifierStatusHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	if fm.store != nil {
+		if _, err := fm.store.GetNotifier(r.Context(), id); err != nil {
+			if err == pgx.ErrNoRows {
+				writeError(w, http.StatusNotFound, "NOTIFIER_NOT_FOUND", "Notifier not found")
+			} else {
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			}
+			return
+		}
+	} else if fm.notifiers.GetRaw(id) == nil {
+		writeError(w, http.StatusNotFound, "NOTIFIER_NOT_FOUND", "Notifier not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fm.audit.notify.status(id))
+}
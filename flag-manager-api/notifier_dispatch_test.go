@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestNotifierDispatch(t *testing.T) {
+	previousDelay := notifierRetryDelay
+	notifierRetryDelay = time.Millisecond
+	defer func() { notifierRetryDelay = previousDelay }()
+
+	type received struct {
+		path, signature string
+		body            []byte
+	}
+	requests := make(chan received, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{path: r.URL.Path, signature: r.Header.Get("X-Hub-Signature-256"), body: body}
+	}))
+	defer server.Close()
+
+	next := func(t *testing.T) received {
+		t.Helper()
+		select {
+		case req := <-requests:
+			return req
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for a notification")
+		}
+		return received{}
+	}
+	expectNone := func(t *testing.T) {
+		t.Helper()
+		select {
+		case req := <-requests:
+			t.Fatalf("Unexpected notification on %s: %s", req.path, req.body)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			defer fm.audit.notify.configure(nil)
+			ctx := context.Background()
+			actor := Actor{ID: "u1", Email: "alice@example.com", Type: "user"}
+
+			doRequest(t, router, "POST", "/api/notifiers", `{"id":"bad","name":"bad","kind":"webhook","events":["flag.renamed"]}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/notifiers", `{"id":"chat","name":"chat","kind":"slack","enabled":true,"webhookUrl":"`+server.URL+`/slack"}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/notifiers", `{"id":"hook","name":"hook","kind":"webhook","enabled":true,"endpointUrl":"`+server.URL+`/hook","secret":"s3cret",
+				"events":["flag.deleted","change_request.approved"]}`, http.StatusCreated, nil)
+
+			t.Run("filters events", func(t *testing.T) {
+				fm.audit.Log(ctx, actor, "flag.created", "flag", "f1", "checkout", "web", nil, nil)
+				if req := next(t); req.path != "/slack" || !bytes.Contains(req.body, []byte("Flag `checkout` created in project `web` by alice@example.com")) {
+					t.Fatalf("Unexpected Slack notification on %s: %s", req.path, req.body)
+				}
+				fm.audit.Log(ctx, actor, "flag.tags_updated", "flag", "f1", "checkout", "web", nil, nil)
+				expectNone(t)
+
+				fm.audit.Log(ctx, actor, "change_request.reviewed", "change_request", "cr1", "Enable checkout", "web",
+					map[string]interface{}{"decision": "approved"}, nil)
+				paths := []string{next(t).path, next(t).path}
+				sort.Strings(paths)
+				if !reflect.DeepEqual(paths, []string{"/hook", "/slack"}) {
+					t.Fatalf("Expected the approval on both notifiers, got %v", paths)
+				}
+				fm.audit.Log(ctx, actor, "change_request.reviewed", "change_request", "cr1", "Enable checkout", "web",
+					map[string]interface{}{"decision": "commented"}, nil)
+				expectNone(t)
+			})
+
+			t.Run("signs webhook notifications", func(t *testing.T) {
+				doRequest(t, router, "PUT", "/api/notifiers/chat", `{"name":"chat","kind":"slack","enabled":false,"webhookUrl":"`+server.URL+`/slack"}`, http.StatusOK, nil)
+				fm.audit.Log(ctx, actor, "flag.deleted", "flag", "f1", "checkout", "web", nil, nil)
+				req := next(t)
+				if req.path != "/hook" || req.signature != "sha256="+signProjectWebhookPayload("s3cret", req.body) {
+					t.Fatalf("Expected a signed webhook notification, got %s with %q", req.path, req.signature)
+				}
+				var payload struct {
+					Event  string      `json:"event"`
+					Change ChangeEvent `json:"change"`
+				}
+				if err := json.Unmarshal(req.body, &payload); err != nil || payload.Event != "flag.deleted" || payload.Change.ResourceName != "checkout" {
+					t.Fatalf("Unexpected webhook payload: %s", req.body)
+				}
+				expectNone(t)
+
+				var status NotifierStatus
+				doRequest(t, router, "GET", "/api/notifiers/hook/status", "", http.StatusOK, &status)
+				if status.Delivered != 2 || status.Failed != 0 || status.LastDeliveredAt == nil {
+					t.Fatalf("Unexpected status: %+v", status)
+				}
+			})
+
+			t.Run("retries then gives up", func(t *testing.T) {
+				doRequest(t, router, "PUT", "/api/notifiers/hook", `{"name":"hook","kind":"webhook","enabled":true,"endpointUrl":"`+server.URL+`/down"}`, http.StatusOK, nil)
+				fm.audit.Log(ctx, actor, "flag.deleted", "flag", "f2", "search", "web", nil, nil)
+
+				deadline := time.Now().Add(5 * time.Second)
+				var status NotifierStatus
+				for status.Failed == 0 && time.Now().Before(deadline) {
+					time.Sleep(10 * time.Millisecond)
+					doRequest(t, router, "GET", "/api/notifiers/hook/status", "", http.StatusOK, &status)
+				}
+				if status.Failed != 1 || status.Delivered != 2 || !strings.Contains(status.LastError, "502") {
+					t.Fatalf("Unexpected status: %+v", status)
+				}
+			})
+
+			doRequest(t, router, "DELETE", "/api/notifiers/hook", "", http.StatusNoContent, nil)
+			doRequest(t, router, "GET", "/api/notifiers/hook/status", "", http.StatusNotFound, nil)
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	emailTimeout     = 30 * time.Second
+	maxDigestMinutes = 24 * 60
+)
+
+var emailTLSModes = []string{"starttls", "tls", "none"}
+
+const (
+	defaultEmailSubjectTemplate = `[GO Feature Flag] {{if .Digest}}{{len .Notifications}} changes{{else}}{{.Summary}}{{end}}`
+	defaultEmailBodyTemplate    = `{{range .Notifications}}{{.Summary}}
+{{if eq .Event "change_request.opened"}}Your review is requested.
+{{end}}{{if .Details}}
+{{.Details}}
+{{end}}
+{{end}}--
+Sent by GO Feature Flag
+`
+)
+
+// EmailNotification is a notification as email templates see it.
+type EmailNotification struct {
+	Event       string
+	Severity    string
+	Summary     string // one line, without markdown
+	Details     string // the changed fields, one per line
+	Environment string
+	Tags        []string
+	Change      ChangeEvent
+}
+
+// EmailTemplateData is what the subject and body templates of an email
+// notifier are executed with: a single notification, whose fields are also
+// available at the top level, or a digest of several.
+type EmailTemplateData struct {
+	EmailNotification
+	Digest        bool
+	Notifications []EmailNotification
+}
+
+func newEmailTemplateData(batch []Notification, digest bool) EmailTemplateData {
+	data := EmailTemplateData{Digest: digest}
+	for _, n := range batch {
+		data.Notifications = append(data.Notifications, EmailNotification{
+			Event:       n.Event,
+			Severity:    n.Severity,
+			Summary:     strings.ReplaceAll(n.summary(), "`", ""),
+			Details:     strings.ReplaceAll(strings.ReplaceAll(n.details(), "`", ""), "• ", "- "),
+			Environment: n.Environment,
+			Tags:        n.Tags,
+			Change:      n.Change,
+		})
+	}
+	if len(data.Notifications) > 0 {
+		data.EmailNotification = data.Notifications[0]
+	}
+	return data
+}
+
+// emailTemplates parses the subject and body templates of a notifier.
+func emailTemplates(n Notifier) (subject, body *template.Template, err error) {
+	subjectText, bodyText := n.SubjectTemplate, n.BodyTemplate
+	if subjectText == "" {
+		subjectText = defaultEmailSubjectTemplate
+	}
+	if bodyText == "" {
+		bodyText = defaultEmailBodyTemplate
+	}
+	if subject, err = template.New("subject").Parse(subjectText); err != nil {
+		return nil, nil, fmt.Errorf("subjectTemplate: %w", err)
+	}
+	if body, err = template.New("body").Parse(bodyText); err != nil {
+		return nil, nil, fmt.Errorf("bodyTemplate: %w", err)
+	}
+	return subject, body, nil
+}
+
+// validateEmailNotifier checks the SMTP settings, recipients, templates and
+// digest interval of an email notifier.
+func validateEmailNotifier(n Notifier) []string {
+	if n.Kind != "email" {
+		return nil
+	}
+	var errs []string
+	if n.SMTPHost == "" {
+		errs = append(errs, "smtpHost is required")
+	}
+	if n.SMTPPort < 0 || n.SMTPPort > 65535 {
+		errs = append(errs, "smtpPort must be between 1 and 65535")
+	}
+	if n.SMTPTLS != "" && !slices.Contains(emailTLSModes, n.SMTPTLS) {
+		errs = append(errs, "smtpTls must be one of "+strings.Join(emailTLSModes, ", "))
+	}
+	if _, err := mail.ParseAddress(n.From); err != nil {
+		errs = append(errs, "from must be an email address")
+	}
+	if len(n.To) == 0 {
+		errs = append(errs, "at least one recipient is required in to")
+	}
+	for _, to := range n.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			errs = append(errs, "invalid recipient "+to)
+		}
+	}
+	if _, _, err := emailTemplates(n); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if n.DigestMinutes < 0 || n.DigestMinutes > maxDigestMinutes {
+		errs = append(errs, fmt.Sprintf("digestMinutes must be between 0 and %d", maxDigestMinutes))
+	}
+	return errs
+}
+
+// sendEmailNotifications sends a notification, or a digest of several, as
+// one email.
+func sendEmailNotifications(notifier Notifier, batch []Notification, digest bool) error {
+	subjectTmpl, bodyTmpl, err := emailTemplates(notifier)
+	if err != nil {
+		return err
+	}
+	data := newEmailTemplateData(batch, digest)
+	var subject, body bytes.Buffer
+	if err := subjectTmpl.Execute(&subject, data); err != nil {
+		return fmt.Errorf("subjectTemplate: %w", err)
+	}
+	if err := bodyTmpl.Execute(&body, data); err != nil {
+		return fmt.Errorf("bodyTemplate: %w", err)
+	}
+	return sendEmail(notifier, strings.TrimSpace(subject.String()), body.String())
+}
+
+func testEmailNotifier(n *Notifier) error {
+	return sendEmail(*n, "[GO Feature Flag] Test notification",
+		"This is a test notification from GOFF UI. Your email notifier is configured correctly!\n")
+}
+
+// sendEmail sends a plain text email through the notifier's SMTP server.
+func sendEmail(n Notifier, subject, body string) error {
+	if n.SMTPHost == "" {
+		return fmt.Errorf("SMTP host is required")
+	}
+	if len(n.To) == 0 {
+		return fmt.Errorf("at least one recipient is required")
+	}
+	mode := n.SMTPTLS
+	if mode == "" {
+		mode = "starttls"
+	}
+	port := n.SMTPPort
+	if port == 0 {
+		port = 587
+		if mode == "tls" {
+			port = 465
+		}
+	}
+
+	msg, err := emailMessage(n.From, n.To, subject, body)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(n.SMTPHost, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: emailTimeout}
+	tlsConfig := &tls.Config{ServerName: n.SMTPHost}
+	var conn net.Conn
+	if mode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	client, err := smtp.NewClient(conn, n.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if mode == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if n.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.SMTPUsername, n.SMTPPassword, n.SMTPHost)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	from, err := mail.ParseAddress(n.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %s", n.From)
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP server refused sender: %w", err)
+	}
+	for _, to := range n.To {
+		addr, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %s", to)
+		}
+		if err := client.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("SMTP server refused recipient %s: %w", addr.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP server refused message: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server refused message: %w", err)
+	}
+	return client.Quit()
+}
+
+// emailMessage formats a plain text, quoted-printable encoded email.
+func emailMessage(from string, to []string, subject, body string) ([]byte, error) {
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		msg.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from)
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
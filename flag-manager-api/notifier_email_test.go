@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEmailNotifier(t *testing.T) {
+	previousUnit := notifierDigestUnit
+	notifierDigestUnit = 100 * time.Millisecond
+	defer func() { notifierDigestUnit = previousUnit }()
+
+	// A minimal SMTP server that hands every message it accepts to messages.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch command := strings.ToUpper(strings.TrimSpace(line)); {
+					case command == "DATA":
+						fmt.Fprint(conn, "354 go ahead\r\n")
+						var data strings.Builder
+						for {
+							line, err := reader.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if line == ".\r\n" {
+								break
+							}
+							data.WriteString(line)
+						}
+						messages <- data.String()
+						fmt.Fprint(conn, "250 queued\r\n")
+					case command == "QUIT":
+						fmt.Fprint(conn, "221 bye\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "250 ok\r\n")
+					}
+				}
+			}(conn)
+		}
+	}()
+	next := func(t *testing.T) string {
+		t.Helper()
+		select {
+		case msg := <-messages:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for an email")
+		}
+		return ""
+	}
+
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	defer fm.audit.notify.configure(nil)
+	router := setupTestRouter(fm)
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	smtp := `"smtpHost":"` + host + `","smtpPort":` + port + `,"smtpTls":"none","from":"GOFF <goff@example.com>"`
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"mail","name":"mail","kind":"email","to":["ops@example.com"]}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"mail","name":"mail","kind":"email",`+smtp+`,"to":["not an address"]}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"mail","name":"mail","kind":"email",`+smtp+`,"smtpTls":"ssl","to":["ops@example.com"]}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"mail","name":"mail","kind":"email",`+smtp+`,"to":["ops@example.com"],"subjectTemplate":"{{.Summary"}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"mail","name":"mail","kind":"email",`+smtp+`,"to":["ops@example.com"],"digestMinutes":-1}`, http.StatusBadRequest, nil)
+
+	var mail Notifier
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"mail","name":"mail","kind":"email","enabled":true,`+smtp+`,"smtpPassword":"s3cret","to":["ops@example.com","Reviewers <review@example.com>"]}`, http.StatusCreated, &mail)
+	if mail.SMTPPassword != "********" {
+		t.Fatalf("Expected the SMTP password to be masked, got %q", mail.SMTPPassword)
+	}
+	if configs := fm.notifiers.BuildNotifierConfig(); len(configs) != 0 {
+		t.Fatalf("Expected email notifiers to be left out of the relay proxy config, got %v", configs)
+	}
+
+	t.Run("test", func(t *testing.T) {
+		doRequest(t, router, "POST", "/api/notifiers/mail/test", "", http.StatusOK, nil)
+		if msg := next(t); !strings.Contains(msg, "Subject: [GO Feature Flag] Test notification") || !strings.Contains(msg, "To: ops@example.com, Reviewers <review@example.com>") {
+			t.Fatalf("Unexpected test email: %s", msg)
+		}
+	})
+
+	actor := Actor{ID: "u1", Email: "dev@example.com", Type: "user"}
+	t.Run("review request", func(t *testing.T) {
+		fm.audit.Log(context.Background(), actor, "change_request.created", "change_request", "cr1", "Enable checkout", "web", nil, nil)
+		msg := next(t)
+		if !strings.Contains(msg, "Subject: [GO Feature Flag] Change request") || !strings.Contains(msg, "Your review is requested.") {
+			t.Fatalf("Unexpected review request email: %s", msg)
+		}
+	})
+
+	t.Run("digest", func(t *testing.T) {
+		doRequest(t, router, "PUT", "/api/notifiers/mail", `{"name":"mail","kind":"email","enabled":true,`+smtp+`,"smtpPassword":"********","to":["ops@example.com"],"digestMinutes":1,"subjectTemplate":"{{len .Notifications}} flag changes"}`, http.StatusOK, nil)
+		if n := fm.notifiers.GetRaw("mail"); n.SMTPPassword != "s3cret" {
+			t.Fatalf("Expected a masked SMTP password to be kept, got %q", n.SMTPPassword)
+		}
+		fm.audit.Log(context.Background(), actor, "flag.created", "flag", "f1", "checkout", "web", nil, nil)
+		fm.audit.Log(context.Background(), actor, "flag.deleted", "flag", "f2", "search", "web", nil, nil)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for fm.audit.notify.status("mail").Pending != 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected 2 pending notifications, got %+v", fm.audit.notify.status("mail"))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		msg := next(t)
+		if !strings.Contains(msg, "Subject: 2 flag changes") || !strings.Contains(msg, "checkout") || !strings.Contains(msg, "search") {
+			t.Fatalf("Unexpected digest email: %s", msg)
+		}
+		select {
+		case msg := <-messages:
+			t.Fatalf("Expected a single digest email, got another: %s", msg)
+		case <-time.After(200 * time.Millisecond):
+		}
+		if status := fm.audit.notify.status("mail"); status.Pending != 0 || status.Delivered != 3 {
+			t.Fatalf("Unexpected status after the digest: %+v", status)
+		}
+	})
+
+	n := Notifier{ID: "mail", Kind: "email", SMTPHost: "smtp.example.com", SMTPPort: 465, SMTPTLS: "tls", SMTPUsername: "goff", SMTPPassword: "pw",
+		From: "goff@example.com", To: []string{"ops@example.com"}, SubjectTemplate: "{{.Summary}}", BodyTemplate: "{{.Details}}", DigestMinutes: 15}
+	if got := dbNotifierToNotifier(notifierToDBNotifier(n)); !reflect.DeepEqual(got, n) {
+		t.Fatalf("Expected email settings to survive the database config, got %+v", got)
+	}
+}
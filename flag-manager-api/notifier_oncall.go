@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// On-call notifiers page through PagerDuty or Opsgenie. The relay proxy has no
+// such notifiers, so only the manager delivers to them.
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	opsgenieAPIURL     = "https://api.opsgenie.com" // https://api.eu.opsgenie.com for EU accounts
+)
+
+var (
+	pagerDutySeverities = []string{"critical", "error", "warning", "info"}
+	opsgeniePriorities  = []string{"P1", "P2", "P3", "P4", "P5"}
+
+	// defaultPagerDutySeverities and defaultOpsgeniePriorities map notification
+	// severities when a notifier's severityMapping leaves them out.
+	defaultPagerDutySeverities = map[string]string{"critical": "critical", "warning": "warning", "info": "info"}
+	defaultOpsgeniePriorities  = map[string]string{"critical": "P1", "warning": "P3", "info": "P5"}
+)
+
+// validateSeverityMapping checks that an on-call notifier maps notification
+// severities to PagerDuty severities or Opsgenie priorities.
+func validateSeverityMapping(n Notifier) []string {
+	var allowed []string
+	switch n.Kind {
+	case "pagerduty":
+		allowed = pagerDutySeverities
+	case "opsgenie":
+		allowed = opsgeniePriorities
+	default:
+		if len(n.SeverityMapping) > 0 {
+			return []string{"severityMapping only applies to pagerduty and opsgenie notifiers"}
+		}
+		return nil
+	}
+
+	var errs []string
+	for severity, mapped := range n.SeverityMapping {
+		if !slices.Contains(notificationSeverities, severity) {
+			errs = append(errs, fmt.Sprintf("severityMapping: unknown severity %s, must be one of %s", severity, strings.Join(notificationSeverities, ", ")))
+		} else if !slices.Contains(allowed, mapped) {
+			errs = append(errs, fmt.Sprintf("severityMapping: %s must map to one of %s", severity, strings.Join(allowed, ", ")))
+		}
+	}
+	slices.Sort(errs)
+	return errs
+}
+
+// mappedSeverity returns the PagerDuty severity or Opsgenie priority of a
+// notification severity.
+func mappedSeverity(n Notifier, severity string) string {
+	if mapped, ok := n.SeverityMapping[severity]; ok {
+		return mapped
+	}
+	if n.Kind == "opsgenie" {
+		return defaultOpsgeniePriorities[severity]
+	}
+	return defaultPagerDutySeverities[severity]
+}
+
+func truncateText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
+
+// sendPagerDutyEvent triggers an alert through the PagerDuty Events API v2.
+func sendPagerDutyEvent(notifier Notifier, payload map[string]interface{}) error {
+	if notifier.RoutingKey == "" {
+		return fmt.Errorf("routing key is required")
+	}
+	endpoint := notifier.EndpointURL
+	if endpoint == "" {
+		endpoint = pagerDutyEventsURL
+	}
+	return sendWebhook(endpoint, map[string]interface{}{
+		"routing_key":  notifier.RoutingKey,
+		"event_action": "trigger",
+		"payload":      payload,
+	}, nil)
+}
+
+// sendOpsgenieAlert creates an alert through the Opsgenie Alert API.
+func sendOpsgenieAlert(notifier Notifier, alert map[string]interface{}) error {
+	if notifier.APIKey == "" {
+		return fmt.Errorf("API key is required")
+	}
+	base := notifier.EndpointURL
+	if base == "" {
+		base = opsgenieAPIURL
+	}
+	return sendWebhook(strings.TrimSuffix(base, "/")+"/v2/alerts", alert,
+		map[string]string{"Authorization": "GenieKey " + notifier.APIKey})
+}
+
+func sendPagerDutyNotification(notifier Notifier, n Notification) error {
+	c := n.Change
+	return sendPagerDutyEvent(notifier, map[string]interface{}{
+		"summary":   truncateText(strings.ReplaceAll(n.summary(), "`", ""), 1024),
+		"source":    "go-feature-flag",
+		"severity":  mappedSeverity(notifier, n.Severity),
+		"timestamp": c.Timestamp.Format(time.RFC3339),
+		"component": c.ResourceName,
+		"group":     c.Project,
+		"class":     n.Event,
+		"custom_details": map[string]interface{}{
+			"actor":       actorDisplayName(c.Actor),
+			"environment": n.Environment,
+			"flagSet":     c.FlagSet,
+			"tags":        n.Tags,
+			"diff":        c.Diff,
+		},
+	})
+}
+
+func sendOpsgenieNotification(notifier Notifier, n Notification) error {
+	c := n.Change
+	summary := strings.ReplaceAll(n.summary(), "`", "")
+	description := summary
+	if details := n.details(); details != "" {
+		description += "\n" + strings.ReplaceAll(details, "`", "")
+	}
+	details := map[string]string{"event": n.Event, "actor": actorDisplayName(c.Actor)}
+	for key, value := range map[string]string{"project": c.Project, "flagSet": c.FlagSet, "environment": n.Environment} {
+		if value != "" {
+			details[key] = value
+		}
+	}
+	return sendOpsgenieAlert(notifier, map[string]interface{}{
+		"message":     truncateText(summary, 130),
+		"description": truncateText(description, 15000),
+		"entity":      c.ResourceName,
+		"source":      "GO Feature Flag",
+		"priority":    mappedSeverity(notifier, n.Severity),
+		"tags":        append([]string{"goff", n.Event}, n.Tags...),
+		"details":     details,
+	})
+}
+
+func testPagerDutyNotifier(n *Notifier) error {
+	return sendPagerDutyEvent(*n, map[string]interface{}{
+		"summary":  "GO Feature Flag - Test notification from GOFF UI",
+		"source":   "go-feature-flag",
+		"severity": mappedSeverity(*n, "info"),
+	})
+}
+
+func testOpsgenieNotifier(n *Notifier) error {
+	return sendOpsgenieAlert(*n, map[string]interface{}{
+		"message":     "GO Feature Flag - Test notification from GOFF UI",
+		"description": "This is a test notification from GOFF UI. Your Opsgenie notifier is configured correctly!",
+		"source":      "GO Feature Flag",
+		"priority":    mappedSeverity(*n, "info"),
+		"tags":        []string{"goff", "test"},
+	})
+}
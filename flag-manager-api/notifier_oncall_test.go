@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOnCallNotifiers(t *testing.T) {
+	type received struct {
+		path, auth string
+		body       map[string]interface{}
+	}
+	requests := make(chan received, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests <- received{path: r.URL.Path, auth: r.Header.Get("Authorization"), body: body}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	next := func(t *testing.T, path string) received {
+		t.Helper()
+		select {
+		case req := <-requests:
+			if req.path != path {
+				t.Fatalf("Expected a request on %s, got %s: %v", path, req.path, req.body)
+			}
+			return req
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for a request on %s", path)
+		}
+		return received{}
+	}
+
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	defer fm.audit.notify.configure(nil)
+	router := setupTestRouter(fm)
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"pd","name":"pd","kind":"pagerduty","severityMapping":{"critical":"P1"}}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"og","name":"og","kind":"opsgenie","severityMapping":{"urgent":"P1"}}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"chat","name":"chat","kind":"slack","severityMapping":{"critical":"P1"}}`, http.StatusBadRequest, nil)
+
+	var pd Notifier
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"pd","name":"pd","kind":"pagerduty","enabled":true,"routingKey":"R0UT1NG","endpointUrl":"`+server.URL+`/v2/enqueue"}`, http.StatusCreated, &pd)
+	doRequest(t, router, "POST", "/api/notifiers", `{"id":"og","name":"og","kind":"opsgenie","enabled":true,"apiKey":"g3n13","endpointUrl":"`+server.URL+`/","severityMapping":{"critical":"P2"}}`, http.StatusCreated, nil)
+	if pd.RoutingKey != "********" {
+		t.Fatalf("Expected the routing key to be masked, got %q", pd.RoutingKey)
+	}
+	doRequest(t, router, "PUT", "/api/notifiers/og", `{"name":"og","kind":"opsgenie","enabled":true,"apiKey":"********","endpointUrl":"`+server.URL+`/","severityMapping":{"critical":"P2"}}`, http.StatusOK, nil)
+	if n := fm.notifiers.GetRaw("og"); n.APIKey != "g3n13" {
+		t.Fatalf("Expected a masked API key to be kept, got %q", n.APIKey)
+	}
+	if configs := fm.notifiers.BuildNotifierConfig(); len(configs) != 0 {
+		t.Fatalf("Expected on-call notifiers to be left out of the relay proxy config, got %v", configs)
+	}
+
+	t.Run("test", func(t *testing.T) {
+		doRequest(t, router, "POST", "/api/notifiers/pd/test", "", http.StatusOK, nil)
+		req := next(t, "/v2/enqueue")
+		payload, _ := req.body["payload"].(map[string]interface{})
+		if req.body["routing_key"] != "R0UT1NG" || req.body["event_action"] != "trigger" || payload["severity"] != "info" {
+			t.Fatalf("Unexpected PagerDuty event: %v", req.body)
+		}
+
+		doRequest(t, router, "POST", "/api/notifiers/og/test", "", http.StatusOK, nil)
+		req = next(t, "/v2/alerts")
+		if req.auth != "GenieKey g3n13" || req.body["priority"] != "P5" {
+			t.Fatalf("Unexpected Opsgenie alert with %q: %v", req.auth, req.body)
+		}
+	})
+
+	t.Run("pages on flag disable", func(t *testing.T) {
+		fm.audit.Log(context.Background(), Actor{ID: "u1", Email: "oncall@example.com", Type: "user"}, "flag.disabled", "flag", "f1", "checkout", "web",
+			map[string]interface{}{"disabled": true}, nil)
+
+		got := map[string]received{}
+		for len(got) < 2 {
+			select {
+			case req := <-requests:
+				got[req.path] = req
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for pages, got %v", got)
+			}
+		}
+		payload, _ := got["/v2/enqueue"].body["payload"].(map[string]interface{})
+		if payload["severity"] != "critical" || payload["component"] != "checkout" || payload["group"] != "web" || payload["class"] != "flag.updated" {
+			t.Fatalf("Unexpected PagerDuty event: %v", got["/v2/enqueue"].body)
+		}
+		alert := got["/v2/alerts"].body
+		if alert["priority"] != "P2" || alert["message"] != "Flag checkout updated in project web by oncall@example.com" {
+			t.Fatalf("Unexpected Opsgenie alert: %v", alert)
+		}
+	})
+
+	n := Notifier{ID: "pd", Kind: "pagerduty", RoutingKey: "key", APIKey: "api", SeverityMapping: map[string]string{"warning": "error"}}
+	if got := dbNotifierToNotifier(notifierToDBNotifier(n)); !reflect.DeepEqual(got, n) {
+		t.Fatalf("Expected on-call settings to survive the database config, got %+v", got)
+	}
+}
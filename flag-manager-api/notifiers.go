@@ -7,10 +7,13 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"flag-manager-api/db"
+	"flag-manager-api/httpclient"
+	"flag-manager-api/secrets"
 
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
@@ -20,7 +23,7 @@ import (
 type Notifier struct {
 	ID          string            `json:"id"`
 	Name        string            `json:"name"`
-	Kind        string            `json:"kind"` // slack, discord, microsoftteams, webhook, log
+	Kind        string            `json:"kind"` // slack, discord, microsoftteams, webhook, log, pagerduty, opsgenie, email
 	Description string            `json:"description,omitempty"`
 	Enabled     bool              `json:"enabled"`
 	CreatedAt   time.Time         `json:"createdAt"`
@@ -29,7 +32,7 @@ type Notifier struct {
 	// Slack/Discord/Teams - shared webhook field
 	WebhookURL string `json:"webhookUrl,omitempty"`
 
-	// Webhook-specific
+	// Webhook-specific; for PagerDuty and Opsgenie, overrides the API URL
 	EndpointURL string            `json:"endpointUrl,omitempty"`
 	Secret      string            `json:"secret,omitempty"`
 	Headers     map[string]string `json:"headers,omitempty"`
@@ -37,19 +40,41 @@ type Notifier struct {
 
 	// Log-specific
 	LogFormat string `json:"logFormat,omitempty"` // json, text
+
+	// PagerDuty/Opsgenie
+	RoutingKey      string            `json:"routingKey,omitempty"`      // PagerDuty Events API v2 integration key
+	APIKey          string            `json:"apiKey,omitempty"`          // Opsgenie API integration key
+	SeverityMapping map[string]string `json:"severityMapping,omitempty"` // notification severity -> PagerDuty severity or Opsgenie priority
+
+	// Email
+	SMTPHost        string   `json:"smtpHost,omitempty"`
+	SMTPPort        int      `json:"smtpPort,omitempty"` // defaults to 587, or 465 with tls
+	SMTPTLS         string   `json:"smtpTls,omitempty"`  // starttls (default), tls, none
+	SMTPUsername    string   `json:"smtpUsername,omitempty"`
+	SMTPPassword    string   `json:"smtpPassword,omitempty"`
+	From            string   `json:"from,omitempty"`
+	To              []string `json:"to,omitempty"`
+	SubjectTemplate string   `json:"subjectTemplate,omitempty"` // text/template, see EmailTemplateData
+	BodyTemplate    string   `json:"bodyTemplate,omitempty"`
+	DigestMinutes   int      `json:"digestMinutes,omitempty"` // batch notifications into one email every N minutes
+
+	// Events are the manager events sent to the notifier; empty means all.
+	Events []string `json:"events,omitempty"`
 }
 
 // NotifiersStore manages notifier configurations
 type NotifiersStore struct {
 	configPath string
+	cipher     *secrets.Cipher
 	notifiers  map[string]*Notifier
 	mu         sync.RWMutex
 }
 
 // NewNotifiersStore creates a new notifiers store
-func NewNotifiersStore(configDir string) *NotifiersStore {
+func NewNotifiersStore(configDir string, cipher *secrets.Cipher) *NotifiersStore {
 	store := &NotifiersStore{
 		configPath: filepath.Join(configDir, "notifiers.json"),
+		cipher:     cipher,
 		notifiers:  make(map[string]*Notifier),
 	}
 	store.load()
@@ -61,7 +86,7 @@ func (s *NotifiersStore) load() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := os.ReadFile(s.configPath)
+	data, err := readSealedFile(s.configPath, s.cipher, db.NotifierSecretFields)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -93,17 +118,13 @@ func (s *NotifiersStore) save() error {
 		return err
 	}
 
-	return os.WriteFile(s.configPath, data, 0644)
+	return writeSealedFile(s.configPath, data, 0644, s.cipher, db.NotifierSecretFields)
 }
 
 // maskSecrets returns a copy with secrets masked
 func (s *NotifiersStore) maskSecrets(notifier *Notifier) *Notifier {
-	masked := *notifier
-	if masked.Secret != "" {
-		masked.Secret = "********"
-	}
 	// Don't mask webhook URLs as they're needed for display
-	return &masked
+	return maskNotifierSecrets(notifier)
 }
 
 // List returns all notifiers with secrets masked
@@ -142,6 +163,18 @@ func (s *NotifiersStore) GetRaw(id string) *Notifier {
 	return notifier
 }
 
+// ListRaw returns copies of all notifiers without masking (for internal use)
+func (s *NotifiersStore) ListRaw() []Notifier {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Notifier, 0, len(s.notifiers))
+	for _, notifier := range s.notifiers {
+		result = append(result, *notifier)
+	}
+	return result
+}
+
 // Create adds a new notifier
 func (s *NotifiersStore) Create(notifier *Notifier) error {
 	s.mu.Lock()
@@ -169,9 +202,7 @@ func (s *NotifiersStore) Update(id string, updates *Notifier) error {
 	}
 
 	// Preserve secrets if masked values provided
-	if updates.Secret == "********" || updates.Secret == "" {
-		updates.Secret = existing.Secret
-	}
+	preserveNotifierSecrets(updates, existing)
 
 	updates.ID = id
 	updates.CreatedAt = existing.CreatedAt
@@ -212,12 +243,26 @@ func (s *NotifiersStore) GetEnabled() []*Notifier {
 
 // notifierConfigJSON represents the kind-specific config stored as JSON in the DB.
 type notifierConfigJSON struct {
-	WebhookURL  string            `json:"webhookUrl,omitempty"`
-	EndpointURL string            `json:"endpointUrl,omitempty"`
-	Secret      string            `json:"secret,omitempty"`
-	Headers     map[string]string `json:"headers,omitempty"`
-	Meta        map[string]string `json:"meta,omitempty"`
-	LogFormat   string            `json:"logFormat,omitempty"`
+	WebhookURL      string            `json:"webhookUrl,omitempty"`
+	EndpointURL     string            `json:"endpointUrl,omitempty"`
+	Secret          string            `json:"secret,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Meta            map[string]string `json:"meta,omitempty"`
+	LogFormat       string            `json:"logFormat,omitempty"`
+	Events          []string          `json:"events,omitempty"`
+	RoutingKey      string            `json:"routingKey,omitempty"`
+	APIKey          string            `json:"apiKey,omitempty"`
+	SeverityMapping map[string]string `json:"severityMapping,omitempty"`
+	SMTPHost        string            `json:"smtpHost,omitempty"`
+	SMTPPort        int               `json:"smtpPort,omitempty"`
+	SMTPTLS         string            `json:"smtpTls,omitempty"`
+	SMTPUsername    string            `json:"smtpUsername,omitempty"`
+	SMTPPassword    string            `json:"smtpPassword,omitempty"`
+	From            string            `json:"from,omitempty"`
+	To              []string          `json:"to,omitempty"`
+	SubjectTemplate string            `json:"subjectTemplate,omitempty"`
+	BodyTemplate    string            `json:"bodyTemplate,omitempty"`
+	DigestMinutes   int               `json:"digestMinutes,omitempty"`
 }
 
 func dbNotifierToNotifier(dbn db.DBNotifier) Notifier {
@@ -240,6 +285,20 @@ func dbNotifierToNotifier(dbn db.DBNotifier) Notifier {
 			n.Headers = cfg.Headers
 			n.Meta = cfg.Meta
 			n.LogFormat = cfg.LogFormat
+			n.Events = cfg.Events
+			n.RoutingKey = cfg.RoutingKey
+			n.APIKey = cfg.APIKey
+			n.SeverityMapping = cfg.SeverityMapping
+			n.SMTPHost = cfg.SMTPHost
+			n.SMTPPort = cfg.SMTPPort
+			n.SMTPTLS = cfg.SMTPTLS
+			n.SMTPUsername = cfg.SMTPUsername
+			n.SMTPPassword = cfg.SMTPPassword
+			n.From = cfg.From
+			n.To = cfg.To
+			n.SubjectTemplate = cfg.SubjectTemplate
+			n.BodyTemplate = cfg.BodyTemplate
+			n.DigestMinutes = cfg.DigestMinutes
 		}
 	}
 
@@ -258,12 +317,26 @@ func notifierToDBNotifier(n Notifier) db.DBNotifier {
 	}
 
 	cfg := notifierConfigJSON{
-		WebhookURL:  n.WebhookURL,
-		EndpointURL: n.EndpointURL,
-		Secret:      n.Secret,
-		Headers:     n.Headers,
-		Meta:        n.Meta,
-		LogFormat:   n.LogFormat,
+		WebhookURL:      n.WebhookURL,
+		EndpointURL:     n.EndpointURL,
+		Secret:          n.Secret,
+		Headers:         n.Headers,
+		Meta:            n.Meta,
+		LogFormat:       n.LogFormat,
+		Events:          n.Events,
+		RoutingKey:      n.RoutingKey,
+		APIKey:          n.APIKey,
+		SeverityMapping: n.SeverityMapping,
+		SMTPHost:        n.SMTPHost,
+		SMTPPort:        n.SMTPPort,
+		SMTPTLS:         n.SMTPTLS,
+		SMTPUsername:    n.SMTPUsername,
+		SMTPPassword:    n.SMTPPassword,
+		From:            n.From,
+		To:              n.To,
+		SubjectTemplate: n.SubjectTemplate,
+		BodyTemplate:    n.BodyTemplate,
+		DigestMinutes:   n.DigestMinutes,
 	}
 	configJSON, _ := json.Marshal(cfg)
 	dbn.Config = configJSON
@@ -271,41 +344,78 @@ func notifierToDBNotifier(n Notifier) db.DBNotifier {
 	return dbn
 }
 
+// notifierSecrets returns the credentials of a notifier.
+func notifierSecrets(n *Notifier) []*string {
+	return []*string{&n.Secret, &n.RoutingKey, &n.APIKey, &n.SMTPPassword}
+}
+
 func maskNotifierSecrets(n *Notifier) *Notifier {
 	masked := *n
-	if masked.Secret != "" {
-		masked.Secret = "********"
+	for _, secret := range notifierSecrets(&masked) {
+		if *secret != "" && !isSecretRef(*secret) {
+			*secret = "********"
+		}
 	}
 	return &masked
 }
 
+// preserveNotifierSecrets keeps the secrets of existing that updates leaves
+// empty or masked.
+func preserveNotifierSecrets(updates, existing *Notifier) {
+	for _, s := range []struct{ updated, current *string }{
+		{&updates.Secret, &existing.Secret},
+		{&updates.RoutingKey, &existing.RoutingKey},
+		{&updates.APIKey, &existing.APIKey},
+		{&updates.SMTPPassword, &existing.SMTPPassword},
+	} {
+		if *s.updated == "********" || *s.updated == "" {
+			*s.updated = *s.current
+		}
+	}
+}
+
 // HTTP Handlers
 
+// NotifiersResponse lists the notifiers.
+type NotifiersResponse struct {
+	Notifiers []*Notifier `json:"notifiers"`
+}
+
 func (fm *FlagManager) listNotifiersHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseListFilter(r)
+	if err != nil {
+		writeValidationError(w, "INVALID_FILTER", err.Error())
+		return
+	}
+
+	var notifiers []*Notifier
 	if fm.store != nil {
 		dbItems, err := fm.store.ListNotifiers(r.Context())
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			return
 		}
-		notifiers := make([]*Notifier, 0, len(dbItems))
+		notifiers = make([]*Notifier, 0, len(dbItems))
 		for _, dbn := range dbItems {
 			n := dbNotifierToNotifier(dbn)
 			notifiers = append(notifiers, maskNotifierSecrets(&n))
 		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"notifiers": notifiers,
-		})
-		return
+	} else {
+		notifiers = fm.notifiers.List()
 	}
+	notifiers = slices.DeleteFunc(notifiers, func(n *Notifier) bool { return !filter.keeps(!n.Enabled, n.Kind) })
 
-	notifiers := fm.notifiers.List()
+	if wantsPage(r) {
+		writePage(w, r, pageList(r, notifiers,
+			func(n *Notifier) string { return n.Name + " " + n.Description },
+			namedSorts(func(n *Notifier) string { return n.Name }, func(n *Notifier) string { return n.Kind },
+				func(n *Notifier) time.Time { return n.CreatedAt }, func(n *Notifier) time.Time { return n.UpdatedAt }),
+			"name"))
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"notifiers": notifiers,
-	})
+	json.NewEncoder(w).Encode(NotifiersResponse{Notifiers: notifiers})
 }
 
 func (fm *FlagManager) getNotifierHandler(w http.ResponseWriter, r *http.Request) {
@@ -316,9 +426,9 @@ func (fm *FlagManager) getNotifierHandler(w http.ResponseWriter, r *http.Request
 		dbn, err := fm.store.GetNotifier(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Notifier not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "NOTIFIER_NOT_FOUND", "Notifier not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -330,7 +440,7 @@ func (fm *FlagManager) getNotifierHandler(w http.ResponseWriter, r *http.Request
 
 	notifier := fm.notifiers.Get(id)
 	if notifier == nil {
-		http.Error(w, "Notifier not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "NOTIFIER_NOT_FOUND", "Notifier not found")
 		return
 	}
 
@@ -341,22 +451,22 @@ func (fm *FlagManager) getNotifierHandler(w http.ResponseWriter, r *http.Request
 func (fm *FlagManager) createNotifierHandler(w http.ResponseWriter, r *http.Request) {
 	var notifier Notifier
 	if err := json.NewDecoder(r.Body).Decode(&notifier); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if notifier.ID == "" {
-		http.Error(w, "ID is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "ID is required")
 		return
 	}
 
 	if notifier.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Name is required")
 		return
 	}
 
 	if notifier.Kind == "" {
-		http.Error(w, "Kind is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Kind is required")
 		return
 	}
 
@@ -367,9 +477,27 @@ func (fm *FlagManager) createNotifierHandler(w http.ResponseWriter, r *http.Requ
 		"microsoftteams": true,
 		"webhook":        true,
 		"log":            true,
+		"pagerduty":      true,
+		"opsgenie":       true,
+		"email":          true,
 	}
 	if !validKinds[notifier.Kind] {
-		http.Error(w, "Invalid kind. Must be one of: slack, discord, microsoftteams, webhook, log", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Invalid kind. Must be one of: slack, discord, microsoftteams, webhook, log, pagerduty, opsgenie, email")
+		return
+	}
+
+	if errs := validateSeverityMapping(notifier); len(errs) > 0 {
+		writeValidationError(w, "INVALID_SEVERITY_MAPPING", "Severity mapping is invalid", errs...)
+		return
+	}
+
+	if errs := validateEmailNotifier(notifier); len(errs) > 0 {
+		writeValidationError(w, "INVALID_EMAIL_NOTIFIER", "Email notifier is invalid", errs...)
+		return
+	}
+
+	if unknown := validateNotifierEvents(notifier.Events); len(unknown) > 0 {
+		writeValidationError(w, "INVALID_NOTIFIER_EVENTS", "Unknown notifier events", unknown...)
 		return
 	}
 
@@ -377,9 +505,10 @@ func (fm *FlagManager) createNotifierHandler(w http.ResponseWriter, r *http.Requ
 		dbn := notifierToDBNotifier(notifier)
 		created, err := fm.store.CreateNotifier(r.Context(), dbn)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusConflict)
+			writeError(w, http.StatusConflict, "CONFLICT", err.Error())
 			return
 		}
+		fm.afterNotifierChange(r)
 		n := dbNotifierToNotifier(*created)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -388,9 +517,10 @@ func (fm *FlagManager) createNotifierHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := fm.notifiers.Create(&notifier); err != nil {
-		http.Error(w, err.Error(), http.StatusConflict)
+		writeError(w, http.StatusConflict, "CONFLICT", err.Error())
 		return
 	}
+	fm.afterNotifierChange(r)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -403,7 +533,22 @@ func (fm *FlagManager) updateNotifierHandler(w http.ResponseWriter, r *http.Requ
 
 	var updates Notifier
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+
+	if unknown := validateNotifierEvents(updates.Events); len(unknown) > 0 {
+		writeValidationError(w, "INVALID_NOTIFIER_EVENTS", "Unknown notifier events", unknown...)
+		return
+	}
+
+	if errs := validateSeverityMapping(updates); len(errs) > 0 {
+		writeValidationError(w, "INVALID_SEVERITY_MAPPING", "Severity mapping is invalid", errs...)
+		return
+	}
+
+	if errs := validateEmailNotifier(updates); len(errs) > 0 {
+		writeValidationError(w, "INVALID_EMAIL_NOTIFIER", "Email notifier is invalid", errs...)
 		return
 	}
 
@@ -412,23 +557,22 @@ func (fm *FlagManager) updateNotifierHandler(w http.ResponseWriter, r *http.Requ
 		existing, err := fm.store.GetNotifier(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Notifier not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "NOTIFIER_NOT_FOUND", "Notifier not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
 		existingN := dbNotifierToNotifier(*existing)
-		if updates.Secret == "********" || updates.Secret == "" {
-			updates.Secret = existingN.Secret
-		}
+		preserveNotifierSecrets(&updates, &existingN)
 
 		dbn := notifierToDBNotifier(updates)
 		updated, err := fm.store.UpdateNotifier(r.Context(), id, dbn)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 			return
 		}
+		fm.afterNotifierChange(r)
 		n := dbNotifierToNotifier(*updated)
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(maskNotifierSecrets(&n))
@@ -436,9 +580,10 @@ func (fm *FlagManager) updateNotifierHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	if err := fm.notifiers.Update(id, &updates); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		return
 	}
+	fm.afterNotifierChange(r)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(fm.notifiers.Get(id))
@@ -450,17 +595,19 @@ func (fm *FlagManager) deleteNotifierHandler(w http.ResponseWriter, r *http.Requ
 
 	if fm.store != nil {
 		if err := fm.store.DeleteNotifier(r.Context(), id); err != nil {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 			return
 		}
+		fm.afterNotifierChange(r)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
 	if err := fm.notifiers.Delete(id); err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 		return
 	}
+	fm.afterNotifierChange(r)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -475,9 +622,9 @@ func (fm *FlagManager) testNotifierHandler(w http.ResponseWriter, r *http.Reques
 		dbn, err := fm.store.GetNotifier(r.Context(), id)
 		if err != nil {
 			if err == pgx.ErrNoRows {
-				http.Error(w, "Notifier not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, "NOTIFIER_NOT_FOUND", "Notifier not found")
 			} else {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 			}
 			return
 		}
@@ -486,45 +633,55 @@ func (fm *FlagManager) testNotifierHandler(w http.ResponseWriter, r *http.Reques
 	} else {
 		notifier = fm.notifiers.GetRaw(id)
 		if notifier == nil {
-			http.Error(w, "Notifier not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOTIFIER_NOT_FOUND", "Notifier not found")
 			return
 		}
 	}
+	resolved := *notifier
+	if err := fm.secretRefs.resolveFields(r.Context(), notifierSecrets(&resolved)); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ConnectionTestResult{Success: false, Error: err.Error()})
+		return
+	}
+	notifier = &resolved
 
-	var testErr error
+	var send func(*Notifier) error
 
 	switch notifier.Kind {
 	case "slack":
-		testErr = testSlackNotifier(notifier)
+		send = testSlackNotifier
 	case "discord":
-		testErr = testDiscordNotifier(notifier)
+		send = testDiscordNotifier
 	case "microsoftteams":
-		testErr = testTeamsNotifier(notifier)
+		send = testTeamsNotifier
 	case "webhook":
-		testErr = testWebhookNotifier(notifier)
+		send = testWebhookNotifier
+	case "pagerduty":
+		send = testPagerDutyNotifier
+	case "opsgenie":
+		send = testOpsgenieNotifier
+	case "email":
+		send = testEmailNotifier
 	case "log":
 		// Log notifier always succeeds
-		testErr = nil
+		send = func(*Notifier) error { return nil }
 	default:
-		http.Error(w, "Unknown notifier kind", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "Unknown notifier kind")
 		return
 	}
 
+	testErr := fm.outbound.Do(func() error { return send(notifier) })
+
 	if testErr != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": false,
-			"error":   testErr.Error(),
-		})
+		json.NewEncoder(w).Encode(ConnectionTestResult{Success: false, Error: testErr.Error()})
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"message": "Test notification sent successfully",
-	})
+	json.NewEncoder(w).Encode(ConnectionTestResult{Success: true, Message: "Test notification sent successfully"})
 }
 
 // Test functions for each notifier type
@@ -624,8 +781,7 @@ func sendWebhook(url string, payload interface{}, headers map[string]string) err
 		req.Header.Set(key, value)
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := httpclient.Default().Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -687,6 +843,9 @@ func (s *NotifiersStore) BuildNotifierConfig() []map[string]interface{} {
 			if n.LogFormat != "" {
 				config["format"] = n.LogFormat
 			}
+		case "pagerduty", "opsgenie", "email":
+			// Delivered by the manager only
+			continue
 		}
 
 		configs = append(configs, config)
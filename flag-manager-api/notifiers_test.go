@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotifiersCRUD(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	t.Run("list empty notifiers", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/notifiers", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	var createdID string
+
+	t.Run("create slack notifier", func(t *testing.T) {
+		notifier := map[string]interface{}{
+			"id":         "test-slack-notifier",
+			"name":       "slack-alerts",
+			"kind":       "slack",
+			"enabled":    true,
+			"webhookUrl": "https://hooks.slack.com/services/xxx",
+		}
+
+		body, _ := json.Marshal(notifier)
+		req := httptest.NewRequest("POST", "/api/notifiers", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		createdID = response["id"].(string)
+	})
+
+	t.Run("get notifier", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/notifiers/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("update notifier", func(t *testing.T) {
+		notifier := map[string]interface{}{
+			"id":         createdID,
+			"name":       "slack-alerts-updated",
+			"kind":       "slack",
+			"enabled":    false,
+			"webhookUrl": "https://hooks.slack.com/services/yyy",
+		}
+
+		body, _ := json.Marshal(notifier)
+		req := httptest.NewRequest("PUT", "/api/notifiers/"+createdID, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("delete notifier", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/notifiers/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status 200 or 204, got %d", rr.Code)
+		}
+	})
+}
+
+func TestAllNotifierTypes(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	testCases := []struct {
+		name     string
+		notifier map[string]interface{}
+	}{
+		{
+			name: "slack notifier",
+			notifier: map[string]interface{}{
+				"id":         "test-slack",
+				"name":       "slack",
+				"kind":       "slack",
+				"enabled":    true,
+				"webhookUrl": "https://hooks.slack.com/xxx",
+			},
+		},
+		{
+			name: "discord notifier",
+			notifier: map[string]interface{}{
+				"id":         "test-discord",
+				"name":       "discord",
+				"kind":       "discord",
+				"enabled":    true,
+				"webhookUrl": "https://discord.com/api/webhooks/xxx",
+			},
+		},
+		{
+			name: "microsoft teams notifier",
+			notifier: map[string]interface{}{
+				"id":         "test-teams",
+				"name":       "teams",
+				"kind":       "microsoftteams",
+				"enabled":    true,
+				"webhookUrl": "https://outlook.office.com/webhook/xxx",
+			},
+		},
+		{
+			name: "webhook notifier",
+			notifier: map[string]interface{}{
+				"id":          "test-webhook",
+				"name":        "webhook",
+				"kind":        "webhook",
+				"enabled":     true,
+				"endpointUrl": "https://example.com/webhook",
+				"secret":      "my-secret",
+				"headers":     map[string]string{"Authorization": "Bearer token"},
+			},
+		},
+		{
+			name: "log notifier",
+			notifier: map[string]interface{}{
+				"id":        "test-log",
+				"name":      "log",
+				"kind":      "log",
+				"enabled":   true,
+				"logFormat": "json",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.notifier)
+			req := httptest.NewRequest("POST", "/api/notifiers", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusCreated {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// openFeatureSchema is the flagd flag definition schema the document conforms to.
+const openFeatureSchema = "https://flagd.dev/schema/v0/flags.json"
+
+// OpenFeatureFlag is a single flag in an OpenFeature (flagd) flag definition.
+type OpenFeatureFlag struct {
+	State          string                 `json:"state"` // ENABLED or DISABLED
+	Variants       map[string]interface{} `json:"variants"`
+	DefaultVariant string                 `json:"defaultVariant"`
+	Targeting      interface{}            `json:"targeting,omitempty"` // JSONLogic
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// OpenFeatureDocument is an OpenFeature (flagd) flag definition document.
+type OpenFeatureDocument struct {
+	Schema string                     `json:"$schema"`
+	Flags  map[string]OpenFeatureFlag `json:"flags"`
+}
+
+// openFeatureOperators maps GO Feature Flag query operators to JSONLogic.
+var openFeatureOperators = map[string]string{
+	"eq": "==", "==": "==",
+	"ne": "!=", "!=": "!=",
+	"lt": "<", "<": "<",
+	"gt": ">", ">": ">",
+	"le": "<=", "<=": "<=",
+	"ge": ">=", ">=": ">=",
+	"sw": "starts_with",
+	"ew": "ends_with",
+}
+
+// toOpenFeatureFlag converts a flag to its OpenFeature form on a best-effort basis.
+//
+// Variations map to variants and the default rule to defaultVariant; targeting
+// rules become a JSONLogic "if" chain and percentage splits become "fractional"
+// buckets. Targeting queries are translated when they are comparisons joined by
+// a single kind of and/or. Progressive and scheduled rollouts, experimentation
+// windows and untranslatable queries have no OpenFeature equivalent: they are
+// skipped and listed in the flag's "unsupported" metadata.
+func toOpenFeatureFlag(config FlagConfig) OpenFeatureFlag {
+	flag := OpenFeatureFlag{
+		State:    "ENABLED",
+		Variants: config.Variations,
+	}
+	if config.Disable != nil && *config.Disable {
+		flag.State = "DISABLED"
+	}
+	if flag.Variants == nil {
+		flag.Variants = map[string]interface{}{}
+	}
+
+	var unsupported []string
+
+	var branches []interface{}
+	for i, rule := range config.Targeting {
+		if rule.Disable != nil && *rule.Disable {
+			continue
+		}
+		if rule.ProgressiveRollout != nil {
+			unsupported = append(unsupported, fmt.Sprintf("targeting[%d].progressiveRollout", i))
+			continue
+		}
+		condition, ok := queryToJSONLogic(rule.Query)
+		if !ok {
+			unsupported = append(unsupported, fmt.Sprintf("targeting[%d].query", i))
+			continue
+		}
+		result := openFeatureRuleResult(rule.Variation, rule.Percentage, config.BucketingKey)
+		if result == nil {
+			continue
+		}
+		branches = append(branches, condition, result)
+	}
+
+	var fallback interface{}
+	if rule := config.DefaultRule; rule != nil {
+		if rule.ProgressiveRollout != nil {
+			unsupported = append(unsupported, "defaultRule.progressiveRollout")
+		}
+		if rule.Variation != "" {
+			flag.DefaultVariant = rule.Variation
+		} else if len(rule.Percentage) > 0 {
+			flag.DefaultVariant = largestPercentage(rule.Percentage)
+			fallback = openFeatureRuleResult("", rule.Percentage, config.BucketingKey)
+		}
+	}
+
+	switch {
+	case len(branches) > 0:
+		if fallback != nil {
+			branches = append(branches, fallback)
+		}
+		flag.Targeting = map[string]interface{}{"if": branches}
+	case fallback != nil:
+		flag.Targeting = fallback
+	}
+
+	if len(config.ScheduledRollout) > 0 {
+		unsupported = append(unsupported, "scheduledRollout")
+	}
+	if config.Experimentation != nil {
+		unsupported = append(unsupported, "experimentation")
+	}
+	if len(unsupported) > 0 {
+		flag.Metadata = map[string]interface{}{"unsupported": strings.Join(unsupported, ", ")}
+	}
+
+	return flag
+}
+
+// openFeatureRuleResult returns the variant name or fractional split a rule
+// resolves to, or nil if the rule serves nothing.
+func openFeatureRuleResult(variation string, percentage map[string]float64, bucketingKey string) interface{} {
+	if variation != "" {
+		return variation
+	}
+	if len(percentage) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(percentage))
+	for name := range percentage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buckets []interface{}
+	if bucketingKey != "" {
+		buckets = append(buckets, map[string]interface{}{"var": bucketingKey})
+	}
+	for _, name := range names {
+		buckets = append(buckets, []interface{}{name, percentage[name]})
+	}
+	return map[string]interface{}{"fractional": buckets}
+}
+
+// largestPercentage returns the variation with the largest share of a split,
+// preferring the alphabetically first on ties.
+func largestPercentage(percentage map[string]float64) string {
+	best := ""
+	for name, pct := range percentage {
+		if best == "" || pct > percentage[best] || (pct == percentage[best] && name < best) {
+			best = name
+		}
+	}
+	return best
+}
+
+// queryToJSONLogic translates a targeting query made of comparisons joined by
+// a single kind of and/or into JSONLogic. It reports false for anything else
+// (parentheses, not, pr, mixed and/or).
+func queryToJSONLogic(query string) (interface{}, bool) {
+	tokens := tokenizeQuery(query)
+	if len(tokens) == 0 {
+		return nil, false
+	}
+
+	var conditions []interface{}
+	joiner := ""
+	for i := 0; i < len(tokens); {
+		if i > 0 {
+			word := strings.ToLower(tokens[i])
+			if word != "and" && word != "or" {
+				return nil, false
+			}
+			if joiner != "" && joiner != word {
+				return nil, false
+			}
+			joiner = word
+			i++
+		}
+
+		condition, next, ok := comparisonToJSONLogic(tokens, i)
+		if !ok {
+			return nil, false
+		}
+		conditions = append(conditions, condition)
+		i = next
+	}
+
+	if len(conditions) == 1 {
+		return conditions[0], true
+	}
+	return map[string]interface{}{joiner: conditions}, true
+}
+
+// comparisonToJSONLogic translates the comparison starting at tokens[i] and
+// returns the index just past it.
+func comparisonToJSONLogic(tokens []string, i int) (interface{}, int, bool) {
+	if i+2 >= len(tokens) {
+		return nil, 0, false
+	}
+	attr, op := tokens[i], strings.ToLower(tokens[i+1])
+	if !isQueryIdentifier(attr) {
+		return nil, 0, false
+	}
+	// GO Feature Flag calls the targeting key "key"; OpenFeature calls it "targetingKey"
+	if attr == "key" {
+		attr = "targetingKey"
+	}
+	variable := map[string]interface{}{"var": attr}
+
+	if op == "in" {
+		if tokens[i+2] != "[" {
+			return nil, 0, false
+		}
+		var values []interface{}
+		j := i + 3
+		for ; j < len(tokens) && tokens[j] != "]"; j++ {
+			if tokens[j] == "," {
+				continue
+			}
+			value, ok := queryLiteral(tokens[j])
+			if !ok {
+				return nil, 0, false
+			}
+			values = append(values, value)
+		}
+		if j == len(tokens) {
+			return nil, 0, false
+		}
+		return map[string]interface{}{"in": []interface{}{variable, values}}, j + 1, true
+	}
+
+	value, ok := queryLiteral(tokens[i+2])
+	if !ok {
+		return nil, 0, false
+	}
+	if op == "co" {
+		// JSONLogic "in" with a string haystack is a substring test
+		return map[string]interface{}{"in": []interface{}{value, variable}}, i + 3, true
+	}
+	jsonOp, ok := openFeatureOperators[op]
+	if !ok {
+		return nil, 0, false
+	}
+	return map[string]interface{}{jsonOp: []interface{}{variable, value}}, i + 3, true
+}
+
+// queryLiteral parses a string, number or boolean literal from a query token.
+func queryLiteral(tok string) (interface{}, bool) {
+	if len(tok) >= 2 && (tok[0] == '"' || tok[0] == '\'') && tok[len(tok)-1] == tok[0] {
+		return tok[1 : len(tok)-1], true
+	}
+	switch strings.ToLower(tok) {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	if n, err := strconv.ParseFloat(tok, 64); err == nil {
+		return n, true
+	}
+	return nil, false
+}
+
+// loadAllFlags returns every project's flags keyed "project/flag", as served on
+// /api/flags/raw: without drafts.
+func (fm *FlagManager) loadAllFlags(ctx context.Context) (map[string]FlagConfig, error) {
+	allFlags, err := fm.storage.AllPublishedFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fm.expandProjectSegments(ctx, allFlags)
+}
+
+// eachServedFlag yields the flags loadAllFlags returns one at a time, as
+// they are read from storage.
+func (fm *FlagManager) eachServedFlag(ctx context.Context) flagSeq[FlagConfig] {
+	return func(yield func(key string, config FlagConfig) error) error {
+		return fm.storage.EachPublishedFlag(ctx, func(key string, config FlagConfig) error {
+			return yield(key, fm.expandFlagSegments(ctx, config))
+		})
+	}
+}
+
+// getOpenFeatureFlagsHandler serves all flags as an OpenFeature (flagd) flag
+// definition document.
+func (fm *FlagManager) getOpenFeatureFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	allFlags, err := fm.loadAllFlags(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	doc := OpenFeatureDocument{
+		Schema: openFeatureSchema,
+		Flags:  make(map[string]OpenFeatureFlag, len(allFlags)),
+	}
+	for key, config := range allFlags {
+		doc.Flags[key] = toOpenFeatureFlag(config)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
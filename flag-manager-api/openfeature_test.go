@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenFeatureFlagsEndpoint(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	req := httptest.NewRequest("POST", "/api/projects/of-tests", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	flagConfig := map[string]interface{}{
+		"variations": map[string]interface{}{"on": true, "off": false},
+		"targeting": []map[string]interface{}{
+			{"query": `email ew "@example.com" and beta eq true`, "variation": "on"},
+			{"query": `(plan eq "pro") or not (country eq "FR")`, "variation": "on"},
+		},
+		"defaultRule":      map[string]interface{}{"percentage": map[string]float64{"on": 20, "off": 80}},
+		"scheduledRollout": []map[string]interface{}{{"date": "2030-01-01T00:00:00Z", "defaultRule": map[string]interface{}{"variation": "on"}}},
+	}
+	body, _ := json.Marshal(flagConfig)
+	req = httptest.NewRequest("POST", "/api/projects/of-tests/flags/checkout", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/flags/openfeature", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var doc struct {
+		Schema string                            `json:"$schema"`
+		Flags  map[string]map[string]interface{} `json:"flags"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if doc.Schema != openFeatureSchema {
+		t.Errorf("Expected schema %s, got %s", openFeatureSchema, doc.Schema)
+	}
+
+	flag, ok := doc.Flags["of-tests/checkout"]
+	if !ok {
+		t.Fatalf("Expected flag of-tests/checkout, got %v", doc.Flags)
+	}
+	if flag["state"] != "ENABLED" || flag["defaultVariant"] != "off" {
+		t.Errorf("Expected enabled flag defaulting to off, got state=%v defaultVariant=%v", flag["state"], flag["defaultVariant"])
+	}
+
+	targeting, _ := json.Marshal(flag["targeting"])
+	expected := `{"if":[{"and":[{"ends_with":[{"var":"email"},"@example.com"]},{"==":[{"var":"beta"},true]}]},"on",{"fractional":[["off",80],["on",20]]}]}`
+	if string(targeting) != expected {
+		t.Errorf("Unexpected targeting:\n got: %s\nwant: %s", targeting, expected)
+	}
+
+	metadata, _ := flag["metadata"].(map[string]interface{})
+	if metadata["unsupported"] != "targeting[1].query, scheduledRollout" {
+		t.Errorf("Expected unsupported mappings to be listed, got %v", metadata)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+)
+
+const defaultOutboundConcurrency = 4
+
+// outboundLimiter bounds how many calls to external systems (git providers,
+// notifier webhooks, the relay proxy) run at the same time, so bursts of
+// proposals or bulk operations cannot trip rate limits upstream.
+type outboundLimiter struct {
+	sem chan struct{}
+}
+
+func newOutboundLimiter(limit int) *outboundLimiter {
+	if limit < 1 {
+		limit = 1
+	}
+	return &outboundLimiter{sem: make(chan struct{}, limit)}
+}
+
+// Do runs fn once a slot is free. A nil limiter runs fn immediately.
+func (l *outboundLimiter) Do(fn func() error) error {
+	if l == nil {
+		return fn()
+	}
+	l.sem <- struct{}{}
+	defer func() { <-l.sem }()
+	return fn()
+}
+
+// parseOutboundConcurrency reads the OUTBOUND_CONCURRENCY setting, falling back
+// to the default for missing or invalid values.
+func parseOutboundConcurrency(value string) int {
+	if value == "" {
+		return defaultOutboundConcurrency
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		slog.Warn("Invalid OUTBOUND_CONCURRENCY, using default", "value", value, "default", defaultOutboundConcurrency)
+		return defaultOutboundConcurrency
+	}
+	return n
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingProvider is a git.Provider that records the peak number of concurrent calls.
+type countingProvider struct {
+	active int32
+	peak   int32
+}
+
+func (p *countingProvider) GetFile(path string) ([]byte, error) {
+	return nil, nil
+}
+
+func (p *countingProvider) CreatePR(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
+	n := atomic.AddInt32(&p.active, 1)
+	defer atomic.AddInt32(&p.active, -1)
+	for {
+		peak := atomic.LoadInt32(&p.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(&p.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return "https://git.example.com/pr/" + sourceBranch, nil
+}
+
+func TestProposalBurstRespectsOutboundConcurrency(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	const limit = 2
+	provider := &countingProvider{}
+	fm.gitProvider = provider
+	fm.outbound = newOutboundLimiter(limit)
+
+	router := setupTestRouter(fm)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"action": "create",
+		"config": FlagConfig{
+			Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+			DefaultRule: &DefaultRule{Variation: "disabled"},
+		},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/api/projects/burst/flags/flag-"+string(rune('a'+i))+"/propose", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != http.StatusCreated {
+				t.Errorf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if peak := atomic.LoadInt32(&provider.peak); peak > limit {
+		t.Errorf("Expected at most %d concurrent PR creations, got %d", limit, peak)
+	}
+	if peak := atomic.LoadInt32(&provider.peak); peak == 0 {
+		t.Error("Expected PR creation to be called")
+	}
+}
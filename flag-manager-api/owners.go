@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// isTeamOwner reports whether a flag owner names a team rather than a user.
+func isTeamOwner(owner string) bool {
+	return teamOwnerRegex.MatchString(owner)
+}
+
+// normalizeOwner returns the form owners are compared in: lowercase, without
+// the leading @, so that alice, @alice and @Alice name the same user.
+func normalizeOwner(owner string) string {
+	return strings.ToLower(strings.TrimPrefix(owner, "@"))
+}
+
+// ownsFlag reports whether one of names, compared as normalized owners, is an
+// owner of a flag.
+func ownsFlag(config FlagConfig, names []string) bool {
+	for _, owner := range config.Owners {
+		for _, name := range names {
+			if normalizeOwner(owner) == normalizeOwner(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// actorOwnerNames returns the owners that designate an actor: its user ID and
+// email, and the teams of its groups claim.
+func actorOwnerNames(actor Actor) []string {
+	var names []string
+	if actor.ID != "" {
+		names = append(names, actor.ID)
+	}
+	if actor.Email != "" {
+		names = append(names, actor.Email)
+	}
+	return append(names, actor.Groups...)
+}
+
+// mayChangeFlag reports whether the actor of a request may change a flag. With
+// ENFORCE_FLAG_OWNERS, a flag that has owners may only be changed by them and
+// by admins. API keys are not restricted, as for approvals, and nothing is
+// enforced when authentication is disabled.
+func (fm *FlagManager) mayChangeFlag(r *http.Request, config FlagConfig) bool {
+	if !fm.enforceFlagOwners || !fm.authEnabled || len(config.Owners) == 0 {
+		return true
+	}
+	actor := GetActor(r)
+	if actor.Type == "apikey" || ownsFlag(config, actorOwnerNames(actor)) {
+		return true
+	}
+	if fm.store != nil && actor.ID != "" {
+		isAdmin, _ := fm.store.HasPermission(r.Context(), actor.ID, "*", "admin")
+		return isAdmin
+	}
+	return false
+}
+
+// writeNotFlagOwner sends a 403 response naming the flags the actor does not
+// own.
+func writeNotFlagOwner(w http.ResponseWriter, keys ...string) {
+	writeError(w, http.StatusForbidden, "NOT_FLAG_OWNER", "Only the owners of a flag and admins can change it", keys...)
+}
+
+// validateOwners checks owners set on a flag that previously had previous:
+// each must be well formed, and users newly made owners must be in the RBAC
+// users table. Teams are not checked against it, nor are users when there is
+// no database or no user has a role yet, so that owners can be set before
+// RBAC is.
+func (fm *FlagManager) validateOwners(ctx context.Context, owners, previous []string) ([]string, error) {
+	var errs []string
+	var added []string
+	for _, owner := range owners {
+		if err := ValidateOwner(owner); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !isTeamOwner(owner) && !slices.ContainsFunc(previous, func(p string) bool {
+			return normalizeOwner(p) == normalizeOwner(owner)
+		}) {
+			added = append(added, owner)
+		}
+	}
+	if len(errs) > 0 || len(added) == 0 || fm.store == nil {
+		return errs, nil
+	}
+
+	users, err := fm.store.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]bool, 2*len(users))
+	for _, u := range users {
+		known[normalizeOwner(u.UserID)] = true
+		if u.Email != "" {
+			known[normalizeOwner(u.Email)] = true
+		}
+	}
+	for _, owner := range added {
+		if !known[normalizeOwner(owner)] {
+			errs = append(errs, fmt.Sprintf("owner '%s' is not a known user", owner))
+		}
+	}
+	return errs, nil
+}
+
+// OwnedFlag is a flag of a project with its owners.
+type OwnedFlag struct {
+	Project string   `json:"project"`
+	Key     string   `json:"key"`
+	Owners  []string `json:"owners"`
+}
+
+// OwnedFlagsResponse lists the flags owned by a user or team.
+type OwnedFlagsResponse struct {
+	Owner string      `json:"owner"`
+	Flags []OwnedFlag `json:"flags"`
+	Total int         `json:"total"`
+}
+
+// ownedFlagsHandler lists the flags of every project owned by ?owner=, a user
+// or @org/team; the calling user by default. A user given by ID also owns the
+// flags listing their email in the RBAC users table, and the other way round.
+func (fm *FlagManager) ownedFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	owner := r.URL.Query().Get("owner")
+	var names []string
+	if owner != "" {
+		if err := ValidateOwner(owner); err != nil {
+			writeValidationError(w, "INVALID_OWNER", err.Error())
+			return
+		}
+		names = []string{owner}
+	} else if actor := GetActor(r); actor.Type == "user" {
+		owner = actorLabel(actor)
+		names = actorOwnerNames(actor)
+	} else {
+		writeValidationError(w, "OWNER_REQUIRED", "owner is required")
+		return
+	}
+
+	if fm.store != nil && !isTeamOwner(owner) {
+		users, err := fm.store.ListUsers(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		for _, u := range users {
+			if ownsFlag(FlagConfig{Owners: []string{u.UserID, u.Email}}, names) {
+				names = append(names, u.UserID)
+				if u.Email != "" {
+					names = append(names, u.Email)
+				}
+			}
+		}
+	}
+
+	flags, err := fm.storage.AllFlags(r.Context())
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	owned := []OwnedFlag{}
+	for id, config := range flags {
+		if !ownsFlag(config, names) {
+			continue
+		}
+		project, key, _ := strings.Cut(id, "/")
+		owned = append(owned, OwnedFlag{Project: project, Key: key, Owners: config.Owners})
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		if owned[i].Project != owned[j].Project {
+			return owned[i].Project < owned[j].Project
+		}
+		return owned[i].Key < owned[j].Key
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OwnedFlagsResponse{Owner: owner, Flags: owned, Total: len(owned)})
+}
+
+// codeownersRule is a line of a CODEOWNERS file: the flags whose key matches
+// Pattern are owned by Owners, or by no one when there are none.
+type codeownersRule struct {
+	Pattern string
+	Owners  []string
+}
+
+// parseCodeowners reads the rules of a CODEOWNERS-style file. Patterns are
+// matched against flag keys with path.Match; a leading / is ignored so that
+// rooted patterns such as /checkout-* apply as written.
+func parseCodeowners(data []byte) ([]codeownersRule, []string) {
+	var rules []codeownersRule
+	var errs []string
+	for i, line := range strings.Split(string(data), "\n") {
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rule := codeownersRule{Pattern: strings.TrimPrefix(fields[0], "/"), Owners: fields[1:]}
+		if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+			errs = append(errs, fmt.Sprintf("line %d: invalid pattern '%s'", i+1, fields[0]))
+		}
+		if len(rule.Owners) > maxFlagOwners {
+			errs = append(errs, fmt.Sprintf("line %d: a flag can have at most %d owners", i+1, maxFlagOwners))
+		}
+		for _, owner := range rule.Owners {
+			if err := ValidateOwner(owner); err != nil {
+				errs = append(errs, fmt.Sprintf("line %d: %v", i+1, err))
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, errs
+}
+
+// codeownersOwners returns the owners rules give a flag: those of the last
+// rule matching its key, as in CODEOWNERS files. ok is false if none does.
+func codeownersOwners(rules []codeownersRule, key string) (owners []string, ok bool) {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if matched, _ := path.Match(rules[i].Pattern, key); matched {
+			return rules[i].Owners, true
+		}
+	}
+	return nil, false
+}
+
+// CodeownersImportResponse reports the flags whose owners a CODEOWNERS import
+// changed and the patterns that matched no flag.
+type CodeownersImportResponse struct {
+	Project        string      `json:"project"`
+	DryRun         bool        `json:"dryRun"`
+	Updated        []OwnedFlag `json:"updated"`
+	UnusedPatterns []string    `json:"unusedPatterns"`
+	Total          int         `json:"total"`
+}
+
+// importCodeowners handles POST /api/flags/import?source=codeowners: it sets
+// the owners of the flags of ?project= from a CODEOWNERS-style file whose
+// patterns match flag keys. Flags no pattern matches keep their owners.
+// ?dryRun=true reports what would change without applying it. Nothing is
+// applied if the file is invalid or names unknown users.
+func (fm *FlagManager) importCodeowners(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	project := query.Get("project")
+	if project == "" {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "project is required")
+		return
+	}
+	if err := ValidateProjectName(project); err != nil {
+		writeValidationError(w, "INVALID_PROJECT_NAME", err.Error())
+		return
+	}
+	if !fm.authorizeProject(w, r, "flag", "write", project) {
+		return
+	}
+	dryRun := query.Get("dryRun") == "true"
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	rules, errs := parseCodeowners(body)
+	if len(errs) > 0 {
+		writeValidationError(w, "INVALID_CODEOWNERS_FILE", "The CODEOWNERS file is invalid", errs...)
+		return
+	}
+	var owners []string
+	for _, rule := range rules {
+		for _, owner := range rule.Owners {
+			if !slices.Contains(owners, owner) {
+				owners = append(owners, owner)
+			}
+		}
+	}
+	errs, err = fm.validateOwners(r.Context(), owners, nil)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, "UNKNOWN_OWNERS", "The CODEOWNERS file names unknown users", errs...)
+		return
+	}
+
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	keys := make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resp := CodeownersImportResponse{Project: project, DryRun: dryRun, Updated: []OwnedFlag{}, UnusedPatterns: []string{}}
+	used := make(map[string]bool)
+	before := make(map[string][]string)
+	var changed, denied []string
+	for _, key := range keys {
+		owners, ok := codeownersOwners(rules, key)
+		if !ok {
+			continue
+		}
+		for _, rule := range rules {
+			if matched, _ := path.Match(rule.Pattern, key); matched {
+				used[rule.Pattern] = true
+			}
+		}
+		config := flags[key]
+		if slices.Equal(config.Owners, owners) || (len(config.Owners) == 0 && len(owners) == 0) {
+			continue
+		}
+		if !fm.mayChangeFlag(r, config) {
+			denied = append(denied, key)
+		}
+		if len(owners) == 0 {
+			owners = nil
+		}
+		changed = append(changed, key)
+		before[key] = config.Owners
+		config.Owners = owners
+		flags[key] = config
+		resp.Updated = append(resp.Updated, OwnedFlag{Project: project, Key: key, Owners: append([]string{}, owners...)})
+	}
+	for _, rule := range rules {
+		if !used[rule.Pattern] && !slices.Contains(resp.UnusedPatterns, rule.Pattern) {
+			resp.UnusedPatterns = append(resp.UnusedPatterns, rule.Pattern)
+		}
+	}
+	resp.Total = len(resp.Updated)
+
+	if len(denied) > 0 {
+		writeNotFlagOwner(w, denied...)
+		return
+	}
+
+	if !dryRun && len(changed) > 0 {
+		flagIDs, err := fm.storage.SaveFlags(r.Context(), project, flags, changed)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+
+		actor := GetActor(r)
+		for _, key := range changed {
+			fm.audit.Log(r.Context(), actor, "flag.owners_updated", "flag", flagIDs[key], key, project,
+				map[string]interface{}{"before": before[key], "after": flags[key].Owners},
+				map[string]interface{}{"source": "codeowners"})
+			fm.notifyProjectWebhook(r, "flag.updated", project, key, "")
+		}
+
+		fm.scheduleRelayRefresh(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
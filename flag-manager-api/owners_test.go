@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagOwners(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	roles, err := store.ListRoles(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list roles: %v", err)
+	}
+	roleIDs := make(map[string]string)
+	for _, role := range roles {
+		roleIDs[role.Name] = role.ID
+	}
+	for user, role := range map[string]string{"alice": "editor", "bob": "editor", "carol": "editor", "root": "admin"} {
+		if err := store.SetUserRoles(context.Background(), user, []string{roleIDs[role]}); err != nil {
+			t.Fatalf("Failed to assign role: %v", err)
+		}
+	}
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			as := func(actor *Actor, method, path, body string, status int, v interface{}) {
+				t.Helper()
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				if actor != nil {
+					req = req.WithContext(context.WithValue(req.Context(), ctxActor, *actor))
+				}
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				if rr.Code != status {
+					t.Fatalf("%s %s: expected status %d, got %d: %s", method, path, status, rr.Code, rr.Body.String())
+				}
+				if v != nil {
+					json.Unmarshal(rr.Body.Bytes(), v)
+				}
+			}
+			flag := func(owners string) string {
+				return `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"owners":` + owners + `}`
+			}
+			owners := func(key string) []string {
+				t.Helper()
+				var resp FlagResponse
+				doRequest(t, router, "GET", "/api/projects/shop/flags/"+key, "", http.StatusOK, &resp)
+				return resp.Config.Owners
+			}
+
+			doRequest(t, router, "POST", "/api/projects/shop/flags/checkout", flag(`["@acme/payments","alice"]`), http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/refunds", flag(`["@Alice"]`), http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/banner", flag(`["bob"]`), http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/blog/flags/comments", flag(`["@acme/payments"]`), http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bad", flag(`["two words"]`), http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bad", flag(`["alice","@alice"]`), http.StatusBadRequest, nil)
+			if fm.store != nil {
+				doRequest(t, router, "POST", "/api/projects/shop/flags/bad", flag(`["mallory"]`), http.StatusBadRequest, nil)
+			} else {
+				doRequest(t, router, "POST", "/api/projects/shop/flags/unchecked", flag(`["mallory"]`), http.StatusCreated, nil)
+			}
+
+			t.Run("lists owned flags", func(t *testing.T) {
+				var owned OwnedFlagsResponse
+				doRequest(t, router, "GET", "/api/flags/owned?owner=alice", "", http.StatusOK, &owned)
+				if want := []OwnedFlag{
+					{Project: "shop", Key: "checkout", Owners: []string{"@acme/payments", "alice"}},
+					{Project: "shop", Key: "refunds", Owners: []string{"@Alice"}},
+				}; !reflect.DeepEqual(owned.Flags, want) {
+					t.Errorf("Expected %v, got %v", want, owned.Flags)
+				}
+				owned = OwnedFlagsResponse{}
+				doRequest(t, router, "GET", "/api/flags/owned?owner="+url.QueryEscape("@acme/payments"), "", http.StatusOK, &owned)
+				if owned.Total != 2 || owned.Flags[0].Project != "blog" || owned.Flags[1].Key != "checkout" {
+					t.Errorf("Expected the team's flags, got %v", owned.Flags)
+				}
+				owned = OwnedFlagsResponse{}
+				as(&Actor{ID: "carol", Type: "user", Groups: []string{"acme/payments"}}, "GET", "/api/flags/owned", "", http.StatusOK, &owned)
+				if owned.Total != 2 {
+					t.Errorf("Expected the caller's team flags, got %v", owned.Flags)
+				}
+				doRequest(t, router, "GET", "/api/flags/owned", "", http.StatusBadRequest, nil)
+			})
+
+			t.Run("enforces ownership", func(t *testing.T) {
+				fm.authEnabled, fm.enforceFlagOwners = true, true
+				defer func() { fm.authEnabled, fm.enforceFlagOwners = false, false }()
+
+				alice := &Actor{ID: "alice", Type: "user"}
+				bob := &Actor{ID: "bob", Type: "user"}
+				payments := &Actor{ID: "carol", Type: "user", Groups: []string{"acme/payments"}}
+				update := `{"config":` + flag(`["@acme/payments","alice"]`) + `}`
+
+				as(bob, "PUT", "/api/projects/shop/flags/checkout", update, http.StatusForbidden, nil)
+				as(bob, "DELETE", "/api/projects/shop/flags/refunds", "", http.StatusForbidden, nil)
+				as(bob, "POST", "/api/projects/shop/flags/bulk-tags", `{"keys":["checkout"],"add":["x"]}`, http.StatusForbidden, nil)
+				var bulk BulkResponse
+				as(bob, "POST", "/api/projects/shop/flags/bulk-toggle", `{"keys":["checkout","banner"],"disabled":true}`, http.StatusOK, &bulk)
+				if bulk.Total != 1 || bulk.Results[0].Key != "banner" || len(bulk.Errors) != 1 {
+					t.Errorf("Expected only the unowned flag to be toggled, got %+v", bulk)
+				}
+
+				as(alice, "PUT", "/api/projects/shop/flags/checkout", update, http.StatusOK, nil)
+				as(payments, "PUT", "/api/projects/shop/flags/checkout", update, http.StatusOK, nil)
+				as(&Actor{Type: "apikey"}, "PUT", "/api/projects/shop/flags/checkout", update, http.StatusOK, nil)
+				if fm.store != nil {
+					as(&Actor{ID: "root", Type: "user"}, "PUT", "/api/projects/shop/flags/checkout", update, http.StatusOK, nil)
+				}
+			})
+
+			t.Run("imports CODEOWNERS", func(t *testing.T) {
+				codeowners := "# Flag owners\n* @acme/platform\n/check* @acme/payments alice # checkout team\nbanner\nlegacy-* @acme/legacy\n"
+
+				var resp CodeownersImportResponse
+				doRequest(t, router, "POST", "/api/flags/import?source=codeowners&project=shop&dryRun=true", codeowners, http.StatusOK, &resp)
+				if want := (OwnedFlag{Project: "shop", Key: "refunds", Owners: []string{"@acme/platform"}}); !resp.DryRun || !slices.ContainsFunc(resp.Updated, func(f OwnedFlag) bool {
+					return reflect.DeepEqual(f, want)
+				}) {
+					t.Errorf("Expected a dry run reporting %v, got %+v", want, resp)
+				}
+				if got := owners("refunds"); !reflect.DeepEqual(got, []string{"@Alice"}) {
+					t.Errorf("Expected a dry run to change nothing, got %v", got)
+				}
+
+				resp = CodeownersImportResponse{}
+				doRequest(t, router, "POST", "/api/flags/import?source=codeowners&project=shop", codeowners, http.StatusOK, &resp)
+				if want := []string{"legacy-*"}; !reflect.DeepEqual(resp.UnusedPatterns, want) {
+					t.Errorf("Expected unused patterns %v, got %v", want, resp.UnusedPatterns)
+				}
+				if got := owners("checkout"); !reflect.DeepEqual(got, []string{"@acme/payments", "alice"}) {
+					t.Errorf("Expected the last matching rule to win, got %v", got)
+				}
+				if got := owners("refunds"); !reflect.DeepEqual(got, []string{"@acme/platform"}) {
+					t.Errorf("Expected the catch-all rule, got %v", got)
+				}
+				if got := owners("banner"); got != nil {
+					t.Errorf("Expected a rule without owners to clear them, got %v", got)
+				}
+
+				doRequest(t, router, "POST", "/api/flags/import?source=codeowners&project=shop", "[ @acme/x\n", http.StatusBadRequest, nil)
+				doRequest(t, router, "POST", "/api/flags/import?source=codeowners&project=shop", "* not/valid/owner\n", http.StatusBadRequest, nil)
+				if fm.store != nil {
+					doRequest(t, router, "POST", "/api/flags/import?source=codeowners&project=shop", "* mallory\n", http.StatusBadRequest, nil)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+// wantsPage reports whether a list request asks for a page. List endpoints
+// that predate pagination keep their original response without one.
+func wantsPage(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("page") || q.Has("perPage") || q.Has("pageSize")
+}
+
+// listFilter holds the ?disabled= and ?type= filters of list endpoints. For
+// flags the type is the type of their variations; for retrievers, exporters
+// and notifiers it is their kind, and disabled means not enabled.
+type listFilter struct {
+	Disabled *bool
+	Type     string
+}
+
+// parseListFilter parses the list filters of a request.
+func parseListFilter(r *http.Request) (listFilter, error) {
+	var f listFilter
+	if v := r.URL.Query().Get("disabled"); v != "" {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, fmt.Errorf("disabled must be true or false")
+		}
+		f.Disabled = &disabled
+	}
+	f.Type = r.URL.Query().Get("type")
+	return f, nil
+}
+
+// keeps reports whether an item passes the filter.
+func (f listFilter) keeps(disabled bool, typ string) bool {
+	return (f.Disabled == nil || *f.Disabled == disabled) && (f.Type == "" || f.Type == typ)
+}
+
+// listSorts are the comparators a list held in memory can be sorted by, keyed
+// by ?sort= value.
+type listSorts[T any] map[string]func(a, b T) int
+
+// pageList searches, sorts and pages a list held in memory with the query
+// parameters of the database list endpoints: ?search= keeps the items whose
+// text contains it (case-insensitive) and ?sort= names one of sorts, falling
+// back to defaultSort. Without ?order=, timestamps sort newest first and
+// other fields ascending.
+func pageList[T any](r *http.Request, items []T, text func(T) string, sorts listSorts[T], defaultSort string) *db.PaginatedResult[T] {
+	params := parsePaginationParams(r)
+	if _, ok := sorts[params.Sort]; !ok || !r.URL.Query().Has("sort") {
+		params.Sort = defaultSort
+	}
+	if !r.URL.Query().Has("order") && !strings.HasSuffix(params.Sort, "_at") {
+		params.Order = "asc"
+	}
+
+	search := strings.ToLower(params.Search)
+	matched := []T{}
+	for _, item := range items {
+		if search == "" || strings.Contains(strings.ToLower(text(item)), search) {
+			matched = append(matched, item)
+		}
+	}
+
+	compare := sorts[params.Sort]
+	desc := params.OrderDirection() == "DESC"
+	slices.SortStableFunc(matched, func(a, b T) int {
+		if desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+
+	total := len(matched)
+	start := min(params.Offset(), total)
+	end := min(start+params.Limit(), total)
+	return db.NewPaginatedResult(matched[start:end], total, params)
+}
+
+// namedSorts are the sorts of resources with a name, kind and timestamps.
+func namedSorts[T any](name, kind func(T) string, created, updated func(T) time.Time) listSorts[T] {
+	return listSorts[T]{
+		"name":       func(a, b T) int { return cmp.Compare(name(a), name(b)) },
+		"kind":       func(a, b T) int { return cmp.Compare(kind(a), kind(b)) },
+		"created_at": func(a, b T) int { return created(a).Compare(created(b)) },
+		"updated_at": func(a, b T) int { return updated(a).Compare(updated(b)) },
+	}
+}
+
+// writePage writes a page of a list, keeping only the ?fields= of each item
+// when given.
+func writePage[T any](w http.ResponseWriter, r *http.Request, page *db.PaginatedResult[T]) {
+	fields, err := parseFieldSelection(r)
+	if err != nil {
+		writeValidationError(w, "INVALID_FIELDS", err.Error())
+		return
+	}
+
+	var resp interface{} = page
+	if fields != nil {
+		items := make([]map[string]interface{}, 0, len(page.Data))
+		for _, item := range page.Data {
+			projected, err := projectFields(item, fields)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+				return
+			}
+			items = append(items, projected)
+		}
+		resp = db.PaginatedResult[map[string]interface{}]{
+			Data:       items,
+			Total:      page.Total,
+			Page:       page.Page,
+			PageSize:   page.PageSize,
+			TotalPages: page.TotalPages,
+			HasNext:    page.HasNext,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
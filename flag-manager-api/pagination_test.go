@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestListPagination(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	type page struct {
+		Data []struct {
+			Key  string `json:"key"`
+			Name string `json:"name"`
+		} `json:"data"`
+		Total      int  `json:"total"`
+		TotalPages int  `json:"totalPages"`
+		HasNext    bool `json:"hasNext"`
+	}
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			keys := func(path string) ([]string, page) {
+				t.Helper()
+				var p page
+				doRequest(t, router, "GET", path, "", http.StatusOK, &p)
+				var keys []string
+				for _, item := range p.Data {
+					keys = append(keys, item.Key+item.Name)
+				}
+				return keys, p
+			}
+
+			doRequest(t, router, "POST", "/api/projects/web/flags/alpha", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"tags":["ui"]}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/beta", `{"variations":{"a":"x","b":"y"},"defaultRule":{"variation":"a"},"disable":true}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/gamma", `{"variations":{"low":1,"high":2},"defaultRule":{"variation":"low"},"tags":["ui"]}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/delta", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/api/flags/one", `{"variations":{"on":true},"defaultRule":{"variation":"on"}}`, http.StatusCreated, nil)
+
+			got, p := keys("/api/projects/web/flags?page=1&perPage=3&sort=key&order=asc")
+			if !reflect.DeepEqual(got, []string{"alpha", "beta", "delta"}) || p.Total != 4 || p.TotalPages != 2 || !p.HasNext {
+				t.Errorf("Expected the first page of flags, got %v %+v", got, p)
+			}
+			got, p = keys("/api/projects/web/flags?page=2&perPage=3&sort=key&order=asc")
+			if !reflect.DeepEqual(got, []string{"gamma"}) || p.HasNext {
+				t.Errorf("Expected the last page of flags, got %v %+v", got, p)
+			}
+			for query, want := range map[string][]string{
+				"disabled=true":               {"beta"},
+				"disabled=false&type=boolean": {"alpha", "delta"},
+				"type=number":                 {"gamma"},
+				"type=string":                 {"beta"},
+				"tag=ui&type=boolean":         {"alpha"},
+				"search=lt":                   {"delta"},
+			} {
+				if got, _ := keys("/api/projects/web/flags?page=1&sort=key&order=asc&" + query); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: expected %v, got %v", query, want, got)
+				}
+			}
+			var list struct {
+				Flags map[string]interface{} `json:"flags"`
+			}
+			doRequest(t, router, "GET", "/api/projects/web/flags?disabled=true", "", http.StatusOK, &list)
+			if len(list.Flags) != 1 || list.Flags["beta"] == nil {
+				t.Errorf("Expected the unpaginated list to be filtered, got %v", list.Flags)
+			}
+			doRequest(t, router, "GET", "/api/projects/web/flags?type=date", "", http.StatusBadRequest, nil)
+			doRequest(t, router, "GET", "/api/projects/web/flags?disabled=maybe", "", http.StatusBadRequest, nil)
+
+			var projects struct {
+				Data    []string `json:"data"`
+				Total   int      `json:"total"`
+				HasNext bool     `json:"hasNext"`
+			}
+			doRequest(t, router, "GET", "/api/projects?page=1&perPage=1", "", http.StatusOK, &projects)
+			if !reflect.DeepEqual(projects.Data, []string{"api"}) || projects.Total != 2 || !projects.HasNext {
+				t.Errorf("Expected the first project, got %+v", projects)
+			}
+			var legacy ProjectsResponse
+			doRequest(t, router, "GET", "/api/projects", "", http.StatusOK, &legacy)
+			if len(legacy.Projects) != 2 {
+				t.Errorf("Expected the unpaginated project list, got %+v", legacy)
+			}
+
+			doRequest(t, router, "POST", "/api/notifiers", `{"id":"ops-log","name":"ops-log","kind":"log","enabled":true}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/notifiers", `{"id":"audit-log","name":"audit-log","kind":"log","enabled":false}`, http.StatusCreated, nil)
+			if got, p := keys("/api/notifiers?page=1&disabled=false"); !reflect.DeepEqual(got, []string{"ops-log"}) || p.Total != 1 {
+				t.Errorf("Expected the enabled notifier, got %v", got)
+			}
+			if got, _ := keys("/api/notifiers?page=1&sort=name&order=desc"); !reflect.DeepEqual(got, []string{"ops-log", "audit-log"}) {
+				t.Errorf("Expected the notifiers by name, got %v", got)
+			}
+			var notifiers NotifiersResponse
+			doRequest(t, router, "GET", "/api/notifiers?type=slack", "", http.StatusOK, &notifiers)
+			if len(notifiers.Notifiers) != 0 {
+				t.Errorf("Expected no slack notifier, got %+v", notifiers)
+			}
+
+			doRequest(t, router, "POST", "/api/flagsets", `{"name":"mobile"}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/flagsets", `{"name":"desktop"}`, http.StatusCreated, nil)
+			if got, p := keys("/api/flagsets?perPage=1&search=mob"); !reflect.DeepEqual(got, []string{"mobile"}) || p.HasNext {
+				t.Errorf("Expected the searched flag set, got %v %+v", got, p)
+			}
+		})
+	}
+}
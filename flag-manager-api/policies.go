@@ -0,0 +1,848 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errPolicyNotFound = errors.New("policy not found")
+	errPolicyExists   = errors.New("policy already exists")
+)
+
+var policySeverities = []string{"error", "warning"}
+
+// PoliciesStore manages policy persistence in file mode
+type PoliciesStore struct {
+	filePath string
+	policies []db.Policy
+	mu       sync.RWMutex
+}
+
+// NewPoliciesStore creates a new policies store
+func NewPoliciesStore(configDir string) *PoliciesStore {
+	store := &PoliciesStore{
+		filePath: filepath.Join(configDir, "policies.json"),
+	}
+	store.load()
+	return store
+}
+
+func (s *PoliciesStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.policies)
+}
+
+func (s *PoliciesStore) save() error {
+	data, err := json.MarshalIndent(s.policies, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filePath, data, 0644)
+}
+
+// nameTaken reports whether a policy other than id is named name.
+func (s *PoliciesStore) nameTaken(name, id string) bool {
+	for _, p := range s.policies {
+		if p.Name == name && p.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the policies by name
+func (s *PoliciesStore) List() []db.Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policies := append([]db.Policy{}, s.policies...)
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies
+}
+
+// Get returns a policy, or errPolicyNotFound
+func (s *PoliciesStore) Get(id string) (*db.Policy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.policies {
+		if p.ID == id {
+			return &p, nil
+		}
+	}
+	return nil, errPolicyNotFound
+}
+
+// Create stores a policy and returns it with its ID and timestamps
+func (s *PoliciesStore) Create(p db.Policy) (*db.Policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(p.Name, "") {
+		return nil, errPolicyExists
+	}
+	now := time.Now().UTC()
+	p.ID = uuid.New().String()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	s.policies = append(s.policies, p)
+	if err := s.save(); err != nil {
+		s.policies = s.policies[:len(s.policies)-1]
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Update replaces a policy, keeping its ID and creation time
+func (s *PoliciesStore) Update(id string, p db.Policy) (*db.Policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.policies {
+		if existing.ID != id {
+			continue
+		}
+		if s.nameTaken(p.Name, id) {
+			return nil, errPolicyExists
+		}
+		p.ID = id
+		p.CreatedAt = existing.CreatedAt
+		p.UpdatedAt = time.Now().UTC()
+		s.policies[i] = p
+		if err := s.save(); err != nil {
+			s.policies[i] = existing
+			return nil, err
+		}
+		return &p, nil
+	}
+	return nil, errPolicyNotFound
+}
+
+// Delete removes a policy
+func (s *PoliciesStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, p := range s.policies {
+		if p.ID != id {
+			continue
+		}
+		previous := s.policies
+		s.policies = append(s.policies[:i:i], s.policies[i+1:]...)
+		if err := s.save(); err != nil {
+			s.policies = previous
+			return err
+		}
+		return nil
+	}
+	return errPolicyNotFound
+}
+
+// policyStoreError maps database errors to errPolicyNotFound and
+// errPolicyExists.
+func policyStoreError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return errPolicyNotFound
+	case strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "UNIQUE"):
+		return errPolicyExists
+	}
+	return err
+}
+
+// writePolicyError responds with the status of a policy store error.
+func writePolicyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPolicyNotFound):
+		writeError(w, http.StatusNotFound, "POLICY_NOT_FOUND", "Policy not found")
+	case errors.Is(err, errPolicyExists):
+		writeError(w, http.StatusConflict, "POLICY_EXISTS", "Policy with this name already exists")
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+}
+
+// policyEnv declares the attributes of a flag change, as policyInput
+// provides them, to the CEL expressions of policy conditions and rules.
+var policyEnv = sync.OnceValues(func() (*cel.Env, error) {
+	stringList := cel.ListType(cel.StringType)
+	return cel.NewEnv(
+		cel.Variable("action", cel.StringType),
+		cel.Variable("project", cel.StringType),
+		cel.Variable("flag", cel.StringType),
+		cel.Variable("environment", cel.StringType),
+		cel.Variable("environments", stringList),
+		cel.Variable("owners", stringList),
+		cel.Variable("ownerCount", cel.IntType),
+		cel.Variable("tags", stringList),
+		cel.Variable("trackEvents", cel.BoolType),
+		cel.Variable("disabled", cel.BoolType),
+		cel.Variable("experiment", cel.BoolType),
+		cel.Variable("variationCount", cel.IntType),
+		cel.Variable("targetingRuleCount", cel.IntType),
+		cel.Variable("percentageChange", cel.DoubleType),
+		cel.Variable("status", cel.StringType),
+		cel.Variable("expiresAt", cel.StringType),
+		cel.Variable("metadata", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("actor", cel.MapType(cel.StringType, cel.StringType)),
+		cel.OptionalTypes(),
+		cel.CrossTypeNumericComparisons(true),
+	)
+})
+
+// policyPrograms caches the compiled policy expressions by source.
+var policyPrograms sync.Map
+
+// compilePolicyExpression compiles a policy condition or rule, which must be
+// a CEL expression of the policy attributes evaluating to a bool.
+func compilePolicyExpression(expr string) (cel.Program, error) {
+	if prg, ok := policyPrograms.Load(expr); ok {
+		return prg.(cel.Program), nil
+	}
+	env, err := policyEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expr)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression is a %s, not a bool", ast.OutputType())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	policyPrograms.Store(expr, prg)
+	return prg, nil
+}
+
+// evalPolicyExpression evaluates a policy condition or rule on a change.
+func evalPolicyExpression(expr string, input map[string]interface{}) (bool, error) {
+	prg, err := compilePolicyExpression(expr)
+	if err != nil {
+		return false, err
+	}
+	out, _, err := prg.Eval(input)
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression evaluated to %v, not a bool", out.Value())
+	}
+	return result, nil
+}
+
+// validatePolicy checks the name, the severity and the expressions of a
+// policy.
+func validatePolicy(p db.Policy) []string {
+	var errs []string
+	if p.Name == "" {
+		errs = append(errs, "name is required")
+	}
+	if !slices.Contains(policySeverities, p.Severity) {
+		errs = append(errs, "severity must be one of "+strings.Join(policySeverities, ", "))
+	}
+	if p.Condition != "" {
+		if _, err := compilePolicyExpression(p.Condition); err != nil {
+			errs = append(errs, "condition: "+err.Error())
+		}
+	}
+	if p.Rule == "" {
+		errs = append(errs, "rule is required")
+	} else if _, err := compilePolicyExpression(p.Rule); err != nil {
+		errs = append(errs, "rule: "+err.Error())
+	}
+	return errs
+}
+
+// PolicyViolation is a policy a flag change does not satisfy.
+type PolicyViolation struct {
+	Flag     string `json:"flag,omitempty"` // the changed flag
+	PolicyID string `json:"policyId,omitempty"`
+	Policy   string `json:"policy"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// policySatisfied reports whether a change described by input satisfies a
+// policy: its condition does not match the change, or its rule does.
+func policySatisfied(p db.Policy, input map[string]interface{}) (bool, error) {
+	if p.Condition != "" {
+		applies, err := evalPolicyExpression(p.Condition, input)
+		if err != nil {
+			return false, fmt.Errorf("condition: %w", err)
+		}
+		if !applies {
+			return true, nil
+		}
+	}
+	satisfied, err := evalPolicyExpression(p.Rule, input)
+	if err != nil {
+		return false, fmt.Errorf("rule: %w", err)
+	}
+	return satisfied, nil
+}
+
+// evaluatePolicies returns the enabled policies a change described by input
+// does not satisfy, errors first. A policy that fails to evaluate, such as
+// one stored before its expressions were checked or reading a metadata key
+// the flag lacks, is violated: policies fail closed.
+func evaluatePolicies(policies []db.Policy, input map[string]interface{}) []PolicyViolation {
+	violations := []PolicyViolation{}
+	for _, p := range policies {
+		if !p.Enabled {
+			continue
+		}
+		satisfied, err := policySatisfied(p, input)
+		if satisfied {
+			continue
+		}
+		message := p.Message
+		if message == "" {
+			message = p.Name
+		}
+		if err != nil {
+			slog.Warn("Policy failed to evaluate", "policy", p.Name, "error", err)
+			message = "Policy could not be evaluated: " + err.Error()
+		}
+		violations = append(violations, PolicyViolation{PolicyID: p.ID, Policy: p.Name, Severity: p.Severity, Message: message})
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Severity == "error" && violations[j].Severity != "error"
+	})
+	return violations
+}
+
+// ruleShares returns the share of users, in percent, each variation of a
+// rule serves.
+func ruleShares(variation string, percentage map[string]float64) map[string]float64 {
+	shares := map[string]float64{}
+	if len(percentage) > 0 {
+		for v, p := range percentage {
+			shares[v] = p
+		}
+	} else if variation != "" {
+		shares[variation] = 100
+	}
+	return shares
+}
+
+// defaultShares returns the shares of the variations of a flag's default rule.
+func defaultShares(config *FlagConfig) map[string]float64 {
+	if config.DefaultRule == nil {
+		return map[string]float64{}
+	}
+	return ruleShares(config.DefaultRule.Variation, config.DefaultRule.Percentage)
+}
+
+// targetingShares returns the shares of the variations of each enabled
+// targeting rule of a flag, keyed by rule name, or by query for unnamed rules.
+func targetingShares(config *FlagConfig) map[string]map[string]float64 {
+	rules := map[string]map[string]float64{}
+	for _, rule := range config.Targeting {
+		if rule.Disable != nil && *rule.Disable {
+			continue
+		}
+		key := "name:" + rule.Name
+		if rule.Name == "" {
+			key = "query:" + rule.Query
+		}
+		rules[key] = ruleShares(rule.Variation, rule.Percentage)
+	}
+	return rules
+}
+
+// sharesChange is the largest change, in percentage points, in the share of
+// users a variation is served.
+func sharesChange(before, after map[string]float64) float64 {
+	change := 0.0
+	for variation := range before {
+		change = math.Max(change, math.Abs(after[variation]-before[variation]))
+	}
+	for variation := range after {
+		change = math.Max(change, math.Abs(after[variation]-before[variation]))
+	}
+	return change
+}
+
+// percentageChange is the largest change, in percentage points, in the share
+// of users a variation serves, across the default rule and the targeting
+// rules. The users of a targeting rule that is added, removed or disabled
+// move to or from the default rule, and are compared with it. It is 0 for
+// new flags.
+func percentageChange(before, after *FlagConfig) float64 {
+	if before == nil {
+		return 0
+	}
+	beforeDefault, afterDefault := defaultShares(before), defaultShares(after)
+	change := sharesChange(beforeDefault, afterDefault)
+
+	beforeRules, afterRules := targetingShares(before), targetingShares(after)
+	for key, shares := range afterRules {
+		previous, ok := beforeRules[key]
+		if !ok {
+			previous = beforeDefault
+		}
+		change = math.Max(change, sharesChange(previous, shares))
+	}
+	for key, shares := range beforeRules {
+		if _, ok := afterRules[key]; !ok {
+			change = math.Max(change, sharesChange(shares, afterDefault))
+		}
+	}
+	return change
+}
+
+func genericStrings(values []string) []interface{} {
+	list := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		list = append(list, v)
+	}
+	return list
+}
+
+// policyInput describes a flag change to policies, as the attributes their
+// expressions read. environment is set for a change to the flag's config in
+// one environment; environments lists the environments a change applies to,
+// which for the project's config are those not configuring the flag
+// themselves. before is nil for a new flag.
+func (fm *FlagManager) policyInput(ctx context.Context, actor Actor, project, flagKey, environment string, before, after *FlagConfig) (map[string]interface{}, error) {
+	environments := []string{}
+	if environment != "" {
+		environments = append(environments, environment)
+	} else {
+		envs, _, err := fm.projectEnvironments(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range envs {
+			configs, err := fm.loadEnvironmentConfigs(ctx, project, env, false)
+			if err != nil {
+				return nil, err
+			}
+			if _, overridden := configs[flagKey]; !overridden {
+				environments = append(environments, env)
+			}
+		}
+	}
+
+	action := "update"
+	if before == nil {
+		action = "create"
+	}
+	status := after.Status
+	if status == "" {
+		status = flagStatusPublished
+	}
+	metadata, err := toGenericValue(after.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	return map[string]interface{}{
+		"action":             action,
+		"project":            project,
+		"flag":               flagKey,
+		"environment":        environment,
+		"environments":       genericStrings(environments),
+		"owners":             genericStrings(after.Owners),
+		"ownerCount":         len(after.Owners),
+		"tags":               genericStrings(after.Tags),
+		"trackEvents":        after.TrackEvents == nil || *after.TrackEvents,
+		"disabled":           flagDisabled(*after),
+		"experiment":         after.Experimentation != nil,
+		"variationCount":     len(after.Variations),
+		"targetingRuleCount": len(after.Targeting),
+		"percentageChange":   percentageChange(before, after),
+		"status":             status,
+		"expiresAt":          after.ExpiresAt,
+		"metadata":           metadata,
+		"actor":              map[string]interface{}{"id": actor.ID, "email": actor.Email, "type": actor.Type},
+	}, nil
+}
+
+// PolicyViolationResponse is the error body of a change violating policies.
+type PolicyViolationResponse struct {
+	APIError
+	Violations []PolicyViolation `json:"violations"`
+}
+
+// policyViolationError is returned by flag writes violating a policy with
+// severity error. Nothing is saved.
+type policyViolationError struct {
+	violations []PolicyViolation
+}
+
+func (e *policyViolationError) Error() string {
+	return "the change violates flag policies: " + strings.Join(policyViolationDetails(e.violations), "; ")
+}
+
+func policyViolationDetails(violations []PolicyViolation) []string {
+	details := make([]string, 0, len(violations))
+	for _, v := range violations {
+		detail := v.Policy + ": " + v.Message
+		if v.Flag != "" {
+			detail = v.Flag + ": " + detail
+		}
+		details = append(details, detail)
+	}
+	return details
+}
+
+// writePolicyViolations responds 422 with the violations of a change.
+func writePolicyViolations(w http.ResponseWriter, violations []PolicyViolation) {
+	message := "The change violates flag policies"
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(PolicyViolationResponse{
+		APIError:   APIError{Code: "POLICY_VIOLATION", Message: message, Details: policyViolationDetails(violations), Error: message},
+		Violations: violations,
+	})
+}
+
+// writePolicyViolationError responds 422 and returns true if err is, or
+// wraps, a *policyViolationError.
+func writePolicyViolationError(w http.ResponseWriter, err error) bool {
+	var violation *policyViolationError
+	if !errors.As(err, &violation) {
+		return false
+	}
+	writePolicyViolations(w, violation.violations)
+	return true
+}
+
+// flagChange is a change to a flag checked against the policies. before is
+// nil for a new flag.
+type flagChange struct {
+	key           string
+	before, after *FlagConfig
+}
+
+// enabledPolicies returns the policies flag changes are checked against.
+func (fm *FlagManager) enabledPolicies(ctx context.Context) ([]db.Policy, error) {
+	policies, err := fm.storage.ListPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(policies, func(p db.Policy) bool { return !p.Enabled }), nil
+}
+
+// checkFlagChanges evaluates the policies on changes to the flags of a
+// project, in one environment if environment is set, made by the actor of
+// ctx. It returns a *policyViolationError listing the violations of every
+// change if a policy with severity error is violated, and otherwise the
+// violated warnings.
+func (fm *FlagManager) checkFlagChanges(ctx context.Context, policies []db.Policy, project, environment string, changes []flagChange) ([]PolicyViolation, error) {
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	actor := actorFrom(ctx)
+	var violations []PolicyViolation
+	failed := false
+	for _, c := range changes {
+		input, err := fm.policyInput(ctx, actor, project, c.key, environment, c.before, c.after)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range evaluatePolicies(policies, input) {
+			v.Flag = c.key
+			failed = failed || v.Severity == "error"
+			violations = append(violations, v)
+		}
+	}
+	if failed {
+		sort.SliceStable(violations, func(i, j int) bool {
+			return violations[i].Severity == "error" && violations[j].Severity != "error"
+		})
+		return nil, &policyViolationError{violations: violations}
+	}
+	return violations, nil
+}
+
+// auditPolicyWarnings audits the warnings violated by saved flag changes.
+func (fm *FlagManager) auditPolicyWarnings(ctx context.Context, project, environment string, warnings []PolicyViolation) {
+	byFlag := map[string][]PolicyViolation{}
+	var keys []string
+	for _, v := range warnings {
+		if _, seen := byFlag[v.Flag]; !seen {
+			keys = append(keys, v.Flag)
+		}
+		byFlag[v.Flag] = append(byFlag[v.Flag], v)
+	}
+	for _, key := range keys {
+		metadata := map[string]interface{}{"violations": byFlag[key]}
+		if environment != "" {
+			metadata["environment"] = environment
+		}
+		fm.audit.Log(ctx, actorFrom(ctx), "flag.policy_warned", "flag", "", key, project, nil, metadata)
+	}
+}
+
+// checkFlagPolicies evaluates the policies on flag changes before they are
+// written, ahead of a change request or in a dry run, to report violations
+// early; the write itself is checked by the storage. When a policy with
+// severity error is violated it writes a 422 response listing the violations
+// and returns false.
+func (fm *FlagManager) checkFlagPolicies(w http.ResponseWriter, r *http.Request, project string, changes ...flagChange) bool {
+	policies, err := fm.enabledPolicies(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return false
+	}
+	_, err = fm.checkFlagChanges(r.Context(), policies, project, "", changes)
+	if writePolicyViolationError(w, err) {
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return false
+	}
+	return true
+}
+
+// currentFlagConfig returns a flag's config, in one environment if
+// environment is set, or nil if the flag does not exist.
+func (fm *FlagManager) currentFlagConfig(ctx context.Context, project, flagKey, environment string) (*FlagConfig, error) {
+	if environment != "" {
+		flags, _, err := fm.loadEnvironmentFlags(ctx, project, environment, false)
+		if err != nil {
+			return nil, err
+		}
+		if config, ok := flags[flagKey]; ok {
+			return &config, nil
+		}
+		return nil, nil
+	}
+	flag, err := fm.storage.GetFlag(ctx, project, flagKey)
+	if errors.Is(err, errFlagNotFound) || errors.Is(err, errProjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flag.Config, nil
+}
+
+// PoliciesResponse lists the policies.
+type PoliciesResponse struct {
+	Policies []db.Policy `json:"policies"`
+	Total    int         `json:"total"`
+}
+
+func (fm *FlagManager) listPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	policies, err := fm.storage.ListPolicies(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PoliciesResponse{Policies: policies, Total: len(policies)})
+}
+
+func (fm *FlagManager) getPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	p, err := fm.storage.GetPolicy(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// decodePolicy reads and validates a policy. It writes the error response and
+// returns false when the policy is invalid.
+func decodePolicy(w http.ResponseWriter, body []byte) (db.Policy, bool) {
+	p := db.Policy{Enabled: true, Severity: "error"}
+	if err := json.Unmarshal(body, &p); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return p, false
+	}
+	p.Name = strings.TrimSpace(p.Name)
+	if errs := validatePolicy(p); len(errs) > 0 {
+		writeValidationError(w, "INVALID_POLICY", "Policy is invalid", errs...)
+		return p, false
+	}
+	return p, true
+}
+
+func (fm *FlagManager) createPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	p, ok := decodePolicy(w, body)
+	if !ok {
+		return
+	}
+
+	created, err := fm.storage.CreatePolicy(r.Context(), p)
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "policy.created", "policy", created.ID, created.Name, "",
+		map[string]interface{}{"after": created}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (fm *FlagManager) updatePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	before, err := fm.storage.GetPolicy(r.Context(), id)
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	var body json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	p, ok := decodePolicy(w, body)
+	if !ok {
+		return
+	}
+	updated, err := fm.storage.UpdatePolicy(r.Context(), id, p)
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "policy.updated", "policy", updated.ID, updated.Name, "",
+		map[string]interface{}{"before": before, "after": updated}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (fm *FlagManager) deletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	existing, err := fm.storage.GetPolicy(r.Context(), id)
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	if err := fm.storage.DeletePolicy(r.Context(), id); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "policy.deleted", "policy", id, existing.Name, "",
+		map[string]interface{}{"before": existing}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PolicyValidationResponse is the outcome of checking a flag change against
+// policies without saving it, with the attributes the policies saw.
+type PolicyValidationResponse struct {
+	Allowed    bool                   `json:"allowed"`
+	Violations []PolicyViolation      `json:"violations"`
+	Input      map[string]interface{} `json:"input"`
+}
+
+// validatePoliciesHandler checks a flag change, given by its project, flag key,
+// optional environment and new config, against the policies without saving
+// it. The change is compared with the flag as currently stored. A draft policy
+// given as policy is checked instead of the stored ones, to try it out before
+// saving it.
+func (fm *FlagManager) validatePoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Project     string          `json:"project"`
+		FlagKey     string          `json:"flagKey"`
+		Environment string          `json:"environment,omitempty"`
+		Config      FlagConfig      `json:"config"`
+		Policy      json.RawMessage `json:"policy,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if err := ValidateProjectName(body.Project); err != nil {
+		writeValidationError(w, "INVALID_PROJECT_NAME", err.Error())
+		return
+	}
+	if err := ValidateFlagKey(body.FlagKey); err != nil {
+		writeValidationError(w, "INVALID_FLAG_KEY", err.Error())
+		return
+	}
+
+	var policies []db.Policy
+	if len(body.Policy) > 0 {
+		p, ok := decodePolicy(w, body.Policy)
+		if !ok {
+			return
+		}
+		p.Enabled = true
+		policies = []db.Policy{p}
+	} else {
+		var err error
+		if policies, err = fm.storage.ListPolicies(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	}
+
+	before, err := fm.currentFlagConfig(r.Context(), body.Project, body.FlagKey, body.Environment)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	input, err := fm.policyInput(r.Context(), GetActor(r), body.Project, body.FlagKey, body.Environment, before, &body.Config)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	violations := evaluatePolicies(policies, input)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PolicyValidationResponse{
+		Allowed:    len(violations) == 0 || violations[0].Severity != "error",
+		Violations: violations,
+		Input:      input,
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestPolicies(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, changes: NewChangeFeed()}
+	dbFM.storage = newPolicyStorage(dbFM, &dbStorage{store: store})
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			// Expressions must compile against the policy attributes to a bool
+			doRequest(t, router, "POST", "/api/policies", `{"name":"bad","rule":"ownerCount >"}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/policies", `{"name":"bad","rule":"ownerCount gt 0"}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/policies", `{"name":"bad","rule":"owner_count > 0"}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/policies", `{"name":"bad","rule":"ownerCount + 1"}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/policies", `{"name":"bad","rule":"ownerCount > 0","severity":"fatal"}`, http.StatusBadRequest, nil)
+
+			var owner, jump, tracking db.Policy
+			doRequest(t, router, "POST", "/api/policies", `{"name":"prod-owner","condition":"\"production\" in environments","rule":"ownerCount > 0","message":"Production flags must have an owner"}`, http.StatusCreated, &owner)
+			doRequest(t, router, "POST", "/api/policies", `{"name":"prod-owner","rule":"ownerCount > 0"}`, http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/policies", `{"name":"rollout-jump","rule":"percentageChange <= 25"}`, http.StatusCreated, &jump)
+			doRequest(t, router, "POST", "/api/policies", `{"name":"experiment-tracking","severity":"warning","condition":"experiment","rule":"trackEvents"}`, http.StatusCreated, &tracking)
+			if !owner.Enabled || owner.Severity != "error" {
+				t.Errorf("Expected an enabled error policy by default, got %+v", owner)
+			}
+
+			doRequest(t, router, "POST", "/api/projects/web", "", http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/environments/production", "", http.StatusCreated, nil)
+
+			var violation PolicyViolationResponse
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}`, http.StatusUnprocessableEntity, &violation)
+			if violation.Code != "POLICY_VIOLATION" || len(violation.Violations) != 1 || violation.Violations[0].PolicyID != owner.ID {
+				t.Fatalf("Expected the owner policy to be violated, got %+v", violation)
+			}
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"owners":["@acme/web"]}`, http.StatusCreated, nil)
+
+			// Rollouts may move 25 points at a time
+			doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"percentage":{"on":50,"off":50}},"owners":["@acme/web"]}}`, http.StatusUnprocessableEntity, nil)
+			doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"percentage":{"on":20,"off":80}},"owners":["@acme/web"]}}`, http.StatusOK, nil)
+
+			// Targeting rules count too: their users were served the default rule
+			doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"targeting":[{"name":"beta","query":"beta eq true","variation":"on"}],"defaultRule":{"percentage":{"on":20,"off":80}},"owners":["@acme/web"]}}`, http.StatusUnprocessableEntity, nil)
+			doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"targeting":[{"name":"beta","query":"beta eq true","percentage":{"on":40,"off":60}}],"defaultRule":{"percentage":{"on":20,"off":80}},"owners":["@acme/web"]}}`, http.StatusOK, nil)
+			doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"targeting":[{"name":"beta","query":"beta eq true","variation":"on"}],"defaultRule":{"percentage":{"on":20,"off":80}},"owners":["@acme/web"]}}`, http.StatusUnprocessableEntity, nil)
+
+			// Environment configs are checked as changes in that environment
+			doRequest(t, router, "PUT", "/api/projects/web/environments/production/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"percentage":{"on":20,"off":80}}}}`, http.StatusUnprocessableEntity, nil)
+			// and so are promotions, against what the target environment served
+			doRequest(t, router, "POST", "/api/projects/web/environments/staging", "", http.StatusCreated, nil)
+			doRequest(t, router, "PUT", "/api/projects/web/environments/staging/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"percentage":{"on":40,"off":60}},"owners":["@acme/web"]}}`, http.StatusOK, nil)
+			doRequest(t, router, "PUT", "/api/projects/web/environments/staging/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"percentage":{"on":60,"off":40}},"owners":["@acme/web"]}}`, http.StatusOK, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout/promote?from=staging&to=production", "", http.StatusUnprocessableEntity, nil)
+
+			// Warnings let the change through
+			doRequest(t, router, "POST", "/api/projects/web/flags/experiment", `{"variations":{"a":"a","b":"b"},"defaultRule":{"variation":"a"},"owners":["@acme/web"],"trackEvents":false,"experimentation":{"start":"2026-01-01T00:00:00Z","end":"2026-02-01T00:00:00Z"}}`, http.StatusCreated, nil)
+
+			// Imports and bulk edits are checked by the storage like any write;
+			// a file import violating a policy applies none of its flags
+			imported := `{"owned":{"variations":{"on":true},"defaultRule":{"variation":"on"},"owners":["@acme/web"]},"unowned":{"variations":{"on":true},"defaultRule":{"variation":"on"}}}`
+			doRequest(t, router, "POST", "/api/projects/web/import?format=json", imported, http.StatusUnprocessableEntity, &violation)
+			if len(violation.Violations) != 1 || violation.Violations[0].Flag != "unowned" {
+				t.Errorf("Expected the unowned flag to violate the owner policy, got %+v", violation)
+			}
+			doRequest(t, router, "GET", "/api/projects/web/flags/owned", "", http.StatusNotFound, nil)
+			var manifest ManifestImportResponse
+			doRequest(t, router, "POST", "/api/flags/import", `{"project":"web","flags":[{"key":"discovered","type":"boolean"}]}`, http.StatusOK, &manifest)
+			if manifest.Created != 0 || len(manifest.Errors) != 1 || !strings.Contains(manifest.Errors[0], "prod-owner") {
+				t.Errorf("Expected the manifest flag to be rejected, got %+v", manifest)
+			}
+			doRequest(t, router, "PUT", "/api/projects/web/flags/checkout/ramp", `{"variation":"on","baseline":"off","steps":[60,100],"interval":"1d"}`, http.StatusUnprocessableEntity, nil)
+
+			// A dry run reports violations and the attributes policies see
+			var validation PolicyValidationResponse
+			doRequest(t, router, "POST", "/api/policies/validate", `{"project":"web","flagKey":"checkout","config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusOK, &validation)
+			if validation.Allowed || len(validation.Violations) != 2 || validation.Input["percentageChange"] != 80.0 || validation.Input["action"] != "update" {
+				t.Errorf("Expected the owner and rollout policies violated, got %+v", validation)
+			}
+			doRequest(t, router, "POST", "/api/policies/validate", `{"project":"web","flagKey":"new-flag","config":{"variations":{"on":true}},"policy":{"name":"draft","rule":"flag.startsWith(\"web-\")"}}`, http.StatusOK, &validation)
+			if validation.Allowed || len(validation.Violations) != 1 || validation.Violations[0].Policy != "draft" {
+				t.Errorf("Expected only the draft policy to be checked, got %+v", validation)
+			}
+
+			// A policy failing to evaluate is violated
+			doRequest(t, router, "POST", "/api/policies/validate", `{"project":"web","flagKey":"new-flag","config":{"variations":{"on":true}},"policy":{"name":"team","rule":"metadata.team == \"web\""}}`, http.StatusOK, &validation)
+			if validation.Allowed || len(validation.Violations) != 1 || !strings.Contains(validation.Violations[0].Message, "could not be evaluated") {
+				t.Errorf("Expected the unevaluable policy to be violated, got %+v", validation)
+			}
+			doRequest(t, router, "POST", "/api/policies/validate", `{"project":"web","flagKey":"new-flag","config":{"variations":{"on":true},"metadata":{"team":"web"}},"policy":{"name":"team","rule":"metadata.team == \"web\""}}`, http.StatusOK, &validation)
+			if !validation.Allowed {
+				t.Errorf("Expected the policy to pass with the metadata key, got %+v", validation)
+			}
+
+			var list PoliciesResponse
+			doRequest(t, router, "GET", "/api/policies", "", http.StatusOK, &list)
+			if list.Total != 3 || list.Policies[0].Name != "experiment-tracking" {
+				t.Errorf("Expected 3 policies by name, got %+v", list)
+			}
+
+			// Disabled policies are not checked
+			doRequest(t, router, "PUT", "/api/policies/"+owner.ID, `{"name":"prod-owner","enabled":false,"condition":"\"production\" in environments","rule":"ownerCount > 0"}`, http.StatusOK, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/banner", `{"variations":{"on":true},"defaultRule":{"variation":"on"}}`, http.StatusCreated, nil)
+
+			doRequest(t, router, "DELETE", "/api/policies/"+jump.ID, "", http.StatusNoContent, nil)
+			doRequest(t, router, "GET", "/api/policies/"+jump.ID, "", http.StatusNotFound, nil)
+			doRequest(t, router, "DELETE", "/api/policies/"+tracking.ID, "", http.StatusNoContent, nil)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// policyStorage checks every flag write of the Storage it wraps against the
+// policies, environment configs included, so that no handler, import or
+// background job can skip them. A
+// write violating a policy with severity error saves nothing and returns a
+// *policyViolationError; violated warnings are audited once it is saved.
+type policyStorage struct {
+	Storage
+	fm *FlagManager
+}
+
+// newPolicyStorage wraps storage with the policy checks of fm.
+func newPolicyStorage(fm *FlagManager, storage Storage) Storage {
+	return &policyStorage{Storage: storage, fm: fm}
+}
+
+func (s *policyStorage) CreateFlag(ctx context.Context, project, key string, config FlagConfig) (*StoredFlag, error) {
+	warnings, err := s.check(ctx, project, "", func() ([]flagChange, error) {
+		return []flagChange{{key: key, after: &config}}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	flag, err := s.Storage.CreateFlag(ctx, project, key, config)
+	if err == nil {
+		s.fm.auditPolicyWarnings(ctx, project, "", warnings)
+	}
+	return flag, err
+}
+
+func (s *policyStorage) UpdateFlag(ctx context.Context, project, key, newKey string, config FlagConfig) (*StoredFlag, *StoredFlag, error) {
+	target := key
+	if newKey != "" {
+		target = newKey
+	}
+	warnings, err := s.check(ctx, project, "", func() ([]flagChange, error) {
+		existing, err := s.Storage.GetFlag(ctx, project, key)
+		if err != nil {
+			return nil, err
+		}
+		return []flagChange{{key: target, before: &existing.Config, after: &config}}, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	before, after, err := s.Storage.UpdateFlag(ctx, project, key, newKey, config)
+	if err == nil {
+		s.fm.auditPolicyWarnings(ctx, project, "", warnings)
+	}
+	return before, after, err
+}
+
+func (s *policyStorage) SaveFlags(ctx context.Context, project string, flags ProjectFlags, changed []string) (map[string]string, error) {
+	warnings, err := s.check(ctx, project, "", func() ([]flagChange, error) {
+		stored, err := s.Storage.ListFlags(ctx, project)
+		if err != nil && !errors.Is(err, errProjectNotFound) {
+			return nil, err
+		}
+		changes := make([]flagChange, 0, len(changed))
+		for _, key := range changed {
+			after, ok := flags[key]
+			if !ok {
+				continue
+			}
+			change := flagChange{key: key, after: &after}
+			if before, ok := stored[key]; ok {
+				change.before = &before
+			}
+			changes = append(changes, change)
+		}
+		return changes, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.Storage.SaveFlags(ctx, project, flags, changed)
+	if err == nil {
+		s.fm.auditPolicyWarnings(ctx, project, "", warnings)
+	}
+	return ids, err
+}
+
+// SetEnvironmentFlag checks the config against the one the environment
+// served before: its own config, or else the project's.
+func (s *policyStorage) SetEnvironmentFlag(ctx context.Context, project, env, key string, config FlagConfig) (string, *FlagConfig, error) {
+	warnings, err := s.check(ctx, project, env, func() ([]flagChange, error) {
+		configs, err := s.Storage.ListEnvironmentFlags(ctx, project, env)
+		if err != nil {
+			return nil, err
+		}
+		if before, ok := configs[key]; ok {
+			return []flagChange{{key: key, before: &before, after: &config}}, nil
+		}
+		existing, err := s.Storage.GetFlag(ctx, project, key)
+		if errors.Is(err, errFlagNotFound) || errors.Is(err, errProjectNotFound) {
+			// Nothing is written: the flag does not exist
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []flagChange{{key: key, before: &existing.Config, after: &config}}, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	id, before, err := s.Storage.SetEnvironmentFlag(ctx, project, env, key, config)
+	if err == nil {
+		s.fm.auditPolicyWarnings(ctx, project, env, warnings)
+	}
+	return id, before, err
+}
+
+// check evaluates the enabled policies on the changes a write makes, which
+// are only loaded when there are policies to check.
+func (s *policyStorage) check(ctx context.Context, project, env string, changes func() ([]flagChange, error)) ([]PolicyViolation, error) {
+	policies, err := s.fm.enabledPolicies(ctx)
+	if err != nil || len(policies) == 0 {
+		return nil, err
+	}
+	list, err := changes()
+	if err != nil {
+		return nil, err
+	}
+	return s.fm.checkFlagChanges(ctx, policies, project, env, list)
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// A project's environments (dev, staging, prod, ...) are listed in its meta.
+// Each environment serves the project's flags, except for flags given their
+// own config in that environment. Environment configs are stored in the
+// environment_flags table, or in file mode in one file per project and
+// environment under FLAGS_DIR/environments/{project}/{environment}.yaml.
+
+// getEnvironmentFilePath returns the file holding a project's flag configs in
+// one environment.
+func (fm *FlagManager) getEnvironmentFilePath(project, env string) string {
+	return filepath.Join(fm.config.FlagsDir, "environments", project, env+".yaml")
+}
+
+// projectFlagFilePaths returns a project's flag file followed by the flag files
+// of its environments, so that all of them can be locked together.
+func (fm *FlagManager) projectFlagFilePaths(project string) []string {
+	paths := []string{fm.getProjectFilePath(project)}
+	if fm.projectMeta != nil {
+		for _, env := range fm.projectMeta.Get(project).Environments {
+			paths = append(paths, fm.getEnvironmentFilePath(project, env))
+		}
+	}
+	return paths
+}
+
+// readEnvironmentFlags reads a project's flag configs in one environment. A
+// missing file holds no configs.
+func (fm *FlagManager) readEnvironmentFlags(project, env string) (ProjectFlags, error) {
+	fileMu.RLock()
+	defer fileMu.RUnlock()
+
+	data, err := os.ReadFile(fm.getEnvironmentFilePath(project, env))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return make(ProjectFlags), nil
+		}
+		return nil, err
+	}
+
+	var flags ProjectFlags
+	if err := yaml.Unmarshal(data, &flags); err != nil {
+		return nil, err
+	}
+	if flags == nil {
+		flags = make(ProjectFlags)
+	}
+	return flags, nil
+}
+
+// writeEnvironmentFlags writes a project's flag configs in one environment,
+// removing the file once it holds none.
+func (fm *FlagManager) writeEnvironmentFlags(project, env string, flags ProjectFlags) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	filePath := fm.getEnvironmentFilePath(project, env)
+	if len(flags) == 0 {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := yaml.Marshal(flags)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filePath, data, 0644)
+}
+
+// moveEnvironmentFlagConfigs renames a flag's configs in every environment of
+// a file-based project, or drops them when newKey is empty. The caller must
+// hold the locks of projectFlagFilePaths.
+func (fm *FlagManager) moveEnvironmentFlagConfigs(project, oldKey, newKey string) error {
+	if fm.projectMeta == nil {
+		return nil
+	}
+	for _, env := range fm.projectMeta.Get(project).Environments {
+		flags, err := fm.readEnvironmentFlags(project, env)
+		if err != nil {
+			return err
+		}
+		config, ok := flags[oldKey]
+		if !ok {
+			continue
+		}
+		delete(flags, oldKey)
+		if newKey != "" {
+			flags[newKey] = config
+		}
+		if err := fm.writeEnvironmentFlags(project, env, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasEnvironment(envs []string, env string) bool {
+	for _, e := range envs {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// loadEnvironmentConfigs returns a project's flag configs in one environment.
+func (fm *FlagManager) loadEnvironmentConfigs(ctx context.Context, project, env string, expandSegments bool) (ProjectFlags, error) {
+	configs, err := fm.storage.ListEnvironmentFlags(ctx, project, env)
+	if err != nil || !expandSegments {
+		return configs, err
+	}
+	return fm.expandProjectSegments(ctx, configs)
+}
+
+// loadEnvironmentFlags returns the flags a project serves in one environment:
+// its flags with the environment's configs applied, and the sorted keys of the
+// flags configured in the environment. flags is nil if the project does not
+// exist. When served is set, flags are returned as served to the relay proxy,
+// with segments expanded and without drafts.
+func (fm *FlagManager) loadEnvironmentFlags(ctx context.Context, project, env string, served bool) (flags ProjectFlags, overridden []string, err error) {
+	if served {
+		flags, err = fm.loadServedProjectFlags(ctx, project)
+	} else {
+		flags, err = fm.loadProjectFlagsExpanded(ctx, project, false)
+	}
+	if err != nil || flags == nil {
+		return nil, nil, err
+	}
+
+	configs, err := fm.loadEnvironmentConfigs(ctx, project, env, served)
+	if err != nil {
+		return nil, nil, err
+	}
+	overridden = []string{}
+	for key, config := range configs {
+		if _, ok := flags[key]; !ok {
+			continue
+		}
+		flags[key] = config
+		overridden = append(overridden, key)
+	}
+	sort.Strings(overridden)
+	return flags, overridden, nil
+}
+
+// rawEnvironmentFlags returns the flags of the given projects as served in env,
+// keyed like /api/flags/raw when prefix is set. Projects without env serve
+// their own flags; writeRawFlags still resolves their environmentOverrides.
+func (fm *FlagManager) rawEnvironmentFlags(ctx context.Context, projects []string, env string, prefix bool) (map[string]FlagConfig, error) {
+	all := make(map[string]FlagConfig)
+	for _, project := range projects {
+		envs, _, err := fm.projectEnvironments(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+
+		var flags ProjectFlags
+		if hasEnvironment(envs, env) {
+			flags, _, err = fm.loadEnvironmentFlags(ctx, project, env, true)
+		} else {
+			flags, err = fm.loadServedProjectFlags(ctx, project)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for key, config := range flags {
+			if prefix {
+				key = project + "/" + key
+			}
+			all[key] = config
+		}
+	}
+	return all, nil
+}
+
+// projectEnvironments returns the environments of a project. ok is false if
+// the project does not exist.
+func (fm *FlagManager) projectEnvironments(ctx context.Context, project string) (envs []string, ok bool, err error) {
+	meta, ok, err := fm.getProjectMeta(ctx, project)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	return meta.Environments, true, nil
+}
+
+// requireProjectEnvironment writes an error and returns false unless env is
+// one of the project's environments.
+func (fm *FlagManager) requireProjectEnvironment(w http.ResponseWriter, r *http.Request, project, env string) bool {
+	envs, ok, err := fm.projectEnvironments(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return false
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return false
+	}
+	if !hasEnvironment(envs, env) {
+		writeError(w, http.StatusNotFound, "ENVIRONMENT_NOT_FOUND", fmt.Sprintf("Environment not found: %s", env))
+		return false
+	}
+	return true
+}
+
+// EnvironmentsResponse lists the environments of a project.
+type EnvironmentsResponse struct {
+	Environments []string `json:"environments"`
+}
+
+func (fm *FlagManager) listProjectEnvironmentsHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	envs, ok, err := fm.projectEnvironments(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	if envs == nil {
+		envs = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EnvironmentsResponse{Environments: envs})
+}
+
+// createProjectEnvironmentHandler adds an environment to a project. It starts
+// out serving the project's flags unchanged.
+func (fm *FlagManager) createProjectEnvironmentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	env := vars["environment"]
+
+	if err := ValidateEnvironmentName(env); err != nil {
+		writeValidationError(w, "INVALID_ENVIRONMENT", err.Error())
+		return
+	}
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	if hasEnvironment(meta.Environments, env) {
+		writeError(w, http.StatusConflict, "ENVIRONMENT_EXISTS", "Environment already exists")
+		return
+	}
+
+	meta.Environments = append(meta.Environments, env)
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "project.environment_created", "project", "", project, project,
+		nil, map[string]interface{}{"environment": env})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(EnvironmentsResponse{Environments: meta.Environments})
+}
+
+// deleteProjectEnvironmentHandler removes an environment and its flag configs
+// from a project.
+func (fm *FlagManager) deleteProjectEnvironmentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	env := vars["environment"]
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	if !hasEnvironment(meta.Environments, env) {
+		writeError(w, http.StatusNotFound, "ENVIRONMENT_NOT_FOUND", fmt.Sprintf("Environment not found: %s", env))
+		return
+	}
+
+	if err := fm.storage.DeleteEnvironmentFlags(r.Context(), project, env); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	remaining := make([]string, 0, len(meta.Environments))
+	for _, e := range meta.Environments {
+		if e != env {
+			remaining = append(remaining, e)
+		}
+	}
+	meta.Environments = remaining
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "project.environment_deleted", "project", "", project, project,
+		nil, map[string]interface{}{"environment": env})
+
+	fm.scheduleRelayRefresh(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EnvironmentFlagsResponse is the flags a project serves in one environment.
+// Overridden lists the flags with their own config in the environment.
+type EnvironmentFlagsResponse struct {
+	Project     string       `json:"project"`
+	Environment string       `json:"environment"`
+	Flags       ProjectFlags `json:"flags"`
+	Overridden  []string     `json:"overridden"`
+}
+
+// listEnvironmentFlagsHandler returns the flags a project serves in one
+// environment and which of them are configured there.
+func (fm *FlagManager) listEnvironmentFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	env := vars["environment"]
+
+	if !fm.requireProjectEnvironment(w, r, project, env) {
+		return
+	}
+
+	flags, overridden, err := fm.loadEnvironmentFlags(r.Context(), project, env, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if flags == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EnvironmentFlagsResponse{
+		Project:     project,
+		Environment: env,
+		Flags:       flags,
+		Overridden:  overridden,
+	})
+}
+
+// EnvironmentFlagResponse is a flag's config in one environment.
+type EnvironmentFlagResponse struct {
+	Key         string     `json:"key"`
+	Environment string     `json:"environment"`
+	Config      FlagConfig `json:"config"`
+}
+
+// updateEnvironmentFlagHandler sets a flag's config in one environment.
+func (fm *FlagManager) updateEnvironmentFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	env := vars["environment"]
+	flagKey := vars["flagKey"]
+
+	var requestBody struct {
+		Config FlagConfig `json:"config"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	config := requestBody.Config
+	if errs := ValidateFlagConfig(config); len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid", errs...)
+		return
+	}
+	config.resolveRelativeSchedule(time.Now())
+
+	if !fm.requireProjectEnvironment(w, r, project, env) {
+		return
+	}
+
+	flagID, before, err := fm.storage.SetEnvironmentFlag(r.Context(), project, env, flagKey, config)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	changes := map[string]interface{}{"after": config}
+	if before != nil {
+		changes["before"] = *before
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "flag.environment_updated", "flag", flagID, flagKey, project,
+		changes, map[string]interface{}{"environment": env})
+
+	fm.scheduleRelayRefresh(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EnvironmentFlagResponse{
+		Key:         flagKey,
+		Environment: env,
+		Config:      config,
+	})
+}
+
+// deleteEnvironmentFlagHandler removes a flag's config in one environment, so
+// the environment serves the project's config again.
+func (fm *FlagManager) deleteEnvironmentFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	env := vars["environment"]
+	flagKey := vars["flagKey"]
+
+	if !fm.requireProjectEnvironment(w, r, project, env) {
+		return
+	}
+
+	before, err := fm.storage.DeleteEnvironmentFlag(r.Context(), project, env, flagKey)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "flag.environment_reset", "flag", "", flagKey, project,
+		map[string]interface{}{"before": *before}, map[string]interface{}{"environment": env})
+
+	fm.scheduleRelayRefresh(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PromoteFlagResponse is a flag config promoted from one environment to
+// another.
+type PromoteFlagResponse struct {
+	Key    string     `json:"key"`
+	From   string     `json:"from"`
+	To     string     `json:"to"`
+	Config FlagConfig `json:"config"`
+}
+
+// promoteFlagHandler copies the config a flag has in one environment to
+// another, e.g. ?from=staging&to=prod.
+func (fm *FlagManager) promoteFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+
+	if from == "" || to == "" {
+		writeValidationError(w, "INVALID_PROMOTION", "from and to environments are required")
+		return
+	}
+	if from == to {
+		writeValidationError(w, "INVALID_PROMOTION", "from and to must be different environments")
+		return
+	}
+	if !fm.requireProjectEnvironment(w, r, project, from) || !fm.requireProjectEnvironment(w, r, project, to) {
+		return
+	}
+
+	flags, _, err := fm.loadEnvironmentFlags(r.Context(), project, from, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	config, ok := flags[flagKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
+		return
+	}
+
+	flagID, before, err := fm.storage.SetEnvironmentFlag(r.Context(), project, to, flagKey, config)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	changes := map[string]interface{}{"after": config}
+	if before != nil {
+		changes["before"] = *before
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "flag.promoted", "flag", flagID, flagKey, project,
+		changes, map[string]interface{}{"from": from, "to": to})
+
+	fm.scheduleRelayRefresh(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PromoteFlagResponse{
+		Key:    flagKey,
+		From:   from,
+		To:     to,
+		Config: config,
+	})
+}
+
+// writeRawEnvironmentFlags serves the flags of the given projects in env as a
+// flags file for the relay proxy.
+func (fm *FlagManager) writeRawEnvironmentFlags(w http.ResponseWriter, r *http.Request, projects []string, env string, prefix bool) {
+	flags, err := fm.rawEnvironmentFlags(r.Context(), projects, env, prefix)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	fm.writeRawFlags(w, r, flags, env)
+}
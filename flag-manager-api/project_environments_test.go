@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestProjectEnvironments(t *testing.T) {
+	fm, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	doRequest(t, router, "POST", "/api/projects/env-tests", "", http.StatusCreated, nil)
+	banner := `{"variations":{"on":"new","off":"old"},"environmentOverrides":{"on":{"prod":"new-prod"}},"defaultRule":{"variation":"off"},"tags":["homepage"],"expiresAt":"2099-01-01T00:00:00Z"}`
+	doRequest(t, router, "POST", "/api/projects/env-tests/flags/banner", banner, http.StatusCreated, nil)
+
+	for _, env := range []string{"staging", "prod"} {
+		doRequest(t, router, "POST", "/api/projects/env-tests/environments/"+env, "", http.StatusCreated, nil)
+	}
+	doRequest(t, router, "POST", "/api/projects/env-tests/environments/prod", "", http.StatusConflict, nil)
+	doRequest(t, router, "POST", "/api/projects/env-tests/environments/pro.d", "", http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/projects/missing/environments/prod", "", http.StatusNotFound, nil)
+
+	var list struct {
+		Environments []string `json:"environments"`
+	}
+	doRequest(t, router, "GET", "/api/projects/env-tests/environments", "", http.StatusOK, &list)
+	if !reflect.DeepEqual(list.Environments, []string{"staging", "prod"}) {
+		t.Errorf("Expected [staging prod], got %v", list.Environments)
+	}
+
+	staged := `{"config":{"variations":{"on":"new","off":"old"},"environmentOverrides":{"on":{"prod":"new-prod"}},"defaultRule":{"variation":"on"}}}`
+	doRequest(t, router, "PUT", "/api/projects/env-tests/environments/staging/flags/banner", staged, http.StatusOK, nil)
+	doRequest(t, router, "PUT", "/api/projects/env-tests/environments/staging/flags/missing", staged, http.StatusNotFound, nil)
+	doRequest(t, router, "PUT", "/api/projects/env-tests/environments/qa/flags/banner", staged, http.StatusNotFound, nil)
+	if _, err := os.Stat(filepath.Join(tempDir, "environments", "env-tests", "staging.yaml")); err != nil {
+		t.Errorf("Expected staging config file: %v", err)
+	}
+
+	envFlags := func(env string) (ProjectFlags, []string) {
+		t.Helper()
+		var response struct {
+			Flags      ProjectFlags `json:"flags"`
+			Overridden []string     `json:"overridden"`
+		}
+		doRequest(t, router, "GET", "/api/projects/env-tests/environments/"+env+"/flags", "", http.StatusOK, &response)
+		return response.Flags, response.Overridden
+	}
+	flags, overridden := envFlags("staging")
+	if flags["banner"].DefaultRule.Variation != "on" || !reflect.DeepEqual(overridden, []string{"banner"}) {
+		t.Errorf("Expected staging to serve on, got %+v (%v)", flags["banner"].DefaultRule, overridden)
+	}
+	flags, overridden = envFlags("prod")
+	if flags["banner"].DefaultRule.Variation != "off" || len(overridden) != 0 {
+		t.Errorf("Expected prod to serve the project config, got %+v (%v)", flags["banner"].DefaultRule, overridden)
+	}
+
+	doRequest(t, router, "POST", "/api/projects/env-tests/flags/banner/promote?from=staging", "", http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/projects/env-tests/flags/banner/promote?from=staging&to=qa", "", http.StatusNotFound, nil)
+	doRequest(t, router, "POST", "/api/projects/env-tests/flags/banner/promote?from=staging&to=prod", "", http.StatusOK, nil)
+	if flags, _ := envFlags("prod"); flags["banner"].DefaultRule.Variation != "on" {
+		t.Errorf("Expected prod to serve on after promotion, got %+v", flags["banner"].DefaultRule)
+	}
+
+	raw := func(path string) map[string]map[string]interface{} {
+		t.Helper()
+		rr := doRequest(t, router, "GET", path, "", http.StatusOK, nil)
+		var flags map[string]map[string]interface{}
+		if err := yaml.Unmarshal(rr.Body.Bytes(), &flags); err != nil {
+			t.Fatalf("Invalid YAML: %v", err)
+		}
+		return flags
+	}
+	prodFlags := raw("/api/flags/raw/env-tests?environment=prod")
+	variations, _ := prodFlags["banner"]["variations"].(map[string]interface{})
+	if variations["on"] != "new-prod" {
+		t.Errorf("Expected prod override value, got %v", variations)
+	}
+	if _, ok := prodFlags["banner"]["environmentOverrides"]; ok {
+		t.Error("Expected environmentOverrides to be resolved away")
+	}
+	if _, ok := raw("/api/flags/raw?environment=prod")["env-tests/banner"]; !ok {
+		t.Error("Expected prefixed key in all-projects raw flags")
+	}
+	// Without an environment the overrides and other manager-only fields are
+	// stripped, and variations keep their default values
+	for path, key := range map[string]string{"/api/flags/raw/env-tests": "banner", "/api/flags/raw": "env-tests/banner"} {
+		served := raw(path)[key]
+		for _, field := range []string{"environmentOverrides", "tags", "expiresAt"} {
+			if _, ok := served[field]; ok {
+				t.Errorf("Expected %s stripped from %s, got %v", field, path, served)
+			}
+		}
+		if variations, _ := served["variations"].(map[string]interface{}); variations["on"] != "new" {
+			t.Errorf("Expected default variation value from %s, got %v", path, variations)
+		}
+	}
+	doRequest(t, router, "GET", "/api/flags/raw/env-tests?environment=qa", "", http.StatusNotFound, nil)
+
+	// Renaming and deleting a flag carries its environment configs along
+	doRequest(t, router, "PUT", "/api/projects/env-tests/flags/banner", `{"config":`+banner+`,"newKey":"hero"}`, http.StatusOK, nil)
+	if flags, overridden := envFlags("staging"); flags["hero"].DefaultRule.Variation != "on" || !reflect.DeepEqual(overridden, []string{"hero"}) {
+		t.Errorf("Expected staging config to follow the rename, got %v", overridden)
+	}
+	doRequest(t, router, "DELETE", "/api/projects/env-tests/environments/staging/flags/hero", "", http.StatusNoContent, nil)
+	if _, err := os.Stat(filepath.Join(tempDir, "environments", "env-tests", "staging.yaml")); !os.IsNotExist(err) {
+		t.Error("Expected empty staging config file to be removed")
+	}
+	doRequest(t, router, "DELETE", "/api/projects/env-tests/flags/hero", "", http.StatusNoContent, nil)
+	if _, overridden := envFlags("prod"); len(overridden) != 1 {
+		t.Errorf("Expected prod config kept while the flag is archived, got %v", overridden)
+	}
+	doRequest(t, router, "DELETE", "/api/projects/env-tests/flags/hero", "", http.StatusNoContent, nil)
+	if _, overridden := envFlags("prod"); len(overridden) != 0 {
+		t.Errorf("Expected prod config removed with the flag, got %v", overridden)
+	}
+
+	doRequest(t, router, "DELETE", "/api/projects/env-tests/environments/prod", "", http.StatusNoContent, nil)
+	doRequest(t, router, "GET", "/api/projects/env-tests/environments", "", http.StatusOK, &list)
+	if !reflect.DeepEqual(list.Environments, []string{"staging"}) {
+		t.Errorf("Expected [staging], got %v", list.Environments)
+	}
+}
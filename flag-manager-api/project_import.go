@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// Project import modes: merge keeps flags missing from the imported file,
+// replace deletes them.
+const (
+	importModeMerge   = "merge"
+	importModeReplace = "replace"
+)
+
+// ProjectImportResult is the outcome of importing a flags file into a project.
+type ProjectImportResult struct {
+	Project string         `json:"project"`
+	Format  string         `json:"format"`
+	Mode    string         `json:"mode"`
+	DryRun  bool           `json:"dryRun"`
+	Applied bool           `json:"applied"`
+	Summary map[string]int `json:"summary"`
+	Flags   []SyncedFlag   `json:"flags"`
+}
+
+// exportProjectHandler returns all flags of a project as a flags file
+// (?format=yaml, json or toml; yaml by default) that can be loaded by the relay
+// proxy or imported into another instance.
+func (fm *FlagManager) exportProjectHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "yaml"
+	}
+	if _, ok := flagFormatContentTypes[format]; !ok {
+		writeValidationError(w, "INVALID_FORMAT", "format must be one of: json, yaml, toml")
+		return
+	}
+
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	data, err := encodeFlagFormat(format, flags)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", flagFormatContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", project, format))
+	w.Write(data)
+}
+
+// importProjectHandler loads a flags file into a project, creating the project
+// if needed. The format is taken from ?format= or the Content-Type, defaulting
+// to yaml. Flags in the file are created or updated; with ?mode=replace, flags
+// missing from the file are deleted. ?dryRun=true reports what would change
+// without applying it. Nothing is applied if any flag is invalid.
+func (fm *FlagManager) importProjectHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+	query := r.URL.Query()
+	if err := ValidateProjectName(project); err != nil {
+		writeValidationError(w, "INVALID_PROJECT_NAME", err.Error())
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = importFormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	if _, ok := flagFormatContentTypes[format]; !ok {
+		writeValidationError(w, "INVALID_FORMAT", "format must be one of: json, yaml, toml")
+		return
+	}
+	mode := query.Get("mode")
+	switch mode {
+	case "":
+		mode = importModeMerge
+	case importModeMerge, importModeReplace:
+	default:
+		writeValidationError(w, "INVALID_IMPORT_MODE", "mode must be merge or replace")
+		return
+	}
+	dryRun := query.Get("dryRun") == "true"
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	imported, err := decodeFlagFormat(format, body)
+	if err != nil {
+		writeValidationError(w, "INVALID_FLAGS_FILE", fmt.Sprintf("Invalid %s flags file: %v", format, err))
+		return
+	}
+	var invalid []string
+	for key, config := range imported {
+		if err := ValidateFlagKey(key); err != nil {
+			invalid = append(invalid, key+": "+err.Error())
+			continue
+		}
+		for _, e := range ValidateFlagConfig(config) {
+			invalid = append(invalid, key+": "+e)
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		writeValidationError(w, "INVALID_FLAGS_FILE", "The flags file contains invalid flags", invalid...)
+		return
+	}
+
+	local, err := fm.loadStoredProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	projectExists := local != nil
+	if local == nil {
+		local = make(ProjectFlags)
+	}
+
+	// The imported file always wins. Using the current flags as the sync base
+	// marks flags missing from the file as removed on the file side.
+	var base ProjectFlags
+	if mode == importModeReplace {
+		base = local
+	}
+	plan, err := planGitSync(local, imported, base, syncStrategyRepo)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	result := &ProjectImportResult{
+		Project: project,
+		Format:  format,
+		Mode:    mode,
+		DryRun:  dryRun,
+		Summary: map[string]int{"added": 0, "updated": 0, "removed": 0, "kept": 0},
+		Flags:   plan,
+	}
+	for i, f := range plan {
+		if f.Action == "kept_local" {
+			plan[i].Action = "kept"
+		}
+		result.Summary[plan[i].Action]++
+	}
+
+	if !dryRun {
+		if !projectExists {
+			if err := fm.storage.CreateProject(r.Context(), project); err != nil && !errors.Is(err, errProjectExists) {
+				writeStorageError(w, err)
+				return
+			}
+		}
+		if err := fm.applyGitSync(r.Context(), project, imported, plan); err != nil {
+			if writePolicyViolationError(w, err) {
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to import flags: "+err.Error())
+			return
+		}
+		result.Applied = true
+
+		actor := GetActor(r)
+		for _, f := range plan {
+			if f.Action == "kept" {
+				continue
+			}
+			changes := map[string]interface{}{}
+			if config, ok := local[f.Key]; ok {
+				changes["before"] = config
+			}
+			if config, ok := imported[f.Key]; ok {
+				changes["after"] = config
+			}
+			fm.audit.Log(r.Context(), actor, "flag.imported", "flag", "", f.Key, project, changes,
+				map[string]interface{}{"format": format, "mode": mode, "action": f.Action})
+			fm.notifyProjectWebhook(r, syncWebhookEvents[f.Action], project, f.Key, "")
+		}
+		if result.Summary["added"]+result.Summary["updated"]+result.Summary["removed"] > 0 {
+			fm.scheduleRelayRefresh(r.Context())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// importFormatFromContentType picks the flags file format of an import from
+// its Content-Type, defaulting to yaml.
+func importFormatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for format, ct := range flagFormatContentTypes {
+		if mediaType == ct {
+			return format
+		}
+	}
+	return "yaml"
+}
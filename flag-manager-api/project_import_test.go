@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProjectExportImport(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/banner", `{"variations":{"a":"blue","b":"red"},"defaultRule":{"variation":"a"}}`, http.StatusCreated, nil)
+	doRequest(t, router, "GET", "/api/projects/missing/export", "", http.StatusNotFound, nil)
+	doRequest(t, router, "GET", "/api/projects/web/export?format=xml", "", http.StatusBadRequest, nil)
+
+	for _, format := range []string{"yaml", "json", "toml"} {
+		t.Run(format, func(t *testing.T) {
+			rr := doRequest(t, router, "GET", "/api/projects/web/export?format="+format, "", http.StatusOK, nil)
+			if cd := rr.Header().Get("Content-Disposition"); !strings.Contains(cd, "web."+format) {
+				t.Errorf("Expected a web.%s attachment, got %q", format, cd)
+			}
+
+			// Importing an export into a new project reproduces it
+			project := "copy-" + format
+			var result ProjectImportResult
+			doRequest(t, router, "POST", "/api/projects/"+project+"/import?format="+format, rr.Body.String(), http.StatusOK, &result)
+			if !result.Applied || result.Summary["added"] != 2 {
+				t.Fatalf("Expected 2 flags added, got %+v", result)
+			}
+			flags, err := fm.storage.ListFlags(context.Background(), project)
+			if err != nil || len(flags) != 2 || flags["banner"].Variations["b"] != "red" {
+				t.Errorf("Expected the imported flags, got %+v, %v", flags, err)
+			}
+		})
+	}
+
+	yamlFile := "checkout:\n  variations: {on: true, off: false}\n  defaultRule: {variation: on}\nsearch:\n  variations: {on: true, off: false}\n  defaultRule: {variation: off}\n"
+	importYAML := func(path string) *http.Request {
+		req := httptest.NewRequest("POST", path, strings.NewReader(yamlFile))
+		req.Header.Set("Content-Type", "application/x-yaml")
+		return req
+	}
+
+	// A dry run reports the changes without applying them
+	var result ProjectImportResult
+	serveRequest(t, router, importYAML("/api/projects/web/import?mode=replace&dryRun=true"), http.StatusOK, &result)
+	if result.Applied || result.Summary["added"] != 1 || result.Summary["updated"] != 1 || result.Summary["removed"] != 1 {
+		t.Errorf("Expected 1 flag added, updated and removed, got %+v", result)
+	}
+	if flags, _ := fm.storage.ListFlags(context.Background(), "web"); len(flags) != 2 || flags["checkout"].DefaultRule.Variation != "off" {
+		t.Errorf("Expected a dry run to leave the project unchanged, got %+v", flags)
+	}
+
+	// Merging keeps flags missing from the file
+	serveRequest(t, router, importYAML("/api/projects/web/import"), http.StatusOK, &result)
+	if !result.Applied || result.Summary["kept"] != 1 {
+		t.Errorf("Expected banner to be kept, got %+v", result)
+	}
+	flags, _ := fm.storage.ListFlags(context.Background(), "web")
+	if len(flags) != 3 || flags["checkout"].DefaultRule.Variation != "on" {
+		t.Errorf("Expected 3 flags with checkout updated, got %+v", flags)
+	}
+
+	// Replacing deletes them
+	serveRequest(t, router, importYAML("/api/projects/web/import?mode=replace"), http.StatusOK, &result)
+	if result.Summary["removed"] != 1 || result.Summary["updated"] != 0 {
+		t.Errorf("Expected only banner removed, got %+v", result)
+	}
+	if flags, _ := fm.storage.ListFlags(context.Background(), "web"); len(flags) != 2 {
+		t.Errorf("Expected 2 flags left, got %+v", flags)
+	}
+
+	doRequest(t, router, "POST", "/api/projects/web/import?format=json", `{"Bad Key":{"variations":{"on":true},"defaultRule":{"variation":"on"}}}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "POST", "/api/projects/web/import?mode=sync", yamlFile, http.StatusBadRequest, nil)
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// projectWebhookDeliveryLimit is how many deliveries are kept per webhook
+// subscription; the oldest are dropped.
+const projectWebhookDeliveryLimit = 100
+
+// projectWebhookEvents are the flag lifecycle events a webhook subscription
+// can filter on.
+var projectWebhookEvents = []string{"flag.created", "flag.updated", "flag.published", "flag.archived", "flag.restored", "flag.deleted"}
+
+// ProjectWebhookSubscription is an outbound webhook receiving the flag
+// lifecycle events of a project, for automation downstream of the manager.
+// Unlike the project's single webhook, a project can have several, each
+// filtering the events it receives and keeping a log of its deliveries.
+type ProjectWebhookSubscription struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events,omitempty"` // empty to receive every event
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// subscribes reports whether the subscription receives an event.
+func (s *ProjectWebhookSubscription) subscribes(event string) bool {
+	return len(s.Events) == 0 || slices.Contains(s.Events, event)
+}
+
+// maskedProjectWebhookSubscription returns a copy of a subscription with its
+// secret masked.
+func maskedProjectWebhookSubscription(sub ProjectWebhookSubscription) ProjectWebhookSubscription {
+	if sub.Secret != "" {
+		sub.Secret = "********"
+	}
+	return sub
+}
+
+// ProjectWebhookDelivery is the delivery of an event to a webhook
+// subscription, through all of its attempts.
+type ProjectWebhookDelivery struct {
+	ID           string              `json:"id"`
+	WebhookID    string              `json:"webhookId"`
+	Project      string              `json:"project"`
+	Event        ProjectWebhookEvent `json:"event"`
+	Status       string              `json:"status"` // pending, delivered, failed
+	Attempts     int                 `json:"attempts"`
+	ResponseCode int                 `json:"responseCode,omitempty"` // of the last attempt
+	Error        string              `json:"error,omitempty"`        // of the last attempt
+	RedeliveryOf string              `json:"redeliveryOf,omitempty"`
+	CreatedAt    time.Time           `json:"createdAt"`
+	CompletedAt  *time.Time          `json:"completedAt,omitempty"`
+}
+
+// projectWebhookDeliveryLog keeps the last deliveries of each webhook
+// subscription in memory. The zero value is ready to use.
+type projectWebhookDeliveryLog struct {
+	mu         sync.Mutex
+	deliveries map[string][]*ProjectWebhookDelivery // by webhook ID, oldest first
+}
+
+// add records a new delivery.
+func (l *projectWebhookDeliveryLog) add(d *ProjectWebhookDelivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.deliveries == nil {
+		l.deliveries = make(map[string][]*ProjectWebhookDelivery)
+	}
+	deliveries := append(l.deliveries[d.WebhookID], d)
+	if n := len(deliveries) - projectWebhookDeliveryLimit; n > 0 {
+		deliveries = append([]*ProjectWebhookDelivery(nil), deliveries[n:]...)
+	}
+	l.deliveries[d.WebhookID] = deliveries
+}
+
+// update applies an attempt's outcome to a recorded delivery.
+func (l *projectWebhookDeliveryLog) update(d *ProjectWebhookDelivery, fn func(*ProjectWebhookDelivery)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn(d)
+}
+
+// list returns the deliveries of a webhook subscription, newest first.
+func (l *projectWebhookDeliveryLog) list(webhookID string) []ProjectWebhookDelivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	deliveries := l.deliveries[webhookID]
+	out := make([]ProjectWebhookDelivery, 0, len(deliveries))
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		out = append(out, *deliveries[i])
+	}
+	return out
+}
+
+// get returns a delivery of a webhook subscription.
+func (l *projectWebhookDeliveryLog) get(webhookID, id string) (ProjectWebhookDelivery, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, d := range l.deliveries[webhookID] {
+		if d.ID == id {
+			return *d, true
+		}
+	}
+	return ProjectWebhookDelivery{}, false
+}
+
+// forget drops the deliveries of a deleted webhook subscription.
+func (l *projectWebhookDeliveryLog) forget(webhookID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.deliveries, webhookID)
+}
+
+// startProjectWebhookDelivery records a delivery of an event to a
+// subscription and makes it in the background. It returns the delivery as
+// recorded.
+func (fm *FlagManager) startProjectWebhookDelivery(project string, sub ProjectWebhookSubscription, event ProjectWebhookEvent, redeliveryOf string) ProjectWebhookDelivery {
+	d := &ProjectWebhookDelivery{
+		ID:           uuid.New().String(),
+		WebhookID:    sub.ID,
+		Project:      project,
+		Event:        event,
+		Status:       "pending",
+		RedeliveryOf: redeliveryOf,
+		CreatedAt:    time.Now().UTC(),
+	}
+	fm.webhookDeliveries.add(d)
+	recorded := *d
+	go fm.deliverProjectWebhookSubscription(sub, d)
+	return recorded
+}
+
+// deliverProjectWebhookSubscription posts the event of a delivery, retrying
+// failed attempts with exponential backoff, and records each attempt.
+func (fm *FlagManager) deliverProjectWebhookSubscription(sub ProjectWebhookSubscription, d *ProjectWebhookDelivery) {
+	data, err := json.Marshal(d.Event)
+	if err != nil {
+		fm.webhookDeliveries.update(d, func(d *ProjectWebhookDelivery) {
+			d.Status = "failed"
+			d.Error = err.Error()
+		})
+		return
+	}
+
+	delay := projectWebhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		status, err := fm.postProjectWebhook(sub.URL, sub.Secret, d.ID, d.Event.Event, data)
+		done := err == nil || attempt == projectWebhookMaxAttempts
+		fm.webhookDeliveries.update(d, func(d *ProjectWebhookDelivery) {
+			d.Attempts = attempt
+			d.ResponseCode = status
+			d.Error = ""
+			if err != nil {
+				d.Error = err.Error()
+			}
+			if done {
+				now := time.Now().UTC()
+				d.CompletedAt = &now
+				d.Status = "delivered"
+				if err != nil {
+					d.Status = "failed"
+				}
+			}
+		})
+		if done {
+			if err != nil {
+				slog.Warn("Project webhook delivery failed", "project", d.Project, "webhook", sub.ID, "event", d.Event.Event, "attempts", attempt, "error", err)
+			}
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// ProjectWebhookSubscriptionsResponse lists the webhook subscriptions of a
+// project.
+type ProjectWebhookSubscriptionsResponse struct {
+	Webhooks []ProjectWebhookSubscription `json:"webhooks"`
+	Total    int                          `json:"total"`
+}
+
+// ProjectWebhookDeliveriesResponse lists the deliveries of a webhook
+// subscription, newest first.
+type ProjectWebhookDeliveriesResponse struct {
+	Deliveries []ProjectWebhookDelivery `json:"deliveries"`
+	Total      int                      `json:"total"`
+}
+
+// loadProjectWebhookSubscription returns the meta of the request's project and
+// the index in it of the webhook subscription of the request. It writes the
+// error response and returns false when either does not exist.
+func (fm *FlagManager) loadProjectWebhookSubscription(w http.ResponseWriter, r *http.Request) (ProjectMeta, int, bool) {
+	vars := mux.Vars(r)
+	meta, ok, err := fm.getProjectMeta(r.Context(), vars["project"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return meta, -1, false
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return meta, -1, false
+	}
+	// The subscriptions are changed in place, and the file store shares them
+	meta.Webhooks = slices.Clone(meta.Webhooks)
+	for i, sub := range meta.Webhooks {
+		if sub.ID == vars["id"] {
+			return meta, i, true
+		}
+	}
+	writeError(w, http.StatusNotFound, "WEBHOOK_NOT_FOUND", "Webhook not found")
+	return meta, -1, false
+}
+
+// decodeProjectWebhookSubscription reads and validates the subscription of a
+// request body. An empty or masked secret keeps the secret of previous, if
+// any. It writes the error response and returns false when the subscription
+// is invalid.
+func decodeProjectWebhookSubscription(w http.ResponseWriter, r *http.Request, previous *ProjectWebhookSubscription) (ProjectWebhookSubscription, bool) {
+	sub := ProjectWebhookSubscription{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return sub, false
+	}
+	if sub.Secret == "********" {
+		sub.Secret = ""
+	}
+	if previous != nil && sub.Secret == "" {
+		sub.Secret = previous.Secret
+	}
+
+	var errs []string
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, "url must be an absolute http or https URL")
+	}
+	seen := make(map[string]bool, len(sub.Events))
+	events := sub.Events[:0]
+	for _, event := range sub.Events {
+		if !slices.Contains(projectWebhookEvents, event) {
+			errs = append(errs, "unknown event "+event+": events must be among "+strings.Join(projectWebhookEvents, ", "))
+		} else if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	sub.Events = events
+	sort.Strings(sub.Events)
+	if len(errs) > 0 {
+		writeValidationError(w, "INVALID_WEBHOOK", "Webhook is invalid", errs...)
+		return sub, false
+	}
+	return sub, true
+}
+
+func (fm *FlagManager) listProjectWebhookSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	meta, ok, err := fm.getProjectMeta(r.Context(), mux.Vars(r)["project"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	resp := ProjectWebhookSubscriptionsResponse{Webhooks: make([]ProjectWebhookSubscription, 0, len(meta.Webhooks)), Total: len(meta.Webhooks)}
+	for _, sub := range meta.Webhooks {
+		resp.Webhooks = append(resp.Webhooks, maskedProjectWebhookSubscription(sub))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// createProjectWebhookSubscriptionHandler subscribes a webhook to the events
+// of a project. Without a secret, one is generated and returned once in the
+// response.
+func (fm *FlagManager) createProjectWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	sub, ok := decodeProjectWebhookSubscription(w, r, nil)
+	if !ok {
+		return
+	}
+	if sub.Secret == "" {
+		if sub.Secret, err = generateWebhookSecret(); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	}
+	now := time.Now().UTC()
+	sub.ID = uuid.New().String()
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+
+	meta.Webhooks = append(slices.Clip(meta.Webhooks), sub)
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "project_webhook.created", "project_webhook", sub.ID, sub.URL, project,
+		map[string]interface{}{"after": maskedProjectWebhookSubscription(sub)}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (fm *FlagManager) getProjectWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	meta, i, ok := fm.loadProjectWebhookSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maskedProjectWebhookSubscription(meta.Webhooks[i]))
+}
+
+// updateProjectWebhookSubscriptionHandler replaces a webhook subscription. An
+// empty or masked secret keeps the current one.
+func (fm *FlagManager) updateProjectWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	meta, i, ok := fm.loadProjectWebhookSubscription(w, r)
+	if !ok {
+		return
+	}
+	before := meta.Webhooks[i]
+	sub, ok := decodeProjectWebhookSubscription(w, r, &before)
+	if !ok {
+		return
+	}
+	sub.ID = before.ID
+	sub.CreatedAt = before.CreatedAt
+	sub.UpdatedAt = time.Now().UTC()
+
+	meta.Webhooks[i] = sub
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "project_webhook.updated", "project_webhook", sub.ID, sub.URL, project,
+		map[string]interface{}{"before": maskedProjectWebhookSubscription(before), "after": maskedProjectWebhookSubscription(sub)}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maskedProjectWebhookSubscription(sub))
+}
+
+func (fm *FlagManager) deleteProjectWebhookSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	meta, i, ok := fm.loadProjectWebhookSubscription(w, r)
+	if !ok {
+		return
+	}
+	sub := meta.Webhooks[i]
+	meta.Webhooks = append(meta.Webhooks[:i:i], meta.Webhooks[i+1:]...)
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	fm.webhookDeliveries.forget(sub.ID)
+
+	fm.audit.Log(r.Context(), GetActor(r), "project_webhook.deleted", "project_webhook", sub.ID, sub.URL, project,
+		map[string]interface{}{"before": maskedProjectWebhookSubscription(sub)}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listProjectWebhookDeliveriesHandler returns the last deliveries of a webhook
+// subscription, newest first, with the outcome of their last attempt.
+func (fm *FlagManager) listProjectWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	meta, i, ok := fm.loadProjectWebhookSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries := fm.webhookDeliveries.list(meta.Webhooks[i].ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProjectWebhookDeliveriesResponse{Deliveries: deliveries, Total: len(deliveries)})
+}
+
+// redeliverProjectWebhookHandler delivers the event of a past delivery again,
+// with its original payload, to the current URL and secret of the webhook
+// subscription, whether or not it is enabled.
+func (fm *FlagManager) redeliverProjectWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	meta, i, ok := fm.loadProjectWebhookSubscription(w, r)
+	if !ok {
+		return
+	}
+	sub := meta.Webhooks[i]
+	original, ok := fm.webhookDeliveries.get(sub.ID, mux.Vars(r)["deliveryId"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "DELIVERY_NOT_FOUND", "Delivery not found")
+		return
+	}
+
+	delivery := fm.startProjectWebhookDelivery(project, sub, original.Event, original.ID)
+	fm.audit.Log(r.Context(), GetActor(r), "project_webhook.redelivered", "project_webhook", sub.ID, sub.URL, project, nil,
+		map[string]interface{}{"deliveryId": delivery.ID, "redeliveryOf": original.ID, "event": original.Event.Event})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestProjectWebhookSubscriptions(t *testing.T) {
+	prevDelay := projectWebhookRetryDelay
+	projectWebhookRetryDelay = time.Millisecond
+	defer func() { projectWebhookRetryDelay = prevDelay }()
+
+	type received struct {
+		path, event, delivery, signature string
+		body                             []byte
+	}
+	var mu sync.Mutex
+	var requests []received
+	healthy := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, received{r.URL.Path, r.Header.Get(projectWebhookEventHeader), r.Header.Get(projectWebhookDeliveryHeader), r.Header.Get(projectWebhookSignatureHeader), body})
+		if strings.HasSuffix(r.URL.Path, "/flaky") && !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	requestsTo := func(path string) []received {
+		mu.Lock()
+		defer mu.Unlock()
+		var out []received
+		for _, req := range requests {
+			if req.path == path {
+				out = append(out, req)
+			}
+		}
+		return out
+	}
+
+	fileFM, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			project := mode + "-shop"
+			base := "/api/projects/" + project + "/webhooks"
+			allURL, flakyURL := server.URL+"/"+mode+"/all", server.URL+"/"+mode+"/flaky"
+			deliveries := func(id string) []ProjectWebhookDelivery {
+				t.Helper()
+				var resp ProjectWebhookDeliveriesResponse
+				doRequest(t, router, "GET", base+"/"+id+"/deliveries", "", http.StatusOK, &resp)
+				return resp.Deliveries
+			}
+			// settled waits for the deliveries of a webhook to complete
+			settled := func(id string, n int) []ProjectWebhookDelivery {
+				t.Helper()
+				deadline := time.Now().Add(5 * time.Second)
+				for {
+					list := deliveries(id)
+					done := len(list) == n
+					for _, d := range list {
+						done = done && d.Status != "pending"
+					}
+					if done {
+						return list
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("Timed out waiting for %d deliveries, got %+v", n, list)
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+			}
+
+			doRequest(t, router, "POST", base, `{"url":"`+allURL+`"}`, http.StatusNotFound, nil)
+			doRequest(t, router, "POST", "/api/projects/"+project, "", http.StatusCreated, nil)
+			doRequest(t, router, "POST", base, `{"url":"`+server.URL+`","events":["flag.renamed"]}`, http.StatusBadRequest, nil)
+
+			var all, flaky ProjectWebhookSubscription
+			doRequest(t, router, "POST", base, `{"url":"`+allURL+`"}`, http.StatusCreated, &all)
+			if all.ID == "" || all.Secret == "" || !all.Enabled {
+				t.Fatalf("Expected an enabled webhook with a generated secret, got %+v", all)
+			}
+			doRequest(t, router, "POST", base, `{"url":"`+flakyURL+`","secret":"s3cret","events":["flag.deleted","flag.deleted"],"enabled":true}`, http.StatusCreated, &flaky)
+			if !reflect.DeepEqual(flaky.Events, []string{"flag.deleted"}) {
+				t.Fatalf("Expected a webhook filtering flag.deleted, got %+v", flaky)
+			}
+
+			var list ProjectWebhookSubscriptionsResponse
+			doRequest(t, router, "GET", base, "", http.StatusOK, &list)
+			if list.Total != 2 || list.Webhooks[0].Secret != "********" || list.Webhooks[1].Secret != "********" {
+				t.Errorf("Expected 2 webhooks with masked secrets, got %+v", list)
+			}
+
+			doRequest(t, router, "POST", "/api/projects/"+project+"/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+			// The first delete archives the flag, the second purges it
+			doRequest(t, router, "DELETE", "/api/projects/"+project+"/flags/checkout", "", http.StatusNoContent, nil)
+			doRequest(t, router, "DELETE", "/api/projects/"+project+"/flags/checkout", "", http.StatusNoContent, nil)
+
+			// Every event reaches the unfiltered webhook, signed and with its
+			// delivery ID
+			delivered := settled(all.ID, 3)
+			if delivered[0].Event.Event != "flag.deleted" || delivered[1].Event.Event != "flag.archived" || delivered[2].Event.Event != "flag.created" ||
+				delivered[0].Status != "delivered" || delivered[0].Attempts != 1 {
+				t.Errorf("Expected flag.created, flag.archived and flag.deleted delivered, newest first, got %+v", delivered)
+			}
+			for _, req := range requestsTo("/" + mode + "/all") {
+				if req.signature != "sha256="+signProjectWebhookPayload(all.Secret, req.body) || req.delivery == "" {
+					t.Errorf("Expected a signed request with a delivery ID, got %+v", req)
+				}
+			}
+
+			// The filtered webhook only gets flag.deleted, retried until it
+			// fails
+			failed := settled(flaky.ID, 1)
+			if failed[0].Event.Event != "flag.deleted" || failed[0].Status != "failed" || failed[0].Attempts != projectWebhookMaxAttempts || failed[0].ResponseCode != http.StatusInternalServerError {
+				t.Fatalf("Expected flag.deleted failed after %d attempts, got %+v", projectWebhookMaxAttempts, failed[0])
+			}
+			attempts := requestsTo("/" + mode + "/flaky")
+			if len(attempts) != projectWebhookMaxAttempts || attempts[0].delivery != failed[0].ID || attempts[2].delivery != failed[0].ID {
+				t.Errorf("Expected %d attempts of delivery %s, got %+v", projectWebhookMaxAttempts, failed[0].ID, attempts)
+			}
+
+			// A redelivery sends the same payload again
+			mu.Lock()
+			healthy = true
+			mu.Unlock()
+			doRequest(t, router, "POST", base+"/"+flaky.ID+"/deliveries/missing/redeliver", "", http.StatusNotFound, nil)
+			doRequest(t, router, "POST", base+"/"+flaky.ID+"/deliveries/"+failed[0].ID+"/redeliver", "", http.StatusAccepted, nil)
+			redelivered := settled(flaky.ID, 2)[0]
+			if redelivered.Status != "delivered" || redelivered.RedeliveryOf != failed[0].ID || redelivered.ID == failed[0].ID {
+				t.Errorf("Expected a new delivery of %s, got %+v", failed[0].ID, redelivered)
+			}
+			attempts = requestsTo("/" + mode + "/flaky")
+			if last := attempts[len(attempts)-1]; !bytes.Equal(last.body, attempts[0].body) || last.signature != "sha256="+signProjectWebhookPayload("s3cret", last.body) {
+				t.Errorf("Expected the original payload, signed, got %s", last.body)
+			}
+			mu.Lock()
+			healthy = false
+			mu.Unlock()
+
+			// A masked secret keeps the current one
+			doRequest(t, router, "PUT", base+"/"+all.ID, `{"url":"`+allURL+`","secret":"********","events":["flag.updated"],"enabled":false}`, http.StatusOK, nil)
+			meta, _, _ := fm.getProjectMeta(context.Background(), project)
+			if meta.Webhooks[0].Secret != all.Secret || meta.Webhooks[0].Enabled || !meta.Webhooks[0].CreatedAt.Equal(all.CreatedAt) {
+				t.Errorf("Expected the secret and creation time kept, got %+v", meta.Webhooks[0])
+			}
+
+			doRequest(t, router, "DELETE", base+"/"+flaky.ID, "", http.StatusNoContent, nil)
+			doRequest(t, router, "GET", base+"/"+flaky.ID+"/deliveries", "", http.StatusNotFound, nil)
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+	"flag-manager-api/httpclient"
+	"flag-manager-api/secrets"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// projectWebhookSignatureHeader carries the hex HMAC-SHA256 of the request
+	// body, keyed with the project's webhook secret.
+	projectWebhookSignatureHeader = "X-Goff-Signature"
+	projectWebhookEventHeader     = "X-Goff-Event"
+	projectWebhookDeliveryHeader  = "X-Goff-Delivery" // ID of the delivery, the same for all of its attempts
+	projectWebhookMaxAttempts     = 3
+)
+
+// projectWebhookRetryDelay is the delay before the first retry; it doubles on
+// each further attempt.
+var projectWebhookRetryDelay = 2 * time.Second
+
+// ProjectWebhook is an outbound webhook receiving every flag change in a project
+type ProjectWebhook struct {
+	URL     string `json:"url"`
+	Secret  string `json:"secret,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ProjectMeta holds per-project settings that live outside the flags themselves
+type ProjectMeta struct {
+	Webhook      *ProjectWebhook              `json:"webhook,omitempty"`
+	Webhooks     []ProjectWebhookSubscription `json:"webhooks,omitempty"`
+	Environments []string                     `json:"environments,omitempty"` // e.g. dev, staging, prod
+	NamingRules  *FlagNamingRules             `json:"namingRules,omitempty"`
+}
+
+// ProjectWebhookEvent is the payload delivered to a project webhook
+type ProjectWebhookEvent struct {
+	Event       string    `json:"event"` // flag.created, flag.updated, flag.published, flag.deleted
+	Project     string    `json:"project"`
+	FlagKey     string    `json:"flagKey"`
+	PreviousKey string    `json:"previousKey,omitempty"` // set when an update renamed the flag
+	Actor       string    `json:"actor,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// ProjectMetaStore manages project meta persistence in file mode
+type ProjectMetaStore struct {
+	mu       sync.RWMutex
+	meta     map[string]ProjectMeta
+	filePath string
+	cipher   *secrets.Cipher
+}
+
+// NewProjectMetaStore creates a new project meta store
+func NewProjectMetaStore(configDir string, cipher *secrets.Cipher) *ProjectMetaStore {
+	store := &ProjectMetaStore{
+		filePath: filepath.Join(configDir, "project-meta.json"),
+		cipher:   cipher,
+		meta:     make(map[string]ProjectMeta),
+	}
+	store.load()
+	return store
+}
+
+func (s *ProjectMetaStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := readSealedFile(s.filePath, s.cipher, db.ProjectMetaSecretFields)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.meta)
+}
+
+func (s *ProjectMetaStore) save() error {
+	data, err := json.MarshalIndent(s.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSealedFile(s.filePath, data, 0644, s.cipher, db.ProjectMetaSecretFields)
+}
+
+// Get returns a project's meta
+func (s *ProjectMetaStore) Get(project string) ProjectMeta {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.meta[project]
+}
+
+// Set replaces a project's meta
+func (s *ProjectMetaStore) Set(project string, meta ProjectMeta) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.meta[project] = meta
+	return s.save()
+}
+
+// Delete removes a project's meta
+func (s *ProjectMetaStore) Delete(project string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.meta[project]; !ok {
+		return nil
+	}
+	delete(s.meta, project)
+	return s.save()
+}
+
+// getProjectMeta returns a project's meta. ok is false if the project does not exist.
+func (fm *FlagManager) getProjectMeta(ctx context.Context, project string) (meta ProjectMeta, ok bool, err error) {
+	if fm.store != nil {
+		raw, err := fm.store.GetProjectMeta(ctx, project)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return meta, false, nil
+			}
+			return meta, false, err
+		}
+		if raw != nil {
+			if err := json.Unmarshal(raw, &meta); err != nil {
+				return meta, true, err
+			}
+		}
+		return meta, true, nil
+	}
+
+	flags, err := fm.readProjectFlags(project)
+	if err != nil || flags == nil {
+		return meta, false, err
+	}
+	if fm.projectMeta != nil {
+		meta = fm.projectMeta.Get(project)
+	}
+	return meta, true, nil
+}
+
+// setProjectMeta replaces a project's meta in whichever backend is active.
+func (fm *FlagManager) setProjectMeta(ctx context.Context, project string, meta ProjectMeta) error {
+	if fm.store != nil {
+		raw, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+		return fm.store.SetProjectMeta(ctx, project, raw)
+	}
+	return fm.projectMeta.Set(project, meta)
+}
+
+// maskedProjectWebhook returns a copy of a webhook with its secret masked
+func maskedProjectWebhook(webhook *ProjectWebhook) *ProjectWebhook {
+	masked := *webhook
+	if masked.Secret != "" {
+		masked.Secret = "********"
+	}
+	return &masked
+}
+
+// generateWebhookSecret returns a random hex secret for signing webhook payloads
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// signProjectWebhookPayload returns the hex HMAC-SHA256 of a payload
+func signProjectWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notifyProjectWebhook delivers a flag change event to the project's webhook,
+// if one is enabled, and to the webhook subscriptions of the project filtering
+// it in. Delivery is asynchronous and never fails the request.
+func (fm *FlagManager) notifyProjectWebhook(r *http.Request, event, project, flagKey, previousKey string) {
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to load project webhook", "project", project, "error", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	actor := GetActor(r)
+	payload := ProjectWebhookEvent{
+		Event:       event,
+		Project:     project,
+		FlagKey:     flagKey,
+		PreviousKey: previousKey,
+		Actor:       actor.Name,
+		Timestamp:   time.Now().UTC(),
+	}
+	if actor.Email != "" {
+		payload.Actor = actor.Email
+	}
+
+	if webhook := meta.Webhook; webhook != nil && webhook.Enabled && webhook.URL != "" {
+		webhook := *webhook
+		go func() {
+			if err := fm.deliverProjectWebhook(webhook, payload); err != nil {
+				slog.WarnContext(r.Context(), "Project webhook failed", "project", project, "error", err)
+			}
+		}()
+	}
+	for _, sub := range meta.Webhooks {
+		if sub.Enabled && sub.subscribes(event) {
+			fm.startProjectWebhookDelivery(project, sub, payload, "")
+		}
+	}
+}
+
+// deliverProjectWebhook posts a signed event, retrying failed attempts with
+// exponential backoff.
+func (fm *FlagManager) deliverProjectWebhook(webhook ProjectWebhook, event ProjectWebhookEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	delay := projectWebhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		_, err = fm.postProjectWebhook(webhook.URL, webhook.Secret, "", event.Event, data)
+		if err == nil || attempt == projectWebhookMaxAttempts {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postProjectWebhook makes one attempt at posting a signed event payload. It
+// returns the status of the response, or 0 if there was none.
+func (fm *FlagManager) postProjectWebhook(webhookURL, secret, deliveryID, event string, data []byte) (int, error) {
+	status := 0
+	err := fm.outbound.Do(func() error {
+		req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(projectWebhookEventHeader, event)
+		req.Header.Set(projectWebhookSignatureHeader, "sha256="+signProjectWebhookPayload(secret, data))
+		if deliveryID != "" {
+			req.Header.Set(projectWebhookDeliveryHeader, deliveryID)
+		}
+
+		resp, err := httpclient.Default().Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		status = resp.StatusCode
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	})
+	return status, err
+}
+
+func (fm *FlagManager) getProjectWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	if meta.Webhook == nil {
+		writeError(w, http.StatusNotFound, "WEBHOOK_NOT_CONFIGURED", "Webhook not configured")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maskedProjectWebhook(meta.Webhook))
+}
+
+// updateProjectWebhookHandler configures a project's webhook. An empty or
+// masked secret keeps the current one; if there is none, a secret is generated
+// and returned once in the response.
+func (fm *FlagManager) updateProjectWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	var webhook ProjectWebhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeValidationError(w, "INVALID_WEBHOOK_URL", "url must be an absolute http or https URL")
+		return
+	}
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+
+	if webhook.Secret == "" || webhook.Secret == "********" {
+		webhook.Secret = ""
+		if meta.Webhook != nil {
+			webhook.Secret = meta.Webhook.Secret
+		}
+	}
+	if webhook.Secret == "" {
+		if webhook.Secret, err = generateWebhookSecret(); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	}
+
+	meta.Webhook = &webhook
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "project.webhook_updated", "project", "", project, project,
+		map[string]interface{}{"after": maskedProjectWebhook(&webhook)}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhook)
+}
+
+func (fm *FlagManager) deleteProjectWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	meta, ok, err := fm.getProjectMeta(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	if meta.Webhook == nil {
+		writeError(w, http.StatusNotFound, "WEBHOOK_NOT_CONFIGURED", "Webhook not configured")
+		return
+	}
+
+	meta.Webhook = nil
+	if err := fm.setProjectMeta(r.Context(), project, meta); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "project.webhook_deleted", "project", "", project, project, nil, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProjectWebhook(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	failures := 1
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	prevDelay := projectWebhookRetryDelay
+	projectWebhookRetryDelay = time.Millisecond
+	defer func() { projectWebhookRetryDelay = prevDelay }()
+
+	webhook := `{"url":"` + server.URL + `","enabled":true}`
+	doRequest(t, router, "PUT", "/api/projects/shop/webhook", webhook, http.StatusNotFound, nil)
+	doRequest(t, router, "POST", "/api/projects/shop", "", http.StatusCreated, nil)
+	doRequest(t, router, "PUT", "/api/projects/shop/webhook", `{"url":"ftp://example.com","enabled":true}`, http.StatusBadRequest, nil)
+
+	var configured ProjectWebhook
+	doRequest(t, router, "PUT", "/api/projects/shop/webhook", webhook, http.StatusOK, &configured)
+	if configured.Secret == "" {
+		t.Fatal("Expected a generated secret")
+	}
+
+	var masked ProjectWebhook
+	doRequest(t, router, "GET", "/api/projects/shop/webhook", "", http.StatusOK, &masked)
+	if masked.Secret != "********" || masked.URL != server.URL {
+		t.Errorf("Expected masked webhook, got %+v", masked)
+	}
+
+	// A masked secret keeps the current one
+	doRequest(t, router, "PUT", "/api/projects/shop/webhook", `{"url":"`+server.URL+`","secret":"********","enabled":true}`, http.StatusOK, nil)
+	if got := fm.projectMeta.Get("shop").Webhook.Secret; got != configured.Secret {
+		t.Errorf("Expected secret to be kept, got %q", got)
+	}
+
+	expect := func(event, flagKey string) {
+		t.Helper()
+		select {
+		case req := <-received:
+			body := <-bodies
+			want := "sha256=" + signProjectWebhookPayload(configured.Secret, body)
+			if req.Header.Get(projectWebhookSignatureHeader) != want {
+				t.Errorf("Signature mismatch for %s", event)
+			}
+			var payload ProjectWebhookEvent
+			json.Unmarshal(body, &payload)
+			if payload.Event != event || payload.Project != "shop" || payload.FlagKey != flagKey {
+				t.Errorf("Expected %s for %s, got %+v", event, flagKey, payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s", event)
+		}
+	}
+
+	config := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+	doRequest(t, router, "POST", "/api/projects/shop/flags/checkout", config, http.StatusCreated, nil)
+	// The first delivery fails and is retried
+	expect("flag.created", "checkout")
+
+	doRequest(t, router, "PUT", "/api/projects/shop/flags/checkout", `{"config":`+config+`}`, http.StatusOK, nil)
+	expect("flag.updated", "checkout")
+
+	doRequest(t, router, "DELETE", "/api/projects/shop/flags/checkout", "", http.StatusNoContent, nil)
+	expect("flag.archived", "checkout")
+	doRequest(t, router, "DELETE", "/api/projects/shop/flags/checkout", "", http.StatusNoContent, nil)
+	expect("flag.deleted", "checkout")
+
+	doRequest(t, router, "DELETE", "/api/projects/shop/webhook", "", http.StatusNoContent, nil)
+	doRequest(t, router, "POST", "/api/projects/shop/flags/search", config, http.StatusCreated, nil)
+	select {
+	case <-received:
+		t.Error("Expected no delivery after the webhook was removed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+	"flag-manager-api/git"
+
+	"github.com/google/uuid"
+)
+
+// defaultProposalPollInterval is how often the state of open proposals is
+// checked when PROPOSAL_POLL_INTERVAL is not set.
+const defaultProposalPollInterval = 5 * time.Minute
+
+// proposalPollerActor is the audit actor of proposal state changes detected
+// by the poller.
+var proposalPollerActor = Actor{ID: "proposal-poller", Name: "proposal-poller", Type: "system"}
+
+// ProposalsStore manages proposal persistence in file mode
+type ProposalsStore struct {
+	filePath  string
+	proposals []db.Proposal
+	mu        sync.RWMutex
+}
+
+// NewProposalsStore creates a new proposals store
+func NewProposalsStore(configDir string) *ProposalsStore {
+	store := &ProposalsStore{
+		filePath: filepath.Join(configDir, "proposals.json"),
+	}
+	store.load()
+	return store
+}
+
+func (s *ProposalsStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.proposals)
+}
+
+func (s *ProposalsStore) save() error {
+	data, err := json.MarshalIndent(s.proposals, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filePath, data, 0644)
+}
+
+// Create records a proposal and returns it with its ID and timestamps
+func (s *ProposalsStore) Create(p db.Proposal) (*db.Proposal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	p.ID = uuid.New().String()
+	if p.State == "" {
+		p.State = string(git.PRStateOpen)
+	}
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	s.proposals = append(s.proposals, p)
+	if err := s.save(); err != nil {
+		s.proposals = s.proposals[:len(s.proposals)-1]
+		return nil, err
+	}
+	return &p, nil
+}
+
+// List returns the proposals matching filter, newest first
+func (s *ProposalsStore) List(filter db.ProposalFilter) []db.Proposal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []db.Proposal{}
+	for _, p := range s.proposals {
+		if (filter.Project != "" && p.Project != filter.Project) ||
+			(filter.FlagKey != "" && p.FlagKey != filter.FlagKey) ||
+			(filter.State != "" && p.State != filter.State) {
+			continue
+		}
+		result = append(result, p)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result
+}
+
+// UpdateState sets the state of a proposal
+func (s *ProposalsStore) UpdateState(id, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.proposals {
+		p := &s.proposals[i]
+		if p.ID != id {
+			continue
+		}
+		now := time.Now().UTC()
+		p.State = state
+		p.UpdatedAt = now
+		if state == string(git.PRStateOpen) {
+			p.ResolvedAt = nil
+		} else if p.ResolvedAt == nil {
+			p.ResolvedAt = &now
+		}
+		return s.save()
+	}
+	return nil
+}
+
+// recordProposal persists a proposal in the database or the proposals file.
+func (fm *FlagManager) recordProposal(ctx context.Context, p db.Proposal) (*db.Proposal, error) {
+	if fm.store != nil {
+		return fm.store.CreateProposal(ctx, p)
+	}
+	return fm.proposals.Create(p)
+}
+
+func (fm *FlagManager) listProposals(ctx context.Context, filter db.ProposalFilter) ([]db.Proposal, error) {
+	if fm.store != nil {
+		return fm.store.ListProposals(ctx, filter)
+	}
+	return fm.proposals.List(filter), nil
+}
+
+func (fm *FlagManager) setProposalState(ctx context.Context, id, state string) error {
+	if fm.store != nil {
+		return fm.store.UpdateProposalState(ctx, id, state)
+	}
+	return fm.proposals.UpdateState(id, state)
+}
+
+// ProposalsResponse lists proposed flag changes.
+type ProposalsResponse struct {
+	Proposals []db.Proposal `json:"proposals"`
+	Total     int           `json:"total"`
+}
+
+// listProposalsHandler lists proposed flag changes and the state of their
+// PRs, optionally filtered by ?project=, ?flag= and ?state=.
+func (fm *FlagManager) listProposalsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := db.ProposalFilter{
+		Project: query.Get("project"),
+		FlagKey: query.Get("flag"),
+		State:   query.Get("state"),
+	}
+	switch git.PRState(filter.State) {
+	case "", git.PRStateOpen, git.PRStateMerged, git.PRStateClosed:
+	default:
+		writeValidationError(w, "INVALID_STATE", "state must be open, merged or closed")
+		return
+	}
+
+	proposals, err := fm.listProposals(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ProposalsResponse{
+		Proposals: proposals,
+		Total:     len(proposals),
+	})
+}
+
+// parseProposalPollInterval reads the PROPOSAL_POLL_INTERVAL setting. Empty
+// values use the default; zero disables polling.
+func parseProposalPollInterval(value string) time.Duration {
+	if value == "" {
+		return defaultProposalPollInterval
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid PROPOSAL_POLL_INTERVAL, using default", "value", value, "default", defaultProposalPollInterval)
+		return defaultProposalPollInterval
+	}
+	if d > 0 && d < 10*time.Second {
+		slog.Warn("PROPOSAL_POLL_INTERVAL is below 10s, using 10s", "value", d)
+		d = 10 * time.Second
+	}
+	return d
+}
+
+// proposalProvider returns the git provider a proposal's PR was opened with,
+// or nil if its integration no longer exists.
+func (fm *FlagManager) proposalProvider(ctx context.Context, p db.Proposal) git.Provider {
+	if p.IntegrationID == "" {
+		return fm.gitProvider
+	}
+	provider, _ := fm.integrationGitProvider(ctx, p.IntegrationID)
+	return provider
+}
+
+// pollProposals checks the PR state of every open proposal and records those
+// merged or closed. When ProposalAutoRefresh is set, the relay proxy is
+// refreshed if any PR was merged. It returns the number of proposals resolved;
+// a failing proposal does not stop the others and the first error is returned.
+func (fm *FlagManager) pollProposals(ctx context.Context) (int, error) {
+	open, err := fm.listProposals(ctx, db.ProposalFilter{State: string(git.PRStateOpen)})
+	if err != nil {
+		return 0, err
+	}
+
+	resolved, merged := 0, 0
+	var firstErr error
+	for _, p := range open {
+		provider, ok := fm.proposalProvider(ctx, p).(git.StatusProvider)
+		if !ok {
+			continue
+		}
+
+		var state git.PRState
+		err := fm.outbound.Do(func() error {
+			var err error
+			state, err = provider.GetPRState(p.PRURL)
+			return err
+		})
+		if err == nil && state != git.PRStateOpen {
+			err = fm.setProposalState(ctx, p.ID, string(state))
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to poll proposal", "pr_url", p.PRURL, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if state == git.PRStateOpen {
+			continue
+		}
+
+		resolved++
+		if state == git.PRStateMerged {
+			merged++
+		}
+		fm.audit.Log(ctx, proposalPollerActor, "proposal."+string(state), "proposal", p.ID, p.FlagKey, p.Project,
+			map[string]interface{}{"before": p.State, "after": state},
+			map[string]interface{}{"prUrl": p.PRURL, "branch": p.Branch})
+		slog.InfoContext(ctx, "Proposal resolved", "pr_url", p.PRURL, "project", p.Project, "flag", p.FlagKey, "state", state)
+	}
+
+	if merged > 0 && fm.config.ProposalAutoRefresh {
+		fm.scheduleRelayRefresh(ctx)
+	}
+	return resolved, firstErr
+}
+
+// runProposalPoller polls the state of open proposals every interval until
+// ctx is done.
+func (fm *FlagManager) runProposalPoller(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := fm.pollProposals(ctx)
+			if err != nil {
+				backgroundJobFailuresTotal.Add(1, "job", "proposal_poller")
+			}
+			proposalsResolvedTotal.Add(float64(n))
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+	"flag-manager-api/git"
+)
+
+// recordingProvider is a git.Provider that serves files from a map and
+// records the last PR it was asked to create.
+type recordingProvider struct {
+	files       map[string][]byte
+	title       string
+	description string
+	branch      string
+}
+
+func (p *recordingProvider) GetFile(path string) ([]byte, error) {
+	return p.files[path], nil
+}
+
+func (p *recordingProvider) CreatePR(title, description, sourceBranch, targetBranch string, changes map[string][]byte) (string, error) {
+	p.title = title
+	p.description = description
+	p.branch = sourceBranch
+	return "https://git.example.com/pr/1", nil
+}
+
+func TestPRTemplates(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	createIntegration := func(titleTemplate string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"id":                    "templated",
+			"name":                  "templated",
+			"provider":              "gitlab",
+			"prTitleTemplate":       titleTemplate,
+			"prDescriptionTemplate": "Changed by {{.Actor}} in {{.Project}}",
+		})
+		req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("invalid template rejected", func(t *testing.T) {
+		for _, tmpl := range []string{"[FF] {{.Project", "[FF] {{.Team}}"} {
+			rr := createIntegration(tmpl)
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400 for %q, got %d: %s", tmpl, rr.Code, rr.Body.String())
+			}
+			var resp APIError
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			if resp.Code != "INVALID_PR_TEMPLATE" {
+				t.Errorf("Expected code INVALID_PR_TEMPLATE, got %s", resp.Code)
+			}
+		}
+	})
+
+	t.Run("template applied to proposal", func(t *testing.T) {
+		rr := createIntegration("[FF][{{.Project}}] {{.Action}} {{.Flag}}")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		provider := &recordingProvider{}
+		fm.integrations.providers["templated"] = provider
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"action": "update",
+			"config": FlagConfig{
+				Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+				DefaultRule: &DefaultRule{Variation: "disabled"},
+			},
+		})
+		req := httptest.NewRequest("POST", "/api/projects/web/flags/checkout/propose", bytes.NewReader(body))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		if provider.title != "[FF][web] update checkout" {
+			t.Errorf("Unexpected PR title %q", provider.title)
+		}
+		if provider.description != "Changed by anonymous in web" {
+			t.Errorf("Unexpected PR description %q", provider.description)
+		}
+	})
+}
+
+func TestBranchNameTemplate(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	createIntegration := func(branchTemplate string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{
+			"id":                 "branched",
+			"name":               "branched",
+			"provider":           "gitlab",
+			"branchNameTemplate": branchTemplate,
+		})
+		req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("invalid template rejected", func(t *testing.T) {
+		for _, tmpl := range []string{"ff/{{.Project", "ff/{{.Team}}", "ff branch/{{.Flag}}", "ff/{{.Flag}}.lock", "{{.Missing}}"} {
+			rr := createIntegration(tmpl)
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status 400 for %q, got %d: %s", tmpl, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("template applied and sanitized", func(t *testing.T) {
+		rr := createIntegration("feature/ff/{{.Project}}/{{.Flag}}")
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		provider := &recordingProvider{}
+		fm.integrations.providers["branched"] = provider
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"action": "update",
+			"config": FlagConfig{
+				Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+				DefaultRule: &DefaultRule{Variation: "disabled"},
+			},
+		})
+		req := httptest.NewRequest("POST", "/api/projects/web/flags/checkout/propose", bytes.NewReader(body))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		if provider.branch != "feature/ff/web/checkout" {
+			t.Errorf("Unexpected branch %q", provider.branch)
+		}
+	})
+
+	t.Run("sanitize branch name", func(t *testing.T) {
+		cases := map[string]string{
+			"flag/my project/new~key":  "flag/my-project/new-key",
+			"flag//.hidden/a..b.lock/": "flag/hidden/a.b",
+			"flag/x@{y}:z.":            "flag/x-y}-z",
+		}
+		for in, want := range cases {
+			if got := sanitizeBranchName(in); got != want {
+				t.Errorf("sanitizeBranchName(%q) = %q, want %q", in, got, want)
+			}
+		}
+	})
+}
+
+// statusRecordingProvider is a recordingProvider that also reports the state
+// of the PRs it created.
+type statusRecordingProvider struct {
+	recordingProvider
+	state git.PRState
+}
+
+func (p *statusRecordingProvider) GetPRState(prURL string) (git.PRState, error) {
+	return p.state, nil
+}
+
+func TestProposalTracking(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	var refreshes int32
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&refreshes, 1)
+	}))
+	defer relay.Close()
+	fm.config.RelayProxyURL = relay.URL
+	fm.config.ProposalAutoRefresh = true
+
+	body, _ := json.Marshal(map[string]interface{}{"id": "tracked", "name": "tracked", "provider": "gitlab"})
+	req := httptest.NewRequest("POST", "/api/integrations", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	provider := &statusRecordingProvider{state: git.PRStateOpen}
+	fm.integrations.providers["tracked"] = provider
+
+	propose := func(flag string) string {
+		body, _ := json.Marshal(map[string]interface{}{
+			"action": "update",
+			"config": FlagConfig{
+				Variations:  map[string]interface{}{"enabled": true, "disabled": false},
+				DefaultRule: &DefaultRule{Variation: "disabled"},
+			},
+		})
+		req := httptest.NewRequest("POST", "/api/projects/web/flags/"+flag+"/propose", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		id, _ := resp["proposalId"].(string)
+		if id == "" {
+			t.Fatalf("Expected proposalId in response, got %v", resp)
+		}
+		return id
+	}
+
+	listProposals := func(query string) []db.Proposal {
+		t.Helper()
+		var resp struct {
+			Proposals []db.Proposal `json:"proposals"`
+			Total     int           `json:"total"`
+		}
+		doRequest(t, router, "GET", "/api/proposals"+query, "", http.StatusOK, &resp)
+		if resp.Total != len(resp.Proposals) {
+			t.Errorf("Expected total %d, got %d", len(resp.Proposals), resp.Total)
+		}
+		return resp.Proposals
+	}
+
+	checkoutID := propose("checkout")
+
+	t.Run("proposal recorded as open", func(t *testing.T) {
+		proposals := listProposals("?project=web")
+		if len(proposals) != 1 {
+			t.Fatalf("Expected 1 proposal, got %d", len(proposals))
+		}
+		p := proposals[0]
+		if p.ID != checkoutID || p.FlagKey != "checkout" || p.State != "open" || p.IntegrationID != "tracked" {
+			t.Errorf("Unexpected proposal: %+v", p)
+		}
+		if p.PRURL != "https://git.example.com/pr/1" || p.Branch != provider.branch || p.BaseBranch != "main" {
+			t.Errorf("Unexpected PR details: %+v", p)
+		}
+	})
+
+	t.Run("open PRs stay open", func(t *testing.T) {
+		n, err := fm.pollProposals(context.Background())
+		if err != nil || n != 0 {
+			t.Fatalf("Expected no resolved proposals, got %d, %v", n, err)
+		}
+		if proposals := listProposals("?state=open"); len(proposals) != 1 {
+			t.Errorf("Expected 1 open proposal, got %d", len(proposals))
+		}
+	})
+
+	t.Run("merged PR recorded and relay refreshed", func(t *testing.T) {
+		provider.state = git.PRStateMerged
+		n, err := fm.pollProposals(context.Background())
+		if err != nil || n != 1 {
+			t.Fatalf("Expected 1 resolved proposal, got %d, %v", n, err)
+		}
+
+		proposals := listProposals("?state=merged")
+		if len(proposals) != 1 || proposals[0].ResolvedAt == nil {
+			t.Fatalf("Expected a resolved merged proposal, got %+v", proposals)
+		}
+		if proposals := listProposals("?state=open"); len(proposals) != 0 {
+			t.Errorf("Expected no open proposals, got %d", len(proposals))
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for atomic.LoadInt32(&refreshes) == 0 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if atomic.LoadInt32(&refreshes) == 0 {
+			t.Error("Expected relay proxy refresh after merge")
+		}
+	})
+
+	t.Run("closed PR recorded", func(t *testing.T) {
+		provider.state = git.PRStateOpen
+		propose("banner")
+		provider.state = git.PRStateClosed
+		if n, err := fm.pollProposals(context.Background()); err != nil || n != 1 {
+			t.Fatalf("Expected 1 resolved proposal, got %d, %v", n, err)
+		}
+
+		proposals := listProposals("?flag=banner")
+		if len(proposals) != 1 || proposals[0].State != "closed" {
+			t.Fatalf("Expected banner proposal closed, got %+v", proposals)
+		}
+		if proposals := listProposals(""); len(proposals) != 2 || proposals[0].FlagKey != "banner" {
+			t.Errorf("Expected 2 proposals, newest first, got %+v", proposals)
+		}
+	})
+
+	t.Run("invalid state filter", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/proposals?state=pending", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("persisted across restarts", func(t *testing.T) {
+		reloaded := NewProposalsStore(fm.config.FlagsDir)
+		if proposals := reloaded.List(db.ProposalFilter{}); len(proposals) != 2 {
+			t.Errorf("Expected 2 persisted proposals, got %d", len(proposals))
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"flag-manager-api/db"
+	"flag-manager-api/httpclient"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+)
+
+// newAzureBlobClient returns a client of a target's blob service, authorized
+// with its SAS token or account key. The endpoint defaults to the account's
+// blob service.
+func newAzureBlobClient(c db.PublishTargetConfig) (*azblob.Client, error) {
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", c.AccountName)
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/") + "/"
+	options := &azblob.ClientOptions{ClientOptions: azcore.ClientOptions{Transport: httpclient.Default()}}
+
+	if c.SASToken != "" {
+		return azblob.NewClientWithNoCredential(endpoint+"?"+strings.TrimPrefix(c.SASToken, "?"), options)
+	}
+	cred, err := azblob.NewSharedKeyCredential(c.AccountName, c.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account key: %w", err)
+	}
+	return azblob.NewClientWithSharedKeyCredential(endpoint, cred, options)
+}
+
+// publishAzureBlob uploads the flags file as a block blob.
+func publishAzureBlob(ctx context.Context, client *azblob.Client, c db.PublishTargetConfig, data []byte, contentType string) error {
+	_, err := client.UploadBuffer(ctx, c.Container, strings.TrimPrefix(c.Object, "/"), data, &azblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	})
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"flag-manager-api/db"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// gcsServiceAccountKey is the part of a service account JSON key checked
+// before it is handed to the client.
+type gcsServiceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+}
+
+// validateGCSServiceAccountKey checks that a service account key can get
+// access tokens.
+func validateGCSServiceAccountKey(serviceAccountKey string) error {
+	var key gcsServiceAccountKey
+	if err := json.Unmarshal([]byte(serviceAccountKey), &key); err != nil {
+		return fmt.Errorf("invalid service account key: %w", err)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return errors.New("service account key needs client_email and private_key")
+	}
+	return nil
+}
+
+// newGCSClient returns a client authorized with a target's service account
+// key, or with the application default credentials, such as the workload's
+// service account on GCE and GKE, when it has none.
+func newGCSClient(ctx context.Context, c db.PublishTargetConfig) (*storage.Client, error) {
+	options := []option.ClientOption{option.WithScopes(storage.ScopeReadWrite)}
+	if c.ServiceAccountKey != "" {
+		if err := validateGCSServiceAccountKey(c.ServiceAccountKey); err != nil {
+			return nil, err
+		}
+		options = append(options, option.WithCredentialsJSON([]byte(c.ServiceAccountKey)))
+	}
+	if c.Endpoint != "" {
+		options = append(options, option.WithEndpoint(strings.TrimSuffix(c.Endpoint, "/")+"/storage/v1/"))
+	}
+	return storage.NewClient(ctx, options...)
+}
+
+// publishGCS uploads the flags file in a single request.
+func publishGCS(ctx context.Context, client *storage.Client, c db.PublishTargetConfig, data []byte, contentType string) error {
+	w := client.Bucket(c.Bucket).Object(strings.TrimPrefix(c.Object, "/")).NewWriter(ctx)
+	w.ContentType = contentType
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+
+	"flag-manager-api/db"
+	"flag-manager-api/httpclient"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const s3DefaultRegion = "us-east-1"
+
+// s3TargetCredentials returns the keys of a target, or those of the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables when it has none.
+func s3TargetCredentials(c db.PublishTargetConfig) (aws.Credentials, error) {
+	creds := aws.Credentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken}
+	if creds.AccessKeyID == "" {
+		creds = awsEnvCredentials()
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, errors.New("no S3 credentials: set accessKeyId and secretAccessKey, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return creds, nil
+}
+
+// newS3Client returns a client of a target's bucket: on AWS, or path-style
+// on a custom endpoint such as MinIO.
+func newS3Client(c db.PublishTargetConfig) (*s3.Client, error) {
+	creds, err := s3TargetCredentials(c)
+	if err != nil {
+		return nil, err
+	}
+	options := s3.Options{
+		Region:      c.Region,
+		Credentials: credentials.StaticCredentialsProvider{Value: creds},
+		HTTPClient:  httpclient.Default(),
+	}
+	if options.Region == "" {
+		options.Region = s3DefaultRegion
+	}
+	if c.Endpoint != "" {
+		options.BaseEndpoint = aws.String(c.Endpoint)
+		options.UsePathStyle = true
+		// Not every S3-compatible store checks the SDK's default checksums
+		options.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+	}
+	return s3.New(options), nil
+}
+
+// publishS3 uploads the flags file with a PUT Object request.
+func publishS3(ctx context.Context, client *s3.Client, c db.PublishTargetConfig, data []byte, contentType string) error {
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(c.Bucket),
+		Key:         aws.String(strings.TrimPrefix(c.Object, "/")),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
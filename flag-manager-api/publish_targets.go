@@ -0,0 +1,741 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+	"flag-manager-api/secrets"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errPublishTargetNotFound = errors.New("publish target not found")
+	errPublishTargetExists   = errors.New("publish target already exists")
+)
+
+// publishTargetTimeout bounds each upload, including getting a token.
+const publishTargetTimeout = 30 * time.Second
+
+// publishTargetKinds are the kinds of publish targets.
+var publishTargetKinds = []string{"s3", "gcs", "azblob"}
+
+// PublishTargetsStore manages publish target persistence in file mode
+type PublishTargetsStore struct {
+	filePath string
+	cipher   *secrets.Cipher
+	targets  []db.PublishTarget
+	mu       sync.RWMutex
+}
+
+// NewPublishTargetsStore creates a new publish targets store
+func NewPublishTargetsStore(configDir string, cipher *secrets.Cipher) *PublishTargetsStore {
+	store := &PublishTargetsStore{
+		filePath: filepath.Join(configDir, "publish_targets.json"),
+		cipher:   cipher,
+	}
+	store.load()
+	return store
+}
+
+func (s *PublishTargetsStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := readSealedFile(s.filePath, s.cipher, db.PublishTargetSecretFields)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.targets)
+}
+
+func (s *PublishTargetsStore) save() error {
+	data, err := json.MarshalIndent(s.targets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSealedFile(s.filePath, data, 0600, s.cipher, db.PublishTargetSecretFields)
+}
+
+// nameTaken reports whether a target other than id is named name.
+func (s *PublishTargetsStore) nameTaken(name, id string) bool {
+	for _, target := range s.targets {
+		if target.Name == name && target.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the targets ordered by name
+func (s *PublishTargetsStore) List() []db.PublishTarget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	targets := append([]db.PublishTarget{}, s.targets...)
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Name < targets[j].Name
+	})
+	return targets
+}
+
+// Get returns a target, or errPublishTargetNotFound
+func (s *PublishTargetsStore) Get(id string) (*db.PublishTarget, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, target := range s.targets {
+		if target.ID == id {
+			return &target, nil
+		}
+	}
+	return nil, errPublishTargetNotFound
+}
+
+// Create stores a target and returns it with its ID and timestamps
+func (s *PublishTargetsStore) Create(target db.PublishTarget) (*db.PublishTarget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(target.Name, "") {
+		return nil, errPublishTargetExists
+	}
+	now := time.Now().UTC()
+	target.ID = uuid.New().String()
+	target.CreatedAt = now
+	target.UpdatedAt = now
+	s.targets = append(s.targets, target)
+	if err := s.save(); err != nil {
+		s.targets = s.targets[:len(s.targets)-1]
+		return nil, err
+	}
+	return &target, nil
+}
+
+// Update replaces a target, keeping its ID and creation time
+func (s *PublishTargetsStore) Update(id string, target db.PublishTarget) (*db.PublishTarget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.targets {
+		if existing.ID != id {
+			continue
+		}
+		if s.nameTaken(target.Name, id) {
+			return nil, errPublishTargetExists
+		}
+		target.ID = id
+		target.CreatedAt = existing.CreatedAt
+		target.UpdatedAt = time.Now().UTC()
+		s.targets[i] = target
+		if err := s.save(); err != nil {
+			s.targets[i] = existing
+			return nil, err
+		}
+		return &target, nil
+	}
+	return nil, errPublishTargetNotFound
+}
+
+// Delete removes a target
+func (s *PublishTargetsStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, target := range s.targets {
+		if target.ID != id {
+			continue
+		}
+		previous := s.targets
+		s.targets = append(s.targets[:i:i], s.targets[i+1:]...)
+		if err := s.save(); err != nil {
+			s.targets = previous
+			return err
+		}
+		return nil
+	}
+	return errPublishTargetNotFound
+}
+
+// publishTargetStoreError maps database errors to errPublishTargetNotFound
+// and errPublishTargetExists.
+func publishTargetStoreError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return errPublishTargetNotFound
+	case strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "UNIQUE"):
+		return errPublishTargetExists
+	}
+	return err
+}
+
+func (fm *FlagManager) listPublishTargets(ctx context.Context) ([]db.PublishTarget, error) {
+	if fm.store != nil {
+		return fm.store.ListPublishTargets(ctx)
+	}
+	return fm.publishTargets.List(), nil
+}
+
+func (fm *FlagManager) getPublishTarget(ctx context.Context, id string) (*db.PublishTarget, error) {
+	if fm.store != nil {
+		target, err := fm.store.GetPublishTarget(ctx, id)
+		return target, publishTargetStoreError(err)
+	}
+	return fm.publishTargets.Get(id)
+}
+
+func (fm *FlagManager) createPublishTarget(ctx context.Context, target db.PublishTarget) (*db.PublishTarget, error) {
+	if fm.store != nil {
+		created, err := fm.store.CreatePublishTarget(ctx, target)
+		return created, publishTargetStoreError(err)
+	}
+	return fm.publishTargets.Create(target)
+}
+
+func (fm *FlagManager) updatePublishTarget(ctx context.Context, id string, target db.PublishTarget) (*db.PublishTarget, error) {
+	if fm.store != nil {
+		updated, err := fm.store.UpdatePublishTarget(ctx, id, target)
+		return updated, publishTargetStoreError(err)
+	}
+	return fm.publishTargets.Update(id, target)
+}
+
+func (fm *FlagManager) deletePublishTarget(ctx context.Context, id string) error {
+	if fm.store != nil {
+		return publishTargetStoreError(fm.store.DeletePublishTarget(ctx, id))
+	}
+	return fm.publishTargets.Delete(id)
+}
+
+// reloadPublishTargets hands the configured targets to the publisher.
+func (fm *FlagManager) reloadPublishTargets(ctx context.Context) error {
+	targets, err := fm.listPublishTargets(ctx)
+	if err != nil {
+		return err
+	}
+	fm.publishing.configure(targets)
+	return nil
+}
+
+// writePublishTargetError responds with the status of a publish target store
+// error.
+func writePublishTargetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPublishTargetNotFound):
+		writeError(w, http.StatusNotFound, "PUBLISH_TARGET_NOT_FOUND", "Publish target not found")
+	case errors.Is(err, errPublishTargetExists):
+		writeError(w, http.StatusConflict, "PUBLISH_TARGET_EXISTS", "Publish target with this name already exists")
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+}
+
+// validatePublishTarget checks the name, kind, file and the settings its
+// kind needs.
+func validatePublishTarget(target db.PublishTarget) []string {
+	var errs []string
+	if target.Name == "" {
+		errs = append(errs, "name is required")
+	}
+	c := target.Config
+	if strings.Trim(c.Object, "/") == "" {
+		errs = append(errs, "object is required")
+	}
+	if _, ok := flagFormatContentTypes[c.Format]; c.Format != "" && !ok {
+		errs = append(errs, "format must be one of: json, yaml, toml")
+	}
+	if c.Endpoint != "" {
+		if u, err := url.Parse(c.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, "endpoint must be an http or https URL")
+		}
+	}
+
+	switch target.Kind {
+	case "s3":
+		if c.Bucket == "" {
+			errs = append(errs, "bucket is required")
+		}
+		if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+			errs = append(errs, "accessKeyId and secretAccessKey must be set together")
+		}
+	case "gcs":
+		if c.Bucket == "" {
+			errs = append(errs, "bucket is required")
+		}
+		if c.ServiceAccountKey != "" {
+			if err := validateGCSServiceAccountKey(c.ServiceAccountKey); err != nil {
+				errs = append(errs, "serviceAccountKey: "+err.Error())
+			}
+		}
+	case "azblob":
+		if c.AccountName == "" {
+			errs = append(errs, "accountName is required")
+		}
+		if c.Container == "" {
+			errs = append(errs, "container is required")
+		}
+		if c.AccountKey == "" && c.SASToken == "" {
+			errs = append(errs, "accountKey or sasToken is required")
+		} else if _, err := base64.StdEncoding.DecodeString(c.AccountKey); err != nil {
+			errs = append(errs, "accountKey must be base64")
+		}
+	default:
+		errs = append(errs, "kind must be one of "+strings.Join(publishTargetKinds, ", "))
+	}
+	return errs
+}
+
+// publishTargetSecrets returns the secret settings of a target config.
+func publishTargetSecrets(c *db.PublishTargetConfig) []*string {
+	return []*string{&c.SecretAccessKey, &c.SessionToken, &c.ServiceAccountKey, &c.AccountKey, &c.SASToken}
+}
+
+// maskPublishTarget hides the credentials of a target.
+func maskPublishTarget(target db.PublishTarget) db.PublishTarget {
+	for _, secret := range publishTargetSecrets(&target.Config) {
+		if *secret != "" {
+			*secret = "********"
+		}
+	}
+	return target
+}
+
+// publisher uploads data as an object of a target: the rendered flags file,
+// or its signature.
+type publisher func(ctx context.Context, object string, data []byte, contentType string) error
+
+// newPublisher returns the publisher of a target's kind.
+func newPublisher(target db.PublishTarget) publisher {
+	c := target.Config
+	upload, err := newUploader(target)
+	if err != nil {
+		return func(context.Context, string, []byte, string) error {
+			return err
+		}
+	}
+	return func(ctx context.Context, object string, data []byte, contentType string) error {
+		c := c
+		c.Object = object
+		return upload(ctx, c, data, contentType)
+	}
+}
+
+// uploader writes data to the object of a target config.
+type uploader func(ctx context.Context, c db.PublishTargetConfig, data []byte, contentType string) error
+
+// newUploader returns the uploader of a target's kind, bound to a client of
+// its cloud.
+func newUploader(target db.PublishTarget) (uploader, error) {
+	switch target.Kind {
+	case "s3":
+		client, err := newS3Client(target.Config)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, c db.PublishTargetConfig, data []byte, contentType string) error {
+			return publishS3(ctx, client, c, data, contentType)
+		}, nil
+	case "gcs":
+		client, err := newGCSClient(context.Background(), target.Config)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, c db.PublishTargetConfig, data []byte, contentType string) error {
+			return publishGCS(ctx, client, c, data, contentType)
+		}, nil
+	case "azblob":
+		client, err := newAzureBlobClient(target.Config)
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, c db.PublishTargetConfig, data []byte, contentType string) error {
+			return publishAzureBlob(ctx, client, c, data, contentType)
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid publish target %q", target.Name)
+}
+
+// PublishTargetStatus is the publishing state of a target.
+type PublishTargetStatus struct {
+	Published       int        `json:"published"`
+	Skipped         int        `json:"skipped"` // changes that left the file as last published
+	Failed          int        `json:"failed"`
+	ContentHash     string     `json:"contentHash,omitempty"` // SHA-256 of the file last published
+	LastPublishedAt *time.Time `json:"lastPublishedAt,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+}
+
+// publishTargetState is the publish queue and status of a target. A changed
+// target keeps its state.
+type publishTargetState struct {
+	queue relayRefreshQueue
+
+	mu      sync.Mutex
+	target  db.PublishTarget
+	publish publisher
+	status  PublishTargetStatus
+}
+
+// publishTargetDispatcher publishes the flags to the configured targets. The
+// zero value has no targets and is ready to use.
+type publishTargetDispatcher struct {
+	mu     sync.RWMutex
+	states map[string]*publishTargetState
+}
+
+// configure replaces the targets flags are published to.
+func (d *publishTargetDispatcher) configure(targets []db.PublishTarget) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	states := make(map[string]*publishTargetState, len(targets))
+	for _, target := range targets {
+		s, ok := d.states[target.ID]
+		if !ok {
+			s = &publishTargetState{}
+		}
+		s.mu.Lock()
+		if ok && !sameJSON(s.target.Config, target.Config) {
+			// The file must be written to its new location
+			s.status.ContentHash = ""
+		}
+		s.target = target
+		s.publish = newPublisher(target)
+		s.mu.Unlock()
+		states[target.ID] = s
+	}
+	d.states = states
+}
+
+// sameJSON reports whether two values encode to the same JSON.
+func sameJSON(a, b interface{}) bool {
+	ja, erra := json.Marshal(a)
+	jb, errb := json.Marshal(b)
+	return erra == nil && errb == nil && string(ja) == string(jb)
+}
+
+func (d *publishTargetDispatcher) state(id string) *publishTargetState {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.states[id]
+}
+
+// schedule publishes to every enabled target within window, coalescing the
+// changes made meanwhile per target.
+func (d *publishTargetDispatcher) schedule(ctx context.Context, window time.Duration, publish func(context.Context, *publishTargetState, bool) (bool, error)) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, s := range d.states {
+		s.mu.Lock()
+		enabled := s.target.Enabled
+		s.mu.Unlock()
+		if !enabled {
+			continue
+		}
+		s := s
+		s.queue.schedule(ctx, window, func(ctx context.Context) error {
+			_, err := publish(ctx, s, false)
+			return err
+		})
+	}
+}
+
+// status returns the publishing state of a target.
+func (d *publishTargetDispatcher) status(id string) PublishTargetStatus {
+	s := d.state(id)
+	if s == nil {
+		return PublishTargetStatus{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// renderPublishTarget renders the flags file of a target: the flags of its
+// project, or of all projects, in its format.
+func (fm *FlagManager) renderPublishTarget(ctx context.Context, c db.PublishTargetConfig) ([]byte, string, error) {
+	var flags interface{} = fm.eachServedFlag(ctx)
+	if c.Project != "" {
+		project, err := fm.loadServedProjectFlags(ctx, c.Project)
+		if err == nil && project == nil {
+			err = fmt.Errorf("project %q not found", c.Project)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		flags = project
+	}
+
+	format := c.Format
+	if format == "" {
+		format = "yaml"
+	}
+	data, err := fm.encodeRelayFlags(format, flags, "")
+	return data, flagFormatContentTypes[format], err
+}
+
+// publishToTarget renders and uploads the flags file of a target, unless it
+// is unchanged since the last upload and force is false, followed by its
+// signature if a signing key is set. It reports whether the file was
+// uploaded.
+func (fm *FlagManager) publishToTarget(ctx context.Context, s *publishTargetState, force bool) (bool, error) {
+	s.mu.Lock()
+	target, publish, lastHash := s.target, s.publish, s.status.ContentHash
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTargetTimeout)
+	defer cancel()
+
+	data, contentType, err := fm.renderPublishTarget(ctx, target.Config)
+	hash := sha256Hex(data)
+	if err == nil && !force && hash == lastHash {
+		s.mu.Lock()
+		s.status.Skipped++
+		s.mu.Unlock()
+		return false, nil
+	}
+	if err == nil {
+		err = fm.outbound.Do(func() error {
+			if err := publish(ctx, target.Config.Object, data, contentType); err != nil {
+				return err
+			}
+			return fm.publishSignature(ctx, publish, target.Config.Object, data)
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.status.Failed++
+		s.status.LastError = err.Error()
+		slog.WarnContext(ctx, "Publishing flags failed", "target", target.Name, "kind", target.Kind, "error", err)
+		return false, err
+	}
+	now := time.Now().UTC()
+	s.status.Published++
+	s.status.ContentHash = hash
+	s.status.LastPublishedAt = &now
+	s.status.LastError = ""
+	return true, nil
+}
+
+// publishSignature uploads the signature of a flags file next to it, as
+// <object>.sig.json. Nothing is uploaded without a signing key.
+func (fm *FlagManager) publishSignature(ctx context.Context, publish publisher, object string, data []byte) error {
+	sig, err := fm.signer.sign(data)
+	if err != nil || sig == nil {
+		return err
+	}
+	sidecar, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	return publish(ctx, object+signatureSidecarSuffix, sidecar, flagFormatContentTypes["json"])
+}
+
+// schedulePublish publishes the flags to every enabled target after a
+// change, without waiting for it.
+func (fm *FlagManager) schedulePublish(ctx context.Context) {
+	fm.publishing.schedule(ctx, fm.config.RefreshDebounce, fm.publishToTarget)
+}
+
+// PublishTargetResponse is a target, with its credentials masked, and its
+// publishing state.
+type PublishTargetResponse struct {
+	db.PublishTarget
+	Status PublishTargetStatus `json:"status"`
+}
+
+// PublishTargetsResponse lists the publish targets.
+type PublishTargetsResponse struct {
+	Targets []PublishTargetResponse `json:"targets"`
+	Total   int                     `json:"total"`
+}
+
+func (fm *FlagManager) publishTargetResponse(target db.PublishTarget) PublishTargetResponse {
+	return PublishTargetResponse{PublishTarget: maskPublishTarget(target), Status: fm.publishing.status(target.ID)}
+}
+
+func (fm *FlagManager) listPublishTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	targets, err := fm.listPublishTargets(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	resp := PublishTargetsResponse{Targets: make([]PublishTargetResponse, 0, len(targets)), Total: len(targets)}
+	for _, target := range targets {
+		resp.Targets = append(resp.Targets, fm.publishTargetResponse(target))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (fm *FlagManager) getPublishTargetHandler(w http.ResponseWriter, r *http.Request) {
+	target, err := fm.getPublishTarget(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writePublishTargetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fm.publishTargetResponse(*target))
+}
+
+// decodePublishTarget reads and validates the target of a request body.
+// Empty or masked credentials keep those of previous, if any. It writes the
+// error response and returns false when the target is invalid.
+func decodePublishTarget(w http.ResponseWriter, r *http.Request, previous *db.PublishTarget) (db.PublishTarget, bool) {
+	target := db.PublishTarget{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return target, false
+	}
+	target.Name = strings.TrimSpace(target.Name)
+	if previous != nil {
+		kept := previous.Config
+		keptSecrets := publishTargetSecrets(&kept)
+		for i, secret := range publishTargetSecrets(&target.Config) {
+			if *secret == "" || *secret == "********" {
+				*secret = *keptSecrets[i]
+			}
+		}
+	}
+	if errs := validatePublishTarget(target); len(errs) > 0 {
+		writeValidationError(w, "INVALID_PUBLISH_TARGET", "Publish target is invalid", errs...)
+		return target, false
+	}
+	return target, true
+}
+
+// afterPublishTargetChange applies a target change to the publisher and
+// publishes to new and changed targets.
+func (fm *FlagManager) afterPublishTargetChange(r *http.Request) {
+	if err := fm.reloadPublishTargets(r.Context()); err != nil {
+		slog.WarnContext(r.Context(), "Failed to reload publish targets", "error", err)
+		return
+	}
+	fm.schedulePublish(r.Context())
+}
+
+func (fm *FlagManager) createPublishTargetHandler(w http.ResponseWriter, r *http.Request) {
+	target, ok := decodePublishTarget(w, r, nil)
+	if !ok {
+		return
+	}
+
+	created, err := fm.createPublishTarget(r.Context(), target)
+	if err != nil {
+		writePublishTargetError(w, err)
+		return
+	}
+	fm.afterPublishTargetChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "publish_target.created", "publish_target", created.ID, created.Name, "",
+		map[string]interface{}{"after": maskPublishTarget(*created)}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fm.publishTargetResponse(*created))
+}
+
+func (fm *FlagManager) updatePublishTargetHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	before, err := fm.getPublishTarget(r.Context(), id)
+	if err != nil {
+		writePublishTargetError(w, err)
+		return
+	}
+	target, ok := decodePublishTarget(w, r, before)
+	if !ok {
+		return
+	}
+	updated, err := fm.updatePublishTarget(r.Context(), id, target)
+	if err != nil {
+		writePublishTargetError(w, err)
+		return
+	}
+	fm.afterPublishTargetChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "publish_target.updated", "publish_target", updated.ID, updated.Name, "",
+		map[string]interface{}{"before": maskPublishTarget(*before), "after": maskPublishTarget(*updated)}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fm.publishTargetResponse(*updated))
+}
+
+func (fm *FlagManager) deletePublishTargetHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	existing, err := fm.getPublishTarget(r.Context(), id)
+	if err != nil {
+		writePublishTargetError(w, err)
+		return
+	}
+	if err := fm.deletePublishTarget(r.Context(), id); err != nil {
+		writePublishTargetError(w, err)
+		return
+	}
+	fm.afterPublishTargetChange(r)
+	fm.audit.Log(r.Context(), GetActor(r), "publish_target.deleted", "publish_target", id, existing.Name, "",
+		map[string]interface{}{"before": maskPublishTarget(*existing)}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PublishResponse is the outcome of publishing to a target on demand.
+type PublishResponse struct {
+	Success bool                `json:"success"`
+	Error   string              `json:"error,omitempty"`
+	Status  PublishTargetStatus `json:"status"`
+}
+
+// publishTargetHandler uploads the flags file to a target now, even if it is
+// unchanged or the target is disabled.
+func (fm *FlagManager) publishTargetHandler(w http.ResponseWriter, r *http.Request) {
+	target, err := fm.getPublishTarget(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writePublishTargetError(w, err)
+		return
+	}
+	s := fm.publishing.state(target.ID)
+	if s == nil {
+		// Created on another replica
+		if err := fm.reloadPublishTargets(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if s = fm.publishing.state(target.ID); s == nil {
+			writePublishTargetError(w, errPublishTargetNotFound)
+			return
+		}
+	}
+
+	resp := PublishResponse{Success: true}
+	if _, err := fm.publishToTarget(r.Context(), s, true); err != nil {
+		resp = PublishResponse{Success: false, Error: err.Error()}
+	}
+	resp.Status = fm.publishing.status(target.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestPublishTargets(t *testing.T) {
+	type upload struct {
+		path string
+		name string // of GCS objects
+		body string
+		req  *http.Request
+	}
+	uploads := make(chan upload, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/computeMetadata/v1/instance/service-accounts/default/token":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"access_token":"gcs-token","token_type":"Bearer","expires_in":3600}`))
+			return
+		case strings.HasPrefix(r.URL.Path, "/computeMetadata/"):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		u := upload{path: r.URL.Path, req: r}
+		mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "multipart/related" {
+			// GCS multipart uploads: the object's metadata, then its data
+			parts := multipart.NewReader(r.Body, params["boundary"])
+			var object struct {
+				Name string `json:"name"`
+			}
+			if part, err := parts.NextPart(); err == nil {
+				json.NewDecoder(part).Decode(&object)
+			}
+			if part, err := parts.NextPart(); err == nil {
+				data, _ := io.ReadAll(part)
+				u.body = string(data)
+			}
+			u.name = object.Name
+			json.NewEncoder(w).Encode(map[string]string{"bucket": strings.Split(r.URL.Path, "/")[5], "name": object.Name})
+		} else {
+			data, _ := io.ReadAll(r.Body)
+			u.body = string(data)
+			if r.Header.Get("x-ms-blob-type") != "" {
+				w.WriteHeader(http.StatusCreated)
+			}
+		}
+		uploads <- u
+	}))
+	defer server.Close()
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	var backlog []upload
+	next := func(t *testing.T, path string) upload {
+		t.Helper()
+		if i := slices.IndexFunc(backlog, func(u upload) bool { return u.path == path }); i >= 0 {
+			u := backlog[i]
+			backlog = slices.Delete(backlog, i, i+1)
+			return u
+		}
+		for timeout := time.After(5 * time.Second); ; {
+			select {
+			case u := <-uploads:
+				if u.path == path {
+					return u
+				}
+				backlog = append(backlog, u)
+			case <-timeout:
+				t.Fatalf("Timed out waiting for an upload to %s", path)
+			}
+		}
+	}
+
+	accountKey := base64.StdEncoding.EncodeToString([]byte("azure-account-key"))
+
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			defer fm.publishing.configure(nil)
+
+			doRequest(t, router, "POST", "/api/projects/web/flags/"+mode, `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"bad","kind":"ftp","config":{"object":"flags.yaml"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"bad","kind":"s3","config":{"object":"flags.yaml"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"bad","kind":"s3","config":{"bucket":"b","object":"flags.yaml","format":"xml"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"bad","kind":"gcs","config":{"bucket":"b","object":"flags.yaml","serviceAccountKey":"{}"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"bad","kind":"azblob","config":{"accountName":"a","container":"c","object":"flags.yaml"}}`, http.StatusBadRequest, nil)
+
+			var s3, gcs, azure PublishTargetResponse
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"s3","kind":"s3","config":{"endpoint":"`+server.URL+`","bucket":"flags","object":"/`+mode+`/flags.yaml","project":"web","region":"eu-west-1","accessKeyId":"AKID","secretAccessKey":"s3cret"}}`, http.StatusCreated, &s3)
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"s3","kind":"s3","config":{"endpoint":"`+server.URL+`","bucket":"flags","object":"flags.yaml"}}`, http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"gcs","kind":"gcs","config":{"endpoint":"`+server.URL+`","bucket":"`+mode+`","object":"`+mode+`/flags.json","format":"json"}}`, http.StatusCreated, &gcs)
+			doRequest(t, router, "POST", "/api/publish-targets", `{"name":"azure","kind":"azblob","config":{"endpoint":"`+server.URL+`","accountName":"goff","container":"blobs","object":"`+mode+`/flags.yaml","accountKey":"`+accountKey+`"}}`, http.StatusCreated, &azure)
+			if !s3.Enabled || s3.Config.SecretAccessKey != "********" || azure.Config.AccountKey != "********" {
+				t.Errorf("Expected enabled targets with masked credentials, got %+v and %+v", s3.PublishTarget, azure.PublishTarget)
+			}
+
+			// New targets are published to right away
+			u := next(t, "/flags/"+mode+"/flags.yaml")
+			if u.req.Method != "PUT" || !strings.Contains(u.body, mode+":") {
+				t.Errorf("Expected the project flags to be put, got %s %q", u.req.Method, u.body)
+			}
+			if auth := u.req.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request") {
+				t.Errorf("Expected a SigV4 signature, got %q", auth)
+			}
+
+			u = next(t, "/upload/storage/v1/b/"+mode+"/o")
+			var published map[string]FlagConfig
+			if err := json.Unmarshal([]byte(u.body), &published); err != nil || u.name != mode+"/flags.json" {
+				t.Errorf("Expected the flags as JSON, got %q (%v)", u.body, err)
+			}
+			if u.req.Header.Get("Authorization") != "Bearer gcs-token" {
+				t.Errorf("Expected the metadata server token, got %q", u.req.Header.Get("Authorization"))
+			}
+
+			u = next(t, "/blobs/"+mode+"/flags.yaml")
+			if u.req.Header.Get("x-ms-blob-type") != "BlockBlob" {
+				t.Errorf("Expected a block blob, got %v", u.req.Header)
+			}
+			if auth := u.req.Header.Get("Authorization"); !strings.HasPrefix(auth, "SharedKey goff:") {
+				t.Errorf("Expected a shared key signature, got %q", auth)
+			}
+
+			// Changes in other projects leave the S3 file as published
+			waitStatus := func(id string, done func(PublishTargetStatus) bool) PublishTargetStatus {
+				t.Helper()
+				var target PublishTargetResponse
+				for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+					doRequest(t, router, "GET", "/api/publish-targets/"+id, "", http.StatusOK, &target)
+					if done(target.Status) {
+						return target.Status
+					}
+					if time.Now().After(deadline) {
+						t.Fatalf("Timed out waiting for the publish status, got %+v", target.Status)
+					}
+				}
+			}
+			waitStatus(s3.ID, func(s PublishTargetStatus) bool { return s.Published == 1 })
+			doRequest(t, router, "POST", "/api/projects/other/flags/"+mode, `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+			next(t, "/upload/storage/v1/b/"+mode+"/o")
+			status := waitStatus(s3.ID, func(s PublishTargetStatus) bool { return s.Skipped > 0 })
+			if status.Published != 1 || status.ContentHash == "" || status.LastPublishedAt == nil {
+				t.Errorf("Expected the unchanged file to be skipped, got %+v", status)
+			}
+
+			doRequest(t, router, "PUT", "/api/projects/web/flags/"+mode, `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusOK, nil)
+			if u := next(t, "/flags/"+mode+"/flags.yaml"); !strings.Contains(u.body, `variation: "on"`) {
+				t.Errorf("Expected the changed flag to be published, got %q", u.body)
+			}
+
+			// Publishing on demand uploads unchanged files too
+			var resp PublishResponse
+			doRequest(t, router, "POST", "/api/publish-targets/"+gcs.ID+"/publish", "", http.StatusOK, &resp)
+			if !resp.Success || resp.Status.LastError != "" {
+				t.Errorf("Expected a successful publish, got %+v", resp)
+			}
+			next(t, "/upload/storage/v1/b/"+mode+"/o")
+
+			// Keeping masked credentials keeps the credentials
+			doRequest(t, router, "PUT", "/api/publish-targets/"+azure.ID, `{"name":"azure","kind":"azblob","enabled":false,"config":{"endpoint":"`+server.URL+`","accountName":"goff","container":"blobs","object":"`+mode+`/flags.yaml","accountKey":"********"}}`, http.StatusOK, nil)
+			target, err := fm.getPublishTarget(context.Background(), azure.ID)
+			if err != nil || target.Config.AccountKey != accountKey || target.Enabled {
+				t.Errorf("Expected the disabled target to keep its key, got %+v (%v)", target, err)
+			}
+
+			doRequest(t, router, "DELETE", "/api/publish-targets/"+gcs.ID, "", http.StatusNoContent, nil)
+			doRequest(t, router, "GET", "/api/publish-targets/"+gcs.ID, "", http.StatusNotFound, nil)
+			var list PublishTargetsResponse
+			doRequest(t, router, "GET", "/api/publish-targets", "", http.StatusOK, &list)
+			if list.Total != 2 || list.Targets[0].Name != "azure" || list.Targets[1].Name != "s3" {
+				t.Errorf("Expected the remaining targets by name, got %+v", list)
+			}
+		})
+	}
+}
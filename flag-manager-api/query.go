@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// queryOperators are the comparison operators of the GO Feature Flag targeting
+// query language (nikunjy/rules), in both word and symbol form.
+var queryOperators = map[string]bool{
+	"eq": true, "==": true,
+	"ne": true, "!=": true,
+	"lt": true, "<": true,
+	"gt": true, ">": true,
+	"le": true, "<=": true,
+	"ge": true, ">=": true,
+	"co": true, "sw": true, "ew": true,
+	"in": true, "pr": true,
+}
+
+// queryKeywords are words that can never be attribute names.
+var queryKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "true": true, "false": true, "null": true,
+}
+
+// querySegmentPrefix starts a segment reference in a targeting query,
+// segment:<name>, which stands for the rules of the segment joined by or.
+const querySegmentPrefix = "segment:"
+
+// tokenizeQuery splits a targeting query into tokens. String literals are returned
+// with their quotes so callers can tell them apart from identifiers.
+func tokenizeQuery(query string) []string {
+	spans := tokenizeQuerySpans(query)
+	tokens := make([]string, len(spans))
+	for i, span := range spans {
+		tokens[i] = span.text
+	}
+	return tokens
+}
+
+// querySpan is a query token with its position in the query, in runes.
+type querySpan struct {
+	text       string
+	start, end int
+}
+
+// tokenizeQuerySpans is tokenizeQuery with the position of each token.
+func tokenizeQuerySpans(query string) []querySpan {
+	var tokens []querySpan
+	runes := []rune(query)
+	token := func(start, end int) {
+		tokens = append(tokens, querySpan{text: string(runes[start:end]), start: start, end: end})
+	}
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != c {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(runes) {
+				j++
+			}
+			token(i, min(j, len(runes)))
+			i = j
+		case strings.ContainsRune("()[],", c):
+			token(i, i+1)
+			i++
+		case strings.ContainsRune("=!<>", c):
+			j := i + 1
+			if j < len(runes) && runes[j] == '=' {
+				j++
+			}
+			token(i, j)
+			i = j
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()[],=!<>\"'", runes[j]) {
+				j++
+			}
+			token(i, j)
+			i = j
+		}
+	}
+
+	return tokens
+}
+
+// extractQueryAttributes returns the distinct attribute names referenced on the
+// left-hand side of comparisons in a targeting query, sorted alphabetically.
+// Nested attributes keep their dotted path (e.g. "user.company").
+func extractQueryAttributes(query string) []string {
+	tokens := tokenizeQuery(query)
+	seen := make(map[string]bool)
+
+	for i := 0; i+1 < len(tokens); i++ {
+		tok := tokens[i]
+		if !queryOperators[strings.ToLower(tokens[i+1])] || !isQueryIdentifier(tok) {
+			continue
+		}
+		seen[tok] = true
+	}
+
+	attrs := make([]string, 0, len(seen))
+	for attr := range seen {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+	return attrs
+}
+
+func isQueryIdentifier(tok string) bool {
+	if tok == "" || queryKeywords[strings.ToLower(tok)] || queryOperators[strings.ToLower(tok)] {
+		return false
+	}
+	first := rune(tok[0])
+	return unicode.IsLetter(first) || first == '_' || first == '$'
+}
+
+// validateQuery checks that a targeting query is syntactically valid: comparisons
+// joined by and/or, optionally negated with not and grouped with parentheses.
+func validateQuery(query string) error {
+	_, err := parseQuery(query)
+	return err
+}
+
+// parseQuery parses a targeting query into an expression tree.
+func parseQuery(query string) (queryNode, error) {
+	p := &queryParser{tokens: tokenizeQuery(query)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at token %d", p.tokens[p.pos], p.pos+1)
+	}
+	return node, nil
+}
+
+// queryNode is a parsed targeting query expression.
+type queryNode interface {
+	eval(attrs map[string]interface{}) bool
+}
+
+type queryAnd struct{ left, right queryNode }
+
+func (n queryAnd) eval(attrs map[string]interface{}) bool {
+	return n.left.eval(attrs) && n.right.eval(attrs)
+}
+
+type queryOr struct{ left, right queryNode }
+
+func (n queryOr) eval(attrs map[string]interface{}) bool {
+	return n.left.eval(attrs) || n.right.eval(attrs)
+}
+
+type queryNot struct{ expr queryNode }
+
+func (n queryNot) eval(attrs map[string]interface{}) bool {
+	return !n.expr.eval(attrs)
+}
+
+// querySegmentRef is a segment reference. References are expanded into the
+// rules of their segment before flags are served or evaluated; one left
+// unexpanded, to a missing segment, matches nothing.
+type querySegmentRef struct{ name string }
+
+func (n querySegmentRef) eval(attrs map[string]interface{}) bool { return false }
+
+// querySegments returns the distinct segments a targeting query references,
+// in order of appearance.
+func querySegments(query string) ([]string, error) {
+	node, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	var walk func(n queryNode)
+	walk = func(n queryNode) {
+		switch n := n.(type) {
+		case queryAnd:
+			walk(n.left)
+			walk(n.right)
+		case queryOr:
+			walk(n.left)
+			walk(n.right)
+		case queryNot:
+			walk(n.expr)
+		case querySegmentRef:
+			if !slices.Contains(names, n.name) {
+				names = append(names, n.name)
+			}
+		}
+	}
+	walk(node)
+	return names, nil
+}
+
+// rewriteSegmentReferences replaces the segment references of a targeting
+// query for which replace returns a replacement, leaving the rest of the query
+// as written, and reports whether any was replaced. Queries that do not parse
+// are left alone, so that a name in a string literal or a typo is never taken
+// for a reference.
+func rewriteSegmentReferences(query string, replace func(name string) (string, bool)) (string, bool) {
+	if _, err := parseQuery(query); err != nil {
+		return query, false
+	}
+	runes := []rune(query)
+	var b strings.Builder
+	last, replaced := 0, false
+	for _, span := range tokenizeQuerySpans(query) {
+		name, ok := strings.CutPrefix(span.text, querySegmentPrefix)
+		if !ok {
+			continue
+		}
+		replacement, ok := replace(name)
+		if !ok {
+			continue
+		}
+		b.WriteString(string(runes[last:span.start]))
+		b.WriteString(replacement)
+		last, replaced = span.end, true
+	}
+	if !replaced {
+		return query, false
+	}
+	b.WriteString(string(runes[last:]))
+	return b.String(), true
+}
+
+// queryComparison compares an attribute with one literal, or with a list for in.
+type queryComparison struct {
+	attr   string
+	op     string
+	values []interface{}
+}
+
+// queryParser is a recursive-descent parser over query tokens.
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// expect consumes the given token or fails with what was found instead.
+func (p *queryParser) expect(tok, context string) error {
+	if p.peek() != tok {
+		return p.unexpected("expected " + strconv.Quote(tok) + " " + context)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *queryParser) unexpected(want string) error {
+	if p.pos >= len(p.tokens) {
+		return fmt.Errorf("%s, got end of query", want)
+	}
+	return fmt.Errorf("%s, got %q at token %d", want, p.tokens[p.pos], p.pos+1)
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for tok := strings.ToLower(p.peek()); tok == "or" || tok == "||"; tok = strings.ToLower(p.peek()) {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		node = queryOr{node, right}
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for tok := strings.ToLower(p.peek()); tok == "and" || tok == "&&"; tok = strings.ToLower(p.peek()) {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		node = queryAnd{node, right}
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	switch strings.ToLower(p.peek()) {
+	case "not":
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{expr}, nil
+	case "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(")", "to close group")
+	}
+	if name, ok := strings.CutPrefix(p.peek(), querySegmentPrefix); ok {
+		if err := ValidateSegmentName(name); err != nil {
+			return nil, fmt.Errorf("invalid segment reference at token %d: %w", p.pos+1, err)
+		}
+		p.pos++
+		return querySegmentRef{name}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryNode, error) {
+	attr := p.peek()
+	if !isQueryIdentifier(attr) {
+		return nil, p.unexpected("expected attribute name")
+	}
+	p.pos++
+
+	op := strings.ToLower(p.peek())
+	if !queryOperators[op] {
+		return nil, p.unexpected("expected comparison operator")
+	}
+	p.pos++
+
+	node := queryComparison{attr: attr, op: op}
+	switch op {
+	case "pr":
+		return node, nil
+	case "in":
+		if err := p.expect("[", "after in"); err != nil {
+			return nil, err
+		}
+		for {
+			value, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			node.values = append(node.values, value)
+			if p.peek() != "," {
+				break
+			}
+			p.pos++
+		}
+		return node, p.expect("]", "to close list")
+	}
+
+	value, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	node.values = []interface{}{value}
+	return node, nil
+}
+
+// parseLiteral parses a string, number, boolean or null literal; null is nil.
+func (p *queryParser) parseLiteral() (interface{}, error) {
+	tok := p.peek()
+	if tok != "" && (tok[0] == '"' || tok[0] == '\'') && (len(tok) < 2 || tok[len(tok)-1] != tok[0]) {
+		return nil, fmt.Errorf("unterminated string at token %d", p.pos+1)
+	}
+	value, ok := queryLiteral(tok)
+	if !ok && strings.ToLower(tok) != "null" {
+		return nil, p.unexpected("expected string, number or boolean")
+	}
+	p.pos++
+	return value, nil
+}
+
+// eval applies the comparison to the attribute's value. Comparisons against a
+// missing attribute are false, except ne which is true.
+func (n queryComparison) eval(attrs map[string]interface{}) bool {
+	value, ok := lookupQueryAttribute(attrs, n.attr)
+	if n.op == "pr" {
+		return ok && value != nil
+	}
+	if !ok {
+		return n.op == "ne" || n.op == "!="
+	}
+
+	switch n.op {
+	case "eq", "==":
+		return queryEqual(value, n.values[0])
+	case "ne", "!=":
+		return !queryEqual(value, n.values[0])
+	case "in":
+		for _, v := range n.values {
+			if queryEqual(value, v) {
+				return true
+			}
+		}
+		return false
+	case "co":
+		if list, ok := value.([]interface{}); ok {
+			for _, item := range list {
+				if queryEqual(item, n.values[0]) {
+					return true
+				}
+			}
+			return false
+		}
+		s, sub, ok := queryStrings(value, n.values[0])
+		return ok && strings.Contains(s, sub)
+	case "sw":
+		s, prefix, ok := queryStrings(value, n.values[0])
+		return ok && strings.HasPrefix(s, prefix)
+	case "ew":
+		s, suffix, ok := queryStrings(value, n.values[0])
+		return ok && strings.HasSuffix(s, suffix)
+	}
+
+	cmp, ok := queryCompare(value, n.values[0])
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "lt", "<":
+		return cmp < 0
+	case "gt", ">":
+		return cmp > 0
+	case "le", "<=":
+		return cmp <= 0
+	case "ge", ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// lookupQueryAttribute resolves a possibly dotted attribute path in nested maps.
+func lookupQueryAttribute(attrs map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := attrs[path]; ok {
+		return value, true
+	}
+	var current interface{} = attrs
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// queryNumber converts a JSON number to float64.
+func queryNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func queryStrings(a, b interface{}) (string, string, bool) {
+	sa, ok := a.(string)
+	if !ok {
+		return "", "", false
+	}
+	sb, ok := b.(string)
+	return sa, sb, ok
+}
+
+func queryEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if cmp, ok := queryCompare(a, b); ok {
+		return cmp == 0
+	}
+	if ba, ok := a.(bool); ok {
+		bb, ok := b.(bool)
+		return ok && ba == bb
+	}
+	return false
+}
+
+// queryCompare orders two numbers or two strings; other combinations are not comparable.
+func queryCompare(a, b interface{}) (int, bool) {
+	if na, ok := queryNumber(a); ok {
+		nb, ok := queryNumber(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case na < nb:
+			return -1, true
+		case na > nb:
+			return 1, true
+		}
+		return 0, true
+	}
+	if sa, sb, ok := queryStrings(a, b); ok {
+		return strings.Compare(sa, sb), true
+	}
+	return 0, false
+}
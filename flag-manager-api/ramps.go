@@ -0,0 +1,733 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"flag-manager-api/httpclient"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultRampControllerInterval is how often running ramps are checked and
+// advanced when RAMP_CONTROLLER_INTERVAL is not set.
+const defaultRampControllerInterval = time.Minute
+
+// Ramp statuses.
+const (
+	rampRunning   = "running"   // advanced by the rollout controller
+	rampPaused    = "paused"    // left at its step until resumed
+	rampHalted    = "halted"    // stopped by its metrics check until resumed
+	rampCompleted = "completed" // at its last step
+)
+
+// rampControllerActor is the audit actor of changes made by the rollout
+// controller.
+var rampControllerActor = Actor{ID: "rollout-controller", Name: "rollout-controller", Type: "system"}
+
+// RolloutRamp is a percentage rollout the rollout controller advances step by
+// step: every Interval, the rule serves Variation to the next percentage of
+// Steps and Baseline to the rest. When a metrics check is configured, it is
+// run before every step and on every controller run, and the ramp halts as
+// soon as the value it reports is above the threshold.
+type RolloutRamp struct {
+	Rule           string     `yaml:"rule,omitempty" json:"rule,omitempty"` // targeting rule ramped; empty for the default rule
+	Variation      string     `yaml:"variation" json:"variation"`
+	Baseline       string     `yaml:"baseline" json:"baseline"`
+	Steps          []float64  `yaml:"steps" json:"steps"`       // increasing percentages of Variation, e.g. 5, 25, 50, 100
+	Interval       string     `yaml:"interval" json:"interval"` // time spent at each step ("12h", "1d")
+	Check          *RampCheck `yaml:"check,omitempty" json:"check,omitempty"`
+	RollbackOnHalt bool       `yaml:"rollbackOnHalt,omitempty" json:"rollbackOnHalt,omitempty"` // serve Baseline to everyone when halted
+
+	Status     string `yaml:"status,omitempty" json:"status,omitempty"`
+	Step       int    `yaml:"step" json:"step"`                         // index of the step served
+	StepAt     string `yaml:"stepAt,omitempty" json:"stepAt,omitempty"` // RFC 3339; when the step was reached
+	HaltedAt   string `yaml:"haltedAt,omitempty" json:"haltedAt,omitempty"`
+	HaltReason string `yaml:"haltReason,omitempty" json:"haltReason,omitempty"`
+}
+
+// RampCheck is the metrics check guarding a ramp: a Prometheus query, run
+// against PROMETHEUS_URL, or a webhook, posted a RampCheckRequest and
+// answering {"value": <number>}. The value is typically an error rate.
+type RampCheck struct {
+	Prometheus string  `yaml:"prometheus,omitempty" json:"prometheus,omitempty"`
+	Webhook    string  `yaml:"webhook,omitempty" json:"webhook,omitempty"`
+	Threshold  float64 `yaml:"threshold" json:"threshold"` // the ramp halts when the value is above it
+}
+
+// RampCheckRequest is the payload posted to a ramp's check webhook.
+type RampCheckRequest struct {
+	Project    string  `json:"project"`
+	FlagKey    string  `json:"flagKey"`
+	Variation  string  `json:"variation"`
+	Percentage float64 `json:"percentage"`
+	Step       int     `json:"step"`
+}
+
+// RampCheckResponse is the answer of a ramp's check webhook.
+type RampCheckResponse struct {
+	Value float64 `json:"value"`
+}
+
+// FlagRamp is the ramp of a flag.
+type FlagRamp struct {
+	Project string      `json:"project"`
+	FlagKey string      `json:"flagKey"`
+	Ramp    RolloutRamp `json:"ramp"`
+}
+
+// FlagRampsResponse lists the ramps of every flag.
+type FlagRampsResponse struct {
+	Ramps []FlagRamp `json:"ramps"`
+	Total int        `json:"total"`
+}
+
+// parseRampControllerInterval reads the RAMP_CONTROLLER_INTERVAL setting.
+// Empty values use the default; zero disables the rollout controller. Invalid
+// values keep the default.
+func parseRampControllerInterval(value string) time.Duration {
+	if value == "" {
+		return defaultRampControllerInterval
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid RAMP_CONTROLLER_INTERVAL, using default", "value", value, "default", defaultRampControllerInterval)
+		return defaultRampControllerInterval
+	}
+	if d > 0 && d < time.Second {
+		slog.Warn("RAMP_CONTROLLER_INTERVAL is below 1s, using 1s", "value", d)
+		d = time.Second
+	}
+	return d
+}
+
+// validateRamp checks the ramp of a flag, if any, against its variations and
+// rules.
+func validateRamp(config FlagConfig) []string {
+	ramp := config.Ramp
+	if ramp == nil {
+		return nil
+	}
+	var errors []string
+
+	for _, v := range []struct{ field, name string }{{"variation", ramp.Variation}, {"baseline", ramp.Baseline}} {
+		if v.name == "" {
+			errors = append(errors, fmt.Sprintf("ramp %s is required", v.field))
+		} else if _, ok := config.Variations[v.name]; !ok {
+			errors = append(errors, fmt.Sprintf("ramp %s references unknown variation '%s'", v.field, v.name))
+		}
+	}
+	if ramp.Variation != "" && ramp.Variation == ramp.Baseline {
+		errors = append(errors, "ramp variation and baseline must differ")
+	}
+
+	if ramp.Rule != "" && rampRuleIndex(config, ramp.Rule) < 0 {
+		errors = append(errors, fmt.Sprintf("ramp rule '%s' is not a targeting rule of the flag", ramp.Rule))
+	}
+
+	if len(ramp.Steps) == 0 {
+		errors = append(errors, "ramp needs at least one step")
+	}
+	for i, pct := range ramp.Steps {
+		if pct <= 0 || pct > 100 {
+			errors = append(errors, fmt.Sprintf("ramp step #%d must be above 0 and at most 100", i+1))
+		} else if i > 0 && pct <= ramp.Steps[i-1] {
+			errors = append(errors, fmt.Sprintf("ramp step #%d must be above step #%d", i+1, i))
+		}
+	}
+	if ramp.Step < 0 || (len(ramp.Steps) > 0 && ramp.Step >= len(ramp.Steps)) {
+		errors = append(errors, "ramp step is out of range")
+	}
+
+	if delay, err := parseDuration(ramp.Interval); err != nil {
+		errors = append(errors, "ramp interval: "+err.Error())
+	} else if delay <= 0 {
+		errors = append(errors, "ramp interval must be positive")
+	}
+
+	if check := ramp.Check; check != nil {
+		if (check.Prometheus == "") == (check.Webhook == "") {
+			errors = append(errors, "ramp check needs either a prometheus query or a webhook")
+		}
+		if check.Webhook != "" {
+			u, err := url.Parse(check.Webhook)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errors = append(errors, "ramp check webhook must be an absolute http or https URL")
+			}
+		}
+		if check.Threshold < 0 {
+			errors = append(errors, "ramp check threshold cannot be negative")
+		}
+	}
+
+	switch ramp.Status {
+	case "", rampRunning, rampPaused, rampHalted, rampCompleted:
+	default:
+		errors = append(errors, "ramp status must be running, paused, halted or completed")
+	}
+	if ramp.StepAt != "" {
+		if _, err := time.Parse(time.RFC3339, ramp.StepAt); err != nil {
+			errors = append(errors, "ramp stepAt must be an RFC 3339 timestamp")
+		}
+	}
+
+	return errors
+}
+
+// rampRuleIndex returns the index of the targeting rule named name, or -1.
+func rampRuleIndex(config FlagConfig, name string) int {
+	for i, rule := range config.Targeting {
+		if rule.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// serve makes the ramped rule of config serve the ramp's variation to pct
+// percent and its baseline to the rest. The rules of config are copied, not
+// changed in place.
+func (ramp *RolloutRamp) serve(config *FlagConfig, pct float64) {
+	percentage := map[string]float64{ramp.Variation: pct, ramp.Baseline: 100 - pct}
+	if ramp.Rule == "" {
+		rule := DefaultRule{}
+		if config.DefaultRule != nil {
+			rule = *config.DefaultRule
+		}
+		rule.Variation = ""
+		rule.ProgressiveRollout = nil
+		rule.Percentage = percentage
+		config.DefaultRule = &rule
+		return
+	}
+	if i := rampRuleIndex(*config, ramp.Rule); i >= 0 {
+		config.Targeting = append([]TargetingRule(nil), config.Targeting...)
+		config.Targeting[i].Variation = ""
+		config.Targeting[i].ProgressiveRollout = nil
+		config.Targeting[i].Percentage = percentage
+	}
+}
+
+// due reports whether a running ramp has spent its interval at its step.
+func (ramp *RolloutRamp) due(now time.Time) bool {
+	if ramp.Status != rampRunning || ramp.Step >= len(ramp.Steps)-1 {
+		return false
+	}
+	stepAt, err := time.Parse(time.RFC3339, ramp.StepAt)
+	if err != nil {
+		return true
+	}
+	delay, err := parseDuration(ramp.Interval)
+	return err == nil && !now.Before(stepAt.Add(delay))
+}
+
+// startRamp sets the ramp of config running from its first step.
+func startRamp(config *FlagConfig, now time.Time) {
+	ramp := *config.Ramp
+	ramp.Status = rampRunning
+	ramp.Step = 0
+	ramp.StepAt = now.UTC().Format(time.RFC3339)
+	ramp.HaltedAt = ""
+	ramp.HaltReason = ""
+	if len(ramp.Steps) == 1 {
+		ramp.Status = rampCompleted
+	}
+	ramp.serve(config, ramp.Steps[0])
+	config.Ramp = &ramp
+}
+
+// runRampCheck runs the metrics check of a flag's ramp and returns the value
+// it reports.
+func (fm *FlagManager) runRampCheck(ctx context.Context, project, flagKey string, ramp *RolloutRamp) (float64, error) {
+	if ramp.Check.Prometheus != "" {
+		return fm.queryPrometheus(ctx, ramp.Check.Prometheus)
+	}
+
+	data, err := json.Marshal(RampCheckRequest{
+		Project:    project,
+		FlagKey:    flagKey,
+		Variation:  ramp.Variation,
+		Percentage: ramp.Steps[ramp.Step],
+		Step:       ramp.Step,
+	})
+	if err != nil {
+		return 0, err
+	}
+	var value float64
+	err = fm.outbound.Do(func() error {
+		req, err := http.NewRequestWithContext(ctx, "POST", ramp.Check.Webhook, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := httpclient.Default().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("check webhook returned status %d", resp.StatusCode)
+		}
+		var result RampCheckResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return fmt.Errorf("invalid check webhook response: %w", err)
+		}
+		value = result.Value
+		return nil
+	})
+	return value, err
+}
+
+// queryPrometheus runs an instant query against PROMETHEUS_URL and returns its
+// value: the largest of a vector, or a scalar. Empty and NaN results, as
+// when there is no traffic, are 0.
+func (fm *FlagManager) queryPrometheus(ctx context.Context, query string) (float64, error) {
+	if fm.config.PrometheusURL == "" {
+		return 0, fmt.Errorf("PROMETHEUS_URL is not set")
+	}
+	queryURL := strings.TrimRight(fm.config.PrometheusURL, "/") + "/api/v1/query?query=" + url.QueryEscape(query)
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	err := fm.outbound.Do(func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := httpclient.Default().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil && resp.StatusCode < 300 {
+			return fmt.Errorf("invalid Prometheus response: %w", err)
+		}
+		if resp.StatusCode >= 300 || body.Status != "success" {
+			return fmt.Errorf("Prometheus query failed with status %d: %s", resp.StatusCode, body.Error)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var samples [][2]interface{}
+	switch body.Data.ResultType {
+	case "vector":
+		var vector []struct {
+			Value [2]interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(body.Data.Result, &vector); err != nil {
+			return 0, fmt.Errorf("invalid Prometheus vector: %w", err)
+		}
+		for _, v := range vector {
+			samples = append(samples, v.Value)
+		}
+	case "scalar":
+		var scalar [2]interface{}
+		if err := json.Unmarshal(body.Data.Result, &scalar); err != nil {
+			return 0, fmt.Errorf("invalid Prometheus scalar: %w", err)
+		}
+		samples = append(samples, scalar)
+	default:
+		return 0, fmt.Errorf("unsupported Prometheus result type %q", body.Data.ResultType)
+	}
+
+	value := 0.0
+	for _, sample := range samples {
+		s, _ := sample[1].(string)
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid Prometheus sample value %q", s)
+		}
+		if !math.IsNaN(v) && v > value {
+			value = v
+		}
+	}
+	return value, nil
+}
+
+// advanceProjectRamps runs the checks of the running ramps of a project and
+// advances the ramps that are due, or halts those whose check reports a value
+// above the threshold. Checks run without the project lock; a ramp changed
+// meanwhile is left for the next run. It returns the number of ramps changed.
+func (fm *FlagManager) advanceProjectRamps(ctx context.Context, project string, now time.Time) (int, error) {
+	flags, err := fm.loadStoredProjectFlags(ctx, project)
+	if err != nil || flags == nil {
+		return 0, err
+	}
+
+	type rampCheckResult struct {
+		ramp  RolloutRamp
+		value float64
+		err   error
+	}
+	checks := make(map[string]rampCheckResult)
+	for key, config := range flags {
+		ramp := config.Ramp
+		if ramp == nil || ramp.Status != rampRunning || isArchived(config) || isDraft(config) {
+			continue
+		}
+		result := rampCheckResult{ramp: *ramp}
+		if ramp.Check != nil {
+			result.value, result.err = fm.runRampCheck(ctx, project, key, ramp)
+		} else if !ramp.due(now) {
+			continue
+		}
+		checks[key] = result
+	}
+	if len(checks) == 0 {
+		return 0, nil
+	}
+
+	defer fm.storage.LockProject(project)()
+
+	flags, err = fm.loadStoredProjectFlags(ctx, project)
+	if err != nil || flags == nil {
+		return 0, err
+	}
+
+	type rampChange struct {
+		action   string
+		before   FlagConfig
+		metadata map[string]interface{}
+	}
+	changes := make(map[string]rampChange)
+	var changed []string
+	for key, check := range checks {
+		config, ok := flags[key]
+		if !ok || config.Ramp == nil || config.Ramp.Status != rampRunning ||
+			config.Ramp.Step != check.ramp.Step || config.Ramp.StepAt != check.ramp.StepAt {
+			continue
+		}
+		if check.err != nil {
+			rampCheckFailuresTotal.Add(1)
+			slog.WarnContext(ctx, "Ramp check failed, not advancing", "project", project, "flag", key, "error", check.err)
+			continue
+		}
+
+		after := config
+		ramp := *config.Ramp
+		metadata := map[string]interface{}{"step": ramp.Step, "percentage": ramp.Steps[ramp.Step]}
+		if ramp.Check != nil {
+			metadata["value"] = check.value
+			metadata["threshold"] = ramp.Check.Threshold
+		}
+
+		action := ""
+		switch {
+		case ramp.Check != nil && check.value > ramp.Check.Threshold:
+			action = "flag.ramp_halted"
+			ramp.Status = rampHalted
+			ramp.HaltedAt = now.UTC().Format(time.RFC3339)
+			ramp.HaltReason = fmt.Sprintf("check value %g is above the threshold %g", check.value, ramp.Check.Threshold)
+			if ramp.RollbackOnHalt {
+				ramp.serve(&after, 0)
+			}
+			rampChangesTotal.Add(1, "change", "halted")
+		case ramp.due(now):
+			action = "flag.ramp_advanced"
+			ramp.Step++
+			ramp.StepAt = now.UTC().Format(time.RFC3339)
+			if ramp.Step == len(ramp.Steps)-1 {
+				ramp.Status = rampCompleted
+			}
+			ramp.serve(&after, ramp.Steps[ramp.Step])
+			metadata["step"] = ramp.Step
+			metadata["percentage"] = ramp.Steps[ramp.Step]
+			rampChangesTotal.Add(1, "change", "advanced")
+		default:
+			continue
+		}
+		after.Ramp = &ramp
+		flags[key] = after
+		changes[key] = rampChange{action: action, before: config, metadata: metadata}
+		changed = append(changed, key)
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	sort.Strings(changed)
+
+	flagIDs, err := fm.saveStoredProjectFlags(ctx, project, flags, changed)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range changed {
+		c := changes[key]
+		fm.audit.Log(ctx, rampControllerActor, c.action, "flag", flagIDs[key], key, project,
+			map[string]interface{}{"before": c.before, "after": flags[key]}, c.metadata)
+		slog.InfoContext(ctx, "Ramp changed", "project", project, "flag", key, "action", c.action, "status", flags[key].Ramp.Status)
+	}
+	return len(changed), nil
+}
+
+// advanceRamps runs the rollout controller across all projects and refreshes
+// the relay proxy if any flag changed. A failing project does not stop the
+// others; the first error is returned.
+func (fm *FlagManager) advanceRamps(ctx context.Context, now time.Time) (int, error) {
+	projects, err := fm.listAllProjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var firstErr error
+	for _, project := range projects {
+		n, err := fm.advanceProjectRamps(ctx, project, now)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to advance ramps", "project", project, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		total += n
+	}
+
+	if total > 0 {
+		fm.scheduleRelayRefresh(ctx)
+	}
+	return total, firstErr
+}
+
+// runRolloutController advances and guards ramps every interval. It returns
+// when ctx is done.
+func (fm *FlagManager) runRolloutController(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := fm.advanceRamps(ctx, now); err != nil {
+				backgroundJobFailuresTotal.Add(1, "job", "rollout_controller")
+			}
+		}
+	}
+}
+
+// updateFlagRamp changes the ramp of the request's flag with update, which
+// writes the error response and returns false when the change is refused,
+// then saves the flag as any flag update. The new ramp is returned, or 204
+// when it was removed.
+func (fm *FlagManager) updateFlagRamp(w http.ResponseWriter, r *http.Request, action string, update func(config *FlagConfig, now time.Time) bool) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.loadStoredProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	before, ok := flags[flagKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
+		return
+	}
+	if isArchived(before) {
+		writeError(w, http.StatusConflict, "FLAG_ARCHIVED", "Flag is archived; restore it to change it")
+		return
+	}
+	if !fm.mayChangeFlag(r, before) {
+		writeNotFlagOwner(w, flagKey)
+		return
+	}
+	if fm.flagRequiresApproval(before) && !fm.bypassesApproval(r) {
+		writeError(w, http.StatusConflict, "APPROVAL_REQUIRED", "Flag requires approval; submit the ramp as a change request")
+		return
+	}
+
+	after := before
+	if !update(&after, time.Now()) {
+		return
+	}
+	if errs := ValidateFlagConfig(after); len(errs) > 0 {
+		writeValidationError(w, "INVALID_FLAG_CONFIG", "Flag configuration is invalid", errs...)
+		return
+	}
+
+	flags[flagKey] = after
+	flagIDs, err := fm.saveStoredProjectFlags(r.Context(), project, flags, []string{flagKey})
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "flag.updated", "flag", flagIDs[flagKey], flagKey, project,
+		map[string]interface{}{"before": before, "after": after},
+		map[string]interface{}{"ramp": action})
+	fm.notifyProjectWebhook(r, "flag.updated", project, flagKey, "")
+	fm.syncJiraIssue(r, project, flagKey, &before, &after)
+	fm.scheduleRelayRefresh(r.Context())
+
+	if after.Ramp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after.Ramp)
+}
+
+// listRampsHandler lists the ramps of every flag, optionally only those with
+// ?status=.
+func (fm *FlagManager) listRampsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+
+	projects, err := fm.listAllProjects(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	sort.Strings(projects)
+
+	resp := FlagRampsResponse{Ramps: []FlagRamp{}}
+	for _, project := range projects {
+		flags, err := fm.loadStoredProjectFlags(r.Context(), project)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		keys := make([]string, 0, len(flags))
+		for key, config := range flags {
+			if config.Ramp != nil && (status == "" || config.Ramp.Status == status) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			resp.Ramps = append(resp.Ramps, FlagRamp{Project: project, FlagKey: key, Ramp: *flags[key].Ramp})
+		}
+	}
+	resp.Total = len(resp.Ramps)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (fm *FlagManager) getFlagRampHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	flags, err := fm.loadStoredProjectFlags(r.Context(), vars["project"])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	config, ok := flags[vars["flagKey"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
+		return
+	}
+	if config.Ramp == nil {
+		writeError(w, http.StatusNotFound, "RAMP_NOT_FOUND", "Flag has no ramp")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.Ramp)
+}
+
+// putFlagRampHandler configures the ramp of a flag and starts it from its
+// first step, replacing any previous ramp.
+func (fm *FlagManager) putFlagRampHandler(w http.ResponseWriter, r *http.Request) {
+	var ramp RolloutRamp
+	if err := json.NewDecoder(r.Body).Decode(&ramp); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if ramp.Check != nil && ramp.Check.Prometheus != "" && fm.config.PrometheusURL == "" {
+		writeError(w, http.StatusBadRequest, "PROMETHEUS_NOT_CONFIGURED", "PROMETHEUS_URL must be set for Prometheus checks")
+		return
+	}
+
+	// The controller keeps the state of the ramp
+	ramp.Status, ramp.Step, ramp.StepAt, ramp.HaltedAt, ramp.HaltReason = "", 0, "", "", ""
+
+	fm.updateFlagRamp(w, r, "started", func(config *FlagConfig, now time.Time) bool {
+		config.Ramp = &ramp
+		if errs := validateRamp(*config); len(errs) > 0 {
+			writeValidationError(w, "INVALID_RAMP", "Ramp is invalid", errs...)
+			return false
+		}
+		startRamp(config, now)
+		return true
+	})
+}
+
+// deleteFlagRampHandler removes the ramp of a flag, which keeps serving its
+// current percentages.
+func (fm *FlagManager) deleteFlagRampHandler(w http.ResponseWriter, r *http.Request) {
+	fm.updateFlagRamp(w, r, "removed", func(config *FlagConfig, now time.Time) bool {
+		if config.Ramp == nil {
+			writeError(w, http.StatusNotFound, "RAMP_NOT_FOUND", "Flag has no ramp")
+			return false
+		}
+		config.Ramp = nil
+		return true
+	})
+}
+
+// pauseFlagRampHandler stops the rollout controller from advancing a running
+// ramp.
+func (fm *FlagManager) pauseFlagRampHandler(w http.ResponseWriter, r *http.Request) {
+	fm.updateFlagRamp(w, r, "paused", func(config *FlagConfig, now time.Time) bool {
+		if config.Ramp == nil {
+			writeError(w, http.StatusNotFound, "RAMP_NOT_FOUND", "Flag has no ramp")
+			return false
+		}
+		if config.Ramp.Status != rampRunning {
+			writeError(w, http.StatusConflict, "RAMP_NOT_RUNNING", "Ramp is "+config.Ramp.Status)
+			return false
+		}
+		ramp := *config.Ramp
+		ramp.Status = rampPaused
+		config.Ramp = &ramp
+		return true
+	})
+}
+
+// resumeFlagRampHandler resumes a paused or halted ramp at its step, which
+// is served again and lasts a full interval from now.
+func (fm *FlagManager) resumeFlagRampHandler(w http.ResponseWriter, r *http.Request) {
+	fm.updateFlagRamp(w, r, "resumed", func(config *FlagConfig, now time.Time) bool {
+		if config.Ramp == nil {
+			writeError(w, http.StatusNotFound, "RAMP_NOT_FOUND", "Flag has no ramp")
+			return false
+		}
+		if config.Ramp.Status != rampPaused && config.Ramp.Status != rampHalted {
+			writeError(w, http.StatusConflict, "RAMP_NOT_STOPPED", "Only paused or halted ramps can be resumed; ramp is "+config.Ramp.Status)
+			return false
+		}
+		ramp := *config.Ramp
+		ramp.Status = rampRunning
+		ramp.StepAt = now.UTC().Format(time.RFC3339)
+		ramp.HaltedAt = ""
+		ramp.HaltReason = ""
+		ramp.serve(config, ramp.Steps[ramp.Step])
+		config.Ramp = &ramp
+		return true
+	})
+}
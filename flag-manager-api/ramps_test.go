@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRolloutRamp(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	var checks []RampCheckRequest
+	checkValue, checkStatus := 0.01, http.StatusOK
+	check := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req RampCheckRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		checks = append(checks, req)
+		w.WriteHeader(checkStatus)
+		json.NewEncoder(w).Encode(RampCheckResponse{Value: checkValue})
+	}))
+	defer check.Close()
+
+	doRequest(t, router, "POST", "/api/projects/ramp-tests", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/ramp-tests/flags/checkout", `{"variations":{"on":true,"off":false},"targeting":[{"name":"beta","query":"beta eq true","variation":"off"}],"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+	getFlag := func() FlagConfig {
+		flags, err := fm.readProjectFlags("ramp-tests")
+		if err != nil {
+			t.Fatalf("Failed to read flags: %v", err)
+		}
+		return flags["checkout"]
+	}
+
+	doRequest(t, router, "GET", "/api/projects/ramp-tests/flags/checkout/ramp", "", http.StatusNotFound, nil)
+	doRequest(t, router, "PUT", "/api/projects/ramp-tests/flags/checkout/ramp", `{"variation":"on","baseline":"off","steps":[50,25],"interval":"1d"}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "PUT", "/api/projects/ramp-tests/flags/checkout/ramp", `{"rule":"staff","variation":"on","baseline":"off","steps":[5],"interval":"1d"}`, http.StatusBadRequest, nil)
+	doRequest(t, router, "PUT", "/api/projects/ramp-tests/flags/checkout/ramp", `{"variation":"on","baseline":"off","steps":[5],"interval":"1d","check":{"prometheus":"errors","threshold":0.05}}`, http.StatusBadRequest, nil)
+
+	var ramp RolloutRamp
+	start := time.Now()
+	doRequest(t, router, "PUT", "/api/projects/ramp-tests/flags/checkout/ramp", `{"rule":"beta","variation":"on","baseline":"off","steps":[5,25,50,100],"interval":"1d","check":{"webhook":"`+check.URL+`","threshold":0.05},"rollbackOnHalt":true,"status":"completed","step":3}`, http.StatusOK, &ramp)
+	if ramp.Status != rampRunning || ramp.Step != 0 {
+		t.Fatalf("Expected the ramp to start from its first step, got %+v", ramp)
+	}
+	if rule := getFlag().Targeting[0]; rule.Variation != "" || rule.Percentage["on"] != 5 || rule.Percentage["off"] != 95 {
+		t.Fatalf("Expected the beta rule to serve on to 5%%, got %+v", rule)
+	}
+
+	// The check runs on every run, the ramp only advances once a day
+	if n, err := fm.advanceRamps(context.Background(), start.Add(time.Hour)); err != nil || n != 0 {
+		t.Fatalf("Expected no ramp to advance yet, got %d (%v)", n, err)
+	}
+	if len(checks) != 1 || checks[0].FlagKey != "checkout" || checks[0].Percentage != 5 {
+		t.Errorf("Expected the check webhook to be posted the ramp, got %+v", checks)
+	}
+	if n, err := fm.advanceRamps(context.Background(), start.Add(25*time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Expected the ramp to advance, got %d (%v)", n, err)
+	}
+	if config := getFlag(); config.Ramp.Step != 1 || config.Targeting[0].Percentage["on"] != 25 {
+		t.Fatalf("Expected the ramp at 25%%, got %+v / %+v", config.Ramp, config.Targeting[0])
+	}
+
+	// A failing check holds the ramp, errors above the threshold halt it
+	checkStatus = http.StatusInternalServerError
+	if n, _ := fm.advanceRamps(context.Background(), start.Add(72*time.Hour)); n != 0 {
+		t.Errorf("Expected a failing check to hold the ramp, got %d", n)
+	}
+	checkStatus, checkValue = http.StatusOK, 0.2
+
+	sub := fm.changes.Subscribe()
+	defer fm.changes.Unsubscribe(sub)
+	sub.update([]string{"ramp-tests"}, nil, true)
+
+	if n, err := fm.advanceRamps(context.Background(), start.Add(72*time.Hour)); err != nil || n != 1 {
+		t.Fatalf("Expected the ramp to halt, got %d (%v)", n, err)
+	}
+	config := getFlag()
+	if config.Ramp.Status != rampHalted || config.Ramp.HaltReason == "" || config.Targeting[0].Percentage["on"] != 0 {
+		t.Fatalf("Expected the ramp halted and rolled back, got %+v / %+v", config.Ramp, config.Targeting[0])
+	}
+	select {
+	case data := <-sub.messages:
+		var event ChangeEvent
+		json.Unmarshal(data, &event)
+		if event.Action != "flag.ramp_halted" || event.Actor.Name != "rollout-controller" {
+			t.Errorf("Unexpected audit event %+v", event)
+		}
+	default:
+		t.Error("Expected the halt to be audited")
+	}
+	if n, _ := fm.advanceRamps(context.Background(), start.Add(96*time.Hour)); n != 0 {
+		t.Errorf("Expected a halted ramp to stay halted, got %d", n)
+	}
+
+	// Resuming serves the step again, for a full interval
+	checkValue = 0.01
+	doRequest(t, router, "POST", "/api/projects/ramp-tests/flags/checkout/ramp/pause", "", http.StatusConflict, nil)
+	doRequest(t, router, "POST", "/api/projects/ramp-tests/flags/checkout/ramp/resume", "", http.StatusOK, &ramp)
+	if ramp.Status != rampRunning || ramp.HaltReason != "" || getFlag().Targeting[0].Percentage["on"] != 25 {
+		t.Fatalf("Expected the ramp to resume at 25%%, got %+v", ramp)
+	}
+	doRequest(t, router, "POST", "/api/projects/ramp-tests/flags/checkout/ramp/pause", "", http.StatusOK, &ramp)
+	if n, _ := fm.advanceRamps(context.Background(), start.Add(30*24*time.Hour)); n != 0 {
+		t.Errorf("Expected a paused ramp not to advance, got %d", n)
+	}
+	doRequest(t, router, "POST", "/api/projects/ramp-tests/flags/checkout/ramp/resume", "", http.StatusOK, nil)
+	doRequest(t, router, "POST", "/api/projects/ramp-tests/flags/checkout/ramp/resume", "", http.StatusConflict, nil)
+
+	for _, days := range []int{31, 32} {
+		if n, err := fm.advanceRamps(context.Background(), start.Add(time.Duration(days)*24*time.Hour)); err != nil || n != 1 {
+			t.Fatalf("Expected the ramp to advance, got %d (%v)", n, err)
+		}
+	}
+	config = getFlag()
+	if config.Ramp.Status != rampCompleted || config.Ramp.Step != 3 || config.Targeting[0].Percentage["on"] != 100 {
+		t.Fatalf("Expected the ramp completed at 100%%, got %+v / %+v", config.Ramp, config.Targeting[0])
+	}
+
+	var ramps FlagRampsResponse
+	doRequest(t, router, "GET", "/api/ramps?status=completed", "", http.StatusOK, &ramps)
+	if ramps.Total != 1 || ramps.Ramps[0].FlagKey != "checkout" {
+		t.Errorf("Expected the completed ramp to be listed, got %+v", ramps)
+	}
+	doRequest(t, router, "GET", "/api/ramps?status=running", "", http.StatusOK, &ramps)
+	if ramps.Total != 0 {
+		t.Errorf("Expected no running ramp, got %+v", ramps)
+	}
+
+	// The raw flags, served without authentication, leave the ramp out
+	doRequest(t, router, "PUT", "/api/projects/ramp-tests/flags/checkout/ramp", `{"variation":"on","baseline":"off","steps":[5,100],"interval":"1d","check":{"webhook":"https://hooks.example.com/secret-token","threshold":0.05}}`, http.StatusOK, nil)
+	for _, path := range []string{"/api/flags/raw", "/api/flags/raw/ramp-tests", "/api/flags/raw/ramp-tests?format=json"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if body := rr.Body.String(); rr.Code != http.StatusOK || strings.Contains(body, "baseline") || strings.Contains(body, "secret-token") || !strings.Contains(body, "checkout") {
+			t.Errorf("%s: expected the flag without its ramp, got %d: %s", path, rr.Code, body)
+		}
+	}
+
+	doRequest(t, router, "DELETE", "/api/projects/ramp-tests/flags/checkout/ramp", "", http.StatusNoContent, nil)
+	doRequest(t, router, "DELETE", "/api/projects/ramp-tests/flags/checkout/ramp", "", http.StatusNotFound, nil)
+	if config := getFlag(); config.Ramp != nil || config.DefaultRule.Percentage["on"] != 5 {
+		t.Errorf("Expected the ramp removed and its percentages kept, got %+v", config)
+	}
+
+	// Prometheus checks take the largest value of a vector, and no data as 0
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("query") {
+		case "errors":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"value":[1,"0.02"]},{"value":[1,"0.07"]},{"value":[1,"NaN"]}]}}`))
+		case "idle":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","error":"parse error"}`))
+		}
+	}))
+	defer prometheus.Close()
+	fm.config.PrometheusURL = prometheus.URL
+
+	if v, err := fm.queryPrometheus(context.Background(), "errors"); err != nil || v != 0.07 {
+		t.Errorf("Expected 0.07, got %v (%v)", v, err)
+	}
+	if v, err := fm.queryPrometheus(context.Background(), "idle"); err != nil || v != 0 {
+		t.Errorf("Expected 0, got %v (%v)", v, err)
+	}
+	if _, err := fm.queryPrometheus(context.Background(), "invalid("); err == nil || !strings.Contains(err.Error(), "parse error") {
+		t.Errorf("Expected the query error, got %v", err)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRateLimitRead  = "600/1m"
+	defaultRateLimitWrite = "120/1m"
+
+	defaultRateLimitAuthFailures = "20/1m"
+
+	// rateLimitIdle is how long a client with a full quota is kept.
+	rateLimitIdle = 3 * time.Minute
+)
+
+// RateQuota allows Requests per Period, all of which may be made at once;
+// the quota refills evenly over the period. The zero quota is unlimited.
+type RateQuota struct {
+	Requests int
+	Period   time.Duration
+}
+
+// parseRateQuota reads a quota written as requests/period, as in 600/1m, or
+// "unlimited".
+func parseRateQuota(value string) (RateQuota, error) {
+	value = strings.TrimSpace(value)
+	if value == "unlimited" || value == "0" {
+		return RateQuota{}, nil
+	}
+	requests, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateQuota{}, fmt.Errorf("invalid rate quota %q: expected requests/period, as in 600/1m", value)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return RateQuota{}, fmt.Errorf("invalid rate quota %q: requests must be a non-negative integer", value)
+	}
+	if !strings.ContainsAny(period, "0123456789") {
+		period = "1" + period // 100/s
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return RateQuota{}, fmt.Errorf("invalid rate quota %q: invalid period", value)
+	}
+	if n == 0 {
+		return RateQuota{}, nil
+	}
+	return RateQuota{Requests: n, Period: d}, nil
+}
+
+func (q RateQuota) String() string {
+	if q.Requests == 0 {
+		return "unlimited"
+	}
+	period := q.Period.String()
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+	return strconv.Itoa(q.Requests) + "/" + period
+}
+
+func (q RateQuota) MarshalJSON() ([]byte, error) {
+	return json.Marshal(q.String())
+}
+
+func (q *RateQuota) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := parseRateQuota(value)
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
+
+// RateQuotas are the quotas of a client's reads (GET, HEAD and OPTIONS
+// requests) and writes.
+type RateQuotas struct {
+	Read  RateQuota `json:"read"`
+	Write RateQuota `json:"write"`
+}
+
+// RateLimitConfig sets the quotas of API clients: Clients by client name, as
+// in apikey:<id or name>, user:<id or email>, flagset:<id> or ip:<address>,
+// or for every client of a kind, as in apikey:*. Other clients have Default.
+// AuthFailures is the quota of failed authentications of each address.
+type RateLimitConfig struct {
+	Default      RateQuotas            `json:"default"`
+	Clients      map[string]RateQuotas `json:"clients,omitempty"`
+	AuthFailures RateQuota             `json:"authFailures"`
+}
+
+// parseRateLimitConfig reads RATE_LIMIT_READ and RATE_LIMIT_WRITE, the
+// default quotas, RATE_LIMIT_QUOTAS, a JSON object of the quotas of clients,
+// and RATE_LIMIT_AUTH_FAILURES. A client quota omitting reads or writes has
+// the default one.
+func parseRateLimitConfig(getenv func(string) string) (RateLimitConfig, error) {
+	var config RateLimitConfig
+	var err error
+	read, write := getenv("RATE_LIMIT_READ"), getenv("RATE_LIMIT_WRITE")
+	if read == "" {
+		read = defaultRateLimitRead
+	}
+	if write == "" {
+		write = defaultRateLimitWrite
+	}
+	if config.Default.Read, err = parseRateQuota(read); err != nil {
+		return config, fmt.Errorf("RATE_LIMIT_READ: %w", err)
+	}
+	if config.Default.Write, err = parseRateQuota(write); err != nil {
+		return config, fmt.Errorf("RATE_LIMIT_WRITE: %w", err)
+	}
+	authFailures := getenv("RATE_LIMIT_AUTH_FAILURES")
+	if authFailures == "" {
+		authFailures = defaultRateLimitAuthFailures
+	}
+	if config.AuthFailures, err = parseRateQuota(authFailures); err != nil {
+		return config, fmt.Errorf("RATE_LIMIT_AUTH_FAILURES: %w", err)
+	}
+
+	value := getenv("RATE_LIMIT_QUOTAS")
+	if strings.TrimSpace(value) == "" {
+		return config, nil
+	}
+	var clients map[string]struct {
+		Read  *RateQuota `json:"read"`
+		Write *RateQuota `json:"write"`
+	}
+	if err := json.Unmarshal([]byte(value), &clients); err != nil {
+		return config, fmt.Errorf("invalid RATE_LIMIT_QUOTAS: %w", err)
+	}
+	config.Clients = make(map[string]RateQuotas, len(clients))
+	for name, quotas := range clients {
+		kind, id, _ := strings.Cut(name, ":")
+		switch {
+		case id == "":
+			return config, fmt.Errorf("rate quota %q: expected kind:name, as in apikey:deployer", name)
+		case kind != "apikey" && kind != "user" && kind != "flagset" && kind != "ip":
+			return config, fmt.Errorf("rate quota %q: kind must be apikey, user, flagset or ip", name)
+		}
+		q := config.Default
+		if quotas.Read != nil {
+			q.Read = *quotas.Read
+		}
+		if quotas.Write != nil {
+			q.Write = *quotas.Write
+		}
+		config.Clients[name] = q
+	}
+	return config, nil
+}
+
+// rateLimitNames returns the names of the client making a request: the name
+// its quota usage is tracked under first, then those its quota may be set
+// under, most specific first.
+func rateLimitNames(r *http.Request) []string {
+	actor := GetActor(r)
+	switch actor.Type {
+	case "apikey":
+		return []string{"apikey:" + actor.ID, "apikey:" + actor.Name, "apikey:*"}
+	case "user":
+		names := []string{"user:" + actor.ID}
+		if actor.Email != "" {
+			names = append(names, "user:"+actor.Email)
+		}
+		return append(names, "user:*")
+	case "flagset":
+		return []string{"flagset:" + actor.ID, "flagset:*"}
+	}
+	return []string{"ip:" + clientIP(r), "ip:*"}
+}
+
+// clientIP returns the address a request came from, the first one in
+// X-Forwarded-For behind a proxy.
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ip, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(ip)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// isReadRequest reports whether a request counts against the read quota.
+func isReadRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+}
+
+// rateLimitClient is the quota usage of a client.
+type rateLimitClient struct {
+	quotas      RateQuotas
+	read, write *rate.Limiter // nil when unlimited
+	lastSeen    time.Time
+}
+
+func newRateBucket(q RateQuota) *rate.Limiter {
+	if q.Requests == 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(float64(q.Requests)/q.Period.Seconds()), q.Requests)
+}
+
+// RateLimitUsage is how much of a quota a client has left.
+type RateLimitUsage struct {
+	Quota        RateQuota `json:"quota"`
+	Remaining    int       `json:"remaining"`
+	ResetSeconds int       `json:"resetSeconds"` // until the quota is full again
+}
+
+func rateUsage(q RateQuota, bucket *rate.Limiter, now time.Time) RateLimitUsage {
+	usage := RateLimitUsage{Quota: q}
+	if bucket == nil {
+		return usage
+	}
+	tokens := bucket.TokensAt(now)
+	usage.Remaining = max(0, int(tokens))
+	usage.ResetSeconds = int(math.Ceil((float64(q.Requests) - tokens) / float64(bucket.Limit())))
+	return usage
+}
+
+// authFailureClient is the failed authentications of an address.
+type authFailureClient struct {
+	bucket   *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter limits the requests of each API key, user, flag set key and,
+// for unauthenticated requests, address, to its quotas, and the failed
+// authentications of each address.
+type rateLimiter struct {
+	config RateLimitConfig
+
+	mu       sync.Mutex
+	clients  map[string]*rateLimitClient
+	failures map[string]*authFailureClient // by address
+	swept    time.Time
+}
+
+func newRateLimiter(config RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		config:   config,
+		clients:  make(map[string]*rateLimitClient),
+		failures: make(map[string]*authFailureClient),
+	}
+}
+
+// quotas returns the quotas of the client with the given names.
+func (l *rateLimiter) quotas(names []string) RateQuotas {
+	for _, name := range names {
+		if q, ok := l.config.Clients[name]; ok {
+			return q
+		}
+	}
+	return l.config.Default
+}
+
+// take counts a request against its client's quota, and returns whether it
+// is allowed, with the quota usage after it and how long until the next
+// request is allowed if it is not.
+func (l *rateLimiter) take(r *http.Request, now time.Time) (RateLimitUsage, time.Duration, bool) {
+	names := rateLimitNames(r)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= time.Minute {
+		l.sweep(now)
+	}
+
+	c := l.clients[names[0]]
+	if c == nil {
+		quotas := l.quotas(names)
+		c = &rateLimitClient{quotas: quotas, read: newRateBucket(quotas.Read), write: newRateBucket(quotas.Write)}
+		l.clients[names[0]] = c
+	}
+	c.lastSeen = now
+
+	q, bucket := c.quotas.Write, c.write
+	if isReadRequest(r) {
+		q, bucket = c.quotas.Read, c.read
+	}
+	if bucket == nil {
+		return rateUsage(q, nil, now), 0, true
+	}
+	allowed := bucket.AllowN(now, 1)
+	var retryAfter time.Duration
+	if !allowed {
+		retryAfter = time.Duration((1 - bucket.TokensAt(now)) / float64(bucket.Limit()) * float64(time.Second))
+	}
+	return rateUsage(q, bucket, now), retryAfter, allowed
+}
+
+// sweep forgets the clients and addresses idle with full quotas.
+func (l *rateLimiter) sweep(now time.Time) {
+	l.swept = now
+	for name, c := range l.clients {
+		if now.Sub(c.lastSeen) < rateLimitIdle {
+			continue
+		}
+		if rateUsage(c.quotas.Read, c.read, now).ResetSeconds > 0 || rateUsage(c.quotas.Write, c.write, now).ResetSeconds > 0 {
+			continue
+		}
+		delete(l.clients, name)
+	}
+	for ip, c := range l.failures {
+		if now.Sub(c.lastSeen) >= rateLimitIdle && rateUsage(l.config.AuthFailures, c.bucket, now).ResetSeconds == 0 {
+			delete(l.failures, ip)
+		}
+	}
+}
+
+// authBlocked reports whether an address has used up its quota of failed
+// authentications, and how long until it may try again.
+func (l *rateLimiter) authBlocked(ip string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.failures[ip]
+	if c == nil {
+		return 0, false
+	}
+	tokens := c.bucket.TokensAt(now)
+	if tokens >= 1 {
+		return 0, false
+	}
+	return time.Duration((1 - tokens) / float64(c.bucket.Limit()) * float64(time.Second)), true
+}
+
+// authFailed counts a failed authentication against the quota of its address.
+func (l *rateLimiter) authFailed(ip string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.swept) >= time.Minute {
+		l.sweep(now)
+	}
+	c := l.failures[ip]
+	if c == nil {
+		bucket := newRateBucket(l.config.AuthFailures)
+		if bucket == nil {
+			return
+		}
+		c = &authFailureClient{bucket: bucket}
+		l.failures[ip] = c
+	}
+	c.lastSeen = now
+	c.bucket.AllowN(now, 1)
+}
+
+// authMiddleware rejects the requests of addresses out of their quota of
+// failed authentications with 429 Too Many Requests, and counts the requests
+// failing authentication against it. It runs before AuthMiddleware, so that
+// credentials cannot be guessed faster than the quota allows.
+func (l *rateLimiter) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if retryAfter, blocked := l.authBlocked(ip, time.Now()); blocked {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "RATE_LIMITED", "too many failed authentications")
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == http.StatusUnauthorized {
+			l.authFailed(ip, time.Now())
+		}
+	})
+}
+
+// middleware rejects requests over their client's quota with 429 Too Many
+// Requests, and reports the quota usage in X-RateLimit-* headers. It runs
+// after AuthMiddleware, which identifies the client.
+func (l *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		usage, retryAfter, allowed := l.take(r, time.Now())
+		if usage.Quota.Requests > 0 {
+			h := w.Header()
+			h.Set("X-RateLimit-Limit", strconv.Itoa(usage.Quota.Requests))
+			h.Set("X-RateLimit-Remaining", strconv.Itoa(usage.Remaining))
+			h.Set("X-RateLimit-Reset", strconv.Itoa(usage.ResetSeconds))
+		}
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "RATE_LIMITED", "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitClientStatus is the quota usage of a client.
+type RateLimitClientStatus struct {
+	Client   string         `json:"client"`
+	Read     RateLimitUsage `json:"read"`
+	Write    RateLimitUsage `json:"write"`
+	LastSeen time.Time      `json:"lastSeen"`
+}
+
+// RateLimitsResponse lists the clients seen recently with their quota usage.
+type RateLimitsResponse struct {
+	Config  RateLimitConfig         `json:"config"`
+	Clients []RateLimitClientStatus `json:"clients"`
+	Total   int                     `json:"total"`
+}
+
+func (l *rateLimiter) status(now time.Time) []RateLimitClientStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clients := make([]RateLimitClientStatus, 0, len(l.clients))
+	for name, c := range l.clients {
+		clients = append(clients, RateLimitClientStatus{
+			Client:   name,
+			Read:     rateUsage(c.quotas.Read, c.read, now),
+			Write:    rateUsage(c.quotas.Write, c.write, now),
+			LastSeen: c.lastSeen,
+		})
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Client < clients[j].Client })
+	return clients
+}
+
+// reset gives a client, or every client when name is "", its full quotas
+// back, and returns how many clients it reset. Resetting an address also
+// forgets its failed authentications.
+func (l *rateLimiter) reset(name string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if name == "" {
+		n := len(l.clients)
+		clear(l.clients)
+		clear(l.failures)
+		return n
+	}
+	n := 0
+	if _, ok := l.clients[name]; ok {
+		delete(l.clients, name)
+		n = 1
+	}
+	if ip, ok := strings.CutPrefix(name, "ip:"); ok && l.failures[ip] != nil {
+		delete(l.failures, ip)
+		n = 1
+	}
+	return n
+}
+
+// listRateLimitsHandler returns the rate limit configuration and the quota
+// usage of the clients seen recently.
+func (fm *FlagManager) listRateLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := RateLimitsResponse{Clients: []RateLimitClientStatus{}}
+	if l := fm.rateLimits; l != nil {
+		resp.Config = l.config
+		resp.Clients = l.status(time.Now())
+	}
+	resp.Total = len(resp.Clients)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// resetRateLimitsHandler gives every client its full quotas back.
+func (fm *FlagManager) resetRateLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	if fm.rateLimits != nil {
+		fm.rateLimits.reset("")
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "rate_limit.reset", "rate_limit", "*", "all clients", "", nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resetRateLimitHandler gives a client its full quotas back.
+func (fm *FlagManager) resetRateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	client := mux.Vars(r)["client"]
+	if fm.rateLimits == nil || fm.rateLimits.reset(client) == 0 {
+		writeError(w, http.StatusNotFound, "RATE_LIMIT_CLIENT_NOT_FOUND", "No quota usage is tracked for client "+client)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "rate_limit.reset", "rate_limit", client, client, "", nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
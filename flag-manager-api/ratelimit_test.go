@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimits(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	config, err := parseRateLimitConfig(func(name string) string {
+		return map[string]string{
+			"RATE_LIMIT_READ":          "3/1m",
+			"RATE_LIMIT_WRITE":         "1/h",
+			"RATE_LIMIT_QUOTAS":        `{"user:alice@example.com":{"read":"5/1m"},"apikey:*":{"read":"unlimited","write":"0"}}`,
+			"RATE_LIMIT_AUTH_FAILURES": "2/1m",
+		}[name]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fm.rateLimits = newRateLimiter(config)
+	handler := fm.rateLimits.middleware(setupTestRouter(fm))
+
+	// send makes a request from a client address, as actor unless it is nil
+	send := func(actor *Actor, addr, method, path string, status int) http.Header {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(`{}`))
+		req.RemoteAddr = addr
+		if actor != nil {
+			req = withActor(req, *actor)
+		}
+		return serveRequest(t, handler, req, status, nil).Header()
+	}
+
+	const addr = "192.0.2.1:4711"
+	for remaining := 2; remaining >= 0; remaining-- {
+		h := send(nil, addr, "GET", "/api/projects", http.StatusOK)
+		if h.Get("X-RateLimit-Limit") != "3" || h.Get("X-RateLimit-Remaining") != fmt.Sprint(remaining) || h.Get("X-RateLimit-Reset") == "0" {
+			t.Fatalf("Expected %d reads remaining, got %v", remaining, h)
+		}
+	}
+	if h := send(nil, "192.0.2.1:4712", "GET", "/api/projects", http.StatusTooManyRequests); h.Get("Retry-After") != "20" {
+		t.Errorf("Expected to retry once a read is refilled, got %v", h)
+	}
+	// Writes have their own quota
+	send(nil, addr, "POST", "/api/projects/web", http.StatusCreated)
+	if h := send(nil, addr, "DELETE", "/api/projects/web", http.StatusTooManyRequests); h.Get("Retry-After") != "3600" {
+		t.Errorf("Expected to retry in an hour, got %v", h)
+	}
+	send(nil, "198.51.100.7:80", "GET", "/api/projects", http.StatusOK)
+
+	alice := &Actor{ID: "u-1", Email: "alice@example.com", Type: "user"}
+	if h := send(alice, addr, "GET", "/api/projects", http.StatusOK); h.Get("X-RateLimit-Limit") != "5" {
+		t.Errorf("Expected alice's read quota, got %v", h)
+	}
+	if h := send(alice, addr, "POST", "/api/projects/shop", http.StatusCreated); h.Get("X-RateLimit-Limit") != "1" {
+		t.Errorf("Expected the default write quota, got %v", h)
+	}
+	deployer := &Actor{ID: "k-1", Name: "deployer", Type: "apikey"}
+	for i := 0; i < 5; i++ {
+		if h := send(deployer, addr, "DELETE", "/api/projects/missing", http.StatusNotFound); h.Get("X-RateLimit-Limit") != "" {
+			t.Fatalf("Expected no quota headers for an unlimited key, got %v", h)
+		}
+	}
+
+	var resp RateLimitsResponse
+	serveRequest(t, handler, withActor(httptest.NewRequest("GET", "/api/admin/rate-limits", nil), *deployer), http.StatusOK, &resp)
+	byClient := map[string]RateLimitClientStatus{}
+	for _, c := range resp.Clients {
+		byClient[c.Client] = c
+	}
+	if c := byClient["ip:192.0.2.1"]; c.Read.Remaining != 0 || c.Write.Remaining != 0 || c.Write.Quota.String() != "1/1h" {
+		t.Errorf("Expected the address's quotas used up, got %+v", c)
+	}
+	if c := byClient["user:u-1"]; c.Read.Quota.String() != "5/1m" || c.Read.Remaining != 4 {
+		t.Errorf("Expected alice's usage, got %+v", c)
+	}
+	if _, ok := byClient["apikey:k-1"]; !ok || resp.Config.Default.Read.String() != "3/1m" {
+		t.Errorf("Expected the key and the configuration, got %+v", resp)
+	}
+
+	send(deployer, addr, "DELETE", "/api/admin/rate-limits/ip:192.0.2.1", http.StatusNoContent)
+	send(deployer, addr, "DELETE", "/api/admin/rate-limits/ip:192.0.2.1", http.StatusNotFound)
+	send(nil, addr, "GET", "/api/projects", http.StatusOK)
+	send(deployer, addr, "DELETE", "/api/admin/rate-limits", http.StatusNoContent)
+	if status := fm.rateLimits.status(time.Now()); len(status) != 0 {
+		t.Errorf("Expected every client reset, got %+v", status)
+	}
+
+	// Failed authentications are counted per address before credentials are
+	// checked, so that keys cannot be guessed without limit
+	fm.authEnabled = true
+	defer func() { fm.authEnabled = false }()
+	guarded := fm.rateLimits.authMiddleware(fm.AuthMiddleware(handler))
+	guess := func(addr, key string, status int) http.Header {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/projects", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("X-API-Key", key)
+		return serveRequest(t, guarded, req, status, nil).Header()
+	}
+	const guesser = "203.0.113.5:1234"
+	guess(guesser, "guess-1", http.StatusUnauthorized)
+	guess(guesser, "guess-2", http.StatusUnauthorized)
+	if h := guess(guesser, "guess-3", http.StatusTooManyRequests); h.Get("Retry-After") != "30" {
+		t.Errorf("Expected to retry once a failure is refilled, got %v", h)
+	}
+	guess("203.0.113.6:1234", "guess-4", http.StatusUnauthorized)
+	if n := fm.rateLimits.reset("ip:203.0.113.5"); n != 1 {
+		t.Errorf("Expected the address reset, got %d", n)
+	}
+	guess(guesser, "guess-5", http.StatusUnauthorized)
+
+	for _, value := range []string{"10", "ten/1m", "10/soon", `{"team:x":{}}`} {
+		env := map[string]string{"RATE_LIMIT_READ": value}
+		if value[0] == '{' {
+			env = map[string]string{"RATE_LIMIT_QUOTAS": value}
+		}
+		if _, err := parseRateLimitConfig(func(name string) string { return env[name] }); err == nil {
+			t.Errorf("Expected %s to be rejected", value)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRawFlagsCacheTTL bounds how long a rendered flags file is served
+// without rendering it again, for changes this replica does not see: those
+// made on other replicas or to the files in FLAGS_DIR.
+const defaultRawFlagsCacheTTL = 10 * time.Second
+
+// parseRawFlagsCacheTTL reads RAW_FLAGS_CACHE_TTL; 0 renders every request.
+func parseRawFlagsCacheTTL(value string) time.Duration {
+	if value == "" {
+		return defaultRawFlagsCacheTTL
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid RAW_FLAGS_CACHE_TTL, using default", "value", value, "default", defaultRawFlagsCacheTTL)
+		return defaultRawFlagsCacheTTL
+	}
+	return d
+}
+
+// rawFlagsEntry is a rendered flags file.
+type rawFlagsEntry struct {
+	revision    uint64
+	renderedAt  time.Time
+	data        []byte
+	contentType string
+	etag        string
+	modified    time.Time // when the file last changed
+	signature   *FlagsSignature
+}
+
+// rawFlagsCache keeps the flags files served by the raw flags endpoints, per
+// path, format and environment, until the flags change. The zero value is
+// ready to use.
+type rawFlagsCache struct {
+	mu       sync.Mutex
+	revision uint64 // bumped on every flag change
+	entries  map[string]*rawFlagsEntry
+}
+
+// invalidate marks the cached files as outdated.
+func (c *rawFlagsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.revision++
+}
+
+// lookup returns the entry of key if it is current and younger than ttl,
+// and the revision a new entry must be stored with.
+func (c *rawFlagsCache) lookup(key string, ttl time.Duration) (*rawFlagsEntry, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[key]
+	if entry == nil || entry.revision != c.revision || time.Since(entry.renderedAt) >= ttl {
+		return nil, c.revision
+	}
+	return entry, c.revision
+}
+
+// store caches a rendered file, unless a file rendered after a later change
+// is cached already. An unchanged file keeps its Last-Modified.
+func (c *rawFlagsCache) store(key string, entry *rawFlagsEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	previous := c.entries[key]
+	if previous != nil && previous.etag == entry.etag {
+		entry.modified = previous.modified
+	}
+	if previous != nil && previous.revision > entry.revision {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*rawFlagsEntry)
+	}
+	c.entries[key] = entry
+}
+
+// rawFlagsCacheKey identifies the file served for a request.
+func rawFlagsCacheKey(r *http.Request, format string) string {
+	return r.URL.Path + "?format=" + format + "&environment=" + r.URL.Query().Get("environment")
+}
+
+type rawFlagsRevisionKey struct{}
+
+// serveCachedRawFlags serves the cached flags file of a request, and reports
+// whether it did. Otherwise it returns the request carrying the revision
+// writeRawFlags caches the file it renders with; it is taken before the
+// flags are loaded so that a concurrent change outdates the file.
+func (fm *FlagManager) serveCachedRawFlags(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	format, ok := negotiateFlagFormat(r)
+	if !ok {
+		return r, false
+	}
+	entry, revision := fm.rawFlags.lookup(rawFlagsCacheKey(r, format), fm.config.RawFlagsCacheTTL)
+	if entry == nil {
+		return r.WithContext(context.WithValue(r.Context(), rawFlagsRevisionKey{}, revision)), false
+	}
+	fm.serveRawFlagsEntry(w, r, entry)
+	return r, true
+}
+
+// serveRawFlagsEntry writes a flags file, or 304 Not Modified when the
+// request's If-None-Match or, without it, If-Modified-Since matches it.
+func (fm *FlagManager) serveRawFlagsEntry(w http.ResponseWriter, r *http.Request, entry *rawFlagsEntry) {
+	h := w.Header()
+	h.Set("ETag", entry.etag)
+	h.Set("Last-Modified", entry.modified.Format(http.TimeFormat))
+	h.Add("Vary", "Accept")
+	if entry.signature != nil {
+		entry.signature.setHeaders(h)
+	}
+	fm.rawFlagsFetches.record(r)
+
+	if notModified(r, entry) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", entry.contentType)
+	w.Write(entry.data)
+}
+
+// notModified evaluates the conditional headers of a GET as RFC 9110 does.
+func notModified(r *http.Request, entry *rawFlagsEntry) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == entry.etag {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !entry.modified.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRawFlagsConditionalRequests(t *testing.T) {
+	fm, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	fm.config.RawFlagsCacheTTL = time.Hour
+	router := setupTestRouter(fm)
+
+	get := func(path string, header http.Header, status int) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != status {
+			t.Fatalf("GET %s: expected status %d, got %d: %s", path, status, rr.Code, rr.Body.String())
+		}
+		return rr
+	}
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+	rr := get("/api/flags/raw", nil, http.StatusOK)
+	etag, modified := rr.Header().Get("ETag"), rr.Header().Get("Last-Modified")
+	if etag != `"`+sha256Hex(rr.Body.Bytes())+`"` || modified == "" {
+		t.Fatalf("Expected the content hash as ETag and a Last-Modified, got %v", rr.Header())
+	}
+
+	if rr := get("/api/flags/raw", http.Header{"If-None-Match": {`"other", ` + etag}}, http.StatusNotModified); rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag {
+		t.Errorf("Expected an empty 304 with the ETag, got %v %q", rr.Header(), rr.Body.String())
+	}
+	get("/api/flags/raw", http.Header{"If-None-Match": {"W/" + etag}}, http.StatusNotModified)
+	get("/api/flags/raw", http.Header{"If-Modified-Since": {modified}}, http.StatusNotModified)
+	// If-None-Match takes precedence over If-Modified-Since
+	get("/api/flags/raw", http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {modified}}, http.StatusOK)
+	// Formats are cached apart
+	if rr := get("/api/flags/raw?format=json", http.Header{"If-None-Match": {etag}}, http.StatusOK); rr.Header().Get("ETag") == etag {
+		t.Errorf("Expected JSON to have its own ETag, got %v", rr.Header())
+	}
+
+	// The cached file is served until the flags change, even if the files do
+	projectFile := filepath.Join(tempDir, "web.yaml")
+	data, _ := os.ReadFile(projectFile)
+	os.WriteFile(projectFile, []byte(strings.Replace(string(data), "variation: \"off\"", "variation: \"on\"", 1)), 0644)
+	get("/api/flags/raw", http.Header{"If-None-Match": {etag}}, http.StatusNotModified)
+
+	time.Sleep(time.Second) // Last-Modified has a resolution of a second
+	doRequest(t, router, "PUT", "/api/projects/web/flags/checkout", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusOK, nil)
+	rr = get("/api/flags/raw", http.Header{"If-None-Match": {etag}}, http.StatusOK)
+	if rr.Header().Get("ETag") == etag || rr.Header().Get("Last-Modified") == modified {
+		t.Errorf("Expected a new ETag and Last-Modified after a change, got %v", rr.Header())
+	}
+	get("/api/flags/raw", http.Header{"If-Modified-Since": {modified}}, http.StatusOK)
+
+	// An unchanged file keeps its Last-Modified when rendered again
+	etag, modified = rr.Header().Get("ETag"), rr.Header().Get("Last-Modified")
+	fm.rawFlags.invalidate()
+	time.Sleep(time.Second)
+	if rr := get("/api/flags/raw", nil, http.StatusOK); rr.Header().Get("ETag") != etag || rr.Header().Get("Last-Modified") != modified {
+		t.Errorf("Expected the same ETag and Last-Modified, got %v", rr.Header())
+	}
+	get("/api/flags/raw/web", http.Header{"If-None-Match": {"*"}}, http.StatusNotModified)
+	get("/api/flags/raw/unknown", nil, http.StatusNotFound)
+}
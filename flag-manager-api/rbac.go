@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
 
 	"flag-manager-api/db"
@@ -15,136 +17,446 @@ import (
 func (fm *FlagManager) requirePermission(resource, action string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// If auth is disabled, allow everything
-			if !fm.authEnabled {
-				next.ServeHTTP(w, r)
+			if !fm.allowed(r, permissionCheck{Resource: resource, Action: action}) {
+				writeForbidden(w, resource, action)
 				return
 			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-			// If no database, can't check roles — allow
-			if fm.store == nil {
-				next.ServeHTTP(w, r)
-				return
-			}
+// permissionCheck is a permission a request needs: Action on Resource, within
+// the Project or FlagSet the route names, if any. With AnyScope, a role held
+// in any project or flag set is enough; list routes then only show what the
+// user has a role in.
+type permissionCheck struct {
+	Resource string
+	Action   string
+	Project  string
+	FlagSet  string
+	AnyScope bool
+}
 
-			actor := GetActor(r)
+// actorRoles returns the roles of the user or API key making a request: for
+// users, their assigned roles and those their token maps to. ok is false when
+// permissions are not checked for the request: with auth disabled, without a
+// database to hold roles, for other actors, or before any role is assigned to
+// a user or mapped from tokens, so that the first user can assign roles.
+func (fm *FlagManager) actorRoles(r *http.Request) (roles []db.ScopedRole, ok bool, err error) {
+	if !fm.authEnabled || fm.store == nil {
+		return nil, false, nil
+	}
+	actor := GetActor(r)
+	switch actor.Type {
+	case "apikey":
+		roles, err = fm.apiKeyRoles(r)
+		return roles, true, err
+	case "user":
+	default:
+		return nil, false, nil
+	}
+	mapped, _, err := fm.mappedRoles(r.Context(), actor.RoleClaims)
+	if err != nil || actor.ID == "" {
+		return mapped, true, err
+	}
+	roles, err = fm.store.GetUserRoles(r.Context(), actor.ID)
+	if err == nil && len(roles) == 0 && len(fm.config.RoleMappings) == 0 {
+		if n, err := fm.store.CountRoleAssignments(r.Context()); err == nil && n == 0 {
+			return nil, false, nil
+		}
+	}
+	return append(roles, mapped...), true, err
+}
 
-			// For API key actors, check permissions field on the key
-			if actor.Type == "apikey" {
-				if hasAPIKeyPermission(actor, resource, action) {
-					next.ServeHTTP(w, r)
-					return
-				}
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusForbidden)
-				json.NewEncoder(w).Encode(map[string]interface{}{
-					"error":    "Forbidden",
-					"code":     "FORBIDDEN",
-					"resource": resource,
-					"action":   action,
-				})
-				return
+// allowed reports whether the actor of a request has a permission.
+func (fm *FlagManager) allowed(r *http.Request, check permissionCheck) bool {
+	actor := GetActor(r)
+	if fm.authEnabled && fm.store != nil {
+		switch actor.Type {
+		case "flagset":
+			// Flag set API keys only reach their own flags (see AuthMiddleware)
+			return true
+		case "user", "apikey":
+		default:
+			return false
+		}
+	}
+
+	// Users hold roles through user_roles, API keys through their own role
+	roles, checked, err := fm.actorRoles(r)
+	if !checked {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	for _, role := range roles {
+		if check.AnyScope && role.Grants(check.Resource, check.Action) ||
+			role.GrantsIn(check.Resource, check.Action, check.Project, check.FlagSet) {
+			return true
+		}
+	}
+	return false
+}
+
+// readableIn returns a filter keeping the projects or flag sets in which the
+// actor of a request may read resource, or nil when it may read all of them.
+func (fm *FlagManager) readableIn(r *http.Request, resource string) func(project, flagSetID string) bool {
+	roles, checked, err := fm.actorRoles(r)
+	if !checked {
+		return nil
+	}
+	return func(project, flagSetID string) bool {
+		if err != nil {
+			return false
+		}
+		for _, role := range roles {
+			if role.GrantsIn(resource, "read", project, flagSetID) {
+				return true
 			}
+		}
+		return false
+	}
+}
 
-			// For user actors, check user_roles -> roles -> permissions
-			if actor.ID != "" {
-				allowed, err := fm.store.HasPermission(r.Context(), actor.ID, resource, action)
-				if err == nil && allowed {
-					next.ServeHTTP(w, r)
-					return
-				}
+// routeResources maps API routes, by path template prefix, to the resource
+// they act on. The first matching prefix wins.
+var routeResources = []struct{ prefix, resource string }{
+	{"/api/projects/{project}/flags", "flag"},
+	{"/api/projects/{project}/environments/{environment}/flags", "flag"},
+	{"/api/projects", "project"},
+	{"/api/trash", "project"},
+	{"/api/evaluate", "flag"},
+	{"/api/flags", "flag"},
+	{"/api/search", "flag"},
+	{"/api/tags", "flag"},
+	{"/api/ramps", "flag"},
+	{"/api/diff", "flag"},
+	{"/api/lint", "flag"},
+	{"/api/proposals", "flag"},
+	{"/api/admin/refresh", "flag"},
+	{"/api/relay-proxy", "flag"},
+	{"/api/flagsets", "flagset"},
+	{"/api/segments", "segment"},
+	{"/api/settings", "settings"},
+	{"/api/templates", "template"},
+	{"/api/change-requests", "change_request"},
+	{"/api/integrations", "integration"},
+	{"/api/notifiers", "notifier"},
+	{"/api/notification-rules", "notifier"},
+	{"/api/policies", "policy"},
+	{"/api/exporters", "exporter"},
+	{"/api/publish-targets", "publish_target"},
+	{"/api/retrievers", "retriever"},
+	{"/api/audit", "audit"},
+	{"/api/analytics", "audit"},
+	{"/api/ws", "audit"},
+	{"/api/api-keys", "apikey"},
+	{"/api/roles", "user"},
+	{"/api/users", "user"},
+	{"/api/auth/role-mappings", "user"},
+	{"/api/admin", "*"},
+	{"/api/apply", "*"},
+}
+
+// publicRoutes need no permission: the UI reads its configuration before
+// login, the relay proxy reads raw flags, and the key verifying them, and posts
+// evaluation events, and git hosts post push webhooks, verified by their
+// secret.
+var publicRoutes = map[string]bool{
+	"/api/config":                       true,
+	"/api/flags/raw":                    true,
+	"/api/flags/raw/{project}":          true,
+	"/api/flagsets/{id}/flags/raw":      true,
+	"/api/flags/signing-key":            true,
+	"/api/evaluations":                  true,
+	"/api/webhooks/git/{integrationId}": true,
+}
+
+// readOnlyPosts are POST routes that change nothing, such as evaluations and
+// dry runs, by path template suffix.
+var readOnlyPosts = []string{"/simulate", "/flags/health", "/segments/validate", "/policies/validate", "/lint/flags", "/api/evaluate/{project}/{flagKey}"}
+
+// handlerScopedWrites are write routes acting on the project named in their
+// body, query or stored record rather than in their path. The route needs the
+// permission in some project, and the handler checks it in the project it
+// writes to, see authorizeProject.
+var handlerScopedWrites = map[string]bool{
+	"/api/flags/import":                true,
+	"/api/change-requests":             true,
+	"/api/change-requests/{id}/review": true,
+	"/api/change-requests/{id}/apply":  true,
+	"/api/change-requests/{id}/cancel": true,
+}
+
+// routePermission returns the permission a request needs, from its route: the
+// resource the path names, the action the method implies and the project or
+// flag set the path, or for reads a ?project= parameter, scopes it to. ok is
+// false for routes that need none.
+func routePermission(r *http.Request) (check permissionCheck, ok bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return check, false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil || publicRoutes[template] {
+		return check, false
+	}
+	vars := mux.Vars(r)
+
+	// Users may always see their own permissions
+	if template == "/api/users/{userId}/permissions" && (vars["userId"] == "me" || vars["userId"] == GetActor(r).ID) {
+		return check, false
+	}
+
+	for _, rr := range routeResources {
+		if template == rr.prefix || strings.HasPrefix(template, rr.prefix+"/") {
+			check.Resource = rr.resource
+			break
+		}
+	}
+	if check.Resource == "" {
+		return check, false
+	}
+
+	switch {
+	case template == "/api/users/{userId}/roles" || (check.Resource == "user" && r.Method != http.MethodGet):
+		check.Action = "manage_users"
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		check.Action = "read"
+	case r.Method == http.MethodDelete || strings.HasSuffix(template, "/bulk-delete"):
+		check.Action = "delete"
+	default:
+		check.Action = "write"
+		for _, suffix := range readOnlyPosts {
+			if strings.HasSuffix(template, suffix) {
+				check.Action = "read"
 			}
+		}
+		// Health checks with ?fix= save the flags they repair
+		if strings.HasSuffix(template, "/flags/health") && r.URL.Query().Get("fix") != "" {
+			check.Action = "write"
+		}
+	}
 
-			// No matching permission found
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusForbidden)
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error":    "Forbidden",
-				"code":     "FORBIDDEN",
-				"resource": resource,
-				"action":   action,
-			})
-		})
+	check.Project = vars["project"]
+	if check.Project == "" && check.Action == "read" {
+		check.Project = r.URL.Query().Get("project")
 	}
+	if strings.HasPrefix(template, "/api/flagsets/{id}") {
+		check.FlagSet = vars["id"]
+	}
+	// Lists of projects and flag sets show those the user has a role in
+	check.AnyScope = r.Method == http.MethodGet && (template == "/api/projects" || template == "/api/flagsets") ||
+		check.Action != "read" && handlerScopedWrites[template]
+	return check, true
 }
 
-// hasAPIKeyPermission checks if an API key actor has the required permission.
-// API keys have simple permission strings: "read", "write", "admin".
-func hasAPIKeyPermission(actor Actor, resource, action string) bool {
-	// API key permissions are stored in actor metadata, but we use a simple model:
-	// "admin" grants everything, "write" grants read+write, "read" grants read only.
-	// For now, API keys with "admin" permission can do anything.
-	// The actor.Name field or additional context could carry permission info.
-	// Since the auth middleware doesn't pass API key permissions into the actor struct,
-	// we'll treat all authenticated API keys as having their permissions checked at auth level.
-	// With the existing architecture, API key auth already happened in AuthMiddleware.
-
-	// For simplicity: authenticated API keys pass through.
-	// Fine-grained API key RBAC can be added by storing permissions in actor context.
+// authorize is middleware checking that the actor of an API request has the
+// permission its route needs, see routePermission. It runs after routing, so
+// that the route and its variables are known.
+func (fm *FlagManager) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check, ok := routePermission(r); ok && !fm.allowed(r, check) {
+			writeForbidden(w, check.Resource, check.Action)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeProject checks that the actor of a request may act on resource in
+// the project a handler writes to, sending a 403 response when it may not.
+func (fm *FlagManager) authorizeProject(w http.ResponseWriter, r *http.Request, resource, action, project string) bool {
+	if !fm.allowed(r, permissionCheck{Resource: resource, Action: action, Project: project}) {
+		writeForbidden(w, resource, action)
+		return false
+	}
 	return true
 }
 
-// getUserPermissions returns all permissions for a user.
-func (fm *FlagManager) getUserPermissions(r *http.Request, userID string) ([]db.Permission, error) {
-	roles, err := fm.store.GetUserRoles(r.Context(), userID)
-	if err != nil {
-		return nil, err
+// writeForbidden sends a 403 response naming the missing permission.
+func writeForbidden(w http.ResponseWriter, resource, action string) {
+	writeError(w, http.StatusForbidden, "FORBIDDEN", "Forbidden", "resource: "+resource, "action: "+action)
+}
+
+// fullAccessRole is the role of API keys with the admin permission.
+var fullAccessRole = db.Role{
+	Name:        "full-access",
+	Permissions: []db.Permission{{Resource: "*", Actions: []string{"*"}}},
+}
+
+// apiKeyPermissions maps the permissions of API keys not bound to a role to
+// what they allow: read reads everything, write also changes flags, projects,
+// flag sets and segments, and admin, which must be asked for, allows all.
+var apiKeyPermissions = map[string][]db.Permission{
+	"read": {{Resource: "*", Actions: []string{"read"}}},
+	"write": {
+		{Resource: "*", Actions: []string{"read"}},
+		{Resource: "flag", Actions: []string{"read", "write", "delete"}},
+		{Resource: "project", Actions: []string{"read", "write", "delete"}},
+		{Resource: "flagset", Actions: []string{"read", "write", "delete"}},
+		{Resource: "segment", Actions: []string{"read", "write", "delete"}},
+	},
+	"admin": fullAccessRole.Permissions,
+}
+
+// apiKeyPermissionsRole returns the role of an API key not bound to a role,
+// allowing what its permissions do. Unknown permissions allow nothing.
+func apiKeyPermissionsRole(permissions []string) db.Role {
+	role := db.Role{Name: "api-key"}
+	for _, permission := range permissions {
+		role.Permissions = append(role.Permissions, apiKeyPermissions[permission]...)
+	}
+	return role
+}
+
+// apiKeyRoles returns the roles an API key acts with: its role, or the role of
+// its permissions without one, reduced to reads for read-only keys and
+// assigned in each of the key's projects and flag sets, or globally when it
+// has none.
+func (fm *FlagManager) apiKeyRoles(r *http.Request) ([]db.ScopedRole, error) {
+	key, _ := r.Context().Value(ctxAPIKey).(*db.APIKey)
+	if key == nil {
+		return []db.ScopedRole{{Role: fullAccessRole}}, nil
+	}
+
+	role := apiKeyPermissionsRole(key.Permissions)
+	if key.RoleID != "" {
+		bound, err := fm.store.GetRole(r.Context(), key.RoleID)
+		if err != nil {
+			return nil, err
+		}
+		role = *bound
+	}
+	if key.ReadOnly {
+		role = readOnlyRole(role)
+	}
+
+	if !key.Restricted() {
+		return []db.ScopedRole{{Role: role}}, nil
 	}
+	roles := make([]db.ScopedRole, 0, len(key.Projects)+len(key.FlagSets))
+	for _, project := range key.Projects {
+		roles = append(roles, db.ScopedRole{Role: role, Project: project})
+	}
+	for _, flagSetID := range key.FlagSets {
+		roles = append(roles, db.ScopedRole{Role: role, FlagSet: flagSetID})
+	}
+	return roles, nil
+}
 
+// readOnlyRole returns role without the actions other than read.
+func readOnlyRole(role db.Role) db.Role {
 	var perms []db.Permission
+	for _, perm := range role.Permissions {
+		if slices.Contains(perm.Actions, "read") || slices.Contains(perm.Actions, "*") {
+			perms = append(perms, db.Permission{Resource: perm.Resource, Actions: []string{"read"}})
+		}
+	}
+	role.Permissions = perms
+	return role
+}
+
+// ScopedPermission is the actions a user may take on a resource, everywhere
+// or within a project or flag set.
+type ScopedPermission struct {
+	Resource string   `json:"resource"`
+	Actions  []string `json:"actions"`
+	Project  string   `json:"project,omitempty"`
+	FlagSet  string   `json:"flagSet,omitempty"`
+}
+
+// scopedPermissions merges the permissions of roles by resource and scope,
+// global permissions first.
+func scopedPermissions(roles []db.ScopedRole) []ScopedPermission {
+	perms := []ScopedPermission{}
+	index := make(map[[3]string]int)
 	for _, role := range roles {
-		perms = append(perms, role.Permissions...)
+		for _, perm := range role.Permissions {
+			key := [3]string{role.Project, role.FlagSet, perm.Resource}
+			i, ok := index[key]
+			if !ok {
+				i = len(perms)
+				index[key] = i
+				perms = append(perms, ScopedPermission{Resource: perm.Resource, Actions: []string{}, Project: role.Project, FlagSet: role.FlagSet})
+			}
+			for _, action := range perm.Actions {
+				if !slices.Contains(perms[i].Actions, action) {
+					perms[i].Actions = append(perms[i].Actions, action)
+				}
+			}
+		}
+	}
+	for _, p := range perms {
+		sort.Strings(p.Actions)
 	}
-	return perms, nil
+	sort.SliceStable(perms, func(i, j int) bool {
+		a, b := perms[i], perms[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.FlagSet != b.FlagSet {
+			return a.FlagSet < b.FlagSet
+		}
+		return a.Resource < b.Resource
+	})
+	return perms
 }
 
 // Role management handlers
 
+// RolesResponse lists the roles.
+type RolesResponse struct {
+	Roles []db.Role `json:"roles"`
+}
+
 func (fm *FlagManager) listRolesHandler(w http.ResponseWriter, r *http.Request) {
 	if fm.store == nil {
-		http.Error(w, "Database required for RBAC", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for RBAC")
 		return
 	}
 
 	roles, err := fm.store.ListRoles(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"roles": roles})
+	json.NewEncoder(w).Encode(RolesResponse{Roles: roles})
 }
 
 func (fm *FlagManager) createRoleHandler(w http.ResponseWriter, r *http.Request) {
 	if fm.store == nil {
-		http.Error(w, "Database required for RBAC", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for RBAC")
 		return
 	}
 
 	var role db.Role
 	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if role.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Name is required")
 		return
 	}
 
 	if len(role.Permissions) == 0 {
-		http.Error(w, "At least one permission is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "At least one permission is required")
 		return
 	}
 
 	created, err := fm.store.CreateRole(r.Context(), role)
 	if err != nil {
 		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
-			http.Error(w, "Role with this name already exists", http.StatusConflict)
+			writeError(w, http.StatusConflict, "ROLE_EXISTS", "Role with this name already exists")
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -157,7 +469,7 @@ func (fm *FlagManager) createRoleHandler(w http.ResponseWriter, r *http.Request)
 
 func (fm *FlagManager) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
 	if fm.store == nil {
-		http.Error(w, "Database required for RBAC", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for RBAC")
 		return
 	}
 
@@ -166,21 +478,21 @@ func (fm *FlagManager) updateRoleHandler(w http.ResponseWriter, r *http.Request)
 
 	var role db.Role
 	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	updated, err := fm.store.UpdateRole(r.Context(), id, role)
 	if err != nil {
 		if strings.Contains(err.Error(), "built-in") {
-			http.Error(w, err.Error(), http.StatusForbidden)
+			writeError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
 			return
 		}
 		if strings.Contains(err.Error(), "no rows") {
-			http.Error(w, "Role not found", http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "ROLE_NOT_FOUND", "Role not found")
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -192,7 +504,7 @@ func (fm *FlagManager) updateRoleHandler(w http.ResponseWriter, r *http.Request)
 
 func (fm *FlagManager) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
 	if fm.store == nil {
-		http.Error(w, "Database required for RBAC", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for RBAC")
 		return
 	}
 
@@ -201,14 +513,14 @@ func (fm *FlagManager) deleteRoleHandler(w http.ResponseWriter, r *http.Request)
 
 	if err := fm.store.DeleteRole(r.Context(), id); err != nil {
 		if strings.Contains(err.Error(), "built-in") {
-			http.Error(w, err.Error(), http.StatusForbidden)
+			writeError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
 			return
 		}
 		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, err.Error(), http.StatusNotFound)
+			writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -217,54 +529,143 @@ func (fm *FlagManager) deleteRoleHandler(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// UsersResponse lists the users with their roles.
+type UsersResponse struct {
+	Users []db.UserWithRoles `json:"users"`
+}
+
 func (fm *FlagManager) listUsersHandler(w http.ResponseWriter, r *http.Request) {
 	if fm.store == nil {
-		http.Error(w, "Database required for RBAC", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for RBAC")
 		return
 	}
 
 	users, err := fm.store.ListUsers(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"users": users})
+	json.NewEncoder(w).Encode(UsersResponse{Users: users})
+}
+
+// UserRolesResponse is the roles of a user.
+type UserRolesResponse struct {
+	UserID string          `json:"userId"`
+	Roles  []db.ScopedRole `json:"roles"`
 }
 
 func (fm *FlagManager) setUserRolesHandler(w http.ResponseWriter, r *http.Request) {
 	if fm.store == nil {
-		http.Error(w, "Database required for RBAC", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for RBAC")
 		return
 	}
 
 	vars := mux.Vars(r)
 	userID := vars["userId"]
 
+	// roleIds are global roles; assignments may scope a role to a project or
+	// flag set
 	var body struct {
-		RoleIDs []string `json:"roleIds"`
+		RoleIDs     []string            `json:"roleIds"`
+		Assignments []db.RoleAssignment `json:"assignments,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+
+	assignments := make([]db.RoleAssignment, 0, len(body.RoleIDs)+len(body.Assignments))
+	for _, roleID := range body.RoleIDs {
+		assignments = append(assignments, db.RoleAssignment{RoleID: roleID})
+	}
+	var errs []string
+	for _, a := range body.Assignments {
+		switch {
+		case a.RoleID == "":
+			errs = append(errs, "roleId is required")
+		case a.Project != "" && a.FlagSet != "":
+			errs = append(errs, "a role is assigned in a project or a flag set, not both")
+		case a.Project != "":
+			if err := ValidateProjectName(a.Project); err != nil {
+				errs = append(errs, err.Error())
+			}
+		case a.FlagSet != "":
+			if _, err := fm.store.GetFlagSet(r.Context(), a.FlagSet); err != nil {
+				errs = append(errs, "flag set not found: "+a.FlagSet)
+			}
+		}
+		if slices.Contains(assignments, a) {
+			errs = append(errs, "duplicate assignment of role "+a.RoleID)
+		}
+		assignments = append(assignments, a)
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, "INVALID_ROLE_ASSIGNMENT", "Role assignments are invalid", errs...)
 		return
 	}
 
-	if err := fm.store.SetUserRoles(r.Context(), userID, body.RoleIDs); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := fm.store.SetUserRoleAssignments(r.Context(), userID, assignments); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	fm.audit.Log(r.Context(), GetActor(r), "user.roles_updated", "user", userID, userID, "",
-		map[string]interface{}{"roleIds": body.RoleIDs}, nil)
+		map[string]interface{}{"roleIds": body.RoleIDs, "assignments": body.Assignments}, nil)
 
 	// Return the updated user roles
 	roles, err := fm.store.GetUserRoles(r.Context(), userID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"userId": userID, "roles": roles})
+	json.NewEncoder(w).Encode(UserRolesResponse{UserID: userID, Roles: roles})
+}
+
+// UserPermissionsResponse is the roles of a user and the permissions they
+// grant, by scope, so that the UI can hide actions the user may not take.
+type UserPermissionsResponse struct {
+	UserID      string             `json:"userId"`
+	Roles       []db.ScopedRole    `json:"roles"`
+	Permissions []ScopedPermission `json:"permissions"`
+}
+
+// userPermissionsHandler returns the permissions of a user; "me" names the
+// calling user.
+func (fm *FlagManager) userPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	if fm.store == nil {
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for RBAC")
+		return
+	}
+
+	actor := GetActor(r)
+	userID := mux.Vars(r)["userId"]
+	if userID == "me" {
+		userID = actor.ID
+	}
+
+	roles, err := fm.store.GetUserRoles(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	// Only the caller's token is known, so other users' mapped roles are not
+	if userID == actor.ID {
+		mapped, _, err := fm.mappedRoles(r.Context(), actor.RoleClaims)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		roles = append(roles, mapped...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UserPermissionsResponse{
+		UserID:      userID,
+		Roles:       roles,
+		Permissions: scopedPermissions(roles),
+	})
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestScopedRoles(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	fm := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	fm.audit = NewAuditLogger(store, fm.changes)
+	router := setupTestRouter(fm)
+
+	as := func(userID, method, path, body string, status int, v interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if userID != "" {
+			req = req.WithContext(context.WithValue(req.Context(), ctxActor, Actor{ID: userID, Type: "user"}))
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != status {
+			t.Fatalf("%s %s as %q: expected status %d, got %d: %s", method, path, userID, status, rr.Code, rr.Body.String())
+		}
+		if v != nil {
+			json.Unmarshal(rr.Body.Bytes(), v)
+		}
+	}
+	flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+
+	// Before any role is assigned, users have full access
+	fm.authEnabled = true
+	as("first", "GET", "/api/projects", "", http.StatusOK, nil)
+	fm.authEnabled = false
+
+	var roles RolesResponse
+	as("", "GET", "/api/roles", "", http.StatusOK, &roles)
+	roleIDs := make(map[string]string)
+	for _, role := range roles.Roles {
+		roleIDs[role.Name] = role.ID
+	}
+	var mobile FlagSet
+	as("", "POST", "/api/flagsets", `{"name":"mobile"}`, http.StatusCreated, &mobile)
+	as("", "POST", "/api/flagsets", `{"name":"desktop"}`, http.StatusCreated, nil)
+	as("", "POST", "/api/projects/shop", "", http.StatusCreated, nil)
+	as("", "POST", "/api/projects/blog/flags/comments", flag, http.StatusCreated, nil)
+
+	assign := func(userID, body string, status int) {
+		t.Helper()
+		as("", "PUT", "/api/users/"+userID+"/roles", body, status, nil)
+	}
+	assign("dana", `{"assignments":[{"roleId":"`+roleIDs["editor"]+`","project":"shop"},{"roleId":"`+roleIDs["viewer"]+`","flagSet":"`+mobile.ID+`"}]}`, http.StatusOK)
+	assign("vic", `{"roleIds":["`+roleIDs["viewer"]+`"]}`, http.StatusOK)
+	assign("root", `{"roleIds":["`+roleIDs["admin"]+`"]}`, http.StatusOK)
+	assign("olga", `{"roleIds":["`+roleIDs["owner"]+`"]}`, http.StatusOK)
+	assign("erin", `{"assignments":[{"roleId":"`+roleIDs["editor"]+`","project":"shop","flagSet":"`+mobile.ID+`"}]}`, http.StatusBadRequest)
+	assign("erin", `{"assignments":[{"roleId":"`+roleIDs["editor"]+`","flagSet":"missing"}]}`, http.StatusBadRequest)
+
+	fm.authEnabled = true
+	defer func() { fm.authEnabled = false }()
+
+	t.Run("project scope", func(t *testing.T) {
+		as("dana", "POST", "/api/projects/shop/flags/checkout", flag, http.StatusCreated, nil)
+		as("dana", "PUT", "/api/projects/shop/flags/checkout", `{"config":`+flag+`}`, http.StatusOK, nil)
+		as("dana", "GET", "/api/tags?project=shop", "", http.StatusOK, nil)
+		as("dana", "POST", "/api/projects/blog/flags/checkout", flag, http.StatusForbidden, nil)
+		as("dana", "GET", "/api/projects/blog/flags", "", http.StatusForbidden, nil)
+		as("dana", "GET", "/api/search?q=checkout", "", http.StatusForbidden, nil)
+
+		var projects ProjectsResponse
+		as("dana", "GET", "/api/projects", "", http.StatusOK, &projects)
+		if !reflect.DeepEqual(projects.Projects, []string{"shop"}) {
+			t.Errorf("Expected only the project with a role, got %v", projects.Projects)
+		}
+		projects = ProjectsResponse{}
+		as("vic", "GET", "/api/projects", "", http.StatusOK, &projects)
+		if len(projects.Projects) != 2 {
+			t.Errorf("Expected a global viewer to list every project, got %v", projects.Projects)
+		}
+	})
+
+	t.Run("flag set scope", func(t *testing.T) {
+		var flagSets FlagSetsResponse
+		as("dana", "GET", "/api/flagsets", "", http.StatusOK, &flagSets)
+		if len(flagSets.FlagSets) != 1 || flagSets.FlagSets[0].ID != mobile.ID {
+			t.Errorf("Expected only the flag set with a role, got %v", flagSets.FlagSets)
+		}
+		as("dana", "GET", "/api/flagsets/"+mobile.ID+"/flags", "", http.StatusOK, nil)
+		as("dana", "POST", "/api/flagsets/"+mobile.ID+"/flags/banner", flag, http.StatusForbidden, nil)
+	})
+
+	t.Run("projects named by the body or the stored record", func(t *testing.T) {
+		as("dana", "POST", "/api/flags/import?project=shop", `{"project":"blog","flags":[{"key":"evil","type":"boolean"}]}`, http.StatusForbidden, nil)
+		as("dana", "POST", "/api/flags/import", `{"project":"shop","flags":[{"key":"imported","type":"boolean"}]}`, http.StatusCreated, nil)
+		as("dana", "POST", "/api/flags/import?source=launchdarkly&project=blog", `{"items":[]}`, http.StatusForbidden, nil)
+		as("dana", "GET", "/api/projects/blog/flags/evil", "", http.StatusForbidden, nil)
+		as("root", "GET", "/api/projects/blog/flags/evil", "", http.StatusNotFound, nil)
+
+		as("dana", "POST", "/api/change-requests?project=shop", `{"title":"Enable comments","project":"blog","flagKey":"comments"}`, http.StatusForbidden, nil)
+		as("dana", "POST", "/api/change-requests", `{"title":"Enable checkout","project":"shop","flagKey":"checkout"}`, http.StatusCreated, nil)
+		var cr db.ChangeRequest
+		as("root", "POST", "/api/change-requests", `{"title":"Enable comments","project":"blog","flagKey":"comments"}`, http.StatusCreated, &cr)
+		for _, action := range []string{"review", "apply", "cancel"} {
+			as("dana", "POST", "/api/change-requests/"+cr.ID+"/"+action+"?project=shop", `{"decision":"approved"}`, http.StatusForbidden, nil)
+		}
+	})
+
+	t.Run("health fixes", func(t *testing.T) {
+		as("vic", "POST", "/api/projects/blog/flags/health", "", http.StatusOK, nil)
+		as("vic", "POST", "/api/projects/blog/flags/health?fix=normalize", "", http.StatusForbidden, nil)
+		as("root", "POST", "/api/projects/blog/flags/health?fix=normalize", "", http.StatusOK, nil)
+	})
+
+	t.Run("global roles", func(t *testing.T) {
+		as("vic", "GET", "/api/projects/blog/flags", "", http.StatusOK, nil)
+		as("vic", "POST", "/api/projects/blog/flags/other", flag, http.StatusForbidden, nil)
+		as("vic", "POST", "/api/evaluate/blog/comments", `{"context":{"targetingKey":"u1"}}`, http.StatusOK, nil)
+		as("root", "DELETE", "/api/projects/blog/flags/comments", "", http.StatusNoContent, nil)
+		as("nobody", "GET", "/api/projects/shop/flags", "", http.StatusForbidden, nil)
+	})
+
+	t.Run("user management", func(t *testing.T) {
+		as("root", "PUT", "/api/users/dana/roles", `{"roleIds":[]}`, http.StatusForbidden, nil)
+		as("dana", "GET", "/api/users/vic/permissions", "", http.StatusForbidden, nil)
+		as("olga", "GET", "/api/users/dana/permissions", "", http.StatusOK, nil)
+
+		var perms UserPermissionsResponse
+		as("dana", "GET", "/api/users/me/permissions", "", http.StatusOK, &perms)
+		if perms.UserID != "dana" || len(perms.Roles) != 2 {
+			t.Fatalf("Expected dana's two roles, got %+v", perms)
+		}
+		want := ScopedPermission{Resource: "flag", Actions: []string{"delete", "read", "write"}, Project: "shop"}
+		if !slices.ContainsFunc(perms.Permissions, func(p ScopedPermission) bool { return reflect.DeepEqual(p, want) }) {
+			t.Errorf("Expected %+v among %+v", want, perms.Permissions)
+		}
+		for _, p := range perms.Permissions {
+			if p.FlagSet == mobile.ID && !reflect.DeepEqual(p.Actions, []string{"read"}) {
+				t.Errorf("Expected read-only flag set permissions, got %+v", p)
+			}
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+const (
+	// defaultStaleFlagAge is how long a flag may go unchanged before it is
+	// reported as stale when STALE_FLAG_AGE is not set.
+	defaultStaleFlagAge = 90 * 24 * time.Hour
+	// defaultStaleReaperInterval is how often the stale flag reaper runs when
+	// STALE_REAPER_INTERVAL is not set.
+	defaultStaleReaperInterval = time.Hour
+
+	staleReaperActionReport  = "report"
+	staleReaperActionDisable = "disable"
+	staleReaperActionDelete  = "delete"
+)
+
+// staleReaperActor is the audit actor of changes made by the stale flag reaper.
+var staleReaperActor = Actor{ID: "stale-reaper", Name: "stale-reaper", Type: "system"}
+
+// parseStaleFlagAge reads the STALE_FLAG_AGE setting ("90d", "720h"). Empty
+// values use the default; zero disables age-based stale detection.
+func parseStaleFlagAge(value string) time.Duration {
+	if value == "" {
+		return defaultStaleFlagAge
+	}
+	if value == "0" {
+		return 0
+	}
+	d, err := parseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid STALE_FLAG_AGE, using default", "value", value, "default", defaultStaleFlagAge)
+		return defaultStaleFlagAge
+	}
+	return d
+}
+
+// parseStaleReaperInterval reads the STALE_REAPER_INTERVAL setting. Empty
+// values use the default; zero disables the reaper.
+func parseStaleReaperInterval(value string) time.Duration {
+	if value == "" {
+		return defaultStaleReaperInterval
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid STALE_REAPER_INTERVAL, using default", "value", value, "default", defaultStaleReaperInterval)
+		return defaultStaleReaperInterval
+	}
+	if d > 0 && d < time.Minute {
+		slog.Warn("STALE_REAPER_INTERVAL is below 1m, using 1m", "value", d)
+		d = time.Minute
+	}
+	return d
+}
+
+// parseStaleReaperAction reads the STALE_REAPER_ACTION setting. Unknown
+// actions fall back to report, which never changes flags.
+func parseStaleReaperAction(value string) string {
+	switch action := strings.ToLower(value); action {
+	case "":
+		return staleReaperActionReport
+	case staleReaperActionReport, staleReaperActionDisable, staleReaperActionDelete:
+		return action
+	default:
+		slog.Warn("Invalid STALE_REAPER_ACTION, using default", "value", value, "default", staleReaperActionReport)
+		return staleReaperActionReport
+	}
+}
+
+// reapProjectStaleFlags finds the stale flags of a project and applies action
+// to the expired ones. Flags that are only long unchanged are reported but
+// never modified, and snoozed flags are left alone. It returns the number of
+// stale flags found and of flags changed.
+func (fm *FlagManager) reapProjectStaleFlags(ctx context.Context, project, action string, now time.Time) (int, int, error) {
+	if action != staleReaperActionReport {
+		defer fm.storage.LockProject(project)()
+	}
+
+	flags, err := fm.loadStoredProjectFlags(ctx, project)
+	if err != nil || flags == nil {
+		return 0, 0, err
+	}
+	stale, err := fm.projectStaleFlags(ctx, project, flags, fm.config.StaleFlagAge, false, now)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var expired []string
+	for _, entry := range stale {
+		if !flagExpired(flags[entry.Key], now) {
+			continue
+		}
+		if action == staleReaperActionDisable && entry.Disabled {
+			continue
+		}
+		expired = append(expired, entry.Key)
+	}
+	if action == staleReaperActionReport || len(expired) == 0 {
+		return len(stale), 0, nil
+	}
+
+	switch action {
+	case staleReaperActionDisable:
+		before := make(map[string]FlagConfig, len(expired))
+		for _, key := range expired {
+			config := flags[key]
+			before[key] = config
+			disabled := true
+			config.Disable = &disabled
+			flags[key] = config
+		}
+
+		flagIDs := make(map[string]string, len(expired))
+		done := expired
+		if fm.store != nil {
+			// The disabled column must follow the config, so update flags one by
+			// one; flags disabled before a failure are still audited
+			done = nil
+			for _, key := range expired {
+				var configJSON []byte
+				if configJSON, err = json.Marshal(flags[key]); err != nil {
+					break
+				}
+				var flag *db.Flag
+				if flag, err = fm.store.UpdateFlag(ctx, project, key, configJSON, true, flags[key].Version, ""); err != nil {
+					break
+				}
+				flagIDs[key] = flag.ID
+				done = append(done, key)
+			}
+		} else if err = fm.writeProjectFlags(project, flags); err != nil {
+			return len(stale), 0, err
+		}
+
+		revisions := make([]flagRevision, 0, len(done))
+		for _, key := range done {
+			config := flags[key]
+			revisions = append(revisions, flagRevision{Key: key, Action: flagVersionUpdated, Config: &config})
+		}
+		fm.history().record(context.WithValue(ctx, ctxActor, staleReaperActor), project, revisions...)
+
+		for _, key := range done {
+			fm.audit.Log(ctx, staleReaperActor, "flag.expired_disabled", "flag", flagIDs[key], key, project,
+				map[string]interface{}{"before": before[key], "after": flags[key]},
+				map[string]interface{}{"expiresAt": flags[key].ExpiresAt})
+			slog.InfoContext(ctx, "Disabled expired flag", "project", project, "flag", key)
+		}
+		return len(stale), len(done), err
+
+	case staleReaperActionDelete:
+		flagIDs := make(map[string]string, len(expired))
+		done := expired
+		if fm.store != nil {
+			done = nil
+			for _, key := range expired {
+				if existing, err := fm.store.GetFlag(ctx, project, key); err == nil {
+					flagIDs[key] = existing.ID
+				}
+				if err = fm.store.DeleteFlag(ctx, project, key); err != nil {
+					break
+				}
+				done = append(done, key)
+			}
+		} else {
+			remaining := make(ProjectFlags, len(flags))
+			for key, config := range flags {
+				remaining[key] = config
+			}
+			for _, key := range expired {
+				delete(remaining, key)
+			}
+			if err := fm.writeProjectFlags(project, remaining); err != nil {
+				return len(stale), 0, err
+			}
+		}
+
+		revisions := make([]flagRevision, 0, len(done))
+		for _, key := range done {
+			revisions = append(revisions, flagRevision{Key: key, Action: flagVersionDeleted})
+		}
+		fm.history().record(context.WithValue(ctx, ctxActor, staleReaperActor), project, revisions...)
+
+		for _, key := range done {
+			fm.audit.Log(ctx, staleReaperActor, "flag.expired_deleted", "flag", flagIDs[key], key, project,
+				map[string]interface{}{"before": flags[key]},
+				map[string]interface{}{"expiresAt": flags[key].ExpiresAt})
+			slog.InfoContext(ctx, "Deleted expired flag", "project", project, "flag", key)
+		}
+		return len(stale), len(done), err
+	}
+	return len(stale), 0, nil
+}
+
+// reapStaleFlags runs the reaper across all projects and refreshes the relay
+// proxy if any flag changed. A failing project does not stop the others; the
+// first error is returned.
+func (fm *FlagManager) reapStaleFlags(ctx context.Context, action string, now time.Time) (int, int, error) {
+	projects, err := fm.listAllProjects(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	found, changed := 0, 0
+	var firstErr error
+	for _, project := range projects {
+		s, c, err := fm.reapProjectStaleFlags(ctx, project, action, now)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to reap stale flags", "project", project, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		found += s
+		changed += c
+	}
+
+	if found > 0 {
+		slog.InfoContext(ctx, "Stale flag reaper found stale flags", "count", found)
+	}
+	if changed > 0 {
+		slog.InfoContext(ctx, "Stale flag reaper changed expired flags", "count", changed, "action", reaperActionPast(action))
+		fm.scheduleRelayRefresh(ctx)
+	}
+	return found, changed, firstErr
+}
+
+func reaperActionPast(action string) string {
+	switch action {
+	case staleReaperActionDisable:
+		return "disabled"
+	case staleReaperActionDelete:
+		return "deleted"
+	default:
+		return "changed"
+	}
+}
+
+// runStaleReaper reports stale flags every interval and, unless action is
+// report, disables or deletes expired ones, until ctx is done.
+func (fm *FlagManager) runStaleReaper(ctx context.Context, interval time.Duration, action string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			found, changed, err := fm.reapStaleFlags(ctx, action, now)
+			if err != nil {
+				backgroundJobFailuresTotal.Add(1, "job", "stale_reaper")
+			}
+			staleFlagsFound.Set(float64(found))
+			if changed > 0 {
+				reapedFlagsTotal.Add(float64(changed), "action", reaperActionPast(action))
+			}
+		}
+	}
+}
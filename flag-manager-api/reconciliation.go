@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"flag-manager-api/db"
+
+	"github.com/gorilla/mux"
+)
+
+// ReconciliationReport compares a project's flags with the code references
+// of the latest goff-scan manifests.
+type ReconciliationReport struct {
+	Project string `json:"project"`
+	// Apps are the apps whose scans the report is based on. Without any,
+	// every flag is unreferenced.
+	Apps           []string           `json:"apps"`
+	Unreferenced   []string           `json:"unreferenced"` // flags no code evaluates
+	Missing        []MissingFlag      `json:"missing"`      // flags code evaluates that do not exist
+	TypeMismatches []FlagTypeMismatch `json:"typeMismatches"`
+}
+
+// MissingFlag is a flag evaluated in code that the project does not have.
+type MissingFlag struct {
+	Key        string             `json:"key"`
+	References []db.CodeReference `json:"references"`
+}
+
+// FlagTypeMismatch is a flag evaluated in code as another type than that of
+// its variations, e.g. a boolean flag read with getStringValue.
+type FlagTypeMismatch struct {
+	Key        string             `json:"key"`
+	FlagType   string             `json:"flagType"`
+	References []db.CodeReference `json:"references"` // the references of another type
+}
+
+// listProjectCodeReferences returns the code references of a project by
+// flag, app, file and line.
+func (fm *FlagManager) listProjectCodeReferences(ctx context.Context, project string) ([]db.CodeReference, error) {
+	if fm.store != nil {
+		return fm.store.ListProjectCodeReferences(ctx, project)
+	}
+	if fm.codeReferences == nil {
+		return []db.CodeReference{}, nil
+	}
+	refs := fm.codeReferences.ListProject(project)
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].FlagKey != refs[j].FlagKey {
+			return refs[i].FlagKey < refs[j].FlagKey
+		}
+		return codeReferenceLess(refs[i], refs[j])
+	})
+	return refs, nil
+}
+
+// reconcileFlags builds the reconciliation report of a project's flags and
+// code references, which are sorted by flag.
+func reconcileFlags(project string, flags ProjectFlags, refs []db.CodeReference) ReconciliationReport {
+	report := ReconciliationReport{
+		Project:        project,
+		Apps:           []string{},
+		Unreferenced:   []string{},
+		Missing:        []MissingFlag{},
+		TypeMismatches: []FlagTypeMismatch{},
+	}
+
+	byFlag := make(map[string][]db.CodeReference)
+	apps := make(map[string]bool)
+	var referenced []string
+	for _, ref := range refs {
+		if _, ok := byFlag[ref.FlagKey]; !ok {
+			referenced = append(referenced, ref.FlagKey)
+		}
+		byFlag[ref.FlagKey] = append(byFlag[ref.FlagKey], ref)
+		if !apps[ref.App] {
+			apps[ref.App] = true
+			report.Apps = append(report.Apps, ref.App)
+		}
+	}
+	sort.Strings(report.Apps)
+
+	keys := make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := byFlag[key]; !ok {
+			report.Unreferenced = append(report.Unreferenced, key)
+		}
+	}
+
+	for _, key := range referenced {
+		config, ok := flags[key]
+		if !ok {
+			report.Missing = append(report.Missing, MissingFlag{Key: key, References: byFlag[key]})
+			continue
+		}
+		// Flags whose variations have mixed types cannot be checked
+		typ := flagType(config)
+		if typ == "" {
+			continue
+		}
+		var mismatched []db.CodeReference
+		for _, ref := range byFlag[key] {
+			if ref.Type != "" && ref.Type != typ {
+				mismatched = append(mismatched, ref)
+			}
+		}
+		if len(mismatched) > 0 {
+			report.TypeMismatches = append(report.TypeMismatches, FlagTypeMismatch{Key: key, FlagType: typ, References: mismatched})
+		}
+	}
+	return report
+}
+
+// reconciliationHandler reports the flags of a project no code evaluates,
+// the flags code evaluates that the project lacks, and the flags code
+// evaluates as another type than their variations.
+func (fm *FlagManager) reconciliationHandler(w http.ResponseWriter, r *http.Request) {
+	project := mux.Vars(r)["project"]
+
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	// Code evaluating an archived flag gets the default value, as for a
+	// missing flag
+	flags = withoutArchived(flags)
+	refs, err := fm.listProjectCodeReferences(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reconcileFlags(project, flags, refs))
+}
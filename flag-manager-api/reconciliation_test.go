@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestReconciliation(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			doRequest(t, router, "POST", "/api/flags/import", `{"project":"shop","metadata":{"app":"web"},"flags":[
+				{"key":"checkout","type":"boolean","callSites":[
+					{"file":"src/pay.ts","line":12,"language":"typescript","call":"getBooleanValue","type":"boolean"},
+					{"file":"src/cart.ts","line":3,"language":"typescript","call":"getStringValue","type":"string"}]},
+				{"key":"banner","type":"string","callSites":[{"file":"src/home.ts","line":1,"language":"typescript","call":"getStringValue"}]},
+				{"key":"retired","type":"boolean","callSites":[{"file":"src/old.ts","line":4,"language":"typescript","call":"getBooleanValue"}]}]}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/flags/import", `{"project":"shop","metadata":{"app":"worker"},"flags":[
+				{"key":"banner","type":"string","callSites":[{"file":"jobs/mail.py","line":7,"language":"python","call":"get_string_value"}]}]}`, http.StatusOK, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/search", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+			doRequest(t, router, "DELETE", "/api/projects/shop/flags/retired", "", http.StatusNoContent, nil)
+
+			var report ReconciliationReport
+			doRequest(t, router, "GET", "/api/projects/shop/reconciliation", "", http.StatusOK, &report)
+			if len(report.Apps) != 2 || report.Apps[0] != "web" || report.Apps[1] != "worker" {
+				t.Errorf("Expected the scanned apps, got %+v", report.Apps)
+			}
+			if len(report.Unreferenced) != 1 || report.Unreferenced[0] != "search" {
+				t.Errorf("Expected search to be unreferenced, got %+v", report.Unreferenced)
+			}
+			if len(report.Missing) != 1 || report.Missing[0].Key != "retired" || len(report.Missing[0].References) != 1 {
+				t.Errorf("Expected retired to be missing, got %+v", report.Missing)
+			}
+			if len(report.TypeMismatches) != 1 {
+				t.Fatalf("Expected one type mismatch, got %+v", report.TypeMismatches)
+			}
+			mismatch := report.TypeMismatches[0]
+			if mismatch.Key != "checkout" || mismatch.FlagType != "boolean" || len(mismatch.References) != 1 ||
+				mismatch.References[0].File != "src/cart.ts" || mismatch.References[0].Type != "string" {
+				t.Errorf("Expected checkout read as a string, got %+v", mismatch)
+			}
+
+			doRequest(t, router, "GET", "/api/projects/unknown/reconciliation", "", http.StatusNotFound, nil)
+		})
+	}
+}
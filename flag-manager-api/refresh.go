@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// refreshJitterFraction is the largest share of the interval added at random
+// to each scheduled refresh, so instances started together drift apart.
+const refreshJitterFraction = 0.1
+
+// parseRefreshInterval reads the REFRESH_INTERVAL setting. Empty, zero and
+// invalid values disable scheduled refreshes.
+func parseRefreshInterval(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid REFRESH_INTERVAL, scheduled refresh disabled", "value", value)
+		return 0
+	}
+	if d > 0 && d < time.Second {
+		slog.Warn("REFRESH_INTERVAL is below 1s, using 1s", "value", d)
+		d = time.Second
+	}
+	return d
+}
+
+// jitteredInterval returns interval plus a random delay of up to
+// refreshJitterFraction of it.
+func jitteredInterval(interval time.Duration) time.Duration {
+	maxJitter := int64(float64(interval) * refreshJitterFraction)
+	if maxJitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(maxJitter))
+}
+
+// runScheduledRefresh refreshes the relay proxy every interval (plus jitter)
+// regardless of mutations, as a safety net for missed refreshes, until ctx is
+// done.
+func (fm *FlagManager) runScheduledRefresh(ctx context.Context, interval time.Duration) {
+	for {
+		timer := time.NewTimer(jitteredInterval(interval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := fm.refreshRelayProxy(ctx); err != nil {
+			scheduledRefreshTotal.Add(1, "result", "failure")
+			slog.Warn("Scheduled relay proxy refresh failed", "error", err)
+			continue
+		}
+		scheduledRefreshTotal.Add(1, "result", "success")
+		slog.Info("Scheduled relay proxy refresh succeeded")
+	}
+}
+
+// defaultRefreshDebounce is the default window in which relay proxy refreshes
+// requested by flag changes are coalesced into one.
+const defaultRefreshDebounce = time.Second
+
+// relayRefreshMaxRetries is the number of times a failed coalesced refresh is
+// retried before the queue reports it as failed.
+const relayRefreshMaxRetries = 5
+
+// relayRefreshRetryDelay is the delay before the first retry of a failed
+// coalesced refresh; it doubles on each further retry.
+var relayRefreshRetryDelay = time.Second
+
+// parseRefreshDebounce reads the REFRESH_DEBOUNCE setting. Zero refreshes as
+// soon as the previous refresh is done.
+func parseRefreshDebounce(value string) time.Duration {
+	if value == "" {
+		return defaultRefreshDebounce
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid REFRESH_DEBOUNCE, using default", "value", value, "default", defaultRefreshDebounce)
+		return defaultRefreshDebounce
+	}
+	return d
+}
+
+// scheduleRelayRefresh asks the relay proxy targets that are not scoped to a
+// flag set for a refresh after a project flag change, without waiting for it.
+// Requests are coalesced per target by a relayRefreshQueue. The flags
+// ConfigMap, if any, and the publish targets are updated the same way.
+func (fm *FlagManager) scheduleRelayRefresh(ctx context.Context) {
+	fm.scheduleFlagSetRelayRefresh(ctx, "")
+	fm.configMap.schedule(ctx, fm.config.RefreshDebounce)
+	fm.schedulePublish(ctx)
+}
+
+// scheduleFlagSetRelayRefresh is scheduleRelayRefresh after a change of the
+// flags of a flag set, which also refreshes the targets scoped to it.
+func (fm *FlagManager) scheduleFlagSetRelayRefresh(ctx context.Context, flagSetID string) {
+	fm.rawFlags.invalidate()
+	for _, target := range fm.relayTargets() {
+		if target.FlagSet != "" && target.FlagSet != flagSetID {
+			continue
+		}
+		fm.relayStates.get(target.Name).queue.schedule(ctx, fm.config.RefreshDebounce, func(ctx context.Context) error {
+			return fm.refreshRelayTarget(ctx, target)
+		})
+	}
+}
+
+// relayRefreshQueue coalesces the relay proxy refreshes requested by flag
+// changes, so that bulk operations do not cause a refresh storm: requests
+// arriving within the debounce window, or while a refresh is running, share
+// the next refresh. A failed refresh is retried with exponential backoff. The
+// zero value is ready to use.
+type relayRefreshQueue struct {
+	mu           sync.Mutex
+	window       time.Duration
+	refresh      func(context.Context) error
+	timer        *time.Timer // armed while a refresh or retry is scheduled
+	inFlight     bool
+	pending      int       // requests waiting for a refresh
+	pendingSince time.Time // of the oldest waiting request
+	ctx          context.Context
+	nextAttempt  time.Time
+	retries      int
+	failed       bool
+	lastErr      string
+}
+
+// RelayRefreshQueueStatus is the state of the coalesced refresh queue.
+type RelayRefreshQueueStatus struct {
+	Pending       int        `json:"pending"` // flag changes waiting for a refresh
+	PendingSince  *time.Time `json:"pendingSince,omitempty"`
+	InFlight      bool       `json:"inFlight"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	Retries       int        `json:"retries"` // failed attempts of the pending refresh
+	// Failed reports that the last refresh was given up after all retries;
+	// it is cleared by the next successful refresh.
+	Failed    bool   `json:"failed"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// schedule requests a refresh within window. The refresh is made with the
+// context of the latest request, for its request ID.
+func (q *relayRefreshQueue) schedule(ctx context.Context, window time.Duration, refresh func(context.Context) error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.window = window
+	q.refresh = refresh
+	if q.pending == 0 {
+		q.pendingSince = time.Now().UTC()
+	}
+	q.pending++
+	q.ctx = ctx
+	if q.timer == nil && !q.inFlight {
+		q.arm(window)
+	}
+}
+
+// arm schedules the next attempt after delay. q.mu must be held.
+func (q *relayRefreshQueue) arm(delay time.Duration) {
+	q.nextAttempt = time.Now().Add(delay).UTC()
+	q.timer = time.AfterFunc(delay, q.run)
+}
+
+func (q *relayRefreshQueue) run() {
+	q.mu.Lock()
+	q.timer = nil
+	q.inFlight = true
+	count, since, ctx := q.pending, q.pendingSince, q.ctx
+	q.pending = 0
+	q.mu.Unlock()
+
+	err := q.refresh(ctx)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inFlight = false
+	if err != nil {
+		q.lastErr = err.Error()
+		q.retries++
+		if q.retries <= relayRefreshMaxRetries {
+			// Requests made meanwhile are covered by the retry
+			q.pending += count
+			q.pendingSince = since
+			q.arm(relayRefreshRetryDelay << (q.retries - 1))
+			return
+		}
+		slog.WarnContext(ctx, "Giving up relay proxy refresh", "retries", relayRefreshMaxRetries, "coalesced", count, "error", err)
+		q.failed = true
+		q.retries = 0
+	} else {
+		q.failed = false
+		q.retries = 0
+		q.lastErr = ""
+	}
+
+	if q.pending > 0 {
+		q.arm(q.window)
+	}
+}
+
+// drain makes the pending refresh now, rather than at the end of the debounce
+// window, and waits until no refresh is pending or running, or ctx is done.
+// Retries keep their backoff.
+func (q *relayRefreshQueue) drain(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		q.mu.Lock()
+		if q.timer != nil && q.retries == 0 && q.timer.Stop() {
+			q.nextAttempt = time.Now().UTC()
+			q.timer.Reset(0)
+		}
+		idle, pending := q.timer == nil && !q.inFlight, q.pending
+		q.mu.Unlock()
+		if idle {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d changes not refreshed: %w", pending, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// status returns the state of the queue.
+func (q *relayRefreshQueue) status() RelayRefreshQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status := RelayRefreshQueueStatus{
+		Pending:   q.pending,
+		InFlight:  q.inFlight,
+		Retries:   q.retries,
+		Failed:    q.failed,
+		LastError: q.lastErr,
+	}
+	if q.pending > 0 {
+		since := q.pendingSince
+		status.PendingSince = &since
+	}
+	if q.timer != nil {
+		next := q.nextAttempt
+		status.NextAttemptAt = &next
+	}
+	return status
+}
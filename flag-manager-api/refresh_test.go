@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduledRelayRefresh(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	var calls int32
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin/v1/retriever/refresh" {
+			atomic.AddInt32(&calls, 1)
+		}
+	}))
+	defer relay.Close()
+	fm.config.RelayProxyURL = relay.URL
+
+	before := scheduledRefreshTotal.Value("result", "success")
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		fm.runScheduledRefresh(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&calls) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+	<-done
+
+	if atomic.LoadInt32(&calls) < 2 {
+		t.Fatalf("Expected repeated refreshes, got %d", calls)
+	}
+	if after := scheduledRefreshTotal.Value("result", "success"); after-before < 2 {
+		t.Errorf("Expected scheduled refreshes to be counted, got %v", after-before)
+	}
+
+	if d := parseRefreshInterval(""); d != 0 {
+		t.Errorf("Expected scheduled refresh to default off, got %s", d)
+	}
+	if d := parseRefreshInterval("soon"); d != 0 {
+		t.Errorf("Expected invalid interval to disable refresh, got %s", d)
+	}
+	for i := 0; i < 100; i++ {
+		if d := jitteredInterval(time.Minute); d < time.Minute || d >= time.Minute+6*time.Second {
+			t.Fatalf("Jittered interval %s out of range", d)
+		}
+	}
+}
+
+func TestRelayRefreshCustomization(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	var gotPath, gotAuth, gotKey string
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotKey = r.Header.Get("X-Api-Key")
+	}))
+	defer relay.Close()
+
+	fm.config.RelayProxyURL = relay.URL
+	fm.config.AdminAPIKey = "secret"
+
+	if err := fm.refreshRelayProxy(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if gotPath != "/admin/v1/retriever/refresh" || gotAuth != "Bearer secret" {
+		t.Errorf("Expected default path and bearer auth, got %s %q", gotPath, gotAuth)
+	}
+
+	fm.config.RelayProxyURL = relay.URL + "/"
+	fm.config.RelayRefreshPath = "/goff/refresh"
+	fm.config.RelayAuthHeader = "X-Api-Key"
+	fm.config.RelayAuthScheme = "none"
+	gotAuth = ""
+	if err := fm.refreshRelayProxy(context.Background()); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if gotPath != "/goff/refresh" || gotKey != "secret" || gotAuth != "" {
+		t.Errorf("Expected custom path and bare key header, got %s %q %q", gotPath, gotKey, gotAuth)
+	}
+
+	for _, c := range []struct{ base, path string }{
+		{relay.URL, "goff/refresh"},
+		{"relay:1031", ""},
+		{"ftp://relay:1031", ""},
+		{"http:", ""},
+	} {
+		if _, err := relayRefreshURL(c.base, c.path); err == nil {
+			t.Errorf("Expected %q + %q to be rejected", c.base, c.path)
+		}
+	}
+}
+
+func TestRelayRefreshCoalescing(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	prevDelay := relayRefreshRetryDelay
+	relayRefreshRetryDelay = time.Millisecond
+	defer func() { relayRefreshRetryDelay = prevDelay }()
+
+	var calls, failures atomic.Int32
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failures.Load() != 0 {
+			failures.Add(-1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer relay.Close()
+	fm.config.RelayProxyURL = relay.URL
+	fm.config.RefreshDebounce = 50 * time.Millisecond
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s (calls: %d, queue: %+v)", what, calls.Load(), fm.relayStates.get(defaultRelayTargetName).queue.status())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	idle := func() bool {
+		s := fm.relayStates.get(defaultRelayTargetName).queue.status()
+		return s.Pending == 0 && !s.InFlight && s.NextAttemptAt == nil
+	}
+
+	for i := 0; i < 10; i++ {
+		fm.scheduleRelayRefresh(context.Background())
+	}
+	if s := fm.relayStates.get(defaultRelayTargetName).queue.status(); s.Pending != 10 || s.PendingSince == nil || s.NextAttemptAt == nil {
+		t.Errorf("Expected 10 pending requests with a scheduled refresh, got %+v", s)
+	}
+	waitFor("the coalesced refresh", idle)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected 10 requests to be coalesced into 1 refresh, got %d", n)
+	}
+
+	t.Run("retries failed refreshes", func(t *testing.T) {
+		calls.Store(0)
+		failures.Store(2)
+		fm.scheduleRelayRefresh(context.Background())
+		waitFor("the retried refresh", func() bool { return calls.Load() == 3 && idle() })
+		if s := fm.relayStates.get(defaultRelayTargetName).queue.status(); s.Failed || s.Retries != 0 || s.LastError != "" {
+			t.Errorf("Expected the refresh to succeed on retry, got %+v", s)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls.Store(0)
+		failures.Store(1000)
+		fm.scheduleRelayRefresh(context.Background())
+		waitFor("the refresh to be given up", func() bool { return fm.relayStates.get(defaultRelayTargetName).queue.status().Failed })
+		if n := calls.Load(); n != relayRefreshMaxRetries+1 {
+			t.Errorf("Expected %d attempts, got %d", relayRefreshMaxRetries+1, n)
+		}
+		if s := fm.relayStates.get(defaultRelayTargetName).queue.status(); s.LastError == "" || s.Pending != 0 {
+			t.Errorf("Expected the failure to be reported, got %+v", s)
+		}
+
+		failures.Store(0)
+		fm.scheduleRelayRefresh(context.Background())
+		waitFor("the next refresh", func() bool { return !fm.relayStates.get(defaultRelayTargetName).queue.status().Failed })
+	})
+}
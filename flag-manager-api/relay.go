@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultRelayRefreshPath = "/admin/v1/retriever/refresh"
+	defaultRelayAuthHeader  = "Authorization"
+	defaultRelayAuthScheme  = "Bearer"
+	// relayAuthSchemeNone sends the admin API key as the bare header value
+	relayAuthSchemeNone = "none"
+)
+
+// relayRefreshURL returns the relay proxy refresh URL, validating that it is an
+// absolute http(s) URL. An empty path uses the GO Feature Flag default.
+func relayRefreshURL(baseURL, path string) (string, error) {
+	if path == "" {
+		path = defaultRelayRefreshPath
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("refresh path %q must start with /", path)
+	}
+
+	refreshURL := strings.TrimSuffix(baseURL, "/") + path
+	u, err := url.Parse(refreshURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid relay refresh URL %q: %w", refreshURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("relay refresh URL %q must be an absolute http or https URL", refreshURL)
+	}
+	return refreshURL, nil
+}
+
+// RelayTarget is a relay proxy refreshed by the manager. Deployments running
+// one relay proxy per region or environment list them in RELAY_PROXY_TARGETS;
+// otherwise RELAY_PROXY_URL and ADMIN_API_KEY make the only target.
+type RelayTarget struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	AdminAPIKey string `json:"adminApiKey,omitempty"`
+	// FlagSet scopes the target to the flag set with this ID: it is only
+	// refreshed when that flag set's flags change. Unscoped targets are
+	// refreshed on every change.
+	FlagSet string `json:"flagSet,omitempty"`
+}
+
+// defaultRelayTargetName names the target made of RELAY_PROXY_URL.
+const defaultRelayTargetName = "default"
+
+// parseRelayTargets reads the RELAY_PROXY_TARGETS setting, a JSON array of
+// targets. Names default to the URL and must be unique.
+func parseRelayTargets(value, refreshPath string) ([]RelayTarget, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var targets []RelayTarget
+	if err := json.Unmarshal([]byte(value), &targets); err != nil {
+		return nil, fmt.Errorf("invalid RELAY_PROXY_TARGETS: %w", err)
+	}
+
+	seen := make(map[string]bool, len(targets))
+	for i := range targets {
+		t := &targets[i]
+		if t.Name == "" {
+			t.Name = t.URL
+		}
+		if _, err := relayRefreshURL(t.URL, refreshPath); err != nil {
+			return nil, fmt.Errorf("relay proxy target %q: %w", t.Name, err)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("duplicate relay proxy target %q", t.Name)
+		}
+		seen[t.Name] = true
+	}
+	return targets, nil
+}
+
+// relayTargets returns the configured relay proxy targets.
+func (fm *FlagManager) relayTargets() []RelayTarget {
+	if len(fm.config.RelayTargets) > 0 {
+		return fm.config.RelayTargets
+	}
+	if fm.config.RelayProxyURL == "" {
+		return nil
+	}
+	return []RelayTarget{{Name: defaultRelayTargetName, URL: fm.config.RelayProxyURL, AdminAPIKey: fm.config.AdminAPIKey}}
+}
+
+// relayTargetState is the refresh history and queue of a relay proxy target.
+type relayTargetState struct {
+	refreshes relayRefreshLog
+	queue     relayRefreshQueue
+}
+
+// relayTargetStates holds the state of each relay proxy target by name. The
+// zero value is ready to use.
+type relayTargetStates struct {
+	mu     sync.Mutex
+	states map[string]*relayTargetState
+}
+
+func (s *relayTargetStates) get(name string) *relayTargetState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states == nil {
+		s.states = make(map[string]*relayTargetState)
+	}
+	state, ok := s.states[name]
+	if !ok {
+		state = &relayTargetState{}
+		s.states[name] = state
+	}
+	return state
+}
+
+// setRelayAuth adds a target's admin API key to a relay proxy request using
+// the configured header and scheme (Authorization: Bearer <key> by default).
+func setRelayAuth(req *http.Request, config Config, target RelayTarget) {
+	if target.AdminAPIKey == "" {
+		return
+	}
+
+	header := config.RelayAuthHeader
+	if header == "" {
+		header = defaultRelayAuthHeader
+	}
+	scheme := config.RelayAuthScheme
+	if scheme == "" {
+		scheme = defaultRelayAuthScheme
+	}
+
+	value := target.AdminAPIKey
+	if !strings.EqualFold(scheme, relayAuthSchemeNone) {
+		value = scheme + " " + value
+	}
+	req.Header.Set(header, value)
+}
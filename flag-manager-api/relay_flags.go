@@ -0,0 +1,113 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+)
+
+// RelayFlag is a flag as the relay proxy is served it: the GO Feature Flag
+// fields of a FlagConfig. The fields only the manager uses, such as owners,
+// tags, approval settings or ramps, are left out: the relay proxy does not
+// understand them, and the raw flags endpoints need no authentication.
+type RelayFlag struct {
+	Variations       map[string]interface{} `yaml:"variations,omitempty" json:"variations,omitempty"`
+	Targeting        []TargetingRule        `yaml:"targeting,omitempty" json:"targeting,omitempty"`
+	DefaultRule      *DefaultRule           `yaml:"defaultRule,omitempty" json:"defaultRule,omitempty"`
+	TrackEvents      *bool                  `yaml:"trackEvents,omitempty" json:"trackEvents,omitempty"`
+	Disable          *bool                  `yaml:"disable,omitempty" json:"disable,omitempty"`
+	Version          string                 `yaml:"version,omitempty" json:"version,omitempty"`
+	Metadata         map[string]interface{} `yaml:"metadata,omitempty" json:"metadata,omitempty"`
+	ScheduledRollout []ScheduledStep        `yaml:"scheduledRollout,omitempty" json:"scheduledRollout,omitempty"`
+	Experimentation  *Experimentation       `yaml:"experimentation,omitempty" json:"experimentation,omitempty"`
+	BucketingKey     string                 `yaml:"bucketingKey,omitempty" json:"bucketingKey,omitempty"`
+}
+
+// relayFlag returns the relay proxy projection of a flag, with each
+// overridden variation given its value for env. The environmentOverrides
+// themselves are dropped; without an env the variations keep their defaults.
+func relayFlag(config FlagConfig, env string) RelayFlag {
+	variations := config.Variations
+	if env != "" && len(config.EnvironmentOverrides) > 0 {
+		variations = make(map[string]interface{}, len(config.Variations))
+		for name, value := range config.Variations {
+			if override, ok := config.EnvironmentOverrides[name][env]; ok {
+				value = override
+			}
+			variations[name] = value
+		}
+	}
+	return RelayFlag{
+		Variations:       variations,
+		Targeting:        config.Targeting,
+		DefaultRule:      config.DefaultRule,
+		TrackEvents:      config.TrackEvents,
+		Disable:          config.Disable,
+		Version:          config.Version,
+		Metadata:         config.Metadata,
+		ScheduledRollout: config.ScheduledRollout,
+		Experimentation:  config.Experimentation,
+		BucketingKey:     config.BucketingKey,
+	}
+}
+
+// relayFlags returns the relay proxy projection of a map of flags served in
+// env, which are FlagConfigs or, as flag set flags are stored, generic values.
+func relayFlags(flags interface{}, env string) (map[string]RelayFlag, error) {
+	switch flags := flags.(type) {
+	case map[string]FlagConfig:
+		return relayFlagConfigs(flags, env), nil
+	case ProjectFlags:
+		return relayFlagConfigs(flags, env), nil
+	case map[string]interface{}:
+		relay := make(map[string]RelayFlag, len(flags))
+		for key, v := range flags {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			var config FlagConfig
+			if err := json.Unmarshal(data, &config); err != nil {
+				return nil, fmt.Errorf("invalid flag %s: %w", key, err)
+			}
+			relay[key] = relayFlag(config, env)
+		}
+		return relay, nil
+	default:
+		return nil, fmt.Errorf("unsupported flags type %T", flags)
+	}
+}
+
+// relayFlagSeq yields the relay proxy projection of flags served in env, one
+// flag at a time. A flagSeq of FlagConfigs is projected as it is read; maps
+// are yielded in key order.
+func relayFlagSeq(flags interface{}, env string) (flagSeq[RelayFlag], error) {
+	var configs flagSeq[FlagConfig]
+	switch flags := flags.(type) {
+	case flagSeq[FlagConfig]:
+		configs = flags
+	case map[string]FlagConfig:
+		configs = sortedFlags(flags, cmp.Less[string])
+	case ProjectFlags:
+		configs = sortedFlags(flags, cmp.Less[string])
+	default:
+		relay, err := relayFlags(flags, env)
+		if err != nil {
+			return nil, err
+		}
+		return sortedFlags(relay, cmp.Less[string]), nil
+	}
+	return func(yield func(key string, flag RelayFlag) error) error {
+		return configs(func(key string, config FlagConfig) error {
+			return yield(key, relayFlag(config, env))
+		})
+	}, nil
+}
+
+func relayFlagConfigs[M ~map[string]FlagConfig](flags M, env string) map[string]RelayFlag {
+	relay := make(map[string]RelayFlag, len(flags))
+	for key, config := range flags {
+		relay[key] = relayFlag(config, env)
+	}
+	return relay
+}
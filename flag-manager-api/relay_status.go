@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/httpclient"
+)
+
+// relayRefreshHistorySize is the number of relay proxy refresh attempts kept
+// for the status API.
+const relayRefreshHistorySize = 20
+
+// relayStatusTimeout bounds each call made to the relay proxy by the status API.
+const relayStatusTimeout = 5 * time.Second
+
+// relayVersionHeader is set by the GO Feature Flag relay proxy on its responses.
+const relayVersionHeader = "X-GOFEATUREFLAG-VERSION"
+
+// RelayRefreshAttempt is the outcome of one relay proxy refresh.
+type RelayRefreshAttempt struct {
+	Time       time.Time `json:"time"`
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	RequestID  string    `json:"requestId,omitempty"`
+}
+
+// relayRefreshLog keeps the latest relay proxy refresh attempts. The zero
+// value is ready to use.
+type relayRefreshLog struct {
+	mu       sync.Mutex
+	attempts []RelayRefreshAttempt // oldest first
+}
+
+// record adds a refresh started at start to the history. err is nil for a
+// successful refresh.
+func (l *relayRefreshLog) record(ctx context.Context, start time.Time, statusCode int, err error) {
+	attempt := RelayRefreshAttempt{
+		Time:       start.UTC(),
+		Success:    err == nil,
+		StatusCode: statusCode,
+		DurationMs: time.Since(start).Milliseconds(),
+		RequestID:  requestIDFrom(ctx),
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.attempts = append(l.attempts, attempt)
+	if n := len(l.attempts) - relayRefreshHistorySize; n > 0 {
+		l.attempts = append([]RelayRefreshAttempt(nil), l.attempts[n:]...)
+	}
+}
+
+// recent returns the recorded attempts, newest first.
+func (l *relayRefreshLog) recent() []RelayRefreshAttempt {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	attempts := make([]RelayRefreshAttempt, len(l.attempts))
+	for i, a := range l.attempts {
+		attempts[len(l.attempts)-1-i] = a
+	}
+	return attempts
+}
+
+// rawFlagsFetchLog remembers the last request served by a raw flags endpoint,
+// which the relay proxy's HTTP retriever polls. The zero value is ready to use.
+type rawFlagsFetchLog struct {
+	mu        sync.Mutex
+	at        time.Time
+	path      string
+	remote    string
+	userAgent string
+}
+
+func (l *rawFlagsFetchLog) record(r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.at = time.Now().UTC()
+	l.path = r.URL.Path
+	l.remote = r.RemoteAddr
+	l.userAgent = r.UserAgent()
+}
+
+// RelayProxyStatus is the body of GET /api/relay-proxy/status.
+type RelayProxyStatus struct {
+	Targets    []RelayTargetStatus `json:"targets"`
+	Retrievers []RelayRetriever    `json:"retrievers"`
+	RawFlags   RawFlagsStatus      `json:"rawFlags"`
+}
+
+// RelayTargetStatus is the status of one relay proxy target.
+type RelayTargetStatus struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	FlagSet string `json:"flagSet,omitempty"`
+	// Reachable reports whether the relay proxy answered its health check;
+	// Healthy whether it also reported being initialized.
+	Reachable    bool                    `json:"reachable"`
+	Healthy      bool                    `json:"healthy"`
+	Version      string                  `json:"version,omitempty"`
+	CacheRefresh *time.Time              `json:"cacheRefresh,omitempty"` // last flag cache update reported by the relay proxy
+	Error        string                  `json:"error,omitempty"`
+	LastRefresh  *RelayRefreshAttempt    `json:"lastRefresh,omitempty"`
+	Refreshes    []RelayRefreshAttempt   `json:"refreshes"` // newest first
+	Queue        RelayRefreshQueueStatus `json:"queue"`
+}
+
+// RelayRetriever summarizes an enabled retriever of the generated relay proxy
+// configuration.
+type RelayRetriever struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// RawFlagsStatus tells whether the relay proxy reads the manager's raw flags
+// endpoint. The manager cannot call itself from the relay proxy's network, so
+// it is considered reachable when the endpoint was fetched since the last
+// successful refresh, which makes the relay proxy poll its retrievers.
+type RawFlagsStatus struct {
+	Reachable     bool       `json:"reachable"`
+	LastFetchedAt *time.Time `json:"lastFetchedAt,omitempty"`
+	Path          string     `json:"path,omitempty"`
+	RemoteAddr    string     `json:"remoteAddr,omitempty"`
+	UserAgent     string     `json:"userAgent,omitempty"`
+}
+
+// relayProxyStatusHandler reports the health and version of each relay proxy
+// target with the outcome of its recent refreshes, and the retrievers the
+// relay proxies are configured with.
+func (fm *FlagManager) relayProxyStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := RelayProxyStatus{Targets: []RelayTargetStatus{}}
+
+	retrievers, err := fm.enabledRetrievers(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	status.Retrievers = make([]RelayRetriever, 0, len(retrievers))
+	for _, ret := range retrievers {
+		status.Retrievers = append(status.Retrievers, RelayRetriever{ID: ret.ID, Name: ret.Name, Kind: ret.Kind})
+	}
+
+	// The raw flags endpoint is read by the targets not scoped to a flag set
+	var lastRefresh time.Time
+	for _, target := range fm.relayTargets() {
+		state := fm.relayStates.get(target.Name)
+		ts := RelayTargetStatus{
+			Name:      target.Name,
+			URL:       target.URL,
+			FlagSet:   target.FlagSet,
+			Refreshes: state.refreshes.recent(),
+			Queue:     state.queue.status(),
+		}
+		if len(ts.Refreshes) > 0 {
+			ts.LastRefresh = &ts.Refreshes[0]
+		}
+		if target.FlagSet == "" {
+			for _, a := range ts.Refreshes {
+				if a.Success {
+					if a.Time.After(lastRefresh) {
+						lastRefresh = a.Time
+					}
+					break
+				}
+			}
+		}
+		status.Targets = append(status.Targets, ts)
+	}
+	status.RawFlags = fm.rawFlagsFetches.status(lastRefresh)
+
+	var wg sync.WaitGroup
+	for i, target := range fm.relayTargets() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fm.probeRelayProxy(r.Context(), target, &status.Targets[i])
+		}()
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// probeRelayProxy fills in a target's health, version and last cache update
+// from the relay proxy's /health and /info endpoints.
+func (fm *FlagManager) probeRelayProxy(ctx context.Context, target RelayTarget, status *RelayTargetStatus) {
+	var health struct {
+		Initialized bool `json:"initialized"`
+	}
+	version, err := fm.getRelayProxyJSON(ctx, target, "/health", &health)
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+	status.Reachable = true
+	status.Healthy = health.Initialized
+	status.Version = version
+
+	var info struct {
+		CacheRefresh *time.Time `json:"cacheRefresh"`
+	}
+	if _, err := fm.getRelayProxyJSON(ctx, target, "/info", &info); err != nil {
+		status.Error = err.Error()
+		return
+	}
+	status.CacheRefresh = info.CacheRefresh
+}
+
+// getRelayProxyJSON decodes the JSON response of a relay proxy endpoint and
+// returns the relay proxy version reported with it.
+func (fm *FlagManager) getRelayProxyJSON(ctx context.Context, target RelayTarget, path string, v interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, relayStatusTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(target.URL, "/")+path, nil)
+	if err != nil {
+		return "", err
+	}
+	setRelayAuth(req, fm.config, target)
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	var resp *http.Response
+	err = fm.outbound.Do(func() error {
+		resp, err = httpclient.Default().Do(req)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("relay proxy %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("relay proxy %s returned status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("relay proxy %s: invalid response: %w", path, err)
+	}
+	return resp.Header.Get(relayVersionHeader), nil
+}
+
+// status reports the last raw flags fetch. It counts as reachable unless the
+// relay proxies were last refreshed after it.
+func (l *rawFlagsFetchLog) status(lastRefresh time.Time) RawFlagsStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.at.IsZero() {
+		return RawFlagsStatus{}
+	}
+
+	at := l.at
+	return RawFlagsStatus{
+		Reachable:     !at.Before(lastRefresh),
+		LastFetchedAt: &at,
+		Path:          l.path,
+		RemoteAddr:    l.remote,
+		UserAgent:     l.userAgent,
+	}
+}
+
+// enabledRetrievers returns the enabled retrievers in either storage mode.
+func (fm *FlagManager) enabledRetrievers(ctx context.Context) ([]*Retriever, error) {
+	if fm.store == nil {
+		if fm.retrievers == nil {
+			return nil, nil
+		}
+		return fm.retrievers.GetEnabled(), nil
+	}
+
+	dbItems, err := fm.store.ListRetrievers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var retrievers []*Retriever
+	for _, dbr := range dbItems {
+		if dbr.Enabled {
+			ret := dbRetrieverToRetriever(dbr)
+			retrievers = append(retrievers, &ret)
+		}
+	}
+	return retrievers, nil
+}
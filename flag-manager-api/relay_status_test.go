@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRelayProxyStatus(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	var failRefresh atomic.Bool
+	failRefresh.Store(true)
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-GOFEATUREFLAG-VERSION", "v1.40.0")
+		switch r.URL.Path {
+		case "/health":
+			w.Write([]byte(`{"initialized":true}`))
+		case "/info":
+			w.Write([]byte(`{"cacheRefresh":"2026-01-02T03:04:05Z"}`))
+		case "/admin/v1/retriever/refresh":
+			if failRefresh.Load() {
+				http.Error(w, "boom", http.StatusInternalServerError)
+			}
+		}
+	}))
+	defer relay.Close()
+	fm.config.RelayProxyURL = relay.URL
+	fm.retrievers.Create(&Retriever{Name: "manager", Kind: "http", URL: "http://manager/api/flags/raw", Enabled: true})
+	fm.retrievers.Create(&Retriever{Name: "unused", Kind: "file", Path: "/flags.yaml"})
+
+	getStatus := func() RelayProxyStatus {
+		t.Helper()
+		var status RelayProxyStatus
+		doRequest(t, router, "GET", "/api/relay-proxy/status", "", http.StatusOK, &status)
+		return status
+	}
+
+	fm.refreshRelayProxy(context.Background())
+	failRefresh.Store(false)
+	fm.refreshRelayProxy(context.Background())
+
+	status := getStatus()
+	if len(status.Targets) != 1 {
+		t.Fatalf("Expected the default relay proxy target, got %+v", status.Targets)
+	}
+	target := status.Targets[0]
+	if target.Name != "default" || !target.Reachable || !target.Healthy || target.Version != "v1.40.0" {
+		t.Errorf("Expected a healthy relay proxy v1.40.0, got %+v", target)
+	}
+	if target.CacheRefresh == nil || !target.CacheRefresh.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Expected the relay proxy cache refresh time, got %v", target.CacheRefresh)
+	}
+	if len(status.Retrievers) != 1 || status.Retrievers[0].Name != "manager" || status.Retrievers[0].Kind != "http" {
+		t.Errorf("Expected the enabled retriever only, got %+v", status.Retrievers)
+	}
+	if len(target.Refreshes) != 2 || !target.Refreshes[0].Success || target.Refreshes[1].Success || target.Refreshes[1].StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected a failed then a successful refresh, newest first, got %+v", target.Refreshes)
+	}
+	if target.LastRefresh == nil || !target.LastRefresh.Success {
+		t.Errorf("Expected the last refresh to have succeeded, got %+v", target.LastRefresh)
+	}
+	if status.RawFlags.Reachable || status.RawFlags.LastFetchedAt != nil {
+		t.Errorf("Expected the raw flags endpoint not to have been fetched, got %+v", status.RawFlags)
+	}
+
+	req := httptest.NewRequest("GET", "/api/flags/raw", nil)
+	req.Header.Set("User-Agent", "gofeatureflag-relay")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if raw := getStatus().RawFlags; !raw.Reachable || raw.UserAgent != "gofeatureflag-relay" {
+		t.Errorf("Expected the raw flags fetch to be reported, got %+v", raw)
+	}
+
+	for i := 0; i < relayRefreshHistorySize+5; i++ {
+		fm.refreshRelayProxy(context.Background())
+	}
+	if n := len(getStatus().Targets[0].Refreshes); n != relayRefreshHistorySize {
+		t.Errorf("Expected %d refreshes kept, got %d", relayRefreshHistorySize, n)
+	}
+
+	relay.Close()
+	if target := getStatus().Targets[0]; target.Reachable || target.Error == "" {
+		t.Errorf("Expected an unreachable relay proxy to be reported, got %+v", target)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelayProxyTargets(t *testing.T) {
+	if _, err := parseRelayTargets(`[{"name":"eu","url":"http://eu:1031"},{"name":"eu","url":"http://eu2:1031"}]`, ""); err == nil {
+		t.Error("Expected duplicate target names to be rejected")
+	}
+	if _, err := parseRelayTargets(`[{"url":"eu:1031"}]`, ""); err == nil {
+		t.Error("Expected a relative target URL to be rejected")
+	}
+	if _, err := parseRelayTargets(`{"url":"http://eu:1031"}`, ""); err == nil {
+		t.Error("Expected a non-array value to be rejected")
+	}
+	if targets, err := parseRelayTargets(`[{"url":"http://eu:1031"}]`, ""); err != nil || targets[0].Name != "http://eu:1031" {
+		t.Errorf("Expected the name to default to the URL, got %+v, %v", targets, err)
+	}
+
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	type call struct{ target, auth string }
+	calls := make(chan call, 10)
+	newRelay := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/admin/v1/retriever/refresh" {
+				calls <- call{name, r.Header.Get("Authorization")}
+				w.WriteHeader(status)
+			}
+		}))
+	}
+	eu := newRelay("eu", http.StatusOK)
+	defer eu.Close()
+	mobile := newRelay("mobile", http.StatusBadGateway)
+	defer mobile.Close()
+	fm.config.RelayTargets = []RelayTarget{
+		{Name: "eu", URL: eu.URL, AdminAPIKey: "eu-key"},
+		{Name: "mobile", URL: mobile.URL, AdminAPIKey: "mobile-key", FlagSet: "fs-mobile"},
+	}
+
+	expectCalls := func(want ...call) {
+		t.Helper()
+		var got []call
+		for range want {
+			select {
+			case c := <-calls:
+				got = append(got, c)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected refreshes %v, got %v", want, got)
+			}
+		}
+		select {
+		case c := <-calls:
+			t.Fatalf("Unexpected refresh of %v", c)
+		case <-time.After(50 * time.Millisecond):
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i].target < got[j].target })
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected refreshes %v, got %v", want, got)
+		}
+	}
+
+	flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/projects/web/flags/checkout", strings.NewReader(flag)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	expectCalls(call{"eu", "Bearer eu-key"})
+
+	fm.scheduleFlagSetRelayRefresh(context.Background(), "fs-other")
+	expectCalls(call{"eu", "Bearer eu-key"})
+
+	fm.scheduleFlagSetRelayRefresh(context.Background(), "fs-mobile")
+	expectCalls(call{"eu", "Bearer eu-key"}, call{"mobile", "Bearer mobile-key"})
+
+	// Wait for the failed refresh to be recorded before refreshing directly
+	for deadline := time.Now().Add(5 * time.Second); len(fm.relayStates.get("mobile").refreshes.recent()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("Failed refresh of mobile was not recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Drop the pending retry so that it does not fire on the reset queue
+	queue := &fm.relayStates.get("mobile").queue
+	queue.mu.Lock()
+	if queue.timer != nil {
+		queue.timer.Stop()
+	}
+	queue.mu.Unlock()
+	*queue = relayRefreshQueue{}
+
+	err := fm.refreshRelayProxy(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "mobile") || strings.Contains(err.Error(), "eu:") {
+		t.Errorf("Expected only the mobile target to fail, got %v", err)
+	}
+	expectCalls(call{"eu", "Bearer eu-key"}, call{"mobile", "Bearer mobile-key"})
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/relay-proxy/status", nil))
+	var status RelayProxyStatus
+	json.Unmarshal(rr.Body.Bytes(), &status)
+	if len(status.Targets) != 2 || status.Targets[1].FlagSet != "fs-mobile" {
+		t.Fatalf("Expected both targets in the status, got %+v", status.Targets)
+	}
+	if last := status.Targets[0].LastRefresh; last == nil || !last.Success {
+		t.Errorf("Expected eu's last refresh to have succeeded, got %+v", last)
+	}
+	if last := status.Targets[1].LastRefresh; last == nil || last.Success || last.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected mobile's last refresh to have failed, got %+v", last)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// APIError is the body of every error response: a stable, machine-readable
+// code, a human-readable message and optional details, such as one entry per
+// invalid field.
+type APIError struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Details []string `json:"details,omitempty"`
+	// Error repeats Message for clients written against the former
+	// {"error": ...} bodies.
+	Error string `json:"error"`
+}
+
+// errorCodes are the codes of errors without a more specific one.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "BAD_REQUEST",
+	http.StatusUnauthorized:        "UNAUTHORIZED",
+	http.StatusForbidden:           "FORBIDDEN",
+	http.StatusNotFound:            "NOT_FOUND",
+	http.StatusConflict:            "CONFLICT",
+	http.StatusUpgradeRequired:     "UPGRADE_REQUIRED",
+	http.StatusTooManyRequests:     "RATE_LIMITED",
+	http.StatusInternalServerError: "INTERNAL_ERROR",
+	http.StatusBadGateway:          "BAD_GATEWAY",
+	http.StatusServiceUnavailable:  "UNAVAILABLE",
+}
+
+// errorCode returns the generic error code of an HTTP status.
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	return "ERROR"
+}
+
+// writeError sends an error response.
+func writeError(w http.ResponseWriter, status int, code, message string, details ...string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(APIError{
+		Code:    code,
+		Message: message,
+		Details: details,
+		Error:   message,
+	})
+}
+
+// FlagResponse is the body returned for a single project flag.
+type FlagResponse struct {
+	Key         string     `json:"key"`
+	Config      FlagConfig `json:"config"`
+	ContentHash string     `json:"contentHash"` // see flagContentHash
+}
+
+func newFlagResponse(key string, config FlagConfig) FlagResponse {
+	return FlagResponse{Key: key, Config: config, ContentHash: flagContentHash(config)}
+}
+
+// StatusResponse acknowledges an action that has no other result.
+type StatusResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// SuccessResponse acknowledges a successful change.
+type SuccessResponse struct {
+	Success bool `json:"success"`
+}
+
+// ConnectionTestResult is the outcome of testing a connection to an external
+// service. A failed test is reported in Error rather than as an error response.
+type ConnectionTestResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
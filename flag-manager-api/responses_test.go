@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", flag, http.StatusCreated, nil)
+
+	cases := []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}{
+		{"missing project", "GET", "/api/projects/missing", "", http.StatusNotFound, "PROJECT_NOT_FOUND"},
+		{"missing flag", "GET", "/api/projects/web/flags/missing", "", http.StatusNotFound, "FLAG_NOT_FOUND"},
+		{"existing flag", "POST", "/api/projects/web/flags/checkout", flag, http.StatusConflict, "FLAG_EXISTS"},
+		{"malformed body", "POST", "/api/projects/web/flags/banner", "{", http.StatusBadRequest, "INVALID_REQUEST_BODY"},
+		{"invalid flag", "POST", "/api/projects/web/flags/banner", `{"variations":{}}`, http.StatusBadRequest, "INVALID_FLAG_CONFIG"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var resp APIError
+			rr := doRequest(t, router, c.method, c.path, c.body, c.status, &resp)
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected a JSON error, got Content-Type %q", ct)
+			}
+			if resp.Code != c.code || resp.Message == "" || resp.Error != resp.Message {
+				t.Errorf("Expected code %s with a message, got %+v", c.code, resp)
+			}
+		})
+	}
+}
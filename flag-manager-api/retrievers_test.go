@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRetrieversCRUD(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	var createdID string
+
+	t.Run("create file retriever", func(t *testing.T) {
+		retriever := map[string]interface{}{
+			"id":      "test-file-retriever",
+			"name":    "file-retriever",
+			"kind":    "file",
+			"enabled": true,
+			"path":    "/etc/goff/flags.yaml",
+		}
+
+		body, _ := json.Marshal(retriever)
+		req := httptest.NewRequest("POST", "/api/retrievers", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var response map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		createdID = response["id"].(string)
+	})
+
+	t.Run("list retrievers", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/retrievers", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("get retriever", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/retrievers/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("update retriever", func(t *testing.T) {
+		retriever := map[string]interface{}{
+			"id":      createdID,
+			"name":    "file-retriever-updated",
+			"kind":    "file",
+			"enabled": false,
+			"path":    "/etc/goff/flags-new.yaml",
+		}
+
+		body, _ := json.Marshal(retriever)
+		req := httptest.NewRequest("PUT", "/api/retrievers/"+createdID, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("delete retriever", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/retrievers/"+createdID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK && rr.Code != http.StatusNoContent {
+			t.Errorf("Expected status 200 or 204, got %d", rr.Code)
+		}
+	})
+}
+
+func TestAllRetrieverTypes(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	testCases := []struct {
+		name      string
+		retriever map[string]interface{}
+	}{
+		{
+			name: "file retriever",
+			retriever: map[string]interface{}{
+				"id":      "test-file",
+				"name":    "file",
+				"kind":    "file",
+				"enabled": true,
+				"path":    "/flags.yaml",
+			},
+		},
+		{
+			name: "http retriever",
+			retriever: map[string]interface{}{
+				"id":      "test-http",
+				"name":    "http",
+				"kind":    "http",
+				"enabled": true,
+				"url":     "https://example.com/flags.yaml",
+			},
+		},
+		{
+			name: "s3 retriever",
+			retriever: map[string]interface{}{
+				"id":       "test-s3",
+				"name":     "s3",
+				"kind":     "s3",
+				"enabled":  true,
+				"s3Bucket": "my-bucket",
+				"s3Item":   "flags.yaml",
+			},
+		},
+		{
+			name: "github retriever",
+			retriever: map[string]interface{}{
+				"id":                   "test-github",
+				"name":                 "github",
+				"kind":                 "github",
+				"enabled":              true,
+				"githubRepositorySlug": "org/repo",
+				"githubPath":           "flags.yaml",
+				"githubBranch":         "main",
+			},
+		},
+		{
+			name: "gitlab retriever",
+			retriever: map[string]interface{}{
+				"id":                   "test-gitlab",
+				"name":                 "gitlab",
+				"kind":                 "gitlab",
+				"enabled":              true,
+				"gitlabRepositorySlug": "org/repo",
+				"gitlabPath":           "flags.yaml",
+				"gitlabBranch":         "main",
+			},
+		},
+		{
+			name: "mongodb retriever",
+			retriever: map[string]interface{}{
+				"id":                "test-mongodb",
+				"name":              "mongodb",
+				"kind":              "mongodb",
+				"enabled":           true,
+				"mongodbUri":        "mongodb://localhost:27017",
+				"mongodbDatabase":   "goff",
+				"mongodbCollection": "flags",
+			},
+		},
+		{
+			name: "redis retriever",
+			retriever: map[string]interface{}{
+				"id":          "test-redis",
+				"name":        "redis",
+				"kind":        "redis",
+				"enabled":     true,
+				"redisAddr":   "localhost:6379",
+				"redisPrefix": "goff:",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, _ := json.Marshal(tc.retriever)
+			req := httptest.NewRequest("POST", "/api/retrievers", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusCreated {
+				t.Errorf("Expected status %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRetrieverUsage(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	retriever := &Retriever{ID: "shared-http", Name: "shared-http", Kind: "http", Enabled: true, URL: "https://flags.example.com/flags.yaml"}
+	if err := fm.retrievers.Create(retriever); err != nil {
+		t.Fatalf("Failed to create retriever: %v", err)
+	}
+	fs, err := fm.flagSets.Create(FlagSet{
+		Name:      "payments",
+		Retriever: FlagSetRetriever{Kind: "http", RetrieverID: retriever.ID, URL: retriever.URL},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create flag set: %v", err)
+	}
+
+	t.Run("usage lists referencing flag sets", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/retrievers/"+retriever.ID+"/usage", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var usage RetrieverUsage
+		json.Unmarshal(rr.Body.Bytes(), &usage)
+		if !usage.InUse || len(usage.FlagSets) != 1 || usage.FlagSets[0].ID != fs.ID {
+			t.Errorf("Expected usage by flag set %s, got %+v", fs.ID, usage)
+		}
+	})
+
+	t.Run("usage of unknown retriever", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/retrievers/missing/usage", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("delete refused while in use", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/retrievers/"+retriever.ID, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusConflict, rr.Code, rr.Body.String())
+		}
+		if fm.retrievers.Get(retriever.ID) == nil {
+			t.Error("Expected retriever to still exist")
+		}
+	})
+
+	t.Run("forced delete", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/retrievers/"+retriever.ID+"?force=true", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+		}
+		if fm.retrievers.Get(retriever.ID) != nil {
+			t.Error("Expected retriever to be deleted")
+		}
+	})
+}
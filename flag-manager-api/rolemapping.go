@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"flag-manager-api/db"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// defaultRolesClaim is the token claim role mappings match when
+// JWT_ROLES_CLAIM is not set.
+const defaultRolesClaim = "groups"
+
+// RoleMapping gives the users whose token carries Value in the roles claim a
+// role, by name, everywhere or only within a project or flag set. Mapped roles
+// add to the roles assigned through /api/users/{userId}/roles and are not
+// stored: they follow the token.
+type RoleMapping struct {
+	Value   string `json:"value"`
+	Role    string `json:"role"`
+	Project string `json:"project,omitempty"`
+	FlagSet string `json:"flagSet,omitempty"` // flag set ID
+}
+
+// parseRoleMappings reads the JWT_ROLE_MAPPINGS setting, a JSON array of
+// mappings.
+func parseRoleMappings(value string) ([]RoleMapping, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var mappings []RoleMapping
+	if err := json.Unmarshal([]byte(value), &mappings); err != nil {
+		return nil, fmt.Errorf("invalid JWT_ROLE_MAPPINGS: %w", err)
+	}
+	for i, m := range mappings {
+		switch {
+		case m.Value == "" || m.Role == "":
+			return nil, fmt.Errorf("role mapping %d: value and role are required", i)
+		case m.Project != "" && m.FlagSet != "":
+			return nil, fmt.Errorf("role mapping %d: a role is mapped in a project or a flag set, not both", i)
+		case m.Project != "":
+			if err := ValidateProjectName(m.Project); err != nil {
+				return nil, fmt.Errorf("role mapping %d: %w", i, err)
+			}
+		}
+	}
+	return mappings, nil
+}
+
+// claimValues returns the strings at path in the claims of a token: a string
+// or the strings of an array. The path goes through nested objects with dots,
+// as in realm_access.roles, but a claim named with dots, as namespaced claims
+// like https://example.com/roles are, matches as a whole first.
+func claimValues(claims map[string]interface{}, path string) []string {
+	switch v := claimAt(claims, path).(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func claimAt(claims map[string]interface{}, path string) interface{} {
+	if v, ok := claims[path]; ok {
+		return v
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if nested, ok := claims[path[:i]].(map[string]interface{}); ok {
+			if v := claimAt(nested, path[i+1:]); v != nil {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// rolesClaim returns the path of the claim role mappings match.
+func (fm *FlagManager) rolesClaim() string {
+	if fm.config.JWTRolesClaim != "" {
+		return fm.config.JWTRolesClaim
+	}
+	return defaultRolesClaim
+}
+
+// mappedRoles returns the roles the mappings give to a token carrying values
+// in its roles claim, and the mapped role names that match no role.
+func (fm *FlagManager) mappedRoles(ctx context.Context, values []string) (roles []db.ScopedRole, unknown []string, err error) {
+	var matched []RoleMapping
+	for _, m := range fm.config.RoleMappings {
+		if slices.Contains(values, m.Value) {
+			matched = append(matched, m)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, nil, nil
+	}
+
+	all, err := fm.store.ListRoles(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byName := make(map[string]db.Role, len(all))
+	for _, role := range all {
+		byName[role.Name] = role
+	}
+	for _, m := range matched {
+		role, ok := byName[m.Role]
+		if !ok {
+			if !slices.Contains(unknown, m.Role) {
+				unknown = append(unknown, m.Role)
+			}
+			continue
+		}
+		roles = append(roles, db.ScopedRole{Role: role, Project: m.Project, FlagSet: m.FlagSet})
+	}
+	return roles, unknown, nil
+}
+
+// checkRoleMappings logs the mappings naming roles that do not exist, which
+// give no permissions.
+func (fm *FlagManager) checkRoleMappings(ctx context.Context) {
+	if fm.store == nil || len(fm.config.RoleMappings) == 0 {
+		return
+	}
+	roles, err := fm.store.ListRoles(ctx)
+	if err != nil {
+		slog.Warn("Failed to check role mappings", "error", err)
+		return
+	}
+	for _, m := range fm.config.RoleMappings {
+		if !slices.ContainsFunc(roles, func(r db.Role) bool { return r.Name == m.Role }) {
+			slog.Warn("Role mapping names an unknown role", "value", m.Value, "role", m.Role)
+		}
+	}
+}
+
+// RoleMappingsResponse is the role mapping configuration.
+type RoleMappingsResponse struct {
+	Claim    string        `json:"claim"`
+	Mappings []RoleMapping `json:"mappings"`
+}
+
+func (fm *FlagManager) listRoleMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	mappings := fm.config.RoleMappings
+	if mappings == nil {
+		mappings = []RoleMapping{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RoleMappingsResponse{Claim: fm.rolesClaim(), Mappings: mappings})
+}
+
+// RoleMappingDebugResponse shows how a token is mapped to roles: the values
+// of its roles claim, the mappings they match and the roles and permissions
+// these give.
+type RoleMappingDebugResponse struct {
+	Claim        string             `json:"claim"`
+	Values       []string           `json:"values"`
+	Matched      []RoleMapping      `json:"matched"`
+	Roles        []db.ScopedRole    `json:"roles"`
+	UnknownRoles []string           `json:"unknownRoles,omitempty"` // mapped role names matching no role
+	Permissions  []ScopedPermission `json:"permissions"`
+}
+
+// debugRoleMappingsHandler maps a token, the claims of one, or without either
+// the caller's own token, to roles. Tokens are decoded without being verified,
+// so that tokens of other users or environments can be checked.
+func (fm *FlagManager) debugRoleMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	if fm.store == nil {
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for RBAC")
+		return
+	}
+
+	var body struct {
+		Token  string                 `json:"token,omitempty"`
+		Claims map[string]interface{} `json:"claims,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+			return
+		}
+	}
+
+	var values []string
+	switch {
+	case body.Token != "" && body.Claims != nil:
+		writeError(w, http.StatusBadRequest, "BAD_REQUEST", "token and claims cannot both be set")
+		return
+	case body.Token != "":
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser().ParseUnverified(strings.TrimPrefix(body.Token, "Bearer "), claims); err != nil {
+			writeValidationError(w, "INVALID_TOKEN", "Token cannot be decoded", err.Error())
+			return
+		}
+		values = claimValues(claims, fm.rolesClaim())
+	case body.Claims != nil:
+		values = claimValues(body.Claims, fm.rolesClaim())
+	default:
+		values = GetActor(r).RoleClaims
+	}
+
+	resp := RoleMappingDebugResponse{
+		Claim:   fm.rolesClaim(),
+		Values:  values,
+		Matched: []RoleMapping{},
+	}
+	if resp.Values == nil {
+		resp.Values = []string{}
+	}
+	for _, m := range fm.config.RoleMappings {
+		if slices.Contains(values, m.Value) {
+			resp.Matched = append(resp.Matched, m)
+		}
+	}
+	roles, unknown, err := fm.mappedRoles(r.Context(), values)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if roles == nil {
+		roles = []db.ScopedRole{}
+	}
+	resp.Roles = roles
+	resp.UnknownRoles = unknown
+	resp.Permissions = scopedPermissions(roles)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
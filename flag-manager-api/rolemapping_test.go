@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestRoleMappings(t *testing.T) {
+	for _, value := range []string{
+		`{"value":"devs"}`,
+		`[{"value":"devs"}]`,
+		`[{"value":"devs","role":"editor","project":"shop","flagSet":"fs"}]`,
+		`[{"value":"devs","role":"editor","project":"../shop"}]`,
+	} {
+		if _, err := parseRoleMappings(value); err == nil {
+			t.Errorf("Expected %s to be rejected", value)
+		}
+	}
+
+	claims := map[string]interface{}{
+		"groups":                   []interface{}{"devs", 42, "ops"},
+		"realm_access":             map[string]interface{}{"roles": []interface{}{"flag-admin"}},
+		"https://example.com/role": "auditor",
+	}
+	for path, want := range map[string][]string{
+		"groups":                   {"devs", "ops"},
+		"realm_access.roles":       {"flag-admin"},
+		"https://example.com/role": {"auditor"},
+		"missing.roles":            nil,
+	} {
+		if got := claimValues(claims, path); !reflect.DeepEqual(got, want) {
+			t.Errorf("claimValues(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	mappings, err := parseRoleMappings(`[
+		{"value":"flag-admin","role":"owner"},
+		{"value":"shop-devs","role":"editor","project":"shop"},
+		{"value":"auditors","role":"auditor"}
+	]`)
+	if err != nil {
+		t.Fatalf("Failed to parse role mappings: %v", err)
+	}
+	fm := &FlagManager{
+		config:  Config{FlagsDir: tempDir, JWTRolesClaim: "realm_access.roles", RoleMappings: mappings},
+		store:   store,
+		storage: &dbStorage{store: store},
+		changes: NewChangeFeed(),
+	}
+	fm.audit = NewAuditLogger(store, fm.changes)
+	router := setupTestRouter(fm)
+
+	as := func(actor Actor, method, path, body string, status int, v interface{}) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), ctxActor, actor))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != status {
+			t.Fatalf("%s %s as %+v: expected status %d, got %d: %s", method, path, actor, status, rr.Code, rr.Body.String())
+		}
+		if v != nil {
+			json.Unmarshal(rr.Body.Bytes(), v)
+		}
+	}
+	flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+	admin := Actor{ID: "ada", Type: "user", RoleClaims: []string{"flag-admin"}}
+	dev := Actor{ID: "dev", Type: "user", RoleClaims: []string{"shop-devs", "auditors"}}
+	stranger := Actor{ID: "stranger", Type: "user"}
+
+	fm.authEnabled = true
+	defer func() { fm.authEnabled = false }()
+
+	t.Run("mapped roles", func(t *testing.T) {
+		// With mappings configured, users without roles get no access even
+		// before any role is assigned
+		as(stranger, "GET", "/api/projects", "", http.StatusForbidden, nil)
+		as(admin, "POST", "/api/projects/shop/flags/checkout", flag, http.StatusCreated, nil)
+		as(admin, "POST", "/api/projects/blog/flags/comments", flag, http.StatusCreated, nil)
+		as(dev, "PUT", "/api/projects/shop/flags/checkout", `{"config":`+flag+`}`, http.StatusOK, nil)
+		as(dev, "GET", "/api/projects/blog/flags", "", http.StatusForbidden, nil)
+
+		var perms UserPermissionsResponse
+		as(dev, "GET", "/api/users/me/permissions", "", http.StatusOK, &perms)
+		if len(perms.Roles) != 1 || perms.Roles[0].Name != "editor" || perms.Roles[0].Project != "shop" {
+			t.Errorf("Expected the mapped editor role on shop, got %+v", perms.Roles)
+		}
+	})
+
+	t.Run("assigned roles add to mapped roles", func(t *testing.T) {
+		var roles RolesResponse
+		as(admin, "GET", "/api/roles", "", http.StatusOK, &roles)
+		for _, role := range roles.Roles {
+			if role.Name == "viewer" {
+				as(admin, "PUT", "/api/users/dev/roles", `{"assignments":[{"roleId":"`+role.ID+`","project":"blog"}]}`, http.StatusOK, nil)
+			}
+		}
+		as(dev, "GET", "/api/projects/blog/flags", "", http.StatusOK, nil)
+		as(dev, "PUT", "/api/users/dev/roles", `{"roleIds":[]}`, http.StatusForbidden, nil)
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		var config RoleMappingsResponse
+		as(admin, "GET", "/api/auth/role-mappings", "", http.StatusOK, &config)
+		if config.Claim != "realm_access.roles" || len(config.Mappings) != 3 {
+			t.Errorf("Expected the role mapping configuration, got %+v", config)
+		}
+
+		encode := func(v string) string { return base64.RawURLEncoding.EncodeToString([]byte(v)) }
+		token := encode(`{"alg":"none"}`) + "." + encode(`{"sub":"dev","realm_access":{"roles":["shop-devs","auditors","other"]}}`) + "."
+		var debug RoleMappingDebugResponse
+		as(admin, "POST", "/api/auth/role-mappings/debug", `{"token":"`+token+`"}`, http.StatusOK, &debug)
+		if !reflect.DeepEqual(debug.Values, []string{"shop-devs", "auditors", "other"}) || len(debug.Matched) != 2 {
+			t.Errorf("Expected the token's claim values and two matched mappings, got %+v", debug)
+		}
+		if len(debug.Roles) != 1 || debug.Roles[0].Project != "shop" || !reflect.DeepEqual(debug.UnknownRoles, []string{"auditor"}) {
+			t.Errorf("Expected the editor role and the unknown auditor role, got %+v", debug)
+		}
+
+		debug = RoleMappingDebugResponse{}
+		as(admin, "POST", "/api/auth/role-mappings/debug", `{"claims":{"realm_access":{"roles":["flag-admin"]}}}`, http.StatusOK, &debug)
+		if len(debug.Roles) != 1 || debug.Roles[0].Name != "owner" || !debug.Roles[0].Global() {
+			t.Errorf("Expected the global owner role, got %+v", debug.Roles)
+		}
+
+		debug = RoleMappingDebugResponse{}
+		as(admin, "POST", "/api/auth/role-mappings/debug", "", http.StatusOK, &debug)
+		if !reflect.DeepEqual(debug.Values, []string{"flag-admin"}) {
+			t.Errorf("Expected the caller's own claim values, got %+v", debug.Values)
+		}
+
+		as(admin, "POST", "/api/auth/role-mappings/debug", `{"token":"not-a-token"}`, http.StatusBadRequest, nil)
+		as(dev, "POST", "/api/auth/role-mappings/debug", `{"token":"`+token+`"}`, http.StatusForbidden, nil)
+	})
+}
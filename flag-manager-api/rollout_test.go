@@ -518,6 +518,91 @@ func TestRolloutStrategies(t *testing.T) {
 		}
 	})
 
+	t.Run("scheduled rollout - relative steps resolved to dates", func(t *testing.T) {
+		before := time.Now().UTC().Truncate(time.Second)
+
+		flagConfig := FlagConfig{
+			Variations: map[string]interface{}{
+				"enabled":  true,
+				"disabled": false,
+			},
+			DefaultRule: &DefaultRule{
+				Variation: "disabled",
+			},
+			ScheduledRollout: []ScheduledStep{
+				{After: "24h", DefaultRule: &DefaultRule{Percentage: map[string]float64{"enabled": 50, "disabled": 50}}},
+				{After: "2d", DefaultRule: &DefaultRule{Variation: "enabled"}},
+			},
+		}
+
+		body, _ := json.Marshal(flagConfig)
+		req := httptest.NewRequest("POST", "/api/projects/rollout-tests/flags/scheduled-relative", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != 201 {
+			t.Fatalf("Expected 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var response struct {
+			Config FlagConfig `json:"config"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &response)
+
+		for i, wantOffset := range []time.Duration{24 * time.Hour, 72 * time.Hour} {
+			step := response.Config.ScheduledRollout[i]
+			if step.After != "" {
+				t.Errorf("Step %d: expected after to be cleared, got %q", i+1, step.After)
+			}
+			date, err := time.Parse(time.RFC3339, step.Date)
+			if err != nil {
+				t.Fatalf("Step %d: invalid date %q", i+1, step.Date)
+			}
+			if offset := date.Sub(before); offset < wantOffset || offset > wantOffset+time.Minute {
+				t.Errorf("Step %d: expected date ~%v after save, got %v", i+1, wantOffset, offset)
+			}
+		}
+	})
+
+	t.Run("scheduled rollout - mixing absolute and relative rejected", func(t *testing.T) {
+		future := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+
+		tests := map[string][]ScheduledStep{
+			"same step": {
+				{Date: future, After: "24h", DefaultRule: &DefaultRule{Variation: "enabled"}},
+			},
+			"across steps": {
+				{Date: future, DefaultRule: &DefaultRule{Variation: "enabled"}},
+				{After: "24h", DefaultRule: &DefaultRule{Variation: "disabled"}},
+			},
+		}
+
+		for name, steps := range tests {
+			flagConfig := FlagConfig{
+				Variations: map[string]interface{}{
+					"enabled":  true,
+					"disabled": false,
+				},
+				DefaultRule: &DefaultRule{
+					Variation: "disabled",
+				},
+				ScheduledRollout: steps,
+			}
+
+			body, _ := json.Marshal(flagConfig)
+			req := httptest.NewRequest("POST", "/api/projects/rollout-tests/flags/scheduled-mixed", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != 400 {
+				t.Errorf("%s: expected 400, got %d: %s", name, rr.Code, rr.Body.String())
+			}
+			if !bytes.Contains(rr.Body.Bytes(), []byte("INVALID_FLAG_CONFIG")) {
+				t.Errorf("%s: expected INVALID_FLAG_CONFIG, got %s", name, rr.Body.String())
+			}
+		}
+	})
+
 	// ==========================================================================
 	// EXPERIMENTATION
 	// ==========================================================================
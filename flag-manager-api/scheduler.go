@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// defaultSchedulerInterval is how often due scheduled rollout steps are applied
+// when SCHEDULER_INTERVAL is not set.
+const defaultSchedulerInterval = time.Minute
+
+// schedulerActor is the audit actor of changes made by the rollout scheduler.
+var schedulerActor = Actor{ID: "scheduler", Name: "scheduler", Type: "system"}
+
+// parseSchedulerInterval reads the SCHEDULER_INTERVAL setting. Empty values use
+// the default; zero disables the scheduler. Invalid values keep the default.
+func parseSchedulerInterval(value string) time.Duration {
+	if value == "" {
+		return defaultSchedulerInterval
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid SCHEDULER_INTERVAL, using default", "value", value, "default", defaultSchedulerInterval)
+		return defaultSchedulerInterval
+	}
+	if d > 0 && d < time.Second {
+		slog.Warn("SCHEDULER_INTERVAL is below 1s, using 1s", "value", d)
+		d = time.Second
+	}
+	return d
+}
+
+// applyProjectScheduledSteps rewrites the flags of a project whose scheduled
+// rollout steps are due, auditing each flag changed. It returns the number of
+// steps applied.
+func (fm *FlagManager) applyProjectScheduledSteps(ctx context.Context, project string, now time.Time) (int, error) {
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.loadStoredProjectFlags(ctx, project)
+	if err != nil || flags == nil {
+		return 0, err
+	}
+
+	type appliedFlag struct {
+		before FlagConfig
+		dates  []string
+	}
+	applied := make(map[string]appliedFlag)
+	var changed []string
+	for key, config := range flags {
+		updated, steps := applyScheduledRollout(config, now)
+		if len(steps) == 0 {
+			continue
+		}
+		dates := make([]string, len(steps))
+		for i, step := range steps {
+			dates[i] = step.Date
+		}
+		applied[key] = appliedFlag{before: config, dates: dates}
+		flags[key] = updated
+		changed = append(changed, key)
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	flagIDs, err := fm.saveStoredProjectFlags(ctx, project, flags, changed)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, key := range changed {
+		a := applied[key]
+		count += len(a.dates)
+		fm.audit.Log(ctx, schedulerActor, "flag.scheduled_step_applied", "flag", flagIDs[key], key, project,
+			map[string]interface{}{"before": a.before, "after": flags[key]},
+			map[string]interface{}{"steps": a.dates})
+		slog.InfoContext(ctx, "Applied scheduled rollout steps", "project", project, "flag", key, "steps", len(a.dates))
+	}
+	return count, nil
+}
+
+// applyScheduledSteps applies every due scheduled rollout step across all
+// projects and refreshes the relay proxy if any flag changed. A failing
+// project does not stop the others; the first error is returned.
+func (fm *FlagManager) applyScheduledSteps(ctx context.Context, now time.Time) (int, error) {
+	projects, err := fm.listAllProjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var firstErr error
+	for _, project := range projects {
+		n, err := fm.applyProjectScheduledSteps(ctx, project, now)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to apply scheduled steps", "project", project, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		total += n
+	}
+
+	if total > 0 {
+		fm.scheduleRelayRefresh(ctx)
+	}
+	return total, firstErr
+}
+
+// runRolloutScheduler applies due scheduled rollout steps every interval, so
+// they take effect even where flags are evaluated without time-based rollout
+// support. It returns when ctx is done.
+func (fm *FlagManager) runRolloutScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := fm.applyScheduledSteps(ctx, now)
+			if err != nil {
+				backgroundJobFailuresTotal.Add(1, "job", "rollout_scheduler")
+			}
+			scheduledStepsAppliedTotal.Add(float64(n))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRolloutScheduler(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	req := httptest.NewRequest("POST", "/api/projects/sched-tests", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	flagConfig := map[string]interface{}{
+		"variations": map[string]interface{}{"on": true, "off": false},
+		"targeting": []map[string]interface{}{
+			{"name": "beta", "query": `beta eq true`, "percentage": map[string]float64{"on": 10, "off": 90}},
+		},
+		"defaultRule": map[string]interface{}{"variation": "off"},
+		"scheduledRollout": []map[string]interface{}{
+			{
+				"date":        "2030-01-01T00:00:00Z",
+				"targeting":   []map[string]interface{}{{"name": "beta", "percentage": map[string]float64{"on": 50, "off": 50}}},
+				"defaultRule": map[string]interface{}{"variation": "on"},
+			},
+			{"date": "2031-01-01T00:00:00Z", "targeting": []map[string]interface{}{{"name": "staff", "query": `staff eq true`, "variation": "on"}}},
+		},
+	}
+	body, _ := json.Marshal(flagConfig)
+	req = httptest.NewRequest("POST", "/api/projects/sched-tests/flags/checkout", bytes.NewReader(body))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create flag: %d %s", rr.Code, rr.Body.String())
+	}
+
+	getFlag := func() FlagConfig {
+		flags, err := fm.readProjectFlags("sched-tests")
+		if err != nil {
+			t.Fatalf("Failed to read flags: %v", err)
+		}
+		return flags["checkout"]
+	}
+
+	if n, err := fm.applyScheduledSteps(context.Background(), time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil || n != 0 {
+		t.Fatalf("Expected no steps due yet, got %d (%v)", n, err)
+	}
+
+	sub := fm.changes.Subscribe()
+	defer fm.changes.Unsubscribe(sub)
+	sub.update([]string{"sched-tests"}, nil, true)
+
+	now := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	if n, err := fm.applyScheduledSteps(context.Background(), now); err != nil || n != 1 {
+		t.Fatalf("Expected 1 step applied, got %d (%v)", n, err)
+	}
+
+	config := getFlag()
+	if config.DefaultRule == nil || config.DefaultRule.Variation != "on" {
+		t.Errorf("Expected default rule to serve on, got %+v", config.DefaultRule)
+	}
+	if len(config.Targeting) != 1 || config.Targeting[0].Percentage["on"] != 50 || config.Targeting[0].Query != `beta eq true` {
+		t.Errorf("Expected beta rule merged to 50%%, got %+v", config.Targeting)
+	}
+	if len(config.ScheduledRollout) != 1 || config.ScheduledRollout[0].Date != "2031-01-01T00:00:00Z" {
+		t.Errorf("Expected only the 2031 step to remain, got %+v", config.ScheduledRollout)
+	}
+
+	select {
+	case data := <-sub.messages:
+		var event ChangeEvent
+		json.Unmarshal(data, &event)
+		if event.Action != "flag.scheduled_step_applied" || event.Actor.Name != "scheduler" || event.ResourceName != "checkout" {
+			t.Errorf("Unexpected audit event %+v", event)
+		}
+	default:
+		t.Error("Expected the applied step to be audited")
+	}
+
+	// Applied steps are not applied again
+	if n, _ := fm.applyScheduledSteps(context.Background(), now); n != 0 {
+		t.Errorf("Expected no steps on second run, got %d", n)
+	}
+
+	// Unnamed or new rules are appended
+	if n, _ := fm.applyScheduledSteps(context.Background(), time.Date(2031, 6, 1, 0, 0, 0, 0, time.UTC)); n != 1 {
+		t.Errorf("Expected 1 step applied, got %d", n)
+	}
+	config = getFlag()
+	if len(config.Targeting) != 2 || config.Targeting[1].Name != "staff" || len(config.ScheduledRollout) != 0 {
+		t.Errorf("Expected staff rule appended and schedule emptied, got %+v / %+v", config.Targeting, config.ScheduledRollout)
+	}
+}
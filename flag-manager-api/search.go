@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Searched flag fields, from the most to the least relevant. The weights are
+// those PostgreSQL's ts_rank gives the A to D labels of the search vectors.
+var (
+	searchFieldNames   = [...]string{"key", "description", "variations", "targeting"}
+	searchFieldWeights = [...]float64{1.0, 0.4, 0.2, 0.1}
+)
+
+// SearchResult is a flag matching a search, in its project or flag set.
+type SearchResult struct {
+	Project     string   `json:"project,omitempty"`
+	FlagSet     string   `json:"flagSet,omitempty"` // flag set ID
+	FlagSetName string   `json:"flagSetName,omitempty"`
+	Key         string   `json:"key"`
+	Description string   `json:"description,omitempty"`
+	Matches     []string `json:"matches"` // fields the query matched
+	Score       float64  `json:"score"`
+}
+
+// SearchResponse lists the flags matching a search, best match first.
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+	Total   int            `json:"total"`
+}
+
+// searchWords splits text into lowercase words of letters and digits.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchDoc is the searchable text of a project or flag set flag.
+type searchDoc struct {
+	project     string
+	flagSetID   string
+	key         string
+	description string
+	words       [len(searchFieldNames)][]string
+}
+
+func newSearchDoc(project, flagSetID, key string, config FlagConfig) searchDoc {
+	doc := searchDoc{project: project, flagSetID: flagSetID, key: key}
+	doc.description, _ = config.Metadata["description"].(string)
+
+	doc.words[0] = append([]string{strings.ToLower(key)}, searchWords(key)...)
+	doc.words[1] = searchWords(doc.description)
+	for name := range config.Variations {
+		doc.words[2] = append(doc.words[2], searchWords(name)...)
+	}
+	for _, rule := range config.Targeting {
+		doc.words[3] = append(doc.words[3], searchWords(rule.Query)...)
+	}
+	return doc
+}
+
+// match scores a flag against search terms, which must each prefix a word of
+// one of its fields. ok is false if a term matches nowhere.
+func (d searchDoc) match(terms []string) (score float64, fields []string, ok bool) {
+	var matched [len(searchFieldNames)]bool
+	for _, term := range terms {
+		found := false
+		for field, words := range d.words {
+			for _, word := range words {
+				if strings.HasPrefix(word, term) {
+					score += searchFieldWeights[field]
+					matched[field] = true
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return 0, nil, false
+		}
+	}
+	for field, m := range matched {
+		if m {
+			fields = append(fields, searchFieldNames[field])
+		}
+	}
+	return score, fields, true
+}
+
+// flagSearchIndex keeps the search documents of every flag in file mode. Flag
+// file writes invalidate it and the next search rebuilds it. The zero value is
+// ready to use.
+type flagSearchIndex struct {
+	generation atomic.Uint64 // bumped by every flag write
+
+	mu    sync.Mutex
+	built bool
+	at    uint64 // generation the documents were built at
+	docs  []searchDoc
+}
+
+// invalidate marks the index stale. It takes no lock, so it may be called with
+// fileMu held.
+func (idx *flagSearchIndex) invalidate() {
+	idx.generation.Add(1)
+}
+
+// documents returns the search documents, rebuilding them with build if a flag
+// was written since they were last built.
+func (idx *flagSearchIndex) documents(build func() ([]searchDoc, error)) ([]searchDoc, error) {
+	generation := idx.generation.Load()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.built && idx.at == generation {
+		return idx.docs, nil
+	}
+	docs, err := build()
+	if err != nil {
+		return nil, err
+	}
+	idx.docs, idx.at, idx.built = docs, generation, true
+	return docs, nil
+}
+
+// searchDocuments reads every project and flag set flag into search documents.
+func (fm *FlagManager) searchDocuments(ctx context.Context) ([]searchDoc, error) {
+	var docs []searchDoc
+
+	flagSetFiles := make(map[string]bool)
+	if fm.store != nil {
+		flagSets, err := fm.store.ListFlagSets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, fs := range flagSets {
+			rawFlags, err := fm.store.ListFlagSetFlags(ctx, fs.ID)
+			if err != nil {
+				return nil, err
+			}
+			for key, raw := range rawFlags {
+				var config FlagConfig
+				json.Unmarshal(raw, &config)
+				docs = append(docs, newSearchDoc("", fs.ID, key, config))
+			}
+		}
+	} else if fm.flagSets != nil {
+		for _, fs := range fm.flagSets.List() {
+			// Flag set files sit next to project files and are listed as projects
+			flagSetFiles[strings.TrimSuffix(filepath.Base(fm.getFlagSetFilePath(fs.ID)), ".yaml")] = true
+
+			flags, err := fm.readFlagSetFlags(fs.ID)
+			if err != nil {
+				return nil, err
+			}
+			for key, v := range flags {
+				var config FlagConfig
+				if data, err := json.Marshal(v); err == nil {
+					json.Unmarshal(data, &config)
+				}
+				docs = append(docs, newSearchDoc("", fs.ID, key, config))
+			}
+		}
+	}
+
+	projects, err := fm.storage.ListProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		if flagSetFiles[project] {
+			continue
+		}
+		flags, err := fm.storage.ListFlags(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		for key, config := range flags {
+			docs = append(docs, newSearchDoc(project, "", key, config))
+		}
+	}
+	return docs, nil
+}
+
+// searchFlags returns the flags best matching terms. PostgreSQL searches its
+// full-text index; file mode searches the in-memory index and SQLite the
+// stored flags.
+func (fm *FlagManager) searchFlags(ctx context.Context, terms []string, limit int) ([]SearchResult, error) {
+	results := []SearchResult{}
+
+	if fm.store != nil && !fm.store.SQLite() {
+		hits, err := fm.store.SearchFlags(ctx, terms, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, hit := range hits {
+			var config FlagConfig
+			json.Unmarshal(hit.Config, &config)
+			doc := newSearchDoc(hit.Project, hit.FlagSetID, hit.Key, config)
+			_, fields, _ := doc.match(terms)
+			results = append(results, SearchResult{
+				Project:     hit.Project,
+				FlagSet:     hit.FlagSetID,
+				FlagSetName: hit.FlagSetName,
+				Key:         hit.Key,
+				Description: doc.description,
+				Matches:     fields,
+				Score:       hit.Rank,
+			})
+		}
+		return results, nil
+	}
+
+	build := func() ([]searchDoc, error) { return fm.searchDocuments(ctx) }
+	var docs []searchDoc
+	var err error
+	if fm.store == nil {
+		docs, err = fm.searchIndex.documents(build)
+	} else {
+		docs, err = build()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	flagSetNames := make(map[string]string)
+	if fm.store != nil {
+		flagSets, err := fm.store.ListFlagSets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, fs := range flagSets {
+			flagSetNames[fs.ID] = fs.Name
+		}
+	} else if fm.flagSets != nil {
+		for _, fs := range fm.flagSets.List() {
+			flagSetNames[fs.ID] = fs.Name
+		}
+	}
+
+	for _, doc := range docs {
+		score, fields, ok := doc.match(terms)
+		if !ok {
+			continue
+		}
+		result := SearchResult{
+			Project:     doc.project,
+			FlagSet:     doc.flagSetID,
+			Key:         doc.key,
+			Description: doc.description,
+			Matches:     fields,
+			Score:       score,
+		}
+		if doc.flagSetID != "" {
+			name, ok := flagSetNames[doc.flagSetID]
+			if !ok {
+				continue // deleted flag set
+			}
+			result.FlagSetName = name
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.FlagSetName != b.FlagSetName {
+			return a.FlagSetName < b.FlagSetName
+		}
+		return a.Key < b.Key
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// searchHandler searches flag keys, descriptions, variation names and
+// targeting queries across every project and flag set.
+func (fm *FlagManager) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	terms := searchWords(query)
+	if len(terms) == 0 {
+		writeValidationError(w, "QUERY_REQUIRED", "q must contain at least one word")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			writeValidationError(w, "INVALID_LIMIT", "limit must be between 1 and "+strconv.Itoa(maxSearchLimit))
+			return
+		}
+		limit = n
+	}
+
+	results, err := fm.searchFlags(r.Context(), terms, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{
+		Query:   query,
+		Results: results,
+		Total:   len(results),
+	})
+}
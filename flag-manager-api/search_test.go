@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagSearch(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			search := func(query string) []string {
+				t.Helper()
+				var resp SearchResponse
+				doRequest(t, router, "GET", "/api/search?q="+url.QueryEscape(query), "", http.StatusOK, &resp)
+				var found []string
+				for _, result := range resp.Results {
+					where := result.Project
+					if result.FlagSet != "" {
+						where = "set:" + result.FlagSetName
+					}
+					found = append(found, where+"/"+result.Key+"="+strings.Join(result.Matches, ","))
+				}
+				return found
+			}
+
+			doRequest(t, router, "POST", "/api/projects/shop/flags/new-checkout", `{"variations":{"enabled":true,"disabled":false},"defaultRule":{"variation":"disabled"},
+				"metadata":{"description":"Redesigned payment page"}}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/banner", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},
+				"targeting":[{"query":"checkout eq true","variation":"on"}]}`, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/blog/flags/comments", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+			var flagSet FlagSet
+			doRequest(t, router, "POST", "/api/flagsets", `{"name":"mobile"}`, http.StatusCreated, &flagSet)
+			doRequest(t, router, "POST", "/api/flagsets/"+flagSet.ID+"/flags/checkout-v2", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+			// Key matches rank above targeting matches
+			if found := search("check"); !reflect.DeepEqual(found, []string{"set:mobile/checkout-v2=key", "shop/new-checkout=key", "shop/banner=targeting"}) {
+				t.Errorf("Expected the checkout flags, got %v", found)
+			}
+			if found := search("Payment page"); !reflect.DeepEqual(found, []string{"shop/new-checkout=description"}) {
+				t.Errorf("Expected a description match, got %v", found)
+			}
+			if found := search("enabl"); !reflect.DeepEqual(found, []string{"shop/new-checkout=variations"}) {
+				t.Errorf("Expected a variation match, got %v", found)
+			}
+			if found := search("checkout missing"); len(found) != 0 {
+				t.Errorf("Expected every word to be required, got %v", found)
+			}
+
+			// Writes are searchable right away; archived flags stay searchable
+			// until purged
+			doRequest(t, router, "DELETE", "/api/projects/shop/flags/new-checkout", "", http.StatusNoContent, nil)
+			doRequest(t, router, "DELETE", "/api/projects/shop/flags/new-checkout", "", http.StatusNoContent, nil)
+			doRequest(t, router, "POST", "/api/projects/blog/flags/checkout-promo", `{"variations":{"on":true},"defaultRule":{"variation":"on"}}`, http.StatusCreated, nil)
+			if found := search("checkout"); !reflect.DeepEqual(found, []string{"set:mobile/checkout-v2=key", "blog/checkout-promo=key", "shop/banner=targeting"}) {
+				t.Errorf("Expected the index to follow writes, got %v", found)
+			}
+
+			var limited SearchResponse
+			doRequest(t, router, "GET", "/api/search?q=checkout&limit=1", "", http.StatusOK, &limited)
+			if limited.Total != 1 {
+				t.Errorf("Expected one result, got %+v", limited)
+			}
+			doRequest(t, router, "GET", "/api/search?q=%20-%20", "", http.StatusBadRequest, nil)
+			doRequest(t, router, "GET", "/api/search?q=checkout&limit=0", "", http.StatusBadRequest, nil)
+		})
+	}
+}
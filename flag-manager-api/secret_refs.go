@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/git"
+	"flag-manager-api/httpclient"
+)
+
+// defaultSecretRefsCacheTTL is how long a resolved secret reference is reused.
+const defaultSecretRefsCacheTTL = 5 * time.Minute
+
+// secretRefSchemes are the schemes of the secret providers. A secret field
+// set to <scheme>://<reference> holds a reference to a secret kept by the
+// provider rather than the secret itself.
+var secretRefSchemes = map[string]bool{"vault": true, "awssm": true}
+
+// isSecretRef reports whether a secret field holds a secret reference.
+func isSecretRef(value string) bool {
+	scheme, ref, ok := strings.Cut(value, "://")
+	return ok && ref != "" && secretRefSchemes[scheme]
+}
+
+// SecretProvider resolves the references of a scheme, given without the
+// scheme, to the secrets they name.
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// secretRefResolver resolves secret references with the provider of their
+// scheme, caching the secrets for a while. A nil resolver has no providers.
+type secretRefResolver struct {
+	providers map[string]SecretProvider
+	ttl       time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// newSecretRefResolver returns the resolver of the vault:// references, read
+// from the Vault KV v2 engine at VAULT_ADDR with VAULT_TOKEN (or the token of
+// VAULT_TOKEN_FILE) in VAULT_NAMESPACE, and of the awssm:// references, read
+// from AWS Secrets Manager in SECRET_REFS_AWS_REGION (or AWS_REGION) with the
+// AWS_* credentials. SECRET_REFS_CACHE_TTL sets how long secrets are reused.
+func newSecretRefResolver(getenv func(string) string) *secretRefResolver {
+	region := getenv("SECRET_REFS_AWS_REGION")
+	if region == "" {
+		region = getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = s3DefaultRegion
+	}
+	vault := &vaultSecretProvider{addr: strings.TrimSuffix(getenv("VAULT_ADDR"), "/"), token: getenv("VAULT_TOKEN"), namespace: getenv("VAULT_NAMESPACE")}
+	if file := getenv("VAULT_TOKEN_FILE"); file != "" && vault.token == "" {
+		vault.tokenFile = file
+	}
+	return &secretRefResolver{
+		providers: map[string]SecretProvider{
+			"vault": vault,
+			"awssm": &awsSecretsManagerProvider{region: region, endpoint: getenv("SECRET_REFS_AWS_ENDPOINT")},
+		},
+		ttl:   parseServerDuration("SECRET_REFS_CACHE_TTL", getenv("SECRET_REFS_CACHE_TTL"), defaultSecretRefsCacheTTL),
+		cache: make(map[string]cachedSecret),
+	}
+}
+
+// resolve returns the secret value references, or value itself if it is not
+// a reference.
+func (r *secretRefResolver) resolve(ctx context.Context, value string) (string, error) {
+	if !isSecretRef(value) {
+		return value, nil
+	}
+	scheme, ref, _ := strings.Cut(value, "://")
+	var provider SecretProvider
+	if r != nil {
+		provider = r.providers[scheme]
+	}
+	if provider == nil {
+		return "", fmt.Errorf("no secret provider for %s:// references", scheme)
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[value]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	secret, err := provider.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", value, err)
+	}
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[value] = cachedSecret{value: secret, expires: now.Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return secret, nil
+}
+
+// resolveFields replaces the secret references among fields by their secrets.
+func (r *secretRefResolver) resolveFields(ctx context.Context, fields []*string) error {
+	for _, field := range fields {
+		secret, err := r.resolve(ctx, *field)
+		if err != nil {
+			return err
+		}
+		*field = secret
+	}
+	return nil
+}
+
+// resolveConfig returns a generated configuration with every secret reference
+// in its values replaced by the secret, as generic JSON values.
+func (r *secretRefResolver) resolveConfig(ctx context.Context, config interface{}) (interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	var walk func(v interface{}) (interface{}, error)
+	walk = func(v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case string:
+			return r.resolve(ctx, v)
+		case map[string]interface{}:
+			for key, value := range v {
+				resolved, err := walk(value)
+				if err != nil {
+					return nil, err
+				}
+				v[key] = resolved
+			}
+		case []interface{}:
+			for i, value := range v {
+				resolved, err := walk(value)
+				if err != nil {
+					return nil, err
+				}
+				v[i] = resolved
+			}
+		}
+		return v, nil
+	}
+	return walk(generic)
+}
+
+// resolveNotifierSecrets replaces the secret references of the notifiers the
+// manager sends events to. A notifier whose references cannot be resolved
+// keeps them, and fails to send until they can.
+func (fm *FlagManager) resolveNotifierSecrets(ctx context.Context, notifiers []Notifier) {
+	for i := range notifiers {
+		resolved := notifiers[i]
+		if err := fm.secretRefs.resolveFields(ctx, notifierSecrets(&resolved)); err != nil {
+			slog.WarnContext(ctx, "Failed to resolve notifier secrets", "notifier", resolved.ID, "error", err)
+			continue
+		}
+		notifiers[i] = resolved
+	}
+}
+
+// resolveIntegration returns a copy of an integration with the secret
+// references of its credentials resolved.
+func (fm *FlagManager) resolveIntegration(ctx context.Context, gi *GitIntegration) (*GitIntegration, error) {
+	resolved := *gi
+	if err := fm.secretRefs.resolveFields(ctx, integrationSecrets(&resolved)); err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// initGitProvider initializes the git provider of an integration with the
+// secret references of its credentials resolved. It is nil if they cannot be.
+func (fm *FlagManager) initGitProvider(ctx context.Context, gi *GitIntegration) git.Provider {
+	resolved, err := fm.resolveIntegration(ctx, gi)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to resolve integration secrets", "integration", gi.ID, "error", err)
+		return nil
+	}
+	return initGitProviderFromIntegration(resolved)
+}
+
+// fileGitProvider returns the git provider of an integration in file mode:
+// the store's, or for an integration whose credentials are secret references,
+// one initialized with them resolved.
+func (fm *FlagManager) fileGitProvider(ctx context.Context, id string) git.Provider {
+	gi := fm.integrations.GetRaw(id)
+	if gi == nil {
+		return nil
+	}
+	for _, secret := range integrationSecrets(gi) {
+		if isSecretRef(*secret) {
+			return fm.initGitProvider(ctx, gi)
+		}
+	}
+	return fm.integrations.GetProvider(id)
+}
+
+// pickSecretKey returns the key of a secret holding several values, or its
+// only value when no key is named.
+func pickSecretKey(values map[string]interface{}, key string) (string, error) {
+	if key == "" {
+		if len(values) != 1 {
+			return "", fmt.Errorf("secret has %d keys: name one with #<key>", len(values))
+		}
+		for k := range values {
+			key = k
+		}
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no key %q", key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// vaultSecretProvider reads vault://<mount>/<path>#<key> references from a
+// Vault KV version 2 secrets engine.
+type vaultSecretProvider struct {
+	addr, token, tokenFile, namespace string
+}
+
+func (p *vaultSecretProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	if p.addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	path, key, _ := strings.Cut(ref, "#")
+	mount, secretPath, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || secretPath == "" {
+		return "", errors.New("vault references are vault://<mount>/<path>#<key>")
+	}
+	token := p.token
+	if p.tokenFile != "" {
+		data, err := os.ReadFile(p.tokenFile)
+		if err != nil {
+			return "", err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", p.addr+"/v1/"+url.PathEscape(mount)+"/data/"+secretPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+	resp, err := httpclient.Default().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var out struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("parse vault response: %w", err)
+	}
+	return pickSecretKey(out.Data.Data, key)
+}
+
+// awsSecretsManagerProvider reads awssm://<secret id or ARN>#<key>
+// references from AWS Secrets Manager. Without a key the secret string is
+// returned as it is; with one it is parsed as a JSON object.
+type awsSecretsManagerProvider struct {
+	region, endpoint string
+}
+
+func (p *awsSecretsManagerProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	id, key, _ := strings.Cut(ref, "#")
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := awsJSONRequest(ctx, p.region, p.endpoint, "secretsmanager", "secretsmanager.GetSecretValue", map[string]string{"SecretId": id}, &out); err != nil {
+		return "", err
+	}
+	if key == "" {
+		return out.SecretString, nil
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(out.SecretString), &values); err != nil {
+		return "", errors.New("secret is not a JSON object")
+	}
+	return pickSecretKey(values, key)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSecretReferences(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	vaultCalls := 0
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vaultCalls++
+		if r.Header.Get("X-Vault-Token") != "root" || r.URL.Path != "/v1/kv/data/goff/redis" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": map[string]string{"password": "r3d1s", "user": "goff"}}})
+	}))
+	defer vault.Close()
+	fm.secretRefs = newSecretRefResolver(func(name string) string {
+		return map[string]string{"VAULT_ADDR": vault.URL, "VAULT_TOKEN": "root"}[name]
+	})
+
+	ref := "vault://kv/goff/redis#password"
+	rr := doRequest(t, router, "POST", "/api/retrievers", `{"id":"redis","name":"redis","kind":"redis","enabled":true,"redisAddr":"redis:6379","redisPassword":"`+ref+`"}`, http.StatusCreated, nil)
+	// A reference is not a secret, and is shown so that it can be checked
+	if !strings.Contains(rr.Body.String(), ref) {
+		t.Errorf("Expected the reference unmasked, got %s", rr.Body.String())
+	}
+	if data, _ := os.ReadFile(fm.retrievers.configPath); strings.Contains(string(data), "r3d1s") {
+		t.Error("Expected the secret not to be stored")
+	}
+	doRequest(t, router, "POST", "/api/flagsets", `{"id":"production","name":"production"}`, http.StatusCreated, nil)
+
+	for i := 0; i < 2; i++ {
+		rr := doRequest(t, router, "GET", "/api/flagsets/config/relay-proxy", "", http.StatusOK, nil)
+		if !strings.Contains(rr.Body.String(), `"password":"r3d1s"`) || strings.Contains(rr.Body.String(), "vault://") {
+			t.Errorf("Expected the reference resolved in the config, got %s", rr.Body.String())
+		}
+	}
+	if vaultCalls != 1 {
+		t.Errorf("Expected the resolved secret cached, got %d Vault calls", vaultCalls)
+	}
+
+	doRequest(t, router, "PUT", "/api/retrievers/redis", `{"name":"redis","kind":"redis","enabled":true,"redisAddr":"redis:6379","redisPassword":"vault://kv/goff/missing#password"}`, http.StatusOK, nil)
+	rr = doRequest(t, router, "GET", "/api/flagsets/config/relay-proxy", "", http.StatusBadGateway, nil)
+	if !strings.Contains(rr.Body.String(), "SECRET_RESOLUTION_FAILED") {
+		t.Errorf("Expected 502 for an unresolvable reference, got %s", rr.Body.String())
+	}
+
+	// Secret keys must be named when a secret holds several
+	if _, err := fm.secretRefs.resolve(context.Background(), "vault://kv/goff/redis"); err == nil || !strings.Contains(err.Error(), "name one") {
+		t.Errorf("Expected an error for a reference without a key, got %v", err)
+	}
+	var none *secretRefResolver
+	if got, err := none.resolve(context.Background(), "plain"); err != nil || got != "plain" {
+		t.Errorf("Expected plain values to pass through, got %q (%v)", got, err)
+	}
+	if _, err := none.resolve(context.Background(), ref); err == nil {
+		t.Error("Expected references to fail without providers")
+	}
+}
+
+func TestAWSSecretsManagerProvider(t *testing.T) {
+	var target, authorization, secretID string
+	sm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, authorization = r.Header.Get("X-Amz-Target"), r.Header.Get("Authorization")
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+		secretID = req.SecretId
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": `{"token":"glpat-123"}`})
+	}))
+	defer sm.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	resolver := newSecretRefResolver(func(name string) string {
+		return map[string]string{"SECRET_REFS_AWS_REGION": "eu-west-1", "SECRET_REFS_AWS_ENDPOINT": sm.URL}[name]
+	})
+
+	arn := "arn:aws:secretsmanager:eu-west-1:123456789012:secret:goff/gitlab"
+	if got, err := resolver.resolve(context.Background(), "awssm://"+arn+"#token"); err != nil || got != "glpat-123" {
+		t.Fatalf("Expected the key of the secret, got %q (%v)", got, err)
+	}
+	if secretID != arn || target != "secretsmanager.GetSecretValue" || !strings.Contains(authorization, "/eu-west-1/secretsmanager/aws4_request") {
+		t.Errorf("Expected a signed GetSecretValue request for %s, got %q %q %q", arn, secretID, target, authorization)
+	}
+	if got, _ := resolver.resolve(context.Background(), "awssm://goff/gitlab"); got != `{"token":"glpat-123"}` {
+		t.Errorf("Expected the whole secret string without a key, got %q", got)
+	}
+	if _, err := resolver.resolve(context.Background(), "awssm://goff/gitlab#missing"); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+}
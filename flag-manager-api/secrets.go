@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+	"flag-manager-api/httpclient"
+	"flag-manager-api/secrets"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// newSecretsCipher returns the cipher encrypting the secrets of integrations,
+// notifiers, exporters, retrievers, audit sinks, publish targets and project
+// webhooks at rest, or nil to keep them in plaintext. Its key is set by one of
+// SECRETS_ENCRYPTION_KEY, a base64 key of 32 bytes;
+// SECRETS_ENCRYPTION_KEY_FILE, a file holding one; or
+// SECRETS_ENCRYPTION_KMS_KEY, a data key encrypted with AWS KMS, as returned
+// by aws kms generate-data-key, which is decrypted at startup.
+// SECRETS_ENCRYPTION_OLD_KEYS lists the keys replaced by a rotation, still
+// used to decrypt.
+func newSecretsCipher(ctx context.Context, getenv func(string) string) (*secrets.Cipher, error) {
+	keyValue, keyFile, kmsKey := getenv("SECRETS_ENCRYPTION_KEY"), getenv("SECRETS_ENCRYPTION_KEY_FILE"), getenv("SECRETS_ENCRYPTION_KMS_KEY")
+	set := 0
+	for _, v := range []string{keyValue, keyFile, kmsKey} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("set only one of SECRETS_ENCRYPTION_KEY, SECRETS_ENCRYPTION_KEY_FILE and SECRETS_ENCRYPTION_KMS_KEY")
+	}
+
+	var old [][]byte
+	for _, value := range splitList(getenv("SECRETS_ENCRYPTION_OLD_KEYS")) {
+		key, err := secrets.ParseKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_ENCRYPTION_OLD_KEYS: %w", err)
+		}
+		old = append(old, key)
+	}
+
+	var key []byte
+	var err error
+	switch {
+	case keyValue != "":
+		if key, err = secrets.ParseKey(keyValue); err != nil {
+			return nil, fmt.Errorf("SECRETS_ENCRYPTION_KEY: %w", err)
+		}
+	case keyFile != "":
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("SECRETS_ENCRYPTION_KEY_FILE: %w", err)
+		}
+		if key, err = secrets.ParseKey(string(data)); err != nil {
+			return nil, fmt.Errorf("SECRETS_ENCRYPTION_KEY_FILE: %w", err)
+		}
+	case kmsKey != "":
+		blob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(kmsKey))
+		if err != nil {
+			return nil, errors.New("SECRETS_ENCRYPTION_KMS_KEY is not valid base64")
+		}
+		region := getenv("SECRETS_ENCRYPTION_KMS_REGION")
+		if region == "" {
+			region = getenv("AWS_REGION")
+		}
+		if region == "" {
+			region = s3DefaultRegion
+		}
+		if key, err = kmsDecryptDataKey(ctx, region, getenv("SECRETS_ENCRYPTION_KMS_ENDPOINT"), blob); err != nil {
+			return nil, fmt.Errorf("SECRETS_ENCRYPTION_KMS_KEY: %w", err)
+		}
+		if len(key) != secrets.KeySize {
+			return nil, fmt.Errorf("SECRETS_ENCRYPTION_KMS_KEY: data key is %d bytes, want %d (generate it with --key-spec AES_256)", len(key), secrets.KeySize)
+		}
+	default:
+		if len(old) > 0 {
+			return nil, errors.New("SECRETS_ENCRYPTION_OLD_KEYS requires a current key")
+		}
+		return nil, nil
+	}
+	return secrets.NewCipher(key, old...)
+}
+
+// kmsDecryptDataKey decrypts a data key with the AWS KMS Decrypt API, signed
+// with the credentials of the AWS_* environment variables. endpoint overrides
+// the regional KMS endpoint.
+func kmsDecryptDataKey(ctx context.Context, region, endpoint string, blob []byte) ([]byte, error) {
+	creds := awsEnvCredentials()
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, errors.New("no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	var out struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	in := map[string]string{"CiphertextBlob": base64.StdEncoding.EncodeToString(blob)}
+	if err := awsJSONRequest(ctx, region, endpoint, "kms", "TrentService.Decrypt", in, &out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Plaintext)
+}
+
+// awsJSONRequest calls target of an AWS JSON API, such as KMS or Secrets
+// Manager, signed with the credentials of the AWS_* environment variables.
+// endpoint overrides the regional endpoint of service.
+func awsJSONRequest(ctx context.Context, region, endpoint, service, target string, in, out interface{}) error {
+	creds := awsEnvCredentials()
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return errors.New("no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if endpoint == "" {
+		endpoint = "https://" + service + "." + region + ".amazonaws.com"
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, sha256Hex(body), service, region, time.Now()); err != nil {
+		return err
+	}
+
+	resp, err := httpclient.Default().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned status %d: %s", target, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("parse %s response: %w", target, err)
+	}
+	return nil
+}
+
+// awsEnvCredentials returns the keys of the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func awsEnvCredentials() aws.Credentials {
+	return aws.Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// readSealedFile reads the file of a file store, decrypting its secrets.
+func readSealedFile(path string, c *secrets.Cipher, fields []string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.OpenJSON(data, fields)
+}
+
+// writeSealedFile writes the file of a file store, encrypting its secrets.
+func writeSealedFile(path string, data []byte, perm os.FileMode, c *secrets.Cipher, fields []string) error {
+	sealed, _, err := c.SealJSON(data, fields)
+	if err != nil {
+		return fmt.Errorf("encrypt secrets: %w", err)
+	}
+	return writeFileAtomic(path, sealed, perm)
+}
+
+// sealedFiles are the files of the file stores holding secrets, with the
+// fields encrypted in them.
+var sealedFiles = []struct {
+	name   string
+	fields []string
+}{
+	{"integrations.json", db.IntegrationSecretFields},
+	{"notifiers.json", db.NotifierSecretFields},
+	{"exporters.json", db.ExporterSecretFields},
+	{"retrievers.json", db.RetrieverSecretFields},
+	{"audit_sinks.json", db.AuditSinkSecretFields},
+	{"publish_targets.json", db.PublishTargetSecretFields},
+	{"project-meta.json", db.ProjectMetaSecretFields},
+}
+
+// checkSealedFiles checks that the secrets of the file stores in dir can be
+// decrypted with c. The stores start empty on files they cannot read, and
+// would overwrite them on their next change.
+func checkSealedFiles(dir string, c *secrets.Cipher) error {
+	for _, f := range sealedFiles {
+		if _, err := readSealedFile(filepath.Join(dir, f.name), c, f.fields); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// rotateSealedFile encrypts the secrets of a file store's file that are in
+// plaintext or encrypted with an older key, holding the store's lock.
+func rotateSealedFile(mu sync.Locker, path string, perm os.FileMode, c *secrets.Cipher, fields []string) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	sealed, n, err := c.SealJSON(data, fields)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return n, writeFileAtomic(path, sealed, perm)
+}
+
+// rotateSecrets encrypts with the primary key the stored secrets still in
+// plaintext or encrypted with an older key. It returns how many it encrypted,
+// by table or store.
+func (fm *FlagManager) rotateSecrets(ctx context.Context) (map[string]int, error) {
+	if fm.store != nil {
+		return fm.store.RotateSecrets(ctx)
+	}
+
+	files := []struct {
+		name   string
+		mu     sync.Locker
+		path   string
+		perm   os.FileMode
+		fields []string
+	}{
+		{"integrations", &fm.integrations.mu, fm.integrations.configPath, 0644, db.IntegrationSecretFields},
+		{"notifiers", &fm.notifiers.mu, fm.notifiers.configPath, 0644, db.NotifierSecretFields},
+		{"exporters", &fm.exporters.mu, fm.exporters.configPath, 0644, db.ExporterSecretFields},
+		{"retrievers", &fm.retrievers.mu, fm.retrievers.configPath, 0644, db.RetrieverSecretFields},
+		{"audit_sinks", &fm.auditSinks.mu, fm.auditSinks.filePath, 0600, db.AuditSinkSecretFields},
+		{"publish_targets", &fm.publishTargets.mu, fm.publishTargets.filePath, 0600, db.PublishTargetSecretFields},
+		{"projects", &fm.projectMeta.mu, fm.projectMeta.filePath, 0644, db.ProjectMetaSecretFields},
+	}
+	rotated := make(map[string]int, len(files))
+	for _, f := range files {
+		n, err := rotateSealedFile(f.mu, f.path, f.perm, fm.secrets, f.fields)
+		if err != nil {
+			return nil, fmt.Errorf("rotate secrets of %s: %w", f.name, err)
+		}
+		if n > 0 {
+			rotated[f.name] = n
+		}
+	}
+	return rotated, nil
+}
+
+// SecretsRotationResponse is the result of POST /api/admin/secrets/rotate.
+type SecretsRotationResponse struct {
+	KeyID   string         `json:"keyId"`   // the primary key, which now encrypts every secret
+	Rotated map[string]int `json:"rotated"` // secrets encrypted, by table or store
+	Total   int            `json:"total"`
+}
+
+// rotateSecretsHandler encrypts with the primary key the secrets stored before
+// encryption was enabled, or with a key since replaced. Once it succeeded, the
+// old keys can be removed from SECRETS_ENCRYPTION_OLD_KEYS.
+func (fm *FlagManager) rotateSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	if fm.secrets == nil {
+		writeError(w, http.StatusConflict, "SECRETS_ENCRYPTION_DISABLED", "Secrets encryption is not enabled: set SECRETS_ENCRYPTION_KEY")
+		return
+	}
+
+	rotated, err := fm.rotateSecrets(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to rotate secrets: "+err.Error())
+		return
+	}
+	resp := SecretsRotationResponse{KeyID: fm.secrets.KeyID(), Rotated: rotated}
+	for _, n := range rotated {
+		resp.Total += n
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "secrets.rotate", "secrets", resp.KeyID, "", "", nil, resp)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
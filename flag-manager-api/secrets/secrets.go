@@ -0,0 +1,250 @@
+// Package secrets encrypts the credentials the manager stores (git provider
+// tokens, notifier and exporter keys, retriever passwords) with AES-256-GCM,
+// so that they are not readable from its files, database or backups of them.
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix starts every encrypted value, followed by the ID of the key and the
+// base64 nonce and ciphertext: enc:v1:<key id>:<data>.
+const Prefix = "enc:v1:"
+
+// KeySize is the size of an encryption key, in bytes.
+const KeySize = 32
+
+// ErrNoKey is returned when decrypting without a key.
+var ErrNoKey = errors.New("secret is encrypted but no encryption key is configured")
+
+// Cipher encrypts secrets with its primary key and decrypts them with any of
+// its keys, so that the values encrypted before a key rotation stay readable.
+// A nil *Cipher leaves secrets in plaintext.
+type Cipher struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// KeyID identifies a key in the values it encrypts: the hex of the first 8
+// bytes of its SHA-256.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ParseKey decodes a base64 key of KeySize bytes.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		if key, err = base64.URLEncoding.DecodeString(s); err != nil {
+			return nil, errors.New("key is not valid base64")
+		}
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key is %d bytes, want %d", len(key), KeySize)
+	}
+	return key, nil
+}
+
+// NewCipher returns a cipher encrypting with primary and decrypting with it
+// or any of the old keys.
+func NewCipher(primary []byte, old ...[]byte) (*Cipher, error) {
+	c := &Cipher{primary: KeyID(primary), keys: make(map[string]cipher.AEAD)}
+	for _, key := range append([][]byte{primary}, old...) {
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key is %d bytes, want %d", len(key), KeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys[KeyID(key)] = aead
+	}
+	return c, nil
+}
+
+// KeyID returns the ID of the primary key, or "" for a nil cipher.
+func (c *Cipher) KeyID() string {
+	if c == nil {
+		return ""
+	}
+	return c.primary
+}
+
+// IsEncrypted reports whether value was encrypted by a Cipher.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// keyIDOf returns the ID of the key value was encrypted with.
+func keyIDOf(value string) string {
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	return id
+}
+
+// Encrypt encrypts plaintext with the primary key. Empty values are left
+// empty, and a nil cipher returns plaintext.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if c == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	aead := c.keys[c.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(c.primary))
+	return Prefix + c.primary + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value Encrypt returned. Values without the prefix, stored
+// before encryption was enabled, are returned as they are.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if c == nil {
+		return "", ErrNoKey
+	}
+	id, data, ok := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted secret")
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("secret is encrypted with unknown key %s", id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted secret")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret with key %s: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// SealJSON encrypts with the primary key the string values of the named
+// fields, at any depth of the JSON document data: plaintext values, and values
+// encrypted with an older key. It returns how many it encrypted. Data is
+// returned as is when nothing changed, and otherwise re-encoded, indented if
+// it was. A nil cipher returns data.
+func (c *Cipher) SealJSON(data []byte, fields []string) ([]byte, int, error) {
+	if c == nil {
+		return data, 0, nil
+	}
+	return transformJSON(data, fields, func(value string) (string, bool, error) {
+		if IsEncrypted(value) {
+			if keyIDOf(value) == c.primary {
+				return value, false, nil
+			}
+			plaintext, err := c.Decrypt(value)
+			if err != nil {
+				return "", false, err
+			}
+			value = plaintext
+		}
+		encrypted, err := c.Encrypt(value)
+		return encrypted, err == nil, err
+	})
+}
+
+// OpenJSON decrypts the values SealJSON encrypted in data. Plaintext values
+// are left as they are.
+func (c *Cipher) OpenJSON(data []byte, fields []string) ([]byte, error) {
+	if !bytes.Contains(data, []byte(Prefix)) {
+		return data, nil
+	}
+	out, _, err := transformJSON(data, fields, func(value string) (string, bool, error) {
+		if !IsEncrypted(value) {
+			return value, false, nil
+		}
+		plaintext, err := c.Decrypt(value)
+		return plaintext, err == nil, err
+	})
+	return out, err
+}
+
+// transformJSON replaces the non-empty string values of fields in data with
+// what fn returns for them.
+func transformJSON(data []byte, fields []string, fn func(string) (string, bool, error)) ([]byte, int, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return data, 0, nil
+	}
+	names := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		names[field] = true
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, 0, err
+	}
+	n, err := transformValue(doc, names, fn)
+	if err != nil || n == 0 {
+		return data, n, err
+	}
+
+	var out []byte
+	if bytes.ContainsRune(data, '\n') {
+		out, err = json.MarshalIndent(doc, "", "  ")
+	} else {
+		out, err = json.Marshal(doc)
+	}
+	return out, n, err
+}
+
+func transformValue(v interface{}, names map[string]bool, fn func(string) (string, bool, error)) (int, error) {
+	n := 0
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && names[key] {
+				if s == "" {
+					continue
+				}
+				out, changed, err := fn(s)
+				if err != nil {
+					return n, fmt.Errorf("%s: %w", key, err)
+				}
+				if changed {
+					v[key] = out
+					n++
+				}
+				continue
+			}
+			m, err := transformValue(value, names, fn)
+			n += m
+			if err != nil {
+				return n, err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			m, err := transformValue(item, names, fn)
+			n += m
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
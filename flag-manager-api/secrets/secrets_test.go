@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	c, err := NewCipher(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := c.Encrypt("glpat-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "glpat-secret") {
+		t.Fatalf("Expected an encrypted value, got %q", encrypted)
+	}
+	if !strings.HasPrefix(encrypted, Prefix+c.KeyID()+":") {
+		t.Errorf("Expected the primary key ID in %q", encrypted)
+	}
+	if again, _ := c.Encrypt("glpat-secret"); again == encrypted {
+		t.Error("Expected a fresh nonce for every encryption")
+	}
+	if got, err := c.Decrypt(encrypted); err != nil || got != "glpat-secret" {
+		t.Errorf("Expected glpat-secret, got %q (%v)", got, err)
+	}
+
+	if got, _ := c.Encrypt(""); got != "" {
+		t.Errorf("Expected empty values to stay empty, got %q", got)
+	}
+	if got, err := c.Decrypt("legacy-plaintext"); err != nil || got != "legacy-plaintext" {
+		t.Errorf("Expected plaintext to pass through, got %q (%v)", got, err)
+	}
+
+	tampered := encrypted[:len(encrypted)-2] + "AA"
+	if _, err := c.Decrypt(tampered); err == nil {
+		t.Error("Expected a tampered value to fail")
+	}
+
+	other, _ := NewCipher(newKey(t))
+	if _, err := other.Decrypt(encrypted); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Errorf("Expected an unknown key error, got %v", err)
+	}
+	var none *Cipher
+	if _, err := none.Decrypt(encrypted); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey without a cipher, got %v", err)
+	}
+	if got, _ := none.Encrypt("plain"); got != "plain" {
+		t.Errorf("Expected a nil cipher to leave plaintext, got %q", got)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := ParseKey("c2hvcnQ="); err == nil {
+		t.Error("Expected a short key to be rejected")
+	}
+	if _, err := ParseKey("not base64!"); err == nil {
+		t.Error("Expected invalid base64 to be rejected")
+	}
+	if key, err := ParseKey(" MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE= "); err != nil || len(key) != KeySize {
+		t.Errorf("Expected a %d byte key, got %d (%v)", KeySize, len(key), err)
+	}
+}
+
+func TestSealOpenJSON(t *testing.T) {
+	oldKey, newKeyBytes := newKey(t), newKey(t)
+	old, _ := NewCipher(oldKey)
+	rotated, _ := NewCipher(newKeyBytes, oldKey)
+	fields := []string{"token", "secret"}
+
+	data := []byte(`[{"id":"a","token":"token-1","port":5432,"meta":{"secret":"secret-1","url":"https://x"}},{"id":"b","token":""}]`)
+	sealed, n, err := old.SealJSON(data, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || bytes.Contains(sealed, []byte("token-1")) || bytes.Contains(sealed, []byte("secret-1")) {
+		t.Fatalf("Expected 2 values encrypted, got %d: %s", n, sealed)
+	}
+	if !bytes.Contains(sealed, []byte(`"port":5432`)) || !bytes.Contains(sealed, []byte(`"token":""`)) {
+		t.Errorf("Expected the other values untouched: %s", sealed)
+	}
+	if again, n, _ := old.SealJSON(sealed, fields); n != 0 || !bytes.Equal(again, sealed) {
+		t.Errorf("Expected sealing twice with the same key to change nothing, got %d", n)
+	}
+
+	// Rotation re-encrypts the values of the old key, which stay readable
+	resealed, n, err := rotated.SealJSON(sealed, fields)
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 values re-encrypted, got %d (%v)", n, err)
+	}
+	if bytes.Contains(resealed, []byte(old.KeyID())) {
+		t.Errorf("Expected no value left with the old key: %s", resealed)
+	}
+	for _, doc := range [][]byte{sealed, resealed} {
+		opened, err := rotated.OpenJSON(doc, fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var items []map[string]interface{}
+		json.Unmarshal(opened, &items)
+		if items[0]["token"] != "token-1" || items[0]["meta"].(map[string]interface{})["secret"] != "secret-1" {
+			t.Errorf("Expected the secrets decrypted, got %s", opened)
+		}
+	}
+	if _, err := old.OpenJSON(resealed, fields); err == nil {
+		t.Error("Expected the old key alone to fail on values of the new one")
+	}
+
+	indented := []byte("{\n  \"token\": \"t\"\n}")
+	if out, _, _ := old.SealJSON(indented, fields); !bytes.Contains(out, []byte("\n  \"token\": \"enc:v1:")) {
+		t.Errorf("Expected indented JSON to stay indented, got %s", out)
+	}
+	if out, _ := old.OpenJSON(data, fields); !bytes.Equal(out, data) {
+		t.Error("Expected plaintext JSON to be returned as is")
+	}
+}
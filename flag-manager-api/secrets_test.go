@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+	"flag-manager-api/secrets"
+)
+
+func TestSecretsEncryption(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, secrets.KeySize), bytes.Repeat([]byte{2}, secrets.KeySize)
+	oldCipher, _ := secrets.NewCipher(oldKey)
+	newCipher, _ := secrets.NewCipher(newKey, oldKey)
+
+	fileFM, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for mode, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(mode, func(t *testing.T) {
+			// useCipher restarts the manager with a cipher
+			useCipher := func(c *secrets.Cipher) {
+				fm.secrets = c
+				if fm.store != nil {
+					fm.store.SetCipher(c)
+				} else {
+					fm.integrations = NewIntegrationsStore(tempDir, c)
+				}
+			}
+			// token reads the token of an integration as the manager does
+			token := func(id string) (string, error) {
+				if fm.store == nil {
+					return fm.integrations.GetRaw(id).GitLabToken, nil
+				}
+				dbi, err := fm.store.GetIntegration(context.Background(), id)
+				if err != nil {
+					return "", err
+				}
+				return dbIntegrationToGitIntegration(*dbi).GitLabToken, nil
+			}
+			// readableWith reports whether the token of an integration at rest
+			// can be read with c
+			readableWith := func(id string, c *secrets.Cipher) bool {
+				t.Helper()
+				if fm.store != nil {
+					defer fm.store.SetCipher(fm.secrets)
+					fm.store.SetCipher(c)
+					_, err := token(id)
+					return err == nil
+				}
+				data, err := os.ReadFile(filepath.Join(tempDir, "integrations.json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var integrations []GitIntegration
+				json.Unmarshal(data, &integrations)
+				for _, gi := range integrations {
+					if gi.ID == id {
+						_, err := c.Decrypt(gi.GitLabToken)
+						return err == nil
+					}
+				}
+				t.Fatalf("Integration %s not found", id)
+				return false
+			}
+			create := func(id, secret string) {
+				t.Helper()
+				body, _ := json.Marshal(GitIntegration{ID: id, Name: id, Provider: "gitlab", GitLabURL: "https://gitlab.example.com", GitLabProjectID: "1", GitLabToken: secret})
+				rr := doRequest(t, setupTestRouter(fm), "POST", "/api/integrations", string(body), http.StatusCreated, nil)
+				if strings.Contains(rr.Body.String(), secret) {
+					t.Errorf("Expected the token masked in the response: %s", rr.Body.String())
+				}
+			}
+			rotate := func(status int) SecretsRotationResponse {
+				t.Helper()
+				var resp SecretsRotationResponse
+				doRequest(t, setupTestRouter(fm), "POST", "/api/admin/secrets/rotate", "", status, &resp)
+				return resp
+			}
+
+			useCipher(nil)
+			rotate(http.StatusConflict)
+			legacy, fresh := mode+"-legacy", mode+"-new"
+			create(legacy, "glpat-legacy")
+			if !readableWith(legacy, nil) {
+				t.Fatal("Expected tokens in plaintext without a key")
+			}
+
+			// Secrets written before the key was set are still read, and
+			// encrypted by a rotation
+			useCipher(oldCipher)
+			if got, err := token(legacy); err != nil || got != "glpat-legacy" {
+				t.Errorf("Expected the plaintext token to be read, got %q (%v)", got, err)
+			}
+			resp := rotate(http.StatusOK)
+			if resp.KeyID != oldCipher.KeyID() || resp.Rotated["integrations"] != 1 || resp.Total != 1 {
+				t.Errorf("Expected the plaintext token encrypted, got %+v", resp)
+			}
+			if readableWith(legacy, nil) {
+				t.Error("Expected no plaintext token left after the rotation")
+			}
+
+			// Secrets written once the key is set are encrypted
+			create(fresh, "glpat-new")
+			if readableWith(fresh, nil) || !readableWith(fresh, oldCipher) {
+				t.Error("Expected the new token encrypted with the key")
+			}
+
+			// A new key re-encrypts what the old one did
+			useCipher(newCipher)
+			resp = rotate(http.StatusOK)
+			if resp.KeyID != newCipher.KeyID() || resp.Rotated["integrations"] != 2 || resp.Total != 2 {
+				t.Errorf("Expected both tokens re-encrypted, got %+v", resp)
+			}
+			if resp := rotate(http.StatusOK); resp.Total != 0 {
+				t.Errorf("Expected nothing left to rotate, got %+v", resp)
+			}
+			for id, want := range map[string]string{legacy: "glpat-legacy", fresh: "glpat-new"} {
+				if got, err := token(id); err != nil || got != want {
+					t.Errorf("Expected %s to decrypt to %q, got %q (%v)", id, want, got, err)
+				}
+				if readableWith(id, oldCipher) {
+					t.Errorf("Expected %s no longer readable with the old key", id)
+				}
+			}
+			if fm.store == nil {
+				if err := checkSealedFiles(tempDir, oldCipher); err == nil || !strings.Contains(err.Error(), "unknown key") {
+					t.Errorf("Expected startup to fail with the old key alone, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSecretsCipherConfig(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, secrets.KeySize))
+	old := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, secrets.KeySize))
+	getenv := func(env map[string]string) func(string) string {
+		return func(name string) string { return env[name] }
+	}
+
+	if c, err := newSecretsCipher(context.Background(), getenv(nil)); c != nil || err != nil {
+		t.Errorf("Expected no cipher without a key, got %v (%v)", c, err)
+	}
+	c, err := newSecretsCipher(context.Background(), getenv(map[string]string{"SECRETS_ENCRYPTION_KEY": key, "SECRETS_ENCRYPTION_OLD_KEYS": old}))
+	if err != nil || c == nil {
+		t.Fatalf("Expected a cipher, got %v", err)
+	}
+	oldCipher, _ := secrets.NewCipher(bytes.Repeat([]byte{2}, secrets.KeySize))
+	sealed, _ := oldCipher.Encrypt("token")
+	if got, err := c.Decrypt(sealed); err != nil || got != "token" {
+		t.Errorf("Expected the old key to decrypt, got %q (%v)", got, err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte(key+"\n"), 0600)
+	if c, err := newSecretsCipher(context.Background(), getenv(map[string]string{"SECRETS_ENCRYPTION_KEY_FILE": keyFile})); err != nil || c.KeyID() != secrets.KeyID(bytes.Repeat([]byte{1}, secrets.KeySize)) {
+		t.Errorf("Expected the key of the file, got %v", err)
+	}
+
+	// The data key is decrypted with KMS, with a signed request
+	var target, authorization string
+	kms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target, authorization = r.Header.Get("X-Amz-Target"), r.Header.Get("Authorization")
+		var req struct{ CiphertextBlob string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.CiphertextBlob != base64.StdEncoding.EncodeToString([]byte("wrapped")) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"Plaintext": key})
+	}))
+	defer kms.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	c, err = newSecretsCipher(context.Background(), getenv(map[string]string{
+		"SECRETS_ENCRYPTION_KMS_KEY":      base64.StdEncoding.EncodeToString([]byte("wrapped")),
+		"SECRETS_ENCRYPTION_KMS_REGION":   "eu-west-1",
+		"SECRETS_ENCRYPTION_KMS_ENDPOINT": kms.URL,
+	}))
+	if err != nil || c.KeyID() != secrets.KeyID(bytes.Repeat([]byte{1}, secrets.KeySize)) {
+		t.Fatalf("Expected the data key decrypted by KMS, got %v", err)
+	}
+	if target != "TrentService.Decrypt" || !strings.Contains(authorization, "/eu-west-1/kms/aws4_request") {
+		t.Errorf("Expected a signed KMS Decrypt request, got %q %q", target, authorization)
+	}
+
+	for _, env := range []map[string]string{
+		{"SECRETS_ENCRYPTION_KEY": "c2hvcnQ="},
+		{"SECRETS_ENCRYPTION_KEY": key, "SECRETS_ENCRYPTION_KEY_FILE": keyFile},
+		{"SECRETS_ENCRYPTION_OLD_KEYS": old},
+		{"SECRETS_ENCRYPTION_KEY": key, "SECRETS_ENCRYPTION_OLD_KEYS": "nope"},
+	} {
+		if _, err := newSecretsCipher(context.Background(), getenv(env)); err == nil {
+			t.Errorf("Expected %v to be rejected", env)
+		}
+	}
+}
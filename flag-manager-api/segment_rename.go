@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// SegmentRenameFlag is a flag renaming a segment rewrites, with the changes
+// to its config.
+type SegmentRenameFlag struct {
+	Project string         `json:"project"`
+	FlagKey string         `json:"flagKey"`
+	Changes []ConfigChange `json:"changes"`
+}
+
+// SegmentRenamePreview lists the flags renaming a segment rewrites to
+// reference its new name.
+type SegmentRenamePreview struct {
+	Segment string              `json:"segment"`
+	Name    string              `json:"name"`
+	Flags   []SegmentRenameFlag `json:"flags"`
+	Count   int                 `json:"count"`
+}
+
+// segmentRenamePatch is the targeting patch making flags reference segment to
+// instead of segment from.
+func segmentRenamePatch(from, to string) TargetingPatch {
+	return TargetingPatch{Transforms: []TargetingTransform{{Op: targetingRenameSegment, From: from, To: to}}}
+}
+
+// previewSegmentRename returns the flags of every project, archived and
+// drafts included, that renaming segment from to to rewrites.
+func (fm *FlagManager) previewSegmentRename(ctx context.Context, from, to string) ([]SegmentRenameFlag, error) {
+	projects, err := fm.storage.ListProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(projects)
+
+	patch := segmentRenamePatch(from, to)
+	rewritten := []SegmentRenameFlag{}
+	for _, project := range projects {
+		flags, err := fm.storage.ListFlags(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(flags))
+		for key := range flags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			after, changed := patch.apply(flags[key])
+			if !changed {
+				continue
+			}
+			diff, err := diffConfigs(flags[key], after)
+			if err != nil {
+				return nil, err
+			}
+			rewritten = append(rewritten, SegmentRenameFlag{Project: project, FlagKey: key, Changes: diff})
+		}
+	}
+	return rewritten, nil
+}
+
+// renameSegmentReferences rewrites the flags referencing segment from to
+// reference segment to instead, and returns their keys as "project/flag".
+// The flags of a project are saved at once.
+func (fm *FlagManager) renameSegmentReferences(r *http.Request, from, to string) ([]string, error) {
+	ctx := r.Context()
+	projects, err := fm.storage.ListProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(projects)
+
+	patch := segmentRenamePatch(from, to)
+	actor := GetActor(r)
+	var rewritten []string
+	for _, project := range projects {
+		err := func() error {
+			defer fm.storage.LockProject(project)()
+
+			flags, err := fm.storage.ListFlags(ctx, project)
+			if err != nil {
+				return err
+			}
+			before := make(ProjectFlags)
+			var changed []string
+			for key, config := range flags {
+				if after, ok := patch.apply(config); ok {
+					before[key] = config
+					flags[key] = after
+					changed = append(changed, key)
+				}
+			}
+			if len(changed) == 0 {
+				return nil
+			}
+			sort.Strings(changed)
+			ids, err := fm.storage.SaveFlags(ctx, project, flags, changed)
+			if err != nil {
+				return err
+			}
+
+			for _, key := range changed {
+				fm.audit.Log(ctx, actor, "flag.updated", "flag", ids[key], key, project,
+					map[string]interface{}{"before": before[key], "after": flags[key]},
+					map[string]interface{}{"segmentRenamed": map[string]string{"from": from, "to": to}})
+				fm.notifyProjectWebhook(r, "flag.updated", project, key, "")
+				before, after := before[key], flags[key]
+				fm.syncJiraIssue(r, project, key, &before, &after)
+				rewritten = append(rewritten, project+"/"+key)
+			}
+			return nil
+		}()
+		if err != nil {
+			return rewritten, err
+		}
+	}
+	return rewritten, nil
+}
+
+// segmentRenamePreviewHandler lists the flags that renaming a segment to
+// ?name= rewrites, without changing anything. Renaming a segment that flags
+// reference must be confirmed with ?cascade=true.
+func (fm *FlagManager) segmentRenamePreviewHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	name := r.URL.Query().Get("name")
+
+	if err := ValidateSegmentName(name); err != nil {
+		writeValidationError(w, "INVALID_SEGMENT_NAME", err.Error())
+		return
+	}
+
+	segment, err := fm.storage.GetSegment(r.Context(), id)
+	if err != nil {
+		writeSegmentError(w, err)
+		return
+	}
+	if existing, err := fm.storage.GetSegmentByName(r.Context(), name); err == nil && existing.ID != segment.ID {
+		writeError(w, http.StatusConflict, "SEGMENT_EXISTS", "Segment with this name already exists")
+		return
+	}
+
+	flags := []SegmentRenameFlag{}
+	if name != segment.Name {
+		if flags, err = fm.previewSegmentRename(r.Context(), segment.Name, name); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SegmentRenamePreview{
+		Segment: segment.Name,
+		Name:    name,
+		Flags:   flags,
+		Count:   len(flags),
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestSegmentRename(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+
+	fm := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	fm.audit = NewAuditLogger(store, fm.changes)
+	router := setupTestRouter(fm)
+
+	var seg db.Segment
+	doRequest(t, router, "POST", "/api/segments", `{"name":"beta","rules":["plan eq \"beta\""]}`, http.StatusCreated, &seg)
+	doRequest(t, router, "POST", "/api/segments", `{"name":"beta-users","rules":["plan eq \"pro\""]}`, http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"targeting":[{"query":"segment:beta and country eq \"FR\"","variation":"on"}],"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/banner", `{"variations":{"on":true,"off":false},"targeting":[{"query":"segment:beta-users or note eq \"segment:beta\"","variation":"on"}],"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/mobile/flags/dark-mode", `{"variations":{"on":true,"off":false},"targeting":[{"query":"segment:beta","variation":"on"}],"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+	// The preview lists the flags referencing the segment, not the ones that
+	// only mention its name
+	var preview SegmentRenamePreview
+	doRequest(t, router, "GET", "/api/segments/"+seg.ID+"/rename-preview?name=early-access", "", http.StatusOK, &preview)
+	if preview.Count != 2 || preview.Flags[0].Project != "mobile" || preview.Flags[1].FlagKey != "checkout" {
+		t.Fatalf("Expected mobile/dark-mode and web/checkout to be rewritten, got %+v", preview)
+	}
+	if c := preview.Flags[1].Changes; len(c) != 1 || c[0].After != `segment:early-access and country eq "FR"` {
+		t.Errorf("Expected the checkout query to be rewritten, got %+v", c)
+	}
+	doRequest(t, router, "GET", "/api/segments/"+seg.ID+"/rename-preview?name=beta-users", "", http.StatusConflict, nil)
+	doRequest(t, router, "GET", "/api/segments/"+seg.ID+"/rename-preview?name=Not%20Valid", "", http.StatusBadRequest, nil)
+	doRequest(t, router, "GET", "/api/segments/missing/rename-preview?name=early-access", "", http.StatusNotFound, nil)
+
+	// Renaming a segment in use must be confirmed
+	doRequest(t, router, "PUT", "/api/segments/"+seg.ID, `{"name":"early-access","rules":["plan eq \"beta\""]}`, http.StatusConflict, nil)
+	doRequest(t, router, "PUT", "/api/segments/"+seg.ID+"?cascade=true", `{"name":"beta-users","rules":["plan eq \"beta\""]}`, http.StatusConflict, nil)
+	doRequest(t, router, "PUT", "/api/segments/"+seg.ID+"?cascade=true", `{"name":"early-access","rules":["plan eq \"beta\""]}`, http.StatusOK, &seg)
+	if seg.Name != "early-access" {
+		t.Fatalf("Expected the segment to be renamed, got %+v", seg)
+	}
+
+	web, err := fm.storage.ListFlags(context.Background(), "web")
+	if err != nil {
+		t.Fatalf("Failed to list flags: %v", err)
+	}
+	if q := web["checkout"].Targeting[0].Query; q != `segment:early-access and country eq "FR"` {
+		t.Errorf("Expected the checkout query to reference the renamed segment, got %q", q)
+	}
+	if q := web["banner"].Targeting[0].Query; q != `segment:beta-users or note eq "segment:beta"` {
+		t.Errorf("Expected the banner query to be left alone, got %q", q)
+	}
+	mobile, _ := fm.storage.ListFlags(context.Background(), "mobile")
+	if q := mobile["dark-mode"].Targeting[0].Query; q != "segment:early-access" {
+		t.Errorf("Expected the dark-mode query to reference the renamed segment, got %q", q)
+	}
+
+	events, err := store.ListAuditEvents(context.Background(), db.AuditFilterParams{PaginationParams: db.DefaultPagination(), Action: "segment.updated"})
+	if err != nil || events.Total != 1 {
+		t.Fatalf("Expected a segment update audit event, got %v, %v", events, err)
+	}
+	var meta map[string]interface{}
+	json.Unmarshal(events.Data[0].Metadata, &meta)
+	if meta["renamedFrom"] != "beta" || !reflect.DeepEqual(meta["rewrittenFlags"], []interface{}{"mobile/dark-mode", "web/checkout"}) {
+		t.Errorf("Unexpected segment update audit metadata: %v", events.Data[0].Metadata)
+	}
+
+	// Segment references combine with other conditions once expanded
+	query, ok := fm.expandSegmentQuery(context.Background(), `segment:early-access and country eq "FR"`)
+	if !ok || query != `(plan eq "beta") and country eq "FR"` {
+		t.Errorf("Expected the segment rules to be expanded in place, got %q", query)
+	}
+	names, err := querySegments(`segment:early-access or (segment:beta-users and note eq "segment:other")`)
+	if err != nil || !reflect.DeepEqual(names, []string{"early-access", "beta-users"}) {
+		t.Errorf("Expected the referenced segments to be found, got %v, %v", names, err)
+	}
+
+	// Renaming a segment nothing references needs no confirmation
+	doRequest(t, router, "PUT", "/api/segments/"+seg.ID, `{"name":"beta","rules":["plan eq \"beta\""]}`, http.StatusConflict, nil)
+	doRequest(t, router, "POST", "/api/segments", `{"name":"unused","rules":["plan eq \"free\""]}`, http.StatusCreated, &seg)
+	doRequest(t, router, "PUT", "/api/segments/"+seg.ID, `{"name":"still-unused","rules":["plan eq \"free\""]}`, http.StatusOK, nil)
+}
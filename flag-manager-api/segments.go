@@ -3,7 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"flag-manager-api/db"
@@ -12,15 +18,10 @@ import (
 )
 
 func (fm *FlagManager) listSegmentsHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for segments", http.StatusBadRequest)
-		return
-	}
-
 	params := parsePaginationParams(r)
-	result, err := fm.store.ListSegments(r.Context(), params)
+	result, err := fm.storage.ListSegments(r.Context(), params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
@@ -29,17 +30,12 @@ func (fm *FlagManager) listSegmentsHandler(w http.ResponseWriter, r *http.Reques
 }
 
 func (fm *FlagManager) getSegmentHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for segments", http.StatusBadRequest)
-		return
-	}
-
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	segment, err := fm.store.GetSegment(r.Context(), id)
+	segment, err := fm.storage.GetSegment(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Segment not found", http.StatusNotFound)
+		writeSegmentError(w, err)
 		return
 	}
 
@@ -48,19 +44,14 @@ func (fm *FlagManager) getSegmentHandler(w http.ResponseWriter, r *http.Request)
 }
 
 func (fm *FlagManager) createSegmentHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for segments", http.StatusBadRequest)
-		return
-	}
-
 	var seg db.Segment
 	if err := json.NewDecoder(r.Body).Decode(&seg); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
 	if seg.Name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "Name is required")
 		return
 	}
 
@@ -70,21 +61,18 @@ func (fm *FlagManager) createSegmentHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	if len(seg.Rules) == 0 {
-		http.Error(w, "At least one rule is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "At least one rule is required")
 		return
 	}
 
-	created, err := fm.store.CreateSegment(r.Context(), seg)
+	created, err := fm.storage.CreateSegment(r.Context(), seg, actorLabel(GetActor(r)))
 	if err != nil {
-		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
-			http.Error(w, "Segment with this name already exists", http.StatusConflict)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeSegmentError(w, err)
 		return
 	}
 
-	fm.audit.Log(r.Context(), GetActor(r), "segment.created", "segment", created.ID, created.Name, "", nil, nil)
+	fm.audit.Log(r.Context(), GetActor(r), "segment.created", "segment", created.ID, created.Name, "", nil,
+		map[string]interface{}{"version": created.Version})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -92,17 +80,12 @@ func (fm *FlagManager) createSegmentHandler(w http.ResponseWriter, r *http.Reque
 }
 
 func (fm *FlagManager) updateSegmentHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for segments", http.StatusBadRequest)
-		return
-	}
-
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	var seg db.Segment
 	if err := json.NewDecoder(r.Body).Decode(&seg); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
 		return
 	}
 
@@ -113,37 +96,68 @@ func (fm *FlagManager) updateSegmentHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	updated, err := fm.store.UpdateSegment(r.Context(), id, seg)
+	existing, err := fm.storage.GetSegment(r.Context(), id)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, "Segment not found", http.StatusNotFound)
+		writeSegmentError(w, err)
+		return
+	}
+
+	// Renaming a segment rewrites the flags referencing it, which must be
+	// confirmed with ?cascade=true once the rename preview has been reviewed.
+	renamed := seg.Name != "" && seg.Name != existing.Name
+	if renamed {
+		if _, err := fm.storage.GetSegmentByName(r.Context(), seg.Name); !errors.Is(err, errSegmentNotFound) {
+			if err == nil {
+				err = errSegmentExists
+			}
+			writeSegmentError(w, err)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	if renamed && r.URL.Query().Get("cascade") != "true" {
+		dependents, err := fm.previewSegmentRename(r.Context(), existing.Name, seg.Name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if len(dependents) > 0 {
+			writeError(w, http.StatusConflict, "SEGMENT_IN_USE",
+				fmt.Sprintf("Segment is referenced by %d flag(s); review them with the rename preview and rename with ?cascade=true", len(dependents)))
+			return
+		}
+	}
+
+	updated, err := fm.storage.UpdateSegment(r.Context(), id, seg, actorLabel(GetActor(r)))
+	if err != nil {
+		writeSegmentError(w, err)
 		return
 	}
 
-	fm.audit.Log(r.Context(), GetActor(r), "segment.updated", "segment", updated.ID, updated.Name, "", nil, nil)
+	metadata := map[string]interface{}{"version": updated.Version}
+	if renamed {
+		rewritten, err := fm.renameSegmentReferences(r, existing.Name, updated.Name)
+		metadata["renamedFrom"] = existing.Name
+		metadata["rewrittenFlags"] = rewritten
+		if err != nil {
+			fm.audit.Log(r.Context(), GetActor(r), "segment.updated", "segment", updated.ID, updated.Name, "", nil, metadata)
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Segment renamed, but its flags could not all be updated: "+err.Error())
+			return
+		}
+	}
+
+	fm.audit.Log(r.Context(), GetActor(r), "segment.updated", "segment", updated.ID, updated.Name, "", nil, metadata)
+	fm.refreshSegmentDependents(r.Context(), updated.Name)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(updated)
 }
 
 func (fm *FlagManager) deleteSegmentHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for segments", http.StatusBadRequest)
-		return
-	}
-
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	if err := fm.store.DeleteSegment(r.Context(), id); err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, "Segment not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := fm.storage.DeleteSegment(r.Context(), id); err != nil {
+		writeSegmentError(w, err)
 		return
 	}
 
@@ -152,57 +166,323 @@ func (fm *FlagManager) deleteSegmentHandler(w http.ResponseWriter, r *http.Reque
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// writeSegmentError writes the response for an error from the segment
+// methods of Storage.
+func writeSegmentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errDatabaseRequired):
+		writeError(w, http.StatusBadRequest, "DATABASE_REQUIRED", "Database required for segments")
+	case errors.Is(err, errSegmentNotFound):
+		writeError(w, http.StatusNotFound, "SEGMENT_NOT_FOUND", "Segment not found")
+	case errors.Is(err, errSegmentVersionNotFound):
+		writeError(w, http.StatusNotFound, "SEGMENT_VERSION_NOT_FOUND", "Segment version not found")
+	case errors.Is(err, errSegmentExists):
+		writeError(w, http.StatusConflict, "SEGMENT_EXISTS", "Segment with this name already exists")
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+}
+
+// SegmentUsage is a flag referencing a segment.
+type SegmentUsage struct {
+	FlagKey string `json:"flagKey"`
+}
+
+// SegmentUsageResponse lists the flags referencing a segment.
+type SegmentUsageResponse struct {
+	Segment string         `json:"segment"`
+	Usage   []SegmentUsage `json:"usage"`
+	Count   int            `json:"count"`
+}
+
 func (fm *FlagManager) getSegmentUsageHandler(w http.ResponseWriter, r *http.Request) {
-	if fm.store == nil {
-		http.Error(w, "Database required for segments", http.StatusBadRequest)
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	segment, err := fm.storage.GetSegment(r.Context(), id)
+	if err != nil {
+		writeSegmentError(w, err)
+		return
+	}
+
+	dependents, err := fm.segmentDependents(r.Context(), segment.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	usage := []SegmentUsage{}
+	for _, key := range dependents {
+		usage = append(usage, SegmentUsage{FlagKey: key})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SegmentUsageResponse{
+		Segment: segment.Name,
+		Usage:   usage,
+		Count:   len(usage),
+	})
+}
+
+// segmentDependents returns the keys of the flags referencing a segment.
+func (fm *FlagManager) segmentDependents(ctx context.Context, name string) ([]string, error) {
+	allFlags, err := fm.storage.AllFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key, config := range allFlags {
+		if flagReferencesSegment(config, name) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// refreshSegmentDependents refreshes the relay proxy after a segment change
+// when flags reference the segment, so that they are served with its rules
+// expanded again.
+func (fm *FlagManager) refreshSegmentDependents(ctx context.Context, name string) []string {
+	dependents, err := fm.segmentDependents(ctx, name)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to find flags using segment", "segment", name, "error", err)
+		return nil
+	}
+	if len(dependents) > 0 {
+		fm.scheduleRelayRefresh(ctx)
+	}
+	return dependents
+}
+
+// SegmentVersionsResponse lists the versions of a segment, newest first.
+type SegmentVersionsResponse struct {
+	SegmentID string              `json:"segmentId"`
+	Versions  []db.SegmentVersion `json:"versions"`
+}
+
+func (fm *FlagManager) listSegmentVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, err := fm.storage.GetSegment(r.Context(), id); err != nil {
+		writeSegmentError(w, err)
+		return
+	}
+
+	versions, err := fm.storage.ListSegmentVersions(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SegmentVersionsResponse{SegmentID: id, Versions: versions})
+}
+
+// SegmentRollbackResponse is the segment after a rollback, with the flags
+// whose targeting was re-expanded with its restored rules.
+type SegmentRollbackResponse struct {
+	Segment         *db.Segment `json:"segment"`
+	RestoredVersion int         `json:"restoredVersion"`
+	DependentFlags  []string    `json:"dependentFlags"`
+}
+
+// rollbackSegmentHandler restores the description and rules of a segment
+// version as a new version. The current name is kept so that flags keep
+// referencing the segment.
+func (fm *FlagManager) rollbackSegmentHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		writeValidationError(w, "INVALID_VERSION", "version must be a positive integer")
+		return
+	}
 
-	segment, err := fm.store.GetSegment(r.Context(), id)
+	current, err := fm.storage.GetSegment(r.Context(), id)
+	if err != nil {
+		writeSegmentError(w, err)
+		return
+	}
+	snapshot, err := fm.storage.GetSegmentVersion(r.Context(), id, version)
 	if err != nil {
-		http.Error(w, "Segment not found", http.StatusNotFound)
+		writeSegmentError(w, err)
 		return
 	}
 
-	searchPattern := "segment:" + segment.Name
-	allFlags, err := fm.store.GetAllFlags(r.Context())
+	actor := GetActor(r)
+	updated, err := fm.storage.UpdateSegment(r.Context(), id, db.Segment{
+		Name:        current.Name,
+		Description: snapshot.Description,
+		Rules:       snapshot.Rules,
+	}, actorLabel(actor))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	dependents := fm.refreshSegmentDependents(r.Context(), updated.Name)
+	if dependents == nil {
+		dependents = []string{}
+	}
+
+	fm.audit.Log(r.Context(), actor, "segment.rolled_back", "segment", updated.ID, updated.Name, "",
+		map[string]interface{}{"before": current.Rules, "after": updated.Rules},
+		map[string]interface{}{"fromVersion": current.Version, "toVersion": version, "version": updated.Version, "dependentFlags": dependents})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SegmentRollbackResponse{
+		Segment:         updated,
+		RestoredVersion: version,
+		DependentFlags:  dependents,
+	})
+}
+
+// SegmentRuleValidation is the validation result for one segment rule
+type SegmentRuleValidation struct {
+	Query      string   `json:"query"`
+	Valid      bool     `json:"valid"`
+	Error      string   `json:"error,omitempty"`
+	Attributes []string `json:"attributes"`
+}
+
+// SegmentValidation is the validation result for a segment.
+type SegmentValidation struct {
+	Valid      bool                    `json:"valid"`
+	Rules      []SegmentRuleValidation `json:"rules"`
+	Attributes []string                `json:"attributes"`
+}
+
+// validateSegmentHandler checks a segment's rules with the targeting query
+// parser without saving anything, so syntax errors surface while authoring
+// rather than when a referencing flag is evaluated.
+func (fm *FlagManager) validateSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	var seg db.Segment
+	if err := json.NewDecoder(r.Body).Decode(&seg); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+
+	if len(seg.Rules) == 0 {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "At least one rule is required")
 		return
 	}
 
-	var usage []map[string]string
-	for key, configJSON := range allFlags {
-		configStr := string(configJSON)
-		if strings.Contains(configStr, searchPattern) {
-			usage = append(usage, map[string]string{"flagKey": key})
+	valid := true
+	seen := make(map[string]bool)
+	rules := make([]SegmentRuleValidation, 0, len(seg.Rules))
+	for _, rule := range seg.Rules {
+		result := SegmentRuleValidation{Query: rule, Valid: true, Attributes: extractQueryAttributes(rule)}
+		// Segment references are expanded once, so segments cannot nest
+		if names, err := querySegments(rule); err != nil {
+			result.Valid = false
+			result.Error = err.Error()
+			valid = false
+		} else if len(names) > 0 {
+			result.Valid = false
+			result.Error = "segment rules cannot reference segments"
+			valid = false
 		}
+		for _, attr := range result.Attributes {
+			seen[attr] = true
+		}
+		rules = append(rules, result)
 	}
-	if usage == nil {
-		usage = []map[string]string{}
+
+	attributes := make([]string, 0, len(seen))
+	for attr := range seen {
+		attributes = append(attributes, attr)
 	}
+	sort.Strings(attributes)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"segment": segment.Name,
-		"usage":   usage,
-		"count":   len(usage),
+	json.NewEncoder(w).Encode(SegmentValidation{
+		Valid:      valid,
+		Rules:      rules,
+		Attributes: attributes,
 	})
 }
 
-// expandSegmentRules expands segment:<name> references in targeting rules.
-func (fm *FlagManager) expandSegmentRules(ctx context.Context, flags map[string]json.RawMessage) map[string]json.RawMessage {
-	if fm.store == nil {
-		return flags
+// renameSegmentReference returns a targeting rule query referencing segment to
+// instead of segment from, and whether it referenced from.
+func renameSegmentReference(query, from, to string) (string, bool) {
+	return rewriteSegmentReferences(query, func(name string) (string, bool) {
+		return querySegmentPrefix + to, name == from
+	})
+}
+
+// flagReferencesSegment reports whether the targeting of a flag, including
+// its scheduled steps, references a segment.
+func flagReferencesSegment(config FlagConfig, name string) bool {
+	rules := slices.Clone(config.Targeting)
+	for _, step := range config.ScheduledRollout {
+		rules = append(rules, step.Targeting...)
+	}
+	for _, rule := range rules {
+		if names, err := querySegments(rule.Query); err == nil && slices.Contains(names, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandSegmentQuery replaces the segment references of a targeting query
+// with the rules of their segment joined by or, in parentheses unless the
+// reference is the whole query. References to missing or empty segments are
+// left as they are.
+func (fm *FlagManager) expandSegmentQuery(ctx context.Context, query string) (string, bool) {
+	return rewriteSegmentReferences(query, func(name string) (string, bool) {
+		seg, err := fm.storage.GetSegmentByName(ctx, name)
+		if err != nil || len(seg.Rules) == 0 {
+			return "", false
+		}
+		rules := strings.Join(seg.Rules, " or ")
+		if strings.TrimSpace(query) == querySegmentPrefix+name {
+			return rules, true
+		}
+		return "(" + rules + ")", true
+	})
+}
+
+// expandProjectSegments expands segment references in a set of flag configs.
+func (fm *FlagManager) expandProjectSegments(ctx context.Context, flags ProjectFlags) (ProjectFlags, error) {
+	rawFlags := make(map[string]json.RawMessage, len(flags))
+	for k, v := range flags {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		rawFlags[k] = data
 	}
+	return decodeFlagConfigs(fm.expandSegmentRules(ctx, rawFlags))
+}
 
+// expandFlagSegments expands segment references in a single flag config.
+func (fm *FlagManager) expandFlagSegments(ctx context.Context, config FlagConfig) FlagConfig {
+	var targeting []TargetingRule
+	for i, rule := range config.Targeting {
+		if !strings.Contains(rule.Query, querySegmentPrefix) {
+			continue
+		}
+		if expanded, ok := fm.expandSegmentQuery(ctx, rule.Query); ok {
+			if targeting == nil {
+				targeting = slices.Clone(config.Targeting)
+			}
+			targeting[i].Query = expanded
+		}
+	}
+	if targeting != nil {
+		config.Targeting = targeting
+	}
+	return config
+}
+
+// expandSegmentRules expands segment:<name> references in targeting rules.
+func (fm *FlagManager) expandSegmentRules(ctx context.Context, flags map[string]json.RawMessage) map[string]json.RawMessage {
 	expanded := make(map[string]json.RawMessage, len(flags))
 	for key, raw := range flags {
 		configStr := string(raw)
-		if !strings.Contains(configStr, "segment:") {
+		if !strings.Contains(configStr, querySegmentPrefix) {
 			expanded[key] = raw
 			continue
 		}
@@ -217,11 +497,9 @@ func (fm *FlagManager) expandSegmentRules(ctx context.Context, flags map[string]
 		if targeting, ok := config["targeting"].([]interface{}); ok {
 			for i, rule := range targeting {
 				if ruleMap, ok := rule.(map[string]interface{}); ok {
-					if query, ok := ruleMap["query"].(string); ok && strings.HasPrefix(query, "segment:") {
-						segmentName := strings.TrimPrefix(query, "segment:")
-						seg, err := fm.store.GetSegmentByName(ctx, segmentName)
-						if err == nil && len(seg.Rules) > 0 {
-							ruleMap["query"] = strings.Join(seg.Rules, " or ")
+					if query, ok := ruleMap["query"].(string); ok {
+						if expanded, ok := fm.expandSegmentQuery(ctx, query); ok {
+							ruleMap["query"] = expanded
 							targeting[i] = ruleMap
 							modified = true
 						}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestValidateSegment(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	validate := func(rules ...string) (int, map[string]interface{}) {
+		body, _ := json.Marshal(map[string]interface{}{"name": "beta", "rules": rules})
+		req := httptest.NewRequest("POST", "/api/segments/validate", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr.Code, resp
+	}
+
+	if code, _ := validate(); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without rules, got %d", code)
+	}
+
+	code, resp := validate(`country eq "FR" and (plan in ["pro", "team"] or beta pr)`, `not user.age ge 18`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if resp["valid"] != true {
+		t.Errorf("Expected rules to be valid, got %v", resp)
+	}
+	attrs, _ := json.Marshal(resp["attributes"])
+	if string(attrs) != `["beta","country","plan","user.age"]` {
+		t.Errorf("Unexpected attributes: %s", attrs)
+	}
+
+	for _, query := range []string{
+		`country eq`,
+		`country "FR"`,
+		`country eq "FR`,
+		`(country eq "FR"`,
+		`country eq "FR" and`,
+		`plan in ["pro" "team"]`,
+		`country eq "FR" plan eq "pro"`,
+	} {
+		_, resp := validate(`beta eq true`, query)
+		rules, _ := resp["rules"].([]interface{})
+		if resp["valid"] != false || len(rules) != 2 {
+			t.Errorf("Expected %q to be invalid, got %v", query, resp)
+			continue
+		}
+		second, _ := rules[1].(map[string]interface{})
+		if second["valid"] != false || second["error"] == "" {
+			t.Errorf("Expected an error for %q, got %v", query, second)
+		}
+		if first, _ := rules[0].(map[string]interface{}); first["valid"] != true {
+			t.Errorf("Expected the first rule to stay valid, got %v", first)
+		}
+	}
+}
+
+func TestSegmentVersions(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+
+	fm := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	fm.audit = NewAuditLogger(store, fm.changes)
+	router := setupTestRouter(fm)
+
+	var seg db.Segment
+	doRequest(t, router, "POST", "/api/segments", `{"name":"beta","rules":["plan eq \"beta\""]}`, http.StatusCreated, &seg)
+	if seg.Version != 1 {
+		t.Errorf("Expected a new segment to be version 1, got %d", seg.Version)
+	}
+	doRequest(t, router, "PUT", "/api/segments/"+seg.ID, `{"name":"beta","rules":["plan eq \"pro\""]}`, http.StatusOK, &seg)
+	doRequest(t, router, "PUT", "/api/segments/"+seg.ID, `{"name":"beta","description":"Paying users","rules":["plan in [\"pro\", \"team\"]"]}`, http.StatusOK, &seg)
+	if seg.Version != 3 {
+		t.Errorf("Expected version 3 after two updates, got %d", seg.Version)
+	}
+
+	var versions SegmentVersionsResponse
+	doRequest(t, router, "GET", "/api/segments/"+seg.ID+"/versions", "", http.StatusOK, &versions)
+	if len(versions.Versions) != 3 || versions.Versions[0].Version != 3 || versions.Versions[2].Rules[0] != `plan eq "beta"` {
+		t.Fatalf("Expected 3 versions, newest first, got %+v", versions.Versions)
+	}
+
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"targeting":[{"query":"segment:beta","variation":"on"}],"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+	var rollback SegmentRollbackResponse
+	doRequest(t, router, "POST", "/api/segments/"+seg.ID+"/rollback/1", "", http.StatusOK, &rollback)
+	if rollback.Segment.Version != 4 || rollback.RestoredVersion != 1 || rollback.Segment.Rules[0] != `plan eq "beta"` || rollback.Segment.Description != "" {
+		t.Errorf("Expected version 1 to be restored as version 4, got %+v", rollback)
+	}
+	if !reflect.DeepEqual(rollback.DependentFlags, []string{"web/checkout"}) {
+		t.Errorf("Expected web/checkout to depend on the segment, got %v", rollback.DependentFlags)
+	}
+
+	// Dependent flags are served with the restored rules
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/flags/raw/web?format=json", nil))
+	if !strings.Contains(rr.Body.String(), `plan eq \"beta\"`) {
+		t.Errorf("Expected the restored segment rules in the raw flags, got %s", rr.Body.String())
+	}
+
+	events, err := store.ListAuditEvents(context.Background(), db.AuditFilterParams{PaginationParams: db.DefaultPagination(), Action: "segment.rolled_back"})
+	if err != nil || events.Total != 1 {
+		t.Fatalf("Expected a rollback audit event, got %v, %v", events, err)
+	}
+	var meta map[string]interface{}
+	json.Unmarshal(events.Data[0].Metadata, &meta)
+	if meta["fromVersion"] != float64(3) || meta["toVersion"] != float64(1) {
+		t.Errorf("Unexpected rollback audit metadata: %v", events.Data[0].Metadata)
+	}
+
+	doRequest(t, router, "POST", "/api/segments/"+seg.ID+"/rollback/9", "", http.StatusNotFound, nil)
+	doRequest(t, router, "POST", "/api/segments/"+seg.ID+"/rollback/latest", "", http.StatusBadRequest, nil)
+	doRequest(t, router, "GET", "/api/segments/missing/versions", "", http.StatusNotFound, nil)
+}
+
+func TestSegmentsWithoutDatabase(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+
+	var apiErr APIError
+	doRequest(t, router, "POST", "/api/segments", `{"name":"beta","rules":["plan eq \"beta\""]}`, http.StatusBadRequest, &apiErr)
+	if apiErr.Code != "DATABASE_REQUIRED" {
+		t.Errorf("Expected DATABASE_REQUIRED, got %+v", apiErr)
+	}
+	doRequest(t, router, "GET", "/api/segments/beta/versions", "", http.StatusBadRequest, nil)
+}
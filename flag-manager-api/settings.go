@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// serverSettingsKey is the settings table key holding ServerSettings.
+const serverSettingsKey = "server"
+
+// ServerSettings holds server-wide defaults managed through the settings endpoint
+type ServerSettings struct {
+	// Applied to new flag sets created without their own exporter/notifier
+	DefaultFlagSetExporter *FlagSetExporter `json:"defaultFlagSetExporter,omitempty"`
+	DefaultFlagSetNotifier *FlagSetNotifier `json:"defaultFlagSetNotifier,omitempty"`
+}
+
+// SettingsStore manages server settings persistence
+type SettingsStore struct {
+	mu       sync.RWMutex
+	settings ServerSettings
+	filePath string
+}
+
+// NewSettingsStore creates a new settings store
+func NewSettingsStore(configDir string) *SettingsStore {
+	store := &SettingsStore{
+		filePath: filepath.Join(configDir, "settings.json"),
+	}
+	store.load()
+	return store
+}
+
+func (s *SettingsStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.settings)
+}
+
+// Get returns the current settings
+func (s *SettingsStore) Get() ServerSettings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings
+}
+
+// Set replaces the current settings
+func (s *SettingsStore) Set(settings ServerSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.filePath, data, 0644); err != nil {
+		return err
+	}
+	s.settings = settings
+	return nil
+}
+
+// getSettings returns the server settings from whichever backend is active.
+func (fm *FlagManager) getSettings(ctx context.Context) (ServerSettings, error) {
+	var settings ServerSettings
+	if fm.store != nil {
+		raw, err := fm.store.GetSetting(ctx, serverSettingsKey)
+		if err != nil || raw == nil {
+			return settings, err
+		}
+		err = json.Unmarshal(raw, &settings)
+		return settings, err
+	}
+	if fm.settings == nil {
+		return settings, nil
+	}
+	return fm.settings.Get(), nil
+}
+
+// applyFlagSetDefaults fills in the configured default exporter and notifier
+// on a new flag set. Explicit configs on the flag set take precedence.
+func (fm *FlagManager) applyFlagSetDefaults(ctx context.Context, flagSet *FlagSet) error {
+	settings, err := fm.getSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if flagSet.Exporter == nil && settings.DefaultFlagSetExporter != nil {
+		exporter := *settings.DefaultFlagSetExporter
+		flagSet.Exporter = &exporter
+	}
+	if flagSet.Notifier == nil && settings.DefaultFlagSetNotifier != nil {
+		notifier := *settings.DefaultFlagSetNotifier
+		flagSet.Notifier = &notifier
+	}
+	return nil
+}
+
+func (fm *FlagManager) getSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	settings, err := fm.getSettings(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func (fm *FlagManager) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var settings ServerSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+
+	if settings.DefaultFlagSetExporter != nil && settings.DefaultFlagSetExporter.Kind == "" {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "defaultFlagSetExporter.kind is required")
+		return
+	}
+	if settings.DefaultFlagSetNotifier != nil && settings.DefaultFlagSetNotifier.Kind == "" {
+		writeError(w, http.StatusBadRequest, "FIELD_REQUIRED", "defaultFlagSetNotifier.kind is required")
+		return
+	}
+
+	if fm.store != nil {
+		raw, err := json.Marshal(settings)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if err := fm.store.SetSetting(r.Context(), serverSettingsKey, raw); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	} else if err := fm.settings.Set(settings); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+const (
+	signatureHMACSHA256 = "hmac-sha256"
+	signatureECDSAP256  = "ecdsa-p256-sha256"
+
+	// signatureSidecarSuffix names the signature uploaded next to a file.
+	signatureSidecarSuffix = ".sig.json"
+)
+
+// FlagsSignature is the signature of a flags file: sent in X-Flags-* headers
+// by /api/flags/raw and uploaded next to the file by publish targets.
+type FlagsSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId,omitempty"`
+	SHA256    string `json:"sha256"`    // hex digest of the file
+	Signature string `json:"signature"` // base64, of the file
+}
+
+// setHeaders adds the signature to a response.
+func (s FlagsSignature) setHeaders(h http.Header) {
+	h.Set("X-Flags-SHA256", s.SHA256)
+	h.Set("X-Flags-Signature", s.Signature)
+	h.Set("X-Flags-Signature-Algorithm", s.Algorithm)
+	if s.KeyID != "" {
+		h.Set("X-Flags-Signature-Key-Id", s.KeyID)
+	}
+}
+
+// flagsSigner signs the flags files the manager serves and publishes, with a
+// shared HMAC key or an ECDSA P-256 key. ECDSA signatures are ASN.1 over the
+// SHA-256 of the file, as made by cosign sign-blob and checked by
+// cosign verify-blob or openssl dgst -verify.
+type flagsSigner struct {
+	algorithm string
+	keyID     string
+	hmacKey   []byte
+	ecdsaKey  *ecdsa.PrivateKey
+}
+
+// parseFlagsSigner reads FLAGS_SIGNING_KEY, a shared HMAC key, or
+// FLAGS_SIGNING_KEY_FILE, a PEM ECDSA P-256 private key, and
+// FLAGS_SIGNING_KEY_ID. Without a key flags files are not signed.
+func parseFlagsSigner(getenv func(string) string) (*flagsSigner, error) {
+	secret, keyFile := getenv("FLAGS_SIGNING_KEY"), getenv("FLAGS_SIGNING_KEY_FILE")
+	switch {
+	case secret != "" && keyFile != "":
+		return nil, errors.New("set FLAGS_SIGNING_KEY or FLAGS_SIGNING_KEY_FILE, not both")
+	case secret != "":
+		return &flagsSigner{algorithm: signatureHMACSHA256, keyID: getenv("FLAGS_SIGNING_KEY_ID"), hmacKey: []byte(secret)}, nil
+	case keyFile != "":
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseECDSAPrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyFile, err)
+		}
+		return &flagsSigner{algorithm: signatureECDSAP256, keyID: getenv("FLAGS_SIGNING_KEY_ID"), ecdsaKey: key}, nil
+	}
+	return nil, nil
+}
+
+// parseECDSAPrivateKey reads a P-256 key in a SEC 1 ("EC PRIVATE KEY") or
+// PKCS #8 ("PRIVATE KEY") PEM block.
+func parseECDSAPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key")
+	}
+	var key *ecdsa.PrivateKey
+	if parsed, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		key = parsed
+	} else if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		key, _ = parsed.(*ecdsa.PrivateKey)
+	}
+	if key == nil || key.Curve != elliptic.P256() {
+		return nil, errors.New("not an ECDSA P-256 private key")
+	}
+	return key, nil
+}
+
+// sign returns the signature of a flags file. A nil signer signs nothing.
+func (s *flagsSigner) sign(data []byte) (*FlagsSignature, error) {
+	if s == nil {
+		return nil, nil
+	}
+	digest := sha256.Sum256(data)
+	sig := &FlagsSignature{Algorithm: s.algorithm, KeyID: s.keyID, SHA256: hex.EncodeToString(digest[:])}
+	switch s.algorithm {
+	case signatureHMACSHA256:
+		mac := hmac.New(sha256.New, s.hmacKey)
+		mac.Write(data)
+		sig.Signature = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	case signatureECDSAP256:
+		signature, err := ecdsa.SignASN1(rand.Reader, s.ecdsaKey, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig.Signature = base64.StdEncoding.EncodeToString(signature)
+	}
+	return sig, nil
+}
+
+// SigningKeyResponse describes how flags files are signed, with the public
+// key verifying ECDSA signatures.
+type SigningKeyResponse struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"` // PEM
+}
+
+// signingKeyHandler returns the signing algorithm and public key, for relay
+// proxies and auditors verifying flags files.
+func (fm *FlagManager) signingKeyHandler(w http.ResponseWriter, r *http.Request) {
+	s := fm.signer
+	if s == nil {
+		writeError(w, http.StatusNotFound, "SIGNING_NOT_CONFIGURED", "Flags files are not signed")
+		return
+	}
+
+	resp := SigningKeyResponse{Algorithm: s.algorithm, KeyID: s.keyID}
+	if s.ecdsaKey != nil {
+		der, err := x509.MarshalPKIXPublicKey(&s.ecdsaKey.PublicKey)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		resp.PublicKey = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
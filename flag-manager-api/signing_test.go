@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFlagsSigning(t *testing.T) {
+	fm, tempDir, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+	defer func() { fm.signer = nil }()
+
+	signer := func(env map[string]string) *flagsSigner {
+		t.Helper()
+		s, err := parseFlagsSigner(func(key string) string { return env[key] })
+		if err != nil {
+			t.Fatalf("Failed to parse the signing key: %v", err)
+		}
+		return s
+	}
+	doRequest(t, router, "POST", "/api/projects/web/flags/checkout", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+
+	// Unsigned by default
+	if rr := doRequest(t, router, "GET", "/api/flags/raw", "", http.StatusOK, nil); rr.Header().Get("X-Flags-Signature") != "" {
+		t.Errorf("Expected no signature without a key, got %v", rr.Header())
+	}
+	doRequest(t, router, "GET", "/api/flags/signing-key", "", http.StatusNotFound, nil)
+
+	t.Run("hmac", func(t *testing.T) {
+		fm.signer = signer(map[string]string{"FLAGS_SIGNING_KEY": "shared", "FLAGS_SIGNING_KEY_ID": "2026-10"})
+		rr := doRequest(t, router, "GET", "/api/flags/raw", "", http.StatusOK, nil)
+		mac := hmac.New(sha256.New, []byte("shared"))
+		mac.Write(rr.Body.Bytes())
+		h := rr.Header()
+		if h.Get("X-Flags-Signature") != base64.StdEncoding.EncodeToString(mac.Sum(nil)) || h.Get("X-Flags-SHA256") != sha256Hex(rr.Body.Bytes()) {
+			t.Errorf("Expected the HMAC and digest of the body, got %v", h)
+		}
+		if h.Get("X-Flags-Signature-Algorithm") != "hmac-sha256" || h.Get("X-Flags-Signature-Key-Id") != "2026-10" {
+			t.Errorf("Expected the algorithm and key ID, got %v", h)
+		}
+
+		var key SigningKeyResponse
+		doRequest(t, router, "GET", "/api/flags/signing-key", "", http.StatusOK, &key)
+		if key.Algorithm != "hmac-sha256" || key.KeyID != "2026-10" || key.PublicKey != "" {
+			t.Errorf("Expected the algorithm without a public key, got %+v", key)
+		}
+	})
+
+	t.Run("ecdsa", func(t *testing.T) {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+		keyFile := filepath.Join(tempDir, "signing.pem")
+		os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+		fm.signer = signer(map[string]string{"FLAGS_SIGNING_KEY_FILE": keyFile})
+
+		var key SigningKeyResponse
+		doRequest(t, router, "GET", "/api/flags/signing-key", "", http.StatusOK, &key)
+		block, _ := pem.Decode([]byte(key.PublicKey))
+		if block == nil {
+			t.Fatalf("Expected a PEM public key, got %+v", key)
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			t.Fatalf("Invalid public key: %v", err)
+		}
+
+		rr := doRequest(t, router, "GET", "/api/flags/raw/web?format=json", "", http.StatusOK, nil)
+		digest := sha256.Sum256(rr.Body.Bytes())
+		signature, _ := base64.StdEncoding.DecodeString(rr.Header().Get("X-Flags-Signature"))
+		if !ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], signature) {
+			t.Errorf("Expected a signature the public key verifies, got %v", rr.Header())
+		}
+
+		// Published files get a signature next to them
+		uploads := make(chan [2]string, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			uploads <- [2]string{r.URL.Path, string(body)}
+		}))
+		defer server.Close()
+		defer fm.publishing.configure(nil)
+		doRequest(t, router, "POST", "/api/publish-targets", `{"name":"s3","kind":"s3","config":{"endpoint":"`+server.URL+`","bucket":"flags","object":"flags.yaml","accessKeyId":"AKID","secretAccessKey":"s3cret"}}`, http.StatusCreated, nil)
+
+		var file, sidecar [2]string
+		for timeout := time.After(5 * time.Second); sidecar[0] == ""; {
+			select {
+			case u := <-uploads:
+				if u[0] == "/flags/flags.yaml" {
+					file = u
+				} else {
+					sidecar = u
+				}
+			case <-timeout:
+				t.Fatal("Timed out waiting for the signature upload")
+			}
+		}
+		var sig FlagsSignature
+		json.Unmarshal([]byte(sidecar[1]), &sig)
+		digest = sha256.Sum256([]byte(file[1]))
+		signature, _ = base64.StdEncoding.DecodeString(sig.Signature)
+		if sidecar[0] != "/flags/flags.yaml.sig.json" || sig.SHA256 != sha256Hex([]byte(file[1])) || !ecdsa.VerifyASN1(publicKey.(*ecdsa.PublicKey), digest[:], signature) {
+			t.Errorf("Expected the signature of the file at %s, got %s: %s", file[0], sidecar[0], sidecar[1])
+		}
+	})
+
+	os.WriteFile(filepath.Join(tempDir, "not-a-key.pem"), []byte("{}"), 0600)
+	for name, env := range map[string]map[string]string{
+		"both keys":   {"FLAGS_SIGNING_KEY": "shared", "FLAGS_SIGNING_KEY_FILE": "/dev/null"},
+		"missing key": {"FLAGS_SIGNING_KEY_FILE": filepath.Join(tempDir, "missing.pem")},
+		"not a key":   {"FLAGS_SIGNING_KEY_FILE": filepath.Join(tempDir, "not-a-key.pem")},
+	} {
+		if _, err := parseFlagsSigner(func(key string) string { return env[key] }); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// staleAckMetadataKey is the reserved metadata key holding a flag owner's
+// acknowledgement that the flag is intentionally kept.
+const staleAckMetadataKey = reservedMetadataPrefix + "staleAck"
+
+// StaleAck records that a flag's owner acknowledged a stale-flag report and
+// snoozed it until a given date.
+type StaleAck struct {
+	AcknowledgedBy string `json:"acknowledgedBy,omitempty"`
+	AcknowledgedAt string `json:"acknowledgedAt"`
+	SnoozeUntil    string `json:"snoozeUntil"`
+	Note           string `json:"note,omitempty"`
+}
+
+// staleAckOf returns the stale acknowledgement stored on a flag, if any.
+func staleAckOf(config FlagConfig) (*StaleAck, bool) {
+	raw, ok := config.Metadata[staleAckMetadataKey]
+	if !ok {
+		return nil, false
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false
+	}
+	var ack StaleAck
+	if err := json.Unmarshal(data, &ack); err != nil {
+		return nil, false
+	}
+	return &ack, true
+}
+
+// isStaleSnoozed reports whether a flag's owner has snoozed stale reports for
+// it past now. Stale reports skip snoozed flags until the snooze expires.
+func isStaleSnoozed(config FlagConfig, now time.Time) bool {
+	ack, ok := staleAckOf(config)
+	if !ok {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, ack.SnoozeUntil)
+	if err != nil {
+		return false
+	}
+	return now.Before(until)
+}
+
+// ackStaleFlagHandler records an owner's acknowledgement of a stale flag and
+// snoozes it in stale reports until the given date.
+func (fm *FlagManager) ackStaleFlagHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+	flagKey := vars["flagKey"]
+
+	var body struct {
+		SnoozeUntil string `json:"snoozeUntil"`
+		Note        string `json:"note,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+
+	now := time.Now()
+	until, err := time.Parse(time.RFC3339, body.SnoozeUntil)
+	if err != nil {
+		writeValidationError(w, "INVALID_SNOOZE", "snoozeUntil must be an RFC 3339 timestamp")
+		return
+	}
+	if !until.After(now) {
+		writeValidationError(w, "INVALID_SNOOZE", "snoozeUntil must be in the future")
+		return
+	}
+
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.loadStoredProjectFlags(r.Context(), project)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+	if flags == nil {
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+		return
+	}
+	config, ok := flags[flagKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
+		return
+	}
+
+	actor := GetActor(r)
+	ack := StaleAck{
+		AcknowledgedBy: actor.Name,
+		AcknowledgedAt: now.UTC().Format(time.RFC3339),
+		SnoozeUntil:    until.UTC().Format(time.RFC3339),
+		Note:           body.Note,
+	}
+	if actor.Email != "" {
+		ack.AcknowledgedBy = actor.Email
+	}
+	ackValue, err := toGenericValue(ack)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	metadata := make(map[string]interface{}, len(config.Metadata)+1)
+	for k, v := range config.Metadata {
+		metadata[k] = v
+	}
+	metadata[staleAckMetadataKey] = ackValue
+	config.Metadata = metadata
+	flags[flagKey] = config
+
+	flagIDs, err := fm.saveStoredProjectFlags(r.Context(), project, flags, []string{flagKey})
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	fm.audit.Log(r.Context(), actor, "flag.stale_acknowledged", "flag", flagIDs[flagKey], flagKey, project,
+		nil, map[string]interface{}{"snoozeUntil": ack.SnoozeUntil, "note": ack.Note})
+
+	fm.scheduleRelayRefresh(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ack)
+}
+
+const (
+	staleReasonExpired   = "expired"
+	staleReasonUnchanged = "unchanged"
+)
+
+// StaleFlag is an entry of the stale flag report.
+type StaleFlag struct {
+	Project   string     `json:"project"`
+	Key       string     `json:"key"`
+	Reasons   []string   `json:"reasons"`
+	ExpiresAt string     `json:"expiresAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	Disabled  bool       `json:"disabled"`
+	Snoozed   bool       `json:"snoozed,omitempty"`
+}
+
+// flagExpired reports whether a flag's expiresAt has passed. Flags without a
+// valid expiresAt never expire.
+func flagExpired(config FlagConfig, now time.Time) bool {
+	if config.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, config.ExpiresAt)
+	if err != nil {
+		return false
+	}
+	return !now.Before(expiresAt)
+}
+
+// projectStaleFlags returns the stale flags of a project: flags past their
+// expiresAt, and flags not updated for olderThan (database mode only, as flag
+// files carry no update times). Snoozed flags are skipped unless
+// includeSnoozed is set.
+func (fm *FlagManager) projectStaleFlags(ctx context.Context, project string, flags ProjectFlags, olderThan time.Duration, includeSnoozed bool, now time.Time) ([]StaleFlag, error) {
+	var updateTimes map[string]time.Time
+	if fm.store != nil && olderThan > 0 {
+		var err error
+		if updateTimes, err = fm.store.ListFlagUpdateTimes(ctx, project); err != nil {
+			return nil, err
+		}
+	}
+
+	var stale []StaleFlag
+	for key, config := range flags {
+		// Archived flags are already on their way out
+		if isArchived(config) {
+			continue
+		}
+		entry := StaleFlag{
+			Project:   project,
+			Key:       key,
+			ExpiresAt: config.ExpiresAt,
+			Disabled:  config.Disable != nil && *config.Disable,
+		}
+		if flagExpired(config, now) {
+			entry.Reasons = append(entry.Reasons, staleReasonExpired)
+		}
+		if updatedAt, ok := updateTimes[key]; ok {
+			entry.UpdatedAt = &updatedAt
+			if now.Sub(updatedAt) >= olderThan {
+				entry.Reasons = append(entry.Reasons, staleReasonUnchanged)
+			}
+		}
+		if len(entry.Reasons) == 0 {
+			continue
+		}
+		if isStaleSnoozed(config, now) {
+			if !includeSnoozed {
+				continue
+			}
+			entry.Snoozed = true
+		}
+		stale = append(stale, entry)
+	}
+	return stale, nil
+}
+
+// listAllProjects returns the names of every project.
+func (fm *FlagManager) listAllProjects(ctx context.Context) ([]string, error) {
+	return fm.storage.ListProjects(ctx)
+}
+
+// StaleFlagsResponse lists the stale flags of all projects.
+type StaleFlagsResponse struct {
+	GeneratedAt    string      `json:"generatedAt"`
+	Flags          []StaleFlag `json:"flags"`
+	Total          int         `json:"total"`
+	OlderThanHours int         `json:"olderThanHours,omitempty"`
+}
+
+// staleFlagsHandler reports expired and long-unchanged flags across all
+// projects, or the projects given with ?project=. ?olderThan= (e.g. "30d")
+// overrides STALE_FLAG_AGE and ?includeSnoozed=true lists snoozed flags too.
+func (fm *FlagManager) staleFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	olderThan := fm.config.StaleFlagAge
+	if v := q.Get("olderThan"); v != "" {
+		d, err := parseDuration(v)
+		if err != nil || d <= 0 {
+			writeValidationError(w, "INVALID_OLDER_THAN", "olderThan must be a positive duration such as 30d or 12h")
+			return
+		}
+		olderThan = d
+	}
+	includeSnoozed := q.Get("includeSnoozed") == "true"
+
+	projects := q["project"]
+	if len(projects) == 0 {
+		var err error
+		if projects, err = fm.listAllProjects(r.Context()); err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+	}
+
+	now := time.Now()
+	stale := []StaleFlag{}
+	for _, project := range projects {
+		flags, err := fm.loadStoredProjectFlags(r.Context(), project)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		if flags == nil {
+			writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", fmt.Sprintf("Project not found: %s", project))
+			return
+		}
+		entries, err := fm.projectStaleFlags(r.Context(), project, flags, olderThan, includeSnoozed, now)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+			return
+		}
+		stale = append(stale, entries...)
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		if stale[i].Project != stale[j].Project {
+			return stale[i].Project < stale[j].Project
+		}
+		return stale[i].Key < stale[j].Key
+	})
+
+	response := StaleFlagsResponse{
+		GeneratedAt: now.UTC().Format(time.RFC3339),
+		Flags:       stale,
+		Total:       len(stale),
+	}
+	if olderThan > 0 {
+		response.OlderThanHours = int(olderThan.Hours())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
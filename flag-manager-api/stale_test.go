@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAckStaleFlag(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	body, _ := json.Marshal(FlagConfig{
+		Variations:  map[string]interface{}{"on": true, "off": false},
+		DefaultRule: &DefaultRule{Variation: "off"},
+		Metadata:    map[string]interface{}{"team": "payments"},
+	})
+	req := httptest.NewRequest("POST", "/api/projects/shop/flags/checkout", bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Failed to create flag: %d %s", rr.Code, rr.Body.String())
+	}
+
+	ack := func(flagKey string, payload map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/api/projects/shop/flags/"+flagKey+"/ack-stale", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("invalid snooze rejected", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+		for _, until := range []string{"", "next week", past} {
+			rr := ack("checkout", map[string]interface{}{"snoozeUntil": until})
+			if rr.Code != http.StatusBadRequest || !bytes.Contains(rr.Body.Bytes(), []byte("INVALID_SNOOZE")) {
+				t.Errorf("Expected INVALID_SNOOZE for %q, got %d: %s", until, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		rr := ack("missing", map[string]interface{}{"snoozeUntil": time.Now().Add(time.Hour).Format(time.RFC3339)})
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("acknowledgement snoozes the flag", func(t *testing.T) {
+		until := time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Second)
+		rr := ack("checkout", map[string]interface{}{"snoozeUntil": until.Format(time.RFC3339), "note": "kill switch"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		flags, _ := fm.readProjectFlags("shop")
+		config := flags["checkout"]
+		if config.Metadata["team"] != "payments" {
+			t.Errorf("Expected existing metadata to be kept, got %v", config.Metadata)
+		}
+		stored, ok := staleAckOf(config)
+		if !ok || stored.Note != "kill switch" || stored.SnoozeUntil != until.Format(time.RFC3339) {
+			t.Fatalf("Expected acknowledgement in metadata, got %v", config.Metadata)
+		}
+		if !isStaleSnoozed(config, time.Now()) {
+			t.Error("Expected flag to be snoozed now")
+		}
+		if isStaleSnoozed(config, until.Add(time.Second)) {
+			t.Error("Expected snooze to lapse after snoozeUntil")
+		}
+	})
+}
+
+func TestStaleFlags(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	router := setupTestRouter(fm)
+
+	req := httptest.NewRequest("POST", "/api/projects/stale-tests", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	create := func(key string, config map[string]interface{}) *httptest.ResponseRecorder {
+		config["variations"] = map[string]interface{}{"on": true, "off": false}
+		config["defaultRule"] = map[string]interface{}{"variation": "on"}
+		body, _ := json.Marshal(config)
+		req := httptest.NewRequest("POST", "/api/projects/stale-tests/flags/"+key, bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	for key, expiresAt := range map[string]string{"old-banner": past, "new-banner": future, "keep-me": past, "plain": ""} {
+		config := map[string]interface{}{}
+		if expiresAt != "" {
+			config["expiresAt"] = expiresAt
+		}
+		if key == "keep-me" {
+			config["metadata"] = map[string]interface{}{
+				staleAckMetadataKey: map[string]interface{}{"acknowledgedAt": past, "snoozeUntil": time.Now().Add(72 * time.Hour).UTC().Format(time.RFC3339)},
+			}
+		}
+		if rr := create(key, config); rr.Code != http.StatusCreated {
+			t.Fatalf("Failed to create %s: %d %s", key, rr.Code, rr.Body.String())
+		}
+	}
+
+	if rr := create("bad-expiry", map[string]interface{}{"expiresAt": "next week"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid expiresAt to be rejected, got %d", rr.Code)
+	}
+
+	report := func(query string) []StaleFlag {
+		t.Helper()
+		var response struct {
+			Flags []StaleFlag `json:"flags"`
+			Total int         `json:"total"`
+		}
+		doRequest(t, router, "GET", "/api/flags/stale"+query, "", http.StatusOK, &response)
+		if response.Total != len(response.Flags) {
+			t.Errorf("Expected total %d, got %d", len(response.Flags), response.Total)
+		}
+		return response.Flags
+	}
+
+	stale := report("")
+	if len(stale) != 1 || stale[0].Key != "old-banner" || stale[0].Project != "stale-tests" || len(stale[0].Reasons) != 1 || stale[0].Reasons[0] != staleReasonExpired {
+		t.Errorf("Expected only old-banner to be reported as expired, got %+v", stale)
+	}
+
+	stale = report("?includeSnoozed=true&project=stale-tests")
+	if len(stale) != 2 || stale[0].Key != "keep-me" || !stale[0].Snoozed {
+		t.Errorf("Expected snoozed keep-me to be included, got %+v", stale)
+	}
+
+	req = httptest.NewRequest("GET", "/api/flags/stale?project=missing", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown project, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/api/flags/stale?olderThan=soon", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid olderThan, got %d", rr.Code)
+	}
+
+	readFlags := func() ProjectFlags {
+		flags, err := fm.readProjectFlags("stale-tests")
+		if err != nil {
+			t.Fatalf("Failed to read flags: %v", err)
+		}
+		return flags
+	}
+
+	// Reporting never changes flags
+	if found, changed, err := fm.reapStaleFlags(context.Background(), staleReaperActionReport, time.Now()); err != nil || found != 1 || changed != 0 {
+		t.Fatalf("Expected 1 stale flag and no changes, got %d/%d (%v)", found, changed, err)
+	}
+
+	if _, changed, err := fm.reapStaleFlags(context.Background(), staleReaperActionDisable, time.Now()); err != nil || changed != 1 {
+		t.Fatalf("Expected 1 flag disabled, got %d (%v)", changed, err)
+	}
+	flags := readFlags()
+	if d := flags["old-banner"].Disable; d == nil || !*d {
+		t.Error("Expected old-banner to be disabled")
+	}
+	if flags["keep-me"].Disable != nil {
+		t.Error("Expected snoozed keep-me to be left alone")
+	}
+	if _, changed, _ := fm.reapStaleFlags(context.Background(), staleReaperActionDisable, time.Now()); changed != 0 {
+		t.Errorf("Expected disabled flags not to be disabled again, got %d", changed)
+	}
+
+	// Once new-banner expires, delete removes both expired flags
+	if _, changed, err := fm.reapStaleFlags(context.Background(), staleReaperActionDelete, time.Now().Add(48*time.Hour)); err != nil || changed != 2 {
+		t.Fatalf("Expected 2 flags deleted, got %d (%v)", changed, err)
+	}
+	flags = readFlags()
+	if _, ok := flags["old-banner"]; ok {
+		t.Error("Expected old-banner to be deleted")
+	}
+	if _, ok := flags["new-banner"]; ok {
+		t.Error("Expected new-banner to be deleted")
+	}
+	if _, ok := flags["plain"]; !ok {
+		t.Error("Expected plain to be kept")
+	}
+
+	if got := parseStaleReaperAction("DELETE"); got != staleReaperActionDelete {
+		t.Errorf("Expected delete action, got %q", got)
+	}
+	if got := parseStaleReaperAction("archive"); got != staleReaperActionReport {
+		t.Errorf("Expected unknown action to fall back to report, got %q", got)
+	}
+	if got := parseStaleFlagAge("30d"); got != 30*24*time.Hour {
+		t.Errorf("Expected 30 days, got %s", got)
+	}
+}
@@ -0,0 +1,831 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"flag-manager-api/db"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Storage keeps projects, their flags and environment configs, flag sets,
+// segments, change requests, templates and policies. It is implemented by
+// dbStorage when DATABASE_URL is set (PostgreSQL or SQLite) and by
+// fileStorage over the YAML files in FLAGS_DIR, so that handlers behave the
+// same with either backend.
+// Features that only exist with a database (RBAC, API keys) use fm.store
+// directly.
+type Storage interface {
+	// ListProjects returns the names of all projects.
+	ListProjects(ctx context.Context) ([]string, error)
+	// ProjectExists reports whether a project exists.
+	ProjectExists(ctx context.Context, project string) (bool, error)
+	// CreateProject creates an empty project, or returns errProjectExists,
+	// or errProjectInTrash while a deleted project keeps the name.
+	CreateProject(ctx context.Context, project string) error
+	// DeleteProject moves a project to the trash with its flags and
+	// environments, or returns errProjectNotFound.
+	DeleteProject(ctx context.Context, project string) (*TrashedProject, error)
+	// ListTrash returns the projects in the trash, most recently deleted
+	// first.
+	ListTrash(ctx context.Context) ([]TrashedProject, error)
+	// RestoreProject takes a project out of the trash, or returns
+	// errTrashNotFound, or errProjectExists if its name was taken since.
+	RestoreProject(ctx context.Context, id string) (*TrashedProject, error)
+	// PurgeProject deletes a project in the trash for good, or returns
+	// errTrashNotFound.
+	PurgeProject(ctx context.Context, id string) (*TrashedProject, error)
+
+	// ListFlags returns a project's flags exactly as stored, or
+	// errProjectNotFound.
+	ListFlags(ctx context.Context, project string) (ProjectFlags, error)
+	// AllFlags returns the flags of every project keyed "project/flag".
+	AllFlags(ctx context.Context) (map[string]FlagConfig, error)
+	// ListPublishedFlags is like ListFlags but leaves out draft and archived
+	// flags.
+	ListPublishedFlags(ctx context.Context, project string) (ProjectFlags, error)
+	// AllPublishedFlags is like AllFlags but leaves out draft and archived
+	// flags.
+	AllPublishedFlags(ctx context.Context) (map[string]FlagConfig, error)
+	// EachPublishedFlag calls fn with the flags AllPublishedFlags returns one
+	// at a time, as they are read, ordered by project and key. It stops at
+	// the first error fn returns.
+	EachPublishedFlag(ctx context.Context, fn func(key string, config FlagConfig) error) error
+	// GetFlag returns a flag, or errProjectNotFound or errFlagNotFound.
+	GetFlag(ctx context.Context, project, key string) (*StoredFlag, error)
+	// CreateFlag adds a flag, creating its project if needed. It returns
+	// errFlagExists if the key is taken, or errProjectInTrash.
+	CreateFlag(ctx context.Context, project, key string, config FlagConfig) (*StoredFlag, error)
+	// UpdateFlag replaces a flag's config, renaming it when newKey is set,
+	// and returns the flag before and after. It returns errFlagExists if
+	// newKey is taken.
+	UpdateFlag(ctx context.Context, project, key, newKey string, config FlagConfig) (before, after *StoredFlag, err error)
+	// DeleteFlag removes a flag with its environment configs and returns it.
+	DeleteFlag(ctx context.Context, project, key string) (*StoredFlag, error)
+
+	// SaveFlags persists the changed flags of a set loaded with ListFlags,
+	// all at once. It returns the database IDs of the saved flags (empty
+	// with files).
+	SaveFlags(ctx context.Context, project string, flags ProjectFlags, changed []string) (map[string]string, error)
+	// LockProject serializes read-modify-write cycles of a project's flags
+	// and returns the function that releases the lock. Storage methods must
+	// not be called for the project while it is held, except ListFlags and
+	// SaveFlags.
+	LockProject(project string) func()
+
+	// ListEnvironmentFlags returns a project's flag configs in one
+	// environment, keyed by flag key.
+	ListEnvironmentFlags(ctx context.Context, project, env string) (ProjectFlags, error)
+	// SetEnvironmentFlag stores a flag's config in one environment and
+	// returns the flag's database ID (empty with files) and the config it
+	// replaced, if any. It returns errFlagNotFound if the project has no
+	// such flag.
+	SetEnvironmentFlag(ctx context.Context, project, env, key string, config FlagConfig) (id string, before *FlagConfig, err error)
+	// DeleteEnvironmentFlag removes a flag's config in one environment and
+	// returns it, or errFlagNotConfigured.
+	DeleteEnvironmentFlag(ctx context.Context, project, env, key string) (*FlagConfig, error)
+	// DeleteEnvironmentFlags removes every flag config of a project in one
+	// environment.
+	DeleteEnvironmentFlags(ctx context.Context, project, env string) error
+
+	// ListFlagSets returns every flag set.
+	ListFlagSets(ctx context.Context) ([]FlagSet, error)
+	// GetFlagSet returns a flag set, or errFlagSetNotFound.
+	GetFlagSet(ctx context.Context, id string) (*FlagSet, error)
+	// CreateFlagSet stores a new flag set, filled in by prepareFlagSet.
+	CreateFlagSet(ctx context.Context, flagSet FlagSet) (*FlagSet, error)
+	// UpdateFlagSet replaces a flag set's settings, or returns
+	// errFlagSetNotFound.
+	UpdateFlagSet(ctx context.Context, id string, flagSet FlagSet) (*FlagSet, error)
+	// DeleteFlagSet removes a flag set with its flags.
+	DeleteFlagSet(ctx context.Context, id string) error
+	// ListFlagSetFlags returns a flag set's flags as stored.
+	ListFlagSetFlags(ctx context.Context, id string) (map[string]interface{}, error)
+	// SaveFlagSetFlags persists the changed flags of a set loaded with
+	// ListFlagSetFlags; changed keys missing from flags are deleted.
+	SaveFlagSetFlags(ctx context.Context, id string, flags map[string]interface{}, changed []string) error
+
+	// Segments need a database: with files, these methods return
+	// errDatabaseRequired, except GetSegmentByName, which finds no segment.
+
+	// ListSegments returns a page of segments.
+	ListSegments(ctx context.Context, params db.PaginationParams) (*db.PaginatedResult[db.Segment], error)
+	// GetSegment returns a segment, or errSegmentNotFound.
+	GetSegment(ctx context.Context, id string) (*db.Segment, error)
+	// GetSegmentByName returns the segment with a name, or
+	// errSegmentNotFound.
+	GetSegmentByName(ctx context.Context, name string) (*db.Segment, error)
+	// CreateSegment stores a new segment with its first version, or returns
+	// errSegmentExists.
+	CreateSegment(ctx context.Context, seg db.Segment, author string) (*db.Segment, error)
+	// UpdateSegment replaces a segment, recording a new version, or returns
+	// errSegmentNotFound or errSegmentExists.
+	UpdateSegment(ctx context.Context, id string, seg db.Segment, author string) (*db.Segment, error)
+	// DeleteSegment removes a segment, or returns errSegmentNotFound.
+	DeleteSegment(ctx context.Context, id string) error
+	// ListSegmentVersions returns the versions of a segment, newest first.
+	ListSegmentVersions(ctx context.Context, id string) ([]db.SegmentVersion, error)
+	// GetSegmentVersion returns a version of a segment, or
+	// errSegmentVersionNotFound.
+	GetSegmentVersion(ctx context.Context, id string, version int) (*db.SegmentVersion, error)
+
+	// ListChangeRequests returns a page of change requests.
+	ListChangeRequests(ctx context.Context, params db.ChangeRequestFilterParams) (*db.PaginatedResult[db.ChangeRequest], error)
+	// GetChangeRequest returns a change request.
+	GetChangeRequest(ctx context.Context, id string) (*db.ChangeRequest, error)
+	// CreateChangeRequest stores a new pending change request.
+	CreateChangeRequest(ctx context.Context, cr db.ChangeRequest) (*db.ChangeRequest, error)
+	// SetChangeRequestStatus sets the status of a change request, recording
+	// who applied it when the status is "applied".
+	SetChangeRequestStatus(ctx context.Context, id, status, appliedBy string) error
+	// CancelChangeRequestsBefore cancels the open change requests created
+	// before a time and returns them.
+	CancelChangeRequestsBefore(ctx context.Context, before time.Time) ([]db.ChangeRequest, error)
+	// CountPendingChangeRequests returns the number of pending change
+	// requests.
+	CountPendingChangeRequests(ctx context.Context) (int, error)
+	// AddChangeRequestReview records a review of a change request.
+	AddChangeRequestReview(ctx context.Context, review db.ChangeRequestReview) (*db.ChangeRequestReview, error)
+	// ListChangeRequestReviews returns the reviews of a change request,
+	// oldest first.
+	ListChangeRequestReviews(ctx context.Context, id string) ([]db.ChangeRequestReview, error)
+
+	// ListFlagTemplates returns every flag template.
+	ListFlagTemplates(ctx context.Context) ([]db.FlagTemplate, error)
+	// GetFlagTemplate returns a flag template, or errTemplateNotFound.
+	GetFlagTemplate(ctx context.Context, id string) (*db.FlagTemplate, error)
+	// CreateFlagTemplate stores a new flag template, or returns
+	// errTemplateExists.
+	CreateFlagTemplate(ctx context.Context, t db.FlagTemplate) (*db.FlagTemplate, error)
+	// UpdateFlagTemplate replaces a flag template, or returns
+	// errTemplateNotFound or errTemplateExists.
+	UpdateFlagTemplate(ctx context.Context, id string, t db.FlagTemplate) (*db.FlagTemplate, error)
+	// DeleteFlagTemplate removes a flag template, or returns
+	// errTemplateNotFound.
+	DeleteFlagTemplate(ctx context.Context, id string) error
+
+	// ListPolicies returns every policy.
+	ListPolicies(ctx context.Context) ([]db.Policy, error)
+	// GetPolicy returns a policy, or errPolicyNotFound.
+	GetPolicy(ctx context.Context, id string) (*db.Policy, error)
+	// CreatePolicy stores a new policy, or returns errPolicyExists.
+	CreatePolicy(ctx context.Context, p db.Policy) (*db.Policy, error)
+	// UpdatePolicy replaces a policy, or returns errPolicyNotFound or
+	// errPolicyExists.
+	UpdatePolicy(ctx context.Context, id string, p db.Policy) (*db.Policy, error)
+	// DeletePolicy removes a policy, or returns errPolicyNotFound.
+	DeletePolicy(ctx context.Context, id string) error
+}
+
+// StoredFlag is a flag as returned by Storage.
+type StoredFlag struct {
+	ID     string // database ID, empty with file storage
+	Key    string
+	Config FlagConfig
+}
+
+var (
+	errProjectNotFound = errors.New("project not found")
+	errProjectExists   = errors.New("project already exists")
+	errFlagNotFound    = errors.New("flag not found")
+	errFlagExists      = errors.New("flag already exists")
+	errFlagArchived    = errors.New("flag is archived")
+	errFlagNotArchived = errors.New("flag is not archived")
+	errProjectInTrash  = errors.New("a deleted project with this name is in the trash")
+	errTrashNotFound   = errors.New("trashed project not found")
+
+	errFlagNotConfigured = errors.New("flag not configured in environment")
+	errFlagSetNotFound   = errors.New("flag set not found")
+
+	errDatabaseRequired       = errors.New("database required")
+	errSegmentNotFound        = errors.New("segment not found")
+	errSegmentExists          = errors.New("segment already exists")
+	errSegmentVersionNotFound = errors.New("segment version not found")
+)
+
+// writeStorageError responds with the status of a Storage error.
+func writeStorageError(w http.ResponseWriter, err error) {
+	if writePolicyViolationError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, errProjectNotFound):
+		writeError(w, http.StatusNotFound, "PROJECT_NOT_FOUND", "Project not found")
+	case errors.Is(err, errFlagNotFound):
+		writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found")
+	case errors.Is(err, errFlagNotConfigured):
+		writeError(w, http.StatusNotFound, "FLAG_NOT_CONFIGURED", "Flag not configured in environment")
+	case errors.Is(err, errFlagSetNotFound):
+		writeError(w, http.StatusNotFound, "FLAG_SET_NOT_FOUND", "Flag set not found")
+	case errors.Is(err, errTrashNotFound):
+		writeError(w, http.StatusNotFound, "TRASH_NOT_FOUND", "Project not found in the trash")
+	case errors.Is(err, errProjectExists):
+		writeError(w, http.StatusConflict, "PROJECT_EXISTS", "Project already exists")
+	case errors.Is(err, errProjectInTrash):
+		writeError(w, http.StatusConflict, "PROJECT_IN_TRASH", "A deleted project with this name is in the trash: restore or purge it first")
+	case errors.Is(err, errFlagExists):
+		writeError(w, http.StatusConflict, "FLAG_EXISTS", "Flag already exists")
+	case errors.Is(err, errFlagArchived):
+		writeError(w, http.StatusConflict, "FLAG_ARCHIVED", "Flag is archived")
+	case errors.Is(err, errFlagNotArchived):
+		writeError(w, http.StatusConflict, "FLAG_NOT_ARCHIVED", "Flag is not archived")
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+}
+
+// dbStorage stores projects and flags in the database.
+type dbStorage struct {
+	store *db.Store
+}
+
+func (s *dbStorage) ListProjects(ctx context.Context) ([]string, error) {
+	return s.store.ListProjects(ctx)
+}
+
+func (s *dbStorage) ProjectExists(ctx context.Context, project string) (bool, error) {
+	return s.store.ProjectExists(ctx, project)
+}
+
+func (s *dbStorage) CreateProject(ctx context.Context, project string) error {
+	exists, err := s.store.ProjectExists(ctx, project)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errProjectExists
+	}
+	if err := s.checkNotInTrash(ctx, project); err != nil {
+		return err
+	}
+	_, err = s.store.CreateProject(ctx, project, "")
+	return err
+}
+
+// checkNotInTrash returns errProjectInTrash if a deleted project keeps the
+// name.
+func (s *dbStorage) checkNotInTrash(ctx context.Context, project string) error {
+	inTrash, err := s.store.ProjectInTrash(ctx, project)
+	if err != nil {
+		return err
+	}
+	if inTrash {
+		return errProjectInTrash
+	}
+	return nil
+}
+
+// DeleteProject renames the project row out of the way: its flags,
+// environments and history are kept until it is purged.
+func (s *dbStorage) DeleteProject(ctx context.Context, project string) (*TrashedProject, error) {
+	p, err := s.store.TrashProject(ctx, project, trashDeletedBy(ctx))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errProjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return trashedProject(p), nil
+}
+
+func (s *dbStorage) ListTrash(ctx context.Context) ([]TrashedProject, error) {
+	rows, err := s.store.ListTrashedProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trash := make([]TrashedProject, len(rows))
+	for i := range rows {
+		trash[i] = *trashedProject(&rows[i])
+	}
+	return trash, nil
+}
+
+func (s *dbStorage) RestoreProject(ctx context.Context, id string) (*TrashedProject, error) {
+	p, err := s.store.GetTrashedProject(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errTrashNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	exists, err := s.store.ProjectExists(ctx, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errProjectExists
+	}
+	if err := s.store.RestoreProject(ctx, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errTrashNotFound
+		}
+		return nil, err
+	}
+	return trashedProject(p), nil
+}
+
+func (s *dbStorage) PurgeProject(ctx context.Context, id string) (*TrashedProject, error) {
+	p, err := s.store.GetTrashedProject(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errTrashNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.PurgeProject(ctx, id); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errTrashNotFound
+		}
+		return nil, err
+	}
+	s.history().deleteProject(ctx, p.Name)
+	return trashedProject(p), nil
+}
+
+// trashedProject converts a trashed project row.
+func trashedProject(p *db.TrashedProject) *TrashedProject {
+	return &TrashedProject{ID: p.ID, Type: "project", Name: p.Name, Flags: p.Flags, DeletedAt: p.DeletedAt, DeletedBy: p.DeletedBy}
+}
+
+func (s *dbStorage) ListFlags(ctx context.Context, project string) (ProjectFlags, error) {
+	exists, err := s.store.ProjectExists(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errProjectNotFound
+	}
+
+	rawFlags, err := s.store.ListFlags(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFlagConfigs(rawFlags)
+}
+
+func (s *dbStorage) AllFlags(ctx context.Context) (map[string]FlagConfig, error) {
+	rawFlags, err := s.store.GetAllFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFlagConfigs(rawFlags)
+}
+
+func (s *dbStorage) ListPublishedFlags(ctx context.Context, project string) (ProjectFlags, error) {
+	exists, err := s.store.ProjectExists(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errProjectNotFound
+	}
+
+	rawFlags, err := s.store.ListPublishedFlags(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFlagConfigs(rawFlags)
+}
+
+func (s *dbStorage) AllPublishedFlags(ctx context.Context) (map[string]FlagConfig, error) {
+	rawFlags, err := s.store.GetAllPublishedFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFlagConfigs(rawFlags)
+}
+
+func (s *dbStorage) EachPublishedFlag(ctx context.Context, fn func(key string, config FlagConfig) error) error {
+	return s.store.EachPublishedFlag(ctx, func(key string, raw json.RawMessage) error {
+		var config FlagConfig
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return fmt.Errorf("failed to parse flag %s: %w", key, err)
+		}
+		return fn(key, config)
+	})
+}
+
+func (s *dbStorage) GetFlag(ctx context.Context, project, key string) (*StoredFlag, error) {
+	flag, err := s.store.GetFlag(ctx, project, key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errFlagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return storedFlag(flag)
+}
+
+func (s *dbStorage) CreateFlag(ctx context.Context, project, key string, config FlagConfig) (*StoredFlag, error) {
+	exists, err := s.store.FlagExists(ctx, project, key)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errFlagExists
+	}
+	if err := s.checkNotInTrash(ctx, project); err != nil {
+		return nil, err
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	flag, err := s.store.CreateFlag(ctx, project, key, configJSON, flagDisabled(config), config.Version)
+	if err != nil {
+		return nil, err
+	}
+	countFlagOperation("create", 1)
+	s.history().record(ctx, project, flagRevision{Key: key, Action: flagVersionCreated, Config: &config})
+	return storedFlag(flag)
+}
+
+func (s *dbStorage) UpdateFlag(ctx context.Context, project, key, newKey string, config FlagConfig) (*StoredFlag, *StoredFlag, error) {
+	before, err := s.GetFlag(ctx, project, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if newKey != "" && newKey != key {
+		exists, err := s.store.FlagExists(ctx, project, newKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if exists {
+			return nil, nil, errFlagExists
+		}
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	flag, err := s.store.UpdateFlag(ctx, project, key, configJSON, flagDisabled(config), config.Version, newKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	countFlagOperation("update", 1)
+	after, err := storedFlag(flag)
+	if err == nil {
+		s.history().record(ctx, project, updateRevision(key, after.Key, config))
+	}
+	return before, after, err
+}
+
+func (s *dbStorage) DeleteFlag(ctx context.Context, project, key string) (*StoredFlag, error) {
+	existing, err := s.GetFlag(ctx, project, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.DeleteFlag(ctx, project, key); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, errFlagNotFound
+		}
+		return nil, err
+	}
+	countFlagOperation("delete", 1)
+	s.history().record(ctx, project, flagRevision{Key: key, Action: flagVersionDeleted})
+	return existing, nil
+}
+
+func (s *dbStorage) SaveFlags(ctx context.Context, project string, flags ProjectFlags, changed []string) (map[string]string, error) {
+	configs := make(map[string]json.RawMessage, len(changed))
+	for _, key := range changed {
+		data, err := json.Marshal(flags[key])
+		if err != nil {
+			return nil, err
+		}
+		configs[key] = data
+	}
+	updated, err := s.store.UpdateFlagConfigs(ctx, project, configs)
+	if err != nil {
+		return nil, err
+	}
+	countFlagOperation("update", len(updated))
+
+	ids := make(map[string]string, len(updated))
+	for _, f := range updated {
+		ids[f.Key] = f.ID
+	}
+	s.history().record(ctx, project, savedRevisions(flags, changed)...)
+	return ids, nil
+}
+
+func (s *dbStorage) ListEnvironmentFlags(ctx context.Context, project, env string) (ProjectFlags, error) {
+	rawFlags, err := s.store.ListEnvironmentFlags(ctx, project, env)
+	if err != nil {
+		return nil, err
+	}
+	return decodeFlagConfigs(rawFlags)
+}
+
+func (s *dbStorage) SetEnvironmentFlag(ctx context.Context, project, env, key string, config FlagConfig) (string, *FlagConfig, error) {
+	configs, err := s.ListEnvironmentFlags(ctx, project, env)
+	if err != nil {
+		return "", nil, err
+	}
+	var before *FlagConfig
+	if prev, ok := configs[key]; ok {
+		before = &prev
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return "", nil, err
+	}
+	id, err := s.store.SetEnvironmentFlag(ctx, project, env, key, configJSON)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, errFlagNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return id, before, nil
+}
+
+func (s *dbStorage) DeleteEnvironmentFlag(ctx context.Context, project, env, key string) (*FlagConfig, error) {
+	configs, err := s.ListEnvironmentFlags(ctx, project, env)
+	if err != nil {
+		return nil, err
+	}
+	before, ok := configs[key]
+	if !ok {
+		return nil, errFlagNotConfigured
+	}
+	if err := s.store.DeleteEnvironmentFlag(ctx, project, env, key); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errFlagNotConfigured
+		}
+		return nil, err
+	}
+	return &before, nil
+}
+
+func (s *dbStorage) DeleteEnvironmentFlags(ctx context.Context, project, env string) error {
+	return s.store.DeleteEnvironmentFlags(ctx, project, env)
+}
+
+func (s *dbStorage) ListFlagSets(ctx context.Context) ([]FlagSet, error) {
+	rows, err := s.store.ListFlagSets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flagSets := make([]FlagSet, 0, len(rows))
+	for _, row := range rows {
+		flagSets = append(flagSets, dbFlagSetToFlagSet(row))
+	}
+	return flagSets, nil
+}
+
+func (s *dbStorage) GetFlagSet(ctx context.Context, id string) (*FlagSet, error) {
+	row, err := s.store.GetFlagSet(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errFlagSetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs := dbFlagSetToFlagSet(*row)
+	return &fs, nil
+}
+
+func (s *dbStorage) CreateFlagSet(ctx context.Context, flagSet FlagSet) (*FlagSet, error) {
+	row, err := s.store.CreateFlagSet(ctx, flagSetToDBFlagSet(flagSet))
+	if err != nil {
+		return nil, err
+	}
+	fs := dbFlagSetToFlagSet(*row)
+	return &fs, nil
+}
+
+func (s *dbStorage) UpdateFlagSet(ctx context.Context, id string, flagSet FlagSet) (*FlagSet, error) {
+	row, err := s.store.UpdateFlagSet(ctx, id, flagSetToDBFlagSet(flagSet))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errFlagSetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs := dbFlagSetToFlagSet(*row)
+	return &fs, nil
+}
+
+func (s *dbStorage) DeleteFlagSet(ctx context.Context, id string) error {
+	return s.store.DeleteFlagSet(ctx, id)
+}
+
+func (s *dbStorage) ListFlagSetFlags(ctx context.Context, id string) (map[string]interface{}, error) {
+	rawFlags, err := s.store.ListFlagSetFlags(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	flags := make(map[string]interface{}, len(rawFlags))
+	for key, raw := range rawFlags {
+		var config interface{}
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse flag %s: %w", key, err)
+		}
+		flags[key] = config
+	}
+	return flags, nil
+}
+
+func (s *dbStorage) SaveFlagSetFlags(ctx context.Context, id string, flags map[string]interface{}, changed []string) error {
+	for _, key := range changed {
+		config, keep := flags[key]
+		if !keep {
+			if err := s.store.DeleteFlagSetFlag(ctx, id, key); err != nil {
+				return fmt.Errorf("flag %s: %w", key, err)
+			}
+			continue
+		}
+		configJSON, err := json.Marshal(config)
+		if err != nil {
+			return fmt.Errorf("flag %s: %w", key, err)
+		}
+		exists, err := s.store.FlagSetFlagExists(ctx, id, key)
+		if err == nil {
+			if exists {
+				err = s.store.UpdateFlagSetFlag(ctx, id, key, configJSON, "")
+			} else {
+				err = s.store.CreateFlagSetFlag(ctx, id, key, configJSON)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("flag %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func (s *dbStorage) ListSegments(ctx context.Context, params db.PaginationParams) (*db.PaginatedResult[db.Segment], error) {
+	return s.store.ListSegments(ctx, params)
+}
+
+func (s *dbStorage) GetSegment(ctx context.Context, id string) (*db.Segment, error) {
+	seg, err := s.store.GetSegment(ctx, id)
+	return seg, segmentStoreError(err)
+}
+
+func (s *dbStorage) GetSegmentByName(ctx context.Context, name string) (*db.Segment, error) {
+	seg, err := s.store.GetSegmentByName(ctx, name)
+	return seg, segmentStoreError(err)
+}
+
+func (s *dbStorage) CreateSegment(ctx context.Context, seg db.Segment, author string) (*db.Segment, error) {
+	created, err := s.store.CreateSegment(ctx, seg, author)
+	return created, segmentStoreError(err)
+}
+
+func (s *dbStorage) UpdateSegment(ctx context.Context, id string, seg db.Segment, author string) (*db.Segment, error) {
+	updated, err := s.store.UpdateSegment(ctx, id, seg, author)
+	return updated, segmentStoreError(err)
+}
+
+func (s *dbStorage) DeleteSegment(ctx context.Context, id string) error {
+	return segmentStoreError(s.store.DeleteSegment(ctx, id))
+}
+
+func (s *dbStorage) ListSegmentVersions(ctx context.Context, id string) ([]db.SegmentVersion, error) {
+	return s.store.ListSegmentVersions(ctx, id)
+}
+
+func (s *dbStorage) GetSegmentVersion(ctx context.Context, id string, version int) (*db.SegmentVersion, error) {
+	v, err := s.store.GetSegmentVersion(ctx, id, version)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return nil, errSegmentVersionNotFound
+	}
+	return v, err
+}
+
+func (s *dbStorage) ListChangeRequests(ctx context.Context, params db.ChangeRequestFilterParams) (*db.PaginatedResult[db.ChangeRequest], error) {
+	return s.store.ListChangeRequests(ctx, params)
+}
+
+func (s *dbStorage) GetChangeRequest(ctx context.Context, id string) (*db.ChangeRequest, error) {
+	return s.store.GetChangeRequest(ctx, id)
+}
+
+func (s *dbStorage) CreateChangeRequest(ctx context.Context, cr db.ChangeRequest) (*db.ChangeRequest, error) {
+	return s.store.CreateChangeRequest(ctx, cr)
+}
+
+func (s *dbStorage) SetChangeRequestStatus(ctx context.Context, id, status, appliedBy string) error {
+	return s.store.UpdateChangeRequestStatus(ctx, id, status, appliedBy)
+}
+
+func (s *dbStorage) CancelChangeRequestsBefore(ctx context.Context, before time.Time) ([]db.ChangeRequest, error) {
+	return s.store.CancelChangeRequestsBefore(ctx, before)
+}
+
+func (s *dbStorage) CountPendingChangeRequests(ctx context.Context) (int, error) {
+	return s.store.CountPendingChangeRequests(ctx)
+}
+
+func (s *dbStorage) AddChangeRequestReview(ctx context.Context, review db.ChangeRequestReview) (*db.ChangeRequestReview, error) {
+	return s.store.AddChangeRequestReview(ctx, review)
+}
+
+func (s *dbStorage) ListChangeRequestReviews(ctx context.Context, id string) ([]db.ChangeRequestReview, error) {
+	return s.store.GetChangeRequestReviews(ctx, id)
+}
+
+func (s *dbStorage) ListFlagTemplates(ctx context.Context) ([]db.FlagTemplate, error) {
+	return s.store.ListFlagTemplates(ctx)
+}
+
+func (s *dbStorage) GetFlagTemplate(ctx context.Context, id string) (*db.FlagTemplate, error) {
+	t, err := s.store.GetFlagTemplate(ctx, id)
+	return t, templateStoreError(err)
+}
+
+func (s *dbStorage) CreateFlagTemplate(ctx context.Context, t db.FlagTemplate) (*db.FlagTemplate, error) {
+	created, err := s.store.CreateFlagTemplate(ctx, t)
+	return created, templateStoreError(err)
+}
+
+func (s *dbStorage) UpdateFlagTemplate(ctx context.Context, id string, t db.FlagTemplate) (*db.FlagTemplate, error) {
+	updated, err := s.store.UpdateFlagTemplate(ctx, id, t)
+	return updated, templateStoreError(err)
+}
+
+func (s *dbStorage) DeleteFlagTemplate(ctx context.Context, id string) error {
+	return templateStoreError(s.store.DeleteFlagTemplate(ctx, id))
+}
+
+func (s *dbStorage) ListPolicies(ctx context.Context) ([]db.Policy, error) {
+	return s.store.ListPolicies(ctx)
+}
+
+func (s *dbStorage) GetPolicy(ctx context.Context, id string) (*db.Policy, error) {
+	p, err := s.store.GetPolicy(ctx, id)
+	return p, policyStoreError(err)
+}
+
+func (s *dbStorage) CreatePolicy(ctx context.Context, p db.Policy) (*db.Policy, error) {
+	created, err := s.store.CreatePolicy(ctx, p)
+	return created, policyStoreError(err)
+}
+
+func (s *dbStorage) UpdatePolicy(ctx context.Context, id string, p db.Policy) (*db.Policy, error) {
+	updated, err := s.store.UpdatePolicy(ctx, id, p)
+	return updated, policyStoreError(err)
+}
+
+func (s *dbStorage) DeletePolicy(ctx context.Context, id string) error {
+	return policyStoreError(s.store.DeletePolicy(ctx, id))
+}
+
+// segmentStoreError maps database errors to errSegmentNotFound and
+// errSegmentExists.
+func segmentStoreError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows) || strings.Contains(err.Error(), "not found"):
+		return errSegmentNotFound
+	case strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "UNIQUE"):
+		return errSegmentExists
+	}
+	return err
+}
+
+func (s *dbStorage) history() flagHistory {
+	return flagHistory{store: s.store}
+}
+
+// LockProject does nothing: SaveFlags updates the flags in one transaction.
+func (s *dbStorage) LockProject(project string) func() {
+	return func() {}
+}
+
+// flagDisabled returns the disabled column of a flag config.
+func flagDisabled(config FlagConfig) bool {
+	return config.Disable != nil && *config.Disable
+}
+
+func storedFlag(flag *db.Flag) (*StoredFlag, error) {
+	var config FlagConfig
+	if err := json.Unmarshal(flag.Config, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse flag %s: %w", flag.Key, err)
+	}
+	return &StoredFlag{ID: flag.ID, Key: flag.Key, Config: config}, nil
+}
+
+func decodeFlagConfigs(rawFlags map[string]json.RawMessage) (ProjectFlags, error) {
+	flags := make(ProjectFlags, len(rawFlags))
+	for k, v := range rawFlags {
+		var fc FlagConfig
+		if err := json.Unmarshal(v, &fc); err != nil {
+			return nil, fmt.Errorf("failed to parse flag %s: %w", k, err)
+		}
+		flags[k] = fc
+	}
+	return flags, nil
+}
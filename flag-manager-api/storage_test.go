@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	if !store.SQLite() {
+		t.Fatal("Expected a SQLite store")
+	}
+
+	fm := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	fm.audit = NewAuditLogger(store, fm.changes)
+	router := setupTestRouter(fm)
+
+	doRequest(t, router, "POST", "/api/projects/web", "", http.StatusCreated, nil)
+	doRequest(t, router, "POST", "/api/projects/web", "", http.StatusConflict, nil)
+	doRequest(t, router, "POST", "/api/projects/web/flags/beta", `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`, http.StatusCreated, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/flags/beta", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusOK, nil)
+
+	var flag map[string]interface{}
+	doRequest(t, router, "GET", "/api/projects/web/flags/beta", "", http.StatusOK, &flag)
+	if rule, _ := flag["config"].(map[string]interface{})["defaultRule"].(map[string]interface{}); rule["variation"] != "on" {
+		t.Errorf("Expected the update to be stored, got %v", flag)
+	}
+
+	var audit db.PaginatedResult[db.AuditEvent]
+	doRequest(t, router, "GET", "/api/audit?project=web", "", http.StatusOK, &audit)
+	actions := []string{}
+	for _, e := range audit.Data {
+		actions = append(actions, e.Action)
+	}
+	if len(actions) != 3 {
+		t.Errorf("Expected project and flag changes to be audited, got %v", actions)
+	}
+
+	doRequest(t, router, "DELETE", "/api/projects/web", "", http.StatusNoContent, nil)
+	if flags, err := store.GetAllFlags(context.Background()); err != nil || len(flags) != 0 {
+		t.Errorf("Expected the project's flags to be deleted, got %v, %v", flags, err)
+	}
+}
+
+func TestStorageBackends(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	store, err := db.NewStore("sqlite://" + filepath.Join(t.TempDir(), "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+
+	backends := map[string]Storage{
+		"file":     fileFM.storage,
+		"database": &dbStorage{store: store},
+	}
+	for name, s := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			disabled := true
+			config := FlagConfig{Variations: map[string]interface{}{"on": true, "off": false}, DefaultRule: &DefaultRule{Variation: "off"}}
+
+			if err := s.CreateProject(ctx, "web"); err != nil {
+				t.Fatalf("CreateProject: %v", err)
+			}
+			if err := s.CreateProject(ctx, "web"); !errors.Is(err, errProjectExists) {
+				t.Errorf("Expected errProjectExists, got %v", err)
+			}
+			if _, err := s.ListFlags(ctx, "missing"); !errors.Is(err, errProjectNotFound) {
+				t.Errorf("Expected errProjectNotFound, got %v", err)
+			}
+
+			if _, err := s.CreateFlag(ctx, "web", "beta", config); err != nil {
+				t.Fatalf("CreateFlag: %v", err)
+			}
+			if _, err := s.CreateFlag(ctx, "web", "gamma", config); err != nil {
+				t.Fatalf("CreateFlag: %v", err)
+			}
+			if _, err := s.CreateFlag(ctx, "web", "beta", config); !errors.Is(err, errFlagExists) {
+				t.Errorf("Expected errFlagExists, got %v", err)
+			}
+
+			renamed := config
+			renamed.Disable = &disabled
+			if _, _, err := s.UpdateFlag(ctx, "web", "beta", "gamma", renamed); !errors.Is(err, errFlagExists) {
+				t.Errorf("Expected errFlagExists on rename to a taken key, got %v", err)
+			}
+			before, after, err := s.UpdateFlag(ctx, "web", "beta", "beta-2", renamed)
+			if err != nil {
+				t.Fatalf("UpdateFlag: %v", err)
+			}
+			if before.Key != "beta" || before.Config.Disable != nil || after.Key != "beta-2" || !flagDisabled(after.Config) {
+				t.Errorf("Unexpected update result: before %+v, after %+v", before, after)
+			}
+
+			flags, err := s.ListFlags(ctx, "web")
+			if err != nil || len(flags) != 2 || !flagDisabled(flags["beta-2"]) {
+				t.Errorf("Expected beta-2 and gamma, got %v, %v", flags, err)
+			}
+			all, err := s.AllFlags(ctx)
+			if _, ok := all["web/gamma"]; err != nil || !ok {
+				t.Errorf("Expected web/gamma in all flags, got %v, %v", all, err)
+			}
+
+			if _, err := s.DeleteFlag(ctx, "web", "gamma"); err != nil {
+				t.Fatalf("DeleteFlag: %v", err)
+			}
+			if _, err := s.GetFlag(ctx, "web", "gamma"); !errors.Is(err, errFlagNotFound) {
+				t.Errorf("Expected errFlagNotFound, got %v", err)
+			}
+
+			if _, err := s.DeleteProject(ctx, "web"); err != nil {
+				t.Fatalf("DeleteProject: %v", err)
+			}
+			if exists, _ := s.ProjectExists(ctx, "web"); exists {
+				t.Error("Expected web to be deleted")
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// hasTag reports whether a flag carries tag.
+func hasTag(config FlagConfig, tag string) bool {
+	for _, t := range config.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTag lowercases a free-form tag and replaces its spaces with dashes.
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+}
+
+// promoteMetadataTag moves the tags a flag keeps in its "tags" metadata entry,
+// as imported from LaunchDarkly or set by hand before tags were a flag field,
+// to its Tags. Entries that do not make valid tags stay in the metadata. It
+// reports whether the flag changed.
+func promoteMetadataTag(config *FlagConfig) bool {
+	raw, ok := config.Metadata["tags"]
+	if !ok {
+		return false
+	}
+	var values []string
+	switch v := raw.(type) {
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return false
+			}
+			values = append(values, s)
+		}
+	case []string:
+		values = v
+	case string:
+		values = strings.Split(v, ",")
+	default:
+		return false
+	}
+
+	var rest []interface{}
+	for _, value := range values {
+		tag := normalizeTag(value)
+		if ValidateTag(tag) != nil || (!hasTag(*config, tag) && len(config.Tags) >= maxFlagTags) {
+			if strings.TrimSpace(value) != "" {
+				rest = append(rest, value)
+			}
+			continue
+		}
+		if !hasTag(*config, tag) {
+			config.Tags = append(config.Tags, tag)
+		}
+	}
+	if len(rest) == len(values) {
+		return false
+	}
+
+	metadata := make(map[string]interface{}, len(config.Metadata))
+	for k, v := range config.Metadata {
+		metadata[k] = v
+	}
+	if len(rest) > 0 {
+		metadata["tags"] = rest
+	} else {
+		delete(metadata, "tags")
+	}
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	config.Metadata = metadata
+	return true
+}
+
+// promoteMetadataTags promotes the metadata tags of every flag, see
+// promoteMetadataTag, and returns the number of flags changed.
+func (fm *FlagManager) promoteMetadataTags(ctx context.Context) (int, error) {
+	projects, err := fm.storage.ListProjects(ctx)
+	if err != nil {
+		return 0, err
+	}
+	promoted := 0
+	for _, project := range projects {
+		n, err := fm.promoteProjectMetadataTags(ctx, project)
+		if err != nil {
+			return promoted, fmt.Errorf("project %s: %w", project, err)
+		}
+		promoted += n
+	}
+	return promoted, nil
+}
+
+func (fm *FlagManager) promoteProjectMetadataTags(ctx context.Context, project string) (int, error) {
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.storage.ListFlags(ctx, project)
+	if err != nil {
+		return 0, err
+	}
+	var changed []string
+	for key, config := range flags {
+		if promoteMetadataTag(&config) {
+			flags[key] = config
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	sort.Strings(changed)
+	if _, err := fm.storage.SaveFlags(ctx, project, flags, changed); err != nil {
+		return 0, err
+	}
+	return len(changed), nil
+}
+
+// TagCount is a tag and the number of flags carrying it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagsResponse lists the tags in use, most used first.
+type TagsResponse struct {
+	Tags  []TagCount `json:"tags"`
+	Total int        `json:"total"`
+}
+
+// listTagsHandler lists the tags of every flag, or of a project's flags with
+// ?project=, with the number of flags carrying each.
+func (fm *FlagManager) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var flags map[string]FlagConfig
+	var err error
+	if project := r.URL.Query().Get("project"); project != "" {
+		flags, err = fm.storage.ListFlags(r.Context(), project)
+	} else {
+		flags, err = fm.storage.AllFlags(r.Context())
+	}
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, config := range flags {
+		for _, tag := range config.Tags {
+			counts[tag]++
+		}
+	}
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TagsResponse{Tags: tags, Total: len(tags)})
+}
+
+// bulkFlagKeys returns the flags of a project a bulk operation applies to: the
+// given keys, or when tag is set, the flags carrying it (among keys, if any).
+func (fm *FlagManager) bulkFlagKeys(ctx context.Context, project string, keys []string, tag string) ([]string, error) {
+	if tag == "" {
+		return keys, nil
+	}
+	flags, err := fm.storage.ListFlags(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	candidates := keys
+	if len(candidates) == 0 {
+		for key := range flags {
+			candidates = append(candidates, key)
+		}
+		sort.Strings(candidates)
+	}
+	var selected []string
+	for _, key := range candidates {
+		if config, ok := flags[key]; ok && hasTag(config, tag) {
+			selected = append(selected, key)
+		}
+	}
+	return selected, nil
+}
+
+// TagsPatch describes a bulk tag change. Flags are selected by Keys and Tag as
+// for the other bulk operations; all flags when both are empty.
+type TagsPatch struct {
+	Keys   []string `json:"keys,omitempty"`
+	Tag    string   `json:"tag,omitempty"`
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// validate checks that the patch changes something and names valid tags.
+func (p TagsPatch) validate() []string {
+	var errs []string
+	if len(p.Add) == 0 && len(p.Remove) == 0 {
+		errs = append(errs, "add or remove is required")
+	}
+	if p.Tag != "" {
+		if err := ValidateTag(p.Tag); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, tag := range p.Add {
+		if err := ValidateTag(tag); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, tag := range p.Remove {
+		for _, added := range p.Add {
+			if tag == added {
+				errs = append(errs, fmt.Sprintf("tag '%s' cannot be both added and removed", tag))
+			}
+		}
+	}
+	return errs
+}
+
+// apply returns the patched tags and whether anything changed.
+func (p TagsPatch) apply(tags []string) ([]string, bool) {
+	removed := make(map[string]bool, len(p.Remove))
+	for _, tag := range p.Remove {
+		removed[tag] = true
+	}
+	var patched []string
+	seen := make(map[string]bool, len(tags)+len(p.Add))
+	for _, tag := range append(append([]string{}, tags...), p.Add...) {
+		if !removed[tag] && !seen[tag] {
+			patched = append(patched, tag)
+			seen[tag] = true
+		}
+	}
+	if len(patched) != len(tags) {
+		return patched, true
+	}
+	for i := range patched {
+		if patched[i] != tags[i] {
+			return patched, true
+		}
+	}
+	return tags, false
+}
+
+// BulkTagsResponse lists the flags whose tags a bulk edit changed.
+type BulkTagsResponse struct {
+	Updated []string `json:"updated"`
+	Total   int      `json:"total"`
+}
+
+// bulkTagsHandler adds and removes tags on many flags of a project at once.
+// All selected flags are written together or not at all.
+func (fm *FlagManager) bulkTagsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	project := vars["project"]
+
+	var patch TagsPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return
+	}
+	if errs := patch.validate(); len(errs) > 0 {
+		writeValidationError(w, "INVALID_TAGS_PATCH", "Tags patch is invalid", errs...)
+		return
+	}
+
+	defer fm.storage.LockProject(project)()
+
+	flags, err := fm.storage.ListFlags(r.Context(), project)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	candidates := patch.Keys
+	if len(candidates) == 0 {
+		for key := range flags {
+			candidates = append(candidates, key)
+		}
+	}
+	sort.Strings(candidates)
+
+	type tagsChange struct {
+		key           string
+		before, after []string
+	}
+	var changes []tagsChange
+	var errs, denied []string
+	for _, key := range candidates {
+		config, ok := flags[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "FLAG_NOT_FOUND", "Flag not found: "+key)
+			return
+		}
+		if patch.Tag != "" && !hasTag(config, patch.Tag) {
+			continue
+		}
+		patched, changed := patch.apply(config.Tags)
+		if !changed {
+			continue
+		}
+		if len(patched) > maxFlagTags {
+			errs = append(errs, fmt.Sprintf("%s: a flag can have at most %d tags", key, maxFlagTags))
+			continue
+		}
+		if !fm.mayChangeFlag(r, config) {
+			denied = append(denied, key)
+		}
+		changes = append(changes, tagsChange{key: key, before: config.Tags, after: patched})
+		config.Tags = patched
+		flags[key] = config
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, "TOO_MANY_TAGS", "Tags patch exceeds the tag limit", errs...)
+		return
+	}
+	if len(denied) > 0 {
+		writeNotFlagOwner(w, denied...)
+		return
+	}
+
+	updatedKeys := make([]string, 0, len(changes))
+	for _, c := range changes {
+		updatedKeys = append(updatedKeys, c.key)
+	}
+
+	if len(changes) > 0 {
+		flagIDs, err := fm.storage.SaveFlags(r.Context(), project, flags, updatedKeys)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+
+		actor := GetActor(r)
+		for _, c := range changes {
+			fm.audit.Log(r.Context(), actor, "flag.tags_updated", "flag", flagIDs[c.key], c.key, project,
+				map[string]interface{}{"before": c.before, "after": c.after},
+				map[string]interface{}{"bulk": true})
+		}
+
+		fm.scheduleRelayRefresh(r.Context())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BulkTagsResponse{
+		Updated: updatedKeys,
+		Total:   len(updatedKeys),
+	})
+}
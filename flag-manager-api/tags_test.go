@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagTags(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			listed := func(path string) []string {
+				t.Helper()
+				var list struct {
+					Flags map[string]interface{} `json:"flags"`
+				}
+				doRequest(t, router, "GET", path, "", http.StatusOK, &list)
+				var keys []string
+				for key := range list.Flags {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				return keys
+			}
+			flag := func(tags string) string {
+				return `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"tags":` + tags + `}`
+			}
+
+			doRequest(t, router, "POST", "/api/projects/shop/flags/checkout", flag(`["payments","checkout"]`), http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/refunds", flag(`["payments"]`), http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/banner", flag(`[]`), http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/blog/flags/comments", flag(`["payments"]`), http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bad", flag(`["Payments"]`), http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bad", flag(`["a","a"]`), http.StatusBadRequest, nil)
+
+			if keys := listed("/api/projects/shop/flags?tag=payments"); !reflect.DeepEqual(keys, []string{"checkout", "refunds"}) {
+				t.Errorf("Expected the payments flags, got %v", keys)
+			}
+			doRequest(t, router, "GET", "/api/projects/shop/flags?tag=Bad%20Tag", "", http.StatusBadRequest, nil)
+			if fm.store != nil {
+				var page db.PaginatedResult[db.Flag]
+				doRequest(t, router, "GET", "/api/projects/shop/flags?page=1&tag=checkout", "", http.StatusOK, &page)
+				if page.Total != 1 || page.Data[0].Key != "checkout" {
+					t.Errorf("Expected the paginated list to be filtered by tag, got %+v", page)
+				}
+			}
+
+			var tags TagsResponse
+			doRequest(t, router, "GET", "/api/tags", "", http.StatusOK, &tags)
+			if want := []TagCount{{"payments", 3}, {"checkout", 1}}; !reflect.DeepEqual(tags.Tags, want) {
+				t.Errorf("Expected tag counts %v, got %v", want, tags.Tags)
+			}
+			tags = TagsResponse{}
+			doRequest(t, router, "GET", "/api/tags?project=blog", "", http.StatusOK, &tags)
+			if tags.Total != 1 || tags.Tags[0] != (TagCount{"payments", 1}) {
+				t.Errorf("Expected the blog tags, got %v", tags)
+			}
+
+			var tagged BulkTagsResponse
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-tags", `{"tag":"payments","add":["billing"],"remove":["checkout"]}`, http.StatusOK, &tagged)
+			if !reflect.DeepEqual(tagged.Updated, []string{"checkout", "refunds"}) {
+				t.Errorf("Expected the payments flags to be retagged, got %+v", tagged)
+			}
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-tags", `{"add":["Bad"]}`, http.StatusBadRequest, nil)
+			if keys := listed("/api/projects/shop/flags?tag=billing"); !reflect.DeepEqual(keys, []string{"checkout", "refunds"}) {
+				t.Errorf("Expected the billing tag to be added, got %v", keys)
+			}
+			if keys := listed("/api/projects/shop/flags?tag=checkout"); len(keys) != 0 {
+				t.Errorf("Expected the checkout tag to be removed, got %v", keys)
+			}
+
+			var metadata BulkMetadataResponse
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-metadata", `{"tag":"billing","set":{"team":"payments"}}`, http.StatusOK, &metadata)
+			if !reflect.DeepEqual(metadata.Updated, []string{"checkout", "refunds"}) {
+				t.Errorf("Expected the metadata of the billing flags to be set, got %+v", metadata)
+			}
+
+			var toggled BulkResponse
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-toggle", `{"tag":"billing","disabled":true}`, http.StatusOK, &toggled)
+			if toggled.Total != 2 {
+				t.Errorf("Expected the billing flags to be disabled, got %+v", toggled)
+			}
+			var deleted BulkResponse
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-delete", `{"keys":["banner","refunds"],"tag":"billing"}`, http.StatusOK, &deleted)
+			if deleted.Total != 1 || deleted.Results[0].Key != "refunds" {
+				t.Errorf("Expected only the tagged key to be deleted, got %+v", deleted)
+			}
+			doRequest(t, router, "POST", "/api/projects/shop/flags/bulk-delete", `{}`, http.StatusBadRequest, nil)
+			if keys := listed("/api/projects/shop/flags"); !reflect.DeepEqual(keys, []string{"banner", "checkout"}) {
+				t.Errorf("Expected banner and checkout to remain, got %v", keys)
+			}
+
+			// Tags kept in metadata before they were a flag field are promoted
+			ctx := context.Background()
+			legacy := FlagConfig{
+				Variations:  map[string]interface{}{"on": true},
+				DefaultRule: &DefaultRule{Variation: "on"},
+				Metadata:    map[string]interface{}{"owner": "ops", "tags": []interface{}{"Growth", "a b", "bad!"}},
+			}
+			if _, err := fm.storage.CreateFlag(ctx, "legacy", "old", legacy); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := fm.promoteMetadataTags(ctx); err != nil || n != 1 {
+				t.Fatalf("Expected one flag promoted, got %d, %v", n, err)
+			}
+			old, err := fm.storage.GetFlag(ctx, "legacy", "old")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(old.Config.Tags, []string{"growth", "a-b"}) ||
+				!reflect.DeepEqual(old.Config.Metadata["tags"], []interface{}{"bad!"}) || old.Config.Metadata["owner"] != "ops" {
+				t.Errorf("Expected the valid metadata tags to be promoted, got %+v", old.Config)
+			}
+			if n, err := fm.promoteMetadataTags(ctx); err != nil || n != 0 {
+				t.Errorf("Expected nothing left to promote, got %d, %v", n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"flag-manager-api/db"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errTemplateNotFound = errors.New("template not found")
+	errTemplateExists   = errors.New("template already exists")
+)
+
+// placeholderRegex matches a {{name}} placeholder in a template string.
+var placeholderRegex = regexp.MustCompile(`\{\{\s*([A-Za-z][A-Za-z0-9_]*)\s*\}\}`)
+
+// placeholderNameRegex is the syntax of declared placeholder names.
+var placeholderNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// builtinPlaceholders are substituted in every template without being
+// declared.
+var builtinPlaceholders = []string{"flagKey", "project"}
+
+// FlagTemplatesStore manages flag template persistence in file mode
+type FlagTemplatesStore struct {
+	filePath  string
+	templates []db.FlagTemplate
+	mu        sync.RWMutex
+}
+
+// NewFlagTemplatesStore creates a new flag templates store
+func NewFlagTemplatesStore(configDir string) *FlagTemplatesStore {
+	store := &FlagTemplatesStore{
+		filePath: filepath.Join(configDir, "templates.json"),
+	}
+	store.load()
+	return store
+}
+
+func (s *FlagTemplatesStore) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return json.Unmarshal(data, &s.templates)
+}
+
+func (s *FlagTemplatesStore) save() error {
+	data, err := json.MarshalIndent(s.templates, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.filePath, data, 0644)
+}
+
+// nameTaken reports whether a template other than id is named name.
+func (s *FlagTemplatesStore) nameTaken(name, id string) bool {
+	for _, t := range s.templates {
+		if t.Name == name && t.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the templates ordered by name
+func (s *FlagTemplatesStore) List() []db.FlagTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := append([]db.FlagTemplate{}, s.templates...)
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+// Get returns a template, or errTemplateNotFound
+func (s *FlagTemplatesStore) Get(id string) (*db.FlagTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.templates {
+		if t.ID == id {
+			return &t, nil
+		}
+	}
+	return nil, errTemplateNotFound
+}
+
+// Create stores a template and returns it with its ID and timestamps
+func (s *FlagTemplatesStore) Create(t db.FlagTemplate) (*db.FlagTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(t.Name, "") {
+		return nil, errTemplateExists
+	}
+	now := time.Now().UTC()
+	t.ID = uuid.New().String()
+	t.CreatedAt = now
+	t.UpdatedAt = now
+	s.templates = append(s.templates, t)
+	if err := s.save(); err != nil {
+		s.templates = s.templates[:len(s.templates)-1]
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Update replaces a template, keeping its ID, author and creation time
+func (s *FlagTemplatesStore) Update(id string, t db.FlagTemplate) (*db.FlagTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.templates {
+		if existing.ID != id {
+			continue
+		}
+		if s.nameTaken(t.Name, id) {
+			return nil, errTemplateExists
+		}
+		t.ID = id
+		t.CreatedBy = existing.CreatedBy
+		t.CreatedAt = existing.CreatedAt
+		t.UpdatedAt = time.Now().UTC()
+		s.templates[i] = t
+		if err := s.save(); err != nil {
+			s.templates[i] = existing
+			return nil, err
+		}
+		return &t, nil
+	}
+	return nil, errTemplateNotFound
+}
+
+// Delete removes a template
+func (s *FlagTemplatesStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.templates {
+		if t.ID != id {
+			continue
+		}
+		previous := s.templates
+		s.templates = append(s.templates[:i:i], s.templates[i+1:]...)
+		if err := s.save(); err != nil {
+			s.templates = previous
+			return err
+		}
+		return nil
+	}
+	return errTemplateNotFound
+}
+
+// templateStoreError maps database errors to errTemplateNotFound and
+// errTemplateExists.
+func templateStoreError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, pgx.ErrNoRows):
+		return errTemplateNotFound
+	case strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") || strings.Contains(err.Error(), "UNIQUE"):
+		return errTemplateExists
+	}
+	return err
+}
+
+// writeTemplateError responds with the status of a template store error.
+func writeTemplateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTemplateNotFound):
+		writeError(w, http.StatusNotFound, "TEMPLATE_NOT_FOUND", "Template not found")
+	case errors.Is(err, errTemplateExists):
+		writeError(w, http.StatusConflict, "TEMPLATE_EXISTS", "Template with this name already exists")
+	default:
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+	}
+}
+
+// substitutePlaceholders replaces the placeholders in the strings and object
+// keys of a JSON value. Placeholders without a value are left as they are.
+func substitutePlaceholders(v interface{}, values map[string]string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return placeholderRegex.ReplaceAllStringFunc(v, func(match string) string {
+			if value, ok := values[placeholderRegex.FindStringSubmatch(match)[1]]; ok {
+				return value
+			}
+			return match
+		})
+	case map[string]interface{}:
+		substituted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			substituted[substitutePlaceholders(key, values).(string)] = substitutePlaceholders(item, values)
+		}
+		return substituted
+	case []interface{}:
+		substituted := make([]interface{}, len(v))
+		for i, item := range v {
+			substituted[i] = substitutePlaceholders(item, values)
+		}
+		return substituted
+	}
+	return v
+}
+
+// usedPlaceholders collects the names of the placeholders of a JSON value.
+func usedPlaceholders(v interface{}, names map[string]bool) {
+	switch v := v.(type) {
+	case string:
+		for _, m := range placeholderRegex.FindAllStringSubmatch(v, -1) {
+			names[m[1]] = true
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			usedPlaceholders(key, names)
+			usedPlaceholders(item, names)
+		}
+	case []interface{}:
+		for _, item := range v {
+			usedPlaceholders(item, names)
+		}
+	}
+}
+
+// renderTemplateConfig substitutes values in a template config.
+func renderTemplateConfig(config json.RawMessage, values map[string]string) (FlagConfig, error) {
+	var generic interface{}
+	if err := json.Unmarshal(config, &generic); err != nil {
+		return FlagConfig{}, err
+	}
+	data, err := json.Marshal(substitutePlaceholders(generic, values))
+	if err != nil {
+		return FlagConfig{}, err
+	}
+	var rendered FlagConfig
+	if err := json.Unmarshal(data, &rendered); err != nil {
+		return FlagConfig{}, err
+	}
+	return rendered, nil
+}
+
+// validateFlagTemplate checks a template, including that its config is a
+// valid flag once placeholders are substituted with their default or name.
+func validateFlagTemplate(t db.FlagTemplate) []string {
+	var errs []string
+	if strings.TrimSpace(t.Name) == "" {
+		errs = append(errs, "name is required")
+	} else if len(t.Name) > 100 {
+		errs = append(errs, "name must be at most 100 characters")
+	}
+
+	samples := make(map[string]string)
+	for _, name := range builtinPlaceholders {
+		samples[name] = name
+	}
+	for i, p := range t.Placeholders {
+		switch {
+		case !placeholderNameRegex.MatchString(p.Name):
+			errs = append(errs, fmt.Sprintf("placeholder #%d: name must start with a letter followed by letters, digits or underscores", i+1))
+		case samples[p.Name] != "":
+			errs = append(errs, fmt.Sprintf("placeholder %q is built in or declared twice", p.Name))
+		default:
+			samples[p.Name] = p.Name
+			if p.Default != "" {
+				samples[p.Name] = p.Default
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range t.RequiredMetadata {
+		if strings.TrimSpace(key) == "" {
+			errs = append(errs, "required metadata keys must not be empty")
+		} else if seen[key] {
+			errs = append(errs, fmt.Sprintf("required metadata key %q is listed twice", key))
+		}
+		seen[key] = true
+	}
+
+	var generic map[string]interface{}
+	if len(t.Config) == 0 || json.Unmarshal(t.Config, &generic) != nil || generic == nil {
+		return append(errs, "config must be a flag configuration object")
+	}
+	used := make(map[string]bool)
+	usedPlaceholders(generic, used)
+	for _, name := range sortedKeys(used) {
+		if _, ok := samples[name]; !ok {
+			errs = append(errs, fmt.Sprintf("config uses undeclared placeholder {{%s}}", name))
+		}
+	}
+
+	rendered, err := renderTemplateConfig(t.Config, samples)
+	if err != nil {
+		return append(errs, "config: "+err.Error())
+	}
+	for _, e := range ValidateFlagConfig(rendered) {
+		errs = append(errs, "config: "+e)
+	}
+	return errs
+}
+
+// FlagTemplatesResponse lists the flag templates.
+type FlagTemplatesResponse struct {
+	Templates []db.FlagTemplate `json:"templates"`
+	Total     int               `json:"total"`
+}
+
+func (fm *FlagManager) listFlagTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := fm.storage.ListFlagTemplates(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FlagTemplatesResponse{Templates: templates, Total: len(templates)})
+}
+
+func (fm *FlagManager) getFlagTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	t, err := fm.storage.GetFlagTemplate(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// decodeFlagTemplate reads and validates the template of a request body. It
+// writes the error response and returns false when the template is invalid.
+func decodeFlagTemplate(w http.ResponseWriter, r *http.Request) (db.FlagTemplate, bool) {
+	var t db.FlagTemplate
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+		return t, false
+	}
+	t.Name = strings.TrimSpace(t.Name)
+	if errs := validateFlagTemplate(t); len(errs) > 0 {
+		writeValidationError(w, "INVALID_TEMPLATE", "Template is invalid", errs...)
+		return t, false
+	}
+	return t, true
+}
+
+func (fm *FlagManager) createFlagTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := decodeFlagTemplate(w, r)
+	if !ok {
+		return
+	}
+	t.CreatedBy = actorLabel(GetActor(r))
+
+	created, err := fm.storage.CreateFlagTemplate(r.Context(), t)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "template.created", "template", created.ID, created.Name, "",
+		map[string]interface{}{"after": created}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (fm *FlagManager) updateFlagTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	t, ok := decodeFlagTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	before, err := fm.storage.GetFlagTemplate(r.Context(), id)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	updated, err := fm.storage.UpdateFlagTemplate(r.Context(), id, t)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "template.updated", "template", updated.ID, updated.Name, "",
+		map[string]interface{}{"before": before, "after": updated}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (fm *FlagManager) deleteFlagTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	existing, err := fm.storage.GetFlagTemplate(r.Context(), id)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	if err := fm.storage.DeleteFlagTemplate(r.Context(), id); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "template.deleted", "template", id, existing.Name, "",
+		map[string]interface{}{"before": existing}, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// flagFromTemplate renders the config of a flag created from a template with
+// the placeholder values of the request body {"values": {...}}, and adds its
+// optional "metadata" to the flag's. It writes the error response and returns
+// nil when the flag cannot be created.
+func (fm *FlagManager) flagFromTemplate(w http.ResponseWriter, r *http.Request, id, project, flagKey string) (*FlagConfig, *db.FlagTemplate) {
+	t, err := fm.storage.GetFlagTemplate(r.Context(), id)
+	if err != nil {
+		writeTemplateError(w, err)
+		return nil, nil
+	}
+
+	var requestBody struct {
+		Values   map[string]string      `json:"values"`
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body")
+			return nil, nil
+		}
+	}
+
+	values := map[string]string{"flagKey": flagKey, "project": project}
+	declared := make(map[string]bool, len(t.Placeholders))
+	var missing []string
+	for _, p := range t.Placeholders {
+		declared[p.Name] = true
+		value, ok := requestBody.Values[p.Name]
+		switch {
+		case ok:
+			values[p.Name] = value
+		case p.Required:
+			missing = append(missing, p.Name)
+		default:
+			values[p.Name] = p.Default
+		}
+	}
+	if len(missing) > 0 {
+		writeValidationError(w, "MISSING_PLACEHOLDER", "Values are required for template placeholders", missing...)
+		return nil, nil
+	}
+	for _, name := range sortedKeys(requestBody.Values) {
+		if !declared[name] {
+			writeValidationError(w, "UNKNOWN_PLACEHOLDER", fmt.Sprintf("template %q has no placeholder %q", t.Name, name))
+			return nil, nil
+		}
+	}
+
+	config, err := renderTemplateConfig(t.Config, values)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", err.Error())
+		return nil, nil
+	}
+
+	for key, value := range requestBody.Metadata {
+		if config.Metadata == nil {
+			config.Metadata = make(map[string]interface{})
+		}
+		config.Metadata[key] = value
+	}
+
+	var unset []string
+	for _, key := range t.RequiredMetadata {
+		if value, ok := config.Metadata[key]; !ok || value == nil || value == "" {
+			unset = append(unset, key)
+		}
+	}
+	if len(unset) > 0 {
+		writeValidationError(w, "MISSING_METADATA", "The template requires metadata that the flag does not set", unset...)
+		return nil, nil
+	}
+	return &config, t
+}
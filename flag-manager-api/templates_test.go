@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagTemplates(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	experiment := `{
+		"name": "3-way experiment",
+		"description": "Control and two treatments",
+		"config": {
+			"variations": {"control": "{{flagKey}}-control", "{{treatmentA}}": "a", "{{treatmentB}}": "b"},
+			"defaultRule": {"percentage": {"control": 34, "{{treatmentA}}": 33, "{{treatmentB}}": 33}},
+			"metadata": {"owner": "{{owner}}", "project": "{{project}}"}
+		},
+		"placeholders": [
+			{"name": "treatmentA", "default": "treatment-a"},
+			{"name": "treatmentB", "default": "treatment-b"},
+			{"name": "owner", "required": true}
+		],
+		"requiredMetadata": ["owner", "ticket"]
+	}`
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			router := setupTestRouter(fm)
+			var tmpl db.FlagTemplate
+			doRequest(t, router, "POST", "/api/templates", experiment, http.StatusCreated, &tmpl)
+			if tmpl.ID == "" || len(tmpl.Placeholders) != 3 || !reflect.DeepEqual(tmpl.RequiredMetadata, []string{"owner", "ticket"}) {
+				t.Fatalf("Unexpected template: %+v", tmpl)
+			}
+			doRequest(t, router, "POST", "/api/templates", experiment, http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/templates", `{"name":"broken","config":{"variations":{"on":"{{missing}}"},"defaultRule":{"variation":"on"}}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/templates", `{"name":"kill switch","config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusCreated, nil)
+
+			var list FlagTemplatesResponse
+			doRequest(t, router, "GET", "/api/templates", "", http.StatusOK, &list)
+			if list.Total != 2 || list.Templates[0].Name != "3-way experiment" {
+				t.Errorf("Expected 2 templates ordered by name, got %+v", list)
+			}
+
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout?template="+tmpl.ID, `{"values":{"treatmentB":"fast"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout?template="+tmpl.ID, `{"values":{"owner":"team-a","color":"red"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout?template="+tmpl.ID, `{"values":{"owner":"team-a"}}`, http.StatusBadRequest, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout?template=missing", "", http.StatusNotFound, nil)
+
+			var flag FlagResponse
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout?template="+tmpl.ID, `{"values":{"owner":"team-a","treatmentB":"fast"},"metadata":{"ticket":"JIRA-1"}}`, http.StatusCreated, &flag)
+			wantVariations := map[string]interface{}{"control": "checkout-control", "treatment-a": "a", "fast": "b"}
+			if !reflect.DeepEqual(flag.Config.Variations, wantVariations) || flag.Config.DefaultRule.Percentage["fast"] != 33 {
+				t.Errorf("Expected placeholders to be substituted, got %+v", flag.Config)
+			}
+			if flag.Config.Metadata["owner"] != "team-a" || flag.Config.Metadata["project"] != "web" || flag.Config.Metadata["ticket"] != "JIRA-1" {
+				t.Errorf("Unexpected metadata: %v", flag.Config.Metadata)
+			}
+
+			doRequest(t, router, "PUT", "/api/templates/"+tmpl.ID, `{"name":"3-way experiment","config":{"variations":{"on":true},"defaultRule":{"variation":"on"}}}`, http.StatusOK, &tmpl)
+			if len(tmpl.Placeholders) != 0 || tmpl.CreatedAt.IsZero() {
+				t.Errorf("Expected the template to be replaced, got %+v", tmpl)
+			}
+			doRequest(t, router, "DELETE", "/api/templates/"+tmpl.ID, "", http.StatusNoContent, nil)
+			doRequest(t, router, "GET", "/api/templates/"+tmpl.ID, "", http.StatusNotFound, nil)
+			doRequest(t, router, "PUT", "/api/templates/"+tmpl.ID, `{"name":"gone","config":{"variations":{"on":true},"defaultRule":{"variation":"on"}}}`, http.StatusNotFound, nil)
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultProjectTrashRetention is how long deleted projects stay in the
+	// trash when PROJECT_TRASH_RETENTION is not set.
+	defaultProjectTrashRetention = 30 * 24 * time.Hour
+	// trashPurgeInterval is how often projects past the retention are purged
+	// from the trash.
+	trashPurgeInterval = time.Hour
+)
+
+// trashPurgeActor is the audit actor of projects purged from the trash after
+// the retention.
+var trashPurgeActor = Actor{ID: "trash-purge", Name: "trash-purge", Type: "system"}
+
+// parseProjectTrashRetention reads the PROJECT_TRASH_RETENTION setting ("30d",
+// "720h"). Empty values use the default; zero keeps deleted projects in the
+// trash until they are purged.
+func parseProjectTrashRetention(value string) time.Duration {
+	if value == "" {
+		return defaultProjectTrashRetention
+	}
+	if value == "0" {
+		return 0
+	}
+	d, err := parseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("Invalid PROJECT_TRASH_RETENTION, using default", "value", value, "default", defaultProjectTrashRetention)
+		return defaultProjectTrashRetention
+	}
+	return d
+}
+
+// TrashedProject is a deleted project in the trash. It keeps its flags,
+// environments and history, and its name is reserved until it is restored or
+// purged.
+type TrashedProject struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"` // "project"
+	Name      string     `json:"name"`
+	Flags     int        `json:"flags"`
+	DeletedAt time.Time  `json:"deletedAt"`
+	DeletedBy string     `json:"deletedBy,omitempty"`
+	PurgeAt   *time.Time `json:"purgeAt,omitempty"` // unset when the trash is kept forever
+}
+
+// TrashResponse lists the trash, most recently deleted first.
+type TrashResponse struct {
+	Items []TrashedProject `json:"items"`
+	Total int              `json:"total"`
+}
+
+// trashDeletedBy names the actor of ctx deleting a project.
+func trashDeletedBy(ctx context.Context) string {
+	if actor, ok := ctx.Value(ctxActor).(Actor); ok {
+		return actorLabel(actor)
+	}
+	return ""
+}
+
+// withPurgeAt sets when a trashed project is purged after the retention.
+func (fm *FlagManager) withPurgeAt(p TrashedProject) TrashedProject {
+	if fm.config.ProjectTrashRetention > 0 {
+		purgeAt := p.DeletedAt.Add(fm.config.ProjectTrashRetention)
+		p.PurgeAt = &purgeAt
+	}
+	return p
+}
+
+// trashID returns the trash ID of a request, or errTrashNotFound if it is not
+// one.
+func trashID(r *http.Request) (string, error) {
+	id := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(id); err != nil {
+		return "", errTrashNotFound
+	}
+	return id, nil
+}
+
+// listTrashHandler lists the deleted projects in the trash.
+func (fm *FlagManager) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	trash, err := fm.storage.ListTrash(r.Context())
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	for i := range trash {
+		trash[i] = fm.withPurgeAt(trash[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TrashResponse{Items: trash, Total: len(trash)})
+}
+
+// restoreTrashHandler restores a deleted project under its name, with its
+// flags and environments.
+func (fm *FlagManager) restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := trashID(r)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	restored, err := fm.storage.RestoreProject(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "project.restored", "project", id, restored.Name, restored.Name, nil,
+		map[string]interface{}{"trashId": id, "deletedAt": restored.DeletedAt})
+
+	fm.scheduleRelayRefresh(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CreateProjectResponse{Project: restored.Name, Status: "restored"})
+}
+
+// purgeTrashHandler deletes a project in the trash for good, without waiting
+// for the retention.
+func (fm *FlagManager) purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := trashID(r)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	purged, err := fm.storage.PurgeProject(r.Context(), id)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	fm.audit.Log(r.Context(), GetActor(r), "project.purged", "project", id, purged.Name, purged.Name, nil,
+		map[string]interface{}{"trashId": id, "deletedAt": purged.DeletedAt})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeTrash purges the projects in the trash longer than the retention. A
+// failing project does not stop the others; the first error is returned.
+func (fm *FlagManager) purgeTrash(ctx context.Context, now time.Time) (int, error) {
+	trash, err := fm.storage.ListTrash(ctx)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := now.Add(-fm.config.ProjectTrashRetention)
+
+	purged := 0
+	var firstErr error
+	for _, p := range trash {
+		if p.DeletedAt.After(cutoff) {
+			continue
+		}
+		if _, err := fm.storage.PurgeProject(ctx, p.ID); err != nil {
+			// The project may have been restored since it was listed
+			if errors.Is(err, errTrashNotFound) {
+				continue
+			}
+			slog.WarnContext(ctx, "Failed to purge trashed project", "project", p.Name, "id", p.ID, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		fm.audit.Log(ctx, trashPurgeActor, "project.purged", "project", p.ID, p.Name, p.Name, nil,
+			map[string]interface{}{"trashId": p.ID, "deletedAt": p.DeletedAt})
+		purged++
+	}
+
+	if purged > 0 {
+		slog.InfoContext(ctx, "Purged trashed projects", "count", purged, "retention", fm.config.ProjectTrashRetention)
+	}
+	return purged, firstErr
+}
+
+// runTrashPurge purges trashed projects past the retention every interval
+// until ctx is done.
+func (fm *FlagManager) runTrashPurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			fm.purgeTrash(ctx, now)
+		}
+	}
+}
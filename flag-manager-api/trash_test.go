@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"flag-manager-api/db"
+)
+
+func TestProjectTrash(t *testing.T) {
+	fileFM, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+
+	tempDir := t.TempDir()
+	store, err := db.NewStore("sqlite://" + filepath.Join(tempDir, "goff.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	defer store.Close()
+	dbFM := &FlagManager{config: Config{FlagsDir: tempDir}, store: store, storage: &dbStorage{store: store}, changes: NewChangeFeed()}
+	dbFM.audit = NewAuditLogger(store, dbFM.changes)
+
+	for name, fm := range map[string]*FlagManager{"file": fileFM, "database": dbFM} {
+		t.Run(name, func(t *testing.T) {
+			fm.config.ProjectTrashRetention = 24 * time.Hour
+			router := setupTestRouter(fm)
+			trash := func() []TrashedProject {
+				t.Helper()
+				var list TrashResponse
+				doRequest(t, router, "GET", "/api/trash", "", http.StatusOK, &list)
+				if list.Total != len(list.Items) {
+					t.Errorf("Expected total %d, got %d", len(list.Items), list.Total)
+				}
+				return list.Items
+			}
+			projects := func() []string {
+				t.Helper()
+				var list ProjectsResponse
+				doRequest(t, router, "GET", "/api/projects", "", http.StatusOK, &list)
+				return list.Projects
+			}
+
+			flag := `{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"}}`
+			doRequest(t, router, "POST", "/api/projects/web/flags/checkout", flag, http.StatusCreated, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/banner", flag, http.StatusCreated, nil)
+			doRequest(t, router, "DELETE", "/api/projects/web", "", http.StatusNoContent, nil)
+			doRequest(t, router, "DELETE", "/api/projects/web", "", http.StatusNotFound, nil)
+
+			// Deleted projects are gone from the API but kept in the trash
+			if slices.Contains(projects(), "web") {
+				t.Errorf("Expected the deleted project not to be listed, got %v", projects())
+			}
+			doRequest(t, router, "GET", "/api/projects/web/flags/checkout", "", http.StatusNotFound, nil)
+			items := trash()
+			if len(items) != 1 || items[0].Name != "web" || items[0].Type != "project" || items[0].Flags != 2 {
+				t.Fatalf("Expected web in the trash with 2 flags, got %+v", items)
+			}
+			if items[0].PurgeAt == nil || !items[0].PurgeAt.Equal(items[0].DeletedAt.Add(24*time.Hour)) {
+				t.Errorf("Expected the project purged after the retention, got %+v", items[0])
+			}
+			id := items[0].ID
+
+			// The name stays reserved while the project is in the trash
+			doRequest(t, router, "POST", "/api/projects/web", "", http.StatusConflict, nil)
+			doRequest(t, router, "POST", "/api/projects/web/flags/other", flag, http.StatusConflict, nil)
+
+			doRequest(t, router, "POST", "/api/trash/not-an-id/restore", "", http.StatusNotFound, nil)
+			doRequest(t, router, "POST", "/api/trash/00000000-0000-0000-0000-000000000000/restore", "", http.StatusNotFound, nil)
+			var restored CreateProjectResponse
+			doRequest(t, router, "POST", "/api/trash/"+id+"/restore", "", http.StatusOK, &restored)
+			if restored.Project != "web" || restored.Status != "restored" {
+				t.Errorf("Expected web restored, got %+v", restored)
+			}
+			doRequest(t, router, "POST", "/api/trash/"+id+"/restore", "", http.StatusNotFound, nil)
+			doRequest(t, router, "GET", "/api/projects/web/flags/checkout", "", http.StatusOK, nil)
+			if items := trash(); len(items) != 0 {
+				t.Errorf("Expected an empty trash, got %+v", items)
+			}
+
+			// Purging frees the name
+			doRequest(t, router, "DELETE", "/api/projects/web", "", http.StatusNoContent, nil)
+			id = trash()[0].ID
+			doRequest(t, router, "DELETE", "/api/trash/"+id, "", http.StatusNoContent, nil)
+			doRequest(t, router, "DELETE", "/api/trash/"+id, "", http.StatusNotFound, nil)
+			doRequest(t, router, "POST", "/api/projects/web", "", http.StatusCreated, nil)
+			var list struct {
+				Flags map[string]interface{} `json:"flags"`
+			}
+			doRequest(t, router, "GET", "/api/projects/web/flags", "", http.StatusOK, &list)
+			if len(list.Flags) != 0 {
+				t.Errorf("Expected the purged flags to be gone, got %v", list.Flags)
+			}
+
+			doRequest(t, router, "DELETE", "/api/projects/web", "", http.StatusNoContent, nil)
+			ctx := context.Background()
+			if n, err := fm.purgeTrash(ctx, time.Now().Add(time.Hour)); err != nil || n != 0 {
+				t.Errorf("Expected no project purged within the retention, got %d, %v", n, err)
+			}
+			if n, err := fm.purgeTrash(ctx, time.Now().Add(25*time.Hour)); err != nil || n != 1 {
+				t.Errorf("Expected the project purged after the retention, got %d, %v", n, err)
+			}
+			if items := trash(); len(items) != 0 {
+				t.Errorf("Expected an empty trash, got %+v", items)
+			}
+		})
+	}
+
+	for _, action := range []string{"project.deleted", "project.restored", "project.purged"} {
+		events, err := store.ListAuditEvents(context.Background(), db.AuditFilterParams{PaginationParams: db.DefaultPagination(), Action: action})
+		if err != nil || events.Total == 0 {
+			t.Errorf("Expected %s audit events, got %v, %v", action, events, err)
+		}
+	}
+	if got := parseProjectTrashRetention("7d"); got != 7*24*time.Hour {
+		t.Errorf("Expected 7d retention, got %v", got)
+	}
+	if got := parseProjectTrashRetention("0"); got != 0 {
+		t.Errorf("Expected 0 to keep deleted projects, got %v", got)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// flagContentHash returns the SHA-256 of a flag config's JSON encoding. The
+// encoding is stable (struct fields in declaration order, map keys sorted), so
+// equal configs have equal hashes across reads, storage modes and replicas.
+func flagContentHash(config FlagConfig) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// upsertFlag handles the ?upsert=true cases of a flag update: a missing flag
+// is created and an unchanged one is returned as is, without a new version or
+// audit event. It reports whether it wrote the response; otherwise the update
+// proceeds as usual.
+func (fm *FlagManager) upsertFlag(w http.ResponseWriter, r *http.Request, project, flagKey string, config FlagConfig, newKey string) bool {
+	existing, err := fm.storage.GetFlag(r.Context(), project, flagKey)
+	if err != nil && !errors.Is(err, errFlagNotFound) && !errors.Is(err, errProjectNotFound) {
+		writeStorageError(w, err)
+		return true
+	}
+	if err != nil {
+		if newKey != "" {
+			writeValidationError(w, "INVALID_FLAG_KEY", "newKey cannot rename a flag that does not exist")
+			return true
+		}
+		if err := ValidateFlagKey(flagKey); err != nil {
+			writeValidationError(w, "INVALID_FLAG_KEY", err.Error())
+			return true
+		}
+		fm.createFlag(w, r, project, flagKey, config, map[string]interface{}{"upsert": true})
+		return true
+	}
+
+	if newKey != "" && newKey != flagKey {
+		return false
+	}
+	// Without a status the flag keeps its own, as in an update
+	if config.Status == "" {
+		config.Status = existing.Config.Status
+	}
+	if flagContentHash(config) != flagContentHash(existing.Config) {
+		return false
+	}
+	writeFlagResponse(w, r, existing.Key, existing.Config)
+	return true
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"flag-manager-api/db"
+)
+
+func TestFlagUpsert(t *testing.T) {
+	fm, _, cleanup := setupTestFlagManager(t)
+	defer cleanup()
+	router := setupTestRouter(fm)
+	auditEvents := func() int {
+		t.Helper()
+		var audit db.PaginatedResult[db.AuditEvent]
+		doRequest(t, router, "GET", "/api/audit", "", http.StatusOK, &audit)
+		return audit.Total
+	}
+
+	config := `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"off"},"metadata":{"team":"web","ticket":1}}}`
+	doRequest(t, router, "PUT", "/api/projects/web/flags/beta", config, http.StatusNotFound, nil)
+	doRequest(t, router, "PUT", "/api/projects/web/flags/beta?upsert=true", `{"config":{"variations":{"on":true}},"newKey":"gamma"}`, http.StatusBadRequest, nil)
+
+	var created, got, unchanged, updated FlagResponse
+	doRequest(t, router, "PUT", "/api/projects/web/flags/beta?upsert=true", config, http.StatusCreated, &created)
+	doRequest(t, router, "GET", "/api/projects/web/flags/beta", "", http.StatusOK, &got)
+	if created.ContentHash == "" || !strings.HasPrefix(created.ContentHash, "sha256:") || got.ContentHash != created.ContentHash {
+		t.Fatalf("Expected a stable content hash, got %q on create and %q on read", created.ContentHash, got.ContentHash)
+	}
+	events := auditEvents()
+
+	// Applying the same config again changes nothing
+	doRequest(t, router, "PUT", "/api/projects/web/flags/beta?upsert=true", config, http.StatusOK, &unchanged)
+	if unchanged.ContentHash != created.ContentHash || auditEvents() != events {
+		t.Fatalf("Expected an unchanged flag without an audit event, got %+v", unchanged)
+	}
+
+	doRequest(t, router, "PUT", "/api/projects/web/flags/beta?upsert=true", `{"config":{"variations":{"on":true,"off":false},"defaultRule":{"variation":"on"}}}`, http.StatusOK, &updated)
+	if updated.ContentHash == created.ContentHash || updated.Config.DefaultRule.Variation != "on" || auditEvents() != events+1 {
+		t.Fatalf("Expected the flag to be updated, got %+v", updated)
+	}
+
+	doRequest(t, router, "DELETE", "/api/projects/web/flags/beta?idempotent=true", "", http.StatusNoContent, nil)
+	doRequest(t, router, "DELETE", "/api/projects/web/flags/beta?idempotent=true", "", http.StatusNoContent, nil)
+	doRequest(t, router, "DELETE", "/api/projects/web/flags/beta", "", http.StatusNotFound, nil)
+	doRequest(t, router, "DELETE", "/api/projects/missing/flags/beta?idempotent=true", "", http.StatusNoContent, nil)
+
+	a, b := FlagConfig{Variations: map[string]interface{}{"a": 1, "b": 2.5}}, FlagConfig{Variations: map[string]interface{}{"b": 2.5, "a": float64(1)}}
+	if flagContentHash(a) != flagContentHash(b) {
+		t.Fatal("Expected equal configs to have the same content hash")
+	}
+}
@@ -1,35 +1,39 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 var (
-	flagKeyRegex   = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,127}$`)
-	projectRegex   = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
-	segmentRegex   = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+	flagKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,127}$`)
+	projectRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+	segmentRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+	envNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,31}$`)
+	tagRegex     = regexp.MustCompile(`^[a-z0-9][a-z0-9._:/-]{0,63}$`)
+
+	// Flag owners are teams, written @org/team as in CODEOWNERS files, and
+	// users, written as their user ID, email or @ID.
+	teamOwnerRegex = regexp.MustCompile(`^@[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}/[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+	userOwnerRegex = regexp.MustCompile(`^(@?[a-zA-Z0-9][^\s@/]{0,127}|[^\s@/]+@[^\s@/]+)$`)
 )
 
-// ValidationError represents a structured validation error.
-type ValidationError struct {
-	Error   string   `json:"error"`
-	Code    string   `json:"code"`
-	Details []string `json:"details,omitempty"`
-}
+// maxFlagTags is the number of tags a flag may carry.
+const maxFlagTags = 20
+
+// maxFlagOwners is the number of owners a flag may have.
+const maxFlagOwners = 20
+
+// maxFlagKeyLength is the longest key flagKeyRegex accepts.
+const maxFlagKeyLength = 128
 
-// writeValidationError sends a validation error response.
+// writeValidationError sends a 400 error response for invalid input.
 func writeValidationError(w http.ResponseWriter, code string, message string, details ...string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
-	json.NewEncoder(w).Encode(ValidationError{
-		Error:   message,
-		Code:    code,
-		Details: details,
-	})
+	writeError(w, http.StatusBadRequest, code, message, details...)
 }
 
 // ValidateFlagKey validates a flag key format.
@@ -43,6 +47,57 @@ func ValidateFlagKey(key string) error {
 	return nil
 }
 
+// ValidateFlagKeyConvention checks a flag key, which must already pass
+// ValidateFlagKey, against a project's naming rules. owners are the flag's
+// owners, whose team prefixes apply. rules may be nil.
+func ValidateFlagKeyConvention(key string, owners []string, rules *FlagNamingRules) []string {
+	if rules == nil {
+		return nil
+	}
+	var errs []string
+	if rules.MaxLength > 0 && len(key) > rules.MaxLength {
+		errs = append(errs, fmt.Sprintf("flag key must be at most %d characters", rules.MaxLength))
+	}
+	if rules.Pattern != "" {
+		if re, err := regexp.Compile(rules.Pattern); err == nil && !re.MatchString(key) {
+			errs = append(errs, "flag key must match pattern: "+rules.Pattern)
+		}
+	}
+	if len(rules.Prefixes) > 0 && !hasAnyPrefix(key, rules.Prefixes) {
+		errs = append(errs, "flag key must start with one of: "+strings.Join(rules.Prefixes, ", "))
+	}
+	// A flag owned by several teams may use the prefix of any of them
+	var teams, teamPrefixes []string
+	for _, owner := range owners {
+		if prefixes := rules.teamPrefixes(owner); len(prefixes) > 0 {
+			teams = append(teams, owner)
+			teamPrefixes = append(teamPrefixes, prefixes...)
+		}
+	}
+	if len(teams) > 0 && !hasAnyPrefix(key, teamPrefixes) {
+		errs = append(errs, fmt.Sprintf("flags owned by %s must start with one of: %s", strings.Join(teams, ", "), strings.Join(teamPrefixes, ", ")))
+	}
+	segments := strings.FieldsFunc(strings.ToLower(key), func(r rune) bool { return r == '.' || r == '_' || r == '-' })
+	for _, word := range rules.ReservedWords {
+		for _, segment := range segments {
+			if segment == strings.ToLower(word) {
+				errs = append(errs, fmt.Sprintf("flag key must not use the reserved word %q", word))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateProjectName validates a project name format.
 func ValidateProjectName(name string) error {
 	if name == "" {
@@ -54,6 +109,17 @@ func ValidateProjectName(name string) error {
 	return nil
 }
 
+// ValidateEnvironmentName validates a project environment name format.
+func ValidateEnvironmentName(name string) error {
+	if name == "" {
+		return fmt.Errorf("environment name is required")
+	}
+	if !envNameRegex.MatchString(name) {
+		return fmt.Errorf("environment name must match pattern: starts with alphanumeric, then alphanumeric/_- (max 32 chars)")
+	}
+	return nil
+}
+
 // ValidateSegmentName validates a segment name format.
 func ValidateSegmentName(name string) error {
 	if name == "" {
@@ -65,6 +131,28 @@ func ValidateSegmentName(name string) error {
 	return nil
 }
 
+// ValidateTag validates a flag tag format.
+func ValidateTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tag is required")
+	}
+	if !tagRegex.MatchString(tag) {
+		return fmt.Errorf("tag '%s' must match pattern: starts with lowercase alphanumeric, then lowercase alphanumeric/._:/- (max 64 chars)", tag)
+	}
+	return nil
+}
+
+// ValidateOwner validates a flag owner format.
+func ValidateOwner(owner string) error {
+	if owner == "" {
+		return fmt.Errorf("owner is required")
+	}
+	if !teamOwnerRegex.MatchString(owner) && !userOwnerRegex.MatchString(owner) {
+		return fmt.Errorf("owner '%s' must be a user ID, an email, @user or @org/team", owner)
+	}
+	return nil
+}
+
 // ValidateFlagConfig validates a flag configuration.
 func ValidateFlagConfig(config FlagConfig) []string {
 	var errors []string
@@ -78,20 +166,10 @@ func ValidateFlagConfig(config FlagConfig) []string {
 	if config.DefaultRule == nil {
 		errors = append(errors, "defaultRule is required")
 	} else {
-		// Default rule must reference a valid variation
-		if config.DefaultRule.Variation != "" {
-			if _, exists := config.Variations[config.DefaultRule.Variation]; !exists {
-				errors = append(errors, fmt.Sprintf("defaultRule variation '%s' not found in variations", config.DefaultRule.Variation))
-			}
-		}
-
 		// Validate percentage splits sum to 100
 		if len(config.DefaultRule.Percentage) > 0 {
 			var total float64
 			for varName, pct := range config.DefaultRule.Percentage {
-				if _, exists := config.Variations[varName]; !exists {
-					errors = append(errors, fmt.Sprintf("percentage references unknown variation '%s'", varName))
-				}
 				if pct < 0 {
 					errors = append(errors, fmt.Sprintf("percentage for '%s' cannot be negative", varName))
 				}
@@ -109,22 +187,11 @@ func ValidateFlagConfig(config FlagConfig) []string {
 			errors = append(errors, fmt.Sprintf("targeting rule #%d must have a query", i+1))
 		}
 
-		// Validate variation reference
-		if rule.Variation != "" {
-			if _, exists := config.Variations[rule.Variation]; !exists {
-				errors = append(errors, fmt.Sprintf("targeting rule #%d references unknown variation '%s'", i+1, rule.Variation))
-			}
-		}
-
 		// Validate percentage splits
 		if len(rule.Percentage) > 0 {
 			var total float64
-			for varName, pct := range rule.Percentage {
-				if _, exists := config.Variations[varName]; !exists {
-					errors = append(errors, fmt.Sprintf("targeting rule #%d percentage references unknown variation '%s'", i+1, varName))
-				}
+			for _, pct := range rule.Percentage {
 				total += pct
-				_ = pct
 			}
 			if total < 99.9 || total > 100.1 {
 				errors = append(errors, fmt.Sprintf("targeting rule #%d percentage splits must sum to 100 (got %.2f)", i+1, total))
@@ -132,6 +199,14 @@ func ValidateFlagConfig(config FlagConfig) []string {
 		}
 	}
 
+	// Every variation reference must point at a defined variation
+	if len(config.Variations) > 0 {
+		errors = append(errors, validateAllVariationReferences(config)...)
+	}
+
+	// Environment overrides must target defined variations
+	errors = append(errors, validateEnvironmentOverrides(config)...)
+
 	// Validate progressive rollout date ordering
 	if config.DefaultRule != nil && config.DefaultRule.ProgressiveRollout != nil {
 		pr := config.DefaultRule.ProgressiveRollout
@@ -142,6 +217,9 @@ func ValidateFlagConfig(config FlagConfig) []string {
 		}
 	}
 
+	// Scheduled rollout steps must use either absolute dates or relative delays
+	errors = append(errors, validateScheduledRolloutMode(config.ScheduledRollout)...)
+
 	// Validate scheduled rollout date ordering
 	if len(config.ScheduledRollout) > 1 {
 		for i := 1; i < len(config.ScheduledRollout); i++ {
@@ -153,6 +231,44 @@ func ValidateFlagConfig(config FlagConfig) []string {
 		}
 	}
 
+	if config.ExpiresAt != "" {
+		if _, err := time.Parse(time.RFC3339, config.ExpiresAt); err != nil {
+			errors = append(errors, "expiresAt must be an RFC 3339 timestamp")
+		}
+	}
+
+	if config.Status != "" && config.Status != flagStatusDraft && config.Status != flagStatusPublished {
+		errors = append(errors, "status must be draft or published")
+	}
+
+	if len(config.Tags) > maxFlagTags {
+		errors = append(errors, fmt.Sprintf("a flag can have at most %d tags (got %d)", maxFlagTags, len(config.Tags)))
+	}
+	seenTags := make(map[string]bool, len(config.Tags))
+	for _, tag := range config.Tags {
+		if err := ValidateTag(tag); err != nil {
+			errors = append(errors, err.Error())
+		} else if seenTags[tag] {
+			errors = append(errors, fmt.Sprintf("duplicate tag '%s'", tag))
+		}
+		seenTags[tag] = true
+	}
+
+	if len(config.Owners) > maxFlagOwners {
+		errors = append(errors, fmt.Sprintf("a flag can have at most %d owners (got %d)", maxFlagOwners, len(config.Owners)))
+	}
+	seenOwners := make(map[string]bool, len(config.Owners))
+	for _, owner := range config.Owners {
+		if err := ValidateOwner(owner); err != nil {
+			errors = append(errors, err.Error())
+		} else if seenOwners[normalizeOwner(owner)] {
+			errors = append(errors, fmt.Sprintf("duplicate owner '%s'", owner))
+		}
+		seenOwners[normalizeOwner(owner)] = true
+	}
+
+	errors = append(errors, validateRamp(config)...)
+
 	// Validate experimentation dates
 	if config.Experimentation != nil {
 		if config.Experimentation.Start != "" && config.Experimentation.End != "" {
@@ -164,3 +280,102 @@ func ValidateFlagConfig(config FlagConfig) []string {
 
 	return errors
 }
+
+// validateAllVariationReferences walks every place a flag config can name a
+// variation (default rule, targeting rules, progressive rollouts and scheduled
+// rollout steps) and reports each reference missing from Variations with its path,
+// e.g. "scheduledRollout[0].targeting[1].variation".
+func validateAllVariationReferences(config FlagConfig) []string {
+	var errors []string
+
+	check := func(path, variation string) {
+		if variation == "" {
+			return
+		}
+		if _, exists := config.Variations[variation]; !exists {
+			errors = append(errors, fmt.Sprintf("%s references unknown variation '%s'", path, variation))
+		}
+	}
+
+	checkPercentage := func(path string, percentage map[string]float64) {
+		keys := make([]string, 0, len(percentage))
+		for varName := range percentage {
+			keys = append(keys, varName)
+		}
+		sort.Strings(keys)
+		for _, varName := range keys {
+			check(path+".percentage."+varName, varName)
+		}
+	}
+
+	checkProgressive := func(path string, pr *ProgressiveRollout) {
+		if pr == nil {
+			return
+		}
+		if pr.Initial != nil {
+			check(path+".progressiveRollout.initial.variation", pr.Initial.Variation)
+		}
+		if pr.End != nil {
+			check(path+".progressiveRollout.end.variation", pr.End.Variation)
+		}
+	}
+
+	checkDefaultRule := func(path string, rule *DefaultRule) {
+		if rule == nil {
+			return
+		}
+		check(path+".variation", rule.Variation)
+		checkPercentage(path, rule.Percentage)
+		checkProgressive(path, rule.ProgressiveRollout)
+	}
+
+	checkTargeting := func(path string, rules []TargetingRule) {
+		for i, rule := range rules {
+			rulePath := fmt.Sprintf("%s[%d]", path, i)
+			check(rulePath+".variation", rule.Variation)
+			checkPercentage(rulePath, rule.Percentage)
+			checkProgressive(rulePath, rule.ProgressiveRollout)
+		}
+	}
+
+	checkDefaultRule("defaultRule", config.DefaultRule)
+	checkTargeting("targeting", config.Targeting)
+	for i, step := range config.ScheduledRollout {
+		stepPath := fmt.Sprintf("scheduledRollout[%d]", i)
+		checkDefaultRule(stepPath+".defaultRule", step.DefaultRule)
+		checkTargeting(stepPath+".targeting", step.Targeting)
+	}
+
+	return errors
+}
+
+// validateScheduledRolloutMode rejects scheduled rollouts that mix absolute
+// `date` steps with relative `after` steps, either within one step or across the
+// rollout, since the resulting order would be ambiguous.
+func validateScheduledRolloutMode(steps []ScheduledStep) []string {
+	var errors []string
+	absolute, relative := 0, 0
+
+	for i, step := range steps {
+		if step.Date != "" && step.After != "" {
+			errors = append(errors, fmt.Sprintf("scheduled rollout step #%d cannot set both date and after", i+1))
+			continue
+		}
+		if step.After != "" {
+			if delay, err := parseDuration(step.After); err != nil {
+				errors = append(errors, fmt.Sprintf("scheduled rollout step #%d after: %v", i+1, err))
+			} else if delay <= 0 {
+				errors = append(errors, fmt.Sprintf("scheduled rollout step #%d after must be positive", i+1))
+			}
+			relative++
+		} else if step.Date != "" {
+			absolute++
+		}
+	}
+
+	if absolute > 0 && relative > 0 {
+		errors = append(errors, "scheduled rollout cannot mix absolute dates with relative after delays")
+	}
+
+	return errors
+}
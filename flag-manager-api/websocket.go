@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsMaxMessageSize bounds client messages; clients only send subscriptions.
+const wsMaxMessageSize = 64 << 10
+
+// upgradeWebSocket completes the opening handshake and takes over the
+// connection. On failure an HTTP error has already been written.
+func (fm *FlagManager) upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeError(w, http.StatusUpgradeRequired, "UPGRADE_REQUIRED", "WebSocket upgrade required")
+		return nil, errors.New("not a websocket upgrade request")
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: fm.webSocketOriginAllowed,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			code := "BAD_REQUEST"
+			if status == http.StatusForbidden {
+				code = "FORBIDDEN"
+			}
+			writeError(w, status, code, reason.Error())
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(wsMaxMessageSize)
+	return conn, nil
+}
+
+// webSocketOriginAllowed reports whether a browser on the Origin of r may
+// open a WebSocket: the API's own origin or one the API's CORS policy allows.
+// Browsers send cookies and ?access_token= URLs cross-site without CORS
+// checks, so WebSockets must check the origin themselves. Requests without
+// an Origin do not come from a browser.
+func (fm *FlagManager) webSocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return fm.config.CORS.API.allowedOrigin(origin) != ""
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Baseline is the set of flag keys already known when code scanning was
+// enabled, whose call sites are not reported.
+type Baseline map[string]bool
+
+// LoadBaseline reads a baseline from a manifest written by an earlier scan,
+// in YAML or JSON.
+func LoadBaseline(path string) (Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", path, err)
+	}
+	baseline := make(Baseline, len(m.Flags))
+	for _, f := range m.Flags {
+		baseline[f.Key] = true
+	}
+	return baseline, nil
+}
+
+// Filter returns the flags not in the baseline.
+func (b Baseline) Filter(flags []DiscoveredFlag) []DiscoveredFlag {
+	var unknown []DiscoveredFlag
+	for _, f := range flags {
+		if !b[f.Key] {
+			unknown = append(unknown, f)
+		}
+	}
+	return unknown
+}
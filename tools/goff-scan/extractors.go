@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// Extractor finds flag evaluation calls in the source files of one language.
+type Extractor struct {
+	Language   string
+	Extensions []string
+	Patterns   []FlagPattern
+
+	// comments blanks out comments so that commented-out calls are skipped
+	comments commentSyntax
+}
+
+// Match is a flag evaluation call an Extractor found in a file.
+type Match struct {
+	Key    string
+	Type   FlagType
+	Call   string // the SDK function, e.g. getBooleanValue
+	Line   int
+	Column int
+}
+
+// commentSyntax describes the comments and string literals of a language.
+type commentSyntax struct {
+	line   string // starts a comment running to the end of the line
+	block  bool   // /* */ comments
+	quotes string // string delimiters, whose contents are never comments
+}
+
+var (
+	cComments    = commentSyntax{line: "//", block: true, quotes: `"'`}
+	jsComments   = commentSyntax{line: "//", block: true, quotes: "\"'`"} // also Go, for raw strings
+	hashComments = commentSyntax{line: "#", quotes: `"'`}
+)
+
+// extractors returns the extractors of every supported language.
+func extractors() []*Extractor {
+	return []*Extractor{
+		{Language: "go", Extensions: []string{".go"}, Patterns: compilePatterns(goPatterns), comments: jsComments},
+		{Language: "javascript", Extensions: []string{".js", ".jsx", ".mjs", ".cjs"}, Patterns: compilePatterns(jsPatterns), comments: jsComments},
+		{Language: "typescript", Extensions: []string{".ts", ".tsx", ".mts", ".cts"}, Patterns: compilePatterns(jsPatterns), comments: jsComments},
+		{Language: "python", Extensions: []string{".py"}, Patterns: compilePatterns(pythonPatterns), comments: hashComments},
+		{Language: "java", Extensions: []string{".java"}, Patterns: compilePatterns(clientPatterns), comments: cComments},
+		{Language: "kotlin", Extensions: []string{".kt"}, Patterns: compilePatterns(clientPatterns), comments: cComments},
+		{Language: "swift", Extensions: []string{".swift"}, Patterns: compilePatterns(clientPatterns), comments: cComments},
+		{Language: "csharp", Extensions: []string{".cs"}, Patterns: compilePatterns(dotnetPatterns), comments: cComments},
+		{Language: "ruby", Extensions: []string{".rb"}, Patterns: compilePatterns(rubyPatterns), comments: hashComments},
+		{Language: "php", Extensions: []string{".php"}, Patterns: compilePatterns(clientPatterns), comments: cComments},
+	}
+}
+
+// Extract returns the flag evaluation calls in a file's source, in order.
+// Calls may span several lines; commented-out calls are skipped.
+func (e *Extractor) Extract(src []byte) []Match {
+	code := e.comments.blank(src)
+
+	type position struct {
+		offset int
+		key    string
+	}
+	seen := make(map[position]bool)
+	var matches []Match
+	for _, p := range e.Patterns {
+		for _, loc := range p.Regex.FindAllSubmatchIndex(code, -1) {
+			if loc[2] < 0 {
+				continue
+			}
+			key := string(code[loc[2]:loc[3]])
+			call, callOffset := callName(code[loc[0]:loc[1]])
+			offset := loc[0] + callOffset
+			if seen[position{offset, key}] {
+				continue
+			}
+			seen[position{offset, key}] = true
+
+			typ := p.Type
+			if typ == "" {
+				defaultValue := ""
+				if len(loc) > 4 && loc[4] >= 0 {
+					defaultValue = string(code[loc[4]:loc[5]])
+				}
+				typ = inferFlagType(defaultValue)
+			}
+			line, column := lineColumn(code, offset)
+			matches = append(matches, Match{Key: key, Type: typ, Call: call, Line: line, Column: column})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Line != matches[j].Line {
+			return matches[i].Line < matches[j].Line
+		}
+		return matches[i].Column < matches[j].Column
+	})
+	return matches
+}
+
+// callName returns the name of the function a pattern match calls and its
+// offset in the match: the identifier before the first parenthesis.
+func callName(match []byte) (string, int) {
+	end := bytes.IndexByte(match, '(')
+	if end < 0 {
+		end = len(match)
+	}
+	start := bytes.LastIndexAny(match[:end], ".@ \t\n") + 1
+	return string(match[start:end]), start
+}
+
+// lineColumn returns the 1-based line and column of an offset.
+func lineColumn(src []byte, offset int) (int, int) {
+	line := bytes.Count(src[:offset], []byte("\n")) + 1
+	column := offset - (bytes.LastIndexByte(src[:offset], '\n') + 1) + 1
+	return line, column
+}
+
+// blank returns src with its comments replaced by spaces. Newlines are kept,
+// so that offsets, lines and columns are those of src.
+func (c commentSyntax) blank(src []byte) []byte {
+	out := make([]byte, len(src))
+	copy(out, src)
+
+	for i := 0; i < len(out); {
+		switch {
+		case strings.IndexByte(c.quotes, out[i]) >= 0:
+			i = skipString(out, i)
+		case c.line != "" && bytes.HasPrefix(out[i:], []byte(c.line)):
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c.block && bytes.HasPrefix(out[i:], []byte("/*")):
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			stop := len(out)
+			if end >= 0 {
+				stop = i + 2 + end + 2
+			}
+			for ; i < stop; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+		default:
+			i++
+		}
+	}
+	return out
+}
+
+// skipString returns the offset just past the string literal starting at i,
+// which may be tripled ("""...""") as in Python, Kotlin and Swift. Strings
+// that are not closed end at the end of the line.
+func skipString(src []byte, i int) int {
+	quote := src[i]
+	triple := []byte{quote, quote, quote}
+	if bytes.HasPrefix(src[i:], triple) {
+		if end := bytes.Index(src[i+3:], triple); end >= 0 {
+			return i + 3 + end + 3
+		}
+		return len(src)
+	}
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		case '\n':
+			if quote != '`' {
+				return j
+			}
+		}
+	}
+	return len(src)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func extractorFor(t *testing.T, language string) *Extractor {
+	t.Helper()
+	for _, e := range extractors() {
+		if e.Language == language {
+			return e
+		}
+	}
+	t.Fatalf("no extractor for %s", language)
+	return nil
+}
+
+func TestExtractJavaScript(t *testing.T) {
+	src := `const a = await client.getBooleanValue(
+  'multi-line',
+  false,
+);
+const b = client.getStringValue(` + "`template-key`" + `, 'x');
+const c = client.getStringValue(` + "`prefix-${name}`" + `, 'x');
+// const d = client.getBooleanValue('commented-out', false);
+/* client.getBooleanValue('block-comment', false) */
+const url = "http://example.com"; const e = useFlag('inferred-string', "on");
+const f = useFlag('inferred-object', [1, 2]);
+const g = useFlag('inferred-number', -1.5);
+const h = useFlag('unknown-default', fallback);
+`
+	matches := extractorFor(t, "javascript").Extract([]byte(src))
+
+	want := []Match{
+		{Key: "multi-line", Type: FlagTypeBoolean, Call: "getBooleanValue", Line: 1, Column: 24},
+		{Key: "template-key", Type: FlagTypeString, Call: "getStringValue", Line: 5, Column: 18},
+		{Key: "inferred-string", Type: FlagTypeString, Call: "useFlag", Line: 9, Column: 45},
+		{Key: "inferred-object", Type: FlagTypeObject, Call: "useFlag", Line: 10, Column: 11},
+		{Key: "inferred-number", Type: FlagTypeNumber, Call: "useFlag", Line: 11, Column: 11},
+		{Key: "unknown-default", Type: FlagTypeBoolean, Call: "useFlag", Line: 12, Column: 11},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("expected %d matches, got %d: %+v", len(want), len(matches), matches)
+	}
+	for i, m := range matches {
+		if m != want[i] {
+			t.Errorf("match %d: got %+v, want %+v", i, m, want[i])
+		}
+	}
+}
+
+func TestExtractPython(t *testing.T) {
+	src := `flag = client.get_boolean_value(
+    flag_key="keyword-first",
+    default_value=False,
+)
+size = await client.get_integer_value_async(default_value=1, flag_key='keyword-later')
+details = client.get_object_details("details-flag", {})
+# client.get_boolean_value("commented-out", False)
+label = client.get_string_value("hash-in-string", "#1")
+`
+	matches := extractorFor(t, "python").Extract([]byte(src))
+
+	want := []Match{
+		{Key: "keyword-first", Type: FlagTypeBoolean, Call: "get_boolean_value", Line: 1, Column: 15},
+		{Key: "keyword-later", Type: FlagTypeNumber, Call: "get_integer_value_async", Line: 5, Column: 21},
+		{Key: "details-flag", Type: FlagTypeObject, Call: "get_object_details", Line: 6, Column: 18},
+		{Key: "hash-in-string", Type: FlagTypeString, Call: "get_string_value", Line: 8, Column: 16},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("expected %d matches, got %d: %+v", len(want), len(matches), matches)
+	}
+	for i, m := range matches {
+		if m != want[i] {
+			t.Errorf("match %d: got %+v, want %+v", i, m, want[i])
+		}
+	}
+}
+
+func TestExtractorsPerLanguage(t *testing.T) {
+	// Python calls in a JS file, or JS calls in a Python file, are not flags
+	if m := extractorFor(t, "javascript").Extract([]byte(`client.get_boolean_value("py-flag", False)`)); len(m) != 0 {
+		t.Errorf("expected no JS matches for a Python call, got %+v", m)
+	}
+	if m := extractorFor(t, "python").Extract([]byte(`client.getBooleanValue("js-flag", false)`)); len(m) != 0 {
+		t.Errorf("expected no Python matches for a JS call, got %+v", m)
+	}
+}
+
+func TestScanFixtureRepos(t *testing.T) {
+	tests := []struct {
+		repo     string
+		expected map[string]FlagType
+		missing  []string
+		site     CallSite // a call site of one of the flags
+	}{
+		{
+			repo: "testdata/js-app",
+			expected: map[string]FlagType{
+				"one-click-checkout": FlagTypeBoolean,
+				"default-currency":   FlagTypeString,
+				"payment-retries":    FlagTypeNumber,
+				"cart-limit":         FlagTypeNumber,
+				"new-message":        FlagTypeBoolean,
+				"hero-variant":       FlagTypeString,
+				"pricing-table":      FlagTypeObject,
+				"max-results":        FlagTypeNumber,
+				"nest-welcome":       FlagTypeBoolean,
+			},
+			missing: []string{"legacy-checkout", "legacy-currency", "vendored-flag"},
+			site:    CallSite{File: "src/checkout.ts", Line: 8, Column: 32, Language: "typescript", Call: "getBooleanValue", Type: FlagTypeBoolean},
+		},
+		{
+			repo: "testdata/python-app",
+			expected: map[string]FlagType{
+				"admin-panel":     FlagTypeBoolean,
+				"admin-banner":    FlagTypeString,
+				"batch-size":      FlagTypeNumber,
+				"ranking-weights": FlagTypeObject,
+				"sampling-rate":   FlagTypeNumber,
+			},
+			missing: []string{"legacy-admin"},
+			site:    CallSite{File: "app/jobs.py", Line: 5, Column: 25, Language: "python", Call: "get_integer_value_async", Type: FlagTypeNumber},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			flags, err := NewScanner([]string{"node_modules"}).Scan(tt.repo)
+			if err != nil {
+				t.Fatalf("Scan failed: %v", err)
+			}
+			found := make(map[string]DiscoveredFlag)
+			for _, f := range flags {
+				found[f.Key] = f
+			}
+			if len(found) != len(tt.expected) {
+				t.Errorf("expected %d flags, got %d: %+v", len(tt.expected), len(found), flags)
+			}
+			for key, typ := range tt.expected {
+				f, ok := found[key]
+				if !ok {
+					t.Errorf("expected flag %q to be discovered", key)
+					continue
+				}
+				if f.Type != typ {
+					t.Errorf("flag %q: got type %q, want %q", key, f.Type, typ)
+				}
+				if len(f.CallSites) == 0 || len(f.Languages) != 1 || f.Languages[0] != f.CallSites[0].Language {
+					t.Errorf("flag %q: expected call sites and their language, got %+v", key, f)
+				}
+			}
+			for _, key := range tt.missing {
+				if _, ok := found[key]; ok {
+					t.Errorf("expected flag %q not to be discovered", key)
+				}
+			}
+
+			siteFound := false
+			for _, f := range flags {
+				for _, site := range f.CallSites {
+					siteFound = siteFound || site == tt.site
+				}
+			}
+			if !siteFound {
+				t.Errorf("expected call site %+v", tt.site)
+			}
+		})
+	}
+}
+
+func TestScanCallSitesAcrossLanguages(t *testing.T) {
+	flags, err := NewScanner([]string{"node_modules"}).Scan("testdata")
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	for _, f := range flags {
+		if f.Key != "dark-mode" {
+			continue
+		}
+		// dark-mode is evaluated in sample.go, sample.py and sample.tsx
+		if len(f.Languages) != 3 || len(f.CallSites) < 3 {
+			t.Errorf("expected dark-mode in 3 languages, got %+v", f)
+		}
+		if f.Source != fmt.Sprintf("%s:%d", f.CallSites[0].File, f.CallSites[0].Line) {
+			t.Errorf("expected the source to be the first call site, got %s", f.Source)
+		}
+		return
+	}
+	t.Fatal("expected dark-mode to be discovered")
+}
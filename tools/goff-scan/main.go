@@ -3,17 +3,22 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 func main() {
 	project := flag.String("project", "", "Project name for discovered flags (default: directory basename)")
 	output := flag.String("output", "", "Output file path (default: stdout)")
-	format := flag.String("format", "yaml", "Output format: yaml or json")
+	format := flag.String("format", "yaml", "Output format: yaml, json or sarif")
 	excludeStr := flag.String("exclude", "node_modules,vendor,.git,dist,build", "Comma-separated exclude globs")
 	version := flag.String("version", "", "App version to embed in manifest")
+	pushURL := flag.String("push-url", "", "Manager API base URL to push the manifest to, creating the project and new flags")
+	apiKey := flag.String("api-key", os.Getenv("GOFF_API_KEY"), "Manager API key for --push-url (default: $GOFF_API_KEY)")
+	baselinePath := flag.String("baseline", "", "Manifest of known flags not to report with -format sarif")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: goff-scan [flags] <directory>\n\nScans source code for feature flag evaluation calls and produces a manifest.\n\nFlags:\n")
@@ -40,6 +45,18 @@ func main() {
 		projectName = filepath.Base(absDir)
 	}
 
+	var baseline Baseline
+	if *baselinePath != "" {
+		if *format != "sarif" {
+			fmt.Fprintf(os.Stderr, "Error: --baseline requires -format sarif\n")
+			os.Exit(1)
+		}
+		if baseline, err = LoadBaseline(*baselinePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	excludes := strings.Split(*excludeStr, ",")
 	for i := range excludes {
 		excludes[i] = strings.TrimSpace(excludes[i])
@@ -60,8 +77,12 @@ func main() {
 		data, err = manifest.ToJSON()
 	case "yaml":
 		data, err = manifest.ToYAML()
+	case "sarif":
+		// The manifest is still pushed whole, the baseline only hides
+		// known flags from the report
+		data, err = NewSARIF(baseline.Filter(flags)).ToJSON()
 	default:
-		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use yaml or json)\n", *format)
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q (use yaml, json or sarif)\n", *format)
 		os.Exit(1)
 	}
 	if err != nil {
@@ -75,7 +96,23 @@ func main() {
 			os.Exit(1)
 		}
 		fmt.Fprintf(os.Stderr, "Wrote %d flags to %s\n", len(flags), *output)
-	} else {
+	} else if *pushURL == "" {
 		os.Stdout.Write(data)
 	}
+
+	if *pushURL != "" {
+		if len(flags) == 0 {
+			fmt.Fprintf(os.Stderr, "No flags found, nothing to push\n")
+			return
+		}
+		result, err := pushManifest(&http.Client{Timeout: 30 * time.Second}, *pushURL, *apiKey, manifest)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error pushing manifest: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprint(os.Stderr, result.Summary(projectName))
+		if len(result.Errors) > 0 {
+			os.Exit(1)
+		}
+	}
 }
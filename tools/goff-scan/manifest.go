@@ -16,9 +16,21 @@ type Manifest struct {
 
 // DiscoveredFlag represents a flag found during scanning.
 type DiscoveredFlag struct {
-	Key    string   `json:"key" yaml:"key"`
-	Type   FlagType `json:"type" yaml:"type"`
-	Source string   `json:"source" yaml:"source"`
+	Key       string     `json:"key" yaml:"key"`
+	Type      FlagType   `json:"type" yaml:"type"`
+	Source    string     `json:"source" yaml:"source"`
+	Languages []string   `json:"languages,omitempty" yaml:"languages,omitempty"`
+	CallSites []CallSite `json:"callSites,omitempty" yaml:"callSites,omitempty"`
+}
+
+// CallSite is a place in the source code where a flag is evaluated.
+type CallSite struct {
+	File     string   `json:"file" yaml:"file"`
+	Line     int      `json:"line" yaml:"line"`
+	Column   int      `json:"column" yaml:"column"`
+	Language string   `json:"language" yaml:"language"`
+	Call     string   `json:"call" yaml:"call"` // SDK function, e.g. getBooleanValue
+	Type     FlagType `json:"type" yaml:"type"` // type the call evaluates the flag as
 }
 
 // ManifestMetadata holds metadata about the scan run.
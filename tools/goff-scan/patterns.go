@@ -15,95 +15,155 @@ const (
 // FlagPattern maps a compiled regex to its flag type.
 type FlagPattern struct {
 	Regex *regexp.Regexp
-	Type  FlagType
+	// Type is the type of the flags the pattern finds. When empty, it is
+	// inferred from the default value literal captured in group 2.
+	Type FlagType
+}
+
+type rawPattern struct {
+	pattern string
+	typ     FlagType
+}
+
+// goPatterns match the go-feature-flag Go module and the Go OpenFeature SDK.
+var goPatterns = []rawPattern{
+	// =====================================================================
+	// Go: go-feature-flag (ffclient)
+	// =====================================================================
+	{`BoolVariation\(\s*"([^"]+)"`, FlagTypeBoolean},
+	{`StringVariation\(\s*"([^"]+)"`, FlagTypeString},
+	{`IntVariation\(\s*"([^"]+)"`, FlagTypeNumber},
+	{`Float64Variation\(\s*"([^"]+)"`, FlagTypeNumber},
+	{`JSONVariation\(\s*"([^"]+)"`, FlagTypeObject},
+	{`JSONArrayVariation\(\s*"([^"]+)"`, FlagTypeObject},
+
+	// =====================================================================
+	// Go: OpenFeature SDK
+	// =====================================================================
+	{`\.BooleanValue\([^,]*,\s*"([^"]+)"`, FlagTypeBoolean},
+	{`\.StringValue\([^,]*,\s*"([^"]+)"`, FlagTypeString},
+	{`\.FloatValue\([^,]*,\s*"([^"]+)"`, FlagTypeNumber},
+	{`\.IntValue\([^,]*,\s*"([^"]+)"`, FlagTypeNumber},
+	{`\.ObjectValue\([^,]*,\s*"([^"]+)"`, FlagTypeObject},
+}
+
+// clientPatterns match the OpenFeature client of the JS/TS, Java, Kotlin and
+// Swift SDKs. Matches both "double" and 'single' quoted keys.
+var clientPatterns = []rawPattern{
+	{`\.getBooleanValue\(\s*["']([^"']+)["']`, FlagTypeBoolean},
+	{`\.getStringValue\(\s*["']([^"']+)["']`, FlagTypeString},
+	{`\.getNumberValue\(\s*["']([^"']+)["']`, FlagTypeNumber},
+	{`\.getObjectValue\(\s*["']([^"']+)["']`, FlagTypeObject},
+
+	// Also match Detail variants
+	{`\.getBooleanDetails\(\s*["']([^"']+)["']`, FlagTypeBoolean},
+	{`\.getStringDetails\(\s*["']([^"']+)["']`, FlagTypeString},
+	{`\.getNumberDetails\(\s*["']([^"']+)["']`, FlagTypeNumber},
+	{`\.getObjectDetails\(\s*["']([^"']+)["']`, FlagTypeObject},
+}
+
+// jsPatterns match the JS/TS OpenFeature SDKs, which the go-feature-flag
+// server and web providers plug into: the client, the React hooks and the
+// NestJS decorators. Keys may also be template literals without
+// substitutions.
+var jsPatterns = append(append([]rawPattern{}, clientPatterns...), []rawPattern{
+	{"\\.getBooleanValue\\(\\s*`([^`$]+)`", FlagTypeBoolean},
+	{"\\.getStringValue\\(\\s*`([^`$]+)`", FlagTypeString},
+	{"\\.getNumberValue\\(\\s*`([^`$]+)`", FlagTypeNumber},
+	{"\\.getObjectValue\\(\\s*`([^`$]+)`", FlagTypeObject},
+
+	// =====================================================================
+	// React hooks (OpenFeature React SDK)
+	// =====================================================================
+	{`useBooleanFlagValue\(\s*["']([^"']+)["']`, FlagTypeBoolean},
+	{`useStringFlagValue\(\s*["']([^"']+)["']`, FlagTypeString},
+	{`useNumberFlagValue\(\s*["']([^"']+)["']`, FlagTypeNumber},
+	{`useObjectFlagValue\(\s*["']([^"']+)["']`, FlagTypeObject},
+	{`useBooleanFlagDetails\(\s*["']([^"']+)["']`, FlagTypeBoolean},
+	{`useStringFlagDetails\(\s*["']([^"']+)["']`, FlagTypeString},
+	{`useNumberFlagDetails\(\s*["']([^"']+)["']`, FlagTypeNumber},
+	{`useObjectFlagDetails\(\s*["']([^"']+)["']`, FlagTypeObject},
+
+	// useFlag and useSuspenseFlag take their type from the default value
+	{`\buse(?:Suspense)?Flag\(\s*["'` + "`" + `]([^"'` + "`" + `$]+)["'` + "`" + `](?:\s*,\s*(true|false|-?\.?[0-9]|["'` + "`" + `{\[]))?`, ""},
+
+	// =====================================================================
+	// NestJS decorators (OpenFeature NestJS SDK)
+	// =====================================================================
+	{`@BooleanFeatureFlag\(\s*\{[^}]*?\bflagKey\s*:\s*["']([^"']+)["']`, FlagTypeBoolean},
+	{`@StringFeatureFlag\(\s*\{[^}]*?\bflagKey\s*:\s*["']([^"']+)["']`, FlagTypeString},
+	{`@NumberFeatureFlag\(\s*\{[^}]*?\bflagKey\s*:\s*["']([^"']+)["']`, FlagTypeNumber},
+	{`@ObjectFeatureFlag\(\s*\{[^}]*?\bflagKey\s*:\s*["']([^"']+)["']`, FlagTypeObject},
+}...)
+
+// pythonPatterns match the Python OpenFeature SDK, which the go-feature-flag
+// provider plugs into, with the key passed first or as flag_key=.
+var pythonPatterns = []rawPattern{
+	{`\.get_boolean_(?:value|details)(?:_async)?\(\s*(?:flag_key\s*=\s*)?["']([^"']+)["']`, FlagTypeBoolean},
+	{`\.get_string_(?:value|details)(?:_async)?\(\s*(?:flag_key\s*=\s*)?["']([^"']+)["']`, FlagTypeString},
+	{`\.get_float_(?:value|details)(?:_async)?\(\s*(?:flag_key\s*=\s*)?["']([^"']+)["']`, FlagTypeNumber},
+	{`\.get_integer_(?:value|details)(?:_async)?\(\s*(?:flag_key\s*=\s*)?["']([^"']+)["']`, FlagTypeNumber},
+	{`\.get_object_(?:value|details)(?:_async)?\(\s*(?:flag_key\s*=\s*)?["']([^"']+)["']`, FlagTypeObject},
+
+	// flag_key= after other keyword arguments
+	{`\.get_boolean_(?:value|details)(?:_async)?\([^)]*?[,(]\s*flag_key\s*=\s*["']([^"']+)["']`, FlagTypeBoolean},
+	{`\.get_string_(?:value|details)(?:_async)?\([^)]*?[,(]\s*flag_key\s*=\s*["']([^"']+)["']`, FlagTypeString},
+	{`\.get_float_(?:value|details)(?:_async)?\([^)]*?[,(]\s*flag_key\s*=\s*["']([^"']+)["']`, FlagTypeNumber},
+	{`\.get_integer_(?:value|details)(?:_async)?\([^)]*?[,(]\s*flag_key\s*=\s*["']([^"']+)["']`, FlagTypeNumber},
+	{`\.get_object_(?:value|details)(?:_async)?\([^)]*?[,(]\s*flag_key\s*=\s*["']([^"']+)["']`, FlagTypeObject},
+}
+
+// dotnetPatterns match the .NET OpenFeature SDK.
+var dotnetPatterns = []rawPattern{
+	{`\.GetBooleanValueAsync\(\s*"([^"]+)"`, FlagTypeBoolean},
+	{`\.GetStringValueAsync\(\s*"([^"]+)"`, FlagTypeString},
+	{`\.GetDoubleValueAsync\(\s*"([^"]+)"`, FlagTypeNumber},
+	{`\.GetIntegerValueAsync\(\s*"([^"]+)"`, FlagTypeNumber},
+	{`\.GetObjectValueAsync\(\s*"([^"]+)"`, FlagTypeObject},
+}
+
+// rubyPatterns match the Ruby OpenFeature SDK.
+var rubyPatterns = []rawPattern{
+	{`\.fetch_boolean_value\(\s*["']([^"']+)["']`, FlagTypeBoolean},
+	{`\.fetch_string_value\(\s*["']([^"']+)["']`, FlagTypeString},
+	{`\.fetch_number_value\(\s*["']([^"']+)["']`, FlagTypeNumber},
+	{`\.fetch_object_value\(\s*["']([^"']+)["']`, FlagTypeObject},
+}
+
+// compilePatterns compiles raw patterns. Each regex captures the flag key in
+// group 1.
+func compilePatterns(raw ...[]rawPattern) []FlagPattern {
+	var patterns []FlagPattern
+	for _, set := range raw {
+		for _, r := range set {
+			patterns = append(patterns, FlagPattern{
+				Regex: regexp.MustCompile(r.pattern),
+				Type:  r.typ,
+			})
+		}
+	}
+	return patterns
 }
 
 // allPatterns returns all compiled flag evaluation patterns across OpenFeature SDKs.
 // Each regex captures the flag key in group 1.
 func allPatterns() []FlagPattern {
-	raw := []struct {
-		pattern string
-		typ     FlagType
-	}{
-		// =====================================================================
-		// Go: go-feature-flag (ffclient)
-		// =====================================================================
-		{`BoolVariation\(\s*"([^"]+)"`, FlagTypeBoolean},
-		{`StringVariation\(\s*"([^"]+)"`, FlagTypeString},
-		{`IntVariation\(\s*"([^"]+)"`, FlagTypeNumber},
-		{`Float64Variation\(\s*"([^"]+)"`, FlagTypeNumber},
-		{`JSONVariation\(\s*"([^"]+)"`, FlagTypeObject},
-		{`JSONArrayVariation\(\s*"([^"]+)"`, FlagTypeObject},
-
-		// =====================================================================
-		// Go: OpenFeature SDK
-		// =====================================================================
-		{`\.BooleanValue\([^,]*,\s*"([^"]+)"`, FlagTypeBoolean},
-		{`\.StringValue\([^,]*,\s*"([^"]+)"`, FlagTypeString},
-		{`\.FloatValue\([^,]*,\s*"([^"]+)"`, FlagTypeNumber},
-		{`\.IntValue\([^,]*,\s*"([^"]+)"`, FlagTypeNumber},
-		{`\.ObjectValue\([^,]*,\s*"([^"]+)"`, FlagTypeObject},
-
-		// =====================================================================
-		// JS/TS/Java/Kotlin/Swift: OpenFeature SDK
-		// Matches both "double" and 'single' quoted keys
-		// =====================================================================
-		{`\.getBooleanValue\(\s*["']([^"']+)["']`, FlagTypeBoolean},
-		{`\.getStringValue\(\s*["']([^"']+)["']`, FlagTypeString},
-		{`\.getNumberValue\(\s*["']([^"']+)["']`, FlagTypeNumber},
-		{`\.getObjectValue\(\s*["']([^"']+)["']`, FlagTypeObject},
-
-		// Also match Detail variants
-		{`\.getBooleanDetails\(\s*["']([^"']+)["']`, FlagTypeBoolean},
-		{`\.getStringDetails\(\s*["']([^"']+)["']`, FlagTypeString},
-		{`\.getNumberDetails\(\s*["']([^"']+)["']`, FlagTypeNumber},
-		{`\.getObjectDetails\(\s*["']([^"']+)["']`, FlagTypeObject},
-
-		// =====================================================================
-		// React hooks (OpenFeature React SDK)
-		// =====================================================================
-		{`useBooleanFlagValue\(\s*["']([^"']+)["']`, FlagTypeBoolean},
-		{`useStringFlagValue\(\s*["']([^"']+)["']`, FlagTypeString},
-		{`useNumberFlagValue\(\s*["']([^"']+)["']`, FlagTypeNumber},
-		{`useObjectFlagValue\(\s*["']([^"']+)["']`, FlagTypeObject},
-		{`useBooleanFlagDetails\(\s*["']([^"']+)["']`, FlagTypeBoolean},
-		{`useStringFlagDetails\(\s*["']([^"']+)["']`, FlagTypeString},
-		{`useNumberFlagDetails\(\s*["']([^"']+)["']`, FlagTypeNumber},
-		{`useObjectFlagDetails\(\s*["']([^"']+)["']`, FlagTypeObject},
-
-		// =====================================================================
-		// Python: OpenFeature SDK
-		// =====================================================================
-		{`\.get_boolean_value\(\s*["']([^"']+)["']`, FlagTypeBoolean},
-		{`\.get_string_value\(\s*["']([^"']+)["']`, FlagTypeString},
-		{`\.get_float_value\(\s*["']([^"']+)["']`, FlagTypeNumber},
-		{`\.get_integer_value\(\s*["']([^"']+)["']`, FlagTypeNumber},
-		{`\.get_object_value\(\s*["']([^"']+)["']`, FlagTypeObject},
-
-		// =====================================================================
-		// .NET: OpenFeature SDK
-		// =====================================================================
-		{`\.GetBooleanValueAsync\(\s*"([^"]+)"`, FlagTypeBoolean},
-		{`\.GetStringValueAsync\(\s*"([^"]+)"`, FlagTypeString},
-		{`\.GetDoubleValueAsync\(\s*"([^"]+)"`, FlagTypeNumber},
-		{`\.GetIntegerValueAsync\(\s*"([^"]+)"`, FlagTypeNumber},
-		{`\.GetObjectValueAsync\(\s*"([^"]+)"`, FlagTypeObject},
-
-		// =====================================================================
-		// Ruby: OpenFeature SDK
-		// =====================================================================
-		{`\.fetch_boolean_value\(\s*["']([^"']+)["']`, FlagTypeBoolean},
-		{`\.fetch_string_value\(\s*["']([^"']+)["']`, FlagTypeString},
-		{`\.fetch_number_value\(\s*["']([^"']+)["']`, FlagTypeNumber},
-		{`\.fetch_object_value\(\s*["']([^"']+)["']`, FlagTypeObject},
-	}
+	return compilePatterns(goPatterns, jsPatterns, pythonPatterns, dotnetPatterns, rubyPatterns)
+}
 
-	patterns := make([]FlagPattern, 0, len(raw))
-	for _, r := range raw {
-		patterns = append(patterns, FlagPattern{
-			Regex: regexp.MustCompile(r.pattern),
-			Type:  r.typ,
-		})
+// inferFlagType returns the type of a flag from the start of its default
+// value literal, defaulting to boolean.
+func inferFlagType(defaultValue string) FlagType {
+	switch {
+	case defaultValue == "":
+		return FlagTypeBoolean
+	case defaultValue == "true" || defaultValue == "false":
+		return FlagTypeBoolean
+	case defaultValue[0] == '{' || defaultValue[0] == '[':
+		return FlagTypeObject
+	case defaultValue[0] == '"' || defaultValue[0] == '\'' || defaultValue[0] == '`':
+		return FlagTypeString
+	default:
+		return FlagTypeNumber
 	}
-	return patterns
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// importPath is the manager API endpoint creating the flags of a manifest.
+const importPath = "/api/flags/import"
+
+// PushResult is the manager's response to a pushed manifest.
+type PushResult struct {
+	Created        int      `json:"created"`
+	Skipped        int      `json:"skipped"`
+	Errors         []string `json:"errors"`
+	ProjectCreated bool     `json:"projectCreated"`
+	New            []string `json:"new"`   // flags the push created
+	Known          []string `json:"known"` // flags the project already had
+}
+
+// pushManifest posts a manifest to the manager API at pushURL, its base URL,
+// which creates the project and the flags it does not have yet. apiKey may be
+// empty when the manager does not require authentication.
+func pushManifest(client *http.Client, pushURL, apiKey string, m Manifest) (*PushResult, error) {
+	data, err := m.ToJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := strings.TrimSuffix(pushURL, "/")
+	if !strings.HasSuffix(endpoint, importPath) {
+		endpoint += importPath
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("manager returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result PushResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid response from manager: %w", err)
+	}
+	return &result, nil
+}
+
+// Summary describes a push for the CI log.
+func (r *PushResult) Summary(project string) string {
+	var b strings.Builder
+	if r.ProjectCreated {
+		fmt.Fprintf(&b, "Created project %s\n", project)
+	}
+	fmt.Fprintf(&b, "%d new flags, %d known flags in %s\n", len(r.New), len(r.Known), project)
+	for _, key := range r.New {
+		fmt.Fprintf(&b, "  + %s\n", key)
+	}
+	for _, e := range r.Errors {
+		fmt.Fprintf(&b, "  ! %s\n", e)
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPushManifest(t *testing.T) {
+	var got Manifest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != importPath {
+			t.Errorf("expected a POST to %s, got %s", importPath, r.URL.Path)
+		}
+		if r.Header.Get("X-API-Key") != "secret" {
+			t.Errorf("expected the API key, got %q", r.Header.Get("X-API-Key"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"created":1,"skipped":1,"errors":[],"projectCreated":true,"new":["new-checkout"],"known":["dark-mode"]}`))
+	}))
+	defer server.Close()
+
+	flags := []DiscoveredFlag{
+		{Key: "dark-mode", Type: FlagTypeBoolean, Source: "main.go:10"},
+		{Key: "new-checkout", Type: FlagTypeBoolean, Source: "main.go:12"},
+	}
+	result, err := pushManifest(server.Client(), server.URL+"/", "secret", NewManifest("web", "web", "1.0.0", flags))
+	if err != nil {
+		t.Fatalf("pushManifest failed: %v", err)
+	}
+	if got.Project != "web" || len(got.Flags) != 2 || got.Metadata.Version != "1.0.0" {
+		t.Errorf("expected the manifest to be posted, got %+v", got)
+	}
+	if !result.ProjectCreated || len(result.New) != 1 || len(result.Known) != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	summary := result.Summary("web")
+	for _, want := range []string{"Created project web", "1 new flags, 1 known flags in web", "+ new-checkout"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("expected summary to contain %q, got:\n%s", want, summary)
+		}
+	}
+}
+
+func TestPushManifestError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"code":"FORBIDDEN"}`))
+	}))
+	defer server.Close()
+
+	// A full import URL is used as is
+	_, err := pushManifest(server.Client(), server.URL+importPath, "", NewManifest("web", "web", "", nil))
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected a 403 error, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	// unknownFlagRule is the rule of the results, one per call site of a
+	// flag missing from the baseline.
+	unknownFlagRule = "unknown-flag"
+)
+
+// SARIFLog is a SARIF 2.1.0 log, as uploaded to GitHub code scanning or
+// published by Azure DevOps pipelines.
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is the run of a single tool.
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool describes goff-scan and its rules.
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver is the tool component producing the results.
+type SARIFDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []SARIFRule `json:"rules"`
+}
+
+// SARIFRule is a kind of result.
+type SARIFRule struct {
+	ID                   string       `json:"id"`
+	Name                 string       `json:"name"`
+	ShortDescription     SARIFMessage `json:"shortDescription"`
+	FullDescription      SARIFMessage `json:"fullDescription"`
+	DefaultConfiguration struct {
+		Level string `json:"level"`
+	} `json:"defaultConfiguration"`
+}
+
+// SARIFMessage is a plain text message.
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFResult is a finding at a location.
+type SARIFResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             SARIFMessage      `json:"message"`
+	Locations           []SARIFLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+// SARIFLocation is a region of a file relative to the scanned directory.
+type SARIFLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI       string `json:"uri"`
+			URIBaseID string `json:"uriBaseId"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine   int `json:"startLine"`
+			StartColumn int `json:"startColumn,omitempty"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+// NewSARIF reports every call site of the flags as an unknown flag.
+func NewSARIF(flags []DiscoveredFlag) SARIFLog {
+	rule := SARIFRule{
+		ID:               unknownFlagRule,
+		Name:             "UnknownFeatureFlag",
+		ShortDescription: SARIFMessage{Text: "Feature flag not in the baseline"},
+		FullDescription: SARIFMessage{Text: "The code evaluates a feature flag that is not in the goff-scan baseline. " +
+			"Make sure the flag exists in the flag manager, then add it to the baseline."},
+	}
+	rule.DefaultConfiguration.Level = "warning"
+
+	results := []SARIFResult{}
+	for _, f := range flags {
+		for _, site := range f.CallSites {
+			result := SARIFResult{
+				RuleID:  unknownFlagRule,
+				Level:   "warning",
+				Message: SARIFMessage{Text: fmt.Sprintf("Feature flag %q is not in the baseline", f.Key)},
+				// Keeps a result the same across scans when lines move
+				PartialFingerprints: map[string]string{"flagKey/v1": f.Key},
+			}
+			var loc SARIFLocation
+			loc.PhysicalLocation.ArtifactLocation.URI = site.File
+			loc.PhysicalLocation.ArtifactLocation.URIBaseID = "%SRCROOT%"
+			loc.PhysicalLocation.Region.StartLine = site.Line
+			loc.PhysicalLocation.Region.StartColumn = site.Column
+			result.Locations = []SARIFLocation{loc}
+			results = append(results, result)
+		}
+	}
+
+	return SARIFLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []SARIFRun{{
+			Tool:    SARIFTool{Driver: SARIFDriver{Name: "goff-scan", Rules: []SARIFRule{rule}}},
+			Results: results,
+		}},
+	}
+}
+
+// ToJSON serializes the log to JSON.
+func (l SARIFLog) ToJSON() ([]byte, error) {
+	return json.MarshalIndent(l, "", "  ")
+}
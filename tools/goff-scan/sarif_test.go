@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSARIF(t *testing.T) {
+	flags := []DiscoveredFlag{
+		{Key: "dark-mode", Type: FlagTypeBoolean, CallSites: []CallSite{
+			{File: "src/app.ts", Line: 3, Column: 7, Language: "typescript", Call: "getBooleanValue", Type: FlagTypeBoolean},
+			{File: "src/nav.ts", Line: 9, Column: 2, Language: "typescript", Call: "useFlag", Type: FlagTypeBoolean},
+		}},
+		{Key: "banner", Type: FlagTypeString, CallSites: []CallSite{
+			{File: "app/home.py", Line: 1, Column: 10, Language: "python", Call: "get_string_value", Type: FlagTypeString},
+		}},
+	}
+	data, err := NewSARIF(flags).ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON failed: %v", err)
+	}
+
+	var log map[string]interface{}
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if log["version"] != "2.1.0" || log["$schema"] == nil {
+		t.Errorf("expected a SARIF 2.1.0 log, got %v", log)
+	}
+
+	var parsed SARIFLog
+	json.Unmarshal(data, &parsed)
+	run := parsed.Runs[0]
+	if run.Tool.Driver.Name != "goff-scan" || len(run.Tool.Driver.Rules) != 1 || run.Tool.Driver.Rules[0].ID != unknownFlagRule {
+		t.Errorf("expected the goff-scan driver and its rule, got %+v", run.Tool)
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("expected a result per call site, got %+v", run.Results)
+	}
+	result := run.Results[1]
+	loc := result.Locations[0].PhysicalLocation
+	if result.RuleID != unknownFlagRule || result.PartialFingerprints["flagKey/v1"] != "dark-mode" ||
+		loc.ArtifactLocation.URI != "src/nav.ts" || loc.Region.StartLine != 9 || loc.Region.StartColumn != 2 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// An empty scan still has a run, with no results
+	data, _ = NewSARIF(nil).ToJSON()
+	json.Unmarshal(data, &log)
+	results := log["runs"].([]interface{})[0].(map[string]interface{})["results"]
+	if r, ok := results.([]interface{}); !ok || len(r) != 0 {
+		t.Errorf("expected empty results, got %v", results)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	dir := t.TempDir()
+	old := NewManifest("web", "web", "1.0.0", []DiscoveredFlag{{Key: "dark-mode", Type: FlagTypeBoolean}})
+	flags := []DiscoveredFlag{{Key: "dark-mode"}, {Key: "new-checkout"}}
+
+	for name, serialize := range map[string]func() ([]byte, error){"yaml": old.ToYAML, "json": old.ToJSON} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "baseline."+name)
+			data, _ := serialize()
+			os.WriteFile(path, data, 0644)
+
+			baseline, err := LoadBaseline(path)
+			if err != nil {
+				t.Fatalf("LoadBaseline failed: %v", err)
+			}
+			unknown := baseline.Filter(flags)
+			if len(unknown) != 1 || unknown[0].Key != "new-checkout" {
+				t.Errorf("expected only the new flag, got %+v", unknown)
+			}
+		})
+	}
+
+	if unknown := Baseline(nil).Filter(flags); len(unknown) != 2 {
+		t.Errorf("expected every flag without a baseline, got %+v", unknown)
+	}
+	if _, err := LoadBaseline(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing baseline")
+	}
+}
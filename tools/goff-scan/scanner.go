@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"io/fs"
 	"os"
@@ -9,39 +8,31 @@ import (
 	"strings"
 )
 
-// scannableExtensions lists file extensions that should be scanned.
-var scannableExtensions = map[string]bool{
-	".go":    true,
-	".js":    true,
-	".jsx":   true,
-	".ts":    true,
-	".tsx":   true,
-	".py":    true,
-	".java":  true,
-	".kt":    true,
-	".swift": true,
-	".cs":    true,
-	".rb":    true,
-	".php":   true,
-}
-
 // Scanner walks a directory tree looking for feature flag evaluation calls.
 type Scanner struct {
-	patterns []FlagPattern
-	excludes []string
+	extractors map[string]*Extractor // by file extension
+	excludes   []string
 }
 
 // NewScanner creates a Scanner with the given exclude globs.
 func NewScanner(excludes []string) *Scanner {
+	byExtension := make(map[string]*Extractor)
+	for _, e := range extractors() {
+		for _, ext := range e.Extensions {
+			byExtension[ext] = e
+		}
+	}
 	return &Scanner{
-		patterns: allPatterns(),
-		excludes: excludes,
+		extractors: byExtension,
+		excludes:   excludes,
 	}
 }
 
-// Scan walks the directory and returns all discovered flags, deduplicated by key.
+// Scan walks the directory and returns all discovered flags, deduplicated by
+// key. Each flag lists every call site evaluating it; its type and source are
+// those of the first one.
 func (s *Scanner) Scan(root string) ([]DiscoveredFlag, error) {
-	seen := make(map[string]DiscoveredFlag)
+	seen := make(map[string]*DiscoveredFlag)
 
 	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
@@ -59,8 +50,8 @@ func (s *Scanner) Scan(root string) ([]DiscoveredFlag, error) {
 			return nil
 		}
 
-		ext := strings.ToLower(filepath.Ext(path))
-		if !scannableExtensions[ext] {
+		extractor := s.extractors[strings.ToLower(filepath.Ext(path))]
+		if extractor == nil {
 			return nil
 		}
 
@@ -68,7 +59,7 @@ func (s *Scanner) Scan(root string) ([]DiscoveredFlag, error) {
 			return nil
 		}
 
-		return s.scanFile(path, relPath, seen)
+		return s.scanFile(path, relPath, extractor, seen)
 	})
 	if err != nil {
 		return nil, err
@@ -77,7 +68,7 @@ func (s *Scanner) Scan(root string) ([]DiscoveredFlag, error) {
 	// Convert map to sorted slice (order by key for stable output)
 	flags := make([]DiscoveredFlag, 0, len(seen))
 	for _, f := range seen {
-		flags = append(flags, f)
+		flags = append(flags, *f)
 	}
 	sortFlags(flags)
 	return flags, nil
@@ -93,37 +84,46 @@ func (s *Scanner) shouldExclude(name string) bool {
 	return false
 }
 
-// scanFile reads a file line-by-line and tests every pattern against each line.
-func (s *Scanner) scanFile(path, relPath string, seen map[string]DiscoveredFlag) error {
-	f, err := os.Open(path)
+// scanFile extracts the flag evaluation calls of a file and records them as
+// call sites of their flags.
+func (s *Scanner) scanFile(path, relPath string, extractor *Extractor, seen map[string]*DiscoveredFlag) error {
+	src, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	lineNum := 0
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-		for _, p := range s.patterns {
-			matches := p.Regex.FindAllStringSubmatch(line, -1)
-			for _, m := range matches {
-				if len(m) < 2 {
-					continue
-				}
-				key := m[1]
-				if _, exists := seen[key]; !exists {
-					seen[key] = DiscoveredFlag{
-						Key:    key,
-						Type:   p.Type,
-						Source: fmt.Sprintf("%s:%d", relPath, lineNum),
-					}
-				}
+
+	for _, m := range extractor.Extract(src) {
+		f, exists := seen[m.Key]
+		if !exists {
+			f = &DiscoveredFlag{
+				Key:    m.Key,
+				Type:   m.Type,
+				Source: fmt.Sprintf("%s:%d", relPath, m.Line),
 			}
+			seen[m.Key] = f
+		}
+		if !containsString(f.Languages, extractor.Language) {
+			f.Languages = append(f.Languages, extractor.Language)
 		}
+		f.CallSites = append(f.CallSites, CallSite{
+			File:     relPath,
+			Line:     m.Line,
+			Column:   m.Column,
+			Language: extractor.Language,
+			Call:     m.Call,
+			Type:     m.Type,
+		})
 	}
-	return scanner.Err()
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
 }
 
 // sortFlags sorts flags by key alphabetically.
@@ -0,0 +1,10 @@
+import { useFlag, useSuspenseFlag } from '@openfeature/react-sdk';
+
+export function App() {
+  const { value: showNewMessage } = useFlag('new-message', true);
+  const { value: hero } = useSuspenseFlag('hero-variant', 'control');
+  const { value: table } = useFlag('pricing-table', { rows: 3 });
+  const { value: results } = useFlag('max-results', 20);
+
+  return showNewMessage ? <Hero variant={hero} table={table} results={results} /> : null;
+}
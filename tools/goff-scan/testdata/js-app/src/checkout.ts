@@ -0,0 +1,23 @@
+import { OpenFeature } from '@openfeature/server-sdk';
+import { GoFeatureFlagProvider } from '@openfeature/go-feature-flag-provider';
+
+OpenFeature.setProvider(new GoFeatureFlagProvider({ endpoint: 'http://localhost:1031' }));
+const client = OpenFeature.getClient();
+
+export async function checkout(ctx: EvaluationContext) {
+  const enabled = await client.getBooleanValue(
+    'one-click-checkout',
+    false,
+    ctx,
+  );
+  const currency = await client.getStringValue(`default-currency`, 'EUR', ctx);
+  const { value: retries } = await client.getNumberDetails("payment-retries", 3, ctx);
+
+  // client.getBooleanValue('legacy-checkout', false)
+  /*
+   * const old = client.getStringValue('legacy-currency', 'USD');
+   */
+  const docs = 'https://example.com/flags'; const limit = await client.getNumberValue('cart-limit', 50, ctx);
+
+  return { enabled, currency, retries, limit, docs };
+}
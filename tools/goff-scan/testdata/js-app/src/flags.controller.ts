@@ -0,0 +1,17 @@
+import { Controller, Get } from '@nestjs/common';
+import { BooleanFeatureFlag, EvaluationDetails } from '@openfeature/nestjs-sdk';
+import { Observable } from 'rxjs';
+
+@Controller()
+export class FlagsController {
+  @Get('/welcome')
+  public async welcome(
+    @BooleanFeatureFlag({
+      flagKey: 'nest-welcome',
+      defaultValue: false,
+    })
+    feature: Observable<EvaluationDetails<boolean>>,
+  ) {
+    return feature;
+  }
+}
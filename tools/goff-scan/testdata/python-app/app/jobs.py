@@ -0,0 +1,12 @@
+from app.views import client
+
+
+async def run_batch(ctx):
+    size = await client.get_integer_value_async(
+        default_value=100,
+        flag_key="batch-size",
+        evaluation_context=ctx,
+    )
+    weights = client.get_object_value('ranking-weights', {"recency": 0.5})
+    rate = client.get_float_details("sampling-rate", 0.1)
+    return size, weights, rate
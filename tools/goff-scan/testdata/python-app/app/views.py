@@ -0,0 +1,16 @@
+from openfeature import api
+from gofeatureflag_python_provider.provider import GoFeatureFlagProvider
+
+api.set_provider(GoFeatureFlagProvider(options=options))
+client = api.get_client()
+
+
+def admin_view(ctx):
+    is_admin = client.get_boolean_value(
+        flag_key="admin-panel",
+        default_value=False,
+        evaluation_context=ctx,
+    )
+    # client.get_boolean_value("legacy-admin", False)
+    banner = client.get_string_details("admin-banner", "Welcome #1", ctx)
+    return is_admin, banner.value